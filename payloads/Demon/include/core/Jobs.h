@@ -19,6 +19,7 @@ typedef struct _JOB_DATA
     SHORT             State;
     HANDLE            Handle;
     PVOID             Data;
+    UINT32            Sequence;
     struct _JOB_DATA* Next;
 } JOB_DATA, *PJOB_DATA;
 
@@ -0,0 +1,38 @@
+#ifndef DEMON_LDAP_H
+#define DEMON_LDAP_H
+
+#include <windows.h>
+
+#define LDAP_MAX_ATTRIBUTES  32
+#define LDAP_PAGE_SIZE       100
+
+typedef struct _LDAP_QUERY
+{
+    /* domain controller. the dc of the domain of the agent if empty */
+    PCHAR  Server;
+
+    /* base of the search. the default naming context if empty */
+    PCHAR  BaseDN;
+
+    /* rootDSE attribute of the naming context the base is relative to (configurationNamingContext) */
+    PCHAR  Context;
+    PCHAR  Filter;
+
+    /* comma separated attributes to return. every attribute if empty */
+    PCHAR  Attributes;
+    ULONG  Scope;
+    ULONG  PageSize;
+    ULONG  MaxEntries;
+} LDAP_QUERY, *PLDAP_QUERY;
+
+/*!
+ * Runs the paged ldap search using the token of the agent and
+ * sends every page of entries as its own package.
+ * @param Query search to run
+ * @return ldap status of the search
+ */
+ULONG LdapQuery(
+    IN PLDAP_QUERY Query
+);
+
+#endif
@@ -19,6 +19,9 @@ extern COFFAPIFUNC  NtApi[];
 #define CALLBACK_ERROR       0x0d
 #define CALLBACK_OUTPUT_UTF8 0x20
 
+/* ordered chunk of the output of a running job: [ Sequence ] [ Final ] [ Output ] */
+#define CALLBACK_OUTPUT_PARTIAL 0x21
+
 typedef struct {
     PCHAR  original; /* the original buffer [so we can free it] */
     PCHAR  buffer;   /* current pointer into our buffer */
@@ -0,0 +1,53 @@
+#ifndef DEMON_REGISTRY_H
+#define DEMON_REGISTRY_H
+
+#include <windows.h>
+
+#define REGISTRY_COMMAND_QUERY   0x1
+#define REGISTRY_COMMAND_ENUM    0x2
+#define REGISTRY_COMMAND_SET     0x3
+#define REGISTRY_COMMAND_DELETE  0x4
+
+/* items of the answer. the end item is followed by the status */
+#define REGISTRY_ITEM_END        0x0
+#define REGISTRY_ITEM_SUBKEY     0x1
+#define REGISTRY_ITEM_VALUE      0x2
+
+/* subkeys and values of an enumerated key that are sent at most */
+#define REGISTRY_MAX_ITEMS       1024
+/* bytes of the data of a value that are sent at most */
+#define REGISTRY_MAX_DATA        0x10000
+/* longest name of a key or value (in characters) */
+#define REGISTRY_MAX_NAME        16384
+
+typedef struct _REGISTRY_TASK
+{
+    UINT32 Command;
+
+    /* index into the predefined keys (HKLM, HKCU, HKU, HKCR, HKCC) */
+    UINT32 Hive;
+    PWCHAR Path;
+
+    /* value to query, set or delete. empty is the default value */
+    PWCHAR Name;
+
+    /* KEY_WOW64_32KEY or KEY_WOW64_64KEY to pick a registry view */
+    UINT32 View;
+
+    /* data of the value to set */
+    UINT32 Type;
+    PBYTE  Data;
+    UINT32 Size;
+} REGISTRY_TASK, *PREGISTRY_TASK;
+
+/*!
+ * Queries, enumerates or modifies the key and sends its subkeys and
+ * values. Modifications send the value as it was before the change.
+ * @param Task registry task to run
+ * @return win32 status of the task
+ */
+LSTATUS RegistryTask(
+    IN PREGISTRY_TASK Task
+);
+
+#endif
@@ -39,6 +39,14 @@ BOOL RtNetApi32(
     VOID
 );
 
+BOOL RtWldap32(
+    VOID
+);
+
+BOOL RtOle32(
+    VOID
+);
+
 BOOL RtWs2_32(
     VOID
 );
@@ -0,0 +1,64 @@
+#ifndef DEMON_SCRIPT_H
+#define DEMON_SCRIPT_H
+
+#include <windows.h>
+
+#define SCRIPT_MAX_VARS      64
+#define SCRIPT_MAX_TOKENS    16
+#define SCRIPT_MAX_NAME      32
+#define SCRIPT_MAX_VALUE     1024
+#define SCRIPT_MAX_DEPTH     16
+#define SCRIPT_MAX_ERROR     256
+
+/* value of the variable a command stores its result in if none has been specified */
+#define SCRIPT_VAR_RESULT    "_"
+
+typedef struct _SCRIPT_VAR
+{
+    CHAR  Name[ SCRIPT_MAX_NAME ];
+    PCHAR Value;
+} SCRIPT_VAR, *PSCRIPT_VAR;
+
+typedef struct _SCRIPT
+{
+    /* script source. lines separated by \n */
+    PCHAR      Source;
+    UINT32     Length;
+
+    /* arguments of the script ($1 - $n) */
+    PCHAR*     Args;
+    UINT32     ArgCount;
+
+    /* variables set by the script */
+    SCRIPT_VAR Vars[ SCRIPT_MAX_VARS ];
+    UINT32     VarCount;
+
+    /* output of the print command */
+    PCHAR      Output;
+    UINT32     OutputLength;
+    UINT32     OutputSize;
+
+    /* state of the script once it finished */
+    UINT32     Line;
+    INT32      ExitCode;
+    CHAR       Error[ SCRIPT_MAX_ERROR ];
+} SCRIPT, *PSCRIPT;
+
+/*!
+ * Executes the script line by line.
+ * @param Script script to run
+ * @return if the script finished without error
+ */
+BOOL ScriptRun(
+    IN OUT PSCRIPT Script
+);
+
+/*!
+ * Frees the variables and output of the script.
+ * @param Script script to free
+ */
+VOID ScriptFree(
+    IN OUT PSCRIPT Script
+);
+
+#endif
@@ -21,6 +21,11 @@
 #define SOCKET_COMMAND_WRITE        0x12
 #define SOCKET_COMMAND_CLOSE        0x13
 #define SOCKET_COMMAND_CONNECT      0x14
+#define SOCKET_COMMAND_WINDOW       0x15
+
+/* what the teamserver asks for at the connect of a socks client */
+#define SOCKET_FLAG_WINDOW          0x1
+#define SOCKET_FLAG_COMPRESS        0x2
 
 /* Errors */
 #define SOCKET_ERROR_ALREADY_BOUND  0x1
@@ -57,6 +62,12 @@ typedef struct _SOCKET_DATA
     DWORD FwdAddr;
     DWORD FwdPort;
 
+    /* SOCKET_FLAG_* agreed on at the connect */
+    DWORD Flags;
+
+    /* bytes written the teamserver hasn't been told about yet */
+    DWORD Written;
+
     /* pointer to the next Socket data */
     struct _SOCKET_DATA* Next;
 } SOCKET_DATA, *PSOCKET_DATA;
@@ -88,6 +99,24 @@ PSOCKET_DATA SocketNew( SOCKET WinSock, DWORD Type, BOOL UseIpv4, DWORD IPv4, PB
 /* Check for new connections, read everything from the sockets and or close "dead" sockets */
 VOID SocketPush();
 
+/*!
+ * Compresses a frame of a socks client (lznt1). The frame starts
+ * with the size of the data. A frame of the same size holds the
+ * data as is since it didn't get any smaller.
+ * @param Data
+ * @param Frame buffer allocated on the heap
+ * @return if the frame has been created
+ */
+BOOL SocketCompress( PBUFFER Data, PBUFFER Frame );
+
+/*!
+ * Decompresses a frame of a socks client (see SocketCompress).
+ * @param Frame
+ * @param Data buffer allocated on the heap
+ * @return if the frame has been decompressed
+ */
+BOOL SocketDecompress( PBUFFER Frame, PBUFFER Data );
+
 /*!
  * Query the IPv4 from the specified domain
  * @param Domain
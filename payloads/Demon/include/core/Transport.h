@@ -7,6 +7,9 @@
 
 #define PIPE_BUFFER_MAX 0x10000
 
+/* proxy mode sent by transports that don't use a proxy (smb) */
+#define TRANSPORT_PROXY_NONE 3
+
 /*!
  * Initialize HTTP/HTTPS Connection to C2 Server + using AES encryption or
  * Initializes a connection to the parent pivot over SMB + using AES encryption
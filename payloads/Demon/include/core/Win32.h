@@ -197,8 +197,17 @@ BOOL AnonPipesInit(
 );
 
 VOID AnonPipesRead(
-    IN PANONPIPE AnonPipes,
-    IN UINT32    RequestID
+    IN     PANONPIPE AnonPipes,
+    IN     UINT32    RequestID,
+    IN OUT PUINT32   Sequence
+);
+
+VOID OutputPartial(
+    IN     UINT32  RequestID,
+    IN OUT PUINT32 Sequence,
+    IN     PVOID   Buffer,
+    IN     DWORD   Size,
+    IN     BOOL    Final
 );
 
 BOOL PipeWrite(
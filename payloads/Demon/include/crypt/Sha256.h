@@ -0,0 +1,20 @@
+#ifndef _SHA256_H_
+#define _SHA256_H_
+
+#include <windows.h>
+
+#define SHA256_BLOCKLEN 64
+#define SHA256_HASHLEN  32
+
+typedef struct {
+    UINT32 State[ 8 ];
+    UINT64 Length;
+    UINT8  Block[ SHA256_BLOCKLEN ];
+    SIZE_T Used;
+} SHA256CTX, *PSHA256CTX ;
+
+void Sha256Init( PSHA256CTX ctx );
+void Sha256Update( PSHA256CTX ctx, const PUINT8 buf, SIZE_T length );
+void Sha256Final( PSHA256CTX ctx, PUINT8 hash );
+
+#endif // _SHA256_H_
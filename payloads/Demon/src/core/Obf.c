@@ -708,6 +708,13 @@ UINT32 SleepTime(
         }
     }
 
+    /* the teamserver asked us to slow down */
+    if ( Instance->Config.Transport.Backoff )
+    {
+        SleepTime += Instance->Config.Transport.Backoff;
+        Instance->Config.Transport.Backoff = 0;
+    }
+
     return SleepTime;
 }
 
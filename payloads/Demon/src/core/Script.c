@@ -0,0 +1,792 @@
+#include <Demon.h>
+
+#include <common/Macros.h>
+
+#include <core/MiniStd.h>
+#include <core/Memory.h>
+#include <core/Script.h>
+
+/*
+ * Small line based script engine to run bundled scripts without
+ * spawning an interpreter process (powershell.exe, cmd.exe).
+ *
+ * Every line is a command followed by its arguments, separated by
+ * whitespaces. Arguments can be quoted using "" and variables are
+ * expanded using $name or ${name}, script arguments using $1 - $n,
+ * the argument count using $# and a literal dollar using $$.
+ * Lines starting with # are comments.
+ *
+ *   set     <name> [value...]     set variable
+ *   print   [value...]            add line to the output
+ *   if      <a> == <b>            run block if equal (!= for not equal)
+ *   if      exists <path>         run block if path exists
+ *   if      <a>                   run block if a is not empty or 0
+ *   else / end                    end of if block
+ *   cat     <path> [var]          print content of file or store it in var
+ *   write   <path> [value...]     write file (append to append to file)
+ *   rm      <path>                remove file or empty directory
+ *   mkdir   <path>                create directory
+ *   cp/mv   <src> <dst>           copy/move file
+ *   ls      <path>                print the entries of the directory
+ *   cd      <path>                change working directory
+ *   pwd / hostname / whoami [var] print working directory/computer/user or store it in var
+ *   fail    [message...]          stop script with error
+ *   exit    [code]                stop script with exit code
+ */
+
+typedef struct _SCRIPT_LINE
+{
+    CHAR   Tokens[ SCRIPT_MAX_TOKENS ][ SCRIPT_MAX_VALUE ];
+    UINT32 Count;
+
+    /* arguments joined using spaces */
+    CHAR   Joined[ SCRIPT_MAX_VALUE ];
+} SCRIPT_LINE, *PSCRIPT_LINE;
+
+static BOOL ScriptError( PSCRIPT Script, PCHAR Message, PCHAR Detail )
+{
+    SIZE_T Length = 0;
+
+    MemZero( Script->Error, sizeof( Script->Error ) );
+
+    for ( ; *Message && Length < SCRIPT_MAX_ERROR - 1; Message++ ) {
+        Script->Error[ Length++ ] = *Message;
+    }
+
+    if ( Detail )
+    {
+        if ( Length < SCRIPT_MAX_ERROR - 3 ) {
+            Script->Error[ Length++ ] = ':';
+            Script->Error[ Length++ ] = ' ';
+        }
+
+        for ( ; *Detail && Length < SCRIPT_MAX_ERROR - 1; Detail++ ) {
+            Script->Error[ Length++ ] = *Detail;
+        }
+    }
+
+    if ( ! Script->ExitCode ) {
+        Script->ExitCode = 1;
+    }
+
+    return FALSE;
+}
+
+static VOID ScriptIntToString( INT32 Value, PCHAR Buffer )
+{
+    CHAR   Digits[ 12 ] = { 0 };
+    UINT32 Number       = Value < 0 ? -Value : Value;
+    INT    Length       = 0;
+
+    do {
+        Digits[ Length++ ] = '0' + ( Number % 10 );
+        Number /= 10;
+    } while ( Number );
+
+    if ( Value < 0 ) {
+        *Buffer++ = '-';
+    }
+
+    while ( Length ) {
+        *Buffer++ = Digits[ --Length ];
+    }
+
+    *Buffer = 0;
+}
+
+static BOOL ScriptStringToInt( PCHAR String, PINT32 Value )
+{
+    BOOL Negative = FALSE;
+
+    *Value = 0;
+
+    if ( *String == '-' ) {
+        Negative = TRUE;
+        String++;
+    }
+
+    if ( ! *String ) {
+        return FALSE;
+    }
+
+    for ( ; *String; String++ )
+    {
+        if ( *String < '0' || *String > '9' ) {
+            return FALSE;
+        }
+
+        *Value = *Value * 10 + ( *String - '0' );
+    }
+
+    if ( Negative ) {
+        *Value = -*Value;
+    }
+
+    return TRUE;
+}
+
+static BOOL ScriptNameChar( CHAR C )
+{
+    return ( C >= 'a' && C <= 'z' ) || ( C >= 'A' && C <= 'Z' ) || ( C >= '0' && C <= '9' ) || C == '_';
+}
+
+static PCHAR ScriptGetVar( PSCRIPT Script, PCHAR Name )
+{
+    for ( UINT32 i = 0; i < Script->VarCount; i++ )
+    {
+        if ( StringCompareA( Script->Vars[ i ].Name, Name ) == 0 ) {
+            return Script->Vars[ i ].Value;
+        }
+    }
+
+    return NULL;
+}
+
+static BOOL ScriptSetVar( PSCRIPT Script, PCHAR Name, PCHAR Value, UINT32 Length )
+{
+    PSCRIPT_VAR Var = NULL;
+
+    if ( ! *Name || ( *Name >= '0' && *Name <= '9' ) || StringLengthA( Name ) >= SCRIPT_MAX_NAME ) {
+        return ScriptError( Script, "invalid variable name", Name );
+    }
+
+    for ( PCHAR C = Name; *C; C++ )
+    {
+        if ( ! ScriptNameChar( *C ) ) {
+            return ScriptError( Script, "invalid variable name", Name );
+        }
+    }
+
+    for ( UINT32 i = 0; i < Script->VarCount; i++ )
+    {
+        if ( StringCompareA( Script->Vars[ i ].Name, Name ) == 0 ) {
+            Var = &Script->Vars[ i ];
+            break;
+        }
+    }
+
+    if ( ! Var )
+    {
+        if ( Script->VarCount == SCRIPT_MAX_VARS ) {
+            return ScriptError( Script, "too many variables", Name );
+        }
+
+        Var = &Script->Vars[ Script->VarCount++ ];
+        MemCopy( Var->Name, Name, StringLengthA( Name ) );
+    }
+
+    if ( Var->Value ) {
+        MmHeapFree( Var->Value );
+    }
+
+    /* zeroed by the allocation so the value is always null terminated */
+    Var->Value = MmHeapAlloc( Length + 1 );
+    MemCopy( Var->Value, Value, Length );
+
+    return TRUE;
+}
+
+static VOID ScriptPrint( PSCRIPT Script, PCHAR Text, UINT32 Length )
+{
+    if ( Script->OutputLength + Length + 1 > Script->OutputSize )
+    {
+        Script->OutputSize = ( Script->OutputLength + Length + 1 ) * 2;
+
+        if ( Script->Output ) {
+            Script->Output = MmHeapReAlloc( Script->Output, Script->OutputSize );
+        } else {
+            Script->Output = MmHeapAlloc( Script->OutputSize );
+        }
+    }
+
+    MemCopy( Script->Output + Script->OutputLength, Text, Length );
+    Script->OutputLength += Length;
+
+    if ( ! Length || Text[ Length - 1 ] != '\n' ) {
+        Script->Output[ Script->OutputLength++ ] = '\n';
+    }
+}
+
+/* expands the variable the line points to (after the $) and moves the line past it */
+static BOOL ScriptExpand( PSCRIPT Script, PCHAR* Line, PCHAR Token, PUINT32 Length )
+{
+    CHAR   Name[ SCRIPT_MAX_NAME ] = { 0 };
+    CHAR   Count[ 12 ]             = { 0 };
+    UINT32 NameLength              = 0;
+    PCHAR  Value                   = NULL;
+    BOOL   Braces                  = FALSE;
+    INT32  Index                   = 0;
+
+    if ( **Line == '$' ) {
+        Value = "$";
+        ( *Line )++;
+    }
+    else if ( **Line == '#' ) {
+        ScriptIntToString( Script->ArgCount, Count );
+        Value = Count;
+        ( *Line )++;
+    }
+    else
+    {
+        if ( **Line == '{' ) {
+            Braces = TRUE;
+            ( *Line )++;
+        }
+
+        while ( ScriptNameChar( **Line ) )
+        {
+            if ( NameLength == SCRIPT_MAX_NAME - 1 ) {
+                return ScriptError( Script, "variable name too long", NULL );
+            }
+
+            Name[ NameLength++ ] = *( *Line )++;
+        }
+
+        if ( Braces )
+        {
+            if ( **Line != '}' ) {
+                return ScriptError( Script, "missing } of variable", Name );
+            }
+
+            ( *Line )++;
+        }
+
+        if ( ! NameLength ) {
+            Value = "$";
+        }
+        else if ( ScriptStringToInt( Name, &Index ) ) {
+            Value = ( Index > 0 && Index <= Script->ArgCount ) ? Script->Args[ Index - 1 ] : "";
+        }
+        else if ( ! ( Value = ScriptGetVar( Script, Name ) ) ) {
+            Value = "";
+        }
+    }
+
+    for ( ; *Value; Value++ )
+    {
+        if ( *Length == SCRIPT_MAX_VALUE - 1 ) {
+            return ScriptError( Script, "value too long", Name );
+        }
+
+        Token[ ( *Length )++ ] = *Value;
+    }
+
+    return TRUE;
+}
+
+static BOOL ScriptTokenize( PSCRIPT Script, PCHAR Line, PSCRIPT_LINE Tokens )
+{
+    PCHAR  Token  = NULL;
+    UINT32 Length = 0;
+    BOOL   Quoted = FALSE;
+
+    Tokens->Count = 0;
+
+    while ( *Line )
+    {
+        while ( *Line == ' ' || *Line == '\t' ) {
+            Line++;
+        }
+
+        if ( ! *Line || *Line == '#' ) {
+            break;
+        }
+
+        if ( Tokens->Count == SCRIPT_MAX_TOKENS ) {
+            return ScriptError( Script, "too many arguments", NULL );
+        }
+
+        Token  = Tokens->Tokens[ Tokens->Count++ ];
+        Length = 0;
+        MemZero( Token, SCRIPT_MAX_VALUE );
+
+        while ( *Line )
+        {
+            if ( *Line == '"' ) {
+                Quoted = ! Quoted;
+                Line++;
+                continue;
+            }
+
+            if ( ! Quoted && ( *Line == ' ' || *Line == '\t' ) ) {
+                break;
+            }
+
+            if ( *Line == '$' )
+            {
+                Line++;
+
+                if ( ! ScriptExpand( Script, &Line, Token, &Length ) ) {
+                    return FALSE;
+                }
+
+                continue;
+            }
+
+            if ( Length == SCRIPT_MAX_VALUE - 1 ) {
+                return ScriptError( Script, "value too long", NULL );
+            }
+
+            Token[ Length++ ] = *Line++;
+        }
+
+        if ( Quoted ) {
+            return ScriptError( Script, "unterminated quote", NULL );
+        }
+    }
+
+    return TRUE;
+}
+
+/* joins the tokens starting at the index using spaces */
+static PCHAR ScriptJoin( PSCRIPT_LINE Tokens, UINT32 Start )
+{
+    UINT32 Length = 0;
+
+    MemZero( Tokens->Joined, SCRIPT_MAX_VALUE );
+
+    for ( UINT32 i = Start; i < Tokens->Count; i++ )
+    {
+        if ( i > Start && Length < SCRIPT_MAX_VALUE - 1 ) {
+            Tokens->Joined[ Length++ ] = ' ';
+        }
+
+        for ( PCHAR C = Tokens->Tokens[ i ]; *C && Length < SCRIPT_MAX_VALUE - 1; C++ ) {
+            Tokens->Joined[ Length++ ] = *C;
+        }
+    }
+
+    return Tokens->Joined;
+}
+
+/* stores the value in the variable or prints it if no variable has been specified */
+static BOOL ScriptResult( PSCRIPT Script, PSCRIPT_LINE Tokens, UINT32 Index, PCHAR Value, UINT32 Length )
+{
+    if ( Tokens->Count > Index ) {
+        return ScriptSetVar( Script, Tokens->Tokens[ Index ], Value, Length );
+    }
+
+    ScriptPrint( Script, Value, Length );
+
+    return TRUE;
+}
+
+static BOOL ScriptArgs( PSCRIPT Script, PSCRIPT_LINE Tokens, UINT32 Min )
+{
+    if ( Tokens->Count - 1 < Min ) {
+        return ScriptError( Script, "missing arguments", Tokens->Tokens[ 0 ] );
+    }
+
+    return TRUE;
+}
+
+static BOOL ScriptWin32Error( PSCRIPT Script, PCHAR Command, PCHAR Path )
+{
+    CHAR Error[ 12 ] = { 0 };
+
+    ScriptIntToString( NtGetLastError(), Error );
+    ScriptError( Script, Command, Path );
+
+    if ( StringLengthA( Script->Error ) + StringLengthA( Error ) + 9 < SCRIPT_MAX_ERROR ) {
+        StringConcatA( Script->Error, " (error " );
+        StringConcatA( Script->Error, Error );
+        StringConcatA( Script->Error, ")" );
+    }
+
+    return FALSE;
+}
+
+static BOOL ScriptFileRead( PSCRIPT Script, PSCRIPT_LINE Tokens )
+{
+    WCHAR  Path[ SCRIPT_MAX_VALUE ] = { 0 };
+    HANDLE File                      = NULL;
+    PCHAR  Content                   = NULL;
+    DWORD  Size                      = 0;
+    DWORD  Read                      = 0;
+    BOOL   Success                   = FALSE;
+
+    CharStringToWCharString( Path, Tokens->Tokens[ 1 ], SCRIPT_MAX_VALUE - 1 );
+
+    File = Instance->Win32.CreateFileW( Path, GENERIC_READ, FILE_SHARE_READ, NULL, OPEN_EXISTING, 0, NULL );
+    if ( ( ! File ) || ( File == INVALID_HANDLE_VALUE ) ) {
+        return ScriptWin32Error( Script, "failed to open file", Tokens->Tokens[ 1 ] );
+    }
+
+    Size    = Instance->Win32.GetFileSize( File, NULL );
+    Content = MmHeapAlloc( Size + 1 );
+
+    if ( Instance->Win32.ReadFile( File, Content, Size, &Read, NULL ) ) {
+        Success = ScriptResult( Script, Tokens, 2, Content, Read );
+    } else {
+        ScriptWin32Error( Script, "failed to read file", Tokens->Tokens[ 1 ] );
+    }
+
+    SysNtClose( File );
+
+    MemZero( Content, Size );
+    MmHeapFree( Content );
+
+    return Success;
+}
+
+static BOOL ScriptFileWrite( PSCRIPT Script, PSCRIPT_LINE Tokens, BOOL Append )
+{
+    WCHAR  Path[ SCRIPT_MAX_VALUE ] = { 0 };
+    HANDLE File                      = NULL;
+    PCHAR  Content                   = ScriptJoin( Tokens, 2 );
+    DWORD  Written                   = 0;
+    BOOL   Success                   = FALSE;
+
+    CharStringToWCharString( Path, Tokens->Tokens[ 1 ], SCRIPT_MAX_VALUE - 1 );
+
+    File = Instance->Win32.CreateFileW( Path, Append ? FILE_APPEND_DATA : GENERIC_WRITE, 0, NULL, Append ? OPEN_ALWAYS : CREATE_ALWAYS, FILE_ATTRIBUTE_NORMAL, NULL );
+    if ( ( ! File ) || ( File == INVALID_HANDLE_VALUE ) ) {
+        return ScriptWin32Error( Script, "failed to open file", Tokens->Tokens[ 1 ] );
+    }
+
+    if ( ! ( Success = Instance->Win32.WriteFile( File, Content, StringLengthA( Content ), &Written, NULL ) ) ) {
+        ScriptWin32Error( Script, "failed to write file", Tokens->Tokens[ 1 ] );
+    }
+
+    SysNtClose( File );
+
+    return Success;
+}
+
+static BOOL ScriptList( PSCRIPT Script, PSCRIPT_LINE Tokens )
+{
+    WCHAR            Path[ SCRIPT_MAX_VALUE ]  = { 0 };
+    CHAR             Name[ MAX_PATH * 2 ]       = { 0 };
+    WIN32_FIND_DATAW Data                       = { 0 };
+    HANDLE           Find                       = NULL;
+    SIZE_T           Length                     = 0;
+
+    Length = CharStringToWCharString( Path, Tokens->Tokens[ 1 ], SCRIPT_MAX_VALUE - 4 );
+
+    if ( Length && Path[ Length - 1 ] != L'\\' ) {
+        Path[ Length++ ] = L'\\';
+    }
+
+    Path[ Length ] = L'*';
+
+    if ( ( Find = Instance->Win32.FindFirstFileW( Path, &Data ) ) == INVALID_HANDLE_VALUE ) {
+        return ScriptWin32Error( Script, "failed to list directory", Tokens->Tokens[ 1 ] );
+    }
+
+    do {
+        if ( StringCompareW( Data.cFileName, L"." ) == 0 || StringCompareW( Data.cFileName, L".." ) == 0 ) {
+            continue;
+        }
+
+        MemZero( Name, sizeof( Name ) );
+        Length = WCharStringToCharString( Name, Data.cFileName, sizeof( Name ) - 2 );
+
+        if ( Data.dwFileAttributes & FILE_ATTRIBUTE_DIRECTORY ) {
+            Name[ Length++ ] = '\\';
+        }
+
+        ScriptPrint( Script, Name, Length );
+    } while ( Instance->Win32.FindNextFileW( Find, &Data ) );
+
+    Instance->Win32.FindClose( Find );
+
+    return TRUE;
+}
+
+static BOOL ScriptPath( PSCRIPT Script, PSCRIPT_LINE Tokens )
+{
+    PCHAR Command                    = Tokens->Tokens[ 0 ];
+    WCHAR Path[ SCRIPT_MAX_VALUE ]  = { 0 };
+    WCHAR Path2[ SCRIPT_MAX_VALUE ] = { 0 };
+    BOOL  Success                    = FALSE;
+
+    CharStringToWCharString( Path, Tokens->Tokens[ 1 ], SCRIPT_MAX_VALUE - 1 );
+
+    if ( StringCompareA( Command, "rm" ) == 0 ) {
+        Success = Instance->Win32.DeleteFileW( Path ) || Instance->Win32.RemoveDirectoryW( Path );
+    }
+    else if ( StringCompareA( Command, "mkdir" ) == 0 ) {
+        Success = Instance->Win32.CreateDirectoryW( Path, NULL );
+    }
+    else if ( StringCompareA( Command, "cd" ) == 0 ) {
+        Success = Instance->Win32.SetCurrentDirectoryW( Path );
+    }
+    else
+    {
+        if ( ! ScriptArgs( Script, Tokens, 2 ) ) {
+            return FALSE;
+        }
+
+        CharStringToWCharString( Path2, Tokens->Tokens[ 2 ], SCRIPT_MAX_VALUE - 1 );
+
+        if ( StringCompareA( Command, "cp" ) == 0 ) {
+            Success = Instance->Win32.CopyFileW( Path, Path2, FALSE );
+        } else {
+            Success = Instance->Win32.MoveFileExW( Path, Path2, MOVEFILE_REPLACE_EXISTING | MOVEFILE_COPY_ALLOWED );
+        }
+    }
+
+    if ( ! Success ) {
+        return ScriptWin32Error( Script, Command, Tokens->Tokens[ 1 ] );
+    }
+
+    return TRUE;
+}
+
+static BOOL ScriptInfo( PSCRIPT Script, PSCRIPT_LINE Tokens )
+{
+    PCHAR Command                      = Tokens->Tokens[ 0 ];
+    CHAR  Value[ SCRIPT_MAX_VALUE ]   = { 0 };
+    WCHAR Path[ MAX_PATH ]             = { 0 };
+    DWORD Length                       = SCRIPT_MAX_VALUE - 1;
+    BOOL  Success                      = FALSE;
+
+    if ( StringCompareA( Command, "pwd" ) == 0 )
+    {
+        if ( ( Success = Instance->Win32.GetCurrentDirectoryW( MAX_PATH, Path ) ) ) {
+            Length = WCharStringToCharString( Value, Path, SCRIPT_MAX_VALUE - 1 );
+        }
+    }
+    else if ( StringCompareA( Command, "hostname" ) == 0 ) {
+        Success = Instance->Win32.GetComputerNameExA( ComputerNameNetBIOS, Value, &Length );
+    }
+    else if ( Instance->Win32.GetUserNameA )
+    {
+        if ( ( Success = Instance->Win32.GetUserNameA( Value, &Length ) ) ) {
+            Length = StringLengthA( Value );
+        }
+    }
+
+    if ( ! Success ) {
+        return ScriptWin32Error( Script, Command, NULL );
+    }
+
+    return ScriptResult( Script, Tokens, 1, Value, Length );
+}
+
+static BOOL ScriptCondition( PSCRIPT Script, PSCRIPT_LINE Tokens, PBOOL Result )
+{
+    WCHAR Path[ SCRIPT_MAX_VALUE ] = { 0 };
+
+    if ( Tokens->Count == 2 ) {
+        *Result = Tokens->Tokens[ 1 ][ 0 ] && StringCompareA( Tokens->Tokens[ 1 ], "0" ) != 0;
+    }
+    else if ( Tokens->Count == 3 && StringCompareA( Tokens->Tokens[ 1 ], "exists" ) == 0 ) {
+        CharStringToWCharString( Path, Tokens->Tokens[ 2 ], SCRIPT_MAX_VALUE - 1 );
+        *Result = Instance->Win32.GetFileAttributesW( Path ) != INVALID_FILE_ATTRIBUTES;
+    }
+    else if ( Tokens->Count == 4 && StringCompareA( Tokens->Tokens[ 2 ], "==" ) == 0 ) {
+        *Result = StringCompareA( Tokens->Tokens[ 1 ], Tokens->Tokens[ 3 ] ) == 0;
+    }
+    else if ( Tokens->Count == 4 && StringCompareA( Tokens->Tokens[ 2 ], "!=" ) == 0 ) {
+        *Result = StringCompareA( Tokens->Tokens[ 1 ], Tokens->Tokens[ 3 ] ) != 0;
+    }
+    else {
+        return ScriptError( Script, "invalid if condition", NULL );
+    }
+
+    return TRUE;
+}
+
+/* runs the command of the line. Stop is set by exit/fail */
+static BOOL ScriptCommand( PSCRIPT Script, PSCRIPT_LINE Tokens, PBOOL Stop )
+{
+    PCHAR Command = Tokens->Tokens[ 0 ];
+    PCHAR Value   = NULL;
+
+    if ( StringCompareA( Command, "set" ) == 0 )
+    {
+        if ( ! ScriptArgs( Script, Tokens, 1 ) ) {
+            return FALSE;
+        }
+
+        Value = ScriptJoin( Tokens, 2 );
+        return ScriptSetVar( Script, Tokens->Tokens[ 1 ], Value, StringLengthA( Value ) );
+    }
+    else if ( StringCompareA( Command, "print" ) == 0 ) {
+        Value = ScriptJoin( Tokens, 1 );
+        ScriptPrint( Script, Value, StringLengthA( Value ) );
+        return TRUE;
+    }
+    else if ( StringCompareA( Command, "cat" ) == 0 ) {
+        return ScriptArgs( Script, Tokens, 1 ) && ScriptFileRead( Script, Tokens );
+    }
+    else if ( StringCompareA( Command, "write" ) == 0 || StringCompareA( Command, "append" ) == 0 ) {
+        return ScriptArgs( Script, Tokens, 1 ) && ScriptFileWrite( Script, Tokens, Command[ 0 ] == 'a' );
+    }
+    else if ( StringCompareA( Command, "ls" ) == 0 ) {
+        return ScriptArgs( Script, Tokens, 1 ) && ScriptList( Script, Tokens );
+    }
+    else if (
+        StringCompareA( Command, "rm" ) == 0 || StringCompareA( Command, "mkdir" ) == 0 ||
+        StringCompareA( Command, "cd" ) == 0 || StringCompareA( Command, "cp" ) == 0   ||
+        StringCompareA( Command, "mv" ) == 0
+    ) {
+        return ScriptArgs( Script, Tokens, 1 ) && ScriptPath( Script, Tokens );
+    }
+    else if ( StringCompareA( Command, "pwd" ) == 0 || StringCompareA( Command, "hostname" ) == 0 || StringCompareA( Command, "whoami" ) == 0 ) {
+        return ScriptInfo( Script, Tokens );
+    }
+    else if ( StringCompareA( Command, "fail" ) == 0 ) {
+        *Stop = TRUE;
+        return ScriptError( Script, Tokens->Count > 1 ? ScriptJoin( Tokens, 1 ) : "script failed", NULL );
+    }
+    else if ( StringCompareA( Command, "exit" ) == 0 )
+    {
+        *Stop = TRUE;
+
+        if ( Tokens->Count > 1 && ! ScriptStringToInt( Tokens->Tokens[ 1 ], &Script->ExitCode ) ) {
+            return ScriptError( Script, "invalid exit code", Tokens->Tokens[ 1 ] );
+        }
+
+        return TRUE;
+    }
+
+    return ScriptError( Script, "unknown command", Command );
+}
+
+BOOL ScriptRun(
+    IN OUT PSCRIPT Script
+) {
+    PSCRIPT_LINE Tokens                     = NULL;
+    PCHAR        Source                     = NULL;
+    PCHAR        Line                       = NULL;
+    PCHAR        Next                       = NULL;
+    BOOL         Cond[ SCRIPT_MAX_DEPTH ]   = { 0 };
+    BOOL         Else[ SCRIPT_MAX_DEPTH ]   = { 0 };
+    UINT32       Depth                      = 0;
+    BOOL         Active                     = TRUE;
+    BOOL         Result                     = FALSE;
+    BOOL         Stop                       = FALSE;
+    BOOL         Success                    = TRUE;
+
+    if ( ! Script->Source || ! Script->Length ) {
+        return ScriptError( Script, "empty script", NULL );
+    }
+
+    Tokens = MmHeapAlloc( sizeof( SCRIPT_LINE ) );
+    Source = MmHeapAlloc( Script->Length + 1 );
+    MemCopy( Source, Script->Source, Script->Length );
+
+    for ( Line = Source; Line && *Line && Success && ! Stop; Line = Next )
+    {
+        Script->Line++;
+
+        if ( ( Next = Line ) )
+        {
+            while ( *Next && *Next != '\n' ) {
+                Next++;
+            }
+
+            if ( *Next ) {
+                *Next++ = 0;
+            } else {
+                Next = NULL;
+            }
+        }
+
+        for ( PCHAR C = Line; *C; C++ )
+        {
+            if ( *C == '\r' ) {
+                *C = 0;
+                break;
+            }
+        }
+
+        if ( ! ( Success = ScriptTokenize( Script, Line, Tokens ) ) ) {
+            break;
+        }
+
+        if ( ! Tokens->Count ) {
+            continue;
+        }
+
+        if ( StringCompareA( Tokens->Tokens[ 0 ], "if" ) == 0 )
+        {
+            if ( Depth == SCRIPT_MAX_DEPTH ) {
+                Success = ScriptError( Script, "if blocks nested too deep", NULL );
+                break;
+            }
+
+            /* conditions inside of skipped blocks are not evaluated */
+            Result = FALSE;
+            if ( Active && ! ( Success = ScriptCondition( Script, Tokens, &Result ) ) ) {
+                break;
+            }
+
+            Cond[ Depth ] = Result;
+            Else[ Depth ] = FALSE;
+            Depth++;
+        }
+        else if ( StringCompareA( Tokens->Tokens[ 0 ], "else" ) == 0 )
+        {
+            if ( ! Depth || Else[ Depth - 1 ] ) {
+                Success = ScriptError( Script, "else without if", NULL );
+                break;
+            }
+
+            Else[ Depth - 1 ] = TRUE;
+            Cond[ Depth - 1 ] = ! Cond[ Depth - 1 ];
+        }
+        else if ( StringCompareA( Tokens->Tokens[ 0 ], "end" ) == 0 )
+        {
+            if ( ! Depth ) {
+                Success = ScriptError( Script, "end without if", NULL );
+                break;
+            }
+
+            Depth--;
+        }
+        else if ( Active )
+        {
+            Success = ScriptCommand( Script, Tokens, &Stop );
+            continue;
+        }
+
+        /* block is only active if every enclosing block is */
+        Active = TRUE;
+        for ( UINT32 i = 0; i < Depth; i++ ) {
+            Active = Active && Cond[ i ];
+        }
+    }
+
+    if ( Success && ! Stop && Depth ) {
+        Success = ScriptError( Script, "missing end of if block", NULL );
+    }
+
+    if ( Success ) {
+        Script->Line = 0;
+    }
+
+    MemZero( Tokens, sizeof( SCRIPT_LINE ) );
+    MmHeapFree( Tokens );
+
+    MemZero( Source, Script->Length );
+    MmHeapFree( Source );
+
+    return Success;
+}
+
+VOID ScriptFree(
+    IN OUT PSCRIPT Script
+) {
+    for ( UINT32 i = 0; i < Script->VarCount; i++ )
+    {
+        if ( Script->Vars[ i ].Value ) {
+            MemZero( Script->Vars[ i ].Value, StringLengthA( Script->Vars[ i ].Value ) );
+            MmHeapFree( Script->Vars[ i ].Value );
+            Script->Vars[ i ].Value = NULL;
+        }
+    }
+
+    if ( Script->Output ) {
+        MemZero( Script->Output, Script->OutputSize );
+        MmHeapFree( Script->Output );
+        Script->Output = NULL;
+    }
+
+    if ( Script->Args ) {
+        MmHeapFree( Script->Args );
+        Script->Args = NULL;
+    }
+}
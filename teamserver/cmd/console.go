@@ -0,0 +1,86 @@
+package cmd
+
+import (
+	"errors"
+	"os"
+	"strings"
+	"time"
+
+	"Havoc/pkg/console"
+	"Havoc/pkg/sdk"
+
+	"github.com/spf13/cobra"
+)
+
+var (
+	consoleFlags struct {
+		Teamserver  string
+		User        string
+		Password    string
+		Token       string
+		Directory   bool
+		Prefix      string
+		Fingerprint string
+		Timeout     time.Duration
+	}
+
+	CobraConsole = &cobra.Command{
+		Use:          "console",
+		Short:        "terminal operator client",
+		Long:         "Connects to a teamserver as an operator from the terminal, for operators working over ssh where the graphical client isn't practical.\nLists and interacts with the agents (shell, sleep, download, upload, ...) and sends to and shows the chat of the operators.",
+		Args:         cobra.NoArgs,
+		SilenceUsage: true,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			var Config = console.Config{
+				Config: sdk.Config{
+					Address:     consoleFlags.Teamserver,
+					User:        consoleFlags.User,
+					Password:    consoleFlags.Password,
+					Token:       consoleFlags.Token,
+					Directory:   consoleFlags.Directory,
+					Prefix:      consoleFlags.Prefix,
+					Fingerprint: consoleFlags.Fingerprint,
+					Timeout:     consoleFlags.Timeout,
+				},
+			}
+
+			/* keeps the password out of the process list */
+			if len(Config.Password) == 0 {
+				Config.Password = os.Getenv("HAVOC_PASSWORD")
+			}
+
+			if len(Config.Token) == 0 {
+				Config.Token = os.Getenv("HAVOC_TOKEN")
+			}
+
+			/* the name of an operator of the identity provider is in its token */
+			if len(Config.Address) == 0 || (len(Config.Token) == 0 && (len(Config.User) == 0 || len(Config.Password) == 0)) {
+				return errors.New("specify the teamserver with --teamserver and the operator with --user and --password or --token")
+			}
+
+			if Config.Directory && len(Config.Fingerprint) == 0 {
+				return errors.New("--directory sends the password in the clear, specify the --fingerprint of the teamserver")
+			}
+
+			if len(Config.Prefix) > 0 {
+				Config.Prefix = "/" + strings.Trim(Config.Prefix, "/")
+			}
+
+			return console.Run(Config)
+		},
+	}
+)
+
+func init() {
+	CobraConsole.Flags().SortFlags = false
+	CobraConsole.Flags().StringVarP(&consoleFlags.Teamserver, "teamserver", "", "", "teamserver (host:port) to connect to")
+	CobraConsole.Flags().StringVarP(&consoleFlags.User, "user", "", "", "operator to log in as")
+	CobraConsole.Flags().StringVarP(&consoleFlags.Password, "password", "", "", "password of the operator (default is $HAVOC_PASSWORD)")
+	CobraConsole.Flags().StringVarP(&consoleFlags.Token, "token", "", "", "id token of the identity provider of the teamserver (default is $HAVOC_TOKEN)")
+	CobraConsole.Flags().BoolVarP(&consoleFlags.Directory, "directory", "", false, "the operator is one of the directory (ldap) of the teamserver")
+	CobraConsole.Flags().StringVarP(&consoleFlags.Prefix, "prefix", "", "", "path prefix of the operator api of the teamserver behind a cdn or reverse proxy")
+	CobraConsole.Flags().StringVarP(&consoleFlags.Fingerprint, "fingerprint", "", "", "sha256 fingerprint of the certificate of the teamserver to verify")
+	CobraConsole.Flags().DurationVarP(&consoleFlags.Timeout, "timeout", "", sdk.LOGIN_TIMEOUT, "how long the login may take")
+
+	HavocCli.AddCommand(CobraConsole)
+}
@@ -0,0 +1,123 @@
+package cmd
+
+import (
+	"errors"
+	"fmt"
+	"os"
+
+	"Havoc/pkg/colors"
+	"Havoc/pkg/db"
+	"Havoc/pkg/logger"
+	"Havoc/pkg/profile"
+
+	"github.com/spf13/cobra"
+)
+
+var (
+	migrateFlags struct {
+		Profile  string
+		Secrets  string
+		Database string
+		DryRun   bool
+	}
+
+	CobraMigrate = &cobra.Command{
+		Use:          "migrate",
+		Short:        "migrate the profile and database of an older teamserver",
+		Long:         "Brings the profile and the database up to the format of this teamserver. The teamserver does the same on start, this shows what changes (--dry-run) or upgrades without starting it.\nThe migrations of the database run in a single transaction and the ones of the profile have to result in a profile that loads, nothing changes if one of them fails. The old profile and database are kept as <file>.v<version>.bak.",
+		SilenceUsage: true,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			if len(migrateFlags.Profile) == 0 && len(migrateFlags.Database) == 0 {
+				return errors.New("specify the profile with --profile and/or the database with --database")
+			}
+
+			if len(migrateFlags.Profile) > 0 {
+				if err := migrateProfile(); err != nil {
+					return err
+				}
+			}
+
+			if len(migrateFlags.Database) > 0 {
+				if err := migrateDatabase(); err != nil {
+					return err
+				}
+			}
+
+			return nil
+		},
+	}
+)
+
+func init() {
+	CobraMigrate.Flags().SortFlags = false
+	CobraMigrate.Flags().StringVarP(&migrateFlags.Profile, "profile", "", "", "profile to migrate")
+	CobraMigrate.Flags().StringVarP(&migrateFlags.Secrets, "secrets", "", "", "set file of the secrets the profile interpolates (${NAME})")
+	CobraMigrate.Flags().StringVarP(&migrateFlags.Database, "database", "", "", "database to migrate")
+	CobraMigrate.Flags().BoolVarP(&migrateFlags.DryRun, "dry-run", "", false, "show what would change without changing anything")
+
+	HavocCli.AddCommand(CobraMigrate)
+}
+
+func migrateProfile() error {
+	Plan, err := profile.Migrate(migrateFlags.Profile, migrateFlags.Secrets, migrateFlags.DryRun)
+	if err != nil {
+		return fmt.Errorf("failed to migrate the profile: %w", err)
+	}
+
+	if len(Plan.Migrations) == 0 {
+		logger.Info(fmt.Sprintf("Profile %v is up to date (version %v)", colors.Blue(migrateFlags.Profile), Plan.From))
+		return nil
+	}
+
+	for _, Migration := range Plan.Migrations {
+		logger.Info(fmt.Sprintf("Profile migration %v: %v", Migration.Version, Migration.Description))
+	}
+
+	if migrateFlags.DryRun {
+		logger.Info(fmt.Sprintf("Profile %v would be migrated from version %v to %v:", colors.Blue(migrateFlags.Profile), Plan.From, Plan.To))
+		fmt.Println(Plan.Diff)
+	} else {
+		logger.Info(fmt.Sprintf("Migrated profile %v from version %v to %v (backup: %v.v%v.bak)", colors.Blue(migrateFlags.Profile), Plan.From, Plan.To, migrateFlags.Profile, Plan.From))
+	}
+
+	return nil
+}
+
+func migrateDatabase() error {
+	if _, err := os.Stat(migrateFlags.Database); err != nil {
+		return fmt.Errorf("failed to open the database: %w", err)
+	}
+
+	Database, err := db.DatabaseOpen(migrateFlags.Database)
+	if err != nil {
+		return err
+	}
+	defer Database.Close()
+
+	Version, err := Database.Version()
+	if err != nil {
+		return err
+	}
+
+	Migrations, err := Database.Migrate(migrateFlags.DryRun)
+	if err != nil {
+		return fmt.Errorf("failed to migrate the database: %w", err)
+	}
+
+	if len(Migrations) == 0 {
+		logger.Info(fmt.Sprintf("Database %v is up to date (version %v)", colors.Blue(migrateFlags.Database), Version))
+		return nil
+	}
+
+	for _, Migration := range Migrations {
+		logger.Info(fmt.Sprintf("Database migration %v: %v", Migration.Version, Migration.Description))
+	}
+
+	if migrateFlags.DryRun {
+		logger.Info(fmt.Sprintf("Database %v would be migrated from version %v to %v. The migrations ran and got rolled back", colors.Blue(migrateFlags.Database), Version, db.SchemaVersion()))
+	} else {
+		logger.Info(fmt.Sprintf("Migrated database %v from version %v to %v (backup: %v.v%v.bak)", colors.Blue(migrateFlags.Database), Version, db.SchemaVersion(), migrateFlags.Database, Version))
+	}
+
+	return nil
+}
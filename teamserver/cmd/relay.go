@@ -0,0 +1,81 @@
+package cmd
+
+import (
+	"errors"
+	"os"
+	"strings"
+
+	"Havoc/pkg/logger"
+	"Havoc/pkg/relay"
+
+	"github.com/spf13/cobra"
+)
+
+var (
+	relayFlags struct {
+		Listen      string
+		Teamserver  string
+		User        string
+		Password    string
+		Prefix      string
+		Fingerprint string
+		Cert        string
+		Key         string
+		Debug       bool
+	}
+
+	CobraRelay = &cobra.Command{
+		Use:          "relay",
+		Short:        "relay the operator clients of an office over a single link to the teamserver",
+		Long:         "Listens for operator clients and multiplexes them over a single link to the teamserver, so only the relay needs to reach the teamserver port.\nThe link authenticates with an account that has the Relay role in the profile of the teamserver. The operators behind the relay still authenticate with their own credentials.",
+		SilenceUsage: true,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			var Config = relay.Config{
+				Listen:      relayFlags.Listen,
+				Teamserver:  relayFlags.Teamserver,
+				User:        relayFlags.User,
+				Password:    relayFlags.Password,
+				Prefix:      relayFlags.Prefix,
+				Fingerprint: relayFlags.Fingerprint,
+				Cert:        relayFlags.Cert,
+				Key:         relayFlags.Key,
+			}
+
+			if len(Config.Teamserver) == 0 || len(Config.User) == 0 {
+				return errors.New("specify the teamserver with --teamserver and the relay account with --user")
+			}
+
+			/* keeps the password out of the process list */
+			if len(Config.Password) == 0 {
+				Config.Password = os.Getenv("HAVOC_RELAY_PASSWORD")
+			}
+
+			if (len(Config.Cert) == 0) != (len(Config.Key) == 0) {
+				return errors.New("specify both the certificate and its key")
+			}
+
+			if len(Config.Prefix) > 0 {
+				Config.Prefix = "/" + strings.Trim(Config.Prefix, "/")
+			}
+
+			logger.SetDebug(relayFlags.Debug)
+
+			return relay.NewRelay(Config).Run()
+		},
+	}
+)
+
+func init() {
+	CobraRelay.Flags().SortFlags = false
+	CobraRelay.Flags().StringVarP(&relayFlags.Listen, "listen", "", "0.0.0.0:40056", "address the operator clients connect to")
+	CobraRelay.Flags().StringVarP(&relayFlags.Teamserver, "teamserver", "", "", "teamserver (host:port) the relay keeps its link to")
+	CobraRelay.Flags().StringVarP(&relayFlags.User, "user", "", "", "account with the Relay role the link authenticates with")
+	CobraRelay.Flags().StringVarP(&relayFlags.Password, "password", "", "", "password of the relay account (default is $HAVOC_RELAY_PASSWORD)")
+	CobraRelay.Flags().StringVarP(&relayFlags.Prefix, "prefix", "", "", "path prefix of the operator api of the teamserver behind a cdn or reverse proxy")
+	CobraRelay.Flags().StringVarP(&relayFlags.Fingerprint, "fingerprint", "", "", "sha256 fingerprint of the certificate of the teamserver to verify")
+	CobraRelay.Flags().StringVarP(&relayFlags.Cert, "cert", "", "", "certificate the relay serves (default is a generated one)")
+	CobraRelay.Flags().StringVarP(&relayFlags.Key, "key", "", "", "key of the certificate the relay serves")
+	CobraRelay.Flags().BoolVarP(&relayFlags.Debug, "debug", "", false, "enable debug mode")
+
+	HavocCli.AddCommand(CobraRelay)
+}
@@ -0,0 +1,77 @@
+package cmd
+
+import (
+	"errors"
+	"strings"
+	"time"
+
+	"Havoc/pkg/logger"
+	"Havoc/pkg/profile"
+	"Havoc/pkg/selftest"
+
+	"github.com/spf13/cobra"
+)
+
+var (
+	replayFlags struct {
+		Profile  string
+		Secrets  string
+		Listener string
+		Urls     []string
+		Pace     bool
+		Timeout  time.Duration
+	}
+
+	CobraReplay = &cobra.Command{
+		Use:          "replay [recording]",
+		Short:        "replay the recorded transactions of a listener against a profile",
+		Long:         "Replays a recording (Record block of a http listener) against a http listener of a running teamserver to check that the agents of the recording keep working with its profile and version.\nEvery recorded agent is simulated by a demon that registers as a new session, so replay against a staging teamserver.",
+		Args:         cobra.ExactArgs(1),
+		SilenceUsage: true,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			var (
+				Profile = profile.NewProfile()
+				Config  = selftest.ReplayConfig{
+					File:    args[0],
+					Urls:    replayFlags.Urls,
+					Pace:    replayFlags.Pace,
+					Timeout: replayFlags.Timeout,
+				}
+			)
+
+			if len(Config.Urls) == 0 {
+				if replayFlags.Profile == "" {
+					return errors.New("specify the profile of the teamserver with --profile or the listener with --url")
+				}
+
+				Profile.Secrets = replayFlags.Secrets
+				if err := Profile.SetProfile(replayFlags.Profile, false); err != nil {
+					return err
+				}
+
+				Listener, err := profileListener(Profile, replayFlags.Listener)
+				if err != nil {
+					return err
+				}
+
+				Config.Urls = listenerUrls(Listener)
+			}
+
+			logger.Info("Replay against " + strings.Join(Config.Urls, ", "))
+
+			return selftest.Replay(Config)
+		},
+	}
+)
+
+func init() {
+	CobraReplay.Flags().SortFlags = false
+	CobraReplay.Flags().StringVarP(&replayFlags.Profile, "profile", "", "", "set havoc teamserver profile")
+	CobraReplay.Flags().StringVarP(&replayFlags.Secrets, "secrets", "", "", "set file of the secrets the profile interpolates (${NAME})")
+	CobraReplay.Flags().StringVarP(&replayFlags.Listener, "listener", "", "", "name of the http listener to replay against (default is the first one)")
+	CobraReplay.Flags().StringSliceVarP(&replayFlags.Urls, "url", "", nil, "url of the listener to replay against instead of the hosts of the profile")
+	CobraReplay.Flags().BoolVarP(&replayFlags.Pace, "pace", "", false, "keep the time between the recorded transactions")
+	CobraReplay.Flags().DurationVarP(&replayFlags.Timeout, "timeout", "", 30*time.Second, "timeout of each request")
+
+	HavocCli.AddCommand(CobraReplay)
+}
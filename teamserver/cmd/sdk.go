@@ -0,0 +1,33 @@
+package cmd
+
+import (
+	"os"
+
+	"Havoc/pkg/sdk"
+
+	"github.com/spf13/cobra"
+)
+
+var (
+	CobraSdk = &cobra.Command{
+		Use:   "sdk",
+		Short: "generate the client bindings of the teamserver",
+	}
+
+	CobraSdkPython = &cobra.Command{
+		Use:          "python",
+		Short:        "print the protocol module of the python bindings (tools/python/havoc/protocol.py)",
+		Args:         cobra.NoArgs,
+		SilenceUsage: true,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			_, err := os.Stdout.Write(sdk.Python())
+			return err
+		},
+	}
+)
+
+func init() {
+	CobraSdk.AddCommand(CobraSdkPython)
+
+	HavocCli.AddCommand(CobraSdk)
+}
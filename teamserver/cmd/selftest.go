@@ -0,0 +1,165 @@
+package cmd
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"Havoc/pkg/logger"
+	"Havoc/pkg/profile"
+	"Havoc/pkg/selftest"
+
+	"github.com/spf13/cobra"
+)
+
+var (
+	selftestFlags struct {
+		Profile    string
+		Secrets    string
+		Listener   string
+		Urls       []string
+		Teamserver string
+		User       string
+		Password   string
+		Timeout    time.Duration
+	}
+
+	CobraSelftest = &cobra.Command{
+		Use:          "selftest",
+		Short:        "test a running teamserver end-to-end with a simulated demon",
+		Long:         "Registers a simulated demon over a http listener of the profile, tasks it, downloads a file from it and connects a pivot to it.\nThe teamserver has to be running. The operator (--user) tasks the simulated demon and gets its output and the downloaded file like any other agent.",
+		SilenceUsage: true,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			var (
+				Profile = profile.NewProfile()
+				Config  = selftest.Config{
+					Process: "selftest.exe",
+					Pipe:    "havoc-selftest",
+					Poll:    500 * time.Millisecond,
+					Timeout: selftestFlags.Timeout,
+				}
+			)
+
+			if selftestFlags.Profile == "" {
+				return errors.New("specify the profile of the teamserver with --profile")
+			}
+
+			Profile.Secrets = selftestFlags.Secrets
+			if err := Profile.SetProfile(selftestFlags.Profile, false); err != nil {
+				return err
+			}
+
+			Listener, err := profileListener(Profile, selftestFlags.Listener)
+			if err != nil {
+				return err
+			}
+
+			Config.Listener = selftest.Listener{
+				Urls:       selftestFlags.Urls,
+				Uris:       Listener.Uris,
+				UserAgent:  Listener.UserAgent,
+				Headers:    Listener.Headers,
+				HostHeader: Listener.HostHeader,
+			}
+
+			if len(Config.Listener.Urls) == 0 {
+				Config.Listener.Urls = listenerUrls(Listener)
+			}
+
+			Config.Teamserver = selftestFlags.Teamserver
+			if Config.Teamserver == "" {
+				var Host = Profile.Config.Server.Host
+
+				if Host == "0.0.0.0" || Host == "" {
+					Host = "127.0.0.1"
+				}
+
+				Config.Teamserver = Host + ":" + strconv.Itoa(Profile.Config.Server.Port)
+			}
+
+			Config.User, Config.Password = selftestFlags.User, selftestFlags.Password
+			if Profile.Config.Operators != nil {
+				for _, User := range Profile.Config.Operators.Users {
+					if Config.User != "" && User.Name != Config.User {
+						continue
+					}
+
+					Config.User = User.Name
+					if Config.Password == "" && !profile.IsPasswordHash(User.Password) {
+						Config.Password = User.Password
+					}
+
+					break
+				}
+			}
+
+			if Config.User == "" || Config.Password == "" {
+				return errors.New("specify the operator to task the simulated demon with --user and --password")
+			}
+
+			logger.Info("Self test of listener " + Listener.Name + " (" + strings.Join(Config.Listener.Urls, ", ") + ")")
+
+			if err := selftest.Run(Config); err != nil {
+				return err
+			}
+
+			logger.Good("Self test passed")
+
+			return nil
+		},
+	}
+)
+
+// profileListener
+// returns the http listener of the profile (the first one if Name is empty).
+func profileListener(Profile *profile.Profile, Name string) (*profile.ListenerHTTP, error) {
+	if Profile.Config.Listener != nil {
+		for _, Listener := range Profile.Config.Listener.ListenerHTTP {
+			if Name == "" || Listener.Name == Name {
+				return Listener, nil
+			}
+		}
+	}
+
+	return nil, fmt.Errorf("no http listener %v in the profile. only http listeners are supported", Name)
+}
+
+// listenerUrls
+// returns the base urls the payloads of the listener connect to.
+func listenerUrls(Listener *profile.ListenerHTTP) []string {
+	var (
+		Urls   []string
+		Scheme = "http://"
+		Port   = Listener.PortConn
+	)
+
+	if Listener.Secure {
+		Scheme = "https://"
+	}
+
+	if Port == 0 {
+		Port = Listener.PortBind
+	}
+
+	for _, Host := range Listener.Hosts {
+		Urls = append(Urls, Scheme+Host+":"+strconv.Itoa(Port))
+	}
+
+	return Urls
+}
+
+func init() {
+	CobraSelftest.Flags().SortFlags = false
+	CobraSelftest.Flags().StringVarP(&selftestFlags.Profile, "profile", "", "", "set havoc teamserver profile")
+	CobraSelftest.Flags().StringVarP(&selftestFlags.Secrets, "secrets", "", "", "set file of the secrets the profile interpolates (${NAME})")
+	CobraSelftest.Flags().StringVarP(&selftestFlags.Listener, "listener", "", "", "name of the http listener to test (default is the first one)")
+	CobraSelftest.Flags().StringSliceVarP(&selftestFlags.Urls, "url", "", nil, "url the simulated demon connects to instead of the hosts of the listener (eg: a redirector)")
+	CobraSelftest.Flags().StringVarP(&selftestFlags.Teamserver, "teamserver", "", "", "host:port of the teamserver (default is the one of the profile)")
+	CobraSelftest.Flags().StringVarP(&selftestFlags.User, "user", "", "", "operator tasking the simulated demon (default is the first one of the profile)")
+	CobraSelftest.Flags().StringVarP(&selftestFlags.Password, "password", "", "", "password of the operator (required if the profile only has its hash)")
+	CobraSelftest.Flags().DurationVarP(&selftestFlags.Timeout, "timeout", "", 30*time.Second, "how long each step of the test may take")
+
+	HavocCli.AddCommand(CobraSelftest)
+}
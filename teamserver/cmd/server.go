@@ -1,6 +1,8 @@
 package cmd
 
 import (
+	"encoding/json"
+	"errors"
 	"fmt"
 	"os"
 	"time"
@@ -10,6 +12,7 @@ import (
 	"Havoc/pkg/events"
 	"Havoc/pkg/logger"
 	"Havoc/pkg/logr"
+	"Havoc/pkg/profile"
 
 	"github.com/spf13/cobra"
 )
@@ -33,7 +36,19 @@ var CobraServer = &cobra.Command{
 			}
 			os.Exit(0)
 		}
-		
+
+		/* json on stdout, logs on stderr */
+		if flags.Server.PrintSchema || flags.Server.PrintEffective {
+			logger.SetStdOut(os.Stderr)
+
+			if err := printConfig(); err != nil {
+				logger.Error(err.Error())
+				os.Exit(1)
+			}
+
+			os.Exit(0)
+		}
+
 		if flags.Server.Database != "" {
 			DatabasePath = (flags.Server.Database)
 		}
@@ -66,6 +81,22 @@ var CobraServer = &cobra.Command{
 
 		logger.Info(fmt.Sprintf("Havoc Framework [Version: %v] [CodeName: %v]", VersionNumber, VersionName))
 
+		if flags.Server.HashPasswords {
+			if flags.Server.Profile == "" {
+				logger.Error("Specify the profile to hash the operator passwords of with --profile")
+				os.Exit(1)
+			}
+
+			Count, err := profile.HashPasswords(flags.Server.Profile, flags.Server.Secrets)
+			if err != nil {
+				logger.Error("Failed to hash the operator passwords: " + err.Error())
+				os.Exit(1)
+			}
+
+			logger.Info(fmt.Sprintf("Hashed %v operator passwords of %v", Count, colors.Blue(flags.Server.Profile)))
+			os.Exit(0)
+		}
+
 		if flags.Server.Default {
 			Server.SetProfile(DirPath + "/data/havoc.yaotl")
 		} else if flags.Server.Profile != "" {
@@ -91,3 +122,41 @@ var CobraServer = &cobra.Command{
 		return nil
 	},
 }
+
+// printConfig
+// prints the json schema of the profile or the config the teamserver
+// would run with.
+func printConfig() error {
+	var Output any
+
+	if flags.Server.PrintSchema {
+		Output = profile.Schema()
+	} else {
+		var (
+			DirPath, _ = os.Getwd()
+			Profile    = profile.NewProfile()
+			Path       = flags.Server.Profile
+		)
+
+		if flags.Server.Default {
+			Path = DirPath + "/data/havoc.yaotl"
+		} else if len(Path) == 0 {
+			return errors.New("no profile specified. Specify a profile with --profile or choose the standard profile with --default")
+		}
+
+		Profile.Secrets = flags.Server.Secrets
+
+		if err := Profile.SetProfile(Path, flags.Server.Default); err != nil {
+			return fmt.Errorf("profile error: %w", err)
+		}
+
+		Output = Profile.Effective()
+	}
+
+	var Encoder = json.NewEncoder(os.Stdout)
+
+	Encoder.SetEscapeHTML(false)
+	Encoder.SetIndent("", "  ")
+
+	return Encoder.Encode(Output)
+}
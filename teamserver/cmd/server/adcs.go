@@ -0,0 +1,232 @@
+package server
+
+import (
+	"crypto/rsa"
+	"crypto/sha1"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"regexp"
+	"strings"
+	"time"
+
+	"Havoc/pkg/agent"
+	"Havoc/pkg/db"
+	"Havoc/pkg/logger"
+)
+
+// time the certificate authority has to issue a requested certificate
+// before the key of the request gets dropped
+const ADCS_TIMEOUT = 24 * time.Hour
+
+var adcsAuthority = regexp.MustCompile(`^[A-Za-z0-9._-]+\\[A-Za-z0-9 ._-]+$`)
+
+// AdcsAuthority
+// returns the config string (host\name) of the certificate authority.
+// Authorities found by the enumeration can be referenced by their name.
+func (t *Teamserver) AdcsAuthority(Agent *agent.Agent, Name string) (string, error) {
+	if strings.Contains(Name, "\\") {
+		if !adcsAuthority.MatchString(Name) {
+			return "", errors.New("invalid certificate authority: " + Name)
+		}
+
+		return Name, nil
+	}
+
+	for _, Object := range t.DirectoryObjects(workspaceOrDefault(Agent.Info.Workspace), "ca") {
+		var (
+			CN   = directoryAttribute(Object.Attributes, "cn")
+			Host = directoryAttribute(Object.Attributes, "dNSHostName")
+		)
+
+		if len(Host) == 0 || (len(Name) > 0 && !strings.EqualFold(CN, Name)) {
+			continue
+		}
+
+		return Host + "\\" + CN, nil
+	}
+
+	if len(Name) == 0 {
+		return "", errors.New("no certificate authority known. enumerate the authorities or specify host\\name")
+	}
+
+	return "", errors.New("certificate authority " + Name + " not found. enumerate the authorities or specify host\\name")
+}
+
+// AdcsRequested
+// keeps the key of the certificate request until the certificate
+// authority answered.
+func (t *Teamserver) AdcsRequested(Agent *agent.Agent, RequestID uint32, ClientID string, Request *agent.AdcsRequest) {
+	var Pending = &PendingCertificate{
+		Request: Request,
+		Time:    time.Now(),
+	}
+
+	if value, ok := t.Clients.Load(ClientID); ok {
+		Pending.User = value.(*Client).Username
+	}
+
+	t.Certificates.Store(RequestID, Pending)
+
+	logger.Info(fmt.Sprintf("Agent %v requests a %v certificate from %v [upn: %v]", Agent.NameID, Request.Template, Request.Authority, Request.UPN))
+
+	time.AfterFunc(ADCS_TIMEOUT, func() {
+		t.Certificates.CompareAndDelete(RequestID, Pending)
+	})
+}
+
+// AdcsIssued
+// saves the issued certificate and the key of its request as credential.
+// an empty certificate drops the request. returns the id of the credential.
+func (t *Teamserver) AdcsIssued(Agent *agent.Agent, RequestID uint32, CaRequestID int, Certificate string) (int, error) {
+	value, ok := t.Certificates.LoadAndDelete(RequestID)
+	if !ok {
+		if len(Certificate) == 0 {
+			return 0, nil
+		}
+
+		return 0, errors.New("certificate request not found, the key of the request is lost")
+	}
+
+	if len(Certificate) == 0 {
+		return 0, nil
+	}
+
+	var (
+		Pending  = value.(*PendingCertificate)
+		Request  = Pending.Request
+		Username = Request.Subject
+		Domain   = Agent.Info.DomainName
+	)
+
+	DER, err := base64.StdEncoding.DecodeString(strings.Join(strings.Fields(Certificate), ""))
+	if err != nil {
+		return 0, err
+	}
+
+	Parsed, err := x509.ParseCertificate(DER)
+	if err != nil {
+		return 0, err
+	}
+
+	if Public, ok := Parsed.PublicKey.(*rsa.PublicKey); !ok || !Public.Equal(&Request.Key.PublicKey) {
+		return 0, errors.New("certificate doesn't belong to the key of the request")
+	}
+
+	Key, err := x509.MarshalPKCS8PrivateKey(Request.Key)
+	if err != nil {
+		return 0, err
+	}
+
+	Metadata := certificateMetadata(Parsed)
+	Metadata["Template"] = Request.Template
+	Metadata["Authority"] = Request.Authority
+	Metadata["RequestID"] = CaRequestID
+	Metadata["AgentID"] = Agent.NameID
+
+	if len(Request.SID) > 0 {
+		Metadata["SID"] = Request.SID
+	}
+
+	if UPN, ok := Metadata["UPN"].(string); ok && len(UPN) > 0 {
+		Username, Domain, _ = strings.Cut(UPN, "@")
+	}
+
+	Encoded, err := json.Marshal(Metadata)
+	if err != nil {
+		return 0, err
+	}
+
+	ID, err := t.DB.CredentialAdd(db.Credential{
+		Username:    Username,
+		Domain:      Domain,
+		Certificate: string(pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: DER})) + string(pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: Key})),
+		Metadata:    string(Encoded),
+		Source:      "adcs " + Request.Template,
+		Workspace:   workspaceOrDefault(Agent.Info.Workspace),
+		User:        Pending.User,
+		Time:        time.Now().Format("02/01/2006 15:04:05"),
+	})
+	if err != nil {
+		return 0, err
+	}
+
+	logger.Info(fmt.Sprintf("Certificate %v of %v\\%v issued by %v saved as credential %v", CaRequestID, Domain, Username, Request.Authority, ID))
+
+	t.credentialsBroadcast()
+
+	return ID, nil
+}
+
+// certificateMetadata
+// returns the details of the certificate the credential store keeps.
+func certificateMetadata(Certificate *x509.Certificate) map[string]any {
+	var (
+		Thumbprint = sha1.Sum(Certificate.Raw)
+		Usages     []string
+	)
+
+	for _, Usage := range Certificate.UnknownExtKeyUsage {
+		Usages = append(Usages, Usage.String())
+	}
+
+	for _, Usage := range Certificate.ExtKeyUsage {
+		switch Usage {
+
+		case x509.ExtKeyUsageClientAuth:
+			Usages = append(Usages, "client auth")
+
+		case x509.ExtKeyUsageAny:
+			Usages = append(Usages, "any")
+
+		default:
+			Usages = append(Usages, fmt.Sprint(Usage))
+
+		}
+	}
+
+	return map[string]any{
+		"Subject":    Certificate.Subject.String(),
+		"Issuer":     Certificate.Issuer.String(),
+		"Serial":     Certificate.SerialNumber.Text(16),
+		"Thumbprint": strings.ToUpper(hex.EncodeToString(Thumbprint[:])),
+		"NotBefore":  Certificate.NotBefore.Format("02/01/2006 15:04:05"),
+		"NotAfter":   Certificate.NotAfter.Format("02/01/2006 15:04:05"),
+		"UPN":        agent.AdcsUPN(Certificate),
+		"DNS":        Certificate.DNSNames,
+		"Usages":     Usages,
+	}
+}
+
+// certificateImport
+// returns the metadata of the certificate of a pem bundle added to the
+// credential store by an operator.
+func certificateImport(Bundle string) (string, error) {
+	var (
+		Rest  = []byte(Bundle)
+		Block *pem.Block
+	)
+
+	for {
+		if Block, Rest = pem.Decode(Rest); Block == nil {
+			return "", errors.New("credential certificate has no pem encoded certificate")
+		}
+
+		if Block.Type == "CERTIFICATE" {
+			break
+		}
+	}
+
+	Certificate, err := x509.ParseCertificate(Block.Bytes)
+	if err != nil {
+		return "", err
+	}
+
+	Metadata, err := json.Marshal(certificateMetadata(Certificate))
+
+	return string(Metadata), err
+}
@@ -3,21 +3,97 @@ package server
 import (
 	"Havoc/pkg/logger"
 	"encoding/json"
+	"errors"
 	"math/rand"
 	"time"
 	"fmt"
 	"strconv"
 
 	"Havoc/pkg/agent"
+	"Havoc/pkg/db"
+	"Havoc/pkg/eventbus"
 	"Havoc/pkg/events"
+	"Havoc/pkg/keyring"
 	"Havoc/pkg/packager"
 )
 
 func (t *Teamserver) AgentUpdate(agent *agent.Agent) {
+	/* synthetic agents of the demo mode aren't stored */
+	if _, ok := t.Demo.Load(agent.NameID); ok {
+		return
+	}
+
+	t.journalKey(agent, false)
+
 	err := t.DB.AgentUpdate(agent)
 	if err != nil {
 		logger.Error("Could not update agent: " + err.Error())
 	}
+
+	t.AgentCapabilitiesSave(agent)
+}
+
+// AgentCapabilitiesSave
+// saves the capabilities the agent reported so they survive restarts.
+func (t *Teamserver) AgentCapabilitiesSave(Agent *agent.Agent) {
+	if Agent == nil || Agent.Info == nil {
+		return
+	}
+
+	var AgentID, _ = strconv.ParseInt(Agent.NameID, 16, 64)
+
+	if Agent.Info.Capabilities != nil {
+		if err := t.DB.AgentCapabilitiesSet(int(AgentID), Agent.Info.Capabilities); err != nil {
+			logger.Error("Could not save agent capabilities: " + err.Error())
+		}
+	}
+
+	if Agent.Info.MaxResponse > 0 {
+		if err := t.DB.AgentMaxResponseSet(int(AgentID), Agent.Info.MaxResponse); err != nil {
+			logger.Error("Could not save agent max response size: " + err.Error())
+		}
+	}
+
+	if len(Agent.Info.TimeZone) > 0 {
+		if err := t.DB.AgentTimeZoneSet(int(AgentID), Agent.Info.TimeZone, Agent.Info.UTCOffset); err != nil {
+			logger.Error("Could not save agent time zone: " + err.Error())
+		}
+	}
+
+	if Agent.Info.CodePage != 0 || Agent.Info.OEMCodePage != 0 {
+		if err := t.DB.AgentCodePageSet(int(AgentID), Agent.Info.CodePage, Agent.Info.OEMCodePage); err != nil {
+			logger.Error("Could not save agent code pages: " + err.Error())
+		}
+	}
+}
+
+// agentTimeZone
+// returns the saved time zone of the host of the agent.
+func (t *Teamserver) agentTimeZone(AgentID int) (string, int) {
+	var TimeZone = t.DB.AgentTimeZones()[AgentID]
+
+	return TimeZone.Name, TimeZone.Offset
+}
+
+// agentCodePages
+// returns the saved ansi and oem code page of the host of the agent.
+func (t *Teamserver) agentCodePages(AgentID int) (int, int) {
+	var CodePage = t.DB.AgentCodePages()[AgentID]
+
+	return CodePage.Ansi, CodePage.OEM
+}
+
+// agentStamps
+// returns the timestamp of the teamserver in UTC and in the local
+// time of the host of the agent (empty if unknown).
+func (t *Teamserver) agentStamps(AgentID, Stamp string) (string, string) {
+	var Info *agent.AgentInfo
+
+	if Agent := t.Agents.Get(AgentID); Agent != nil {
+		Info = Agent.Info
+	}
+
+	return Info.CallInStamps(Stamp)
 }
 
 func (t *Teamserver) Died(Agent *agent.Agent) {
@@ -25,6 +101,15 @@ func (t *Teamserver) Died(Agent *agent.Agent) {
 	t.UnlinkFromAll(Agent)
 	t.EventAgentMark(Agent.NameID, "Dead")
 	t.AgentUpdate(Agent)
+
+	/* its socks proxies don't reach anything anymore */
+	Agent.SocksSvrMtx.Lock()
+	var Socks = len(Agent.SocksSvr)
+	Agent.SocksSvrMtx.Unlock()
+
+	if Socks > 0 {
+		t.SocksChanged(Agent)
+	}
 }
 
 func (t *Teamserver) UnlinkFromAll(Agent *agent.Agent) {
@@ -35,7 +120,7 @@ func (t *Teamserver) UnlinkFromAll(Agent *agent.Agent) {
 	}
 
 	// remove agent from parent's link
-	for _, ParentAgent := range t.Agents.Agents {
+	for _, ParentAgent := range t.Agents.List() {
 		if ParentAgent.NameID == Agent.NameID {
 			continue
 		}
@@ -105,11 +190,48 @@ func (t *Teamserver) AgentHasDied(Agent *agent.Agent) bool {
 	return t.DB.AgentHasDied(int(AgentID))
 }
 
+// agentKeyRestore
+// loads the session key of the agent from the db again if it got wiped
+// when the session closed (see keyring.Session).
+func (t *Teamserver) agentKeyRestore(Agent *agent.Agent) {
+	if !Agent.Encryption.Empty() {
+		return
+	}
+
+	var AgentID, _ = strconv.ParseInt(Agent.NameID, 16, 64)
+
+	Stored, err := t.DB.AgentGet(int(AgentID))
+	if err != nil {
+		logger.Error("Could not load the session key of agent " + Agent.NameID + ": " + err.Error())
+		return
+	}
+
+	var AESKey, AESIv = Stored.Encryption.Keys()
+
+	Agent.Encryption.Set(AESKey, AESIv)
+
+	keyring.Wipe(AESKey, AESIv)
+	Stored.Encryption.Destroy()
+}
+
 func (t *Teamserver) AgentAdd(Agent *agent.Agent) []*agent.Agent {
-	if Agent != nil {
-		if t.WebHooks != nil {
-			t.WebHooks.NewAgent(Agent.ToMap())
-		}
+	return t.agentAdd(Agent, false)
+}
+
+// agentAdd
+// adds the agent. Restored agents of a previous run aren't new sessions.
+func (t *Teamserver) agentAdd(Agent *agent.Agent, Restored bool) []*agent.Agent {
+	/* claim the id first. two registrations of the same agent racing each other only add it once */
+	if Agent != nil && !t.Agents.Add(Agent) {
+		logger.Debug("Agent " + Agent.NameID + " is already registered")
+		return t.Agents.List()
+	}
+
+	/* in the journal first. a crash before the db has it doesn't lose the session */
+	if Restored {
+		t.journalKey(Agent, true)
+	} else {
+		t.journalSession(Agent)
 	}
 
 	err := t.DB.AgentAdd(Agent)
@@ -117,7 +239,35 @@ func (t *Teamserver) AgentAdd(Agent *agent.Agent) []*agent.Agent {
 		logger.Error("Could not add agent to database: " + err.Error())
 	}
 
-	return t.Agents.AgentsAppend(Agent)
+	if Agent != nil && Agent.Info != nil {
+		/* pivot agents belong to the workspace of their parent */
+		if len(Agent.Info.Workspace) == 0 && Agent.Pivots.Parent != nil && Agent.Pivots.Parent.Info != nil {
+			Agent.Info.Workspace = Agent.Pivots.Parent.Info.Workspace
+		}
+
+		t.jumpSession(Agent)
+
+		Agent.Info.Workspace = workspaceOrDefault(Agent.Info.Workspace)
+
+		var AgentID, _ = strconv.ParseInt(Agent.NameID, 16, 64)
+		if err = t.DB.AgentWorkspaceSet(int(AgentID), Agent.Info.Workspace); err != nil {
+			logger.Error("Could not save agent workspace: " + err.Error())
+		}
+
+		t.AgentCapabilitiesSave(Agent)
+
+		var Network = t.networkAdd(Agent)
+
+		if !Restored {
+			t.EventPublish(eventbus.SESSION_NEW, Agent.Info.Workspace, sessionData(Agent))
+
+			if len(Network) > 0 {
+				t.networkPublish(Agent, Network)
+			}
+		}
+	}
+
+	return t.Agents.List()
 }
 
 func (t *Teamserver) AgentSendNotify(Agent *agent.Agent) {
@@ -153,14 +303,7 @@ func (t *Teamserver) AgentCallbackSize(DemonInstance *agent.Agent, i int) {
 }
 
 func (t *Teamserver) AgentInstance(AgentID int) *agent.Agent {
-	for _, demon := range t.Agents.Agents {
-		var NameID, _ = strconv.ParseInt(demon.NameID, 16, 64)
-
-		if AgentID == int(NameID) {
-			return demon
-		}
-	}
-	return nil
+	return t.Agents.Get(fmt.Sprintf("%08x", AgentID))
 }
 
 func (t *Teamserver) AgentLastTimeCalled(AgentID string, LastCallback string, Sleep int, Jitter int, KillDate int64, WorkingHours int32) {
@@ -181,23 +324,143 @@ func (t *Teamserver) AgentLastTimeCalled(AgentID string, LastCallback string, Sl
 }
 
 func (t *Teamserver) AgentExist(AgentID int) bool {
-	for _, demon := range t.Agents.Agents {
-		var NameID, err = strconv.ParseInt(demon.NameID, 16, 64)
-		if err != nil {
-			logger.Debug("Failed to convert demon.NameID to int: " + err.Error())
-			return false
+	return t.AgentInstance(AgentID) != nil
+}
+
+// AgentResume
+// re-attaches an agent that registered again to its session instead of
+// adding it twice. The session is either still in the session table (the
+// agent reconnected from another ip or over another transport) or a dead
+// or archived one of a previous run. Returns nil if the agent has no
+// session yet.
+func (t *Teamserver) AgentResume(AgentID int, Register *agent.Agent) (*agent.Agent, error) {
+	var (
+		Session  = t.AgentInstance(AgentID)
+		Loaded   = false
+		Archived = false
+		err      error
+	)
+
+	if Register == nil {
+		return nil, errors.New("invalid register request")
+	}
+
+	if Session == nil {
+		if !t.DB.AgentExist(AgentID) {
+			return nil, nil
 		}
 
-		if AgentID == int(NameID) {
-			return true
+		if Session, err = t.DB.AgentGet(AgentID); err != nil {
+			return nil, err
 		}
+
+		Session.Info.Workspace = workspaceOrDefault(t.DB.AgentWorkspaces()[AgentID])
+		Session.Info.Capabilities = t.DB.AgentCapabilities()[AgentID]
+		Session.Info.MaxResponse = t.DB.AgentMaxResponses()[AgentID]
+		Session.Info.TimeZone, Session.Info.UTCOffset = t.agentTimeZone(AgentID)
+		Session.Info.CodePage, Session.Info.OEMCodePage = t.agentCodePages(AgentID)
+		Session.Info.Transport = t.DB.AgentTransportsCurrent()[AgentID]
+
+		_, Archived = t.DB.AgentArchived(AgentID)
+		Loaded = true
+	}
+
+	var Alive = Session.Active
+
+	/* the key of a closed session got wiped */
+	t.agentKeyRestore(Session)
+
+	if err = Session.Resume(Register); err != nil {
+		if err == agent.ErrSessionKey {
+			logger.Warn(fmt.Sprintf("Agent %v registered again with another session key. Refused", Session.NameID))
+		}
+		return nil, err
+	}
+
+	if Archived {
+		if err = t.DB.AgentUnarchive(AgentID); err != nil {
+			return nil, err
+		}
+	}
+
+	/* the route over the previous parent is gone */
+	if Session.Pivots.Parent != nil {
+		t.LinkRemove(Session.Pivots.Parent, Session, true)
+		Session.Pivots.Parent = nil
+	} else if Loaded {
+		if ParentID, err := t.DB.ParentOf(AgentID); err == nil {
+			t.DB.LinkRemove(ParentID, AgentID)
+		}
+	}
+
+	Session.Active = true
+	Session.Reason = ""
+	Session.UpdateExternalIP(t, Register.Info.ExternalIP)
+
+	if Loaded {
+		/* lost the race against another register request of the agent */
+		if !t.Agents.Add(Session) {
+			return t.AgentInstance(AgentID), nil
+		}
+
+		t.AgentSendNotify(Session)
+	} else if !Alive {
+		t.EventAgentMark(Session.NameID, "Alive")
+	}
+
+	t.AgentUpdate(Session)
+
+	logger.Info(fmt.Sprintf("Agent %v resumed its session", Session.NameID))
+
+	t.AgentConsole(Session.NameID, agent.HAVOC_CONSOLE_MESSAGE, map[string]string{
+		"Type":    "Info",
+		"Message": "Agent reconnected and resumed its session",
+	})
+
+	return Session, nil
+}
+
+// AgentTransport
+// records the listener the agent calls back over from now on. Previous is
+// the listener it failed over from (empty if it just registered).
+func (t *Teamserver) AgentTransport(Agent *agent.Agent, Previous string) {
+	var AgentID, _ = strconv.ParseInt(Agent.NameID, 16, 64)
+
+	if err := t.DB.AgentTransportAdd(db.AgentTransport{
+		AgentID:  int(AgentID),
+		Listener: Agent.Info.Transport,
+		Previous: Previous,
+		Host:     Agent.Info.CallbackHost,
+		Time:     time.Now().Format("02/01/2006 15:04:05"),
+	}); err != nil {
+		logger.Error("Could not save agent transport: " + err.Error())
 	}
-	return false
+
+	if len(Previous) > 0 {
+		logger.Info(fmt.Sprintf("Agent %v failed over from listener %v to %v", Agent.NameID, Previous, Agent.Info.Transport))
+	}
+
+	t.ListenerEphemeralAgent(Agent)
 }
 
 func (t *Teamserver) AgentConsole(AgentID string, CommandID int, Output map[string]string) {
+	if len(Output["Output"]) > 0 {
+		t.SecretsCollect(AgentID, Output["Output"])
+		t.ServicesCollect(AgentID, Output["Output"])
+		t.SecretsScan(AgentID, Output["Output"])
+	}
+
+	t.FailureRecord(AgentID, Output)
+	t.BatchOutput(AgentID, Output)
+	t.SprayOutput(AgentID, Output)
+
+	/* lets clients attribute the output to the task it answers */
+	if Agent := t.Agents.Get(AgentID); Agent != nil && len(Agent.Answering()) > 0 && len(Output["TaskID"]) == 0 {
+		Output["TaskID"] = Agent.Answering()
+	}
+
 	var (
-		out, _ = json.Marshal(Output)
+		out, _ = json.Marshal(t.OutputLimit(AgentID, Output))
 		pk     = events.Demons.DemonOutput(AgentID, CommandID, string(out))
 	)
 
@@ -207,7 +470,7 @@ func (t *Teamserver) AgentConsole(AgentID string, CommandID int, Output map[stri
 
 func (t *Teamserver) PythonModuleCallback(ClientID string, AgentID string, CommandID int, Output map[string]string) {
 	var (
-		out, _ = json.Marshal(Output)
+		out, _ = json.Marshal(t.OutputLimit(AgentID, Output))
 		pk     = events.Demons.DemonOutput(AgentID, CommandID, string(out))
 	)
 
@@ -230,6 +493,38 @@ func (t *Teamserver) AgentCallback(DemonID string, Time string) {
 	t.EventBroadcast("", pk)
 }
 
+// SocksFlowControl
+// returns the frame size and window of socks clients and if their
+// frames get compressed.
+func (t *Teamserver) SocksFlowControl() (int, int, bool) {
+	var (
+		FrameSize = 0x10000
+		Window    = 0
+		Compress  = false
+	)
+
+	if t.Profile.Config.Demon != nil && t.Profile.Config.Demon.Socks != nil {
+		if t.Profile.Config.Demon.Socks.FrameSize > 0 {
+			FrameSize = t.Profile.Config.Demon.Socks.FrameSize
+		}
+
+		Window = t.Profile.Config.Demon.Socks.Window
+		Compress = t.Profile.Config.Demon.Socks.Compress
+	}
+
+	return FrameSize, Window, Compress
+}
+
+// DemonMaxResponse
+// returns the max response size demons get built with. 0 is no limit.
+func (t *Teamserver) DemonMaxResponse() int {
+	if t.Profile.Config.Demon != nil && t.Profile.Config.Demon.MaxResponse > 0 {
+		return t.Profile.Config.Demon.MaxResponse
+	}
+
+	return 0
+}
+
 func (t *Teamserver) SendLogs() bool {
 	return t.Flags.Server.SendLogs
 }
@@ -0,0 +1,249 @@
+package server
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"regexp"
+	"sort"
+	"strings"
+	"time"
+
+	"Havoc/pkg/agent"
+	"Havoc/pkg/events"
+	"Havoc/pkg/logger"
+	"Havoc/pkg/profile"
+)
+
+// time a task waits for its approval if the profile doesn't specify it
+const APPROVAL_TIMEOUT = time.Hour
+
+// ApprovalSetup
+// loads the risk criteria of the profile. tasks matching them are held
+// back until a second operator approves them.
+func (t *Teamserver) ApprovalSetup() {
+	var err error
+
+	t.Approval.Timeout = APPROVAL_TIMEOUT
+
+	if t.Profile.Config.Server == nil || t.Profile.Config.Server.Approval == nil {
+		return
+	}
+
+	var Config = t.Profile.Config.Server.Approval
+
+	if len(Config.Timeout) > 0 {
+		if t.Approval.Timeout, err = time.ParseDuration(Config.Timeout); err != nil || t.Approval.Timeout <= 0 {
+			logger.Error("Failed to parse approval timeout: " + Config.Timeout)
+			t.Approval.Timeout = APPROVAL_TIMEOUT
+		}
+	}
+
+	t.Approval.AdminOnly = Config.AdminOnly
+
+	for _, Rule := range Config.Rules {
+		var Risk = &RiskRule{Name: Rule.Name, Reason: Rule.Reason, Commands: ruleCommands(Rule.Command)}
+
+		if len(Rule.Pattern) > 0 {
+			if Risk.Regex, err = regexp.Compile("(?i)" + Rule.Pattern); err != nil {
+				logger.Error(fmt.Sprintf("Approval rule %v has an invalid pattern: %v", Rule.Name, err))
+				continue
+			}
+		}
+
+		if len(Rule.Host) > 0 {
+			if Risk.Host, err = regexp.Compile("(?i)" + Rule.Host); err != nil {
+				logger.Error(fmt.Sprintf("Approval rule %v has an invalid host: %v", Rule.Name, err))
+				continue
+			}
+		}
+
+		if len(Risk.Commands) == 0 && Risk.Regex == nil && Risk.Host == nil {
+			logger.Error("Approval rule " + Rule.Name + " requires a command, pattern or host")
+			continue
+		}
+
+		t.Approval.Rules = append(t.Approval.Rules, Risk)
+	}
+
+	if len(t.Approval.Rules) > 0 {
+		logger.Info(fmt.Sprintf("Task approval: %v rules, timeout %v", len(t.Approval.Rules), t.Approval.Timeout))
+	}
+}
+
+// ApprovalRequired
+// returns the risk rule the task of the agent matches. Commands are the
+// names of the command the line got resolved to.
+func (t *Teamserver) ApprovalRequired(Agent *agent.Agent, CommandLine string, Commands ...string) *RiskRule {
+	if Fields := strings.Fields(CommandLine); len(Fields) > 0 {
+		Commands = append(Commands, Fields[0])
+	}
+
+	for _, Rule := range t.Approval.Rules {
+		if len(Rule.Commands) > 0 && !blockRuleCommand(Rule.Commands, Commands) {
+			continue
+		}
+
+		if Rule.Regex != nil && !Rule.Regex.MatchString(CommandLine) {
+			continue
+		}
+
+		if Rule.Host != nil && (Agent.Info == nil || !Rule.Host.MatchString(Agent.Info.Hostname)) {
+			continue
+		}
+
+		return Rule
+	}
+
+	return nil
+}
+
+// ApprovalHold
+// keeps the job of the agent until a second operator approves it or
+// the approval times out.
+func (t *Teamserver) ApprovalHold(User string, Agent *agent.Agent, Job agent.Job, TaskID, CommandLine string, Rule *RiskRule) *PendingTask {
+	var (
+		Random  = make([]byte, 4)
+		Pending = &PendingTask{
+			AgentID:     Agent.NameID,
+			TaskID:      TaskID,
+			CommandLine: CommandLine,
+			Rule:        Rule.Name,
+			Reason:      Rule.Reason,
+			User:        User,
+			Time:        time.Now().Format("02/01/2006 15:04:05"),
+			Agent:       Agent,
+			Job:         Job,
+			Created:     time.Now(),
+		}
+	)
+
+	_, _ = rand.Read(Random)
+	Pending.ID = hex.EncodeToString(Random)
+
+	t.approvalWait(Pending)
+
+	return Pending
+}
+
+// approvalWait
+// keeps the pending task until it gets decided on or times out.
+func (t *Teamserver) approvalWait(Pending *PendingTask) {
+	t.Approval.Pending.Store(Pending.ID, Pending)
+
+	logger.Info(fmt.Sprintf("Task %v of %v on agent %v waits for approval [rule: %v]", Pending.ID, Pending.User, Pending.AgentID, Pending.Rule))
+
+	time.AfterFunc(t.Approval.Timeout, func() {
+		if t.Approval.Pending.CompareAndDelete(Pending.ID, Pending) {
+			t.AgentConsole(Pending.AgentID, agent.HAVOC_CONSOLE_MESSAGE, map[string]string{
+				"Type":    "Error",
+				"Message": fmt.Sprintf("Task %v expired without approval", Pending.ID),
+			})
+
+			t.uploadDecided(Pending, "expired", "")
+			t.approvalsBroadcast()
+		}
+	})
+
+	t.approvalsBroadcast()
+}
+
+// ApprovalDecide
+// approves or denies the pending task. The operator that queued the
+// task isn't allowed to approve it.
+func (t *Teamserver) ApprovalDecide(User, ID string, Approve bool) error {
+	value, ok := t.Approval.Pending.Load(ID)
+	if !ok {
+		return errors.New("pending task " + ID + " not found")
+	}
+
+	var Pending = value.(*PendingTask)
+
+	if !workspaceVisible(t.UserWorkspace(User), Pending.Agent.Info.Workspace) {
+		return errors.New("pending task " + ID + " not found")
+	}
+
+	if Approve {
+		if Pending.User == User {
+			return errors.New("tasks have to be approved by a second operator")
+		}
+
+		if t.Approval.AdminOnly && t.Profile.UserRole(User) != profile.ROLE_ADMIN {
+			return errors.New("only admins are allowed to approve tasks")
+		}
+	}
+
+	/* another operator might have decided in the meantime */
+	if !t.Approval.Pending.CompareAndDelete(ID, Pending) {
+		return errors.New("pending task " + ID + " not found")
+	}
+
+	var Decision, Type = "denied", "Error"
+
+	if Approve {
+		if t.AgentHasDied(Pending.Agent) {
+			t.approvalsBroadcast()
+			return errors.New("agent " + Pending.AgentID + " is dead")
+		}
+
+		if Pending.Input != nil {
+			/* held back upload: queue it like the operator did, without checking the upload rules again */
+			t.Uploads.Approved.Store(Pending.TaskID, true)
+			t.TaskQueue(Pending.User, Pending.Agent, Pending.TaskID, Pending.Input)
+		} else {
+			t.taskEnqueue(Pending.Agent, Pending.Job)
+		}
+
+		Decision, Type = "approved", "Good"
+	}
+
+	t.uploadDecided(Pending, Decision, User)
+
+	t.AgentConsole(Pending.AgentID, agent.HAVOC_CONSOLE_MESSAGE, map[string]string{
+		"Type":    Type,
+		"Message": fmt.Sprintf("Task %v of %v %v by %v", Pending.ID, Pending.User, Decision, User),
+	})
+
+	logger.Info(fmt.Sprintf("Task %v of %v on agent %v %v by %v", Pending.ID, Pending.User, Pending.AgentID, Decision, User))
+
+	t.approvalsBroadcast()
+
+	return nil
+}
+
+// ApprovalsPending
+// returns the tasks waiting for approval the workspace sees.
+func (t *Teamserver) ApprovalsPending(Workspace string) []PendingTask {
+	var Tasks []PendingTask
+
+	t.Approval.Pending.Range(func(key, value any) bool {
+		var Pending = value.(*PendingTask)
+
+		if workspaceVisible(Workspace, Pending.Agent.Info.Workspace) {
+			Tasks = append(Tasks, *Pending)
+		}
+
+		return true
+	})
+
+	sort.Slice(Tasks, func(i, j int) bool {
+		return Tasks[i].Created.Before(Tasks[j].Created)
+	})
+
+	return Tasks
+}
+
+// approvalsBroadcast
+// sends every client the pending tasks of its workspace.
+func (t *Teamserver) approvalsBroadcast() {
+	t.Clients.Range(func(key, value any) bool {
+		var client = value.(*Client)
+
+		if err := t.SendEvent(key.(string), events.Approval.List(t.ApprovalsPending(client.Workspace))); err != nil {
+			logger.Error("Failed to send Event: " + err.Error())
+		}
+
+		return true
+	})
+}
@@ -0,0 +1,233 @@
+package server
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	"Havoc/pkg/agent"
+	"Havoc/pkg/events"
+	"Havoc/pkg/logger"
+	"Havoc/pkg/logr"
+	"Havoc/pkg/packager"
+)
+
+// SessionArchive
+// moves a dead session out of the active session table into the archive.
+// The agent, its transcripts and loot stay in the database and on disk
+// and are available again once the session gets restored.
+func (t *Teamserver) SessionArchive(User, AgentID string) error {
+	var (
+		Agent *agent.Agent
+		ID    int64
+		err   error
+	)
+
+	if ID, err = strconv.ParseInt(AgentID, 16, 64); err != nil {
+		return errors.New("invalid agent id")
+	}
+
+	if _, ok := t.DB.AgentArchived(int(ID)); ok {
+		return errors.New("session " + AgentID + " is already archived")
+	}
+
+	/* dead sessions of previous runs are not loaded into memory */
+	if Agent = t.AgentInstance(int(ID)); Agent == nil {
+		if Agent, err = t.DB.AgentGet(int(ID)); err != nil {
+			return errors.New("session " + AgentID + " not found")
+		}
+
+		Agent.Info.Workspace = workspaceOrDefault(t.DB.AgentWorkspaces()[int(ID)])
+	}
+
+	if !workspaceVisible(t.UserWorkspace(User), Agent.Info.Workspace) {
+		return errors.New("session " + AgentID + " not found")
+	}
+
+	if Agent.Active {
+		return errors.New("session " + AgentID + " is still alive. mark it as dead first")
+	}
+
+	if err = t.DB.AgentArchive(int(ID), User, time.Now().Format("02/01/2006 15:04:05"), strings.Join(archiveLoot(Agent.NameID), ",")); err != nil {
+		return err
+	}
+
+	t.Agents.Remove(Agent)
+	Agent.Encryption.Destroy()
+
+	logger.Info(fmt.Sprintf("Session %v archived by %v", AgentID, User))
+
+	t.EventBroadcast("", events.Demons.Remove(Agent.NameID))
+
+	return nil
+}
+
+// SessionRestore
+// re-hydrates an archived session into the session table and sends
+// its transcript to the connected operators.
+func (t *Teamserver) SessionRestore(User, AgentID string) error {
+	var (
+		Agent *agent.Agent
+		ID    int64
+		err   error
+	)
+
+	if ID, err = strconv.ParseInt(AgentID, 16, 64); err != nil {
+		return errors.New("invalid agent id")
+	}
+
+	if _, ok := t.DB.AgentArchived(int(ID)); !ok {
+		return errors.New("session " + AgentID + " is not archived")
+	}
+
+	if Agent, err = t.DB.AgentGet(int(ID)); err != nil {
+		return err
+	}
+
+	Agent.Info.Workspace = workspaceOrDefault(t.DB.AgentWorkspaces()[int(ID)])
+	Agent.Info.Capabilities = t.DB.AgentCapabilities()[int(ID)]
+	Agent.Info.MaxResponse = t.DB.AgentMaxResponses()[int(ID)]
+	Agent.Info.TimeZone, Agent.Info.UTCOffset = t.agentTimeZone(int(ID))
+	Agent.Info.CodePage, Agent.Info.OEMCodePage = t.agentCodePages(int(ID))
+	Agent.Info.Transport = t.DB.AgentTransportsCurrent()[int(ID)]
+
+	if !workspaceVisible(t.UserWorkspace(User), Agent.Info.Workspace) {
+		return errors.New("session " + AgentID + " is not archived")
+	}
+
+	if err = t.DB.AgentUnarchive(int(ID)); err != nil {
+		return err
+	}
+
+	if ParentID, err := t.ParentOf(Agent); err == nil {
+		Agent.Pivots.Parent = t.AgentInstance(ParentID)
+	}
+
+	if !t.Agents.Add(Agent) {
+		return errors.New("session " + AgentID + " is already active")
+	}
+
+	logger.Info(fmt.Sprintf("Session %v restored by %v", AgentID, User))
+
+	t.EventBroadcast("", t.EventNewDemon(Agent))
+	t.EventBroadcast("", events.Demons.MarkAs(Agent.NameID, "Dead"))
+
+	/* the transcript of the session */
+	for _, Data := range t.DB.EventsSince(0, math.MaxInt64) {
+		var Package packager.Package
+
+		if err := json.Unmarshal([]byte(Data), &Package); err != nil {
+			continue
+		}
+
+		if archiveSessionOf(Package) != Agent.NameID {
+			continue
+		}
+
+		t.EventBroadcast("", Package)
+	}
+
+	return nil
+}
+
+// ArchivedSessions
+// returns the archived sessions visible to the workspace.
+func (t *Teamserver) ArchivedSessions(Workspace string) []ArchivedSession {
+	var (
+		Sessions   []ArchivedSession
+		Workspaces = t.DB.AgentWorkspaces()
+		TimeZones  = t.DB.AgentTimeZones()
+	)
+
+	for _, Archived := range t.DB.AgentsArchived() {
+		Agent, err := t.DB.AgentGet(Archived.AgentID)
+		if err != nil {
+			continue
+		}
+
+		Agent.Info.Workspace = workspaceOrDefault(Workspaces[Archived.AgentID])
+
+		if !workspaceVisible(Workspace, Agent.Info.Workspace) {
+			continue
+		}
+
+		var TimeZone = TimeZones[Archived.AgentID]
+
+		Agent.Info.TimeZone, Agent.Info.UTCOffset = TimeZone.Name, TimeZone.Offset
+
+		var Session = ArchivedSession{
+			AgentID:     Agent.NameID,
+			Hostname:    Agent.Info.Hostname,
+			Username:    Agent.Info.Username,
+			DomainName:  Agent.Info.DomainName,
+			ProcessName: Agent.Info.ProcessName,
+			ProcessPID:  Agent.Info.ProcessPID,
+			FirstCallIn: Agent.Info.FirstCallIn,
+			LastCallIn:  Agent.Info.LastCallIn,
+			Workspace:   Agent.Info.Workspace,
+			User:        Archived.User,
+			Time:        Archived.Time,
+			LootPath:    Archived.LootPath,
+			TimeZone:    Agent.Info.TimeZone,
+		}
+
+		Session.FirstCallInUTC, Session.FirstCallInLocal = Agent.Info.CallInStamps(Agent.Info.FirstCallIn)
+		Session.LastCallInUTC, Session.LastCallInLocal = Agent.Info.CallInStamps(Agent.Info.LastCallIn)
+
+		Sessions = append(Sessions, Session)
+	}
+
+	return Sessions
+}
+
+// archivedIDs
+// returns the ids of every archived session.
+func (t *Teamserver) archivedIDs() map[string]bool {
+	var Archived = make(map[string]bool)
+
+	for _, Agent := range t.DB.AgentsArchived() {
+		Archived[fmt.Sprintf("%08x", Agent.AgentID)] = true
+	}
+
+	return Archived
+}
+
+// archiveSessionOf
+// returns the id of the session the session event is about.
+func archiveSessionOf(pk packager.Package) string {
+	if pk.Head.Event != packager.Type.Session.Type {
+		return ""
+	}
+
+	for _, Key := range []string{"DemonID", "AgentID"} {
+		if AgentID, ok := pk.Body.Info[Key].(string); ok {
+			return AgentID
+		}
+	}
+
+	return ""
+}
+
+// archiveLoot
+// returns the loot folders of the agent of this and previous teamserver runs.
+func archiveLoot(AgentID string) []string {
+	var (
+		Root       = filepath.Dir(filepath.Dir(logr.LogrInstance.AgentPath))
+		Folders, _ = filepath.Glob(filepath.Join(Root, "*", "agents", AgentID))
+		Loot       []string
+	)
+
+	for _, Folder := range Folders {
+		if Info, err := os.Stat(Folder); err == nil && Info.IsDir() {
+			Loot = append(Loot, Folder)
+		}
+	}
+
+	return Loot
+}
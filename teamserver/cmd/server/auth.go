@@ -0,0 +1,189 @@
+package server
+
+import (
+	"crypto/sha256"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"Havoc/pkg/auth"
+	"Havoc/pkg/colors"
+	"Havoc/pkg/logger"
+	"Havoc/pkg/profile"
+)
+
+// operators a backend authenticated aren't asked again for this long,
+// the http endpoints authenticate every request
+const AUTH_CACHE = 5 * time.Minute
+
+// AuthSetup
+// sets up the directory and the identity provider of the profile the
+// operators without a user block authenticate against.
+func (t *Teamserver) AuthSetup() {
+	var Operators = t.Profile.Config.Operators
+
+	t.Auth.Cache = make(map[[sha256.Size]byte]AuthCached)
+
+	if Operators == nil {
+		return
+	}
+
+	if Config := Operators.Ldap; Config != nil {
+		var (
+			Timeout time.Duration
+			err     error
+		)
+
+		if len(Config.Timeout) > 0 {
+			if Timeout, err = time.ParseDuration(Config.Timeout); err != nil {
+				logger.Error(fmt.Sprintf("Failed to parse the ldap timeout, waiting %v: %v", auth.AUTH_TIMEOUT, err))
+			}
+		}
+
+		Ldap, err := auth.NewLdap(auth.LdapOptions{
+			Url:           Config.Url,
+			StartTLS:      Config.StartTLS,
+			CACert:        Config.CACert,
+			Insecure:      Config.Insecure,
+			BindDN:        Config.BindDN,
+			BindPassword:  Config.BindPassword,
+			BaseDN:        Config.BaseDN,
+			UserAttribute: Config.UserAttribute,
+			UserFilter:    Config.UserFilter,
+			GroupFilter:   Config.GroupFilter,
+			Timeout:       Timeout,
+		})
+		if err != nil {
+			logger.Error("Failed to set up the ldap operators: " + err.Error())
+		} else {
+			t.Auth.Backends = append(t.Auth.Backends, AuthBackend{Backend: Ldap, Groups: Config.Groups})
+
+			if Config.Insecure {
+				logger.Warn("The certificate of the directory isn't verified, the passwords of the operators might end up with anyone")
+			}
+
+			logger.Info(fmt.Sprintf("Operators of the directory %v in %v groups", colors.Blue(Config.Url), len(Config.Groups)))
+		}
+	}
+
+	if Config := Operators.Oidc; Config != nil {
+		Oidc, err := auth.NewOidc(auth.OidcOptions{
+			Issuer:      Config.Issuer,
+			ClientID:    Config.ClientID,
+			UserClaim:   Config.UserClaim,
+			GroupsClaim: Config.GroupsClaim,
+			CACert:      Config.CACert,
+		})
+		if err != nil {
+			logger.Error("Failed to set up the oidc operators: " + err.Error())
+		} else {
+			t.Auth.Backends = append(t.Auth.Backends, AuthBackend{Backend: Oidc, Groups: Config.Groups})
+
+			logger.Info(fmt.Sprintf("Operators of the identity provider %v in %v groups", colors.Blue(Config.Issuer), len(Config.Groups)))
+		}
+	}
+}
+
+// authLocal
+// checks if the operator has a user block in the profile. Those accounts
+// are never authenticated by a backend.
+func (t *Teamserver) authLocal(Name string) bool {
+	if t.Profile == nil || t.Profile.Config.Operators == nil {
+		return false
+	}
+
+	for _, User := range t.Profile.ListOfUsernames() {
+		if strings.EqualFold(User, Name) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// authExternal
+// authenticates the operator against the directory and the identity
+// provider of the profile. Returns its name as the backend knows it, its
+// role and workspace are the ones of the first group of the profile it's in.
+// Operators in none of the groups are refused.
+func (t *Teamserver) authExternal(Credentials auth.Credentials) (string, bool) {
+	if len(t.Auth.Backends) == 0 {
+		return "", false
+	}
+
+	var (
+		Key = sha256.Sum256([]byte(Credentials.User + "\x00" + Credentials.Password + "\x00" + Credentials.Token))
+		Now = time.Now()
+	)
+
+	t.Auth.Lock()
+	Cached, ok := t.Auth.Cache[Key]
+	t.Auth.Unlock()
+
+	if ok && Now.Before(Cached.Expires) {
+		return Cached.Name, true
+	}
+
+	for _, Backend := range t.Auth.Backends {
+		Identity, err := Backend.Backend.Authenticate(Credentials)
+		if errors.Is(err, auth.ErrUnsupported) {
+			continue
+		}
+
+		if err != nil {
+			if !errors.Is(err, auth.ErrInvalid) {
+				logger.Error("Failed to authenticate " + Credentials.User + " against the " + Backend.Backend.Name() + ": " + err.Error())
+			}
+			continue
+		}
+
+		/* the backend would take over the account of the profile */
+		if t.authLocal(Identity.Name) {
+			logger.Warn("Operator " + Identity.Name + " of the " + Backend.Backend.Name() + " is a user of the profile, refused")
+			return "", false
+		}
+
+		var Group *profile.AuthGroupConfig
+
+		for i := range Backend.Groups {
+			for _, Name := range Identity.Groups {
+				if auth.GroupMatches(Backend.Groups[i].Name, Name) {
+					Group = &Backend.Groups[i]
+					break
+				}
+			}
+
+			if Group != nil {
+				break
+			}
+		}
+
+		if Group == nil {
+			logger.Warn("Operator " + Identity.Name + " of the " + Backend.Backend.Name() + " isn't in any group of the profile, refused")
+			return "", false
+		}
+
+		t.Profile.IdentitySet(Identity.Name, Group.Role, Group.Workspace)
+
+		Cached = AuthCached{Name: Identity.Name, Expires: Now.Add(AUTH_CACHE)}
+		if !Identity.Expires.IsZero() && Identity.Expires.Before(Cached.Expires) {
+			Cached.Expires = Identity.Expires
+		}
+
+		t.Auth.Lock()
+		for Stale, Entry := range t.Auth.Cache {
+			if Now.After(Entry.Expires) {
+				delete(t.Auth.Cache, Stale)
+			}
+		}
+		t.Auth.Cache[Key] = Cached
+		t.Auth.Unlock()
+
+		logger.Debug("Operator " + colors.Blue(Identity.Name) + " authenticated by the " + Backend.Backend.Name() + " (group " + Group.Name + ")")
+
+		return Identity.Name, true
+	}
+
+	return "", false
+}
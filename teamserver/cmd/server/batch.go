@@ -0,0 +1,482 @@
+package server
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"path"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"Havoc/pkg/agent"
+	"Havoc/pkg/eventbus"
+	"Havoc/pkg/logger"
+)
+
+const (
+	// batches kept for their results. the oldest one is dropped
+	BATCH_KEEP = 50
+	// output of an agent kept for the result of a batch
+	BATCH_OUTPUT_LIMIT = 64 * 1024
+)
+
+// fields of the agents a batch filter matches
+var batchFields = map[string]func(Info *agent.AgentInfo) string{
+	"host":     func(Info *agent.AgentInfo) string { return Info.Hostname },
+	"user":     func(Info *agent.AgentInfo) string { return Info.Username },
+	"domain":   func(Info *agent.AgentInfo) string { return Info.DomainName },
+	"process":  func(Info *agent.AgentInfo) string { return Info.ProcessName },
+	"os":       func(Info *agent.AgentInfo) string { return Info.OSVersion },
+	"arch":     func(Info *agent.AgentInfo) string { return Info.ProcessArch },
+	"ip":       func(Info *agent.AgentInfo) string { return Info.InternalIP },
+	"listener": func(Info *agent.AgentInfo) string { return Info.Transport },
+	"elevated": func(Info *agent.AgentInfo) string { return Info.Elevated },
+}
+
+// batchFilter
+// parses a filter of space separated field=pattern terms (eg: "os=*10*
+// elevated=true"). Patterns are case insensitive globs and every term
+// has to match.
+func batchFilter(Filter string) (func(Info *agent.AgentInfo) bool, error) {
+	type term struct {
+		Field   func(Info *agent.AgentInfo) string
+		Pattern string
+	}
+
+	var Terms []term
+
+	for _, Term := range strings.Fields(Filter) {
+		Name, Pattern, ok := strings.Cut(Term, "=")
+		if !ok {
+			return nil, fmt.Errorf("filter term %q isn't field=pattern", Term)
+		}
+
+		Field, ok := batchFields[strings.ToLower(Name)]
+		if !ok {
+			return nil, fmt.Errorf("unknown filter field %q", Name)
+		}
+
+		Pattern = strings.ToLower(Pattern)
+
+		if _, err := path.Match(Pattern, ""); err != nil {
+			return nil, fmt.Errorf("invalid filter pattern %q", Pattern)
+		}
+
+		Terms = append(Terms, term{Field: Field, Pattern: Pattern})
+	}
+
+	return func(Info *agent.AgentInfo) bool {
+		for _, Term := range Terms {
+			if Matched, _ := path.Match(Term.Pattern, strings.ToLower(Term.Field(Info))); !Matched {
+				return false
+			}
+		}
+
+		return true
+	}, nil
+}
+
+// BatchSelect
+// returns the active demons of the workspace the selection matches.
+// Agents (comma separated ids), Group (see GroupMembers), Tag, Subnet
+// (cidr of the internal or external ip) and Filter (see batchFilter)
+// are combined, at least one of them is required.
+func (t *Teamserver) BatchSelect(Workspace string, Info map[string]any) ([]*agent.Agent, error) {
+	var Given = false
+
+	for _, Key := range []string{"Agents", "Group", "Tag", "Subnet", "Filter"} {
+		if Value, _ := Info[Key].(string); len(Value) > 0 {
+			Given = true
+		}
+	}
+
+	if !Given {
+		return nil, errors.New("select the agents by id, group, tag, subnet or filter")
+	}
+
+	Selected, err := t.batchMatch(Workspace, Info)
+	if err != nil {
+		return nil, err
+	}
+
+	if len(Selected) == 0 {
+		return nil, errors.New("no active agent matches the selection")
+	}
+
+	return Selected, nil
+}
+
+// batchMatch
+// returns the active demons of the workspace matching every part of the
+// selection given.
+func (t *Teamserver) batchMatch(Workspace string, Info map[string]any) ([]*agent.Agent, error) {
+	var (
+		Agents, _ = Info["Agents"].(string)
+		Group, _  = Info["Group"].(string)
+		Tag, _    = Info["Tag"].(string)
+		Subnet, _ = Info["Subnet"].(string)
+		Filter, _ = Info["Filter"].(string)
+		IDs       map[string]bool
+		Grouped   map[string]bool
+		Network   *net.IPNet
+		Match     func(Info *agent.AgentInfo) bool
+		Tags      map[int][]string
+		Selected  []*agent.Agent
+		err       error
+	)
+
+	if len(Group) > 0 {
+		Members, err := t.GroupMembers(Workspace, Group)
+		if err != nil {
+			return nil, err
+		}
+
+		Grouped = make(map[string]bool)
+
+		for _, Agent := range Members {
+			Grouped[Agent.NameID] = true
+		}
+	}
+
+	if len(Agents) > 0 {
+		IDs = make(map[string]bool)
+
+		for _, ID := range strings.Split(Agents, ",") {
+			IDs[strings.TrimSpace(ID)] = true
+		}
+	}
+
+	if len(Subnet) > 0 {
+		if _, Network, err = net.ParseCIDR(Subnet); err != nil {
+			return nil, errors.New("invalid subnet: " + Subnet)
+		}
+	}
+
+	if len(Filter) > 0 {
+		if Match, err = batchFilter(Filter); err != nil {
+			return nil, err
+		}
+	}
+
+	if len(Tag) > 0 {
+		Tags = t.DB.AgentTags()
+	}
+
+	for _, Agent := range t.Agents.List() {
+		if !Agent.Active || Agent.Info == nil || Agent.Info.MagicValue != agent.DEMON_MAGIC_VALUE {
+			continue
+		}
+
+		if !workspaceVisible(Workspace, Agent.Info.Workspace) {
+			continue
+		}
+
+		if IDs != nil && !IDs[Agent.NameID] {
+			continue
+		}
+
+		if Grouped != nil && !Grouped[Agent.NameID] {
+			continue
+		}
+
+		if len(Tag) > 0 {
+			var (
+				NameID, _ = strconv.ParseInt(Agent.NameID, 16, 64)
+				Tagged    = false
+			)
+
+			for _, Name := range Tags[int(NameID)] {
+				if strings.EqualFold(Name, Tag) {
+					Tagged = true
+					break
+				}
+			}
+
+			if !Tagged {
+				continue
+			}
+		}
+
+		if Network != nil {
+			var (
+				Internal = net.ParseIP(Agent.Info.InternalIP)
+				External = net.ParseIP(Agent.Info.ExternalIP)
+			)
+
+			if !(Internal != nil && Network.Contains(Internal)) && !(External != nil && Network.Contains(External)) {
+				continue
+			}
+		}
+
+		if Match != nil && !Match(Agent.Info) {
+			continue
+		}
+
+		Selected = append(Selected, Agent)
+	}
+
+	return Selected, nil
+}
+
+// BatchQueue
+// queues the same command (see TaskCommand) against every selected agent.
+func (t *Teamserver) BatchQueue(User string, Info map[string]any) (*Batch, error) {
+	var Workspace = t.UserWorkspace(User)
+
+	Agents, err := t.BatchSelect(Workspace, Info)
+	if err != nil {
+		return nil, err
+	}
+
+	Command, err := t.TaskCommand(Info)
+	if err != nil {
+		return nil, err
+	}
+
+	var Batch = &Batch{
+		ID:          randomID(),
+		CommandLine: Command["CommandLine"].(string),
+		User:        User,
+		Workspace:   Workspace,
+		Time:        time.Now().Format("02/01/2006 15:04:05"),
+	}
+
+	Batch.Template, _ = Info["Template"].(string)
+	Batch.Group, _ = Info["Group"].(string)
+
+	for _, Agent := range Agents {
+		var Task = &BatchTask{
+			AgentID:  Agent.NameID,
+			Hostname: Agent.Info.Hostname,
+			Username: Agent.Info.Username,
+			TaskID:   strings.ToUpper(randomID()),
+			Status:   TASK_QUEUED,
+		}
+
+		t.Batches.Lock()
+		t.Batches.Tasks[Task.TaskID] = Task
+		t.Batches.Unlock()
+
+		Batch.Tasks = append(Batch.Tasks, Task)
+
+		var Status = t.TaskQueue(User, Agent, Task.TaskID, Command)
+
+		t.Batches.Lock()
+		if Task.Status == TASK_QUEUED {
+			Task.Status = Status
+		}
+		t.Batches.Unlock()
+	}
+
+	t.Batches.Lock()
+	t.Batches.Jobs = append(t.Batches.Jobs, Batch)
+
+	if len(t.Batches.Jobs) > BATCH_KEEP {
+		for _, Task := range t.Batches.Jobs[0].Tasks {
+			delete(t.Batches.Tasks, Task.TaskID)
+		}
+
+		t.Batches.Jobs = t.Batches.Jobs[1:]
+	}
+	t.Batches.Unlock()
+
+	logger.Info(fmt.Sprintf("Batch %v of %v: %v queued against %v agents", Batch.ID, User, Batch.CommandLine, len(Batch.Tasks)))
+
+	return Batch, nil
+}
+
+// BatchOutput
+// adds the output the agent prints to the result of its batch task.
+func (t *Teamserver) BatchOutput(AgentID string, Output map[string]string) {
+	var Agent = t.Agents.Get(AgentID)
+
+	if Agent == nil {
+		return
+	}
+
+	var TaskID = Agent.Answering()
+
+	if len(TaskID) == 0 {
+		return
+	}
+
+	t.Batches.Lock()
+	defer t.Batches.Unlock()
+
+	Task, ok := t.Batches.Tasks[TaskID]
+	if !ok || len(Task.Output) >= BATCH_OUTPUT_LIMIT {
+		return
+	}
+
+	for _, Key := range []string{"Message", "Output"} {
+		if len(Output[Key]) > 0 {
+			Task.Output += strings.TrimRight(Output[Key], "\n") + "\n"
+		}
+	}
+
+	if len(Task.Output) >= BATCH_OUTPUT_LIMIT {
+		Task.Output = Task.Output[:BATCH_OUTPUT_LIMIT] + "\n[output truncated]\n"
+	}
+}
+
+// batchComplete
+// completes the batch task of the event.
+func (t *Teamserver) batchComplete(Event eventbus.Event) error {
+	var TaskID, _ = Event.Data["TaskID"].(string)
+
+	t.Batches.Lock()
+	defer t.Batches.Unlock()
+
+	if Task, ok := t.Batches.Tasks[TaskID]; ok {
+		Task.Status = TASK_COMPLETE
+		Task.Completed = Event.Time.Format("02/01/2006 15:04:05")
+	}
+
+	return nil
+}
+
+// BatchList
+// returns the progress of the batches of the workspace.
+func (t *Teamserver) BatchList(Workspace string) []BatchSummary {
+	var Summaries []BatchSummary
+
+	t.Batches.Lock()
+	defer t.Batches.Unlock()
+
+	for _, Batch := range t.Batches.Jobs {
+		if !workspaceVisible(Workspace, Batch.Workspace) {
+			continue
+		}
+
+		var Summary = BatchSummary{
+			ID:          Batch.ID,
+			CommandLine: Batch.CommandLine,
+			Template:    Batch.Template,
+			Group:       Batch.Group,
+			User:        Batch.User,
+			Time:        Batch.Time,
+			Agents:      len(Batch.Tasks),
+		}
+
+		for _, Task := range Batch.Tasks {
+			switch Task.Status {
+			case TASK_COMPLETE:
+				Summary.Complete++
+			case TASK_FAILED:
+				Summary.Failed++
+			default:
+				Summary.Pending++
+			}
+		}
+
+		Summaries = append(Summaries, Summary)
+	}
+
+	return Summaries
+}
+
+// BatchResult
+// returns the tasks of the batch and groups the agents by their output,
+// so the agents which answered differently stand out.
+func (t *Teamserver) BatchResult(Workspace, ID string) (*BatchResult, error) {
+	var (
+		Result = new(BatchResult)
+		Groups = make(map[string]*BatchGroup)
+	)
+
+	t.Batches.Lock()
+	defer t.Batches.Unlock()
+
+	for _, Batch := range t.Batches.Jobs {
+		if Batch.ID != ID || !workspaceVisible(Workspace, Batch.Workspace) {
+			continue
+		}
+
+		Result.Batch = *Batch
+		Result.Batch.Tasks = nil
+
+		for _, Task := range Batch.Tasks {
+			Result.Batch.Tasks = append(Result.Batch.Tasks, &BatchTask{
+				AgentID:   Task.AgentID,
+				Hostname:  Task.Hostname,
+				Username:  Task.Username,
+				TaskID:    Task.TaskID,
+				Status:    Task.Status,
+				Output:    Task.Output,
+				Completed: Task.Completed,
+			})
+
+			if Task.Status != TASK_COMPLETE {
+				continue
+			}
+
+			var Output = strings.TrimSpace(Task.Output)
+
+			if _, ok := Groups[Output]; !ok {
+				Groups[Output] = &BatchGroup{Output: Output}
+			}
+
+			Groups[Output].Agents = append(Groups[Output].Agents, Task.AgentID)
+		}
+
+		for _, Group := range Groups {
+			Result.Groups = append(Result.Groups, *Group)
+		}
+
+		/* the most common output first */
+		sort.Slice(Result.Groups, func(i, j int) bool {
+			if len(Result.Groups[i].Agents) != len(Result.Groups[j].Agents) {
+				return len(Result.Groups[i].Agents) > len(Result.Groups[j].Agents)
+			}
+
+			return Result.Groups[i].Output < Result.Groups[j].Output
+		})
+
+		return Result, nil
+	}
+
+	return nil, errors.New("batch " + ID + " not found")
+}
+
+// AgentTagsSet
+// replaces the tags of the agent (comma separated).
+func (t *Teamserver) AgentTagsSet(User, AgentID, List string) error {
+	var Tags []string
+
+	NameID, err := strconv.ParseInt(AgentID, 16, 64)
+	if err != nil || t.Agents.Get(AgentID) == nil {
+		return errors.New("agent " + AgentID + " not found")
+	}
+
+	for _, Tag := range strings.Split(List, ",") {
+		if Tag = strings.TrimSpace(Tag); len(Tag) > 0 {
+			Tags = append(Tags, Tag)
+		}
+	}
+
+	if err = t.DB.AgentTagsSet(int(NameID), Tags); err != nil {
+		return err
+	}
+
+	logger.Info(fmt.Sprintf("Agent %v tagged by %v: %v", AgentID, User, strings.Join(Tags, ", ")))
+
+	return nil
+}
+
+// AgentTags
+// returns the tags of the agents of the workspace.
+func (t *Teamserver) AgentTags(Workspace string) map[string][]string {
+	var Tags = make(map[string][]string)
+
+	for NameID, List := range t.DB.AgentTags() {
+		var AgentID = fmt.Sprintf("%08x", NameID)
+
+		if Agent := t.Agents.Get(AgentID); Agent != nil && Agent.Info != nil && workspaceVisible(Workspace, Agent.Info.Workspace) {
+			Tags[AgentID] = List
+		}
+	}
+
+	return Tags
+}
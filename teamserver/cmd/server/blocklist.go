@@ -0,0 +1,258 @@
+package server
+
+import (
+	"errors"
+	"fmt"
+	"regexp"
+	"strings"
+	"time"
+
+	"Havoc/pkg/db"
+	"Havoc/pkg/logger"
+	"Havoc/pkg/profile"
+)
+
+// BlocklistSetup
+// loads the blocklist rules of the profile and the ones the admins
+// added in previous runs.
+func (t *Teamserver) BlocklistSetup() {
+	var Rules []*BlockRule
+
+	if t.Profile.Config.Server != nil && t.Profile.Config.Server.Blocklist != nil {
+		for _, Config := range t.Profile.Config.Server.Blocklist.Rules {
+			Rule, err := blockRuleCompile(db.BlockRule{
+				Name:    Config.Name,
+				Command: Config.Command,
+				Pattern: Config.Pattern,
+				Reason:  Config.Reason,
+				User:    "profile",
+			})
+			if err != nil {
+				logger.Error("Failed to load blocklist rule: " + err.Error())
+				continue
+			}
+
+			Rule.Profile = true
+			Rules = append(Rules, Rule)
+		}
+	}
+
+	for _, Saved := range t.DB.BlockRules() {
+		Rule, err := blockRuleCompile(Saved)
+		if err != nil {
+			logger.Error("Failed to load blocklist rule: " + err.Error())
+			continue
+		}
+
+		if blockRuleFind(Rules, Rule.Name) >= 0 {
+			logger.Warn("Blocklist rule " + Rule.Name + " of the database is shadowed by the profile")
+			continue
+		}
+
+		Rules = append(Rules, Rule)
+	}
+
+	t.Blocklist.Lock()
+	t.Blocklist.Rules = Rules
+	t.Blocklist.Unlock()
+
+	if len(Rules) > 0 {
+		logger.Info(fmt.Sprintf("Command blocklist: %v rules", len(Rules)))
+	}
+}
+
+// BlocklistSave
+// adds or replaces a rule of the command blocklist. Only admins are
+// allowed to change the blocklist.
+func (t *Teamserver) BlocklistSave(User string, Info map[string]any) error {
+	var Saved = db.BlockRule{User: User, Time: time.Now().Format("02/01/2006 15:04:05")}
+
+	if t.Profile.UserRole(User) != profile.ROLE_ADMIN {
+		return errors.New("only admins are allowed to change the blocklist")
+	}
+
+	Saved.Name, _ = Info["Name"].(string)
+	Saved.Command, _ = Info["Command"].(string)
+	Saved.Pattern, _ = Info["Pattern"].(string)
+	Saved.Reason, _ = Info["Reason"].(string)
+
+	Rule, err := blockRuleCompile(Saved)
+	if err != nil {
+		return err
+	}
+
+	t.Blocklist.Lock()
+	defer t.Blocklist.Unlock()
+
+	var Index = blockRuleFind(t.Blocklist.Rules, Rule.Name)
+	if Index >= 0 && t.Blocklist.Rules[Index].Profile {
+		return errors.New("blocklist rule " + Rule.Name + " is part of the profile")
+	}
+
+	if err = t.DB.BlockRuleSet(Saved); err != nil {
+		return err
+	}
+
+	if Index >= 0 {
+		t.Blocklist.Rules[Index] = Rule
+	} else {
+		t.Blocklist.Rules = append(t.Blocklist.Rules, Rule)
+	}
+
+	logger.Info(fmt.Sprintf("Blocklist rule %v [command: %v, pattern: %v] saved by %v", Rule.Name, Rule.Command, Rule.Pattern, User))
+
+	return nil
+}
+
+// BlocklistRemove
+// removes a rule the admins added to the command blocklist.
+func (t *Teamserver) BlocklistRemove(User, Name string) error {
+	if t.Profile.UserRole(User) != profile.ROLE_ADMIN {
+		return errors.New("only admins are allowed to change the blocklist")
+	}
+
+	t.Blocklist.Lock()
+	defer t.Blocklist.Unlock()
+
+	var Index = blockRuleFind(t.Blocklist.Rules, Name)
+	if Index < 0 {
+		return errors.New("blocklist rule " + Name + " not found")
+	}
+
+	if t.Blocklist.Rules[Index].Profile {
+		return errors.New("blocklist rule " + Name + " is part of the profile")
+	}
+
+	if _, err := t.DB.BlockRuleRemove(Name); err != nil {
+		return err
+	}
+
+	t.Blocklist.Rules = append(t.Blocklist.Rules[:Index], t.Blocklist.Rules[Index+1:]...)
+
+	logger.Info(fmt.Sprintf("Blocklist rule %v removed by %v", Name, User))
+
+	return nil
+}
+
+// BlocklistRules
+// returns the rules of the command blocklist.
+func (t *Teamserver) BlocklistRules() []BlockRule {
+	var Rules []BlockRule
+
+	t.Blocklist.RLock()
+	defer t.Blocklist.RUnlock()
+
+	for _, Rule := range t.Blocklist.Rules {
+		Rules = append(Rules, *Rule)
+	}
+
+	return Rules
+}
+
+// BlocklistMatch
+// returns the rule that blocks the command line. Commands are the names
+// of the command the line got resolved to (the first word of the line
+// and the name of the agent command).
+func (t *Teamserver) BlocklistMatch(CommandLine string, Commands ...string) *BlockRule {
+	if Fields := strings.Fields(CommandLine); len(Fields) > 0 {
+		Commands = append(Commands, Fields[0])
+	}
+
+	t.Blocklist.RLock()
+	defer t.Blocklist.RUnlock()
+
+	for _, Rule := range t.Blocklist.Rules {
+		if len(Rule.Commands) > 0 && !blockRuleCommand(Rule.Commands, Commands) {
+			continue
+		}
+
+		if Rule.Regex != nil && !Rule.Regex.MatchString(CommandLine) {
+			continue
+		}
+
+		return Rule
+	}
+
+	return nil
+}
+
+// BlocklistCheck
+// returns an error telling the operator why the command line is blocked.
+func (t *Teamserver) BlocklistCheck(User, AgentID, CommandLine string, Commands ...string) error {
+	var Rule = t.BlocklistMatch(CommandLine, Commands...)
+
+	if Rule == nil {
+		return nil
+	}
+
+	logger.Warn(fmt.Sprintf("Blocked command of %v on agent %v by blocklist rule %v: %v", User, AgentID, Rule.Name, CommandLine))
+
+	if len(Rule.Reason) > 0 {
+		return errors.New("command blocked by rule " + Rule.Name + ": " + Rule.Reason)
+	}
+
+	return errors.New("command blocked by rule " + Rule.Name)
+}
+
+// blockRuleCompile
+// validates the rule and compiles its pattern. Patterns are case insensitive.
+func blockRuleCompile(Saved db.BlockRule) (*BlockRule, error) {
+	var (
+		Rule = &BlockRule{BlockRule: Saved}
+		err  error
+	)
+
+	if len(Rule.Name) == 0 {
+		return nil, errors.New("blocklist rule name is required")
+	}
+
+	Rule.Commands = ruleCommands(Rule.Command)
+
+	if len(Rule.Pattern) > 0 {
+		if Rule.Regex, err = regexp.Compile("(?i)" + Rule.Pattern); err != nil {
+			return nil, fmt.Errorf("blocklist rule %v has an invalid pattern: %v", Rule.Name, err)
+		}
+	}
+
+	if len(Rule.Commands) == 0 && Rule.Regex == nil {
+		return nil, errors.New("blocklist rule " + Rule.Name + " requires a command or a pattern")
+	}
+
+	return Rule, nil
+}
+
+// ruleCommands
+// splits the comma separated commands of a rule.
+func ruleCommands(Command string) []string {
+	var Commands []string
+
+	for _, Name := range strings.Split(Command, ",") {
+		if Name = strings.TrimSpace(Name); len(Name) > 0 {
+			Commands = append(Commands, strings.ToLower(Name))
+		}
+	}
+
+	return Commands
+}
+
+func blockRuleFind(Rules []*BlockRule, Name string) int {
+	for i, Rule := range Rules {
+		if Rule.Name == Name {
+			return i
+		}
+	}
+
+	return -1
+}
+
+func blockRuleCommand(Rules []string, Commands []string) bool {
+	for _, Command := range Commands {
+		for _, Rule := range Rules {
+			if strings.EqualFold(Rule, Command) {
+				return true
+			}
+		}
+	}
+
+	return false
+}
@@ -0,0 +1,57 @@
+package server
+
+import (
+	"fmt"
+
+	"Havoc/pkg/budget"
+	"Havoc/pkg/logger"
+)
+
+// BudgetSetup
+// creates the resource budgets of the subsystems and applies the hard
+// caps of the profile.
+func (t *Teamserver) BudgetSetup() {
+	t.Budgets = make(map[string]*budget.Budget)
+
+	for _, Name := range budget.Subsystems {
+		t.Budgets[Name] = budget.NewBudget(Name)
+	}
+
+	if t.Profile.Config.Server == nil {
+		return
+	}
+
+	for _, Config := range t.Profile.Config.Server.Budgets {
+		var Budget, ok = t.Budgets[Config.Subsystem]
+
+		if !ok {
+			logger.Error(fmt.Sprintf("Unknown budget subsystem %v (supported: %v)", Config.Subsystem, budget.Subsystems))
+			continue
+		}
+
+		if Config.Goroutines < 0 || Config.Sockets < 0 || Config.Memory < 0 {
+			logger.Error("Budget of " + Config.Subsystem + " can't be negative")
+			continue
+		}
+
+		Budget.SetLimit(budget.Goroutines, int64(Config.Goroutines))
+		Budget.SetLimit(budget.Sockets, int64(Config.Sockets))
+		Budget.SetLimit(budget.Memory, int64(Config.Memory))
+
+		logger.Info(fmt.Sprintf("Budget of %v: %v goroutines, %v sockets, %v memory", Config.Subsystem, budgetMax(Config.Goroutines), budgetMax(Config.Sockets), exfilMax(int64(Config.Memory))))
+	}
+}
+
+// Budget
+// returns the resource budget of the subsystem.
+func (t *Teamserver) Budget(Subsystem string) *budget.Budget {
+	return t.Budgets[Subsystem]
+}
+
+func budgetMax(Limit int) string {
+	if Limit == 0 {
+		return "unlimited"
+	}
+
+	return fmt.Sprint(Limit)
+}
@@ -0,0 +1,239 @@
+package server
+
+import (
+	"crypto/ed25519"
+	"encoding/base64"
+	"errors"
+	"time"
+
+	"Havoc/pkg/common/bundle"
+	"Havoc/pkg/common/certs"
+	"Havoc/pkg/handlers"
+	"Havoc/pkg/logger"
+)
+
+// BundleKey
+// returns the key bundles are signed with. A new key is
+// generated and saved in the database on first use.
+func (t *Teamserver) BundleKey() (ed25519.PrivateKey, error) {
+	if Encoded := t.DB.SettingGet("BundleKey"); len(Encoded) > 0 {
+		Data, err := base64.StdEncoding.DecodeString(Encoded)
+		if err == nil && len(Data) == ed25519.PrivateKeySize {
+			return ed25519.PrivateKey(Data), nil
+		}
+
+		logger.Error("Failed to decode bundle signing key. Generating a new one")
+	}
+
+	Key, err := bundle.GenerateKey()
+	if err != nil {
+		return nil, err
+	}
+
+	if err = t.DB.SettingSet("BundleKey", base64.StdEncoding.EncodeToString(Key)); err != nil {
+		return nil, err
+	}
+
+	logger.Info("Generated bundle signing key: " + bundle.PublicKey(Key))
+
+	return Key, nil
+}
+
+// BundleTrusted
+// returns the keys of every teamserver we accept bundles from (including our own).
+func (t *Teamserver) BundleTrusted() []ed25519.PublicKey {
+	var Trusted []ed25519.PublicKey
+
+	if Key, err := t.BundleKey(); err == nil {
+		Trusted = append(Trusted, Key.Public().(ed25519.PublicKey))
+	}
+
+	if t.Profile.Config.Server != nil && t.Profile.Config.Server.Bundles != nil {
+		for _, Encoded := range t.Profile.Config.Server.Bundles.Trusted {
+			Key, err := bundle.ParsePublicKey(Encoded)
+			if err != nil {
+				logger.Error("Failed to parse trusted bundle key " + Encoded + ": " + err.Error())
+				continue
+			}
+
+			Trusted = append(Trusted, Key)
+		}
+	}
+
+	return Trusted
+}
+
+// BundleExport
+// exports the listener config, certificate subject and given
+// payload defaults as signed bundle.
+func (t *Teamserver) BundleExport(User, ListenerName, Name string, Payload map[string]any) (string, error) {
+	var (
+		Bundled = &bundle.Bundle{
+			Name:    Name,
+			Author:  User,
+			Created: time.Now().Format("02/01/2006 15:04:05"),
+			Payload: Payload,
+		}
+		Found = false
+	)
+
+	if len(Bundled.Name) == 0 {
+		Bundled.Name = ListenerName
+	}
+
+	for _, listener := range t.Listeners {
+		if listener.Name != ListenerName {
+			continue
+		}
+
+		switch listener.Config.(type) {
+		case *handlers.HTTP:
+			var (
+				HTTP   = listener.Config.(*handlers.HTTP)
+				Config = HTTP.Config
+			)
+
+			/* strip everything that is specific to this teamserver */
+			Config.Cert.Cert = ""
+			Config.Cert.Key = ""
+			Config.Workspace = ""
+			Config.BehindRedir = false
+			Config.Proxy.Username = ""
+			Config.Proxy.Password = ""
+			Config.CertTemplate = nil
+
+			Bundled.Listener.Protocol = handlers.AGENT_HTTP
+			Bundled.Listener.Http = &Config
+			Bundled.Cert = HTTP.Config.CertTemplate
+
+			if len(HTTP.TLS.Cert) > 0 {
+				if Template, err := certs.TemplateFromCert(HTTP.TLS.Cert); err == nil {
+					Bundled.Cert = Template
+				} else {
+					logger.Debug("Failed to get certificate subject: " + err.Error())
+				}
+			}
+			break
+
+		case *handlers.SMB:
+			var Config = listener.Config.(*handlers.SMB).Config
+
+			Config.Workspace = ""
+
+			Bundled.Listener.Protocol = handlers.AGENT_PIVOT_SMB
+			Bundled.Listener.Smb = &Config
+			break
+
+		case *handlers.External:
+			var Config = listener.Config.(*handlers.External).Config
+
+			Config.Workspace = ""
+
+			Bundled.Listener.Protocol = handlers.AGENT_EXTERNAL
+			Bundled.Listener.External = &Config
+			break
+		}
+
+		Found = true
+		break
+	}
+
+	if !Found {
+		return "", errors.New("listener " + ListenerName + " not found")
+	}
+
+	Key, err := t.BundleKey()
+	if err != nil {
+		return "", err
+	}
+
+	Data, err := bundle.Export(Bundled, Key)
+	if err != nil {
+		return "", err
+	}
+
+	logger.Info("Listener " + ListenerName + " exported as bundle by " + User)
+
+	return string(Data), nil
+}
+
+// BundleImport
+// verifies the bundle and starts the listener of it inside the given workspace.
+// returns the bundle and the name of the started listener.
+func (t *Teamserver) BundleImport(User, Data, Name, Workspace string) (*bundle.Bundle, string, error) {
+	var (
+		Bundled *bundle.Bundle
+		err     error
+	)
+
+	if Bundled, err = bundle.Import([]byte(Data), t.BundleTrusted()); err != nil {
+		return nil, "", err
+	}
+
+	switch Bundled.Listener.Protocol {
+
+	case handlers.AGENT_HTTP, handlers.AGENT_HTTPS:
+		if Bundled.Listener.Http == nil {
+			return nil, "", errors.New("bundle has no http listener config")
+		}
+
+		var Config = *Bundled.Listener.Http
+
+		if len(Name) > 0 {
+			Config.Name = Name
+		}
+
+		Config.Workspace = Workspace
+		Config.CertTemplate = Bundled.Cert
+		Config.BehindRedir = t.Profile.Config.Demon.TrustXForwardedFor
+
+		err = t.ListenerStart(handlers.LISTENER_HTTP, Config)
+		Name = Config.Name
+		break
+
+	case handlers.AGENT_PIVOT_SMB:
+		if Bundled.Listener.Smb == nil {
+			return nil, "", errors.New("bundle has no smb listener config")
+		}
+
+		var Config = *Bundled.Listener.Smb
+
+		if len(Name) > 0 {
+			Config.Name = Name
+		}
+
+		Config.Workspace = Workspace
+
+		err = t.ListenerStart(handlers.LISTENER_PIVOT_SMB, Config)
+		Name = Config.Name
+		break
+
+	case handlers.AGENT_EXTERNAL:
+		if Bundled.Listener.External == nil {
+			return nil, "", errors.New("bundle has no external listener config")
+		}
+
+		var Config = *Bundled.Listener.External
+
+		if len(Name) > 0 {
+			Config.Name = Name
+		}
+
+		Config.Workspace = Workspace
+
+		err = t.ListenerStart(handlers.LISTENER_EXTERNAL, Config)
+		Name = Config.Name
+		break
+
+	default:
+		return nil, "", errors.New("unknown bundle listener protocol: " + Bundled.Listener.Protocol)
+	}
+
+	if err != nil {
+		return nil, "", err
+	}
+
+	logger.Info("Bundle " + Bundled.Name + " (by " + Bundled.Author + ") imported by " + User + " as listener " + Name)
+
+	return Bundled, Name, nil
+}
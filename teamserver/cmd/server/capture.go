@@ -0,0 +1,49 @@
+package server
+
+import (
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+
+	"Havoc/pkg/handlers"
+	"Havoc/pkg/logger"
+)
+
+// Capture
+// serves the requests the capture of a http listener recorded and the
+// responses to them. Only admins are allowed to use it.
+func (t *Teamserver) Capture(ctx *gin.Context) {
+	var Name = ctx.Param("listener")
+
+	User, ok := t.adminAuthenticate(ctx, "capture")
+	if !ok {
+		return
+	}
+
+	for _, Listener := range t.Listeners {
+		if Listener.Name != Name {
+			continue
+		}
+
+		HTTP, ok := Listener.Config.(*handlers.HTTP)
+		if !ok {
+			break
+		}
+
+		logger.Info("User " + User + " requested the capture of listener " + Name)
+
+		ctx.Header("Content-Type", "text/plain; charset=utf-8")
+		ctx.Status(http.StatusOK)
+
+		if err := HTTP.CaptureDump(ctx.Writer); err != nil {
+			if !ctx.Writer.Written() {
+				ctx.String(http.StatusNotFound, err.Error()+"\n")
+			}
+			logger.Debug("Failed to dump capture of listener " + Name + ": " + err.Error())
+		}
+
+		return
+	}
+
+	ctx.String(http.StatusNotFound, "http listener "+Name+" not found\n")
+}
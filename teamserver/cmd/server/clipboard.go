@@ -0,0 +1,77 @@
+package server
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"strconv"
+	"strings"
+	"time"
+
+	"Havoc/pkg/agent"
+	"Havoc/pkg/db"
+)
+
+// entries of the clipboard history returned by default
+const CLIPBOARD_HISTORY = 200
+
+// ClipboardAdd
+// adds the captured clipboard text to the history of the host of the
+// agent. returns the id of the entry and if the host copied it before.
+func (t *Teamserver) ClipboardAdd(Agent *agent.Agent, Text string) (int, bool, error) {
+	var (
+		Now   = time.Now()
+		Hash  = sha256.Sum256([]byte(Text))
+		Entry = db.ClipboardEntry{
+			Workspace: workspaceOrDefault(Agent.Info.Workspace),
+			Host:      strings.ToLower(Agent.Info.Hostname),
+			AgentID:   Agent.NameID,
+			Hash:      hex.EncodeToString(Hash[:]),
+			Text:      Text,
+			First:     Now.Format("02/01/2006 15:04:05"),
+			Last:      Now.Format("02/01/2006 15:04:05"),
+			Seen:      Now.Unix(),
+		}
+	)
+
+	return t.DB.ClipboardAdd(Entry)
+}
+
+// ClipboardHistory
+// returns the clipboard history of the workspace, most recent first.
+// Host limits it to a host, Query to the texts containing it (case
+// insensitive) and Limit caps the count of entries.
+func (t *Teamserver) ClipboardHistory(Workspace string, Info map[string]any) []db.ClipboardEntry {
+	var (
+		Host, _  = Info["Host"].(string)
+		Query, _ = Info["Query"].(string)
+		Limit    = CLIPBOARD_HISTORY
+		Entries  []db.ClipboardEntry
+	)
+
+	if val, ok := Info["Limit"].(string); ok {
+		if Number, err := strconv.Atoi(val); err == nil && Number > 0 {
+			Limit = Number
+		}
+	}
+
+	Query = strings.ToLower(Query)
+
+	for _, Entry := range t.DB.Clipboard(strings.ToLower(Host)) {
+		if !workspaceVisible(Workspace, Entry.Workspace) {
+			continue
+		}
+
+		/* the texts might be sealed, so this can't be left to sqlite */
+		if len(Query) > 0 && !strings.Contains(strings.ToLower(Entry.Text), Query) {
+			continue
+		}
+
+		Entries = append(Entries, Entry)
+
+		if len(Entries) >= Limit {
+			break
+		}
+	}
+
+	return Entries
+}
@@ -0,0 +1,191 @@
+package server
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"Havoc/pkg/db"
+	"Havoc/pkg/logger"
+	"Havoc/pkg/secrets"
+)
+
+// CrackingJob
+// job file of the hashes of one type for hashcat or john.
+type CrackingJob struct {
+	Name        string
+	Type        string
+	Mode        int
+	Format      string
+	Command     string
+	Hashes      string
+	Credentials []int
+}
+
+// CrackingExport
+// builds a job file for every type of hash in the credential store of the
+// workspace. Types limits the export to the named hash types. Credentials
+// that already have a password are skipped.
+func (t *Teamserver) CrackingExport(Workspace, Format string, Types []string) ([]CrackingJob, error) {
+	var (
+		Jobs   = make(map[string]*CrackingJob)
+		Seen   = make(map[string]bool)
+		Export []CrackingJob
+	)
+
+	switch Format = strings.ToLower(Format); Format {
+
+	case "":
+		Format = secrets.FORMAT_HASHCAT
+
+	case secrets.FORMAT_HASHCAT, secrets.FORMAT_JOHN:
+
+	default:
+		return nil, errors.New("unknown cracking format: " + Format)
+
+	}
+
+	for _, Credential := range t.Credentials(Workspace) {
+		if len(Credential.Hash) == 0 || len(Credential.Password) > 0 {
+			continue
+		}
+
+		Hash, ok := secrets.HashParse(Credential.Username, Credential.Hash)
+		if !ok || !crackingType(Types, Hash.Type.Name) {
+			continue
+		}
+
+		var Job, exists = Jobs[Hash.Type.Name]
+		if !exists {
+			Job = &CrackingJob{Type: Hash.Type.Name, Mode: Hash.Type.Hashcat, Format: Format}
+			Job.Name, Job.Command = secrets.HashFile(Hash.Type, Format)
+
+			Jobs[Hash.Type.Name] = Job
+		}
+
+		Job.Credentials = append(Job.Credentials, Credential.ID)
+
+		/* the same hash of different credentials is cracked once */
+		var Line = secrets.HashLine(Hash, Format)
+		if Seen[Hash.Type.Name+"\x00"+Line] {
+			continue
+		}
+
+		Seen[Hash.Type.Name+"\x00"+Line] = true
+		Job.Hashes += Line + "\n"
+	}
+
+	for _, Type := range secrets.HashTypes() {
+		if Job, ok := Jobs[Type]; ok {
+			Export = append(Export, *Job)
+		}
+	}
+
+	return Export, nil
+}
+
+// CrackingImport
+// attaches the plaintexts of a hashcat or john potfile to the credentials
+// of the workspace with the cracked hashes. returns the number of
+// credentials that got a password.
+func (t *Teamserver) CrackingImport(User, Potfile string) (int, error) {
+	var (
+		Workspace = t.UserWorkspace(User)
+		Hashes    = make(map[string][]db.Credential)
+		Scanner   = bufio.NewScanner(strings.NewReader(Potfile))
+		Cracked   = 0
+	)
+
+	for _, Credential := range t.Credentials(Workspace) {
+		if len(Credential.Hash) == 0 || len(Credential.Password) > 0 {
+			continue
+		}
+
+		if Hash, ok := secrets.HashParse(Credential.Username, Credential.Hash); ok {
+			Hashes[strings.ToLower(Hash.Hash)] = append(Hashes[strings.ToLower(Hash.Hash)], Credential)
+		}
+	}
+
+	if len(Hashes) == 0 {
+		return 0, errors.New("no uncracked hashes in the credential store")
+	}
+
+	Scanner.Buffer(make([]byte, 0x10000), 0x1000000)
+
+	for Scanner.Scan() {
+		Hash, Plain, ok := secrets.PotParse(Scanner.Text(), func(Hash string) bool {
+			_, ok := Hashes[strings.ToLower(Hash)]
+			return ok
+		})
+
+		if !ok {
+			continue
+		}
+
+		for _, Credential := range Hashes[strings.ToLower(Hash)] {
+			Credential.Password = Plain
+			Credential.Metadata = crackingMetadata(Credential.Metadata, User)
+
+			if _, err := t.DB.CredentialEdit(Credential); err != nil {
+				logger.Error(fmt.Sprintf("Failed to save cracked credential %v: %v", Credential.ID, err))
+				continue
+			}
+
+			Cracked++
+		}
+
+		delete(Hashes, strings.ToLower(Hash))
+	}
+
+	if err := Scanner.Err(); err != nil {
+		return Cracked, err
+	}
+
+	if Cracked > 0 {
+		logger.Info(fmt.Sprintf("%v cracked %v credentials", User, Cracked))
+		t.credentialsBroadcast()
+	}
+
+	return Cracked, nil
+}
+
+// crackingMetadata
+// records who imported the plaintext of the credential and when.
+func crackingMetadata(Metadata, User string) string {
+	var Fields = make(map[string]any)
+
+	if len(Metadata) > 0 {
+		if err := json.Unmarshal([]byte(Metadata), &Fields); err != nil {
+			return Metadata
+		}
+	}
+
+	Fields["Cracked"] = map[string]string{
+		"User": User,
+		"Time": time.Now().Format("02/01/2006 15:04:05"),
+	}
+
+	Encoded, err := json.Marshal(Fields)
+	if err != nil {
+		return Metadata
+	}
+
+	return string(Encoded)
+}
+
+func crackingType(Types []string, Type string) bool {
+	if len(Types) == 0 {
+		return true
+	}
+
+	for _, Name := range Types {
+		if strings.EqualFold(Name, Type) {
+			return true
+		}
+	}
+
+	return false
+}
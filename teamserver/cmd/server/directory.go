@@ -0,0 +1,115 @@
+package server
+
+import (
+	"strings"
+	"time"
+
+	"Havoc/pkg/agent"
+	"Havoc/pkg/db"
+	"Havoc/pkg/logger"
+)
+
+// DirectoryAdd
+// adds the entries of a ldap search to the directory objects of the
+// workspace of the agent. searches requesting other attributes extend
+// the objects that are already known. returns the number of saved objects.
+func (t *Teamserver) DirectoryAdd(Agent *agent.Agent, Entries []agent.LdapEntry) int {
+	var (
+		Workspace = workspaceOrDefault(Agent.Info.Workspace)
+		Time      = time.Now().Format("02/01/2006 15:04:05")
+		Count     = 0
+	)
+
+	for _, Entry := range Entries {
+		if len(Entry.DN) == 0 {
+			continue
+		}
+
+		Object, err := t.DB.DirectoryGet(Workspace, Entry.DN)
+		if err != nil || Object.Attributes == nil {
+			Object = db.DirectoryObject{
+				DN:         Entry.DN,
+				Workspace:  Workspace,
+				Attributes: make(map[string][]string),
+			}
+		}
+
+		for Name, Values := range Entry.Attributes {
+			Object.Attributes[Name] = Values
+		}
+
+		var Merged = agent.LdapEntry{DN: Object.DN, Attributes: Object.Attributes}
+
+		Object.Domain = directoryDomain(Object.DN)
+		Object.Type = agent.LdapType(Merged)
+		Object.Name = directoryAttribute(Object.Attributes, "sAMAccountName")
+		Object.SID = directoryAttribute(Object.Attributes, "objectSid")
+		Object.AgentID = Agent.NameID
+		Object.Time = Time
+
+		if len(Object.Name) == 0 {
+			Object.Name = directoryAttribute(Object.Attributes, "name")
+		}
+
+		if err = t.DB.DirectorySet(Object); err != nil {
+			logger.Error("Failed to save directory object: " + err.Error())
+			continue
+		}
+
+		Count++
+	}
+
+	return Count
+}
+
+// DirectoryObjects
+// returns the directory objects of the type visible to the workspace.
+func (t *Teamserver) DirectoryObjects(Workspace, Type string) []db.DirectoryObject {
+	var Objects []db.DirectoryObject
+
+	for _, Object := range t.DB.DirectoryObjects(Type) {
+		if workspaceVisible(Workspace, Object.Workspace) {
+			Objects = append(Objects, Object)
+		}
+	}
+
+	return Objects
+}
+
+// directoryDomain
+// returns the dns name of the domain the dn belongs to.
+func directoryDomain(DN string) string {
+	var Components []string
+
+	for _, RDN := range strings.Split(DN, ",") {
+		if Key, Value, ok := strings.Cut(strings.TrimSpace(RDN), "="); ok && strings.EqualFold(Key, "DC") {
+			Components = append(Components, Value)
+		}
+	}
+
+	return strings.ToLower(strings.Join(Components, "."))
+}
+
+// directoryAttribute
+// returns the first value of the attribute. attribute names are case insensitive.
+func directoryAttribute(Attributes map[string][]string, Name string) string {
+	for Key, Values := range Attributes {
+		if strings.EqualFold(Key, Name) && len(Values) > 0 {
+			return Values[0]
+		}
+	}
+
+	return ""
+}
+
+// directoryValues
+// returns every value of the attribute.
+func directoryValues(Attributes map[string][]string, Name string) []string {
+	for Key, Values := range Attributes {
+		if strings.EqualFold(Key, Name) {
+			return Values
+		}
+	}
+
+	return nil
+}
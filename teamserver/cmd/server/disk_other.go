@@ -0,0 +1,11 @@
+//go:build !unix
+
+package server
+
+import "errors"
+
+// diskUsage
+// disk usage is only reported on unix.
+func diskUsage(Path string) (uint64, uint64, error) {
+	return 0, 0, errors.New("disk usage isn't supported on this platform")
+}
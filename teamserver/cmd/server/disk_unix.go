@@ -0,0 +1,19 @@
+//go:build unix
+
+package server
+
+import "syscall"
+
+// diskUsage
+// returns the used and total bytes of the filesystem the path is on.
+func diskUsage(Path string) (uint64, uint64, error) {
+	var Stat syscall.Statfs_t
+
+	if err := syscall.Statfs(Path, &Stat); err != nil {
+		return 0, 0, err
+	}
+
+	var Total = Stat.Blocks * uint64(Stat.Bsize)
+
+	return Total - Stat.Bavail*uint64(Stat.Bsize), Total, nil
+}
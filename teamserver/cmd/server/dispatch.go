@@ -9,12 +9,15 @@ import (
 	"time"
 
 	"Havoc/pkg/agent"
+	"Havoc/pkg/common"
 	"Havoc/pkg/common/builder"
+	"Havoc/pkg/common/bundle"
 	"Havoc/pkg/events"
 	"Havoc/pkg/handlers"
 	"Havoc/pkg/logger"
 	"Havoc/pkg/logr"
 	"Havoc/pkg/packager"
+	"Havoc/pkg/seal"
 )
 
 func (t *Teamserver) DispatchEvent(pk packager.Package) {
@@ -25,18 +28,17 @@ func (t *Teamserver) DispatchEvent(pk packager.Package) {
 		switch pk.Body.SubEvent {
 
 		case packager.Type.Session.MarkAsDead:
-			if AgentID, ok := pk.Body.Info["AgentID"]; ok {
-				for i := range t.Agents.Agents {
-					if t.Agents.Agents[i].NameID == AgentID {
-
-						if val, ok := pk.Body.Info["Marked"]; ok {
-							if val == "Dead" {
-								t.Died(t.Agents.Agents[i])
-							} else if val == "Alive" {
-								t.Agents.Agents[i].Active = true
-							}
-							t.AgentUpdate(t.Agents.Agents[i])
+			if AgentID, ok := pk.Body.Info["AgentID"].(string); ok {
+				if Agent := t.Agents.Get(AgentID); Agent != nil {
+
+					if val, ok := pk.Body.Info["Marked"]; ok {
+						if val == "Dead" {
+							t.Died(Agent)
+						} else if val == "Alive" {
+							t.agentKeyRestore(Agent)
+							Agent.Active = true
 						}
+						t.AgentUpdate(Agent)
 					}
 				}
 			}
@@ -60,271 +62,1418 @@ func (t *Teamserver) DispatchEvent(pk packager.Package) {
 				return
 			}
 
-			for i := range t.Agents.Agents {
+			if Agent := t.Agents.Get(DemonID); Agent != nil {
+				found = true
+
+				/* rules of engagement: refuse to queue blocked commands */
+				if pk.Body.Info["CommandID"] != "Python Plugin" {
+					var (
+						CommandLine, _ = pk.Body.Info["CommandLine"].(string)
+						Commands       []string
+					)
+
+					if Agent.Info.MagicValue == agent.DEMON_MAGIC_VALUE {
+						if ID, err := strconv.Atoi(fmt.Sprint(pk.Body.Info["CommandID"])); err == nil {
+							Commands = append(Commands, agent.CommandNames[uint32(ID)])
+						}
+					}
+
+					if err = t.BlocklistCheck(pk.Head.User, DemonID, CommandLine, Commands...); err != nil {
+						t.AgentConsole(DemonID, agent.HAVOC_CONSOLE_MESSAGE, map[string]string{
+							"Type":    "Error",
+							"Message": "Failed to create Task: " + err.Error(),
+						})
+						return
+					}
+
+					/* files to the targets: tool categories the rules of engagement restrict */
+					if Held, err := t.UploadCheck(pk.Head.User, Agent, pk.Body.Info); err != nil {
+						t.AgentConsole(DemonID, agent.HAVOC_CONSOLE_MESSAGE, map[string]string{
+							"Type":    "Error",
+							"Message": "Failed to create Task: " + err.Error(),
+						})
+						return
+					} else if Held {
+						return
+					}
+				}
+
+				// handle demon session input
+				// TODO: maybe move to own function ?
+				if Agent.Info.MagicValue == agent.DEMON_MAGIC_VALUE {
+
+					var (
+						Message = new(map[string]string)
+						Console = func(AgentID string, Message map[string]string) {
+							var (
+								out, _ = json.Marshal(Message)
+								pk     = events.Demons.DemonOutput(DemonID, agent.HAVOC_CONSOLE_MESSAGE, string(out))
+							)
+
+							t.EventAppend(pk)
+							t.EventBroadcast("", pk)
+						}
+					)
+
+					if val, ok := pk.Body.Info["CommandID"]; ok {
+
+						if pk.Body.Info["CommandID"] == "Python Plugin" {
+
+							// TODO: move to own function.
+							logr.LogrInstance.AddAgentInput("Demon", pk.Body.Info["DemonID"].(string), pk.Head.User, pk.Body.Info["TaskID"].(string), pk.Body.Info["CommandLine"].(string), time.Now().UTC().Format("02/01/2006 15:04:05"))
+
+							if pk.Head.OneTime == "true" {
+								return
+							}
+
+							var backups = map[string]interface{}{
+								"TaskID":      pk.Body.Info["TaskID"].(string),
+								"DemonID":     DemonID,
+								"CommandID":   "",
+								"CommandLine": pk.Body.Info["CommandLine"].(string),
+								"AgentType":   AgentType,
+							}
+
+							if _, ok := pk.Body.Info["CommandID"].(string); ok {
+								backups["CommandID"] = pk.Body.Info["CommandID"]
+							}
+
+							if _, ok := pk.Body.Info["TaskMessage"].(string); ok {
+								backups["TaskMessage"] = pk.Body.Info["TaskMessage"]
+							}
+
+							for k := range pk.Body.Info {
+								delete(pk.Body.Info, k)
+							}
+
+							pk.Body.Info = backups
+
+							t.EventAppend(pk)
+							t.EventBroadcast(pk.Head.User, pk)
+
+							return
+
+						} else if pk.Body.Info["CommandID"] == "Teamserver" {
+
+							// TODO: move to own function.
+							logr.LogrInstance.AddAgentInput("Demon", pk.Body.Info["DemonID"].(string), pk.Head.User, pk.Body.Info["TaskID"].(string), pk.Body.Info["CommandLine"].(string), time.Now().UTC().Format("02/01/2006 15:04:05"))
+
+							var Command = pk.Body.Info["Command"].(string)
+
+							if pk.Head.OneTime == "true" {
+								return
+							}
+
+							var backups = map[string]interface{}{
+								"TaskID":      pk.Body.Info["TaskID"].(string),
+								"DemonID":     DemonID,
+								"CommandID":   "",
+								"CommandLine": pk.Body.Info["CommandLine"].(string),
+								"AgentType":   AgentType,
+							}
+
+							if _, ok := pk.Body.Info["CommandID"].(string); ok {
+								backups["CommandID"] = pk.Body.Info["CommandID"]
+							}
+
+							for k := range pk.Body.Info {
+								delete(pk.Body.Info, k)
+							}
+
+							pk.Body.Info = backups
+
+							t.EventAppend(pk)
+							t.EventBroadcast(pk.Head.User, pk)
+
+							if err = Agent.TeamserverTaskPrepare(Command, Console); err != nil {
+								Console(Agent.NameID, map[string]string{
+									"Type":    "Error",
+									"Message": "Failed to create Task: " + err.Error(),
+								})
+								return
+							}
+
+							/* task clear doesn't bring the tasks back after a crash */
+							t.journalCleared(Agent)
+
+							return
+
+						} else {
+
+							// TODO: move to own function.
+							command, err = strconv.Atoi(val.(string))
+							if err != nil {
+
+								logger.Error("Failed to convert CommandID to integer: " + err.Error())
+								command = 0
+
+							} else {
+								*Message = make(map[string]string)
+
+								var ClientID string
+								ClientID = ""
+								t.Clients.Range(func(key, value any) bool {
+									client := value.(*Client)
+									if client.Username == pk.Head.User {
+										ClientID = client.ClientID
+										return false
+									}
+									return true
+								})
+
+								job, err = Agent.TaskPrepare(command, pk.Body.Info, Message, ClientID, t)
+								if err != nil {
+									Console(Agent.NameID, map[string]string{
+										"Type":    "Error",
+										"Message": "Failed to create Task: " + err.Error(),
+									})
+									return
+								}
+
+								if job != nil && !Agent.Supports(job.Command) {
+									Console(Agent.NameID, map[string]string{
+										"Type":    "Error",
+										"Message": fmt.Sprintf("Agent build doesn't support the %v command (0x%x)", agent.CommandNames[job.Command], job.Command),
+									})
+									return
+								}
+
+								var Held *PendingTask
+
+								if job != nil {
+									var CommandLine, _ = pk.Body.Info["CommandLine"].(string)
+									var TaskID, _ = pk.Body.Info["TaskID"].(string)
+
+									/* two-person rule: high risk tasks wait for a second operator */
+									if Rule := t.ApprovalRequired(Agent, CommandLine, agent.CommandNames[job.Command]); Rule != nil {
+										Held = t.ApprovalHold(pk.Head.User, Agent, *job, TaskID, CommandLine, Rule)
+									} else {
+										t.taskEnqueue(Agent, *job)
+									}
+								}
+
+								if Agent.Pivots.Parent != nil {
+									logr.LogrInstance.AddAgentInput("Demon", Agent.NameID, pk.Head.User, pk.Body.Info["TaskID"].(string), pk.Body.Info["CommandLine"].(string), time.Now().UTC().Format("02/01/2006 15:04:05"))
+
+								} else {
+									logr.LogrInstance.AddAgentInput("Demon", pk.Body.Info["DemonID"].(string), pk.Head.User, pk.Body.Info["TaskID"].(string), pk.Body.Info["CommandLine"].(string), time.Now().UTC().Format("02/01/2006 15:04:05"))
+								}
+
+								if pk.Head.OneTime == "true" {
+									return
+								}
+
+								var backups = map[string]interface{}{
+									"TaskID":      pk.Body.Info["TaskID"].(string),
+									"DemonID":     DemonID,
+									"CommandID":   "",
+									"CommandLine": pk.Body.Info["CommandLine"].(string),
+									"AgentType":   AgentType,
+								}
+
+								if _, ok := pk.Body.Info["CommandID"].(string); ok {
+									backups["CommandID"] = pk.Body.Info["CommandID"]
+								}
+
+								for k := range pk.Body.Info {
+									delete(pk.Body.Info, k)
+								}
+
+								pk.Body.Info = backups
+
+								t.EventAppend(pk)
+								t.EventBroadcast(pk.Head.User, pk)
+
+								if Message != nil {
+									Console(Agent.NameID, *Message)
+								}
+
+								if Held != nil {
+									Console(Agent.NameID, map[string]string{
+										"Type":    "Info",
+										"Message": fmt.Sprintf("Task %v waits for the approval of a second operator [rule: %v]", Held.ID, Held.Rule),
+									})
+								}
+
+								return
+							}
+						}
+					}
+
+				} else if Agent.Info.MagicValue == agent.SSH_MAGIC_VALUE {
+
+					AgentType = "SSH"
+
+					if pk.Body.Info["CommandID"] != "Python Plugin" {
+						t.SSHInput(Agent, pk.Head.User, pk.Body.Info)
+					}
+
+				} else if Agent.Info.MagicValue == agent.RELAYED_MAGIC_VALUE {
+
+					AgentType = "Relayed"
+
+					t.RelayedInput(Agent)
+
+				} else {
+
+					for _, a := range t.Service.Agents {
+						if a.MagicValue == fmt.Sprintf("0x%x", Agent.Info.MagicValue) {
+
+							// Set agent type
+							AgentType = a.Name
+
+							if pk.Body.Info["CommandID"] == "Python Plugin" {
+								logr.LogrInstance.AddAgentInput(AgentType, pk.Body.Info["DemonID"].(string), pk.Head.User, pk.Body.Info["TaskID"].(string), pk.Body.Info["CommandLine"].(string), time.Now().UTC().Format("02/01/2006 15:04:05"))
+
+								if pk.Head.OneTime == "true" {
+									return
+								}
+
+								var backups = map[string]interface{}{
+									"TaskID":      pk.Body.Info["TaskID"].(string),
+									"DemonID":     DemonID,
+									"CommandID":   "",
+									"CommandLine": pk.Body.Info["CommandLine"].(string),
+									"AgentType":   AgentType,
+								}
+
+								if _, ok := pk.Body.Info["CommandID"].(string); ok {
+									backups["CommandID"] = pk.Body.Info["CommandID"]
+								}
+
+								if _, ok := pk.Body.Info["TaskMessage"].(string); ok {
+									backups["TaskMessage"] = pk.Body.Info["TaskMessage"]
+								}
+
+								for k := range pk.Body.Info {
+									delete(pk.Body.Info, k)
+								}
+
+								pk.Body.Info = backups
+
+								t.EventAppend(pk)
+								t.EventBroadcast(pk.Head.User, pk)
+
+								return
+
+							} else {
+								// Send command to agent service
+								a.SendTask(pk.Body.Info, Agent.ToMap())
+
+								// log agent input
+								logr.LogrInstance.AddAgentInput(a.Name, pk.Body.Info["DemonID"].(string), pk.Head.User, pk.Body.Info["TaskID"].(string), pk.Body.Info["CommandLine"].(string), time.Now().UTC().Format("02/01/2006 15:04:05"))
+							}
+
+						}
+					}
+				}
+			}
+
+			if found == false {
+				logger.Error(fmt.Sprintf("The AgentID %s was not found", DemonID))
+				return
+			}
+
+			if pk.Head.OneTime == "true" {
+				return
+			}
+
+			var backups = map[string]interface{}{
+				"TaskID":      pk.Body.Info["TaskID"].(string),
+				"DemonID":     DemonID,
+				"CommandID":   "",
+				"CommandLine": pk.Body.Info["CommandLine"].(string),
+				"AgentType":   AgentType,
+			}
+
+			if _, ok := pk.Body.Info["CommandID"].(string); ok {
+				backups["CommandID"] = pk.Body.Info["CommandID"]
+			}
+
+			for k := range pk.Body.Info {
+				delete(pk.Body.Info, k)
+			}
+
+			pk.Body.Info = backups
+
+			t.EventAppend(pk)
+			t.EventBroadcast(pk.Head.User, pk)
+		}
+
+	case packager.Type.Infra.Type:
+
+		switch pk.Body.SubEvent {
+
+		case packager.Type.Infra.Burn:
+			var (
+				Host, _   = pk.Body.Info["Host"].(string)
+				Reason, _ = pk.Body.Info["Reason"].(string)
+				Rotate    = false
+			)
+
+			if val, ok := pk.Body.Info["Rotate"].(string); ok && val == "true" {
+				Rotate = true
+			}
+
+			if err := t.InfraBurn(pk.Head.User, Host, Reason, Rotate); err != nil {
+				logger.Error("Failed to burn host: " + err.Error())
+				t.SendEventToUser(pk.Head.User, events.Teamserver.Logger("Failed to burn host: "+err.Error()))
+			}
+			break
+
+		case packager.Type.Infra.Restore:
+			var Host, _ = pk.Body.Info["Host"].(string)
+
+			if err := t.InfraRestore(pk.Head.User, Host); err != nil {
+				logger.Error("Failed to restore host: " + err.Error())
+				t.SendEventToUser(pk.Head.User, events.Teamserver.Logger("Failed to restore host: "+err.Error()))
+			}
+			break
+
+		case packager.Type.Infra.List:
+			t.SendEventToUser(pk.Head.User, events.Infra.List(t.InfraList()))
+			break
+
+		}
+
+	case packager.Type.Bundle.Type:
+
+		switch pk.Body.SubEvent {
+
+		case packager.Type.Bundle.Export:
+			var (
+				Listener, _ = pk.Body.Info["Listener"].(string)
+				Name, _     = pk.Body.Info["Name"].(string)
+				Payload     map[string]any
+			)
+
+			if val, ok := pk.Body.Info["Payload"].(string); ok && len(val) > 0 {
+				if err := json.Unmarshal([]byte(val), &Payload); err != nil {
+					t.SendEventToUser(pk.Head.User, events.Teamserver.Logger("Failed to parse payload defaults: "+err.Error()))
+					break
+				}
+			}
+
+			Data, err := t.BundleExport(pk.Head.User, Listener, Name, Payload)
+			if err != nil {
+				logger.Error("Failed to export bundle: " + err.Error())
+				t.SendEventToUser(pk.Head.User, events.Teamserver.Logger("Failed to export bundle: "+err.Error()))
+				break
+			}
+
+			if len(Name) == 0 {
+				Name = Listener
+			}
+
+			t.SendEventToUser(pk.Head.User, events.Bundle.Export(Name, Data))
+			break
+
+		case packager.Type.Bundle.Import:
+			var (
+				Data, _ = pk.Body.Info["Bundle"].(string)
+				Name, _ = pk.Body.Info["Name"].(string)
+			)
+
+			Bundled, Listener, err := t.BundleImport(pk.Head.User, Data, Name, t.ListenerNewWorkspace(pk))
+			if err != nil {
+				logger.Error("Failed to import bundle: " + err.Error())
+				t.SendEventToUser(pk.Head.User, events.Teamserver.Logger("Failed to import bundle: "+err.Error()))
+				break
+			}
+
+			t.SendEventToUser(pk.Head.User, events.Bundle.Import(Bundled.Name, Listener, Bundled.Signer, Bundled.Payload))
+			break
+
+		case packager.Type.Bundle.Key:
+			Key, err := t.BundleKey()
+			if err != nil {
+				logger.Error("Failed to get bundle signing key: " + err.Error())
+				break
+			}
+
+			t.SendEventToUser(pk.Head.User, events.Bundle.Key(bundle.PublicKey(Key)))
+			break
+
+		}
 
-				if t.Agents.Agents[i].NameID == DemonID {
-					found = true
+	case packager.Type.Export.Type:
 
-					// handle demon session input
-					// TODO: maybe move to own function ?
-					if t.Agents.Agents[i].Info.MagicValue == agent.DEMON_MAGIC_VALUE {
+		switch pk.Body.SubEvent {
+
+		case packager.Type.Export.Stix:
+			Data, err := t.StixExport(t.UserWorkspace(pk.Head.User))
+			if err != nil {
+				logger.Error("Failed to export STIX bundle: " + err.Error())
+				t.SendEventToUser(pk.Head.User, events.Teamserver.Logger("Failed to export STIX bundle: "+err.Error()))
+				break
+			}
+
+			t.SendEventToUser(pk.Head.User, events.Export.Stix(string(Data)))
+			break
+
+		case packager.Type.Export.Timeline:
+			t.SendEventToUser(pk.Head.User, events.Export.Timeline(t.Timeline(t.UserWorkspace(pk.Head.User))))
+			break
+
+		}
+
+	case packager.Type.Snapshot.Type:
+		var (
+			DemonID, _ = pk.Body.Info["DemonID"].(string)
+			Command, _ = pk.Body.Info["Command"].(string)
+			Target, _  = pk.Body.Info["Target"].(string)
+		)
+
+		switch pk.Body.SubEvent {
+
+		case packager.Type.Snapshot.List:
+			t.SendEventToUser(pk.Head.User, events.Snapshots.List(DemonID, t.DB.Snapshots(DemonID, Command, Target)))
+			break
+
+		case packager.Type.Snapshot.Diff:
+			var From, To int64
+
+			if val, ok := pk.Body.Info["From"].(string); ok && len(val) > 0 {
+				From, _ = strconv.ParseInt(val, 10, 64)
+			}
+
+			if val, ok := pk.Body.Info["To"].(string); ok && len(val) > 0 {
+				To, _ = strconv.ParseInt(val, 10, 64)
+			}
+
+			Diff, err := t.SnapshotCompare(DemonID, Command, Target, From, To)
+			if err != nil {
+				t.SendEventToUser(pk.Head.User, events.Teamserver.Logger("Failed to compare snapshots: "+err.Error()))
+				break
+			}
+
+			t.SendEventToUser(pk.Head.User, events.Snapshots.Diff(DemonID, Diff))
+			break
+
+		}
+
+	case packager.Type.Loot.Type:
+
+		switch pk.Body.SubEvent {
+
+		case packager.Type.Loot.Fetch:
+			var (
+				DemonID, _ = pk.Body.Info["DemonID"].(string)
+				Type, _    = pk.Body.Info["Type"].(string)
+				Name, _    = pk.Body.Info["Name"].(string)
+				Folders    = map[string]string{"output": "Output", "download": "Download", "screenshot": "Screenshots", "recording": "Recordings"}
+			)
+
+			/* only loot of known agents. the id becomes part of the path */
+			AgentID, err := strconv.ParseInt(DemonID, 16, 64)
+			if err != nil {
+				t.SendEventToUser(pk.Head.User, events.Teamserver.Logger("Failed to fetch loot: invalid agent id"))
+				break
+			}
+
+			Folder, ok := Folders[Type]
+			if !ok || !t.AgentExist(int(AgentID)) {
+				t.SendEventToUser(pk.Head.User, events.Teamserver.Logger("Failed to fetch loot: invalid agent or loot type"))
+				break
+			}
+
+			Path, err := logr.LogrInstance.DemonLootPath(fmt.Sprintf("%08x", AgentID), Folder, Name)
+			if err != nil {
+				t.SendEventToUser(pk.Head.User, events.Teamserver.Logger("Failed to fetch loot: "+err.Error()))
+				break
+			}
+
+			/* too big to send over the websocket */
+			if Size, err := seal.Size(Path); err == nil && Size > agent.DOWNLOAD_INLINE_MAX {
+				t.SendEventToUser(pk.Head.User, events.Teamserver.Logger(fmt.Sprintf("Loot %v is too big to fetch [%v]. Fetch it from %v", Name, common.ByteCountSI(Size), agent.TransferURL(logr.LogrInstance.TransferPath(Path)))))
+				break
+			}
+
+			Data, err := seal.ReadFile(Path)
+			if err != nil {
+				t.SendEventToUser(pk.Head.User, events.Teamserver.Logger("Failed to fetch loot: "+err.Error()))
+				break
+			}
+
+			t.SendEventToUser(pk.Head.User, events.Loot.Fetch(DemonID, Type, Name, Data))
+			break
+
+		}
+
+	case packager.Type.Download.Type:
+
+		switch pk.Body.SubEvent {
+
+		case packager.Type.Download.Segmented:
+			var (
+				Name, _    = pk.Body.Info["Name"].(string)
+				Hash, _    = pk.Body.Info["Hash"].(string)
+				Sources, _ = pk.Body.Info["Sources"].([]any)
+				Size       int64
+				Paths      [][2]string
+			)
+
+			if val, ok := pk.Body.Info["Size"].(string); ok {
+				Size, _ = strconv.ParseInt(val, 10, 64)
+			}
+
+			/* [ { "DemonID": "...", "Path": "..." }, ... ] */
+			for _, Source := range Sources {
+				if Source, ok := Source.(map[string]any); ok {
+					var (
+						DemonID, _ = Source["DemonID"].(string)
+						Path, _    = Source["Path"].(string)
+					)
+
+					Paths = append(Paths, [2]string{DemonID, Path})
+				}
+			}
+
+			Download, err := t.DownloadSegmented(pk.Head.User, Name, Size, Hash, Paths)
+			if err != nil {
+				t.SendEventToUser(pk.Head.User, events.Teamserver.Logger("Failed to start segmented download: "+err.Error()))
+				break
+			}
+
+			t.SendEventToUser(pk.Head.User, events.Downloads.Status(Download.ID, Download.Name, "running", 0, len(Download.Segments)))
+			break
+
+		}
+
+	case packager.Type.Archive.Type:
+		var AgentID, _ = pk.Body.Info["AgentID"].(string)
+
+		switch pk.Body.SubEvent {
+
+		case packager.Type.Archive.List:
+			t.SendEventToUser(pk.Head.User, events.Archive.List(t.ArchivedSessions(t.UserWorkspace(pk.Head.User))))
+			break
+
+		case packager.Type.Archive.Add:
+			if err := t.SessionArchive(pk.Head.User, AgentID); err != nil {
+				t.SendEventToUser(pk.Head.User, events.Teamserver.Logger("Failed to archive session: "+err.Error()))
+				break
+			}
+
+			t.SendEventToUser(pk.Head.User, events.Archive.List(t.ArchivedSessions(t.UserWorkspace(pk.Head.User))))
+			break
+
+		case packager.Type.Archive.Restore:
+			if err := t.SessionRestore(pk.Head.User, AgentID); err != nil {
+				t.SendEventToUser(pk.Head.User, events.Teamserver.Logger("Failed to restore session: "+err.Error()))
+				break
+			}
+
+			t.SendEventToUser(pk.Head.User, events.Archive.List(t.ArchivedSessions(t.UserWorkspace(pk.Head.User))))
+			break
+
+		}
+
+	case packager.Type.Search.Type:
+
+		switch pk.Body.SubEvent {
+
+		case packager.Type.Search.Query:
+			var (
+				Query, _ = pk.Body.Info["Query"].(string)
+				Raw, _   = pk.Body.Info["Raw"].(string)
+				Limit    int
+			)
+
+			if val, ok := pk.Body.Info["Limit"].(string); ok {
+				Limit, _ = strconv.Atoi(val)
+			}
+
+			Results, err := t.Search(t.UserWorkspace(pk.Head.User), Query, Raw == "true", Limit)
+			if err != nil {
+				t.SendEventToUser(pk.Head.User, events.Teamserver.Logger("Failed to search: "+err.Error()))
+				break
+			}
+
+			t.SendEventToUser(pk.Head.User, events.Search.Results(Query, Results))
+			break
+
+		}
+
+	case packager.Type.Preset.Type:
+
+		switch pk.Body.SubEvent {
+
+		case packager.Type.Preset.List:
+			t.SendEventToUser(pk.Head.User, events.Presets.List(t.DB.Presets()))
+			break
+
+		case packager.Type.Preset.Add:
+			if err := t.PresetSave(pk.Head.User, pk.Body.Info); err != nil {
+				t.SendEventToUser(pk.Head.User, events.Teamserver.Logger("Failed to save build preset: "+err.Error()))
+				break
+			}
+
+			t.EventBroadcast("", events.Presets.List(t.DB.Presets()))
+			break
+
+		case packager.Type.Preset.Remove:
+			var Name, _ = pk.Body.Info["Name"].(string)
+
+			if Removed, err := t.DB.PresetRemove(Name); err != nil || !Removed {
+				t.SendEventToUser(pk.Head.User, events.Teamserver.Logger("Failed to remove build preset: "+Name+" not found"))
+				break
+			}
+
+			logger.Info(fmt.Sprintf("Build preset %v removed by %v", Name, pk.Head.User))
+
+			t.EventBroadcast("", events.Presets.List(t.DB.Presets()))
+			break
+
+		}
+
+	case packager.Type.Notification.Type:
+
+		switch pk.Body.SubEvent {
+
+		case packager.Type.Notification.Preferences:
+			t.SendEventToUser(pk.Head.User, events.Notify.Preferences(t.NotifyPreferencesOf(pk.Head.User)))
+			break
+
+		case packager.Type.Notification.Set:
+			Preferences, err := t.NotifySet(pk.Head.User, pk.Body.Info)
+			if err != nil {
+				t.SendEventToUser(pk.Head.User, events.Teamserver.Logger("Failed to set notification preferences: "+err.Error()))
+				break
+			}
+
+			t.SendEventToUser(pk.Head.User, events.Notify.Preferences(Preferences))
+			break
+
+		}
+
+	case packager.Type.Credentials.Type:
+
+		switch pk.Body.SubEvent {
+
+		case packager.Type.Credentials.List:
+			t.SendEventToUser(pk.Head.User, events.Credentials.List(t.Credentials(t.UserWorkspace(pk.Head.User))))
+			break
+
+		case packager.Type.Credentials.Add, packager.Type.Credentials.Edit:
+			if err := t.CredentialSave(pk.Head.User, pk.Body.Info, pk.Body.SubEvent == packager.Type.Credentials.Edit); err != nil {
+				t.SendEventToUser(pk.Head.User, events.Teamserver.Logger("Failed to save credential: "+err.Error()))
+				break
+			}
+
+			t.credentialsBroadcast()
+			break
+
+		case packager.Type.Credentials.Cookies:
+			var (
+				Host, _   = pk.Body.Info["Host"].(string)
+				Format, _ = pk.Body.Info["Format"].(string)
+			)
+
+			Cookies, err := t.CookiesExport(t.UserWorkspace(pk.Head.User), Host, Format)
+			if err != nil {
+				t.SendEventToUser(pk.Head.User, events.Teamserver.Logger("Failed to export cookies: "+err.Error()))
+				break
+			}
+
+			t.SendEventToUser(pk.Head.User, events.Credentials.Cookies(Format, Cookies))
+			break
+
+		case packager.Type.Credentials.Export:
+			var (
+				Format, _ = pk.Body.Info["Format"].(string)
+				Types     []string
+			)
+
+			if Value, ok := pk.Body.Info["Types"].(string); ok && len(Value) > 0 {
+				Types = strings.Split(Value, ",")
+			}
+
+			Jobs, err := t.CrackingExport(t.UserWorkspace(pk.Head.User), Format, Types)
+			if err != nil {
+				t.SendEventToUser(pk.Head.User, events.Teamserver.Logger("Failed to export hashes: "+err.Error()))
+				break
+			}
+
+			t.SendEventToUser(pk.Head.User, events.Credentials.Export(Format, Jobs))
+			break
+
+		case packager.Type.Credentials.Import:
+			var Potfile, _ = pk.Body.Info["Potfile"].(string)
+
+			Cracked, err := t.CrackingImport(pk.Head.User, Potfile)
+			if err != nil {
+				t.SendEventToUser(pk.Head.User, events.Teamserver.Logger("Failed to import cracked hashes: "+err.Error()))
+				break
+			}
+
+			t.SendEventToUser(pk.Head.User, events.Credentials.Import(Cracked))
+			break
+
+		case packager.Type.Credentials.Remove:
+			var ID, _ = pk.Body.Info["ID"].(string)
+
+			if err := t.CredentialRemove(pk.Head.User, ID); err != nil {
+				t.SendEventToUser(pk.Head.User, events.Teamserver.Logger("Failed to remove credential: "+err.Error()))
+				break
+			}
+
+			t.credentialsBroadcast()
+			break
+
+		}
+
+	case packager.Type.Approval.Type:
+
+		switch pk.Body.SubEvent {
+
+		case packager.Type.Approval.List:
+			t.SendEventToUser(pk.Head.User, events.Approval.List(t.ApprovalsPending(t.UserWorkspace(pk.Head.User))))
+			break
+
+		case packager.Type.Approval.Approve, packager.Type.Approval.Deny:
+			var ID, _ = pk.Body.Info["ID"].(string)
+
+			if err := t.ApprovalDecide(pk.Head.User, ID, pk.Body.SubEvent == packager.Type.Approval.Approve); err != nil {
+				t.SendEventToUser(pk.Head.User, events.Teamserver.Logger("Failed to decide on task: "+err.Error()))
+				break
+			}
+
+			break
+
+		}
+
+	case packager.Type.Uploads.Type:
+
+		switch pk.Body.SubEvent {
+
+		case packager.Type.Uploads.Rules:
+			t.SendEventToUser(pk.Head.User, events.Uploads.Rules(t.UploadRules()))
+			break
+
+		case packager.Type.Uploads.Add:
+			if err := t.UploadSave(pk.Head.User, pk.Body.Info); err != nil {
+				t.SendEventToUser(pk.Head.User, events.Teamserver.Logger("Failed to save upload rule: "+err.Error()))
+				break
+			}
+
+			t.EventBroadcast("", events.Uploads.Rules(t.UploadRules()))
+			break
+
+		case packager.Type.Uploads.Remove:
+			var Name, _ = pk.Body.Info["Name"].(string)
+
+			if err := t.UploadRemove(pk.Head.User, Name); err != nil {
+				t.SendEventToUser(pk.Head.User, events.Teamserver.Logger("Failed to remove upload rule: "+err.Error()))
+				break
+			}
+
+			t.EventBroadcast("", events.Uploads.Rules(t.UploadRules()))
+			break
+
+		case packager.Type.Uploads.Audit:
+			t.SendEventToUser(pk.Head.User, events.Uploads.Audit(t.UploadAudits(t.UserWorkspace(pk.Head.User))))
+			break
+
+		}
+
+	case packager.Type.Blocklist.Type:
+
+		switch pk.Body.SubEvent {
+
+		case packager.Type.Blocklist.List:
+			t.SendEventToUser(pk.Head.User, events.Blocklist.List(t.BlocklistRules()))
+			break
+
+		case packager.Type.Blocklist.Add:
+			if err := t.BlocklistSave(pk.Head.User, pk.Body.Info); err != nil {
+				t.SendEventToUser(pk.Head.User, events.Teamserver.Logger("Failed to save blocklist rule: "+err.Error()))
+				break
+			}
+
+			t.EventBroadcast("", events.Blocklist.List(t.BlocklistRules()))
+			break
+
+		case packager.Type.Blocklist.Remove:
+			var Name, _ = pk.Body.Info["Name"].(string)
+
+			if err := t.BlocklistRemove(pk.Head.User, Name); err != nil {
+				t.SendEventToUser(pk.Head.User, events.Teamserver.Logger("Failed to remove blocklist rule: "+err.Error()))
+				break
+			}
+
+			t.EventBroadcast("", events.Blocklist.List(t.BlocklistRules()))
+			break
+
+		}
+
+	case packager.Type.Lateral.Type:
+
+		switch pk.Body.SubEvent {
+
+		case packager.Type.Lateral.List:
+			t.SendEventToUser(pk.Head.User, events.Lateral.List(t.LateralEdges(t.UserWorkspace(pk.Head.User))))
+			break
+
+		case packager.Type.Lateral.Methods:
+			t.SendEventToUser(pk.Head.User, events.Lateral.Methods(JumpMethods()))
+			break
+
+		case packager.Type.Lateral.Move:
+			if _, err := t.LateralMove(pk.Head.User, pk.Body.Info); err != nil {
+				t.SendEventToUser(pk.Head.User, events.Teamserver.Logger("Failed to jump: "+err.Error()))
+				break
+			}
+
+			t.lateralBroadcast()
+			break
+
+		}
+
+	case packager.Type.SSH.Type:
+
+		switch pk.Body.SubEvent {
+
+		case packager.Type.SSH.List:
+			t.SendEventToUser(pk.Head.User, events.SSH.List(t.SSHConnections(t.UserWorkspace(pk.Head.User))))
+			break
+
+		case packager.Type.SSH.Connect:
+			if _, err := t.SSHConnect(pk.Head.User, pk.Body.Info); err != nil {
+				t.SendEventToUser(pk.Head.User, events.Teamserver.Logger("Failed to connect over ssh: "+err.Error()))
+				break
+			}
+
+			t.sshBroadcast()
+			break
+
+		case packager.Type.SSH.Disconnect:
+			var AgentID, _ = pk.Body.Info["AgentID"].(string)
+
+			if err := t.SSHDisconnect(pk.Head.User, AgentID); err != nil {
+				t.SendEventToUser(pk.Head.User, events.Teamserver.Logger("Failed to disconnect ssh session: "+err.Error()))
+			}
+
+			break
+
+		}
+
+	case packager.Type.Directory.Type:
+
+		switch pk.Body.SubEvent {
+
+		case packager.Type.Directory.List:
+			var Type, _ = pk.Body.Info["Type"].(string)
+
+			t.SendEventToUser(pk.Head.User, events.Directory.List(t.DirectoryObjects(t.UserWorkspace(pk.Head.User), Type)))
+			break
+
+		}
+
+	case packager.Type.Script.Type:
+
+		switch pk.Body.SubEvent {
+
+		case packager.Type.Script.List:
+			t.SendEventToUser(pk.Head.User, events.Scripts.List(t.DB.Scripts()))
+			break
+
+		case packager.Type.Script.Add:
+			if err := t.ScriptSave(pk.Head.User, pk.Body.Info); err != nil {
+				t.SendEventToUser(pk.Head.User, events.Teamserver.Logger("Failed to save agent script: "+err.Error()))
+				break
+			}
+
+			t.EventBroadcast("", events.Scripts.List(t.DB.Scripts()))
+			break
+
+		case packager.Type.Script.Remove:
+			var Name, _ = pk.Body.Info["Name"].(string)
+
+			if Removed, err := t.DB.ScriptRemove(Name); err != nil || !Removed {
+				t.SendEventToUser(pk.Head.User, events.Teamserver.Logger("Failed to remove agent script: "+Name+" not found"))
+				break
+			}
+
+			logger.Info(fmt.Sprintf("Agent script %v removed by %v", Name, pk.Head.User))
+
+			t.EventBroadcast("", events.Scripts.List(t.DB.Scripts()))
+			break
+
+		}
+
+	case packager.Type.Template.Type:
+
+		switch pk.Body.SubEvent {
+
+		case packager.Type.Template.List:
+			t.SendEventToUser(pk.Head.User, events.Templates.List(t.DB.Templates()))
+			break
+
+		case packager.Type.Template.Add:
+			if err := t.TemplateSave(pk.Head.User, pk.Body.Info); err != nil {
+				t.SendEventToUser(pk.Head.User, events.Teamserver.Logger("Failed to save task template: "+err.Error()))
+				break
+			}
+
+			t.EventBroadcast("", events.Templates.List(t.DB.Templates()))
+			break
+
+		case packager.Type.Template.Remove:
+			var Name, _ = pk.Body.Info["Name"].(string)
+
+			if Removed, err := t.DB.TemplateRemove(Name); err != nil || !Removed {
+				t.SendEventToUser(pk.Head.User, events.Teamserver.Logger("Failed to remove task template: "+Name+" not found"))
+				break
+			}
+
+			logger.Info(fmt.Sprintf("Task template %v removed by %v", Name, pk.Head.User))
+
+			t.EventBroadcast("", events.Templates.List(t.DB.Templates()))
+			break
+
+		case packager.Type.Template.Execute:
+			if err := t.TemplateExecute(pk.Head.User, pk.Body.Info); err != nil {
+				t.SendEventToUser(pk.Head.User, events.Teamserver.Logger("Failed to execute task template: "+err.Error()))
+				break
+			}
+			break
+
+		}
+
+	case packager.Type.Batch.Type:
+
+		switch pk.Body.SubEvent {
+
+		case packager.Type.Batch.Task:
+			Batch, err := t.BatchQueue(pk.Head.User, pk.Body.Info)
+			if err != nil {
+				t.SendEventToUser(pk.Head.User, events.Teamserver.Logger("Failed to queue batch: "+err.Error()))
+				break
+			}
+
+			t.SendEventToUser(pk.Head.User, events.Teamserver.Logger(fmt.Sprintf("Batch %v queued against %v agents", Batch.ID, len(Batch.Tasks))))
+			t.SendEventToUser(pk.Head.User, events.Batches.List(t.BatchList(t.UserWorkspace(pk.Head.User))))
+			break
+
+		case packager.Type.Batch.List:
+			t.SendEventToUser(pk.Head.User, events.Batches.List(t.BatchList(t.UserWorkspace(pk.Head.User))))
+			break
+
+		case packager.Type.Batch.Result:
+			var ID, _ = pk.Body.Info["ID"].(string)
+
+			Result, err := t.BatchResult(t.UserWorkspace(pk.Head.User), ID)
+			if err != nil {
+				t.SendEventToUser(pk.Head.User, events.Teamserver.Logger("Failed to get batch result: "+err.Error()))
+				break
+			}
+
+			t.SendEventToUser(pk.Head.User, events.Batches.Result(Result))
+			break
+
+		case packager.Type.Batch.Tag:
+			var (
+				AgentID, _ = pk.Body.Info["AgentID"].(string)
+				Tags, _    = pk.Body.Info["Tags"].(string)
+			)
+
+			if err := t.AgentTagsSet(pk.Head.User, AgentID, Tags); err != nil {
+				t.SendEventToUser(pk.Head.User, events.Teamserver.Logger("Failed to tag agent: "+err.Error()))
+				break
+			}
+
+			t.SendEventToUser(pk.Head.User, events.Batches.Tags(t.AgentTags(t.UserWorkspace(pk.Head.User))))
+			break
+
+		case packager.Type.Batch.Tags:
+			t.SendEventToUser(pk.Head.User, events.Batches.Tags(t.AgentTags(t.UserWorkspace(pk.Head.User))))
+			break
+
+		}
+
+	case packager.Type.Spray.Type:
+
+		switch pk.Body.SubEvent {
+
+		case packager.Type.Spray.Start:
+			Spray, err := t.SprayStart(pk.Head.User, pk.Body.Info)
+			if err != nil {
+				t.SendEventToUser(pk.Head.User, events.Teamserver.Logger("Failed to start spray: "+err.Error()))
+				break
+			}
+
+			t.SendEventToUser(pk.Head.User, events.Teamserver.Logger(fmt.Sprintf("Spray %v started: %v passwords against %v users via agent %v", Spray.ID, Spray.Passwords, len(Spray.Users), Spray.AgentID)))
+			t.SendEventToUser(pk.Head.User, events.Sprays.List(t.SprayList(t.UserWorkspace(pk.Head.User))))
+			break
+
+		case packager.Type.Spray.List:
+			t.SendEventToUser(pk.Head.User, events.Sprays.List(t.SprayList(t.UserWorkspace(pk.Head.User))))
+			break
+
+		case packager.Type.Spray.Attempts:
+			var ID, _ = pk.Body.Info["ID"].(string)
+
+			Spray, err := t.SprayAttempts(t.UserWorkspace(pk.Head.User), ID)
+			if err != nil {
+				t.SendEventToUser(pk.Head.User, events.Teamserver.Logger("Failed to get spray attempts: "+err.Error()))
+				break
+			}
+
+			t.SendEventToUser(pk.Head.User, events.Sprays.Attempts(Spray))
+			break
+
+		case packager.Type.Spray.Pause, packager.Type.Spray.Resume, packager.Type.Spray.Cancel:
+			var (
+				ID, _  = pk.Body.Info["ID"].(string)
+				Action = map[int]string{
+					packager.Type.Spray.Pause:  SPRAY_PAUSED,
+					packager.Type.Spray.Resume: SPRAY_RUNNING,
+					packager.Type.Spray.Cancel: SPRAY_CANCELLED,
+				}[pk.Body.SubEvent]
+			)
+
+			if err := t.SprayControl(pk.Head.User, ID, Action); err != nil {
+				t.SendEventToUser(pk.Head.User, events.Teamserver.Logger("Failed to change spray: "+err.Error()))
+				break
+			}
+
+			t.SendEventToUser(pk.Head.User, events.Sprays.List(t.SprayList(t.UserWorkspace(pk.Head.User))))
+			break
+
+		case packager.Type.Spray.Protocols:
+			t.SendEventToUser(pk.Head.User, events.Sprays.Protocols(SprayProtocols()))
+			break
+
+		}
+
+	case packager.Type.Pivot.Type:
+
+		switch pk.Body.SubEvent {
+
+		case packager.Type.Pivot.List:
+			t.pivotsSend(pk.Head.User)
+			break
+
+		case packager.Type.Pivot.Streams:
+			var AgentID, _ = pk.Body.Info["AgentID"].(string)
+
+			t.SendEventToUser(pk.Head.User, events.Pivots.Streams(t.PivotStreams(t.UserWorkspace(pk.Head.User), AgentID)))
+			break
+
+		}
+
+	case packager.Type.Route.Type:
+
+		switch pk.Body.SubEvent {
+
+		case packager.Type.Route.Add:
+			Route, err := t.RouteAdd(pk.Head.User, pk.Body.Info)
+			if err != nil {
+				t.SendEventToUser(pk.Head.User, events.Teamserver.Logger("Failed to add route: "+err.Error()))
+				break
+			}
+
+			t.SendEventToUser(pk.Head.User, events.Teamserver.Logger(fmt.Sprintf("Route %v to %v through %v added", Route.ID, Route.Destination, strings.Join(Route.Hops, " -> "))))
+			break
+
+		case packager.Type.Route.Remove:
+			var ID, _ = pk.Body.Info["ID"].(string)
+
+			if err := t.RouteRemove(pk.Head.User, ID); err != nil {
+				t.SendEventToUser(pk.Head.User, events.Teamserver.Logger("Failed to remove route: "+err.Error()))
+				break
+			}
+
+			t.routesSend("")
+			break
+
+		case packager.Type.Route.List:
+			t.routesSend(pk.Head.User)
+			break
+
+		case packager.Type.Route.Listen:
+			var Target, _ = pk.Body.Info["Target"].(string)
+
+			Port, err := strconv.Atoi(fmt.Sprint(pk.Body.Info["Port"]))
+			if err != nil {
+				t.SendEventToUser(pk.Head.User, events.Teamserver.Logger("Failed to open route port: invalid port"))
+				break
+			}
+
+			if _, err = t.RouteListen(pk.Head.User, Port, Target); err != nil {
+				t.SendEventToUser(pk.Head.User, events.Teamserver.Logger("Failed to open route port: "+err.Error()))
+				break
+			}
+
+			t.routesSend("")
+			break
+
+		case packager.Type.Route.Close:
+			Port, err := strconv.Atoi(fmt.Sprint(pk.Body.Info["Port"]))
+			if err != nil {
+				t.SendEventToUser(pk.Head.User, events.Teamserver.Logger("Failed to close route port: invalid port"))
+				break
+			}
+
+			if err = t.RouteClose(pk.Head.User, Port); err != nil {
+				t.SendEventToUser(pk.Head.User, events.Teamserver.Logger("Failed to close route port: "+err.Error()))
+				break
+			}
+
+			t.routesSend("")
+			break
+
+		}
+
+	case packager.Type.Group.Type:
+
+		switch pk.Body.SubEvent {
+
+		case packager.Type.Group.Save:
+			Group, err := t.GroupSave(pk.Head.User, pk.Body.Info)
+			if err != nil {
+				t.SendEventToUser(pk.Head.User, events.Teamserver.Logger("Failed to save agent group: "+err.Error()))
+				break
+			}
+
+			t.SendEventToUser(pk.Head.User, events.Teamserver.Logger(fmt.Sprintf("Agent group %v saved, it selects %v agents now", Group.Name, len(Group.Agents))))
+			t.SendEventToUser(pk.Head.User, events.Groups.List(t.GroupList(t.UserWorkspace(pk.Head.User))))
+			break
+
+		case packager.Type.Group.Remove:
+			var Name, _ = pk.Body.Info["Name"].(string)
+
+			if err := t.GroupRemove(pk.Head.User, Name); err != nil {
+				t.SendEventToUser(pk.Head.User, events.Teamserver.Logger("Failed to remove agent group: "+err.Error()))
+				break
+			}
+
+			t.SendEventToUser(pk.Head.User, events.Groups.List(t.GroupList(t.UserWorkspace(pk.Head.User))))
+			break
+
+		case packager.Type.Group.List:
+			t.SendEventToUser(pk.Head.User, events.Groups.List(t.GroupList(t.UserWorkspace(pk.Head.User))))
+			break
+
+		case packager.Type.Group.Members:
+			var Name, _ = pk.Body.Info["Name"].(string)
+
+			Members, err := t.GroupMembers(t.UserWorkspace(pk.Head.User), Name)
+			if err != nil {
+				t.SendEventToUser(pk.Head.User, events.Teamserver.Logger("Failed to list agent group: "+err.Error()))
+				break
+			}
 
-						var (
-							Message = new(map[string]string)
-							Console = func(AgentID string, Message map[string]string) {
-								var (
-									out, _ = json.Marshal(Message)
-									pk     = events.Demons.DemonOutput(DemonID, agent.HAVOC_CONSOLE_MESSAGE, string(out))
-								)
+			t.SendEventToUser(pk.Head.User, events.Groups.Members(Name, groupIDs(Members)))
+			break
 
-								t.EventAppend(pk)
-								t.EventBroadcast("", pk)
-							}
-						)
+		case packager.Type.Group.Tag:
+			var (
+				Name, _ = pk.Body.Info["Name"].(string)
+				Tag, _  = pk.Body.Info["Tag"].(string)
+			)
 
-						if val, ok := pk.Body.Info["CommandID"]; ok {
+			Tagged, err := t.GroupTag(pk.Head.User, Name, Tag)
+			if err != nil {
+				t.SendEventToUser(pk.Head.User, events.Teamserver.Logger("Failed to tag agent group: "+err.Error()))
+				break
+			}
 
-							if pk.Body.Info["CommandID"] == "Python Plugin" {
+			t.SendEventToUser(pk.Head.User, events.Teamserver.Logger(fmt.Sprintf("Tagged %v agents of group %v with %v", Tagged, Name, Tag)))
+			t.SendEventToUser(pk.Head.User, events.Batches.Tags(t.AgentTags(t.UserWorkspace(pk.Head.User))))
+			break
 
-								// TODO: move to own function.
-								logr.LogrInstance.AddAgentInput("Demon", pk.Body.Info["DemonID"].(string), pk.Head.User, pk.Body.Info["TaskID"].(string), pk.Body.Info["CommandLine"].(string), time.Now().UTC().Format("02/01/2006 15:04:05"))
+		}
 
-								if pk.Head.OneTime == "true" {
-									return
-								}
+	case packager.Type.Schedule.Type:
 
-								var backups = map[string]interface{}{
-									"TaskID":      pk.Body.Info["TaskID"].(string),
-									"DemonID":     DemonID,
-									"CommandID":   "",
-									"CommandLine": pk.Body.Info["CommandLine"].(string),
-									"AgentType":   AgentType,
-								}
+		switch pk.Body.SubEvent {
 
-								if _, ok := pk.Body.Info["CommandID"].(string); ok {
-									backups["CommandID"] = pk.Body.Info["CommandID"]
-								}
+		case packager.Type.Schedule.Add:
+			Jobs, err := t.ScheduleAdd(pk.Head.User, pk.Body.Info)
+			if err != nil {
+				t.SendEventToUser(pk.Head.User, events.Teamserver.Logger("Failed to schedule job: "+err.Error()))
+				break
+			}
 
-								if _, ok := pk.Body.Info["TaskMessage"].(string); ok {
-									backups["TaskMessage"] = pk.Body.Info["TaskMessage"]
-								}
+			t.SendEventToUser(pk.Head.User, events.Teamserver.Logger(fmt.Sprintf("Scheduled job on %v agents", len(Jobs))))
+			t.SendEventToUser(pk.Head.User, events.Schedules.List(t.ScheduleList(t.UserWorkspace(pk.Head.User))))
+			break
 
-								for k := range pk.Body.Info {
-									delete(pk.Body.Info, k)
-								}
+		case packager.Type.Schedule.List:
+			t.SendEventToUser(pk.Head.User, events.Schedules.List(t.ScheduleList(t.UserWorkspace(pk.Head.User))))
+			break
 
-								pk.Body.Info = backups
+		case packager.Type.Schedule.Cancel:
+			Cancelled, err := t.ScheduleCancel(pk.Head.User, pk.Body.Info)
+			if err != nil {
+				t.SendEventToUser(pk.Head.User, events.Teamserver.Logger("Failed to cancel scheduled jobs: "+err.Error()))
+				break
+			}
 
-								t.EventAppend(pk)
-								t.EventBroadcast(pk.Head.User, pk)
+			t.SendEventToUser(pk.Head.User, events.Teamserver.Logger(fmt.Sprintf("Cancelled %v scheduled jobs", Cancelled)))
+			t.SendEventToUser(pk.Head.User, events.Schedules.List(t.ScheduleList(t.UserWorkspace(pk.Head.User))))
+			break
 
-								return
+		}
 
-							} else if pk.Body.Info["CommandID"] == "Teamserver" {
+	case packager.Type.Clipboard.Type:
 
-								// TODO: move to own function.
-								logr.LogrInstance.AddAgentInput("Demon", pk.Body.Info["DemonID"].(string), pk.Head.User, pk.Body.Info["TaskID"].(string), pk.Body.Info["CommandLine"].(string), time.Now().UTC().Format("02/01/2006 15:04:05"))
+		switch pk.Body.SubEvent {
 
-								var Command = pk.Body.Info["Command"].(string)
+		case packager.Type.Clipboard.History:
+			t.SendEventToUser(pk.Head.User, events.Clipboard.History(t.ClipboardHistory(t.UserWorkspace(pk.Head.User), pk.Body.Info)))
+			break
 
-								if pk.Head.OneTime == "true" {
-									return
-								}
+		}
 
-								var backups = map[string]interface{}{
-									"TaskID":      pk.Body.Info["TaskID"].(string),
-									"DemonID":     DemonID,
-									"CommandID":   "",
-									"CommandLine": pk.Body.Info["CommandLine"].(string),
-									"AgentType":   AgentType,
-								}
+	case packager.Type.Registry.Type:
 
-								if _, ok := pk.Body.Info["CommandID"].(string); ok {
-									backups["CommandID"] = pk.Body.Info["CommandID"]
-								}
+		switch pk.Body.SubEvent {
 
-								for k := range pk.Body.Info {
-									delete(pk.Body.Info, k)
-								}
+		case packager.Type.Registry.Records:
+			Records, err := t.RegistryRecords(t.UserWorkspace(pk.Head.User), pk.Body.Info)
+			if err != nil {
+				t.SendEventToUser(pk.Head.User, events.Teamserver.Logger("Failed to list registry records: "+err.Error()))
+				break
+			}
 
-								pk.Body.Info = backups
+			t.SendEventToUser(pk.Head.User, events.Registry.Records(Records))
+			break
 
-								t.EventAppend(pk)
-								t.EventBroadcast(pk.Head.User, pk)
+		case packager.Type.Registry.Changes:
+			t.SendEventToUser(pk.Head.User, events.Registry.Changes(t.RegistryCleanup(t.UserWorkspace(pk.Head.User), pk.Body.Info)))
+			break
 
-								if err = t.Agents.Agents[i].TeamserverTaskPrepare(Command, Console); err != nil {
-									Console(t.Agents.Agents[i].NameID, map[string]string{
-										"Type":    "Error",
-										"Message": "Failed to create Task: " + err.Error(),
-									})
-									return
-								}
+		}
 
-								return
+	case packager.Type.Files.Type:
 
-							} else {
+		switch pk.Body.SubEvent {
 
-								// TODO: move to own function.
-								command, err = strconv.Atoi(val.(string))
-								if err != nil {
+		case packager.Type.Files.Records:
+			t.SendEventToUser(pk.Head.User, events.Files.Records(t.FileRecords(t.UserWorkspace(pk.Head.User), pk.Body.Info)))
+			break
 
-									logger.Error("Failed to convert CommandID to integer: " + err.Error())
-									command = 0
+		}
 
-								} else {
-									*Message = make(map[string]string)
-
-									var ClientID string
-									ClientID = ""
-									t.Clients.Range(func(key, value any) bool {
-										client := value.(*Client)
-										if client.Username == pk.Head.User {
-											ClientID = client.ClientID
-											return false
-										}
-										return true
-									})
+	case packager.Type.Timeline.Type:
 
-									job, err = t.Agents.Agents[i].TaskPrepare(command, pk.Body.Info, Message, ClientID, t)
-									if err != nil {
-										Console(t.Agents.Agents[i].NameID, map[string]string{
-											"Type":    "Error",
-											"Message": "Failed to create Task: " + err.Error(),
-										})
-										return
-									}
+		switch pk.Body.SubEvent {
 
-									if job != nil {
-										t.Agents.Agents[i].AddJobToQueue(*job)
-									}
+		case packager.Type.Timeline.Add:
+			if _, err := t.TimelineAdd(pk.Head.User, pk.Body.Info); err != nil {
+				t.SendEventToUser(pk.Head.User, events.Teamserver.Logger("Failed to add the timeline entry: "+err.Error()))
+			}
+			break
 
-									if t.Agents.Agents[i].Pivots.Parent != nil {
-										logr.LogrInstance.AddAgentInput("Demon", t.Agents.Agents[i].NameID, pk.Head.User, pk.Body.Info["TaskID"].(string), pk.Body.Info["CommandLine"].(string), time.Now().UTC().Format("02/01/2006 15:04:05"))
+		case packager.Type.Timeline.Remove:
+			var ID int
 
-									} else {
-										logr.LogrInstance.AddAgentInput("Demon", pk.Body.Info["DemonID"].(string), pk.Head.User, pk.Body.Info["TaskID"].(string), pk.Body.Info["CommandLine"].(string), time.Now().UTC().Format("02/01/2006 15:04:05"))
-									}
+			if val, ok := pk.Body.Info["ID"].(string); ok {
+				ID, _ = strconv.Atoi(val)
+			}
 
-									if pk.Head.OneTime == "true" {
-										return
-									}
+			if err := t.TimelineRemove(pk.Head.User, ID); err != nil {
+				t.SendEventToUser(pk.Head.User, events.Teamserver.Logger("Failed to remove the timeline entry: "+err.Error()))
+			}
+			break
 
-									var backups = map[string]interface{}{
-										"TaskID":      pk.Body.Info["TaskID"].(string),
-										"DemonID":     DemonID,
-										"CommandID":   "",
-										"CommandLine": pk.Body.Info["CommandLine"].(string),
-										"AgentType":   AgentType,
-									}
+		case packager.Type.Timeline.List:
+			t.SendEventToUser(pk.Head.User, events.Timeline.List(t.TimelineEntries(t.UserWorkspace(pk.Head.User))))
+			break
 
-									if _, ok := pk.Body.Info["CommandID"].(string); ok {
-										backups["CommandID"] = pk.Body.Info["CommandID"]
-									}
+		}
 
-									for k := range pk.Body.Info {
-										delete(pk.Body.Info, k)
-									}
+	case packager.Type.Evidence.Type:
 
-									pk.Body.Info = backups
+		switch pk.Body.SubEvent {
 
-									t.EventAppend(pk)
-									t.EventBroadcast(pk.Head.User, pk)
+		case packager.Type.Evidence.Add:
+			if _, err := t.EvidenceAdd(pk.Head.User, pk.Body.Info); err != nil {
+				t.SendEventToUser(pk.Head.User, events.Teamserver.Logger("Failed to attach the evidence: "+err.Error()))
+			}
+			break
 
-									if Message != nil {
-										Console(t.Agents.Agents[i].NameID, *Message)
-									}
+		case packager.Type.Evidence.Remove:
+			var ID int
 
-									return
-								}
-							}
-						}
+			if val, ok := pk.Body.Info["ID"].(string); ok {
+				ID, _ = strconv.Atoi(val)
+			}
 
-					} else {
+			if err := t.EvidenceRemove(pk.Head.User, ID); err != nil {
+				t.SendEventToUser(pk.Head.User, events.Teamserver.Logger("Failed to remove the evidence: "+err.Error()))
+			}
+			break
 
-						for _, a := range t.Service.Agents {
-							if a.MagicValue == fmt.Sprintf("0x%x", t.Agents.Agents[i].Info.MagicValue) {
+		case packager.Type.Evidence.List:
+			t.SendEventToUser(pk.Head.User, events.Evidence.List(t.Evidences(t.UserWorkspace(pk.Head.User), pk.Body.Info)))
+			break
 
-								// Set agent type
-								AgentType = a.Name
+		case packager.Type.Evidence.Fetch:
+			var ID int
 
-								if pk.Body.Info["CommandID"] == "Python Plugin" {
-									logr.LogrInstance.AddAgentInput(AgentType, pk.Body.Info["DemonID"].(string), pk.Head.User, pk.Body.Info["TaskID"].(string), pk.Body.Info["CommandLine"].(string), time.Now().UTC().Format("02/01/2006 15:04:05"))
+			if val, ok := pk.Body.Info["ID"].(string); ok {
+				ID, _ = strconv.Atoi(val)
+			}
 
-									if pk.Head.OneTime == "true" {
-										return
-									}
+			if Evidence, Data, err := t.EvidenceFetch(pk.Head.User, ID); err != nil {
+				t.SendEventToUser(pk.Head.User, events.Teamserver.Logger("Failed to fetch the evidence: "+err.Error()))
+			} else {
+				t.SendEventToUser(pk.Head.User, events.Evidence.Fetch(Evidence, Data))
+			}
+			break
 
-									var backups = map[string]interface{}{
-										"TaskID":      pk.Body.Info["TaskID"].(string),
-										"DemonID":     DemonID,
-										"CommandID":   "",
-										"CommandLine": pk.Body.Info["CommandLine"].(string),
-										"AgentType":   AgentType,
-									}
+		}
 
-									if _, ok := pk.Body.Info["CommandID"].(string); ok {
-										backups["CommandID"] = pk.Body.Info["CommandID"]
-									}
+	case packager.Type.Detection.Type:
 
-									if _, ok := pk.Body.Info["TaskMessage"].(string); ok {
-										backups["TaskMessage"] = pk.Body.Info["TaskMessage"]
-									}
+		switch pk.Body.SubEvent {
 
-									for k := range pk.Body.Info {
-										delete(pk.Body.Info, k)
-									}
+		case packager.Type.Detection.Annotate:
+			if _, err := t.DetectionSet(pk.Head.User, pk.Body.Info); err != nil {
+				t.SendEventToUser(pk.Head.User, events.Teamserver.Logger("Failed to annotate the task: "+err.Error()))
+			}
+			break
 
-									pk.Body.Info = backups
+		case packager.Type.Detection.List:
+			t.SendEventToUser(pk.Head.User, events.Detection.List(t.DetectionList(t.UserWorkspace(pk.Head.User))))
+			break
 
-									t.EventAppend(pk)
-									t.EventBroadcast(pk.Head.User, pk)
+		case packager.Type.Detection.Coverage:
+			t.SendEventToUser(pk.Head.User, events.Detection.Coverage(t.Coverage(t.UserWorkspace(pk.Head.User))))
+			break
 
-									return
+		}
 
-								} else {
-									// Send command to agent service
-									a.SendTask(pk.Body.Info, t.Agents.Agents[i].ToMap())
+	case packager.Type.Services.Type:
 
-									// log agent input
-									logr.LogrInstance.AddAgentInput(a.Name, pk.Body.Info["DemonID"].(string), pk.Head.User, pk.Body.Info["TaskID"].(string), pk.Body.Info["CommandLine"].(string), time.Now().UTC().Format("02/01/2006 15:04:05"))
-								}
+		switch pk.Body.SubEvent {
 
-							}
-						}
-					}
-					break
-				}
-			}
+		case packager.Type.Services.List:
+			t.SendEventToUser(pk.Head.User, events.Services.List(t.HostServices(t.UserWorkspace(pk.Head.User), pk.Body.Info)))
+			break
 
-			if found == false {
-				logger.Error(fmt.Sprintf("The AgentID %s was not found", DemonID))
-				return
-			}
+		}
 
-			if pk.Head.OneTime == "true" {
-				return
-			}
+	case packager.Type.Desktop.Type:
 
-			var backups = map[string]interface{}{
-				"TaskID":      pk.Body.Info["TaskID"].(string),
-				"DemonID":     DemonID,
-				"CommandID":   "",
-				"CommandLine": pk.Body.Info["CommandLine"].(string),
-				"AgentType":   AgentType,
-			}
+		switch pk.Body.SubEvent {
 
-			if _, ok := pk.Body.Info["CommandID"].(string); ok {
-				backups["CommandID"] = pk.Body.Info["CommandID"]
-			}
+		case packager.Type.Desktop.Watch, packager.Type.Desktop.Leave:
+			var AgentID, _ = pk.Body.Info["AgentID"].(string)
 
-			for k := range pk.Body.Info {
-				delete(pk.Body.Info, k)
+			if err := t.DesktopWatch(pk.Head.User, AgentID, pk.Body.SubEvent == packager.Type.Desktop.Watch); err != nil {
+				t.SendEventToUser(pk.Head.User, events.Teamserver.Logger("Failed to watch the desktop: "+err.Error()))
 			}
+			break
 
-			pk.Body.Info = backups
+		case packager.Type.Desktop.List:
+			t.SendEventToUser(pk.Head.User, events.Desktop.List(t.DesktopViews(t.UserWorkspace(pk.Head.User))))
+			break
 
-			t.EventAppend(pk)
-			t.EventBroadcast(pk.Head.User, pk)
 		}
 
 	case packager.Type.Chat.Type:
@@ -332,6 +1481,7 @@ func (t *Teamserver) DispatchEvent(pk packager.Package) {
 		switch pk.Body.SubEvent {
 
 		case packager.Type.Chat.NewMessage:
+			t.timelineChat(pk.Head.User, pk.Body.Info)
 			t.EventBroadcast("", pk)
 			break
 
@@ -350,7 +1500,17 @@ func (t *Teamserver) DispatchEvent(pk packager.Package) {
 
 		case packager.Type.Listener.Add:
 
-			var Protocol = pk.Body.Info["Protocol"].(string)
+			var (
+				Protocol       = pk.Body.Info["Protocol"].(string)
+				Name, _        = pk.Body.Info["Name"].(string)
+				Existed        = t.ListenerExist(Name)
+				Ephemeral, err = ListenerEphemeral(pk.Body.Info)
+			)
+
+			if err != nil {
+				t.SendEventToUser(pk.Head.User, events.Listener.ListenerError(pk.Head.User, Name, err))
+				break
+			}
 
 			switch Protocol {
 
@@ -493,10 +1653,40 @@ func (t *Teamserver) DispatchEvent(pk packager.Package) {
 					}
 				}
 
+				if val, ok := pk.Body.Info["Proxy Mode"].(string); ok {
+					Config.Proxy.Mode = val
+				}
+
+				if val, ok := pk.Body.Info["Host Headers"].(string); ok {
+					Config.HostHeaders = handlers.ParseHostHeaders(val)
+				}
+
+				if val, ok := pk.Body.Info["Server Names"].(string); ok {
+					for _, s := range strings.Split(val, ", ") {
+						if len(s) > 0 {
+							Config.ServerNames = append(Config.ServerNames, s)
+						}
+					}
+				}
+
+				if val, ok := pk.Body.Info["Proxy Auth"].(string); ok {
+					Config.Proxy.Auth = val
+				}
+
+				if val, ok := pk.Body.Info["Proxy Bypass"].(string); ok {
+					for _, s := range strings.Split(val, ", ") {
+						if len(s) > 0 {
+							Config.Proxy.Bypass = append(Config.Proxy.Bypass, s)
+						}
+					}
+				}
+
 				if pk.Body.Info["Secure"].(string) == "true" {
 					Config.Secure = true
 				}
 
+				Config.Workspace = t.ListenerNewWorkspace(pk)
+
 				if err := t.ListenerStart(handlers.LISTENER_HTTP, Config); err != nil {
 					t.Clients.Range(func(key, value any) bool {
 						id := key.(string)
@@ -530,6 +1720,8 @@ func (t *Teamserver) DispatchEvent(pk packager.Package) {
 					SmdConfig.Name = ""
 				}
 
+				SmdConfig.Workspace = t.ListenerNewWorkspace(pk)
+
 				if err := t.ListenerStart(handlers.LISTENER_PIVOT_SMB, SmdConfig); err != nil {
 					t.Clients.Range(func(key, value any) bool {
 						id := key.(string)
@@ -564,6 +1756,8 @@ func (t *Teamserver) DispatchEvent(pk packager.Package) {
 					return
 				}
 
+				ExtConfig.Workspace = t.ListenerNewWorkspace(pk)
+
 				if err := t.ListenerStart(handlers.LISTENER_EXTERNAL, ExtConfig); err != nil {
 					t.Clients.Range(func(key, value any) bool {
 						id := key.(string)
@@ -629,14 +1823,21 @@ func (t *Teamserver) DispatchEvent(pk packager.Package) {
 				break
 			}
 
+			if Ephemeral != nil && !Existed && t.ListenerExist(Name) {
+				t.ListenerEphemeralArm(pk.Head.User, Name, Ephemeral)
+			}
+
 			break
 
 		case packager.Type.Listener.Remove:
 
 			if val, ok := pk.Body.Info["Name"]; ok {
+				var Workspace = t.ListenerWorkspace(val.(string))
+
 				t.ListenerRemove(val.(string))
 
 				var p = events.Listener.ListenerRemove(val.(string))
+				p.Head.Workspace = Workspace
 
 				t.EventAppend(p)
 				t.EventBroadcast("", p)
@@ -644,6 +1845,83 @@ func (t *Teamserver) DispatchEvent(pk packager.Package) {
 
 			break
 
+		case packager.Type.Listener.TemplateSave:
+			var (
+				Name, _     = pk.Body.Info["Name"].(string)
+				Listener, _ = pk.Body.Info["Listener"].(string)
+			)
+
+			Template, err := t.ListenerTemplateSave(pk.Head.User, Name, Listener)
+			if err != nil {
+				t.SendEventToUser(pk.Head.User, events.Teamserver.Logger("Failed to save listener template: "+err.Error()))
+				break
+			}
+
+			t.SendEventToUser(pk.Head.User, events.Teamserver.Logger(fmt.Sprintf("Listener template %v saved from listener %v", Template.Name, Template.Source)))
+			t.SendEventToUser(pk.Head.User, events.Listener.Templates(t.ListenerTemplateList(t.UserWorkspace(pk.Head.User))))
+			break
+
+		case packager.Type.Listener.TemplateRemove:
+			var Name, _ = pk.Body.Info["Name"].(string)
+
+			if err := t.ListenerTemplateRemove(pk.Head.User, Name); err != nil {
+				t.SendEventToUser(pk.Head.User, events.Teamserver.Logger("Failed to remove listener template: "+err.Error()))
+				break
+			}
+
+			t.SendEventToUser(pk.Head.User, events.Listener.Templates(t.ListenerTemplateList(t.UserWorkspace(pk.Head.User))))
+			break
+
+		case packager.Type.Listener.TemplateList:
+			t.SendEventToUser(pk.Head.User, events.Listener.Templates(t.ListenerTemplateList(t.UserWorkspace(pk.Head.User))))
+			break
+
+		case packager.Type.Listener.Clone:
+			var (
+				Name, _        = pk.Body.Info["Name"].(string)
+				Ephemeral, err = ListenerEphemeral(pk.Body.Info)
+			)
+
+			if err != nil {
+				t.SendEventToUser(pk.Head.User, events.Listener.ListenerError(pk.Head.User, Name, err))
+				break
+			}
+
+			Clone, err := t.ListenerClone(pk.Head.User, t.ListenerNewWorkspace(pk), pk.Body.Info)
+			if err != nil {
+				t.SendEventToUser(pk.Head.User, events.Listener.ListenerError(pk.Head.User, Name, err))
+				break
+			}
+
+			if Ephemeral != nil {
+				t.ListenerEphemeralArm(pk.Head.User, Clone, Ephemeral)
+			}
+
+			break
+
+		case packager.Type.Listener.Egress:
+			var (
+				Name, _  = pk.Body.Info["Name"].(string)
+				Url, _   = pk.Body.Info["Url"].(string)
+				Agent, _ = pk.Body.Info["Agent"].(string)
+				User     = pk.Head.User
+			)
+
+			/* the stages take a while, more so through an agent */
+			go func() {
+				defer t.Recover("egress test of " + User)
+
+				Report, err := t.ListenerEgress(User, Name, Url, Agent)
+				if err != nil {
+					t.SendEventToUser(User, events.Listener.ListenerError(User, Name, err))
+					return
+				}
+
+				t.SendEventToUser(User, events.Listener.Egress(Report))
+			}()
+
+			break
+
 		case packager.Type.Listener.Edit:
 
 			var Protocol = pk.Body.Info["Protocol"].(string)
@@ -786,6 +2064,26 @@ func (t *Teamserver) DispatchEvent(pk packager.Package) {
 					}
 				}
 
+				if val, ok := pk.Body.Info["Proxy Mode"].(string); ok {
+					Config.Proxy.Mode = val
+				}
+
+				if val, ok := pk.Body.Info["Host Headers"].(string); ok {
+					Config.HostHeaders = handlers.ParseHostHeaders(val)
+				}
+
+				if val, ok := pk.Body.Info["Proxy Auth"].(string); ok {
+					Config.Proxy.Auth = val
+				}
+
+				if val, ok := pk.Body.Info["Proxy Bypass"].(string); ok {
+					for _, s := range strings.Split(val, ", ") {
+						if len(s) > 0 {
+							Config.Proxy.Bypass = append(Config.Proxy.Bypass, s)
+						}
+					}
+				}
+
 				if pk.Body.Info["Secure"].(string) == "true" {
 					Config.Secure = true
 				}
@@ -808,6 +2106,12 @@ func (t *Teamserver) DispatchEvent(pk packager.Package) {
 
 		switch pk.Body.SubEvent {
 		case packager.Type.Gate.Stageless:
+			Preset, err := t.PresetApply(pk.Head.User, pk.Body.Info)
+			if err != nil {
+				t.SendEventToUser(pk.Head.User, events.Gate.SendConsoleMessage("Error", "Failed to build payload: "+err.Error()))
+				break
+			}
+
 			var (
 				AgentType      = pk.Body.Info["AgentType"].(string)
 				ListenerName   = pk.Body.Info["Listener"].(string)
@@ -835,8 +2139,15 @@ func (t *Teamserver) DispatchEvent(pk packager.Package) {
 				}
 			}
 
+			if AgentType == "Demon" && Arch != "x64" && Arch != "x86" {
+				t.SendEventToUser(pk.Head.User, events.Gate.SendConsoleMessage("Error", "Failed to build payload: unknown architecture "+Arch))
+				break
+			}
+
 			if AgentType == "Demon" {
 				go func() {
+					defer t.Recover("payload build of " + pk.Head.User)
+
 					var ConfigMap = make(map[string]any)
 
 					err := json.Unmarshal([]byte(Config), &ConfigMap)
@@ -846,11 +2157,12 @@ func (t *Teamserver) DispatchEvent(pk packager.Package) {
 					}
 
 					var PayloadBuilder = builder.NewBuilder(builder.BuilderConfig{
-						Compiler64: t.Settings.Compiler64,
-						Compiler86: t.Settings.Compiler32,
-						Nasm:       t.Settings.Nasm,
-						DebugDev:   t.Flags.Server.DebugDev,
-						SendLogs:   t.Flags.Server.SendLogs,
+						Compiler64:  t.Settings.Compiler64,
+						Compiler86:  t.Settings.Compiler32,
+						Nasm:        t.Settings.Nasm,
+						DebugDev:    t.Flags.Server.DebugDev,
+						SendLogs:    t.Flags.Server.SendLogs,
+						MaxResponse: t.DemonMaxResponse(),
 					})
 
 					PayloadBuilder.ClientId = ClientID
@@ -910,7 +2222,15 @@ func (t *Teamserver) DispatchEvent(pk packager.Package) {
 						}
 					}
 
+					Fallbacks, err := t.ListenerFallbacks(Config, ListenerName)
+					if err != nil {
+						SendConsoleMsg("Error", "Failed to build payload: "+err.Error())
+						return
+					}
+
+					PayloadBuilder.SetFallbacks(Fallbacks)
 					PayloadBuilder.SetExtension(Ext)
+					PayloadBuilder.SetExcludeHosts(t.InfraBurnedHosts())
 
 					if t.Profile.Config.Demon != nil && t.Profile.Config.Demon.Binary != nil {
 						PayloadBuilder.SetPatchConfig(t.Profile.Config.Demon.Binary)
@@ -919,6 +2239,10 @@ func (t *Teamserver) DispatchEvent(pk packager.Package) {
 					if PayloadBuilder.Build() {
 						pal := PayloadBuilder.GetPayloadBytes()
 						if len(pal) > 0 {
+							if err := t.DB.PayloadAdd(Name+Ext, ListenerName, strings.Join(PayloadBuilder.CallbackHosts, ", "), Arch, Format, pk.Head.User, time.Now().Format("02/01/2006 15:04:05"), Preset, Config); err != nil {
+								logger.Error("Failed to add payload to database: " + err.Error())
+							}
+
 							err := t.SendEvent(PayloadBuilder.ClientId, events.Gate.SendStageless(Name+Ext, pal))
 							if err != nil {
 								logger.Error("Error while sending event: " + err.Error())
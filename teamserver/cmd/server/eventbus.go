@@ -0,0 +1,136 @@
+package server
+
+import (
+	"net"
+	"strings"
+
+	"Havoc/pkg/agent"
+	"Havoc/pkg/db"
+	"Havoc/pkg/eventbus"
+)
+
+// sessionData
+// what the consumers of the event bus get to know about a new session.
+// The keys of Info are the ones the webhooks expect.
+func sessionData(Agent *agent.Agent) map[string]any {
+	var (
+		Info = map[string]any{
+			"Hostname":    Agent.Info.Hostname,
+			"Username":    Agent.Info.Username,
+			"Domain":      Agent.Info.DomainName,
+			"InternalIP":  Agent.Info.InternalIP,
+			"ExternalIP":  Agent.Info.ExternalIP,
+			"ProcessPath": Agent.Info.ProcessPath,
+			"ProcessName": Agent.Info.ProcessName,
+			"ProcessPID":  Agent.Info.ProcessPID,
+			"ProcessArch": Agent.Info.ProcessArch,
+			"Elevated":    Agent.Info.Elevated,
+			"OSVersion":   Agent.Info.OSVersion,
+			"OSArch":      Agent.Info.OSArch,
+			"FirstCallIn": Agent.Info.FirstCallIn,
+			"Transport":   Agent.Info.Transport,
+		}
+
+		Data = map[string]any{
+			"NameID": Agent.NameID,
+			"Info":   Info,
+		}
+	)
+
+	/* the first callback in UTC and in the local time of the host */
+	Info["FirstCallInUTC"], Info["FirstCallInLocal"] = Agent.Info.CallInStamps(Agent.Info.FirstCallIn)
+
+	if len(Agent.Info.TimeZone) > 0 {
+		Info["TimeZone"] = Agent.Info.TimeZone
+		Info["UTCOffset"] = Agent.Info.UTCOffset
+	}
+
+	if Agent.Pivots.Parent != nil {
+		Data["Parent"] = Agent.Pivots.Parent.NameID
+	}
+
+	return Data
+}
+
+// credentialPublish
+// publishes a credential added to the credential store. The consumers
+// get to know whose credential it is, not the secret.
+func (t *Teamserver) credentialPublish(Credential db.Credential, AgentID string) {
+	var Data = map[string]any{
+		"Type":     "credential",
+		"ID":       Credential.ID,
+		"Username": Credential.Username,
+		"Domain":   Credential.Domain,
+		"Source":   Credential.Source,
+		"User":     Credential.User,
+	}
+
+	if len(AgentID) > 0 {
+		Data["AgentID"] = AgentID
+	}
+
+	t.EventPublish(eventbus.LOOT_ADDED, Credential.Workspace, Data)
+}
+
+// agentNetwork
+// the network of the internal address of an agent: its /24, or its /64
+// for ipv6. empty if the address isn't one.
+func agentNetwork(InternalIP string) string {
+	var IP = net.ParseIP(strings.TrimSpace(InternalIP))
+
+	if IP == nil || IP.IsUnspecified() || IP.IsLoopback() {
+		return ""
+	}
+
+	if IP4 := IP.To4(); IP4 != nil {
+		return (&net.IPNet{IP: IP4.Mask(net.CIDRMask(24, 32)), Mask: net.CIDRMask(24, 32)}).String()
+	}
+
+	return (&net.IPNet{IP: IP.Mask(net.CIDRMask(64, 128)), Mask: net.CIDRMask(64, 128)}).String()
+}
+
+// networkAdd
+// remembers the network of the agent. Returns the network if no agent
+// of the workspace was on it before.
+func (t *Teamserver) networkAdd(Agent *agent.Agent) string {
+	var Network = agentNetwork(Agent.Info.InternalIP)
+
+	if len(Network) == 0 {
+		return ""
+	}
+
+	t.Networks.Lock()
+	defer t.Networks.Unlock()
+
+	if t.Networks.Known == nil {
+		t.Networks.Known = make(map[[2]string]bool)
+	}
+
+	if t.Networks.Known[[2]string{Agent.Info.Workspace, Network}] {
+		return ""
+	}
+
+	t.Networks.Known[[2]string{Agent.Info.Workspace, Network}] = true
+
+	return Network
+}
+
+// networkPublish
+// publishes the first agent of the workspace on a network.
+func (t *Teamserver) networkPublish(Agent *agent.Agent, Network string) {
+	var Data = map[string]any{
+		"Network":    Network,
+		"AgentID":    Agent.NameID,
+		"Hostname":   Agent.Info.Hostname,
+		"Username":   Agent.Info.Username,
+		"Domain":     Agent.Info.DomainName,
+		"InternalIP": Agent.Info.InternalIP,
+		"ExternalIP": Agent.Info.ExternalIP,
+	}
+
+	if Agent.Pivots.Parent != nil {
+		Data["Parent"] = Agent.Pivots.Parent.NameID
+	}
+
+	t.EventPublish(eventbus.NETWORK_NEW, Agent.Info.Workspace, Data)
+}
@@ -0,0 +1,237 @@
+package server
+
+import (
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	"Havoc/pkg/agent"
+	"Havoc/pkg/db"
+	"Havoc/pkg/events"
+	"Havoc/pkg/logger"
+	"Havoc/pkg/logr"
+	"Havoc/pkg/packager"
+	"Havoc/pkg/profile"
+	"Havoc/pkg/seal"
+	"Havoc/pkg/utils"
+)
+
+const (
+	// biggest evidence an operator can attach. it goes back to the clients inline
+	EVIDENCE_MAX = agent.DOWNLOAD_INLINE_MAX
+	// longest description of an evidence
+	EVIDENCE_DESCRIPTION_MAX = 1024
+)
+
+// taskInput
+// returns the agent and the workspace of the task with the id.
+func (t *Teamserver) taskInput(TaskID string) (string, string, bool) {
+	for _, Data := range t.DB.EventsOf(packager.Type.Session.Type, packager.Type.Session.Input) {
+		var Package packager.Package
+
+		if err := json.Unmarshal([]byte(Data), &Package); err != nil {
+			continue
+		}
+
+		if ID, _ := Package.Body.Info["TaskID"].(string); ID != TaskID {
+			continue
+		}
+
+		var (
+			DemonID, _ = Package.Body.Info["DemonID"].(string)
+			Workspace  = Package.Head.Workspace
+		)
+
+		if len(Workspace) == 0 {
+			Workspace = t.AgentWorkspace(DemonID)
+		}
+
+		return DemonID, Workspace, true
+	}
+
+	return "", "", false
+}
+
+// EvidenceAdd
+// attaches a file to a task (TaskID) or a timeline entry (TimelineID)
+// and stores it in the loot vault. Info has the Name and the base64 Data
+// of the file, and optionally a Description.
+func (t *Teamserver) EvidenceAdd(User string, Info map[string]any) (db.Evidence, error) {
+	var (
+		Workspace      = t.UserWorkspace(User)
+		TaskID, _      = Info["TaskID"].(string)
+		TimelineID, _  = Info["TimelineID"].(string)
+		Name, _        = Info["Name"].(string)
+		Encoded, _     = Info["Data"].(string)
+		Description, _ = Info["Description"].(string)
+		Evidence       db.Evidence
+		Data           []byte
+		err            error
+	)
+
+	TaskID = strings.TrimSpace(TaskID)
+	TimelineID = strings.TrimSpace(TimelineID)
+
+	if (len(TaskID) == 0) == (len(TimelineID) == 0) {
+		return Evidence, errors.New("evidence has to be attached to either a task or a timeline entry")
+	}
+
+	/* only the name of the file, whatever path the client sent along */
+	if Name = filepath.Base(strings.ReplaceAll(strings.TrimSpace(Name), `\`, "/")); Name == "." || Name == "/" || Name == ".." {
+		return Evidence, errors.New("evidence needs a file name")
+	}
+
+	if Description = strings.TrimSpace(Description); len(Description) > EVIDENCE_DESCRIPTION_MAX {
+		return Evidence, fmt.Errorf("evidence description is longer than %v bytes", EVIDENCE_DESCRIPTION_MAX)
+	}
+
+	if Data, err = base64.StdEncoding.DecodeString(Encoded); err != nil || len(Data) == 0 {
+		return Evidence, errors.New("evidence has no content")
+	}
+
+	if len(Data) > EVIDENCE_MAX {
+		return Evidence, fmt.Errorf("evidence is bigger than %v bytes", EVIDENCE_MAX)
+	}
+
+	if len(TaskID) > 0 {
+		AgentID, TaskWorkspace, ok := t.taskInput(TaskID)
+		if !ok || !workspaceVisible(Workspace, TaskWorkspace) {
+			return Evidence, errors.New("task " + TaskID + " not found")
+		}
+
+		Evidence.TaskID = TaskID
+		Evidence.AgentID = AgentID
+		Evidence.Workspace = TaskWorkspace
+	} else {
+		ID, _ := strconv.Atoi(TimelineID)
+
+		Entry, err := t.DB.TimelineGet(ID)
+		if err != nil || !workspaceVisible(Workspace, Entry.Workspace) {
+			return Evidence, errors.New("timeline entry " + TimelineID + " not found")
+		}
+
+		Evidence.TimelineID = Entry.ID
+		Evidence.AgentID = Entry.AgentID
+		Evidence.Workspace = Entry.Workspace
+	}
+
+	var Hash = sha256.Sum256(Data)
+
+	Evidence.Workspace = workspaceOrDefault(Evidence.Workspace)
+	Evidence.Name = Name
+	Evidence.Description = Description
+	Evidence.Size = int64(len(Data))
+	Evidence.Hash = hex.EncodeToString(Hash[:])
+	Evidence.User = User
+	Evidence.Time = time.Now().Format("02/01/2006 15:04:05")
+
+	/* prefixed so two files with the same name don't overwrite each other */
+	if Evidence.Path, err = logr.LogrInstance.SaveEvidence(utils.GenerateID(8)+"-"+Name, Data); err != nil {
+		return Evidence, err
+	}
+
+	if Evidence.ID, err = t.DB.EvidenceAdd(Evidence); err != nil {
+		os.Remove(Evidence.Path)
+		return Evidence, err
+	}
+
+	logger.Info(fmt.Sprintf("Evidence %v (%v) attached by %v", Evidence.ID, Evidence.Name, User))
+
+	var pk = events.Evidence.Add(Evidence)
+	pk.Head.Workspace = Evidence.Workspace
+
+	t.EventBroadcast("", pk)
+
+	return Evidence, nil
+}
+
+// EvidenceRemove
+// removes the evidence and its file. Only its author and admins can.
+func (t *Teamserver) EvidenceRemove(User string, ID int) error {
+	Evidence, err := t.DB.EvidenceGet(ID)
+	if err != nil || !workspaceVisible(t.UserWorkspace(User), Evidence.Workspace) {
+		return fmt.Errorf("evidence %v not found", ID)
+	}
+
+	if Evidence.User != User && t.Profile.UserRole(User) != profile.ROLE_ADMIN {
+		return errors.New("only " + Evidence.User + " and admins can remove the evidence")
+	}
+
+	t.evidenceDelete(Evidence)
+
+	logger.Info(fmt.Sprintf("Evidence %v removed by %v", ID, User))
+
+	return nil
+}
+
+// evidenceDelete
+// removes the evidence, its file and tells the clients.
+func (t *Teamserver) evidenceDelete(Evidence db.Evidence) {
+	if _, err := t.DB.EvidenceRemove(Evidence.ID); err != nil {
+		logger.Error(fmt.Sprintf("Failed to remove evidence %v: %v", Evidence.ID, err))
+		return
+	}
+
+	if err := os.Remove(Evidence.Path); err != nil && !os.IsNotExist(err) {
+		logger.Warn("Failed to remove evidence file " + Evidence.Path + ": " + err.Error())
+	}
+
+	var pk = events.Evidence.Remove(Evidence.ID)
+	pk.Head.Workspace = Evidence.Workspace
+
+	t.EventBroadcast("", pk)
+}
+
+// Evidences
+// returns the evidence of the workspace. Info limits it to the one of
+// a TaskID or a TimelineID.
+func (t *Teamserver) Evidences(Workspace string, Info map[string]any) []db.Evidence {
+	var (
+		TaskID, _     = Info["TaskID"].(string)
+		TimelineID, _ = Info["TimelineID"].(string)
+		Entry, _      = strconv.Atoi(TimelineID)
+		List          []db.Evidence
+	)
+
+	for _, Evidence := range t.DB.Evidences() {
+		if !workspaceVisible(Workspace, Evidence.Workspace) {
+			continue
+		}
+
+		if len(TaskID) > 0 && Evidence.TaskID != TaskID {
+			continue
+		}
+
+		if len(TimelineID) > 0 && Evidence.TimelineID != Entry {
+			continue
+		}
+
+		List = append(List, Evidence)
+	}
+
+	return List
+}
+
+// EvidenceFetch
+// returns the evidence with the id and the content of its file.
+func (t *Teamserver) EvidenceFetch(User string, ID int) (db.Evidence, []byte, error) {
+	Evidence, err := t.DB.EvidenceGet(ID)
+	if err != nil || !workspaceVisible(t.UserWorkspace(User), Evidence.Workspace) {
+		return Evidence, nil, fmt.Errorf("evidence %v not found", ID)
+	}
+
+	Data, err := seal.ReadFile(Evidence.Path)
+	if err != nil {
+		return Evidence, nil, err
+	}
+
+	return Evidence, Data, nil
+}
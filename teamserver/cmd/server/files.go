@@ -0,0 +1,94 @@
+package server
+
+import (
+	"strings"
+	"time"
+
+	"Havoc/pkg/agent"
+	"Havoc/pkg/db"
+)
+
+// time the agent has to finish a file search before its options are
+// dropped. matches arriving later still get indexed, without the content
+const FILESEARCH_TIMEOUT = 24 * time.Hour
+
+// FileSearchRequested
+// keeps the options of the search until the agent finished it.
+func (t *Teamserver) FileSearchRequested(Agent *agent.Agent, RequestID uint32, Search agent.FileSearch) {
+	var Pending = &Search
+
+	t.FileSearches.Store(RequestID, Pending)
+
+	time.AfterFunc(FILESEARCH_TIMEOUT, func() {
+		t.FileSearches.CompareAndDelete(RequestID, Pending)
+	})
+}
+
+// FileSearchIndex
+// adds the files of a batch of matches to the index of the host.
+// Done is the last batch of the search.
+func (t *Teamserver) FileSearchIndex(Agent *agent.Agent, RequestID uint32, Matches []agent.FileMatch, Done bool) error {
+	var (
+		Workspace = workspaceOrDefault(Agent.Info.Workspace)
+		Host      = strings.ToLower(Agent.Info.Hostname)
+		Now       = time.Now().Format("02/01/2006 15:04:05")
+		Content   string
+		Records   []db.FileRecord
+	)
+
+	if value, ok := t.FileSearches.Load(RequestID); ok {
+		Content = value.(*agent.FileSearch).Grep
+	}
+
+	if Done {
+		t.FileSearches.Delete(RequestID)
+	}
+
+	for _, Match := range Matches {
+		var Name = Match.Path
+
+		if i := strings.LastIndexAny(Name, `\/`); i >= 0 {
+			Name = Name[i+1:]
+		}
+
+		Records = append(Records, db.FileRecord{
+			Workspace:  Workspace,
+			Host:       Host,
+			Path:       Match.Path,
+			Name:       Name,
+			Size:       Match.Size,
+			Modified:   Match.Modified.Format("02/01/2006 15:04:05"),
+			Attributes: Match.Attributes,
+			Content:    Content,
+			AgentID:    Agent.NameID,
+			Time:       Now,
+		})
+	}
+
+	if len(Records) == 0 {
+		return nil
+	}
+
+	return t.DB.FileAdd(Records)
+}
+
+// FileRecords
+// returns the indexed files of the workspace. Host limits them to a
+// host, Pattern to the names matching it (eg: *.kdbx) and Content to
+// the files that got found containing it.
+func (t *Teamserver) FileRecords(Workspace string, Info map[string]any) []db.FileRecord {
+	var (
+		Host, _    = Info["Host"].(string)
+		Pattern, _ = Info["Pattern"].(string)
+		Content, _ = Info["Content"].(string)
+		Records    []db.FileRecord
+	)
+
+	for _, Record := range t.DB.Files(strings.ToLower(Host), Pattern, Content) {
+		if workspaceVisible(Workspace, Record.Workspace) {
+			Records = append(Records, Record)
+		}
+	}
+
+	return Records
+}
@@ -0,0 +1,819 @@
+package server
+
+import (
+	"encoding/json"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	"Havoc/pkg/agent"
+	"Havoc/pkg/auth"
+	"Havoc/pkg/db"
+	"Havoc/pkg/graphql"
+	"Havoc/pkg/handlers"
+	"Havoc/pkg/logger"
+	"Havoc/pkg/logr"
+	"Havoc/pkg/packager"
+	"Havoc/pkg/profile"
+	"Havoc/pkg/seal"
+
+	"github.com/gin-gonic/gin"
+)
+
+// GraphQL
+// endpoint to query the engagement data (agents, tasks, loot, credentials,
+// hosts, listeners). Operators authenticate with http basic auth and only
+// see the data of their workspace.
+func (t *Teamserver) GraphQL(ctx *gin.Context) {
+	var Request struct {
+		Query     string         `json:"query"`
+		Variables map[string]any `json:"variables"`
+	}
+
+	User, Password, ok := ctx.Request.BasicAuth()
+	if !ok || !t.graphqlAuthenticate(User, Password) {
+		logger.Debug("GraphQL request with invalid credentials from " + ctx.ClientIP())
+		ctx.Header("WWW-Authenticate", `Basic realm="havoc"`)
+		ctx.AbortWithStatus(http.StatusUnauthorized)
+		return
+	}
+
+	if err := ctx.ShouldBindJSON(&Request); err != nil {
+		ctx.JSON(http.StatusBadRequest, graphql.Response{
+			Errors: []graphql.Error{{Message: "invalid request: " + err.Error()}},
+		})
+		return
+	}
+
+	ctx.JSON(http.StatusOK, graphql.Execute(t.graphqlRoot(t.UserWorkspace(User)), Request.Query, Request.Variables))
+}
+
+func (t *Teamserver) graphqlAuthenticate(User, Password string) bool {
+	if t.Profile == nil || t.Profile.Config.Operators == nil {
+		return false
+	}
+
+	if t.authLocal(User) {
+		/* relay accounts only carry the sessions of other operators */
+		if t.Profile.UserRole(User) == profile.ROLE_RELAY {
+			return false
+		}
+
+		return t.Profile.Authenticate(User, profile.PasswordDigest(Password))
+	}
+
+	var Credentials = auth.Credentials{User: User, Password: Password}
+
+	/* an id token of the identity provider instead of a password */
+	if strings.HasPrefix(Password, "eyJ") && strings.Count(Password, ".") == 2 {
+		Credentials = auth.Credentials{User: User, Token: Password}
+	}
+
+	/* the endpoints go by the user of the request, it has to be the operator's name */
+	if Name, ok := t.authExternal(Credentials); !ok || Name != User {
+		return false
+	}
+
+	return t.Profile.UserRole(User) != profile.ROLE_RELAY
+}
+
+// graphqlRoot
+// builds the root object of the data model for the given workspace.
+func (t *Teamserver) graphqlRoot(Workspace string) graphql.Object {
+	return graphql.Object{
+		"agents": graphql.Resolver(func(Args map[string]any) (any, error) {
+			return graphql.List(t.graphqlAgents(Workspace), Args), nil
+		}),
+
+		"agent": graphql.Resolver(func(Args map[string]any) (any, error) {
+			var ID, _ = Args["id"].(string)
+
+			for _, Agent := range t.graphqlAgents(Workspace) {
+				if strings.EqualFold(Agent["id"].(string), ID) {
+					return Agent, nil
+				}
+			}
+
+			return nil, nil
+		}),
+
+		"tasks": graphql.Resolver(func(Args map[string]any) (any, error) {
+			return graphql.List(t.graphqlTasks(Workspace, ""), Args), nil
+		}),
+
+		"loot": graphql.Resolver(func(Args map[string]any) (any, error) {
+			return graphql.List(t.graphqlLoot(Workspace, ""), Args), nil
+		}),
+
+		"credentials": graphql.Resolver(func(Args map[string]any) (any, error) {
+			return graphql.List(t.graphqlCredentials(Workspace), Args), nil
+		}),
+
+		"lateral": graphql.Resolver(func(Args map[string]any) (any, error) {
+			return graphql.List(t.graphqlLateral(Workspace), Args), nil
+		}),
+
+		"directory": graphql.Resolver(func(Args map[string]any) (any, error) {
+			var Type, _ = Args["type"].(string)
+
+			return graphql.List(t.graphqlDirectory(Workspace, Type), Args), nil
+		}),
+
+		"hosts": graphql.Resolver(func(Args map[string]any) (any, error) {
+			return graphql.List(t.graphqlHosts(Workspace), Args), nil
+		}),
+
+		"listeners": graphql.Resolver(func(Args map[string]any) (any, error) {
+			return graphql.List(t.graphqlListeners(Workspace), Args), nil
+		}),
+
+		"streams": graphql.Resolver(func(Args map[string]any) (any, error) {
+			return graphql.List(t.graphqlStreams(Workspace, ""), Args), nil
+		}),
+
+		"failures": graphql.Resolver(func(Args map[string]any) (any, error) {
+			return graphql.List(t.graphqlFailures(Workspace), Args), nil
+		}),
+
+		"files": graphql.Resolver(func(Args map[string]any) (any, error) {
+			return graphql.List(t.graphqlFiles(Workspace, Args), Args), nil
+		}),
+
+		"timeline": graphql.Resolver(func(Args map[string]any) (any, error) {
+			var Kind, _ = Args["kind"].(string)
+
+			return graphql.List(t.graphqlTimeline(Workspace, Kind), Args), nil
+		}),
+
+		"evidence": graphql.Resolver(func(Args map[string]any) (any, error) {
+			var Info = map[string]any{"TaskID": Args["taskId"]}
+
+			if ID, ok := Args["timelineId"].(int64); ok {
+				Info["TimelineID"] = strconv.FormatInt(ID, 10)
+			}
+
+			return graphql.List(t.graphqlEvidence(t.Evidences(Workspace, Info)), Args), nil
+		}),
+
+		"coverage": graphql.Resolver(func(Args map[string]any) (any, error) {
+			return t.graphqlCoverage(Workspace), nil
+		}),
+
+		"search": graphql.Resolver(func(Args map[string]any) (any, error) {
+			var (
+				Query, _ = Args["query"].(string)
+				Raw, _   = Args["raw"].(bool)
+				Results  []graphql.Object
+			)
+
+			Matches, err := t.Search(Workspace, Query, Raw, SEARCH_LIMIT_DEFAULT)
+			if err != nil {
+				return nil, err
+			}
+
+			for _, Match := range Matches {
+				var AgentID = Match.AgentID
+
+				Results = append(Results, graphql.Object{
+					"agentId": Match.AgentID,
+					"type":    Match.Type,
+					"user":    Match.User,
+					"time":    Match.Time,
+					"snippet": Match.Snippet,
+					"agent": graphql.Resolver(func(Args map[string]any) (any, error) {
+						return t.graphqlAgentByID(Workspace, AgentID), nil
+					}),
+				})
+			}
+
+			return graphql.List(Results, Args), nil
+		}),
+	}
+}
+
+func (t *Teamserver) graphqlAgent(Workspace string, Agent *agent.Agent) graphql.Object {
+	var Object = graphql.Object{
+		"id":     Agent.NameID,
+		"active": Agent.Active,
+		"reason": Agent.Reason,
+	}
+
+	if Agent.Info != nil {
+		Object["hostname"] = Agent.Info.Hostname
+		Object["username"] = Agent.Info.Username
+		Object["domain"] = Agent.Info.DomainName
+		Object["internalIP"] = Agent.Info.InternalIP
+		Object["externalIP"] = Agent.Info.ExternalIP
+		Object["elevated"] = Agent.Info.Elevated
+		Object["processName"] = Agent.Info.ProcessName
+		Object["processPath"] = Agent.Info.ProcessPath
+		Object["processArch"] = Agent.Info.ProcessArch
+		Object["wow64"] = Agent.IsWow64()
+		Object["processPID"] = Agent.Info.ProcessPID
+		Object["processPPID"] = Agent.Info.ProcessPPID
+		Object["osVersion"] = Agent.Info.OSVersion
+		Object["osArch"] = Agent.Info.OSArch
+		Object["osBuild"] = Agent.Info.OSBuild
+		Object["sleep"] = Agent.Info.SleepDelay
+		Object["jitter"] = Agent.Info.SleepJitter
+		Object["firstCallIn"] = Agent.Info.FirstCallIn
+		Object["lastCallIn"] = Agent.Info.LastCallIn
+		Object["timeZone"] = Agent.Info.TimeZone
+		Object["utcOffset"] = Agent.Info.UTCOffset
+		Object["firstCallInUTC"], Object["firstCallInLocal"] = Agent.Info.CallInStamps(Agent.Info.FirstCallIn)
+		Object["lastCallInUTC"], Object["lastCallInLocal"] = Agent.Info.CallInStamps(Agent.Info.LastCallIn)
+		_, Object["localTime"] = Agent.Info.TimeStamps(time.Now())
+		Object["callbackHost"] = Agent.Info.CallbackHost
+		Object["transport"] = Agent.Info.Transport
+		Object["proxyPath"] = Agent.Info.ProxyPath
+		Object["capabilities"] = strings.Join(Agent.CapabilityNames(), ", ")
+		Object["burned"] = Agent.Info.Burned
+		Object["workspace"] = Agent.Info.Workspace
+	}
+
+	/* relations */
+	Object["parent"] = graphql.Resolver(func(Args map[string]any) (any, error) {
+		if Agent.Pivots.Parent == nil {
+			return nil, nil
+		}
+
+		return t.graphqlAgent(Workspace, Agent.Pivots.Parent), nil
+	})
+
+	Object["links"] = graphql.Resolver(func(Args map[string]any) (any, error) {
+		var Links []graphql.Object
+
+		for _, Link := range Agent.Pivots.Links {
+			if Link != nil {
+				Links = append(Links, t.graphqlAgent(Workspace, Link))
+			}
+		}
+
+		return graphql.List(Links, Args), nil
+	})
+
+	Object["tasks"] = graphql.Resolver(func(Args map[string]any) (any, error) {
+		return graphql.List(t.graphqlTasks(Workspace, Agent.NameID), Args), nil
+	})
+
+	Object["loot"] = graphql.Resolver(func(Args map[string]any) (any, error) {
+		return graphql.List(t.graphqlLoot(Workspace, Agent.NameID), Args), nil
+	})
+
+	/* pivot streams the agent carries and the totals of all it carried */
+	Object["streams"] = graphql.Resolver(func(Args map[string]any) (any, error) {
+		return graphql.List(t.graphqlStreams(Workspace, Agent.NameID), Args), nil
+	})
+
+	Object["streamTotals"] = graphql.Resolver(func(Args map[string]any) (any, error) {
+		return graphqlStream(Agent.StreamTotals()), nil
+	})
+
+	/* listeners the agent called back over and when it failed over */
+	Object["transports"] = graphql.Resolver(func(Args map[string]any) (any, error) {
+		var (
+			Transports []graphql.Object
+			AgentID, _ = strconv.ParseInt(Agent.NameID, 16, 64)
+		)
+
+		for _, Transport := range t.DB.AgentTransports(int(AgentID)) {
+			Transports = append(Transports, graphql.Object{
+				"listener": Transport.Listener,
+				"previous": Transport.Previous,
+				"host":     Transport.Host,
+				"time":     Transport.Time,
+			})
+		}
+
+		return graphql.List(Transports, Args), nil
+	})
+
+	return Object
+}
+
+func (t *Teamserver) graphqlAgents(Workspace string) []graphql.Object {
+	var Agents []graphql.Object
+
+	for _, Agent := range t.Agents.List() {
+		if Agent.Info == nil || !workspaceVisible(Workspace, Agent.Info.Workspace) {
+			continue
+		}
+
+		Agents = append(Agents, t.graphqlAgent(Workspace, Agent))
+	}
+
+	return Agents
+}
+
+func (t *Teamserver) graphqlAgentByID(Workspace, AgentID string) any {
+	if Agent := t.Agents.Get(AgentID); Agent != nil && Agent.Info != nil && workspaceVisible(Workspace, Agent.Info.Workspace) {
+		return t.graphqlAgent(Workspace, Agent)
+	}
+
+	return nil
+}
+
+// graphqlTasks
+// returns every task (operator input) of the persisted event history.
+func (t *Teamserver) graphqlTasks(Workspace, AgentID string) []graphql.Object {
+	var Tasks []graphql.Object
+
+	for _, Data := range t.DB.EventsOf(packager.Type.Session.Type, packager.Type.Session.Input) {
+		var Package packager.Package
+
+		if err := json.Unmarshal([]byte(Data), &Package); err != nil {
+			continue
+		}
+
+		var (
+			DemonID, _     = Package.Body.Info["DemonID"].(string)
+			TaskID, _      = Package.Body.Info["TaskID"].(string)
+			CommandLine, _ = Package.Body.Info["CommandLine"].(string)
+			CommandID, _   = Package.Body.Info["CommandID"].(string)
+		)
+
+		if len(AgentID) > 0 && DemonID != AgentID {
+			continue
+		}
+
+		if !workspaceVisible(Workspace, t.EventWorkspace(Package)) {
+			continue
+		}
+
+		var TimeUTC, TimeLocal = t.agentStamps(DemonID, Package.Head.Time)
+
+		Tasks = append(Tasks, graphql.Object{
+			"id":          TaskID,
+			"agentId":     DemonID,
+			"user":        Package.Head.User,
+			"time":        Package.Head.Time,
+			"timeUTC":     TimeUTC,
+			"timeLocal":   TimeLocal,
+			"command":     CommandID,
+			"commandLine": CommandLine,
+			"agent": graphql.Resolver(func(Args map[string]any) (any, error) {
+				return t.graphqlAgentByID(Workspace, DemonID), nil
+			}),
+		})
+	}
+
+	return Tasks
+}
+
+// graphqlLoot
+// returns the downloaded files and screenshots of the agents.
+func (t *Teamserver) graphqlLoot(Workspace, AgentID string) []graphql.Object {
+	var Loot []graphql.Object
+
+	if logr.LogrInstance == nil {
+		return nil
+	}
+
+	for _, Agent := range t.Agents.List() {
+		if Agent.Info == nil || !workspaceVisible(Workspace, Agent.Info.Workspace) {
+			continue
+		}
+
+		if len(AgentID) > 0 && Agent.NameID != AgentID {
+			continue
+		}
+
+		for Type, Dir := range map[string]string{"download": "Download", "screenshot": "Screenshots", "output": "Output", "recording": "Recordings"} {
+			var Path = filepath.Join(logr.LogrInstance.AgentPath, Agent.NameID, Dir)
+
+			Files, err := os.ReadDir(Path)
+			if err != nil {
+				continue
+			}
+
+			for _, File := range Files {
+				Info, err := File.Info()
+				if err != nil || File.IsDir() {
+					continue
+				}
+
+				var (
+					NameID  = Agent.NameID
+					Size, _ = seal.Size(filepath.Join(Path, File.Name()))
+
+					TimeUTC, TimeLocal = Agent.Info.TimeStamps(Info.ModTime())
+				)
+
+				Loot = append(Loot, graphql.Object{
+					"agentId":   NameID,
+					"type":      Type,
+					"name":      File.Name(),
+					"path":      filepath.Join(Path, File.Name()),
+					"size":      Size,
+					"time":      Info.ModTime().Format("02/01/2006 15:04:05"),
+					"timeUTC":   TimeUTC,
+					"timeLocal": TimeLocal,
+					"agent": graphql.Resolver(func(Args map[string]any) (any, error) {
+						return t.graphqlAgentByID(Workspace, NameID), nil
+					}),
+				})
+			}
+		}
+	}
+
+	return Loot
+}
+
+// graphqlCredentials
+// returns the credentials of the credential store.
+func (t *Teamserver) graphqlCredentials(Workspace string) []graphql.Object {
+	var Credentials []graphql.Object
+
+	for _, Credential := range t.Credentials(Workspace) {
+		Credentials = append(Credentials, graphql.Object{
+			"id":          Credential.ID,
+			"username":    Credential.Username,
+			"domain":      Credential.Domain,
+			"password":    Credential.Password,
+			"hash":        Credential.Hash,
+			"certificate": Credential.Certificate,
+			"metadata":    Credential.Metadata,
+			"source":      Credential.Source,
+			"workspace":   Credential.Workspace,
+			"user":        Credential.User,
+			"time":        Credential.Time,
+		})
+	}
+
+	return Credentials
+}
+
+// graphqlLateral
+// returns the lateral movements (edges of the asset graph).
+func (t *Teamserver) graphqlLateral(Workspace string) []graphql.Object {
+	var Edges []graphql.Object
+
+	for _, Edge := range t.LateralEdges(Workspace) {
+		var (
+			AgentID   = Edge.AgentID
+			SessionID = Edge.SessionID
+		)
+
+		Edges = append(Edges, graphql.Object{
+			"id":         Edge.ID,
+			"method":     Edge.Method,
+			"agentId":    Edge.AgentID,
+			"target":     Edge.Target,
+			"credential": Edge.Credential,
+			"payload":    Edge.Payload,
+			"status":     Edge.Status,
+			"user":       Edge.User,
+			"time":       Edge.Time,
+			"sessionId":  Edge.SessionID,
+			"agent": graphql.Resolver(func(Args map[string]any) (any, error) {
+				return t.graphqlAgentByID(Workspace, AgentID), nil
+			}),
+			"session": graphql.Resolver(func(Args map[string]any) (any, error) {
+				if len(SessionID) == 0 {
+					return nil, nil
+				}
+
+				return t.graphqlAgentByID(Workspace, SessionID), nil
+			}),
+		})
+	}
+
+	return Edges
+}
+
+// graphqlDirectory
+// returns the directory objects collected by ldap searches.
+func (t *Teamserver) graphqlDirectory(Workspace, Type string) []graphql.Object {
+	var Objects []graphql.Object
+
+	for _, Object := range t.DirectoryObjects(Workspace, Type) {
+		var (
+			AgentID    = Object.AgentID
+			Control, _ = strconv.Atoi(directoryAttribute(Object.Attributes, "userAccountControl"))
+			Issues     []string
+		)
+
+		if Object.Type == "template" {
+			Issues = agent.AdcsTemplateIssues(agent.LdapEntry{DN: Object.DN, Attributes: Object.Attributes})
+		}
+
+		Objects = append(Objects, graphql.Object{
+			"dn":                   Object.DN,
+			"type":                 Object.Type,
+			"name":                 Object.Name,
+			"domain":               Object.Domain,
+			"sid":                  Object.SID,
+			"agentId":              Object.AgentID,
+			"time":                 Object.Time,
+			"description":          directoryAttribute(Object.Attributes, "description"),
+			"userPrincipalName":    directoryAttribute(Object.Attributes, "userPrincipalName"),
+			"dnsHostName":          directoryAttribute(Object.Attributes, "dNSHostName"),
+			"operatingSystem":      directoryAttribute(Object.Attributes, "operatingSystem"),
+			"servicePrincipalName": directoryValues(Object.Attributes, "servicePrincipalName"),
+			"memberOf":             directoryValues(Object.Attributes, "memberOf"),
+			"members":              directoryValues(Object.Attributes, "member"),
+			"enabled":              Control&0x2 == 0,
+			"issues":               Issues,
+			"agent": graphql.Resolver(func(Args map[string]any) (any, error) {
+				return t.graphqlAgentByID(Workspace, AgentID), nil
+			}),
+		})
+	}
+
+	return Objects
+}
+
+// graphqlHosts
+// groups the agents by the host they are running on.
+func (t *Teamserver) graphqlHosts(Workspace string) []graphql.Object {
+	var (
+		Hosts []graphql.Object
+		Index = make(map[string]graphql.Object)
+	)
+
+	for _, Agent := range t.Agents.List() {
+		if Agent.Info == nil || !workspaceVisible(Workspace, Agent.Info.Workspace) {
+			continue
+		}
+
+		var Key = strings.ToLower(Agent.Info.DomainName + "\\" + Agent.Info.Hostname)
+
+		Host, ok := Index[Key]
+		if !ok {
+			Host = graphql.Object{
+				"hostname":   Agent.Info.Hostname,
+				"domain":     Agent.Info.DomainName,
+				"internalIP": Agent.Info.InternalIP,
+				"osVersion":  Agent.Info.OSVersion,
+				"osArch":     Agent.Info.OSArch,
+			}
+
+			Index[Key] = Host
+			Hosts = append(Hosts, Host)
+		}
+
+		var Agents, _ = Host["agentList"].([]graphql.Object)
+		Host["agentList"] = append(Agents, t.graphqlAgent(Workspace, Agent))
+	}
+
+	for _, Host := range Hosts {
+		var Agents = Host["agentList"].([]graphql.Object)
+
+		delete(Host, "agentList")
+
+		Host["agents"] = graphql.Resolver(func(Args map[string]any) (any, error) {
+			return graphql.List(Agents, Args), nil
+		})
+	}
+
+	return Hosts
+}
+
+func (t *Teamserver) graphqlStreams(Workspace, AgentID string) []graphql.Object {
+	var Streams []graphql.Object
+
+	for _, Pivot := range t.PivotStreams(Workspace, AgentID) {
+		for _, Stream := range Pivot.Streams {
+			var Object = graphqlStream(Stream)
+
+			Object["agent"] = graphql.Resolver(func(Args map[string]any) (any, error) {
+				return t.graphqlAgentByID(Workspace, Stream.AgentID), nil
+			})
+
+			Streams = append(Streams, Object)
+		}
+	}
+
+	return Streams
+}
+
+func graphqlStream(Stream agent.StreamInfo) graphql.Object {
+	return graphql.Object{
+		"agentId":   Stream.AgentID,
+		"socketId":  Stream.SocketID,
+		"type":      Stream.Type,
+		"proxy":     Stream.Proxy,
+		"target":    Stream.Target,
+		"path":      strings.Join(Stream.Path, " -> "),
+		"opened":    Stream.Opened,
+		"streams":   Stream.Streams,
+		"sent":      Stream.Sent,
+		"received":  Stream.Received,
+		"rate":      Stream.Rate,
+		"rtt":       Stream.RTT,
+		"samples":   Stream.Samples,
+		"errors":    Stream.Errors,
+		"errorRate": Stream.ErrorRate,
+	}
+}
+
+func (t *Teamserver) graphqlFailures(Workspace string) []graphql.Object {
+	var Failures []graphql.Object
+
+	for _, Failure := range t.FailureList(Workspace) {
+		Failures = append(Failures, graphql.Object{
+			"code":    Failure.Code,
+			"command": Failure.Command,
+			"count":   Failure.Count,
+			"last":    Failure.Last,
+		})
+	}
+
+	return Failures
+}
+
+// graphqlFiles
+// returns the indexed files of the workspace for the api.
+func (t *Teamserver) graphqlFiles(Workspace string, Args map[string]any) []graphql.Object {
+	var (
+		Info    = make(map[string]any)
+		Objects []graphql.Object
+	)
+
+	for _, Key := range []string{"Host", "Pattern", "Content"} {
+		Info[Key] = Args[strings.ToLower(Key)]
+	}
+
+	for _, Record := range t.FileRecords(Workspace, Info) {
+		var AgentID = Record.AgentID
+
+		Objects = append(Objects, graphql.Object{
+			"host":       Record.Host,
+			"path":       Record.Path,
+			"name":       Record.Name,
+			"size":       Record.Size,
+			"modified":   Record.Modified,
+			"attributes": Record.Attributes,
+			"content":    Record.Content,
+			"agentId":    Record.AgentID,
+			"time":       Record.Time,
+			"agent": graphql.Resolver(func(Args map[string]any) (any, error) {
+				return t.graphqlAgentByID(Workspace, AgentID), nil
+			}),
+		})
+	}
+
+	return Objects
+}
+
+// graphqlTimeline
+// returns the engagement timeline of the workspace for the api. Kind
+// limits it to sessions, tasks or the manual entries.
+func (t *Teamserver) graphqlTimeline(Workspace, Kind string) []graphql.Object {
+	var Objects []graphql.Object
+
+	for _, Item := range t.Timeline(Workspace) {
+		var (
+			AgentID   = Item.AgentID
+			Detection = Item.Detection
+		)
+
+		if len(Kind) > 0 && Item.Kind != Kind {
+			continue
+		}
+
+		Objects = append(Objects, graphql.Object{
+			"id":       Item.ID,
+			"time":     Item.Time,
+			"kind":     Item.Kind,
+			"category": Item.Category,
+			"text":     Item.Text,
+			"agentId":  Item.AgentID,
+			"user":     Item.User,
+			"taskId":   Item.TaskID,
+			"evidence": t.graphqlEvidence(Item.Evidence),
+			"detection": graphql.Resolver(func(Args map[string]any) (any, error) {
+				if Detection == nil {
+					return nil, nil
+				}
+
+				return graphqlDetection(*Detection), nil
+			}),
+			"agent": graphql.Resolver(func(Args map[string]any) (any, error) {
+				return t.graphqlAgentByID(Workspace, AgentID), nil
+			}),
+		})
+	}
+
+	return Objects
+}
+
+// graphqlDetection
+// returns the detection annotation of a task for the api.
+func graphqlDetection(Detection db.Detection) graphql.Object {
+	var Time string
+
+	if Detection.Time > 0 {
+		Time = time.Unix(Detection.Time, 0).UTC().Format("2006-01-02T15:04:05Z")
+	}
+
+	return graphql.Object{
+		"detected":  Detection.Detected,
+		"time":      Time,
+		"reference": Detection.Reference,
+		"user":      Detection.User,
+		"updated":   Detection.Updated,
+	}
+}
+
+// graphqlCoverage
+// returns the detection coverage of the tasks of the workspace for the api.
+func (t *Teamserver) graphqlCoverage(Workspace string) graphql.Object {
+	var (
+		Coverage = t.Coverage(Workspace)
+		Commands []graphql.Object
+	)
+
+	for _, Count := range Coverage.Commands {
+		Commands = append(Commands, graphql.Object{
+			"command":  Count.Command,
+			"tasks":    Count.Tasks,
+			"detected": Count.Detected,
+			"missed":   Count.Missed,
+			"unknown":  Count.Unknown,
+		})
+	}
+
+	return graphql.Object{
+		"tasks":            Coverage.Tasks,
+		"annotated":        Coverage.Annotated,
+		"detected":         Coverage.Detected,
+		"missed":           Coverage.Missed,
+		"unknown":          Coverage.Unknown,
+		"coverage":         Coverage.Coverage,
+		"meanTimeToDetect": Coverage.MeanTimeToDetect,
+		"commands":         Commands,
+	}
+}
+
+// graphqlEvidence
+// returns the evidence for the api. the content is fetched through the
+// teamserver connection.
+func (t *Teamserver) graphqlEvidence(List []db.Evidence) []graphql.Object {
+	var Objects []graphql.Object
+
+	for _, Evidence := range List {
+		Objects = append(Objects, graphql.Object{
+			"id":          Evidence.ID,
+			"taskId":      Evidence.TaskID,
+			"timelineId":  Evidence.TimelineID,
+			"agentId":     Evidence.AgentID,
+			"name":        Evidence.Name,
+			"description": Evidence.Description,
+			"size":        Evidence.Size,
+			"sha256":      Evidence.Hash,
+			"user":        Evidence.User,
+			"time":        Evidence.Time,
+		})
+	}
+
+	return Objects
+}
+
+func (t *Teamserver) graphqlListeners(Workspace string) []graphql.Object {
+	var Listeners []graphql.Object
+
+	for _, listener := range t.Listeners {
+		var Listener = graphql.Object{
+			"name":      listener.Name,
+			"workspace": t.ListenerWorkspace(listener.Name),
+		}
+
+		if !workspaceVisible(Workspace, Listener["workspace"].(string)) {
+			continue
+		}
+
+		switch listener.Config.(type) {
+		case *handlers.HTTP:
+			var Config = listener.Config.(*handlers.HTTP).Config
+
+			Listener["protocol"] = handlers.AGENT_HTTP
+			if Config.Secure {
+				Listener["protocol"] = handlers.AGENT_HTTPS
+			}
+
+			Listener["hosts"] = strings.Join(Config.Hosts, ", ")
+			Listener["hostBind"] = Config.HostBind
+			Listener["portBind"] = Config.PortBind
+			Listener["active"] = listener.Config.(*handlers.HTTP).Active
+			break
+
+		case *handlers.SMB:
+			Listener["protocol"] = handlers.AGENT_PIVOT_SMB
+			Listener["pipeName"] = listener.Config.(*handlers.SMB).Config.PipeName
+			break
+
+		case *handlers.External:
+			Listener["protocol"] = handlers.AGENT_EXTERNAL
+			Listener["endpoint"] = listener.Config.(*handlers.External).Config.Endpoint
+			break
+		}
+
+		Listeners = append(Listeners, Listener)
+	}
+
+	return Listeners
+}
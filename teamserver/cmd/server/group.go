@@ -0,0 +1,223 @@
+package server
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"Havoc/pkg/agent"
+	"Havoc/pkg/db"
+	"Havoc/pkg/logger"
+)
+
+// GroupSave
+// saves the selection of the request (Tag, Subnet and Filter, see
+// BatchSelect) as a group of the workspace of the operator (eg: "x64
+// servers in 10.2.0.0/16 with an admin token" is Subnet 10.2.0.0/16 and
+// Filter "arch=x64 os=*server* elevated=true"). The group is evaluated
+// whenever it gets used, agents join and leave it as they change.
+func (t *Teamserver) GroupSave(User string, Info map[string]any) (AgentGroup, error) {
+	var Group = db.AgentGroup{
+		Workspace: t.UserWorkspace(User),
+		User:      User,
+		Time:      time.Now().Format("02/01/2006 15:04:05"),
+	}
+
+	Group.Name, _ = Info["Name"].(string)
+	Group.Description, _ = Info["Description"].(string)
+	Group.Tag, _ = Info["Tag"].(string)
+	Group.Subnet, _ = Info["Subnet"].(string)
+	Group.Filter, _ = Info["Filter"].(string)
+
+	if Group.Name = strings.TrimSpace(Group.Name); len(Group.Name) == 0 {
+		return AgentGroup{}, errors.New("group name is required")
+	}
+
+	/* names get listed comma separated (notification preferences) */
+	if strings.ContainsAny(Group.Name, ", ") {
+		return AgentGroup{}, errors.New("group name can't contain spaces or commas")
+	}
+
+	if len(Group.Tag) == 0 && len(Group.Subnet) == 0 && len(Group.Filter) == 0 {
+		return AgentGroup{}, errors.New("select the agents of the group by tag, subnet or filter")
+	}
+
+	if Existing, err := t.DB.GroupGet(Group.Name); err == nil && !workspaceVisible(Group.Workspace, Existing.Workspace) {
+		return AgentGroup{}, errors.New("group " + Group.Name + " exists in another workspace")
+	}
+
+	/* validates the selection before it gets stored */
+	Members, err := t.groupMatch(Group)
+	if err != nil {
+		return AgentGroup{}, err
+	}
+
+	if err = t.DB.GroupSet(Group); err != nil {
+		return AgentGroup{}, err
+	}
+
+	logger.Info(fmt.Sprintf("Agent group %v saved by %v (tag: %v, subnet: %v, filter: %v): %v agents", Group.Name, User, orNone(Group.Tag), orNone(Group.Subnet), orNone(Group.Filter), len(Members)))
+
+	return AgentGroup{AgentGroup: Group, Agents: groupIDs(Members)}, nil
+}
+
+// GroupRemove
+// removes the group of the workspace. The agents are left untouched.
+func (t *Teamserver) GroupRemove(User, Name string) error {
+	if _, err := t.groupGet(t.UserWorkspace(User), Name); err != nil {
+		return err
+	}
+
+	if _, err := t.DB.GroupRemove(Name); err != nil {
+		return err
+	}
+
+	logger.Info(fmt.Sprintf("Agent group %v removed by %v", Name, User))
+
+	return nil
+}
+
+// GroupList
+// returns the groups of the workspace with the agents they select now.
+func (t *Teamserver) GroupList(Workspace string) []AgentGroup {
+	var Groups []AgentGroup
+
+	for _, Group := range t.DB.Groups() {
+		if !workspaceVisible(Workspace, Group.Workspace) {
+			continue
+		}
+
+		Members, err := t.groupMatch(Group)
+		if err != nil {
+			logger.Error(fmt.Sprintf("Failed to evaluate agent group %v: %v", Group.Name, err))
+		}
+
+		Groups = append(Groups, AgentGroup{AgentGroup: Group, Agents: groupIDs(Members)})
+	}
+
+	return Groups
+}
+
+// GroupMembers
+// returns the active demons the group of the workspace selects now.
+func (t *Teamserver) GroupMembers(Workspace, Name string) ([]*agent.Agent, error) {
+	Group, err := t.groupGet(Workspace, Name)
+	if err != nil {
+		return nil, err
+	}
+
+	/* the members have to be in the workspace asking too, not only in the one of the group */
+	Members, err := t.groupMatch(Group)
+	if err != nil {
+		return nil, err
+	}
+
+	var Visible []*agent.Agent
+
+	for _, Agent := range Members {
+		if workspaceVisible(Workspace, Agent.Info.Workspace) {
+			Visible = append(Visible, Agent)
+		}
+	}
+
+	return Visible, nil
+}
+
+// GroupTag
+// adds the tag to every agent the group selects now, the other tags of
+// the agents are kept. Returns the agents tagged.
+func (t *Teamserver) GroupTag(User, Name, Tag string) (int, error) {
+	var Tags = t.DB.AgentTags()
+
+	if Tag = strings.TrimSpace(Tag); len(Tag) == 0 || strings.Contains(Tag, ",") {
+		return 0, errors.New("invalid tag " + Tag)
+	}
+
+	Members, err := t.GroupMembers(t.UserWorkspace(User), Name)
+	if err != nil {
+		return 0, err
+	}
+
+	for _, Agent := range Members {
+		var (
+			NameID, _ = strconv.ParseInt(Agent.NameID, 16, 64)
+			List      = Tags[int(NameID)]
+			Tagged    = false
+		)
+
+		for _, Existing := range List {
+			if strings.EqualFold(Existing, Tag) {
+				Tagged = true
+				break
+			}
+		}
+
+		if Tagged {
+			continue
+		}
+
+		if err = t.DB.AgentTagsSet(int(NameID), append(List, Tag)); err != nil {
+			return 0, err
+		}
+	}
+
+	logger.Info(fmt.Sprintf("Agent group %v tagged %v by %v: %v agents", Name, Tag, User, len(Members)))
+
+	return len(Members), nil
+}
+
+// groupGet
+// returns the stored group if the workspace sees it.
+func (t *Teamserver) groupGet(Workspace, Name string) (db.AgentGroup, error) {
+	Group, err := t.DB.GroupGet(Name)
+	if err != nil || !workspaceVisible(Workspace, Group.Workspace) {
+		return db.AgentGroup{}, errors.New("agent group " + Name + " not found")
+	}
+
+	return Group, nil
+}
+
+// groupMatch
+// evaluates the selection of the group in its workspace.
+func (t *Teamserver) groupMatch(Group db.AgentGroup) ([]*agent.Agent, error) {
+	return t.batchMatch(Group.Workspace, map[string]any{
+		"Tag":    Group.Tag,
+		"Subnet": Group.Subnet,
+		"Filter": Group.Filter,
+	})
+}
+
+// groupContains
+// returns true if the agent is a member of one of the groups of the
+// workspace. Groups that don't exist (anymore) select nothing.
+func (t *Teamserver) groupContains(Workspace string, Groups []string, AgentID string) bool {
+	for _, Name := range Groups {
+		Members, err := t.GroupMembers(Workspace, Name)
+		if err != nil {
+			continue
+		}
+
+		for _, Agent := range Members {
+			if Agent.NameID == AgentID {
+				return true
+			}
+		}
+	}
+
+	return false
+}
+
+func groupIDs(Agents []*agent.Agent) []string {
+	var IDs = []string{}
+
+	for _, Agent := range Agents {
+		IDs = append(IDs, Agent.NameID)
+	}
+
+	sort.Strings(IDs)
+
+	return IDs
+}
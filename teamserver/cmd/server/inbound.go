@@ -0,0 +1,187 @@
+package server
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"time"
+
+	"Havoc/pkg/agent"
+	"Havoc/pkg/common"
+	"Havoc/pkg/logger"
+)
+
+// smallest request size backpressure tells an agent to stay below
+const INBOUND_MIN_REQUEST = 0x10000
+
+// InboundSetup
+// parses the inbound limits of the profile.
+func (t *Teamserver) InboundSetup() {
+	var (
+		Config = t.Profile.Config.Demon
+		Policy = new(InboundPolicy)
+	)
+
+	t.Inbound.Agents = make(map[string]*InboundState)
+
+	if Config == nil || Config.Inbound == nil {
+		return
+	}
+
+	Policy.Rate = float64(Config.Inbound.Rate)
+	Policy.Burst = float64(Config.Inbound.Burst)
+	Policy.Drop = float64(Config.Inbound.Drop)
+	Policy.Concurrent = Config.Inbound.Concurrent
+	Policy.Alert = int64(Config.Inbound.Alert)
+
+	if Policy.Rate < 0 || Policy.Burst < 0 || Policy.Drop < 0 || Policy.Concurrent < 0 || Policy.Alert < 0 {
+		logger.Error("Inbound limits can't be negative")
+		return
+	}
+
+	if Policy.Burst == 0 {
+		Policy.Burst = Policy.Rate * 10
+	}
+
+	if Policy.Drop == 0 {
+		Policy.Drop = Policy.Burst
+	}
+
+	if Policy.Concurrent == 0 {
+		Policy.Concurrent = 2
+	}
+
+	t.Inbound.Policy = Policy
+
+	logger.Info(fmt.Sprintf("Inbound limits: %v per second (burst %v), %v concurrent requests per agent, alert at %v per minute", exfilMax(int64(Policy.Rate)), common.ByteCountSI(int64(Policy.Burst)), Policy.Concurrent, exfilMax(Policy.Alert)))
+}
+
+// AgentInbound
+// accounts a request of the agent before its results get processed.
+// Returns an error if the request has to be refused and a backpressure
+// job if the agent has to slow down (or may speed up again). Every
+// accepted request has to be finished with AgentInboundDone.
+func (t *Teamserver) AgentInbound(Agent *agent.Agent, Size int) (*agent.Job, error) {
+	var (
+		Policy = t.Inbound.Policy
+		State  *InboundState
+		Now    = time.Now()
+		ok     bool
+	)
+
+	if Policy == nil {
+		return nil, nil
+	}
+
+	t.Inbound.Lock()
+	defer t.Inbound.Unlock()
+
+	if State, ok = t.Inbound.Agents[Agent.NameID]; !ok {
+		State = &InboundState{Tokens: Policy.Burst, Last: Now, Minute: Now}
+		t.Inbound.Agents[Agent.NameID] = State
+	}
+
+	if State.Active >= Policy.Concurrent {
+		logger.Warn(fmt.Sprintf("Refused request of agent %v: %v requests in progress", Agent.NameID, State.Active))
+		return nil, errors.New("too many concurrent requests")
+	}
+
+	t.inboundAlert(Agent, State, int64(Size), Now)
+
+	if Policy.Rate <= 0 {
+		State.Active++
+		return nil, nil
+	}
+
+	/* refill the bucket */
+	State.Tokens = math.Min(Policy.Burst, State.Tokens+Now.Sub(State.Last).Seconds()*Policy.Rate)
+	State.Last = Now
+
+	if State.Tokens-float64(Size) < -Policy.Drop {
+		logger.Warn(fmt.Sprintf("Dropped request of agent %v: %v exceeds the inbound limit", Agent.NameID, common.ByteCountSI(int64(Size))))
+		return nil, errors.New("inbound limit exceeded")
+	}
+
+	State.Tokens -= float64(Size)
+	State.Active++
+
+	if State.Tokens < 0 {
+		var (
+			Sleep      = math.Max(float64(Agent.Info.SleepDelay), 1)
+			MaxRequest = math.Max(Policy.Rate*Sleep, INBOUND_MIN_REQUEST)
+			Backoff    = -State.Tokens / Policy.Rate * 1000
+		)
+
+		if !State.Throttled {
+			logger.Warn(fmt.Sprintf("Agent %v exceeds the inbound rate, limiting its requests to %v", Agent.NameID, common.ByteCountSI(int64(MaxRequest))))
+		}
+
+		State.Throttled = true
+
+		return inboundJob(uint32(MaxRequest), uint32(Backoff)), nil
+	}
+
+	if State.Throttled {
+		State.Throttled = false
+
+		logger.Info(fmt.Sprintf("Agent %v is below the inbound rate again", Agent.NameID))
+
+		return inboundJob(0, 0), nil
+	}
+
+	return nil, nil
+}
+
+// AgentInboundDone
+// finishes a request accepted by AgentInbound.
+func (t *Teamserver) AgentInboundDone(Agent *agent.Agent) {
+	if t.Inbound.Policy == nil {
+		return
+	}
+
+	t.Inbound.Lock()
+	defer t.Inbound.Unlock()
+
+	if State, ok := t.Inbound.Agents[Agent.NameID]; ok && State.Active > 0 {
+		State.Active--
+	}
+}
+
+// inboundAlert
+// alerts the operators once per minute the agent sends more than the
+// alert threshold. Inbound lock has to be held.
+func (t *Teamserver) inboundAlert(Agent *agent.Agent, State *InboundState, Size int64, Now time.Time) {
+	if Now.Sub(State.Minute) >= time.Minute {
+		State.Minute = Now
+		State.Bytes = 0
+		State.Alerted = false
+	}
+
+	State.Bytes += Size
+
+	if t.Inbound.Policy.Alert <= 0 || State.Alerted || State.Bytes < t.Inbound.Policy.Alert {
+		return
+	}
+
+	State.Alerted = true
+
+	logger.Warn(fmt.Sprintf("Agent %v sent %v within a minute", Agent.NameID, common.ByteCountSI(State.Bytes)))
+
+	/* console output takes its own locks. don't hold up the agent */
+	go t.AgentConsole(Agent.NameID, agent.HAVOC_CONSOLE_MESSAGE, map[string]string{
+		"Type":    "Error",
+		"Message": fmt.Sprintf("Agent sent %v within a minute (alert threshold %v)", common.ByteCountSI(State.Bytes), common.ByteCountSI(t.Inbound.Policy.Alert)),
+	})
+}
+
+// inboundJob
+// tells the agent the max size of its requests and how long to back off.
+func inboundJob(MaxRequest, Backoff uint32) *agent.Job {
+	return &agent.Job{
+		Command: agent.COMMAND_BACKPRESSURE,
+		Data: []interface{}{
+			MaxRequest,
+			Backoff,
+		},
+	}
+}
@@ -0,0 +1,308 @@
+package server
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"strings"
+	"time"
+
+	"Havoc/pkg/agent"
+	"Havoc/pkg/common"
+	"Havoc/pkg/events"
+	"Havoc/pkg/handlers"
+	"Havoc/pkg/logger"
+)
+
+// infraHost
+// normalizes a domain/ip so it can be compared against listener hosts.
+func infraHost(Host string) string {
+	return strings.ToLower(strings.TrimSpace(strings.Split(Host, ":")[0]))
+}
+
+// InfraLoad
+// loads every burned host from the database.
+func (t *Teamserver) InfraLoad() {
+	t.BurnedMtx.Lock()
+	defer t.BurnedMtx.Unlock()
+
+	t.Burned = nil
+	for _, burned := range t.DB.BurnedAll() {
+		t.Burned = append(t.Burned, &BurnedHost{
+			Host:   burned["Host"].(string),
+			Reason: burned["Reason"].(string),
+			User:   burned["User"].(string),
+			Time:   burned["Time"].(string),
+			Rotate: burned["Rotate"].(bool),
+		})
+	}
+
+	if len(t.Burned) > 0 {
+		logger.Info(fmt.Sprintf("Loaded %v burned hosts", len(t.Burned)))
+	}
+}
+
+// InfraBurnedHosts
+// returns a list of every burned domain/ip.
+func (t *Teamserver) InfraBurnedHosts() []string {
+	var Hosts []string
+
+	t.BurnedMtx.Lock()
+	defer t.BurnedMtx.Unlock()
+
+	for _, burned := range t.Burned {
+		Hosts = append(Hosts, burned.Host)
+	}
+
+	return Hosts
+}
+
+// InfraList
+// returns every burned host as a map so it can be sent to the client.
+func (t *Teamserver) InfraList() []map[string]any {
+	var List []map[string]any
+
+	t.BurnedMtx.Lock()
+	defer t.BurnedMtx.Unlock()
+
+	for _, burned := range t.Burned {
+		List = append(List, map[string]any{
+			"Host":   burned.Host,
+			"Reason": burned.Reason,
+			"User":   burned.User,
+			"Time":   burned.Time,
+			"Rotate": burned.Rotate,
+		})
+	}
+
+	return List
+}
+
+// HostBurned
+// checks if the host has been burned and agents should be
+// forced to rotate away from it. Callbacks over such a host are rejected,
+// except of agents that still have to fetch their switch to other hosts.
+func (t *Teamserver) HostBurned(Host string, AgentID int) bool {
+	var Rotate = false
+
+	Host = infraHost(Host)
+	if len(Host) == 0 {
+		return false
+	}
+
+	t.BurnedMtx.Lock()
+	for _, burned := range t.Burned {
+		if burned.Host == Host {
+			Rotate = burned.Rotate
+			break
+		}
+	}
+	t.BurnedMtx.Unlock()
+
+	if Rotate && AgentID != 0 {
+		if Agent := t.AgentInstance(AgentID); Agent != nil && Agent.TransportSwitching() {
+			return false
+		}
+	}
+
+	return Rotate
+}
+
+// infraHosts
+// returns the hosts (as host:port) and Host headers of the http listener
+// serving the host the agents should switch to, without the burned ones.
+func (t *Teamserver) infraHosts(Host string) ([]string, []string) {
+	var (
+		Hosts       []string
+		HostHeaders []string
+		Burned      = t.InfraBurnedHosts()
+	)
+
+	for _, Listener := range t.Listeners {
+		var HTTP, ok = Listener.Config.(*handlers.HTTP)
+		if !ok {
+			continue
+		}
+
+		var Serves = false
+		for _, host := range HTTP.Config.Hosts {
+			if infraHost(host) == Host {
+				Serves = true
+				break
+			}
+		}
+
+		if !Serves {
+			continue
+		}
+
+		/* same port the payloads are built with */
+		var Port = HTTP.Config.PortConn
+		if len(Port) == 0 {
+			Port = HTTP.Config.PortBind
+		}
+
+	Hosts:
+		for i, host := range HTTP.Config.Hosts {
+			for _, burned := range Burned {
+				if infraHost(host) == burned {
+					continue Hosts
+				}
+			}
+
+			var Name, HostPort = host, Port
+			if Split := strings.Split(host, ":"); len(Split) > 1 {
+				Name, HostPort = Split[0], Split[1]
+			}
+
+			Hosts = append(Hosts, net.JoinHostPort(common.GetInterfaceIpv4Addr(Name), HostPort))
+			if i < len(HTTP.Config.HostHeaders) {
+				HostHeaders = append(HostHeaders, HTTP.Config.HostHeaders[i])
+			}
+		}
+
+		break
+	}
+
+	return Hosts, HostHeaders
+}
+
+// InfraBurn
+// marks a domain/ip as burned. New payloads won't embed the host anymore,
+// every session & payload that used it gets annotated and if Rotate is
+// set the sessions calling back over the host get told to switch to the
+// remaining hosts of their listener before the listeners refuse callbacks
+// over it.
+func (t *Teamserver) InfraBurn(User, Host, Reason string, Rotate bool) error {
+	var (
+		Time     = time.Now().Format("02/01/2006 15:04:05")
+		Note     string
+		Sessions []string
+		Payloads int64
+		Found    = false
+		err      error
+
+		Hosts       []string
+		HostHeaders []string
+	)
+
+	Host = infraHost(Host)
+	if len(Host) == 0 {
+		return errors.New("no host specified")
+	}
+
+	if err = t.DB.BurnedAdd(Host, Reason, User, Time, Rotate); err != nil {
+		return err
+	}
+
+	t.BurnedMtx.Lock()
+	for _, burned := range t.Burned {
+		if burned.Host == Host {
+			burned.Reason = Reason
+			burned.User = User
+			burned.Time = Time
+			burned.Rotate = Rotate
+			Found = true
+			break
+		}
+	}
+
+	if !Found {
+		t.Burned = append(t.Burned, &BurnedHost{
+			Host:   Host,
+			Reason: Reason,
+			User:   User,
+			Time:   Time,
+			Rotate: Rotate,
+		})
+	}
+	t.BurnedMtx.Unlock()
+
+	Note = fmt.Sprintf("%v burned by %v at %v", Host, User, Time)
+	if len(Reason) > 0 {
+		Note += " (" + Reason + ")"
+	}
+
+	if Rotate {
+		Hosts, HostHeaders = t.infraHosts(Host)
+	}
+
+	/* annotate every session that calls back over the host */
+	for _, Agent := range t.Agents.List() {
+		if Agent.Info == nil || infraHost(Agent.Info.CallbackHost) != Host {
+			continue
+		}
+
+		Agent.Info.Burned = Note
+		Sessions = append(Sessions, Agent.NameID)
+
+		var Message = map[string]string{
+			"Type":    "Error",
+			"Message": "Callback host has been burned: " + Note,
+		}
+
+		if Rotate {
+			if len(Hosts) > 0 && Agent.Active && Agent.Info.MagicValue == agent.DEMON_MAGIC_VALUE {
+				Agent.TransportHosts(Hosts, HostHeaders)
+				Message["Output"] = fmt.Sprintf("Callbacks over this host are rejected. The agent has been told to switch to %v", strings.Join(Hosts, ", "))
+			} else {
+				Message["Output"] = "Callbacks over this host are rejected and the listener has no other host to switch to. The agent is going to rotate to its next callback host."
+			}
+		}
+
+		t.AgentConsole(Agent.NameID, agent.HAVOC_CONSOLE_MESSAGE, Message)
+	}
+
+	/* annotate every payload that has been built with the host */
+	if Payloads, err = t.DB.PayloadAnnotate(Host, Note); err != nil {
+		logger.Error("Failed to annotate payloads: " + err.Error())
+	}
+
+	logger.Warn(fmt.Sprintf("Host %v has been burned by %v [sessions: %v, payloads: %v]", Host, User, len(Sessions), Payloads))
+
+	var pk = events.Infra.Burn(User, Host, Reason, Rotate, Sessions, Payloads)
+
+	t.EventAppend(pk)
+	t.EventBroadcast("", pk)
+
+	return nil
+}
+
+// InfraRestore
+// removes a host from the burned list.
+func (t *Teamserver) InfraRestore(User, Host string) error {
+	var Found = false
+
+	Host = infraHost(Host)
+
+	t.BurnedMtx.Lock()
+	for i, burned := range t.Burned {
+		if burned.Host == Host {
+			t.Burned = append(t.Burned[:i], t.Burned[i+1:]...)
+			Found = true
+			break
+		}
+	}
+	t.BurnedMtx.Unlock()
+
+	if !Found {
+		return errors.New("host " + Host + " is not burned")
+	}
+
+	if err := t.DB.BurnedRemove(Host); err != nil {
+		return err
+	}
+
+	for _, Agent := range t.Agents.List() {
+		if Agent.Info != nil && infraHost(Agent.Info.CallbackHost) == Host {
+			Agent.Info.Burned = ""
+		}
+	}
+
+	var pk = events.Infra.Restore(User, Host)
+
+	t.EventAppend(pk)
+	t.EventBroadcast("", pk)
+
+	return nil
+}
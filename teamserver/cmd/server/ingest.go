@@ -0,0 +1,391 @@
+package server
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math/rand"
+	"net"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+
+	"Havoc/pkg/agent"
+	"Havoc/pkg/db"
+	"Havoc/pkg/logger"
+	"Havoc/pkg/profile"
+	"Havoc/pkg/secrets"
+)
+
+const (
+	// max size of the body of an ingest request
+	INGEST_BODY_LIMIT = 1 << 20
+)
+
+// IngestHash
+// stores the hashes a relay tool on the teamserver host captured (eg:
+// the NetNTLMv2 hashes of responder or the lm:nt pairs ntlmrelayx dumped)
+// in the credential store of the workspace of the operator:
+//
+//	{"Tool": "responder", "Client": "10.0.0.5", "Hashes": [
+//	    {"Hash": "alice::CORP:1122334455667788:..."},
+//	    {"Hash": "aad3b435...:31d6cfe0...", "Username": "Administrator", "Domain": "WS01"}
+//	]}
+//
+// The user and domain of NetNTLM hashes are taken from the hash. Hashes
+// the store already has are skipped.
+func (t *Teamserver) IngestHash(ctx *gin.Context) {
+	var Request struct {
+		Tool   string
+		Client string
+		Hashes []struct {
+			Hash     string
+			Username string
+			Domain   string
+		}
+	}
+
+	User, ok := t.ingestAuthenticate(ctx)
+	if !ok {
+		return
+	}
+
+	if err := ingestDecode(ctx, &Request); err != nil {
+		ctx.JSON(http.StatusBadRequest, gin.H{"Error": err.Error()})
+		return
+	}
+
+	var (
+		Workspace   = t.UserWorkspace(User)
+		Known       = make(map[string]bool)
+		Credentials []db.Credential
+		Added       = []int{}
+		Skipped     = 0
+	)
+
+	if Request.Tool = strings.TrimSpace(Request.Tool); len(Request.Tool) == 0 {
+		Request.Tool = "relay"
+	}
+
+	for _, Credential := range t.Credentials(Workspace) {
+		Known[Credential.Hash] = true
+	}
+
+	/* parsed before any of them gets stored so a bad request adds nothing */
+	for i, Entry := range Request.Hashes {
+		var Username, Domain = Entry.Username, Entry.Domain
+
+		/* NetNTLM: user::domain:challenge:... */
+		if Fields := strings.SplitN(strings.TrimSpace(Entry.Hash), ":", 4); len(Fields) == 4 && len(Fields[1]) == 0 {
+			Username, Domain = Fields[0], Fields[2]
+		}
+
+		Hash, ok := secrets.HashParse(Username, Entry.Hash)
+		if !ok {
+			ctx.JSON(http.StatusBadRequest, gin.H{"Error": fmt.Sprintf("hash %v: unknown hash type", i)})
+			return
+		}
+
+		if Known[Hash.Hash] {
+			Skipped++
+			continue
+		}
+
+		Known[Hash.Hash] = true
+
+		var Credential = db.Credential{
+			Username:  Username,
+			Domain:    Domain,
+			Hash:      Hash.Hash,
+			Source:    Request.Tool + " " + Hash.Type.Name,
+			Workspace: Workspace,
+			User:      User,
+			Time:      time.Now().Format("02/01/2006 15:04:05"),
+		}
+
+		if len(Request.Client) > 0 {
+			Credential.Source += " from " + Request.Client
+		}
+
+		Credentials = append(Credentials, Credential)
+	}
+
+	for _, Credential := range Credentials {
+		ID, err := t.DB.CredentialAdd(Credential)
+		if err != nil {
+			logger.Error("Failed to add ingested credential: " + err.Error())
+			ctx.JSON(http.StatusInternalServerError, gin.H{"Error": err.Error()})
+			return
+		}
+
+		Credential.ID = ID
+		Added = append(Added, ID)
+
+		t.credentialPublish(Credential, "")
+	}
+
+	if len(Added) > 0 {
+		logger.Info(fmt.Sprintf("Ingested %v hashes of %v by %v (%v already known)", len(Added), Request.Tool, User, Skipped))
+
+		t.credentialsBroadcast()
+	}
+
+	ctx.JSON(http.StatusOK, gin.H{"Credentials": Added, "Skipped": Skipped})
+}
+
+// IngestSession
+// registers the session a relay tool on the teamserver host relayed (eg:
+// an smb session of ntlmrelayx kept open in its socks server) as session
+// of the workspace of the operator:
+//
+//	{"Tool": "ntlmrelayx", "Protocol": "smb", "Target": "10.0.0.20",
+//	 "Username": "alice", "Domain": "CORP", "Admin": true,
+//	 "Socks": "127.0.0.1:1080", "Client": "10.0.0.5"}
+//
+// Pushing the same session again keeps it alive and returns its id.
+// Relayed sessions can't be tasked, they are used through the socks
+// server of the tool.
+func (t *Teamserver) IngestSession(ctx *gin.Context) {
+	var Request struct {
+		Tool     string
+		Protocol string
+		Target   string
+		Username string
+		Domain   string
+		Admin    bool
+		Socks    string
+		Client   string
+	}
+
+	User, ok := t.ingestAuthenticate(ctx)
+	if !ok {
+		return
+	}
+
+	if err := ingestDecode(ctx, &Request); err != nil {
+		ctx.JSON(http.StatusBadRequest, gin.H{"Error": err.Error()})
+		return
+	}
+
+	Request.Protocol = strings.ToLower(strings.TrimSpace(Request.Protocol))
+	Request.Target = strings.TrimSpace(Request.Target)
+
+	if len(Request.Protocol) == 0 || len(Request.Target) == 0 || len(Request.Username) == 0 {
+		ctx.JSON(http.StatusBadRequest, gin.H{"Error": "protocol, target and username are required"})
+		return
+	}
+
+	if Request.Tool = strings.TrimSpace(Request.Tool); len(Request.Tool) == 0 {
+		Request.Tool = "relay"
+	}
+
+	var (
+		Workspace = t.UserWorkspace(User)
+		Account   = Request.Username
+		Session   *RelayedSession
+	)
+
+	if len(Request.Domain) > 0 {
+		Account = Request.Domain + "\\" + Request.Username
+	}
+
+	t.Relayed.Range(func(key, value any) bool {
+		var Relayed = value.(*RelayedSession)
+
+		if Relayed.Agent.Active && Relayed.Tool == Request.Tool && Relayed.Protocol == Request.Protocol && Relayed.Target == Request.Target &&
+			strings.EqualFold(Relayed.Agent.Info.Username, Account) && Relayed.Socks == Request.Socks && Relayed.Agent.Info.Workspace == Workspace {
+			Session = Relayed
+			return false
+		}
+
+		return true
+	})
+
+	if Session != nil {
+		Session.Agent.Info.Elevated = strconv.FormatBool(Request.Admin)
+		Session.Agent.Info.LastCallIn = time.Now().Format("02-01-2006 15:04:05")
+		t.AgentLastTimeCalled(Session.Agent.NameID, Session.Agent.Info.LastCallIn, 0, 0, 0, 0)
+
+		ctx.JSON(http.StatusOK, gin.H{"ID": Session.Agent.NameID})
+		return
+	}
+
+	Session = &RelayedSession{
+		Agent:    t.relayedAgent(Request.Target, Account, Request.Domain, Request.Admin),
+		Tool:     Request.Tool,
+		Protocol: Request.Protocol,
+		Target:   Request.Target,
+		Socks:    Request.Socks,
+		User:     User,
+	}
+
+	Session.Agent.Info.Workspace = Workspace
+	Session.Agent.Info.ProcessName = Request.Tool + " (" + Request.Protocol + ")"
+	Session.Agent.Info.ExternalIP = Request.Client
+	Session.Agent.Info.ProxyPath = Request.Socks
+
+	t.Relayed.Store(Session.Agent.NameID, Session)
+
+	/* like ssh sessions they aren't stored in the agent table as they can't be restored */
+	t.Agents.Add(Session.Agent)
+	t.AgentSendNotify(Session.Agent)
+
+	logger.Info(fmt.Sprintf("Relayed session %v: %v %v://%v pushed by %v (admin: %v, socks: %v)", Session.Agent.NameID, Account, Request.Protocol, Request.Target, User, Request.Admin, orNone(Request.Socks)))
+
+	t.AgentConsole(Session.Agent.NameID, agent.HAVOC_CONSOLE_MESSAGE, map[string]string{
+		"Type":    "Good",
+		"Message": fmt.Sprintf("%v relayed %v to %v://%v [admin: %v, socks: %v]", Request.Tool, Account, Request.Protocol, Request.Target, Request.Admin, orNone(Request.Socks)),
+	})
+
+	ctx.JSON(http.StatusOK, gin.H{"ID": Session.Agent.NameID})
+}
+
+// IngestSessionClose
+// marks the relayed session as dead once the tool lost it: {"ID": "..."}
+func (t *Teamserver) IngestSessionClose(ctx *gin.Context) {
+	var Request struct {
+		ID     string
+		Reason string
+	}
+
+	User, ok := t.ingestAuthenticate(ctx)
+	if !ok {
+		return
+	}
+
+	if err := ingestDecode(ctx, &Request); err != nil {
+		ctx.JSON(http.StatusBadRequest, gin.H{"Error": err.Error()})
+		return
+	}
+
+	Value, ok := t.Relayed.Load(Request.ID)
+	if !ok || !workspaceVisible(t.UserWorkspace(User), Value.(*RelayedSession).Agent.Info.Workspace) {
+		ctx.JSON(http.StatusNotFound, gin.H{"Error": "relayed session " + Request.ID + " not found"})
+		return
+	}
+
+	var Session = Value.(*RelayedSession)
+
+	if len(Request.Reason) == 0 {
+		Request.Reason = "relayed session closed"
+	}
+
+	t.Relayed.Delete(Request.ID)
+
+	Session.Agent.Active = false
+	Session.Agent.Reason = Request.Reason
+
+	logger.Info(fmt.Sprintf("Relayed session %v to %v closed by %v: %v", Request.ID, Session.Target, User, Request.Reason))
+
+	t.AgentConsole(Session.Agent.NameID, agent.HAVOC_CONSOLE_MESSAGE, map[string]string{
+		"Type":    "Info",
+		"Message": Session.Tool + ": " + Request.Reason,
+	})
+
+	t.EventAgentMark(Session.Agent.NameID, "Dead")
+
+	ctx.JSON(http.StatusOK, gin.H{"ID": Request.ID})
+}
+
+// RelayedInput
+// answers the operator tasking a relayed session. The session lives in
+// the relay tool, it gets used through the socks server of the tool.
+func (t *Teamserver) RelayedInput(Agent *agent.Agent) {
+	var Message = "Relayed sessions can't be tasked"
+
+	if Value, ok := t.Relayed.Load(Agent.NameID); ok {
+		var Session = Value.(*RelayedSession)
+
+		if len(Session.Socks) > 0 {
+			Message += fmt.Sprintf(", use the %v session through the socks server of %v at %v (eg: proxychains)", Session.Protocol, Session.Tool, Session.Socks)
+		} else {
+			Message += fmt.Sprintf(", the %v session is used from %v", Session.Protocol, Session.Tool)
+		}
+	}
+
+	t.AgentConsole(Agent.NameID, agent.HAVOC_CONSOLE_MESSAGE, map[string]string{
+		"Type":    "Error",
+		"Message": Message,
+	})
+}
+
+// relayedAgent
+// creates the session of the relayed connection.
+func (t *Teamserver) relayedAgent(Target, Account, Domain string, Admin bool) *agent.Agent {
+	var (
+		Agent = &agent.Agent{
+			Active:     true,
+			TaskedOnce: true,
+			Info:       new(agent.AgentInfo),
+		}
+		ID   uint32
+		Host = Target
+	)
+
+	for ID = rand.Uint32(); ID == 0 || t.AgentExist(int(ID)); ID = rand.Uint32() {
+	}
+
+	if Split, _, err := net.SplitHostPort(Target); err == nil {
+		Host = Split
+	}
+
+	Agent.NameID = fmt.Sprintf("%08x", ID)
+	Agent.Info.MagicValue = agent.RELAYED_MAGIC_VALUE
+	Agent.Info.Hostname = Host
+	Agent.Info.DomainName = Domain
+	Agent.Info.Username = Account
+	Agent.Info.Elevated = strconv.FormatBool(Admin)
+	Agent.Info.InternalIP = Host
+	Agent.Info.FirstCallIn = time.Now().Format("02/01/2006 15:04:05")
+	Agent.Info.LastCallIn = time.Now().Format("02-01-2006 15:04:05")
+
+	return Agent
+}
+
+// ingestAuthenticate
+// only accepts requests from the teamserver host (also behind a trusted
+// proxy) of operators authenticating using http basic auth. Observers
+// aren't allowed to push anything.
+func (t *Teamserver) ingestAuthenticate(ctx *gin.Context) (string, bool) {
+	Host, _, err := net.SplitHostPort(ctx.Request.RemoteAddr)
+	if err != nil || !ingestLoopback(Host) || !ingestLoopback(ctx.ClientIP()) {
+		logger.Warn("Ingest request from " + ctx.ClientIP() + " refused: only the teamserver host is allowed to use it")
+		ctx.AbortWithStatus(http.StatusForbidden)
+		return "", false
+	}
+
+	User, Password, ok := ctx.Request.BasicAuth()
+	if !ok || !t.graphqlAuthenticate(User, Password) {
+		logger.Debug("Ingest request with invalid credentials from " + ctx.ClientIP())
+		ctx.Header("WWW-Authenticate", `Basic realm="havoc"`)
+		ctx.AbortWithStatus(http.StatusUnauthorized)
+		return "", false
+	}
+
+	if t.Profile.UserRole(User) == profile.ROLE_OBSERVER {
+		logger.Warn("User " + User + " isn't allowed to use the ingest endpoints")
+		ctx.AbortWithStatus(http.StatusForbidden)
+		return "", false
+	}
+
+	return User, true
+}
+
+func ingestLoopback(Host string) bool {
+	var IP = net.ParseIP(Host)
+
+	return IP != nil && IP.IsLoopback()
+}
+
+func ingestDecode(ctx *gin.Context, Request any) error {
+	var Decoder = json.NewDecoder(http.MaxBytesReader(ctx.Writer, ctx.Request.Body, INGEST_BODY_LIMIT))
+
+	if err := Decoder.Decode(Request); err != nil {
+		return errors.New("invalid request: " + err.Error())
+	}
+
+	return nil
+}
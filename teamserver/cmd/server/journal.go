@@ -0,0 +1,501 @@
+package server
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/gob"
+	"fmt"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"Havoc/pkg/agent"
+	"Havoc/pkg/colors"
+	"Havoc/pkg/journal"
+	"Havoc/pkg/keyring"
+	"Havoc/pkg/logger"
+)
+
+// types of the journal records
+const (
+	JOURNAL_SESSION   = "session.new"
+	JOURNAL_KEY       = "session.key"
+	JOURNAL_QUEUED    = "task.queued"
+	JOURNAL_DELIVERED = "task.delivered"
+	JOURNAL_DROPPED   = "task.dropped"
+)
+
+// records after which the journal gets rewritten with the tasks still pending
+const JOURNAL_COMPACT = 1024
+
+// JournalTask
+// a task in the journal: the agent it is for and its request id.
+type JournalTask struct {
+	AgentID   string
+	RequestID uint32
+}
+
+// journalSession
+// what a new session needs to be restored if it didn't make it into the db.
+type journalSession struct {
+	Info   agent.AgentInfo
+	AESKey []byte
+	AESIv  []byte
+}
+
+// journalEncode
+// encodes the data of a record.
+func journalEncode(Value any) ([]byte, error) {
+	var Data bytes.Buffer
+
+	if err := gob.NewEncoder(&Data).Encode(Value); err != nil {
+		return nil, err
+	}
+
+	return Data.Bytes(), nil
+}
+
+// journalDecode
+// decodes the data of a record.
+func journalDecode(Data []byte, Value any) error {
+	return gob.NewDecoder(bytes.NewReader(Data)).Decode(Value)
+}
+
+// journalDigest
+// tells the keys of an agent apart without keeping them in the clear.
+func journalDigest(AESKey, AESIv []byte) [sha256.Size]byte {
+	return sha256.Sum256(append(append([]byte(nil), AESKey...), AESIv...))
+}
+
+// JournalSetup
+// opens the journal next to the db and recovers what the last run
+// journaled but didn't get into the db before it stopped: sessions,
+// their keys and the tasks that weren't delivered to the agents.
+func (t *Teamserver) JournalSetup(DatabasePath string) {
+	var Path = strings.TrimSuffix(DatabasePath, filepath.Ext(DatabasePath)) + ".journal"
+
+	Log, Records, err := journal.Open(Path)
+	if err != nil {
+		logger.Error("Failed to open the journal " + Path + ": " + err.Error() + ". Sessions and queued tasks won't survive a crash")
+		return
+	}
+
+	t.Journal.Lock()
+	defer t.Journal.Unlock()
+
+	t.Journal.Log = Log
+	t.Journal.Pending = make(map[JournalTask]journal.Record)
+	t.Journal.Keys = make(map[string][sha256.Size]byte)
+
+	var (
+		Sessions = make(map[string]*journalSession)
+		Order    []string
+	)
+
+	for _, Record := range Records {
+		switch Record.Type {
+
+		case JOURNAL_SESSION:
+			var Session = new(journalSession)
+
+			err = journalDecode(Record.Data, Session)
+			keyring.Wipe(Record.Data)
+
+			if err != nil {
+				logger.Error("Failed to decode journaled session " + Record.AgentID + ": " + err.Error())
+				continue
+			}
+
+			if _, ok := Sessions[Record.AgentID]; !ok {
+				Order = append(Order, Record.AgentID)
+			}
+
+			Sessions[Record.AgentID] = Session
+
+		case JOURNAL_KEY:
+			var Session = new(journalSession)
+
+			err = journalDecode(Record.Data, Session)
+			keyring.Wipe(Record.Data)
+
+			if err != nil {
+				logger.Error("Failed to decode journaled key of " + Record.AgentID + ": " + err.Error())
+				continue
+			}
+
+			if Journaled, ok := Sessions[Record.AgentID]; ok {
+				keyring.Wipe(Journaled.AESKey, Journaled.AESIv)
+				Journaled.AESKey, Journaled.AESIv = Session.AESKey, Session.AESIv
+			} else {
+				Order = append(Order, Record.AgentID)
+				Sessions[Record.AgentID] = Session
+			}
+
+		case JOURNAL_QUEUED:
+			var Job agent.Job
+
+			if err = journalDecode(Record.Data, &Job); err != nil {
+				logger.Error("Failed to decode journaled task of " + Record.AgentID + ": " + err.Error())
+				continue
+			}
+
+			t.Journal.Pending[JournalTask{Record.AgentID, Job.RequestID}] = Record
+			t.Journal.Recovered = append(t.Journal.Recovered, Record)
+
+		case JOURNAL_DELIVERED, JOURNAL_DROPPED:
+			var Tasks []JournalTask
+
+			if err = journalDecode(Record.Data, &Tasks); err != nil {
+				logger.Error("Failed to decode journaled delivery: " + err.Error())
+				continue
+			}
+
+			for _, Task := range Tasks {
+				delete(t.Journal.Pending, Task)
+			}
+
+		}
+	}
+
+	for _, AgentID := range Order {
+		t.journalRestore(AgentID, Sessions[AgentID])
+	}
+
+	/* the sessions are in the db now. only the pending tasks are left to keep */
+	if err = t.journalCompact(); err != nil {
+		logger.Error("Failed to compact the journal: " + err.Error())
+	}
+}
+
+// journalRestore
+// writes a journaled session or key the db didn't get before the crash.
+func (t *Teamserver) journalRestore(AgentID string, Session *journalSession) {
+	var ID, err = strconv.ParseInt(AgentID, 16, 64)
+
+	/* the key is wrapped once it is restored */
+	defer keyring.Wipe(Session.AESKey, Session.AESIv)
+
+	if err != nil {
+		return
+	}
+
+	if Stored, err := t.DB.AgentGet(int(ID)); err == nil && Stored != nil {
+		defer Stored.Encryption.Destroy()
+
+		if Stored.Encryption.Equal(Session.AESKey, Session.AESIv) {
+			return
+		}
+
+		Stored.Encryption.Set(Session.AESKey, Session.AESIv)
+
+		if err = t.DB.AgentUpdate(Stored); err != nil {
+			logger.Error("Failed to restore the journaled key of agent " + AgentID + ": " + err.Error())
+			return
+		}
+
+		logger.Warn("Restored the key agent " + AgentID + " exchanged before the teamserver stopped")
+		return
+	}
+
+	/* a key of an agent the db doesn't know anything else of */
+	if len(Session.Info.FirstCallIn) == 0 {
+		return
+	}
+
+	var Agent = &agent.Agent{NameID: AgentID, Active: true, Info: &Session.Info}
+
+	Agent.Encryption.Set(Session.AESKey, Session.AESIv)
+	defer Agent.Encryption.Destroy()
+
+	if err = t.DB.AgentAdd(Agent); err != nil {
+		logger.Error("Failed to restore the journaled session " + AgentID + ": " + err.Error())
+		return
+	}
+
+	if err = t.DB.AgentWorkspaceSet(int(ID), workspaceOrDefault(Session.Info.Workspace)); err != nil {
+		logger.Error("Could not save agent workspace: " + err.Error())
+	}
+
+	t.AgentCapabilitiesSave(Agent)
+
+	logger.Warn(fmt.Sprintf("Restored session %v (%v\\%v @ %v) that registered before the teamserver stopped", AgentID, Session.Info.DomainName, Session.Info.Username, Session.Info.Hostname))
+}
+
+// JournalRequeue
+// queues the tasks the last run didn't deliver again, once the agents
+// are restored.
+func (t *Teamserver) JournalRequeue() {
+	var Count int
+
+	t.Journal.Lock()
+	var Recovered = t.Journal.Recovered
+	t.Journal.Recovered = nil
+	t.Journal.Unlock()
+
+	for _, Record := range Recovered {
+		var (
+			Job   agent.Job
+			Agent = t.Agents.Get(Record.AgentID)
+		)
+
+		if journalDecode(Record.Data, &Job) != nil {
+			continue
+		}
+
+		t.Journal.Lock()
+		_, Pending := t.Journal.Pending[JournalTask{Record.AgentID, Job.RequestID}]
+		t.Journal.Unlock()
+
+		if !Pending {
+			continue
+		}
+
+		if Agent == nil || !Agent.Active {
+			t.journalDrop([]JournalTask{{Record.AgentID, Job.RequestID}})
+			continue
+		}
+
+		Agent.AddJobToQueue(Job)
+		Count++
+	}
+
+	if Count > 0 {
+		logger.Info(fmt.Sprintf("Queued %v tasks again that weren't delivered before the teamserver stopped", colors.Green(Count)))
+	}
+}
+
+// journalAppend
+// writes the record and rewrites the journal every JOURNAL_COMPACT records.
+// Needs the lock of the journal.
+func (t *Teamserver) journalAppend(Record journal.Record) {
+	if err := t.Journal.Log.Append(Record); err != nil {
+		logger.Error("Failed to write the journal: " + err.Error())
+		return
+	}
+
+	if t.Journal.Written++; t.Journal.Written >= JOURNAL_COMPACT {
+		if err := t.journalCompact(); err != nil {
+			logger.Error("Failed to compact the journal: " + err.Error())
+		}
+	}
+}
+
+// journalCompact
+// rewrites the journal with the tasks still pending. Needs the lock of
+// the journal.
+func (t *Teamserver) journalCompact() error {
+	var Records []journal.Record
+
+	for _, Record := range t.Journal.Pending {
+		Records = append(Records, Record)
+	}
+
+	/* in the order the tasks got queued */
+	sort.Slice(Records, func(i, j int) bool {
+		return Records[i].Time < Records[j].Time
+	})
+
+	t.Journal.Written = 0
+
+	return t.Journal.Log.Rewrite(Records)
+}
+
+// journaled
+// returns true if the state of the agent goes to the journal.
+func (t *Teamserver) journaled(Agent *agent.Agent) bool {
+	if Agent == nil || t.Journal.Log == nil {
+		return false
+	}
+
+	/* synthetic agents of the demo mode aren't stored */
+	_, Demo := t.Demo.Load(Agent.NameID)
+
+	return !Demo
+}
+
+// journalSession
+// journals a new session before it goes to the db.
+func (t *Teamserver) journalSession(Agent *agent.Agent) {
+	if !t.journaled(Agent) || Agent.Info == nil {
+		return
+	}
+
+	var Session = journalSession{Info: *Agent.Info}
+
+	Session.AESKey, Session.AESIv = Agent.Encryption.Keys()
+	defer keyring.Wipe(Session.AESKey, Session.AESIv)
+
+	/* the listener is running again after a restart */
+	Session.Info.Listener = nil
+
+	Data, err := journalEncode(Session)
+	if err != nil {
+		logger.Error("Failed to journal session " + Agent.NameID + ": " + err.Error())
+		return
+	}
+	defer keyring.Wipe(Data)
+
+	t.Journal.Lock()
+	defer t.Journal.Unlock()
+
+	t.Journal.Keys[Agent.NameID] = journalDigest(Session.AESKey, Session.AESIv)
+
+	t.journalAppend(journal.Record{Type: JOURNAL_SESSION, AgentID: Agent.NameID, Data: Data})
+}
+
+// journalKey
+// journals the key of the agent before it goes to the db, if it
+// exchanged a new one. Restored is set for the agents of the db.
+func (t *Teamserver) journalKey(Agent *agent.Agent, Restored bool) {
+	if !t.journaled(Agent) {
+		return
+	}
+
+	var AESKey, AESIv = Agent.Encryption.Keys()
+	defer keyring.Wipe(AESKey, AESIv)
+
+	/* the key got wiped once the agent died. the db keeps it */
+	if len(AESKey) == 0 {
+		return
+	}
+
+	var Digest = journalDigest(AESKey, AESIv)
+
+	t.Journal.Lock()
+	defer t.Journal.Unlock()
+
+	/* the key the db has. nothing to journal until it changes */
+	Key, ok := t.Journal.Keys[Agent.NameID]
+	if Restored || !ok {
+		t.Journal.Keys[Agent.NameID] = Digest
+		return
+	}
+
+	if Key == Digest {
+		return
+	}
+
+	Data, err := journalEncode(journalSession{AESKey: AESKey, AESIv: AESIv})
+	if err != nil {
+		logger.Error("Failed to journal key of " + Agent.NameID + ": " + err.Error())
+		return
+	}
+	defer keyring.Wipe(Data)
+
+	t.Journal.Keys[Agent.NameID] = Digest
+
+	t.journalAppend(journal.Record{Type: JOURNAL_KEY, AgentID: Agent.NameID, Data: Data})
+}
+
+// taskEnqueue
+// journals the task of the operator and queues it. Jobs without a task
+// id (socks, probes, memory files) aren't worth recovering.
+func (t *Teamserver) taskEnqueue(Agent *agent.Agent, Job agent.Job) {
+	if len(Job.TaskID) > 0 && t.journaled(Agent) {
+		if Data, err := journalEncode(Job); err != nil {
+			logger.Error("Failed to journal task " + Job.TaskID + ": " + err.Error())
+		} else {
+			var Record = journal.Record{Type: JOURNAL_QUEUED, AgentID: Agent.NameID, Time: time.Now().UnixNano(), Data: Data}
+
+			t.Journal.Lock()
+			t.Journal.Pending[JournalTask{Agent.NameID, Job.RequestID}] = Record
+			t.journalAppend(Record)
+			t.Journal.Unlock()
+		}
+	}
+
+	Agent.AddJobToQueue(Job)
+}
+
+// TasksDelivered
+// journals the delivery of the jobs, before they leave the teamserver,
+// so a crash doesn't deliver them twice.
+func (t *Teamserver) TasksDelivered(Agent *agent.Agent, Jobs []agent.Job) {
+	var Delivered []JournalTask
+
+	if t.Journal.Log == nil {
+		return
+	}
+
+	t.Journal.Lock()
+	defer t.Journal.Unlock()
+
+	for _, Job := range Jobs {
+		var Task = JournalTask{Agent.NameID, Job.RequestID}
+
+		/* jobs of links travel inside pivot jobs of their parent */
+		if len(Job.Carried.AgentID) > 0 {
+			Task = JournalTask{Job.Carried.AgentID, Job.Carried.RequestID}
+		}
+
+		if _, ok := t.Journal.Pending[Task]; ok {
+			delete(t.Journal.Pending, Task)
+			Delivered = append(Delivered, Task)
+		}
+	}
+
+	if len(Delivered) == 0 {
+		return
+	}
+
+	Data, err := journalEncode(Delivered)
+	if err != nil {
+		logger.Error("Failed to journal delivered tasks: " + err.Error())
+		return
+	}
+
+	t.journalAppend(journal.Record{Type: JOURNAL_DELIVERED, Data: Data})
+}
+
+// journalCleared
+// drops the pending tasks of the agent that aren't in its queue anymore
+// (task clear), so a crash doesn't bring them back.
+func (t *Teamserver) journalCleared(Agent *agent.Agent) {
+	var (
+		Queued  = make(map[uint32]bool)
+		Cleared []JournalTask
+	)
+
+	if !t.journaled(Agent) {
+		return
+	}
+
+	for _, Job := range Agent.JobQueue {
+		Queued[Job.RequestID] = true
+	}
+
+	t.Journal.Lock()
+	for Task := range t.Journal.Pending {
+		if Task.AgentID == Agent.NameID && !Queued[Task.RequestID] {
+			Cleared = append(Cleared, Task)
+		}
+	}
+	t.Journal.Unlock()
+
+	t.journalDrop(Cleared)
+}
+
+// journalDrop
+// drops the pending tasks from the journal.
+func (t *Teamserver) journalDrop(Tasks []JournalTask) {
+	if len(Tasks) == 0 || t.Journal.Log == nil {
+		return
+	}
+
+	Data, err := journalEncode(Tasks)
+	if err != nil {
+		logger.Error("Failed to journal dropped tasks: " + err.Error())
+		return
+	}
+
+	t.Journal.Lock()
+	defer t.Journal.Unlock()
+
+	for _, Task := range Tasks {
+		delete(t.Journal.Pending, Task)
+	}
+
+	t.journalAppend(journal.Record{Type: JOURNAL_DROPPED, Data: Data})
+}
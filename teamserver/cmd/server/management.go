@@ -0,0 +1,209 @@
+package server
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"net"
+	"net/http"
+	"os"
+	"strconv"
+	"time"
+
+	"Havoc/pkg/colors"
+	"Havoc/pkg/common/certs"
+	"Havoc/pkg/logger"
+
+	"github.com/gin-gonic/gin"
+)
+
+// permissions of the unix socket of the operator api
+const MANAGEMENT_SOCKET_MODE = 0660
+
+// ManagementSplit
+// tells if the operator api is served apart from the agent facing port of
+// the teamserver (Teamserver { Management { ... } }).
+func (t *Teamserver) ManagementSplit() bool {
+	return t.Profile.Config.Server != nil && t.Profile.Config.Server.Management != nil
+}
+
+// ManagementPublic
+// the handler of the public port of the teamserver once the operator api is
+// split off: only the endpoints of the external listeners.
+func (t *Teamserver) ManagementPublic() http.Handler {
+	var Engine = gin.New()
+
+	Engine.Use(t.requestRecovery)
+	Engine.POST("/:endpoint", t.EndpointRequest)
+
+	return Engine
+}
+
+// ManagementStart
+// serves the operator api (websocket, service, graphql, panel, ...) on the
+// management address and/or unix socket. The address has its own
+// certificate and can require client certificates of the operators.
+// Returns the urls of the websocket, the socket comes first if both are set.
+func (t *Teamserver) ManagementStart() []string {
+	var (
+		Config = t.Profile.Config.Server.Management
+		Urls   []string
+	)
+
+	if len(Config.Host) == 0 && len(Config.Socket) == 0 {
+		logger.Error("Management needs a Host and Port or a Socket")
+		os.Exit(0)
+	}
+
+	var Host = Config.Host
+	if len(Host) == 0 {
+		Host = "localhost"
+	}
+
+	TLSConfig, err := t.managementTLS(Host)
+	if err != nil {
+		logger.Error("Failed to set up the tls of the operator api: " + err.Error())
+		os.Exit(0)
+	}
+
+	/* tls on the socket too: a forward of it (eg: ssh -L 40056:/run/havoc.sock) works with the usual clients */
+	if len(Config.Socket) > 0 {
+		Listener, err := t.managementSocket(Config.Socket)
+		if err != nil {
+			logger.Error("Failed to listen on the management socket: " + err.Error())
+			os.Exit(0)
+		}
+
+		var Url = "wss+unix://" + Config.Socket
+
+		logger.Info("Starting Teamserver on " + colors.BlueUnderline(Url+t.ProxyPath("/havoc/")))
+
+		Urls = append(Urls, Url)
+
+		go t.managementServe(tls.NewListener(Listener, TLSConfig))
+	}
+
+	if len(Config.Host) > 0 {
+		var Address = net.JoinHostPort(Config.Host, strconv.Itoa(Config.Port))
+
+		if Config.Port == 0 {
+			logger.Error("Management needs the Port of its Host")
+			os.Exit(0)
+		}
+
+		Listener, err := net.Listen("tcp", Address)
+		if err != nil {
+			logger.Error("Failed to listen on the management address: " + err.Error())
+			os.Exit(0)
+		}
+
+		if ip := net.ParseIP(Config.Host); ip == nil || !ip.IsLoopback() {
+			logger.Warn("The operator api listens on " + Address + ", not on the loopback")
+		}
+
+		var Url = "wss://" + Address
+
+		logger.Info("Starting Teamserver on " + colors.BlueUnderline(Url+t.ProxyPath("/havoc/")))
+
+		Urls = append(Urls, Url)
+
+		go t.managementServe(tls.NewListener(Listener, TLSConfig))
+	}
+
+	logger.Info("Agent facing port on " + colors.BlueUnderline(t.Flags.Server.Host+":"+t.Flags.Server.Port) + " only serves the external listeners")
+
+	return Urls
+}
+
+// managementServe
+// serves the operator api. the teamserver stops if it fails.
+func (t *Teamserver) managementServe(Listener net.Listener) {
+	var Server = &http.Server{Handler: t.Server.Engine, ReadHeaderTimeout: 30 * time.Second}
+
+	if err := Server.Serve(Listener); err != nil {
+		logger.Error("Failed to serve the operator api: " + err.Error())
+	}
+
+	os.Exit(0)
+}
+
+// managementSocket
+// listens on the unix socket, replacing the one a previous run left behind.
+func (t *Teamserver) managementSocket(Path string) (net.Listener, error) {
+	if Info, err := os.Lstat(Path); err == nil {
+		if Info.Mode()&os.ModeSocket == 0 {
+			return nil, errors.New(Path + " exists and isn't a socket")
+		}
+
+		if err = os.Remove(Path); err != nil {
+			return nil, err
+		}
+	}
+
+	Listener, err := net.Listen("unix", Path)
+	if err != nil {
+		return nil, err
+	}
+
+	if err = os.Chmod(Path, MANAGEMENT_SOCKET_MODE); err != nil {
+		Listener.Close()
+		return nil, err
+	}
+
+	return Listener, nil
+}
+
+// managementTLS
+// the certificate of the management address (its own, the one of the
+// teamserver or a generated one) and the authorities of the client
+// certificates if the operators need one.
+func (t *Teamserver) managementTLS(Host string) (*tls.Config, error) {
+	var (
+		Config  = t.Profile.Config.Server.Management
+		Cert    = Config.Cert
+		KeyPair tls.Certificate
+		err     error
+	)
+
+	if Cert == nil {
+		Cert = t.Profile.Config.Server.Cert
+	}
+
+	if Cert != nil {
+		KeyPair, err = certs.KeyPair(Cert.Cert, Cert.Key)
+	} else {
+		var CertPEM, KeyPEM []byte
+
+		if CertPEM, KeyPEM, err = certs.HTTPSGenerateRSACertificate(Host); err == nil {
+			KeyPair, err = tls.X509KeyPair(CertPEM, KeyPEM)
+		}
+	}
+
+	if err != nil {
+		return nil, err
+	}
+
+	var TLSConfig = &tls.Config{Certificates: []tls.Certificate{KeyPair}, MinVersion: tls.VersionTLS12}
+
+	if len(Config.ClientCA) > 0 {
+		var (
+			Pool    = x509.NewCertPool()
+			Content = []byte(Config.ClientCA)
+		)
+
+		if !certs.IsPEM(Config.ClientCA) {
+			if Content, err = os.ReadFile(Config.ClientCA); err != nil {
+				return nil, err
+			}
+		}
+
+		if !Pool.AppendCertsFromPEM(Content) {
+			return nil, errors.New("no certificate in ClientCA")
+		}
+
+		TLSConfig.ClientCAs = Pool
+		TLSConfig.ClientAuth = tls.RequireAndVerifyClientCert
+	}
+
+	return TLSConfig, nil
+}
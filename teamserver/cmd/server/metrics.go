@@ -0,0 +1,108 @@
+package server
+
+import (
+	"fmt"
+	"net/http"
+	"runtime"
+	"sort"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+
+	"Havoc/pkg/budget"
+	"Havoc/pkg/profile"
+)
+
+// Metrics
+// serves the resource usage of the teamserver and the budgets of its
+// subsystems in the prometheus text format.
+func (t *Teamserver) Metrics(ctx *gin.Context) {
+	var (
+		Metrics  strings.Builder
+		Memory   runtime.MemStats
+		Names    []string
+		Sessions int
+	)
+
+	if _, ok := t.adminAuthenticate(ctx, "metrics"); !ok {
+		return
+	}
+
+	runtime.ReadMemStats(&Memory)
+
+	t.Clients.Range(func(key, value any) bool {
+		Sessions++
+		return true
+	})
+
+	for Name := range t.Budgets {
+		Names = append(Names, Name)
+	}
+
+	sort.Strings(Names)
+
+	Metrics.WriteString("# HELP havoc_goroutines goroutines of the teamserver\n")
+	Metrics.WriteString("# TYPE havoc_goroutines gauge\n")
+	Metrics.WriteString(fmt.Sprintf("havoc_goroutines %v\n", runtime.NumGoroutine()))
+
+	Metrics.WriteString("# HELP havoc_memory_bytes heap memory in use by the teamserver\n")
+	Metrics.WriteString("# TYPE havoc_memory_bytes gauge\n")
+	Metrics.WriteString(fmt.Sprintf("havoc_memory_bytes %v\n", Memory.HeapAlloc))
+
+	Metrics.WriteString("# HELP havoc_clients connected clients\n")
+	Metrics.WriteString("# TYPE havoc_clients gauge\n")
+	Metrics.WriteString(fmt.Sprintf("havoc_clients %v\n", Sessions))
+
+	Metrics.WriteString("# HELP havoc_budget_usage resources a subsystem currently uses\n")
+	Metrics.WriteString("# TYPE havoc_budget_usage gauge\n")
+	t.metricsBudget(&Metrics, Names, "havoc_budget_usage", (*budget.Budget).Usage)
+
+	Metrics.WriteString("# HELP havoc_budget_limit hard cap of the resources of a subsystem (0 is unlimited)\n")
+	Metrics.WriteString("# TYPE havoc_budget_limit gauge\n")
+	t.metricsBudget(&Metrics, Names, "havoc_budget_limit", (*budget.Budget).Limit)
+
+	Metrics.WriteString("# HELP havoc_budget_refused_total requests refused by the hard cap of a subsystem\n")
+	Metrics.WriteString("# TYPE havoc_budget_refused_total counter\n")
+	t.metricsBudget(&Metrics, Names, "havoc_budget_refused_total", (*budget.Budget).Refused)
+
+	Metrics.WriteString("# HELP havoc_task_failures_total failed tasks by the kind of the failure and the command\n")
+	Metrics.WriteString("# TYPE havoc_task_failures_total counter\n")
+	t.metricsFailures(&Metrics)
+
+	ctx.Data(http.StatusOK, "text/plain; version=0.0.4", []byte(Metrics.String()))
+}
+
+func (t *Teamserver) metricsBudget(Metrics *strings.Builder, Names []string, Metric string, Value func(*budget.Budget, budget.Resource) int64) {
+	for _, Name := range Names {
+		for _, Resource := range budget.Resources {
+			Metrics.WriteString(fmt.Sprintf("%v{subsystem=%q,resource=%q} %v\n", Metric, Name, Resource.String(), Value(t.Budgets[Name], Resource)))
+		}
+	}
+}
+
+// metricsFailures
+// sums the failures of every workspace by their kind and command.
+func (t *Teamserver) metricsFailures(Metrics *strings.Builder) {
+	var (
+		Totals = make(map[[2]string]int64)
+		Keys   [][2]string
+	)
+
+	for _, Failure := range t.FailureList(profile.WORKSPACE_ALL) {
+		var Key = [2]string{Failure.Code, Failure.Command}
+
+		if _, ok := Totals[Key]; !ok {
+			Keys = append(Keys, Key)
+		}
+
+		Totals[Key] += Failure.Count
+	}
+
+	sort.Slice(Keys, func(i, j int) bool {
+		return Keys[i][0] < Keys[j][0] || (Keys[i][0] == Keys[j][0] && Keys[i][1] < Keys[j][1])
+	})
+
+	for _, Key := range Keys {
+		Metrics.WriteString(fmt.Sprintf("havoc_task_failures_total{code=%q,command=%q} %v\n", Key[0], Key[1], Totals[Key]))
+	}
+}
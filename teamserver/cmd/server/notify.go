@@ -0,0 +1,581 @@
+package server
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"Havoc/pkg/common"
+	"Havoc/pkg/db"
+	"Havoc/pkg/eventbus"
+	"Havoc/pkg/events"
+	"Havoc/pkg/logger"
+	"Havoc/pkg/profile"
+)
+
+const (
+	// how often held back notifications get delivered and the kill dates checked
+	NOTIFY_TICK = 30 * time.Second
+	// how long before its kill date an agent raises a notification
+	NOTIFY_KILLDATE = 24 * time.Hour
+	// notifications held back for an operator before the oldest get dropped
+	NOTIFY_PENDING = 500
+	// shortest interval of a digest
+	NOTIFY_DIGEST_MIN = time.Minute
+)
+
+// events that reach the operators right away, whatever their preferences
+var notifyCritical = map[string]bool{
+	eventbus.LISTENER_DOWN:     true,
+	eventbus.KILLDATE_IMMINENT: true,
+}
+
+// NotifyAlert
+// an event of the teamserver as the operators get notified of it.
+type NotifyAlert struct {
+	Type      string
+	Time      string
+	Workspace string
+	Critical  bool
+	Summary   string
+	Data      map[string]any
+}
+
+// NotifyPreferences
+// what an operator wants to be notified of and when. Notifications that
+// aren't critical are held back while Digest is set or during the quiet
+// hours and delivered together.
+type NotifyPreferences struct {
+	User string
+	// event types the operator isn't notified of
+	Muted []string
+	// interval of the digest (eg: 1h). notified right away if empty
+	Digest string
+	// hh:mm-hh:mm, may wrap around midnight (22:00-07:00)
+	QuietHours string
+	// time zone of the quiet hours. local time of the teamserver if empty
+	TimeZone string
+	// agent groups the operator is notified of the agents of. every agent if empty
+	Groups []string
+
+	muted    map[string]bool
+	digest   time.Duration
+	quiet    []int
+	location *time.Location
+}
+
+// notifyQueue
+// notifications held back for an operator.
+type notifyQueue struct {
+	Alerts  []NotifyAlert
+	Dropped int
+	// last digest sent
+	Last time.Time
+}
+
+// NotifySetup
+// loads the notification preferences of the operators and starts
+// notifying them of the events of the teamserver.
+func (t *Teamserver) NotifySetup() {
+	t.Notify.Preferences = make(map[string]*NotifyPreferences)
+	t.Notify.Queues = make(map[string]*notifyQueue)
+	t.Notify.KillDates = make(map[string]int64)
+
+	for _, Stored := range t.DB.NotifyPreferences() {
+		Preferences, err := notifyPreferences(Stored)
+		if err != nil {
+			logger.Error(fmt.Sprintf("Failed to load the notification preferences of %v: %v", Stored.User, err))
+			continue
+		}
+
+		t.Notify.Preferences[Stored.User] = Preferences
+	}
+
+	t.Bus.Subscribe("notifications", eventbus.ConsumerFunc(t.notify), eventbus.Types...)
+
+	go t.Supervise("notifications", func() {
+		var Ticker = time.NewTicker(NOTIFY_TICK)
+		defer Ticker.Stop()
+
+		for Now := range Ticker.C {
+			t.notifyKillDates(Now)
+			t.notifyFlush(Now)
+		}
+	})
+}
+
+// notifyPreferences
+// parses the stored preferences of an operator.
+func notifyPreferences(Stored db.NotifyPreferences) (*NotifyPreferences, error) {
+	var (
+		Preferences = &NotifyPreferences{
+			User:       Stored.User,
+			Digest:     Stored.Digest,
+			QuietHours: Stored.QuietHours,
+			TimeZone:   Stored.TimeZone,
+			muted:      make(map[string]bool),
+			location:   time.Local,
+		}
+		err error
+	)
+
+	if len(Stored.Muted) > 0 {
+		if err = json.Unmarshal([]byte(Stored.Muted), &Preferences.Muted); err != nil {
+			return nil, errors.New("invalid muted events: " + err.Error())
+		}
+	}
+
+	for _, Type := range Preferences.Muted {
+		if notifyCritical[Type] {
+			return nil, fmt.Errorf("%v is critical and can't be muted", Type)
+		}
+
+		if !notifyType(Type) {
+			return nil, fmt.Errorf("unknown event %v", Type)
+		}
+
+		Preferences.muted[Type] = true
+	}
+
+	if len(Stored.Groups) > 0 {
+		if err = json.Unmarshal([]byte(Stored.Groups), &Preferences.Groups); err != nil {
+			return nil, errors.New("invalid groups: " + err.Error())
+		}
+	}
+
+	if len(Preferences.Digest) > 0 {
+		if Preferences.digest, err = time.ParseDuration(Preferences.Digest); err != nil || Preferences.digest < NOTIFY_DIGEST_MIN {
+			return nil, fmt.Errorf("invalid digest interval %v. use a duration of at least %v (eg: 1h)", Preferences.Digest, NOTIFY_DIGEST_MIN)
+		}
+	}
+
+	if len(Preferences.QuietHours) > 0 {
+		if Preferences.quiet, err = notifyHours(Preferences.QuietHours); err != nil {
+			return nil, err
+		}
+	}
+
+	if len(Preferences.TimeZone) > 0 {
+		if Preferences.location, err = time.LoadLocation(Preferences.TimeZone); err != nil {
+			return nil, fmt.Errorf("unknown time zone %v", Preferences.TimeZone)
+		}
+	}
+
+	return Preferences, nil
+}
+
+func notifyType(Type string) bool {
+	for _, Known := range eventbus.Types {
+		if Known == Type {
+			return true
+		}
+	}
+
+	return false
+}
+
+// notifyHours
+// parses hh:mm-hh:mm into the minutes of the day it starts and ends at.
+func notifyHours(Hours string) ([]int, error) {
+	var Minutes []int
+
+	for _, Time := range strings.Split(Hours, "-") {
+		Parsed, err := time.Parse("15:04", strings.TrimSpace(Time))
+		if err != nil {
+			return nil, fmt.Errorf("invalid quiet hours %v. use hh:mm-hh:mm (eg: 22:00-07:00)", Hours)
+		}
+
+		Minutes = append(Minutes, Parsed.Hour()*60+Parsed.Minute())
+	}
+
+	if len(Minutes) != 2 || Minutes[0] == Minutes[1] {
+		return nil, fmt.Errorf("invalid quiet hours %v. use hh:mm-hh:mm (eg: 22:00-07:00)", Hours)
+	}
+
+	return Minutes, nil
+}
+
+// quietAt
+// returns true if the time is inside the quiet hours of the operator.
+func (p *NotifyPreferences) quietAt(Now time.Time) bool {
+	if p == nil || len(p.quiet) != 2 {
+		return false
+	}
+
+	Now = Now.In(p.location)
+
+	var Minute = Now.Hour()*60 + Now.Minute()
+
+	/* wraps around midnight */
+	if p.quiet[0] > p.quiet[1] {
+		return Minute >= p.quiet[0] || Minute < p.quiet[1]
+	}
+
+	return Minute >= p.quiet[0] && Minute < p.quiet[1]
+}
+
+// NotifyPreferencesOf
+// returns the notification preferences of the operator.
+func (t *Teamserver) NotifyPreferencesOf(User string) NotifyPreferences {
+	t.Notify.Lock()
+	defer t.Notify.Unlock()
+
+	if Preferences, ok := t.Notify.Preferences[User]; ok {
+		return *Preferences
+	}
+
+	return NotifyPreferences{User: User, Muted: []string{}, Groups: []string{}}
+}
+
+// NotifySet
+// stores the notification preferences the operator sent.
+func (t *Teamserver) NotifySet(User string, Info map[string]any) (NotifyPreferences, error) {
+	var (
+		Stored = db.NotifyPreferences{User: User, Time: time.Now().Format("02/01/2006 15:04:05")}
+		Muted  = []string{}
+		Groups = []string{}
+	)
+
+	if List, ok := Info["Muted"].([]any); ok {
+		for _, Type := range List {
+			if Type, ok := Type.(string); ok && len(Type) > 0 {
+				Muted = append(Muted, Type)
+			}
+		}
+	}
+
+	if List, ok := Info["Groups"].([]any); ok {
+		for _, Name := range List {
+			if Name, ok := Name.(string); ok && len(Name) > 0 {
+				if _, err := t.groupGet(t.UserWorkspace(User), Name); err != nil {
+					return NotifyPreferences{}, err
+				}
+
+				Groups = append(Groups, Name)
+			}
+		}
+	}
+
+	Encoded, _ := json.Marshal(Muted)
+	Stored.Muted = string(Encoded)
+
+	Encoded, _ = json.Marshal(Groups)
+	Stored.Groups = string(Encoded)
+
+	Stored.Digest, _ = Info["Digest"].(string)
+	Stored.QuietHours, _ = Info["QuietHours"].(string)
+	Stored.TimeZone, _ = Info["TimeZone"].(string)
+
+	Preferences, err := notifyPreferences(Stored)
+	if err != nil {
+		return NotifyPreferences{}, err
+	}
+
+	if err = t.DB.NotifyPreferencesSet(Stored); err != nil {
+		return NotifyPreferences{}, err
+	}
+
+	t.Notify.Lock()
+	t.Notify.Preferences[User] = Preferences
+	t.Notify.Unlock()
+
+	logger.Info(fmt.Sprintf("%v changed its notification preferences (muted: %v, digest: %v, quiet hours: %v, groups: %v)", User, Muted, orNone(Stored.Digest), orNone(Stored.QuietHours), Groups))
+
+	return *Preferences, nil
+}
+
+func orNone(Value string) string {
+	if len(Value) == 0 {
+		return "none"
+	}
+
+	return Value
+}
+
+// notify
+// notifies the connected operators that see the workspace of the event,
+// or holds the notification back for their digest.
+func (t *Teamserver) notify(Event eventbus.Event) error {
+	var (
+		Alert = NotifyAlert{
+			Type:      Event.Type,
+			Time:      Event.Time.Format("02/01/2006 15:04:05"),
+			Workspace: Event.Workspace,
+			Critical:  notifyCritical[Event.Type],
+			Summary:   notifySummary(Event),
+			Data:      Event.Data,
+		}
+		Users = make(map[string]bool)
+		Now   = time.Now()
+	)
+
+	t.Clients.Range(func(key, value any) bool {
+		var client = value.(*Client)
+
+		if client.Authenticated && client.Role != profile.ROLE_RELAY && workspaceVisible(t.UserWorkspace(client.Username), Event.Workspace) {
+			Users[client.Username] = true
+		}
+
+		return true
+	})
+
+	for User := range Users {
+		if !Alert.Critical && !t.notifyGroups(User, Event) {
+			continue
+		}
+
+		if t.notifyHold(User, Alert, Now) {
+			continue
+		}
+
+		t.SendEventToUser(User, events.Notify.Alert(Alert))
+	}
+
+	return nil
+}
+
+// notifyGroups
+// returns true if the event is about an agent of the groups the operator
+// wants to be notified of, or isn't about an agent at all.
+func (t *Teamserver) notifyGroups(User string, Event eventbus.Event) bool {
+	var Groups []string
+
+	t.Notify.Lock()
+	if Preferences := t.Notify.Preferences[User]; Preferences != nil {
+		Groups = Preferences.Groups
+	}
+	t.Notify.Unlock()
+
+	if len(Groups) == 0 {
+		return true
+	}
+
+	/* new sessions carry the id as NameID */
+	var AgentID, _ = Event.Data["AgentID"].(string)
+
+	if len(AgentID) == 0 {
+		AgentID, _ = Event.Data["NameID"].(string)
+	}
+
+	if len(AgentID) == 0 {
+		return true
+	}
+
+	return t.groupContains(t.UserWorkspace(User), Groups, AgentID)
+}
+
+// notifyHold
+// returns true if the operator doesn't get notified right away: it muted
+// the event or the notification waits for its digest.
+func (t *Teamserver) notifyHold(User string, Alert NotifyAlert, Now time.Time) bool {
+	if Alert.Critical {
+		return false
+	}
+
+	t.Notify.Lock()
+	defer t.Notify.Unlock()
+
+	var Preferences = t.Notify.Preferences[User]
+
+	if Preferences == nil {
+		return false
+	}
+
+	if Preferences.muted[Alert.Type] {
+		return true
+	}
+
+	if Preferences.digest == 0 && !Preferences.quietAt(Now) {
+		return false
+	}
+
+	var Queue = t.Notify.Queues[User]
+
+	if Queue == nil {
+		Queue = &notifyQueue{Last: Now}
+		t.Notify.Queues[User] = Queue
+	}
+
+	if len(Queue.Alerts) >= NOTIFY_PENDING {
+		Queue.Alerts = Queue.Alerts[1:]
+		Queue.Dropped++
+	}
+
+	Queue.Alerts = append(Queue.Alerts, Alert)
+
+	return true
+}
+
+// notifyFlush
+// sends the operators the notifications held back for them once their
+// digest is due and their quiet hours are over.
+func (t *Teamserver) notifyFlush(Now time.Time) {
+	type digest struct {
+		User    string
+		Alerts  []NotifyAlert
+		Dropped int
+	}
+
+	var Due []digest
+
+	t.Notify.Lock()
+	for User, Queue := range t.Notify.Queues {
+		var Preferences = t.Notify.Preferences[User]
+
+		if len(Queue.Alerts) == 0 || Preferences.quietAt(Now) {
+			continue
+		}
+
+		if Preferences != nil && Preferences.digest > 0 && Now.Sub(Queue.Last) < Preferences.digest {
+			continue
+		}
+
+		/* kept till the operator connects again */
+		if !t.userConnected(User) {
+			continue
+		}
+
+		Due = append(Due, digest{User: User, Alerts: Queue.Alerts, Dropped: Queue.Dropped})
+
+		Queue.Alerts = nil
+		Queue.Dropped = 0
+		Queue.Last = Now
+	}
+	t.Notify.Unlock()
+
+	for _, Digest := range Due {
+		t.SendEventToUser(Digest.User, events.Notify.Digest(Digest.Alerts, Digest.Dropped))
+	}
+}
+
+func (t *Teamserver) userConnected(User string) bool {
+	var Connected = false
+
+	t.Clients.Range(func(key, value any) bool {
+		var client = value.(*Client)
+
+		if client.Authenticated && client.Username == User {
+			Connected = true
+			return false
+		}
+
+		return true
+	})
+
+	return Connected
+}
+
+// notifyKillDates
+// raises a notification for the agents that reach their kill date
+// within NOTIFY_KILLDATE. once per agent and kill date.
+func (t *Teamserver) notifyKillDates(Now time.Time) {
+	for _, Agent := range t.Agents.List() {
+		if !Agent.Active || Agent.Info == nil || Agent.Info.KillDate == 0 {
+			continue
+		}
+
+		var (
+			KillDate  = time.Unix(common.SystemTimeToEpoch(Agent.Info.KillDate), 0)
+			Remaining = KillDate.Sub(Now)
+		)
+
+		if Remaining > NOTIFY_KILLDATE || Remaining < 0 {
+			continue
+		}
+
+		t.Notify.Lock()
+		var Notified = t.Notify.KillDates[Agent.NameID] == Agent.Info.KillDate
+		t.Notify.KillDates[Agent.NameID] = Agent.Info.KillDate
+		t.Notify.Unlock()
+
+		if Notified {
+			continue
+		}
+
+		t.EventPublish(eventbus.KILLDATE_IMMINENT, Agent.Info.Workspace, map[string]any{
+			"AgentID":   Agent.NameID,
+			"Hostname":  Agent.Info.Hostname,
+			"Username":  Agent.Info.Username,
+			"KillDate":  KillDate.UTC().Format("2006-01-02T15:04:05Z"),
+			"Remaining": Remaining.Round(time.Minute).String(),
+		})
+	}
+}
+
+// notifySummary
+// describes the event in a line for the operators.
+func notifySummary(Event eventbus.Event) string {
+	var Data = func(Key string) string {
+		if Value, ok := Event.Data[Key]; ok && Value != nil {
+			return fmt.Sprint(Value)
+		}
+
+		return ""
+	}
+
+	switch Event.Type {
+
+	case eventbus.SESSION_NEW:
+		var Info, _ = Event.Data["Info"].(map[string]any)
+
+		return fmt.Sprintf("new agent %v %v\\%v @ %v", Data("NameID"), Info["Domain"], Info["Username"], Info["Hostname"])
+
+	case eventbus.TASK_COMPLETE:
+		return fmt.Sprintf("agent %v completed task %v (%v)", Data("AgentID"), Data("TaskID"), Data("CommandLine"))
+
+	case eventbus.LOOT_ADDED:
+		var Summary = fmt.Sprintf("new %v %v", Data("Type"), Data("Name"))
+
+		if Data("Type") == "credential" {
+			Summary = fmt.Sprintf("new credential %v\\%v", Data("Domain"), Data("Username"))
+		}
+
+		if len(Data("AgentID")) > 0 {
+			Summary += " from agent " + Data("AgentID")
+		}
+
+		return Summary
+
+	case eventbus.CREDENTIAL_FOUND:
+		var Summary = "secrets found in " + Data("Source")
+
+		if len(Data("Name")) > 0 {
+			Summary += " " + Data("Name")
+		}
+
+		if len(Data("AgentID")) > 0 {
+			Summary += " of agent " + Data("AgentID")
+		}
+
+		return Summary
+
+	case eventbus.LISTENER_DOWN:
+		return fmt.Sprintf("listener %v is down: %v", Data("Name"), Data("Error"))
+
+	case eventbus.LISTENER_EXPIRED:
+		if len(Data("AgentID")) > 0 {
+			return fmt.Sprintf("listener %v stopped after agent %v (%v) called back", Data("Name"), Data("AgentID"), Data("Hostname"))
+		}
+		return fmt.Sprintf("listener %v stopped after its time to live of %v", Data("Name"), Data("Lifetime"))
+
+	case eventbus.CERTIFICATE_LOGGED:
+		if len(Data("Listeners")) > 0 {
+			return fmt.Sprintf("certificate for %v got logged, it covers listener %v", Data("Names"), Data("Listeners"))
+		}
+		return fmt.Sprintf("certificate for %v got logged by %v", Data("Names"), Data("Issuer"))
+
+	case eventbus.KILLDATE_IMMINENT:
+		return fmt.Sprintf("agent %v (%v) reaches its kill date in %v", Data("AgentID"), Data("Hostname"), Data("Remaining"))
+
+	case eventbus.NETWORK_NEW:
+		return fmt.Sprintf("first agent on %v: %v %v\\%v @ %v", Data("Network"), Data("AgentID"), Data("Domain"), Data("Username"), Data("Hostname"))
+
+	case eventbus.TEAMSERVER_ERROR:
+		return fmt.Sprintf("teamserver error in %v: %v", Data("Source"), Data("Error"))
+
+	}
+
+	return Event.Type
+}
@@ -0,0 +1,111 @@
+package server
+
+import (
+	"Havoc/pkg/packager"
+)
+
+// observerAllowed
+// observers (white cell, trainers) receive every event in real time
+// but are only allowed to chat and to query read-only information.
+// anything that would task an agent or change the teamserver is dropped.
+func observerAllowed(pk packager.Package) bool {
+	switch pk.Head.Event {
+
+	case packager.Type.Chat.Type:
+		return pk.Body.SubEvent == packager.Type.Chat.NewMessage
+
+	case packager.Type.Infra.Type:
+		return pk.Body.SubEvent == packager.Type.Infra.List
+
+	case packager.Type.Bundle.Type:
+		return pk.Body.SubEvent == packager.Type.Bundle.Key
+
+	case packager.Type.Archive.Type:
+		return pk.Body.SubEvent == packager.Type.Archive.List
+
+	case packager.Type.Listener.Type:
+		return pk.Body.SubEvent == packager.Type.Listener.TemplateList
+
+	case packager.Type.Preset.Type:
+		return pk.Body.SubEvent == packager.Type.Preset.List
+
+	case packager.Type.Script.Type:
+		return pk.Body.SubEvent == packager.Type.Script.List
+
+	case packager.Type.Template.Type:
+		return pk.Body.SubEvent == packager.Type.Template.List
+
+	case packager.Type.Batch.Type:
+		return pk.Body.SubEvent == packager.Type.Batch.List || pk.Body.SubEvent == packager.Type.Batch.Result || pk.Body.SubEvent == packager.Type.Batch.Tags
+
+	case packager.Type.Schedule.Type:
+		return pk.Body.SubEvent == packager.Type.Schedule.List
+
+	case packager.Type.Group.Type:
+		return pk.Body.SubEvent == packager.Type.Group.List || pk.Body.SubEvent == packager.Type.Group.Members
+
+	case packager.Type.Spray.Type:
+		return pk.Body.SubEvent == packager.Type.Spray.List || pk.Body.SubEvent == packager.Type.Spray.Attempts || pk.Body.SubEvent == packager.Type.Spray.Protocols
+
+	case packager.Type.Pivot.Type:
+		return pk.Body.SubEvent == packager.Type.Pivot.List || pk.Body.SubEvent == packager.Type.Pivot.Streams
+
+	case packager.Type.Route.Type:
+		return pk.Body.SubEvent == packager.Type.Route.List
+
+	case packager.Type.Clipboard.Type:
+		return pk.Body.SubEvent == packager.Type.Clipboard.History
+
+	case packager.Type.Registry.Type:
+		return pk.Body.SubEvent == packager.Type.Registry.Records || pk.Body.SubEvent == packager.Type.Registry.Changes
+
+	case packager.Type.Services.Type:
+		return pk.Body.SubEvent == packager.Type.Services.List
+
+	case packager.Type.Files.Type:
+		return pk.Body.SubEvent == packager.Type.Files.Records
+
+	case packager.Type.Timeline.Type:
+		return pk.Body.SubEvent == packager.Type.Timeline.List
+
+	case packager.Type.Evidence.Type:
+		return pk.Body.SubEvent == packager.Type.Evidence.List || pk.Body.SubEvent == packager.Type.Evidence.Fetch
+
+	case packager.Type.Detection.Type:
+		return pk.Body.SubEvent == packager.Type.Detection.List || pk.Body.SubEvent == packager.Type.Detection.Coverage
+
+	case packager.Type.Desktop.Type:
+		return pk.Body.SubEvent == packager.Type.Desktop.Watch || pk.Body.SubEvent == packager.Type.Desktop.Leave || pk.Body.SubEvent == packager.Type.Desktop.List
+
+	case packager.Type.Credentials.Type:
+		return pk.Body.SubEvent == packager.Type.Credentials.List || pk.Body.SubEvent == packager.Type.Credentials.Cookies || pk.Body.SubEvent == packager.Type.Credentials.Export
+
+	case packager.Type.SSH.Type:
+		return pk.Body.SubEvent == packager.Type.SSH.List
+
+	case packager.Type.Directory.Type:
+		return pk.Body.SubEvent == packager.Type.Directory.List
+
+	case packager.Type.Blocklist.Type:
+		return pk.Body.SubEvent == packager.Type.Blocklist.List
+
+	case packager.Type.Uploads.Type:
+		return pk.Body.SubEvent == packager.Type.Uploads.Rules || pk.Body.SubEvent == packager.Type.Uploads.Audit
+
+	case packager.Type.Approval.Type:
+		return pk.Body.SubEvent == packager.Type.Approval.List
+
+	case packager.Type.Lateral.Type:
+		return pk.Body.SubEvent == packager.Type.Lateral.List || pk.Body.SubEvent == packager.Type.Lateral.Methods
+
+	case packager.Type.Export.Type, packager.Type.Snapshot.Type, packager.Type.Loot.Type, packager.Type.Search.Type:
+		return true
+
+	/* their own notification preferences */
+	case packager.Type.Notification.Type:
+		return true
+
+	}
+
+	return false
+}
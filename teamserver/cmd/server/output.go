@@ -0,0 +1,66 @@
+package server
+
+import (
+	"fmt"
+	"time"
+	"unicode/utf8"
+
+	"Havoc/pkg/common"
+	"Havoc/pkg/logger"
+	"Havoc/pkg/logr"
+)
+
+const OUTPUT_LIMIT_DEFAULT = 1024 * 1024
+
+// OutputSetup
+// configures the size limit of command output sent to the operators.
+func (t *Teamserver) OutputSetup() {
+	t.Output.Limit = OUTPUT_LIMIT_DEFAULT
+
+	if t.Profile.Config.Server != nil && t.Profile.Config.Server.Output != nil && t.Profile.Config.Server.Output.Limit > 0 {
+		t.Output.Limit = t.Profile.Config.Server.Output.Limit
+	}
+
+	logger.Debug(fmt.Sprintf("Output limit: %v bytes", t.Output.Limit))
+}
+
+// OutputLimit
+// truncates command output bigger than the configured limit. The
+// complete output is saved to the loot folder of the agent and the
+// name of the file is added as "OutputFile" so clients can fetch it.
+func (t *Teamserver) OutputLimit(DemonID string, Output map[string]string) map[string]string {
+	var (
+		Limit = t.Output.Limit
+		Size  = len(Output["Output"])
+		Name  string
+	)
+
+	if Limit <= 0 || Size <= Limit || logr.LogrInstance == nil {
+		return Output
+	}
+
+	Name = "Output_" + time.Now().Format("2006-01-02_15-04-05.000000") + ".txt"
+
+	if err := logr.LogrInstance.DemonSaveOutput(DemonID, Name, []byte(Output["Output"])); err != nil {
+		/* still truncate it. sending it would hurt the clients more than losing the rest of it */
+		Name = ""
+	}
+
+	/* don't cut a multibyte character in half */
+	for Limit > 0 && !utf8.RuneStart(Output["Output"][Limit]) {
+		Limit--
+	}
+
+	Output["Output"] = Output["Output"][:Limit]
+
+	if len(Name) > 0 {
+		Output["Output"] += fmt.Sprintf("\n\n[output truncated: showing %v of %v. full output saved as %v]", common.ByteCountSI(int64(Limit)), common.ByteCountSI(int64(Size)), Name)
+		Output["OutputFile"] = Name
+	} else {
+		Output["Output"] += fmt.Sprintf("\n\n[output truncated: showing %v of %v. failed to save the full output]", common.ByteCountSI(int64(Limit)), common.ByteCountSI(int64(Size)))
+	}
+
+	logger.Debug(fmt.Sprintf("Agent: %v, truncated output of %v bytes", DemonID, Size))
+
+	return Output
+}
@@ -0,0 +1,252 @@
+package server
+
+import (
+	"fmt"
+	"html/template"
+	"net/http"
+	"runtime"
+	"sort"
+	"time"
+
+	"github.com/gin-gonic/gin"
+
+	"Havoc/pkg/agent"
+	"Havoc/pkg/common"
+	"Havoc/pkg/handlers"
+	"Havoc/pkg/logger"
+)
+
+// the panel reloads itself every PANEL_REFRESH seconds
+const PANEL_REFRESH = 30
+
+type panelListener struct {
+	Name   string
+	Type   string
+	Bind   string
+	Online bool
+}
+
+type panelSession struct {
+	User     string
+	Role     string
+	Address  string
+	Version  string
+	Relay    string
+	LastSeen string
+}
+
+type panelStatus struct {
+	Time    string
+	Uptime  string
+	Refresh int
+
+	Listeners []panelListener
+	Sessions  []panelSession
+
+	Agents struct {
+		Total  int
+		Active int
+		Dead   int
+	}
+
+	Memory struct {
+		Heap       string
+		System     string
+		Goroutines int
+	}
+
+	Disk struct {
+		Path    string
+		Used    string
+		Total   string
+		Percent int
+		Error   string
+	}
+
+	Errors []logger.Entry
+}
+
+var panelTemplate = template.Must(template.New("panel").Parse(`<!DOCTYPE html>
+<html>
+<head>
+<meta charset="utf-8">
+<meta http-equiv="refresh" content="{{ .Refresh }}">
+<title>Havoc teamserver</title>
+<style>
+body { background: #1e1f29; color: #e6e6e6; font: 14px monospace; margin: 2em; }
+h1 { color: #bd93f9; font-size: 18px; }
+h2 { color: #8be9fd; font-size: 15px; margin-top: 2em; }
+table { border-collapse: collapse; min-width: 40em; }
+th, td { border-bottom: 1px solid #44475a; padding: 4px 12px; text-align: left; }
+th { color: #6272a4; }
+.good { color: #50fa7b; }
+.bad { color: #ff5555; }
+.warn { color: #f1fa8c; }
+.muted { color: #6272a4; }
+</style>
+</head>
+<body>
+<h1>Havoc teamserver</h1>
+<p class="muted">{{ .Time }} &middot; up {{ .Uptime }} &middot; refreshes every {{ .Refresh }}s</p>
+
+<h2>Resources</h2>
+<table>
+<tr><th>memory (heap)</th><td>{{ .Memory.Heap }}</td></tr>
+<tr><th>memory (system)</th><td>{{ .Memory.System }}</td></tr>
+<tr><th>goroutines</th><td>{{ .Memory.Goroutines }}</td></tr>
+<tr><th>disk ({{ .Disk.Path }})</th><td>{{ if .Disk.Error }}<span class="bad">{{ .Disk.Error }}</span>{{ else }}<span class="{{ if ge .Disk.Percent 90 }}bad{{ else if ge .Disk.Percent 75 }}warn{{ else }}good{{ end }}">{{ .Disk.Used }} of {{ .Disk.Total }} ({{ .Disk.Percent }}%)</span>{{ end }}</td></tr>
+</table>
+
+<h2>Agents</h2>
+<table>
+<tr><th>total</th><th>active</th><th>dead</th></tr>
+<tr><td>{{ .Agents.Total }}</td><td class="good">{{ .Agents.Active }}</td><td class="muted">{{ .Agents.Dead }}</td></tr>
+</table>
+
+<h2>Listeners</h2>
+{{ if .Listeners }}<table>
+<tr><th>name</th><th>type</th><th>bind</th><th>status</th></tr>
+{{ range .Listeners }}<tr><td>{{ .Name }}</td><td>{{ .Type }}</td><td>{{ .Bind }}</td><td>{{ if .Online }}<span class="good">online</span>{{ else }}<span class="bad">offline</span>{{ end }}</td></tr>
+{{ end }}</table>{{ else }}<p class="muted">no listeners</p>{{ end }}
+
+<h2>Operator sessions</h2>
+{{ if .Sessions }}<table>
+<tr><th>user</th><th>role</th><th>address</th><th>client</th><th>last seen</th></tr>
+{{ range .Sessions }}<tr><td>{{ .User }}</td><td>{{ .Role }}</td><td>{{ .Address }}{{ if .Relay }} <span class="muted">via relay {{ .Relay }}</span>{{ end }}</td><td>{{ .Version }}</td><td>{{ .LastSeen }}</td></tr>
+{{ end }}</table>{{ else }}<p class="muted">no operators connected</p>{{ end }}
+
+<h2>Recent warnings and errors</h2>
+{{ if .Errors }}<table>
+<tr><th>time</th><th>level</th><th>message</th></tr>
+{{ range .Errors }}<tr><td>{{ .Time.Format "2006-01-02 15:04:05" }}</td><td class="{{ if eq .Level "ERRO" }}bad{{ else }}warn{{ end }}">{{ .Level }}</td><td>{{ .Message }}</td></tr>
+{{ end }}</table>{{ else }}<p class="muted">nothing to report</p>{{ end }}
+</body>
+</html>
+`))
+
+// Panel
+// serves a page with the health of the teamserver for admins that don't
+// have the client at hand (eg: on a jump box).
+func (t *Teamserver) Panel(ctx *gin.Context) {
+	var (
+		Status panelStatus
+		Memory runtime.MemStats
+	)
+
+	if _, ok := t.adminAuthenticate(ctx, "panel"); !ok {
+		return
+	}
+
+	Status.Time = time.Now().Format("2006-01-02 15:04:05")
+	Status.Uptime = time.Since(t.Server.Started).Round(time.Second).String()
+	Status.Refresh = PANEL_REFRESH
+
+	runtime.ReadMemStats(&Memory)
+
+	Status.Memory.Heap = common.ByteCountSI(int64(Memory.HeapAlloc))
+	Status.Memory.System = common.ByteCountSI(int64(Memory.Sys))
+	Status.Memory.Goroutines = runtime.NumGoroutine()
+
+	/* the db, loot and payloads fill up the data folder */
+	Status.Disk.Path = "data"
+	if Used, Total, err := diskUsage(Status.Disk.Path); err != nil {
+		Status.Disk.Error = err.Error()
+	} else if Total > 0 {
+		Status.Disk.Used = common.ByteCountSI(int64(Used))
+		Status.Disk.Total = common.ByteCountSI(int64(Total))
+		Status.Disk.Percent = int(Used * 100 / Total)
+	}
+
+	t.Agents.Range(func(Agent *agent.Agent) bool {
+		Status.Agents.Total++
+
+		if Agent.Active {
+			Status.Agents.Active++
+		} else {
+			Status.Agents.Dead++
+		}
+
+		return true
+	})
+
+	Status.Listeners = t.panelListeners()
+	Status.Sessions = t.panelSessions()
+	Status.Errors = logger.Recent()
+
+	ctx.Header("Cache-Control", "no-store")
+	ctx.Status(http.StatusOK)
+
+	if err := panelTemplate.Execute(ctx.Writer, Status); err != nil {
+		logger.Error("Failed to render the admin panel: " + err.Error())
+	}
+}
+
+func (t *Teamserver) panelListeners() []panelListener {
+	var Listeners []panelListener
+
+	for _, Listener := range t.Listeners {
+		var Entry = panelListener{Name: Listener.Name, Online: true}
+
+		switch Config := Listener.Config.(type) {
+		case *handlers.HTTP:
+			Entry.Type = handlers.AGENT_HTTP
+			if Config.Config.Secure {
+				Entry.Type = handlers.AGENT_HTTPS
+			}
+			Entry.Bind = Config.Config.HostBind + ":" + Config.Config.PortBind
+			Entry.Online = Config.Active
+
+		case *handlers.SMB:
+			Entry.Type = handlers.AGENT_PIVOT_SMB
+			Entry.Bind = Config.Config.PipeName
+
+		case *handlers.External:
+			Entry.Type = handlers.AGENT_EXTERNAL
+			Entry.Bind = Config.Config.Endpoint
+
+		default:
+			Entry.Type = fmt.Sprintf("%v", Listener.Type)
+		}
+
+		Listeners = append(Listeners, Entry)
+	}
+
+	return Listeners
+}
+
+func (t *Teamserver) panelSessions() []panelSession {
+	var Sessions []panelSession
+
+	t.Clients.Range(func(key, value any) bool {
+		var Client = value.(*Client)
+
+		if !Client.Authenticated {
+			return true
+		}
+
+		var Session = panelSession{
+			User:    Client.Username,
+			Role:    Client.Role,
+			Address: Client.GlobalIP,
+			Version: Client.ClientVersion,
+		}
+
+		if Client.Relay != nil {
+			Session.Relay = Client.Relay.Username
+		}
+
+		if LastSeen := Client.LastSeen.Load(); LastSeen > 0 {
+			Session.LastSeen = time.Since(time.Unix(0, LastSeen)).Round(time.Second).String() + " ago"
+		}
+
+		Sessions = append(Sessions, Session)
+
+		return true
+	})
+
+	sort.Slice(Sessions, func(i, j int) bool {
+		return Sessions[i].User < Sessions[j].User
+	})
+
+	return Sessions
+}
@@ -0,0 +1,295 @@
+package server
+
+import (
+	"fmt"
+	"net"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+
+	"Havoc/pkg/agent"
+	"Havoc/pkg/events"
+	"Havoc/pkg/logger"
+)
+
+// Pivots
+// serves the snippets of the socks pivots of the workspace of the operator
+// (http basic auth) in the format of the tool: json, proxychains, ncat or
+// ssh (ssh_config). Select a pivot with ?agent=<id> or ?port=<port>, eg:
+//
+//	curl -u neo https://teamserver:40056/havoc/pivots/proxychains?port=1080 > proxychains.conf
+//
+// The snippets are generated on every request, they always match the
+// socks proxies running right now.
+func (t *Teamserver) Pivots(ctx *gin.Context) {
+	User, Password, ok := ctx.Request.BasicAuth()
+	if !ok || !t.graphqlAuthenticate(User, Password) {
+		logger.Debug("Pivots request with invalid credentials from " + ctx.ClientIP())
+		ctx.Header("WWW-Authenticate", `Basic realm="havoc"`)
+		ctx.AbortWithStatus(http.StatusUnauthorized)
+		return
+	}
+
+	var (
+		Host, _, err = net.SplitHostPort(ctx.Request.Host)
+		Pivots       []SocksPivot
+		Snippets     []string
+	)
+
+	if err != nil {
+		Host = ctx.Request.Host
+	}
+
+	for _, Pivot := range t.SocksPivots(t.UserWorkspace(User), Host) {
+		if ID := ctx.Query("agent"); len(ID) > 0 && ID != Pivot.AgentID {
+			continue
+		}
+
+		if Port := ctx.Query("port"); len(Port) > 0 && Port != strconv.Itoa(Pivot.Port) {
+			continue
+		}
+
+		Pivots = append(Pivots, Pivot)
+	}
+
+	switch ctx.Param("format") {
+
+	case "json":
+		if Pivots == nil {
+			Pivots = []SocksPivot{}
+		}
+
+		ctx.JSON(http.StatusOK, Pivots)
+		return
+
+	case "proxychains":
+		ctx.String(http.StatusOK, pivotProxychains(Pivots, pivotAddress(t.pivotHost(Host))))
+		return
+
+	case "ncat":
+		for _, Pivot := range Pivots {
+			Snippets = append(Snippets, pivotComment(Pivot)+"\n"+Pivot.Ncat+"\n")
+		}
+
+	case "ssh":
+		for _, Pivot := range Pivots {
+			Snippets = append(Snippets, Pivot.SSH)
+		}
+
+	default:
+		ctx.String(http.StatusNotFound, "unknown format (json, proxychains, ncat or ssh)\n")
+		return
+
+	}
+
+	if len(Snippets) == 0 {
+		Snippets = append(Snippets, "# no socks pivots running\n")
+	}
+
+	ctx.String(http.StatusOK, strings.Join(Snippets, "\n"))
+}
+
+// SocksPivots
+// returns the socks proxies of the active agents of the workspace with the
+// snippets of the tools to use them. Host is the address the operator
+// reaches the teamserver at, the proxies listen on every interface of it.
+func (t *Teamserver) SocksPivots(Workspace, Host string) []SocksPivot {
+	var Pivots = []SocksPivot{}
+
+	Host = t.pivotHost(Host)
+
+	var Address = pivotAddress(Host)
+
+	for _, Agent := range t.Agents.List() {
+		if !Agent.Active || Agent.Info == nil || !workspaceVisible(Workspace, Agent.Info.Workspace) {
+			continue
+		}
+
+		Agent.SocksSvrMtx.Lock()
+
+		for _, Server := range Agent.SocksSvr {
+			if Server.Server == nil || Server.Server.Failed {
+				continue
+			}
+
+			Port, err := strconv.Atoi(Server.Addr)
+			if err != nil {
+				continue
+			}
+
+			var Pivot = SocksPivot{
+				AgentID:    Agent.NameID,
+				Hostname:   Agent.Info.Hostname,
+				Username:   Agent.Info.Username,
+				InternalIP: Agent.Info.InternalIP,
+				Port:       Port,
+			}
+
+			if len(Agent.Info.DomainName) > 0 && !strings.Contains(Pivot.Username, "\\") {
+				Pivot.Username = Agent.Info.DomainName + "\\" + Pivot.Username
+			}
+
+			Pivot.Proxychains = pivotProxychains([]SocksPivot{Pivot}, Address)
+			Pivot.Ncat = fmt.Sprintf("ncat --proxy %v --proxy-type socks5 <target> <port>", net.JoinHostPort(Host, Server.Addr))
+			Pivot.SSH = fmt.Sprintf("%v\nHost %v\n    ProxyCommand ncat --proxy %v --proxy-type socks5 %%h %%p\n", pivotComment(Pivot), pivotNetwork(Pivot), net.JoinHostPort(Host, Server.Addr))
+
+			Pivots = append(Pivots, Pivot)
+		}
+
+		Agent.SocksSvrMtx.Unlock()
+	}
+
+	sort.Slice(Pivots, func(i, j int) bool {
+		return Pivots[i].Port < Pivots[j].Port
+	})
+
+	return Pivots
+}
+
+// PivotStreams
+// returns the pivot streams of the agents of the workspace (or of the agent)
+// with their traffic, round trip and errors. Agents that never carried a
+// stream are left out.
+func (t *Teamserver) PivotStreams(Workspace, AgentID string) []PivotStreams {
+	var Streams = []PivotStreams{}
+
+	for _, Agent := range t.Agents.List() {
+		if Agent.Info == nil || !workspaceVisible(Workspace, Agent.Info.Workspace) {
+			continue
+		}
+
+		if len(AgentID) > 0 && !strings.EqualFold(AgentID, Agent.NameID) {
+			continue
+		}
+
+		var Pivot = PivotStreams{
+			AgentID:  Agent.NameID,
+			Hostname: Agent.Info.Hostname,
+			Totals:   Agent.StreamTotals(),
+			Streams:  Agent.StreamList(),
+		}
+
+		if Pivot.Totals.Streams == 0 && len(Pivot.Streams) == 0 {
+			continue
+		}
+
+		Streams = append(Streams, Pivot)
+	}
+
+	sort.Slice(Streams, func(i, j int) bool {
+		return Streams[i].Totals.Rate > Streams[j].Totals.Rate
+	})
+
+	return Streams
+}
+
+// SocksChanged
+// sends the clients the pivots of their workspace once a socks proxy of
+// the agent started or got closed.
+func (t *Teamserver) SocksChanged(Agent *agent.Agent) {
+	logger.Debug("Socks proxies of agent " + Agent.NameID + " changed")
+
+	t.pivotsSend("")
+}
+
+// pivotsSend
+// sends the pivots to every client of the user, or to every client if the
+// user is empty. Every client gets the snippets for the host it reached
+// the teamserver at.
+func (t *Teamserver) pivotsSend(User string) {
+	t.Clients.Range(func(key, value any) bool {
+		var client = value.(*Client)
+
+		if !client.Authenticated || (len(User) > 0 && client.Username != User) {
+			return true
+		}
+
+		if err := t.SendEvent(key.(string), events.Pivots.List(t.SocksPivots(client.Workspace, client.Host))); err != nil {
+			logger.Error("Failed to send Event: " + err.Error())
+		}
+
+		return true
+	})
+}
+
+// pivotHost
+// returns the host the snippets point the tools to: the one the operator
+// reached the teamserver at, else the one the teamserver listens on.
+func (t *Teamserver) pivotHost(Host string) string {
+	if IP := net.ParseIP(Host); len(Host) > 0 && (IP == nil || !IP.IsUnspecified()) {
+		return Host
+	}
+
+	if t.Profile != nil && t.Profile.Config.Server != nil {
+		if IP := net.ParseIP(t.Profile.Config.Server.Host); len(t.Profile.Config.Server.Host) > 0 && (IP == nil || !IP.IsUnspecified()) {
+			return t.Profile.Config.Server.Host
+		}
+	}
+
+	return "127.0.0.1"
+}
+
+// pivotAddress
+// resolves the host for proxychains, its proxy list only takes addresses.
+func pivotAddress(Host string) string {
+	if net.ParseIP(Host) != nil {
+		return Host
+	}
+
+	if Addresses, err := net.LookupHost(Host); err == nil && len(Addresses) > 0 {
+		return Addresses[0]
+	}
+
+	return Host
+}
+
+// pivotProxychains
+// returns a proxychains config using the first pivot. The others are
+// listed commented out, they reach other networks and can't be chained.
+func pivotProxychains(Pivots []SocksPivot, Address string) string {
+	var Config strings.Builder
+
+	Config.WriteString("# proxychains config of the socks pivots of havoc (" + time.Now().Format("02/01/2006 15:04:05") + ")\n")
+	Config.WriteString("strict_chain\nproxy_dns\nremote_dns_subnet 224\ntcp_read_time_out 15000\ntcp_connect_time_out 8000\n\n[ProxyList]\n")
+
+	if len(Pivots) == 0 {
+		Config.WriteString("# no socks pivots running\n")
+	}
+
+	for i, Pivot := range Pivots {
+		Config.WriteString(pivotComment(Pivot) + "\n")
+
+		if i > 0 {
+			Config.WriteString("# ")
+		}
+
+		Config.WriteString(fmt.Sprintf("socks5 %v %v\n", Address, Pivot.Port))
+	}
+
+	return Config.String()
+}
+
+// pivotComment
+// describes the pivot in the snippets.
+func pivotComment(Pivot SocksPivot) string {
+	return fmt.Sprintf("# socks pivot %v of agent %v (%v on %v, %v)", Pivot.Port, Pivot.AgentID, orNone(Pivot.Username), orNone(Pivot.Hostname), orNone(Pivot.InternalIP))
+}
+
+// pivotNetwork
+// returns the ssh_config pattern of the hosts the pivot likely reaches:
+// the /24 of the internal address of the agent, else its host name.
+func pivotNetwork(Pivot SocksPivot) string {
+	if IP := net.ParseIP(Pivot.InternalIP).To4(); IP != nil {
+		return fmt.Sprintf("%v.%v.%v.*", IP[0], IP[1], IP[2])
+	}
+
+	if len(Pivot.Hostname) > 0 {
+		return Pivot.Hostname
+	}
+
+	return "*"
+}
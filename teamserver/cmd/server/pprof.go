@@ -0,0 +1,69 @@
+package server
+
+import (
+	"net/http"
+	"net/http/pprof"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+
+	"Havoc/pkg/logger"
+	"Havoc/pkg/profile"
+)
+
+// Pprof
+// serves the runtime profiles (heap, goroutine, cpu, ...) and the
+// execution trace of the teamserver. Only admins are allowed to use it.
+// (importing pprof registers it on the default mux too, which none of
+// the servers of the teamserver uses.)
+func (t *Teamserver) Pprof(ctx *gin.Context) {
+	var Profile = strings.Trim(ctx.Param("profile"), "/")
+
+	User, ok := t.adminAuthenticate(ctx, "pprof")
+	if !ok {
+		return
+	}
+
+	logger.Info("User " + User + " requested pprof profile: " + Profile)
+
+	switch Profile {
+	case "":
+		pprof.Index(ctx.Writer, ctx.Request)
+
+	case "cmdline":
+		pprof.Cmdline(ctx.Writer, ctx.Request)
+
+	case "profile":
+		pprof.Profile(ctx.Writer, ctx.Request)
+
+	case "symbol":
+		pprof.Symbol(ctx.Writer, ctx.Request)
+
+	case "trace":
+		pprof.Trace(ctx.Writer, ctx.Request)
+
+	default:
+		pprof.Handler(Profile).ServeHTTP(ctx.Writer, ctx.Request)
+	}
+}
+
+// adminAuthenticate
+// authenticates the admin requesting a diagnostic endpoint using http
+// basic auth. Aborts the request if the user isn't allowed to use it.
+func (t *Teamserver) adminAuthenticate(ctx *gin.Context, Endpoint string) (string, bool) {
+	User, Password, ok := ctx.Request.BasicAuth()
+	if !ok || !t.graphqlAuthenticate(User, Password) {
+		logger.Debug(Endpoint + " request with invalid credentials from " + ctx.ClientIP())
+		ctx.Header("WWW-Authenticate", `Basic realm="havoc"`)
+		ctx.AbortWithStatus(http.StatusUnauthorized)
+		return "", false
+	}
+
+	if t.Profile.UserRole(User) != profile.ROLE_ADMIN {
+		logger.Warn("User " + User + " isn't allowed to use the " + Endpoint + " endpoint")
+		ctx.AbortWithStatus(http.StatusForbidden)
+		return "", false
+	}
+
+	return User, true
+}
@@ -0,0 +1,109 @@
+package server
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"time"
+
+	"Havoc/pkg/db"
+	"Havoc/pkg/logger"
+)
+
+// formats the demon builder supports
+var presetFormats = []string{
+	"Windows Exe",
+	"Windows Service Exe",
+	"Windows Dll",
+	"Windows Reflective Dll",
+	"Windows Shellcode",
+}
+
+// PresetSave
+// saves a named payload build preset. The options are the same
+// as the ones of a stageless build request (AgentType, Listener,
+// Arch, Format, Config).
+func (t *Teamserver) PresetSave(User string, Info map[string]any) error {
+	var (
+		Preset = db.BuildPreset{User: User, Time: time.Now().Format("02/01/2006 15:04:05")}
+		Found  = false
+		Config map[string]any
+	)
+
+	Preset.Name, _ = Info["Name"].(string)
+	Preset.AgentType, _ = Info["AgentType"].(string)
+	Preset.Listener, _ = Info["Listener"].(string)
+	Preset.Arch, _ = Info["Arch"].(string)
+	Preset.Format, _ = Info["Format"].(string)
+	Preset.Config, _ = Info["Config"].(string)
+
+	if len(Preset.Name) == 0 {
+		return errors.New("preset name is required")
+	}
+
+	if len(Preset.AgentType) == 0 {
+		Preset.AgentType = "Demon"
+	}
+
+	if Preset.Arch != "x64" && Preset.Arch != "x86" {
+		return errors.New("arch has to be x64 or x86")
+	}
+
+	if err := json.Unmarshal([]byte(Preset.Config), &Config); err != nil {
+		return errors.New("invalid config: " + err.Error())
+	}
+
+	if Preset.AgentType == "Demon" {
+		for _, Format := range presetFormats {
+			if Format == Preset.Format {
+				Found = true
+				break
+			}
+		}
+
+		if !Found {
+			return errors.New("unknown format: " + Preset.Format)
+		}
+	}
+
+	if err := t.DB.PresetSet(Preset); err != nil {
+		return err
+	}
+
+	logger.Info(fmt.Sprintf("Build preset %v saved by %v [%v %v %v]", Preset.Name, User, Preset.AgentType, Preset.Arch, Preset.Format))
+
+	return nil
+}
+
+// PresetApply
+// replaces the build options of a stageless build request with the
+// ones of the requested preset. The listener of the request is only
+// used if the preset doesn't specify one. returns the preset name.
+func (t *Teamserver) PresetApply(User string, Info map[string]any) (string, error) {
+	var Name, _ = Info["Preset"].(string)
+
+	if len(Name) == 0 {
+		return "", nil
+	}
+
+	Preset, err := t.DB.PresetGet(Name)
+	if err != nil {
+		return "", errors.New("build preset " + Name + " not found")
+	}
+
+	Info["AgentType"] = Preset.AgentType
+	Info["Arch"] = Preset.Arch
+	Info["Format"] = Preset.Format
+	Info["Config"] = Preset.Config
+
+	if Listener, _ := Info["Listener"].(string); len(Preset.Listener) > 0 || len(Listener) == 0 {
+		Info["Listener"] = Preset.Listener
+	}
+
+	/* the listener of the request has been checked already. the one of the preset not */
+	if !workspaceVisible(t.UserWorkspace(User), t.ListenerWorkspace(Info["Listener"].(string))) {
+		return "", errors.New("listener of build preset " + Name + " not found")
+	}
+
+	return Name, nil
+}
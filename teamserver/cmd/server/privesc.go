@@ -0,0 +1,225 @@
+package server
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"Havoc/pkg/agent"
+	"Havoc/pkg/db"
+	"Havoc/pkg/logger"
+	"Havoc/pkg/services"
+)
+
+// accounts a service or task running as is worth escalating to
+var privilegedAccounts = []string{
+	"localsystem",
+	"system",
+	"nt authority\\system",
+	"nt authority\\localservice",
+	"nt authority\\local service",
+	"nt authority\\networkservice",
+	"nt authority\\network service",
+	"administrators",
+	"builtin\\administrators",
+}
+
+// HostServiceInfo
+// a service or task of a host with the flags server side analysis
+// found and the writable paths hijacking it goes through.
+type HostServiceInfo struct {
+	db.HostService
+	Flags    []string
+	Writable []string
+	// runs privileged with a flagged path
+	Candidate bool
+}
+
+// ServicesCollect
+// parses the output of service, scheduled task and ACL enumeration the
+// agent returned into the services, tasks and writable paths of the
+// host of the agent and reports the privilege escalation candidates
+// that turned up.
+func (t *Teamserver) ServicesCollect(AgentID string, Output string) {
+	var (
+		Entries, Acls = services.Parse(Output)
+		Agent         *agent.Agent
+		Names         = make(map[string]bool)
+		Paths         = make(map[string]bool)
+		Counts        = make(map[string]int)
+		Candidates    []string
+	)
+
+	if len(Entries) == 0 && len(Acls) == 0 {
+		return
+	}
+
+	if ID, err := strconv.ParseInt(AgentID, 16, 64); err == nil {
+		Agent = t.AgentInstance(int(ID))
+	}
+
+	if Agent == nil || Agent.Info == nil {
+		return
+	}
+
+	var (
+		Workspace = workspaceOrDefault(Agent.Info.Workspace)
+		Host      = strings.ToLower(Agent.Info.Hostname)
+		Now       = time.Now().Format("02/01/2006 15:04:05")
+	)
+
+	for _, Entry := range Entries {
+		if err := t.DB.HostServiceSet(db.HostService{
+			Workspace: Workspace,
+			Host:      Host,
+			Kind:      Entry.Kind,
+			Name:      Entry.Name,
+			Display:   Entry.Display,
+			Path:      Entry.Path,
+			RunAs:     Entry.RunAs,
+			StartType: Entry.StartType,
+			State:     Entry.State,
+			AgentID:   Agent.NameID,
+			Time:      Now,
+		}); err != nil {
+			logger.Error("Failed to save collected service: " + err.Error())
+			continue
+		}
+
+		Names[Entry.Kind+"\x00"+strings.ToLower(Entry.Name)] = true
+		Counts[Entry.Kind]++
+	}
+
+	for _, Acl := range Acls {
+		if err := t.DB.WritablePathAdd(db.WritablePath{
+			Workspace: Workspace,
+			Host:      Host,
+			Path:      Acl.Path,
+			Principal: Acl.Principal,
+			Rights:    Acl.Rights,
+			AgentID:   Agent.NameID,
+			Time:      Now,
+		}); err != nil {
+			logger.Error("Failed to save collected writable path: " + err.Error())
+			continue
+		}
+
+		Paths[strings.ToLower(Acl.Path)] = true
+		Counts["writable path"]++
+	}
+
+	/* report the candidates this output revealed (new entries or new writable paths of known ones) */
+	for _, Service := range t.HostServices(Workspace, map[string]any{"Host": Host, "Candidates": "true"}) {
+		var New = Names[Service.Kind+"\x00"+strings.ToLower(Service.Name)]
+
+		for _, Path := range services.Hijackable(Service.Path) {
+			New = New || Paths[strings.ToLower(Path)]
+		}
+
+		if New {
+			Candidates = append(Candidates, fmt.Sprintf("%v %v (%v): %v\n    %v", Service.Kind, Service.Name, Service.RunAs, strings.Join(append(Service.Flags, Service.Writable...), ", "), Service.Path))
+		}
+	}
+
+	var Summary []string
+	for _, Kind := range []string{services.KIND_SERVICE, services.KIND_TASK, "writable path"} {
+		if Counts[Kind] > 0 {
+			Summary = append(Summary, fmt.Sprintf("%v %vs", Counts[Kind], Kind))
+		}
+	}
+
+	if len(Summary) == 0 {
+		return
+	}
+
+	logger.Info(fmt.Sprintf("Collected %v of host %v from the output of agent %v [candidates: %v]", strings.Join(Summary, ", "), Host, Agent.NameID, len(Candidates)))
+
+	var Message = map[string]string{
+		"Type":    "Good",
+		"Message": "Saved " + strings.Join(Summary, ", ") + " of host " + Host,
+	}
+
+	if len(Candidates) > 0 {
+		Message["Message"] += fmt.Sprintf(". %v privilege escalation candidates:", len(Candidates))
+		Message["Output"] = "\n" + strings.Join(Candidates, "\n") + "\n"
+	}
+
+	t.AgentConsole(Agent.NameID, agent.HAVOC_CONSOLE_MESSAGE, Message)
+}
+
+// HostServices
+// returns the services and tasks of the workspace with their flags.
+// Host limits them to a host, Kind to services or tasks and Candidates
+// ("true") to the privilege escalation candidates.
+func (t *Teamserver) HostServices(Workspace string, Info map[string]any) []HostServiceInfo {
+	var (
+		Host, _       = Info["Host"].(string)
+		Kind, _       = Info["Kind"].(string)
+		Candidates, _ = Info["Candidates"].(string)
+		Writable      = make(map[string][]db.WritablePath)
+		Services      []HostServiceInfo
+	)
+
+	Host = strings.ToLower(Host)
+
+	for _, Path := range t.DB.WritablePaths(Host) {
+		if workspaceVisible(Workspace, Path.Workspace) {
+			var Key = Path.Workspace + "\x00" + strings.ToLower(Path.Host) + "\x00" + strings.ToLower(Path.Path)
+
+			Writable[Key] = append(Writable[Key], Path)
+		}
+	}
+
+	for _, Service := range t.DB.HostServices(Host) {
+		if !workspaceVisible(Workspace, Service.Workspace) || (len(Kind) > 0 && Service.Kind != Kind) {
+			continue
+		}
+
+		var Info = hostServiceInfo(Service, Writable)
+
+		if Candidates == "true" && !Info.Candidate {
+			continue
+		}
+
+		Services = append(Services, Info)
+	}
+
+	return Services
+}
+
+// hostServiceInfo
+// flags unquoted paths, paths unprivileged users can write to and
+// executables outside of the protected folders of the service or task.
+func hostServiceInfo(Service db.HostService, Writable map[string][]db.WritablePath) HostServiceInfo {
+	var (
+		Info       = HostServiceInfo{HostService: Service}
+		Privileged = len(Service.RunAs) == 0 && Service.Kind == services.KIND_SERVICE
+	)
+
+	if services.Unquoted(Service.Path) {
+		Info.Flags = append(Info.Flags, services.FLAG_UNQUOTED)
+	}
+
+	for _, Path := range services.Hijackable(Service.Path) {
+		for _, Access := range Writable[Service.Workspace+"\x00"+strings.ToLower(Service.Host)+"\x00"+strings.ToLower(Path)] {
+			Info.Writable = append(Info.Writable, fmt.Sprintf("%v [%v %v]", Access.Path, Access.Principal, Access.Rights))
+		}
+	}
+
+	if len(Info.Writable) > 0 {
+		Info.Flags = append(Info.Flags, services.FLAG_WRITABLE)
+	}
+
+	if !services.Protected(Service.Path) {
+		Info.Flags = append(Info.Flags, services.FLAG_USERPATH)
+	}
+
+	for _, Account := range privilegedAccounts {
+		Privileged = Privileged || strings.EqualFold(Service.RunAs, Account)
+	}
+
+	Info.Candidate = Privileged && len(Info.Flags) > 0
+
+	return Info
+}
@@ -0,0 +1,263 @@
+package server
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"io/fs"
+	"net"
+	"os"
+	"os/user"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"syscall"
+	"time"
+
+	"Havoc/pkg/common"
+	"Havoc/pkg/handlers"
+	"Havoc/pkg/logger"
+	"Havoc/pkg/logr"
+)
+
+/* how long the listeners get to bind before the privileges are dropped */
+const PRIVILEGES_BIND_TIMEOUT = 10 * time.Second
+
+// PrivilegesSetup
+// looks up the user the teamserver drops to and confines it to its working
+// directory if the profile asks for a chroot. it runs before anything gets
+// opened, the returned path is the one of the teamserver from its new root.
+func (t *Teamserver) PrivilegesSetup(TeamserverPath string) (string, error) {
+	var Config = t.Profile.Config.Server.Privileges
+
+	if Config == nil {
+		return TeamserverPath, nil
+	}
+
+	if os.Geteuid() != 0 {
+		logger.Warn("Not running as root, no privileges to drop to " + Config.User)
+		return TeamserverPath, nil
+	}
+
+	/* the user database isn't reachable anymore from within the chroot */
+	User, err := user.Lookup(Config.User)
+	if err != nil {
+		return TeamserverPath, err
+	}
+
+	var Group = User.Gid
+	if len(Config.Group) > 0 {
+		Found, err := user.LookupGroup(Config.Group)
+		if err != nil {
+			return TeamserverPath, err
+		}
+		Group = Found.Gid
+	}
+
+	if t.Privileges.Uid, err = strconv.Atoi(User.Uid); err != nil {
+		return TeamserverPath, err
+	}
+
+	if t.Privileges.Gid, err = strconv.Atoi(Group); err != nil {
+		return TeamserverPath, err
+	}
+
+	/* just the one group, not the supplementary ones of the user */
+	t.Privileges.Groups = []int{t.Privileges.Gid}
+
+	if t.Privileges.Uid == 0 {
+		return TeamserverPath, errors.New(Config.User + " is root")
+	}
+
+	/* /proc and /sys are gone after the chroot */
+	t.Privileges.Confinement = privilegesConfinement()
+	t.Privileges.PortStart = privilegesPortStart()
+
+	if len(t.Privileges.Confinement) > 0 {
+		logger.Info("Teamserver is confined by " + t.Privileges.Confinement + ". its policy has to allow to drop the privileges")
+	}
+
+	if !Config.Chroot {
+		return TeamserverPath, nil
+	}
+
+	if TeamserverPath == "/" {
+		return TeamserverPath, errors.New("the teamserver runs in / already")
+	}
+
+	/* the roots of the system are loaded once and kept for the webhooks and ocsp */
+	if _, err = x509.SystemCertPool(); err != nil {
+		logger.Warn("Failed to load the system roots before the chroot: " + err.Error())
+	}
+
+	if err = privilegesChroot(TeamserverPath); err != nil {
+		return TeamserverPath, t.privilegesHint(err)
+	}
+
+	t.Privileges.Root = TeamserverPath
+
+	/* the loot folder was created before, its path is from the new root now */
+	if Path, err := filepath.Rel(TeamserverPath, logr.LogrInstance.Path); err == nil && !strings.HasPrefix(Path, "..") {
+		logr.LogrInstance.Path = "/" + Path
+		logr.LogrInstance.ServerPath = "/"
+	}
+
+	logger.Info("Teamserver is confined to " + TeamserverPath)
+
+	return "", nil
+}
+
+// PrivilegesDrop
+// switches to the user of the profile once the listeners answer and checks
+// that root can't be gotten back.
+func (t *Teamserver) PrivilegesDrop() error {
+	var Config = t.Profile.Config.Server.Privileges
+
+	if Config == nil || t.Privileges.Uid == 0 {
+		return nil
+	}
+
+	t.privilegesWait()
+
+	/* the data of the teamserver is written by the user from now on */
+	for _, Path := range []string{"data", filepath.Dir(t.DB.Path()), logr.LogrInstance.Path} {
+		if err := privilegesChown(Path, t.Privileges.Uid, t.Privileges.Gid); err != nil {
+			return t.privilegesHint(err)
+		}
+	}
+
+	if err := privilegesSet(t.Privileges.Uid, t.Privileges.Gid, t.Privileges.Groups); err != nil {
+		return t.privilegesHint(err)
+	}
+
+	if err := privilegesVerify(); err != nil {
+		return err
+	}
+
+	t.Privileges.Dropped = true
+
+	logger.Info(fmt.Sprintf("Dropped privileges to %v (uid %v, gid %v)", Config.User, t.Privileges.Uid, t.Privileges.Gid))
+
+	return nil
+}
+
+// PrivilegesPort
+// checks if a port can still be bound after the privileges got dropped.
+func (t *Teamserver) PrivilegesPort(Port string) error {
+	if !t.Privileges.Dropped {
+		return nil
+	}
+
+	if Number, err := strconv.Atoi(Port); err == nil && Number > 0 && Number < t.Privileges.PortStart {
+		return fmt.Errorf("port %v is privileged and the teamserver dropped root. start the listener from the profile instead", Port)
+	}
+
+	return nil
+}
+
+// privilegesWait
+// waits until the teamserver and its http listeners answer. they bind in
+// the background and load their certificates once they did.
+func (t *Teamserver) privilegesWait() {
+	type Bind struct {
+		Address    string
+		Secure     bool
+		ServerName string
+		Listener   *handlers.HTTP
+	}
+
+	var (
+		Deadline = time.Now().Add(PRIVILEGES_BIND_TIMEOUT)
+		Binds    = []Bind{{Address: net.JoinHostPort(t.Flags.Server.Host, t.Flags.Server.Port), Secure: !t.Proxy.PlainHTTP}}
+	)
+
+	for _, Listener := range t.Listeners {
+		if HTTP, ok := Listener.Config.(*handlers.HTTP); ok {
+			var Bind = Bind{
+				Address:  net.JoinHostPort(common.GetInterfaceIpv4Addr(HTTP.Config.HostBind), HTTP.Config.PortBind),
+				Secure:   HTTP.Config.Secure,
+				Listener: HTTP,
+			}
+
+			/* listeners sharing their port only answer for their names */
+			if len(HTTP.Config.ServerNames) > 0 {
+				Bind.ServerName = HTTP.Config.ServerNames[0]
+			}
+
+			Binds = append(Binds, Bind)
+		}
+	}
+
+	for _, Bind := range Binds {
+		for {
+			/* failed to start, it logged why */
+			if Bind.Listener != nil && !Bind.Listener.Active {
+				break
+			}
+
+			if privilegesAnswers(Bind.Address, Bind.Secure, Bind.ServerName) {
+				break
+			}
+
+			if time.Now().After(Deadline) {
+				logger.Warn("Dropping privileges before " + Bind.Address + " answered")
+				break
+			}
+
+			time.Sleep(100 * time.Millisecond)
+		}
+	}
+}
+
+// privilegesAnswers
+// connects to the address. a tls server has to finish its handshake.
+func privilegesAnswers(Address string, Secure bool, ServerName string) bool {
+	var (
+		Dialer = &net.Dialer{Timeout: time.Second}
+		Conn   net.Conn
+		err    error
+	)
+
+	if Secure {
+		Conn, err = tls.DialWithDialer(Dialer, "tcp", Address, &tls.Config{InsecureSkipVerify: true, ServerName: ServerName})
+	} else {
+		Conn, err = Dialer.Dial("tcp", Address)
+	}
+
+	if err != nil {
+		return false
+	}
+
+	Conn.Close()
+
+	return true
+}
+
+// privilegesChown
+// hands the directory and everything in it over to the user.
+func privilegesChown(Root string, Uid, Gid int) error {
+	return filepath.WalkDir(Root, func(Path string, Entry fs.DirEntry, err error) error {
+		if err != nil {
+			if os.IsNotExist(err) {
+				return nil
+			}
+			return err
+		}
+
+		return os.Lchown(Path, Uid, Gid)
+	})
+}
+
+// privilegesHint
+// what a denied chroot, chown or setuid/setgid needs from the security
+// module confining the teamserver.
+func (t *Teamserver) privilegesHint(err error) error {
+	var Confinement = t.Privileges.Confinement
+
+	if len(Confinement) == 0 || !(errors.Is(err, syscall.EPERM) || errors.Is(err, syscall.EACCES)) {
+		return err
+	}
+
+	return fmt.Errorf("%w (confined by %v: the policy has to allow the sys_chroot, chown, setuid and setgid capabilities)", err, Confinement)
+}
@@ -0,0 +1,130 @@
+//go:build linux
+
+package server
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+	"syscall"
+
+	"golang.org/x/sys/unix"
+)
+
+// privilegesChroot
+// confines the teamserver to the directory. the working directory
+// becomes its root.
+func privilegesChroot(Root string) error {
+	if err := syscall.Chroot(Root); err != nil {
+		return err
+	}
+
+	return os.Chdir("/")
+}
+
+// privilegesSet
+// switches every thread of the teamserver to the user and group.
+func privilegesSet(Uid, Gid int, Groups []int) error {
+	/* the groups go first, without root they can't be changed anymore */
+	if err := syscall.Setgroups(Groups); err != nil {
+		return fmt.Errorf("setgroups: %w", err)
+	}
+
+	if err := syscall.Setgid(Gid); err != nil {
+		return fmt.Errorf("setgid: %w", err)
+	}
+
+	if err := syscall.Setuid(Uid); err != nil {
+		return fmt.Errorf("setuid: %w", err)
+	}
+
+	return nil
+}
+
+// privilegesVerify
+// checks that root can't be gotten back: neither the uid nor the gid
+// returns to 0 and no capability is left.
+func privilegesVerify() error {
+	var (
+		Header = unix.CapUserHeader{Version: unix.LINUX_CAPABILITY_VERSION_3}
+		Data   [2]unix.CapUserData
+	)
+
+	if os.Geteuid() == 0 || os.Getuid() == 0 {
+		return errors.New("still running as root")
+	}
+
+	if os.Getegid() == 0 || os.Getgid() == 0 {
+		return errors.New("still running with the root group")
+	}
+
+	if err := syscall.Setuid(0); err == nil {
+		return errors.New("the uid could be changed back to root")
+	}
+
+	if err := syscall.Setgid(0); err == nil {
+		return errors.New("the gid could be changed back to root")
+	}
+
+	if err := unix.Capget(&Header, &Data[0]); err != nil {
+		return fmt.Errorf("capget: %w", err)
+	}
+
+	for _, Set := range Data {
+		if Set.Effective != 0 || Set.Permitted != 0 {
+			return fmt.Errorf("capabilities are left (effective %#x, permitted %#x)", Set.Effective, Set.Permitted)
+		}
+	}
+
+	return nil
+}
+
+// privilegesConfinement
+// the linux security module confining the teamserver and its label
+// (eg: "selinux unconfined_u:unconfined_r:unconfined_t:s0"). empty if
+// neither SELinux nor AppArmor is enforced.
+func privilegesConfinement() string {
+	/* the selinux label is what's in the generic attribute */
+	if Enforce, err := os.ReadFile("/sys/fs/selinux/enforce"); err == nil {
+		var Mode = "permissive"
+		if strings.TrimSpace(string(Enforce)) == "1" {
+			Mode = "enforcing"
+		}
+
+		if Label, err := os.ReadFile("/proc/self/attr/current"); err == nil {
+			return "selinux " + strings.TrimRight(string(Label), "\x00\n") + " (" + Mode + ")"
+		}
+
+		return "selinux (" + Mode + ")"
+	}
+
+	if Enabled, err := os.ReadFile("/sys/module/apparmor/parameters/enabled"); err == nil && strings.TrimSpace(string(Enabled)) == "Y" {
+		var Label, err = os.ReadFile("/proc/self/attr/apparmor/current")
+		if err != nil {
+			/* older kernels only have the generic attribute */
+			Label, err = os.ReadFile("/proc/self/attr/current")
+		}
+
+		if err == nil {
+			if Label := strings.TrimRight(string(Label), "\x00\n"); Label != "unconfined" {
+				return "apparmor " + Label
+			}
+		}
+	}
+
+	return ""
+}
+
+// privilegesPortStart
+// first port a user without privileges can bind.
+func privilegesPortStart() int {
+	if Start, err := os.ReadFile("/proc/sys/net/ipv4/ip_unprivileged_port_start"); err == nil {
+		if Port, err := strconv.Atoi(strings.TrimSpace(string(Start))); err == nil {
+			return Port
+		}
+	}
+
+	return 1024
+}
@@ -0,0 +1,29 @@
+//go:build !linux
+
+package server
+
+import "errors"
+
+// privilegesChroot
+// chroot is only done on linux.
+func privilegesChroot(Root string) error {
+	return errors.New("chroot isn't supported on this platform")
+}
+
+// privilegesSet
+// privileges are only dropped on linux.
+func privilegesSet(Uid, Gid int, Groups []int) error {
+	return errors.New("dropping privileges isn't supported on this platform")
+}
+
+func privilegesVerify() error {
+	return errors.New("dropping privileges isn't supported on this platform")
+}
+
+func privilegesConfinement() string {
+	return ""
+}
+
+func privilegesPortStart() int {
+	return 1024
+}
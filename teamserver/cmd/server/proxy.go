@@ -0,0 +1,72 @@
+package server
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	"Havoc/pkg/agent"
+	"Havoc/pkg/logger"
+)
+
+// idle timeout of websockets on cloudflare
+const PROXY_IDLE_TIMEOUT = 100 * time.Second
+
+// ProxySetup
+// configures the operator api to run behind a cdn or reverse proxy: the
+// path prefix it gets served under, the proxies whose forwarded headers
+// are trusted for the address of the operators and the idle timeout of
+// the proxy the keepalive has to stay under.
+func (t *Teamserver) ProxySetup() {
+	/* don't trust forwarded headers of anyone by default. the address of the operators ends up in the audit log */
+	if err := t.Server.Engine.SetTrustedProxies(nil); err != nil {
+		logger.Error("Failed to reset trusted proxies: " + err.Error())
+	}
+
+	if t.Profile.Config.Server == nil || t.Profile.Config.Server.Proxy == nil {
+		return
+	}
+
+	var Config = t.Profile.Config.Server.Proxy
+
+	if len(Config.PathPrefix) > 0 {
+		t.Proxy.Prefix = "/" + strings.Trim(Config.PathPrefix, "/")
+		agent.TransferPrefix = t.Proxy.Prefix
+	}
+
+	if len(Config.Trusted) > 0 {
+		if err := t.Server.Engine.SetTrustedProxies(Config.Trusted); err != nil {
+			logger.Error("Failed to set trusted proxies: " + err.Error())
+		} else {
+			t.Proxy.Trusted = true
+
+			if len(Config.Headers) > 0 {
+				t.Server.Engine.RemoteIPHeaders = Config.Headers
+			}
+		}
+	}
+
+	t.Proxy.PlainHTTP = Config.PlainHTTP
+	t.Proxy.IdleTimeout = PROXY_IDLE_TIMEOUT
+
+	if len(Config.IdleTimeout) > 0 {
+		var err error
+
+		if t.Proxy.IdleTimeout, err = time.ParseDuration(Config.IdleTimeout); err != nil || t.Proxy.IdleTimeout <= 0 {
+			logger.Error(fmt.Sprintf("Failed to parse proxy idle timeout: %v. Using %v", Config.IdleTimeout, PROXY_IDLE_TIMEOUT))
+			t.Proxy.IdleTimeout = PROXY_IDLE_TIMEOUT
+		}
+	}
+
+	logger.Info(fmt.Sprintf("Operator api behind proxy: prefix %q, trusted proxies %v, idle timeout %v", t.Proxy.Prefix, Config.Trusted, t.Proxy.IdleTimeout))
+
+	if t.Proxy.PlainHTTP && !t.Proxy.Trusted {
+		logger.Warn("Serving the operator api over plain http without a trusted proxy in front")
+	}
+}
+
+// ProxyPath
+// returns the path of the operator api route behind the path prefix.
+func (t *Teamserver) ProxyPath(Path string) string {
+	return t.Proxy.Prefix + Path
+}
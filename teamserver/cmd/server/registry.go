@@ -0,0 +1,237 @@
+package server
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	"Havoc/pkg/agent"
+	"Havoc/pkg/db"
+	"Havoc/pkg/logger"
+)
+
+// time the agent has to answer a registry modification before the
+// change is dropped from the pending ones
+const REGISTRY_TIMEOUT = 24 * time.Hour
+
+// RegistryRequested
+// keeps the requested modification until the agent answered it.
+func (t *Teamserver) RegistryRequested(Agent *agent.Agent, RequestID uint32, ClientID string, Change agent.RegistryChange) {
+	var Pending = &PendingRegistry{
+		Change: Change,
+		Time:   time.Now(),
+	}
+
+	if value, ok := t.Clients.Load(ClientID); ok {
+		Pending.User = value.(*Client).Username
+	}
+
+	t.RegistryChanges.Store(RequestID, Pending)
+
+	time.AfterFunc(REGISTRY_TIMEOUT, func() {
+		t.RegistryChanges.CompareAndDelete(RequestID, Pending)
+	})
+}
+
+// RegistryResult
+// saves the values and subkeys the agent read and logs the
+// modifications made with the value they replaced.
+func (t *Teamserver) RegistryResult(Agent *agent.Agent, RequestID uint32, Command int, Status int, Key agent.RegistryKey) error {
+	var (
+		Workspace = workspaceOrDefault(Agent.Info.Workspace)
+		Host      = strings.ToLower(Agent.Info.Hostname)
+		Now       = time.Now().Format("02/01/2006 15:04:05")
+	)
+
+	switch Command {
+
+	case agent.REGISTRY_COMMAND_QUERY:
+		if Status == agent.REGISTRY_NOT_FOUND {
+			return t.DB.RegistryValueRemove(Workspace, Host, Key.Hive, Key.Path, Key.Name)
+		}
+
+		if Status != 0 {
+			return nil
+		}
+
+		for _, Value := range Key.Values {
+			if err := t.DB.RegistryValueSet(db.RegistryRecord{
+				Workspace: Workspace, Host: Host, Hive: Key.Hive, Path: Key.Path, Name: Value.Name,
+				Type: Value.Type, Data: Value.Data, AgentID: Agent.NameID, Time: Now,
+			}); err != nil {
+				return err
+			}
+		}
+
+	case agent.REGISTRY_COMMAND_ENUM:
+		var Records []db.RegistryRecord
+
+		if Status != 0 {
+			return nil
+		}
+
+		for _, Subkey := range Key.Subkeys {
+			Records = append(Records, db.RegistryRecord{
+				Workspace: Workspace, Host: Host, Hive: Key.Hive, Path: Key.Path, Name: Subkey,
+				Subkey: true, AgentID: Agent.NameID, Time: Now,
+			})
+		}
+
+		for _, Value := range Key.Values {
+			Records = append(Records, db.RegistryRecord{
+				Workspace: Workspace, Host: Host, Hive: Key.Hive, Path: Key.Path, Name: Value.Name,
+				Type: Value.Type, Data: Value.Data, AgentID: Agent.NameID, Time: Now,
+			})
+		}
+
+		return t.DB.RegistryKeySet(Workspace, Host, Key.Hive, Key.Path, Records)
+
+	case agent.REGISTRY_COMMAND_SET, agent.REGISTRY_COMMAND_DELETE:
+		value, ok := t.RegistryChanges.LoadAndDelete(RequestID)
+		if !ok {
+			return fmt.Errorf("registry change %x not found", RequestID)
+		}
+
+		var (
+			Pending = value.(*PendingRegistry)
+			Change  = db.RegistryChange{
+				Workspace: Workspace,
+				Host:      Host,
+				AgentID:   Agent.NameID,
+				User:      Pending.User,
+				Operation: Pending.Change.Operation,
+				Hive:      Key.Hive,
+				Path:      Key.Path,
+				Name:      Key.Name,
+				View:      Pending.Change.View,
+				Type:      Pending.Change.Type,
+				Data:      Pending.Change.Data,
+				Existed:   len(Key.Values) > 0,
+				Status:    Status,
+				Time:      Now,
+			}
+		)
+
+		if Change.Existed {
+			Change.PreviousType = Key.Values[0].Type
+			Change.PreviousData = Key.Values[0].Data
+		}
+
+		if err := t.DB.RegistryChangeAdd(Change); err != nil {
+			return err
+		}
+
+		logger.Info(fmt.Sprintf("Registry value %v of %v\\%v %v by %v on agent %v [status: %v]", Key.Name, Key.Hive, Key.Path, Change.Operation, Change.User, Agent.NameID, Status))
+
+		if Status != 0 {
+			return nil
+		}
+
+		if Command == agent.REGISTRY_COMMAND_DELETE {
+			return t.DB.RegistryValueRemove(Workspace, Host, Key.Hive, Key.Path, Key.Name)
+		}
+
+		return t.DB.RegistryValueSet(db.RegistryRecord{
+			Workspace: Workspace, Host: Host, Hive: Key.Hive, Path: Key.Path, Name: Key.Name,
+			Type: Change.Type, Data: Change.Data, AgentID: Agent.NameID, Time: Now,
+		})
+
+	}
+
+	return nil
+}
+
+// RegistryRecords
+// returns the registry records of the workspace. Host limits them to a
+// host and Key (eg: HKLM\SOFTWARE\Microsoft) to the key and its subkeys.
+func (t *Teamserver) RegistryRecords(Workspace string, Info map[string]any) ([]db.RegistryRecord, error) {
+	var (
+		Host, _ = Info["Host"].(string)
+		Key, _  = Info["Key"].(string)
+		Hive    string
+		Path    string
+		Records []db.RegistryRecord
+	)
+
+	if len(Key) > 0 {
+		Index, Rest, err := agent.RegistryKeyPath(Key)
+		if err != nil {
+			return nil, err
+		}
+
+		Hive, Path = agent.RegistryHive(Index), Rest
+	}
+
+	for _, Record := range t.DB.Registry(strings.ToLower(Host), Hive, Path) {
+		if workspaceVisible(Workspace, Record.Workspace) {
+			Records = append(Records, Record)
+		}
+	}
+
+	return Records, nil
+}
+
+// RegistryChangeLog
+// a logged registry modification and the command reverting it.
+type RegistryChangeLog struct {
+	db.RegistryChange
+	Revert string
+}
+
+// RegistryCleanup
+// returns the registry modifications of the workspace, most recent
+// first, with the reg.exe commands restoring the previous values for
+// the cleanup report. Host limits them to a host.
+func (t *Teamserver) RegistryCleanup(Workspace string, Info map[string]any) []RegistryChangeLog {
+	var (
+		Host, _ = Info["Host"].(string)
+		Changes []RegistryChangeLog
+	)
+
+	for _, Change := range t.DB.RegistryChanges(strings.ToLower(Host)) {
+		if !workspaceVisible(Workspace, Change.Workspace) {
+			continue
+		}
+
+		var Log = RegistryChangeLog{RegistryChange: Change}
+
+		if Change.Status == 0 {
+			Log.Revert = registryRevert(Change)
+		}
+
+		Changes = append(Changes, Log)
+	}
+
+	return Changes
+}
+
+// registryRevert
+// returns the reg.exe command restoring the value the change replaced
+// or removing the value the change created.
+func registryRevert(Change db.RegistryChange) string {
+	var Command = "reg delete"
+
+	if Change.Existed {
+		Command = "reg add"
+	}
+
+	Command += fmt.Sprintf(" \"%v\\%v\"", Change.Hive, Change.Path)
+
+	if len(Change.Name) == 0 {
+		Command += " /ve"
+	} else {
+		Command += fmt.Sprintf(" /v \"%v\"", Change.Name)
+	}
+
+	if Change.Existed {
+		Command += fmt.Sprintf(" /t %v /d \"%v\"", Change.PreviousType, Change.PreviousData)
+	}
+
+	Command += " /f"
+
+	if len(Change.View) > 0 {
+		Command += " /reg:" + Change.View
+	}
+
+	return Command
+}
@@ -0,0 +1,196 @@
+package server
+
+import (
+	"encoding/json"
+	"time"
+
+	"Havoc/pkg/colors"
+	"Havoc/pkg/events"
+	"Havoc/pkg/logger"
+	"Havoc/pkg/packager"
+
+	"github.com/gorilla/websocket"
+)
+
+// relayEvents
+// reads the packages of a relay till its link disconnects. Every package
+// carries the id the relay knows one of its operator clients by and the
+// package of the client.
+func (t *Teamserver) relayEvents(id string) {
+	for {
+		value, ok := t.Clients.Load(id)
+		if !ok {
+			return
+		}
+
+		var link = value.(*Client)
+
+		_, Data, err := link.Connection.ReadMessage()
+		if err != nil {
+			logger.Warn("Relay <" + colors.Blue(link.Username) + "> " + colors.Red("Disconnected") + ": " + err.Error())
+			t.relayClose(id, link)
+			return
+		}
+
+		t.clientSeen(link)
+
+		var (
+			pk         = link.Packager.CreatePackage(string(Data))
+			RelayID, _ = pk.Body.Info["ClientID"].(string)
+			Package, _ = pk.Body.Info["Package"].(string)
+			ClientID   = id + "/" + RelayID
+		)
+
+		if pk.Head.Event != packager.Type.Relay.Type || len(RelayID) == 0 {
+			logger.Warn("Relay <" + colors.Blue(link.Username) + "> sent an invalid package")
+			continue
+		}
+
+		switch pk.Body.SubEvent {
+
+		case packager.Type.Relay.Connect:
+			var client = &Client{
+				GlobalIP: link.GlobalIP + " (relay " + link.Username + ")",
+				Packager: packager.NewPackager(),
+				Relay:    link,
+				RelayID:  RelayID,
+			}
+
+			client.LastSeen.Store(time.Now().UnixNano())
+
+			if _, Exists := t.Clients.LoadOrStore(ClientID, client); Exists {
+				logger.Warn("Relay <" + colors.Blue(link.Username) + "> reused the client id " + RelayID)
+				continue
+			}
+
+			if !t.clientLogin(ClientID, client, client.Packager.CreatePackage(Package)) {
+				t.relaySend(link, packager.Type.Relay.Disconnect, RelayID, nil)
+				t.Clients.Delete(ClientID)
+			}
+
+		case packager.Type.Relay.Message:
+			value, ok = t.Clients.Load(ClientID)
+			if !ok {
+				continue
+			}
+
+			var client = value.(*Client)
+
+			if client.Authenticated {
+				t.clientSeen(client)
+				t.clientEvent(ClientID, client, []byte(Package))
+			}
+
+		case packager.Type.Relay.Disconnect:
+			if value, ok = t.Clients.Load(ClientID); ok {
+				t.relayDisconnected(ClientID, value.(*Client))
+			}
+
+		}
+	}
+}
+
+// relayDisconnected
+// removes a client that disconnected from its relay.
+func (t *Teamserver) relayDisconnected(ClientID string, client *Client) {
+	if client.Authenticated && !client.Replaced.Load() {
+		logger.Warn("User <" + colors.Blue(client.Username) + "> " + colors.Red("Disconnected") + " from relay " + colors.Blue(client.Relay.Username))
+
+		t.EventAppend(events.ChatLog.UserDisconnected(client.Username))
+	}
+
+	t.RemoveClient(ClientID)
+}
+
+// relayDrop
+// tells the relay to close the connection of the client and removes it.
+func (t *Teamserver) relayDrop(ClientID string, client *Client) {
+	if err := t.relaySend(client.Relay, packager.Type.Relay.Disconnect, client.RelayID, nil); err != nil {
+		logger.Debug("Failed to drop client " + ClientID + " of the relay: " + err.Error())
+	}
+
+	t.relayDisconnected(ClientID, client)
+}
+
+// relayClose
+// closes the link of the relay and removes every client behind it.
+func (t *Teamserver) relayClose(id string, link *Client) {
+	if err := link.Connection.Close(); err != nil {
+		logger.Debug("Failed to close relay link " + id + ": " + err.Error())
+	}
+
+	t.Clients.Range(func(key, value any) bool {
+		if client := value.(*Client); client.Relay == link {
+			t.relayDisconnected(key.(string), client)
+		}
+
+		return true
+	})
+
+	t.RemoveClient(id)
+}
+
+// relaySend
+// sends a package over the link of the relay. Data is the package of
+// the client behind the relay.
+func (t *Teamserver) relaySend(link *Client, SubEvent int, RelayID string, Data []byte) error {
+	var pk = packager.Package{
+		Head: packager.Head{
+			Event: packager.Type.Relay.Type,
+			User:  link.Username,
+			Time:  time.Now().Format("02/01/2006 15:04:05"),
+		},
+		Body: packager.Body{
+			SubEvent: SubEvent,
+			Info: map[string]any{
+				"ClientID": RelayID,
+				"Package":  string(Data),
+			},
+		},
+	}
+
+	Relayed, err := json.Marshal(pk)
+	if err != nil {
+		return err
+	}
+
+	return t.linkWrite(link, Relayed)
+}
+
+// clientWrite
+// sends the encoded package to the client, either over its own
+// connection or over the link of its relay.
+func (t *Teamserver) clientWrite(ClientID string, client *Client, Data []byte) error {
+	var (
+		link = client
+		err  error
+	)
+
+	if client.Relay != nil {
+		link = client.Relay
+		err = t.relaySend(link, packager.Type.Relay.Message, client.RelayID, Data)
+	} else {
+		err = t.linkWrite(link, Data)
+	}
+
+	if err != nil {
+		/* the connection is unusable after a failed write. the reader removes the client */
+		t.clientDrop(link.ClientID, link)
+	}
+
+	return err
+}
+
+// linkWrite
+// writes a message to the websocket of a client or relay.
+func (t *Teamserver) linkWrite(link *Client, Data []byte) error {
+	link.Mutex.Lock()
+	defer link.Mutex.Unlock()
+
+	/* a half-open client would block the broadcast to everyone else */
+	if t.Keepalive.Timeout > 0 {
+		_ = link.Connection.SetWriteDeadline(time.Now().Add(t.Keepalive.Timeout))
+	}
+
+	return link.Connection.WriteMessage(websocket.BinaryMessage, Data)
+}
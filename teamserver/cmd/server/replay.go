@@ -0,0 +1,123 @@
+package server
+
+import (
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"Havoc/pkg/logger"
+	"Havoc/pkg/packager"
+)
+
+// ReplaySetup
+// configures how much of the event history gets replayed to
+// operators connecting mid engagement.
+func (t *Teamserver) ReplaySetup() {
+	var err error
+
+	t.Replay.LastID = t.DB.EventLastID()
+
+	if t.Profile.Config.Server == nil || t.Profile.Config.Server.Replay == nil {
+		return
+	}
+
+	t.Replay.Enabled = true
+	t.Replay.Window = 24 * time.Hour
+
+	if len(t.Profile.Config.Server.Replay.Window) > 0 {
+		if t.Replay.Window, err = time.ParseDuration(t.Profile.Config.Server.Replay.Window); err != nil {
+			logger.Error("Failed to parse replay window: " + err.Error() + ". Using 24h")
+			t.Replay.Window = 24 * time.Hour
+		}
+	}
+
+	logger.Debug(fmt.Sprintf("Replay window: %v (%v events from previous runs)", t.Replay.Window, t.Replay.LastID))
+}
+
+// replayIsHistory
+// history events (chat, session input/output, infra) are bound to
+// the replay window. everything else describes teamserver state
+// (listeners, etc.) and is always sent to new clients.
+func replayIsHistory(pk packager.Package) bool {
+	switch pk.Head.Event {
+
+	case packager.Type.Chat.Type, packager.Type.Session.Type, packager.Type.Infra.Type:
+		return true
+
+	}
+
+	return false
+}
+
+// replayInWindow
+// checks if the package has been created inside the replay window.
+func (t *Teamserver) replayInWindow(pk packager.Package) bool {
+	if !t.Replay.Enabled || t.Replay.Window == 0 {
+		return true
+	}
+
+	Time, err := time.ParseInLocation("02/01/2006 15:04:05", pk.Head.Time, time.Local)
+	if err != nil {
+		return true
+	}
+
+	return time.Since(Time) <= t.Replay.Window
+}
+
+// EventPersist
+// writes history events to the database so they survive restarts.
+func (t *Teamserver) EventPersist(pk packager.Package) {
+	if t.DB == nil || !replayIsHistory(pk) {
+		return
+	}
+
+	Package, err := json.Marshal(pk)
+	if err != nil {
+		logger.Error("Failed to marshal event: " + err.Error())
+		return
+	}
+
+	if err = t.DB.EventAdd(time.Now().Unix(), pk.Head.Event, pk.Body.SubEvent, pk.Head.User, string(Package)); err != nil {
+		logger.Error("Failed to persist event: " + err.Error())
+		return
+	}
+
+	t.SearchIndex(pk)
+}
+
+// ReplayHistory
+// sends the history of previous teamserver runs that is inside the replay window.
+func (t *Teamserver) ReplayHistory(ClientID string) error {
+	var (
+		Since    int64
+		Archived = t.archivedIDs()
+	)
+
+	if !t.Replay.Enabled || t.Replay.LastID == 0 {
+		return nil
+	}
+
+	if t.Replay.Window > 0 {
+		Since = time.Now().Add(-t.Replay.Window).Unix()
+	}
+
+	for _, Data := range t.DB.EventsSince(Since, t.Replay.LastID) {
+		var Package packager.Package
+
+		if err := json.Unmarshal([]byte(Data), &Package); err != nil {
+			logger.Debug("Failed to unmarshal persisted event: " + err.Error())
+			continue
+		}
+
+		/* transcripts of archived sessions are sent once they get restored */
+		if Archived[archiveSessionOf(Package)] {
+			continue
+		}
+
+		if err := t.SendEvent(ClientID, Package); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,569 @@
+package server
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"path"
+	"strconv"
+	"strings"
+	"time"
+
+	"Havoc/pkg/agent"
+	"Havoc/pkg/budget"
+	"Havoc/pkg/events"
+	"Havoc/pkg/logger"
+	"Havoc/pkg/socks"
+)
+
+const (
+	// hops get probed for their latency every interval
+	ROUTE_PROBE_INTERVAL = 30 * time.Second
+	// destination of the default route
+	ROUTE_DEFAULT = "*"
+)
+
+// RouteSetup
+// starts probing the latency of the hops of the routes.
+func (t *Teamserver) RouteSetup() {
+	t.Routes.Listeners = make(map[int]*RouteListener)
+
+	go t.Supervise("routes", func() {
+		var Ticker = time.NewTicker(ROUTE_PROBE_INTERVAL)
+		defer Ticker.Stop()
+
+		for range Ticker.C {
+			t.routeProbe()
+		}
+	})
+}
+
+// RouteAdd
+// adds the route of the destination to the routing table of the workspace
+// of the operator, or replaces the chain of the route of the destination.
+// The destination is a network (10.2.0.0/16), a host (10.2.0.5 or
+// dc01.corp.local), a domain pattern (*.corp.local) or * for everything
+// else. Hops is the chain of agents the traffic goes through, starting at
+// the agent connected to the teamserver, every other one linked to the
+// one before (eg: "a1b2c3d4,e5f6a7b8"). The last one connects to the
+// destination.
+func (t *Teamserver) RouteAdd(User string, Info map[string]any) (*Route, error) {
+	var (
+		Destination, _ = Info["Destination"].(string)
+		Hops, _        = Info["Hops"].(string)
+		Route          = &Route{
+			ID:        randomID(),
+			Workspace: t.UserWorkspace(User),
+			User:      User,
+			Time:      time.Now().Format("02/01/2006 15:04:05"),
+		}
+		err error
+	)
+
+	if Route.Destination, err = routeDestination(Destination); err != nil {
+		return nil, err
+	}
+
+	Route.Hops = strings.FieldsFunc(Hops, func(r rune) bool {
+		return r == ',' || r == ' ' || r == '-' || r == '>'
+	})
+
+	if len(Route.Hops) == 0 {
+		return nil, errors.New("the chain needs at least one agent")
+	}
+
+	if _, err = t.routeChain(Route); err != nil {
+		return nil, err
+	}
+
+	t.Routes.Lock()
+
+	var Replaced = false
+
+	for i, Existing := range t.Routes.Table {
+		if Existing.Workspace == Route.Workspace && Existing.Destination == Route.Destination {
+			Route.ID = Existing.ID
+			t.Routes.Table[i] = Route
+			Replaced = true
+			break
+		}
+	}
+
+	if !Replaced {
+		t.Routes.Table = append(t.Routes.Table, Route)
+	}
+
+	t.Routes.Unlock()
+
+	logger.Info(fmt.Sprintf("Route %v to %v through %v added by %v", Route.ID, Route.Destination, strings.Join(Route.Hops, " -> "), User))
+
+	/* the hops of a new chain get measured right away */
+	t.routeProbe()
+
+	return Route, nil
+}
+
+// RouteRemove
+// removes the route from the routing table of the workspace.
+func (t *Teamserver) RouteRemove(User, ID string) error {
+	var Workspace = t.UserWorkspace(User)
+
+	t.Routes.Lock()
+	defer t.Routes.Unlock()
+
+	for i, Route := range t.Routes.Table {
+		if Route.ID == ID && workspaceVisible(Workspace, Route.Workspace) {
+			t.Routes.Table = append(t.Routes.Table[:i], t.Routes.Table[i+1:]...)
+
+			logger.Info(fmt.Sprintf("Route %v to %v removed by %v", ID, Route.Destination, User))
+
+			return nil
+		}
+	}
+
+	return errors.New("route " + ID + " not found")
+}
+
+// RouteList
+// returns the routes of the workspace with the latency of their hops.
+func (t *Teamserver) RouteList(Workspace string) []RouteInfo {
+	var Routes = []RouteInfo{}
+
+	t.Routes.Lock()
+	defer t.Routes.Unlock()
+
+	for _, Route := range t.Routes.Table {
+		if !workspaceVisible(Workspace, Route.Workspace) {
+			continue
+		}
+
+		var (
+			Info     = RouteInfo{Route: *Route}
+			Previous = int64(0)
+		)
+
+		if _, err := t.routeChain(Route); err != nil {
+			Info.Broken = err.Error()
+		}
+
+		for _, ID := range Route.Hops {
+			var Hop = RouteHop{AgentID: ID, RoundTrip: -1, Latency: -1}
+
+			if Agent := t.Agents.Get(ID); Agent != nil {
+				var RoundTrip, Measured, Pending = Agent.RoundTrip()
+
+				Hop.Active = Agent.Active
+
+				if Agent.Info != nil {
+					Hop.Hostname = Agent.Info.Hostname
+				}
+
+				if !Measured.IsZero() {
+					Hop.RoundTrip = RoundTrip.Milliseconds()
+					Hop.Measured = Measured.Format("02/01/2006 15:04:05")
+				}
+
+				if !Pending.IsZero() {
+					Hop.Pending = Pending.Format("02/01/2006 15:04:05")
+				}
+			}
+
+			/* the round trip of a hop includes the ones before */
+			if Hop.RoundTrip >= 0 && Previous >= 0 {
+				Hop.Latency = max(Hop.RoundTrip-Previous, 0)
+			}
+
+			Previous = Hop.RoundTrip
+
+			Info.Path = append(Info.Path, Hop)
+		}
+
+		Routes = append(Routes, Info)
+	}
+
+	return Routes
+}
+
+// RouteListeners
+// returns the socks proxies and port forwards of the workspace.
+func (t *Teamserver) RouteListeners(Workspace string) []RouteListener {
+	var Listeners = []RouteListener{}
+
+	t.Routes.Lock()
+	defer t.Routes.Unlock()
+
+	for _, Listener := range t.Routes.Listeners {
+		if workspaceVisible(Workspace, Listener.Workspace) {
+			Listeners = append(Listeners, RouteListener{
+				Port:      Listener.Port,
+				Target:    Listener.Target,
+				Workspace: Listener.Workspace,
+				User:      Listener.User,
+				Time:      Listener.Time,
+			})
+		}
+	}
+
+	return Listeners
+}
+
+// RouteListen
+// opens the port on the teamserver. Without a target it's a socks5 proxy
+// that connects to every destination through the chain of its route,
+// with a target (host:port) it forwards the connections to the target
+// through the chain of the route of the target.
+func (t *Teamserver) RouteListen(User string, Port int, Target string) (*RouteListener, error) {
+	var (
+		Listener = &RouteListener{
+			Port:      Port,
+			Target:    Target,
+			Workspace: t.UserWorkspace(User),
+			User:      User,
+			Time:      time.Now().Format("02/01/2006 15:04:05"),
+		}
+		Name   = "route " + strconv.Itoa(Port)
+		Header socks.SocksHeader
+		err    error
+	)
+
+	if Port < 1 || Port > 65535 {
+		return nil, errors.New("invalid port " + strconv.Itoa(Port))
+	}
+
+	if len(Target) > 0 {
+		if Header, err = routeHeader(Target); err != nil {
+			return nil, err
+		}
+	}
+
+	t.Routes.Lock()
+	defer t.Routes.Unlock()
+
+	if _, ok := t.Routes.Listeners[Port]; ok {
+		return nil, errors.New("port " + strconv.Itoa(Port) + " is routed already")
+	}
+
+	if Listener.listener, err = net.Listen("tcp", "0.0.0.0:"+strconv.Itoa(Port)); err != nil {
+		return nil, err
+	}
+
+	/* the proxy keeps track of the sockets of its clients */
+	if len(Target) == 0 {
+		Listener.socks = socks.NewSocks("0.0.0.0:" + strconv.Itoa(Port))
+	}
+
+	var Handler = agent.SocksHandler(t, Name, func(Header socks.SocksHeader) *agent.Agent {
+		return t.routeExit(Listener, routeHost(Header))
+	})
+
+	Listener.listener = t.Budget(budget.PIVOTS).Listener(Listener.listener)
+
+	t.Routes.Listeners[Port] = Listener
+
+	go t.Supervise(Name, func() {
+		defer Listener.listener.Close()
+
+		for {
+			Conn, err := Listener.listener.Accept()
+			if err != nil {
+				return
+			}
+
+			if Listener.socks != nil {
+				go Handler(Listener.socks, Conn)
+				continue
+			}
+
+			var Exit = t.routeExit(Listener, routeHost(Header))
+			if Exit == nil {
+				Conn.Close()
+				continue
+			}
+
+			if SocketID, ok := Exit.SocksConnect(t, Name, Conn, Header, true); ok {
+				t.Routes.Lock()
+				Listener.clients = append(Listener.clients, SocketID)
+				t.Routes.Unlock()
+			}
+		}
+	})
+
+	if len(Target) == 0 {
+		logger.Info(fmt.Sprintf("Route socks proxy on port %v opened by %v", Port, User))
+	} else {
+		logger.Info(fmt.Sprintf("Route port forward %v -> %v opened by %v", Port, Target, User))
+	}
+
+	return Listener, nil
+}
+
+// RouteClose
+// closes the socks proxy or port forward on the port and the connections
+// of its clients.
+func (t *Teamserver) RouteClose(User string, Port int) error {
+	t.Routes.Lock()
+
+	Listener, ok := t.Routes.Listeners[Port]
+	if !ok || !workspaceVisible(t.UserWorkspace(User), Listener.Workspace) {
+		t.Routes.Unlock()
+		return errors.New("port " + strconv.Itoa(Port) + " isn't routed")
+	}
+
+	delete(t.Routes.Listeners, Port)
+
+	var Clients = Listener.clients
+
+	if Listener.socks != nil {
+		Clients = append(Clients, Listener.socks.Clients...)
+	}
+
+	t.Routes.Unlock()
+
+	Listener.listener.Close()
+
+	for _, Agent := range t.Agents.List() {
+		for _, SocketID := range Clients {
+			if Agent.SocksClientGet(int(SocketID)) == nil {
+				continue
+			}
+
+			Agent.SocksClientClose(SocketID)
+			Agent.AddJobToQueue(agent.Job{
+				Command: agent.COMMAND_SOCKET,
+				Data:    []any{agent.SOCKET_COMMAND_CLOSE, SocketID},
+			})
+		}
+	}
+
+	logger.Info(fmt.Sprintf("Route port %v closed by %v", Port, User))
+
+	return nil
+}
+
+// routeExit
+// returns the agent connecting to the host for the listener, nil if the
+// workspace has no route to it or its chain is broken.
+func (t *Teamserver) routeExit(Listener *RouteListener, Host string) *agent.Agent {
+	var Route, Score = (*Route)(nil), -1
+
+	t.Routes.Lock()
+
+	for _, Candidate := range t.Routes.Table {
+		if !workspaceVisible(Listener.Workspace, Candidate.Workspace) {
+			continue
+		}
+
+		if Matched := routeScore(Candidate.Destination, Host); Matched > Score {
+			Route, Score = Candidate, Matched
+		}
+	}
+
+	t.Routes.Unlock()
+
+	if Route == nil {
+		logger.Warn(fmt.Sprintf("Route port %v: no route to %v", Listener.Port, Host))
+		return nil
+	}
+
+	Chain, err := t.routeChain(Route)
+	if err != nil {
+		logger.Warn(fmt.Sprintf("Route port %v: route %v to %v is broken: %v", Listener.Port, Route.ID, Host, err))
+		return nil
+	}
+
+	return Chain[len(Chain)-1]
+}
+
+// routeChain
+// returns the agents of the chain of the route. The traffic of a linked
+// agent goes through its parents, so the chain has to follow the links.
+func (t *Teamserver) routeChain(Route *Route) ([]*agent.Agent, error) {
+	var Chain []*agent.Agent
+
+	for i, ID := range Route.Hops {
+		var Agent = t.Agents.Get(ID)
+
+		if Agent == nil || Agent.Info == nil || !workspaceVisible(Route.Workspace, Agent.Info.Workspace) {
+			return nil, errors.New("agent " + ID + " not found")
+		}
+
+		if !Agent.Active {
+			return nil, errors.New("agent " + ID + " is dead")
+		}
+
+		if Agent.Info.MagicValue != agent.DEMON_MAGIC_VALUE {
+			return nil, errors.New("agent " + ID + " can't carry socks traffic")
+		}
+
+		if i == 0 && Agent.Pivots.Parent != nil {
+			return nil, fmt.Errorf("agent %v is reached through agent %v, start the chain at the agent connected to the teamserver", ID, Agent.Pivots.Parent.NameID)
+		}
+
+		if i > 0 && Agent.Pivots.Parent != Chain[i-1] {
+			return nil, fmt.Errorf("agent %v isn't linked to agent %v", ID, Chain[i-1].NameID)
+		}
+
+		Chain = append(Chain, Agent)
+	}
+
+	return Chain, nil
+}
+
+// routeProbe
+// probes the round trip of the hops of every route and sends the clients
+// the routes with the latencies measured since the last probe.
+func (t *Teamserver) routeProbe() {
+	var Probed = make(map[string]bool)
+
+	t.Routes.Lock()
+
+	for _, Route := range t.Routes.Table {
+		for _, ID := range Route.Hops {
+			if Probed[ID] {
+				continue
+			}
+
+			Probed[ID] = true
+
+			if Agent := t.Agents.Get(ID); Agent != nil && Agent.Active && Agent.Info != nil && Agent.Info.MagicValue == agent.DEMON_MAGIC_VALUE {
+				Agent.LatencyProbe()
+			}
+		}
+	}
+
+	t.Routes.Unlock()
+
+	if len(Probed) > 0 {
+		t.routesSend("")
+	}
+}
+
+// routesSend
+// sends the routes and the proxies of their workspace to every client of
+// the user, or to every client if the user is empty.
+func (t *Teamserver) routesSend(User string) {
+	t.Clients.Range(func(key, value any) bool {
+		var client = value.(*Client)
+
+		if !client.Authenticated || (len(User) > 0 && client.Username != User) {
+			return true
+		}
+
+		if err := t.SendEvent(key.(string), events.Routes.List(t.RouteList(client.Workspace), t.RouteListeners(client.Workspace))); err != nil {
+			logger.Error("Failed to send Event: " + err.Error())
+		}
+
+		return true
+	})
+}
+
+// routeDestination
+// validates and normalizes the destination of a route.
+func routeDestination(Destination string) (string, error) {
+	Destination = strings.ToLower(strings.TrimSpace(Destination))
+
+	switch {
+
+	case len(Destination) == 0:
+		return "", errors.New("destination is required")
+
+	case Destination == ROUTE_DEFAULT || Destination == "default":
+		return ROUTE_DEFAULT, nil
+
+	case strings.Contains(Destination, "/"):
+		_, Network, err := net.ParseCIDR(Destination)
+		if err != nil {
+			return "", errors.New("invalid network " + Destination)
+		}
+
+		return Network.String(), nil
+
+	case strings.ContainsAny(Destination, " ,:") && net.ParseIP(Destination) == nil:
+		return "", errors.New("invalid destination " + Destination)
+
+	}
+
+	if _, err := path.Match(Destination, ""); err != nil {
+		return "", errors.New("invalid destination pattern " + Destination)
+	}
+
+	return Destination, nil
+}
+
+// routeScore
+// returns how specific the destination matches the host, -1 if it
+// doesn't. The most specific route wins: the host itself, then domain
+// patterns, then the smallest network, then the default route.
+func routeScore(Destination, Host string) int {
+	Host = strings.ToLower(Host)
+
+	switch {
+
+	case Destination == Host:
+		return 1000
+
+	case Destination == ROUTE_DEFAULT:
+		return 0
+
+	case strings.Contains(Destination, "/"):
+		var IP = net.ParseIP(Host)
+
+		if _, Network, err := net.ParseCIDR(Destination); err == nil && IP != nil && Network.Contains(IP) {
+			var Ones, _ = Network.Mask.Size()
+
+			return 1 + Ones
+		}
+
+	case strings.ContainsAny(Destination, "*?["):
+		if Matched, _ := path.Match(Destination, Host); Matched {
+			return 500 + len(Destination)
+		}
+
+	}
+
+	return -1
+}
+
+// routeHeader
+// returns the socks header of the connect to the target (host:port) of a
+// port forward.
+func routeHeader(Target string) (socks.SocksHeader, error) {
+	var Header = socks.SocksHeader{Command: socks.ConnectCommand}
+
+	Host, Port, err := net.SplitHostPort(Target)
+	if err != nil {
+		return Header, errors.New("invalid target " + Target + ", expected host:port")
+	}
+
+	Number, err := strconv.Atoi(Port)
+	if err != nil || Number < 1 || Number > 65535 {
+		return Header, errors.New("invalid port of target " + Target)
+	}
+
+	Header.Port = uint16(Number)
+
+	switch IP := net.ParseIP(Host); {
+
+	case IP != nil && IP.To4() != nil:
+		Header.ATYP, Header.IpDomain = socks.IPv4, IP.To4()
+
+	case IP != nil:
+		Header.ATYP, Header.IpDomain = socks.IPv6, IP.To16()
+
+	default:
+		Header.ATYP, Header.IpDomain = socks.FQDN, []byte(Host)
+
+	}
+
+	return Header, nil
+}
+
+// routeHost
+// returns the host of the destination of the socks header.
+func routeHost(Header socks.SocksHeader) string {
+	if Header.ATYP == socks.FQDN {
+		return string(Header.IpDomain)
+	}
+
+	return net.IP(Header.IpDomain).String()
+}
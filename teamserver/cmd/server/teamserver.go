@@ -3,16 +3,19 @@ package server
 import "C"
 import (
 	"Havoc/pkg/agent"
+	"Havoc/pkg/auth"
 	"Havoc/pkg/common/certs"
 	"Havoc/pkg/db"
+	"Havoc/pkg/eventbus"
 	"Havoc/pkg/service"
 	"Havoc/pkg/webhook"
 	"bytes"
-	"encoding/hex"
+	"crypto/tls"
 	"encoding/json"
 	"errors"
 	"fmt"
 	"io"
+	"net"
 	"net/http"
 	"os"
 	"os/exec"
@@ -22,12 +25,12 @@ import (
 
 	"github.com/gin-gonic/gin"
 	"github.com/gorilla/websocket"
-	"golang.org/x/crypto/sha3"
 
 	"Havoc/pkg/colors"
 	"Havoc/pkg/common"
 	"Havoc/pkg/events"
 	"Havoc/pkg/handlers"
+	"Havoc/pkg/keyring"
 	"Havoc/pkg/logger"
 	"Havoc/pkg/packager"
 	"Havoc/pkg/profile"
@@ -39,9 +42,30 @@ func NewTeamserver(DatabasePath string) *Teamserver {
 		logger.Error("Failed to create a new db: " + err.Error())
 		return nil
 	} else {
-		return &Teamserver{
-			DB: d,
+		var Teamserver = &Teamserver{
+			DB:  d,
+			Bus: eventbus.NewBus(),
 		}
+
+		/* a new db gets created by the migrations */
+		if d.Existed() {
+			for _, Migration := range d.Migrated() {
+				logger.Info(fmt.Sprintf("Migrated database to version %v: %v", Migration.Version, Migration.Description))
+			}
+		}
+
+		Teamserver.Bus.Supervise = Teamserver.Supervise
+
+		/* in order with the events sent to single clients */
+		Teamserver.Bus.SubscribeSync("operators", eventbus.ConsumerFunc(Teamserver.broadcast), eventbus.OPERATOR_PACKAGE)
+
+		Teamserver.Batches.Tasks = make(map[string]*BatchTask)
+		Teamserver.Bus.SubscribeSync("batches", eventbus.ConsumerFunc(Teamserver.batchComplete), eventbus.TASK_COMPLETE)
+
+		Teamserver.Sprays.Tasks = make(map[string]*SprayAttempt)
+		Teamserver.Bus.SubscribeSync("sprays", eventbus.ConsumerFunc(Teamserver.sprayComplete), eventbus.TASK_COMPLETE)
+
+		return Teamserver
 	}
 }
 
@@ -53,7 +77,7 @@ func (t *Teamserver) Start() {
 	logger.Debug("Starting teamserver...")
 	var (
 		ServerFinished      chan bool
-		TeamserverWs        string
+		TeamserverWs        []string
 		TeamserverPath, err = os.Getwd()
 		ListenerCount       int
 		KillDate            int64
@@ -64,6 +88,13 @@ func (t *Teamserver) Start() {
 		return
 	}
 
+	/* before anything gets opened. the paths are from the new root if it chroots */
+	if TeamserverPath, err = t.PrivilegesSetup(TeamserverPath); err != nil {
+		logger.SetStdOut(os.Stderr)
+		logger.Error("Failed to set up dropping the privileges: " + err.Error())
+		return
+	}
+
 	if t.Flags.Server.Host == "" {
 		t.Flags.Server.Host = t.Profile.ServerHost()
 	}
@@ -74,13 +105,17 @@ func (t *Teamserver) Start() {
 
 	gin.SetMode(gin.ReleaseMode)
 	t.Server.Engine = gin.New()
+	t.Server.Started = time.Now()
+	t.Server.Engine.Use(t.requestRecovery)
+
+	t.ProxySetup()
 
-	t.Server.Engine.GET("/", func(context *gin.Context) {
-		context.Redirect(http.StatusMovedPermanently, "home/")
+	t.Server.Engine.GET(t.ProxyPath("/"), func(context *gin.Context) {
+		context.Redirect(http.StatusMovedPermanently, t.ProxyPath("/home/"))
 	})
 
 	// Catch me if you can
-	t.Server.Engine.GET("/havoc/", func(context *gin.Context) {
+	t.Server.Engine.GET(t.ProxyPath("/havoc/"), func(context *gin.Context) {
 
 		var (
 			upgrade   websocket.Upgrader
@@ -93,34 +128,76 @@ func (t *Teamserver) Start() {
 			return
 		}
 
-		t.Clients.Store(ClientID,
-			&Client{
-				Username:      "",
-				GlobalIP:      WebSocket.RemoteAddr().String(),
-				Connection:    WebSocket,
-				ClientVersion: "",
-				Packager:      packager.NewPackager(),
-				Authenticated: false,
-			})
+		var client = &Client{
+			Username:      "",
+			GlobalIP:      WebSocket.RemoteAddr().String(),
+			Connection:    WebSocket,
+			ClientVersion: "",
+			Packager:      packager.NewPackager(),
+			Authenticated: false,
+		}
+
+		if client.Host, _, err = net.SplitHostPort(context.Request.Host); err != nil {
+			client.Host = context.Request.Host
+		}
+
+		/* the address the proxy forwarded instead of the one of the proxy */
+		if t.Proxy.Trusted {
+			client.GlobalIP = context.ClientIP()
+		}
+
+		/* a client that doesn't authenticate or answer the pings in time gets dropped */
+		t.clientKeepalive(client)
+
+		t.Clients.Store(ClientID, client)
 
 		// Handle connections in a new goroutine.
 		go t.handleRequest(ClientID)
 	})
 
-	// TODO: pass this as a profile/command line flag
-	t.Server.Engine.Static("/home", "./bin/static")
+	if t.Profile.Config.Server != nil && t.Profile.Config.Server.GraphQL {
+		t.Server.Engine.POST(t.ProxyPath("/havoc/graphql"), t.GraphQL)
+		logger.Info("GraphQL endpoint enabled: " + t.ProxyPath("/havoc/graphql"))
+	}
 
-	t.Server.Engine.POST("/:endpoint", func(context *gin.Context) {
-		var endpoint = context.Request.RequestURI[1:]
+	if t.Profile.Config.Server != nil && t.Profile.Config.Server.Metrics {
+		t.Server.Engine.GET(t.ProxyPath("/havoc/metrics"), t.Metrics)
+		logger.Info("Metrics endpoint enabled: " + t.ProxyPath("/havoc/metrics"))
+	}
 
-		if len(t.Endpoints) > 0 {
-			for i := range t.Endpoints {
-				if t.Endpoints[i].Endpoint == endpoint {
-					t.Endpoints[i].Function(context)
-				}
-			}
-		}
-	})
+	if t.Profile.Config.Server != nil && t.Profile.Config.Server.Panel {
+		t.Server.Engine.GET(t.ProxyPath("/havoc/panel/"), t.Panel)
+		logger.Info("Admin panel enabled: " + t.ProxyPath("/havoc/panel/"))
+	}
+
+	if t.Profile.Config.Server != nil && t.Profile.Config.Server.Pprof {
+		t.Server.Engine.Any(t.ProxyPath("/havoc/debug/pprof/*profile"), t.Pprof)
+		logger.Warn("Diagnostic endpoint enabled: " + t.ProxyPath("/havoc/debug/pprof/"))
+	}
+
+	if t.Profile.Config.Server != nil && t.Profile.Config.Server.Capture {
+		t.Server.Engine.GET(t.ProxyPath("/havoc/capture/:listener"), t.Capture)
+		logger.Warn("Diagnostic endpoint enabled: " + t.ProxyPath("/havoc/capture/"))
+	}
+
+	if t.Profile.Config.Server != nil && t.Profile.Config.Server.Pivots {
+		t.Server.Engine.GET(t.ProxyPath("/havoc/pivots/:format"), t.Pivots)
+		logger.Info("Pivots endpoint enabled: " + t.ProxyPath("/havoc/pivots/"))
+	}
+
+	if t.Profile.Config.Server != nil && t.Profile.Config.Server.Ingest {
+		t.Server.Engine.POST(t.ProxyPath("/havoc/ingest/hash"), t.IngestHash)
+		t.Server.Engine.POST(t.ProxyPath("/havoc/ingest/session"), t.IngestSession)
+		t.Server.Engine.POST(t.ProxyPath("/havoc/ingest/session/close"), t.IngestSessionClose)
+		logger.Info("Ingest endpoints enabled: " + t.ProxyPath("/havoc/ingest/"))
+	}
+
+	t.Server.Engine.GET(agent.TransferURL("*path"), t.Transfer)
+
+	// TODO: pass this as a profile/command line flag
+	t.Server.Engine.Static(t.ProxyPath("/home"), "./bin/static")
+
+	t.Server.Engine.POST("/:endpoint", t.EndpointRequest)
 
 	// start the teamserver websocket connection
 	go func(Host, Port string) {
@@ -130,29 +207,68 @@ func (t *Teamserver) Start() {
 
 			Cert []byte
 			Key  []byte
+
+			/* only the agent facing endpoints if the operator api is served apart */
+			Public http.Handler = t.Server.Engine
 		)
 
-		Cert, Key, err = certs.HTTPSGenerateRSACertificate(Host)
-		if err != nil {
-			logger.Error("Failed to generate server certificates: " + err.Error())
-			os.Exit(0)
+		if t.ManagementSplit() {
+			Public = t.ManagementPublic()
 		}
 
-		err = os.WriteFile(certPath, Cert, 0644)
-		if err != nil {
-			logger.Error("Couldn't save server cert file: " + err.Error())
-			os.Exit(0)
-		}
+		/* tls gets terminated by the proxy in front */
+		if t.Proxy.PlainHTTP {
+			var Server = &http.Server{
+				Addr:              Host + ":" + Port,
+				Handler:           Public,
+				ReadHeaderTimeout: 30 * time.Second,
+			}
 
-		err = os.WriteFile(keyPath, Key, 0644)
-		if err != nil {
-			logger.Error("Couldn't save server cert file: " + err.Error())
-			os.Exit(0)
-		}
+			if err = Server.ListenAndServe(); err != nil {
+				logger.Error("Failed to start websocket: " + err.Error())
+			}
+		} else if t.Profile.Config.Server != nil && t.Profile.Config.Server.Cert != nil {
+			// certificate of the profile (path, or pem resolved from a keystore)
+			KeyPair, err := certs.KeyPair(t.Profile.Config.Server.Cert.Cert, t.Profile.Config.Server.Cert.Key)
+			if err != nil {
+				logger.Error("Failed to load server certificates: " + err.Error())
+				os.Exit(0)
+			}
+
+			var Server = &http.Server{
+				Addr:              Host + ":" + Port,
+				Handler:           Public,
+				TLSConfig:         &tls.Config{Certificates: []tls.Certificate{KeyPair}},
+				ReadHeaderTimeout: 30 * time.Second,
+			}
+
+			// start the teamserver
+			if err = Server.ListenAndServeTLS("", ""); err != nil {
+				logger.Error("Failed to start websocket: " + err.Error())
+			}
+		} else {
+			Cert, Key, err = certs.HTTPSGenerateRSACertificate(Host)
+			if err != nil {
+				logger.Error("Failed to generate server certificates: " + err.Error())
+				os.Exit(0)
+			}
+
+			err = os.WriteFile(certPath, Cert, 0644)
+			if err != nil {
+				logger.Error("Couldn't save server cert file: " + err.Error())
+				os.Exit(0)
+			}
+
+			err = os.WriteFile(keyPath, Key, 0644)
+			if err != nil {
+				logger.Error("Couldn't save server cert file: " + err.Error())
+				os.Exit(0)
+			}
 
-		// start the teamserver
-		if err = t.Server.Engine.RunTLS(Host+":"+Port, certPath, keyPath); err != nil {
-			logger.Error("Failed to start websocket: " + err.Error())
+			// start the teamserver
+			if err = http.ListenAndServeTLS(Host+":"+Port, certPath, keyPath, Public); err != nil {
+				logger.Error("Failed to start websocket: " + err.Error())
+			}
 		}
 
 		ServerFinished <- true
@@ -163,9 +279,16 @@ func (t *Teamserver) Start() {
 	t.WebHooks = webhook.NewWebHook()
 	t.Listeners = []*Listener{}
 
-	TeamserverWs = "wss://" + t.Flags.Server.Host + ":" + t.Flags.Server.Port
+	TeamserverWs = []string{"wss://" + t.Flags.Server.Host + ":" + t.Flags.Server.Port}
+	if t.Proxy.PlainHTTP {
+		TeamserverWs = []string{"ws://" + t.Flags.Server.Host + ":" + t.Flags.Server.Port}
+	}
 
-	logger.Info("Starting Teamserver on " + colors.BlueUnderline(TeamserverWs))
+	if t.ManagementSplit() {
+		TeamserverWs = t.ManagementStart()
+	} else {
+		logger.Info("Starting Teamserver on " + colors.BlueUnderline(TeamserverWs[0]+t.ProxyPath("/havoc/")))
+	}
 
 	/* if we specified a webhook then lets use it. */
 	if t.Profile.Config.WebHook != nil {
@@ -187,6 +310,103 @@ func (t *Teamserver) Start() {
 				t.WebHooks.SetDiscord(AvatarUrl, UserName, t.Profile.Config.WebHook.Discord.WebHook)
 			}
 		}
+
+		t.Bus.Subscribe("webhooks", t.WebHooks, eventbus.SESSION_NEW)
+
+		/* mail the critical events to the team */
+		if t.Profile.Config.WebHook.Smtp != nil {
+			var (
+				Config  = t.Profile.Config.WebHook.Smtp
+				Options = webhook.SmtpOptions{
+					Host:     Config.Host,
+					Port:     Config.Port,
+					TLS:      Config.TLS,
+					Insecure: Config.Insecure,
+					Username: Config.Username,
+					Password: Config.Password,
+					From:     Config.From,
+					To:       Config.To,
+					Subject:  Config.Subject,
+					Body:     Config.Body,
+				}
+				Events = Config.Events
+			)
+
+			if len(Events) == 0 {
+				Events = webhook.SmtpEvents
+			}
+
+			/* a route subscribes to its event */
+			for _, Route := range Config.Routes {
+				Options.Routes = append(Options.Routes, webhook.SmtpRoute{Event: Route.Event, To: Route.To, Subject: Route.Subject, Body: Route.Body})
+				Events = append(Events, Route.Event)
+			}
+
+			if Smtp, err := webhook.NewSmtp(Options); err != nil {
+				logger.Error("Failed to set up smtp alerts: " + err.Error())
+			} else {
+				Smtp.Summary = notifySummary
+
+				/* a mail that didn't go out is an alert that got lost */
+				t.Bus.Subscribe("smtp", eventbus.ConsumerFunc(func(Event eventbus.Event) error {
+					if err := Smtp.Consume(Event); err != nil {
+						logger.Error(fmt.Sprintf("Failed to mail %v: %v", Event.Type, err))
+					}
+					return nil
+				}), Events...)
+				logger.Info("Mailing events through " + net.JoinHostPort(Config.Host, strconv.Itoa(Smtp.Options.Port)))
+			}
+		}
+	}
+
+	/* forward the events to syslog */
+	if t.Profile.Config.Server.Syslog != nil {
+		var Config = t.Profile.Config.Server.Syslog
+
+		if Syslog, err := eventbus.NewSyslog(Config.Address, Config.Tag); err != nil {
+			logger.Error("Failed to connect to syslog: " + err.Error())
+		} else {
+			t.Bus.Subscribe("syslog", Syslog, Config.Events...)
+			logger.Info("Forwarding events to syslog " + Config.Address)
+		}
+	}
+
+	/* export the events to the pipelines of the team */
+	if t.Profile.Config.Server.Nats != nil {
+		var Config = t.Profile.Config.Server.Nats
+
+		if Nats, err := eventbus.NewNats(eventbus.ExportOptions{
+			Servers:  Config.Servers,
+			Subject:  Config.Subject,
+			Username: Config.User,
+			Password: Config.Password,
+			Token:    Config.Token,
+			TLS:      Config.TLS,
+			CACert:   Config.CACert,
+		}); err != nil {
+			logger.Error("Failed to connect to nats: " + err.Error())
+		} else {
+			t.Bus.Subscribe("nats", Nats, Config.Events...)
+			logger.Info("Exporting events to nats subject " + Nats.Options.Subject)
+		}
+	}
+
+	if t.Profile.Config.Server.Kafka != nil {
+		var Config = t.Profile.Config.Server.Kafka
+
+		if Kafka, err := eventbus.NewKafka(eventbus.ExportOptions{
+			Servers:  Config.Brokers,
+			Subject:  Config.Topic,
+			Username: Config.Username,
+			Password: Config.Password,
+			TLS:      Config.TLS,
+			CACert:   Config.CACert,
+		}); err != nil {
+			logger.Error("Failed to connect to kafka: " + err.Error())
+		} else {
+			t.Bus.Subscribe("kafka", Kafka, Config.Events...)
+			logger.Info("Exporting events to kafka topic " + Kafka.Options.Subject)
+		}
 	}
 
 	// start teamserver service
@@ -199,13 +419,21 @@ func (t *Teamserver) Start() {
 		t.Service.Config = *t.Profile.Config.Service
 
 		if len(t.Service.Config.Endpoint) > 0 {
+			t.Bus.Subscribe("service", t.Service)
 			t.Service.Start()
-			logger.Info(fmt.Sprintf("%v starting service handle on %v", "["+colors.BoldWhite("SERVICE")+"]", colors.BlueUnderline(TeamserverWs+"/"+t.Service.Config.Endpoint)))
+			for _, Url := range TeamserverWs {
+				logger.Info(fmt.Sprintf("%v starting service handle on %v", "["+colors.BoldWhite("SERVICE")+"]", colors.BlueUnderline(Url+"/"+t.Service.Config.Endpoint)))
+			}
 		} else {
 			logger.Error("Teamserver service error: Endpoint not specified")
 		}
 	}
 
+	/* the session keys of the agents are kept wrapped with it in memory */
+	if err = keyring.Setup(); err != nil {
+		logger.Warn("Session keys are wrapped in memory but their master key might end up in swap or a core dump: " + err.Error())
+	}
+
 	/* now load up our db or start a new one if none exist */
 	DBPath := t.DB.Path()
 	if t.DB, err = db.DatabaseNew(TeamserverPath + "/" + DBPath); err != nil {
@@ -220,6 +448,33 @@ func (t *Teamserver) Start() {
 		logger.Info("Creates new database: " + colors.Blue(DBPath))
 	}
 
+	if err = t.StorageSetup(); err != nil {
+		logger.SetStdOut(os.Stderr)
+		logger.Error("Failed to set up the storage: " + err.Error())
+		return
+	}
+
+	/* after the storage so the journal gets sealed */
+	t.JournalSetup(TeamserverPath + "/" + DBPath)
+
+	t.InfraLoad()
+	t.AuthSetup()
+	t.ReplaySetup()
+	t.KeepaliveSetup()
+	t.OutputSetup()
+	t.ExfilSetup()
+	t.InboundSetup()
+	t.BudgetSetup()
+	t.SearchSetup()
+	t.BlocklistSetup()
+	t.UploadSetup()
+	t.SecretScanSetup()
+	t.ApprovalSetup()
+	t.ScheduleSetup()
+	t.NotifySetup()
+	t.RouteSetup()
+	t.ListenerEphemeralSetup()
+
 	ListenerCount = t.DB.ListenerCount()
 
 	/* start listeners from the specified yaotl profile */
@@ -254,18 +509,34 @@ func (t *Teamserver) Start() {
 				Uris:         listener.Uris,
 				Secure:       listener.Secure,
 				HostHeader:   listener.HostHeader,
+				HostHeaders:  listener.HostHeaders,
+				Workspace:    listener.Workspace,
+				ServerNames:  listener.ServerNames,
+			}
+
+			if len(listener.HostHeaders) > len(listener.Hosts) {
+				logger.Error("Listener '" + listener.Name + "' has more HostHeaders than Hosts")
+				return
+			}
+
+			switch listener.HostRotation {
+			case "round-robin", "random", "failover":
+				break
+
+			default:
+				logger.Warn("Unknown HostRotation '" + listener.HostRotation + "' for listener '" + listener.Name + "'. Using random")
 			}
 
 			if listener.Cert != nil {
 				var Found = true
 
-				if _, err = os.Stat(listener.Cert.Cert); !os.IsNotExist(err) {
+				if certs.Exists(listener.Cert.Cert) {
 					HandlerData.Cert.Cert = listener.Cert.Cert
 				} else {
 					Found = false
 				}
 
-				if _, err = os.Stat(listener.Cert.Key); !os.IsNotExist(err) {
+				if certs.Exists(listener.Cert.Key) {
 					HandlerData.Cert.Key = listener.Cert.Key
 				} else {
 					Found = false
@@ -280,6 +551,79 @@ func (t *Teamserver) Start() {
 				HandlerData.Response.Headers = listener.Response.Headers
 			}
 
+			if listener.Probe != nil {
+				HandlerData.Probe = &handlers.HTTPProbe{
+					Uris:       listener.Probe.Uris,
+					UserAgents: listener.Probe.UserAgents,
+					Sources:    listener.Probe.Sources,
+					Status:     listener.Probe.Status,
+					Headers:    listener.Probe.Headers,
+					Body:       listener.Probe.Body,
+					File:       listener.Probe.File,
+					Url:        listener.Probe.Url,
+					CacheTime:  listener.Probe.CacheTime,
+				}
+			}
+
+			if listener.Capture != nil {
+				HandlerData.Capture = &handlers.HTTPCapture{
+					Mode:       listener.Capture.Mode,
+					Entries:    listener.Capture.Entries,
+					FileSize:   listener.Capture.FileSize,
+					Files:      listener.Capture.Files,
+					MaxBody:    listener.Capture.MaxBody,
+					Redact:     listener.Capture.Redact,
+					RedactBody: listener.Capture.RedactBody,
+				}
+			}
+
+			if listener.Record != nil {
+				HandlerData.Record = &handlers.HTTPRecord{
+					Redact: listener.Record.Redact,
+				}
+			}
+
+			if listener.Chaos != nil {
+				if t.Flags.Server.Chaos {
+					HandlerData.Chaos = &handlers.HTTPChaos{
+						Loss:     listener.Chaos.Loss,
+						Truncate: listener.Chaos.Truncate,
+						Latency:  listener.Chaos.Latency,
+						Jitter:   listener.Chaos.Jitter,
+						Flap:     listener.Chaos.Flap,
+						Down:     listener.Chaos.Down,
+					}
+				} else {
+					logger.Warn("Ignoring the Chaos of listener " + listener.Name + ". failures are only injected with --chaos")
+				}
+			}
+
+			if listener.Proxy != nil {
+				HandlerData.Proxy.Mode = listener.Proxy.Mode
+				if len(HandlerData.Proxy.Mode) == 0 && len(listener.Proxy.Host) > 0 {
+					HandlerData.Proxy.Mode = handlers.PROXY_MODE_EXPLICIT
+				}
+
+				if handlers.ProxyMode(HandlerData) == handlers.PROXY_MODE_EXPLICIT {
+					if len(listener.Proxy.Host) == 0 || listener.Proxy.Port == 0 {
+						logger.Error("Proxy Host/Port not specified for listener '" + listener.Name + "'")
+						return
+					}
+
+					HandlerData.Proxy.Enabled = true
+					HandlerData.Proxy.Type = listener.Proxy.Type
+					if len(HandlerData.Proxy.Type) == 0 {
+						HandlerData.Proxy.Type = "http"
+					}
+					HandlerData.Proxy.Host = listener.Proxy.Host
+					HandlerData.Proxy.Port = strconv.Itoa(listener.Proxy.Port)
+					HandlerData.Proxy.Username = listener.Proxy.User
+					HandlerData.Proxy.Password = listener.Proxy.Pass
+					HandlerData.Proxy.Auth = listener.Proxy.Auth
+					HandlerData.Proxy.Bypass = listener.Proxy.Bypass
+				}
+			}
+
 			if err := t.ListenerStart(handlers.LISTENER_HTTP, HandlerData); err != nil {
 				logger.Error("Failed to start listener from profile: " + err.Error())
 				return
@@ -304,6 +648,7 @@ func (t *Teamserver) Start() {
 				PipeName:     listener.PipeName,
 				KillDate:     KillDate,
 				WorkingHours: listener.WorkingHours,
+				Workspace:    listener.Workspace,
 			}
 
 			if err := t.ListenerStart(handlers.LISTENER_PIVOT_SMB, HandlerData); err != nil {
@@ -315,8 +660,9 @@ func (t *Teamserver) Start() {
 		/* Start all ExternalC2 listeners */
 		for _, listener := range t.Profile.Config.Listener.ListenerExternal {
 			var HandlerData = handlers.ExternalConfig{
-				Name:     listener.Name,
-				Endpoint: listener.Endpoint,
+				Name:      listener.Name,
+				Endpoint:  listener.Endpoint,
+				Workspace: listener.Workspace,
 			}
 
 			if err := t.ListenerStart(handlers.LISTENER_EXTERNAL, HandlerData); err != nil {
@@ -375,6 +721,56 @@ func (t *Teamserver) Start() {
 			HandlerData.Uris = strings.Split(Data["Uris"].(string), ", ")
 			HandlerData.BehindRedir = t.Profile.Config.Demon.TrustXForwardedFor
 
+			if val, ok := Data["HostHeader"].(string); ok {
+				HandlerData.HostHeader = val
+			}
+
+			if val, ok := Data["Host Headers"].(string); ok {
+				HandlerData.HostHeaders = handlers.ParseHostHeaders(val)
+			}
+
+			if val, ok := Data["Server Names"].(string); ok && len(val) > 0 {
+				HandlerData.ServerNames = strings.Split(val, ", ")
+			}
+
+			HandlerData.Workspace, _ = Data["Workspace"].(string)
+
+			if val, ok := Data["CertTemplate"].(map[string]any); ok {
+				if Template, err := json.Marshal(val); err == nil {
+					HandlerData.CertTemplate = new(certs.Template)
+					if err = json.Unmarshal(Template, HandlerData.CertTemplate); err != nil {
+						HandlerData.CertTemplate = nil
+					}
+				}
+			}
+
+			if val, ok := Data["Probe"].(map[string]any); ok {
+				if Probe, err := json.Marshal(val); err == nil {
+					HandlerData.Probe = new(handlers.HTTPProbe)
+					if err = json.Unmarshal(Probe, HandlerData.Probe); err != nil {
+						HandlerData.Probe = nil
+					}
+				}
+			}
+
+			if val, ok := Data["Capture"].(map[string]any); ok {
+				if Capture, err := json.Marshal(val); err == nil {
+					HandlerData.Capture = new(handlers.HTTPCapture)
+					if err = json.Unmarshal(Capture, HandlerData.Capture); err != nil {
+						HandlerData.Capture = nil
+					}
+				}
+			}
+
+			if val, ok := Data["Record"].(map[string]any); ok {
+				if Record, err := json.Marshal(val); err == nil {
+					HandlerData.Record = new(handlers.HTTPRecord)
+					if err = json.Unmarshal(Record, HandlerData.Record); err != nil {
+						HandlerData.Record = nil
+					}
+				}
+			}
+
 			HandlerData.Secure = false
 			if Data["Secure"].(string) == "true" {
 				HandlerData.Secure = true
@@ -396,6 +792,28 @@ func (t *Teamserver) Start() {
 				}
 			}
 
+			/* restore the proxy settings */
+			if val, ok := Data["Proxy Enabled"].(bool); ok {
+				HandlerData.Proxy.Enabled = val
+			}
+
+			if val, ok := Data["Proxy Mode"].(string); ok {
+				HandlerData.Proxy.Mode = val
+			}
+
+			if HandlerData.Proxy.Enabled {
+				HandlerData.Proxy.Type, _ = Data["Proxy Type"].(string)
+				HandlerData.Proxy.Host, _ = Data["Proxy Host"].(string)
+				HandlerData.Proxy.Port, _ = Data["Proxy Port"].(string)
+				HandlerData.Proxy.Username, _ = Data["Proxy Username"].(string)
+				HandlerData.Proxy.Password, _ = Data["Proxy Password"].(string)
+				HandlerData.Proxy.Auth, _ = Data["Proxy Auth"].(string)
+
+				if val, ok := Data["Proxy Bypass"].(string); ok && len(val) > 0 {
+					HandlerData.Proxy.Bypass = strings.Split(val, ", ")
+				}
+			}
+
 			/* also ignore if we already have a listener running */
 			if err := t.ListenerStart(handlers.LISTENER_HTTP, HandlerData); err != nil && err.Error() != "listener already exists" {
 				logger.SetStdOut(os.Stderr)
@@ -421,6 +839,7 @@ func (t *Teamserver) Start() {
 			}
 
 			HandlerData.Endpoint = Data["Endpoint"].(string)
+			HandlerData.Workspace, _ = Data["Workspace"].(string)
 
 			if err := t.ListenerStart(handlers.LISTENER_EXTERNAL, HandlerData); err != nil && err.Error() != "listener already exists" {
 				logger.SetStdOut(os.Stderr)
@@ -446,6 +865,7 @@ func (t *Teamserver) Start() {
 			}
 
 			HandlerData.PipeName = Data["PipeName"].(string)
+			HandlerData.Workspace, _ = Data["Workspace"].(string)
 
 			if err := t.ListenerStart(handlers.LISTENER_PIVOT_SMB, HandlerData); err != nil && err.Error() != "listener already exists" {
 				logger.SetStdOut(os.Stderr)
@@ -459,10 +879,34 @@ func (t *Teamserver) Start() {
 
 	}
 
+	/* the listeners of the profile and the last session are bound, root isn't needed anymore */
+	if err = t.PrivilegesDrop(); err != nil {
+		logger.SetStdOut(os.Stderr)
+		logger.Error("Failed to drop the privileges: " + err.Error())
+		return
+	}
+
 	// load all existing Agents from the DB
 	Agents := t.DB.AgentAll()
+	Workspaces := t.DB.AgentWorkspaces()
+	Capabilities := t.DB.AgentCapabilities()
+	MaxResponses := t.DB.AgentMaxResponses()
+	TimeZones := t.DB.AgentTimeZones()
+	CodePages := t.DB.AgentCodePages()
+	Transports := t.DB.AgentTransportsCurrent()
 	for _, Agent := range Agents {
-		t.AgentAdd(Agent)
+		var AgentID, _ = strconv.ParseInt(Agent.NameID, 16, 64)
+
+		Agent.Info.Workspace = workspaceOrDefault(Workspaces[int(AgentID)])
+		Agent.Info.Capabilities = Capabilities[int(AgentID)]
+		Agent.Info.MaxResponse = MaxResponses[int(AgentID)]
+		Agent.Info.TimeZone = TimeZones[int(AgentID)].Name
+		Agent.Info.UTCOffset = TimeZones[int(AgentID)].Offset
+		Agent.Info.CodePage = CodePages[int(AgentID)].Ansi
+		Agent.Info.OEMCodePage = CodePages[int(AgentID)].OEM
+		Agent.Info.Transport = Transports[int(AgentID)]
+
+		t.agentAdd(Agent, true)
 	}
 
 	for _, Agent := range Agents {
@@ -478,6 +922,9 @@ func (t *Teamserver) Start() {
 		}
 	}
 
+	/* once the links are restored, tasks of pivots go through their parents */
+	t.JournalRequeue()
+
 	// notify the clients
 	for _, Agent := range Agents {
 		t.AgentSendNotify(Agent)
@@ -487,8 +934,15 @@ func (t *Teamserver) Start() {
 		logger.Info(fmt.Sprintf("Restored %v agents from last session", colors.Green(len(Agents))))
 	}
 
+	/* after the listeners so logged certificates get attributed to them */
+	t.TransparencySetup()
+
 	t.EventAppend(events.SendProfile(t.Profile))
 
+	if t.Flags.Server.Demo > 0 {
+		t.DemoStart(t.Flags.Server.Demo)
+	}
+
 	// This should hold the Teamserver as long as the WebSocket Server is running
 	logger.Debug("Wait til the server shutdown")
 
@@ -496,6 +950,8 @@ func (t *Teamserver) Start() {
 }
 
 func (t *Teamserver) handleRequest(id string) {
+	defer t.Recover("authentication of client " + id)
+
 	value, isok := t.Clients.Load(id)
 
 	if !isok {
@@ -519,9 +975,46 @@ func (t *Teamserver) handleRequest(id string) {
 		return
 	}
 
-	pk := client.Packager.CreatePackage(string(NewClient))
+	if !t.clientLogin(id, client, client.Packager.CreatePackage(string(NewClient))) {
+		err = client.Connection.Close()
+		if err != nil {
+			logger.Error("Failed to close client (" + id + ") socket")
+		}
+		t.Clients.Delete(id)
+		return
+	}
 
-	if t.Profile != nil {
+	if client.Role == profile.ROLE_RELAY {
+		/* carries the sessions of the operators behind the relay */
+		t.Supervise("relay "+client.Username, func() {
+			t.relayEvents(id)
+		})
+	} else {
+		/* a panic while dispatching an event only restarts the session of the client */
+		t.Supervise("session of "+client.Username, func() {
+			t.clientEvents(id)
+		})
+	}
+
+	/* the session kept crashing. drop the client */
+	if value, ok := t.Clients.Load(id); ok {
+		if err := value.(*Client).Connection.Close(); err != nil {
+			logger.Error("Failed to close client (" + id + ") socket")
+		}
+
+		t.RemoveClient(id)
+	}
+}
+
+// clientLogin
+// authenticates the client with its first package. Announces the
+// operator and sends it the state of the teamserver. Returns false
+// if the client got refused.
+func (t *Teamserver) clientLogin(id string, client *Client, pk packager.Package) bool {
+	var Resumed bool
+
+	/* operators of a directory or an identity provider have no user block */
+	if t.Profile != nil && len(t.Auth.Backends) == 0 {
 		var found = false
 		for _, UserNames := range t.Profile.ListOfUsernames() {
 			if UserNames == pk.Head.User {
@@ -533,59 +1026,116 @@ func (t *Teamserver) handleRequest(id string) {
 			if err != nil {
 				logger.Error("Error while sending package to " + colors.Red(id) + "")
 			}
-			t.RemoveClient(id)
-			return
+			return false
+		}
+	}
+
+	Name, Authenticated := t.ClientAuthenticate(pk)
+	if !Authenticated {
+		logger.Error("Client [User: " + pk.Head.User + "] failed to Authenticate! (" + colors.Red(client.GlobalIP) + ")")
+		err := t.SendEvent(id, events.Authenticated(false))
+		if err != nil {
+			logger.Error("client (" + colors.Red(id) + ") error while sending authenticate message: " + colors.Red(err))
+		}
+		return false
+	}
+
+	/* the name the directory or identity provider knows the operator by */
+	pk.Head.User = Name
+
+	var Role = profile.ROLE_OPERATOR
+	if t.Profile != nil {
+		Role = t.Profile.UserRole(pk.Head.User)
+	}
+
+	/* relays don't get chained */
+	if Role == profile.ROLE_RELAY && client.Relay != nil {
+		logger.Error("Relay <" + colors.Blue(pk.Head.User) + "> tried to connect through another relay (" + colors.Red(client.GlobalIP) + ")")
+		if err := t.SendEvent(id, events.Authenticated(false)); err != nil {
+			logger.Error("client (" + colors.Red(id) + ") error while sending authenticate message: " + colors.Red(err))
 		}
+		return false
+	}
+
+	/* the client lost its connection and resumes its previous session */
+	if Token, ok := pk.Body.Info["ReconnectToken"].(string); ok && len(Token) > 0 && Role != profile.ROLE_RELAY {
+		Resumed = t.ReconnectResume(pk.Head.User, Token)
 	}
 
+	/* checked by the name the operator got authenticated as. a resumed
+	 * session already dropped its stale client */
 	isExist := false
 	t.Clients.Range(func(key, value any) bool {
-		if client.Username == pk.Head.User {
+		if Other := value.(*Client); key != id && Other.Authenticated && strings.EqualFold(Other.Username, pk.Head.User) {
 			err := t.SendEvent(id, events.UserAlreadyExits())
 			if err != nil {
 				logger.Error("couldn't send event to client "+colors.Yellow(id)+":", err)
 			}
-			t.RemoveClient(id)
 			isExist = true
 			return false
 		}
 		return true
 	})
 	if isExist {
-		return
+		logger.Error("User <" + colors.Blue(pk.Head.User) + "> is already connected, refused (" + colors.Red(client.GlobalIP) + ")")
+		return false
 	}
 
-	if !t.ClientAuthenticate(pk) {
-		logger.Error("Client [User: " + pk.Head.User + "] failed to Authenticate! (" + colors.Red(client.GlobalIP) + ")")
-		err := t.SendEvent(id, events.Authenticated(false))
-		if err != nil {
-			logger.Error("client (" + colors.Red(id) + ") error while sending authenticate message: " + colors.Red(err))
-		}
-		err = client.Connection.Close()
-		if err != nil {
-			logger.Error("Failed to close client (" + id + ") socket")
-		}
-		return
-	} else {
+	logger.Good("User <" + colors.Blue(pk.Head.User) + "> " + colors.Green("Authenticated"))
 
-		logger.Good("User <" + colors.Blue(pk.Head.User) + "> " + colors.Green("Authenticated"))
+	client.Authenticated = true
+	client.ClientID = id
+	client.Username = pk.Head.User
+	client.Role = Role
+	client.Workspace = t.UserWorkspace(pk.Head.User)
 
-		client.Authenticated = true
-		client.ClientID = id
+	switch client.Role {
+	case profile.ROLE_OBSERVER:
+		logger.Info("User <" + colors.Blue(pk.Head.User) + "> connected as " + colors.Yellow("observer"))
 
-		err := t.SendEvent(id, events.Authenticated(true))
-		if err != nil {
-			logger.Error("client (" + colors.Red(id) + ") error while sending authenticate message:" + colors.Red(err))
+	case profile.ROLE_RELAY:
+		logger.Info("User <" + colors.Blue(pk.Head.User) + "> connected as " + colors.Yellow("relay") + " (" + client.GlobalIP + ")")
+
+	case profile.ROLE_OPERATOR, profile.ROLE_ADMIN:
+		if client.Relay != nil {
+			logger.Info("User <" + colors.Blue(pk.Head.User) + "> connected through relay " + colors.Yellow(client.Relay.Username))
 		}
 	}
 
-	client.Username = pk.Head.User
-	packageNewUser := events.ChatLog.NewUserConnected(client.Username)
-	t.EventAppend(packageNewUser)
-	t.EventBroadcast(id, packageNewUser)
+	var Authed = events.Authenticated(true)
+	Authed.Body.Info["User"] = client.Username
+	Authed.Body.Info["Role"] = client.Role
+	Authed.Body.Info["Workspace"] = client.Workspace
+
+	if client.Role != profile.ROLE_RELAY {
+		Authed.Body.Info["ReconnectToken"] = t.ReconnectIssue(id, client)
+	}
+
+	err := t.SendEvent(id, Authed)
+	if err != nil {
+		logger.Error("client (" + colors.Red(id) + ") error while sending authenticate message:" + colors.Red(err))
+	}
+
+	if client.Role == profile.ROLE_RELAY {
+		return true
+	}
+
+	if !Resumed {
+		packageNewUser := events.ChatLog.NewUserConnected(client.Username)
+		t.EventAppend(packageNewUser)
+		t.EventBroadcast(id, packageNewUser)
+	}
 
 	t.SendAllPackagesToNewClient(id)
 
+	return true
+}
+
+// clientEvents
+// reads and dispatches the events of the authenticated client till it disconnects.
+func (t *Teamserver) clientEvents(id string) {
+	var client *Client
+
 	for {
 		value, isok := t.Clients.Load(id)
 		if !isok {
@@ -595,19 +1145,27 @@ func (t *Teamserver) handleRequest(id string) {
 		_, EventPackage, err := client.Connection.ReadMessage()
 
 		if err != nil {
-			if websocket.IsCloseError(err, websocket.CloseAbnormalClosure) {
+			if client.Replaced.Load() {
+				/* a reconnect of the client took over the session */
+				t.RemoveClient(id)
+				return
+			}
+
+			if websocket.IsCloseError(err, websocket.CloseAbnormalClosure, websocket.CloseNormalClosure, websocket.CloseGoingAway) {
 				logger.Warn("User <" + colors.Blue(client.Username) + "> " + colors.Red("Disconnected"))
 
 				t.EventAppend(events.ChatLog.UserDisconnected(client.Username))
 				t.RemoveClient(id)
 
 				return
+			} else if clientTimedOut(err) {
+				logger.Warn("User <" + colors.Blue(client.Username) + "> " + colors.Red("Timed out"))
 			} else {
 				logger.Error("Error reading :", err.Error())
 			}
 
 			err := client.Connection.Close()
-			if err != nil {
+			if err != nil && !errors.Is(err, net.ErrClosed) {
 				logger.Error("Socket Error:", err.Error())
 			}
 
@@ -617,18 +1175,61 @@ func (t *Teamserver) handleRequest(id string) {
 			return
 		}
 
-		pk := client.Packager.CreatePackage(string(EventPackage))
-		pk.Head.Time = time.Now().Format("02/01/2006 15:04:05")
+		t.clientSeen(client)
+		t.clientEvent(id, client, EventPackage)
+	}
+}
+
+// clientEvent
+// dispatches an event the authenticated client sent.
+func (t *Teamserver) clientEvent(id string, client *Client, EventPackage []byte) {
+	pk := client.Packager.CreatePackage(string(EventPackage))
+	pk.Head.Time = time.Now().Format("02/01/2006 15:04:05")
+
+	/* user and workspace of the event are decided by the teamserver, not the client */
+	pk.Head.User = client.Username
+	pk.Head.Workspace = ""
+
+	if client.Role == profile.ROLE_OBSERVER && !observerAllowed(pk) {
+		logger.Warn("Observer <" + colors.Blue(client.Username) + "> tried to send a restricted event [" + strconv.Itoa(pk.Head.Event) + ":" + strconv.Itoa(pk.Body.SubEvent) + "]")
+
+		if err := t.SendEvent(id, events.Teamserver.Logger("Observers are not allowed to task agents or modify the teamserver")); err != nil {
+			logger.Error("Failed to send event to observer: " + err.Error())
+		}
+		return
+	}
+
+	if !t.workspaceAllowed(client, pk) {
+		logger.Warn("User <" + colors.Blue(client.Username) + "> tried to access another workspace [" + strconv.Itoa(pk.Head.Event) + ":" + strconv.Itoa(pk.Body.SubEvent) + "]")
 
-		t.EventAppend(pk)
-		t.DispatchEvent(pk)
+		if err := t.SendEvent(id, events.Teamserver.Logger("Not allowed to access resources of another workspace")); err != nil {
+			logger.Error("Failed to send event to client: " + err.Error())
+		}
+		return
 	}
+
+	t.EventAppend(pk)
+	t.DispatchEvent(pk)
 }
 
 func (t *Teamserver) SetProfile(path string) {
 	t.Profile = profile.NewProfile()
+	t.Profile.Secrets = t.Flags.Server.Secrets
 	logger.LoggerInstance.STDERR = os.Stderr
-	err := t.Profile.SetProfile(path, t.Flags.Server.Default)
+
+	/* profiles of an older teamserver get upgraded to the current format */
+	Plan, err := profile.Migrate(path, t.Flags.Server.Secrets, false)
+	if err != nil {
+		logger.SetStdOut(os.Stderr)
+		logger.Error("Failed to migrate the profile:", colors.Red(err))
+		os.Exit(1)
+	}
+
+	for _, Migration := range Plan.Migrations {
+		logger.Info(fmt.Sprintf("Migrated profile to version %v: %v (backup: %v)", Migration.Version, Migration.Description, colors.Blue(fmt.Sprintf("%v.v%v.bak", path, Plan.From))))
+	}
+
+	err = t.Profile.SetProfile(path, t.Flags.Server.Default)
 	if err != nil {
 		logger.SetStdOut(os.Stderr)
 		logger.Error("Profile error:", colors.Red(err))
@@ -636,47 +1237,38 @@ func (t *Teamserver) SetProfile(path string) {
 	}
 }
 
-func (t *Teamserver) ClientAuthenticate(pk packager.Package) bool {
+// ClientAuthenticate
+// authenticates the login package of a client. Returns the name of the
+// operator, the one of the backend for operators without a user block.
+func (t *Teamserver) ClientAuthenticate(pk packager.Package) (string, bool) {
 	if pk.Head.Event == packager.Type.InitConnection.Type {
 		if pk.Body.SubEvent == packager.Type.InitConnection.OAuthRequest {
 			if t.Profile != nil {
 				if t.Profile.Config.Operators != nil {
-					var (
-						UserPassword string
-						UserName     string
-						PassHash     = sha3.New256()
-						UserFound    = false
-					)
-
-					// search for operator
-					for _, User := range t.Profile.Config.Operators.Users {
-						if User.Name == pk.Head.User {
-							UserName = User.Name
-							UserFound = true
-
-							PassHash.Write([]byte(User.Password))
-							UserPassword = hex.EncodeToString(PassHash.Sum(nil))
-
-							logger.Debug("Found User: " + User.Name)
-						}
+					// the client sends the sha3-256 digest of the password
+					if password, ok := pk.Body.Info["Password"].(string); ok && t.Profile.Authenticate(pk.Head.User, password) {
+						logger.Debug("User " + colors.Red(pk.Head.User) + " is authenticated")
+						return pk.Head.User, true
 					}
 
-					// check if the operator was even found
-					if UserFound {
-						if password, ok := pk.Body.Info["Password"].(string); ok && password == UserPassword {
-							logger.Debug("User " + colors.Red(UserName) + " is authenticated")
-							return true
+					/* the directory needs the password in the clear, the identity provider its token */
+					if !t.authLocal(pk.Head.User) {
+						var Credentials = auth.Credentials{User: pk.Head.User}
+
+						Credentials.Password, _ = pk.Body.Info["Secret"].(string)
+						Credentials.Token, _ = pk.Body.Info["Token"].(string)
+
+						if Name, ok := t.authExternal(Credentials); ok {
+							return Name, true
 						}
-					} else {
-						logger.Debug("User not found")
 					}
 
 					logger.Debug("User not authenticated")
 				}
 
-				return false
+				return "", false
 			} else {
-				return false
+				return "", false
 			}
 		} else {
 			logger.Error("Wrong SubEvent :: " + strconv.Itoa(pk.Body.SubEvent))
@@ -685,12 +1277,12 @@ func (t *Teamserver) ClientAuthenticate(pk packager.Package) bool {
 		logger.Error("Not a Authenticate request")
 	}
 
-	if password, ok := pk.Body.Info["Password"].(string); ok {
-		logger.Error("Client failed to authenticate with password hash :: " + password)
+	if _, ok := pk.Body.Info["Password"].(string); ok {
+		logger.Error("Client failed to authenticate with a wrong password")
 	} else {
 		logger.Error("Client failed to authenticate, password is nil")
 	}
-	return false
+	return "", false
 }
 
 func (t *Teamserver) EventBroadcast(ExceptClient string, pk packager.Package) {
@@ -700,9 +1292,24 @@ func (t *Teamserver) EventBroadcast(ExceptClient string, pk packager.Package) {
 		return
 	}
 
+	t.Bus.Publish(eventbus.Event{Type: eventbus.OPERATOR_PACKAGE, Package: &pk, Except: ExceptClient})
+}
+
+// EventPublish
+// publishes a typed event to the consumers of the event bus (webhooks,
+// syslog, service clients).
+func (t *Teamserver) EventPublish(Type, Workspace string, Data map[string]any) {
+	t.Bus.Publish(eventbus.Event{Type: Type, Workspace: workspaceOrDefault(Workspace), Data: Data})
+}
+
+// broadcast
+// sends the package of the event to every connected client.
+func (t *Teamserver) broadcast(Event eventbus.Event) error {
+	var pk = *Event.Package
+
 	t.Clients.Range(func(key, value any) bool {
 		ClientID := key.(string)
-		if ExceptClient != ClientID {
+		if Event.Except != ClientID {
 			err := t.SendEvent(ClientID, pk)
 			if err != nil && !strings.Contains(err.Error(), "use of closed network connection") {
 				logger.Error("SendEvent error: ", colors.Red(err))
@@ -710,6 +1317,8 @@ func (t *Teamserver) EventBroadcast(ExceptClient string, pk packager.Package) {
 		}
 		return true
 	})
+
+	return nil
 }
 
 func (t *Teamserver) EventNewDemon(DemonAgent *agent.Agent) packager.Package {
@@ -729,6 +1338,11 @@ func (t *Teamserver) EventListenerError(ListenerName string, Error error) {
 	t.EventAppend(pk)
 	t.EventBroadcast("", pk)
 
+	t.EventPublish(eventbus.LISTENER_DOWN, t.EventWorkspace(pk), map[string]any{
+		"Name":  ListenerName,
+		"Error": Error.Error(),
+	})
+
 	// also remove the listener from the init packages.
 	for EventID := range t.EventsList {
 		if t.EventsList[EventID].Head.Event == packager.Type.Listener.Type {
@@ -758,22 +1372,39 @@ func (t *Teamserver) SendEvent(id string, pk packager.Package) error {
 	value, isOk := t.Clients.Load(id)
 	if isOk {
 		client := value.(*Client)
-		client.Mutex.Lock()
 
-		err = client.Connection.WriteMessage(websocket.BinaryMessage, buffer.Bytes())
-		if err != nil {
-			// TODO: comment this line out as it seems to crash the server
-			//t.Clients[id].Mutex.Unlock()
-			return err
+		/* don't leak events of other workspaces */
+		if !workspaceVisible(client.Workspace, t.EventWorkspace(pk)) {
+			return nil
 		}
 
-		client.Mutex.Unlock()
+		/* the link of a relay only carries the packages of its operators */
+		if client.Role == profile.ROLE_RELAY && pk.Head.Event != packager.Type.InitConnection.Type {
+			return nil
+		}
 
+		err = t.clientWrite(id, client, buffer.Bytes())
 	} else {
 		return errors.New(fmt.Sprintf("client (%v) doesn't exist anymore", colors.Red(id)))
 	}
 
-	return nil
+	return err
+}
+
+// SendEventToUser
+// sends the package to every client the user is connected with.
+func (t *Teamserver) SendEventToUser(User string, pk packager.Package) {
+	t.Clients.Range(func(key, value any) bool {
+		var client = value.(*Client)
+
+		if client.Username == User {
+			if err := t.SendEvent(key.(string), pk); err != nil {
+				logger.Error("Failed to send Event: " + err.Error())
+			}
+		}
+
+		return true
+	})
 }
 
 func (t *Teamserver) RemoveClient(ClientID string) {
@@ -787,7 +1418,9 @@ func (t *Teamserver) RemoveClient(ClientID string) {
 			Authenticated    = client.Authenticated
 		)
 
-		if Authenticated {
+		t.ReconnectExpire(client)
+
+		if Authenticated && !client.Replaced.Load() && client.Role != profile.ROLE_RELAY {
 			t.EventBroadcast(ClientID, events.ChatLog.UserDisconnected(userDisconnected))
 			for UserID := range t.Users {
 				if userDisconnected == t.Users[UserID].Name {
@@ -808,7 +1441,10 @@ func (t *Teamserver) EventAppend(event packager.Package) []packager.Package {
 	}
 
 	if event.Head.OneTime != "true" {
+		event.Head.Workspace = t.EventWorkspace(event)
+
 		t.EventsList = append(t.EventsList, event)
+		t.EventPersist(event)
 		return append(t.EventsList, event)
 	}
 
@@ -822,7 +1458,12 @@ func (t *Teamserver) EventRemove(EventID int) []packager.Package {
 }
 
 func (t *Teamserver) SendAllPackagesToNewClient(ClientID string) {
+	/* send the teamserver state first (listeners, etc.) */
 	for _, Package := range t.EventsList {
+		if replayIsHistory(Package) {
+			continue
+		}
+
 		err := t.SendEvent(ClientID, Package)
 		if err != nil {
 			logger.Error("error while sending info to client("+ClientID+"): ", err)
@@ -831,7 +1472,7 @@ func (t *Teamserver) SendAllPackagesToNewClient(ClientID string) {
 	}
 
 	// send all the agents that are alive right now to the new client
-	for _, demon := range t.Agents.Agents {
+	for _, demon := range t.Agents.List() {
 		if demon.Active == false {
 			continue
 		}
@@ -843,6 +1484,30 @@ func (t *Teamserver) SendAllPackagesToNewClient(ClientID string) {
 			return
 		}
 	}
+
+	/* replay the history of previous runs */
+	if err := t.ReplayHistory(ClientID); err != nil {
+		logger.Error("error while sending info to client("+ClientID+"): ", err)
+		return
+	}
+
+	/* and the history of this run that is inside the replay window */
+	var Archived = t.archivedIDs()
+	for _, Package := range t.EventsList {
+		if !replayIsHistory(Package) || !t.replayInWindow(Package) {
+			continue
+		}
+
+		if Archived[archiveSessionOf(Package)] {
+			continue
+		}
+
+		err := t.SendEvent(ClientID, Package)
+		if err != nil {
+			logger.Error("error while sending info to client("+ClientID+"): ", err)
+			return
+		}
+	}
 }
 
 func (t *Teamserver) FindSystemPackages() bool {
@@ -948,6 +1613,20 @@ func (t *Teamserver) EndpointAdd(endpoint *Endpoint) bool {
 	return true
 }
 
+// EndpointRequest
+// hands the request to the external listener of the endpoint.
+func (t *Teamserver) EndpointRequest(context *gin.Context) {
+	var endpoint = context.Request.RequestURI[1:]
+
+	if len(t.Endpoints) > 0 {
+		for i := range t.Endpoints {
+			if t.Endpoints[i].Endpoint == endpoint {
+				t.Endpoints[i].Function(context)
+			}
+		}
+	}
+}
+
 func (t *Teamserver) EndpointRemove(endpoint string) []*Endpoint {
 	for i := range t.Endpoints {
 		if t.Endpoints[i].Endpoint == endpoint {
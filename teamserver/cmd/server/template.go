@@ -0,0 +1,365 @@
+package server
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	"Havoc/pkg/db"
+	"Havoc/pkg/logger"
+)
+
+// types of the parameters of a task template
+const (
+	TEMPLATE_STRING = "string"
+	TEMPLATE_INT    = "int"
+	TEMPLATE_BOOL   = "bool"
+	TEMPLATE_CHOICE = "choice"
+	// substituted base64 encoded (eg: arguments of inline-execute)
+	TEMPLATE_BASE64 = "base64"
+)
+
+var (
+	templateName        = regexp.MustCompile(`^[A-Za-z0-9_.-]+$`)
+	templateParameter   = regexp.MustCompile(`^[A-Za-z_][A-Za-z0-9_]*$`)
+	templatePlaceholder = regexp.MustCompile(`\$\{([^}]*)\}`)
+)
+
+// TemplateParameter
+// a typed parameter of a task template. ${Name} in the command
+// of the template is replaced by its value.
+type TemplateParameter struct {
+	Name        string
+	Type        string
+	Description string
+	Required    bool
+	// used when no value is given
+	Default string
+	// string: regular expression the whole value has to match
+	Pattern string
+	// int: bounds of the value
+	Min *int64
+	Max *int64
+	// choice: the allowed values
+	Values []string
+}
+
+// validate
+// checks the value and returns what is substituted for it.
+func (p TemplateParameter) validate(Value string) (string, error) {
+	switch p.Type {
+
+	case TEMPLATE_STRING, "":
+		if len(p.Pattern) > 0 {
+			if Matched, err := regexp.MatchString("^(?:"+p.Pattern+")$", Value); err != nil || !Matched {
+				return "", fmt.Errorf("%v doesn't match %v", p.Name, p.Pattern)
+			}
+		}
+
+		return Value, nil
+
+	case TEMPLATE_INT:
+		Number, err := strconv.ParseInt(Value, 0, 64)
+		if err != nil {
+			return "", fmt.Errorf("%v has to be an integer", p.Name)
+		}
+
+		if p.Min != nil && Number < *p.Min {
+			return "", fmt.Errorf("%v has to be at least %v", p.Name, *p.Min)
+		}
+
+		if p.Max != nil && Number > *p.Max {
+			return "", fmt.Errorf("%v has to be at most %v", p.Name, *p.Max)
+		}
+
+		return strconv.FormatInt(Number, 10), nil
+
+	case TEMPLATE_BOOL:
+		Bool, err := strconv.ParseBool(Value)
+		if err != nil {
+			return "", fmt.Errorf("%v has to be true or false", p.Name)
+		}
+
+		return strconv.FormatBool(Bool), nil
+
+	case TEMPLATE_CHOICE:
+		for _, Allowed := range p.Values {
+			if Allowed == Value {
+				return Value, nil
+			}
+		}
+
+		return "", fmt.Errorf("%v has to be one of %v", p.Name, strings.Join(p.Values, ", "))
+
+	case TEMPLATE_BASE64:
+		return base64.StdEncoding.EncodeToString([]byte(Value)), nil
+
+	}
+
+	return "", fmt.Errorf("unknown type %v of parameter %v", p.Type, p.Name)
+}
+
+// templateParse
+// decodes the command and the parameters of the template.
+func templateParse(Template db.TaskTemplate) (map[string]any, []TemplateParameter, error) {
+	var (
+		Command    map[string]any
+		Parameters []TemplateParameter
+	)
+
+	if err := json.Unmarshal([]byte(Template.Command), &Command); err != nil {
+		return nil, nil, errors.New("invalid command: " + err.Error())
+	}
+
+	if len(Template.Parameters) > 0 {
+		if err := json.Unmarshal([]byte(Template.Parameters), &Parameters); err != nil {
+			return nil, nil, errors.New("invalid parameters: " + err.Error())
+		}
+	}
+
+	return Command, Parameters, nil
+}
+
+// templateSubstitute
+// replaces the placeholders in the strings of the command. Placeholders
+// Values has no entry for are passed to Missing and left as they are.
+func templateSubstitute(Value any, Values map[string]string, Missing func(Name string)) any {
+	switch Value := Value.(type) {
+
+	case string:
+		return templatePlaceholder.ReplaceAllStringFunc(Value, func(Placeholder string) string {
+			var Name = templatePlaceholder.FindStringSubmatch(Placeholder)[1]
+
+			if Substitute, ok := Values[Name]; ok {
+				return Substitute
+			}
+
+			Missing(Name)
+
+			return Placeholder
+		})
+
+	case map[string]any:
+		var Rendered = make(map[string]any, len(Value))
+
+		for Key, Value := range Value {
+			Rendered[Key] = templateSubstitute(Value, Values, Missing)
+		}
+
+		return Rendered
+
+	case []any:
+		var Rendered = make([]any, len(Value))
+
+		for i := range Value {
+			Rendered[i] = templateSubstitute(Value[i], Values, Missing)
+		}
+
+		return Rendered
+
+	}
+
+	return Value
+}
+
+// TemplateSave
+// saves a named task template. The command is the json object of
+// the session input the console of the client sends (CommandID,
+// CommandLine and the arguments of the command) with ${Name}
+// placeholders for the parameters (json array of TemplateParameter).
+func (t *Teamserver) TemplateSave(User string, Info map[string]any) error {
+	var (
+		Template = db.TaskTemplate{User: User, Time: time.Now().Format("02/01/2006 15:04:05")}
+		Declared = make(map[string]string)
+		Unknown  []string
+	)
+
+	Template.Name, _ = Info["Name"].(string)
+	Template.Description, _ = Info["Description"].(string)
+	Template.Command, _ = Info["Command"].(string)
+	Template.Parameters, _ = Info["Parameters"].(string)
+
+	if !templateName.MatchString(Template.Name) {
+		return errors.New("template name is required (letters, digits, _ . and -)")
+	}
+
+	Command, Parameters, err := templateParse(Template)
+	if err != nil {
+		return err
+	}
+
+	for _, Key := range []string{"CommandID", "CommandLine"} {
+		if _, ok := Command[Key].(string); !ok {
+			return errors.New("command requires " + Key)
+		}
+	}
+
+	/* filled in when the template gets executed */
+	for _, Key := range []string{"DemonID", "TaskID"} {
+		if _, ok := Command[Key]; ok {
+			return errors.New("command can't specify " + Key)
+		}
+	}
+
+	for _, Parameter := range Parameters {
+		if !templateParameter.MatchString(Parameter.Name) {
+			return fmt.Errorf("invalid parameter name %q", Parameter.Name)
+		}
+
+		if _, ok := Declared[Parameter.Name]; ok {
+			return errors.New("duplicate parameter " + Parameter.Name)
+		}
+
+		if len(Parameter.Pattern) > 0 {
+			if _, err = regexp.Compile(Parameter.Pattern); err != nil {
+				return fmt.Errorf("invalid pattern of %v: %v", Parameter.Name, err)
+			}
+		}
+
+		if Parameter.Type == TEMPLATE_CHOICE && len(Parameter.Values) == 0 {
+			return errors.New("choice parameter " + Parameter.Name + " has no values")
+		}
+
+		switch Parameter.Type {
+		case "", TEMPLATE_STRING, TEMPLATE_INT, TEMPLATE_BOOL, TEMPLATE_CHOICE, TEMPLATE_BASE64:
+		default:
+			return fmt.Errorf("unknown type %v of parameter %v", Parameter.Type, Parameter.Name)
+		}
+
+		if len(Parameter.Default) > 0 {
+			if _, err = Parameter.validate(Parameter.Default); err != nil {
+				return errors.New("invalid default: " + err.Error())
+			}
+		}
+
+		Declared[Parameter.Name] = ""
+	}
+
+	templateSubstitute(Command, Declared, func(Name string) {
+		Unknown = append(Unknown, Name)
+	})
+
+	if len(Unknown) > 0 {
+		return errors.New("command uses undeclared parameters: " + strings.Join(Unknown, ", "))
+	}
+
+	if err = t.DB.TemplateSet(Template); err != nil {
+		return err
+	}
+
+	logger.Info(fmt.Sprintf("Task template %v saved by %v [%v parameters]", Template.Name, User, len(Parameters)))
+
+	return nil
+}
+
+// TemplateRender
+// validates the values of the parameters and returns the session
+// input of the template with the placeholders replaced by them.
+func (t *Teamserver) TemplateRender(Name string, Values map[string]any) (map[string]any, error) {
+	var Substitutes = make(map[string]string)
+
+	Template, err := t.DB.TemplateGet(Name)
+	if err != nil {
+		return nil, errors.New("task template " + Name + " not found")
+	}
+
+	Command, Parameters, err := templateParse(Template)
+	if err != nil {
+		return nil, err
+	}
+
+	for _, Parameter := range Parameters {
+		var Value = Parameter.Default
+
+		switch Given := Values[Parameter.Name].(type) {
+		case string:
+			Value = Given
+		case float64:
+			/* numbers of json requests */
+			Value = strconv.FormatFloat(Given, 'f', -1, 64)
+		case bool:
+			Value = strconv.FormatBool(Given)
+		}
+
+		if len(Value) == 0 {
+			if Parameter.Required {
+				return nil, errors.New("parameter " + Parameter.Name + " is required")
+			}
+
+			/* optional parameters without a value are left empty */
+			Substitutes[Parameter.Name] = ""
+			continue
+		}
+
+		if Substitutes[Parameter.Name], err = Parameter.validate(Value); err != nil {
+			return nil, err
+		}
+	}
+
+	for Key := range Values {
+		if _, ok := Substitutes[Key]; !ok {
+			return nil, errors.New("unknown parameter " + Key)
+		}
+	}
+
+	return templateSubstitute(Command, Substitutes, func(string) {}).(map[string]any), nil
+}
+
+// TemplateExecute
+// renders the template with the parameters of the request and tasks
+// the agent with it like the console of the operator would. The task
+// goes through the blocklist and approval checks of any other task.
+func (t *Teamserver) TemplateExecute(User string, Info map[string]any) error {
+	var (
+		Name, _    = Info["Name"].(string)
+		AgentID, _ = Info["DemonID"].(string)
+		Agent      = t.Agents.Get(AgentID)
+	)
+
+	if Agent == nil {
+		return errors.New("agent " + AgentID + " not found")
+	}
+
+	Values, err := templateValues(Info["Parameters"])
+	if err != nil {
+		return err
+	}
+
+	Command, err := t.TemplateRender(Name, Values)
+	if err != nil {
+		return err
+	}
+
+	logger.Info(fmt.Sprintf("Task template %v executed by %v on agent %v: %v", Name, User, AgentID, Command["CommandLine"]))
+
+	t.TaskQueue(User, Agent, strings.ToUpper(randomID()), Command)
+
+	return nil
+}
+
+// templateValues
+// decodes the values of the parameters (json object or its encoding).
+func templateValues(Parameters any) (map[string]any, error) {
+	var Values map[string]any
+
+	switch Parameters := Parameters.(type) {
+
+	case map[string]any:
+		Values = Parameters
+
+	case string:
+		if len(Parameters) > 0 {
+			if err := json.Unmarshal([]byte(Parameters), &Values); err != nil {
+				return nil, errors.New("invalid parameters: " + err.Error())
+			}
+		}
+
+	}
+
+	return Values, nil
+}
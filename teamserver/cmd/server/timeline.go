@@ -0,0 +1,364 @@
+package server
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"html"
+	"regexp"
+	"sort"
+	"strings"
+	"time"
+
+	"Havoc/pkg/agent"
+	"Havoc/pkg/db"
+	"Havoc/pkg/events"
+	"Havoc/pkg/logger"
+	"Havoc/pkg/packager"
+	"Havoc/pkg/profile"
+)
+
+const (
+	// category of the entries added without one
+	TIMELINE_CATEGORY = "note"
+	// longest text of an entry
+	TIMELINE_TEXT_MAX = 4096
+	// chat messages starting with it add an entry (/timeline phish sent to finance)
+	TIMELINE_CHAT = "/timeline"
+)
+
+// kinds of the entries of the timeline
+const (
+	TIMELINE_SESSION = "session"
+	TIMELINE_TASK    = "task"
+	TIMELINE_MANUAL  = "manual"
+)
+
+var timelineCategory = regexp.MustCompile(`^[a-z0-9_-]{1,32}$`)
+
+// layouts the operators give the time of an entry in. the ones without
+// a zone are in the local time of the teamserver
+var timelineLayouts = []string{time.RFC3339, "2006-01-02 15:04:05", "2006-01-02 15:04", "02/01/2006 15:04:05"}
+
+// TimelineItem
+// an entry of the engagement timeline: the sessions and tasks of the
+// agents and the entries the operators added by hand. ID is only set
+// for the latter, TaskID for the tasks. Evidence are the files attached
+// to them, Detection whether the blue team detected a task.
+type TimelineItem struct {
+	ID        int    `json:",omitempty"`
+	TaskID    string `json:",omitempty"`
+	Time      string
+	Kind      string
+	Category  string
+	Text      string
+	AgentID   string
+	User      string
+	Evidence  []db.Evidence `json:",omitempty"`
+	Detection *db.Detection `json:",omitempty"`
+
+	time time.Time
+}
+
+// timelineItem
+// the item of an entry the operators added.
+func timelineItem(Entry db.TimelineEntry) TimelineItem {
+	var Time = time.Unix(Entry.Time, 0)
+
+	return TimelineItem{
+		ID:       Entry.ID,
+		Time:     Time.UTC().Format("2006-01-02T15:04:05Z"),
+		Kind:     TIMELINE_MANUAL,
+		Category: Entry.Category,
+		Text:     Entry.Text,
+		AgentID:  Entry.AgentID,
+		User:     Entry.User,
+		time:     Time,
+	}
+}
+
+// timelineTime
+// parses the time an entry happened at. now if empty.
+func timelineTime(Stamp string) (time.Time, error) {
+	if Stamp = strings.TrimSpace(Stamp); len(Stamp) == 0 {
+		return time.Now(), nil
+	}
+
+	for _, Layout := range timelineLayouts {
+		if Parsed, err := time.ParseInLocation(Layout, Stamp, time.Local); err == nil {
+			return Parsed, nil
+		}
+	}
+
+	return time.Time{}, errors.New("timeline time has to be yyyy-mm-dd hh:mm[:ss] or rfc3339")
+}
+
+// TimelineAdd
+// adds an entry to the timeline of the workspace of the operator, or
+// of the agent it is about. Info has the Text, and optionally the
+// Category (eg: phish, call, detection), the Time it happened at and
+// the AgentID.
+func (t *Teamserver) TimelineAdd(User string, Info map[string]any) (TimelineItem, error) {
+	var (
+		Workspace   = t.UserWorkspace(User)
+		Text, _     = Info["Text"].(string)
+		Category, _ = Info["Category"].(string)
+		Stamp, _    = Info["Time"].(string)
+		AgentID, _  = Info["AgentID"].(string)
+		Entry       db.TimelineEntry
+		Happened    time.Time
+		err         error
+	)
+
+	if Text = strings.TrimSpace(Text); len(Text) == 0 {
+		return TimelineItem{}, errors.New("timeline entry needs a text")
+	}
+
+	if len(Text) > TIMELINE_TEXT_MAX {
+		return TimelineItem{}, fmt.Errorf("timeline entry is longer than %v bytes", TIMELINE_TEXT_MAX)
+	}
+
+	if Category = strings.ToLower(strings.TrimSpace(Category)); len(Category) == 0 {
+		Category = TIMELINE_CATEGORY
+	}
+
+	if !timelineCategory.MatchString(Category) {
+		return TimelineItem{}, errors.New("timeline category has to be a single word (eg: phish, call, detection)")
+	}
+
+	if Happened, err = timelineTime(Stamp); err != nil {
+		return TimelineItem{}, err
+	}
+
+	if AgentID = strings.TrimSpace(AgentID); len(AgentID) > 0 {
+		var Agent = t.Agents.Get(AgentID)
+
+		if Agent == nil || Agent.Info == nil || !workspaceVisible(Workspace, Agent.Info.Workspace) {
+			return TimelineItem{}, errors.New("agent " + AgentID + " not found")
+		}
+
+		Workspace = Agent.Info.Workspace
+	} else if Workspace == profile.WORKSPACE_ALL {
+		/* operators seeing every workspace pick the one of the entry */
+		Workspace, _ = Info["Workspace"].(string)
+	}
+
+	Entry = db.TimelineEntry{
+		Workspace: workspaceOrDefault(Workspace),
+		Time:      Happened.Unix(),
+		Category:  Category,
+		Text:      Text,
+		AgentID:   AgentID,
+		User:      User,
+		Created:   time.Now().Format("02/01/2006 15:04:05"),
+	}
+
+	if Entry.ID, err = t.DB.TimelineAdd(Entry); err != nil {
+		return TimelineItem{}, err
+	}
+
+	logger.Info(fmt.Sprintf("Timeline entry %v (%v) added by %v", Entry.ID, Entry.Category, User))
+
+	var Item = timelineItem(Entry)
+
+	var pk = events.Timeline.Add(Item)
+	pk.Head.Workspace = Entry.Workspace
+
+	t.EventBroadcast("", pk)
+
+	return Item, nil
+}
+
+// TimelineRemove
+// removes an entry from the timeline. Only its author and admins can.
+func (t *Teamserver) TimelineRemove(User string, ID int) error {
+	Entry, err := t.DB.TimelineGet(ID)
+	if err != nil || !workspaceVisible(t.UserWorkspace(User), Entry.Workspace) {
+		return fmt.Errorf("timeline entry %v not found", ID)
+	}
+
+	if Entry.User != User && t.Profile.UserRole(User) != profile.ROLE_ADMIN {
+		return errors.New("only " + Entry.User + " and admins can remove the timeline entry")
+	}
+
+	if _, err = t.DB.TimelineRemove(ID); err != nil {
+		return err
+	}
+
+	/* the evidence attached to it goes with it */
+	for _, Evidence := range t.DB.Evidences() {
+		if Evidence.TimelineID == ID {
+			t.evidenceDelete(Evidence)
+		}
+	}
+
+	logger.Info(fmt.Sprintf("Timeline entry %v removed by %v", ID, User))
+
+	var pk = events.Timeline.Remove(ID)
+	pk.Head.Workspace = Entry.Workspace
+
+	t.EventBroadcast("", pk)
+
+	return nil
+}
+
+// TimelineEntries
+// returns the entries the operators added to the timeline of the workspace.
+func (t *Teamserver) TimelineEntries(Workspace string) []TimelineItem {
+	var Items []TimelineItem
+
+	for _, Entry := range t.DB.Timeline() {
+		if workspaceVisible(Workspace, Entry.Workspace) {
+			Items = append(Items, timelineItem(Entry))
+		}
+	}
+
+	return Items
+}
+
+// Timeline
+// returns the engagement timeline of the workspace: the agents calling
+// in for the first time, the tasks of the operators and the entries they
+// added by hand, ordered by when they happened.
+func (t *Teamserver) Timeline(Workspace string) []TimelineItem {
+	var Items = t.TimelineEntries(Workspace)
+
+	for _, Agent := range t.Agents.List() {
+		if Agent.Info == nil || !workspaceVisible(Workspace, Agent.Info.Workspace) {
+			continue
+		}
+
+		Time, ok := agent.CallInTime(Agent.Info.FirstCallIn)
+		if !ok {
+			continue
+		}
+
+		Items = append(Items, TimelineItem{
+			Time:    Time.UTC().Format("2006-01-02T15:04:05Z"),
+			Kind:    TIMELINE_SESSION,
+			Text:    fmt.Sprintf("new agent %v\\%v @ %v (%v %v)", Agent.Info.DomainName, Agent.Info.Username, Agent.Info.Hostname, Agent.Info.ProcessName, Agent.Info.ProcessPID),
+			AgentID: Agent.NameID,
+			time:    Time,
+		})
+	}
+
+	for _, Data := range t.DB.EventsOf(packager.Type.Session.Type, packager.Type.Session.Input) {
+		var Package packager.Package
+
+		if err := json.Unmarshal([]byte(Data), &Package); err != nil {
+			continue
+		}
+
+		var (
+			DemonID, _     = Package.Body.Info["DemonID"].(string)
+			TaskID, _      = Package.Body.Info["TaskID"].(string)
+			CommandLine, _ = Package.Body.Info["CommandLine"].(string)
+			EventWorkspace = Package.Head.Workspace
+		)
+
+		if len(EventWorkspace) == 0 {
+			EventWorkspace = t.AgentWorkspace(DemonID)
+		}
+
+		if len(CommandLine) == 0 || !workspaceVisible(Workspace, EventWorkspace) {
+			continue
+		}
+
+		Time, ok := agent.CallInTime(Package.Head.Time)
+		if !ok {
+			continue
+		}
+
+		Items = append(Items, TimelineItem{
+			Time:    Time.UTC().Format("2006-01-02T15:04:05Z"),
+			TaskID:  TaskID,
+			Kind:    TIMELINE_TASK,
+			Text:    CommandLine,
+			AgentID: DemonID,
+			User:    Package.Head.User,
+			time:    Time,
+		})
+	}
+
+	t.timelineEvidence(Workspace, Items)
+	t.timelineDetections(Workspace, Items)
+
+	sort.SliceStable(Items, func(i, j int) bool {
+		return Items[i].time.Before(Items[j].time)
+	})
+
+	return Items
+}
+
+// timelineEvidence
+// adds the evidence attached to the tasks and manual entries to the items.
+func (t *Teamserver) timelineEvidence(Workspace string, Items []TimelineItem) {
+	var (
+		Tasks   = make(map[string][]db.Evidence)
+		Entries = make(map[int][]db.Evidence)
+	)
+
+	for _, Evidence := range t.Evidences(Workspace, nil) {
+		if len(Evidence.TaskID) > 0 {
+			Tasks[Evidence.TaskID] = append(Tasks[Evidence.TaskID], Evidence)
+		} else {
+			Entries[Evidence.TimelineID] = append(Entries[Evidence.TimelineID], Evidence)
+		}
+	}
+
+	for i := range Items {
+		switch Items[i].Kind {
+		case TIMELINE_TASK:
+			Items[i].Evidence = Tasks[Items[i].TaskID]
+		case TIMELINE_MANUAL:
+			Items[i].Evidence = Entries[Items[i].ID]
+		}
+	}
+}
+
+// timelineChat
+// adds the entry of a chat message of the operator starting with
+// TIMELINE_CHAT (/timeline <category> <text>). The message still goes
+// to the chat.
+func (t *Teamserver) timelineChat(User string, Info map[string]any) {
+	var Encoded, _ = Info[User].(string)
+
+	Message, err := base64.StdEncoding.DecodeString(Encoded)
+	if err != nil {
+		return
+	}
+
+	/* the operator client sends the chat html escaped */
+	var Fields = strings.Fields(html.UnescapeString(string(Message)))
+
+	if len(Fields) == 0 || Fields[0] != TIMELINE_CHAT {
+		return
+	}
+
+	if t.Profile.UserRole(User) == profile.ROLE_OBSERVER {
+		t.SendEventToUser(User, events.Teamserver.Logger("Observers can't add timeline entries"))
+		return
+	}
+
+	if len(Fields) < 3 {
+		t.SendEventToUser(User, events.Teamserver.Logger("Usage: "+TIMELINE_CHAT+" <category> <text>"))
+		return
+	}
+
+	if _, err = t.TimelineAdd(User, map[string]any{"Category": Fields[1], "Text": strings.Join(Fields[2:], " ")}); err != nil {
+		t.SendEventToUser(User, events.Teamserver.Logger("Failed to add the timeline entry: "+err.Error()))
+	}
+}
+
+// timelineDetections
+// adds the detection annotations to the tasks of the items.
+func (t *Teamserver) timelineDetections(Workspace string, Items []TimelineItem) {
+	var Detections = t.Detections(Workspace)
+
+	for i := range Items {
+		if Detection, ok := Detections[Items[i].TaskID]; ok && Items[i].Kind == TIMELINE_TASK {
+			Items[i].Detection = &Detection
+		}
+	}
+}
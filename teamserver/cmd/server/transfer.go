@@ -0,0 +1,128 @@
+package server
+
+import (
+	"errors"
+	"mime"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+
+	"Havoc/pkg/budget"
+	"Havoc/pkg/logger"
+	"Havoc/pkg/logr"
+	"Havoc/pkg/profile"
+	"Havoc/pkg/seal"
+)
+
+// Transfer
+// streams a file of the loot of an agent (agents/<id>/<folder>/<path>)
+// or a reassembled download (downloads/<name>) from disk to the
+// operator. Used for files too big to be sent over the websocket.
+// Supports range requests so interrupted transfers can be resumed.
+func (t *Teamserver) Transfer(ctx *gin.Context) {
+	var Budget = t.Budget(budget.TRANSFERS)
+
+	User, Password, ok := ctx.Request.BasicAuth()
+	if !ok || !t.graphqlAuthenticate(User, Password) {
+		logger.Debug("transfer request with invalid credentials from " + ctx.ClientIP())
+		ctx.Header("WWW-Authenticate", `Basic realm="havoc"`)
+		ctx.AbortWithStatus(http.StatusUnauthorized)
+		return
+	}
+
+	Path, err := t.transferPath(User, strings.Trim(ctx.Param("path"), "/"))
+	if err != nil {
+		logger.Warn("User " + User + " requested an invalid transfer: " + err.Error())
+		ctx.AbortWithStatus(http.StatusNotFound)
+		return
+	}
+
+	Stat, err := os.Stat(Path)
+	if err != nil || Stat.IsDir() {
+		ctx.AbortWithStatus(http.StatusNotFound)
+		return
+	}
+
+	File, err := seal.Open(Path)
+	if err != nil {
+		logger.Error("Failed to open transfer " + Path + ": " + err.Error())
+		ctx.AbortWithStatus(http.StatusNotFound)
+		return
+	}
+	defer File.Close()
+
+	if !Budget.Acquire(budget.Goroutines, 1) {
+		ctx.AbortWithStatus(http.StatusServiceUnavailable)
+		return
+	}
+	defer Budget.Release(budget.Goroutines, 1)
+
+	logger.Info("User " + User + " fetches " + filepath.Base(Path) + " [" + strconv.FormatInt(File.Size(), 10) + " bytes]")
+
+	/* sealed files get decrypted record by record. range requests seek over the records */
+	/* non-ascii names get encoded (filename*=utf-8''...) */
+	var Disposition = mime.FormatMediaType("attachment", map[string]string{"filename": Stat.Name()})
+	if len(Disposition) == 0 {
+		Disposition = "attachment"
+	}
+
+	ctx.Header("Content-Disposition", Disposition)
+	ctx.Header("Content-Type", "application/octet-stream")
+	http.ServeContent(ctx.Writer, ctx.Request, Stat.Name(), Stat.ModTime(), File)
+}
+
+// transferPath
+// resolves the requested transfer to a file on disk the user is allowed to fetch.
+func (t *Teamserver) transferPath(User, Transfer string) (string, error) {
+	var (
+		Parts = strings.SplitN(Transfer, "/", 2)
+		Base  string
+	)
+
+	if len(Parts) != 2 || len(Parts[1]) == 0 {
+		return "", errors.New("invalid path: " + Transfer)
+	}
+
+	switch Parts[0] {
+	case "agents":
+		var AgentID = strings.SplitN(Parts[1], "/", 2)[0]
+
+		ID, err := strconv.ParseInt(AgentID, 16, 64)
+		if err != nil {
+			return "", errors.New("invalid agent id: " + AgentID)
+		}
+
+		Agent := t.AgentInstance(int(ID))
+		if Agent == nil || !workspaceVisible(t.UserWorkspace(User), Agent.Info.Workspace) {
+			return "", errors.New("agent not found: " + AgentID)
+		}
+
+		Base = logr.LogrInstance.AgentPath
+
+	case "downloads":
+		t.Downloads.Lock()
+		Owner, ok := t.Downloads.Assembled[Parts[1]]
+		t.Downloads.Unlock()
+
+		if !ok || (Owner != User && t.Profile.UserRole(User) != profile.ROLE_ADMIN) {
+			return "", errors.New("download not found: " + Parts[1])
+		}
+
+		Base = logr.LogrInstance.DownloadPath
+
+	default:
+		return "", errors.New("invalid path: " + Transfer)
+	}
+
+	/* check if we don't have a path traversal */
+	var Path = filepath.Join(Base, Parts[1])
+	if !strings.HasPrefix(Path, filepath.Clean(Base)+string(filepath.Separator)) {
+		return "", errors.New("path traversal: " + Transfer)
+	}
+
+	return Path, nil
+}
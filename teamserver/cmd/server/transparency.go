@@ -0,0 +1,255 @@
+package server
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"Havoc/pkg/common/certs"
+	"Havoc/pkg/eventbus"
+	"Havoc/pkg/events"
+	"Havoc/pkg/handlers"
+	"Havoc/pkg/logger"
+)
+
+const (
+	// search of the transparency logs. {domain} is the monitored domain
+	TRANSPARENCY_MONITOR = "https://crt.sh/?q=%25.{domain}&output=json"
+	// the monitor polls the logs every interval
+	TRANSPARENCY_INTERVAL = time.Hour
+)
+
+// TransparencyEntry
+// certificate of a monitored domain found in the transparency logs.
+type TransparencyEntry struct {
+	ID        int64  `json:"id"`
+	Issuer    string `json:"issuer_name"`
+	Names     string `json:"name_value"`
+	NotBefore string `json:"not_before"`
+	NotAfter  string `json:"not_after"`
+}
+
+// TransparencySetup
+// starts the monitor of the transparency logs for the engagement domains of
+// the profile.
+func (t *Teamserver) TransparencySetup() {
+	var Config = t.Profile.Config.Server
+
+	if Config == nil || Config.Transparency == nil || len(Config.Transparency.Domains) == 0 {
+		return
+	}
+
+	var Interval = TRANSPARENCY_INTERVAL
+
+	if len(Config.Transparency.Interval) > 0 {
+		Duration, err := time.ParseDuration(Config.Transparency.Interval)
+		if err != nil || Duration < time.Minute {
+			logger.Error(fmt.Sprintf("Invalid interval of the transparency monitor %v, polling every %v", Config.Transparency.Interval, Interval))
+		} else {
+			Interval = Duration
+		}
+	}
+
+	logger.Info(fmt.Sprintf("Monitoring the transparency logs for %v every %v", strings.Join(Config.Transparency.Domains, ", "), Interval))
+
+	go t.Supervise("transparency monitor", func() {
+		var Ticker = time.NewTicker(Interval)
+		defer Ticker.Stop()
+
+		t.transparencyPoll()
+
+		for range Ticker.C {
+			t.transparencyPoll()
+		}
+	})
+}
+
+// TransparencyCheck
+// warns the operators about the hostnames the certificate of the listener
+// discloses in the transparency logs, and which wildcards would hide them.
+func (t *Teamserver) TransparencyCheck(HTTP *handlers.HTTP) {
+	var Config = t.Profile.Config.Server
+
+	if Config == nil || Config.Transparency == nil || !Config.Transparency.Warn {
+		return
+	}
+
+	if !HTTP.Config.Secure || len(HTTP.Config.Cert.Cert) == 0 {
+		return
+	}
+
+	Chain, err := certs.Chain(HTTP.Config.Cert.Cert)
+	if err != nil {
+		logger.Error(fmt.Sprintf("Failed to parse the certificate of listener %v: %v", HTTP.Config.Name, err))
+		return
+	}
+
+	/* self signed or of a private authority: nothing ends up in the logs */
+	if !certs.Logged(Chain) {
+		return
+	}
+
+	var (
+		Hosts    []string
+		Seen     = make(map[string]bool)
+		Exposure certs.Exposure
+		Warning  string
+	)
+
+	for _, Host := range append(append([]string{HTTP.Config.HostHeader}, HTTP.Config.Hosts...), HTTP.Config.ServerNames...) {
+		if Host = infraHost(Host); len(Host) > 0 && net.ParseIP(Host) == nil && !strings.HasPrefix(Host, "*") && !Seen[Host] {
+			Hosts = append(Hosts, Host)
+			Seen[Host] = true
+		}
+	}
+
+	Exposure = certs.Exposes(Chain[0], Hosts)
+
+	Warning = fmt.Sprintf("The certificate of listener %v is in the certificate transparency logs, it discloses %v", HTTP.Config.Name, strings.Join(Exposure.Names, ", "))
+
+	if len(Exposure.Hidden) > 0 {
+		Warning += fmt.Sprintf(". %v only show up as a wildcard", strings.Join(Exposure.Hidden, ", "))
+	}
+
+	if len(Exposure.Wildcards) > 0 {
+		Warning += fmt.Sprintf(". A certificate for %v would hide %v", strings.Join(Exposure.Wildcards, ", "), strings.Join(Exposure.Exposed, ", "))
+	}
+
+	if len(Exposure.Uncovered) > 0 {
+		Warning += fmt.Sprintf(". It isn't valid for %v", strings.Join(Exposure.Uncovered, ", "))
+	}
+
+	logger.Warn(Warning)
+
+	var pk = events.Teamserver.Logger(Warning)
+	pk.Head.Workspace = HTTP.Config.Workspace
+
+	t.EventBroadcast("", pk)
+}
+
+// transparencyPoll
+// looks up the certificates of the monitored domains logged since the last
+// poll. The first poll of a domain only remembers what is logged already.
+func (t *Teamserver) transparencyPoll() {
+	var Config = t.Profile.Config.Server.Transparency
+
+	for _, Domain := range Config.Domains {
+		var (
+			Key      = "transparency." + strings.ToLower(Domain)
+			Stored   = t.DB.SettingGet(Key)
+			Last, _  = strconv.ParseInt(Stored, 10, 64)
+			Newest   = Last
+			Baseline = len(Stored) == 0
+		)
+
+		Entries, err := t.transparencySearch(Config.Monitor, Domain)
+		if err != nil {
+			logger.Error(fmt.Sprintf("Failed to search the transparency logs for %v: %v", Domain, err))
+			continue
+		}
+
+		for _, Entry := range Entries {
+			if Entry.ID > Newest {
+				Newest = Entry.ID
+			}
+
+			if Baseline || Entry.ID <= Last {
+				continue
+			}
+
+			var Names = strings.Fields(strings.ToLower(Entry.Names))
+
+			logger.Warn(fmt.Sprintf("Certificate %v for %v got logged by %v", Entry.ID, strings.Join(Names, ", "), Entry.Issuer))
+
+			t.EventPublish(eventbus.CERTIFICATE_LOGGED, "", map[string]any{
+				"Domain":    Domain,
+				"ID":        Entry.ID,
+				"Names":     strings.Join(Names, ", "),
+				"Issuer":    Entry.Issuer,
+				"NotBefore": Entry.NotBefore,
+				"NotAfter":  Entry.NotAfter,
+				"Listeners": strings.Join(t.transparencyListeners(Names), ", "),
+			})
+		}
+
+		if Baseline {
+			logger.Info(fmt.Sprintf("%v certificates of %v are in the transparency logs already", len(Entries), Domain))
+		}
+
+		if Baseline || Newest > Last {
+			if err = t.DB.SettingSet(Key, strconv.FormatInt(Newest, 10)); err != nil {
+				logger.Error("Failed to save the state of the transparency monitor: " + err.Error())
+			}
+		}
+	}
+}
+
+// transparencySearch
+// returns the certificates of the domain in the transparency logs.
+func (t *Teamserver) transparencySearch(Monitor, Domain string) ([]TransparencyEntry, error) {
+	var (
+		Client  = http.Client{Timeout: 60 * time.Second}
+		Entries []TransparencyEntry
+	)
+
+	if len(Monitor) == 0 {
+		Monitor = TRANSPARENCY_MONITOR
+	}
+
+	Response, err := Client.Get(strings.ReplaceAll(Monitor, "{domain}", Domain))
+	if err != nil {
+		return nil, err
+	}
+	defer Response.Body.Close()
+
+	if Response.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("monitor answered with %v", Response.Status)
+	}
+
+	Body, err := io.ReadAll(io.LimitReader(Response.Body, 64*1024*1024))
+	if err != nil {
+		return nil, err
+	}
+
+	if err = json.Unmarshal(Body, &Entries); err != nil {
+		return nil, err
+	}
+
+	return Entries, nil
+}
+
+// transparencyListeners
+// returns the listeners the names of the logged certificate cover.
+func (t *Teamserver) transparencyListeners(Names []string) []string {
+	var Listeners []string
+
+	for _, Listener := range t.Listeners {
+		HTTP, ok := Listener.Config.(*handlers.HTTP)
+		if !ok {
+			continue
+		}
+
+	Hosts:
+		for _, Host := range append([]string{HTTP.Config.HostHeader}, HTTP.Config.Hosts...) {
+			var Parent string
+
+			if Host = infraHost(Host); strings.Contains(Host, ".") {
+				Parent = Host[strings.Index(Host, ".")+1:]
+			}
+
+			for _, Name := range Names {
+				if Name == Host || (len(Parent) > 0 && Name == "*."+Parent) {
+					Listeners = append(Listeners, Listener.Name)
+					break Hosts
+				}
+			}
+		}
+	}
+
+	return Listeners
+}
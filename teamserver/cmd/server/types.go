@@ -2,15 +2,30 @@ package server
 
 import (
 	"Havoc/pkg/agent"
+	"Havoc/pkg/auth"
+	"Havoc/pkg/budget"
 	"Havoc/pkg/db"
+	"Havoc/pkg/eventbus"
+	"Havoc/pkg/journal"
 	"Havoc/pkg/packager"
 	"Havoc/pkg/profile"
+	"Havoc/pkg/schedule"
+	"Havoc/pkg/seal"
+	"Havoc/pkg/secrets"
 	"Havoc/pkg/service"
+	"Havoc/pkg/socks"
 	"Havoc/pkg/webhook"
+	"crypto/sha256"
+	"image"
+	"net"
+	"regexp"
 	"sync"
+	"sync/atomic"
+	"time"
 
 	"github.com/gin-gonic/gin"
 	"github.com/gorilla/websocket"
+	"golang.org/x/crypto/ssh"
 )
 
 type Listener struct {
@@ -27,8 +42,30 @@ type Client struct {
 	Connection    *websocket.Conn
 	Packager      *packager.Packager
 	Authenticated bool
+	Role          string
+	Workspace     string
 	SessionID     string
 	Mutex         sync.Mutex
+	// unix nano time of the last message or pong of the client
+	LastSeen atomic.Int64
+	// token the client resumes its session with after a dropped connection
+	ReconnectToken string
+	// a reconnect of the client took over the session. its disconnect isn't announced
+	Replaced atomic.Bool
+	// link of the relay the client is connected through and the id the relay knows it by
+	Relay   *Client
+	RelayID string
+	// host the client reached the teamserver at
+	Host string
+}
+
+// ReconnectToken
+// session a client can take over after its connection dropped. Active
+// tokens don't expire while the client is connected.
+type ReconnectToken struct {
+	User     string
+	ClientID string
+	Expires  time.Time
 }
 
 type Users struct {
@@ -44,11 +81,23 @@ type serverFlags struct {
 
 	Database string
 	Profile  string
+	Secrets  string
 	Verbose  bool
 	Debug    bool
 	DebugDev bool
 	SendLogs bool
 	Default  bool
+
+	HashPasswords bool
+
+	// synthetic agents spawned for training and client development
+	Demo int
+
+	// failures of the Chaos blocks injected into the listeners (testing only)
+	Chaos bool
+
+	PrintSchema    bool
+	PrintEffective bool
 }
 
 type utilFlags struct {
@@ -66,11 +115,479 @@ type TeamserverFlags struct {
 	Util   utilFlags
 }
 
+type BurnedHost struct {
+	Host   string
+	Reason string
+	User   string
+	Time   string
+	Rotate bool
+}
+
 type Endpoint struct {
 	Endpoint string
 	Function func(ctx *gin.Context)
 }
 
+type DownloadSegment struct {
+	DemonID   string
+	Path      string
+	Offset    int64
+	Length    int64
+	RequestID uint32
+	Done      bool
+}
+
+type SegmentedDownload struct {
+	ID       string
+	User     string
+	Name     string
+	Size     int64
+	Hash     string
+	Segments []*DownloadSegment
+}
+
+type ArchivedSession struct {
+	AgentID     string
+	Hostname    string
+	Username    string
+	DomainName  string
+	ProcessName string
+	ProcessPID  int
+	FirstCallIn string
+	LastCallIn  string
+	// time zone of the host and the callbacks in UTC and its local time (RFC 3339)
+	TimeZone         string
+	FirstCallInUTC   string
+	FirstCallInLocal string
+	LastCallInUTC    string
+	LastCallInLocal  string
+	Workspace        string
+	User             string
+	Time             string
+	LootPath         string
+}
+
+type JumpMethod struct {
+	Name        string
+	Description string
+	// payload format the method executes
+	Format string
+	// inputs the operator has to specify besides the target
+	Inputs []string
+	// method authenticates with a credential of the credential store
+	Credential bool
+	// path the parent agent uploads the payload to
+	Upload func(Target, Name string, Inputs map[string]string) string
+	// command the parent agent runs to execute the payload
+	Command func(Target, Name string, Inputs map[string]string) string
+}
+
+type SSHSession struct {
+	sync.Mutex
+	Agent  *agent.Agent
+	Client *ssh.Client
+	Host   string
+	Port   int
+}
+
+type RelayedSession struct {
+	Agent    *agent.Agent
+	Tool     string
+	Protocol string
+	Target   string
+	Socks    string
+	User     string
+}
+
+// SocksPivot
+// socks proxy of an agent with the snippets of the tools to use it.
+type SocksPivot struct {
+	AgentID     string
+	Hostname    string
+	Username    string
+	InternalIP  string
+	Port        int
+	Proxychains string
+	Ncat        string
+	SSH         string
+}
+
+// PivotStreams
+// streams an agent carries right now and the totals of all of them.
+type PivotStreams struct {
+	AgentID  string
+	Hostname string
+	Totals   agent.StreamInfo
+	Streams  []agent.StreamInfo
+}
+
+// ListenerTemplate
+// listener template (see ListenerTemplateSave) with its configuration.
+type ListenerTemplate struct {
+	Name      string
+	Workspace string
+	Protocol  string
+	Source    string
+	User      string
+	Time      string
+	Config    map[string]any
+}
+
+// EphemeralListener
+// listener that stops on its own once its time to live passed or an agent
+// matching Until (agent id or hostname pattern) called back over it.
+type EphemeralListener struct {
+	Name      string
+	Workspace string
+	User      string
+	TTL       time.Duration
+	Until     string
+	Created   time.Time
+	Expires   time.Time
+
+	/* why and for which agent it stopped */
+	Reason   string
+	AgentID  string
+	Hostname string
+}
+
+// TaskFailure
+// failures of the tasks of a command with the same kind (agent.ERROR_CODE_*)
+// in a workspace.
+type TaskFailure struct {
+	Workspace string
+	Code      string
+	Command   string
+	Count     int64
+	Last      string
+}
+
+// Route
+// destinations of the routing table (a network, a host, a domain pattern
+// or everything) and the chain of agents their traffic goes through.
+type Route struct {
+	ID          string
+	Destination string
+	Hops        []string
+	Workspace   string
+	User        string
+	Time        string
+}
+
+// RouteHop
+// agent of the chain of a route. RoundTrip is the time a probe took from
+// the teamserver to the agent and back, Latency the part of it the hop
+// adds to the one before. Both are in milliseconds, -1 if not measured.
+type RouteHop struct {
+	AgentID   string
+	Hostname  string
+	Active    bool
+	RoundTrip int64
+	Latency   int64
+	Measured  string
+	Pending   string
+}
+
+type RouteInfo struct {
+	Route
+	Path []RouteHop
+	// why the chain can't carry traffic right now
+	Broken string
+}
+
+// RouteListener
+// socks proxy (no Target) or port forward of the teamserver using the
+// routing table of the workspace.
+type RouteListener struct {
+	Port      int
+	Target    string
+	Workspace string
+	User      string
+	Time      string
+
+	socks    *socks.Socks
+	listener net.Listener
+	clients  []int32
+}
+
+type PendingJump struct {
+	EdgeID int
+	Parent *agent.Agent
+	Target string
+	Time   time.Time
+}
+
+type PendingCertificate struct {
+	Request *agent.AdcsRequest
+	User    string
+	Time    time.Time
+}
+
+type PendingRegistry struct {
+	Change agent.RegistryChange
+	User   string
+	Time   time.Time
+}
+
+// DesktopStream
+// desktop view of an agent. the tiles of the frames get assembled
+// into the desktop the viewers get the changed regions of.
+type DesktopStream struct {
+	sync.Mutex
+
+	AgentID   string
+	Workspace string
+	User      string
+	View      agent.DesktopView
+	Started   string
+	Frames    int
+	Bytes     int64
+	// changed tiles the agent didn't send yet
+	Pending int
+	// name of the recording in the loot folder of the agent
+	Recording string
+	Viewers   map[string]bool
+
+	desktop   *image.RGBA
+	dirty     image.Rectangle
+	credit    float64
+	published time.Time
+	recorder  *seal.Writer
+}
+
+type ExfilPolicy struct {
+	MaxPerHour  int64
+	Hours       int32
+	ChunkJitter int
+}
+
+type ExfilState struct {
+	Window time.Time
+	Bytes  int64
+	// downloads stopped by the policy
+	Paused []int
+	Jitter bool
+}
+
+// AuthBackend
+// directory or identity provider of the profile with the role and
+// workspace of its groups.
+type AuthBackend struct {
+	Backend auth.Backend
+	Groups  []profile.AuthGroupConfig
+}
+
+// AuthCached
+// operator a backend authenticated a moment ago with the same credentials.
+type AuthCached struct {
+	Name    string
+	Expires time.Time
+}
+
+type InboundPolicy struct {
+	Rate       float64
+	Burst      float64
+	Drop       float64
+	Concurrent int
+	Alert      int64
+}
+
+type InboundState struct {
+	Tokens float64
+	Last   time.Time
+	Active int
+	// backpressure the agent got told about
+	Throttled bool
+	// bytes of the current minute for the alert
+	Minute  time.Time
+	Bytes   int64
+	Alerted bool
+}
+
+// BlockRule
+// rule of the command blocklist. Rules of the profile can't be
+// removed by the admins.
+type BlockRule struct {
+	db.BlockRule
+	Profile bool
+
+	Commands []string       `json:"-"`
+	Regex    *regexp.Regexp `json:"-"`
+}
+
+// UploadRule
+// uploads of files the rule matches get blocked or need the approval
+// of a second operator.
+type UploadRule struct {
+	db.UploadRule
+	Profile bool
+
+	Digests map[string]bool `json:"-"`
+	Regex   *regexp.Regexp  `json:"-"`
+	Match   *regexp.Regexp  `json:"-"`
+}
+
+// RiskRule
+// tasks matching the rule need the approval of a second operator.
+type RiskRule struct {
+	Name   string
+	Reason string
+
+	Commands []string
+	Regex    *regexp.Regexp
+	Host     *regexp.Regexp
+}
+
+// Batch
+// the same command queued against a selection of agents.
+type Batch struct {
+	ID          string
+	CommandLine string
+	Template    string
+	Group       string
+	User        string
+	Workspace   string `json:"-"`
+	Time        string
+	Tasks       []*BatchTask
+}
+
+// BatchTask
+// task of an agent of a batch.
+type BatchTask struct {
+	AgentID   string
+	Hostname  string
+	Username  string
+	TaskID    string
+	Status    string
+	Output    string
+	Completed string
+}
+
+type BatchSummary struct {
+	ID          string
+	CommandLine string
+	Template    string
+	Group       string
+	User        string
+	Time        string
+	Agents      int
+	Complete    int
+	Failed      int
+	Pending     int
+}
+
+// BatchGroup
+// agents of a batch that answered with the same output.
+type BatchGroup struct {
+	Output string
+	Agents []string
+}
+
+type BatchResult struct {
+	Batch  Batch
+	Groups []BatchGroup
+}
+
+// Spray
+// password spray running through a pivot agent. Every password is tried
+// against every user, at most Threshold - Margin attempts per user within
+// the lockout observation Window.
+type Spray struct {
+	ID        string
+	Protocol  string
+	AgentID   string
+	Domain    string
+	Targets   []string
+	Users     []string
+	Passwords int
+	Threshold int
+	Margin    int
+	Window    string
+	Delay     string
+	Status    string
+	Reason    string
+	User      string
+	Workspace string `json:"-"`
+	Time      string
+	Tried     int
+	Valid     []string
+	Attempts  []*SprayAttempt `json:",omitempty"`
+
+	passwords []string
+	window    time.Duration
+	delay     time.Duration
+	// next attempt of the plan (password major)
+	next int
+	// attempts by user, to keep within the lockout policy
+	history map[string][]time.Time
+	// users not to try anymore (valid password found, locked or disabled)
+	skip   map[string]bool
+	cancel chan struct{}
+	// held by the routine making the attempts, a resumed spray waits for
+	// the attempt of before to finish
+	running chan struct{}
+}
+
+// SprayAttempt
+// attempt of a spray to log on with a password.
+type SprayAttempt struct {
+	Username string
+	Password string
+	Target   string
+	TaskID   string
+	Result   string
+	Output   string `json:",omitempty"`
+	Time     string
+
+	done chan struct{}
+}
+
+// AgentGroup
+// saved dynamic group of agents with the agents it currently selects.
+type AgentGroup struct {
+	db.AgentGroup
+
+	Agents []string
+}
+
+// ScheduledJob
+// job tasking an agent on a recurring schedule.
+type ScheduledJob struct {
+	db.Schedule
+	Next string
+	// why the last run got skipped. empty if it ran
+	Paused  string
+	Runs    int
+	Skipped int
+
+	Cron         schedule.Schedule `json:"-"`
+	WorkingHours int32             `json:"-"`
+	Due          time.Time         `json:"-"`
+	Session      map[string]any    `json:"-"`
+}
+
+// PendingTask
+// task held back until a second operator approves it.
+type PendingTask struct {
+	ID          string
+	AgentID     string
+	TaskID      string
+	CommandLine string
+	Rule        string
+	Reason      string
+	User        string
+	Time        string
+
+	Agent   *agent.Agent `json:"-"`
+	Job     agent.Job    `json:"-"`
+	Created time.Time    `json:"-"`
+
+	// session input of an upload an upload rule held back. it gets
+	// dispatched again once approved
+	Input  map[string]any  `json:"-"`
+	Upload *db.UploadAudit `json:"-"`
+}
+
 type Teamserver struct {
 	Flags      TeamserverFlags
 	Profile    *profile.Profile
@@ -80,16 +597,212 @@ type Teamserver struct {
 	Service    *service.Service
 	WebHooks   *webhook.WebHook
 	DB         *db.DB
+	// notifications of the teamserver and their consumers
+	Bus *eventbus.Bus
 
 	Server struct {
 		Path   string
 		Engine *gin.Engine
+		// start of the teamserver, for its uptime
+		Started time.Time
 	}
 
 	Agents    agent.Agents
 	Listeners []*Listener
 	Endpoints []*Endpoint
 
+	Burned    []*BurnedHost
+	BurnedMtx sync.Mutex
+
+	Replay struct {
+		Enabled bool
+		Window  time.Duration
+		// last persisted event id from previous runs
+		LastID int64
+	}
+
+	// operator api behind a cdn or reverse proxy
+	Proxy struct {
+		Prefix      string
+		Trusted     bool
+		PlainHTTP   bool
+		IdleTimeout time.Duration
+	}
+
+	// pings of the operator clients and the sessions dropped clients can resume
+	Keepalive struct {
+		Interval  time.Duration
+		Timeout   time.Duration
+		Reconnect time.Duration
+		Tokens    sync.Map // map[string]*ReconnectToken
+	}
+
+	Output struct {
+		// output bigger than this gets truncated and spooled to the loot folder
+		Limit int
+	}
+
+	Downloads struct {
+		sync.Mutex
+		Segmented []*SegmentedDownload
+
+		// reassembled files -> user that downloaded them
+		Assembled map[string]string
+	}
+
+	// jumps waiting for the session of their target
+	Jumps sync.Map // map[int]*PendingJump
+
+	// ssh connections managed as sessions
+	SSH sync.Map // map[string]*SSHSession
+
+	// sessions of the relay tools on the teamserver host
+	Relayed sync.Map // map[string]*RelayedSession
+
+	// synthetic agents of the demo mode
+	Demo sync.Map // map[string]*agent.Agent
+
+	// certificate requests waiting for the certificate authority
+	Certificates sync.Map // map[uint32]*PendingCertificate
+
+	// registry modifications waiting for the answer of the agent
+	RegistryChanges sync.Map // map[uint32]*PendingRegistry
+
+	// desktop views, keyed by the request the frames answer
+	Desktops sync.Map // map[uint32]*DesktopStream
+
+	// file searches whose matches are still coming in
+	FileSearches sync.Map // map[uint32]*agent.FileSearch
+
+	// commands the teamserver refuses to queue
+	Blocklist struct {
+		sync.RWMutex
+		Rules []*BlockRule
+	}
+
+	// rules the downloads and the output of the agents get scanned for secrets with
+	SecretScan struct {
+		Disabled bool
+		MaxSize  int64
+		Rules    []secrets.Rule
+		// secrets reported already, by workspace, rule and value
+		Found sync.Map // map[string]bool
+	}
+
+	// uploads of files the teamserver refuses or holds back
+	Uploads struct {
+		sync.RWMutex
+		Rules []*UploadRule
+		// tasks of held back uploads that got approved
+		Approved sync.Map // map[string]bool
+	}
+
+	// tasks waiting for the approval of a second operator
+	Approval struct {
+		Timeout   time.Duration
+		AdminOnly bool
+		Rules     []*RiskRule
+		Pending   sync.Map // map[string]*PendingTask
+	}
+
+	// routing table of the pivot chains and the proxies using it
+	Routes struct {
+		sync.Mutex
+		Table     []*Route
+		Listeners map[int]*RouteListener
+	}
+
+	// listeners stopping on their own
+	Ephemeral struct {
+		sync.Mutex
+		Listeners map[string]*EphemeralListener
+	}
+
+	// failed tasks counted by their kind and command
+	Failures struct {
+		sync.Mutex
+		Counts map[[3]string]*TaskFailure // by workspace, code and command
+	}
+
+	// password sprays running through pivot agents
+	Sprays struct {
+		sync.Mutex
+		Jobs  []*Spray
+		Tasks map[string]*SprayAttempt // by task id
+	}
+
+	// commands queued against several agents at once
+	Batches struct {
+		sync.Mutex
+		Jobs  []*Batch
+		Tasks map[string]*BatchTask // by task id
+	}
+
+	// jobs tasking agents on a recurring schedule
+	Schedules struct {
+		sync.Mutex
+		Jobs map[int]*ScheduledJob
+	}
+
+	// what the operators want to be notified of and the notifications held back for them
+	Notify struct {
+		sync.Mutex
+		Preferences map[string]*NotifyPreferences
+		Queues      map[string]*notifyQueue
+		// kill dates notified already, by agent
+		KillDates map[string]int64
+	}
+
+	// networks the agents of the workspaces are on, by workspace and network
+	Networks struct {
+		sync.Mutex
+		Known map[[2]string]bool
+	}
+
+	// write-ahead log of the sessions, their keys and the tasks not delivered yet
+	Journal struct {
+		sync.Mutex
+		Log       *journal.Journal
+		Pending   map[JournalTask]journal.Record // queued and not delivered
+		Keys      map[string][sha256.Size]byte   // digest of the last journaled key by agent
+		Recovered []journal.Record               // tasks to queue again once the agents are restored
+		Written   int                            // records since the last compaction
+	}
+
+	Inbound struct {
+		sync.Mutex
+		Policy *InboundPolicy
+		Agents map[string]*InboundState
+	}
+
+	/* resources by subsystem (listeners, pivots, transfers) */
+	Budgets map[string]*budget.Budget
+
+	Exfil struct {
+		sync.Mutex
+		Policy *ExfilPolicy
+		Agents map[string]*ExfilState
+	}
+
+	/* directory and identity provider of the operators without a user block */
+	Auth struct {
+		sync.Mutex
+		Backends []AuthBackend
+		Cache    map[[sha256.Size]byte]AuthCached
+	}
+
+	/* user dropped to once the listeners are bound */
+	Privileges struct {
+		Uid     int
+		Gid     int
+		Groups  []int
+		Root    string // working directory chrooted into
+		Dropped bool
+
+		Confinement string // selinux or apparmor label
+		PortStart   int    // first port without privileges
+	}
+
 	Settings struct {
 		Compiler64 string
 		Compiler32 string
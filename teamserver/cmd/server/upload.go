@@ -0,0 +1,465 @@
+package server
+
+import (
+	"crypto/md5"
+	"crypto/sha1"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"regexp"
+	"strings"
+	"time"
+
+	"Havoc/pkg/agent"
+	"Havoc/pkg/db"
+	"Havoc/pkg/logger"
+	"Havoc/pkg/profile"
+)
+
+// actions of an upload rule
+const (
+	UPLOAD_BLOCK    = "block"
+	UPLOAD_APPROVAL = "approval"
+)
+
+// audit entries an operator gets at most
+const UPLOAD_AUDIT_MAX = 500
+
+// uploadFile
+// a file the session input of an operator sends to the target.
+type uploadFile struct {
+	Name string
+	Data []byte
+}
+
+// UploadSetup
+// loads the upload rules of the profile and the ones the admins added
+// in previous runs.
+func (t *Teamserver) UploadSetup() {
+	var Rules []*UploadRule
+
+	if t.Profile.Config.Server != nil && t.Profile.Config.Server.Uploads != nil {
+		for _, Config := range t.Profile.Config.Server.Uploads.Rules {
+			Rule, err := uploadRuleCompile(db.UploadRule{
+				Name:     Config.Name,
+				Action:   Config.Action,
+				Category: Config.Category,
+				Hashes:   strings.Join(Config.Hashes, ","),
+				Pattern:  Config.Pattern,
+				Content:  Config.Content,
+				Reason:   Config.Reason,
+				User:     "profile",
+			})
+			if err != nil {
+				logger.Error("Failed to load upload rule: " + err.Error())
+				continue
+			}
+
+			Rule.Profile = true
+			Rules = append(Rules, Rule)
+		}
+	}
+
+	for _, Saved := range t.DB.UploadRules() {
+		Rule, err := uploadRuleCompile(Saved)
+		if err != nil {
+			logger.Error("Failed to load upload rule: " + err.Error())
+			continue
+		}
+
+		if uploadRuleFind(Rules, Rule.Name) >= 0 {
+			logger.Warn("Upload rule " + Rule.Name + " of the database is shadowed by the profile")
+			continue
+		}
+
+		Rules = append(Rules, Rule)
+	}
+
+	t.Uploads.Lock()
+	t.Uploads.Rules = Rules
+	t.Uploads.Unlock()
+
+	if len(Rules) > 0 {
+		logger.Info(fmt.Sprintf("Upload rules: %v rules", len(Rules)))
+	}
+}
+
+// UploadSave
+// adds or replaces an upload rule. Only admins are allowed to change
+// the upload rules.
+func (t *Teamserver) UploadSave(User string, Info map[string]any) error {
+	var Saved = db.UploadRule{User: User, Time: time.Now().Format("02/01/2006 15:04:05")}
+
+	if t.Profile.UserRole(User) != profile.ROLE_ADMIN {
+		return errors.New("only admins are allowed to change the upload rules")
+	}
+
+	Saved.Name, _ = Info["Name"].(string)
+	Saved.Action, _ = Info["Action"].(string)
+	Saved.Category, _ = Info["Category"].(string)
+	Saved.Hashes, _ = Info["Hashes"].(string)
+	Saved.Pattern, _ = Info["Pattern"].(string)
+	Saved.Content, _ = Info["Content"].(string)
+	Saved.Reason, _ = Info["Reason"].(string)
+
+	Rule, err := uploadRuleCompile(Saved)
+	if err != nil {
+		return err
+	}
+
+	t.Uploads.Lock()
+	defer t.Uploads.Unlock()
+
+	var Index = uploadRuleFind(t.Uploads.Rules, Rule.Name)
+	if Index >= 0 && t.Uploads.Rules[Index].Profile {
+		return errors.New("upload rule " + Rule.Name + " is part of the profile")
+	}
+
+	if err = t.DB.UploadRuleSet(Rule.UploadRule); err != nil {
+		return err
+	}
+
+	if Index >= 0 {
+		t.Uploads.Rules[Index] = Rule
+	} else {
+		t.Uploads.Rules = append(t.Uploads.Rules, Rule)
+	}
+
+	logger.Info(fmt.Sprintf("Upload rule %v [%v, category: %v] saved by %v", Rule.Name, Rule.Action, Rule.Category, User))
+
+	return nil
+}
+
+// UploadRemove
+// removes an upload rule the admins added.
+func (t *Teamserver) UploadRemove(User, Name string) error {
+	if t.Profile.UserRole(User) != profile.ROLE_ADMIN {
+		return errors.New("only admins are allowed to change the upload rules")
+	}
+
+	t.Uploads.Lock()
+	defer t.Uploads.Unlock()
+
+	var Index = uploadRuleFind(t.Uploads.Rules, Name)
+	if Index < 0 {
+		return errors.New("upload rule " + Name + " not found")
+	}
+
+	if t.Uploads.Rules[Index].Profile {
+		return errors.New("upload rule " + Name + " is part of the profile")
+	}
+
+	if _, err := t.DB.UploadRuleRemove(Name); err != nil {
+		return err
+	}
+
+	t.Uploads.Rules = append(t.Uploads.Rules[:Index], t.Uploads.Rules[Index+1:]...)
+
+	logger.Info(fmt.Sprintf("Upload rule %v removed by %v", Name, User))
+
+	return nil
+}
+
+// UploadRules
+// returns the upload rules.
+func (t *Teamserver) UploadRules() []UploadRule {
+	var Rules []UploadRule
+
+	t.Uploads.RLock()
+	defer t.Uploads.RUnlock()
+
+	for _, Rule := range t.Uploads.Rules {
+		Rules = append(Rules, *Rule)
+	}
+
+	return Rules
+}
+
+// UploadAudits
+// returns the latest audit entries of the uploads the workspace sees.
+func (t *Teamserver) UploadAudits(Workspace string) []db.UploadAudit {
+	var Audits []db.UploadAudit
+
+	for _, Audit := range t.DB.UploadAudits(UPLOAD_AUDIT_MAX) {
+		if workspaceVisible(Workspace, Audit.Workspace) {
+			Audits = append(Audits, Audit)
+		}
+	}
+
+	return Audits
+}
+
+// UploadCheck
+// matches the files the session input uploads to the target against
+// the upload rules. Blocked uploads return an error telling the operator
+// why, uploads that need an approval are held back (returns true) and
+// get dispatched again once a second operator approves them.
+func (t *Teamserver) UploadCheck(User string, Agent *agent.Agent, Info map[string]any) (bool, error) {
+	var (
+		TaskID, _      = Info["TaskID"].(string)
+		CommandLine, _ = Info["CommandLine"].(string)
+		Files          = uploadFiles(Info)
+	)
+
+	if len(Files) == 0 {
+		return false, nil
+	}
+
+	/* approved by a second operator already */
+	if _, Approved := t.Uploads.Approved.LoadAndDelete(TaskID); Approved {
+		return false, nil
+	}
+
+	for _, File := range Files {
+		var (
+			Digests = uploadDigests(File.Data)
+			Rule    = t.uploadMatch(File, CommandLine, Digests)
+		)
+
+		if Rule == nil {
+			continue
+		}
+
+		var Audit = db.UploadAudit{
+			Workspace: Agent.Info.Workspace,
+			AgentID:   Agent.NameID,
+			User:      User,
+			TaskID:    TaskID,
+			File:      File.Name,
+			Hash:      Digests[2],
+			Size:      int64(len(File.Data)),
+			Rule:      Rule.Name,
+			Category:  Rule.Category,
+			Time:      time.Now().Format("02/01/2006 15:04:05"),
+		}
+
+		if Rule.Action == UPLOAD_APPROVAL {
+			var Pending = &PendingTask{
+				ID:          randomID(),
+				AgentID:     Agent.NameID,
+				TaskID:      TaskID,
+				CommandLine: CommandLine,
+				Rule:        Rule.Name,
+				Reason:      uploadReason(Rule),
+				User:        User,
+				Time:        Audit.Time,
+				Agent:       Agent,
+				Created:     time.Now(),
+				Input:       make(map[string]any, len(Info)),
+				Upload:      &Audit,
+			}
+
+			for Key, Value := range Info {
+				Pending.Input[Key] = Value
+			}
+
+			Audit.Decision = "held"
+			t.uploadAudit(Audit)
+
+			t.approvalWait(Pending)
+
+			t.AgentConsole(Agent.NameID, agent.HAVOC_CONSOLE_MESSAGE, map[string]string{
+				"Type":    "Info",
+				"Message": fmt.Sprintf("Upload of %v waits for the approval of a second operator (task %v) [rule: %v]", File.Name, Pending.ID, Rule.Name),
+			})
+
+			return true, nil
+		}
+
+		Audit.Decision = "blocked"
+		t.uploadAudit(Audit)
+
+		logger.Warn(fmt.Sprintf("Blocked upload of %v by %v to agent %v by upload rule %v [sha256: %v]", File.Name, User, Agent.NameID, Rule.Name, Audit.Hash))
+
+		return false, errors.New("upload of " + File.Name + " blocked by rule " + Rule.Name + ": " + uploadReason(Rule))
+	}
+
+	return false, nil
+}
+
+// uploadMatch
+// returns the first upload rule the file matches.
+func (t *Teamserver) uploadMatch(File uploadFile, CommandLine string, Digests [3]string) *UploadRule {
+	t.Uploads.RLock()
+	defer t.Uploads.RUnlock()
+
+	for _, Rule := range t.Uploads.Rules {
+		if len(Rule.Digests) > 0 && !Rule.Digests[Digests[0]] && !Rule.Digests[Digests[1]] && !Rule.Digests[Digests[2]] {
+			continue
+		}
+
+		if Rule.Regex != nil && !Rule.Regex.MatchString(File.Name) && !Rule.Regex.MatchString(CommandLine) {
+			continue
+		}
+
+		if Rule.Match != nil && !Rule.Match.Match(File.Data) {
+			continue
+		}
+
+		return Rule
+	}
+
+	return nil
+}
+
+// uploadDecided
+// records the decision on a held back upload.
+func (t *Teamserver) uploadDecided(Pending *PendingTask, Decision, User string) {
+	if Pending.Upload == nil {
+		return
+	}
+
+	var Audit = *Pending.Upload
+
+	Audit.Decision = Decision
+	Audit.DecidedBy = User
+	Audit.Time = time.Now().Format("02/01/2006 15:04:05")
+
+	t.uploadAudit(Audit)
+}
+
+func (t *Teamserver) uploadAudit(Audit db.UploadAudit) {
+	if err := t.DB.UploadAuditAdd(Audit); err != nil {
+		logger.Error("Failed to add upload audit entry: " + err.Error())
+	}
+}
+
+// uploadFiles
+// returns the files the session input sends to the target: uploads
+// (fs upload of demons, upload of ssh sessions) and the binaries of
+// the commands executing them (inline-execute, dotnet, shellcode, dll).
+func uploadFiles(Info map[string]any) []uploadFile {
+	var (
+		Files          []uploadFile
+		CommandLine, _ = Info["CommandLine"].(string)
+		Fields         = strings.Fields(CommandLine)
+	)
+
+	if Encoded, ok := Info["Binary"].(string); ok && len(Encoded) > 0 {
+		if Data, err := base64.StdEncoding.DecodeString(Encoded); err == nil {
+			var Name = CommandLine
+
+			if len(Fields) > 1 {
+				Name = Fields[1]
+			}
+
+			Files = append(Files, uploadFile{Name: Name, Data: Data})
+		}
+	}
+
+	if SubCommand, _ := Info["SubCommand"].(string); SubCommand == "upload" {
+		var Arguments, _ = Info["Arguments"].(string)
+
+		if Name, Content, ok := strings.Cut(Arguments, ";"); ok {
+			DecodedName, err := base64.StdEncoding.DecodeString(Name)
+			if err != nil {
+				return Files
+			}
+
+			if Data, err := base64.StdEncoding.DecodeString(Content); err == nil {
+				Files = append(Files, uploadFile{Name: string(DecodedName), Data: Data})
+			}
+		}
+	}
+
+	if Encoded, ok := Info["Content"].(string); ok && len(Fields) > 1 && Fields[0] == "upload" {
+		if Data, err := base64.StdEncoding.DecodeString(Encoded); err == nil {
+			Files = append(Files, uploadFile{Name: strings.Join(Fields[1:], " "), Data: Data})
+		}
+	}
+
+	return Files
+}
+
+// uploadDigests
+// returns the md5, sha1 and sha256 hex digests of the data.
+func uploadDigests(Data []byte) [3]string {
+	var (
+		Md5    = md5.Sum(Data)
+		Sha1   = sha1.Sum(Data)
+		Sha256 = sha256.Sum256(Data)
+	)
+
+	return [3]string{hex.EncodeToString(Md5[:]), hex.EncodeToString(Sha1[:]), hex.EncodeToString(Sha256[:])}
+}
+
+// uploadRuleCompile
+// validates the rule and compiles its patterns.
+func uploadRuleCompile(Saved db.UploadRule) (*UploadRule, error) {
+	var (
+		Rule = &UploadRule{UploadRule: Saved}
+		err  error
+	)
+
+	if len(Rule.Name) == 0 {
+		return nil, errors.New("upload rule name is required")
+	}
+
+	switch Rule.Action = strings.ToLower(strings.TrimSpace(Rule.Action)); Rule.Action {
+	case "":
+		Rule.Action = UPLOAD_BLOCK
+	case UPLOAD_BLOCK, UPLOAD_APPROVAL:
+	default:
+		return nil, fmt.Errorf("upload rule %v has an unknown action %v (block or approval)", Rule.Name, Rule.Action)
+	}
+
+	for _, Hash := range strings.Split(Rule.Hashes, ",") {
+		if Hash = strings.ToLower(strings.TrimSpace(Hash)); len(Hash) == 0 {
+			continue
+		}
+
+		if Decoded, err := hex.DecodeString(Hash); err != nil || (len(Decoded) != md5.Size && len(Decoded) != sha1.Size && len(Decoded) != sha256.Size) {
+			return nil, fmt.Errorf("upload rule %v has an invalid hash %v (md5, sha1 or sha256)", Rule.Name, Hash)
+		}
+
+		if Rule.Digests == nil {
+			Rule.Digests = make(map[string]bool)
+		}
+
+		Rule.Digests[Hash] = true
+	}
+
+	if len(Rule.Pattern) > 0 {
+		if Rule.Regex, err = regexp.Compile("(?i)" + Rule.Pattern); err != nil {
+			return nil, fmt.Errorf("upload rule %v has an invalid pattern: %v", Rule.Name, err)
+		}
+	}
+
+	if len(Rule.Content) > 0 {
+		if Rule.Match, err = regexp.Compile(Rule.Content); err != nil {
+			return nil, fmt.Errorf("upload rule %v has an invalid content pattern: %v", Rule.Name, err)
+		}
+	}
+
+	if len(Rule.Digests) == 0 && Rule.Regex == nil && Rule.Match == nil {
+		return nil, errors.New("upload rule " + Rule.Name + " requires hashes, a pattern or a content pattern")
+	}
+
+	return Rule, nil
+}
+
+func uploadRuleFind(Rules []*UploadRule, Name string) int {
+	for i, Rule := range Rules {
+		if Rule.Name == Name {
+			return i
+		}
+	}
+
+	return -1
+}
+
+// uploadReason
+// tells the operator why the rule matched.
+func uploadReason(Rule *UploadRule) string {
+	if len(Rule.Reason) > 0 {
+		return Rule.Reason
+	}
+
+	if len(Rule.Category) > 0 {
+		return Rule.Category
+	}
+
+	return "restricted file"
+}
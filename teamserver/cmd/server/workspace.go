@@ -0,0 +1,172 @@
+package server
+
+import (
+	"Havoc/pkg/handlers"
+	"Havoc/pkg/packager"
+	"Havoc/pkg/profile"
+)
+
+// workspaceOrDefault
+// returns the default workspace if none has been specified.
+func workspaceOrDefault(Workspace string) string {
+	if len(Workspace) == 0 {
+		return profile.WORKSPACE_DEFAULT
+	}
+
+	return Workspace
+}
+
+// workspaceVisible
+// checks if an event of the given workspace should be sent to a
+// client in the client workspace. Events without a workspace are global.
+func workspaceVisible(ClientWorkspace, EventWorkspace string) bool {
+	if len(EventWorkspace) == 0 || EventWorkspace == profile.WORKSPACE_ALL {
+		return true
+	}
+
+	if ClientWorkspace == profile.WORKSPACE_ALL {
+		return true
+	}
+
+	return ClientWorkspace == EventWorkspace
+}
+
+// UserWorkspace
+// returns the workspace the operator has been assigned to.
+func (t *Teamserver) UserWorkspace(User string) string {
+	if t.Profile == nil {
+		return profile.WORKSPACE_DEFAULT
+	}
+
+	return t.Profile.UserWorkspace(User)
+}
+
+// ListenerWorkspace
+// returns the workspace of the listener. empty if the listener doesn't exist.
+func (t *Teamserver) ListenerWorkspace(Name string) string {
+	for _, listener := range t.Listeners {
+		if listener.Name != Name {
+			continue
+		}
+
+		switch listener.Config.(type) {
+		case *handlers.HTTP:
+			return listener.Config.(*handlers.HTTP).Config.Workspace
+
+		case *handlers.SMB:
+			return listener.Config.(*handlers.SMB).Config.Workspace
+
+		case *handlers.External:
+			return listener.Config.(*handlers.External).Config.Workspace
+		}
+	}
+
+	return ""
+}
+
+// AgentWorkspace
+// returns the workspace of the agent. empty if the agent doesn't exist.
+func (t *Teamserver) AgentWorkspace(AgentID string) string {
+	if Agent := t.Agents.Get(AgentID); Agent != nil && Agent.Info != nil {
+		return Agent.Info.Workspace
+	}
+
+	return ""
+}
+
+// EventWorkspace
+// figures out to which workspace the event belongs to by looking
+// at the agent, listener or operator it is about.
+func (t *Teamserver) EventWorkspace(pk packager.Package) string {
+	if len(pk.Head.Workspace) > 0 {
+		return pk.Head.Workspace
+	}
+
+	switch pk.Head.Event {
+
+	case packager.Type.Session.Type:
+		for _, Key := range []string{"DemonID", "NameID", "AgentID"} {
+			if AgentID, ok := pk.Body.Info[Key].(string); ok {
+				return t.AgentWorkspace(AgentID)
+			}
+		}
+		break
+
+	case packager.Type.Listener.Type:
+		if Name, ok := pk.Body.Info["Name"].(string); ok {
+			return t.ListenerWorkspace(Name)
+		}
+		break
+
+	case packager.Type.Chat.Type, packager.Type.Credentials.Type:
+		var User = pk.Head.User
+
+		if len(User) == 0 {
+			User, _ = pk.Body.Info["User"].(string)
+		}
+
+		if len(User) > 0 {
+			return t.UserWorkspace(User)
+		}
+		break
+
+	}
+
+	return ""
+}
+
+// ListenerNewWorkspace
+// returns the workspace a listener created by the operator is going to be in.
+// operators with access to every workspace can specify it.
+func (t *Teamserver) ListenerNewWorkspace(pk packager.Package) string {
+	var Workspace = t.UserWorkspace(pk.Head.User)
+
+	if Workspace == profile.WORKSPACE_ALL {
+		Workspace, _ = pk.Body.Info["Workspace"].(string)
+	}
+
+	return workspaceOrDefault(Workspace)
+}
+
+// workspaceAllowed
+// checks if the client is allowed to interact with the agent or
+// listener the package is about.
+func (t *Teamserver) workspaceAllowed(client *Client, pk packager.Package) bool {
+	var Workspace string
+
+	if client.Workspace == profile.WORKSPACE_ALL {
+		return true
+	}
+
+	switch pk.Head.Event {
+
+	case packager.Type.Session.Type, packager.Type.Snapshot.Type, packager.Type.Loot.Type, packager.Type.Template.Type, packager.Type.Batch.Type, packager.Type.Schedule.Type, packager.Type.Desktop.Type:
+		for _, Key := range []string{"DemonID", "AgentID"} {
+			if AgentID, ok := pk.Body.Info[Key].(string); ok {
+				Workspace = t.AgentWorkspace(AgentID)
+				break
+			}
+		}
+		break
+
+	case packager.Type.Listener.Type:
+		if pk.Body.SubEvent == packager.Type.Listener.Add {
+			/* new listeners are created in the workspace of the operator */
+			return true
+		}
+
+		if Name, ok := pk.Body.Info["Name"].(string); ok {
+			Workspace = t.ListenerWorkspace(Name)
+		}
+		break
+
+	case packager.Type.Gate.Type, packager.Type.Bundle.Type:
+		if Name, ok := pk.Body.Info["Listener"].(string); ok {
+			Workspace = t.ListenerWorkspace(Name)
+		}
+		break
+
+	}
+
+	return len(Workspace) == 0 || Workspace == client.Workspace
+}
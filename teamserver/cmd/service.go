@@ -0,0 +1,222 @@
+package cmd
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+
+	"Havoc/pkg/colors"
+	"Havoc/pkg/logger"
+	"Havoc/pkg/systemd"
+
+	"github.com/spf13/cobra"
+)
+
+var (
+	serviceFlags struct {
+		Name      string
+		Profile   string
+		Secrets   string
+		Database  string
+		User      string
+		Directory string
+		EnvFile   string
+		Print     bool
+		Start     bool
+	}
+
+	CobraInstallService = &cobra.Command{
+		Use:          "install-service",
+		Short:        "install the teamserver as a systemd service",
+		Long:         "Writes a hardened systemd unit for the teamserver and enables it. The teamserver runs as a dedicated account without a login shell (created if it doesn't exist), is restarted on failure and sandboxed to its working directory.\nThe profile is read-only to the service if it lives outside of the working directory, run havoc migrate on it after upgrading the teamserver.",
+		SilenceUsage: true,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			Unit, err := serviceUnit()
+			if err != nil {
+				return err
+			}
+
+			if serviceFlags.Print {
+				Content, err := Unit.Render()
+				if err != nil {
+					return err
+				}
+
+				fmt.Print(string(Content))
+				return nil
+			}
+
+			if err = serviceSupported(); err != nil {
+				return err
+			}
+
+			if err = Unit.Install(); err != nil {
+				return fmt.Errorf("failed to install the service: %w", err)
+			}
+
+			logger.Info(fmt.Sprintf("Installed service %v (%v) running as %v", colors.Blue(Unit.Name), Unit.Path(), colors.Blue(Unit.User)))
+
+			if !strings.HasPrefix(serviceFlags.Profile, Unit.Directory+"/") {
+				logger.Warn("The profile is outside of the working directory and read-only to the service")
+			}
+
+			if serviceFlags.Start {
+				return systemd.Systemctl("start", Unit.Name)
+			}
+
+			logger.Info(fmt.Sprintf("Start it with: havoc service start --name %v", Unit.Name))
+
+			return nil
+		},
+	}
+
+	CobraService = &cobra.Command{
+		Use:   "service",
+		Short: "manage the teamserver service installed with install-service",
+	}
+)
+
+func init() {
+	CobraInstallService.Flags().SortFlags = false
+	CobraInstallService.Flags().StringVarP(&serviceFlags.Name, "name", "", "havoc", "name of the service")
+	CobraInstallService.Flags().StringVarP(&serviceFlags.Profile, "profile", "", "", "set havoc teamserver profile")
+	CobraInstallService.Flags().StringVarP(&serviceFlags.Secrets, "secrets", "", "", "set file of the secrets the profile interpolates (${NAME})")
+	CobraInstallService.Flags().StringVarP(&serviceFlags.Database, "database", "", "", "set havoc teamserver database (default is data/teamserver.db)")
+	CobraInstallService.Flags().StringVarP(&serviceFlags.User, "user", "", "havoc", "account the teamserver runs as (created if it doesn't exist)")
+	CobraInstallService.Flags().StringVarP(&serviceFlags.Directory, "dir", "", "", "working directory of the teamserver (default is the current one)")
+	CobraInstallService.Flags().StringVarP(&serviceFlags.EnvFile, "env-file", "", "", "file of environment variables passed to the teamserver")
+	CobraInstallService.Flags().BoolVarP(&serviceFlags.Print, "print", "", false, "print the unit instead of installing it")
+	CobraInstallService.Flags().BoolVarP(&serviceFlags.Start, "start", "", false, "start the service after installing it")
+
+	CobraService.PersistentFlags().StringVarP(&serviceFlags.Name, "name", "", "havoc", "name of the service")
+
+	for _, Action := range []struct {
+		Name  string
+		Short string
+		Args  []string
+	}{
+		{Name: "start", Short: "start the teamserver service", Args: []string{"start"}},
+		{Name: "stop", Short: "stop the teamserver service", Args: []string{"stop"}},
+		{Name: "restart", Short: "restart the teamserver service", Args: []string{"restart"}},
+		{Name: "status", Short: "show the status and last logs of the teamserver service", Args: []string{"status", "--no-pager"}},
+	} {
+		var Args = Action.Args
+
+		CobraService.AddCommand(&cobra.Command{
+			Use:          Action.Name,
+			Short:        Action.Short,
+			SilenceUsage: true,
+			RunE: func(cmd *cobra.Command, args []string) error {
+				if err := serviceSupported(); err != nil {
+					return err
+				}
+
+				return systemd.Systemctl(append(Args, serviceFlags.Name)...)
+			},
+		})
+	}
+
+	CobraService.AddCommand(&cobra.Command{
+		Use:          "uninstall",
+		Short:        "stop and remove the teamserver service (keeps its account and data)",
+		SilenceUsage: true,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			if err := serviceSupported(); err != nil {
+				return err
+			}
+
+			if err := systemd.Uninstall(serviceFlags.Name); err != nil {
+				return err
+			}
+
+			logger.Info(fmt.Sprintf("Removed service %v", colors.Blue(serviceFlags.Name)))
+
+			return nil
+		},
+	})
+
+	HavocCli.AddCommand(CobraInstallService)
+	HavocCli.AddCommand(CobraService)
+}
+
+// serviceSupported
+// only systemd is supported. on windows run the teamserver in wsl.
+func serviceSupported() error {
+	if runtime.GOOS != "linux" {
+		return fmt.Errorf("services are only supported with systemd on linux, not on %v", runtime.GOOS)
+	}
+
+	if _, err := os.Stat("/run/systemd/system"); err != nil {
+		return errors.New("systemd isn't running on this host")
+	}
+
+	return nil
+}
+
+// serviceUnit
+// builds the unit of the service from the flags. paths are made
+// absolute since the unit doesn't run from the current directory.
+func serviceUnit() (*systemd.Unit, error) {
+	var (
+		Unit = &systemd.Unit{
+			Name: serviceFlags.Name,
+			User: serviceFlags.User,
+		}
+		err error
+	)
+
+	if len(serviceFlags.Profile) == 0 {
+		return nil, errors.New("specify the profile of the teamserver with --profile")
+	}
+
+	if len(Unit.Name) == 0 || strings.ContainsAny(Unit.Name, "/ \t") {
+		return nil, fmt.Errorf("invalid service name: %q", Unit.Name)
+	}
+
+	if Unit.User == "root" {
+		return nil, errors.New("the service has to run as a dedicated account, not root")
+	}
+
+	if Unit.Binary, err = os.Executable(); err != nil {
+		return nil, err
+	}
+
+	if Unit.Binary, err = filepath.EvalSymlinks(Unit.Binary); err != nil {
+		return nil, err
+	}
+
+	/* an empty directory becomes the current one */
+	for _, Path := range []*string{&serviceFlags.Directory, &serviceFlags.Profile, &serviceFlags.Secrets, &serviceFlags.Database, &serviceFlags.EnvFile} {
+		if len(*Path) == 0 && Path != &serviceFlags.Directory {
+			continue
+		}
+
+		if *Path, err = filepath.Abs(*Path); err != nil {
+			return nil, err
+		}
+	}
+
+	Unit.Directory = serviceFlags.Directory
+	Unit.Arguments = []string{"server", "--profile", serviceFlags.Profile}
+	Unit.Readable = []string{serviceFlags.Profile}
+
+	if len(serviceFlags.Secrets) > 0 {
+		Unit.Arguments = append(Unit.Arguments, "--secrets", serviceFlags.Secrets)
+		Unit.Readable = append(Unit.Readable, serviceFlags.Secrets)
+	}
+
+	if len(serviceFlags.Database) > 0 {
+		Unit.Arguments = append(Unit.Arguments, "--database", serviceFlags.Database)
+
+		if !strings.HasPrefix(serviceFlags.Database, Unit.Directory+"/") {
+			Unit.Writable = append(Unit.Writable, filepath.Dir(serviceFlags.Database))
+		}
+	}
+
+	Unit.EnvironmentFile = serviceFlags.EnvFile
+
+	return Unit, nil
+}
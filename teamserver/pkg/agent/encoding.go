@@ -0,0 +1,31 @@
+package agent
+
+import (
+	"Havoc/pkg/common"
+)
+
+// DecodeANSI
+// converts ansi text of the agent (BOF output, results of the ansi
+// win32 functions, file content) to utf-8.
+func (a *Agent) DecodeANSI(Data []byte) string {
+	var CodePage = 0
+
+	if a.Info != nil {
+		CodePage = a.Info.CodePage
+	}
+
+	return common.StripNull(common.DecodeCodePage(Data, CodePage))
+}
+
+// DecodeOEM
+// converts console output of the agent (output of the processes it
+// spawned over a pipe) to utf-8.
+func (a *Agent) DecodeOEM(Data []byte) string {
+	var CodePage = 0
+
+	if a.Info != nil {
+		CodePage = a.Info.OEMCodePage
+	}
+
+	return common.StripNull(common.DecodeCodePage(Data, CodePage))
+}
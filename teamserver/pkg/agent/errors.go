@@ -0,0 +1,258 @@
+package agent
+
+import (
+	"fmt"
+	"strconv"
+)
+
+// kinds of task failures (ErrorCode of the output). Clients localize and
+// act on them, the teamserver counts the failures by them.
+const (
+	ERROR_CODE_FAILED           = "failed"
+	ERROR_CODE_ACCESS_DENIED    = "access_denied"
+	ERROR_CODE_NOT_FOUND        = "not_found"
+	ERROR_CODE_EXISTS           = "exists"
+	ERROR_CODE_IN_USE           = "in_use"
+	ERROR_CODE_NOT_SUPPORTED    = "not_supported"
+	ERROR_CODE_INVALID_ARGUMENT = "invalid_argument"
+	ERROR_CODE_BLOCKED          = "blocked"
+	ERROR_CODE_TIMEOUT          = "timeout"
+	ERROR_CODE_NETWORK          = "network"
+	ERROR_CODE_RESOURCES        = "resources"
+	ERROR_CODE_CRASHED          = "crashed"
+	ERROR_CODE_MALFORMED        = "malformed"
+)
+
+var ErrorCodes = []string{
+	ERROR_CODE_FAILED,
+	ERROR_CODE_ACCESS_DENIED,
+	ERROR_CODE_NOT_FOUND,
+	ERROR_CODE_EXISTS,
+	ERROR_CODE_IN_USE,
+	ERROR_CODE_NOT_SUPPORTED,
+	ERROR_CODE_INVALID_ARGUMENT,
+	ERROR_CODE_BLOCKED,
+	ERROR_CODE_TIMEOUT,
+	ERROR_CODE_NETWORK,
+	ERROR_CODE_RESOURCES,
+	ERROR_CODE_CRASHED,
+	ERROR_CODE_MALFORMED,
+}
+
+// kinds of the win32 errors the demon reports
+var win32ErrorKinds = map[int]string{
+	5:    ERROR_CODE_ACCESS_DENIED, // ERROR_ACCESS_DENIED
+	19:   ERROR_CODE_ACCESS_DENIED, // ERROR_WRITE_PROTECT
+	65:   ERROR_CODE_ACCESS_DENIED, // ERROR_NETWORK_ACCESS_DENIED
+	1314: ERROR_CODE_ACCESS_DENIED, // ERROR_PRIVILEGE_NOT_HELD
+	1326: ERROR_CODE_ACCESS_DENIED, // ERROR_LOGON_FAILURE
+	1327: ERROR_CODE_ACCESS_DENIED, // ERROR_ACCOUNT_RESTRICTION
+	1330: ERROR_CODE_ACCESS_DENIED, // ERROR_PASSWORD_EXPIRED
+	1331: ERROR_CODE_ACCESS_DENIED, // ERROR_ACCOUNT_DISABLED
+	1385: ERROR_CODE_ACCESS_DENIED, // ERROR_LOGON_TYPE_NOT_GRANTED
+	1909: ERROR_CODE_ACCESS_DENIED, // ERROR_ACCOUNT_LOCKED_OUT
+
+	2:     ERROR_CODE_NOT_FOUND, // ERROR_FILE_NOT_FOUND
+	3:     ERROR_CODE_NOT_FOUND, // ERROR_PATH_NOT_FOUND
+	15:    ERROR_CODE_NOT_FOUND, // ERROR_INVALID_DRIVE
+	18:    ERROR_CODE_NOT_FOUND, // ERROR_NO_MORE_FILES
+	53:    ERROR_CODE_NOT_FOUND, // ERROR_BAD_NETPATH
+	67:    ERROR_CODE_NOT_FOUND, // ERROR_BAD_NET_NAME
+	126:   ERROR_CODE_NOT_FOUND, // ERROR_MOD_NOT_FOUND
+	127:   ERROR_CODE_NOT_FOUND, // ERROR_PROC_NOT_FOUND
+	1060:  ERROR_CODE_NOT_FOUND, // ERROR_SERVICE_DOES_NOT_EXIST
+	1168:  ERROR_CODE_NOT_FOUND, // ERROR_NOT_FOUND
+	1317:  ERROR_CODE_NOT_FOUND, // ERROR_NO_SUCH_USER
+	1332:  ERROR_CODE_NOT_FOUND, // ERROR_NONE_MAPPED
+	1355:  ERROR_CODE_NOT_FOUND, // ERROR_NO_SUCH_DOMAIN
+	11001: ERROR_CODE_NOT_FOUND, // WSAHOST_NOT_FOUND
+
+	80:   ERROR_CODE_EXISTS, // ERROR_FILE_EXISTS
+	183:  ERROR_CODE_EXISTS, // ERROR_ALREADY_EXISTS
+	1073: ERROR_CODE_EXISTS, // ERROR_SERVICE_EXISTS
+
+	32:   ERROR_CODE_IN_USE, // ERROR_SHARING_VIOLATION
+	33:   ERROR_CODE_IN_USE, // ERROR_LOCK_VIOLATION
+	170:  ERROR_CODE_IN_USE, // ERROR_BUSY
+	231:  ERROR_CODE_IN_USE, // ERROR_PIPE_BUSY
+	1056: ERROR_CODE_IN_USE, // ERROR_SERVICE_ALREADY_RUNNING
+	1219: ERROR_CODE_IN_USE, // ERROR_SESSION_CREDENTIAL_CONFLICT
+
+	1:   ERROR_CODE_NOT_SUPPORTED, // ERROR_INVALID_FUNCTION
+	50:  ERROR_CODE_NOT_SUPPORTED, // ERROR_NOT_SUPPORTED
+	120: ERROR_CODE_NOT_SUPPORTED, // ERROR_CALL_NOT_IMPLEMENTED
+	193: ERROR_CODE_NOT_SUPPORTED, // ERROR_BAD_EXE_FORMAT
+	216: ERROR_CODE_NOT_SUPPORTED, // ERROR_EXE_MACHINE_TYPE_MISMATCH
+
+	6:   ERROR_CODE_INVALID_ARGUMENT, // ERROR_INVALID_HANDLE
+	87:  ERROR_CODE_INVALID_ARGUMENT, // ERROR_INVALID_PARAMETER
+	123: ERROR_CODE_INVALID_ARGUMENT, // ERROR_INVALID_NAME
+	161: ERROR_CODE_INVALID_ARGUMENT, // ERROR_BAD_PATHNAME
+	206: ERROR_CODE_INVALID_ARGUMENT, // ERROR_FILENAME_EXCED_RANGE
+
+	225:  ERROR_CODE_BLOCKED, // ERROR_VIRUS_INFECTED
+	226:  ERROR_CODE_BLOCKED, // ERROR_VIRUS_DELETED
+	577:  ERROR_CODE_BLOCKED, // ERROR_INVALID_IMAGE_HASH
+	1260: ERROR_CODE_BLOCKED, // ERROR_ACCESS_DISABLED_BY_POLICY
+	1275: ERROR_CODE_BLOCKED, // ERROR_DRIVER_BLOCKED
+	4551: ERROR_CODE_BLOCKED, // ERROR_SYSTEM_INTEGRITY_POLICY_VIOLATION
+
+	121:   ERROR_CODE_TIMEOUT, // ERROR_SEM_TIMEOUT
+	258:   ERROR_CODE_TIMEOUT, // WAIT_TIMEOUT
+	1460:  ERROR_CODE_TIMEOUT, // ERROR_TIMEOUT
+	10060: ERROR_CODE_TIMEOUT, // WSAETIMEDOUT
+
+	51:    ERROR_CODE_NETWORK, // ERROR_REM_NOT_LIST
+	64:    ERROR_CODE_NETWORK, // ERROR_NETNAME_DELETED
+	1222:  ERROR_CODE_NETWORK, // ERROR_NO_NETWORK
+	1225:  ERROR_CODE_NETWORK, // ERROR_CONNECTION_REFUSED
+	1231:  ERROR_CODE_NETWORK, // ERROR_NETWORK_UNREACHABLE
+	1232:  ERROR_CODE_NETWORK, // ERROR_HOST_UNREACHABLE
+	1722:  ERROR_CODE_NETWORK, // RPC_S_SERVER_UNAVAILABLE
+	1727:  ERROR_CODE_NETWORK, // RPC_S_CALL_FAILED_DNE
+	10051: ERROR_CODE_NETWORK, // WSAENETUNREACH
+	10054: ERROR_CODE_NETWORK, // WSAECONNRESET
+	10061: ERROR_CODE_NETWORK, // WSAECONNREFUSED
+	10065: ERROR_CODE_NETWORK, // WSAEHOSTUNREACH
+
+	8:    ERROR_CODE_RESOURCES, // ERROR_NOT_ENOUGH_MEMORY
+	14:   ERROR_CODE_RESOURCES, // ERROR_OUTOFMEMORY
+	112:  ERROR_CODE_RESOURCES, // ERROR_DISK_FULL
+	1450: ERROR_CODE_RESOURCES, // ERROR_NO_SYSTEM_RESOURCES
+	1455: ERROR_CODE_RESOURCES, // ERROR_COMMITMENT_LIMIT
+}
+
+// kinds of the ntstatus codes the demon reports (eg: the exception of an
+// object file). other errors are crashes.
+var ntStatusKinds = map[uint32]string{
+	0xC0000022: ERROR_CODE_ACCESS_DENIED,    // STATUS_ACCESS_DENIED
+	0xC0000061: ERROR_CODE_ACCESS_DENIED,    // STATUS_PRIVILEGE_NOT_HELD
+	0xC0000034: ERROR_CODE_NOT_FOUND,        // STATUS_OBJECT_NAME_NOT_FOUND
+	0xC000003A: ERROR_CODE_NOT_FOUND,        // STATUS_OBJECT_PATH_NOT_FOUND
+	0xC0000135: ERROR_CODE_NOT_FOUND,        // STATUS_DLL_NOT_FOUND
+	0xC0000139: ERROR_CODE_NOT_FOUND,        // STATUS_ENTRYPOINT_NOT_FOUND
+	0xC0000035: ERROR_CODE_EXISTS,           // STATUS_OBJECT_NAME_COLLISION
+	0xC0000043: ERROR_CODE_IN_USE,           // STATUS_SHARING_VIOLATION
+	0xC0000002: ERROR_CODE_NOT_SUPPORTED,    // STATUS_NOT_IMPLEMENTED
+	0xC00000BB: ERROR_CODE_NOT_SUPPORTED,    // STATUS_NOT_SUPPORTED
+	0xC0000008: ERROR_CODE_INVALID_ARGUMENT, // STATUS_INVALID_HANDLE
+	0xC000000D: ERROR_CODE_INVALID_ARGUMENT, // STATUS_INVALID_PARAMETER
+	0xC0000906: ERROR_CODE_BLOCKED,          // STATUS_VIRUS_INFECTED
+	0xC0000907: ERROR_CODE_BLOCKED,          // STATUS_VIRUS_DELETED
+	0xC0000428: ERROR_CODE_BLOCKED,          // STATUS_INVALID_IMAGE_HASH
+	0xC0000361: ERROR_CODE_BLOCKED,          // STATUS_ACCESS_DISABLED_BY_POLICY_DEFAULT
+	0xC00000B5: ERROR_CODE_TIMEOUT,          // STATUS_IO_TIMEOUT
+	0xC0000017: ERROR_CODE_RESOURCES,        // STATUS_NO_MEMORY
+	0xC000009A: ERROR_CODE_RESOURCES,        // STATUS_INSUFFICIENT_RESOURCES
+}
+
+// kinds of the ldap errors the demon reports
+var ldapErrorKinds = map[int]string{
+	0x03: ERROR_CODE_TIMEOUT,
+	0x07: ERROR_CODE_NOT_SUPPORTED,
+	0x08: ERROR_CODE_ACCESS_DENIED,
+	0x20: ERROR_CODE_NOT_FOUND,
+	0x22: ERROR_CODE_INVALID_ARGUMENT,
+	0x31: ERROR_CODE_ACCESS_DENIED,
+	0x32: ERROR_CODE_ACCESS_DENIED,
+	0x33: ERROR_CODE_IN_USE,
+	0x34: ERROR_CODE_NETWORK,
+	0x35: ERROR_CODE_NOT_SUPPORTED,
+	0x51: ERROR_CODE_NETWORK,
+	0x55: ERROR_CODE_TIMEOUT,
+	0x57: ERROR_CODE_INVALID_ARGUMENT,
+	0x5a: ERROR_CODE_RESOURCES,
+	0x5b: ERROR_CODE_NETWORK,
+}
+
+// TaskError
+// marks the output as the failure of a task. The code is the kind of the
+// failure (ERROR_CODE_*), the message what the operators read.
+func TaskError(Output map[string]string, Code, Message string) {
+	Output["Type"] = "Error"
+	Output["Message"] = Message
+	Output["ErrorCode"] = Code
+}
+
+// TaskErrorWin32
+// marks the output as the failure of a task the demon reported with a
+// win32 error. The error is passed on as ErrorStatus and ErrorName.
+func TaskErrorWin32(Output map[string]string, Status int, Message string) {
+	TaskError(Output, ErrorWin32(Status), Message)
+
+	Output["ErrorStatus"] = strconv.Itoa(Status)
+	if Name, ok := Win32ErrorCodes[Status]; ok {
+		Output["ErrorName"] = Name
+	}
+}
+
+// TaskErrorNtStatus
+// marks the output as the failure of a task the demon reported with a
+// ntstatus (eg: an exception).
+func TaskErrorNtStatus(Output map[string]string, Status uint32, Message string) {
+	TaskError(Output, ErrorNtStatus(Status), Message)
+
+	Output["ErrorStatus"] = fmt.Sprintf("0x%x", Status)
+}
+
+// ErrorWin32
+// returns the kind of the win32 error.
+func ErrorWin32(Status int) string {
+	if Code, ok := win32ErrorKinds[Status]; ok {
+		return Code
+	}
+
+	return ERROR_CODE_FAILED
+}
+
+// ErrorNtStatus
+// returns the kind of the ntstatus.
+func ErrorNtStatus(Status uint32) string {
+	if Code, ok := ntStatusKinds[Status]; ok {
+		return Code
+	}
+
+	/* errors that aren't failures of an api are exceptions */
+	if Status&0xC0000000 == 0xC0000000 || Status&0xC0000000 == 0x80000000 {
+		return ERROR_CODE_CRASHED
+	}
+
+	return ERROR_CODE_FAILED
+}
+
+// ErrorLdap
+// returns the kind of the ldap error.
+func ErrorLdap(Status int) string {
+	if Code, ok := ldapErrorKinds[Status]; ok {
+		return Code
+	}
+
+	return ERROR_CODE_FAILED
+}
+
+// ErrorInject
+// returns the kind of the status of an injection.
+func ErrorInject(Status int) string {
+	switch Status {
+
+	case INJECT_ERROR_INVALID_PARAM:
+		return ERROR_CODE_INVALID_ARGUMENT
+
+	case INJECT_ERROR_PROCESS_ARCH_MISMATCH, 0x1001, 0x1002:
+		return ERROR_CODE_NOT_SUPPORTED
+
+	}
+
+	return ERROR_CODE_FAILED
+}
+
+// ErrorAdcs
+// returns the kind of the disposition of a certificate request that
+// didn't issue a certificate.
+func ErrorAdcs(Disposition int) string {
+	if Disposition == ADCS_DISP_DENIED {
+		return ERROR_CODE_ACCESS_DENIED
+	}
+
+	return ERROR_CODE_FAILED
+}
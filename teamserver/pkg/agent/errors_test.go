@@ -0,0 +1,43 @@
+package agent
+
+import "testing"
+
+func TestTaskErrorWin32(t *testing.T) {
+	for Status, Code := range map[int]string{
+		5:    ERROR_CODE_ACCESS_DENIED,
+		2:    ERROR_CODE_NOT_FOUND,
+		225:  ERROR_CODE_BLOCKED,
+		1460: ERROR_CODE_TIMEOUT,
+		4242: ERROR_CODE_FAILED,
+	} {
+		var Output = make(map[string]string)
+
+		TaskErrorWin32(Output, Status, "failed")
+
+		if Output["Type"] != "Error" || Output["ErrorCode"] != Code {
+			t.Errorf("win32 error %v is a %v %v, want an Error %v", Status, Output["Type"], Output["ErrorCode"], Code)
+		}
+	}
+
+	var Output = make(map[string]string)
+
+	TaskErrorWin32(Output, 5, "failed")
+
+	if Output["ErrorStatus"] != "5" || Output["ErrorName"] != "ERROR_ACCESS_DENIED" {
+		t.Errorf("win32 error 5 passed on as %v %v", Output["ErrorStatus"], Output["ErrorName"])
+	}
+}
+
+func TestErrorNtStatus(t *testing.T) {
+	for Status, Code := range map[uint32]string{
+		0xC0000022: ERROR_CODE_ACCESS_DENIED,
+		0xC0000906: ERROR_CODE_BLOCKED,
+		0xC0000005: ERROR_CODE_CRASHED,
+		0x80000003: ERROR_CODE_CRASHED,
+		0x00000103: ERROR_CODE_FAILED,
+	} {
+		if Got := ErrorNtStatus(Status); Got != Code {
+			t.Errorf("ErrorNtStatus(0x%x) = %v, want %v", Status, Got, Code)
+		}
+	}
+}
@@ -0,0 +1,185 @@
+package agent
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"Havoc/pkg/common"
+)
+
+// items of the answer of COMMAND_FILESEARCH
+const (
+	FILESEARCH_ITEM_END   = 0x0
+	FILESEARCH_ITEM_MATCH = 0x1
+)
+
+// defaults and bounds of a file search
+const (
+	// subdirectories below the path that get searched
+	FILESEARCH_DEPTH = 32
+	// matches after which the agent stops searching
+	FILESEARCH_MATCHES     = 5000
+	FILESEARCH_MATCHES_MAX = 100000
+	// name patterns of a search the demon takes
+	FILESEARCH_PATTERNS_MAX = 16
+)
+
+// seconds between 1601 (FILETIME) and 1970 (unix time)
+const fileTimeEpoch = 11644473600
+
+// FileMatch
+// file an agent found searching a host. Offset is where the content
+// matched the grep of the search, -1 if the search didn't grep.
+type FileMatch struct {
+	Path       string
+	Size       int64
+	Modified   time.Time
+	Attributes int
+	Offset     int64
+}
+
+// FileSearch
+// options of a file search an operator tasked.
+type FileSearch struct {
+	Path     string
+	Patterns []string
+	Depth    int
+	MinSize  int64
+	MaxSize  int64
+	After    time.Time
+	Before   time.Time
+	Grep     string
+	Max      int
+}
+
+// FileSearchOptions
+// parses the options of a file search task. Patterns are separated by
+// ; or , (eg: *.kdbx;*.kdb), sizes take a unit (eg: 10MB) and dates are
+// yyyy-mm-dd.
+func FileSearchOptions(Optional map[string]any) (FileSearch, error) {
+	var (
+		Search = FileSearch{Depth: FILESEARCH_DEPTH, Max: FILESEARCH_MATCHES}
+		err    error
+	)
+
+	Search.Path, _ = Optional["Path"].(string)
+	Search.Grep, _ = Optional["Grep"].(string)
+
+	if Search.Path = strings.TrimSpace(Search.Path); len(Search.Path) == 0 {
+		return Search, errors.New("file search needs a path")
+	}
+
+	if Patterns, ok := Optional["Patterns"].(string); ok {
+		for _, Pattern := range strings.FieldsFunc(Patterns, func(r rune) bool { return r == ';' || r == ',' }) {
+			if Pattern = strings.TrimSpace(Pattern); len(Pattern) > 0 {
+				Search.Patterns = append(Search.Patterns, Pattern)
+			}
+		}
+	}
+
+	if len(Search.Patterns) > FILESEARCH_PATTERNS_MAX {
+		return Search, fmt.Errorf("file search takes at most %v patterns", FILESEARCH_PATTERNS_MAX)
+	}
+
+	for Key, Value := range map[string]*int{"Depth": &Search.Depth, "Max": &Search.Max} {
+		if val, ok := Optional[Key].(string); ok && len(val) > 0 {
+			if *Value, err = strconv.Atoi(val); err != nil || *Value < 0 {
+				return Search, errors.New("file search " + strings.ToLower(Key) + " has to be a positive number")
+			}
+		}
+	}
+
+	if Search.Max == 0 || Search.Max > FILESEARCH_MATCHES_MAX {
+		return Search, fmt.Errorf("file search max has to be between 1 and %v", FILESEARCH_MATCHES_MAX)
+	}
+
+	for Key, Value := range map[string]*int64{"MinSize": &Search.MinSize, "MaxSize": &Search.MaxSize} {
+		if val, ok := Optional[Key].(string); ok && len(val) > 0 {
+			if *Value, err = FileSize(val); err != nil {
+				return Search, fmt.Errorf("file search %v: %v", strings.ToLower(Key), err)
+			}
+		}
+	}
+
+	for Key, Value := range map[string]*time.Time{"After": &Search.After, "Before": &Search.Before} {
+		if val, ok := Optional[Key].(string); ok && len(val) > 0 {
+			if *Value, err = time.Parse("2006-01-02", val); err != nil {
+				return Search, fmt.Errorf("file search %v has to be a date (yyyy-mm-dd)", strings.ToLower(Key))
+			}
+		}
+	}
+
+	/* the whole day of before is included */
+	if !Search.Before.IsZero() {
+		Search.Before = Search.Before.Add(24*time.Hour - time.Second)
+	}
+
+	return Search, nil
+}
+
+// FileSize
+// parses a size with an optional unit (B, KB, MB, GB).
+func FileSize(Size string) (int64, error) {
+	var (
+		Value = strings.ToUpper(strings.TrimSpace(Size))
+		Unit  = int64(1)
+	)
+
+	for _, Suffix := range []struct {
+		Name string
+		Unit int64
+	}{{"GB", 1 << 30}, {"MB", 1 << 20}, {"KB", 1 << 10}, {"G", 1 << 30}, {"M", 1 << 20}, {"K", 1 << 10}, {"B", 1}} {
+		if strings.HasSuffix(Value, Suffix.Name) {
+			Value, Unit = strings.TrimSpace(strings.TrimSuffix(Value, Suffix.Name)), Suffix.Unit
+			break
+		}
+	}
+
+	Number, err := strconv.ParseInt(Value, 10, 64)
+	if err != nil || Number < 0 {
+		return 0, errors.New("invalid size " + Size)
+	}
+
+	return Number * Unit, nil
+}
+
+// FileTime
+// converts a windows FILETIME (100ns since 1601) to a time.
+func FileTime(FileTime int64) time.Time {
+	if FileTime <= 0 {
+		return time.Time{}
+	}
+
+	return time.Unix(FileTime/10000000-fileTimeEpoch, FileTime%10000000*100).UTC()
+}
+
+// FileTimeOf
+// converts a time to a windows FILETIME. zero for the zero time.
+func FileTimeOf(Time time.Time) int64 {
+	if Time.IsZero() {
+		return 0
+	}
+
+	return (Time.Unix()+fileTimeEpoch)*10000000 + int64(Time.Nanosecond()/100)
+}
+
+// fileSearchOutput
+// formats the matches of a file search like the demon lists directories.
+func fileSearchOutput(Matches []FileMatch) string {
+	var Output strings.Builder
+
+	for _, Match := range Matches {
+		fmt.Fprintf(&Output, " %-10v  %-16v  %v", common.ByteCountSI(Match.Size), Match.Modified.Format("02/01/2006 15:04"), Match.Path)
+
+		if Match.Offset >= 0 {
+			fmt.Fprintf(&Output, " (matched at %v)", Match.Offset)
+		}
+
+		Output.WriteString("\n")
+	}
+
+	return Output.String()
+}
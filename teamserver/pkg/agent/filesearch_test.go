@@ -0,0 +1,65 @@
+package agent
+
+import (
+	"testing"
+	"time"
+)
+
+func TestFileSearchOptions(t *testing.T) {
+	Search, err := FileSearchOptions(map[string]any{
+		"Path":     `C:\Users`,
+		"Patterns": "*.kdbx; *.kdb,",
+		"MinSize":  "1KB",
+		"MaxSize":  "10 mb",
+		"Before":   "2026-01-31",
+		"Grep":     "password",
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(Search.Patterns) != 2 || Search.Patterns[1] != "*.kdb" {
+		t.Errorf("patterns %q, want *.kdbx and *.kdb", Search.Patterns)
+	}
+
+	if Search.MinSize != 1024 || Search.MaxSize != 10<<20 {
+		t.Errorf("sizes %v to %v", Search.MinSize, Search.MaxSize)
+	}
+
+	if Search.Depth != FILESEARCH_DEPTH || Search.Max != FILESEARCH_MATCHES {
+		t.Errorf("depth %v and max %v instead of the defaults", Search.Depth, Search.Max)
+	}
+
+	/* the day of before is included */
+	if Search.Before.Format("2006-01-02 15:04:05") != "2026-01-31 23:59:59" {
+		t.Errorf("before %v", Search.Before)
+	}
+
+	for _, Optional := range []map[string]any{
+		{},
+		{"Path": `C:\`, "MinSize": "10 parsecs"},
+		{"Path": `C:\`, "After": "31/01/2026"},
+		{"Path": `C:\`, "Max": "0"},
+	} {
+		if _, err = FileSearchOptions(Optional); err == nil {
+			t.Errorf("options %v accepted", Optional)
+		}
+	}
+}
+
+func TestFileTime(t *testing.T) {
+	var Time = time.Date(2026, 10, 15, 12, 30, 0, 0, time.UTC)
+
+	/* 2026-10-15 12:30:00 UTC as the demon reads it from a find data */
+	if FileTimeOf(Time) != 134365410000000000 {
+		t.Errorf("FileTimeOf(%v) = %v", Time, FileTimeOf(Time))
+	}
+
+	if !FileTime(FileTimeOf(Time)).Equal(Time) {
+		t.Errorf("FileTime(FileTimeOf(%v)) = %v", Time, FileTime(FileTimeOf(Time)))
+	}
+
+	if !FileTime(0).IsZero() || FileTimeOf(time.Time{}) != 0 {
+		t.Errorf("zero times aren't kept")
+	}
+}
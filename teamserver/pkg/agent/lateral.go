@@ -0,0 +1,94 @@
+package agent
+
+import (
+	"fmt"
+	"math/rand"
+	"time"
+
+	"Havoc/pkg/common"
+	"Havoc/pkg/win32"
+)
+
+// TokenMake
+// queues the creation of a token using the credentials. The agent
+// impersonates the token so network access uses the credentials.
+func (a *Agent) TokenMake(Domain, User, Password string) Job {
+	var job = Job{
+		Command:   COMMAND_TOKEN,
+		RequestID: rand.Uint32(),
+		Data: []interface{}{
+			DEMON_COMMAND_TOKEN_MAKE,
+			common.EncodeUTF16(Domain),
+			common.EncodeUTF16(User),
+			common.EncodeUTF16(Password),
+			win32.LOGON32_LOGON_NEW_CREDENTIALS,
+		},
+		CommandLine: fmt.Sprintf("token make %v %v ********", Domain, User),
+		Created:     time.Now().UTC().Format("02/01/2006 15:04:05"),
+	}
+
+	a.AddJobToQueue(job)
+
+	return job
+}
+
+// TokenRevert
+// queues the revert to the original token of the agent.
+func (a *Agent) TokenRevert() Job {
+	var job = Job{
+		Command:   COMMAND_TOKEN,
+		RequestID: rand.Uint32(),
+		Data: []interface{}{
+			DEMON_COMMAND_TOKEN_REVERT,
+		},
+		CommandLine: "token revert",
+		Created:     time.Now().UTC().Format("02/01/2006 15:04:05"),
+	}
+
+	a.AddJobToQueue(job)
+
+	return job
+}
+
+// Upload
+// queues the upload of the content to the path on the agent.
+func (a *Agent) Upload(Path string, Content []byte) Job {
+	var job = Job{
+		Command:   COMMAND_FS,
+		RequestID: rand.Uint32(),
+		Data: []interface{}{
+			DEMON_COMMAND_FS_UPLOAD,
+			append([]byte(common.EncodeUTF16(Path)), []byte{0, 0}...),
+			a.UploadMemFileInChunks(Content),
+		},
+		CommandLine: fmt.Sprintf("upload %v (%v)", Path, common.ByteCountSI(int64(len(Content)))),
+		Created:     time.Now().UTC().Format("02/01/2006 15:04:05"),
+	}
+
+	a.AddJobToQueue(job)
+
+	return job
+}
+
+// Shell
+// queues the execution of the command using cmd.exe. The output is piped back.
+func (a *Agent) Shell(Command string) Job {
+	var job = Job{
+		Command:   COMMAND_PROC,
+		RequestID: rand.Uint32(),
+		Data: []interface{}{
+			DEMON_COMMAND_PROC_CREATE,
+			0,
+			common.EncodeUTF16("c:\\windows\\system32\\cmd.exe"),
+			common.EncodeUTF16("/c " + Command),
+			1,
+			0,
+		},
+		CommandLine: "shell " + Command,
+		Created:     time.Now().UTC().Format("02/01/2006 15:04:05"),
+	}
+
+	a.AddJobToQueue(job)
+
+	return job
+}
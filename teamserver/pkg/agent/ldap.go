@@ -0,0 +1,180 @@
+package agent
+
+import (
+	"encoding/base64"
+	"encoding/binary"
+	"fmt"
+	"strings"
+	"unicode/utf8"
+)
+
+// ldap search scopes (see winldap.h)
+const (
+	LDAP_SCOPE_BASE     = 0
+	LDAP_SCOPE_ONELEVEL = 1
+	LDAP_SCOPE_SUBTREE  = 2
+)
+
+// limits of a ldap search
+const (
+	LDAP_PAGE_SIZE   = 100
+	LDAP_PAGE_MAX    = 1000
+	LDAP_ENTRIES     = 1000
+	LDAP_ENTRIES_MAX = 100000
+)
+
+var ldapScopes = map[string]int{
+	"base":     LDAP_SCOPE_BASE,
+	"one":      LDAP_SCOPE_ONELEVEL,
+	"onelevel": LDAP_SCOPE_ONELEVEL,
+	"sub":      LDAP_SCOPE_SUBTREE,
+	"subtree":  LDAP_SCOPE_SUBTREE,
+}
+
+// error codes of the ldap api the demon might return
+var ldapErrors = map[int]string{
+	0x01: "operations error",
+	0x02: "protocol error",
+	0x03: "time limit exceeded",
+	0x07: "auth method not supported",
+	0x08: "stronger auth required",
+	0x20: "no such object",
+	0x22: "invalid dn syntax",
+	0x31: "invalid credentials",
+	0x32: "insufficient rights",
+	0x33: "busy",
+	0x34: "unavailable",
+	0x35: "unwilling to perform",
+	0x51: "server down",
+	0x52: "local error",
+	0x55: "timeout",
+	0x57: "filter error",
+	0x5a: "no memory",
+	0x5b: "connect error",
+}
+
+// LdapError
+// returns the description of the ldap status.
+func LdapError(Status int) string {
+	if Description, ok := ldapErrors[Status]; ok {
+		return fmt.Sprintf("%v (0x%x)", Description, Status)
+	}
+
+	return fmt.Sprintf("ldap error 0x%x", Status)
+}
+
+// LdapScope
+// returns the ldap scope of the name. defaults to the subtree.
+func LdapScope(Name string) (int, error) {
+	if len(Name) == 0 {
+		return LDAP_SCOPE_SUBTREE, nil
+	}
+
+	if Scope, ok := ldapScopes[strings.ToLower(Name)]; ok {
+		return Scope, nil
+	}
+
+	return 0, fmt.Errorf("invalid ldap scope: %v", Name)
+}
+
+// LdapSID
+// converts a binary security identifier into its string form.
+func LdapSID(Value []byte) string {
+	if len(Value) < 8 || int(Value[1])*4+8 != len(Value) {
+		return base64.StdEncoding.EncodeToString(Value)
+	}
+
+	var (
+		Authority uint64
+		SID       = fmt.Sprintf("S-%d", Value[0])
+	)
+
+	for _, b := range Value[2:8] {
+		Authority = Authority<<8 | uint64(b)
+	}
+
+	SID += fmt.Sprintf("-%d", Authority)
+
+	for i := 0; i < int(Value[1]); i++ {
+		SID += fmt.Sprintf("-%d", binary.LittleEndian.Uint32(Value[8+i*4:]))
+	}
+
+	return SID
+}
+
+// LdapGUID
+// converts a binary guid into its string form.
+func LdapGUID(Value []byte) string {
+	if len(Value) != 16 {
+		return base64.StdEncoding.EncodeToString(Value)
+	}
+
+	return fmt.Sprintf("%08x-%04x-%04x-%x-%x",
+		binary.LittleEndian.Uint32(Value[0:4]),
+		binary.LittleEndian.Uint16(Value[4:6]),
+		binary.LittleEndian.Uint16(Value[6:8]),
+		Value[8:10], Value[10:16])
+}
+
+// ldapValue
+// converts the value of the attribute into a string. values that
+// aren't text get base64 encoded.
+func ldapValue(Attribute string, Value []byte) string {
+	switch strings.ToLower(Attribute) {
+
+	case "objectsid", "sidhistory", "securityidentifier":
+		return LdapSID(Value)
+
+	case "objectguid", "msds-generationid":
+		return LdapGUID(Value)
+
+	}
+
+	if !utf8.Valid(Value) {
+		return base64.StdEncoding.EncodeToString(Value)
+	}
+
+	return string(Value)
+}
+
+// LdapType
+// returns the type of directory object the entry is.
+func LdapType(Entry LdapEntry) string {
+	var Classes = make(map[string]bool)
+
+	for Name, Values := range Entry.Attributes {
+		if strings.EqualFold(Name, "objectClass") {
+			for _, Class := range Values {
+				Classes[strings.ToLower(Class)] = true
+			}
+		}
+	}
+
+	/* computers are users as well */
+	switch {
+
+	case Classes["computer"]:
+		return "computer"
+
+	case Classes["group"]:
+		return "group"
+
+	case Classes["user"]:
+		return "user"
+
+	case Classes["pkicertificatetemplate"]:
+		return "template"
+
+	case Classes["pkienrollmentservice"]:
+		return "ca"
+
+	case Classes["organizationalunit"]:
+		return "ou"
+
+	case Classes["domain"], Classes["domaindns"]:
+		return "domain"
+
+	}
+
+	return "object"
+}
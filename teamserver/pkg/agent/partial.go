@@ -0,0 +1,117 @@
+package agent
+
+import (
+	"fmt"
+	"sync"
+)
+
+// chunks of a request the agent may send ahead of a missing one. a stream
+// with a bigger gap is dropped instead of buffering the output forever.
+const PARTIAL_PENDING_MAX = 256
+
+// PartialChunk
+// ordered chunk of the output of a request that is still running. the
+// demon sends them as CALLBACK_OUTPUT_PARTIAL, Final marks the last one.
+// Total is the size of the output up to the chunk once it is in order.
+type PartialChunk struct {
+	Sequence uint32
+	Final    bool
+	Output   []byte
+	Total    int
+}
+
+// PartialStream
+// reorder state of the partial output of a request.
+type PartialStream struct {
+	Next    uint32
+	Size    int
+	Pending map[uint32]PartialChunk
+}
+
+// PartialStreams
+// partial output of the running requests of the agent by request id.
+type PartialStreams struct {
+	sync.Mutex
+	Streams map[uint32]*PartialStream
+}
+
+// PartialOutput
+// puts the chunk of the output of the request back in order and returns the
+// chunks that are ready to be printed, oldest first. Chunks sent again are
+// dropped, chunks ahead of a missing one wait for it. The stream of the
+// request is forgotten once the final chunk got returned.
+func (a *Agent) PartialOutput(RequestID uint32, Chunk PartialChunk) ([]PartialChunk, error) {
+	var Ready []PartialChunk
+
+	a.Partials.Lock()
+	defer a.Partials.Unlock()
+
+	if a.Partials.Streams == nil {
+		a.Partials.Streams = make(map[uint32]*PartialStream)
+	}
+
+	var Stream, ok = a.Partials.Streams[RequestID]
+	if !ok {
+		Stream = &PartialStream{Pending: make(map[uint32]PartialChunk)}
+		a.Partials.Streams[RequestID] = Stream
+	}
+
+	if Chunk.Sequence < Stream.Next {
+		return nil, nil
+	}
+
+	if _, ok = Stream.Pending[Chunk.Sequence]; !ok && len(Stream.Pending) >= PARTIAL_PENDING_MAX {
+		delete(a.Partials.Streams, RequestID)
+		return nil, fmt.Errorf("chunk %v of the output is missing, dropped %v chunks waiting for it", Stream.Next, len(Stream.Pending))
+	}
+
+	Stream.Pending[Chunk.Sequence] = Chunk
+
+	for {
+		var Next, ok = Stream.Pending[Stream.Next]
+		if !ok {
+			break
+		}
+
+		delete(Stream.Pending, Stream.Next)
+
+		Stream.Next++
+		Stream.Size += len(Next.Output)
+		Next.Total = Stream.Size
+
+		Ready = append(Ready, Next)
+
+		if Next.Final {
+			delete(a.Partials.Streams, RequestID)
+			break
+		}
+	}
+
+	return Ready, nil
+}
+
+// PartialClose
+// forgets the partial output of the request (eg: the job of it died) and
+// returns how many chunks of it never arrived. chunks that wait for them
+// get dropped. false if the request had no unfinished output.
+func (a *Agent) PartialClose(RequestID uint32) (int, bool) {
+	a.Partials.Lock()
+	defer a.Partials.Unlock()
+
+	var Stream, ok = a.Partials.Streams[RequestID]
+	if !ok {
+		return 0, false
+	}
+
+	delete(a.Partials.Streams, RequestID)
+
+	/* every sequence up to the last one that arrived is owed */
+	var Last = Stream.Next
+	for Sequence := range Stream.Pending {
+		if Sequence+1 > Last {
+			Last = Sequence + 1
+		}
+	}
+
+	return int(Last-Stream.Next) - len(Stream.Pending), true
+}
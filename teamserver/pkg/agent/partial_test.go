@@ -0,0 +1,65 @@
+package agent
+
+import "testing"
+
+func TestPartialOutput(t *testing.T) {
+	var (
+		Agent  = &Agent{NameID: "aaaaaaaa"}
+		Output string
+	)
+
+	var Send = func(Sequence uint32, Final bool, Data string) []PartialChunk {
+		Chunks, err := Agent.PartialOutput(1, PartialChunk{Sequence: Sequence, Final: Final, Output: []byte(Data)})
+		if err != nil {
+			t.Fatalf("chunk %v: %v", Sequence, err)
+		}
+
+		for _, Chunk := range Chunks {
+			Output += string(Chunk.Output)
+		}
+
+		return Chunks
+	}
+
+	/* out of order, then a chunk sent twice */
+	Send(0, false, "a")
+	if Chunks := Send(2, false, "c"); len(Chunks) != 0 {
+		t.Fatalf("chunk 2 printed before chunk 1")
+	}
+	Send(1, false, "b")
+	Send(1, false, "b")
+
+	var Chunks = Send(3, true, "d")
+	if Output != "abcd" {
+		t.Fatalf("output %q, want abcd", Output)
+	}
+
+	if len(Chunks) != 1 || Chunks[0].Total != 4 {
+		t.Fatalf("final chunk %+v", Chunks)
+	}
+
+	if _, Open := Agent.PartialClose(1); Open {
+		t.Fatalf("stream still open after its final chunk")
+	}
+}
+
+func TestPartialClose(t *testing.T) {
+	var Agent = &Agent{NameID: "aaaaaaaa"}
+
+	Agent.PartialOutput(1, PartialChunk{Sequence: 0})
+	Agent.PartialOutput(1, PartialChunk{Sequence: 3})
+
+	if Missing, Open := Agent.PartialClose(1); !Open || Missing != 2 {
+		t.Fatalf("%v chunks missing (open: %v), want 2", Missing, Open)
+	}
+
+	for Sequence := uint32(1); Sequence <= PARTIAL_PENDING_MAX; Sequence++ {
+		if _, err := Agent.PartialOutput(2, PartialChunk{Sequence: Sequence}); err != nil {
+			t.Fatalf("chunk %v dropped: %v", Sequence, err)
+		}
+	}
+
+	if _, err := Agent.PartialOutput(2, PartialChunk{Sequence: PARTIAL_PENDING_MAX + 1}); err == nil {
+		t.Fatalf("stream buffered more than %v chunks", PARTIAL_PENDING_MAX)
+	}
+}
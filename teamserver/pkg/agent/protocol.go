@@ -0,0 +1,134 @@
+package agent
+
+import (
+	"fmt"
+
+	"Havoc/pkg/common"
+	"Havoc/pkg/common/parser"
+)
+
+/*
+ * version of the demon metadata layout (registration and checkin).
+ * version 1 agents don't send a version. newer agents send it after
+ * the agent id with DEMON_PROTOCOL_FLAG set, which never is set in
+ * the length of the host name a version 1 agent sends at that place.
+ */
+const (
+	DEMON_PROTOCOL_FLAG = 0x80000000
+
+	// proxy path only sent by http agents
+	DEMON_PROTOCOL_V1 = 1
+	// proxy mode sent by every transport. followed by the capabilities
+	DEMON_PROTOCOL_V2 = 2
+	// max response size the agent (or its transport) takes. follows the capabilities
+	DEMON_PROTOCOL_V3 = 3
+	// time zone bias and name of the host. follow the max response size
+	DEMON_PROTOCOL_V4 = 4
+	// host, user and domain name in utf-16. ansi and oem code page follow the time zone
+	DEMON_PROTOCOL_V5 = 5
+
+	DEMON_PROTOCOL_VERSION = DEMON_PROTOCOL_V5
+)
+
+// metadata following the working hours, one parser for every supported version.
+var metaDataParsers = map[int]func(Parser *parser.Parser, Info *AgentInfo){
+	DEMON_PROTOCOL_V1: func(Parser *parser.Parser, Info *AgentInfo) {
+		Info.ProxyPath = ParseProxyPath(Parser)
+	},
+
+	DEMON_PROTOCOL_V2: func(Parser *parser.Parser, Info *AgentInfo) {
+		Info.ProxyPath = ParseProxyPath(Parser)
+		Info.Capabilities = ParseCapabilities(Parser)
+	},
+
+	DEMON_PROTOCOL_V3: func(Parser *parser.Parser, Info *AgentInfo) {
+		Info.ProxyPath = ParseProxyPath(Parser)
+		Info.Capabilities = ParseCapabilities(Parser)
+		Info.MaxResponse = ParseMaxResponse(Parser)
+	},
+
+	DEMON_PROTOCOL_V4: func(Parser *parser.Parser, Info *AgentInfo) {
+		Info.ProxyPath = ParseProxyPath(Parser)
+		Info.Capabilities = ParseCapabilities(Parser)
+		Info.MaxResponse = ParseMaxResponse(Parser)
+		ParseTimeZone(Parser, Info)
+	},
+
+	DEMON_PROTOCOL_V5: func(Parser *parser.Parser, Info *AgentInfo) {
+		Info.ProxyPath = ParseProxyPath(Parser)
+		Info.Capabilities = ParseCapabilities(Parser)
+		Info.MaxResponse = ParseMaxResponse(Parser)
+		ParseTimeZone(Parser, Info)
+		ParseCodePages(Parser, Info)
+	},
+}
+
+// ParseProtocolVersion
+// returns the protocol version of the metadata and removes it
+// from the parser so the layout is the same for every version.
+// The parser has to point to the agent id.
+func ParseProtocolVersion(Parser *parser.Parser) (int, error) {
+	var Version = Parser.PeekInt32(4)
+
+	if Version&DEMON_PROTOCOL_FLAG == 0 {
+		return DEMON_PROTOCOL_V1, nil
+	}
+
+	Parser.Remove(4, 4)
+
+	Version &^= DEMON_PROTOCOL_FLAG
+	if _, ok := metaDataParsers[Version]; !ok {
+		return Version, fmt.Errorf("agent protocol version %v is not supported (supported: %v-%v)", Version, DEMON_PROTOCOL_V1, DEMON_PROTOCOL_VERSION)
+	}
+
+	return Version, nil
+}
+
+// ParseMetaData
+// parses the metadata following the working hours of the protocol version.
+func ParseMetaData(Version int, Parser *parser.Parser, Info *AgentInfo) {
+	if Parse, ok := metaDataParsers[Version]; ok {
+		Parse(Parser, Info)
+	}
+}
+
+// ParseName
+// parses a host, user or domain name of the metadata. Version 5 agents
+// send them in utf-16, older ones in the ansi code page of the host.
+func ParseName(Version int, Parser *parser.Parser) string {
+	if Version >= DEMON_PROTOCOL_V5 {
+		return Parser.ParseUTF16StringMax()
+	}
+
+	return common.StripNull(common.DecodeCodePage(Parser.ParseBytesMax(parser.MaxStringSize), 0))
+}
+
+// ParseCodePages
+// parses the ansi and oem (console) code page of the host. unknown
+// code pages are kept as 0.
+func ParseCodePages(Parser *parser.Parser, Info *AgentInfo) {
+	if !Parser.CanIRead([]parser.ReadType{parser.ReadInt32, parser.ReadInt32}) {
+		return
+	}
+
+	for _, CodePage := range []*int{&Info.CodePage, &Info.OEMCodePage} {
+		if *CodePage = Parser.ParseInt32(); !common.CodePageKnown(*CodePage) {
+			*CodePage = 0
+		}
+	}
+}
+
+// ParseMaxResponse
+// parses the max response size the agent advertised. 0 if it has no limit.
+func ParseMaxResponse(Parser *parser.Parser) int {
+	if !Parser.CanIRead([]parser.ReadType{parser.ReadInt32}) {
+		return 0
+	}
+
+	var MaxResponse = Parser.ParseInt32()
+	if MaxResponse < 0 {
+		return 0
+	}
+
+	return MaxResponse
+}
@@ -0,0 +1,151 @@
+package agent
+
+import (
+	"hash/fnv"
+	"sort"
+	"sync"
+	"sync/atomic"
+)
+
+// shards of the session registry. checkins of agents in different
+// shards don't contend on the same lock.
+const AGENTS_SHARDS = 32
+
+// Agents
+// concurrent safe registry of the sessions, keyed by their NameID.
+// The zero value is an empty registry ready to use. It must not be
+// copied after first use.
+type Agents struct {
+	shards [AGENTS_SHARDS]agentsShard
+
+	// registration counter. keeps List in the order the agents registered
+	sequence atomic.Uint64
+	count    atomic.Int64
+}
+
+type agentsShard struct {
+	sync.RWMutex
+	agents map[string]agentsEntry
+}
+
+type agentsEntry struct {
+	Agent    *Agent
+	Sequence uint64
+}
+
+func (agents *Agents) shard(NameID string) *agentsShard {
+	var Hash = fnv.New32a()
+
+	Hash.Write([]byte(NameID))
+
+	return &agents.shards[Hash.Sum32()%AGENTS_SHARDS]
+}
+
+// Add
+// registers the agent. Returns false and leaves the registry untouched
+// if an agent with the same NameID is already registered.
+func (agents *Agents) Add(Agent *Agent) bool {
+	var shard = agents.shard(Agent.NameID)
+
+	shard.Lock()
+	defer shard.Unlock()
+
+	if _, ok := shard.agents[Agent.NameID]; ok {
+		return false
+	}
+
+	if shard.agents == nil {
+		shard.agents = make(map[string]agentsEntry)
+	}
+
+	shard.agents[Agent.NameID] = agentsEntry{
+		Agent:    Agent,
+		Sequence: agents.sequence.Add(1),
+	}
+
+	agents.count.Add(1)
+
+	return true
+}
+
+// Get
+// returns the registered agent or nil if there is none with the NameID.
+func (agents *Agents) Get(NameID string) *Agent {
+	var shard = agents.shard(NameID)
+
+	shard.RLock()
+	defer shard.RUnlock()
+
+	return shard.agents[NameID].Agent
+}
+
+// Remove
+// removes the agent from the registry. Returns false if it wasn't registered.
+func (agents *Agents) Remove(Agent *Agent) bool {
+	var shard = agents.shard(Agent.NameID)
+
+	shard.Lock()
+	defer shard.Unlock()
+
+	if Entry, ok := shard.agents[Agent.NameID]; !ok || Entry.Agent != Agent {
+		return false
+	}
+
+	delete(shard.agents, Agent.NameID)
+	agents.count.Add(-1)
+
+	return true
+}
+
+// Len
+// returns the count of registered agents.
+func (agents *Agents) Len() int {
+	return int(agents.count.Load())
+}
+
+// Range
+// calls Routine for every registered agent (in no particular order)
+// till it returns false. Routine runs on a snapshot of the registry so
+// it is free to add or remove agents.
+func (agents *Agents) Range(Routine func(Agent *Agent) bool) {
+	for _, Entry := range agents.entries() {
+		if !Routine(Entry.Agent) {
+			return
+		}
+	}
+}
+
+// List
+// returns a snapshot of the registered agents in the order they registered.
+func (agents *Agents) List() []*Agent {
+	var (
+		Entries = agents.entries()
+		List    = make([]*Agent, len(Entries))
+	)
+
+	sort.Slice(Entries, func(i, j int) bool {
+		return Entries[i].Sequence < Entries[j].Sequence
+	})
+
+	for i := range Entries {
+		List[i] = Entries[i].Agent
+	}
+
+	return List
+}
+
+func (agents *Agents) entries() []agentsEntry {
+	var Entries = make([]agentsEntry, 0, agents.Len())
+
+	for i := range agents.shards {
+		var shard = &agents.shards[i]
+
+		shard.RLock()
+		for _, Entry := range shard.agents {
+			Entries = append(Entries, Entry)
+		}
+		shard.RUnlock()
+	}
+
+	return Entries
+}
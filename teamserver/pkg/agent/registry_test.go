@@ -0,0 +1,146 @@
+package agent
+
+import (
+	"fmt"
+	"sync"
+	"testing"
+)
+
+// run with -race. the tests hammer the registry the way thousands of
+// agents checking in at the same time do.
+
+func TestAgentsAddOnce(t *testing.T) {
+	var (
+		Agents Agents
+		Added  = make(chan *Agent, 64)
+		Wait   sync.WaitGroup
+	)
+
+	/* the same agent registering over multiple listeners at once */
+	for i := 0; i < 64; i++ {
+		Wait.Add(1)
+		go func() {
+			defer Wait.Done()
+
+			var Session = &Agent{NameID: "deadbeef"}
+			if Agents.Add(Session) {
+				Added <- Session
+			}
+		}()
+	}
+
+	Wait.Wait()
+	close(Added)
+
+	if len(Added) != 1 {
+		t.Fatalf("agent registered %v times", len(Added))
+	}
+
+	if Session := <-Added; Agents.Get("deadbeef") != Session {
+		t.Fatal("registry returns another agent than the one that got registered")
+	}
+
+	if Agents.Len() != 1 {
+		t.Fatalf("registry has %v agents instead of 1", Agents.Len())
+	}
+}
+
+func TestAgentsConcurrent(t *testing.T) {
+	var (
+		Agents Agents
+		Wait   sync.WaitGroup
+	)
+
+	const Count = 2000
+
+	for i := 0; i < Count; i++ {
+		Wait.Add(3)
+
+		var (
+			NameID  = fmt.Sprintf("%08x", i)
+			Archive = i%2 == 0
+		)
+
+		/* checkin: register and look the agent up right away */
+		go func() {
+			defer Wait.Done()
+
+			var Session = &Agent{NameID: NameID}
+
+			if !Agents.Add(Session) {
+				t.Errorf("agent %v already registered", NameID)
+			}
+
+			if Archive {
+				return
+			}
+
+			if Agents.Get(NameID) != Session {
+				t.Errorf("agent %v not found after registering it", NameID)
+			}
+		}()
+
+		/* operators listing the sessions meanwhile */
+		go func() {
+			defer Wait.Done()
+
+			Agents.Range(func(Agent *Agent) bool {
+				return Agent != nil
+			})
+
+			_ = Agents.List()
+		}()
+
+		/* sessions getting archived meanwhile */
+		go func() {
+			defer Wait.Done()
+
+			if Archive {
+				if Session := Agents.Get(NameID); Session != nil {
+					Agents.Remove(Session)
+				}
+			}
+		}()
+	}
+
+	Wait.Wait()
+
+	if List := Agents.List(); len(List) != Agents.Len() {
+		t.Fatalf("list has %v agents but the registry counts %v", len(List), Agents.Len())
+	}
+
+	/* remove the rest */
+	Agents.Range(func(Agent *Agent) bool {
+		if !Agents.Remove(Agent) {
+			t.Errorf("failed to remove agent %v", Agent.NameID)
+		}
+		return true
+	})
+
+	if Agents.Len() != 0 || len(Agents.List()) != 0 {
+		t.Fatalf("registry not empty: %v agents left", Agents.Len())
+	}
+}
+
+func TestAgentsList(t *testing.T) {
+	var Agents Agents
+
+	for i := 0; i < 100; i++ {
+		Agents.Add(&Agent{NameID: fmt.Sprintf("%08x", 1000-i)})
+	}
+
+	/* removing an agent that isn't registered (anymore) is a no-op */
+	if Agents.Remove(&Agent{NameID: fmt.Sprintf("%08x", 1000)}) {
+		t.Fatal("removed another agent with the same id")
+	}
+
+	for i, Agent := range Agents.List() {
+		if Agent.NameID != fmt.Sprintf("%08x", 1000-i) {
+			t.Fatalf("agent %v listed at %v. list isn't in registration order", Agent.NameID, i)
+		}
+	}
+
+	if Agents.Get("ffffffff") != nil {
+		t.Fatal("got an agent that never registered")
+	}
+}
@@ -0,0 +1,176 @@
+package agent
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+)
+
+// limits of the script engine of the demon (see payloads/Demon/include/core/Script.h)
+const (
+	SCRIPT_MAX_SIZE   = 0x10000
+	SCRIPT_MAX_TOKENS = 16
+	SCRIPT_MAX_DEPTH  = 16
+)
+
+// minimum number of arguments of every script command
+var scriptCommands = map[string]int{
+	"set":      1,
+	"print":    0,
+	"cat":      1,
+	"write":    1,
+	"append":   1,
+	"rm":       1,
+	"mkdir":    1,
+	"cp":       2,
+	"mv":       2,
+	"ls":       1,
+	"cd":       1,
+	"pwd":      0,
+	"hostname": 0,
+	"whoami":   0,
+	"fail":     0,
+	"exit":     0,
+}
+
+// scriptTokens
+// splits the script line into its tokens the way the demon does.
+func scriptTokens(Line string, Comments bool) ([]string, error) {
+	var (
+		Tokens []string
+		Token  strings.Builder
+		Quoted = false
+		InWord = false
+	)
+
+	for _, c := range Line {
+		switch {
+
+		case c == '"':
+			Quoted = !Quoted
+			InWord = true
+
+		case !Quoted && (c == ' ' || c == '\t'):
+			if InWord {
+				Tokens = append(Tokens, Token.String())
+				Token.Reset()
+				InWord = false
+			}
+
+		case c == '#' && Comments && !InWord && !Quoted:
+			return Tokens, nil
+
+		default:
+			Token.WriteRune(c)
+			InWord = true
+		}
+	}
+
+	if Quoted {
+		return nil, errors.New("unterminated quote")
+	}
+
+	if InWord {
+		Tokens = append(Tokens, Token.String())
+	}
+
+	return Tokens, nil
+}
+
+// ScriptVerify
+// checks the script for errors before it gets sent to the demon
+// so syntax errors don't cost a callback.
+func ScriptVerify(Source string) error {
+	var Depth = 0
+
+	if len(strings.TrimSpace(Source)) == 0 {
+		return errors.New("script is empty")
+	}
+
+	if len(Source) > SCRIPT_MAX_SIZE {
+		return fmt.Errorf("script is bigger than %v bytes", SCRIPT_MAX_SIZE)
+	}
+
+	if strings.ContainsRune(Source, 0) {
+		return errors.New("script contains null bytes")
+	}
+
+	for i, Line := range strings.Split(Source, "\n") {
+		Tokens, err := scriptTokens(strings.TrimRight(Line, "\r"), true)
+		if err != nil {
+			return fmt.Errorf("line %v: %v", i+1, err)
+		}
+
+		if len(Tokens) == 0 {
+			continue
+		}
+
+		if len(Tokens) > SCRIPT_MAX_TOKENS {
+			return fmt.Errorf("line %v: too many arguments", i+1)
+		}
+
+		switch Tokens[0] {
+
+		case "if":
+			var Valid = len(Tokens) == 2 ||
+				(len(Tokens) == 3 && Tokens[1] == "exists") ||
+				(len(Tokens) == 4 && (Tokens[2] == "==" || Tokens[2] == "!="))
+
+			if !Valid {
+				return fmt.Errorf("line %v: invalid if condition", i+1)
+			}
+
+			if Depth++; Depth > SCRIPT_MAX_DEPTH {
+				return fmt.Errorf("line %v: if blocks nested too deep", i+1)
+			}
+
+			break
+
+		case "else":
+			if Depth == 0 {
+				return fmt.Errorf("line %v: else without if", i+1)
+			}
+
+			break
+
+		case "end":
+			if Depth == 0 {
+				return fmt.Errorf("line %v: end without if", i+1)
+			}
+
+			Depth--
+			break
+
+		default:
+			Min, ok := scriptCommands[Tokens[0]]
+			if !ok {
+				return fmt.Errorf("line %v: unknown command: %v", i+1, Tokens[0])
+			}
+
+			if len(Tokens)-1 < Min {
+				return fmt.Errorf("line %v: missing arguments: %v", i+1, Tokens[0])
+			}
+
+			break
+		}
+	}
+
+	if Depth > 0 {
+		return errors.New("missing end of if block")
+	}
+
+	return nil
+}
+
+// ScriptArguments
+// splits the arguments of a script run. arguments can be quoted using "".
+func ScriptArguments(Arguments string) []string {
+	var Args, err = scriptTokens(Arguments, false)
+
+	if err != nil {
+		/* unterminated quote: use the arguments as they are */
+		return strings.Fields(Arguments)
+	}
+
+	return Args
+}
@@ -0,0 +1,294 @@
+package agent
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"math/rand"
+	"net"
+
+	"Havoc/pkg/budget"
+	"Havoc/pkg/common/lznt1"
+	"Havoc/pkg/logger"
+	"Havoc/pkg/socks"
+)
+
+// SocksHandler
+// returns the handler of the clients of a socks5 proxy of the teamserver.
+// Route returns the agent that connects to the destination the client
+// asked for, nil refuses the client (eg: no route to the network).
+func SocksHandler(teamserver TeamServer, Name string, Route func(Header socks.SocksHeader) *Agent) func(s *socks.Socks, conn net.Conn) {
+	return func(s *socks.Socks, conn net.Conn) {
+		defer teamserver.Recover("socks proxy " + Name)
+
+		var (
+			NegotiationHeader socks.NegotiationHeader
+			SocksHeader       socks.SocksHeader
+			err               error
+		)
+
+		// parse all the methods supported by the client
+		NegotiationHeader, err = socks.SubNegotiationClient(conn)
+		if err != nil {
+			logger.Error("Failed to read socks negotiation header: " + err.Error())
+			return
+		}
+
+		// we only support NOAUTH, there is no real need to support other types
+		HasNoAuth := false
+		for _, Method := range NegotiationHeader.Methods {
+			if Method == socks.NoAuth {
+				HasNoAuth = true
+				break
+			}
+		}
+
+		// is NOAUTH is not an option, then bail out
+		if HasNoAuth == false {
+			_, err = conn.Write([]byte{socks.Version, socks.NoMatch})
+			if err != nil {
+				logger.Error("Failed to send response to socks client: " + err.Error())
+			}
+			return
+		}
+
+		// tell the client that we support NOAUTH
+		_, err = conn.Write([]byte{socks.Version, socks.NoAuth})
+		if err != nil {
+			logger.Error("Failed to send response to socks client: " + err.Error())
+			return
+		}
+
+		SocksHeader, err = socks.ReadSocksHeader(conn)
+		if err != nil {
+			logger.Error("Failed to read socks header: " + err.Error())
+			return
+		}
+
+		/* check if it's a CONNECT command */
+		if SocksHeader.Command != socks.ConnectCommand {
+			err = socks.SendCommandNotSupported(conn)
+			if err != nil {
+				logger.Error("Failed to send response to socks client: " + err.Error())
+				return
+			}
+			return
+		}
+
+		// NOTE: if you don't want to support IPv6, uncomment this:
+		/*
+			if SocksHeader.ATYP == socks.IPv6 {
+				err = socks.SendAddressTypeNotSupported(conn)
+				if err != nil {
+					logger.Error("Failed to send response to socks client: " + err.Error())
+					return
+				}
+				return
+			}
+		*/
+
+		var Agent = Route(SocksHeader)
+		if Agent == nil {
+			socks.SendConnectFailure(conn, socks.WSAENETUNREACH, SocksHeader.ATYP, SocksHeader.IpDomain, SocksHeader.Port)
+			conn.Close()
+			return
+		}
+
+		if SocketId, ok := Agent.SocksConnect(teamserver, Name, conn, SocksHeader, false); ok {
+			s.Clients = append(s.Clients, SocketId)
+		}
+	}
+}
+
+// SocksConnect
+// lets the agent connect to the destination of the header and relays the
+// connection of the client to the socket of the agent. Raw connections
+// (port forwards) don't get the socks5 reply once the agent connected.
+// Returns the id of the socket.
+func (a *Agent) SocksConnect(teamserver TeamServer, Name string, conn net.Conn, Header socks.SocksHeader, Raw bool) (int32, bool) {
+	var (
+		Budget                      = teamserver.Budget(budget.PIVOTS)
+		FrameSize, Window, Compress = teamserver.SocksFlowControl()
+		SocketId                    int32
+		Flags                       = SOCKET_FLAG_WINDOW
+	)
+
+	if Compress {
+		Flags |= SOCKET_FLAG_COMPRESS
+	}
+
+	/* every client takes a goroutine and a frame of memory */
+	if !Budget.Acquire(budget.Goroutines, 1) {
+		logger.Warn(fmt.Sprintf("Socks proxy %v exceeds the goroutine budget of the pivots", Name))
+		conn.Close()
+		return 0, false
+	}
+
+	if !Budget.Acquire(budget.Memory, int64(FrameSize)) {
+		logger.Warn(fmt.Sprintf("Socks proxy %v exceeds the memory budget of the pivots", Name))
+		Budget.Release(budget.Goroutines, 1)
+		conn.Close()
+		return 0, false
+	}
+
+	/* generate some random socket id */
+	SocketId = int32(rand.Uint32())
+
+	var Client = a.SocksClientAdd(SocketId, conn, Header.ATYP, Header.IpDomain, Header.Port)
+
+	Client.Raw = Raw
+
+	/* the connect starts the clock of the round trip of the stream */
+	a.StreamOpened(&Client.Stats, Name)
+	a.StreamSent(&Client.Stats, 0)
+
+	/* now parse the host:port and send it to the agent. agents
+	 * that don't know the flags ignore them and don't agree on any */
+	a.AddJobToQueue(Job{
+		Command: COMMAND_SOCKET,
+		Data: []any{
+			SOCKET_COMMAND_CONNECT,
+			SocketId,
+			Header.ATYP,
+			Header.IpDomain,
+			Header.Port,
+			int32(Flags),
+		},
+	})
+
+	/* goroutine to read from socks proxy socket and send it to the agent */
+	go func(SocketId int) {
+		defer teamserver.Recover("socks proxy " + Name)
+		defer Budget.Release(budget.Memory, int64(FrameSize))
+		defer Budget.Release(budget.Goroutines, 1)
+
+		for {
+
+			/* check if the connection is still up */
+			if client := a.SocksClientGet(SocketId); client != nil {
+
+				if !client.Connected {
+					/* if we are still not connected then skip */
+					continue
+				}
+
+				/* don't read more than the agent can keep up with */
+				if !a.SocksClientWait(client, Window) {
+					break
+				}
+
+				if Data, err := a.SocksClientRead(client, FrameSize); err == nil {
+
+					/* only send the data if there is something... */
+					if len(Data) > 0 {
+						var Length = len(Data)
+
+						client.Pending.Add(int64(Length))
+
+						/* make a new job */
+						var job = Job{
+							Command: COMMAND_SOCKET,
+							Data: []any{
+								SOCKET_COMMAND_WRITE,
+								client.SocketID,
+								Data,
+							},
+						}
+
+						if client.Compress {
+							job.Data[2] = socksCompress(Data)
+							job.Compressed = true
+						}
+
+						/* append the job to the task queue */
+						a.AddJobToQueue(job)
+
+						a.StreamSent(&client.Stats, Length)
+					}
+
+				} else {
+
+					if err != io.EOF {
+
+						/* we failed to read from the socks proxy */
+						logger.Error(fmt.Sprintf("Failed to read from socket %08x: %v", SocketId, err))
+
+						a.StreamFailed(&client.Stats)
+
+						a.SocksClientClose(int32(SocketId))
+
+						/* make a new job */
+						var job = Job{
+							Command: COMMAND_SOCKET,
+							Data: []any{
+								SOCKET_COMMAND_CLOSE,
+								int32(SocketId),
+							},
+						}
+
+						/* append the job to the task queue */
+						a.AddJobToQueue(job)
+
+					}
+
+					break
+				}
+
+			} else {
+				/* seems like it has been removed. let's exit this routine */
+
+				break
+			}
+
+		}
+
+	}(int(SocketId))
+
+	return SocketId, true
+}
+
+// socksCompress
+// compresses a frame of a socks client (lznt1, the agent has it in ntdll).
+// The frame starts with the size of the data, a frame of the same size
+// holds the data as is because it didn't get any smaller.
+func socksCompress(Data []byte) []byte {
+	var (
+		Compressed = lznt1.Compress(Data)
+		Frame      = binary.LittleEndian.AppendUint32(nil, uint32(len(Data)))
+	)
+
+	if len(Compressed) >= len(Data) {
+		return append(Frame, Data...)
+	}
+
+	return append(Frame, Compressed...)
+}
+
+// socksDecompress
+// decompresses a frame of a socks client (see socksCompress).
+func socksDecompress(Frame []byte) ([]byte, error) {
+	if len(Frame) < 4 {
+		return nil, errors.New("frame too small")
+	}
+
+	var Size = int(binary.LittleEndian.Uint32(Frame))
+	if Size > DEMON_MAX_RESPONSE_LENGTH {
+		return nil, fmt.Errorf("frame of %v bytes too big", Size)
+	}
+
+	if Size == len(Frame)-4 {
+		return Frame[4:], nil
+	}
+
+	Data, err := lznt1.Decompress(Frame[4:], Size)
+	if err != nil {
+		return nil, err
+	}
+
+	if len(Data) != Size {
+		return nil, fmt.Errorf("frame of %v bytes decompressed to %v bytes", Size, len(Data))
+	}
+
+	return Data, nil
+}
@@ -0,0 +1,117 @@
+package agent
+
+import (
+	"bytes"
+	"testing"
+	"time"
+)
+
+func TestSocksWindow(t *testing.T) {
+	var (
+		Parent = &Agent{NameID: "11111111"}
+		Pivot  = &Agent{NameID: "22222222", Pivots: Pivots{Parent: Parent}}
+		Client = Pivot.SocksClientAdd(1, nil, 1, []byte{10, 0, 0, 1}, 80)
+		Write  = Job{Command: COMMAND_SOCKET, Data: []any{SOCKET_COMMAND_WRITE, int32(1), make([]byte, 100)}}
+	)
+
+	Client.Pending.Add(100)
+
+	/* without acknowledgements a pivot can't be held back */
+	if !Pivot.SocksClientWait(Client, 10) {
+		t.Fatal("pivot client without acknowledgements blocked")
+	}
+
+	/* fetching the write doesn't release what the agent acknowledges */
+	Client.Acknowledged = true
+	Pivot.SocksClientFetched([]Job{Write})
+
+	if Client.Pending.Load() != 100 {
+		t.Fatalf("fetch released the window to %v", Client.Pending.Load())
+	}
+
+	var Done = make(chan bool)
+	go func() {
+		Done <- Pivot.SocksClientWait(Client, 10)
+	}()
+
+	select {
+	case <-Done:
+		t.Fatal("pivot client read past its window")
+	case <-time.After(300 * time.Millisecond):
+	}
+
+	Pivot.SocksClientAcknowledged(1, 95)
+
+	select {
+	case Read := <-Done:
+		if !Read {
+			t.Fatal("client gone after the acknowledgement")
+		}
+	case <-time.After(time.Second):
+		t.Fatal("acknowledgement didn't release the window")
+	}
+
+	Pivot.SocksClientAcknowledged(1, 50)
+	if Client.Pending.Load() != 0 {
+		t.Errorf("window at %v after acknowledging more than pending", Client.Pending.Load())
+	}
+}
+
+func TestSocksCompress(t *testing.T) {
+	for _, Data := range [][]byte{
+		bytes.Repeat([]byte("HTTP/1.1 200 OK\r\n"), 400),
+		{0xde, 0xad, 0xbe, 0xef},
+	} {
+		var Frame = socksCompress(Data)
+
+		Decompressed, err := socksDecompress(Frame)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if !bytes.Equal(Decompressed, Data) {
+			t.Errorf("frame of %v bytes changed", len(Data))
+		}
+	}
+
+	for _, Bad := range [][]byte{{1, 0}, {0xff, 0xff, 0xff, 0x7f, 0}, {8, 0, 0, 0, 0x05, 0xb0}} {
+		if _, err := socksDecompress(Bad); err == nil {
+			t.Errorf("%x decompressed", Bad)
+		}
+	}
+}
+
+func TestSocksCompressQueued(t *testing.T) {
+	var (
+		Agent  = &Agent{NameID: "11111111"}
+		Frames = [][]byte{
+			bytes.Repeat([]byte("HTTP/1.1 200 OK\r\n"), 100),
+			bytes.Repeat([]byte("Content-Length: 0\r\n"), 100),
+		}
+	)
+
+	for _, Frame := range Frames {
+		Agent.AddJobToQueue(Job{
+			Command:    COMMAND_SOCKET,
+			Data:       []any{SOCKET_COMMAND_WRITE, int32(1), socksCompress(Frame)},
+			Compressed: true,
+		})
+	}
+
+	/* the agent only reads the size of the first frame of a write */
+	var Jobs = Agent.GetQueuedJobs()
+	if len(Jobs) != len(Frames) {
+		t.Fatalf("compressed writes coalesced into %v jobs", len(Jobs))
+	}
+
+	for i, job := range Jobs {
+		Data, err := socksDecompress(job.Data[2].([]byte))
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if !bytes.Equal(Data, Frames[i]) {
+			t.Errorf("frame %v changed", i)
+		}
+	}
+}
@@ -0,0 +1,306 @@
+package agent
+
+import (
+	"fmt"
+	"math"
+	"net"
+	"strconv"
+	"sync"
+	"time"
+
+	"Havoc/pkg/socks"
+)
+
+const (
+	// time constant of the byte rate of the streams. older traffic fades
+	// out so the rate shows what the stream does right now.
+	STREAM_RATE_WINDOW = 10 * time.Second
+	// weight of a new round trip sample in the smoothed round trip (rfc 6298)
+	STREAM_RTT_ALPHA = 0.125
+)
+
+// StreamStats
+// counters of a pivot stream: a socks client, a forward of a route or a
+// client of a reverse port forward. Sent is the traffic queued for the
+// agent, Received the traffic of the agent written to the client.
+type StreamStats struct {
+	sync.Mutex
+
+	Proxy    string
+	Opened   time.Time
+	Streams  int64
+	Sent     int64
+	Received int64
+	Frames   int64
+	Errors   int64
+	RTT      time.Duration
+	Samples  int64
+
+	rate    float64
+	rated   time.Time
+	waiting time.Time
+}
+
+// StreamInfo
+// state of a pivot stream (or the totals of the streams of an agent) for
+// the clients and the api. Rate is in bytes per second, RTT in milliseconds
+// (-1 if not measured yet).
+type StreamInfo struct {
+	AgentID   string
+	SocketID  string
+	Type      string
+	Proxy     string
+	Target    string
+	Path      []string
+	Opened    string
+	Streams   int64
+	Sent      int64
+	Received  int64
+	Rate      int64
+	RTT       int64
+	Samples   int64
+	Errors    int64
+	ErrorRate float64
+}
+
+// StreamOpened
+// starts counting the stream of the proxy (eg: the port of the socks proxy).
+func (a *Agent) StreamOpened(Stats *StreamStats, Proxy string) {
+	var Now = time.Now()
+
+	Stats.Lock()
+	Stats.Proxy = Proxy
+	Stats.Opened = Now
+	Stats.Unlock()
+
+	a.Streams.Lock()
+	if a.Streams.Opened.IsZero() {
+		a.Streams.Opened = Now
+	}
+	a.Streams.Streams++
+	a.Streams.Unlock()
+}
+
+// StreamSent
+// counts the bytes queued for the agent. The round trip of the stream is
+// measured from the first write to the first answer of the agent, a write
+// of zero bytes (eg: the connect of a socks client) only starts the clock.
+func (a *Agent) StreamSent(Stats *StreamStats, Bytes int) {
+	var Now = time.Now()
+
+	Stats.Lock()
+	Stats.add(int64(Bytes), 0, Now)
+	if Stats.waiting.IsZero() {
+		Stats.waiting = Now
+	}
+	Stats.Unlock()
+
+	a.Streams.Lock()
+	a.Streams.add(int64(Bytes), 0, Now)
+	a.Streams.Unlock()
+}
+
+// StreamReceived
+// counts the bytes the agent sent to the client of the stream.
+func (a *Agent) StreamReceived(Stats *StreamStats, Bytes int) {
+	var (
+		Now    = time.Now()
+		Sample time.Duration
+	)
+
+	Stats.Lock()
+	Stats.add(0, int64(Bytes), Now)
+	if !Stats.waiting.IsZero() {
+		Sample = Now.Sub(Stats.waiting)
+		Stats.waiting = time.Time{}
+		Stats.sample(Sample)
+	}
+	Stats.Unlock()
+
+	a.Streams.Lock()
+	a.Streams.add(0, int64(Bytes), Now)
+	if Sample > 0 {
+		a.Streams.sample(Sample)
+	}
+	a.Streams.Unlock()
+}
+
+// StreamFailed
+// counts a failed connect, read or write of the stream.
+func (a *Agent) StreamFailed(Stats *StreamStats) {
+	Stats.Lock()
+	Stats.Errors++
+	Stats.Unlock()
+
+	a.Streams.Lock()
+	a.Streams.Errors++
+	a.Streams.Unlock()
+}
+
+// StreamList
+// returns the open streams of the agent.
+func (a *Agent) StreamList() []StreamInfo {
+	var (
+		Streams = []StreamInfo{}
+		Path    = a.StreamPath()
+	)
+
+	a.SocksCliMtx.Lock()
+
+	for _, Client := range a.SocksCli {
+		var Info = Client.Stats.Info()
+
+		Info.AgentID = a.NameID
+		Info.SocketID = fmt.Sprintf("%08x", uint32(Client.SocketID))
+		Info.Type = "socks"
+		Info.Target = streamTarget(Client.ATYP, Client.IpDomain, Client.Port)
+		Info.Path = Path
+
+		if Client.Raw {
+			Info.Type = "forward"
+		}
+
+		Streams = append(Streams, Info)
+	}
+
+	a.SocksCliMtx.Unlock()
+
+	a.PortFwdsMtx.Lock()
+
+	for _, PortFwd := range a.PortFwds {
+		var Info = PortFwd.Stats.Info()
+
+		Info.AgentID = a.NameID
+		Info.SocketID = fmt.Sprintf("%08x", uint32(PortFwd.SocktID))
+		Info.Type = "rportfwd"
+		Info.Target = PortFwd.Target
+		Info.Path = Path
+
+		Streams = append(Streams, Info)
+	}
+
+	a.PortFwdsMtx.Unlock()
+
+	return Streams
+}
+
+// StreamTotals
+// returns the counters of every stream the agent carried, closed ones
+// included.
+func (a *Agent) StreamTotals() StreamInfo {
+	var Info = a.Streams.Info()
+
+	Info.AgentID = a.NameID
+	Info.Type = "total"
+	Info.Path = a.StreamPath()
+
+	return Info
+}
+
+// StreamPath
+// returns the agents the traffic of the agent goes through, starting at the
+// one connected to the teamserver and ending at the agent.
+func (a *Agent) StreamPath() []string {
+	var Path []string
+
+	for Agent := a; Agent != nil && len(Path) < 32; Agent = Agent.Pivots.Parent {
+		Path = append([]string{Agent.NameID}, Path...)
+	}
+
+	return Path
+}
+
+// Info
+// returns the counters of the stream.
+func (s *StreamStats) Info() StreamInfo {
+	var Now = time.Now()
+
+	s.Lock()
+	defer s.Unlock()
+
+	var Info = StreamInfo{
+		Proxy:    s.Proxy,
+		Streams:  s.Streams,
+		Sent:     s.Sent,
+		Received: s.Received,
+		Rate:     int64(s.decayed(Now)),
+		RTT:      -1,
+		Samples:  s.Samples,
+		Errors:   s.Errors,
+	}
+
+	if !s.Opened.IsZero() {
+		Info.Opened = s.Opened.Format("02/01/2006 15:04:05")
+	}
+
+	if s.Samples > 0 {
+		Info.RTT = s.RTT.Milliseconds()
+	}
+
+	if s.Frames+s.Errors > 0 {
+		Info.ErrorRate = float64(s.Errors) / float64(s.Frames+s.Errors)
+	}
+
+	return Info
+}
+
+func (s *StreamStats) add(Sent, Received int64, Now time.Time) {
+	if Sent+Received == 0 {
+		return
+	}
+
+	s.Sent += Sent
+	s.Received += Received
+	s.Frames++
+
+	s.rate = s.decayed(Now) + float64(Sent+Received)/STREAM_RATE_WINDOW.Seconds()
+	s.rated = Now
+}
+
+// decayed
+// returns the byte rate faded out till now.
+func (s *StreamStats) decayed(Now time.Time) float64 {
+	if s.rated.IsZero() {
+		return 0
+	}
+
+	return s.rate * math.Exp(-Now.Sub(s.rated).Seconds()/STREAM_RATE_WINDOW.Seconds())
+}
+
+func (s *StreamStats) sample(RTT time.Duration) {
+	if s.Samples == 0 {
+		s.RTT = RTT
+	} else {
+		s.RTT = time.Duration((1-STREAM_RTT_ALPHA)*float64(s.RTT) + STREAM_RTT_ALPHA*float64(RTT))
+	}
+
+	s.Samples++
+}
+
+func streamTarget(ATYP byte, IpDomain []byte, Port uint16) string {
+	var Host = string(IpDomain)
+
+	if ATYP != socks.FQDN {
+		Host = net.IP(IpDomain).String()
+	}
+
+	return net.JoinHostPort(Host, strconv.Itoa(int(Port)))
+}
+
+// streamFailed
+// counts the failure the agent reported for the socket.
+func (a *Agent) streamFailed(SocketID, Type int) {
+	switch Type {
+
+	case SOCKET_TYPE_REVERSE_PROXY:
+		if Client := a.SocksClientGet(SocketID); Client != nil {
+			a.StreamFailed(&Client.Stats)
+		}
+
+	case SOCKET_TYPE_CLIENT:
+		if PortFwd := a.PortFwdGet(SocketID); PortFwd != nil {
+			a.StreamFailed(&PortFwd.Stats)
+		}
+
+	}
+}
@@ -0,0 +1,68 @@
+package agent
+
+import (
+	"testing"
+	"time"
+)
+
+func TestStreamStats(t *testing.T) {
+	var (
+		Parent = &Agent{NameID: "aaaaaaaa"}
+		Pivot  = &Agent{NameID: "bbbbbbbb"}
+		Client = &SocksClient{SocketID: 1, ATYP: 1, IpDomain: []byte{10, 2, 0, 5}, Port: 445}
+	)
+
+	Pivot.Pivots.Parent = Parent
+	Pivot.SocksCli = append(Pivot.SocksCli, Client)
+
+	/* connect, then a request and its answer */
+	Pivot.StreamOpened(&Client.Stats, "1080")
+	Pivot.StreamSent(&Client.Stats, 0)
+	time.Sleep(20 * time.Millisecond)
+	Pivot.StreamReceived(&Client.Stats, 0)
+
+	Pivot.StreamSent(&Client.Stats, 100)
+	Pivot.StreamSent(&Client.Stats, 50)
+	time.Sleep(20 * time.Millisecond)
+	Pivot.StreamReceived(&Client.Stats, 1000)
+	Pivot.StreamFailed(&Client.Stats)
+
+	var Streams = Pivot.StreamList()
+	if len(Streams) != 1 {
+		t.Fatalf("%v streams instead of 1", len(Streams))
+	}
+
+	var Stream = Streams[0]
+
+	if Stream.Sent != 150 || Stream.Received != 1000 {
+		t.Fatalf("sent %v received %v, expected 150 and 1000", Stream.Sent, Stream.Received)
+	}
+
+	/* connect and the first write got answered, the second write was in flight */
+	if Stream.Samples != 2 || Stream.RTT < 20 {
+		t.Fatalf("%v round trip samples of %vms", Stream.Samples, Stream.RTT)
+	}
+
+	if Stream.Errors != 1 || Stream.ErrorRate != 0.25 {
+		t.Fatalf("%v errors, error rate %v", Stream.Errors, Stream.ErrorRate)
+	}
+
+	if Stream.Target != "10.2.0.5:445" || Stream.Type != "socks" || Stream.Proxy != "1080" {
+		t.Fatalf("stream %v %v of proxy %v", Stream.Type, Stream.Target, Stream.Proxy)
+	}
+
+	if len(Stream.Path) != 2 || Stream.Path[0] != "aaaaaaaa" || Stream.Path[1] != "bbbbbbbb" {
+		t.Fatalf("path %v", Stream.Path)
+	}
+
+	if Stream.Rate <= 0 {
+		t.Fatal("stream without a byte rate")
+	}
+
+	/* the totals outlive the stream */
+	Pivot.SocksCli = nil
+
+	if Totals := Pivot.StreamTotals(); Totals.Streams != 1 || Totals.Sent != 150 || Totals.Received != 1000 || Totals.Errors != 1 || Totals.Samples != 2 {
+		t.Fatalf("totals %+v", Totals)
+	}
+}
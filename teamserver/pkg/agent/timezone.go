@@ -0,0 +1,147 @@
+package agent
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"Havoc/pkg/common/parser"
+)
+
+// layouts of FirstCallIn and LastCallIn (local time of the teamserver)
+var callInLayouts = []string{"02/01/2006 15:04:05", "02-01-2006 15:04:05"}
+
+// ParseTimeZone
+// parses the time zone bias (100ns units, UTC = local time + bias) and
+// the windows name of the time zone the agent appends to its metadata.
+func ParseTimeZone(Parser *parser.Parser, Info *AgentInfo) {
+	if !Parser.CanIRead([]parser.ReadType{parser.ReadInt64, parser.ReadBytes}) {
+		return
+	}
+
+	var (
+		Bias = Parser.ParseInt64()
+		Name = Parser.ParseUTF16StringMax()
+	)
+
+	if Bias%600000000 != 0 {
+		return
+	}
+
+	TimeZoneSet(Info, Name, int(-Bias/600000000))
+}
+
+// TimeZoneSet
+// sets the time zone of the host of the agent. Offset is in minutes
+// east of UTC, a zone without a name gets named after its offset.
+func TimeZoneSet(Info *AgentInfo, Name string, Offset int) bool {
+	if Offset < -14*60 || Offset > 14*60 {
+		return false
+	}
+
+	if Name = strings.TrimSpace(Name); len(Name) == 0 {
+		Name = TimeZoneOffset(Offset)
+	}
+
+	Info.TimeZone = Name
+	Info.UTCOffset = Offset
+
+	return true
+}
+
+// TimeZoneOffset
+// formats the offset (minutes east of UTC) as UTC+hh:mm.
+func TimeZoneOffset(Offset int) string {
+	var Sign = "+"
+
+	if Offset < 0 {
+		Sign, Offset = "-", -Offset
+	}
+
+	return fmt.Sprintf("UTC%v%02d:%02d", Sign, Offset/60, Offset%60)
+}
+
+// ParseTimeZoneOffset
+// parses an offset like +0200, -05:30 or +1 into minutes east of UTC.
+func ParseTimeZoneOffset(Offset string) (int, error) {
+	var (
+		Value = strings.TrimPrefix(strings.TrimSpace(Offset), "UTC")
+		Sign  = 1
+	)
+
+	if strings.HasPrefix(Value, "-") {
+		Sign = -1
+	}
+
+	Value = strings.ReplaceAll(strings.TrimLeft(Value, "+-"), ":", "")
+
+	Number, err := strconv.Atoi(Value)
+	if err != nil || len(Value) == 0 {
+		return 0, fmt.Errorf("invalid utc offset: %v", Offset)
+	}
+
+	/* hours only (+1, -11) or hours and minutes (+0530) */
+	if len(Value) <= 2 {
+		return Sign * Number * 60, nil
+	}
+
+	return Sign * (Number/100*60 + Number%100), nil
+}
+
+// Location
+// returns the time zone of the host of the agent. nil if unknown.
+func (i *AgentInfo) Location() *time.Location {
+	if i == nil || len(i.TimeZone) == 0 {
+		return nil
+	}
+
+	return time.FixedZone(i.TimeZone, i.UTCOffset*60)
+}
+
+// LocalTime
+// returns the time in the local time of the host of the agent, the
+// local time of the teamserver if the time zone of the host is unknown.
+func (i *AgentInfo) LocalTime(Time time.Time) time.Time {
+	if Location := i.Location(); Location != nil {
+		return Time.In(Location)
+	}
+
+	return Time
+}
+
+// TimeStamps
+// returns the time in UTC and in the local time of the host of the
+// agent (RFC 3339). Local is empty if the time zone of the host is unknown.
+func (i *AgentInfo) TimeStamps(Time time.Time) (string, string) {
+	var UTC = Time.UTC().Format(time.RFC3339)
+
+	if Location := i.Location(); Location != nil {
+		return UTC, Time.In(Location).Format(time.RFC3339)
+	}
+
+	return UTC, ""
+}
+
+// CallInTime
+// parses a timestamp of the teamserver (FirstCallIn, LastCallIn, package time).
+func CallInTime(Stamp string) (time.Time, bool) {
+	for _, Layout := range callInLayouts {
+		if Parsed, err := time.ParseInLocation(Layout, Stamp, time.Local); err == nil {
+			return Parsed, true
+		}
+	}
+
+	return time.Time{}, false
+}
+
+// CallInStamps
+// returns the timestamp of the teamserver in UTC and in the local time
+// of the host of the agent (see TimeStamps). empty if it can't be parsed.
+func (i *AgentInfo) CallInStamps(Stamp string) (string, string) {
+	if Time, ok := CallInTime(Stamp); ok {
+		return i.TimeStamps(Time)
+	}
+
+	return "", ""
+}
@@ -2,11 +2,15 @@ package agent
 
 import (
 	"sync"
+	"sync/atomic"
 	"net"
-	"os"
+	"time"
 
+	"Havoc/pkg/budget"
 	"Havoc/pkg/common/parser"
+	"Havoc/pkg/keyring"
 	"Havoc/pkg/packager"
+	"Havoc/pkg/seal"
 	"Havoc/pkg/socks"
 )
 
@@ -52,24 +56,72 @@ type TeamServer interface {
 	AgentInstance(AgentID int) *Agent
 	AgentLastTimeCalled(AgentID string, LastCallback string, Sleep int, Jitter int, KillDate int64, WorkingHours int32)
 	AgentExist(AgentID int) bool
+	AgentResume(AgentID int, Register *Agent) (*Agent, error)
+	AgentTransport(Agent *Agent, Previous string)
 	AgentConsole(DemonID string, CommandID int, Output map[string]string)
+	AgentSnapshot(DemonID string, Command string, Target string, Entries map[string]string)
+	DownloadSegment(Agent *Agent, RequestID uint32, File string, Size int64, Finished bool) bool
+	DownloadKnown(Agent *Agent, Name string, Size int64, Hash string) (string, bool)
+	DownloadFinished(Agent *Agent, Name, File string)
+	ExfilTransfer(Agent *Agent, FileID int, Size int)
+	AgentInbound(Agent *Agent, Size int) (*Job, error)
+	AgentInboundDone(Agent *Agent)
+	TasksDelivered(Agent *Agent, Jobs []Job)
+	Budget(Subsystem string) *budget.Budget
+	Supervise(Source string, Routine func())
+	Recover(Source string)
+	Crash(Source string, Panic any, Stack []byte)
+	SocksFlowControl() (FrameSize int, Window int, Compress bool)
+	SocksChanged(Agent *Agent)
+	ScriptGet(Name string) (string, error)
+	DirectoryAdd(Agent *Agent, Entries []LdapEntry) int
+	AdcsAuthority(Agent *Agent, Name string) (string, error)
+	AdcsRequested(Agent *Agent, RequestID uint32, ClientID string, Request *AdcsRequest)
+	AdcsIssued(Agent *Agent, RequestID uint32, CaRequestID int, Certificate string) (int, error)
+	ClipboardAdd(Agent *Agent, Text string) (int, bool, error)
+	RegistryRequested(Agent *Agent, RequestID uint32, ClientID string, Change RegistryChange)
+	RegistryResult(Agent *Agent, RequestID uint32, Command int, Status int, Key RegistryKey) error
+	DesktopStarted(Agent *Agent, RequestID uint32, ClientID string, View DesktopView)
+	DesktopFrame(Agent *Agent, RequestID uint32, Frame DesktopFrame) error
+	DesktopStopped(Agent *Agent, RequestID uint32)
+	FileSearchRequested(Agent *Agent, RequestID uint32, Search FileSearch)
+	FileSearchIndex(Agent *Agent, RequestID uint32, Matches []FileMatch, Done bool) error
 
 	EventAppend(event packager.Package) []packager.Package
 	EventBroadcast(ExceptClient string, pk packager.Package)
 	EventNewDemon(DemonAgent *Agent) packager.Package
 	EventAgentMark(AgentID, Mark string)
 	EventListenerError(ListenerName string, Error error)
+	EventPublish(Type, Workspace string, Data map[string]any)
 
 	ListenerAdd(FromUser string, Type int, Config any) packager.Package
 
 	ServiceAgent(MagicValue int) ServiceAgentInterface
 	ServiceAgentExist(MagicValue int) bool
+	HostBurned(Host string, AgentID int) bool
 
 	GetDotNetPipeTemplate() string
 
 	SendLogs() bool
 }
 
+// ScriptResult
+// structured result of a script run by the script engine of the demon.
+type ScriptResult struct {
+	ExitCode  int
+	Line      int
+	Error     string
+	Output    string
+	Variables map[string]string
+}
+
+// LdapEntry
+// entry of a ldap search. binary values are converted to strings.
+type LdapEntry struct {
+	DN         string
+	Attributes map[string][]string
+}
+
 type Job struct {
 	Command   uint32
 	RequestID uint32
@@ -79,6 +131,15 @@ type Job struct {
 	CommandLine string
 	TaskID      string
 	Created     string
+	// set once the agent sent the first result of the task
+	Answered bool
+	// the data of the socket write is a compressed frame (see socksCompress)
+	Compressed bool
+	// agent and request of the job a pivot job carries to a link
+	Carried struct {
+		AgentID   string
+		RequestID uint32
+	}
 
 	Encryption struct {
 		Key []byte
@@ -92,7 +153,7 @@ type Pivots struct {
 }
 
 type Download struct {
-	File      *os.File
+	File      *seal.Writer
 	FileID    int
 	FilePath  string
 	LocalFile string
@@ -119,6 +180,8 @@ type PortFwd struct {
 	FwdAddr int
 	FwdPort int
 	Target  string
+
+	Stats StreamStats
 }
 
 type SocksClient struct {
@@ -128,6 +191,16 @@ type SocksClient struct {
 	ATYP      byte
 	IpDomain  []byte
 	Port      uint16
+	// bytes queued for the agent that haven't been fetched yet
+	Pending atomic.Int64
+	// connection of a port forward, it doesn't speak socks5
+	Raw bool
+	// the agent acknowledges the bytes it wrote to the target (SOCKET_COMMAND_WINDOW)
+	Acknowledged bool
+	// frames to and from the agent are compressed (see socksCompress)
+	Compress bool
+
+	Stats StreamStats
 }
 
 type SocksServer struct {
@@ -160,12 +233,26 @@ type Agent struct {
 	SocksSvr    []*SocksServer
 	SocksSvrMtx sync.Mutex
 
-	Encryption struct {
-		AESKey []byte
-		AESIv  []byte
-	}
+	// session key, wrapped while it isn't used (see keyring.Session)
+	Encryption keyring.Session
 	TaskedOnce bool
 
+	// task of the result being dispatched (see Answering)
+	answering atomic.Value
+
+	// round trip of the latency probes (see LatencyProbe)
+	Latency struct {
+		sync.Mutex
+		Probes   map[uint32]time.Time
+		RTT      time.Duration
+		Measured time.Time
+	}
+
+	// counters of every pivot stream the agent carried (see StreamStats)
+	Streams StreamStats
+
+	// output of running requests being put back in order (see PartialOutput)
+	Partials PartialStreams
 
 	/* general value. leave it... */
 	BackgroundCheck bool
@@ -188,6 +275,28 @@ type AgentInfo struct {
 
 	InternalIP string
 	ExternalIP string
+	ProxyPath  string
+	// ids of the commands the agent build supports. nil if the agent didn't report them
+	Capabilities []uint32
+	// max size of a response the agent takes. 0 for DEMON_MAX_RESPONSE_LENGTH
+	MaxResponse int
+	// version of the metadata layout the agent uses
+	Protocol int
+	// time zone of the host (windows name or UTC+hh:mm). empty if unknown
+	TimeZone string
+	// offset of the local time of the host to UTC in minutes
+	UTCOffset int
+	// windows code page of the ansi and console output of the host. 0 if unknown
+	CodePage    int
+	OEMCodePage int
+	// host the agent used on its last callback
+	CallbackHost string
+	// listener the agent used on its last callback
+	Transport string
+	// set if the callback host has been burned
+	Burned string
+	// workspace of the listener the agent registered over
+	Workspace string
 	Hostname   string
 	DomainName string
 	Username   string
@@ -209,10 +318,6 @@ type AgentInfo struct {
 	LastCallIn  string
 }
 
-type Agents struct {
-	Agents []*Agent
-}
-
 var InjectErrors = map[int]string{
 	0x1001: "trying to inject a x64 payload into a x86 process",
 	0x1002: "trying to inject a x86 payload into a x64 process",
@@ -225,6 +330,24 @@ const (
 	DOWNLOAD_STATE_REMOVE  = 0x3
 )
 
+const (
+	// downloads up to this size get sent to the clients inline (base64 over the websocket).
+	// bigger ones stay on disk and get streamed from the TRANSFER_ENDPOINT.
+	DOWNLOAD_INLINE_MAX = 0x2000000
+
+	// streams files under the logr folder (agents/<id>/<folder>/..., downloads/...)
+	TRANSFER_ENDPOINT = "/havoc/transfer/"
+)
+
+// path prefix of the operator api when the teamserver runs behind a cdn or reverse proxy
+var TransferPrefix string
+
+// TransferURL
+// returns the path operators fetch the file (relative to the logr folder) from.
+func TransferURL(Path string) string {
+	return TransferPrefix + TRANSFER_ENDPOINT + Path
+}
+
 var Win32ErrorCodes = map[int]string{
 	1:    "ERROR_INVALID_FUNCTION",
 	2:    "ERROR_FILE_NOT_FOUND",
@@ -0,0 +1,290 @@
+package agent
+
+import (
+	"encoding/binary"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+
+	"Havoc/pkg/common"
+)
+
+// sub commands of COMMAND_REGISTRY
+const (
+	REGISTRY_COMMAND_QUERY  = 0x1
+	REGISTRY_COMMAND_ENUM   = 0x2
+	REGISTRY_COMMAND_SET    = 0x3
+	REGISTRY_COMMAND_DELETE = 0x4
+)
+
+// items of the answer of COMMAND_REGISTRY
+const (
+	REGISTRY_ITEM_END    = 0x0
+	REGISTRY_ITEM_SUBKEY = 0x1
+	REGISTRY_ITEM_VALUE  = 0x2
+)
+
+// registry views (see winnt.h)
+const (
+	KEY_WOW64_64KEY = 0x0100
+	KEY_WOW64_32KEY = 0x0200
+)
+
+// value types (see winnt.h)
+const (
+	REG_NONE             = 0
+	REG_SZ               = 1
+	REG_EXPAND_SZ        = 2
+	REG_BINARY           = 3
+	REG_DWORD            = 4
+	REG_DWORD_BIG_ENDIAN = 5
+	REG_LINK             = 6
+	REG_MULTI_SZ         = 7
+	REG_RESOURCE_LIST    = 8
+	REG_QWORD            = 11
+)
+
+// status of a registry task on a key or value that doesn't exist
+const REGISTRY_NOT_FOUND = 2
+
+var registryCommands = map[string]int{
+	"query":  REGISTRY_COMMAND_QUERY,
+	"enum":   REGISTRY_COMMAND_ENUM,
+	"set":    REGISTRY_COMMAND_SET,
+	"delete": REGISTRY_COMMAND_DELETE,
+}
+
+// predefined keys in the order of the demon
+var registryHives = []string{"HKLM", "HKCU", "HKU", "HKCR", "HKCC"}
+
+var registryHiveNames = map[string]int{
+	"HKEY_LOCAL_MACHINE":  0,
+	"HKEY_CURRENT_USER":   1,
+	"HKEY_USERS":          2,
+	"HKEY_CLASSES_ROOT":   3,
+	"HKEY_CURRENT_CONFIG": 4,
+}
+
+var registryTypes = map[int]string{
+	REG_NONE:             "REG_NONE",
+	REG_SZ:               "REG_SZ",
+	REG_EXPAND_SZ:        "REG_EXPAND_SZ",
+	REG_BINARY:           "REG_BINARY",
+	REG_DWORD:            "REG_DWORD",
+	REG_DWORD_BIG_ENDIAN: "REG_DWORD_BIG_ENDIAN",
+	REG_LINK:             "REG_LINK",
+	REG_MULTI_SZ:         "REG_MULTI_SZ",
+	REG_RESOURCE_LIST:    "REG_RESOURCE_LIST",
+	REG_QWORD:            "REG_QWORD",
+}
+
+// RegistryValue
+// value of a registry key. the data is formatted like reg.exe does.
+type RegistryValue struct {
+	Name string
+	Type string
+	Data string
+}
+
+// RegistryKey
+// answer of a registry task: the subkeys and values of the key or, for
+// modifications, the value as it was before the change.
+type RegistryKey struct {
+	Hive    string
+	Path    string
+	Name    string
+	Subkeys []string
+	Values  []RegistryValue
+}
+
+// RegistryChange
+// modification of the registry an operator requested.
+type RegistryChange struct {
+	Operation string
+	Hive      string
+	Path      string
+	Name      string
+	Type      string
+	Data      string
+	// "32" or "64" if the change targets that registry view
+	View string
+}
+
+// RegistryKeyPath
+// splits a key (eg: HKLM\SOFTWARE\Microsoft) into its hive and path.
+func RegistryKeyPath(Key string) (int, string, error) {
+	var Hive, Path, _ = strings.Cut(strings.Trim(strings.ReplaceAll(Key, "/", "\\"), "\\"), "\\")
+
+	Hive = strings.TrimSuffix(strings.ToUpper(Hive), ":")
+
+	for i, Name := range registryHives {
+		if Name == Hive {
+			return i, Path, nil
+		}
+	}
+
+	if i, ok := registryHiveNames[Hive]; ok {
+		return i, Path, nil
+	}
+
+	return 0, "", errors.New("unknown registry hive " + Hive)
+}
+
+// RegistryHive
+// returns the short name of the predefined key.
+func RegistryHive(Hive int) string {
+	if Hive >= 0 && Hive < len(registryHives) {
+		return registryHives[Hive]
+	}
+
+	return fmt.Sprintf("hive %v", Hive)
+}
+
+// RegistryType
+// returns the name of the value type.
+func RegistryType(Type int) string {
+	if Name, ok := registryTypes[Type]; ok {
+		return Name
+	}
+
+	return fmt.Sprintf("REG_0x%x", Type)
+}
+
+// RegistryError
+// returns the name of the win32 status.
+func RegistryError(Status int) string {
+	if Name, ok := Win32ErrorCodes[Status]; ok {
+		return Name
+	}
+
+	return fmt.Sprintf("error %v", Status)
+}
+
+// registryFormat
+// formats the data of a value like reg.exe does.
+func registryFormat(Type int, Data []byte) string {
+	switch Type {
+
+	case REG_SZ, REG_EXPAND_SZ, REG_LINK:
+		return common.StripNull(common.DecodeUTF16(Data))
+
+	case REG_MULTI_SZ:
+		var Strings = strings.Split(strings.TrimRight(common.DecodeUTF16(Data), "\x00"), "\x00")
+
+		return strings.Join(Strings, "\\0")
+
+	case REG_DWORD:
+		if len(Data) >= 4 {
+			return fmt.Sprintf("0x%x", binary.LittleEndian.Uint32(Data))
+		}
+
+	case REG_DWORD_BIG_ENDIAN:
+		if len(Data) >= 4 {
+			return fmt.Sprintf("0x%x", binary.BigEndian.Uint32(Data))
+		}
+
+	case REG_QWORD:
+		if len(Data) >= 8 {
+			return fmt.Sprintf("0x%x", binary.LittleEndian.Uint64(Data))
+		}
+
+	}
+
+	return strings.ToUpper(hex.EncodeToString(Data))
+}
+
+// registryEncode
+// encodes the data of a value the operator wants to set. the data is
+// given like reg.exe takes it (\0 separates the strings of a REG_MULTI_SZ
+// and the bytes of a REG_BINARY are hex).
+func registryEncode(Type string, Data string) (int, []byte, error) {
+	switch strings.ToUpper(Type) {
+
+	case "REG_SZ", "":
+		return REG_SZ, common.EncodeUTF16(Data), nil
+
+	case "REG_EXPAND_SZ":
+		return REG_EXPAND_SZ, common.EncodeUTF16(Data), nil
+
+	case "REG_MULTI_SZ":
+		var Encoded []byte
+
+		for _, String := range strings.Split(Data, "\\0") {
+			Encoded = append(Encoded, common.EncodeUTF16(String)...)
+		}
+
+		/* the list ends with an empty string */
+		return REG_MULTI_SZ, append(Encoded, 0, 0), nil
+
+	case "REG_DWORD":
+		Number, err := strconv.ParseUint(Data, 0, 32)
+		if err != nil {
+			return 0, nil, errors.New("REG_DWORD data has to be a 32 bit number")
+		}
+
+		return REG_DWORD, binary.LittleEndian.AppendUint32(nil, uint32(Number)), nil
+
+	case "REG_QWORD":
+		Number, err := strconv.ParseUint(Data, 0, 64)
+		if err != nil {
+			return 0, nil, errors.New("REG_QWORD data has to be a 64 bit number")
+		}
+
+		return REG_QWORD, binary.LittleEndian.AppendUint64(nil, Number), nil
+
+	case "REG_BINARY":
+		Bytes, err := hex.DecodeString(strings.ReplaceAll(Data, " ", ""))
+		if err != nil {
+			return 0, nil, errors.New("REG_BINARY data has to be hex")
+		}
+
+		return REG_BINARY, Bytes, nil
+
+	}
+
+	return 0, nil, errors.New("unsupported value type " + Type)
+}
+
+// registryOutput
+// formats the subkeys and values of the key like reg query does.
+func registryOutput(Key RegistryKey) string {
+	var (
+		Output strings.Builder
+		Width  = len("(Default)")
+		Root   = Key.Hive
+	)
+
+	if len(Key.Path) > 0 {
+		Root += "\\" + Key.Path
+	}
+
+	for _, Value := range Key.Values {
+		if len(Value.Name) > Width {
+			Width = len(Value.Name)
+		}
+	}
+
+	for _, Value := range Key.Values {
+		var Name = Value.Name
+
+		if len(Name) == 0 {
+			Name = "(Default)"
+		}
+
+		Output.WriteString(fmt.Sprintf("    %-*v    %-13v %v\n", Width, Name, Value.Type, Value.Data))
+	}
+
+	if len(Key.Subkeys) > 0 {
+		if Output.Len() > 0 {
+			Output.WriteString("\n")
+		}
+
+		for _, Subkey := range Key.Subkeys {
+			Output.WriteString(Root + "\\" + Subkey + "\n")
+		}
+	}
+
+	return Output.String()
+}
@@ -0,0 +1,115 @@
+package auth
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"os"
+	"strings"
+	"time"
+)
+
+// timeout of the requests to the directory or the identity provider
+const AUTH_TIMEOUT = 10 * time.Second
+
+var (
+	// the credentials are for another backend (eg: a token for ldap)
+	ErrUnsupported = errors.New("credentials aren't supported by the backend")
+
+	// unknown operator or wrong password/token
+	ErrInvalid = errors.New("invalid credentials")
+)
+
+// Credentials
+// what an operator logs in with. A backend uses what it supports of it.
+type Credentials struct {
+	User string
+	// in the clear, the directory binds with it
+	Password string
+	// id token issued by the identity provider
+	Token string
+}
+
+// Identity
+// an operator a backend authenticated.
+type Identity struct {
+	// name of the operator as the backend knows it
+	Name   string
+	Groups []string
+	// the identity isn't valid anymore after (zero if it doesn't expire)
+	Expires time.Time
+}
+
+// Backend
+// authenticates operators that aren't accounts of the profile.
+type Backend interface {
+	// kind of the backend (eg: "ldap")
+	Name() string
+	Authenticate(Credentials Credentials) (*Identity, error)
+}
+
+// GroupMatches
+// checks if the group of an operator is the one of the profile. Groups
+// that are distinguished names (CN=Red Team,OU=Groups,DC=corp,DC=local)
+// also match by their common name (Red Team).
+func GroupMatches(Name, Group string) bool {
+	if strings.EqualFold(Name, Group) {
+		return true
+	}
+
+	var (
+		RDN    strings.Builder
+		Escape bool
+	)
+
+	/* the first relative name up to an unescaped comma */
+	for _, Char := range Group {
+		if Escape {
+			RDN.WriteRune(Char)
+			Escape = false
+			continue
+		}
+
+		if Char == '\\' {
+			Escape = true
+			continue
+		}
+
+		if Char == ',' {
+			break
+		}
+
+		RDN.WriteRune(Char)
+	}
+
+	if Type, Value, ok := strings.Cut(RDN.String(), "="); ok && strings.EqualFold(strings.TrimSpace(Type), "CN") {
+		return strings.EqualFold(strings.TrimSpace(Value), Name)
+	}
+
+	return false
+}
+
+// tlsConfig
+// tls of the connections to the server. CACert is a pem file of the
+// certificate authority of the server, the system pool by default.
+func tlsConfig(Host, CACert string, Insecure bool) (*tls.Config, error) {
+	var Config = &tls.Config{
+		MinVersion:         tls.VersionTLS12,
+		ServerName:         Host,
+		InsecureSkipVerify: Insecure,
+	}
+
+	if len(CACert) > 0 {
+		Pem, err := os.ReadFile(CACert)
+		if err != nil {
+			return nil, err
+		}
+
+		Config.RootCAs = x509.NewCertPool()
+		if !Config.RootCAs.AppendCertsFromPEM(Pem) {
+			return nil, errors.New("no certificate in " + CACert)
+		}
+	}
+
+	return Config, nil
+}
@@ -0,0 +1,275 @@
+package auth
+
+import (
+	"bufio"
+	"bytes"
+	"crypto"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"math/big"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestLdapFilter(t *testing.T) {
+	Encoded, err := ldapFilter("(cn=a)")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if !bytes.Equal(Encoded, []byte{0xa3, 0x07, 0x04, 0x02, 'c', 'n', 0x04, 0x01, 'a'}) {
+		t.Errorf("encoded (cn=a) as %x", Encoded)
+	}
+
+	for _, Filter := range []string{
+		"(&(objectClass=user)(!(cn=admin*))(|(sn~=doe)(uid=*)))",
+		"(member:1.2.840.113556.1.4.1941:=CN=Red Team\\2cOU=Groups,DC=corp,DC=local)",
+		"(cn=*a*b*)",
+	} {
+		if _, err = ldapFilter(Filter); err != nil {
+			t.Errorf("%v: %v", Filter, err)
+		}
+	}
+
+	for _, Filter := range []string{"cn=a", "(cn=a", "(&(cn=a)", "(=a)", "(cn=a)(cn=b)", "(cn=\\2)"} {
+		if _, err = ldapFilter(Filter); err == nil {
+			t.Errorf("%v parsed", Filter)
+		}
+	}
+
+	/* a login name can't change the filter */
+	var Ldap = &Ldap{Options: LdapOptions{UserAttribute: "uid"}}
+
+	Encoded, err = ldapFilter(Ldap.userFilter("*)(uid=*"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	Expected, _ := ldapFilter("(&(uid=\\2a\\29\\28uid=\\2a))")
+	if !bytes.Equal(Encoded, Expected) {
+		t.Errorf("escaped name encoded as %x", Encoded)
+	}
+}
+
+func TestGroupMatches(t *testing.T) {
+	for _, Case := range []struct {
+		Name, Group string
+		Matches     bool
+	}{
+		{"Red Team", "red team", true},
+		{"Red Team", "CN=Red Team,OU=Groups,DC=corp,DC=local", true},
+		{"Red, Team", "cn=Red\\, Team,DC=corp", true},
+		{"Groups", "CN=Red Team,OU=Groups,DC=corp,DC=local", false},
+		{"Red", "CN=Red Team,DC=corp", false},
+	} {
+		if GroupMatches(Case.Name, Case.Group) != Case.Matches {
+			t.Errorf("%v in %v isn't %v", Case.Name, Case.Group, Case.Matches)
+		}
+	}
+}
+
+func TestLdap(t *testing.T) {
+	Listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer Listener.Close()
+
+	var Binds = map[string]string{
+		"cn=svc,dc=corp":        "service",
+		"cn=jdoe,ou=op,dc=corp": "hunter2",
+	}
+
+	go func() {
+		for {
+			Conn, err := Listener.Accept()
+			if err != nil {
+				return
+			}
+
+			go ldapServe(Conn, Binds)
+		}
+	}()
+
+	Ldap, err := NewLdap(LdapOptions{
+		Url:          "ldap://" + Listener.Addr().String(),
+		BindDN:       "cn=svc,dc=corp",
+		BindPassword: "service",
+		BaseDN:       "dc=corp",
+		UserFilter:   "(objectClass=person)",
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	Identity, err := Ldap.Authenticate(Credentials{User: "jdoe", Password: "hunter2"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if Identity.Name != "JDoe" || len(Identity.Groups) != 1 || !GroupMatches("Red Team", Identity.Groups[0]) {
+		t.Errorf("authenticated %+v", Identity)
+	}
+
+	if _, err = Ldap.Authenticate(Credentials{User: "jdoe", Password: "wrong"}); !errors.Is(err, ErrInvalid) {
+		t.Errorf("wrong password: %v", err)
+	}
+
+	if _, err = Ldap.Authenticate(Credentials{User: "nobody", Password: "hunter2"}); !errors.Is(err, ErrInvalid) {
+		t.Errorf("unknown operator: %v", err)
+	}
+
+	/* an empty password would be an anonymous bind */
+	if _, err = Ldap.Authenticate(Credentials{User: "jdoe"}); !errors.Is(err, ErrUnsupported) {
+		t.Errorf("empty password: %v", err)
+	}
+}
+
+// ldapServe
+// a directory with the single operator jdoe.
+func ldapServe(Conn net.Conn, Binds map[string]string) {
+	defer Conn.Close()
+
+	var Reader = bufio.NewReader(Conn)
+
+	for {
+		Message, err := berRead(Reader)
+		if err != nil {
+			return
+		}
+
+		var (
+			ID        = berInteger(BER_INTEGER, Message.Child(0).Int())
+			Operation = Message.Child(1)
+		)
+
+		switch Operation.Tag {
+		case LDAP_BIND_REQUEST:
+			var Code = LDAP_INVALID_CREDENTIALS
+
+			if Password, ok := Binds[Operation.Child(1).String()]; ok && Password == Operation.Child(2).String() {
+				Code = LDAP_SUCCESS
+			}
+
+			Conn.Write(berEncode(BER_SEQUENCE, ID, berEncode(LDAP_BIND_RESPONSE, berInteger(BER_ENUMERATED, Code), berString(BER_OCTETS, ""), berString(BER_OCTETS, ""))))
+
+		case LDAP_SEARCH_REQUEST:
+			Expected, _ := ldapFilter("(&(sAMAccountName=jdoe)(objectClass=person))")
+
+			Filter := Operation.Child(6)
+			if bytes.Equal(berEncode(Filter.Tag, Filter.Content), Expected) {
+				Conn.Write(berEncode(BER_SEQUENCE, ID, berEncode(LDAP_SEARCH_ENTRY,
+					berString(BER_OCTETS, "cn=jdoe,ou=op,dc=corp"),
+					berEncode(BER_SEQUENCE,
+						berEncode(BER_SEQUENCE, berString(BER_OCTETS, "sAMAccountName"), berEncode(BER_SET, berString(BER_OCTETS, "JDoe"))),
+						berEncode(BER_SEQUENCE, berString(BER_OCTETS, "memberOf"), berEncode(BER_SET, berString(BER_OCTETS, "CN=Red Team,OU=Groups,DC=corp"))),
+					),
+				)))
+			}
+
+			Conn.Write(berEncode(BER_SEQUENCE, ID, berEncode(LDAP_SEARCH_DONE, berInteger(BER_ENUMERATED, LDAP_SUCCESS), berString(BER_OCTETS, ""), berString(BER_OCTETS, ""))))
+
+		default:
+			return
+		}
+	}
+}
+
+func TestOidc(t *testing.T) {
+	Key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var Mux = http.NewServeMux()
+
+	Server := httptest.NewTLSServer(Mux)
+	defer Server.Close()
+
+	Mux.HandleFunc("/.well-known/openid-configuration", func(w http.ResponseWriter, r *http.Request) {
+		json.NewEncoder(w).Encode(map[string]string{"issuer": Server.URL, "jwks_uri": Server.URL + "/keys"})
+	})
+
+	Mux.HandleFunc("/keys", func(w http.ResponseWriter, r *http.Request) {
+		json.NewEncoder(w).Encode(map[string]any{"keys": []map[string]string{{
+			"kty": "RSA",
+			"kid": "1",
+			"use": "sig",
+			"n":   base64.RawURLEncoding.EncodeToString(Key.N.Bytes()),
+			"e":   base64.RawURLEncoding.EncodeToString(big.NewInt(int64(Key.E)).Bytes()),
+		}}})
+	})
+
+	Oidc, err := NewOidc(OidcOptions{Issuer: Server.URL, ClientID: "havoc"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	Oidc.client = Server.Client()
+
+	var Sign = func(Header, Claims map[string]any) string {
+		H, _ := json.Marshal(Header)
+		C, _ := json.Marshal(Claims)
+
+		var Signed = base64.RawURLEncoding.EncodeToString(H) + "." + base64.RawURLEncoding.EncodeToString(C)
+
+		Digest := sha256.Sum256([]byte(Signed))
+		Signature, _ := rsa.SignPKCS1v15(rand.Reader, Key, crypto.SHA256, Digest[:])
+
+		return Signed + "." + base64.RawURLEncoding.EncodeToString(Signature)
+	}
+
+	var (
+		Header = map[string]any{"alg": "RS256", "kid": "1"}
+		Claims = map[string]any{
+			"iss":                Server.URL,
+			"aud":                []string{"havoc", "other"},
+			"exp":                time.Now().Add(time.Hour).Unix(),
+			"preferred_username": "jdoe",
+			"groups":             []string{"red-team", "users"},
+		}
+	)
+
+	Identity, err := Oidc.Authenticate(Credentials{Token: Sign(Header, Claims)})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if Identity.Name != "jdoe" || len(Identity.Groups) != 2 || Identity.Expires.IsZero() {
+		t.Errorf("authenticated %+v", Identity)
+	}
+
+	if _, err = Oidc.Authenticate(Credentials{User: "jdoe", Password: "hunter2"}); !errors.Is(err, ErrUnsupported) {
+		t.Errorf("password: %v", err)
+	}
+
+	var Token = Sign(Header, Claims)
+	if _, err = Oidc.Authenticate(Credentials{Token: Token[:len(Token)-4] + "AAAA"}); err == nil {
+		t.Error("tampered token authenticated")
+	}
+
+	/* tokens that aren't for the teamserver, expired or unsigned */
+	for Claim, Value := range map[string]any{"aud": "other", "iss": "https://evil", "exp": time.Now().Add(-time.Hour).Unix()} {
+		var Changed = map[string]any{}
+		for Name, Value := range Claims {
+			Changed[Name] = Value
+		}
+		Changed[Claim] = Value
+
+		if _, err = Oidc.Authenticate(Credentials{Token: Sign(Header, Changed)}); err == nil {
+			t.Errorf("token with %v %v authenticated", Claim, Value)
+		}
+	}
+
+	C, _ := json.Marshal(Claims)
+	if _, err = Oidc.Authenticate(Credentials{Token: base64.RawURLEncoding.EncodeToString([]byte(`{"alg":"none"}`)) + "." + base64.RawURLEncoding.EncodeToString(C) + "."}); err == nil {
+		t.Error("unsigned token authenticated")
+	}
+}
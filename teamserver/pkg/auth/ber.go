@@ -0,0 +1,232 @@
+package auth
+
+import (
+	"bufio"
+	"errors"
+	"io"
+)
+
+// classes of the ber tags ldap uses
+const (
+	BER_UNIVERSAL   = 0x00
+	BER_APPLICATION = 0x40
+	BER_CONTEXT     = 0x80
+
+	BER_CONSTRUCTED = 0x20
+)
+
+// universal tags
+const (
+	BER_BOOLEAN    = 0x01
+	BER_INTEGER    = 0x02
+	BER_OCTETS     = 0x04
+	BER_ENUMERATED = 0x0a
+	BER_SEQUENCE   = 0x10 | BER_CONSTRUCTED
+	BER_SET        = 0x11 | BER_CONSTRUCTED
+)
+
+// largest message read from the server
+const BER_MAX_MESSAGE = 16 * 1024 * 1024
+
+// ber
+// a decoded element. Constructed elements have children, the others
+// their content.
+type ber struct {
+	Tag      byte
+	Content  []byte
+	Children []*ber
+}
+
+// berEncode
+// encodes an element of the tag (class, constructed bit and number < 31).
+func berEncode(Tag byte, Content ...[]byte) []byte {
+	var Length = 0
+
+	for _, Part := range Content {
+		Length += len(Part)
+	}
+
+	var Buffer = []byte{Tag}
+
+	if Length < 0x80 {
+		Buffer = append(Buffer, byte(Length))
+	} else {
+		var Bytes []byte
+
+		for Rest := Length; Rest > 0; Rest >>= 8 {
+			Bytes = append([]byte{byte(Rest)}, Bytes...)
+		}
+
+		Buffer = append(Buffer, 0x80|byte(len(Bytes)))
+		Buffer = append(Buffer, Bytes...)
+	}
+
+	for _, Part := range Content {
+		Buffer = append(Buffer, Part...)
+	}
+
+	return Buffer
+}
+
+// berInteger
+// encodes a non-negative integer (message ids, limits, enumerations).
+func berInteger(Tag byte, Value int) []byte {
+	var Bytes = []byte{byte(Value)}
+
+	for Rest := Value >> 8; Rest > 0; Rest >>= 8 {
+		Bytes = append([]byte{byte(Rest)}, Bytes...)
+	}
+
+	/* a leading set bit would make it negative */
+	if Bytes[0]&0x80 != 0 {
+		Bytes = append([]byte{0}, Bytes...)
+	}
+
+	return berEncode(Tag, Bytes)
+}
+
+func berString(Tag byte, Value string) []byte {
+	return berEncode(Tag, []byte(Value))
+}
+
+func berBoolean(Value bool) []byte {
+	if Value {
+		return berEncode(BER_BOOLEAN, []byte{0xff})
+	}
+
+	return berEncode(BER_BOOLEAN, []byte{0x00})
+}
+
+// berRead
+// reads the next element from the stream.
+func berRead(Reader *bufio.Reader) (*ber, error) {
+	Tag, err := Reader.ReadByte()
+	if err != nil {
+		return nil, err
+	}
+
+	First, err := Reader.ReadByte()
+	if err != nil {
+		return nil, err
+	}
+
+	var Length = int(First)
+
+	if First&0x80 != 0 {
+		var Count = int(First & 0x7f)
+
+		if Count == 0 || Count > 4 {
+			return nil, errors.New("unsupported ber length")
+		}
+
+		Length = 0
+		for i := 0; i < Count; i++ {
+			Byte, err := Reader.ReadByte()
+			if err != nil {
+				return nil, err
+			}
+			Length = Length<<8 | int(Byte)
+		}
+	}
+
+	if Length > BER_MAX_MESSAGE {
+		return nil, errors.New("ber element too large")
+	}
+
+	var Content = make([]byte, Length)
+	if _, err = io.ReadFull(Reader, Content); err != nil {
+		return nil, err
+	}
+
+	return berDecode(Tag, Content)
+}
+
+// berParse
+// decodes the elements of the content of a constructed element.
+func berParse(Data []byte) ([]*ber, error) {
+	var Elements []*ber
+
+	for len(Data) > 0 {
+		if len(Data) < 2 {
+			return nil, errors.New("truncated ber element")
+		}
+
+		var (
+			Tag    = Data[0]
+			Length = int(Data[1])
+			Offset = 2
+		)
+
+		if Data[1]&0x80 != 0 {
+			var Count = int(Data[1] & 0x7f)
+
+			if Count == 0 || Count > 4 || len(Data) < 2+Count {
+				return nil, errors.New("invalid ber length")
+			}
+
+			Length = 0
+			for _, Byte := range Data[2 : 2+Count] {
+				Length = Length<<8 | int(Byte)
+			}
+			Offset += Count
+		}
+
+		if Length < 0 || len(Data)-Offset < Length {
+			return nil, errors.New("truncated ber element")
+		}
+
+		Element, err := berDecode(Tag, Data[Offset:Offset+Length])
+		if err != nil {
+			return nil, err
+		}
+
+		Elements = append(Elements, Element)
+		Data = Data[Offset+Length:]
+	}
+
+	return Elements, nil
+}
+
+func berDecode(Tag byte, Content []byte) (*ber, error) {
+	var (
+		Element = &ber{Tag: Tag, Content: Content}
+		err     error
+	)
+
+	if Tag&BER_CONSTRUCTED != 0 {
+		if Element.Children, err = berParse(Content); err != nil {
+			return nil, err
+		}
+	}
+
+	return Element, nil
+}
+
+// Int
+// value of an integer or enumerated element.
+func (b *ber) Int() int {
+	var Value = 0
+
+	for i, Byte := range b.Content {
+		if i == 0 && Byte&0x80 != 0 {
+			Value = -1
+		}
+		Value = Value<<8 | int(Byte)
+	}
+
+	return Value
+}
+
+func (b *ber) String() string {
+	return string(b.Content)
+}
+
+// Child
+// the nth child. An empty element if there isn't one.
+func (b *ber) Child(Index int) *ber {
+	if Index < len(b.Children) {
+		return b.Children[Index]
+	}
+
+	return &ber{}
+}
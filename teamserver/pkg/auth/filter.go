@@ -0,0 +1,260 @@
+package auth
+
+import (
+	"encoding/hex"
+	"errors"
+	"strings"
+)
+
+// ldapEscape
+// escapes a value put into a search filter (rfc 4515), so the name an
+// operator logs in with can't change the filter.
+func ldapEscape(Value string) string {
+	var Escaped strings.Builder
+
+	for i := 0; i < len(Value); i++ {
+		switch Value[i] {
+		case '\\', '*', '(', ')', 0:
+			Escaped.WriteString("\\" + hex.EncodeToString([]byte{Value[i]}))
+
+		default:
+			Escaped.WriteByte(Value[i])
+		}
+	}
+
+	return Escaped.String()
+}
+
+// ldapUnescape
+// decodes the \XX escapes of a value of a search filter.
+func ldapUnescape(Value string) (string, error) {
+	var Unescaped strings.Builder
+
+	for i := 0; i < len(Value); i++ {
+		if Value[i] != '\\' {
+			Unescaped.WriteByte(Value[i])
+			continue
+		}
+
+		if i+2 >= len(Value) {
+			return "", errors.New("truncated escape in filter value " + Value)
+		}
+
+		Byte, err := hex.DecodeString(Value[i+1 : i+3])
+		if err != nil {
+			return "", errors.New("invalid escape in filter value " + Value)
+		}
+
+		Unescaped.Write(Byte)
+		i += 2
+	}
+
+	return Unescaped.String(), nil
+}
+
+// ldapFilter
+// encodes a search filter in its string form (eg: "(&(objectClass=user)(sAMAccountName=jdoe))").
+func ldapFilter(Filter string) ([]byte, error) {
+	Encoded, Rest, err := ldapFilterParse(strings.TrimSpace(Filter))
+	if err != nil {
+		return nil, err
+	}
+
+	if len(strings.TrimSpace(Rest)) > 0 {
+		return nil, errors.New("unexpected " + Rest + " after the filter")
+	}
+
+	return Encoded, nil
+}
+
+// ldapFilterParse
+// encodes the parenthesized filter at the start and returns what follows it.
+func ldapFilterParse(Filter string) ([]byte, string, error) {
+	if !strings.HasPrefix(Filter, "(") {
+		return nil, "", errors.New("filter " + Filter + " doesn't start with (")
+	}
+
+	Filter = Filter[1:]
+
+	if len(Filter) == 0 {
+		return nil, "", errors.New("empty filter")
+	}
+
+	switch Filter[0] {
+	case '&', '|':
+		var (
+			Tag      byte = BER_CONTEXT | BER_CONSTRUCTED | 0
+			Children [][]byte
+			Rest     = Filter[1:]
+		)
+
+		if Filter[0] == '|' {
+			Tag = BER_CONTEXT | BER_CONSTRUCTED | 1
+		}
+
+		for strings.HasPrefix(Rest, "(") {
+			Child, Next, err := ldapFilterParse(Rest)
+			if err != nil {
+				return nil, "", err
+			}
+
+			Children = append(Children, Child)
+			Rest = Next
+		}
+
+		if !strings.HasPrefix(Rest, ")") {
+			return nil, "", errors.New("missing ) in filter")
+		}
+
+		return berEncode(Tag, Children...), Rest[1:], nil
+
+	case '!':
+		Child, Rest, err := ldapFilterParse(Filter[1:])
+		if err != nil {
+			return nil, "", err
+		}
+
+		if !strings.HasPrefix(Rest, ")") {
+			return nil, "", errors.New("missing ) in filter")
+		}
+
+		return berEncode(BER_CONTEXT|BER_CONSTRUCTED|2, Child), Rest[1:], nil
+	}
+
+	/* a single comparison. values have their parentheses escaped */
+	End := strings.IndexByte(Filter, ')')
+	if End < 0 {
+		return nil, "", errors.New("missing ) in filter")
+	}
+
+	Item, err := ldapFilterItem(Filter[:End])
+	if err != nil {
+		return nil, "", err
+	}
+
+	return Item, Filter[End+1:], nil
+}
+
+// ldapFilterItem
+// encodes a comparison (attribute=value, >=, <=, ~=, presence, substrings
+// or an extensible match like member:1.2.840.113556.1.4.1941:=<dn>).
+func ldapFilterItem(Item string) ([]byte, error) {
+	Index := strings.IndexByte(Item, '=')
+	if Index <= 0 {
+		return nil, errors.New("invalid filter item " + Item)
+	}
+
+	var (
+		Attribute = Item[:Index]
+		Value     = Item[Index+1:]
+		Tag       byte
+	)
+
+	switch Attribute[len(Attribute)-1] {
+	case '>':
+		Tag, Attribute = 5, Attribute[:len(Attribute)-1]
+
+	case '<':
+		Tag, Attribute = 6, Attribute[:len(Attribute)-1]
+
+	case '~':
+		Tag, Attribute = 8, Attribute[:len(Attribute)-1]
+
+	case ':':
+		return ldapFilterExtensible(Attribute[:len(Attribute)-1], Value)
+
+	default:
+		Tag = 3
+	}
+
+	if len(Attribute) == 0 {
+		return nil, errors.New("invalid filter item " + Item)
+	}
+
+	if Tag == 3 && Value == "*" {
+		return berString(BER_CONTEXT|7, Attribute), nil
+	}
+
+	/* an unescaped star is a wildcard, escaped ones are \2a */
+	if Tag == 3 && strings.Contains(Value, "*") {
+		var (
+			Parts     = strings.Split(Value, "*")
+			Substring [][]byte
+		)
+
+		for i, Part := range Parts {
+			if len(Part) == 0 {
+				continue
+			}
+
+			Part, err := ldapUnescape(Part)
+			if err != nil {
+				return nil, err
+			}
+
+			switch i {
+			case 0:
+				Substring = append(Substring, berString(BER_CONTEXT|0, Part))
+
+			case len(Parts) - 1:
+				Substring = append(Substring, berString(BER_CONTEXT|2, Part))
+
+			default:
+				Substring = append(Substring, berString(BER_CONTEXT|1, Part))
+			}
+		}
+
+		return berEncode(BER_CONTEXT|BER_CONSTRUCTED|4, berString(BER_OCTETS, Attribute), berEncode(BER_SEQUENCE, Substring...)), nil
+	}
+
+	Value, err := ldapUnescape(Value)
+	if err != nil {
+		return nil, err
+	}
+
+	return berEncode(BER_CONTEXT|BER_CONSTRUCTED|Tag, berString(BER_OCTETS, Attribute), berString(BER_OCTETS, Value)), nil
+}
+
+// ldapFilterExtensible
+// encodes attribute[:dn][:rule]:=value.
+func ldapFilterExtensible(Description, Value string) ([]byte, error) {
+	var (
+		Parts = strings.Split(Description, ":")
+		Match [][]byte
+		DN    bool
+		Rule  string
+	)
+
+	for _, Part := range Parts[1:] {
+		if strings.EqualFold(Part, "dn") {
+			DN = true
+		} else {
+			Rule = Part
+		}
+	}
+
+	Value, err := ldapUnescape(Value)
+	if err != nil {
+		return nil, err
+	}
+
+	if len(Rule) > 0 {
+		Match = append(Match, berString(BER_CONTEXT|1, Rule))
+	}
+
+	if len(Parts[0]) > 0 {
+		Match = append(Match, berString(BER_CONTEXT|2, Parts[0]))
+	}
+
+	if len(Rule) == 0 && len(Parts[0]) == 0 {
+		return nil, errors.New("extensible match without attribute and rule")
+	}
+
+	Match = append(Match, berString(BER_CONTEXT|3, Value))
+
+	if DN {
+		Match = append(Match, berEncode(BER_CONTEXT|4, []byte{0xff}))
+	}
+
+	return berEncode(BER_CONTEXT|BER_CONSTRUCTED|9, Match...), nil
+}
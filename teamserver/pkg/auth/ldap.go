@@ -0,0 +1,413 @@
+package auth
+
+import (
+	"bufio"
+	"crypto/tls"
+	"errors"
+	"fmt"
+	"net"
+	"net/url"
+	"strings"
+	"time"
+)
+
+// ldap operations (application tags) and result codes
+const (
+	LDAP_BIND_REQUEST     = BER_APPLICATION | BER_CONSTRUCTED | 0
+	LDAP_BIND_RESPONSE    = BER_APPLICATION | BER_CONSTRUCTED | 1
+	LDAP_UNBIND_REQUEST   = BER_APPLICATION | 2
+	LDAP_SEARCH_REQUEST   = BER_APPLICATION | BER_CONSTRUCTED | 3
+	LDAP_SEARCH_ENTRY     = BER_APPLICATION | BER_CONSTRUCTED | 4
+	LDAP_SEARCH_DONE      = BER_APPLICATION | BER_CONSTRUCTED | 5
+	LDAP_EXTENDED_REQUEST = BER_APPLICATION | BER_CONSTRUCTED | 23
+
+	LDAP_SUCCESS                = 0
+	LDAP_SIZE_LIMIT_EXCEEDED    = 4
+	LDAP_INVALID_CREDENTIALS    = 49
+	LDAP_OID_STARTTLS           = "1.3.6.1.4.1.1466.20037"
+	LDAP_DEFAULT_USERATTRIBUTE  = "sAMAccountName"
+	LDAP_DEFAULT_GROUPATTRIBUTE = "memberOf"
+)
+
+// LdapOptions
+// the directory (ldap or active directory) operators get looked up in.
+type LdapOptions struct {
+	// ldaps://dc01.corp.local or ldap://dc01.corp.local
+	Url string
+	// upgrades ldap:// to tls before anything is sent
+	StartTLS bool
+	// pem file of the certificate authority of the directory. default is the system pool
+	CACert   string
+	Insecure bool
+
+	// account searching the operators. anonymous if empty
+	BindDN       string
+	BindPassword string
+
+	// where the operators and groups get searched
+	BaseDN string
+	// attribute of the login name. default is sAMAccountName
+	UserAttribute string
+	// filter the operators additionally have to match (eg: "(objectClass=person)")
+	UserFilter string
+	// search of the groups of an operator, {dn} is its dn. the memberOf
+	// values of the operator by default
+	GroupFilter string
+
+	Timeout time.Duration
+}
+
+// Ldap
+// authenticates operators by binding to the directory with their password.
+type Ldap struct {
+	Options LdapOptions
+
+	address string
+	tls     bool
+	config  *tls.Config
+}
+
+func NewLdap(Options LdapOptions) (*Ldap, error) {
+	var Ldap = &Ldap{Options: Options}
+
+	Url, err := url.Parse(Options.Url)
+	if err != nil {
+		return nil, err
+	}
+
+	switch strings.ToLower(Url.Scheme) {
+	case "ldap":
+		Ldap.address = Url.Host
+		if len(Url.Port()) == 0 {
+			Ldap.address = net.JoinHostPort(Url.Host, "389")
+		}
+
+	case "ldaps":
+		Ldap.tls = true
+		Ldap.address = Url.Host
+		if len(Url.Port()) == 0 {
+			Ldap.address = net.JoinHostPort(Url.Host, "636")
+		}
+
+	default:
+		return nil, errors.New("url of the directory isn't ldap:// or ldaps://")
+	}
+
+	if Ldap.tls && Options.StartTLS {
+		return nil, errors.New("StartTLS is for ldap://, ldaps:// is tls already")
+	}
+
+	if len(Options.BaseDN) == 0 {
+		return nil, errors.New("no BaseDN to search the operators in")
+	}
+
+	if len(Options.UserAttribute) == 0 {
+		Ldap.Options.UserAttribute = LDAP_DEFAULT_USERATTRIBUTE
+	}
+
+	if Options.Timeout == 0 {
+		Ldap.Options.Timeout = AUTH_TIMEOUT
+	}
+
+	/* the certificate authority is read now, the teamserver might be chrooted on the first login */
+	Host, _, _ := net.SplitHostPort(Ldap.address)
+
+	if Ldap.config, err = tlsConfig(Host, Options.CACert, Options.Insecure); err != nil {
+		return nil, err
+	}
+
+	/* the filters of the profile are checked now, not on the first login */
+	if _, err = ldapFilter(Ldap.userFilter("operator")); err != nil {
+		return nil, fmt.Errorf("UserFilter: %v", err)
+	}
+
+	if len(Options.GroupFilter) > 0 {
+		if _, err = ldapFilter(Ldap.groupFilter("CN=operator")); err != nil {
+			return nil, fmt.Errorf("GroupFilter: %v", err)
+		}
+	}
+
+	return Ldap, nil
+}
+
+func (l *Ldap) Name() string {
+	return "ldap"
+}
+
+// Authenticate
+// looks up the operator, binds with its password and collects its groups.
+func (l *Ldap) Authenticate(Credentials Credentials) (*Identity, error) {
+	/* a bind without password is an anonymous one, it always succeeds */
+	if len(Credentials.User) == 0 || len(Credentials.Password) == 0 {
+		return nil, ErrUnsupported
+	}
+
+	Conn, err := l.connect()
+	if err != nil {
+		return nil, err
+	}
+	defer Conn.close()
+
+	if err = Conn.bind(l.Options.BindDN, l.Options.BindPassword); err != nil {
+		return nil, fmt.Errorf("bind of %v: %v", l.Options.BindDN, err)
+	}
+
+	Entries, err := Conn.search(l.Options.BaseDN, l.userFilter(Credentials.User), 2, l.Options.UserAttribute, LDAP_DEFAULT_GROUPATTRIBUTE)
+	if err != nil {
+		return nil, err
+	}
+
+	if len(Entries) == 0 {
+		return nil, ErrInvalid
+	}
+
+	if len(Entries) > 1 {
+		return nil, fmt.Errorf("%v matches more than one entry", Credentials.User)
+	}
+
+	var (
+		Entry    = Entries[0]
+		Identity = &Identity{Name: Credentials.User}
+	)
+
+	if Names := Entry.Attributes[strings.ToLower(l.Options.UserAttribute)]; len(Names) > 0 {
+		Identity.Name = Names[0]
+	}
+
+	if err = Conn.bind(Entry.DN, Credentials.Password); err != nil {
+		return nil, err
+	}
+
+	if len(l.Options.GroupFilter) == 0 {
+		Identity.Groups = Entry.Attributes[strings.ToLower(LDAP_DEFAULT_GROUPATTRIBUTE)]
+		return Identity, nil
+	}
+
+	/* the operator might not be allowed to search the groups */
+	if err = Conn.bind(l.Options.BindDN, l.Options.BindPassword); err != nil {
+		return nil, fmt.Errorf("bind of %v: %v", l.Options.BindDN, err)
+	}
+
+	Groups, err := Conn.search(l.Options.BaseDN, l.groupFilter(Entry.DN), 0, "1.1")
+	if err != nil {
+		return nil, err
+	}
+
+	for _, Group := range Groups {
+		Identity.Groups = append(Identity.Groups, Group.DN)
+	}
+
+	return Identity, nil
+}
+
+func (l *Ldap) userFilter(User string) string {
+	return "(&(" + l.Options.UserAttribute + "=" + ldapEscape(User) + ")" + l.Options.UserFilter + ")"
+}
+
+func (l *Ldap) groupFilter(DN string) string {
+	return strings.ReplaceAll(l.Options.GroupFilter, "{dn}", ldapEscape(DN))
+}
+
+// connect
+// connects to the directory, over tls if asked to.
+func (l *Ldap) connect() (*ldapConn, error) {
+	Conn, err := net.DialTimeout("tcp", l.address, l.Options.Timeout)
+	if err != nil {
+		return nil, err
+	}
+
+	Conn.SetDeadline(time.Now().Add(l.Options.Timeout))
+
+	if l.tls {
+		Conn = tls.Client(Conn, l.config)
+	}
+
+	var Ldap = &ldapConn{conn: Conn, reader: bufio.NewReader(Conn)}
+
+	if l.Options.StartTLS {
+		Response, err := Ldap.request(berEncode(LDAP_EXTENDED_REQUEST, berString(BER_CONTEXT|0, LDAP_OID_STARTTLS)))
+		if err != nil {
+			Conn.Close()
+			return nil, err
+		}
+
+		if err = ldapResult(Response); err != nil {
+			Conn.Close()
+			return nil, fmt.Errorf("starttls: %v", err)
+		}
+
+		Ldap.conn = tls.Client(Conn, l.config)
+		Ldap.reader = bufio.NewReader(Ldap.conn)
+	}
+
+	return Ldap, nil
+}
+
+// ldapEntry
+// an entry of a search with its attributes by their lowercase names.
+type ldapEntry struct {
+	DN         string
+	Attributes map[string][]string
+}
+
+type ldapConn struct {
+	conn   net.Conn
+	reader *bufio.Reader
+	id     int
+}
+
+// send
+// sends the operation as the next message.
+func (c *ldapConn) send(Operation []byte) (int, error) {
+	c.id++
+
+	_, err := c.conn.Write(berEncode(BER_SEQUENCE, berInteger(BER_INTEGER, c.id), Operation))
+
+	return c.id, err
+}
+
+// receive
+// reads the next operation of the response to the message.
+func (c *ldapConn) receive(ID int) (*ber, error) {
+	for {
+		Message, err := berRead(c.reader)
+		if err != nil {
+			return nil, err
+		}
+
+		if Message.Tag != BER_SEQUENCE || len(Message.Children) < 2 {
+			return nil, errors.New("invalid ldap message")
+		}
+
+		/* notices of the server (id 0) and answers to earlier messages */
+		if Message.Child(0).Int() != ID {
+			continue
+		}
+
+		return Message.Child(1), nil
+	}
+}
+
+// request
+// sends the operation and reads its single response.
+func (c *ldapConn) request(Operation []byte) (*ber, error) {
+	ID, err := c.send(Operation)
+	if err != nil {
+		return nil, err
+	}
+
+	return c.receive(ID)
+}
+
+// bind
+// simple bind. An empty dn binds anonymously.
+func (c *ldapConn) bind(DN, Password string) error {
+	Response, err := c.request(berEncode(LDAP_BIND_REQUEST,
+		berInteger(BER_INTEGER, 3),
+		berString(BER_OCTETS, DN),
+		berString(BER_CONTEXT|0, Password),
+	))
+	if err != nil {
+		return err
+	}
+
+	if Response.Tag != LDAP_BIND_RESPONSE {
+		return errors.New("unexpected response to the bind")
+	}
+
+	return ldapResult(Response)
+}
+
+// search
+// searches the subtree of the base for the filter and returns the entries
+// with the attributes. Limit is the max number of entries, 0 for no limit.
+func (c *ldapConn) search(Base, Filter string, Limit int, Attributes ...string) ([]ldapEntry, error) {
+	var (
+		Entries   []ldapEntry
+		Requested [][]byte
+	)
+
+	Encoded, err := ldapFilter(Filter)
+	if err != nil {
+		return nil, err
+	}
+
+	for _, Attribute := range Attributes {
+		Requested = append(Requested, berString(BER_OCTETS, Attribute))
+	}
+
+	ID, err := c.send(berEncode(LDAP_SEARCH_REQUEST,
+		berString(BER_OCTETS, Base),
+		berInteger(BER_ENUMERATED, 2), /* whole subtree */
+		berInteger(BER_ENUMERATED, 0), /* never dereference aliases */
+		berInteger(BER_INTEGER, Limit),
+		berInteger(BER_INTEGER, 0),
+		berBoolean(false),
+		Encoded,
+		berEncode(BER_SEQUENCE, Requested...),
+	))
+	if err != nil {
+		return nil, err
+	}
+
+	for {
+		Response, err := c.receive(ID)
+		if err != nil {
+			return nil, err
+		}
+
+		switch Response.Tag {
+		case LDAP_SEARCH_ENTRY:
+			var Entry = ldapEntry{
+				DN:         Response.Child(0).String(),
+				Attributes: make(map[string][]string),
+			}
+
+			for _, Attribute := range Response.Child(1).Children {
+				var Name = strings.ToLower(Attribute.Child(0).String())
+
+				for _, Value := range Attribute.Child(1).Children {
+					Entry.Attributes[Name] = append(Entry.Attributes[Name], Value.String())
+				}
+			}
+
+			Entries = append(Entries, Entry)
+
+		case LDAP_SEARCH_DONE:
+			/* more than the limit is what we wanted to know */
+			if Response.Child(0).Int() == LDAP_SIZE_LIMIT_EXCEEDED {
+				return Entries, nil
+			}
+
+			return Entries, ldapResult(Response)
+		}
+
+		/* referrals to other directories aren't followed */
+	}
+}
+
+// close
+// unbinds and closes the connection.
+func (c *ldapConn) close() {
+	c.send(berEncode(LDAP_UNBIND_REQUEST))
+	c.conn.Close()
+}
+
+// ldapResult
+// the error of the result of an operation.
+func ldapResult(Response *ber) error {
+	switch Code := Response.Child(0).Int(); Code {
+	case LDAP_SUCCESS:
+		return nil
+
+	case LDAP_INVALID_CREDENTIALS:
+		return ErrInvalid
+
+	default:
+		if Message := Response.Child(2).String(); len(Message) > 0 {
+			return fmt.Errorf("ldap error %v: %v", Code, Message)
+		}
+
+		return fmt.Errorf("ldap error %v", Code)
+	}
+}
@@ -0,0 +1,434 @@
+package auth
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rsa"
+	_ "crypto/sha256"
+	_ "crypto/sha512"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"math/big"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	// the keys of the provider get fetched again at most this often for an unknown key id
+	OIDC_REFRESH = time.Minute
+
+	// clock skew tolerated with the provider
+	OIDC_LEEWAY = time.Minute
+
+	OIDC_DEFAULT_USERCLAIM   = "preferred_username"
+	OIDC_DEFAULT_GROUPSCLAIM = "groups"
+)
+
+// OidcOptions
+// the openid connect provider issuing the id tokens of the operators.
+type OidcOptions struct {
+	// issuer url as in the tokens (eg: https://login.corp.local/realms/red)
+	Issuer string
+	// client id of the teamserver at the provider, the audience of the tokens
+	ClientID string
+	// claim with the name of the operator. default is preferred_username
+	UserClaim string
+	// claim with the groups of the operator. default is groups
+	GroupsClaim string
+	// pem file of the certificate authority of the provider. default is the system pool
+	CACert string
+}
+
+// Oidc
+// authenticates operators by the id tokens their identity provider issued.
+type Oidc struct {
+	Options OidcOptions
+
+	client *http.Client
+
+	mutex   sync.Mutex
+	jwks    string
+	keys    map[string]crypto.PublicKey
+	fetched time.Time
+}
+
+func NewOidc(Options OidcOptions) (*Oidc, error) {
+	var Oidc = &Oidc{Options: Options}
+
+	Url, err := url.Parse(Options.Issuer)
+	if err != nil {
+		return nil, err
+	}
+
+	if Url.Scheme != "https" || len(Url.Host) == 0 {
+		return nil, errors.New("issuer of the provider isn't an https url")
+	}
+
+	if len(Options.ClientID) == 0 {
+		return nil, errors.New("no ClientID the tokens are issued to")
+	}
+
+	if len(Options.UserClaim) == 0 {
+		Oidc.Options.UserClaim = OIDC_DEFAULT_USERCLAIM
+	}
+
+	if len(Options.GroupsClaim) == 0 {
+		Oidc.Options.GroupsClaim = OIDC_DEFAULT_GROUPSCLAIM
+	}
+
+	Config, err := tlsConfig(Url.Hostname(), Options.CACert, false)
+	if err != nil {
+		return nil, err
+	}
+
+	/* the provider gets discovered on the first login, it might not be up yet */
+	Oidc.client = &http.Client{
+		Timeout: AUTH_TIMEOUT,
+		Transport: &http.Transport{
+			Proxy:           http.ProxyFromEnvironment,
+			TLSClientConfig: Config,
+		},
+	}
+
+	return Oidc, nil
+}
+
+func (o *Oidc) Name() string {
+	return "oidc"
+}
+
+// Authenticate
+// verifies the id token and returns the operator it was issued for.
+func (o *Oidc) Authenticate(Credentials Credentials) (*Identity, error) {
+	if len(Credentials.Token) == 0 {
+		return nil, ErrUnsupported
+	}
+
+	Claims, err := o.verify(Credentials.Token)
+	if err != nil {
+		return nil, err
+	}
+
+	var Identity = new(Identity)
+
+	if Identity.Name, _ = Claims[o.Options.UserClaim].(string); len(Identity.Name) == 0 {
+		return nil, errors.New("token has no " + o.Options.UserClaim + " claim")
+	}
+
+	switch Groups := Claims[o.Options.GroupsClaim].(type) {
+	case string:
+		Identity.Groups = []string{Groups}
+
+	case []any:
+		for _, Group := range Groups {
+			if Group, ok := Group.(string); ok {
+				Identity.Groups = append(Identity.Groups, Group)
+			}
+		}
+	}
+
+	if Expires, ok := Claims["exp"].(float64); ok {
+		Identity.Expires = time.Unix(int64(Expires), 0)
+	}
+
+	return Identity, nil
+}
+
+// verify
+// checks the signature of the token with the keys of the provider, its
+// issuer, audience and lifetime. Returns its claims.
+func (o *Oidc) verify(Token string) (map[string]any, error) {
+	var (
+		Parts  = strings.Split(Token, ".")
+		Header struct {
+			Alg string `json:"alg"`
+			Kid string `json:"kid"`
+		}
+		Claims map[string]any
+	)
+
+	if len(Parts) != 3 {
+		return nil, ErrInvalid
+	}
+
+	if err := jwtDecode(Parts[0], &Header); err != nil {
+		return nil, ErrInvalid
+	}
+
+	if err := jwtDecode(Parts[1], &Claims); err != nil {
+		return nil, ErrInvalid
+	}
+
+	Signature, err := base64.RawURLEncoding.DecodeString(Parts[2])
+	if err != nil {
+		return nil, ErrInvalid
+	}
+
+	Keys, err := o.key(Header.Kid)
+	if err != nil {
+		return nil, err
+	}
+
+	var Verified = false
+	for _, Key := range Keys {
+		if err = jwtVerify(Header.Alg, Key, Parts[0]+"."+Parts[1], Signature); err == nil {
+			Verified = true
+			break
+		}
+	}
+
+	if !Verified {
+		if err == nil {
+			err = errors.New("no key of the provider for the token")
+		}
+		return nil, err
+	}
+
+	if Issuer, _ := Claims["iss"].(string); Issuer != o.Options.Issuer {
+		return nil, fmt.Errorf("token issued by %v", Issuer)
+	}
+
+	if !jwtAudience(Claims["aud"], o.Options.ClientID) {
+		return nil, errors.New("token issued to another client")
+	}
+
+	var Now = time.Now()
+
+	Expires, ok := Claims["exp"].(float64)
+	if !ok || Now.After(time.Unix(int64(Expires), 0).Add(OIDC_LEEWAY)) {
+		return nil, errors.New("token expired")
+	}
+
+	if NotBefore, ok := Claims["nbf"].(float64); ok && Now.Add(OIDC_LEEWAY).Before(time.Unix(int64(NotBefore), 0)) {
+		return nil, errors.New("token isn't valid yet")
+	}
+
+	return Claims, nil
+}
+
+// key
+// the keys of the provider that might have signed the token, fetched again
+// if the key id is unknown (the provider rotated its keys).
+func (o *Oidc) key(ID string) ([]crypto.PublicKey, error) {
+	o.mutex.Lock()
+	defer o.mutex.Unlock()
+
+	if _, ok := o.keys[ID]; (len(o.keys) == 0 || (len(ID) > 0 && !ok)) && time.Since(o.fetched) > OIDC_REFRESH {
+		if err := o.fetch(); err != nil {
+			return nil, err
+		}
+	}
+
+	if Key, ok := o.keys[ID]; ok {
+		return []crypto.PublicKey{Key}, nil
+	}
+
+	/* without key id any key of the provider might have signed it */
+	if len(ID) > 0 {
+		return nil, errors.New("unknown key " + ID + " of the provider")
+	}
+
+	var Keys []crypto.PublicKey
+	for _, Key := range o.keys {
+		Keys = append(Keys, Key)
+	}
+
+	return Keys, nil
+}
+
+// fetch
+// discovers the key set of the provider and fetches its keys.
+func (o *Oidc) fetch() error {
+	var (
+		Discovery struct {
+			Issuer  string `json:"issuer"`
+			JwksUri string `json:"jwks_uri"`
+		}
+		Set struct {
+			Keys []struct {
+				Kty string `json:"kty"`
+				Kid string `json:"kid"`
+				Use string `json:"use"`
+				N   string `json:"n"`
+				E   string `json:"e"`
+				Crv string `json:"crv"`
+				X   string `json:"x"`
+				Y   string `json:"y"`
+			} `json:"keys"`
+		}
+	)
+
+	o.fetched = time.Now()
+
+	if len(o.jwks) == 0 {
+		if err := o.get(strings.TrimSuffix(o.Options.Issuer, "/")+"/.well-known/openid-configuration", &Discovery); err != nil {
+			return fmt.Errorf("discovery of %v: %v", o.Options.Issuer, err)
+		}
+
+		if Discovery.Issuer != o.Options.Issuer {
+			return fmt.Errorf("provider claims to be issuer %v", Discovery.Issuer)
+		}
+
+		if len(Discovery.JwksUri) == 0 {
+			return errors.New("provider has no jwks_uri")
+		}
+
+		o.jwks = Discovery.JwksUri
+	}
+
+	if err := o.get(o.jwks, &Set); err != nil {
+		return fmt.Errorf("keys of %v: %v", o.Options.Issuer, err)
+	}
+
+	var Keys = make(map[string]crypto.PublicKey)
+
+	for _, Key := range Set.Keys {
+		if Key.Use != "" && Key.Use != "sig" {
+			continue
+		}
+
+		switch Key.Kty {
+		case "RSA":
+			N, err := base64.RawURLEncoding.DecodeString(Key.N)
+			if err != nil {
+				continue
+			}
+
+			E, err := base64.RawURLEncoding.DecodeString(Key.E)
+			if err != nil || len(E) > 4 {
+				continue
+			}
+
+			Keys[Key.Kid] = &rsa.PublicKey{N: new(big.Int).SetBytes(N), E: int(new(big.Int).SetBytes(E).Int64())}
+
+		case "EC":
+			var Curve elliptic.Curve
+
+			switch Key.Crv {
+			case "P-256":
+				Curve = elliptic.P256()
+			case "P-384":
+				Curve = elliptic.P384()
+			case "P-521":
+				Curve = elliptic.P521()
+			default:
+				continue
+			}
+
+			X, errX := base64.RawURLEncoding.DecodeString(Key.X)
+			Y, errY := base64.RawURLEncoding.DecodeString(Key.Y)
+			if errX != nil || errY != nil {
+				continue
+			}
+
+			var Public = &ecdsa.PublicKey{Curve: Curve, X: new(big.Int).SetBytes(X), Y: new(big.Int).SetBytes(Y)}
+			if !Curve.IsOnCurve(Public.X, Public.Y) {
+				continue
+			}
+
+			Keys[Key.Kid] = Public
+		}
+	}
+
+	if len(Keys) == 0 {
+		return errors.New("provider has no signing keys")
+	}
+
+	o.keys = Keys
+
+	return nil
+}
+
+func (o *Oidc) get(Url string, Value any) error {
+	Response, err := o.client.Get(Url)
+	if err != nil {
+		return err
+	}
+	defer Response.Body.Close()
+
+	if Response.StatusCode != http.StatusOK {
+		return errors.New(Response.Status)
+	}
+
+	return json.NewDecoder(io.LimitReader(Response.Body, 1024*1024)).Decode(Value)
+}
+
+func jwtDecode(Part string, Value any) error {
+	Data, err := base64.RawURLEncoding.DecodeString(Part)
+	if err != nil {
+		return err
+	}
+
+	return json.Unmarshal(Data, Value)
+}
+
+// jwtVerify
+// checks the signature of the algorithm. Only the asymmetric algorithms of
+// the providers, a token can't pick "none" or a shared secret.
+func jwtVerify(Algorithm string, Key crypto.PublicKey, Signed string, Signature []byte) error {
+	var Hash crypto.Hash
+
+	switch Algorithm[len(Algorithm)-min(3, len(Algorithm)):] {
+	case "256":
+		Hash = crypto.SHA256
+	case "384":
+		Hash = crypto.SHA384
+	case "512":
+		Hash = crypto.SHA512
+	default:
+		return errors.New("unsupported token algorithm " + Algorithm)
+	}
+
+	var Digest = Hash.New()
+	Digest.Write([]byte(Signed))
+
+	switch Public := Key.(type) {
+	case *rsa.PublicKey:
+		switch Algorithm[:2] {
+		case "RS":
+			return rsa.VerifyPKCS1v15(Public, Hash, Digest.Sum(nil), Signature)
+		case "PS":
+			return rsa.VerifyPSS(Public, Hash, Digest.Sum(nil), Signature, &rsa.PSSOptions{SaltLength: rsa.PSSSaltLengthEqualsHash})
+		}
+
+	case *ecdsa.PublicKey:
+		var Size = (Public.Curve.Params().BitSize + 7) / 8
+
+		if Algorithm[:2] != "ES" || len(Signature) != 2*Size {
+			break
+		}
+
+		if ecdsa.Verify(Public, Digest.Sum(nil), new(big.Int).SetBytes(Signature[:Size]), new(big.Int).SetBytes(Signature[Size:])) {
+			return nil
+		}
+
+		return errors.New("invalid token signature")
+	}
+
+	return errors.New("token algorithm " + Algorithm + " doesn't match the key")
+}
+
+// jwtAudience
+// checks if the audience (a string or a list) has the client.
+func jwtAudience(Audience any, Client string) bool {
+	switch Audience := Audience.(type) {
+	case string:
+		return Audience == Client
+
+	case []any:
+		for _, Entry := range Audience {
+			if Entry == Client {
+				return true
+			}
+		}
+	}
+
+	return false
+}
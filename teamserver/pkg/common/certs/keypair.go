@@ -0,0 +1,48 @@
+package certs
+
+import (
+	"crypto/tls"
+	"os"
+	"strings"
+)
+
+// IsPEM - Tells if the value is PEM content rather than a path (eg: a
+// certificate or key resolved from a keystore)
+func IsPEM(Value string) bool {
+	return strings.HasPrefix(strings.TrimSpace(Value), "-----BEGIN ")
+}
+
+// Exists - Tells if the value is PEM content or an existing file
+func Exists(Value string) bool {
+	if IsPEM(Value) {
+		return true
+	}
+
+	_, err := os.Stat(Value)
+
+	return err == nil
+}
+
+// KeyPair - Load a certificate and its key. Both can either be a path or
+// PEM content
+func KeyPair(Cert, Key string) (tls.Certificate, error) {
+	var (
+		CertPEM = []byte(Cert)
+		KeyPEM  = []byte(Key)
+		err     error
+	)
+
+	if !IsPEM(Cert) {
+		if CertPEM, err = os.ReadFile(Cert); err != nil {
+			return tls.Certificate{}, err
+		}
+	}
+
+	if !IsPEM(Key) {
+		if KeyPEM, err = os.ReadFile(Key); err != nil {
+			return tls.Certificate{}, err
+		}
+	}
+
+	return tls.X509KeyPair(CertPEM, KeyPEM)
+}
@@ -0,0 +1,37 @@
+package certs
+
+import (
+	"crypto/sha256"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/hex"
+	"errors"
+	"strings"
+)
+
+// Pinned - Tls config of a connection to the teamserver. The teamserver
+// generates a self signed certificate by default, so only the sha256
+// fingerprint (hex, colons allowed) gets checked if specified
+func Pinned(Fingerprint string) *tls.Config {
+	var Config = &tls.Config{InsecureSkipVerify: true}
+	if len(Fingerprint) == 0 {
+		return Config
+	}
+
+	Fingerprint = strings.ToLower(strings.ReplaceAll(Fingerprint, ":", ""))
+
+	Config.VerifyPeerCertificate = func(Raw [][]byte, _ [][]*x509.Certificate) error {
+		if len(Raw) == 0 {
+			return errors.New("teamserver sent no certificate")
+		}
+
+		var Sum = sha256.Sum256(Raw[0])
+		if hex.EncodeToString(Sum[:]) != Fingerprint {
+			return errors.New("certificate of the teamserver doesn't match the fingerprint")
+		}
+
+		return nil
+	}
+
+	return Config
+}
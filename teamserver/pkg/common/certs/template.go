@@ -0,0 +1,90 @@
+package certs
+
+import (
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/pem"
+	"errors"
+	"fmt"
+
+	"Havoc/pkg/logger"
+)
+
+// Template - Subject of a certificate that can be shared between
+// teamservers. Empty fields are randomly generated.
+type Template struct {
+	CommonName         string
+	Organization       []string
+	OrganizationalUnit []string
+	Country            []string
+	Province           []string
+	Locality           []string
+}
+
+// TemplateFromCert - Extract the subject of a PEM encoded certificate
+func TemplateFromCert(Cert []byte) (*Template, error) {
+	block, _ := pem.Decode(Cert)
+	if block == nil {
+		return nil, errors.New("failed to decode certificate pem")
+	}
+
+	cert, err := x509.ParseCertificate(block.Bytes)
+	if err != nil {
+		return nil, err
+	}
+
+	return &Template{
+		CommonName:         cert.Subject.CommonName,
+		Organization:       cert.Subject.Organization,
+		OrganizationalUnit: cert.Subject.OrganizationalUnit,
+		Country:            cert.Subject.Country,
+		Province:           cert.Subject.Province,
+		Locality:           cert.Subject.Locality,
+	}, nil
+}
+
+// HTTPSGenerateRSACertificateFromTemplate - Generate a server certificate using the subject of the template
+func HTTPSGenerateRSACertificateFromTemplate(host string, template *Template) ([]byte, []byte, error) {
+	if template == nil {
+		return HTTPSGenerateRSACertificate(host)
+	}
+
+	logger.Debug(fmt.Sprintf("Generating TLS certificate (RSA) for '%s' from template ...", host))
+
+	privateKey, err := rsa.GenerateKey(rand.Reader, RSAKeySize)
+	if err != nil {
+		logger.Debug("Failed to generate private key: " + err.Error())
+		return nil, nil, err
+	}
+
+	subject := randomSubject(host)
+
+	if len(template.CommonName) > 0 {
+		subject.CommonName = template.CommonName
+	}
+
+	if len(template.Organization) > 0 {
+		subject.Organization = template.Organization
+	}
+
+	if len(template.OrganizationalUnit) > 0 {
+		subject.OrganizationalUnit = template.OrganizationalUnit
+	}
+
+	if len(template.Country) > 0 {
+		subject.Country = template.Country
+	}
+
+	if len(template.Province) > 0 {
+		subject.Province = template.Province
+	}
+
+	if len(template.Locality) > 0 {
+		subject.Locality = template.Locality
+	}
+
+	cert, key := generateCertificate(HTTPSCA, (*subject), true, false, privateKey)
+
+	return cert, key, nil
+}
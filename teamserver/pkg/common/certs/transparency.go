@@ -0,0 +1,173 @@
+package certs
+
+import (
+	"crypto/x509"
+	"encoding/asn1"
+	"encoding/pem"
+	"errors"
+	"os"
+	"strings"
+)
+
+// signed certificate timestamps of the logs embedded in the certificate (rfc 6962)
+var oidSCTList = asn1.ObjectIdentifier{1, 3, 6, 1, 4, 1, 11129, 2, 4, 2}
+
+// Exposure - Hostnames a certificate in the transparency logs discloses for
+// the hosts of a listener
+type Exposure struct {
+	// names of the certificate, as they show up in the logs
+	Names []string
+	// hosts named in full
+	Exposed []string
+	// hosts only covered by a wildcard of the certificate
+	Hidden []string
+	// hosts the certificate isn't valid for
+	Uncovered []string
+	// wildcards that would hide the exposed hosts
+	Wildcards []string
+}
+
+// Chain - Parse the certificates of a path or PEM content, the leaf first
+func Chain(Cert string) ([]*x509.Certificate, error) {
+	var (
+		Content = []byte(Cert)
+		Chain   []*x509.Certificate
+		err     error
+	)
+
+	if !IsPEM(Cert) {
+		if Content, err = os.ReadFile(Cert); err != nil {
+			return nil, err
+		}
+	}
+
+	for {
+		var Block *pem.Block
+
+		if Block, Content = pem.Decode(Content); Block == nil {
+			break
+		}
+
+		if Block.Type != "CERTIFICATE" {
+			continue
+		}
+
+		Certificate, err := x509.ParseCertificate(Block.Bytes)
+		if err != nil {
+			return nil, err
+		}
+
+		Chain = append(Chain, Certificate)
+	}
+
+	if len(Chain) == 0 {
+		return nil, errors.New("no certificate found")
+	}
+
+	return Chain, nil
+}
+
+// Logged - Tells if the leaf of the chain is in the certificate transparency
+// logs: it carries the timestamps of the logs or it chains up to a public
+// certificate authority (they have to log what they issue)
+func Logged(Chain []*x509.Certificate) bool {
+	var Leaf = Chain[0]
+
+	for _, Extension := range Leaf.Extensions {
+		if Extension.Id.Equal(oidSCTList) {
+			return true
+		}
+	}
+
+	var Intermediates = x509.NewCertPool()
+
+	for _, Certificate := range Chain[1:] {
+		Intermediates.AddCert(Certificate)
+	}
+
+	_, err := Leaf.Verify(x509.VerifyOptions{
+		Intermediates: Intermediates,
+		KeyUsages:     []x509.ExtKeyUsage{x509.ExtKeyUsageAny},
+	})
+
+	return err == nil
+}
+
+// Exposes - Sort the hosts of a listener by what the certificate discloses of
+// them
+func Exposes(Leaf *x509.Certificate, Hosts []string) Exposure {
+	var Exposure = Exposure{Names: Names(Leaf)}
+
+	for _, Host := range Hosts {
+		var (
+			Full     bool
+			Wildcard bool
+		)
+
+		Host = strings.ToLower(strings.TrimSuffix(strings.TrimSpace(Host), "."))
+		if len(Host) == 0 {
+			continue
+		}
+
+		for _, Name := range Exposure.Names {
+			if Name == Host {
+				Full = true
+			} else if strings.HasPrefix(Name, "*.") && parent(Host) == Name[2:] {
+				Wildcard = true
+			}
+		}
+
+		switch {
+
+		case Full:
+			Exposure.Exposed = append(Exposure.Exposed, Host)
+
+			/* the apex of a domain can't hide behind a wildcard */
+			if Parent := parent(Host); strings.Contains(Parent, ".") && !contains(Exposure.Wildcards, "*."+Parent) {
+				Exposure.Wildcards = append(Exposure.Wildcards, "*."+Parent)
+			}
+
+		case Wildcard:
+			Exposure.Hidden = append(Exposure.Hidden, Host)
+
+		default:
+			Exposure.Uncovered = append(Exposure.Uncovered, Host)
+
+		}
+	}
+
+	return Exposure
+}
+
+// Names - Hostnames of the certificate, lowercase and without duplicates
+func Names(Leaf *x509.Certificate) []string {
+	var Names []string
+
+	for _, Name := range append([]string{Leaf.Subject.CommonName}, Leaf.DNSNames...) {
+		Name = strings.ToLower(Name)
+
+		if len(Name) > 0 && strings.Contains(Name, ".") && !contains(Names, Name) {
+			Names = append(Names, Name)
+		}
+	}
+
+	return Names
+}
+
+func parent(Host string) string {
+	if i := strings.Index(Host, "."); i >= 0 {
+		return Host[i+1:]
+	}
+
+	return ""
+}
+
+func contains(List []string, Value string) bool {
+	for _, Item := range List {
+		if Item == Value {
+			return true
+		}
+	}
+
+	return false
+}
@@ -3,23 +3,41 @@ package crypt
 import (
     "crypto/aes"
     "crypto/cipher"
+    "errors"
 
     "Havoc/pkg/logger"
 )
 
+// AESStream
+// returns the aes-ctr stream of the key and iv.
+func AESStream(AESKey []byte, AESIv []byte) (cipher.Stream, error) {
+    /* the key schedule isn't cached here, it would keep the key of the
+       session around after it has been wiped. keyring.Session pools it */
+    block, err := aes.NewCipher(AESKey)
+    if err != nil {
+        return nil, err
+    }
+
+    /* NewCTR panics on an iv of the wrong size */
+    if len(AESIv) != block.BlockSize() {
+        return nil, errors.New("invalid iv size")
+    }
+
+    return cipher.NewCTR(block, AESIv), nil
+}
+
 func XCryptBytesAES256(XBytes []byte, AESKey []byte, AESIv []byte) []byte {
     var (
         ReverseXBytes = make([]byte, len(XBytes))
     )
 
-    block, err := aes.NewCipher(AESKey)
+    stream, err := AESStream(AESKey, AESIv)
     if err != nil {
         logger.Error("Decryption Error: " + err.Error())
         return []byte{}
     }
 
-    stream := cipher.NewCTR(block, AESIv)
     stream.XORKeyStream(ReverseXBytes, XBytes)
 
     return ReverseXBytes
-}
\ No newline at end of file
+}
@@ -0,0 +1,128 @@
+package common
+
+import (
+	"bytes"
+	"path/filepath"
+	"unicode/utf8"
+
+	"golang.org/x/text/encoding"
+	"golang.org/x/text/encoding/charmap"
+	"golang.org/x/text/encoding/japanese"
+	"golang.org/x/text/encoding/korean"
+	"golang.org/x/text/encoding/simplifiedchinese"
+	"golang.org/x/text/encoding/traditionalchinese"
+)
+
+const (
+	CODEPAGE_UTF8 = 65001
+
+	// max length of a file name in bytes (NAME_MAX of linux)
+	FILE_NAME_MAX = 255
+)
+
+// windows code pages of the ansi and console (oem) text of the agents
+var codePages = map[int]encoding.Encoding{
+	437:   charmap.CodePage437,
+	850:   charmap.CodePage850,
+	852:   charmap.CodePage852,
+	855:   charmap.CodePage855,
+	858:   charmap.CodePage858,
+	860:   charmap.CodePage860,
+	862:   charmap.CodePage862,
+	863:   charmap.CodePage863,
+	865:   charmap.CodePage865,
+	866:   charmap.CodePage866,
+	874:   charmap.Windows874,
+	932:   japanese.ShiftJIS,
+	936:   simplifiedchinese.GBK,
+	949:   korean.EUCKR,
+	950:   traditionalchinese.Big5,
+	1250:  charmap.Windows1250,
+	1251:  charmap.Windows1251,
+	1252:  charmap.Windows1252,
+	1253:  charmap.Windows1253,
+	1254:  charmap.Windows1254,
+	1255:  charmap.Windows1255,
+	1256:  charmap.Windows1256,
+	1257:  charmap.Windows1257,
+	1258:  charmap.Windows1258,
+	20866: charmap.KOI8R,
+	21866: charmap.KOI8U,
+	20932: japanese.EUCJP,
+	28591: charmap.ISO8859_1,
+	28592: charmap.ISO8859_2,
+	28595: charmap.ISO8859_5,
+	28605: charmap.ISO8859_15,
+	54936: simplifiedchinese.GB18030,
+}
+
+// CodePageKnown
+// checks if text of the code page can be converted to utf-8.
+func CodePageKnown(CodePage int) bool {
+	_, ok := codePages[CodePage]
+
+	return ok || CodePage == CODEPAGE_UTF8
+}
+
+// DecodeCodePage
+// converts text of the windows code page to utf-8. Text with a byte
+// order mark gets decoded by it and text that already is valid utf-8
+// is kept (tools writing utf-8 on any code page). Unknown code pages
+// (0 if the agent didn't report it) fall back to windows-1252 so the
+// result always is valid utf-8.
+func DecodeCodePage(Data []byte, CodePage int) string {
+	switch {
+	case bytes.HasPrefix(Data, []byte{0xef, 0xbb, 0xbf}):
+		Data = Data[3:]
+
+	case bytes.HasPrefix(Data, []byte{0xff, 0xfe}):
+		return DecodeUTF16(Data[2:])
+	}
+
+	if utf8.Valid(Data) {
+		return string(Data)
+	}
+
+	var Encoding, ok = codePages[CodePage]
+	if !ok {
+		Encoding = charmap.Windows1252
+	}
+
+	Decoded, err := Encoding.NewDecoder().Bytes(Data)
+	if err != nil {
+		return string(bytes.ToValidUTF8(Data, []byte("�")))
+	}
+
+	return string(Decoded)
+}
+
+// FileNameLimit
+// shortens the file name to FILE_NAME_MAX bytes without cutting a
+// character in half. Windows allows 255 utf-16 characters, which take
+// up to three times as many bytes as utf-8 (CJK). The extension is kept.
+func FileNameLimit(Name string) string {
+	if len(Name) <= FILE_NAME_MAX {
+		return Name
+	}
+
+	var Extension = filepath.Ext(Name)
+	if len(Extension) > FILE_NAME_MAX/4 {
+		Extension = ""
+	}
+
+	var Base = Name[:len(Name)-len(Extension)]
+	if len(Base) > FILE_NAME_MAX-len(Extension) {
+		Base = Base[:FILE_NAME_MAX-len(Extension)]
+	}
+
+	/* drop the character that got cut in half */
+	for len(Base) > 0 {
+		if Char, Size := utf8.DecodeLastRuneInString(Base); Char != utf8.RuneError || Size > 1 {
+			break
+		}
+
+		Base = Base[:len(Base)-1]
+	}
+
+	return Base + Extension
+}
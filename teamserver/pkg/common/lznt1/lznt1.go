@@ -0,0 +1,242 @@
+// Package lznt1 implements the lznt1 compression of ntdll
+// (RtlCompressBuffer/RtlDecompressBuffer with COMPRESSION_FORMAT_LZNT1)
+// so agents can compress without shipping a compressor.
+package lznt1
+
+import (
+	"encoding/binary"
+	"errors"
+)
+
+const (
+	// uncompressed bytes per chunk
+	CHUNK_SIZE = 0x1000
+
+	CHUNK_COMPRESSED = 0x8000
+	CHUNK_SIGNATURE  = 0x3000
+	CHUNK_LENGTH     = 0x0fff
+
+	// matches are looked up this many times back per position
+	MATCH_TRIES = 32
+)
+
+// tokenSplit
+// the length mask and displacement shift of a copy token at the position
+// of the chunk. The further into the chunk the more bits the displacement takes.
+func tokenSplit(Position int) (int, uint) {
+	var (
+		Mask  = 0x0fff
+		Shift = uint(12)
+	)
+
+	for i := Position - 1; i >= 0x10; i >>= 1 {
+		Mask >>= 1
+		Shift--
+	}
+
+	return Mask, Shift
+}
+
+// Compress
+// compresses the data into lznt1 chunks.
+func Compress(Data []byte) []byte {
+	var Compressed = make([]byte, 0, len(Data)+len(Data)/CHUNK_SIZE*2+2)
+
+	for Offset := 0; Offset < len(Data); Offset += CHUNK_SIZE {
+		var End = Offset + CHUNK_SIZE
+		if End > len(Data) {
+			End = len(Data)
+		}
+
+		Compressed = compressChunk(Compressed, Data[Offset:End])
+	}
+
+	return Compressed
+}
+
+// compressChunk
+// appends the chunk to the buffer, compressed if that makes it smaller.
+func compressChunk(Buffer, Chunk []byte) []byte {
+	var (
+		Start    = len(Buffer)
+		Head     = make(map[uint32]int)
+		Previous = make([]int, len(Chunk))
+		Flags    int
+		Element  = 8
+	)
+
+	/* header gets written once the size is known */
+	Buffer = append(Buffer, 0, 0)
+
+	for Position := 0; Position < len(Chunk); {
+		if Element == 8 {
+			Flags = len(Buffer)
+			Buffer = append(Buffer, 0)
+			Element = 0
+		}
+
+		var (
+			Mask, Shift = tokenSplit(Position)
+			MaxLength   = Mask + 3
+			MaxDistance = 1 << (16 - Shift)
+			Length      = 0
+			Distance    = 0
+		)
+
+		if MaxLength > len(Chunk)-Position {
+			MaxLength = len(Chunk) - Position
+		}
+
+		if MaxLength >= 3 {
+			var Candidate, ok = Head[key(Chunk[Position:])]
+
+			for Try := 0; ok && Try < MATCH_TRIES && Position-Candidate <= MaxDistance; Try++ {
+				var n = 0
+				for n < MaxLength && Chunk[Candidate+n] == Chunk[Position+n] {
+					n++
+				}
+
+				if n > Length {
+					Length, Distance = n, Position-Candidate
+					if n == MaxLength {
+						break
+					}
+				}
+
+				if Candidate, ok = Previous[Candidate], Previous[Candidate] >= 0; !ok {
+					break
+				}
+			}
+		}
+
+		if Length >= 3 {
+			var Token = uint16((Distance-1)<<Shift | (Length - 3))
+
+			Buffer[Flags] |= 1 << Element
+			Buffer = binary.LittleEndian.AppendUint16(Buffer, Token)
+		} else {
+			Length = 1
+			Buffer = append(Buffer, Chunk[Position])
+		}
+
+		for ; Length > 0; Length-- {
+			if Position+3 <= len(Chunk) {
+				var Key = key(Chunk[Position:])
+				if Candidate, ok := Head[Key]; ok {
+					Previous[Position] = Candidate
+				} else {
+					Previous[Position] = -1
+				}
+				Head[Key] = Position
+			}
+			Position++
+		}
+
+		Element++
+	}
+
+	/* not worth it. store the chunk as is */
+	if len(Buffer)-Start >= len(Chunk)+2 {
+		Buffer = append(Buffer[:Start], 0, 0)
+		Buffer = append(Buffer, Chunk...)
+		binary.LittleEndian.PutUint16(Buffer[Start:], uint16(CHUNK_SIGNATURE|(len(Chunk)+2-3)))
+
+		return Buffer
+	}
+
+	binary.LittleEndian.PutUint16(Buffer[Start:], uint16(CHUNK_COMPRESSED|CHUNK_SIGNATURE|(len(Buffer)-Start-3)))
+
+	return Buffer
+}
+
+func key(Data []byte) uint32 {
+	return uint32(Data[0]) | uint32(Data[1])<<8 | uint32(Data[2])<<16
+}
+
+// Decompress
+// decompresses the lznt1 chunks. Size is the max size of the data,
+// more is refused.
+func Decompress(Compressed []byte, Size int) ([]byte, error) {
+	var Data = make([]byte, 0, Size)
+
+	for len(Compressed) >= 2 {
+		var Header = int(binary.LittleEndian.Uint16(Compressed))
+		if Header == 0 {
+			break
+		}
+
+		var Length = (Header & CHUNK_LENGTH) + 3 - 2
+		if Length > len(Compressed)-2 {
+			return nil, errors.New("chunk exceeds the data")
+		}
+
+		var (
+			Chunk = Compressed[2 : 2+Length]
+			Start = len(Data)
+		)
+
+		Compressed = Compressed[2+Length:]
+
+		if Header&CHUNK_COMPRESSED == 0 {
+			if len(Data)+len(Chunk) > Size {
+				return nil, errors.New("data exceeds its size")
+			}
+
+			Data = append(Data, Chunk...)
+		} else {
+			for len(Chunk) > 0 {
+				var Flags = Chunk[0]
+				Chunk = Chunk[1:]
+
+				for Element := 0; Element < 8 && len(Chunk) > 0; Element++ {
+					if Flags&(1<<Element) == 0 {
+						if len(Data) >= Size {
+							return nil, errors.New("data exceeds its size")
+						}
+
+						Data = append(Data, Chunk[0])
+						Chunk = Chunk[1:]
+						continue
+					}
+
+					if len(Chunk) < 2 {
+						return nil, errors.New("truncated copy token")
+					}
+
+					var (
+						Token       = int(binary.LittleEndian.Uint16(Chunk))
+						Mask, Shift = tokenSplit(len(Data) - Start)
+						Distance    = Token>>Shift + 1
+						Count       = Token&Mask + 3
+					)
+
+					Chunk = Chunk[2:]
+
+					if Distance > len(Data)-Start {
+						return nil, errors.New("copy token points before the chunk")
+					}
+
+					if len(Data)+Count > Size || len(Data)-Start+Count > CHUNK_SIZE {
+						return nil, errors.New("data exceeds its size")
+					}
+
+					/* the copy might overlap what it appends */
+					for ; Count > 0; Count-- {
+						Data = append(Data, Data[len(Data)-Distance])
+					}
+				}
+			}
+		}
+
+		/* chunks before the last one are always full */
+		if len(Compressed) >= 2 && binary.LittleEndian.Uint16(Compressed) != 0 && len(Data)-Start < CHUNK_SIZE {
+			if Start+CHUNK_SIZE > Size {
+				return nil, errors.New("data exceeds its size")
+			}
+
+			Data = append(Data, make([]byte, Start+CHUNK_SIZE-len(Data))...)
+		}
+	}
+
+	return Data, nil
+}
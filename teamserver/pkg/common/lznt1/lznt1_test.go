@@ -0,0 +1,72 @@
+package lznt1
+
+import (
+	"bytes"
+	"math/rand"
+	"testing"
+)
+
+func TestDecompress(t *testing.T) {
+	/* literals abc and a copy of 6 bytes 3 back */
+	Data, err := Decompress([]byte{0x05, 0xb0, 0x08, 'a', 'b', 'c', 0x03, 0x20}, 0x100)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if string(Data) != "abcabcabc" {
+		t.Errorf("decompressed %q", Data)
+	}
+
+	if _, err = Decompress([]byte{0x05, 0xb0, 0x08, 'a', 'b', 'c', 0x03, 0x20}, 8); err == nil {
+		t.Error("data bigger than its size decompressed")
+	}
+
+	/* truncated chunk, copy before the chunk, truncated copy token */
+	for _, Bad := range [][]byte{
+		{0x05, 0xb0, 0x08, 'a'},
+		{0x02, 0xb0, 0x01, 0x03, 0x20},
+		{0x01, 0xb0, 0x01, 'a'},
+	} {
+		if _, err = Decompress(Bad, 0x100); err == nil {
+			t.Errorf("%x decompressed", Bad)
+		}
+	}
+}
+
+func TestCompress(t *testing.T) {
+	var (
+		Random = make([]byte, 3*CHUNK_SIZE+17)
+		Text   = bytes.Repeat([]byte("GET /index.html HTTP/1.1\r\nHost: example.com\r\n\r\n"), 700)
+	)
+
+	rand.New(rand.NewSource(1)).Read(Random)
+
+	for Name, Data := range map[string][]byte{
+		"empty":  {},
+		"byte":   {'a'},
+		"chunk":  Text[:CHUNK_SIZE],
+		"text":   Text,
+		"zeros":  make([]byte, 5*CHUNK_SIZE+1),
+		"random": Random,
+	} {
+		var Compressed = Compress(Data)
+
+		Decompressed, err := Decompress(Compressed, len(Data))
+		if err != nil {
+			t.Errorf("%v: %v", Name, err)
+			continue
+		}
+
+		if !bytes.Equal(Decompressed, Data) {
+			t.Errorf("%v: round trip changed the data", Name)
+		}
+
+		if Name == "text" && len(Compressed) > len(Data)/4 {
+			t.Errorf("text compressed to %v of %v bytes", len(Compressed), len(Data))
+		}
+
+		if Name == "random" && len(Compressed) > len(Data)+2*4 {
+			t.Errorf("random data grew to %v of %v bytes", len(Compressed), len(Data))
+		}
+	}
+}
@@ -1,7 +1,10 @@
 package parser
 
 import (
+	"crypto/aes"
+	"crypto/cipher"
 	"encoding/binary"
+	"errors"
 	"Havoc/pkg/common"
 	"Havoc/pkg/common/crypt"
 )
@@ -16,9 +19,23 @@ const (
 	ReadBool
 )
 
+// max size of a string or buffer the Parse*Max functions accept.
+// enough for a unicode path of max length.
+const MaxStringSize = 0x10000
+
+var (
+	// a read ran past the end of the buffer
+	ErrTruncated = errors.New("parser: read past the end of the buffer")
+	// a size field exceeded the max size of the field
+	ErrTooLarge = errors.New("parser: size exceeds the limit")
+	// the key or iv to decrypt the buffer is invalid
+	ErrInvalidKey = errors.New("parser: invalid aes key or iv")
+)
+
 type Parser struct {
 	buffer    []byte
 	bigEndian bool
+	err       error
 }
 
 func NewParser(buffer []byte) *Parser {
@@ -30,7 +47,7 @@ func NewParser(buffer []byte) *Parser {
 
 func (p *Parser) CanIRead(ReadTypes []ReadType) bool {
 	integer   := make([]byte, 4)
-	number    := 0
+	number    := uint64(0)
 	BytesRead := 0
 	TotalSize := p.Length()
 	
@@ -65,35 +82,26 @@ func (p *Parser) CanIRead(ReadTypes []ReadType) bool {
 			}
 			copy(integer, p.buffer[BytesRead:BytesRead+4])
 			if p.bigEndian {
-				number = int(binary.BigEndian.Uint32(integer))
+				number = uint64(binary.BigEndian.Uint32(integer))
 			} else {
-				number = int(binary.LittleEndian.Uint32(integer))
+				number = uint64(binary.LittleEndian.Uint32(integer))
 			}
 			BytesRead += 4
-			if TotalSize - BytesRead < number {
+			/* compare unsigned so a huge size can't wrap around on 32-bit */
+			if uint64(TotalSize - BytesRead) < number {
 				return false
 			}
-			BytesRead += number
+			BytesRead += int(number)
 		}
 	}
 	return true
 }
 
 func (p *Parser) ParseInt32() int {
-	var integer = make([]byte, 4)
+	var integer = p.read(4)
 
-	for i := range integer {
-		integer[i] = 0
-	}
-
-	if p.Length() >= 4 {
-		if p.Length() == 4 {
-			copy(integer, p.buffer[:p.Length()])
-			p.buffer = []byte{}
-		} else {
-			copy(integer, p.buffer[:p.Length()-4])
-			p.buffer = p.buffer[4:]
-		}
+	if integer == nil {
+		return 0
 	}
 
 	if p.bigEndian {
@@ -103,54 +111,48 @@ func (p *Parser) ParseInt32() int {
 	}
 }
 
-func (p *Parser) ParseInt64() int64 {
-	var integer = make([]byte, 8)
-
-	for i := range integer {
-		integer[i] = 0
-	}
-
-	if p.Length() >= 8 {
-		if p.Length() == 8 {
-			copy(integer, p.buffer[:p.Length()])
-			p.buffer = []byte{}
-		} else {
-			copy(integer, p.buffer[:p.Length()-8])
-			p.buffer = p.buffer[8:]
-		}
+// PeekInt32
+// returns the int32 at the offset without consuming anything.
+func (p *Parser) PeekInt32(Offset int) int {
+	if Offset < 0 || p.Length() < Offset+4 {
+		return 0
 	}
 
 	if p.bigEndian {
-		return int64(binary.BigEndian.Uint64(integer))
-	} else {
-		return int64(binary.LittleEndian.Uint64(integer))
+		return int(binary.BigEndian.Uint32(p.buffer[Offset : Offset+4]))
 	}
-}
 
-func (p *Parser) ParseBool() bool {
-	var integer = make([]byte, 4)
+	return int(binary.LittleEndian.Uint32(p.buffer[Offset : Offset+4]))
+}
 
-	for i := range integer {
-		integer[i] = 0
+// Remove
+// removes the bytes at the offset from the buffer.
+func (p *Parser) Remove(Offset, Size int) {
+	if Offset < 0 || Size <= 0 || p.Length() < Offset+Size {
+		return
 	}
 
-	if p.Length() >= 4 {
-		if p.Length() == 4 {
-			copy(integer, p.buffer[:p.Length()])
-			p.buffer = []byte{}
-		} else {
-			copy(integer, p.buffer[:p.Length()-4])
-			p.buffer = p.buffer[4:]
-		}
+	p.buffer = append(p.buffer[:Offset:Offset], p.buffer[Offset+Size:]...)
+}
+
+func (p *Parser) ParseInt64() int64 {
+	var integer = p.read(8)
+
+	if integer == nil {
+		return 0
 	}
 
 	if p.bigEndian {
-		return int(binary.BigEndian.Uint32(integer)) != 0
+		return int64(binary.BigEndian.Uint64(integer))
 	} else {
-		return int(binary.LittleEndian.Uint32(integer)) != 0
+		return int64(binary.LittleEndian.Uint64(integer))
 	}
 }
 
+func (p *Parser) ParseBool() bool {
+	return p.ParseInt32() != 0
+}
+
 func (p *Parser) ParsePointer() int64 {
 	return p.ParseInt64()
 }
@@ -165,19 +167,52 @@ func (p *Parser) ParseBytes() []byte {
 	if p.Length() >= 4 {
 		BytesSize := uint(p.ParseInt32())
 		if BytesSize > uint(p.Length()) {
+			p.fail(ErrTruncated)
 			bytesBuffer, p.buffer = p.buffer[:p.Length()], p.buffer[p.Length():]
 		} else {
 			bytesBuffer, p.buffer = p.buffer[:BytesSize], p.buffer[BytesSize:]
 		}
+	} else {
+		p.fail(ErrTruncated)
 	}
 
 	return bytesBuffer
 }
 
+// ParseBytesMax
+// parses a size prefixed buffer of at most Max bytes. A bigger or
+// truncated buffer is skipped and returns nil.
+func (p *Parser) ParseBytesMax(Max int) []byte {
+	var Size = p.PeekInt32(0)
+
+	if p.Length() < 4 {
+		p.fail(ErrTruncated)
+		return nil
+	}
+
+	if uint(Size) > uint(Max) {
+		p.fail(ErrTooLarge)
+		p.ParseBytes()
+		return nil
+	}
+
+	if Size > p.Length()-4 {
+		p.ParseBytes()
+		return nil
+	}
+
+	return p.ParseBytes()
+}
+
 func (p *Parser) ParseAtLeastBytes(NumberOfBytes int) []byte {
 	var bytesBuffer []byte
 
+	if NumberOfBytes < 0 {
+		NumberOfBytes = 0
+	}
+
 	if NumberOfBytes > p.Length() {
+		p.fail(ErrTruncated)
 		bytesBuffer, p.buffer = p.buffer[:len(p.buffer)], p.buffer[len(p.buffer):]
 	} else {
 		bytesBuffer, p.buffer = p.buffer[:NumberOfBytes], p.buffer[NumberOfBytes:]
@@ -194,6 +229,18 @@ func (p *Parser) ParseString() string {
 	return common.StripNull(string(p.ParseBytes()))
 }
 
+// ParseStringMax
+// parses a string of at most MaxStringSize bytes.
+func (p *Parser) ParseStringMax() string {
+	return common.StripNull(string(p.ParseBytesMax(MaxStringSize)))
+}
+
+// ParseUTF16StringMax
+// parses an utf16 string of at most MaxStringSize bytes.
+func (p *Parser) ParseUTF16StringMax() string {
+	return common.StripNull(common.DecodeUTF16(p.ParseBytesMax(MaxStringSize)))
+}
+
 func (p *Parser) Length() int {
 	return len(p.buffer)
 }
@@ -202,6 +249,53 @@ func (p *Parser) Buffer() []byte {
 	return p.buffer
 }
 
+// Err
+// returns the first error a read ran into. Reads after an error
+// still return zero values and never panic.
+func (p *Parser) Err() error {
+	return p.err
+}
+
 func (p *Parser) DecryptBuffer(AESKey []byte, AESIv []byte) {
+	if len(AESKey) != 32 || len(AESIv) != aes.BlockSize {
+		p.fail(ErrInvalidKey)
+		p.buffer = []byte{}
+		return
+	}
+
 	p.buffer = crypt.XCryptBytesAES256(p.buffer, AESKey, AESIv)
 }
+
+// DecryptStream
+// decrypts the buffer with the stream of a session (see keyring.Session).
+func (p *Parser) DecryptStream(Stream cipher.Stream) {
+	var Buffer = make([]byte, len(p.buffer))
+
+	Stream.XORKeyStream(Buffer, p.buffer)
+
+	p.buffer = Buffer
+}
+
+// fail
+// keeps the first error of the parser.
+func (p *Parser) fail(err error) {
+	if p.err == nil {
+		p.err = err
+	}
+}
+
+// read
+// consumes Size bytes of the buffer. Returns nil and consumes
+// nothing if the buffer is too short.
+func (p *Parser) read(Size int) []byte {
+	var bytesBuffer []byte
+
+	if p.Length() < Size {
+		p.fail(ErrTruncated)
+		return nil
+	}
+
+	bytesBuffer, p.buffer = p.buffer[:Size], p.buffer[Size:]
+
+	return bytesBuffer
+}
@@ -0,0 +1,140 @@
+package parser
+
+import (
+	"encoding/binary"
+	"testing"
+)
+
+// FuzzParser
+// runs the reads the first bytes select against the rest of the input.
+// No read is allowed to panic or to grow the buffer.
+func FuzzParser(f *testing.F) {
+	f.Add([]byte{0, 1, 2, 3}, []byte{0, 0, 0, 4, 'a', 'b', 'c', 'd'}, true)
+	f.Add([]byte{2, 2, 2}, []byte{0xff, 0xff, 0xff, 0xff, 'a'}, true)
+	f.Add([]byte{5, 6, 7}, []byte{3, 0, 0, 0, 'a', 0, 'b'}, false)
+	f.Add([]byte{1, 4, 0}, []byte{1, 2, 3, 4, 5, 6, 7}, false)
+
+	f.Fuzz(func(t *testing.T, Reads []byte, Data []byte, BigEndian bool) {
+		var Parser = NewParser(Data)
+
+		Parser.SetBigEndian(BigEndian)
+
+		for _, Read := range Reads {
+			var Length = Parser.Length()
+
+			switch Read % 9 {
+			case 0:
+				Parser.ParseInt32()
+			case 1:
+				Parser.ParseInt64()
+			case 2:
+				Parser.ParseBytes()
+			case 3:
+				Parser.ParseBool()
+			case 4:
+				Parser.ParseAtLeastBytes(int(Read) - 0x80)
+			case 5:
+				Parser.ParseUTF16String()
+			case 6:
+				Parser.ParseStringMax()
+			case 7:
+				Parser.ParseUTF16StringMax()
+			case 8:
+				Parser.PeekInt32(int(Read) % 16)
+				Parser.Remove(int(Read)%8, int(Read)%5)
+			}
+
+			if Parser.Length() > Length {
+				t.Fatalf("read %v grew the buffer from %v to %v bytes", Read%9, Length, Parser.Length())
+			}
+		}
+	})
+}
+
+// FuzzCanIRead
+// checks that the reads CanIRead allows never run past the buffer.
+func FuzzCanIRead(f *testing.F) {
+	f.Add([]byte{0, 2, 1}, []byte{0, 0, 0, 1, 0, 0, 0, 1, 'a', 0, 0, 0, 0, 0, 0, 0, 0})
+	f.Add([]byte{2}, []byte{0x80, 0, 0, 0})
+	f.Add([]byte{3, 4}, []byte{0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0})
+
+	f.Fuzz(func(t *testing.T, Types []byte, Data []byte) {
+		var (
+			Parser    = NewParser(Data)
+			ReadTypes = make([]ReadType, len(Types))
+		)
+
+		for i := range Types {
+			ReadTypes[i] = ReadType(Types[i] % 5)
+		}
+
+		if !Parser.CanIRead(ReadTypes) {
+			return
+		}
+
+		for _, Type := range ReadTypes {
+			switch Type {
+			case ReadInt32:
+				Parser.ParseInt32()
+			case ReadInt64:
+				Parser.ParseInt64()
+			case ReadBytes:
+				Parser.ParseBytes()
+			case ReadPointer:
+				Parser.ParsePointer()
+			case ReadBool:
+				Parser.ParseBool()
+			}
+		}
+
+		if err := Parser.Err(); err != nil {
+			t.Fatalf("CanIRead allowed %v but reading failed: %v", ReadTypes, err)
+		}
+	})
+}
+
+func TestParseBytesMax(t *testing.T) {
+	var Data = make([]byte, 4, 8)
+
+	binary.BigEndian.PutUint32(Data, MaxStringSize+1)
+
+	var Parser = NewParser(append(Data, 'a', 'b', 'c', 'd'))
+
+	if Parser.ParseBytesMax(MaxStringSize) != nil {
+		t.Fatal("ParseBytesMax returned a buffer bigger than the limit")
+	}
+
+	if Parser.Err() != ErrTooLarge {
+		t.Fatalf("expected %v, got %v", ErrTooLarge, Parser.Err())
+	}
+
+	if Parser.Length() != 0 {
+		t.Fatalf("expected the oversized buffer to be skipped, %v bytes left", Parser.Length())
+	}
+}
+
+func TestParseInt32Short(t *testing.T) {
+	var Parser = NewParser([]byte{0, 0, 0, 1, 0xff, 0xff})
+
+	if Value := Parser.ParseInt32(); Value != 1 {
+		t.Fatalf("expected 1, got %v", Value)
+	}
+
+	if Value := Parser.ParseInt32(); Value != 0 || Parser.Length() != 2 {
+		t.Fatalf("expected a short read to return 0 and consume nothing, got %v with %v bytes left", Value, Parser.Length())
+	}
+
+	if Parser.Err() != ErrTruncated {
+		t.Fatalf("expected %v, got %v", ErrTruncated, Parser.Err())
+	}
+}
+
+func TestDecryptBufferInvalidKey(t *testing.T) {
+	var Parser = NewParser([]byte{1, 2, 3, 4})
+
+	Parser.DecryptBuffer(make([]byte, 32), make([]byte, 3))
+
+	if Parser.Err() != ErrInvalidKey || Parser.Length() != 0 {
+		t.Fatalf("expected the buffer to be dropped with %v, got %v", ErrInvalidKey, Parser.Err())
+	}
+}
@@ -0,0 +1,60 @@
+package common
+
+import (
+	"io"
+	"os"
+	"sync"
+)
+
+// size of the buffers used to stream files between sockets and disk
+const TRANSFER_BUFFER_SIZE = 0x40000
+
+var transferBuffers = sync.Pool{
+	New: func() any {
+		var Buffer = make([]byte, TRANSFER_BUFFER_SIZE)
+		return &Buffer
+	},
+}
+
+// StreamCopy
+// copies from Src to Dst using a pooled buffer. If Src is a file and Dst
+// a socket (or the other way around) io.CopyBuffer lets the kernel copy
+// the data (sendfile/splice) and the buffer doesn't even get used.
+func StreamCopy(Dst io.Writer, Src io.Reader) (int64, error) {
+	var Buffer = transferBuffers.Get().(*[]byte)
+	defer transferBuffers.Put(Buffer)
+
+	return io.CopyBuffer(Dst, Src, *Buffer)
+}
+
+// MoveFile
+// moves the file from Src to Dst. Falls back to streaming the file if
+// both aren't on the same filesystem.
+func MoveFile(Src, Dst string) error {
+	if err := os.Rename(Src, Dst); err == nil {
+		return nil
+	}
+
+	In, err := os.Open(Src)
+	if err != nil {
+		return err
+	}
+	defer In.Close()
+
+	Out, err := os.Create(Dst)
+	if err != nil {
+		return err
+	}
+
+	if _, err = StreamCopy(Out, In); err != nil {
+		Out.Close()
+		os.Remove(Dst)
+		return err
+	}
+
+	if err = Out.Close(); err != nil {
+		return err
+	}
+
+	return os.Remove(Src)
+}
@@ -98,17 +98,19 @@ func Bmp2Png(BmpBytes []byte) []byte {
 
 func DecodeUTF16(b []byte) string {
 	var (
-		u16s  = make([]uint16, 1)
+		u16s  = make([]uint16, len(b)/2)
 		b8buf = make([]byte, 4)
 		ret   = &bytes.Buffer{}
 	)
 
-	lb := len(b)
+	/* a trailing odd byte isn't a complete code unit */
+	for i := range u16s {
+		u16s[i] = uint16(b[i*2]) + (uint16(b[i*2+1]) << 8)
+	}
 
-	for i := 0; i < lb; i += 2 {
-		u16s[0] = uint16(b[i]) + (uint16(b[i+1]) << 8)
-		r := utf16.Decode(u16s)
-		n := utf8.EncodeRune(b8buf, r[0])
+	/* decoded at once so surrogate pairs (CJK extensions, emoji) stay one rune */
+	for _, r := range utf16.Decode(u16s) {
+		n := utf8.EncodeRune(b8buf, r)
 		ret.Write(b8buf[:n])
 	}
 
@@ -219,6 +221,21 @@ func EpochTimeToSystemTime( EpochTime int64 ) int64 {
 	return ( EpochTime * TICKS_PER_SECOND ) + UNIX_TIME_START
 }
 
+// SystemTimeToEpoch
+// converts the file time of the agents (kill date) back to a unix epoch.
+func SystemTimeToEpoch( SystemTime int64 ) int64 {
+	var (
+		UNIX_TIME_START  int64 = 0x019DB1DED53E8000 //January 1, 1970 (start of Unix epoch) in "ticks"
+		TICKS_PER_SECOND int64 = 10000000 //a tick is 100ns
+	)
+
+	if (SystemTime == 0) {
+		return 0
+	}
+
+	return ( SystemTime - UNIX_TIME_START ) / TICKS_PER_SECOND
+}
+
 func GetRandomChar(dict string) string {
     return string(dict[rand.Intn(len(dict))])
 }
@@ -0,0 +1,762 @@
+// Package console
+// is a terminal operator client for operators working over ssh where the
+// graphical client isn't practical. It talks to the teamserver with the
+// sdk, like any other operator client.
+package console
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"Havoc/pkg/colors"
+	"Havoc/pkg/packager"
+	"Havoc/pkg/sdk"
+)
+
+// how long the teamserver has to stay quiet after the login before the
+// replay of its state counts as done
+const REPLAY_SETTLE = 500 * time.Millisecond
+
+// Config
+// the teamserver to connect to and the terminal to run on.
+type Config struct {
+	sdk.Config
+
+	Input  io.Reader
+	Output io.Writer
+}
+
+type console struct {
+	Config Config
+	Client *sdk.Client
+
+	mutex     sync.Mutex
+	agent     string
+	live      bool
+	last      time.Time
+	tasks     map[string]bool
+	downloads map[string]string
+}
+
+type command struct {
+	Name  string
+	Usage string
+	Help  string
+
+	// only available while interacting with an agent
+	Agent bool
+
+	Run func(c *console, Args []string, Line string) error
+}
+
+var commands []command
+
+func init() {
+	commands = []command{
+		{Name: "help", Help: "show the commands", Run: (*console).help},
+		{Name: "agents", Help: "list the agents", Run: (*console).agents},
+		{Name: "use", Usage: "<agent>", Help: "interact with the agent", Run: (*console).use},
+		{Name: "chat", Usage: "<message>", Help: "send a message to the chat of the operators", Run: (*console).chat},
+		{Name: "notify", Usage: "[mute|unmute|digest|quiet|groups] ...", Help: "show or change what you get notified of (notify help)", Run: (*console).notify},
+		{Name: "quit", Help: "log out of the teamserver", Run: nil},
+
+		{Name: "back", Help: "stop interacting with the agent", Agent: true, Run: (*console).back},
+		{Name: "info", Help: "show the metadata of the agent", Agent: true, Run: (*console).info},
+		{Name: "shell", Usage: "<command>", Help: "run the command with cmd.exe", Agent: true, Run: (*console).shell},
+		{Name: "sleep", Usage: "<delay> [jitter]", Help: "change the sleep (seconds) and jitter (percent)", Agent: true, Run: (*console).sleep},
+		{Name: "checkin", Help: "ask the agent for its metadata again", Agent: true, Run: (*console).checkin},
+		{Name: "download", Usage: "<remote> [local]", Help: "download the file (into the current directory by default)", Agent: true, Run: (*console).download},
+		{Name: "upload", Usage: "<local> <remote>", Help: "upload the file", Agent: true, Run: (*console).upload},
+		{Name: "exit", Usage: "[thread|process]", Help: "tell the agent to exit", Agent: true, Run: (*console).exit},
+	}
+}
+
+// Run
+// logs into the teamserver and reads the commands of the operator till
+// quit, the end of the input or till the connection drops.
+func Run(Config Config) error {
+	var c = &console{
+		Config:    Config,
+		Client:    sdk.New(Config.Config),
+		tasks:     make(map[string]bool),
+		downloads: make(map[string]string),
+	}
+
+	if c.Config.Input == nil {
+		c.Config.Input = os.Stdin
+	}
+
+	if c.Config.Output == nil {
+		c.Config.Output = os.Stdout
+	}
+
+	c.Client.Subscribe(0, func(packager.Package) {
+		c.mutex.Lock()
+		c.last = time.Now()
+		c.mutex.Unlock()
+	})
+
+	c.Client.OnAgent(c.onAgent)
+	c.Client.OnOutput(c.onOutput)
+	c.Client.OnFile(c.onFile)
+	c.Client.OnChat(c.onChat)
+	c.Client.OnAlert(c.onAlert)
+	c.Client.OnDigest(c.onDigest)
+	c.Client.Subscribe(packager.Type.Chat.Type, c.onOperator)
+	c.Client.Subscribe(packager.Type.Session.Type, c.onDead)
+
+	if err := c.Client.Connect(); err != nil {
+		return err
+	}
+	defer c.Client.Close()
+
+	c.settle()
+
+	c.print("%v connected to %v as %v (%v)", colors.Green("[+]"), Config.Address, c.Client.Config.User, c.Client.Role)
+	c.print("%v %v agents. type help for the commands", colors.Blue("[*]"), len(c.Client.Agents()))
+
+	var Lines = make(chan string)
+
+	go func() {
+		var Scanner = bufio.NewScanner(c.Config.Input)
+
+		Scanner.Buffer(make([]byte, 0x10000), 0x100000)
+
+		for Scanner.Scan() {
+			Lines <- Scanner.Text()
+		}
+
+		close(Lines)
+	}()
+
+	for {
+		c.prompt()
+
+		select {
+		case Line, ok := <-Lines:
+			if !ok {
+				return nil
+			}
+
+			if quit := c.execute(Line); quit {
+				return nil
+			}
+
+		case <-c.Client.Done():
+			return c.Client.Wait()
+		}
+	}
+}
+
+// settle
+// waits till the teamserver replayed its state so the console doesn't
+// print the agents and outputs of before as new.
+func (c *console) settle() {
+	var Deadline = time.Now().Add(c.Client.Config.Timeout)
+
+	for time.Now().Before(Deadline) {
+		time.Sleep(REPLAY_SETTLE / 5)
+
+		c.mutex.Lock()
+		var Quiet = time.Since(c.last) > REPLAY_SETTLE
+		c.mutex.Unlock()
+
+		if Quiet {
+			break
+		}
+	}
+
+	c.mutex.Lock()
+	c.live = true
+	c.mutex.Unlock()
+}
+
+// execute
+// runs a line of the operator. Returns true to quit.
+func (c *console) execute(Line string) bool {
+	var Args = split(Line)
+
+	if len(Args) == 0 {
+		return false
+	}
+
+	if Args[0] == "quit" {
+		return true
+	}
+
+	c.mutex.Lock()
+	var Agent = c.agent
+	c.mutex.Unlock()
+
+	for _, Command := range commands {
+		if Command.Name != Args[0] {
+			continue
+		}
+
+		if Command.Agent && len(Agent) == 0 {
+			c.print("%v %v needs an agent. interact with one first (use <agent>)", colors.Red("[-]"), Args[0])
+			return false
+		}
+
+		var Rest = strings.TrimSpace(strings.TrimPrefix(strings.TrimSpace(Line), Args[0]))
+
+		if err := Command.Run(c, Args[1:], Rest); err != nil {
+			c.print("%v %v", colors.Red("[-]"), err)
+		}
+
+		return false
+	}
+
+	c.print("%v unknown command %v. type help for the commands", colors.Red("[-]"), Args[0])
+
+	return false
+}
+
+// print
+// writes a line above the prompt.
+func (c *console) print(Format string, Args ...any) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	fmt.Fprintf(c.Config.Output, "\r"+Format+"\n", Args...)
+}
+
+// event
+// prints an event of the teamserver and draws the prompt again.
+func (c *console) event(Format string, Args ...any) {
+	c.print(Format, Args...)
+	c.prompt()
+}
+
+func (c *console) prompt() {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	if len(c.agent) > 0 {
+		fmt.Fprintf(c.Config.Output, "havoc [%v] > ", colors.Red(c.agent))
+	} else {
+		fmt.Fprint(c.Config.Output, "havoc > ")
+	}
+}
+
+func (c *console) isLive() bool {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	return c.live
+}
+
+func (c *console) onAgent(Agent sdk.Agent) {
+	if c.isLive() {
+		c.event("%v new agent %v %v\\%v @ %v (%v)", colors.Green("[+]"), colors.Red(Agent.ID), Agent.DomainName, Agent.Username, Agent.Hostname, Agent.InternalIP)
+	}
+}
+
+func (c *console) onDead(Package packager.Package) {
+	if Package.Body.SubEvent != packager.Type.Session.MarkAsDead || !c.isLive() {
+		return
+	}
+
+	if Package.Body.Info["Marked"] == "Dead" {
+		c.event("%v agent %v is dead", colors.Red("[-]"), Package.Body.Info["AgentID"])
+	}
+}
+
+func (c *console) onOutput(Output sdk.Output) {
+	c.mutex.Lock()
+	var Shown = c.live && (c.tasks[Output.TaskID] || Output.AgentID == c.agent)
+	c.mutex.Unlock()
+
+	if !Shown || (len(Output.Message) == 0 && len(Output.Output) == 0) {
+		return
+	}
+
+	var Prefix = colors.Blue("[*]")
+
+	switch Output.Type {
+	case "Good":
+		Prefix = colors.Green("[+]")
+	case "Error":
+		Prefix = colors.Red("[-]")
+	case "Warning":
+		Prefix = colors.Yellow("[!]")
+	}
+
+	var Text = fmt.Sprintf("%v [%v] %v", Prefix, Output.AgentID, Output.Message)
+
+	if len(Output.Output) > 0 {
+		Text += "\n" + strings.TrimRight(Output.Output, "\n")
+	}
+
+	c.event("%v", Text)
+}
+
+func (c *console) onFile(File sdk.File) {
+	c.mutex.Lock()
+	var Local, ok = c.downloads[File.TaskID]
+	delete(c.downloads, File.TaskID)
+	c.mutex.Unlock()
+
+	if !ok {
+		return
+	}
+
+	if len(Local) == 0 {
+		Local = filepath.Base(strings.ReplaceAll(File.Name, `\`, "/"))
+	}
+
+	if File.Data != nil {
+		if err := os.WriteFile(Local, File.Data, 0600); err != nil {
+			c.event("%v failed to save %v: %v", colors.Red("[-]"), File.Name, err)
+			return
+		}
+
+		c.event("%v saved %v to %v", colors.Green("[+]"), File.Name, Local)
+		return
+	}
+
+	/* too big to be sent inline. stays on the teamserver till fetched */
+	go func() {
+		var err = c.fetch(File.Transfer, Local)
+
+		if err != nil {
+			c.event("%v failed to fetch %v: %v", colors.Red("[-]"), File.Name, err)
+			return
+		}
+
+		c.event("%v saved %v to %v", colors.Green("[+]"), File.Name, Local)
+	}()
+}
+
+func (c *console) fetch(Transfer, Local string) error {
+	Writer, err := os.OpenFile(Local, os.O_CREATE|os.O_WRONLY|os.O_TRUNC, 0600)
+	if err != nil {
+		return err
+	}
+
+	if err = c.Client.Fetch(context.Background(), Transfer, 0, Writer); err != nil {
+		Writer.Close()
+		return err
+	}
+
+	return Writer.Close()
+}
+
+func (c *console) onChat(Message sdk.Message) {
+	if c.isLive() {
+		c.event("%v %v: %v", colors.Yellow("[chat]"), colors.BoldWhite(Message.User), Message.Text)
+	}
+}
+
+func (c *console) onOperator(Package packager.Package) {
+	if !c.isLive() {
+		return
+	}
+
+	switch Package.Body.SubEvent {
+	case packager.Type.Chat.NewUser:
+		c.event("%v %v connected to the teamserver", colors.Green("[+]"), Package.Body.Info["User"])
+
+	case packager.Type.Chat.UserDisconnected:
+		c.event("%v %v disconnected from the teamserver", colors.Red("[-]"), Package.Body.Info["User"])
+	}
+}
+
+func (c *console) onAlert(Alert sdk.Alert) {
+	var Prefix = colors.Yellow("[alert]")
+
+	if Alert.Critical {
+		Prefix = colors.BoldRed("[ALERT]")
+	}
+
+	c.event("%v %v", Prefix, Alert.Summary)
+}
+
+func (c *console) onDigest(Alerts []sdk.Alert, Dropped int) {
+	var Lines = []string{fmt.Sprintf("%v %v notifications held back", colors.Yellow("[digest]"), len(Alerts)+Dropped)}
+
+	for _, Alert := range Alerts {
+		Lines = append(Lines, fmt.Sprintf("  %v %v", Alert.Time, Alert.Summary))
+	}
+
+	if Dropped > 0 {
+		Lines = append(Lines, fmt.Sprintf("  ... and %v older ones", Dropped))
+	}
+
+	c.event("%v", strings.Join(Lines, "\n"))
+}
+
+func (c *console) help(Args []string, Line string) error {
+	c.mutex.Lock()
+	var Agent = c.agent
+	c.mutex.Unlock()
+
+	for _, Command := range commands {
+		if Command.Agent && len(Agent) == 0 {
+			continue
+		}
+
+		c.print("  %-28v %v", strings.TrimSpace(Command.Name+" "+Command.Usage), Command.Help)
+	}
+
+	return nil
+}
+
+func (c *console) agents(Args []string, Line string) error {
+	var Agents = c.Client.Agents()
+
+	if len(Agents) == 0 {
+		c.print("%v no agents", colors.Blue("[*]"))
+		return nil
+	}
+
+	sort.Slice(Agents, func(i, j int) bool {
+		return Agents[i].FirstCallIn < Agents[j].FirstCallIn
+	})
+
+	c.print("  %-10v %-28v %-16v %-22v %-8v %v", "ID", "USER", "HOST", "PROCESS", "STATUS", "LAST")
+
+	for _, Agent := range Agents {
+		var (
+			User    = Agent.DomainName + `\` + Agent.Username
+			Process = Agent.ProcessName + " (" + Agent.ProcessPID + ")"
+			Status  = "alive"
+		)
+
+		if Agent.Elevated == "true" {
+			User += " *"
+		}
+
+		if !Agent.Active {
+			Status = "dead"
+		}
+
+		c.print("  %-10v %-28v %-16v %-22v %-8v %v", Agent.ID, User, Agent.Hostname, Process, Status, Agent.LastCallIn)
+	}
+
+	return nil
+}
+
+func (c *console) use(Args []string, Line string) error {
+	if len(Args) != 1 {
+		return errors.New("usage: use <agent>")
+	}
+
+	Agent, ok := c.Client.Agent(Args[0])
+	if !ok {
+		return fmt.Errorf("agent %v not found", Args[0])
+	}
+
+	c.mutex.Lock()
+	c.agent = Agent.ID
+	c.mutex.Unlock()
+
+	return nil
+}
+
+func (c *console) back(Args []string, Line string) error {
+	c.mutex.Lock()
+	c.agent = ""
+	c.mutex.Unlock()
+
+	return nil
+}
+
+func (c *console) chat(Args []string, Line string) error {
+	if len(Line) == 0 {
+		return errors.New("usage: chat <message>")
+	}
+
+	return c.Client.Chat(Line)
+}
+
+func (c *console) notify(Args []string, Line string) error {
+	var ctx, cancel = context.WithTimeout(context.Background(), c.Client.Config.Timeout)
+	defer cancel()
+
+	Preferences, err := c.Client.NotifyPreferences(ctx)
+	if err != nil {
+		return err
+	}
+
+	if len(Args) > 0 {
+		switch {
+
+		case Args[0] == "mute" && len(Args) == 2:
+			Preferences.Muted = append(Preferences.Muted, Args[1])
+
+		case Args[0] == "unmute" && len(Args) == 2:
+			var Muted = []string{}
+
+			for _, Type := range Preferences.Muted {
+				if Type != Args[1] {
+					Muted = append(Muted, Type)
+				}
+			}
+
+			Preferences.Muted = Muted
+
+		case Args[0] == "digest" && len(Args) == 2:
+			Preferences.Digest = strings.TrimPrefix(Args[1], "off")
+
+		case Args[0] == "quiet" && (len(Args) == 2 || len(Args) == 3):
+			Preferences.QuietHours, Preferences.TimeZone = strings.TrimPrefix(Args[1], "off"), ""
+
+			if len(Args) == 3 {
+				Preferences.TimeZone = Args[2]
+			}
+
+		case Args[0] == "groups" && len(Args) == 2:
+			Preferences.Groups = []string{}
+
+			if Args[1] != "off" {
+				Preferences.Groups = strings.Split(Args[1], ",")
+			}
+
+		default:
+			c.print("  notify                                    show what you get notified of")
+			c.print("  notify mute|unmute <event>                (un)mute an event (session.new, task.complete, loot.added, credential.found)")
+			c.print("  notify digest <interval|off>              hold notifications back and get them every interval (eg: 1h)")
+			c.print("  notify quiet <hh:mm-hh:mm|off> [zone]     hold notifications back during the hours (eg: 22:00-07:00 Europe/Berlin)")
+			c.print("  notify groups <group,...|off>             only get notified of the agents of the agent groups")
+			c.print("  listener.down and killdate.imminent are critical and always notified right away")
+			return nil
+
+		}
+
+		if Preferences, err = c.Client.SetNotifyPreferences(ctx, Preferences); err != nil {
+			return err
+		}
+	}
+
+	for _, Field := range [][2]string{
+		{"Muted", strings.Join(Preferences.Muted, ", ")},
+		{"Digest", Preferences.Digest},
+		{"Quiet hours", strings.TrimSpace(Preferences.QuietHours + " " + Preferences.TimeZone)},
+		{"Groups", strings.Join(Preferences.Groups, ", ")},
+	} {
+		if len(Field[1]) == 0 {
+			Field[1] = "none"
+		}
+
+		c.print("  %-14v %v", Field[0], Field[1])
+	}
+
+	return nil
+}
+
+func (c *console) current() (sdk.Agent, error) {
+	c.mutex.Lock()
+	var ID = c.agent
+	c.mutex.Unlock()
+
+	Agent, ok := c.Client.Agent(ID)
+	if !ok {
+		return Agent, fmt.Errorf("agent %v is gone", ID)
+	}
+
+	return Agent, nil
+}
+
+// tasked
+// keeps the task so its outputs get printed after the operator switched
+// to another agent.
+func (c *console) tasked(TaskID string, err error) error {
+	if err != nil {
+		return err
+	}
+
+	c.mutex.Lock()
+	c.tasks[TaskID] = true
+	c.mutex.Unlock()
+
+	c.print("%v tasked agent [%v]", colors.Blue("[*]"), TaskID)
+
+	return nil
+}
+
+func (c *console) info(Args []string, Line string) error {
+	Agent, err := c.current()
+	if err != nil {
+		return err
+	}
+
+	for _, Field := range [][2]string{
+		{"Hostname", Agent.Hostname},
+		{"User", Agent.DomainName + `\` + Agent.Username},
+		{"Elevated", Agent.Elevated},
+		{"Internal IP", Agent.InternalIP},
+		{"External IP", Agent.ExternalIP},
+		{"Process", Agent.ProcessName + " (" + Agent.ProcessPID + ", " + Agent.ProcessArch + ")"},
+		{"OS", Agent.OSVersion},
+		{"Sleep", fmt.Sprintf("%vs (%v%% jitter)", Agent.SleepDelay, Agent.SleepJitter)},
+		{"First call in", Agent.FirstCallIn},
+		{"Last call in", Agent.LastCallIn},
+	} {
+		c.print("  %-14v %v", Field[0], Field[1])
+	}
+
+	return nil
+}
+
+func (c *console) shell(Args []string, Line string) error {
+	if len(Line) == 0 {
+		return errors.New("usage: shell <command>")
+	}
+
+	Agent, err := c.current()
+	if err != nil {
+		return err
+	}
+
+	return c.tasked(c.Client.Shell(Agent.ID, Line))
+}
+
+func (c *console) sleep(Args []string, Line string) error {
+	var (
+		Delay, Jitter int
+		err           error
+	)
+
+	if len(Args) == 0 || len(Args) > 2 {
+		return errors.New("usage: sleep <delay> [jitter]")
+	}
+
+	if Delay, err = strconv.Atoi(Args[0]); err != nil || Delay < 0 {
+		return fmt.Errorf("invalid delay %v", Args[0])
+	}
+
+	if len(Args) == 2 {
+		if Jitter, err = strconv.Atoi(Args[1]); err != nil || Jitter < 0 || Jitter > 100 {
+			return fmt.Errorf("invalid jitter %v", Args[1])
+		}
+	}
+
+	Agent, err := c.current()
+	if err != nil {
+		return err
+	}
+
+	return c.tasked(c.Client.Sleep(Agent.ID, Delay, Jitter))
+}
+
+func (c *console) checkin(Args []string, Line string) error {
+	Agent, err := c.current()
+	if err != nil {
+		return err
+	}
+
+	return c.tasked(c.Client.Checkin(Agent.ID))
+}
+
+func (c *console) download(Args []string, Line string) error {
+	var Local string
+
+	if len(Args) == 0 || len(Args) > 2 {
+		return errors.New("usage: download <remote> [local]")
+	}
+
+	if len(Args) == 2 {
+		Local = Args[1]
+	}
+
+	Agent, err := c.current()
+	if err != nil {
+		return err
+	}
+
+	TaskID, err := c.Client.Download(Agent.ID, Args[0])
+	if err != nil {
+		return err
+	}
+
+	c.mutex.Lock()
+	c.downloads[TaskID] = Local
+	c.mutex.Unlock()
+
+	return c.tasked(TaskID, nil)
+}
+
+func (c *console) upload(Args []string, Line string) error {
+	if len(Args) != 2 {
+		return errors.New("usage: upload <local> <remote>")
+	}
+
+	Content, err := os.ReadFile(Args[0])
+	if err != nil {
+		return err
+	}
+
+	Agent, err := c.current()
+	if err != nil {
+		return err
+	}
+
+	return c.tasked(c.Client.Upload(Agent.ID, Args[1], Content))
+}
+
+func (c *console) exit(Args []string, Line string) error {
+	var Process bool
+
+	switch {
+	case len(Args) == 0 || (len(Args) == 1 && Args[0] == "thread"):
+	case len(Args) == 1 && Args[0] == "process":
+		Process = true
+	default:
+		return errors.New("usage: exit [thread|process]")
+	}
+
+	Agent, err := c.current()
+	if err != nil {
+		return err
+	}
+
+	return c.tasked(c.Client.Exit(Agent.ID, Process))
+}
+
+// split
+// splits the line into its arguments. Double quotes keep spaces
+// (download "C:\Program Files\app.log").
+func split(Line string) []string {
+	var (
+		Args    []string
+		Arg     strings.Builder
+		Quoted  bool
+		Pending bool
+	)
+
+	for _, Rune := range Line {
+		switch {
+		case Rune == '"':
+			Quoted = !Quoted
+			Pending = true
+
+		case (Rune == ' ' || Rune == '\t') && !Quoted:
+			if Pending {
+				Args = append(Args, Arg.String())
+				Arg.Reset()
+				Pending = false
+			}
+
+		default:
+			Arg.WriteRune(Rune)
+			Pending = true
+		}
+	}
+
+	if Pending {
+		Args = append(Args, Arg.String())
+	}
+
+	return Args
+}
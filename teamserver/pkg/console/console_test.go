@@ -0,0 +1,21 @@
+package console
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestSplit(t *testing.T) {
+	for Line, Args := range map[string][]string{
+		"":                                  nil,
+		"  agents  ":                        {"agents"},
+		"sleep 5\t20":                       {"sleep", "5", "20"},
+		`download "C:\Program Files\a.log"`: {"download", `C:\Program Files\a.log`},
+		`upload a.txt "C:\dir name\"b.txt`:  {"upload", "a.txt", `C:\dir name\b.txt`},
+		`chat ""`:                           {"chat", ""},
+	} {
+		if Got := split(Line); !reflect.DeepEqual(Got, Args) {
+			t.Errorf("split(%q) = %q, want %q", Line, Got, Args)
+		}
+	}
+}
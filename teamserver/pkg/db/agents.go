@@ -7,8 +7,24 @@ import (
 	"encoding/base64"
 
 	"Havoc/pkg/agent"
+	"Havoc/pkg/keyring"
+	"Havoc/pkg/seal"
 )
 
+// agentKeys
+// the session key and iv of the agent as they are stored. Empty if the
+// session has none anymore (wiped once the agent died).
+func agentKeys(Agent *agent.Agent) (string, string) {
+	var AESKey, AESIv = Agent.Encryption.Keys()
+	defer keyring.Wipe(AESKey, AESIv)
+
+	if len(AESKey) == 0 {
+		return "", ""
+	}
+
+	return seal.SealString(base64.StdEncoding.EncodeToString(AESKey)), seal.SealString(base64.StdEncoding.EncodeToString(AESIv))
+}
+
 func (db *DB) AgentAdd(agent *agent.Agent) error {
 
 	var err error
@@ -36,6 +52,8 @@ func (db *DB) AgentAdd(agent *agent.Agent) error {
 
 	}
 
+	var AESKey, AESIv = agentKeys(agent)
+
 	/* prepare some arguments to execute for the sqlite db */
 	stmt, err := db.db.Prepare("INSERT INTO TS_Agents ( AgentID, Active, Reason, AESKey, AESIv, Hostname, Username, DomainName, ExternalIP, InternalIP, ProcessName, BaseAddress, ProcessPID, ProcessTID, ProcessPPID, ProcessArch, Elevated, OSVersion, OSArch, SleepDelay, SleepJitter, KillDate, WorkingHours, FirstCallIn, LastCallIn) values(?,?,?,?,?,?,?,?,?,?,?,?,?,?,?,?,?,?,?,?,?,?,?,?,?)")
 	if err != nil {
@@ -47,8 +65,8 @@ func (db *DB) AgentAdd(agent *agent.Agent) error {
 		int(AgentID),
 		1,
 		"",
-		base64.StdEncoding.EncodeToString(agent.Encryption.AESKey),
-		base64.StdEncoding.EncodeToString(agent.Encryption.AESIv),
+		AESKey,
+		AESIv,
 		agent.Info.Hostname,
 		agent.Info.Username,
 		agent.Info.DomainName,
@@ -94,8 +112,10 @@ func (db *DB) AgentUpdate(agent *agent.Agent) error {
 		return errors.New("Agent does not exist")
 	}
 
-	/* prepare some arguments to execute for the sqlite db */
-	stmt, err := db.db.Prepare("UPDATE TS_Agents SET Active = ?, Reason = ?, AESKey = ?, AESIv = ?, Hostname = ?, Username = ?, DomainName = ?, ExternalIP = ?, InternalIP = ?, ProcessName = ?, BaseAddress = ?, ProcessPID = ?, ProcessTID = ?, ProcessPPID = ?, ProcessArch = ?, Elevated = ?, OSVersion = ?, OSArch = ?, SleepDelay = ?, SleepJitter = ?, KillDate = ?, WorkingHours = ?, FirstCallIn = ?, LastCallIn = ? WHERE AgentID = ?")
+	var AESKey, AESIv = agentKeys(agent)
+
+	/* a session without key (dead) keeps the stored one. it can still come back */
+	stmt, err := db.db.Prepare("UPDATE TS_Agents SET Active = ?, Reason = ?, AESKey = COALESCE(NULLIF(?, ''), AESKey), AESIv = COALESCE(NULLIF(?, ''), AESIv), Hostname = ?, Username = ?, DomainName = ?, ExternalIP = ?, InternalIP = ?, ProcessName = ?, BaseAddress = ?, ProcessPID = ?, ProcessTID = ?, ProcessPPID = ?, ProcessArch = ?, Elevated = ?, OSVersion = ?, OSArch = ?, SleepDelay = ?, SleepJitter = ?, KillDate = ?, WorkingHours = ?, FirstCallIn = ?, LastCallIn = ? WHERE AgentID = ?")
 	if err != nil {
 		return err
 	}
@@ -110,8 +130,8 @@ func (db *DB) AgentUpdate(agent *agent.Agent) error {
 	_, err = stmt.Exec(
 		active,
 		agent.Reason,
-		base64.StdEncoding.EncodeToString(agent.Encryption.AESKey),
-		base64.StdEncoding.EncodeToString(agent.Encryption.AESIv),
+		AESKey,
+		AESIv,
 		agent.Info.Hostname,
 		agent.Info.Username,
 		agent.Info.DomainName,
@@ -209,10 +229,27 @@ func (db *DB) AgentRemove(AgentID int) error {
 
 
 func (db *DB) AgentAll() []*agent.Agent {
+	/* archived agents are only loaded once they get restored */
+	return db.agentQuery("WHERE Active = 1 AND AgentID NOT IN (SELECT AgentID FROM TS_AgentArchive)")
+}
+
+// AgentGet
+// returns the agent from the db regardless if it's alive or archived.
+func (db *DB) AgentGet(AgentID int) (*agent.Agent, error) {
+	var Agents = db.agentQuery("WHERE AgentID = ?", AgentID)
+
+	if len(Agents) == 0 {
+		return nil, errors.New("agent does not exist")
+	}
+
+	return Agents[0], nil
+}
+
+func (db *DB) agentQuery(Where string, Args ...any) []*agent.Agent {
 
 	var Agents []*agent.Agent
 
-	query, err := db.db.Query("SELECT AgentID, Active, Reason, AESKey, AESIv, Hostname, Username, DomainName, ExternalIP, InternalIP, ProcessName, BaseAddress, ProcessPID, ProcessTID, ProcessPPID, ProcessArch, Elevated, OSVersion, OSArch, SleepDelay, SleepJitter, KillDate, WorkingHours, FirstCallIn, LastCallIn FROM TS_Agents WHERE Active = 1")
+	query, err := db.db.Query("SELECT AgentID, Active, Reason, AESKey, AESIv, Hostname, Username, DomainName, ExternalIP, InternalIP, ProcessName, BaseAddress, ProcessPID, ProcessTID, ProcessPPID, ProcessArch, Elevated, OSVersion, OSArch, SleepDelay, SleepJitter, KillDate, WorkingHours, FirstCallIn, LastCallIn FROM TS_Agents "+Where, Args...)
 	if err != nil {
 		return nil
 	}
@@ -256,18 +293,15 @@ func (db *DB) AgentAll() []*agent.Agent {
 			return Agents
 		}
 
+		/* session keys are sealed at rest */
+		if err = unseal(&AESKey, &AESIv); err != nil {
+			continue
+		}
+
 		BytesAESKey, _ := base64.StdEncoding.DecodeString(AESKey)
 		BytesAESIv,  _ := base64.StdEncoding.DecodeString(AESIv)
 
 		var Agent = &agent.Agent{
-			Encryption: struct {
-				AESKey []byte
-				AESIv  []byte
-			}{
-				AESKey: BytesAESKey,
-				AESIv:  BytesAESIv,
-			},
-
 			Active:     Active == 1,
 			Reason:     Reason,
 			SessionDir: "",
@@ -275,6 +309,10 @@ func (db *DB) AgentAll() []*agent.Agent {
 			Info: new(agent.AgentInfo),
 		}
 
+		/* wrapped in memory, the clear copies go */
+		Agent.Encryption.Set(BytesAESKey, BytesAESIv)
+		keyring.Wipe(BytesAESKey, BytesAESIv)
+
 		Agent.NameID            = fmt.Sprintf("%08x", AgentID)
 		Agent.SessionDir        = ""
 		Agent.BackgroundCheck   = false
@@ -0,0 +1,77 @@
+package db
+
+type ArchivedAgent struct {
+	AgentID  int
+	User     string
+	Time     string
+	LootPath string
+}
+
+// AgentArchive
+// moves the agent into the archive. The agent stays inside of TS_Agents
+// so its transcripts, snapshots and loot keep pointing to it.
+func (db *DB) AgentArchive(AgentID int, User, Time, LootPath string) error {
+	stmt, err := db.db.Prepare("INSERT OR REPLACE INTO TS_AgentArchive (AgentID, User, Time, LootPath) values(?,?,?,?)")
+	if err != nil {
+		return err
+	}
+
+	_, err = stmt.Exec(AgentID, User, Time, LootPath)
+	if err != nil {
+		return err
+	}
+
+	stmt.Close()
+
+	return nil
+}
+
+// AgentUnarchive
+// removes the agent from the archive.
+func (db *DB) AgentUnarchive(AgentID int) error {
+	stmt, err := db.db.Prepare("DELETE FROM TS_AgentArchive WHERE AgentID = ?")
+	if err != nil {
+		return err
+	}
+
+	_, err = stmt.Exec(AgentID)
+	stmt.Close()
+
+	return err
+}
+
+// AgentArchived
+// returns the archive entry of the agent.
+func (db *DB) AgentArchived(AgentID int) (ArchivedAgent, bool) {
+	var Archived ArchivedAgent
+
+	err := db.db.QueryRow("SELECT AgentID, User, Time, LootPath FROM TS_AgentArchive WHERE AgentID = ?", AgentID).Scan(
+		&Archived.AgentID, &Archived.User, &Archived.Time, &Archived.LootPath,
+	)
+
+	return Archived, err == nil
+}
+
+// AgentsArchived
+// returns every archived agent.
+func (db *DB) AgentsArchived() []ArchivedAgent {
+	var Archived []ArchivedAgent
+
+	query, err := db.db.Query("SELECT AgentID, User, Time, LootPath FROM TS_AgentArchive ORDER BY rowid")
+	if err != nil {
+		return nil
+	}
+	defer query.Close()
+
+	for query.Next() {
+		var Agent ArchivedAgent
+
+		if err = query.Scan(&Agent.AgentID, &Agent.User, &Agent.Time, &Agent.LootPath); err != nil {
+			continue
+		}
+
+		Archived = append(Archived, Agent)
+	}
+
+	return Archived
+}
@@ -0,0 +1,71 @@
+package db
+
+type BlockRule struct {
+	Name    string
+	Command string
+	Pattern string
+	Reason  string
+	User    string
+	Time    string
+}
+
+// BlockRuleSet
+// adds or replaces the named rule of the command blocklist.
+func (db *DB) BlockRuleSet(Rule BlockRule) error {
+	stmt, err := db.db.Prepare("INSERT OR REPLACE INTO TS_Blocklist (Name, Command, Pattern, Reason, User, Time) values(?,?,?,?,?,?)")
+	if err != nil {
+		return err
+	}
+
+	_, err = stmt.Exec(Rule.Name, Rule.Command, Rule.Pattern, Rule.Reason, Rule.User, Rule.Time)
+	if err != nil {
+		return err
+	}
+
+	stmt.Close()
+
+	return nil
+}
+
+// BlockRuleRemove
+// removes the named rule of the command blocklist.
+func (db *DB) BlockRuleRemove(Name string) (bool, error) {
+	stmt, err := db.db.Prepare("DELETE FROM TS_Blocklist WHERE Name = ?")
+	if err != nil {
+		return false, err
+	}
+	defer stmt.Close()
+
+	Result, err := stmt.Exec(Name)
+	if err != nil {
+		return false, err
+	}
+
+	Rows, err := Result.RowsAffected()
+
+	return Rows > 0, err
+}
+
+// BlockRules
+// returns every rule of the command blocklist ordered by name.
+func (db *DB) BlockRules() []BlockRule {
+	var Rules []BlockRule
+
+	query, err := db.db.Query("SELECT Name, Command, Pattern, Reason, User, Time FROM TS_Blocklist ORDER BY Name")
+	if err != nil {
+		return nil
+	}
+	defer query.Close()
+
+	for query.Next() {
+		var Rule BlockRule
+
+		if err = query.Scan(&Rule.Name, &Rule.Command, &Rule.Pattern, &Rule.Reason, &Rule.User, &Rule.Time); err != nil {
+			continue
+		}
+
+		Rules = append(Rules, Rule)
+	}
+
+	return Rules
+}
@@ -0,0 +1,76 @@
+package db
+
+func (db *DB) BurnedAdd(Host, Reason, User, Time string, Rotate bool) error {
+	var (
+		err        error
+		RotateFlag = 0
+	)
+
+	if Rotate {
+		RotateFlag = 1
+	}
+
+	stmt, err := db.db.Prepare("INSERT OR REPLACE INTO TS_Burned (Host, Reason, User, Time, Rotate) values(?,?,?,?,?)")
+	if err != nil {
+		return err
+	}
+
+	_, err = stmt.Exec(Host, Reason, User, Time, RotateFlag)
+	if err != nil {
+		return err
+	}
+
+	stmt.Close()
+
+	return nil
+}
+
+func (db *DB) BurnedRemove(Host string) error {
+	stmt, err := db.db.Prepare("DELETE FROM TS_Burned WHERE Host = ?")
+	if err != nil {
+		return err
+	}
+
+	_, err = stmt.Exec(Host)
+	if err != nil {
+		return err
+	}
+
+	stmt.Close()
+
+	return nil
+}
+
+func (db *DB) BurnedAll() []map[string]any {
+	var Burned []map[string]any
+
+	query, err := db.db.Query("SELECT Host, Reason, User, Time, Rotate FROM TS_Burned")
+	if err != nil {
+		return nil
+	}
+	defer query.Close()
+
+	for query.Next() {
+		var (
+			Host   string
+			Reason string
+			User   string
+			Time   string
+			Rotate int
+		)
+
+		if err = query.Scan(&Host, &Reason, &User, &Time, &Rotate); err != nil {
+			continue
+		}
+
+		Burned = append(Burned, map[string]any{
+			"Host":   Host,
+			"Reason": Reason,
+			"User":   User,
+			"Time":   Time,
+			"Rotate": Rotate == 1,
+		})
+	}
+
+	return Burned
+}
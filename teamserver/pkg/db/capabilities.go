@@ -0,0 +1,208 @@
+package db
+
+import (
+	"strconv"
+	"strings"
+)
+
+// AgentCapabilitiesSet
+// saves the ids of the commands the agent build supports.
+func (db *DB) AgentCapabilitiesSet(AgentID int, Capabilities []uint32) error {
+	var Commands = make([]string, 0, len(Capabilities))
+
+	for _, ID := range Capabilities {
+		Commands = append(Commands, strconv.FormatUint(uint64(ID), 10))
+	}
+
+	stmt, err := db.db.Prepare("INSERT OR REPLACE INTO TS_AgentCapabilities (AgentID, Commands) values(?,?)")
+	if err != nil {
+		return err
+	}
+
+	_, err = stmt.Exec(AgentID, strings.Join(Commands, ","))
+	if err != nil {
+		return err
+	}
+
+	stmt.Close()
+
+	return nil
+}
+
+// AgentCapabilities
+// returns the reported capabilities of every agent in the database.
+func (db *DB) AgentCapabilities() map[int][]uint32 {
+	var Capabilities = make(map[int][]uint32)
+
+	query, err := db.db.Query("SELECT AgentID, Commands FROM TS_AgentCapabilities")
+	if err != nil {
+		return Capabilities
+	}
+	defer query.Close()
+
+	for query.Next() {
+		var (
+			AgentID  int
+			Commands string
+		)
+
+		if err = query.Scan(&AgentID, &Commands); err != nil {
+			continue
+		}
+
+		Capabilities[AgentID] = []uint32{}
+		for _, Command := range strings.Split(Commands, ",") {
+			if ID, err := strconv.ParseUint(Command, 10, 32); err == nil {
+				Capabilities[AgentID] = append(Capabilities[AgentID], uint32(ID))
+			}
+		}
+	}
+
+	return Capabilities
+}
+
+// AgentMaxResponseSet
+// saves the max response size the agent advertised.
+func (db *DB) AgentMaxResponseSet(AgentID int, MaxResponse int) error {
+	stmt, err := db.db.Prepare("INSERT OR REPLACE INTO TS_AgentResponseSizes (AgentID, MaxResponse) values(?,?)")
+	if err != nil {
+		return err
+	}
+
+	_, err = stmt.Exec(AgentID, MaxResponse)
+	if err != nil {
+		return err
+	}
+
+	stmt.Close()
+
+	return nil
+}
+
+// AgentMaxResponses
+// returns the advertised max response size of every agent in the database.
+func (db *DB) AgentMaxResponses() map[int]int {
+	var MaxResponses = make(map[int]int)
+
+	query, err := db.db.Query("SELECT AgentID, MaxResponse FROM TS_AgentResponseSizes")
+	if err != nil {
+		return MaxResponses
+	}
+	defer query.Close()
+
+	for query.Next() {
+		var AgentID, MaxResponse int
+
+		if err = query.Scan(&AgentID, &MaxResponse); err != nil {
+			continue
+		}
+
+		MaxResponses[AgentID] = MaxResponse
+	}
+
+	return MaxResponses
+}
+
+// AgentTimeZone
+// time zone of the host of an agent. Offset is in minutes east of UTC.
+type AgentTimeZone struct {
+	Name   string
+	Offset int
+}
+
+// AgentTimeZoneSet
+// saves the time zone of the host of the agent.
+func (db *DB) AgentTimeZoneSet(AgentID int, Name string, Offset int) error {
+	stmt, err := db.db.Prepare("INSERT OR REPLACE INTO TS_AgentTimeZones (AgentID, Name, UTCOffset) values(?,?,?)")
+	if err != nil {
+		return err
+	}
+
+	_, err = stmt.Exec(AgentID, Name, Offset)
+	if err != nil {
+		return err
+	}
+
+	stmt.Close()
+
+	return nil
+}
+
+// AgentTimeZones
+// returns the time zone of the host of every agent in the database.
+func (db *DB) AgentTimeZones() map[int]AgentTimeZone {
+	var TimeZones = make(map[int]AgentTimeZone)
+
+	query, err := db.db.Query("SELECT AgentID, Name, UTCOffset FROM TS_AgentTimeZones")
+	if err != nil {
+		return TimeZones
+	}
+	defer query.Close()
+
+	for query.Next() {
+		var (
+			AgentID  int
+			TimeZone AgentTimeZone
+		)
+
+		if err = query.Scan(&AgentID, &TimeZone.Name, &TimeZone.Offset); err != nil {
+			continue
+		}
+
+		TimeZones[AgentID] = TimeZone
+	}
+
+	return TimeZones
+}
+
+// AgentCodePage
+// ansi and oem (console) code page of the host of an agent.
+type AgentCodePage struct {
+	Ansi int
+	OEM  int
+}
+
+// AgentCodePageSet
+// saves the code pages of the host of the agent.
+func (db *DB) AgentCodePageSet(AgentID int, Ansi int, OEM int) error {
+	stmt, err := db.db.Prepare("INSERT OR REPLACE INTO TS_AgentCodePages (AgentID, Ansi, OEM) values(?,?,?)")
+	if err != nil {
+		return err
+	}
+
+	_, err = stmt.Exec(AgentID, Ansi, OEM)
+	if err != nil {
+		return err
+	}
+
+	stmt.Close()
+
+	return nil
+}
+
+// AgentCodePages
+// returns the code pages of the host of every agent in the database.
+func (db *DB) AgentCodePages() map[int]AgentCodePage {
+	var CodePages = make(map[int]AgentCodePage)
+
+	query, err := db.db.Query("SELECT AgentID, Ansi, OEM FROM TS_AgentCodePages")
+	if err != nil {
+		return CodePages
+	}
+	defer query.Close()
+
+	for query.Next() {
+		var (
+			AgentID  int
+			CodePage AgentCodePage
+		)
+
+		if err = query.Scan(&AgentID, &CodePage.Ansi, &CodePage.OEM); err != nil {
+			continue
+		}
+
+		CodePages[AgentID] = CodePage
+	}
+
+	return CodePages
+}
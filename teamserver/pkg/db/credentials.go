@@ -0,0 +1,119 @@
+package db
+
+import "Havoc/pkg/seal"
+
+type Credential struct {
+	ID          int
+	Username    string
+	Domain      string
+	Password    string
+	Hash        string
+	Certificate string
+	Metadata    string
+	Source      string
+	Workspace   string
+	User        string
+	Time        string
+}
+
+// CredentialAdd
+// adds the credential to the credential store and returns its id.
+func (db *DB) CredentialAdd(Credential Credential) (int, error) {
+	stmt, err := db.db.Prepare("INSERT INTO TS_Credentials (Username, Domain, Password, Hash, Certificate, Metadata, Source, Workspace, User, Time) values(?,?,?,?,?,?,?,?,?,?)")
+	if err != nil {
+		return 0, err
+	}
+	defer stmt.Close()
+
+	Result, err := stmt.Exec(Credential.Username, Credential.Domain, seal.SealString(Credential.Password), seal.SealString(Credential.Hash), seal.SealString(Credential.Certificate), seal.SealString(Credential.Metadata), Credential.Source, Credential.Workspace, Credential.User, Credential.Time)
+	if err != nil {
+		return 0, err
+	}
+
+	ID, err := Result.LastInsertId()
+
+	return int(ID), err
+}
+
+// CredentialEdit
+// replaces the secrets and source of the credential.
+func (db *DB) CredentialEdit(Credential Credential) (bool, error) {
+	stmt, err := db.db.Prepare("UPDATE TS_Credentials SET Username = ?, Domain = ?, Password = ?, Hash = ?, Certificate = ?, Metadata = ?, Source = ?, User = ?, Time = ? WHERE ID = ?")
+	if err != nil {
+		return false, err
+	}
+	defer stmt.Close()
+
+	Result, err := stmt.Exec(Credential.Username, Credential.Domain, seal.SealString(Credential.Password), seal.SealString(Credential.Hash), seal.SealString(Credential.Certificate), seal.SealString(Credential.Metadata), Credential.Source, Credential.User, Credential.Time, Credential.ID)
+	if err != nil {
+		return false, err
+	}
+
+	Rows, err := Result.RowsAffected()
+
+	return Rows > 0, err
+}
+
+// CredentialRemove
+// removes the credential from the credential store.
+func (db *DB) CredentialRemove(ID int) (bool, error) {
+	stmt, err := db.db.Prepare("DELETE FROM TS_Credentials WHERE ID = ?")
+	if err != nil {
+		return false, err
+	}
+	defer stmt.Close()
+
+	Result, err := stmt.Exec(ID)
+	if err != nil {
+		return false, err
+	}
+
+	Rows, err := Result.RowsAffected()
+
+	return Rows > 0, err
+}
+
+// CredentialGet
+// returns the credential with the id.
+func (db *DB) CredentialGet(ID int) (Credential, error) {
+	var Credential Credential
+
+	err := db.db.QueryRow("SELECT ID, Username, Domain, Password, Hash, Certificate, Metadata, Source, Workspace, User, Time FROM TS_Credentials WHERE ID = ?", ID).Scan(
+		&Credential.ID, &Credential.Username, &Credential.Domain, &Credential.Password, &Credential.Hash, &Credential.Certificate, &Credential.Metadata, &Credential.Source, &Credential.Workspace, &Credential.User, &Credential.Time,
+	)
+	if err != nil {
+		return Credential, err
+	}
+
+	err = unseal(&Credential.Password, &Credential.Hash, &Credential.Certificate, &Credential.Metadata)
+
+	return Credential, err
+}
+
+// Credentials
+// returns every credential of the credential store.
+func (db *DB) Credentials() []Credential {
+	var Credentials []Credential
+
+	query, err := db.db.Query("SELECT ID, Username, Domain, Password, Hash, Certificate, Metadata, Source, Workspace, User, Time FROM TS_Credentials ORDER BY ID")
+	if err != nil {
+		return nil
+	}
+	defer query.Close()
+
+	for query.Next() {
+		var Credential Credential
+
+		if err = query.Scan(&Credential.ID, &Credential.Username, &Credential.Domain, &Credential.Password, &Credential.Hash, &Credential.Certificate, &Credential.Metadata, &Credential.Source, &Credential.Workspace, &Credential.User, &Credential.Time); err != nil {
+			continue
+		}
+
+		if err = unseal(&Credential.Password, &Credential.Hash, &Credential.Certificate, &Credential.Metadata); err != nil {
+			continue
+		}
+
+		Credentials = append(Credentials, Credential)
+	}
+
+	return Credentials
+}
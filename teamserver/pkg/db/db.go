@@ -11,9 +11,33 @@ type DB struct {
 	existed bool
 	db      *sql.DB
 	path    string
+
+	// migrations applied when opening the db
+	migrated []Migration
+
+	// full text index. the database itself or an in memory database (SearchVolatile)
+	search     *sql.DB
+	searchKeep *sql.Conn
 }
 
 func DatabaseNew(dbpath string) (*DB, error) {
+	db, err := DatabaseOpen(dbpath)
+	if err != nil {
+		return nil, err
+	}
+
+	/* creates the tables of a new db or brings the schema of an older one up to date */
+	if db.migrated, err = db.Migrate(false); err != nil {
+		db.db.Close()
+		return nil, err
+	}
+
+	return db, nil
+}
+
+// DatabaseOpen
+// opens the db without migrating its schema.
+func DatabaseOpen(dbpath string) (*DB, error) {
 	var (
 		db  = new(DB)
 		err error
@@ -32,33 +56,211 @@ func DatabaseNew(dbpath string) (*DB, error) {
 		return nil, err
 	}
 
-	if !db.existed {
+	db.search = db.db
 
-		/* create db tables */
-		err = db.init()
-		if err != nil {
-			return nil, err
-		}
+	return db, nil
+}
 
+// initTables
+// creates the tables of the first release.
+func initTables(tx *sql.Tx) error {
+	var err error
+
+	_, err = tx.Exec(`CREATE TABLE IF NOT EXISTS "TS_Listeners" ("Name" text UNIQUE, "Protocol" text, "Config" text);`)
+	if err != nil {
+		return err
 	}
 
-	return db, nil
+	_, err = tx.Exec(`CREATE TABLE IF NOT EXISTS "TS_Agents" ("AgentID" int, "Active" int, "Reason" string, "AESKey" string, "AESIv" string, "Hostname" string, "Username" string, "DomainName" string, "ExternalIP" string, "InternalIP" string, "ProcessName" string, BaseAddress int, "ProcessPID" int, "ProcessTID" int, "ProcessPPID" int, "ProcessArch" string, "Elevated" string, "OSVersion" string, "OSArch" string, "SleepDelay" int, "SleepJitter" int, "KillDate" int, "WorkingHours" int, "FirstCallIn" string, "LastCallIn" string);`)
+	if err != nil {
+		return err
+	}
+
+	_, err = tx.Exec(`CREATE TABLE IF NOT EXISTS "TS_Links" ("ParentAgentID" int, "LinkAgentID" int);`)
+	if err != nil {
+		return err
+	}
+
+	return nil
 }
 
-func (db *DB) init() error {
+// tables
+// creates the tables and columns added after the first release.
+func tables(tx *sql.Tx) error {
 	var err error
 
-	_, err = db.db.Exec(`CREATE TABLE "TS_Listeners" ("Name" text UNIQUE, "Protocol" text, "Config" text);`)
+	_, err = tx.Exec(`CREATE TABLE IF NOT EXISTS "TS_Burned" ("Host" text UNIQUE, "Reason" text, "User" text, "Time" text, "Rotate" int);`)
+	if err != nil {
+		return err
+	}
+
+	_, err = tx.Exec(`CREATE TABLE IF NOT EXISTS "TS_Payloads" ("Name" text, "Listener" text, "Hosts" text, "Arch" text, "Format" text, "User" text, "Time" text, "Note" text);`)
+	if err != nil {
+		return err
+	}
+
+	/* preset and options a payload has been built with */
+	for _, Column := range []string{"Preset", "Config"} {
+		if err = column(tx, "TS_Payloads", Column, `text DEFAULT ''`); err != nil {
+			return err
+		}
+	}
+
+	_, err = tx.Exec(`CREATE TABLE IF NOT EXISTS "TS_BuildPresets" ("Name" text UNIQUE, "AgentType" text, "Listener" text, "Arch" text, "Format" text, "Config" text, "User" text, "Time" text);`)
 	if err != nil {
 		return err
 	}
 
-	_, err = db.db.Exec(`CREATE TABLE "TS_Agents" ("AgentID" int, "Active" int, "Reason" string, "AESKey" string, "AESIv" string, "Hostname" string, "Username" string, "DomainName" string, "ExternalIP" string, "InternalIP" string, "ProcessName" string, BaseAddress int, "ProcessPID" int, "ProcessTID" int, "ProcessPPID" int, "ProcessArch" string, "Elevated" string, "OSVersion" string, "OSArch" string, "SleepDelay" int, "SleepJitter" int, "KillDate" int, "WorkingHours" int, "FirstCallIn" string, "LastCallIn" string);`)
+	_, err = tx.Exec(`CREATE TABLE IF NOT EXISTS "TS_Scripts" ("Name" text UNIQUE, "Description" text, "Content" text, "User" text, "Time" text);`)
 	if err != nil {
 		return err
 	}
 
-	_, err = db.db.Exec(`CREATE TABLE "TS_Links" ("ParentAgentID" int, "LinkAgentID" int);`)
+	_, err = tx.Exec(`CREATE TABLE IF NOT EXISTS "TS_TaskTemplates" ("Name" text UNIQUE, "Description" text, "Command" text, "Parameters" text, "User" text, "Time" text);`)
+	if err != nil {
+		return err
+	}
+
+	_, err = tx.Exec(`CREATE TABLE IF NOT EXISTS "TS_Schedules" ("ID" integer PRIMARY KEY AUTOINCREMENT, "AgentID" text, "Name" text, "Schedule" text, "Command" text, "Hours" text, "Workspace" text, "User" text, "Time" text, "LastRun" text);`)
+	if err != nil {
+		return err
+	}
+
+	_, err = tx.Exec(`CREATE TABLE IF NOT EXISTS "TS_Credentials" ("ID" integer PRIMARY KEY AUTOINCREMENT, "Username" text, "Domain" text, "Password" text, "Hash" text, "Source" text, "Workspace" text, "User" text, "Time" text);`)
+	if err != nil {
+		return err
+	}
+
+	_, err = tx.Exec(`CREATE TABLE IF NOT EXISTS "TS_Lateral" ("ID" integer PRIMARY KEY AUTOINCREMENT, "Method" text, "AgentID" text, "Target" text, "Credential" int, "Payload" text, "Status" text, "User" text, "Time" text);`)
+	if err != nil {
+		return err
+	}
+
+	_, err = tx.Exec(`CREATE TABLE IF NOT EXISTS "TS_SSH" ("ID" integer PRIMARY KEY AUTOINCREMENT, "Host" text, "Port" int, "Username" text, "HostKey" text, "AgentID" text, "Workspace" text, "User" text, "Time" text);`)
+	if err != nil {
+		return err
+	}
+
+	_, err = tx.Exec(`CREATE TABLE IF NOT EXISTS "TS_Directory" ("DN" text, "Workspace" text, "Domain" text, "Type" text, "Name" text, "SID" text, "Attributes" text, "AgentID" text, "Time" text, UNIQUE("DN", "Workspace"));`)
+	if err != nil {
+		return err
+	}
+
+	/* session a jump resulted in */
+	if err = column(tx, "TS_Lateral", "SessionID", `text DEFAULT ''`); err != nil {
+		return err
+	}
+
+	/* certificates (pem of certificate and key) and their metadata */
+	for _, Column := range []string{"Certificate", "Metadata"} {
+		if err = column(tx, "TS_Credentials", Column, `text DEFAULT ''`); err != nil {
+			return err
+		}
+	}
+
+	_, err = tx.Exec(`CREATE TABLE IF NOT EXISTS "TS_Events" ("ID" integer PRIMARY KEY AUTOINCREMENT, "Time" int, "Event" int, "SubEvent" int, "User" text, "Package" text);`)
+	if err != nil {
+		return err
+	}
+
+	_, err = tx.Exec(`CREATE TABLE IF NOT EXISTS "TS_AgentWorkspaces" ("AgentID" int UNIQUE, "Workspace" text);`)
+	if err != nil {
+		return err
+	}
+
+	_, err = tx.Exec(`CREATE TABLE IF NOT EXISTS "TS_AgentCapabilities" ("AgentID" int UNIQUE, "Commands" text);`)
+	if err != nil {
+		return err
+	}
+
+	_, err = tx.Exec(`CREATE TABLE IF NOT EXISTS "TS_AgentTags" ("AgentID" int UNIQUE, "Tags" text);`)
+	if err != nil {
+		return err
+	}
+
+	_, err = tx.Exec(`CREATE TABLE IF NOT EXISTS "TS_Clipboard" ("ID" integer PRIMARY KEY AUTOINCREMENT, "Workspace" text, "Host" text, "AgentID" text, "Hash" text, "Text" text, "First" text, "Last" text, "Seen" integer, "Count" integer, UNIQUE("Workspace", "Host", "Hash"));`)
+	if err != nil {
+		return err
+	}
+
+	_, err = tx.Exec(`CREATE TABLE IF NOT EXISTS "TS_Registry" ("Workspace" text, "Host" text COLLATE NOCASE, "Hive" text, "Path" text COLLATE NOCASE, "Name" text COLLATE NOCASE, "Subkey" integer, "Type" text, "Data" text, "AgentID" text, "Time" text, UNIQUE("Workspace", "Host", "Hive", "Path", "Name", "Subkey"));`)
+	if err != nil {
+		return err
+	}
+
+	_, err = tx.Exec(`CREATE TABLE IF NOT EXISTS "TS_RegistryChanges" ("ID" integer PRIMARY KEY AUTOINCREMENT, "Workspace" text, "Host" text COLLATE NOCASE, "AgentID" text, "User" text, "Operation" text, "Hive" text, "Path" text, "Name" text, "View" text, "Type" text, "Data" text, "Existed" integer, "PreviousType" text, "PreviousData" text, "Status" integer, "Time" text);`)
+	if err != nil {
+		return err
+	}
+
+	_, err = tx.Exec(`CREATE TABLE IF NOT EXISTS "TS_HostServices" ("Workspace" text, "Host" text COLLATE NOCASE, "Kind" text, "Name" text COLLATE NOCASE, "Display" text, "Path" text, "RunAs" text, "StartType" text, "State" text, "AgentID" text, "Time" text, UNIQUE("Workspace", "Host", "Kind", "Name"));`)
+	if err != nil {
+		return err
+	}
+
+	_, err = tx.Exec(`CREATE TABLE IF NOT EXISTS "TS_WritablePaths" ("Workspace" text, "Host" text COLLATE NOCASE, "Path" text COLLATE NOCASE, "Principal" text COLLATE NOCASE, "Rights" text, "AgentID" text, "Time" text, UNIQUE("Workspace", "Host", "Path", "Principal"));`)
+	if err != nil {
+		return err
+	}
+
+	_, err = tx.Exec(`CREATE TABLE IF NOT EXISTS "TS_LootHashes" ("Workspace" text, "Hash" text, "Size" integer, "Path" text, "Name" text, "AgentID" text, "Time" text, UNIQUE("Workspace", "Path"));`)
+	if err != nil {
+		return err
+	}
+
+	_, err = tx.Exec(`CREATE TABLE IF NOT EXISTS "TS_AgentResponseSizes" ("AgentID" int UNIQUE, "MaxResponse" int);`)
+	if err != nil {
+		return err
+	}
+
+	_, err = tx.Exec(`CREATE TABLE IF NOT EXISTS "TS_AgentTimeZones" ("AgentID" int UNIQUE, "Name" text, "UTCOffset" int);`)
+	if err != nil {
+		return err
+	}
+
+	_, err = tx.Exec(`CREATE TABLE IF NOT EXISTS "TS_AgentCodePages" ("AgentID" int UNIQUE, "Ansi" int, "OEM" int);`)
+	if err != nil {
+		return err
+	}
+
+	_, err = tx.Exec(`CREATE TABLE IF NOT EXISTS "TS_Settings" ("Key" text UNIQUE, "Value" text);`)
+	if err != nil {
+		return err
+	}
+
+	_, err = tx.Exec(`CREATE TABLE IF NOT EXISTS "TS_AgentArchive" ("AgentID" int UNIQUE, "User" text, "Time" text, "LootPath" text);`)
+	if err != nil {
+		return err
+	}
+
+	/* full text index of task commands and outputs */
+	_, err = tx.Exec(`CREATE VIRTUAL TABLE IF NOT EXISTS "TS_Search" USING fts4("AgentID", "Type", "User", "Time", "Content", notindexed="AgentID", notindexed="Type", notindexed="User", notindexed="Time");`)
+	if err != nil {
+		return err
+	}
+
+	_, err = tx.Exec(`CREATE TABLE IF NOT EXISTS "TS_Blocklist" ("Name" text UNIQUE, "Command" text, "Pattern" text, "Reason" text, "User" text, "Time" text);`)
+	if err != nil {
+		return err
+	}
+
+	_, err = tx.Exec(`CREATE TABLE IF NOT EXISTS "TS_UploadRules" ("Name" text UNIQUE, "Action" text, "Category" text, "Hashes" text, "Pattern" text, "Content" text, "Reason" text, "User" text, "Time" text);`)
+	if err != nil {
+		return err
+	}
+
+	_, err = tx.Exec(`CREATE TABLE IF NOT EXISTS "TS_UploadAudit" ("ID" integer PRIMARY KEY AUTOINCREMENT, "Workspace" text, "AgentID" text, "User" text, "TaskID" text, "File" text, "Hash" text, "Size" integer, "Rule" text, "Category" text, "Decision" text, "DecidedBy" text, "Time" text);`)
+	if err != nil {
+		return err
+	}
+
+	_, err = tx.Exec(`CREATE TABLE IF NOT EXISTS "TS_Snapshots" ("ID" integer PRIMARY KEY AUTOINCREMENT, "AgentID" text, "Command" text, "Target" text, "Time" text, "Entries" text);`)
+	if err != nil {
+		return err
+	}
+
+	/* listeners the agents called back over and when they failed over to another one */
+	_, err = tx.Exec(`CREATE TABLE IF NOT EXISTS "TS_AgentTransports" ("ID" integer PRIMARY KEY AUTOINCREMENT, "AgentID" int, "Listener" text, "Previous" text, "Host" text, "Time" text);`)
 	if err != nil {
 		return err
 	}
@@ -66,6 +268,24 @@ func (db *DB) init() error {
 	return nil
 }
 
+// column
+// adds the column to a table of an older db if it doesn't exist yet.
+func column(tx *sql.Tx, Table, Column, Type string) error {
+	var Count int
+
+	if err := tx.QueryRow(`SELECT COUNT(*) FROM pragma_table_info(?) WHERE name = ?`, Table, Column).Scan(&Count); err != nil {
+		return err
+	}
+
+	if Count > 0 {
+		return nil
+	}
+
+	_, err := tx.Exec(`ALTER TABLE "` + Table + `" ADD COLUMN "` + Column + `" ` + Type)
+
+	return err
+}
+
 func (db *DB) Existed() bool {
 	return db.existed
 }
@@ -0,0 +1,60 @@
+package db
+
+import "Havoc/pkg/seal"
+
+// Detection
+// whether the blue team detected a task (yes, no, unknown), when they did
+// in unix time (0 if unknown) and the reference of their ticket or alert.
+// Updated is when an operator last edited it.
+type Detection struct {
+	TaskID    string
+	Workspace string
+	AgentID   string
+	Detected  string
+	Time      int64
+	Reference string
+	User      string
+	Updated   string
+}
+
+// DetectionSet
+// adds the detection of the task or replaces the one it had.
+func (db *DB) DetectionSet(Detection Detection) error {
+	stmt, err := db.db.Prepare("INSERT OR REPLACE INTO TS_Detections (TaskID, Workspace, AgentID, Detected, Time, Reference, User, Updated) values(?,?,?,?,?,?,?,?)")
+	if err != nil {
+		return err
+	}
+	defer stmt.Close()
+
+	_, err = stmt.Exec(Detection.TaskID, Detection.Workspace, Detection.AgentID, Detection.Detected, Detection.Time, seal.SealString(Detection.Reference), Detection.User, Detection.Updated)
+
+	return err
+}
+
+// Detections
+// returns the detections of the tasks.
+func (db *DB) Detections() []Detection {
+	var List []Detection
+
+	query, err := db.db.Query("SELECT TaskID, Workspace, AgentID, Detected, Time, Reference, User, Updated FROM TS_Detections")
+	if err != nil {
+		return nil
+	}
+	defer query.Close()
+
+	for query.Next() {
+		var Detection Detection
+
+		if err = query.Scan(&Detection.TaskID, &Detection.Workspace, &Detection.AgentID, &Detection.Detected, &Detection.Time, &Detection.Reference, &Detection.User, &Detection.Updated); err != nil {
+			continue
+		}
+
+		if err = unseal(&Detection.Reference); err != nil {
+			continue
+		}
+
+		List = append(List, Detection)
+	}
+
+	return List
+}
@@ -0,0 +1,89 @@
+package db
+
+import (
+	"encoding/json"
+)
+
+// DirectoryObject
+// user, group, computer or other object of a directory an agent queried.
+type DirectoryObject struct {
+	DN         string
+	Workspace  string
+	Domain     string
+	Type       string
+	Name       string
+	SID        string
+	Attributes map[string][]string
+	AgentID    string
+	Time       string
+}
+
+// DirectorySet
+// adds the directory object or replaces the object with the same dn.
+func (db *DB) DirectorySet(Object DirectoryObject) error {
+	Attributes, err := json.Marshal(Object.Attributes)
+	if err != nil {
+		return err
+	}
+
+	stmt, err := db.db.Prepare(`INSERT INTO TS_Directory (DN, Workspace, Domain, Type, Name, SID, Attributes, AgentID, Time) values(?,?,?,?,?,?,?,?,?)
+		ON CONFLICT(DN, Workspace) DO UPDATE SET Domain = excluded.Domain, Type = excluded.Type, Name = excluded.Name, SID = excluded.SID, Attributes = excluded.Attributes, AgentID = excluded.AgentID, Time = excluded.Time`)
+	if err != nil {
+		return err
+	}
+	defer stmt.Close()
+
+	_, err = stmt.Exec(Object.DN, Object.Workspace, Object.Domain, Object.Type, Object.Name, Object.SID, string(Attributes), Object.AgentID, Object.Time)
+
+	return err
+}
+
+// DirectoryGet
+// returns the directory object with the dn.
+func (db *DB) DirectoryGet(Workspace, DN string) (DirectoryObject, error) {
+	var (
+		Object     DirectoryObject
+		Attributes string
+	)
+
+	err := db.db.QueryRow("SELECT DN, Workspace, Domain, Type, Name, SID, Attributes, AgentID, Time FROM TS_Directory WHERE DN = ? AND Workspace = ?", DN, Workspace).Scan(
+		&Object.DN, &Object.Workspace, &Object.Domain, &Object.Type, &Object.Name, &Object.SID, &Attributes, &Object.AgentID, &Object.Time)
+	if err != nil {
+		return Object, err
+	}
+
+	err = json.Unmarshal([]byte(Attributes), &Object.Attributes)
+
+	return Object, err
+}
+
+// DirectoryObjects
+// returns the directory objects of the type. every object if the type is empty.
+func (db *DB) DirectoryObjects(Type string) []DirectoryObject {
+	var Objects []DirectoryObject
+
+	query, err := db.db.Query("SELECT DN, Workspace, Domain, Type, Name, SID, Attributes, AgentID, Time FROM TS_Directory WHERE ? = '' OR Type = ? ORDER BY Domain, Type, Name", Type, Type)
+	if err != nil {
+		return nil
+	}
+	defer query.Close()
+
+	for query.Next() {
+		var (
+			Object     DirectoryObject
+			Attributes string
+		)
+
+		if err = query.Scan(&Object.DN, &Object.Workspace, &Object.Domain, &Object.Type, &Object.Name, &Object.SID, &Attributes, &Object.AgentID, &Object.Time); err != nil {
+			continue
+		}
+
+		if err = json.Unmarshal([]byte(Attributes), &Object.Attributes); err != nil {
+			continue
+		}
+
+		Objects = append(Objects, Object)
+	}
+
+	return Objects
+}
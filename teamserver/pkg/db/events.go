@@ -0,0 +1,88 @@
+package db
+
+import "Havoc/pkg/seal"
+
+func (db *DB) EventAdd(Time int64, Event, SubEvent int, User, Package string) error {
+	stmt, err := db.db.Prepare("INSERT INTO TS_Events (Time, Event, SubEvent, User, Package) values(?,?,?,?,?)")
+	if err != nil {
+		return err
+	}
+
+	_, err = stmt.Exec(Time, Event, SubEvent, User, seal.SealString(Package))
+	if err != nil {
+		return err
+	}
+
+	stmt.Close()
+
+	return nil
+}
+
+// EventLastID
+// returns the id of the last persisted event.
+func (db *DB) EventLastID() int64 {
+	var ID int64
+
+	if err := db.db.QueryRow("SELECT IFNULL(MAX(ID), 0) FROM TS_Events").Scan(&ID); err != nil {
+		return 0
+	}
+
+	return ID
+}
+
+// EventsSince
+// returns every persisted package (as json) that has been
+// added after the specified unix time and up to the event id.
+func (db *DB) EventsSince(Since int64, MaxID int64) []string {
+	var Packages []string
+
+	query, err := db.db.Query("SELECT Package FROM TS_Events WHERE Time >= ? AND ID <= ? ORDER BY ID", Since, MaxID)
+	if err != nil {
+		return nil
+	}
+	defer query.Close()
+
+	for query.Next() {
+		var Package string
+
+		if err = query.Scan(&Package); err != nil {
+			continue
+		}
+
+		if err = unseal(&Package); err != nil {
+			continue
+		}
+
+		Packages = append(Packages, Package)
+	}
+
+	return Packages
+}
+
+// EventsOf
+// returns every persisted package (as json) of the event type.
+func (db *DB) EventsOf(Event, SubEvent int) []string {
+	var Packages []string
+
+	query, err := db.db.Query("SELECT Package FROM TS_Events WHERE Event = ? AND SubEvent = ? ORDER BY ID", Event, SubEvent)
+	if err != nil {
+		return nil
+	}
+	defer query.Close()
+
+	for query.Next() {
+		var Package string
+
+		if err = query.Scan(&Package); err != nil {
+			continue
+		}
+
+		if err = unseal(&Package); err != nil {
+			continue
+		}
+
+		Packages = append(Packages, Package)
+	}
+
+	return Packages
+}
@@ -0,0 +1,114 @@
+package db
+
+import "Havoc/pkg/seal"
+
+// Evidence
+// a file an operator attached to a task or a timeline entry (screenshot,
+// mail, log). Path is where it is stored in the loot vault, Hash the
+// sha256 of its content.
+type Evidence struct {
+	ID          int
+	Workspace   string
+	TaskID      string
+	TimelineID  int
+	AgentID     string
+	Name        string
+	Description string
+	Path        string
+	Size        int64
+	Hash        string
+	User        string
+	Time        string
+}
+
+const evidenceColumns = "ID, Workspace, TaskID, TimelineID, AgentID, Name, Description, Path, Size, Hash, User, Time"
+
+// EvidenceAdd
+// adds the evidence and returns its id.
+func (db *DB) EvidenceAdd(Evidence Evidence) (int, error) {
+	stmt, err := db.db.Prepare("INSERT INTO TS_Evidence (Workspace, TaskID, TimelineID, AgentID, Name, Description, Path, Size, Hash, User, Time) values(?,?,?,?,?,?,?,?,?,?,?)")
+	if err != nil {
+		return 0, err
+	}
+	defer stmt.Close()
+
+	Result, err := stmt.Exec(
+		Evidence.Workspace, Evidence.TaskID, Evidence.TimelineID, Evidence.AgentID, seal.SealString(Evidence.Name),
+		seal.SealString(Evidence.Description), Evidence.Path, Evidence.Size, Evidence.Hash, Evidence.User, Evidence.Time,
+	)
+	if err != nil {
+		return 0, err
+	}
+
+	ID, err := Result.LastInsertId()
+
+	return int(ID), err
+}
+
+// EvidenceRemove
+// removes the evidence.
+func (db *DB) EvidenceRemove(ID int) (bool, error) {
+	stmt, err := db.db.Prepare("DELETE FROM TS_Evidence WHERE ID = ?")
+	if err != nil {
+		return false, err
+	}
+	defer stmt.Close()
+
+	Result, err := stmt.Exec(ID)
+	if err != nil {
+		return false, err
+	}
+
+	Rows, err := Result.RowsAffected()
+
+	return Rows > 0, err
+}
+
+// EvidenceGet
+// returns the evidence with the id.
+func (db *DB) EvidenceGet(ID int) (Evidence, error) {
+	var Evidence Evidence
+
+	err := db.db.QueryRow("SELECT "+evidenceColumns+" FROM TS_Evidence WHERE ID = ?", ID).Scan(
+		&Evidence.ID, &Evidence.Workspace, &Evidence.TaskID, &Evidence.TimelineID, &Evidence.AgentID, &Evidence.Name,
+		&Evidence.Description, &Evidence.Path, &Evidence.Size, &Evidence.Hash, &Evidence.User, &Evidence.Time,
+	)
+	if err != nil {
+		return Evidence, err
+	}
+
+	err = unseal(&Evidence.Name, &Evidence.Description)
+
+	return Evidence, err
+}
+
+// Evidences
+// returns every evidence in the order they got attached.
+func (db *DB) Evidences() []Evidence {
+	var List []Evidence
+
+	query, err := db.db.Query("SELECT " + evidenceColumns + " FROM TS_Evidence ORDER BY ID")
+	if err != nil {
+		return nil
+	}
+	defer query.Close()
+
+	for query.Next() {
+		var Evidence Evidence
+
+		if err = query.Scan(
+			&Evidence.ID, &Evidence.Workspace, &Evidence.TaskID, &Evidence.TimelineID, &Evidence.AgentID, &Evidence.Name,
+			&Evidence.Description, &Evidence.Path, &Evidence.Size, &Evidence.Hash, &Evidence.User, &Evidence.Time,
+		); err != nil {
+			continue
+		}
+
+		if err = unseal(&Evidence.Name, &Evidence.Description); err != nil {
+			continue
+		}
+
+		List = append(List, Evidence)
+	}
+
+	return List
+}
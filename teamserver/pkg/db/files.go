@@ -0,0 +1,82 @@
+package db
+
+import "strings"
+
+// FileRecord
+// file of a host an agent found searching it. Content is what the
+// search grepped the file for, empty if it only matched by name.
+type FileRecord struct {
+	Workspace  string
+	Host       string
+	Path       string
+	Name       string
+	Size       int64
+	Modified   string
+	Attributes int
+	Content    string
+	AgentID    string
+	Time       string
+}
+
+// FileAdd
+// adds the files or updates the known ones. the content a file got
+// grepped for is kept if a later search only matched its name.
+func (db *DB) FileAdd(Records []FileRecord) error {
+	tx, err := db.db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	stmt, err := tx.Prepare(`INSERT INTO TS_Files (Workspace, Host, Path, Name, Size, Modified, Attributes, Content, AgentID, Time) values(?,?,?,?,?,?,?,?,?,?)
+		ON CONFLICT(Workspace, Host, Path) DO UPDATE SET
+			Name = excluded.Name, Size = excluded.Size, Modified = excluded.Modified, Attributes = excluded.Attributes,
+			Content = CASE WHEN excluded.Content = '' THEN Content ELSE excluded.Content END,
+			AgentID = excluded.AgentID, Time = excluded.Time`)
+	if err != nil {
+		return err
+	}
+	defer stmt.Close()
+
+	for _, Record := range Records {
+		if _, err = stmt.Exec(Record.Workspace, Record.Host, Record.Path, Record.Name, Record.Size, Record.Modified, Record.Attributes, Record.Content, Record.AgentID, Record.Time); err != nil {
+			return err
+		}
+	}
+
+	return tx.Commit()
+}
+
+// Files
+// returns the files of the host (every host if empty) whose name matches
+// the wildcard pattern (eg: *.kdbx, every file if empty) and that got
+// grepped for the content (any if empty), ordered by host and path.
+func (db *DB) Files(Host, Pattern, Content string) []FileRecord {
+	var Records []FileRecord
+
+	query, err := db.db.Query(`SELECT Workspace, Host, Path, Name, Size, Modified, Attributes, Content, AgentID, Time FROM TS_Files
+		WHERE (? = '' OR Host = ?) AND (? = '' OR Name LIKE ? ESCAPE '\') AND (? = '' OR Content = ? COLLATE NOCASE)
+		ORDER BY Host, Path`, Host, Host, Pattern, fileLike(Pattern), Content, Content)
+	if err != nil {
+		return nil
+	}
+	defer query.Close()
+
+	for query.Next() {
+		var Record FileRecord
+
+		if err = query.Scan(&Record.Workspace, &Record.Host, &Record.Path, &Record.Name, &Record.Size, &Record.Modified, &Record.Attributes, &Record.Content, &Record.AgentID, &Record.Time); err != nil {
+			continue
+		}
+
+		Records = append(Records, Record)
+	}
+
+	return Records
+}
+
+// fileLike
+// turns a wildcard pattern (* and ?) into a LIKE pattern.
+func fileLike(Pattern string) string {
+	return strings.NewReplacer(`\`, `\\`, `%`, `\%`, `_`, `\_`, `*`, `%`, `?`, `_`).Replace(Pattern)
+}
@@ -0,0 +1,89 @@
+package db
+
+// AgentGroup
+// a saved selection of agents (see BatchSelect of the teamserver) that is
+// evaluated whenever the group is used, so agents join and leave it as
+// they change.
+type AgentGroup struct {
+	Name        string
+	Workspace   string
+	Description string
+	Tag         string
+	Subnet      string
+	Filter      string
+	User        string
+	Time        string
+}
+
+// GroupSet
+// adds or replaces the named agent group.
+func (db *DB) GroupSet(Group AgentGroup) error {
+	stmt, err := db.db.Prepare("INSERT OR REPLACE INTO TS_AgentGroups (Name, Workspace, Description, Tag, Subnet, Filter, User, Time) values(?,?,?,?,?,?,?,?)")
+	if err != nil {
+		return err
+	}
+
+	_, err = stmt.Exec(Group.Name, Group.Workspace, Group.Description, Group.Tag, Group.Subnet, Group.Filter, Group.User, Group.Time)
+	if err != nil {
+		return err
+	}
+
+	stmt.Close()
+
+	return nil
+}
+
+// GroupRemove
+// removes the named agent group.
+func (db *DB) GroupRemove(Name string) (bool, error) {
+	stmt, err := db.db.Prepare("DELETE FROM TS_AgentGroups WHERE Name = ?")
+	if err != nil {
+		return false, err
+	}
+	defer stmt.Close()
+
+	Result, err := stmt.Exec(Name)
+	if err != nil {
+		return false, err
+	}
+
+	Rows, err := Result.RowsAffected()
+
+	return Rows > 0, err
+}
+
+// GroupGet
+// returns the named agent group.
+func (db *DB) GroupGet(Name string) (AgentGroup, error) {
+	var Group AgentGroup
+
+	err := db.db.QueryRow("SELECT Name, Workspace, Description, Tag, Subnet, Filter, User, Time FROM TS_AgentGroups WHERE Name = ?", Name).Scan(
+		&Group.Name, &Group.Workspace, &Group.Description, &Group.Tag, &Group.Subnet, &Group.Filter, &Group.User, &Group.Time,
+	)
+
+	return Group, err
+}
+
+// Groups
+// returns every agent group ordered by name.
+func (db *DB) Groups() []AgentGroup {
+	var Groups []AgentGroup
+
+	query, err := db.db.Query("SELECT Name, Workspace, Description, Tag, Subnet, Filter, User, Time FROM TS_AgentGroups ORDER BY Name")
+	if err != nil {
+		return nil
+	}
+	defer query.Close()
+
+	for query.Next() {
+		var Group AgentGroup
+
+		if err = query.Scan(&Group.Name, &Group.Workspace, &Group.Description, &Group.Tag, &Group.Subnet, &Group.Filter, &Group.User, &Group.Time); err != nil {
+			continue
+		}
+
+		Groups = append(Groups, Group)
+	}
+
+	return Groups
+}
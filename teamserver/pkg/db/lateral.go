@@ -0,0 +1,87 @@
+package db
+
+// LateralEdge
+// edge of the asset graph: an agent moved (or tried to move) to a target.
+type LateralEdge struct {
+	ID         int
+	Method     string
+	AgentID    string
+	Target     string
+	Credential int
+	Payload    string
+	Status     string
+	User       string
+	Time       string
+	SessionID  string
+}
+
+// LateralAdd
+// records the lateral movement and returns the id of the edge.
+func (db *DB) LateralAdd(Edge LateralEdge) (int, error) {
+	stmt, err := db.db.Prepare("INSERT INTO TS_Lateral (Method, AgentID, Target, Credential, Payload, Status, User, Time) values(?,?,?,?,?,?,?,?)")
+	if err != nil {
+		return 0, err
+	}
+	defer stmt.Close()
+
+	Result, err := stmt.Exec(Edge.Method, Edge.AgentID, Edge.Target, Edge.Credential, Edge.Payload, Edge.Status, Edge.User, Edge.Time)
+	if err != nil {
+		return 0, err
+	}
+
+	ID, err := Result.LastInsertId()
+
+	return int(ID), err
+}
+
+// LateralStatus
+// updates the status of the lateral movement.
+func (db *DB) LateralStatus(ID int, Status string) error {
+	stmt, err := db.db.Prepare("UPDATE TS_Lateral SET Status = ? WHERE ID = ?")
+	if err != nil {
+		return err
+	}
+	defer stmt.Close()
+
+	_, err = stmt.Exec(Status, ID)
+
+	return err
+}
+
+// LateralSession
+// links the lateral movement to the session it resulted in.
+func (db *DB) LateralSession(ID int, SessionID string) error {
+	stmt, err := db.db.Prepare("UPDATE TS_Lateral SET Status = 'success', SessionID = ? WHERE ID = ?")
+	if err != nil {
+		return err
+	}
+	defer stmt.Close()
+
+	_, err = stmt.Exec(SessionID, ID)
+
+	return err
+}
+
+// LateralEdges
+// returns every recorded lateral movement.
+func (db *DB) LateralEdges() []LateralEdge {
+	var Edges []LateralEdge
+
+	query, err := db.db.Query("SELECT ID, Method, AgentID, Target, Credential, Payload, Status, User, Time, SessionID FROM TS_Lateral ORDER BY ID")
+	if err != nil {
+		return nil
+	}
+	defer query.Close()
+
+	for query.Next() {
+		var Edge LateralEdge
+
+		if err = query.Scan(&Edge.ID, &Edge.Method, &Edge.AgentID, &Edge.Target, &Edge.Credential, &Edge.Payload, &Edge.Status, &Edge.User, &Edge.Time, &Edge.SessionID); err != nil {
+			continue
+		}
+
+		Edges = append(Edges, Edge)
+	}
+
+	return Edges
+}
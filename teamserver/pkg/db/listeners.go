@@ -166,3 +166,91 @@ func (db *DB) ListenerRemove(Name string) error {
 
 	return nil
 }
+
+
+// ListenerTemplate
+// saved configuration of a listener (the json of its handler config) new
+// listeners get created from.
+type ListenerTemplate struct {
+	Name      string
+	Workspace string
+	Protocol  string
+	Config    string
+	// listener the template got saved from
+	Source string
+	User   string
+	Time   string
+}
+
+// ListenerTemplateSet
+// adds or replaces the named listener template.
+func (db *DB) ListenerTemplateSet(Template ListenerTemplate) error {
+	stmt, err := db.db.Prepare("INSERT OR REPLACE INTO TS_ListenerTemplates (Name, Workspace, Protocol, Config, Source, User, Time) values(?,?,?,?,?,?,?)")
+	if err != nil {
+		return err
+	}
+
+	_, err = stmt.Exec(Template.Name, Template.Workspace, Template.Protocol, Template.Config, Template.Source, Template.User, Template.Time)
+	if err != nil {
+		return err
+	}
+
+	stmt.Close()
+
+	return nil
+}
+
+// ListenerTemplateRemove
+// removes the named listener template.
+func (db *DB) ListenerTemplateRemove(Name string) (bool, error) {
+	stmt, err := db.db.Prepare("DELETE FROM TS_ListenerTemplates WHERE Name = ?")
+	if err != nil {
+		return false, err
+	}
+	defer stmt.Close()
+
+	Result, err := stmt.Exec(Name)
+	if err != nil {
+		return false, err
+	}
+
+	Rows, err := Result.RowsAffected()
+
+	return Rows > 0, err
+}
+
+// ListenerTemplateGet
+// returns the named listener template.
+func (db *DB) ListenerTemplateGet(Name string) (ListenerTemplate, error) {
+	var Template ListenerTemplate
+
+	err := db.db.QueryRow("SELECT Name, Workspace, Protocol, Config, Source, User, Time FROM TS_ListenerTemplates WHERE Name = ?", Name).Scan(
+		&Template.Name, &Template.Workspace, &Template.Protocol, &Template.Config, &Template.Source, &Template.User, &Template.Time,
+	)
+
+	return Template, err
+}
+
+// ListenerTemplates
+// returns every listener template ordered by name.
+func (db *DB) ListenerTemplates() []ListenerTemplate {
+	var Templates []ListenerTemplate
+
+	query, err := db.db.Query("SELECT Name, Workspace, Protocol, Config, Source, User, Time FROM TS_ListenerTemplates ORDER BY Name")
+	if err != nil {
+		return nil
+	}
+	defer query.Close()
+
+	for query.Next() {
+		var Template ListenerTemplate
+
+		if err = query.Scan(&Template.Name, &Template.Workspace, &Template.Protocol, &Template.Config, &Template.Source, &Template.User, &Template.Time); err != nil {
+			continue
+		}
+
+		Templates = append(Templates, Template)
+	}
+
+	return Templates
+}
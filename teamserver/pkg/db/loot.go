@@ -0,0 +1,72 @@
+package db
+
+import (
+	"Havoc/pkg/seal"
+)
+
+// LootHash
+// sha256 of a file in the loot store. downloads of a file the
+// workspace already has get linked to it instead of transferred again.
+type LootHash struct {
+	Workspace string
+	Hash      string
+	Size      int64
+	// file in the loot store
+	Path string
+	// path of the file on the host it got downloaded from
+	Name    string
+	AgentID string
+	Time    string
+}
+
+// LootHashSet
+// records the hash of the file in the loot store (replaces the hash
+// the path had before if the file got downloaded again).
+func (db *DB) LootHashSet(Loot LootHash) error {
+	stmt, err := db.db.Prepare("INSERT INTO TS_LootHashes (Workspace, Hash, Size, Path, Name, AgentID, Time) values(?,?,?,?,?,?,?) ON CONFLICT (Workspace, Path) DO UPDATE SET Hash = excluded.Hash, Size = excluded.Size, Name = excluded.Name, AgentID = excluded.AgentID, Time = excluded.Time")
+	if err != nil {
+		return err
+	}
+	defer stmt.Close()
+
+	_, err = stmt.Exec(Loot.Workspace, Loot.Hash, Loot.Size, Loot.Path, seal.SealString(Loot.Name), Loot.AgentID, Loot.Time)
+
+	return err
+}
+
+// LootHashRemove
+// forgets the hash of a file that isn't in the loot store anymore.
+func (db *DB) LootHashRemove(Workspace, Path string) error {
+	_, err := db.db.Exec("DELETE FROM TS_LootHashes WHERE Workspace = ? AND Path = ?", Workspace, Path)
+
+	return err
+}
+
+// LootHashes
+// returns the files of the workspace with the hash and size, the
+// most recently recorded first.
+func (db *DB) LootHashes(Workspace, Hash string, Size int64) []LootHash {
+	var Files []LootHash
+
+	query, err := db.db.Query("SELECT Workspace, Hash, Size, Path, Name, AgentID, Time FROM TS_LootHashes WHERE Workspace = ? AND Hash = ? AND Size = ? ORDER BY rowid DESC", Workspace, Hash, Size)
+	if err != nil {
+		return nil
+	}
+	defer query.Close()
+
+	for query.Next() {
+		var Loot LootHash
+
+		if err = query.Scan(&Loot.Workspace, &Loot.Hash, &Loot.Size, &Loot.Path, &Loot.Name, &Loot.AgentID, &Loot.Time); err != nil {
+			continue
+		}
+
+		if err = unseal(&Loot.Name); err != nil {
+			continue
+		}
+
+		Files = append(Files, Loot)
+	}
+
+	return Files
+}
@@ -0,0 +1,202 @@
+package db
+
+import (
+	"database/sql"
+	"fmt"
+	"os"
+)
+
+// Migration
+// change of the schema of the db. Applied in order of their version,
+// the version of the schema is kept in the user_version of the db.
+type Migration struct {
+	Version     int
+	Description string
+
+	migrate func(tx *sql.Tx) error
+}
+
+// add new tables and columns as a new migration at the end. never change
+// a migration that has been released.
+var migrations = []Migration{
+	{
+		Version:     1,
+		Description: "tables of the teamserver up to 0.7",
+		migrate: func(tx *sql.Tx) error {
+			if err := initTables(tx); err != nil {
+				return err
+			}
+
+			return tables(tx)
+		},
+	},
+	{
+		Version:     2,
+		Description: "index the event history by time for the replay to new operators",
+		migrate: func(tx *sql.Tx) error {
+			_, err := tx.Exec(`CREATE INDEX IF NOT EXISTS "TS_Events_Time" ON "TS_Events" ("Time");`)
+			return err
+		},
+	},
+	{
+		Version:     3,
+		Description: "notification preferences of the operators",
+		migrate: func(tx *sql.Tx) error {
+			_, err := tx.Exec(`CREATE TABLE IF NOT EXISTS "TS_NotifyPreferences" ("User" text UNIQUE, "Muted" text, "Digest" text, "QuietHours" text, "TimeZone" text, "Time" text);`)
+			return err
+		},
+	},
+	{
+		Version:     4,
+		Description: "saved dynamic agent groups",
+		migrate: func(tx *sql.Tx) error {
+			if _, err := tx.Exec(`CREATE TABLE IF NOT EXISTS "TS_AgentGroups" ("Name" text UNIQUE, "Workspace" text, "Description" text, "Tag" text, "Subnet" text, "Filter" text, "User" text, "Time" text);`); err != nil {
+				return err
+			}
+
+			/* operators only notified of the agents of some groups */
+			return column(tx, "TS_NotifyPreferences", "Groups", `text DEFAULT ''`)
+		},
+	},
+	{
+		Version:     5,
+		Description: "listener templates",
+		migrate: func(tx *sql.Tx) error {
+			_, err := tx.Exec(`CREATE TABLE IF NOT EXISTS "TS_ListenerTemplates" ("Name" text UNIQUE, "Workspace" text, "Protocol" text, "Config" text, "Source" text, "User" text, "Time" text);`)
+			return err
+		},
+	},
+	{
+		Version:     6,
+		Description: "index of the files agents found searching hosts",
+		migrate: func(tx *sql.Tx) error {
+			if _, err := tx.Exec(`CREATE TABLE IF NOT EXISTS "TS_Files" ("Workspace" text, "Host" text COLLATE NOCASE, "Path" text COLLATE NOCASE, "Name" text COLLATE NOCASE, "Size" integer, "Modified" text, "Attributes" integer, "Content" text, "AgentID" text, "Time" text, UNIQUE("Workspace", "Host", "Path"));`); err != nil {
+				return err
+			}
+
+			_, err := tx.Exec(`CREATE INDEX IF NOT EXISTS "TS_Files_Name" ON "TS_Files" ("Name");`)
+			return err
+		},
+	},
+	{
+		Version:     7,
+		Description: "timeline entries the operators add by hand",
+		migrate: func(tx *sql.Tx) error {
+			_, err := tx.Exec(`CREATE TABLE IF NOT EXISTS "TS_Timeline" ("ID" integer PRIMARY KEY AUTOINCREMENT, "Workspace" text, "Time" integer, "Category" text, "Text" text, "AgentID" text, "User" text, "Created" text);`)
+			return err
+		},
+	},
+	{
+		Version:     8,
+		Description: "evidence the operators attach to tasks and timeline entries",
+		migrate: func(tx *sql.Tx) error {
+			_, err := tx.Exec(`CREATE TABLE IF NOT EXISTS "TS_Evidence" ("ID" integer PRIMARY KEY AUTOINCREMENT, "Workspace" text, "TaskID" text, "TimelineID" integer, "AgentID" text, "Name" text, "Description" text, "Path" text, "Size" integer, "Hash" text, "User" text, "Time" text);`)
+			return err
+		},
+	},
+	{
+		Version:     9,
+		Description: "detection annotations of the tasks",
+		migrate: func(tx *sql.Tx) error {
+			_, err := tx.Exec(`CREATE TABLE IF NOT EXISTS "TS_Detections" ("TaskID" text PRIMARY KEY, "Workspace" text, "AgentID" text, "Detected" text, "Time" integer, "Reference" text, "User" text, "Updated" text);`)
+			return err
+		},
+	},
+}
+
+// SchemaVersion
+// returns the latest version of the schema this teamserver knows.
+func SchemaVersion() int {
+	return migrations[len(migrations)-1].Version
+}
+
+// Version
+// returns the version of the schema of the db. 0 for a new db or one
+// older than the migrations.
+func (db *DB) Version() (int, error) {
+	var Version int
+
+	err := db.db.QueryRow(`PRAGMA user_version`).Scan(&Version)
+
+	return Version, err
+}
+
+// Migrate
+// applies the migrations the db is missing in a single transaction.
+// Nothing gets changed if one of them fails. An existing db gets backed
+// up (<db>.v<version>.bak) before. With DryRun the migrations run but
+// get rolled back. Returns the applied (or pending) migrations.
+func (db *DB) Migrate(DryRun bool) ([]Migration, error) {
+	var Pending []Migration
+
+	Version, err := db.Version()
+	if err != nil {
+		return nil, err
+	}
+
+	if Version > SchemaVersion() {
+		return nil, fmt.Errorf("the db has schema version %v, this teamserver only knows up to %v. upgrade the teamserver", Version, SchemaVersion())
+	}
+
+	for _, Migration := range migrations {
+		if Migration.Version > Version {
+			Pending = append(Pending, Migration)
+		}
+	}
+
+	if len(Pending) == 0 {
+		return nil, nil
+	}
+
+	if db.existed && !DryRun {
+		if err = db.backup(fmt.Sprintf("%v.v%v.bak", db.path, Version)); err != nil {
+			return nil, fmt.Errorf("failed to back up the db: %w", err)
+		}
+	}
+
+	tx, err := db.db.Begin()
+	if err != nil {
+		return nil, err
+	}
+
+	for _, Migration := range Pending {
+		if err = Migration.migrate(tx); err != nil {
+			tx.Rollback()
+			return nil, fmt.Errorf("migration %v (%v) failed: %w", Migration.Version, Migration.Description, err)
+		}
+
+		if _, err = tx.Exec(fmt.Sprintf(`PRAGMA user_version = %d`, Migration.Version)); err != nil {
+			tx.Rollback()
+			return nil, err
+		}
+	}
+
+	if DryRun {
+		return Pending, tx.Rollback()
+	}
+
+	return Pending, tx.Commit()
+}
+
+// Migrated
+// returns the migrations applied when opening the db.
+func (db *DB) Migrated() []Migration {
+	return db.migrated
+}
+
+// backup
+// writes a consistent copy of the db to the path.
+func (db *DB) backup(Path string) error {
+	/* VACUUM INTO refuses to overwrite */
+	if err := os.Remove(Path); err != nil && !os.IsNotExist(err) {
+		return err
+	}
+
+	_, err := db.db.Exec(`VACUUM INTO ?`, Path)
+
+	return err
+}
+
+func (db *DB) Close() error {
+	return db.db.Close()
+}
@@ -0,0 +1,56 @@
+package db
+
+// NotifyPreferences
+// what an operator wants to be notified of and when. Muted and Groups
+// are json lists of the muted event types and of the agent groups.
+type NotifyPreferences struct {
+	User       string
+	Muted      string
+	Digest     string
+	QuietHours string
+	TimeZone   string
+	Groups     string
+	Time       string
+}
+
+// NotifyPreferencesSet
+// adds or replaces the notification preferences of the operator.
+func (db *DB) NotifyPreferencesSet(Preferences NotifyPreferences) error {
+	stmt, err := db.db.Prepare("INSERT OR REPLACE INTO TS_NotifyPreferences (User, Muted, Digest, QuietHours, TimeZone, Groups, Time) values(?,?,?,?,?,?,?)")
+	if err != nil {
+		return err
+	}
+
+	_, err = stmt.Exec(Preferences.User, Preferences.Muted, Preferences.Digest, Preferences.QuietHours, Preferences.TimeZone, Preferences.Groups, Preferences.Time)
+	if err != nil {
+		return err
+	}
+
+	stmt.Close()
+
+	return nil
+}
+
+// NotifyPreferences
+// returns the notification preferences of every operator that set some.
+func (db *DB) NotifyPreferences() []NotifyPreferences {
+	var Preferences []NotifyPreferences
+
+	query, err := db.db.Query("SELECT User, Muted, Digest, QuietHours, TimeZone, Groups, Time FROM TS_NotifyPreferences")
+	if err != nil {
+		return nil
+	}
+	defer query.Close()
+
+	for query.Next() {
+		var Preference NotifyPreferences
+
+		if err = query.Scan(&Preference.User, &Preference.Muted, &Preference.Digest, &Preference.QuietHours, &Preference.TimeZone, &Preference.Groups, &Preference.Time); err != nil {
+			continue
+		}
+
+		Preferences = append(Preferences, Preference)
+	}
+
+	return Preferences
+}
@@ -0,0 +1,77 @@
+package db
+
+import "strings"
+
+func (db *DB) PayloadAdd(Name, Listener, Hosts, Arch, Format, User, Time, Preset, Config string) error {
+	stmt, err := db.db.Prepare("INSERT INTO TS_Payloads (Name, Listener, Hosts, Arch, Format, User, Time, Note, Preset, Config) values(?,?,?,?,?,?,?,?,?,?)")
+	if err != nil {
+		return err
+	}
+
+	_, err = stmt.Exec(Name, Listener, Hosts, Arch, Format, User, Time, "", Preset, Config)
+	if err != nil {
+		return err
+	}
+
+	stmt.Close()
+
+	return nil
+}
+
+// PayloadAnnotate
+// appends the note to every payload that has been built with the specified host.
+// returns how many payloads have been annotated.
+func (db *DB) PayloadAnnotate(Host, Note string) (int64, error) {
+	stmt, err := db.db.Prepare("UPDATE TS_Payloads SET Note = CASE WHEN Note = '' THEN ? ELSE Note || '; ' || ? END WHERE (', ' || Hosts || ', ') LIKE ? ESCAPE '\\'")
+	if err != nil {
+		return 0, err
+	}
+	defer stmt.Close()
+
+	/* hosts with a _ or % would match others */
+	Result, err := stmt.Exec(Note, Note, "%, "+likeEscape(Host)+", %")
+	if err != nil {
+		return 0, err
+	}
+
+	return Result.RowsAffected()
+}
+
+func (db *DB) PayloadAll() []map[string]string {
+	var Payloads []map[string]string
+
+	query, err := db.db.Query("SELECT Name, Listener, Hosts, Arch, Format, User, Time, Note, Preset, Config FROM TS_Payloads")
+	if err != nil {
+		return nil
+	}
+	defer query.Close()
+
+	for query.Next() {
+		var Name, Listener, Hosts, Arch, Format, User, Time, Note, Preset, Config string
+
+		if err = query.Scan(&Name, &Listener, &Hosts, &Arch, &Format, &User, &Time, &Note, &Preset, &Config); err != nil {
+			continue
+		}
+
+		Payloads = append(Payloads, map[string]string{
+			"Name":     Name,
+			"Listener": Listener,
+			"Hosts":    Hosts,
+			"Arch":     Arch,
+			"Format":   Format,
+			"User":     User,
+			"Time":     Time,
+			"Note":     Note,
+			"Preset":   Preset,
+			"Config":   Config,
+		})
+	}
+
+	return Payloads
+}
+
+// likeEscape
+// escapes the wildcards of a value matched literally by a LIKE pattern.
+func likeEscape(Value string) string {
+	return strings.NewReplacer(`\`, `\\`, `%`, `\%`, `_`, `\_`).Replace(Value)
+}
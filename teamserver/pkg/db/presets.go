@@ -0,0 +1,85 @@
+package db
+
+type BuildPreset struct {
+	Name      string
+	AgentType string
+	Listener  string
+	Arch      string
+	Format    string
+	Config    string
+	User      string
+	Time      string
+}
+
+// PresetSet
+// adds or replaces the named payload build preset.
+func (db *DB) PresetSet(Preset BuildPreset) error {
+	stmt, err := db.db.Prepare("INSERT OR REPLACE INTO TS_BuildPresets (Name, AgentType, Listener, Arch, Format, Config, User, Time) values(?,?,?,?,?,?,?,?)")
+	if err != nil {
+		return err
+	}
+
+	_, err = stmt.Exec(Preset.Name, Preset.AgentType, Preset.Listener, Preset.Arch, Preset.Format, Preset.Config, Preset.User, Preset.Time)
+	if err != nil {
+		return err
+	}
+
+	stmt.Close()
+
+	return nil
+}
+
+// PresetRemove
+// removes the named payload build preset.
+func (db *DB) PresetRemove(Name string) (bool, error) {
+	stmt, err := db.db.Prepare("DELETE FROM TS_BuildPresets WHERE Name = ?")
+	if err != nil {
+		return false, err
+	}
+	defer stmt.Close()
+
+	Result, err := stmt.Exec(Name)
+	if err != nil {
+		return false, err
+	}
+
+	Rows, err := Result.RowsAffected()
+
+	return Rows > 0, err
+}
+
+// PresetGet
+// returns the named payload build preset.
+func (db *DB) PresetGet(Name string) (BuildPreset, error) {
+	var Preset BuildPreset
+
+	err := db.db.QueryRow("SELECT Name, AgentType, Listener, Arch, Format, Config, User, Time FROM TS_BuildPresets WHERE Name = ?", Name).Scan(
+		&Preset.Name, &Preset.AgentType, &Preset.Listener, &Preset.Arch, &Preset.Format, &Preset.Config, &Preset.User, &Preset.Time,
+	)
+
+	return Preset, err
+}
+
+// Presets
+// returns every payload build preset ordered by name.
+func (db *DB) Presets() []BuildPreset {
+	var Presets []BuildPreset
+
+	query, err := db.db.Query("SELECT Name, AgentType, Listener, Arch, Format, Config, User, Time FROM TS_BuildPresets ORDER BY Name")
+	if err != nil {
+		return nil
+	}
+	defer query.Close()
+
+	for query.Next() {
+		var Preset BuildPreset
+
+		if err = query.Scan(&Preset.Name, &Preset.AgentType, &Preset.Listener, &Preset.Arch, &Preset.Format, &Preset.Config, &Preset.User, &Preset.Time); err != nil {
+			continue
+		}
+
+		Presets = append(Presets, Preset)
+	}
+
+	return Presets
+}
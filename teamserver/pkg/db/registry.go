@@ -0,0 +1,170 @@
+package db
+
+import "Havoc/pkg/seal"
+
+// RegistryRecord
+// subkey or value of a registry key of a host an agent queried.
+type RegistryRecord struct {
+	Workspace string
+	Host      string
+	Hive      string
+	Path      string
+	Name      string
+	// the name is a subkey of the key instead of a value
+	Subkey  bool
+	Type    string
+	Data    string
+	AgentID string
+	Time    string
+}
+
+// RegistryChange
+// modification of the registry of a host an operator made.
+type RegistryChange struct {
+	ID        int
+	Workspace string
+	Host      string
+	AgentID   string
+	User      string
+	Operation string
+	Hive      string
+	Path      string
+	Name      string
+	View      string
+	Type      string
+	Data      string
+	// the value existed before the change
+	Existed      bool
+	PreviousType string
+	PreviousData string
+	Status       int
+	Time         string
+}
+
+// RegistryKeySet
+// replaces the records of the key with the subkeys and values of its enumeration.
+func (db *DB) RegistryKeySet(Workspace, Host, Hive, Path string, Records []RegistryRecord) error {
+	tx, err := db.db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	if _, err = tx.Exec("DELETE FROM TS_Registry WHERE Workspace = ? AND Host = ? AND Hive = ? AND Path = ?", Workspace, Host, Hive, Path); err != nil {
+		return err
+	}
+
+	stmt, err := tx.Prepare("INSERT OR REPLACE INTO TS_Registry (Workspace, Host, Hive, Path, Name, Subkey, Type, Data, AgentID, Time) values(?,?,?,?,?,?,?,?,?,?)")
+	if err != nil {
+		return err
+	}
+	defer stmt.Close()
+
+	for _, Record := range Records {
+		if _, err = stmt.Exec(Record.Workspace, Record.Host, Record.Hive, Record.Path, Record.Name, Record.Subkey, Record.Type, seal.SealString(Record.Data), Record.AgentID, Record.Time); err != nil {
+			return err
+		}
+	}
+
+	return tx.Commit()
+}
+
+// RegistryValueSet
+// adds the value record or replaces the known one.
+func (db *DB) RegistryValueSet(Record RegistryRecord) error {
+	stmt, err := db.db.Prepare("INSERT OR REPLACE INTO TS_Registry (Workspace, Host, Hive, Path, Name, Subkey, Type, Data, AgentID, Time) values(?,?,?,?,?,0,?,?,?,?)")
+	if err != nil {
+		return err
+	}
+	defer stmt.Close()
+
+	_, err = stmt.Exec(Record.Workspace, Record.Host, Record.Hive, Record.Path, Record.Name, Record.Type, seal.SealString(Record.Data), Record.AgentID, Record.Time)
+
+	return err
+}
+
+// RegistryValueRemove
+// removes the record of a value that doesn't exist (anymore).
+func (db *DB) RegistryValueRemove(Workspace, Host, Hive, Path, Name string) error {
+	_, err := db.db.Exec("DELETE FROM TS_Registry WHERE Workspace = ? AND Host = ? AND Hive = ? AND Path = ? AND Name = ? AND Subkey = 0", Workspace, Host, Hive, Path, Name)
+
+	return err
+}
+
+// Registry
+// returns the records of the host (every host if empty) below the key
+// (every key if empty) ordered by key.
+func (db *DB) Registry(Host, Hive, Path string) []RegistryRecord {
+	var Records []RegistryRecord
+
+	query, err := db.db.Query(`SELECT Workspace, Host, Hive, Path, Name, Subkey, Type, Data, AgentID, Time FROM TS_Registry
+		WHERE (? = '' OR Host = ?) AND (? = '' OR Hive = ?) AND (? = '' OR Path = ? OR substr(Path, 1, length(?) + 1) = ? || '\' COLLATE NOCASE)
+		ORDER BY Host, Hive, Path, Subkey DESC, Name`, Host, Host, Hive, Hive, Path, Path, Path, Path)
+	if err != nil {
+		return nil
+	}
+	defer query.Close()
+
+	for query.Next() {
+		var Record RegistryRecord
+
+		if err = query.Scan(&Record.Workspace, &Record.Host, &Record.Hive, &Record.Path, &Record.Name, &Record.Subkey, &Record.Type, &Record.Data, &Record.AgentID, &Record.Time); err != nil {
+			continue
+		}
+
+		if err = unseal(&Record.Data); err != nil {
+			continue
+		}
+
+		Records = append(Records, Record)
+	}
+
+	return Records
+}
+
+// RegistryChangeAdd
+// logs the modification of the registry of a host.
+func (db *DB) RegistryChangeAdd(Change RegistryChange) error {
+	stmt, err := db.db.Prepare(`INSERT INTO TS_RegistryChanges (Workspace, Host, AgentID, User, Operation, Hive, Path, Name, View, Type, Data, Existed, PreviousType, PreviousData, Status, Time)
+		values(?,?,?,?,?,?,?,?,?,?,?,?,?,?,?,?)`)
+	if err != nil {
+		return err
+	}
+	defer stmt.Close()
+
+	_, err = stmt.Exec(Change.Workspace, Change.Host, Change.AgentID, Change.User, Change.Operation, Change.Hive, Change.Path, Change.Name, Change.View, Change.Type,
+		seal.SealString(Change.Data), Change.Existed, Change.PreviousType, seal.SealString(Change.PreviousData), Change.Status, Change.Time)
+
+	return err
+}
+
+// RegistryChanges
+// returns the modifications of the registry of the host (every host if
+// empty), the most recent first.
+func (db *DB) RegistryChanges(Host string) []RegistryChange {
+	var Changes []RegistryChange
+
+	query, err := db.db.Query(`SELECT ID, Workspace, Host, AgentID, User, Operation, Hive, Path, Name, View, Type, Data, Existed, PreviousType, PreviousData, Status, Time
+		FROM TS_RegistryChanges WHERE ? = '' OR Host = ? ORDER BY ID DESC`, Host, Host)
+	if err != nil {
+		return nil
+	}
+	defer query.Close()
+
+	for query.Next() {
+		var Change RegistryChange
+
+		if err = query.Scan(&Change.ID, &Change.Workspace, &Change.Host, &Change.AgentID, &Change.User, &Change.Operation, &Change.Hive, &Change.Path, &Change.Name, &Change.View,
+			&Change.Type, &Change.Data, &Change.Existed, &Change.PreviousType, &Change.PreviousData, &Change.Status, &Change.Time); err != nil {
+			continue
+		}
+
+		if err = unseal(&Change.Data, &Change.PreviousData); err != nil {
+			continue
+		}
+
+		Changes = append(Changes, Change)
+	}
+
+	return Changes
+}
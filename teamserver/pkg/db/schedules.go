@@ -0,0 +1,88 @@
+package db
+
+type Schedule struct {
+	ID      int
+	AgentID string
+	Name    string
+	// cron expression or interval (see schedule.Parse)
+	Schedule string
+	// json of the session input the job tasks the agent with
+	Command string
+	// working hours overriding the ones of the agent
+	Hours     string
+	Workspace string
+	User      string
+	Time      string
+	LastRun   string
+}
+
+// ScheduleAdd
+// adds a recurring job. returns its id.
+func (db *DB) ScheduleAdd(Schedule Schedule) (int, error) {
+	stmt, err := db.db.Prepare("INSERT INTO TS_Schedules (AgentID, Name, Schedule, Command, Hours, Workspace, User, Time, LastRun) values(?,?,?,?,?,?,?,?,?)")
+	if err != nil {
+		return 0, err
+	}
+	defer stmt.Close()
+
+	Result, err := stmt.Exec(Schedule.AgentID, Schedule.Name, Schedule.Schedule, Schedule.Command, Schedule.Hours, Schedule.Workspace, Schedule.User, Schedule.Time, Schedule.LastRun)
+	if err != nil {
+		return 0, err
+	}
+
+	ID, err := Result.LastInsertId()
+
+	return int(ID), err
+}
+
+// ScheduleRan
+// records the last run of the recurring job.
+func (db *DB) ScheduleRan(ID int, LastRun string) error {
+	stmt, err := db.db.Prepare("UPDATE TS_Schedules SET LastRun = ? WHERE ID = ?")
+	if err != nil {
+		return err
+	}
+	defer stmt.Close()
+
+	_, err = stmt.Exec(LastRun, ID)
+
+	return err
+}
+
+// ScheduleRemove
+// removes the recurring job.
+func (db *DB) ScheduleRemove(ID int) error {
+	stmt, err := db.db.Prepare("DELETE FROM TS_Schedules WHERE ID = ?")
+	if err != nil {
+		return err
+	}
+	defer stmt.Close()
+
+	_, err = stmt.Exec(ID)
+
+	return err
+}
+
+// Schedules
+// returns every recurring job.
+func (db *DB) Schedules() []Schedule {
+	var Schedules []Schedule
+
+	query, err := db.db.Query("SELECT ID, AgentID, Name, Schedule, Command, Hours, Workspace, User, Time, LastRun FROM TS_Schedules ORDER BY ID")
+	if err != nil {
+		return nil
+	}
+	defer query.Close()
+
+	for query.Next() {
+		var Schedule Schedule
+
+		if err = query.Scan(&Schedule.ID, &Schedule.AgentID, &Schedule.Name, &Schedule.Schedule, &Schedule.Command, &Schedule.Hours, &Schedule.Workspace, &Schedule.User, &Schedule.Time, &Schedule.LastRun); err != nil {
+			continue
+		}
+
+		Schedules = append(Schedules, Schedule)
+	}
+
+	return Schedules
+}
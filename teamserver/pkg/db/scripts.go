@@ -0,0 +1,82 @@
+package db
+
+type Script struct {
+	Name        string
+	Description string
+	Content     string
+	User        string
+	Time        string
+}
+
+// ScriptSet
+// adds or replaces the named agent script.
+func (db *DB) ScriptSet(Script Script) error {
+	stmt, err := db.db.Prepare("INSERT OR REPLACE INTO TS_Scripts (Name, Description, Content, User, Time) values(?,?,?,?,?)")
+	if err != nil {
+		return err
+	}
+
+	_, err = stmt.Exec(Script.Name, Script.Description, Script.Content, Script.User, Script.Time)
+	if err != nil {
+		return err
+	}
+
+	stmt.Close()
+
+	return nil
+}
+
+// ScriptRemove
+// removes the named agent script.
+func (db *DB) ScriptRemove(Name string) (bool, error) {
+	stmt, err := db.db.Prepare("DELETE FROM TS_Scripts WHERE Name = ?")
+	if err != nil {
+		return false, err
+	}
+	defer stmt.Close()
+
+	Result, err := stmt.Exec(Name)
+	if err != nil {
+		return false, err
+	}
+
+	Rows, err := Result.RowsAffected()
+
+	return Rows > 0, err
+}
+
+// ScriptGet
+// returns the named agent script.
+func (db *DB) ScriptGet(Name string) (Script, error) {
+	var Script Script
+
+	err := db.db.QueryRow("SELECT Name, Description, Content, User, Time FROM TS_Scripts WHERE Name = ?", Name).Scan(
+		&Script.Name, &Script.Description, &Script.Content, &Script.User, &Script.Time,
+	)
+
+	return Script, err
+}
+
+// Scripts
+// returns every agent script ordered by name.
+func (db *DB) Scripts() []Script {
+	var Scripts []Script
+
+	query, err := db.db.Query("SELECT Name, Description, Content, User, Time FROM TS_Scripts ORDER BY Name")
+	if err != nil {
+		return nil
+	}
+	defer query.Close()
+
+	for query.Next() {
+		var Script Script
+
+		if err = query.Scan(&Script.Name, &Script.Description, &Script.Content, &Script.User, &Script.Time); err != nil {
+			continue
+		}
+
+		Scripts = append(Scripts, Script)
+	}
+
+	return Scripts
+}
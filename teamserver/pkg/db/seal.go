@@ -0,0 +1,87 @@
+package db
+
+import (
+	"database/sql"
+	"fmt"
+
+	"Havoc/pkg/seal"
+)
+
+// columns sealed at rest if the storage is sealed
+var sealedColumns = map[string][]string{
+	"TS_Agents":          {"AESKey", "AESIv"},
+	"TS_Clipboard":       {"Text"},
+	"TS_Credentials":     {"Password", "Hash", "Certificate", "Metadata"},
+	"TS_Detections":      {"Reference"},
+	"TS_Events":          {"Package"},
+	"TS_Evidence":        {"Name", "Description"},
+	"TS_LootHashes":      {"Name"},
+	"TS_Registry":        {"Data"},
+	"TS_RegistryChanges": {"Data", "PreviousData"},
+	"TS_Snapshots":       {"Entries"},
+	"TS_Timeline":        {"Text"},
+}
+
+// unseal
+// opens the sealed columns in place.
+func unseal(Values ...*string) error {
+	for _, Value := range Values {
+		Plain, err := seal.OpenString(*Value)
+		if err != nil {
+			return err
+		}
+
+		*Value = Plain
+	}
+
+	return nil
+}
+
+// Seal
+// seals the columns written before the storage got sealed and drops
+// the plain text index of the search. Returns the count of sealed values.
+func (db *DB) Seal() (int, error) {
+	var Count = 0
+
+	for Table, Columns := range sealedColumns {
+		for _, Column := range Columns {
+			var Rows = make(map[int64]string)
+
+			query, err := db.db.Query(fmt.Sprintf(`SELECT rowid, "%v" FROM "%v" WHERE "%v" != '' AND "%v" NOT LIKE ?`, Column, Table, Column, Column), seal.STRING_PREFIX+"%")
+			if err != nil {
+				return Count, err
+			}
+
+			for query.Next() {
+				var (
+					RowID int64
+					Value sql.NullString
+				)
+
+				if err = query.Scan(&RowID, &Value); err == nil && Value.Valid {
+					Rows[RowID] = Value.String
+				}
+			}
+			query.Close()
+
+			for RowID, Value := range Rows {
+				if _, err = db.db.Exec(fmt.Sprintf(`UPDATE "%v" SET "%v" = ? WHERE rowid = ?`, Table, Column), seal.SealString(Value), RowID); err != nil {
+					return Count, err
+				}
+
+				Count++
+			}
+		}
+	}
+
+	if _, err := db.db.Exec(`DELETE FROM "TS_Search"`); err != nil {
+		return Count, err
+	}
+
+	/* the plain text is still in the free pages of the database file */
+	if _, err := db.db.Exec(`VACUUM`); err != nil {
+		return Count, err
+	}
+
+	return Count, nil
+}
@@ -0,0 +1,100 @@
+package db
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+)
+
+type SearchResult struct {
+	AgentID string
+	Type    string
+	User    string
+	Time    string
+	Snippet string
+}
+
+// SearchAdd
+// adds a task command or output to the full text index.
+func (db *DB) SearchAdd(AgentID, Type, User, Time, Content string) error {
+	stmt, err := db.search.Prepare("INSERT INTO TS_Search (AgentID, Type, User, Time, Content) values(?,?,?,?,?)")
+	if err != nil {
+		return err
+	}
+
+	_, err = stmt.Exec(AgentID, Type, User, Time, Content)
+	if err != nil {
+		return err
+	}
+
+	stmt.Close()
+
+	return nil
+}
+
+// SearchCount
+// returns the amount of indexed commands and outputs.
+func (db *DB) SearchCount() int64 {
+	var Count int64
+
+	if err := db.search.QueryRow("SELECT COUNT(*) FROM TS_Search").Scan(&Count); err != nil {
+		return 0
+	}
+
+	return Count
+}
+
+// Search
+// queries the full text index (sqlite fts query syntax) and returns
+// the matches with a highlighted snippet, newest first.
+func (db *DB) Search(Query string, Limit int) ([]SearchResult, error) {
+	var Results []SearchResult
+
+	query, err := db.search.Query("SELECT AgentID, Type, User, Time, snippet(TS_Search, '[', ']', '...', 4, 24) FROM TS_Search WHERE Content MATCH ? ORDER BY docid DESC LIMIT ?", Query, Limit)
+	if err != nil {
+		return nil, err
+	}
+	defer query.Close()
+
+	for query.Next() {
+		var Result SearchResult
+
+		if err = query.Scan(&Result.AgentID, &Result.Type, &Result.User, &Result.Time, &Result.Snippet); err != nil {
+			continue
+		}
+
+		Results = append(Results, Result)
+	}
+
+	return Results, query.Err()
+}
+
+// SearchVolatile
+// moves the full text index into memory. Used if the storage is sealed
+// as the index holds the commands and outputs in plain text. It gets
+// rebuilt from the (sealed) events on startup.
+func (db *DB) SearchVolatile() error {
+	Search, err := sql.Open("sqlite3", fmt.Sprintf("file:havoc-search-%p?mode=memory&cache=shared", db))
+	if err != nil {
+		return err
+	}
+
+	/* the in memory database is gone once its last connection closes */
+	Keep, err := Search.Conn(context.Background())
+	if err != nil {
+		Search.Close()
+		return err
+	}
+
+	_, err = Search.Exec(`CREATE VIRTUAL TABLE IF NOT EXISTS "TS_Search" USING fts4("AgentID", "Type", "User", "Time", "Content", notindexed="AgentID", notindexed="Type", notindexed="User", notindexed="Time");`)
+	if err != nil {
+		Keep.Close()
+		Search.Close()
+		return err
+	}
+
+	db.search = Search
+	db.searchKeep = Keep
+
+	return nil
+}
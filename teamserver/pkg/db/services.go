@@ -0,0 +1,114 @@
+package db
+
+// HostService
+// service or scheduled task of a host parsed from enumeration output.
+type HostService struct {
+	Workspace string
+	Host      string
+	// "service" or "task"
+	Kind      string
+	Name      string
+	Display   string
+	Path      string
+	RunAs     string
+	StartType string
+	State     string
+	AgentID   string
+	Time      string
+}
+
+// WritablePath
+// path of a host unprivileged users can write to.
+type WritablePath struct {
+	Workspace string
+	Host      string
+	Path      string
+	Principal string
+	Rights    string
+	AgentID   string
+	Time      string
+}
+
+// HostServiceSet
+// adds the service or task or updates the known one. fields the
+// enumeration didn't return keep their known value.
+func (db *DB) HostServiceSet(Service HostService) error {
+	stmt, err := db.db.Prepare(`INSERT INTO TS_HostServices (Workspace, Host, Kind, Name, Display, Path, RunAs, StartType, State, AgentID, Time) values(?,?,?,?,?,?,?,?,?,?,?)
+		ON CONFLICT(Workspace, Host, Kind, Name) DO UPDATE SET
+			Display = CASE WHEN excluded.Display = '' THEN Display ELSE excluded.Display END,
+			Path = CASE WHEN excluded.Path = '' THEN Path ELSE excluded.Path END,
+			RunAs = CASE WHEN excluded.RunAs = '' THEN RunAs ELSE excluded.RunAs END,
+			StartType = CASE WHEN excluded.StartType = '' THEN StartType ELSE excluded.StartType END,
+			State = CASE WHEN excluded.State = '' THEN State ELSE excluded.State END,
+			AgentID = excluded.AgentID, Time = excluded.Time`)
+	if err != nil {
+		return err
+	}
+	defer stmt.Close()
+
+	_, err = stmt.Exec(Service.Workspace, Service.Host, Service.Kind, Service.Name, Service.Display, Service.Path, Service.RunAs, Service.StartType, Service.State, Service.AgentID, Service.Time)
+
+	return err
+}
+
+// HostServices
+// returns the services and tasks of the host (every host if empty).
+func (db *DB) HostServices(Host string) []HostService {
+	var Services []HostService
+
+	query, err := db.db.Query("SELECT Workspace, Host, Kind, Name, Display, Path, RunAs, StartType, State, AgentID, Time FROM TS_HostServices WHERE ? = '' OR Host = ? ORDER BY Host, Kind, Name", Host, Host)
+	if err != nil {
+		return nil
+	}
+	defer query.Close()
+
+	for query.Next() {
+		var Service HostService
+
+		if err = query.Scan(&Service.Workspace, &Service.Host, &Service.Kind, &Service.Name, &Service.Display, &Service.Path, &Service.RunAs, &Service.StartType, &Service.State, &Service.AgentID, &Service.Time); err != nil {
+			continue
+		}
+
+		Services = append(Services, Service)
+	}
+
+	return Services
+}
+
+// WritablePathAdd
+// adds the path and the principal that can write to it.
+func (db *DB) WritablePathAdd(Path WritablePath) error {
+	stmt, err := db.db.Prepare("INSERT OR REPLACE INTO TS_WritablePaths (Workspace, Host, Path, Principal, Rights, AgentID, Time) values(?,?,?,?,?,?,?)")
+	if err != nil {
+		return err
+	}
+	defer stmt.Close()
+
+	_, err = stmt.Exec(Path.Workspace, Path.Host, Path.Path, Path.Principal, Path.Rights, Path.AgentID, Path.Time)
+
+	return err
+}
+
+// WritablePaths
+// returns the writable paths of the host (every host if empty).
+func (db *DB) WritablePaths(Host string) []WritablePath {
+	var Paths []WritablePath
+
+	query, err := db.db.Query("SELECT Workspace, Host, Path, Principal, Rights, AgentID, Time FROM TS_WritablePaths WHERE ? = '' OR Host = ? ORDER BY Host, Path", Host, Host)
+	if err != nil {
+		return nil
+	}
+	defer query.Close()
+
+	for query.Next() {
+		var Path WritablePath
+
+		if err = query.Scan(&Path.Workspace, &Path.Host, &Path.Path, &Path.Principal, &Path.Rights, &Path.AgentID, &Path.Time); err != nil {
+			continue
+		}
+
+		Paths = append(Paths, Path)
+	}
+
+	return Paths
+}
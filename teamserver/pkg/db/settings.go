@@ -0,0 +1,45 @@
+package db
+
+// SettingSet
+// saves a teamserver setting (key/value).
+func (db *DB) SettingSet(Key, Value string) error {
+	stmt, err := db.db.Prepare("INSERT OR REPLACE INTO TS_Settings (Key, Value) values(?,?)")
+	if err != nil {
+		return err
+	}
+
+	_, err = stmt.Exec(Key, Value)
+	if err != nil {
+		return err
+	}
+
+	stmt.Close()
+
+	return nil
+}
+
+// SettingGet
+// returns a teamserver setting. empty if it doesn't exist.
+func (db *DB) SettingGet(Key string) string {
+	var Value string
+
+	stmt, err := db.db.Prepare("SELECT Value FROM TS_Settings WHERE Key = ?")
+	if err != nil {
+		return ""
+	}
+	defer stmt.Close()
+
+	if err = stmt.QueryRow(Key).Scan(&Value); err != nil {
+		return ""
+	}
+
+	return Value
+}
+
+// SettingRemove
+// removes a teamserver setting.
+func (db *DB) SettingRemove(Key string) error {
+	_, err := db.db.Exec("DELETE FROM TS_Settings WHERE Key = ?", Key)
+
+	return err
+}
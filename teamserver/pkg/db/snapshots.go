@@ -0,0 +1,72 @@
+package db
+
+import "Havoc/pkg/seal"
+
+type Snapshot struct {
+	ID      int64
+	AgentID string
+	Command string
+	Target  string
+	Time    string
+	Entries string
+}
+
+// SnapshotAdd
+// persists the output of a repeatable command.
+func (db *DB) SnapshotAdd(AgentID, Command, Target, Time, Entries string) error {
+	stmt, err := db.db.Prepare("INSERT INTO TS_Snapshots (AgentID, Command, Target, Time, Entries) values(?,?,?,?,?)")
+	if err != nil {
+		return err
+	}
+
+	_, err = stmt.Exec(AgentID, Command, Target, Time, seal.SealString(Entries))
+	if err != nil {
+		return err
+	}
+
+	stmt.Close()
+
+	return nil
+}
+
+// Snapshots
+// returns the snapshots (without entries) of the command ordered by time.
+// An empty Command returns the snapshots of every command of the agent.
+func (db *DB) Snapshots(AgentID, Command, Target string) []Snapshot {
+	var Snapshots []Snapshot
+
+	query, err := db.db.Query("SELECT ID, AgentID, Command, Target, Time FROM TS_Snapshots WHERE AgentID = ? AND (? = '' OR (Command = ? AND Target = ?)) ORDER BY ID", AgentID, Command, Command, Target)
+	if err != nil {
+		return nil
+	}
+	defer query.Close()
+
+	for query.Next() {
+		var Snapshot Snapshot
+
+		if err = query.Scan(&Snapshot.ID, &Snapshot.AgentID, &Snapshot.Command, &Snapshot.Target, &Snapshot.Time); err != nil {
+			continue
+		}
+
+		Snapshots = append(Snapshots, Snapshot)
+	}
+
+	return Snapshots
+}
+
+// SnapshotGet
+// returns the snapshot including its entries.
+func (db *DB) SnapshotGet(ID int64) (Snapshot, error) {
+	var Snapshot Snapshot
+
+	err := db.db.QueryRow("SELECT ID, AgentID, Command, Target, Time, Entries FROM TS_Snapshots WHERE ID = ?", ID).Scan(
+		&Snapshot.ID, &Snapshot.AgentID, &Snapshot.Command, &Snapshot.Target, &Snapshot.Time, &Snapshot.Entries,
+	)
+	if err != nil {
+		return Snapshot, err
+	}
+
+	err = unseal(&Snapshot.Entries)
+
+	return Snapshot, err
+}
@@ -0,0 +1,66 @@
+package db
+
+// SSHConnection
+// ssh connection the teamserver made to a host.
+type SSHConnection struct {
+	ID        int
+	Host      string
+	Port      int
+	Username  string
+	HostKey   string
+	AgentID   string
+	Workspace string
+	User      string
+	Time      string
+}
+
+// SSHAdd
+// records the ssh connection.
+func (db *DB) SSHAdd(Connection SSHConnection) error {
+	stmt, err := db.db.Prepare("INSERT INTO TS_SSH (Host, Port, Username, HostKey, AgentID, Workspace, User, Time) values(?,?,?,?,?,?,?,?)")
+	if err != nil {
+		return err
+	}
+	defer stmt.Close()
+
+	_, err = stmt.Exec(Connection.Host, Connection.Port, Connection.Username, Connection.HostKey, Connection.AgentID, Connection.Workspace, Connection.User, Connection.Time)
+
+	return err
+}
+
+// SSHHostKey
+// returns the host key of the last connection to the host. empty if the
+// teamserver never connected to the host.
+func (db *DB) SSHHostKey(Host string, Port int) string {
+	var HostKey string
+
+	if err := db.db.QueryRow("SELECT HostKey FROM TS_SSH WHERE Host = ? AND Port = ? ORDER BY ID DESC LIMIT 1", Host, Port).Scan(&HostKey); err != nil {
+		return ""
+	}
+
+	return HostKey
+}
+
+// SSHConnections
+// returns every recorded ssh connection.
+func (db *DB) SSHConnections() []SSHConnection {
+	var Connections []SSHConnection
+
+	query, err := db.db.Query("SELECT ID, Host, Port, Username, HostKey, AgentID, Workspace, User, Time FROM TS_SSH ORDER BY ID")
+	if err != nil {
+		return nil
+	}
+	defer query.Close()
+
+	for query.Next() {
+		var Connection SSHConnection
+
+		if err = query.Scan(&Connection.ID, &Connection.Host, &Connection.Port, &Connection.Username, &Connection.HostKey, &Connection.AgentID, &Connection.Workspace, &Connection.User, &Connection.Time); err != nil {
+			continue
+		}
+
+		Connections = append(Connections, Connection)
+	}
+
+	return Connections
+}
@@ -0,0 +1,50 @@
+package db
+
+import (
+	"strings"
+)
+
+// AgentTagsSet
+// replaces the tags operators gave the agent.
+func (db *DB) AgentTagsSet(AgentID int, Tags []string) error {
+	stmt, err := db.db.Prepare("INSERT OR REPLACE INTO TS_AgentTags (AgentID, Tags) values(?,?)")
+	if err != nil {
+		return err
+	}
+
+	_, err = stmt.Exec(AgentID, strings.Join(Tags, ","))
+	if err != nil {
+		return err
+	}
+
+	stmt.Close()
+
+	return nil
+}
+
+// AgentTags
+// returns the tags of every tagged agent in the database.
+func (db *DB) AgentTags() map[int][]string {
+	var Tags = make(map[int][]string)
+
+	query, err := db.db.Query("SELECT AgentID, Tags FROM TS_AgentTags WHERE Tags != ''")
+	if err != nil {
+		return Tags
+	}
+	defer query.Close()
+
+	for query.Next() {
+		var (
+			AgentID int
+			List    string
+		)
+
+		if err = query.Scan(&AgentID, &List); err != nil {
+			continue
+		}
+
+		Tags[AgentID] = strings.Split(List, ",")
+	}
+
+	return Tags
+}
@@ -0,0 +1,85 @@
+package db
+
+type TaskTemplate struct {
+	Name        string
+	Description string
+	// json object of the session input the template renders
+	Command string
+	// json array of the typed parameters of the template
+	Parameters string
+	User       string
+	Time       string
+}
+
+// TemplateSet
+// adds or replaces the named task template.
+func (db *DB) TemplateSet(Template TaskTemplate) error {
+	stmt, err := db.db.Prepare("INSERT OR REPLACE INTO TS_TaskTemplates (Name, Description, Command, Parameters, User, Time) values(?,?,?,?,?,?)")
+	if err != nil {
+		return err
+	}
+
+	_, err = stmt.Exec(Template.Name, Template.Description, Template.Command, Template.Parameters, Template.User, Template.Time)
+	if err != nil {
+		return err
+	}
+
+	stmt.Close()
+
+	return nil
+}
+
+// TemplateRemove
+// removes the named task template.
+func (db *DB) TemplateRemove(Name string) (bool, error) {
+	stmt, err := db.db.Prepare("DELETE FROM TS_TaskTemplates WHERE Name = ?")
+	if err != nil {
+		return false, err
+	}
+	defer stmt.Close()
+
+	Result, err := stmt.Exec(Name)
+	if err != nil {
+		return false, err
+	}
+
+	Rows, err := Result.RowsAffected()
+
+	return Rows > 0, err
+}
+
+// TemplateGet
+// returns the named task template.
+func (db *DB) TemplateGet(Name string) (TaskTemplate, error) {
+	var Template TaskTemplate
+
+	err := db.db.QueryRow("SELECT Name, Description, Command, Parameters, User, Time FROM TS_TaskTemplates WHERE Name = ?", Name).Scan(
+		&Template.Name, &Template.Description, &Template.Command, &Template.Parameters, &Template.User, &Template.Time,
+	)
+
+	return Template, err
+}
+
+// Templates
+// returns every task template ordered by name.
+func (db *DB) Templates() []TaskTemplate {
+	var Templates []TaskTemplate
+
+	query, err := db.db.Query("SELECT Name, Description, Command, Parameters, User, Time FROM TS_TaskTemplates ORDER BY Name")
+	if err != nil {
+		return nil
+	}
+	defer query.Close()
+
+	for query.Next() {
+		var Template TaskTemplate
+
+		if err = query.Scan(&Template.Name, &Template.Description, &Template.Command, &Template.Parameters, &Template.User, &Template.Time); err != nil {
+			continue
+		}
+
+		Templates = append(Templates, Template)
+	}
+
+	return Templates
+}
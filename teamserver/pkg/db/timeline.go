@@ -0,0 +1,101 @@
+package db
+
+import "Havoc/pkg/seal"
+
+// TimelineEntry
+// an entry of the engagement timeline an operator added by hand (phish
+// sent, call with the client, detection observed). Time is when it
+// happened in unix time, Created when it got added.
+type TimelineEntry struct {
+	ID        int
+	Workspace string
+	Time      int64
+	Category  string
+	Text      string
+	AgentID   string
+	User      string
+	Created   string
+}
+
+// TimelineAdd
+// adds the entry to the timeline and returns its id.
+func (db *DB) TimelineAdd(Entry TimelineEntry) (int, error) {
+	stmt, err := db.db.Prepare("INSERT INTO TS_Timeline (Workspace, Time, Category, Text, AgentID, User, Created) values(?,?,?,?,?,?,?)")
+	if err != nil {
+		return 0, err
+	}
+	defer stmt.Close()
+
+	Result, err := stmt.Exec(Entry.Workspace, Entry.Time, Entry.Category, seal.SealString(Entry.Text), Entry.AgentID, Entry.User, Entry.Created)
+	if err != nil {
+		return 0, err
+	}
+
+	ID, err := Result.LastInsertId()
+
+	return int(ID), err
+}
+
+// TimelineRemove
+// removes the entry from the timeline.
+func (db *DB) TimelineRemove(ID int) (bool, error) {
+	stmt, err := db.db.Prepare("DELETE FROM TS_Timeline WHERE ID = ?")
+	if err != nil {
+		return false, err
+	}
+	defer stmt.Close()
+
+	Result, err := stmt.Exec(ID)
+	if err != nil {
+		return false, err
+	}
+
+	Rows, err := Result.RowsAffected()
+
+	return Rows > 0, err
+}
+
+// TimelineGet
+// returns the entry with the id.
+func (db *DB) TimelineGet(ID int) (TimelineEntry, error) {
+	var Entry TimelineEntry
+
+	err := db.db.QueryRow("SELECT ID, Workspace, Time, Category, Text, AgentID, User, Created FROM TS_Timeline WHERE ID = ?", ID).Scan(
+		&Entry.ID, &Entry.Workspace, &Entry.Time, &Entry.Category, &Entry.Text, &Entry.AgentID, &Entry.User, &Entry.Created,
+	)
+	if err != nil {
+		return Entry, err
+	}
+
+	err = unseal(&Entry.Text)
+
+	return Entry, err
+}
+
+// Timeline
+// returns the entries of the timeline ordered by when they happened.
+func (db *DB) Timeline() []TimelineEntry {
+	var Entries []TimelineEntry
+
+	query, err := db.db.Query("SELECT ID, Workspace, Time, Category, Text, AgentID, User, Created FROM TS_Timeline ORDER BY Time, ID")
+	if err != nil {
+		return nil
+	}
+	defer query.Close()
+
+	for query.Next() {
+		var Entry TimelineEntry
+
+		if err = query.Scan(&Entry.ID, &Entry.Workspace, &Entry.Time, &Entry.Category, &Entry.Text, &Entry.AgentID, &Entry.User, &Entry.Created); err != nil {
+			continue
+		}
+
+		if err = unseal(&Entry.Text); err != nil {
+			continue
+		}
+
+		Entries = append(Entries, Entry)
+	}
+
+	return Entries
+}
@@ -0,0 +1,77 @@
+package db
+
+// AgentTransport
+// the agent started to call back over the listener. Previous is the
+// listener it failed over from (empty on its first callback).
+type AgentTransport struct {
+	AgentID  int
+	Listener string
+	Previous string
+	Host     string
+	Time     string
+}
+
+// AgentTransportAdd
+// records the listener the agent calls back over from now on.
+func (db *DB) AgentTransportAdd(Transport AgentTransport) error {
+	stmt, err := db.db.Prepare("INSERT INTO TS_AgentTransports (AgentID, Listener, Previous, Host, Time) values(?,?,?,?,?)")
+	if err != nil {
+		return err
+	}
+	defer stmt.Close()
+
+	_, err = stmt.Exec(Transport.AgentID, Transport.Listener, Transport.Previous, Transport.Host, Transport.Time)
+
+	return err
+}
+
+// AgentTransports
+// returns the transport history of the agent, oldest first.
+func (db *DB) AgentTransports(AgentID int) []AgentTransport {
+	var Transports []AgentTransport
+
+	query, err := db.db.Query("SELECT AgentID, Listener, Previous, Host, Time FROM TS_AgentTransports WHERE AgentID = ? ORDER BY ID", AgentID)
+	if err != nil {
+		return nil
+	}
+	defer query.Close()
+
+	for query.Next() {
+		var Transport AgentTransport
+
+		if err = query.Scan(&Transport.AgentID, &Transport.Listener, &Transport.Previous, &Transport.Host, &Transport.Time); err != nil {
+			continue
+		}
+
+		Transports = append(Transports, Transport)
+	}
+
+	return Transports
+}
+
+// AgentTransportsCurrent
+// returns the listener every agent in the database called back over last.
+func (db *DB) AgentTransportsCurrent() map[int]string {
+	var Current = make(map[int]string)
+
+	query, err := db.db.Query("SELECT AgentID, Listener FROM TS_AgentTransports ORDER BY ID")
+	if err != nil {
+		return Current
+	}
+	defer query.Close()
+
+	for query.Next() {
+		var (
+			AgentID  int
+			Listener string
+		)
+
+		if err = query.Scan(&AgentID, &Listener); err != nil {
+			continue
+		}
+
+		Current[AgentID] = Listener
+	}
+
+	return Current
+}
@@ -0,0 +1,125 @@
+package db
+
+// UploadRule
+// blocks uploads of files to the targets or holds them back for an
+// approval. Hashes are comma separated md5, sha1 or sha256 hex digests.
+type UploadRule struct {
+	Name     string
+	Action   string
+	Category string
+	Hashes   string
+	Pattern  string
+	Content  string
+	Reason   string
+	User     string
+	Time     string
+}
+
+// UploadAudit
+// an upload an upload rule matched and what happened to it.
+type UploadAudit struct {
+	ID        int
+	Workspace string
+	AgentID   string
+	User      string
+	TaskID    string
+	File      string
+	// sha256 of the file
+	Hash     string
+	Size     int64
+	Rule     string
+	Category string
+	// blocked, held, approved, denied or expired
+	Decision  string
+	DecidedBy string
+	Time      string
+}
+
+// UploadRuleSet
+// adds or replaces the named upload rule.
+func (db *DB) UploadRuleSet(Rule UploadRule) error {
+	stmt, err := db.db.Prepare("INSERT OR REPLACE INTO TS_UploadRules (Name, Action, Category, Hashes, Pattern, Content, Reason, User, Time) values(?,?,?,?,?,?,?,?,?)")
+	if err != nil {
+		return err
+	}
+	defer stmt.Close()
+
+	_, err = stmt.Exec(Rule.Name, Rule.Action, Rule.Category, Rule.Hashes, Rule.Pattern, Rule.Content, Rule.Reason, Rule.User, Rule.Time)
+
+	return err
+}
+
+// UploadRuleRemove
+// removes the named upload rule.
+func (db *DB) UploadRuleRemove(Name string) (bool, error) {
+	Result, err := db.db.Exec("DELETE FROM TS_UploadRules WHERE Name = ?", Name)
+	if err != nil {
+		return false, err
+	}
+
+	Rows, err := Result.RowsAffected()
+
+	return Rows > 0, err
+}
+
+// UploadRules
+// returns every upload rule ordered by name.
+func (db *DB) UploadRules() []UploadRule {
+	var Rules []UploadRule
+
+	query, err := db.db.Query("SELECT Name, Action, Category, Hashes, Pattern, Content, Reason, User, Time FROM TS_UploadRules ORDER BY Name")
+	if err != nil {
+		return nil
+	}
+	defer query.Close()
+
+	for query.Next() {
+		var Rule UploadRule
+
+		if err = query.Scan(&Rule.Name, &Rule.Action, &Rule.Category, &Rule.Hashes, &Rule.Pattern, &Rule.Content, &Rule.Reason, &Rule.User, &Rule.Time); err != nil {
+			continue
+		}
+
+		Rules = append(Rules, Rule)
+	}
+
+	return Rules
+}
+
+// UploadAuditAdd
+// records what happened to an upload an upload rule matched.
+func (db *DB) UploadAuditAdd(Audit UploadAudit) error {
+	stmt, err := db.db.Prepare("INSERT INTO TS_UploadAudit (Workspace, AgentID, User, TaskID, File, Hash, Size, Rule, Category, Decision, DecidedBy, Time) values(?,?,?,?,?,?,?,?,?,?,?,?)")
+	if err != nil {
+		return err
+	}
+	defer stmt.Close()
+
+	_, err = stmt.Exec(Audit.Workspace, Audit.AgentID, Audit.User, Audit.TaskID, Audit.File, Audit.Hash, Audit.Size, Audit.Rule, Audit.Category, Audit.Decision, Audit.DecidedBy, Audit.Time)
+
+	return err
+}
+
+// UploadAudits
+// returns the audit entries of the uploads, the latest first.
+func (db *DB) UploadAudits(Limit int) []UploadAudit {
+	var Audits []UploadAudit
+
+	query, err := db.db.Query("SELECT ID, Workspace, AgentID, User, TaskID, File, Hash, Size, Rule, Category, Decision, DecidedBy, Time FROM TS_UploadAudit ORDER BY ID DESC LIMIT ?", Limit)
+	if err != nil {
+		return nil
+	}
+	defer query.Close()
+
+	for query.Next() {
+		var Audit UploadAudit
+
+		if err = query.Scan(&Audit.ID, &Audit.Workspace, &Audit.AgentID, &Audit.User, &Audit.TaskID, &Audit.File, &Audit.Hash, &Audit.Size, &Audit.Rule, &Audit.Category, &Audit.Decision, &Audit.DecidedBy, &Audit.Time); err != nil {
+			continue
+		}
+
+		Audits = append(Audits, Audit)
+	}
+
+	return Audits
+}
@@ -0,0 +1,46 @@
+package db
+
+// AgentWorkspaceSet
+// saves the workspace the agent belongs to.
+func (db *DB) AgentWorkspaceSet(AgentID int, Workspace string) error {
+	stmt, err := db.db.Prepare("INSERT OR REPLACE INTO TS_AgentWorkspaces (AgentID, Workspace) values(?,?)")
+	if err != nil {
+		return err
+	}
+
+	_, err = stmt.Exec(AgentID, Workspace)
+	if err != nil {
+		return err
+	}
+
+	stmt.Close()
+
+	return nil
+}
+
+// AgentWorkspaces
+// returns the workspace of every agent in the database.
+func (db *DB) AgentWorkspaces() map[int]string {
+	var Workspaces = make(map[int]string)
+
+	query, err := db.db.Query("SELECT AgentID, Workspace FROM TS_AgentWorkspaces")
+	if err != nil {
+		return Workspaces
+	}
+	defer query.Close()
+
+	for query.Next() {
+		var (
+			AgentID   int
+			Workspace string
+		)
+
+		if err = query.Scan(&AgentID, &Workspace); err != nil {
+			continue
+		}
+
+		Workspaces[AgentID] = Workspace
+	}
+
+	return Workspaces
+}
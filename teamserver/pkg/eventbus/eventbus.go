@@ -0,0 +1,193 @@
+package eventbus
+
+import (
+	"encoding/json"
+	"fmt"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"Havoc/pkg/logger"
+	"Havoc/pkg/packager"
+)
+
+// types of the events published on the bus
+const (
+	// an agent registered
+	SESSION_NEW = "session.new"
+	// an agent sent the result of a task of an operator
+	TASK_COMPLETE = "task.complete"
+	// a download, screenshot or credential got stored
+	LOOT_ADDED = "loot.added"
+	// content scanning found secrets in a download or command output
+	CREDENTIAL_FOUND = "credential.found"
+	// a listener failed
+	LISTENER_DOWN = "listener.down"
+	// an ephemeral listener stopped after its time to live or the agent it waited for
+	LISTENER_EXPIRED = "listener.expired"
+	// a certificate of a monitored domain showed up in the transparency logs
+	CERTIFICATE_LOGGED = "certificate.logged"
+	// an agent reaches its kill date soon
+	KILLDATE_IMMINENT = "killdate.imminent"
+	// the first agent of a workspace on a network (the /24 of its internal address)
+	NETWORK_NEW = "network.new"
+	// a routine of the teamserver crashed
+	TEAMSERVER_ERROR = "teamserver.error"
+
+	// a package for the connected operators
+	OPERATOR_PACKAGE = "operator.package"
+)
+
+// Types are the typed events integrations consume. Subscribing without
+// types subscribes to these but not to the packages of the operators.
+var Types = []string{SESSION_NEW, TASK_COMPLETE, LOOT_ADDED, CREDENTIAL_FOUND, LISTENER_DOWN, LISTENER_EXPIRED, CERTIFICATE_LOGGED, KILLDATE_IMMINENT, NETWORK_NEW, TEAMSERVER_ERROR}
+
+// events an asynchronous consumer queues before the bus drops them
+const QUEUE_SIZE = 1024
+
+// Event
+// a notification of the teamserver.
+type Event struct {
+	Type      string
+	Time      time.Time
+	Workspace string
+	Data      map[string]any
+
+	// package for the operators (OPERATOR_PACKAGE) and the client it isn't sent to
+	Package *packager.Package
+	Except  string
+}
+
+// Json
+// encodes the event for the consumers forwarding it out of the teamserver.
+func (e Event) Json() ([]byte, error) {
+	return json.Marshal(map[string]any{
+		"Type":      e.Type,
+		"Time":      e.Time.UTC().Format("2006-01-02T15:04:05Z"),
+		"Workspace": e.Workspace,
+		"Data":      e.Data,
+	})
+}
+
+// Consumer
+// gets the events it subscribed to.
+type Consumer interface {
+	Consume(Event Event) error
+}
+
+// ConsumerFunc
+// turns a function into a Consumer.
+type ConsumerFunc func(Event Event) error
+
+func (f ConsumerFunc) Consume(Event Event) error {
+	return f(Event)
+}
+
+type subscriber struct {
+	Name     string
+	Types    map[string]bool
+	Consumer Consumer
+
+	// nil for synchronous consumers
+	Queue   chan Event
+	Dropped atomic.Int64
+}
+
+// Bus
+// publishes the events of the teamserver to the consumers subscribed to them.
+type Bus struct {
+	mutex       sync.RWMutex
+	subscribers []*subscriber
+
+	// runs the routines of the asynchronous consumers. restarts them if they crash
+	Supervise func(Source string, Routine func())
+}
+
+func NewBus() *Bus {
+	return &Bus{
+		Supervise: func(Source string, Routine func()) { Routine() },
+	}
+}
+
+func (b *Bus) subscribe(Name string, Consumer Consumer, Queue chan Event, Subscribed []string) *subscriber {
+	var Subscriber = &subscriber{
+		Name:     Name,
+		Types:    make(map[string]bool),
+		Consumer: Consumer,
+		Queue:    Queue,
+	}
+
+	if len(Subscribed) == 0 {
+		Subscribed = Types
+	}
+
+	for _, Type := range Subscribed {
+		Subscriber.Types[Type] = true
+	}
+
+	b.mutex.Lock()
+	b.subscribers = append(b.subscribers, Subscriber)
+	b.mutex.Unlock()
+
+	logger.Debug(fmt.Sprintf("Event bus: %v subscribed to %v", Name, Subscribed))
+
+	return Subscriber
+}
+
+// Subscribe
+// subscribes the consumer to the events of the types (the typed events
+// if none are given). It consumes them in its own routine in the order
+// they got published, so a slow consumer doesn't hold the teamserver up.
+func (b *Bus) Subscribe(Name string, Consumer Consumer, Types ...string) {
+	var Subscriber = b.subscribe(Name, Consumer, make(chan Event, QUEUE_SIZE), Types)
+
+	go b.Supervise("event bus consumer "+Name, func() {
+		for Event := range Subscriber.Queue {
+			if err := Subscriber.Consumer.Consume(Event); err != nil {
+				logger.Debug(fmt.Sprintf("Event bus: %v failed to consume %v: %v", Name, Event.Type, err))
+			}
+		}
+	})
+}
+
+// SubscribeSync
+// subscribes the consumer to the events of the types. It consumes them
+// while they get published, which keeps them in order with whatever the
+// publisher does next.
+func (b *Bus) SubscribeSync(Name string, Consumer Consumer, Types ...string) {
+	b.subscribe(Name, Consumer, nil, Types)
+}
+
+// Publish
+// passes the event on to the consumers subscribed to its type.
+func (b *Bus) Publish(Event Event) {
+	if Event.Time.IsZero() {
+		Event.Time = time.Now()
+	}
+
+	b.mutex.RLock()
+	defer b.mutex.RUnlock()
+
+	for _, Subscriber := range b.subscribers {
+		if !Subscriber.Types[Event.Type] {
+			continue
+		}
+
+		if Subscriber.Queue == nil {
+			if err := Subscriber.Consumer.Consume(Event); err != nil {
+				logger.Debug(fmt.Sprintf("Event bus: %v failed to consume %v: %v", Subscriber.Name, Event.Type, err))
+			}
+
+			continue
+		}
+
+		select {
+		case Subscriber.Queue <- Event:
+		default:
+			/* never block the publisher on a consumer that can't keep up */
+			if Dropped := Subscriber.Dropped.Add(1); Dropped%QUEUE_SIZE == 1 {
+				logger.Warn(fmt.Sprintf("Event bus: %v can't keep up, dropped %v events", Subscriber.Name, Dropped))
+			}
+		}
+	}
+}
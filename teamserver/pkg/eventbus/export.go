@@ -0,0 +1,86 @@
+package eventbus
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"net"
+	"os"
+	"time"
+)
+
+// timeout of the connections of the exporters and their requests
+const EXPORT_TIMEOUT = 10 * time.Second
+
+// ExportOptions
+// where an exporter (nats or kafka) publishes the events to.
+type ExportOptions struct {
+	// nats://host:4222 (tls:// for tls) or host:9092 for kafka
+	Servers []string
+	// subject prefix (nats) or topic (kafka)
+	Subject string
+
+	// user and password (kafka: sasl plain) or token (nats)
+	Username string
+	Password string
+	Token    string
+
+	TLS bool
+	// pem file of the certificate authority of the servers. default is the system pool
+	CACert string
+}
+
+// dial
+// connects to the server, over tls if asked to.
+func (o ExportOptions) dial(Address string, TLS bool) (net.Conn, error) {
+	Conn, err := net.DialTimeout("tcp", Address, EXPORT_TIMEOUT)
+	if err != nil {
+		return nil, err
+	}
+
+	if !TLS {
+		return Conn, nil
+	}
+
+	return o.tls(Conn, Address)
+}
+
+// tls
+// upgrades the connection to tls.
+func (o ExportOptions) tls(Conn net.Conn, Address string) (net.Conn, error) {
+	var Config = &tls.Config{MinVersion: tls.VersionTLS12}
+
+	Host, _, err := net.SplitHostPort(Address)
+	if err != nil {
+		Host = Address
+	}
+
+	Config.ServerName = Host
+
+	if len(o.CACert) > 0 {
+		Pem, err := os.ReadFile(o.CACert)
+		if err != nil {
+			Conn.Close()
+			return nil, err
+		}
+
+		Config.RootCAs = x509.NewCertPool()
+		if !Config.RootCAs.AppendCertsFromPEM(Pem) {
+			Conn.Close()
+			return nil, errors.New("no certificate in " + o.CACert)
+		}
+	}
+
+	var Client = tls.Client(Conn, Config)
+
+	Client.SetDeadline(time.Now().Add(EXPORT_TIMEOUT))
+
+	if err = Client.Handshake(); err != nil {
+		Conn.Close()
+		return nil, err
+	}
+
+	Client.SetDeadline(time.Time{})
+
+	return Client, nil
+}
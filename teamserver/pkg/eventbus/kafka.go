@@ -0,0 +1,543 @@
+package eventbus
+
+import (
+	"bufio"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"hash/crc32"
+	"hash/fnv"
+	"io"
+	"net"
+	"strconv"
+	"sync"
+	"time"
+
+	"Havoc/pkg/logger"
+)
+
+// api keys and the versions of the kafka requests the exporter sends
+const (
+	kafkaProduce          = 0
+	kafkaMetadata         = 3
+	kafkaSaslHandshake    = 17
+	kafkaSaslAuthenticate = 36
+
+	kafkaClientId = "havoc-teamserver"
+
+	// biggest response the exporter reads
+	kafkaMaxResponse = 16 << 20
+)
+
+var kafkaCrc = crc32.MakeTable(crc32.Castagnoli)
+
+// Kafka
+// publishes events as records of a kafka topic (default havoc). Records are
+// keyed by the agent (or the type for events without an agent), so the
+// events of an agent stay in order on one partition.
+type Kafka struct {
+	Options ExportOptions
+
+	mutex       sync.Mutex
+	correlation int32
+	conns       map[string]*kafkaConn
+
+	// leaders of the partitions of the topic. refreshed after an error
+	brokers map[int32]string
+	leaders []int32
+}
+
+type kafkaConn struct {
+	net.Conn
+	reader *bufio.Reader
+}
+
+func NewKafka(Options ExportOptions) (*Kafka, error) {
+	var Kafka = &Kafka{
+		Options: Options,
+		conns:   make(map[string]*kafkaConn),
+	}
+
+	if len(Options.Servers) == 0 {
+		return nil, errors.New("no kafka broker")
+	}
+
+	if len(Options.Subject) == 0 {
+		Kafka.Options.Subject = SYSLOG_TAG
+	}
+
+	/* fail early on a wrong address or credentials */
+	if err := Kafka.metadata(); err != nil {
+		Kafka.close()
+		return nil, err
+	}
+
+	return Kafka, nil
+}
+
+func (k *Kafka) Consume(Event Event) error {
+	var Key = Event.Type
+
+	if AgentID, ok := Event.Data["AgentID"].(string); ok && len(AgentID) > 0 {
+		Key = AgentID
+	}
+
+	Message, err := Event.Json()
+	if err != nil {
+		return err
+	}
+
+	k.mutex.Lock()
+	defer k.mutex.Unlock()
+
+	/* retry once with fresh metadata. the leader may have moved */
+	for Try := 0; Try < 2; Try++ {
+		if k.leaders == nil {
+			if err = k.metadata(); err != nil {
+				k.close()
+				continue
+			}
+		}
+
+		if err = k.produce(Event.Time, []byte(Key), Message); err == nil {
+			return nil
+		}
+
+		k.close()
+	}
+
+	return err
+}
+
+// close
+// closes the connections to the brokers and forgets the metadata.
+func (k *Kafka) close() {
+	for Address, Conn := range k.conns {
+		Conn.Close()
+		delete(k.conns, Address)
+	}
+
+	k.brokers = nil
+	k.leaders = nil
+}
+
+// metadata
+// looks the leaders of the partitions of the topic up.
+func (k *Kafka) metadata() error {
+	var (
+		Request  = kafkaBuffer{}
+		Response *kafkaReader
+		err      error
+	)
+
+	/* metadata v1: creates the topic if the brokers auto create topics */
+	Request.int32(1)
+	Request.string(k.Options.Subject)
+
+	for _, Server := range k.Options.Servers {
+		if Response, err = k.request(Server, kafkaMetadata, 1, Request); err == nil {
+			break
+		}
+
+		logger.Debug(fmt.Sprintf("Kafka broker %v: %v", Server, err))
+	}
+
+	if err != nil {
+		return err
+	}
+
+	var Brokers = make(map[int32]string)
+
+	for Count := Response.int32(); Count > 0 && Response.err == nil; Count-- {
+		var (
+			NodeID = Response.int32()
+			Host   = Response.string()
+			Port   = Response.int32()
+		)
+
+		Response.string() // rack
+
+		Brokers[NodeID] = net.JoinHostPort(Host, strconv.Itoa(int(Port)))
+	}
+
+	Response.int32() // controller
+
+	var Leaders []int32
+
+	for Topics := Response.int32(); Topics > 0 && Response.err == nil; Topics-- {
+		var (
+			Error = Response.int16()
+			Name  = Response.string()
+		)
+
+		Response.int8() // internal
+
+		var Partitions = make([]int32, Response.int32())
+
+		for i := 0; i < len(Partitions) && Response.err == nil; i++ {
+			Response.int16() // error of the partition
+
+			var Index = Response.int32()
+
+			Partitions[i] = Response.int32()
+
+			Response.array() // replicas
+			Response.array() // in sync replicas
+
+			if Index != int32(i) {
+				return fmt.Errorf("kafka partition %v of %v out of order", Index, Name)
+			}
+		}
+
+		if Name != k.Options.Subject {
+			continue
+		}
+
+		if Error != 0 {
+			return fmt.Errorf("kafka topic %v: error code %v", Name, Error)
+		}
+
+		Leaders = Partitions
+	}
+
+	if Response.err != nil {
+		return Response.err
+	}
+
+	if len(Leaders) == 0 {
+		return fmt.Errorf("kafka topic %v has no partition", k.Options.Subject)
+	}
+
+	k.brokers = Brokers
+	k.leaders = Leaders
+
+	return nil
+}
+
+// produce
+// writes the record to the leader of the partition of its key.
+func (k *Kafka) produce(Time time.Time, Key, Value []byte) error {
+	var (
+		Hash      = fnv.New32a()
+		Partition int32
+		Request   = kafkaBuffer{}
+	)
+
+	Hash.Write(Key)
+
+	Partition = int32(Hash.Sum32() % uint32(len(k.leaders)))
+
+	Broker, ok := k.brokers[k.leaders[Partition]]
+	if !ok {
+		return fmt.Errorf("kafka partition %v has no leader", Partition)
+	}
+
+	/* produce v3: no transaction, acknowledged by the leader */
+	Request.int16(-1)
+	Request.int16(1)
+	Request.int32(int32(EXPORT_TIMEOUT / time.Millisecond))
+	Request.int32(1)
+	Request.string(k.Options.Subject)
+	Request.int32(1)
+	Request.int32(Partition)
+	Request.bytes(kafkaBatch(Time, Key, Value))
+
+	Response, err := k.request(Broker, kafkaProduce, 3, Request)
+	if err != nil {
+		return err
+	}
+
+	for Topics := Response.int32(); Topics > 0 && Response.err == nil; Topics-- {
+		Response.string()
+
+		for Partitions := Response.int32(); Partitions > 0 && Response.err == nil; Partitions-- {
+			Response.int32()
+
+			if Error := Response.int16(); Error != 0 && Response.err == nil {
+				return fmt.Errorf("kafka broker %v refused the record: error code %v", Broker, Error)
+			}
+
+			Response.int64() // offset
+			Response.int64() // append time
+		}
+	}
+
+	return Response.err
+}
+
+// kafkaBatch
+// encodes a record batch (magic 2) of one record.
+func kafkaBatch(Time time.Time, Key, Value []byte) []byte {
+	var (
+		Record    = kafkaBuffer{}
+		Batch     = kafkaBuffer{}
+		Timestamp = Time.UnixMilli()
+	)
+
+	Record.int8(0)   // attributes
+	Record.varint(0) // timestamp delta
+	Record.varint(0) // offset delta
+	Record.varint(int64(len(Key)))
+	Record = append(Record, Key...)
+	Record.varint(int64(len(Value)))
+	Record = append(Record, Value...)
+	Record.varint(0) // headers
+
+	/* everything after the crc. checksummed with crc32c */
+	Batch.int16(0) // attributes: no compression
+	Batch.int32(0) // last offset delta
+	Batch.int64(Timestamp)
+	Batch.int64(Timestamp)
+	Batch.int64(-1) // producer id
+	Batch.int16(-1) // producer epoch
+	Batch.int32(-1) // base sequence
+	Batch.int32(1)
+	Batch.varint(int64(len(Record)))
+	Batch = append(Batch, Record...)
+
+	var Header = kafkaBuffer{}
+
+	Header.int64(0)                     // base offset
+	Header.int32(int32(len(Batch) + 9)) // length after this field
+	Header.int32(-1)                    // partition leader epoch
+	Header.int8(2)                      // magic
+	Header.int32(int32(crc32.Checksum(Batch, kafkaCrc)))
+
+	return append(Header, Batch...)
+}
+
+// request
+// sends the request to the broker and reads its response.
+func (k *Kafka) request(Broker string, Key, Version int16, Body kafkaBuffer) (*kafkaReader, error) {
+	Conn, err := k.conn(Broker)
+	if err != nil {
+		return nil, err
+	}
+
+	Response, err := k.exchange(Conn, Key, Version, Body)
+	if err != nil {
+		/* the stream is out of sync after a failed exchange */
+		Conn.Close()
+		delete(k.conns, Broker)
+	}
+
+	return Response, err
+}
+
+func (k *Kafka) exchange(Conn *kafkaConn, Key, Version int16, Body kafkaBuffer) (*kafkaReader, error) {
+	var (
+		Request     = kafkaBuffer{}
+		Correlation = k.correlation
+	)
+
+	k.correlation++
+
+	Request.int32(0)
+	Request.int16(Key)
+	Request.int16(Version)
+	Request.int32(Correlation)
+	Request.string(kafkaClientId)
+	Request = append(Request, Body...)
+
+	binary.BigEndian.PutUint32(Request, uint32(len(Request)-4))
+
+	Conn.SetDeadline(time.Now().Add(EXPORT_TIMEOUT))
+	defer Conn.SetDeadline(time.Time{})
+
+	if _, err := Conn.Write(Request); err != nil {
+		return nil, err
+	}
+
+	var Size = make([]byte, 4)
+
+	if _, err := io.ReadFull(Conn.reader, Size); err != nil {
+		return nil, err
+	}
+
+	var Length = binary.BigEndian.Uint32(Size)
+
+	if Length < 4 || Length > kafkaMaxResponse {
+		return nil, fmt.Errorf("kafka response of %v bytes", Length)
+	}
+
+	var Response = &kafkaReader{data: make([]byte, Length)}
+
+	if _, err := io.ReadFull(Conn.reader, Response.data); err != nil {
+		return nil, err
+	}
+
+	if Response.int32() != Correlation {
+		return nil, errors.New("kafka response to another request")
+	}
+
+	return Response, nil
+}
+
+// conn
+// connects (and authenticates) to the broker or reuses the connection to it.
+func (k *Kafka) conn(Broker string) (*kafkaConn, error) {
+	if Conn, ok := k.conns[Broker]; ok {
+		return Conn, nil
+	}
+
+	Raw, err := k.Options.dial(Broker, k.Options.TLS)
+	if err != nil {
+		return nil, err
+	}
+
+	var Conn = &kafkaConn{Conn: Raw, reader: bufio.NewReader(Raw)}
+
+	if len(k.Options.Username) > 0 {
+		if err = k.authenticate(Conn); err != nil {
+			Conn.Close()
+			return nil, fmt.Errorf("kafka broker %v: %v", Broker, err)
+		}
+	}
+
+	k.conns[Broker] = Conn
+
+	return Conn, nil
+}
+
+// authenticate
+// authenticates with sasl plain.
+func (k *Kafka) authenticate(Conn *kafkaConn) error {
+	var Request = kafkaBuffer{}
+
+	Request.string("PLAIN")
+
+	Response, err := k.exchange(Conn, kafkaSaslHandshake, 1, Request)
+	if err != nil {
+		return err
+	}
+
+	if Error := Response.int16(); Error != 0 {
+		return fmt.Errorf("sasl plain isn't enabled: error code %v", Error)
+	}
+
+	Request = kafkaBuffer{}
+	Request.bytes([]byte("\x00" + k.Options.Username + "\x00" + k.Options.Password))
+
+	if Response, err = k.exchange(Conn, kafkaSaslAuthenticate, 0, Request); err != nil {
+		return err
+	}
+
+	if Error := Response.int16(); Error != 0 {
+		return fmt.Errorf("authentication failed: %v", Response.string())
+	}
+
+	return Response.err
+}
+
+// kafkaBuffer
+// encodes the big endian fields of the kafka protocol.
+type kafkaBuffer []byte
+
+func (b *kafkaBuffer) int8(Value int8) {
+	*b = append(*b, byte(Value))
+}
+
+func (b *kafkaBuffer) int16(Value int16) {
+	*b = binary.BigEndian.AppendUint16(*b, uint16(Value))
+}
+
+func (b *kafkaBuffer) int32(Value int32) {
+	*b = binary.BigEndian.AppendUint32(*b, uint32(Value))
+}
+
+func (b *kafkaBuffer) int64(Value int64) {
+	*b = binary.BigEndian.AppendUint64(*b, uint64(Value))
+}
+
+// varint
+// zigzag encoded, as the fields of the records.
+func (b *kafkaBuffer) varint(Value int64) {
+	*b = binary.AppendVarint(*b, Value)
+}
+
+func (b *kafkaBuffer) string(Value string) {
+	b.int16(int16(len(Value)))
+	*b = append(*b, Value...)
+}
+
+func (b *kafkaBuffer) bytes(Value []byte) {
+	b.int32(int32(len(Value)))
+	*b = append(*b, Value...)
+}
+
+// kafkaReader
+// decodes the fields of a kafka response. The first field out of
+// bounds sets err, every field after it reads as zero.
+type kafkaReader struct {
+	data []byte
+	err  error
+}
+
+func (r *kafkaReader) next(Size int) []byte {
+	if r.err != nil {
+		return nil
+	}
+
+	if Size < 0 || Size > len(r.data) {
+		r.err = errors.New("kafka response too short")
+		return nil
+	}
+
+	var Field = r.data[:Size]
+
+	r.data = r.data[Size:]
+
+	return Field
+}
+
+func (r *kafkaReader) int8() int8 {
+	if Field := r.next(1); Field != nil {
+		return int8(Field[0])
+	}
+
+	return 0
+}
+
+func (r *kafkaReader) int16() int16 {
+	if Field := r.next(2); Field != nil {
+		return int16(binary.BigEndian.Uint16(Field))
+	}
+
+	return 0
+}
+
+func (r *kafkaReader) int32() int32 {
+	if Field := r.next(4); Field != nil {
+		return int32(binary.BigEndian.Uint32(Field))
+	}
+
+	return 0
+}
+
+func (r *kafkaReader) int64() int64 {
+	if Field := r.next(8); Field != nil {
+		return int64(binary.BigEndian.Uint64(Field))
+	}
+
+	return 0
+}
+
+// string
+// reads a (nullable) string. null reads as empty.
+func (r *kafkaReader) string() string {
+	var Length = r.int16()
+
+	if Length < 0 {
+		return ""
+	}
+
+	return string(r.next(int(Length)))
+}
+
+// array
+// skips an array of int32.
+func (r *kafkaReader) array() {
+	if Count := r.int32(); Count > 0 {
+		r.next(int(Count) * 4)
+	}
+}
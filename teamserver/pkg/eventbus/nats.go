@@ -0,0 +1,217 @@
+package eventbus
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+
+	"Havoc/pkg/logger"
+)
+
+// Nats
+// publishes events to a nats server under <Subject>.<type of the event>
+// (eg: havoc.session.new).
+type Nats struct {
+	Options ExportOptions
+
+	mutex  sync.Mutex
+	conn   net.Conn
+	writer *bufio.Writer
+	next   int
+}
+
+func NewNats(Options ExportOptions) (*Nats, error) {
+	var Nats = &Nats{Options: Options}
+
+	if len(Options.Servers) == 0 {
+		return nil, errors.New("no nats server")
+	}
+
+	if len(Options.Subject) == 0 {
+		Nats.Options.Subject = SYSLOG_TAG
+	}
+
+	/* fail early on a wrong address or credentials */
+	if err := Nats.connect(); err != nil {
+		return nil, err
+	}
+
+	return Nats, nil
+}
+
+// connect
+// connects to the next server of the list.
+func (n *Nats) connect() error {
+	var (
+		Server = n.Options.Servers[n.next%len(n.Options.Servers)]
+		TLS    = n.Options.TLS
+		Info   struct {
+			TLSRequired bool `json:"tls_required"`
+		}
+	)
+
+	n.next++
+
+	if Url, err := url.Parse(Server); err == nil && len(Url.Host) > 0 {
+		Server = Url.Host
+		TLS = TLS || Url.Scheme == "tls"
+	}
+
+	Conn, err := n.Options.dial(Server, false)
+	if err != nil {
+		return err
+	}
+
+	Conn.SetDeadline(time.Now().Add(EXPORT_TIMEOUT))
+
+	/* the server greets with its info. tls starts after it */
+	var Reader = bufio.NewReader(Conn)
+
+	Line, err := Reader.ReadString('\n')
+	if err != nil {
+		Conn.Close()
+		return err
+	}
+
+	if !strings.HasPrefix(Line, "INFO ") {
+		Conn.Close()
+		return fmt.Errorf("%v isn't a nats server", Server)
+	}
+
+	if err = json.Unmarshal([]byte(strings.TrimPrefix(Line, "INFO ")), &Info); err != nil {
+		Conn.Close()
+		return err
+	}
+
+	if TLS || Info.TLSRequired {
+		if Conn, err = n.Options.tls(Conn, Server); err != nil {
+			return err
+		}
+
+		Conn.SetDeadline(time.Now().Add(EXPORT_TIMEOUT))
+		Reader = bufio.NewReader(Conn)
+	}
+
+	Connect, err := json.Marshal(map[string]any{
+		"verbose":    false,
+		"pedantic":   false,
+		"name":       "havoc teamserver",
+		"lang":       "go",
+		"protocol":   1,
+		"user":       n.Options.Username,
+		"pass":       n.Options.Password,
+		"auth_token": n.Options.Token,
+	})
+	if err != nil {
+		Conn.Close()
+		return err
+	}
+
+	/* the pong confirms the server accepted the connect */
+	if _, err = Conn.Write([]byte("CONNECT " + string(Connect) + "\r\nPING\r\n")); err != nil {
+		Conn.Close()
+		return err
+	}
+
+	for {
+		if Line, err = Reader.ReadString('\n'); err != nil {
+			Conn.Close()
+			return err
+		}
+
+		Line = strings.TrimSpace(Line)
+
+		if strings.HasPrefix(Line, "-ERR") {
+			Conn.Close()
+			return fmt.Errorf("nats server %v refused the connection: %v", Server, strings.TrimSpace(strings.TrimPrefix(Line, "-ERR")))
+		}
+
+		if Line == "PONG" {
+			break
+		}
+	}
+
+	Conn.SetDeadline(time.Time{})
+
+	n.conn = Conn
+	n.writer = bufio.NewWriter(Conn)
+
+	go n.read(Conn, Reader)
+
+	logger.Debug("Connected to nats server " + Server)
+
+	return nil
+}
+
+// read
+// answers the pings of the server till the connection closes.
+func (n *Nats) read(Conn net.Conn, Reader *bufio.Reader) {
+	for {
+		Line, err := Reader.ReadString('\n')
+		if err != nil {
+			break
+		}
+
+		switch Line = strings.TrimSpace(Line); {
+
+		case Line == "PING":
+			n.mutex.Lock()
+			if n.conn == Conn {
+				n.writer.WriteString("PONG\r\n")
+				n.writer.Flush()
+			}
+			n.mutex.Unlock()
+
+		case strings.HasPrefix(Line, "-ERR"):
+			logger.Error("Nats server: " + strings.TrimSpace(strings.TrimPrefix(Line, "-ERR")))
+
+		}
+	}
+
+	n.mutex.Lock()
+	if n.conn == Conn {
+		n.conn.Close()
+		n.conn = nil
+	}
+	n.mutex.Unlock()
+}
+
+func (n *Nats) Consume(Event Event) error {
+	Message, err := Event.Json()
+	if err != nil {
+		return err
+	}
+
+	n.mutex.Lock()
+	defer n.mutex.Unlock()
+
+	/* one reconnect per event. the bus drops the events while the servers are down */
+	for Try := 0; Try < 2; Try++ {
+		if n.conn == nil {
+			if err = n.connect(); err != nil {
+				continue
+			}
+		}
+
+		n.conn.SetWriteDeadline(time.Now().Add(EXPORT_TIMEOUT))
+
+		fmt.Fprintf(n.writer, "PUB %v.%v %v\r\n", n.Options.Subject, Event.Type, len(Message))
+		n.writer.Write(Message)
+		n.writer.WriteString("\r\n")
+
+		if err = n.writer.Flush(); err == nil {
+			return nil
+		}
+
+		n.conn.Close()
+		n.conn = nil
+	}
+
+	return err
+}
@@ -0,0 +1,65 @@
+package eventbus
+
+import (
+	"errors"
+	"log/syslog"
+	"net/url"
+)
+
+// default tag of the messages sent to syslog
+const SYSLOG_TAG = "havoc"
+
+// Syslog
+// forwards events to a syslog server as json.
+type Syslog struct {
+	Writer *syslog.Writer
+}
+
+// NewSyslog
+// connects to the syslog server at Address (udp://host:514 or
+// tcp://host:514). An empty address uses the syslog of the host.
+func NewSyslog(Address, Tag string) (*Syslog, error) {
+	var (
+		Network string
+		Host    string
+		err     error
+	)
+
+	if len(Tag) == 0 {
+		Tag = SYSLOG_TAG
+	}
+
+	if len(Address) > 0 {
+		Url, err := url.Parse(Address)
+		if err != nil {
+			return nil, err
+		}
+
+		if Url.Scheme != "udp" && Url.Scheme != "tcp" {
+			return nil, errors.New("syslog address has to be udp://host:port or tcp://host:port")
+		}
+
+		Network, Host = Url.Scheme, Url.Host
+	}
+
+	var Syslog = new(Syslog)
+
+	if Syslog.Writer, err = syslog.Dial(Network, Host, syslog.LOG_INFO|syslog.LOG_DAEMON, Tag); err != nil {
+		return nil, err
+	}
+
+	return Syslog, nil
+}
+
+func (s *Syslog) Consume(Event Event) error {
+	Message, err := Event.Json()
+	if err != nil {
+		return err
+	}
+
+	if Event.Type == LISTENER_DOWN || Event.Type == KILLDATE_IMMINENT {
+		return s.Writer.Warning(string(Message))
+	}
+
+	return s.Writer.Info(string(Message))
+}
@@ -0,0 +1,54 @@
+package events
+
+import (
+	"time"
+
+	"Havoc/pkg/packager"
+)
+
+var Batches batches
+
+func (batches) List(Batches any) packager.Package {
+	var Package packager.Package
+
+	Package.Head.Event = packager.Type.Batch.Type
+	Package.Head.Time = time.Now().Format("02/01/2006 15:04:05")
+	Package.Head.OneTime = "true"
+
+	Package.Body.SubEvent = packager.Type.Batch.List
+	Package.Body.Info = map[string]any{
+		"Batches": Batches,
+	}
+
+	return Package
+}
+
+func (batches) Result(Result any) packager.Package {
+	var Package packager.Package
+
+	Package.Head.Event = packager.Type.Batch.Type
+	Package.Head.Time = time.Now().Format("02/01/2006 15:04:05")
+	Package.Head.OneTime = "true"
+
+	Package.Body.SubEvent = packager.Type.Batch.Result
+	Package.Body.Info = map[string]any{
+		"Result": Result,
+	}
+
+	return Package
+}
+
+func (batches) Tags(Tags any) packager.Package {
+	var Package packager.Package
+
+	Package.Head.Event = packager.Type.Batch.Type
+	Package.Head.Time = time.Now().Format("02/01/2006 15:04:05")
+	Package.Head.OneTime = "true"
+
+	Package.Body.SubEvent = packager.Type.Batch.Tags
+	Package.Body.Info = map[string]any{
+		"Tags": Tags,
+	}
+
+	return Package
+}
@@ -0,0 +1,58 @@
+package events
+
+import (
+	"time"
+
+	"Havoc/pkg/packager"
+)
+
+var Bundle bundles
+
+func (bundles) Export(Name, Data string) packager.Package {
+	var Package packager.Package
+
+	Package.Head.Event = packager.Type.Bundle.Type
+	Package.Head.Time = time.Now().Format("02/01/2006 15:04:05")
+	Package.Head.OneTime = "true"
+
+	Package.Body.SubEvent = packager.Type.Bundle.Export
+	Package.Body.Info = map[string]any{
+		"Name":   Name,
+		"Bundle": Data,
+	}
+
+	return Package
+}
+
+func (bundles) Import(Name, Listener, Signer string, Payload map[string]any) packager.Package {
+	var Package packager.Package
+
+	Package.Head.Event = packager.Type.Bundle.Type
+	Package.Head.Time = time.Now().Format("02/01/2006 15:04:05")
+	Package.Head.OneTime = "true"
+
+	Package.Body.SubEvent = packager.Type.Bundle.Import
+	Package.Body.Info = map[string]any{
+		"Name":     Name,
+		"Listener": Listener,
+		"Signer":   Signer,
+		"Payload":  Payload,
+	}
+
+	return Package
+}
+
+func (bundles) Key(PublicKey string) packager.Package {
+	var Package packager.Package
+
+	Package.Head.Event = packager.Type.Bundle.Type
+	Package.Head.Time = time.Now().Format("02/01/2006 15:04:05")
+	Package.Head.OneTime = "true"
+
+	Package.Body.SubEvent = packager.Type.Bundle.Key
+	Package.Body.Info = map[string]any{
+		"PublicKey": PublicKey,
+	}
+
+	return Package
+}
@@ -0,0 +1,24 @@
+package events
+
+import (
+	"time"
+
+	"Havoc/pkg/packager"
+)
+
+var Clipboard clipboard
+
+func (clipboard) History(Entries any) packager.Package {
+	var Package packager.Package
+
+	Package.Head.Event = packager.Type.Clipboard.Type
+	Package.Head.Time = time.Now().Format("02/01/2006 15:04:05")
+	Package.Head.OneTime = "true"
+
+	Package.Body.SubEvent = packager.Type.Clipboard.History
+	Package.Body.Info = map[string]any{
+		"Entries": Entries,
+	}
+
+	return Package
+}
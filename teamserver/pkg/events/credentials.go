@@ -0,0 +1,71 @@
+package events
+
+import (
+	"time"
+
+	"Havoc/pkg/packager"
+)
+
+var Credentials creds
+
+func (creds) List(Credentials any) packager.Package {
+	var Package packager.Package
+
+	Package.Head.Event = packager.Type.Credentials.Type
+	Package.Head.Time = time.Now().Format("02/01/2006 15:04:05")
+	Package.Head.OneTime = "true"
+
+	Package.Body.SubEvent = packager.Type.Credentials.List
+	Package.Body.Info = map[string]any{
+		"Credentials": Credentials,
+	}
+
+	return Package
+}
+
+func (creds) Cookies(Format, Cookies string) packager.Package {
+	var Package packager.Package
+
+	Package.Head.Event = packager.Type.Credentials.Type
+	Package.Head.Time = time.Now().Format("02/01/2006 15:04:05")
+	Package.Head.OneTime = "true"
+
+	Package.Body.SubEvent = packager.Type.Credentials.Cookies
+	Package.Body.Info = map[string]any{
+		"Format":  Format,
+		"Cookies": Cookies,
+	}
+
+	return Package
+}
+
+func (creds) Export(Format string, Jobs any) packager.Package {
+	var Package packager.Package
+
+	Package.Head.Event = packager.Type.Credentials.Type
+	Package.Head.Time = time.Now().Format("02/01/2006 15:04:05")
+	Package.Head.OneTime = "true"
+
+	Package.Body.SubEvent = packager.Type.Credentials.Export
+	Package.Body.Info = map[string]any{
+		"Format": Format,
+		"Jobs":   Jobs,
+	}
+
+	return Package
+}
+
+func (creds) Import(Cracked int) packager.Package {
+	var Package packager.Package
+
+	Package.Head.Event = packager.Type.Credentials.Type
+	Package.Head.Time = time.Now().Format("02/01/2006 15:04:05")
+	Package.Head.OneTime = "true"
+
+	Package.Body.SubEvent = packager.Type.Credentials.Import
+	Package.Body.Info = map[string]any{
+		"Cracked": Cracked,
+	}
+
+	return Package
+}
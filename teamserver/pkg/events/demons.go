@@ -8,6 +8,7 @@ import (
 	"time"
 
 	"Havoc/pkg/agent"
+	"Havoc/pkg/keyring"
 	"Havoc/pkg/logr"
 	"Havoc/pkg/packager"
 )
@@ -18,9 +19,12 @@ var Demons demons
 
 func (demons) NewDemon(Agent *agent.Agent) packager.Package {
 	var (
-		Package    packager.Package
+		Package       packager.Package
+		AESKey, AESIv = Agent.Encryption.Keys()
 	)
 
+	defer keyring.Wipe(AESKey, AESIv)
+
 	Package.Head.Event   = packager.Type.Session.Type
 	Package.Head.Time    = time.Now().Format("02/01/2006 15:04:05")
 	Package.Head.OneTime = "true"
@@ -34,13 +38,22 @@ func (demons) NewDemon(Agent *agent.Agent) packager.Package {
 		"DomainName": Agent.Info.DomainName,
 		"Elevated": Agent.Info.Elevated,
 		"Encryption": map[string]interface{}{
-			"AESKey": base64.StdEncoding.EncodeToString(Agent.Encryption.AESKey),
-			"AESIv":  base64.StdEncoding.EncodeToString(Agent.Encryption.AESIv),
+			"AESKey": base64.StdEncoding.EncodeToString(AESKey),
+			"AESIv":  base64.StdEncoding.EncodeToString(AESIv),
 		},
 		"InternalIP": Agent.Info.InternalIP,
 		"ExternalIP": Agent.Info.ExternalIP,
+		"ProxyPath": Agent.Info.ProxyPath,
+		"Capabilities": Agent.CapabilityNames(),
+		"Protocol": Agent.Info.Protocol,
+		"CallbackHost": Agent.Info.CallbackHost,
+		"Transport": Agent.Info.Transport,
+		"Burned": Agent.Info.Burned,
+		"Workspace": Agent.Info.Workspace,
 		"FirstCallIn": Agent.Info.FirstCallIn,
 		"LastCallIn": Agent.Info.LastCallIn,
+		"TimeZone": Agent.Info.TimeZone,
+		"UTCOffset": Agent.Info.UTCOffset,
 		"Hostname": Agent.Info.Hostname,
 		"Listener": "null", // ?
 		"MagicValue": fmt.Sprintf("%x", Agent.Info.MagicValue),
@@ -54,6 +67,7 @@ func (demons) NewDemon(Agent *agent.Agent) packager.Package {
 		},
 		"PortFwds": []string{},
 		"ProcessArch": Agent.Info.ProcessArch,
+		"Wow64": Agent.IsWow64(),
 		"ProcessName": Agent.Info.ProcessName,
 		"ProcessPID": fmt.Sprintf("%d", Agent.Info.ProcessPID),
 		"ProcessPPID": fmt.Sprintf("%d", Agent.Info.ProcessPPID),
@@ -132,3 +146,18 @@ func (demons) MarkAs(AgentID, Mark string) packager.Package {
 
 	return Package
 }
+
+func (demons) Remove(AgentID string) packager.Package {
+	var Package packager.Package
+
+	Package.Head.Event = packager.Type.Session.Type
+	Package.Head.Time = time.Now().Format("02/01/2006 15:04:05")
+	Package.Head.OneTime = "true"
+
+	Package.Body.SubEvent = packager.Type.Session.Remove
+	Package.Body.Info = make(map[string]interface{})
+
+	Package.Body.Info["AgentID"] = AgentID
+
+	return Package
+}
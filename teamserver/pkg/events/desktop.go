@@ -0,0 +1,66 @@
+package events
+
+import (
+	"encoding/base64"
+	"image"
+	"time"
+
+	"Havoc/pkg/packager"
+)
+
+var Desktop desktop
+
+// Frame
+// region of the desktop of the agent that changed (png).
+func (desktop) Frame(AgentID string, Width, Height int, Region image.Rectangle, Image []byte, Frame, Pending int) packager.Package {
+	var Package packager.Package
+
+	Package.Head.Event = packager.Type.Desktop.Type
+	Package.Head.Time = time.Now().Format("02/01/2006 15:04:05")
+	Package.Head.OneTime = "true"
+
+	Package.Body.SubEvent = packager.Type.Desktop.Frame
+	Package.Body.Info = map[string]any{
+		"AgentID": AgentID,
+		"Width":   Width,
+		"Height":  Height,
+		"X":       Region.Min.X,
+		"Y":       Region.Min.Y,
+		"Image":   base64.StdEncoding.EncodeToString(Image),
+		"Frame":   Frame,
+		"Pending": Pending,
+	}
+
+	return Package
+}
+
+func (desktop) List(Views any) packager.Package {
+	var Package packager.Package
+
+	Package.Head.Event = packager.Type.Desktop.Type
+	Package.Head.Time = time.Now().Format("02/01/2006 15:04:05")
+	Package.Head.OneTime = "true"
+
+	Package.Body.SubEvent = packager.Type.Desktop.List
+	Package.Body.Info = map[string]any{
+		"Views": Views,
+	}
+
+	return Package
+}
+
+func (desktop) Stopped(AgentID, Recording string) packager.Package {
+	var Package packager.Package
+
+	Package.Head.Event = packager.Type.Desktop.Type
+	Package.Head.Time = time.Now().Format("02/01/2006 15:04:05")
+	Package.Head.OneTime = "true"
+
+	Package.Body.SubEvent = packager.Type.Desktop.Stopped
+	Package.Body.Info = map[string]any{
+		"AgentID":   AgentID,
+		"Recording": Recording,
+	}
+
+	return Package
+}
@@ -0,0 +1,54 @@
+package events
+
+import (
+	"time"
+
+	"Havoc/pkg/packager"
+)
+
+var Detection detection
+
+func (detection) Annotate(Detection any) packager.Package {
+	var Package packager.Package
+
+	Package.Head.Event = packager.Type.Detection.Type
+	Package.Head.Time = time.Now().Format("02/01/2006 15:04:05")
+	Package.Head.OneTime = "true"
+
+	Package.Body.SubEvent = packager.Type.Detection.Annotate
+	Package.Body.Info = map[string]any{
+		"Detection": Detection,
+	}
+
+	return Package
+}
+
+func (detection) List(Detections any) packager.Package {
+	var Package packager.Package
+
+	Package.Head.Event = packager.Type.Detection.Type
+	Package.Head.Time = time.Now().Format("02/01/2006 15:04:05")
+	Package.Head.OneTime = "true"
+
+	Package.Body.SubEvent = packager.Type.Detection.List
+	Package.Body.Info = map[string]any{
+		"Detections": Detections,
+	}
+
+	return Package
+}
+
+func (detection) Coverage(Coverage any) packager.Package {
+	var Package packager.Package
+
+	Package.Head.Event = packager.Type.Detection.Type
+	Package.Head.Time = time.Now().Format("02/01/2006 15:04:05")
+	Package.Head.OneTime = "true"
+
+	Package.Body.SubEvent = packager.Type.Detection.Coverage
+	Package.Body.Info = map[string]any{
+		"Coverage": Coverage,
+	}
+
+	return Package
+}
@@ -0,0 +1,24 @@
+package events
+
+import (
+	"time"
+
+	"Havoc/pkg/packager"
+)
+
+var Directory directory
+
+func (directory) List(Objects any) packager.Package {
+	var Package packager.Package
+
+	Package.Head.Event = packager.Type.Directory.Type
+	Package.Head.Time = time.Now().Format("02/01/2006 15:04:05")
+	Package.Head.OneTime = "true"
+
+	Package.Body.SubEvent = packager.Type.Directory.List
+	Package.Body.Info = map[string]any{
+		"Objects": Objects,
+	}
+
+	return Package
+}
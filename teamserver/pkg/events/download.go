@@ -0,0 +1,49 @@
+package events
+
+import (
+	"encoding/base64"
+	"time"
+
+	"Havoc/pkg/packager"
+)
+
+var Downloads downloads
+
+func (downloads) Status(ID, Name, State string, Done, Total int) packager.Package {
+	var Package packager.Package
+
+	Package.Head.Event = packager.Type.Download.Type
+	Package.Head.Time = time.Now().Format("02/01/2006 15:04:05")
+	Package.Head.OneTime = "true"
+
+	Package.Body.SubEvent = packager.Type.Download.Status
+	Package.Body.Info = map[string]any{
+		"ID":    ID,
+		"Name":  Name,
+		"State": State,
+		"Done":  Done,
+		"Total": Total,
+	}
+
+	return Package
+}
+
+func (downloads) Finished(ID, Name, Hash string, Verified bool, Data []byte, Transfer string) packager.Package {
+	var Package packager.Package
+
+	Package.Head.Event = packager.Type.Download.Type
+	Package.Head.Time = time.Now().Format("02/01/2006 15:04:05")
+	Package.Head.OneTime = "true"
+
+	Package.Body.SubEvent = packager.Type.Download.Finished
+	Package.Body.Info = map[string]any{
+		"ID":       ID,
+		"Name":     Name,
+		"Hash":     Hash,
+		"Verified": Verified,
+		"Data":     base64.StdEncoding.EncodeToString(Data),
+		"Transfer": Transfer,
+	}
+
+	return Package
+}
@@ -17,6 +17,39 @@ type (
 	gate       int
 	service    int
 	teamserver int
+	infra      int
+	bundles    int
+	exports    int
+	snapshots  int
+	loot       int
+	downloads  int
+	archive    int
+	search     int
+	presets    int
+	scripts    int
+	creds      int
+	lateral    int
+	ssh        int
+	directory  int
+	blocklist  int
+	approval   int
+	templates  int
+	batches    int
+	schedules  int
+	clipboard  int
+	registry   int
+	services   int
+	desktop    int
+	uploads    int
+	notify     int
+	groups     int
+	sprays     int
+	pivots     int
+	routes     int
+	files      int
+	timeline   int
+	evidence   int
+	detection  int
 )
 
 func Authenticated(authed bool) packager.Package {
@@ -0,0 +1,71 @@
+package events
+
+import (
+	"encoding/base64"
+	"time"
+
+	"Havoc/pkg/packager"
+)
+
+var Evidence evidence
+
+func (evidence) Add(Evidence any) packager.Package {
+	var Package packager.Package
+
+	Package.Head.Event = packager.Type.Evidence.Type
+	Package.Head.Time = time.Now().Format("02/01/2006 15:04:05")
+	Package.Head.OneTime = "true"
+
+	Package.Body.SubEvent = packager.Type.Evidence.Add
+	Package.Body.Info = map[string]any{
+		"Evidence": Evidence,
+	}
+
+	return Package
+}
+
+func (evidence) Remove(ID int) packager.Package {
+	var Package packager.Package
+
+	Package.Head.Event = packager.Type.Evidence.Type
+	Package.Head.Time = time.Now().Format("02/01/2006 15:04:05")
+	Package.Head.OneTime = "true"
+
+	Package.Body.SubEvent = packager.Type.Evidence.Remove
+	Package.Body.Info = map[string]any{
+		"ID": ID,
+	}
+
+	return Package
+}
+
+func (evidence) List(Evidences any) packager.Package {
+	var Package packager.Package
+
+	Package.Head.Event = packager.Type.Evidence.Type
+	Package.Head.Time = time.Now().Format("02/01/2006 15:04:05")
+	Package.Head.OneTime = "true"
+
+	Package.Body.SubEvent = packager.Type.Evidence.List
+	Package.Body.Info = map[string]any{
+		"Evidences": Evidences,
+	}
+
+	return Package
+}
+
+func (evidence) Fetch(Evidence any, Data []byte) packager.Package {
+	var Package packager.Package
+
+	Package.Head.Event = packager.Type.Evidence.Type
+	Package.Head.Time = time.Now().Format("02/01/2006 15:04:05")
+	Package.Head.OneTime = "true"
+
+	Package.Body.SubEvent = packager.Type.Evidence.Fetch
+	Package.Body.Info = map[string]any{
+		"Evidence": Evidence,
+		"Data":     base64.StdEncoding.EncodeToString(Data),
+	}
+
+	return Package
+}
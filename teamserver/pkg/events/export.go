@@ -0,0 +1,40 @@
+package events
+
+import (
+	"time"
+
+	"Havoc/pkg/packager"
+)
+
+var Export exports
+
+func (exports) Stix(Data string) packager.Package {
+	var Package packager.Package
+
+	Package.Head.Event = packager.Type.Export.Type
+	Package.Head.Time = time.Now().Format("02/01/2006 15:04:05")
+	Package.Head.OneTime = "true"
+
+	Package.Body.SubEvent = packager.Type.Export.Stix
+	Package.Body.Info = map[string]any{
+		"Format": "stix-2.1",
+		"Bundle": Data,
+	}
+
+	return Package
+}
+
+func (exports) Timeline(Entries any) packager.Package {
+	var Package packager.Package
+
+	Package.Head.Event = packager.Type.Export.Type
+	Package.Head.Time = time.Now().Format("02/01/2006 15:04:05")
+	Package.Head.OneTime = "true"
+
+	Package.Body.SubEvent = packager.Type.Export.Timeline
+	Package.Body.Info = map[string]any{
+		"Entries": Entries,
+	}
+
+	return Package
+}
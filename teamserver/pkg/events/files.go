@@ -0,0 +1,24 @@
+package events
+
+import (
+	"time"
+
+	"Havoc/pkg/packager"
+)
+
+var Files files
+
+func (files) Records(Records any) packager.Package {
+	var Package packager.Package
+
+	Package.Head.Event = packager.Type.Files.Type
+	Package.Head.Time = time.Now().Format("02/01/2006 15:04:05")
+	Package.Head.OneTime = "true"
+
+	Package.Body.SubEvent = packager.Type.Files.Records
+	Package.Body.Info = map[string]any{
+		"Records": Records,
+	}
+
+	return Package
+}
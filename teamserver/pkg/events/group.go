@@ -0,0 +1,40 @@
+package events
+
+import (
+	"time"
+
+	"Havoc/pkg/packager"
+)
+
+var Groups groups
+
+func (groups) List(Groups any) packager.Package {
+	var Package packager.Package
+
+	Package.Head.Event = packager.Type.Group.Type
+	Package.Head.Time = time.Now().Format("02/01/2006 15:04:05")
+	Package.Head.OneTime = "true"
+
+	Package.Body.SubEvent = packager.Type.Group.List
+	Package.Body.Info = map[string]any{
+		"Groups": Groups,
+	}
+
+	return Package
+}
+
+func (groups) Members(Name string, Agents any) packager.Package {
+	var Package packager.Package
+
+	Package.Head.Event = packager.Type.Group.Type
+	Package.Head.Time = time.Now().Format("02/01/2006 15:04:05")
+	Package.Head.OneTime = "true"
+
+	Package.Body.SubEvent = packager.Type.Group.Members
+	Package.Body.Info = map[string]any{
+		"Name":   Name,
+		"Agents": Agents,
+	}
+
+	return Package
+}
@@ -0,0 +1,58 @@
+package events
+
+import (
+	"time"
+
+	"Havoc/pkg/packager"
+)
+
+var Infra infra
+
+func (infra) Burn(User, Host, Reason string, Rotate bool, Sessions []string, Payloads int64) packager.Package {
+	var Package packager.Package
+
+	Package.Head.Event = packager.Type.Infra.Type
+	Package.Head.Time = time.Now().Format("02/01/2006 15:04:05")
+	Package.Head.User = User
+
+	Package.Body.SubEvent = packager.Type.Infra.Burn
+	Package.Body.Info = map[string]any{
+		"Host":     Host,
+		"Reason":   Reason,
+		"Rotate":   Rotate,
+		"Sessions": Sessions,
+		"Payloads": Payloads,
+	}
+
+	return Package
+}
+
+func (infra) Restore(User, Host string) packager.Package {
+	var Package packager.Package
+
+	Package.Head.Event = packager.Type.Infra.Type
+	Package.Head.Time = time.Now().Format("02/01/2006 15:04:05")
+	Package.Head.User = User
+
+	Package.Body.SubEvent = packager.Type.Infra.Restore
+	Package.Body.Info = map[string]any{
+		"Host": Host,
+	}
+
+	return Package
+}
+
+func (infra) List(Burned []map[string]any) packager.Package {
+	var Package packager.Package
+
+	Package.Head.Event = packager.Type.Infra.Type
+	Package.Head.Time = time.Now().Format("02/01/2006 15:04:05")
+	Package.Head.OneTime = "true"
+
+	Package.Body.SubEvent = packager.Type.Infra.List
+	Package.Body.Info = map[string]any{
+		"Burned": Burned,
+	}
+
+	return Package
+}
@@ -0,0 +1,39 @@
+package events
+
+import (
+	"time"
+
+	"Havoc/pkg/packager"
+)
+
+var Lateral lateral
+
+func (lateral) List(Edges any) packager.Package {
+	var Package packager.Package
+
+	Package.Head.Event = packager.Type.Lateral.Type
+	Package.Head.Time = time.Now().Format("02/01/2006 15:04:05")
+	Package.Head.OneTime = "true"
+
+	Package.Body.SubEvent = packager.Type.Lateral.List
+	Package.Body.Info = map[string]any{
+		"Edges": Edges,
+	}
+
+	return Package
+}
+
+func (lateral) Methods(Methods any) packager.Package {
+	var Package packager.Package
+
+	Package.Head.Event = packager.Type.Lateral.Type
+	Package.Head.Time = time.Now().Format("02/01/2006 15:04:05")
+	Package.Head.OneTime = "true"
+
+	Package.Body.SubEvent = packager.Type.Lateral.Methods
+	Package.Body.Info = map[string]any{
+		"Methods": Methods,
+	}
+
+	return Package
+}
@@ -30,6 +30,7 @@ func (listeners) ListenerAdd(FromUser string, Type int, Config any) packager.Pac
 		Package.Body.Info["Protocol"] = handlers.AGENT_HTTP
 		Package.Body.Info["Headers"] = strings.Join(Config.(*handlers.HTTP).Config.Headers, ", ")
 		Package.Body.Info["Uris"] = strings.Join(Config.(*handlers.HTTP).Config.Uris, ", ")
+		Package.Body.Info["Host Headers"] = strings.Join(Config.(*handlers.HTTP).Config.HostHeaders, ", ")
 
 		/* proxy settings */
 		Package.Body.Info["Proxy Enabled"] = "false"
@@ -42,6 +43,9 @@ func (listeners) ListenerAdd(FromUser string, Type int, Config any) packager.Pac
 		Package.Body.Info["Proxy Port"] = Config.(*handlers.HTTP).Config.Proxy.Port
 		Package.Body.Info["Proxy Username"] = Config.(*handlers.HTTP).Config.Proxy.Username
 		Package.Body.Info["Proxy Password"] = Config.(*handlers.HTTP).Config.Proxy.Password
+		Package.Body.Info["Proxy Mode"] = handlers.ProxyMode(Config.(*handlers.HTTP).Config)
+		Package.Body.Info["Proxy Auth"] = Config.(*handlers.HTTP).Config.Proxy.Auth
+		Package.Body.Info["Proxy Bypass"] = strings.Join(Config.(*handlers.HTTP).Config.Proxy.Bypass, ", ")
 
 		Package.Body.Info["Secure"] = "false"
 		if Config.(*handlers.HTTP).Config.Secure {
@@ -57,6 +61,8 @@ func (listeners) ListenerAdd(FromUser string, Type int, Config any) packager.Pac
 		delete(Package.Body.Info, "Proxy")
 		delete(Package.Body.Info, "Response")
 		delete(Package.Body.Info, "Hosts")
+		delete(Package.Body.Info, "HostHeaders")
+		delete(Package.Body.Info, "CertTemplate")
 
 		var Hosts string
 		for _, host := range Config.(*handlers.HTTP).Config.Hosts {
@@ -111,6 +117,7 @@ func (listeners) ListenerEdit(Type int, Config any) packager.Package {
 		Package.Body.Info["Protocol"] = handlers.AGENT_HTTP
 		Package.Body.Info["Headers"] = strings.Join(Config.(*handlers.HTTPConfig).Headers, ", ")
 		Package.Body.Info["Uris"] = strings.Join(Config.(*handlers.HTTPConfig).Uris, ", ")
+		Package.Body.Info["Host Headers"] = strings.Join(Config.(*handlers.HTTPConfig).HostHeaders, ", ")
 
 		// Proxy settings
 		Package.Body.Info["Proxy Enabled"] = "false"
@@ -122,6 +129,9 @@ func (listeners) ListenerEdit(Type int, Config any) packager.Package {
 		Package.Body.Info["Proxy Port"] = Config.(*handlers.HTTPConfig).Proxy.Port
 		Package.Body.Info["Proxy Username"] = Config.(*handlers.HTTPConfig).Proxy.Username
 		Package.Body.Info["Proxy Password"] = Config.(*handlers.HTTPConfig).Proxy.Password
+		Package.Body.Info["Proxy Mode"] = handlers.ProxyMode(*Config.(*handlers.HTTPConfig))
+		Package.Body.Info["Proxy Auth"] = Config.(*handlers.HTTPConfig).Proxy.Auth
+		Package.Body.Info["Proxy Bypass"] = strings.Join(Config.(*handlers.HTTPConfig).Proxy.Bypass, ", ")
 
 		Package.Body.Info["Secure"] = "false"
 		if Config.(*handlers.HTTPConfig).Secure {
@@ -134,6 +144,8 @@ func (listeners) ListenerEdit(Type int, Config any) packager.Package {
 		delete(Package.Body.Info, "Proxy")
 		delete(Package.Body.Info, "Response")
 		delete(Package.Body.Info, "Hosts")
+		delete(Package.Body.Info, "HostHeaders")
+		delete(Package.Body.Info, "CertTemplate")
 
 		var Hosts string
 		for _, host := range Config.(*handlers.HTTPConfig).Hosts {
@@ -198,3 +210,33 @@ func (listeners) ListenerMark(ListenerName string, Mark string) packager.Package
 
 	return Package
 }
+
+func (listeners) Templates(Templates any) packager.Package {
+	var Package packager.Package
+
+	Package.Head.Event = packager.Type.Listener.Type
+	Package.Head.Time = time.Now().Format("02/01/2006 15:04:05")
+	Package.Head.OneTime = "true"
+
+	Package.Body.SubEvent = packager.Type.Listener.TemplateList
+	Package.Body.Info = map[string]any{
+		"Templates": Templates,
+	}
+
+	return Package
+}
+
+func (listeners) Egress(Report any) packager.Package {
+	var Package packager.Package
+
+	Package.Head.Event = packager.Type.Listener.Type
+	Package.Head.Time = time.Now().Format("02/01/2006 15:04:05")
+	Package.Head.OneTime = "true"
+
+	Package.Body.SubEvent = packager.Type.Listener.Egress
+	Package.Body.Info = map[string]any{
+		"Report": Report,
+	}
+
+	return Package
+}
@@ -0,0 +1,28 @@
+package events
+
+import (
+	"encoding/base64"
+	"time"
+
+	"Havoc/pkg/packager"
+)
+
+var Loot loot
+
+func (loot) Fetch(DemonID, Type, Name string, Data []byte) packager.Package {
+	var Package packager.Package
+
+	Package.Head.Event = packager.Type.Loot.Type
+	Package.Head.Time = time.Now().Format("02/01/2006 15:04:05")
+	Package.Head.OneTime = "true"
+
+	Package.Body.SubEvent = packager.Type.Loot.Fetch
+	Package.Body.Info = map[string]any{
+		"DemonID": DemonID,
+		"Type":    Type,
+		"Name":    Name,
+		"Data":    base64.StdEncoding.EncodeToString(Data),
+	}
+
+	return Package
+}
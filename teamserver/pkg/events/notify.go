@@ -0,0 +1,59 @@
+package events
+
+import (
+	"time"
+
+	"Havoc/pkg/packager"
+)
+
+var Notify notify
+
+// Alert
+// an event of the teamserver an operator gets notified of.
+func (notify) Alert(Alert any) packager.Package {
+	var Package packager.Package
+
+	Package.Head.Event = packager.Type.Notification.Type
+	Package.Head.Time = time.Now().Format("02/01/2006 15:04:05")
+	Package.Head.OneTime = "true"
+
+	Package.Body.SubEvent = packager.Type.Notification.Alert
+	Package.Body.Info = map[string]any{
+		"Alert": Alert,
+	}
+
+	return Package
+}
+
+// Digest
+// the events held back for an operator by its digest or its quiet hours.
+func (notify) Digest(Alerts any, Dropped int) packager.Package {
+	var Package packager.Package
+
+	Package.Head.Event = packager.Type.Notification.Type
+	Package.Head.Time = time.Now().Format("02/01/2006 15:04:05")
+	Package.Head.OneTime = "true"
+
+	Package.Body.SubEvent = packager.Type.Notification.Digest
+	Package.Body.Info = map[string]any{
+		"Alerts":  Alerts,
+		"Dropped": Dropped,
+	}
+
+	return Package
+}
+
+func (notify) Preferences(Preferences any) packager.Package {
+	var Package packager.Package
+
+	Package.Head.Event = packager.Type.Notification.Type
+	Package.Head.Time = time.Now().Format("02/01/2006 15:04:05")
+	Package.Head.OneTime = "true"
+
+	Package.Body.SubEvent = packager.Type.Notification.Preferences
+	Package.Body.Info = map[string]any{
+		"Preferences": Preferences,
+	}
+
+	return Package
+}
@@ -0,0 +1,39 @@
+package events
+
+import (
+	"time"
+
+	"Havoc/pkg/packager"
+)
+
+var Pivots pivots
+
+func (pivots) List(Pivots any) packager.Package {
+	var Package packager.Package
+
+	Package.Head.Event = packager.Type.Pivot.Type
+	Package.Head.Time = time.Now().Format("02/01/2006 15:04:05")
+	Package.Head.OneTime = "true"
+
+	Package.Body.SubEvent = packager.Type.Pivot.List
+	Package.Body.Info = map[string]any{
+		"Pivots": Pivots,
+	}
+
+	return Package
+}
+
+func (pivots) Streams(Streams any) packager.Package {
+	var Package packager.Package
+
+	Package.Head.Event = packager.Type.Pivot.Type
+	Package.Head.Time = time.Now().Format("02/01/2006 15:04:05")
+	Package.Head.OneTime = "true"
+
+	Package.Body.SubEvent = packager.Type.Pivot.Streams
+	Package.Body.Info = map[string]any{
+		"Streams": Streams,
+	}
+
+	return Package
+}
@@ -0,0 +1,24 @@
+package events
+
+import (
+	"time"
+
+	"Havoc/pkg/packager"
+)
+
+var Presets presets
+
+func (presets) List(Presets any) packager.Package {
+	var Package packager.Package
+
+	Package.Head.Event = packager.Type.Preset.Type
+	Package.Head.Time = time.Now().Format("02/01/2006 15:04:05")
+	Package.Head.OneTime = "true"
+
+	Package.Body.SubEvent = packager.Type.Preset.List
+	Package.Body.Info = map[string]any{
+		"Presets": Presets,
+	}
+
+	return Package
+}
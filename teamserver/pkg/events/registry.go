@@ -0,0 +1,39 @@
+package events
+
+import (
+	"time"
+
+	"Havoc/pkg/packager"
+)
+
+var Registry registry
+
+func (registry) Records(Records any) packager.Package {
+	var Package packager.Package
+
+	Package.Head.Event = packager.Type.Registry.Type
+	Package.Head.Time = time.Now().Format("02/01/2006 15:04:05")
+	Package.Head.OneTime = "true"
+
+	Package.Body.SubEvent = packager.Type.Registry.Records
+	Package.Body.Info = map[string]any{
+		"Records": Records,
+	}
+
+	return Package
+}
+
+func (registry) Changes(Changes any) packager.Package {
+	var Package packager.Package
+
+	Package.Head.Event = packager.Type.Registry.Type
+	Package.Head.Time = time.Now().Format("02/01/2006 15:04:05")
+	Package.Head.OneTime = "true"
+
+	Package.Body.SubEvent = packager.Type.Registry.Changes
+	Package.Body.Info = map[string]any{
+		"Changes": Changes,
+	}
+
+	return Package
+}
@@ -0,0 +1,25 @@
+package events
+
+import (
+	"time"
+
+	"Havoc/pkg/packager"
+)
+
+var Routes routes
+
+func (routes) List(Routes any, Listeners any) packager.Package {
+	var Package packager.Package
+
+	Package.Head.Event = packager.Type.Route.Type
+	Package.Head.Time = time.Now().Format("02/01/2006 15:04:05")
+	Package.Head.OneTime = "true"
+
+	Package.Body.SubEvent = packager.Type.Route.List
+	Package.Body.Info = map[string]any{
+		"Routes":    Routes,
+		"Listeners": Listeners,
+	}
+
+	return Package
+}
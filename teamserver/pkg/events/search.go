@@ -0,0 +1,25 @@
+package events
+
+import (
+	"time"
+
+	"Havoc/pkg/packager"
+)
+
+var Search search
+
+func (search) Results(Query string, Results any) packager.Package {
+	var Package packager.Package
+
+	Package.Head.Event = packager.Type.Search.Type
+	Package.Head.Time = time.Now().Format("02/01/2006 15:04:05")
+	Package.Head.OneTime = "true"
+
+	Package.Body.SubEvent = packager.Type.Search.Query
+	Package.Body.Info = map[string]any{
+		"Query":   Query,
+		"Results": Results,
+	}
+
+	return Package
+}
@@ -0,0 +1,41 @@
+package events
+
+import (
+	"time"
+
+	"Havoc/pkg/packager"
+)
+
+var Snapshots snapshots
+
+func (snapshots) List(DemonID string, Snapshots any) packager.Package {
+	var Package packager.Package
+
+	Package.Head.Event = packager.Type.Snapshot.Type
+	Package.Head.Time = time.Now().Format("02/01/2006 15:04:05")
+	Package.Head.OneTime = "true"
+
+	Package.Body.SubEvent = packager.Type.Snapshot.List
+	Package.Body.Info = map[string]any{
+		"DemonID":   DemonID,
+		"Snapshots": Snapshots,
+	}
+
+	return Package
+}
+
+func (snapshots) Diff(DemonID string, Diff any) packager.Package {
+	var Package packager.Package
+
+	Package.Head.Event = packager.Type.Snapshot.Type
+	Package.Head.Time = time.Now().Format("02/01/2006 15:04:05")
+	Package.Head.OneTime = "true"
+
+	Package.Body.SubEvent = packager.Type.Snapshot.Diff
+	Package.Body.Info = map[string]any{
+		"DemonID": DemonID,
+		"Diff":    Diff,
+	}
+
+	return Package
+}
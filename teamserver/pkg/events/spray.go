@@ -0,0 +1,54 @@
+package events
+
+import (
+	"time"
+
+	"Havoc/pkg/packager"
+)
+
+var Sprays sprays
+
+func (sprays) List(Sprays any) packager.Package {
+	var Package packager.Package
+
+	Package.Head.Event = packager.Type.Spray.Type
+	Package.Head.Time = time.Now().Format("02/01/2006 15:04:05")
+	Package.Head.OneTime = "true"
+
+	Package.Body.SubEvent = packager.Type.Spray.List
+	Package.Body.Info = map[string]any{
+		"Sprays": Sprays,
+	}
+
+	return Package
+}
+
+func (sprays) Attempts(Spray any) packager.Package {
+	var Package packager.Package
+
+	Package.Head.Event = packager.Type.Spray.Type
+	Package.Head.Time = time.Now().Format("02/01/2006 15:04:05")
+	Package.Head.OneTime = "true"
+
+	Package.Body.SubEvent = packager.Type.Spray.Attempts
+	Package.Body.Info = map[string]any{
+		"Spray": Spray,
+	}
+
+	return Package
+}
+
+func (sprays) Protocols(Protocols any) packager.Package {
+	var Package packager.Package
+
+	Package.Head.Event = packager.Type.Spray.Type
+	Package.Head.Time = time.Now().Format("02/01/2006 15:04:05")
+	Package.Head.OneTime = "true"
+
+	Package.Body.SubEvent = packager.Type.Spray.Protocols
+	Package.Body.Info = map[string]any{
+		"Protocols": Protocols,
+	}
+
+	return Package
+}
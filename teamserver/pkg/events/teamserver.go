@@ -35,3 +35,19 @@ func (teamserver) Profile(profile string) packager.Package {
 
 	return Package
 }
+
+func (teamserver) Crash(Source, Error, Stack string) packager.Package {
+	var Package packager.Package
+
+	Package.Head.Event = packager.Type.Teamserver.Type
+	// Time Day Month Year
+	Package.Head.Time = time.Now().Format("02/01/2006 15:04:05")
+
+	Package.Body.Info = make(map[string]interface{})
+	Package.Body.SubEvent = packager.Type.Teamserver.Crash
+	Package.Body.Info["Source"] = Source
+	Package.Body.Info["Error"] = Error
+	Package.Body.Info["Stack"] = Stack
+
+	return Package
+}
@@ -0,0 +1,54 @@
+package events
+
+import (
+	"time"
+
+	"Havoc/pkg/packager"
+)
+
+var Timeline timeline
+
+func (timeline) Add(Entry any) packager.Package {
+	var Package packager.Package
+
+	Package.Head.Event = packager.Type.Timeline.Type
+	Package.Head.Time = time.Now().Format("02/01/2006 15:04:05")
+	Package.Head.OneTime = "true"
+
+	Package.Body.SubEvent = packager.Type.Timeline.Add
+	Package.Body.Info = map[string]any{
+		"Entry": Entry,
+	}
+
+	return Package
+}
+
+func (timeline) Remove(ID int) packager.Package {
+	var Package packager.Package
+
+	Package.Head.Event = packager.Type.Timeline.Type
+	Package.Head.Time = time.Now().Format("02/01/2006 15:04:05")
+	Package.Head.OneTime = "true"
+
+	Package.Body.SubEvent = packager.Type.Timeline.Remove
+	Package.Body.Info = map[string]any{
+		"ID": ID,
+	}
+
+	return Package
+}
+
+func (timeline) List(Entries any) packager.Package {
+	var Package packager.Package
+
+	Package.Head.Event = packager.Type.Timeline.Type
+	Package.Head.Time = time.Now().Format("02/01/2006 15:04:05")
+	Package.Head.OneTime = "true"
+
+	Package.Body.SubEvent = packager.Type.Timeline.List
+	Package.Body.Info = map[string]any{
+		"Entries": Entries,
+	}
+
+	return Package
+}
@@ -0,0 +1,39 @@
+package events
+
+import (
+	"time"
+
+	"Havoc/pkg/packager"
+)
+
+var Uploads uploads
+
+func (uploads) Rules(Rules any) packager.Package {
+	var Package packager.Package
+
+	Package.Head.Event = packager.Type.Uploads.Type
+	Package.Head.Time = time.Now().Format("02/01/2006 15:04:05")
+	Package.Head.OneTime = "true"
+
+	Package.Body.SubEvent = packager.Type.Uploads.Rules
+	Package.Body.Info = map[string]any{
+		"Rules": Rules,
+	}
+
+	return Package
+}
+
+func (uploads) Audit(Entries any) packager.Package {
+	var Package packager.Package
+
+	Package.Head.Event = packager.Type.Uploads.Type
+	Package.Head.Time = time.Now().Format("02/01/2006 15:04:05")
+	Package.Head.OneTime = "true"
+
+	Package.Body.SubEvent = packager.Type.Uploads.Audit
+	Package.Body.Info = map[string]any{
+		"Entries": Entries,
+	}
+
+	return Package
+}
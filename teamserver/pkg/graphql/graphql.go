@@ -0,0 +1,195 @@
+package graphql
+
+import (
+	"fmt"
+	"strings"
+)
+
+type (
+	// Resolver of a lazy field. Args are the arguments of the requested field.
+	Resolver func(Args map[string]any) (any, error)
+
+	// Object of the data model. Values are scalars, Objects, lists
+	// of Objects or Resolvers that get called if the field is requested.
+	Object map[string]any
+
+	Error struct {
+		Message string   `json:"message"`
+		Path    []string `json:"path,omitempty"`
+	}
+
+	Response struct {
+		Data   map[string]any `json:"data"`
+		Errors []Error        `json:"errors,omitempty"`
+	}
+)
+
+// arguments used for pagination instead of filtering
+var pagination = []string{"limit", "offset"}
+
+// Execute
+// parses the query and resolves the requested fields starting from the root object.
+func Execute(Root Object, Query string, Variables map[string]any) Response {
+	var Response Response
+
+	Selection, err := Parse(Query, Variables)
+	if err != nil {
+		Response.Errors = append(Response.Errors, Error{Message: err.Error()})
+		return Response
+	}
+
+	Response.Data = resolveObject(Root, Selection, nil, &Response.Errors)
+
+	return Response
+}
+
+func resolveObject(Obj Object, Selection []*Field, Path []string, Errors *[]Error) map[string]any {
+	var Result = make(map[string]any)
+
+	for _, field := range Selection {
+		var FieldPath = append(append([]string{}, Path...), field.Key())
+
+		value, ok := Obj[field.Name]
+		if !ok {
+			if field.Name == "__typename" {
+				Result[field.Key()] = "Object"
+				continue
+			}
+
+			*Errors = append(*Errors, Error{Message: "unknown field " + field.Name, Path: FieldPath})
+			continue
+		}
+
+		Result[field.Key()] = resolveValue(value, field, FieldPath, Errors)
+	}
+
+	return Result
+}
+
+func resolveValue(Value any, field *Field, Path []string, Errors *[]Error) any {
+	var err error
+
+	if resolver, ok := Value.(Resolver); ok {
+		if Value, err = resolver(field.Arguments); err != nil {
+			*Errors = append(*Errors, Error{Message: err.Error(), Path: Path})
+			return nil
+		}
+	}
+
+	if Value == nil {
+		return nil
+	}
+
+	switch Value.(type) {
+
+	case Object:
+		if len(field.Selection) == 0 {
+			*Errors = append(*Errors, Error{Message: "field " + field.Name + " needs a selection of subfields", Path: Path})
+			return nil
+		}
+
+		return resolveObject(Value.(Object), field.Selection, Path, Errors)
+
+	case []Object:
+		var List = make([]any, 0, len(Value.([]Object)))
+
+		if len(field.Selection) == 0 {
+			*Errors = append(*Errors, Error{Message: "field " + field.Name + " needs a selection of subfields", Path: Path})
+			return nil
+		}
+
+		for i, Obj := range Value.([]Object) {
+			List = append(List, resolveObject(Obj, field.Selection, append(append([]string{}, Path...), fmt.Sprint(i)), Errors))
+		}
+
+		return List
+
+	}
+
+	if len(field.Selection) > 0 {
+		*Errors = append(*Errors, Error{Message: "field " + field.Name + " has no subfields", Path: Path})
+		return nil
+	}
+
+	return Value
+}
+
+// List
+// filters the objects by the arguments and applies "offset" and "limit".
+// Every other argument has to match the scalar field with the same
+// name (strings are compared case-insensitive). Arguments that aren't
+// a field of the object are ignored.
+func List(Objects []Object, Args map[string]any) []Object {
+	var (
+		Filtered = make([]Object, 0, len(Objects))
+		Offset   = argInt(Args, "offset")
+		Limit    = argInt(Args, "limit")
+	)
+
+	for _, Obj := range Objects {
+		if Match(Obj, Args) {
+			Filtered = append(Filtered, Obj)
+		}
+	}
+
+	if Offset > 0 {
+		if Offset >= len(Filtered) {
+			return []Object{}
+		}
+		Filtered = Filtered[Offset:]
+	}
+
+	if Limit > 0 && Limit < len(Filtered) {
+		Filtered = Filtered[:Limit]
+	}
+
+	return Filtered
+}
+
+// Match
+// checks if the scalar fields of the object match the arguments.
+func Match(Obj Object, Args map[string]any) bool {
+	for Name, Arg := range Args {
+		var isPagination = false
+
+		for _, p := range pagination {
+			if p == Name {
+				isPagination = true
+				break
+			}
+		}
+
+		if isPagination || Arg == nil {
+			continue
+		}
+
+		value, ok := Obj[Name]
+		if !ok {
+			continue
+		}
+
+		switch value.(type) {
+		case Resolver, Object, []Object:
+			continue
+		}
+
+		if !strings.EqualFold(fmt.Sprint(value), fmt.Sprint(Arg)) {
+			return false
+		}
+	}
+
+	return true
+}
+
+func argInt(Args map[string]any, Name string) int {
+	switch value := Args[Name].(type) {
+	case int64:
+		return int(value)
+	case float64:
+		return int(value)
+	case int:
+		return value
+	}
+
+	return 0
+}
@@ -0,0 +1,451 @@
+package graphql
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"unicode"
+)
+
+// Field of a selection set.
+//
+//	alias: name(arg: value) { selection }
+type Field struct {
+	Alias     string
+	Name      string
+	Arguments map[string]any
+	Selection []*Field
+}
+
+// Key returns the name the field has in the response.
+func (f *Field) Key() string {
+	if len(f.Alias) > 0 {
+		return f.Alias
+	}
+
+	return f.Name
+}
+
+type parser struct {
+	src       []rune
+	pos       int
+	variables map[string]any
+}
+
+// Parse
+// parses a query document. Only a single query operation with
+// fields, aliases, arguments, variables and nested selections is
+// supported. Mutations, subscriptions and fragments are rejected.
+func Parse(Query string, Variables map[string]any) ([]*Field, error) {
+	var (
+		p = &parser{
+			src:       []rune(Query),
+			variables: Variables,
+		}
+		Selection []*Field
+		err       error
+	)
+
+	p.skip()
+
+	if name := p.peekName(); len(name) > 0 {
+		switch name {
+		case "query":
+			p.name()
+			p.skip()
+
+			/* optional operation name */
+			if len(p.peekName()) > 0 {
+				p.name()
+				p.skip()
+			}
+
+			/* variable definitions. the values are taken from the variables map */
+			if p.peek() == '(' {
+				if err = p.skipBlock('(', ')'); err != nil {
+					return nil, err
+				}
+				p.skip()
+			}
+
+		case "mutation", "subscription":
+			return nil, errors.New(name + " operations are not supported")
+
+		case "fragment":
+			return nil, errors.New("fragments are not supported")
+
+		default:
+			return nil, p.errorf("unexpected %q", name)
+		}
+	}
+
+	if Selection, err = p.selection(); err != nil {
+		return nil, err
+	}
+
+	p.skip()
+	if p.pos < len(p.src) {
+		return nil, p.errorf("unexpected %q after query", string(p.src[p.pos]))
+	}
+
+	return Selection, nil
+}
+
+func (p *parser) errorf(format string, args ...any) error {
+	return fmt.Errorf("syntax error at %v: %v", p.pos, fmt.Sprintf(format, args...))
+}
+
+// skip whitespaces, commas and comments
+func (p *parser) skip() {
+	for p.pos < len(p.src) {
+		var c = p.src[p.pos]
+
+		if c == '#' {
+			for p.pos < len(p.src) && p.src[p.pos] != '\n' {
+				p.pos++
+			}
+			continue
+		}
+
+		if !unicode.IsSpace(c) && c != ',' {
+			return
+		}
+
+		p.pos++
+	}
+}
+
+func (p *parser) peek() rune {
+	if p.pos < len(p.src) {
+		return p.src[p.pos]
+	}
+
+	return 0
+}
+
+func (p *parser) expect(c rune) error {
+	p.skip()
+
+	if p.peek() != c {
+		return p.errorf("expected %q", string(c))
+	}
+
+	p.pos++
+
+	return nil
+}
+
+func isNameStart(c rune) bool {
+	return c == '_' || (c >= 'a' && c <= 'z') || (c >= 'A' && c <= 'Z')
+}
+
+func isName(c rune) bool {
+	return isNameStart(c) || (c >= '0' && c <= '9')
+}
+
+func (p *parser) peekName() string {
+	var pos = p.pos
+
+	name := p.name()
+	p.pos = pos
+
+	return name
+}
+
+func (p *parser) name() string {
+	var start = p.pos
+
+	if p.pos >= len(p.src) || !isNameStart(p.src[p.pos]) {
+		return ""
+	}
+
+	for p.pos < len(p.src) && isName(p.src[p.pos]) {
+		p.pos++
+	}
+
+	return string(p.src[start:p.pos])
+}
+
+func (p *parser) skipBlock(open, close rune) error {
+	var depth = 0
+
+	for p.pos < len(p.src) {
+		switch p.src[p.pos] {
+		case open:
+			depth++
+		case close:
+			depth--
+			if depth == 0 {
+				p.pos++
+				return nil
+			}
+		}
+		p.pos++
+	}
+
+	return p.errorf("expected %q", string(close))
+}
+
+func (p *parser) selection() ([]*Field, error) {
+	var Selection []*Field
+
+	if err := p.expect('{'); err != nil {
+		return nil, err
+	}
+
+	for {
+		p.skip()
+
+		if p.peek() == '}' {
+			p.pos++
+			break
+		}
+
+		if p.peek() == 0 {
+			return nil, p.errorf("expected %q", "}")
+		}
+
+		if strings.HasPrefix(string(p.src[p.pos:]), "...") {
+			return nil, errors.New("fragments are not supported")
+		}
+
+		field, err := p.field()
+		if err != nil {
+			return nil, err
+		}
+
+		Selection = append(Selection, field)
+	}
+
+	if len(Selection) == 0 {
+		return nil, p.errorf("empty selection set")
+	}
+
+	return Selection, nil
+}
+
+func (p *parser) field() (*Field, error) {
+	var (
+		field = &Field{Arguments: make(map[string]any)}
+		err   error
+	)
+
+	if field.Name = p.name(); len(field.Name) == 0 {
+		return nil, p.errorf("expected field name")
+	}
+
+	p.skip()
+
+	if p.peek() == ':' {
+		p.pos++
+		p.skip()
+
+		field.Alias = field.Name
+		if field.Name = p.name(); len(field.Name) == 0 {
+			return nil, p.errorf("expected field name after alias")
+		}
+
+		p.skip()
+	}
+
+	if p.peek() == '(' {
+		p.pos++
+
+		for {
+			p.skip()
+
+			if p.peek() == ')' {
+				p.pos++
+				break
+			}
+
+			name := p.name()
+			if len(name) == 0 {
+				return nil, p.errorf("expected argument name")
+			}
+
+			if err = p.expect(':'); err != nil {
+				return nil, err
+			}
+
+			if field.Arguments[name], err = p.value(); err != nil {
+				return nil, err
+			}
+		}
+
+		p.skip()
+	}
+
+	if p.peek() == '{' {
+		if field.Selection, err = p.selection(); err != nil {
+			return nil, err
+		}
+	}
+
+	return field, nil
+}
+
+func (p *parser) value() (any, error) {
+	p.skip()
+
+	switch c := p.peek(); {
+
+	case c == '$':
+		p.pos++
+		name := p.name()
+		if len(name) == 0 {
+			return nil, p.errorf("expected variable name")
+		}
+		return p.variables[name], nil
+
+	case c == '"':
+		return p.string()
+
+	case c == '-' || (c >= '0' && c <= '9'):
+		var start = p.pos
+
+		p.pos++
+		for p.pos < len(p.src) && strings.ContainsRune("0123456789.eE+-", p.src[p.pos]) {
+			p.pos++
+		}
+
+		number := string(p.src[start:p.pos])
+		if i, err := strconv.ParseInt(number, 10, 64); err == nil {
+			return i, nil
+		}
+
+		f, err := strconv.ParseFloat(number, 64)
+		if err != nil {
+			return nil, p.errorf("invalid number %q", number)
+		}
+		return f, nil
+
+	case c == '[':
+		var List []any
+
+		p.pos++
+		for {
+			p.skip()
+
+			if p.peek() == ']' {
+				p.pos++
+				break
+			}
+
+			if p.peek() == 0 {
+				return nil, p.errorf("expected %q", "]")
+			}
+
+			value, err := p.value()
+			if err != nil {
+				return nil, err
+			}
+
+			List = append(List, value)
+		}
+		return List, nil
+
+	case c == '{':
+		var Object = make(map[string]any)
+
+		p.pos++
+		for {
+			p.skip()
+
+			if p.peek() == '}' {
+				p.pos++
+				break
+			}
+
+			name := p.name()
+			if len(name) == 0 {
+				return nil, p.errorf("expected object field name")
+			}
+
+			if err := p.expect(':'); err != nil {
+				return nil, err
+			}
+
+			value, err := p.value()
+			if err != nil {
+				return nil, err
+			}
+
+			Object[name] = value
+		}
+		return Object, nil
+
+	case isNameStart(c):
+		switch name := p.name(); name {
+		case "true":
+			return true, nil
+		case "false":
+			return false, nil
+		case "null":
+			return nil, nil
+		default:
+			/* enum values are handled as strings */
+			return name, nil
+		}
+
+	}
+
+	return nil, p.errorf("expected value")
+}
+
+func (p *parser) string() (string, error) {
+	var builder strings.Builder
+
+	/* skip the opening quote */
+	p.pos++
+
+	for p.pos < len(p.src) {
+		var c = p.src[p.pos]
+		p.pos++
+
+		switch c {
+		case '"':
+			return builder.String(), nil
+
+		case '\\':
+			if p.pos >= len(p.src) {
+				return "", p.errorf("unterminated string")
+			}
+
+			c = p.src[p.pos]
+			p.pos++
+
+			switch c {
+			case 'n':
+				builder.WriteRune('\n')
+			case 't':
+				builder.WriteRune('\t')
+			case 'r':
+				builder.WriteRune('\r')
+			case 'u':
+				if p.pos+4 > len(p.src) {
+					return "", p.errorf("invalid unicode escape")
+				}
+
+				code, err := strconv.ParseUint(string(p.src[p.pos:p.pos+4]), 16, 32)
+				if err != nil {
+					return "", p.errorf("invalid unicode escape")
+				}
+
+				builder.WriteRune(rune(code))
+				p.pos += 4
+			default:
+				builder.WriteRune(c)
+			}
+
+		case '\n':
+			return "", p.errorf("unterminated string")
+
+		default:
+			builder.WriteRune(c)
+		}
+	}
+
+	return "", p.errorf("unterminated string")
+}
@@ -0,0 +1,357 @@
+package handlers
+
+import (
+	"bytes"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"Havoc/pkg/logger"
+	"Havoc/pkg/logr"
+
+	"github.com/gin-gonic/gin"
+)
+
+const (
+	CAPTURE_MODE_RING  = "ring"
+	CAPTURE_MODE_FILES = "files"
+
+	// default requests the ring keeps
+	CAPTURE_ENTRIES = 100
+	// default size of a capture file and rotated files kept
+	CAPTURE_FILE_SIZE = 10 * 1024 * 1024
+	CAPTURE_FILES     = 5
+	// default bytes of each body captured
+	CAPTURE_MAX_BODY = 64 * 1024
+)
+
+// headers redacted even if the config doesn't list them
+var captureRedact = []string{"Authorization", "Proxy-Authorization", "Cookie", "Set-Cookie"}
+
+// capture
+// raw capture of the requests of a listener and its responses, either in
+// a ring buffer or in rotated files in the folder of the listener.
+type capture struct {
+	Config  *HTTPCapture
+	Redact  map[string]bool
+	Entries int
+	MaxBody int
+
+	mutex sync.Mutex
+	Ring  [][]byte
+	Next  int
+
+	Path     string
+	File     *os.File
+	Size     int64
+	FileSize int64
+	Files    int
+}
+
+// captureWriter
+// records the response the handlers write.
+type captureWriter struct {
+	gin.ResponseWriter
+
+	Body    bytes.Buffer
+	MaxBody int
+}
+
+func (w *captureWriter) Write(Data []byte) (int, error) {
+	if Left := w.MaxBody - w.Body.Len(); Left > 0 {
+		w.Body.Write(Data[:min(Left, len(Data))])
+	}
+
+	return w.ResponseWriter.Write(Data)
+}
+
+func (w *captureWriter) WriteString(Data string) (int, error) {
+	if Left := w.MaxBody - w.Body.Len(); Left > 0 {
+		w.Body.WriteString(Data[:min(Left, len(Data))])
+	}
+
+	return w.ResponseWriter.WriteString(Data)
+}
+
+// newCapture
+// prepares the capture of the listener Name.
+func newCapture(Name string, Config *HTTPCapture) (*capture, error) {
+	var Capture = &capture{
+		Config:   Config,
+		Redact:   make(map[string]bool),
+		Entries:  Config.Entries,
+		MaxBody:  Config.MaxBody,
+		FileSize: int64(Config.FileSize),
+		Files:    Config.Files,
+	}
+
+	if Capture.Entries <= 0 {
+		Capture.Entries = CAPTURE_ENTRIES
+	}
+
+	if Capture.MaxBody <= 0 {
+		Capture.MaxBody = CAPTURE_MAX_BODY
+	}
+
+	if Capture.FileSize <= 0 {
+		Capture.FileSize = CAPTURE_FILE_SIZE
+	}
+
+	if Capture.Files <= 0 {
+		Capture.Files = CAPTURE_FILES
+	}
+
+	for _, Header := range append(captureRedact, Config.Redact...) {
+		Capture.Redact[http.CanonicalHeaderKey(Header)] = true
+	}
+
+	switch strings.ToLower(Config.Mode) {
+
+	case "", CAPTURE_MODE_RING:
+		Capture.Ring = make([][]byte, Capture.Entries)
+
+	case CAPTURE_MODE_FILES:
+		var (
+			reg  = regexp.MustCompile("[^a-zA-Z0-9]+")
+			Path = filepath.Join(logr.LogrInstance.ListenerPath, reg.ReplaceAllString(Name, ""), "capture")
+			err  error
+		)
+
+		/* requests might contain data of the agents */
+		if err = os.MkdirAll(Path, 0700); err != nil {
+			return nil, err
+		}
+
+		Capture.Path = filepath.Join(Path, "capture.log")
+
+		if Capture.File, err = os.OpenFile(Capture.Path, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0600); err != nil {
+			return nil, err
+		}
+
+		if Info, err := Capture.File.Stat(); err == nil {
+			Capture.Size = Info.Size()
+		}
+
+	default:
+		return nil, errors.New("unknown capture mode: " + Config.Mode)
+
+	}
+
+	return Capture, nil
+}
+
+// body
+// formats a captured body.
+func (c *capture) body(Entry *bytes.Buffer, Body []byte, Size int) {
+	if Size == 0 {
+		return
+	}
+
+	if c.Config.RedactBody {
+		Entry.WriteString(fmt.Sprintf("[redacted %v bytes]\n", Size))
+		return
+	}
+
+	Entry.WriteString(hex.Dump(Body))
+
+	if Size > len(Body) {
+		Entry.WriteString(fmt.Sprintf("[truncated %v of %v bytes]\n", Size-len(Body), Size))
+	}
+}
+
+// headers
+// formats captured headers in a stable order.
+func (c *capture) headers(Entry *bytes.Buffer, Headers http.Header) {
+	var Names = make([]string, 0, len(Headers))
+
+	for Name := range Headers {
+		Names = append(Names, Name)
+	}
+
+	sort.Strings(Names)
+
+	for _, Name := range Names {
+		for _, Value := range Headers[Name] {
+			if c.Redact[http.CanonicalHeaderKey(Name)] {
+				Value = "[redacted]"
+			}
+
+			Entry.WriteString(Name + ": " + Value + "\n")
+		}
+	}
+}
+
+// record
+// captures a request and the response to it.
+func (c *capture) record(Listener string, Request *http.Request, RequestBody []byte, Response *captureWriter, Elapsed time.Duration) {
+	var (
+		Entry        bytes.Buffer
+		ResponseSize = Response.Size()
+	)
+
+	Entry.WriteString(fmt.Sprintf("=== %v %v -> %v (%v)\n", time.Now().UTC().Format(time.RFC3339Nano), Request.RemoteAddr, Listener, Elapsed.Round(time.Microsecond)))
+
+	/* request line and headers as the agent sent them */
+	Entry.WriteString(fmt.Sprintf("%v %v %v\n", Request.Method, Request.RequestURI, Request.Proto))
+	Entry.WriteString("Host: " + Request.Host + "\n")
+	c.headers(&Entry, Request.Header)
+	Entry.WriteString("\n")
+	c.body(&Entry, RequestBody[:min(len(RequestBody), c.MaxBody)], len(RequestBody))
+
+	Entry.WriteString(fmt.Sprintf("\n%v %v %v\n", Request.Proto, Response.Status(), http.StatusText(Response.Status())))
+	c.headers(&Entry, Response.Header())
+	Entry.WriteString("\n")
+	c.body(&Entry, Response.Body.Bytes(), max(ResponseSize, 0))
+	Entry.WriteString("\n")
+
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	if c.Ring != nil {
+		c.Ring[c.Next] = Entry.Bytes()
+		c.Next = (c.Next + 1) % len(c.Ring)
+		return
+	}
+
+	if c.File == nil {
+		return
+	}
+
+	if c.Size+int64(Entry.Len()) > c.FileSize && c.Size > 0 {
+		if err := c.rotate(); err != nil {
+			logger.Error("Failed to rotate capture file " + c.Path + ": " + err.Error())
+			return
+		}
+	}
+
+	Written, err := c.File.Write(Entry.Bytes())
+	if err != nil {
+		logger.Debug("Failed to write capture file " + c.Path + ": " + err.Error())
+	}
+
+	c.Size += int64(Written)
+}
+
+// rotate
+// moves capture.log to capture.log.1 (and so on), dropping the oldest file.
+func (c *capture) rotate() error {
+	var err error
+
+	c.File.Close()
+
+	os.Remove(fmt.Sprintf("%v.%v", c.Path, c.Files))
+
+	for i := c.Files - 1; i >= 1; i-- {
+		os.Rename(fmt.Sprintf("%v.%v", c.Path, i), fmt.Sprintf("%v.%v", c.Path, i+1))
+	}
+
+	if err = os.Rename(c.Path, c.Path+".1"); err != nil {
+		return err
+	}
+
+	c.Size = 0
+	c.File, err = os.OpenFile(c.Path, os.O_CREATE|os.O_WRONLY|os.O_TRUNC, 0600)
+
+	return err
+}
+
+// dump
+// writes the captured requests, oldest first.
+func (c *capture) dump(Writer io.Writer) error {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	if c.Ring != nil {
+		for i := range c.Ring {
+			if Entry := c.Ring[(c.Next+i)%len(c.Ring)]; Entry != nil {
+				if _, err := Writer.Write(Entry); err != nil {
+					return err
+				}
+			}
+		}
+
+		return nil
+	}
+
+	for i := c.Files; i >= 0; i-- {
+		var Path = c.Path
+
+		if i > 0 {
+			Path = fmt.Sprintf("%v.%v", c.Path, i)
+		}
+
+		File, err := os.Open(Path)
+		if err != nil {
+			continue
+		}
+
+		_, err = io.Copy(Writer, File)
+		File.Close()
+
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func (c *capture) close() {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	if c.File != nil {
+		c.File.Close()
+		c.File = nil
+	}
+}
+
+// capturing
+// captures the request and the response of the handlers when the capture
+// of the listener is enabled.
+func (h *HTTP) capturing(ctx *gin.Context) {
+	var (
+		Start = time.Now()
+		Body  []byte
+		err   error
+	)
+
+	if h.capture == nil {
+		ctx.Next()
+		return
+	}
+
+	/* the handlers read the whole body anyway */
+	if Body, err = io.ReadAll(ctx.Request.Body); err != nil {
+		logger.Debug("Error while reading request: " + err.Error())
+	}
+
+	ctx.Request.Body = io.NopCloser(bytes.NewReader(Body))
+
+	var Writer = &captureWriter{ResponseWriter: ctx.Writer, MaxBody: h.capture.MaxBody}
+
+	ctx.Writer = Writer
+
+	ctx.Next()
+
+	h.capture.record(h.Config.Name, ctx.Request, Body, Writer, time.Since(Start))
+}
+
+// CaptureDump
+// writes what the capture of the listener recorded, oldest first.
+func (h *HTTP) CaptureDump(Writer io.Writer) error {
+	if h.capture == nil {
+		return errors.New("capture of listener " + h.Config.Name + " isn't enabled")
+	}
+
+	return h.capture.dump(Writer)
+}
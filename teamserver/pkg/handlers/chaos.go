@@ -0,0 +1,318 @@
+package handlers
+
+import (
+	"errors"
+	"fmt"
+	"math/rand"
+	"net"
+	"strconv"
+	"sync"
+	"time"
+
+	"Havoc/pkg/logger"
+
+	"github.com/gin-gonic/gin"
+)
+
+// default time a flapping listener stays down
+const CHAOS_DOWN = 30 * time.Second
+
+// chaos
+// the failures injected into the transport of a listener. only set up
+// when the teamserver runs with --chaos, never on an engagement.
+type chaos struct {
+	Name string
+
+	Loss     int
+	Truncate int
+	Latency  time.Duration
+	Jitter   time.Duration
+	Flap     time.Duration
+	Down     time.Duration
+}
+
+// newChaos
+// parses the failures to inject into the listener.
+func newChaos(Name string, Config *HTTPChaos) (*chaos, error) {
+	var (
+		Chaos = &chaos{
+			Name:     Name,
+			Loss:     Config.Loss,
+			Truncate: Config.Truncate,
+			Down:     CHAOS_DOWN,
+		}
+		err error
+	)
+
+	if Chaos.Loss < 0 || Chaos.Loss > 100 || Chaos.Truncate < 0 || Chaos.Truncate > 100 {
+		return nil, errors.New("Loss and Truncate are percentages (0-100)")
+	}
+
+	for _, Setting := range []struct {
+		Name   string
+		Value  string
+		Target *time.Duration
+	}{
+		{Name: "Latency", Value: Config.Latency, Target: &Chaos.Latency},
+		{Name: "Jitter", Value: Config.Jitter, Target: &Chaos.Jitter},
+		{Name: "Flap", Value: Config.Flap, Target: &Chaos.Flap},
+		{Name: "Down", Value: Config.Down, Target: &Chaos.Down},
+	} {
+		if len(Setting.Value) == 0 {
+			continue
+		}
+
+		if *Setting.Target, err = time.ParseDuration(Setting.Value); err != nil || *Setting.Target < 0 {
+			return nil, fmt.Errorf("invalid %v: %v", Setting.Name, Setting.Value)
+		}
+	}
+
+	if Chaos.Flap > 0 && Chaos.Down <= 0 {
+		return nil, errors.New("a flapping listener needs a Down time")
+	}
+
+	return Chaos, nil
+}
+
+// String
+// describes the injected failures for the logs.
+func (c *chaos) String() string {
+	var Description = fmt.Sprintf("%v%% loss, %v%% truncated, %v latency (+%v jitter)", c.Loss, c.Truncate, c.Latency, c.Jitter)
+
+	if c.Flap > 0 {
+		Description += fmt.Sprintf(", down for %v every %v", c.Down, c.Flap)
+	}
+
+	return Description
+}
+
+// chance
+// returns true for Percent percent of the calls.
+func chance(Percent int) bool {
+	return Percent > 0 && rand.Intn(100) < Percent
+}
+
+// chaotic
+// delays, drops and cuts short the requests of the listener as its chaos
+// config says. dropped requests never reach the teamserver.
+func (h *HTTP) chaotic(ctx *gin.Context) {
+	if h.chaos == nil {
+		ctx.Next()
+		return
+	}
+
+	if Delay := h.chaos.Latency; Delay > 0 || h.chaos.Jitter > 0 {
+		if h.chaos.Jitter > 0 {
+			Delay += time.Duration(rand.Int63n(int64(h.chaos.Jitter)))
+		}
+
+		select {
+		case <-time.After(Delay):
+		case <-ctx.Request.Context().Done():
+			ctx.Abort()
+			return
+		}
+	}
+
+	if chance(h.chaos.Loss) {
+		logger.Debug("Chaos: dropped request of " + ctx.ClientIP() + " to listener " + h.Config.Name)
+
+		/* closed without an answer like a lost packet the agent times out on */
+		if Conn, _, err := ctx.Writer.Hijack(); err == nil {
+			Conn.Close()
+		}
+
+		ctx.Abort()
+		return
+	}
+
+	if chance(h.chaos.Truncate) {
+		logger.Debug("Chaos: truncating response to " + ctx.ClientIP() + " from listener " + h.Config.Name)
+
+		ctx.Writer = &chaosWriter{ResponseWriter: ctx.Writer}
+	}
+
+	ctx.Next()
+}
+
+// chaosWriter
+// sends the first half of the response announced with its full length
+// and closes the connection.
+type chaosWriter struct {
+	gin.ResponseWriter
+	truncated bool
+}
+
+func (w *chaosWriter) Write(Data []byte) (int, error) {
+	if w.truncated {
+		return len(Data), nil
+	}
+
+	w.truncated = true
+	w.Header().Set("Content-Length", strconv.Itoa(len(Data)))
+
+	if _, err := w.ResponseWriter.Write(Data[:len(Data)/2]); err != nil {
+		return 0, err
+	}
+
+	w.ResponseWriter.Flush()
+
+	if Conn, _, err := w.ResponseWriter.Hijack(); err == nil {
+		Conn.Close()
+	}
+
+	return len(Data), nil
+}
+
+func (w *chaosWriter) WriteString(Data string) (int, error) {
+	return w.Write([]byte(Data))
+}
+
+// chaosListener
+// a listener that goes down every Flap for Down. the socket is closed
+// while down so agents get their connections refused.
+type chaosListener struct {
+	Chaos   *chaos
+	Address net.Addr
+
+	mutex    sync.Mutex
+	listener net.Listener
+	up       chan struct{}
+	done     chan struct{}
+	closed   bool
+}
+
+// listener
+// wraps the socket of the listener to flap it. without Flap the socket
+// is returned as is.
+func (c *chaos) listener(Listener net.Listener) net.Listener {
+	if c.Flap <= 0 {
+		return Listener
+	}
+
+	var Flapping = &chaosListener{
+		Chaos:    c,
+		Address:  Listener.Addr(),
+		listener: Listener,
+		done:     make(chan struct{}),
+	}
+
+	go Flapping.flap()
+
+	return Flapping
+}
+
+// flap
+// closes the socket every Flap and listens again after Down.
+func (l *chaosListener) flap() {
+	for {
+		select {
+		case <-time.After(l.Chaos.Flap):
+		case <-l.done:
+			return
+		}
+
+		var Up = make(chan struct{})
+
+		l.mutex.Lock()
+		if l.closed {
+			l.mutex.Unlock()
+			return
+		}
+		l.up = Up
+		l.listener.Close()
+		l.mutex.Unlock()
+
+		logger.Warn(fmt.Sprintf("Chaos: listener %v is down for %v", l.Chaos.Name, l.Chaos.Down))
+
+		select {
+		case <-time.After(l.Chaos.Down):
+		case <-l.done:
+			return
+		}
+
+		for {
+			Listener, err := net.Listen("tcp", l.Address.String())
+			if err == nil {
+				l.mutex.Lock()
+				if l.closed {
+					l.mutex.Unlock()
+					Listener.Close()
+					return
+				}
+				l.listener = Listener
+				l.up = nil
+				l.mutex.Unlock()
+
+				close(Up)
+				break
+			}
+
+			logger.Error("Chaos: failed to bring listener " + l.Chaos.Name + " back up: " + err.Error())
+
+			select {
+			case <-time.After(time.Second):
+			case <-l.done:
+				return
+			}
+		}
+
+		logger.Warn("Chaos: listener " + l.Chaos.Name + " is up again")
+	}
+}
+
+func (l *chaosListener) Accept() (net.Conn, error) {
+	for {
+		l.mutex.Lock()
+		var Listener, Up = l.listener, l.up
+		l.mutex.Unlock()
+
+		if Up != nil {
+			select {
+			case <-Up:
+				continue
+			case <-l.done:
+				return nil, net.ErrClosed
+			}
+		}
+
+		Conn, err := Listener.Accept()
+		if err != nil {
+			/* the socket got closed by the flap, not by the server */
+			l.mutex.Lock()
+			var Flapped = !l.closed && (l.up != nil || l.listener != Listener)
+			l.mutex.Unlock()
+
+			if Flapped {
+				continue
+			}
+
+			return nil, err
+		}
+
+		return Conn, nil
+	}
+}
+
+func (l *chaosListener) Close() error {
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+
+	if l.closed {
+		return nil
+	}
+
+	l.closed = true
+	close(l.done)
+
+	if l.up != nil {
+		/* already closed by the flap */
+		return nil
+	}
+
+	return l.listener.Close()
+}
+
+func (l *chaosListener) Addr() net.Addr {
+	return l.Address
+}
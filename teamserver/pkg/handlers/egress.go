@@ -0,0 +1,368 @@
+package handlers
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	// size of the random body of an egress probe
+	EGRESS_PROBE_SIZE = 64
+	// time every stage of the egress test of the teamserver may take
+	EGRESS_TIMEOUT = 15 * time.Second
+
+	EGRESS_DNS     = "DNS"
+	EGRESS_TCP     = "TCP"
+	EGRESS_TLS     = "TLS"
+	EGRESS_HTTP    = "HTTP"
+	EGRESS_PROFILE = "Profile"
+)
+
+// egressProbes
+// the probes of running egress tests by their body. the listener a probe
+// reaches records whether the profile accepts it.
+var egressProbes sync.Map
+
+// egressProbe
+// what the listener saw of an egress probe.
+type egressProbe struct {
+	mutex     sync.Mutex
+	Listener  string
+	Reason    string
+	Forwarded string
+	Seen      bool
+}
+
+// EgressDial
+// connects to the address (host:port) of the tested url, eg: through an
+// agent. the dns of the host is resolved by the other end.
+type EgressDial func(Address string) (net.Conn, error)
+
+// EgressStage
+// result of a stage of the egress test.
+type EgressStage struct {
+	Stage   string
+	Success bool
+	Detail  string
+	Elapsed string
+}
+
+// EgressReport
+// how far the egress test got through the chain to the listener.
+type EgressReport struct {
+	Listener string
+	Url      string
+	Stages   []EgressStage
+	/* stage the chain breaks at, empty if the probe went through */
+	Broken string
+}
+
+// stage
+// appends the result of a stage, the failure of one breaks the chain.
+func (r *EgressReport) stage(Stage string, Start time.Time, err error, Detail string) bool {
+	var Result = EgressStage{
+		Stage:   Stage,
+		Success: err == nil,
+		Detail:  Detail,
+		Elapsed: time.Since(Start).Round(time.Millisecond).String(),
+	}
+
+	if err != nil {
+		Result.Detail = err.Error()
+		r.Broken = Stage
+	}
+
+	r.Stages = append(r.Stages, Result)
+
+	return err == nil
+}
+
+// EgressUrl
+// the url the payloads of the listener connect to.
+func (h *HTTP) EgressUrl() string {
+	var (
+		Scheme = "http://"
+		Port   = h.Config.PortConn
+		Host   = h.Config.HostBind
+	)
+
+	if h.Config.Secure {
+		Scheme = "https://"
+	}
+
+	if len(Port) == 0 || Port == "0" {
+		Port = h.Config.PortBind
+	}
+
+	if len(h.Config.Hosts) > 0 {
+		Host = h.Config.Hosts[0]
+	}
+
+	if _, _, err := net.SplitHostPort(Host); err == nil {
+		return Scheme + Host
+	}
+
+	return Scheme + net.JoinHostPort(Host, Port)
+}
+
+// Egress
+// sends a probe shaped like the requests of the agents to the url (the
+// listener, a redirector or cdn in front of it) and reports where the
+// chain breaks: dns, tcp, tls, http or the profile of the listener. Without
+// a dial the teamserver connects itself. Every stage may take the timeout
+// (EGRESS_TIMEOUT if zero).
+func (h *HTTP) Egress(Target string, Dial EgressDial, Timeout time.Duration) EgressReport {
+	var (
+		Report = EgressReport{Listener: h.Config.Name, Url: Target}
+		Nonce  = make([]byte, EGRESS_PROBE_SIZE)
+		Probe  = &egressProbe{}
+		Conn   net.Conn
+		Start  time.Time
+	)
+
+	if len(Target) == 0 {
+		Report.Url = h.EgressUrl()
+	}
+
+	if Timeout == 0 {
+		Timeout = EGRESS_TIMEOUT
+	}
+
+	Url, err := url.Parse(Report.Url)
+	if err == nil && Url.Scheme != "http" && Url.Scheme != "https" {
+		err = fmt.Errorf("unsupported scheme %v", Url.Scheme)
+	}
+	if err != nil {
+		Report.stage(EGRESS_DNS, time.Now(), fmt.Errorf("invalid url %v: %v", Report.Url, err), "")
+		return Report
+	}
+
+	var (
+		Host = Url.Hostname()
+		Port = Url.Port()
+	)
+
+	if len(Port) == 0 {
+		Port = "80"
+		if Url.Scheme == "https" {
+			Port = "443"
+		}
+	}
+
+	/* dns */
+	Start = time.Now()
+	if Dial != nil {
+		Report.stage(EGRESS_DNS, Start, nil, "resolved by the agent")
+	} else if IP := net.ParseIP(Host); IP != nil {
+		Report.stage(EGRESS_DNS, Start, nil, "ip address")
+	} else {
+		Ctx, Cancel := context.WithTimeout(context.Background(), Timeout)
+		Addresses, err := net.DefaultResolver.LookupHost(Ctx, Host)
+		Cancel()
+
+		if !Report.stage(EGRESS_DNS, Start, err, strings.Join(Addresses, ", ")) {
+			return Report
+		}
+	}
+
+	/* tcp */
+	Start = time.Now()
+	if Dial != nil {
+		Conn, err = Dial(net.JoinHostPort(Host, Port))
+	} else {
+		Conn, err = net.DialTimeout("tcp", net.JoinHostPort(Host, Port), Timeout)
+	}
+
+	if err != nil {
+		Report.stage(EGRESS_TCP, Start, err, "")
+		return Report
+	}
+	defer Conn.Close()
+
+	if Dial != nil {
+		Report.stage(EGRESS_TCP, Start, nil, "connected through the agent to "+net.JoinHostPort(Host, Port))
+	} else {
+		Report.stage(EGRESS_TCP, Start, nil, "connected to "+Conn.RemoteAddr().String())
+	}
+
+	/* tls: the agents don't verify the certificate, an untrusted one doesn't break the chain */
+	if Url.Scheme == "https" {
+		Start = time.Now()
+
+		var Client = tls.Client(Conn, &tls.Config{ServerName: Host, InsecureSkipVerify: true})
+
+		Conn.SetDeadline(time.Now().Add(Timeout))
+		if err = Client.Handshake(); err != nil {
+			Report.stage(EGRESS_TLS, Start, err, "")
+			return Report
+		}
+
+		Report.stage(EGRESS_TLS, Start, nil, egressCertificate(Client.ConnectionState(), Host))
+
+		Conn = Client
+	}
+
+	/* http: the probe looks like a request of an agent */
+	if _, err = rand.Read(Nonce); err != nil {
+		Report.stage(EGRESS_HTTP, time.Now(), err, "")
+		return Report
+	}
+
+	egressProbes.Store(string(Nonce), Probe)
+	defer egressProbes.Delete(string(Nonce))
+
+	if len(Url.Path) <= 1 && len(h.Config.Uris) > 0 {
+		Url.Path, Url.RawQuery, _ = strings.Cut(h.Config.Uris[0], "?")
+	}
+
+	Start = time.Now()
+
+	Request, err := http.NewRequest(http.MethodPost, Url.String(), bytes.NewReader(Nonce))
+	if err != nil {
+		Report.stage(EGRESS_HTTP, Start, err, "")
+		return Report
+	}
+
+	if len(h.Config.HostHeader) > 0 {
+		Request.Host = h.Config.HostHeader
+	}
+
+	if len(h.Config.UserAgent) > 0 {
+		Request.Header.Set("User-Agent", h.Config.UserAgent)
+	}
+
+	for _, Header := range h.Config.Headers {
+		if NameValue := strings.SplitN(Header, ": ", 2); len(NameValue) > 1 {
+			if strings.EqualFold(NameValue[0], "Host") {
+				Request.Host = NameValue[1]
+			} else {
+				Request.Header.Set(NameValue[0], NameValue[1])
+			}
+		}
+	}
+
+	Conn.SetDeadline(time.Now().Add(Timeout))
+	if err = Request.Write(Conn); err != nil {
+		Report.stage(EGRESS_HTTP, Start, err, "")
+		return Report
+	}
+
+	Response, err := http.ReadResponse(bufio.NewReader(Conn), Request)
+	if err != nil {
+		Report.stage(EGRESS_HTTP, Start, fmt.Errorf("no response to %v %v: %v", Request.Method, Url.RequestURI(), err), "")
+		return Report
+	}
+	defer Response.Body.Close()
+
+	Body, _ := io.ReadAll(io.LimitReader(Response.Body, EGRESS_PROBE_SIZE*2))
+
+	Report.stage(EGRESS_HTTP, Start, nil, fmt.Sprintf("%v %v answered with %v", Request.Method, Url.RequestURI(), Response.Status))
+
+	/* profile: what the listener made of the probe */
+	Start = time.Now()
+
+	Probe.mutex.Lock()
+	defer Probe.mutex.Unlock()
+
+	switch {
+
+	case !Probe.Seen:
+		Report.stage(EGRESS_PROFILE, Start, fmt.Errorf("the request didn't reach the listener, %v", egressServer(Response)), "")
+
+	case Probe.Listener != h.Config.Name:
+		Report.stage(EGRESS_PROFILE, Start, fmt.Errorf("the request reached listener %v instead", Probe.Listener), "")
+
+	case len(Probe.Reason) > 0:
+		Report.stage(EGRESS_PROFILE, Start, fmt.Errorf("the listener refused the request: %v", Probe.Reason), "")
+
+	case !bytes.Equal(Body, Nonce):
+		Report.stage(EGRESS_PROFILE, Start, fmt.Errorf("the listener accepted the request but its response got changed on the way back (%v)", Response.Status), "")
+
+	case h.Config.BehindRedir && len(Probe.Forwarded) == 0:
+		Report.stage(EGRESS_PROFILE, Start, nil, "accepted, but the redirector doesn't set X-Forwarded-For")
+
+	default:
+		Report.stage(EGRESS_PROFILE, Start, nil, "accepted by the listener")
+
+	}
+
+	return Report
+}
+
+// egressSeen
+// records what the listener made of the request if it is an egress probe,
+// the reason is empty if the profile accepts it.
+func (h *HTTP) egressSeen(Body []byte, Forwarded, Reason string) bool {
+	if len(Body) != EGRESS_PROBE_SIZE {
+		return false
+	}
+
+	Value, ok := egressProbes.Load(string(Body))
+	if !ok {
+		return false
+	}
+
+	var Probe = Value.(*egressProbe)
+
+	Probe.mutex.Lock()
+	defer Probe.mutex.Unlock()
+
+	/* a probe the redirector retries keeps the first verdict */
+	if !Probe.Seen {
+		Probe.Seen = true
+		Probe.Listener = h.Config.Name
+		Probe.Reason = Reason
+		Probe.Forwarded = Forwarded
+	}
+
+	return true
+}
+
+// egressCertificate
+// describes the certificate of the handshake and if clients would trust it.
+func egressCertificate(State tls.ConnectionState, Host string) string {
+	var (
+		Leaf    = State.PeerCertificates[0]
+		Pool    = x509.NewCertPool()
+		Version = tls.VersionName(State.Version)
+		Detail  string
+	)
+
+	for _, Intermediate := range State.PeerCertificates[1:] {
+		Pool.AddCert(Intermediate)
+	}
+
+	Detail = fmt.Sprintf("%v, %v issued by %v, expires %v", Version, Leaf.Subject.CommonName, Leaf.Issuer.CommonName, Leaf.NotAfter.Format("02/01/2006"))
+
+	if _, err := Leaf.Verify(x509.VerifyOptions{DNSName: Host, Intermediates: Pool}); err != nil {
+		Detail += ", not trusted: " + err.Error()
+	}
+
+	if len(State.OCSPResponse) > 0 {
+		Detail += ", ocsp stapled"
+	}
+
+	return Detail
+}
+
+// egressServer
+// names what answered a request that didn't reach the listener.
+func egressServer(Response *http.Response) string {
+	if Server := Response.Header.Get("Server"); len(Server) > 0 {
+		return Server + " answered with " + Response.Status
+	}
+
+	return "something in between answered with " + Response.Status
+}
@@ -9,6 +9,7 @@ import (
 	"Havoc/pkg/agent"
 	"Havoc/pkg/common/packer"
 	"Havoc/pkg/common/parser"
+	"Havoc/pkg/keyring"
 	"Havoc/pkg/logger"
 )
 
@@ -20,7 +21,11 @@ import (
 //
 //	Response byte.Buffer
 //	Success	 bool
-func parseAgentRequest(Teamserver agent.TeamServer, Body []byte, ExternalIP string) (bytes.Buffer, bool) {
+//
+// CallbackHost is the host the agent used to reach the listener (empty if unknown).
+// Listener is the name of the listener the request came in over.
+// Workspace is the workspace of the listener new agents get assigned to.
+func parseAgentRequest(Teamserver agent.TeamServer, Body []byte, ExternalIP string, CallbackHost string, Listener string, Workspace string) (bytes.Buffer, bool) {
 
 	var (
 		Header   agent.Header
@@ -40,7 +45,7 @@ func parseAgentRequest(Teamserver agent.TeamServer, Body []byte, ExternalIP stri
 
 	// handle this demon connection if the magic value matches
 	if Header.MagicValue == agent.DEMON_MAGIC_VALUE {
-		return handleDemonAgent(Teamserver, Header, ExternalIP)
+		return handleDemonAgent(Teamserver, Header, ExternalIP, CallbackHost, Listener, Workspace)
 	}
 
 	// If it's not a Demon request then try to see if it's a 3rd party agent.
@@ -53,7 +58,7 @@ func parseAgentRequest(Teamserver agent.TeamServer, Body []byte, ExternalIP stri
 //
 //	Response bytes.Buffer
 //	Success  bool
-func handleDemonAgent(Teamserver agent.TeamServer, Header agent.Header, ExternalIP string) (bytes.Buffer, bool) {
+func handleDemonAgent(Teamserver agent.TeamServer, Header agent.Header, ExternalIP string, CallbackHost string, Listener string, Workspace string) (bytes.Buffer, bool) {
 
 	var (
 		Agent     *agent.Agent
@@ -62,6 +67,7 @@ func handleDemonAgent(Teamserver agent.TeamServer, Header agent.Header, External
 		Command   uint32
 		Packer    *packer.Packer
 		Build     []byte
+		Pressure  *agent.Job
 		err       error
 	)
 
@@ -70,6 +76,9 @@ func handleDemonAgent(Teamserver agent.TeamServer, Header agent.Header, External
 
 		/* get our agent instance based on the agent id */
 		Agent = Teamserver.AgentInstance(Header.AgentID)
+		Agent.UpdateCallbackHost(Teamserver, CallbackHost)
+		Agent.UpdateExternalIP(Teamserver, ExternalIP)
+		Agent.UpdateTransport(Teamserver, Listener)
 		Agent.UpdateLastCallback(Teamserver)
 
 		// while we can read a command and request id, parse new packages
@@ -82,10 +91,20 @@ func handleDemonAgent(Teamserver agent.TeamServer, Header agent.Header, External
 			/* check if this is a 'reconnect' request */
 			if Command == agent.DEMON_INIT {
 				logger.Debug(fmt.Sprintf("Agent: %x, Command: DEMON_INIT", Header.AgentID))
-				Packer = packer.NewPacker(Agent.Encryption.AESKey, Agent.Encryption.AESIv)
+
+				/* the agent re-authenticates with the session key of its register request */
+				if Agent, err = Teamserver.AgentResume(Header.AgentID, agent.ParseDemonRegisterRequest(Header.AgentID, Header.Data, ExternalIP)); err != nil || Agent == nil {
+					logger.Debug(fmt.Sprintf("Agent: %x, refused reconnect: %v", Header.AgentID, err))
+					return Response, false
+				}
+
+				var AESKey, AESIv = Agent.Encryption.Keys()
+
+				Packer = packer.NewPacker(AESKey, AESIv)
 				Packer.AddUInt32(uint32(Header.AgentID))
 
 				Build = Packer.Build()
+				keyring.Wipe(AESKey, AESIv)
 
 				_, err = Response.Write(Build)
 				if err != nil {
@@ -99,12 +118,24 @@ func handleDemonAgent(Teamserver agent.TeamServer, Header agent.Header, External
 			if first_iter {
 				first_iter = false
 				// if the message is not a reconnect, decrypt the buffer
-				Header.Data.DecryptBuffer(Agent.Encryption.AESKey, Agent.Encryption.AESIv)
+				Agent.DecryptBuffer(Header.Data)
+
+				// refuse floods before parsing them and tell the agent to slow down if needed
+				if Pressure, err = Teamserver.AgentInbound(Agent, Header.Data.Length()); err != nil {
+					logger.Debug(fmt.Sprintf("Agent: %x, refused request: %v", Header.AgentID, err))
+					return Response, false
+				}
+				defer Teamserver.AgentInboundDone(Agent)
 			}
 
 			/* The agent is sending us the result of a task */
 			if Command != agent.COMMAND_GET_JOB {
-				Parser := parser.NewParser(Header.Data.ParseBytes())
+				Parser, ok := agent.ParseTaskResponse(Header.Data)
+				if !ok {
+					logger.Debug(fmt.Sprintf("Agent: %x, Command: %d, Truncated response", Header.AgentID, Command))
+					break
+				}
+
 				Agent.TaskDispatch(RequestID, Command, Parser, Teamserver)
 			} else {
 				asked_for_jobs = true
@@ -118,7 +149,11 @@ func handleDemonAgent(Teamserver agent.TeamServer, Header agent.Header, External
 				Data:    []interface{}{},
 			}}
 
-			var Payload = agent.BuildPayloadMessage(NoJob, Agent.Encryption.AESKey, Agent.Encryption.AESIv)
+			if Pressure != nil {
+				NoJob = append([]agent.Job{*Pressure}, NoJob...)
+			}
+
+			var Payload = Agent.PayloadMessage(NoJob)
 
 			_, err = Response.Write(Payload)
 			if err != nil {
@@ -130,9 +165,18 @@ func handleDemonAgent(Teamserver agent.TeamServer, Header agent.Header, External
 			/* if there is a job then send the Task Queue */
 			var (
 				job     = Agent.GetQueuedJobs()
-				payload = agent.BuildPayloadMessage(job, Agent.Encryption.AESKey, Agent.Encryption.AESIv)
+				payload []byte
 			)
 
+			/* journaled before they leave, a crash doesn't deliver them twice */
+			Teamserver.TasksDelivered(Agent, job)
+
+			if Pressure != nil {
+				payload = Agent.PayloadMessage(append([]agent.Job{*Pressure}, job...))
+			} else {
+				payload = Agent.PayloadMessage(job)
+			}
+
 			// write the response to the buffer
 			_, err = Response.Write(payload)
 			if err != nil {
@@ -142,7 +186,7 @@ func handleDemonAgent(Teamserver agent.TeamServer, Header agent.Header, External
 
 			// TODO: move this to its own function
 			// show bytes for pivot
-			var CallbackSizes = make(map[uint32][]byte)
+			var CallbackSizes = make(map[uint32]int)
 			for j := range job {
 
 				if len(job[j].Data) >= 1 {
@@ -190,7 +234,7 @@ func handleDemonAgent(Teamserver agent.TeamServer, Header agent.Header, External
 
 								/* create a new parse for the parsed task */
 								Parser = parser.NewParser(TaskBuffer)
-								Parser.DecryptBuffer(PivotInstance.Encryption.AESKey, PivotInstance.Encryption.AESIv)
+								PivotInstance.DecryptBuffer(Parser)
 
 								if Parser.Length() >= 4 {
 
@@ -205,7 +249,7 @@ func handleDemonAgent(Teamserver agent.TeamServer, Header agent.Header, External
 										continue
 
 									} else {
-										CallbackSizes[uint32(PivotAgentID)] = append(CallbackSizes[job[j].Data[1].(uint32)], TaskBuffer...)
+										CallbackSizes[uint32(PivotAgentID)] = CallbackSizes[job[j].Data[1].(uint32)] + len(TaskBuffer)
 
 										break
 									}
@@ -232,26 +276,23 @@ func handleDemonAgent(Teamserver agent.TeamServer, Header agent.Header, External
 
 					default:
 						//logger.Debug("Default")
-						/* build the task payload */
-						payload = agent.BuildPayloadMessage([]agent.Job{job[j]}, Agent.Encryption.AESKey, Agent.Encryption.AESIv)
-
-						/* add the size of the task to the callback size */
-						CallbackSizes[uint32(Header.AgentID)] = append(CallbackSizes[uint32(Header.AgentID)], payload...)
+						/* add the size of the task to the callback size. no need to package it again */
+						CallbackSizes[uint32(Header.AgentID)] += agent.JobSize(job[j])
 
 						break
 
 					}
 
 				} else {
-					CallbackSizes[uint32(Header.AgentID)] = append(CallbackSizes[uint32(Header.AgentID)], payload...)
+					CallbackSizes[uint32(Header.AgentID)] += agent.JobSize(job[j])
 				}
 
 			}
 
-			for agentID, buffer := range CallbackSizes {
+			for agentID, size := range CallbackSizes {
 				Agent = Teamserver.AgentInstance(int(agentID))
 				if Agent != nil {
-					Teamserver.AgentCallbackSize(Agent, len(buffer))
+					Teamserver.AgentCallbackSize(Agent, size)
 				}
 			}
 
@@ -275,16 +316,33 @@ func handleDemonAgent(Teamserver agent.TeamServer, Header agent.Header, External
 				return Response, false
 			}
 
-			Agent.Info.MagicValue = Header.MagicValue
-			Agent.Info.Listener = nil /* TODO: pass here the listener instance/name */
+			/* a dead or archived session of a previous run reconnected */
+			if Session, err := Teamserver.AgentResume(Header.AgentID, Agent); err != nil {
+				logger.Debug(fmt.Sprintf("Agent: %x, refused register request: %v", Header.AgentID, err))
+				return Response, false
+			} else if Session != nil {
+				Agent = Session
+				Agent.UpdateCallbackHost(Teamserver, CallbackHost)
+				Agent.UpdateTransport(Teamserver, Listener)
+			} else {
+				Agent.Info.MagicValue = Header.MagicValue
+				Agent.Info.Listener = nil /* TODO: pass here the listener instance/name */
+				Agent.Info.CallbackHost = CallbackHost
+				Agent.Info.Workspace = Workspace
+
+				Teamserver.AgentAdd(Agent)
+				Teamserver.AgentSendNotify(Agent)
+
+				Agent.UpdateTransport(Teamserver, Listener)
+			}
 
-			Teamserver.AgentAdd(Agent)
-			Teamserver.AgentSendNotify(Agent)
+			var AESKey, AESIv = Agent.Encryption.Keys()
 
-			Packer = packer.NewPacker(Agent.Encryption.AESKey, Agent.Encryption.AESIv)
+			Packer = packer.NewPacker(AESKey, AESIv)
 			Packer.AddUInt32(uint32(Header.AgentID))
 
 			Build = Packer.Build()
+			keyring.Wipe(AESKey, AESIv)
 
 			_, err = Response.Write(Build)
 			if err != nil {
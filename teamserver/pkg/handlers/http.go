@@ -2,16 +2,21 @@ package handlers
 
 import (
 	"context"
+	"crypto/tls"
 	//"encoding/hex"
 	"io"
 	"log"
+	"net"
 	"net/http"
 	"os"
 	"regexp"
+	"runtime/debug"
 	"strings"
 	"time"
 	"fmt"
 
+	"Havoc/pkg/agent"
+	"Havoc/pkg/budget"
 	"Havoc/pkg/colors"
 	"Havoc/pkg/common/certs"
 	"Havoc/pkg/common"
@@ -29,6 +34,30 @@ func NewConfigHttp() *HTTP {
 	return config
 }
 
+// ProxyMode
+// returns which proxy mode the agent should use to reach the listener.
+// configs without a mode fall back to the old "Proxy Enabled" switch.
+func ProxyMode(Config HTTPConfig) string {
+	switch strings.ToLower(Config.Proxy.Mode) {
+
+	case "explicit":
+		return PROXY_MODE_EXPLICIT
+
+	case "direct":
+		return PROXY_MODE_DIRECT
+
+	case "system":
+		return PROXY_MODE_SYSTEM
+
+	}
+
+	if Config.Proxy.Enabled {
+		return PROXY_MODE_EXPLICIT
+	}
+
+	return PROXY_MODE_SYSTEM
+}
+
 func (h *HTTP) generateCertFiles() bool {
 
 	var (
@@ -57,7 +86,7 @@ func (h *HTTP) generateCertFiles() bool {
 	h.TLS.CertPath = ListenerPath + "server.crt"
 	h.TLS.KeyPath = ListenerPath + "server.key"
 
-	h.TLS.Cert, h.TLS.Key, err = certs.HTTPSGenerateRSACertificate(common.GetInterfaceIpv4Addr(h.Config.HostBind))
+	h.TLS.Cert, h.TLS.Key, err = certs.HTTPSGenerateRSACertificateFromTemplate(common.GetInterfaceIpv4Addr(h.Config.HostBind), h.Config.CertTemplate)
 
 	err = os.WriteFile(h.TLS.CertPath, h.TLS.Cert, 0644)
 	if err != nil {
@@ -90,9 +119,159 @@ func (h *HTTP) fake404(ctx *gin.Context) {
 	ctx.Writer.Write(html)
 }
 
+// recovery
+// keeps a panic while handling the request of an agent from taking
+// down the teamserver. answers like any unknown page.
+func (h *HTTP) recovery(ctx *gin.Context) {
+	defer func() {
+		if Panic := recover(); Panic != nil {
+			h.Teamserver.Crash("listener "+h.Config.Name+" request from "+ctx.ClientIP(), Panic, debug.Stack())
+			h.fake404(ctx)
+			ctx.Abort()
+		}
+	}()
+
+	ctx.Next()
+}
+
+// accounting
+// accounts the request in the budget of the listeners. requests
+// exceeding it are answered like any unknown page.
+func (h *HTTP) accounting(ctx *gin.Context) {
+	var (
+		Budget = h.Teamserver.Budget(budget.LISTENERS)
+		Size   = max(ctx.Request.ContentLength, 0)
+	)
+
+	if !Budget.Acquire(budget.Goroutines, 1) {
+		logger.Warn("Listener " + h.Config.Name + " exceeds its goroutine budget. refused request from " + ctx.ClientIP())
+		h.fake404(ctx)
+		ctx.Abort()
+		return
+	}
+	defer Budget.Release(budget.Goroutines, 1)
+
+	if !Budget.Acquire(budget.Memory, Size) {
+		logger.Warn("Listener " + h.Config.Name + " exceeds its memory budget. refused request from " + ctx.ClientIP())
+		h.fake404(ctx)
+		ctx.Abort()
+		return
+	}
+	defer Budget.Release(budget.Memory, Size)
+
+	ctx.Next()
+}
+
+// serve
+// listens on the address of the server and serves the sockets the
+// budget of the listeners allows.
+func (h *HTTP) serve(Serve func(Listener net.Listener) error) error {
+	var (
+		Listener net.Listener
+		err      error
+	)
+
+	/* https listeners routing by server name share their port */
+	if h.Config.Secure && len(h.Config.ServerNames) > 0 {
+		Listener, err = sniListen(h.Server.Addr, h.Config)
+	} else {
+		Listener, err = net.Listen("tcp", h.Server.Addr)
+	}
+
+	if err != nil {
+		return err
+	}
+
+	if h.chaos != nil {
+		Listener = h.chaos.listener(Listener)
+	}
+
+	return Serve(h.Teamserver.Budget(budget.LISTENERS).Listener(Listener))
+}
+
+// ParseHostHeaders
+// parses the per host Host headers as the client sends them ("a, , c").
+// Entries are by position of the hosts, an empty one means the host sends
+// itself. An empty field means no Host headers at all.
+func ParseHostHeaders(Value string) []string {
+	if len(Value) == 0 {
+		return nil
+	}
+
+	return strings.Split(Value, ", ")
+}
+
+// checkHost
+// checks the Host (or the X-Forwarded-Host) of a request if the listener
+// has a Host header or per host Host headers.
+func (h *HTTP) checkHost(Host, Forwarded string) bool {
+	if len(h.Config.HostHeader) == 0 && len(h.Config.HostHeaders) == 0 {
+		return true
+	}
+
+	return h.validHostHeader(Host) || h.validHostHeader(Forwarded)
+}
+
+// validHostHeader
+// checks if the given host matches the listener Host header
+// or one of the per host Host headers.
+func (h *HTTP) validHostHeader(Host string) bool {
+	if len(Host) == 0 {
+		return false
+	}
+
+	if len(h.Config.HostHeader) > 0 && strings.ToLower(Host) == strings.ToLower(h.Config.HostHeader) {
+		return true
+	}
+
+	return h.hostIndex(Host) >= 0
+}
+
+// hostIndex
+// index of the host whose per host Host header the given host is (the
+// host itself if it has none). -1 if it's none of them.
+func (h *HTTP) hostIndex(Host string) int {
+	for i, HostHeader := range h.Config.HostHeaders {
+		/* no Host header for this host means the agent sends the host itself */
+		if len(HostHeader) == 0 && i < len(h.Config.Hosts) {
+			HostHeader = h.Config.Hosts[i]
+		}
+
+		if len(HostHeader) > 0 && strings.ToLower(strings.Split(Host, ":")[0]) == strings.ToLower(strings.Split(HostHeader, ":")[0]) {
+			return i
+		}
+	}
+
+	return -1
+}
+
+// callbackHost
+// the host the agent dialed. Fronted hosts send their Host header instead,
+// it gets mapped back to the host so the host is tracked and burned. Hosts
+// sharing a Host header can't be told apart, the first one is taken.
+func (h *HTTP) callbackHost(Host string) string {
+	if i := h.hostIndex(Host); i >= 0 && i < len(h.Config.Hosts) {
+		return h.Config.Hosts[i]
+	}
+
+	return Host
+}
+
+// agentID
+// the id of the agent that sent the request. 0 if it isn't an agent request.
+func agentID(Body []byte) int {
+	Header, err := agent.ParseHeader(Body)
+	if err != nil {
+		return 0
+	}
+
+	return Header.AgentID
+}
+
 func (h *HTTP) request(ctx *gin.Context) {
 	var ExternalIP string
 	var MissingHdr string
+	var CallbackHost string
 
 	Body, err := io.ReadAll(ctx.Request.Body)
 	if err != nil {
@@ -140,10 +319,8 @@ func (h *HTTP) request(ctx *gin.Context) {
 		}
 	}
 
-	if len(h.Config.HostHeader) > 0 {
-		if strings.ToLower(ctx.Request.Host) == strings.ToLower(h.Config.HostHeader) {
-			valid = true
-		} else if strings.ToLower(ctx.Request.Header.Get("X-Forwarded-Host")) == strings.ToLower(h.Config.HostHeader) {
+	if len(h.Config.HostHeader) > 0 || len(h.Config.HostHeaders) > 0 {
+		if h.checkHost(ctx.Request.Host, ctx.Request.Header.Get("X-Forwarded-Host")) {
 			valid = true
 		} else {
 			MissingHdr = "Host: " + ctx.Request.Host + "; X-Forwarded-Host: " + ctx.Request.Header.Get("X-Forwarded-Host")
@@ -153,6 +330,7 @@ func (h *HTTP) request(ctx *gin.Context) {
 
 	if valid == false {
 		logger.Warn(fmt.Sprintf("got a request with an invalid header: %s", MissingHdr))
+		h.egressSeen(Body, ctx.Request.Header.Get("X-Forwarded-For"), "invalid header "+MissingHdr)
 		h.fake404(ctx)
 		return
 	}
@@ -169,6 +347,7 @@ func (h *HTTP) request(ctx *gin.Context) {
 
 		if valid == false {
 			logger.Warn(fmt.Sprintf("got a request with an invalid request path: %s", ctx.Request.RequestURI))
+			h.egressSeen(Body, ctx.Request.Header.Get("X-Forwarded-For"), "invalid request path "+ctx.Request.RequestURI)
 			h.fake404(ctx)
 			return
 		}
@@ -178,6 +357,7 @@ func (h *HTTP) request(ctx *gin.Context) {
 	if h.Config.UserAgent != "" {
 		if h.Config.UserAgent != ctx.Request.UserAgent() {
 			logger.Warn(fmt.Sprintf("got a request with an invalid user agent: %s", ctx.Request.UserAgent()))
+			h.egressSeen(Body, ctx.Request.Header.Get("X-Forwarded-For"), "invalid user agent "+ctx.Request.UserAgent())
 			h.fake404(ctx)
 			return
 		}
@@ -194,7 +374,27 @@ func (h *HTTP) request(ctx *gin.Context) {
 		}
 	}
 
-	if Response, Success := parseAgentRequest(h.Teamserver, Body, ExternalIP); Success {
+	CallbackHost = ctx.Request.Host
+	if h.Config.BehindRedir && len(ctx.Request.Header.Get("X-Forwarded-Host")) > 0 {
+		CallbackHost = ctx.Request.Header.Get("X-Forwarded-Host")
+	}
+	CallbackHost = h.callbackHost(CallbackHost)
+
+	// refuse callbacks over burned hosts so the agent rotates to the next one
+	if h.Teamserver.HostBurned(CallbackHost, agentID(Body)) {
+		logger.Debug("got a request over a burned host: " + CallbackHost)
+		h.egressSeen(Body, ctx.Request.Header.Get("X-Forwarded-For"), "burned host "+CallbackHost)
+		h.fake404(ctx)
+		return
+	}
+
+	// egress tests get their probe back instead of being parsed as an agent
+	if h.egressSeen(Body, ctx.Request.Header.Get("X-Forwarded-For"), "") {
+		ctx.Writer.Write(Body)
+		return
+	}
+
+	if Response, Success := parseAgentRequest(h.Teamserver, Body, ExternalIP, CallbackHost, h.Config.Name, h.Config.Workspace); Success {
 		_, err := ctx.Writer.Write(Response.Bytes())
 		if err != nil {
 			logger.Debug("Failed to write to request: " + err.Error())
@@ -219,6 +419,50 @@ func (h *HTTP) Start() {
 		return
 	}
 
+	if h.Config.Probe != nil {
+		var err error
+
+		if h.probe, err = newProbeCache(h.Config.Probe); err != nil {
+			logger.Error("Failed to setup the probe response of " + h.Config.Name + ": " + err.Error())
+		}
+	}
+
+	if h.Config.Capture != nil {
+		var err error
+
+		if h.capture, err = newCapture(h.Config.Name, h.Config.Capture); err != nil {
+			logger.Error("Failed to setup the capture of " + h.Config.Name + ": " + err.Error())
+		} else {
+			logger.Warn("Capturing the requests of listener " + h.Config.Name)
+		}
+	}
+
+	if h.Config.Record != nil {
+		var err error
+
+		if h.recorder, err = newRecorder(h.Config.Name, h.Config.Record); err != nil {
+			logger.Error("Failed to setup the recording of " + h.Config.Name + ": " + err.Error())
+		} else {
+			logger.Info("Recording the transactions of listener " + h.Config.Name + " to " + h.recorder.Path)
+		}
+	}
+
+	if h.Config.Chaos != nil {
+		var err error
+
+		if h.chaos, err = newChaos(h.Config.Name, h.Config.Chaos); err != nil {
+			logger.Error("Failed to setup the chaos of " + h.Config.Name + ": " + err.Error())
+		} else {
+			logger.Warn("Injecting failures into listener " + h.Config.Name + ": " + h.chaos.String())
+		}
+	}
+
+	h.GinEngine.Use(h.recovery)
+	h.GinEngine.Use(h.healthProbe)
+	h.GinEngine.Use(h.accounting)
+	h.GinEngine.Use(h.chaotic)
+	h.GinEngine.Use(h.capturing)
+	h.GinEngine.Use(h.recording)
 	h.GinEngine.POST("/*endpoint", h.request)
 	h.GinEngine.GET("/*endpoint", h.fake404)
 	h.Active = true
@@ -232,7 +476,7 @@ func (h *HTTP) Start() {
 			h.Teamserver.EventAppend(pk)
 			h.Teamserver.EventBroadcast("", pk)
 
-			go func() {
+			go h.Teamserver.Supervise("listener "+h.Config.Name, func() {
 				var (
 					CertPath = h.TLS.CertPath
 					KeyPath  = h.TLS.KeyPath
@@ -244,11 +488,29 @@ func (h *HTTP) Start() {
 				}
 
 				if h.Config.Cert.Cert != "" && h.Config.Cert.Key != "" {
-					CertPath = h.Config.Cert.Cert
-					KeyPath = h.Config.Cert.Key
+					/* path or resolved from a keystore, served with its whole chain and the ocsp response stapled */
+					Stapler, err := newStapler(h.Config.Name, h.Config.Cert.Cert, h.Config.Cert.Key)
+					if err != nil {
+						logger.Error("Couldn't load the certificate of the HTTPs handler: " + err.Error())
+						h.Active = false
+						h.Teamserver.EventListenerError(h.Config.Name, err)
+						return
+					}
+
+					if h.stapler != nil {
+						h.stapler.close()
+					}
+
+					h.stapler = Stapler
+					h.Server.TLSConfig = &tls.Config{GetCertificate: Stapler.GetCertificate}
+					CertPath, KeyPath = "", ""
+
+					go h.Teamserver.Supervise("ocsp stapling of "+h.Config.Name, Stapler.run)
 				}
 
-				err := h.Server.ListenAndServeTLS(CertPath, KeyPath)
+				err := h.serve(func(Listener net.Listener) error {
+					return h.Server.ServeTLS(Listener, CertPath, KeyPath)
+				})
 				if err != nil {
 					if err == http.ErrServerClosed {
 						h.Active = false
@@ -258,7 +520,7 @@ func (h *HTTP) Start() {
 						h.Teamserver.EventListenerError(h.Config.Name, err)
 					}
 				}
-			}()
+			})
 		} else {
 			logger.Error("Failed to generate server tls certifications")
 		}
@@ -269,19 +531,19 @@ func (h *HTTP) Start() {
 		h.Teamserver.EventAppend(pk)
 		h.Teamserver.EventBroadcast("", pk)
 
-		go func() {
+		go h.Teamserver.Supervise("listener "+h.Config.Name, func() {
 			h.Server = &http.Server{
 				Addr:    common.GetInterfaceIpv4Addr(h.Config.HostBind) + ":" + h.Config.PortBind,
 				Handler: h.GinEngine,
 			}
 
-			err := h.Server.ListenAndServe()
+			err := h.serve(h.Server.Serve)
 			if err != nil {
 				logger.Error("Couldn't start HTTP handler: " + err.Error())
 				h.Active = false
 				h.Teamserver.EventListenerError(h.Config.Name, err)
 			}
-		}()
+		})
 	}
 }
 
@@ -291,6 +553,18 @@ func (h *HTTP) Stop() error {
 	if err := h.Server.Shutdown(ctx); err != nil {
 		return err
 	}
+
+	if h.capture != nil {
+		h.capture.close()
+	}
+
+	if h.recorder != nil {
+		h.recorder.close()
+	}
+
+	if h.stapler != nil {
+		h.stapler.close()
+	}
 	// catching ctx.Done(). timeout of 5 seconds.
 	select {
 	case <-ctx.Done():
@@ -0,0 +1,49 @@
+package handlers
+
+import "testing"
+
+func TestHostHeaders(t *testing.T) {
+	/* a listener added from the client without Host headers */
+	var Listener = &HTTP{Config: HTTPConfig{
+		Hosts:       []string{"a.example.com", "b.example.com", "c.example.com"},
+		HostHeaders: ParseHostHeaders(""),
+	}}
+
+	if Listener.Config.HostHeaders != nil {
+		t.Fatalf("empty field parsed as %q", Listener.Config.HostHeaders)
+	}
+
+	for _, Host := range append(Listener.Config.Hosts, "other.example.com") {
+		if !Listener.checkHost(Host, "") {
+			t.Errorf("callback over %v refused", Host)
+		}
+	}
+
+	/* only the first host is fronted, the others send themselves */
+	Listener.Config.HostHeaders = ParseHostHeaders("front.cdn.example, , ")
+
+	for _, Host := range []string{"front.cdn.example", "b.example.com:443", "C.example.com"} {
+		if !Listener.checkHost(Host, "") {
+			t.Errorf("callback over %v refused", Host)
+		}
+	}
+
+	if Listener.checkHost("a.example.com", "") || Listener.checkHost("other.example.com", "") {
+		t.Error("callback over a host without its Host header accepted")
+	}
+
+	if !Listener.checkHost("redirector.example.com", "front.cdn.example") {
+		t.Error("forwarded Host header refused")
+	}
+
+	/* the fronted host is tracked and burned, not its Host header */
+	for Host, Dialed := range map[string]string{
+		"front.cdn.example:443": "a.example.com",
+		"b.example.com":         "b.example.com",
+		"other.example.com":     "other.example.com",
+	} {
+		if Callback := Listener.callbackHost(Host); Callback != Dialed {
+			t.Errorf("callback over %v tracked as %v", Host, Callback)
+		}
+	}
+}
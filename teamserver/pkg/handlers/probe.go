@@ -0,0 +1,290 @@
+package handlers
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"Havoc/pkg/logger"
+
+	"github.com/gin-gonic/gin"
+)
+
+const (
+	// default seconds a page fetched from the Url of a probe stays cached
+	PROBE_CACHE_TIME = 300
+	// max size of the page fetched from the Url of a probe
+	PROBE_MAX_BODY = 1 << 20
+)
+
+// probeCache
+// the prepared response to the health probes of a listener.
+type probeCache struct {
+	Probe *HTTPProbe
+
+	Sources []*net.IPNet
+
+	mutex      sync.RWMutex
+	Status     int
+	Headers    http.Header
+	Body       []byte
+	ETag       string
+	Fetched    time.Time
+	refreshing bool
+}
+
+// newProbeCache
+// prepares the response of the probe. the content (Body, File or Url) is
+// read once here instead of on every request.
+func newProbeCache(Probe *HTTPProbe) (*probeCache, error) {
+	var Cache = &probeCache{
+		Probe:   Probe,
+		Status:  Probe.Status,
+		Headers: make(http.Header),
+		Body:    []byte(Probe.Body),
+	}
+
+	if len(Probe.Uris) == 0 {
+		return nil, errors.New("probe has no uris")
+	}
+
+	if Cache.Status == 0 {
+		Cache.Status = http.StatusOK
+	}
+
+	for _, Source := range Probe.Sources {
+		if !strings.Contains(Source, "/") {
+			if strings.Contains(Source, ":") {
+				Source += "/128"
+			} else {
+				Source += "/32"
+			}
+		}
+
+		_, Network, err := net.ParseCIDR(Source)
+		if err != nil {
+			return nil, fmt.Errorf("invalid probe source %v: %v", Source, err)
+		}
+
+		Cache.Sources = append(Cache.Sources, Network)
+	}
+
+	for _, Header := range Probe.Headers {
+		var Name, Value, ok = strings.Cut(Header, ":")
+
+		if !ok {
+			return nil, fmt.Errorf("invalid probe header %v", Header)
+		}
+
+		Cache.Headers.Add(strings.TrimSpace(Name), strings.TrimSpace(Value))
+	}
+
+	if len(Probe.File) > 0 {
+		Body, err := os.ReadFile(Probe.File)
+		if err != nil {
+			return nil, err
+		}
+
+		Cache.Body = Body
+	}
+
+	if len(Probe.Url) > 0 {
+		/* serve Body/File until the page could be fetched */
+		if err := Cache.fetch(); err != nil {
+			logger.Warn("Failed to fetch the probe page " + Probe.Url + ": " + err.Error())
+		}
+	}
+
+	Cache.ETag = probeETag(Cache.Body)
+
+	return Cache, nil
+}
+
+func probeETag(Body []byte) string {
+	var Hash = sha256.Sum256(Body)
+
+	return `"` + hex.EncodeToString(Hash[:8]) + `"`
+}
+
+// fetch
+// fetches the page at the Url of the probe.
+func (p *probeCache) fetch() error {
+	var Client = http.Client{Timeout: 10 * time.Second}
+
+	Response, err := Client.Get(p.Probe.Url)
+	if err != nil {
+		return err
+	}
+	defer Response.Body.Close()
+
+	Body, err := io.ReadAll(io.LimitReader(Response.Body, PROBE_MAX_BODY))
+	if err != nil {
+		return err
+	}
+
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+
+	if p.Probe.Status == 0 {
+		p.Status = Response.StatusCode
+	}
+
+	/* the configured headers take precedence */
+	if ContentType := Response.Header.Get("Content-Type"); len(ContentType) > 0 && len(p.Headers.Get("Content-Type")) == 0 {
+		/* probes might still be reading the current headers */
+		p.Headers = p.Headers.Clone()
+		p.Headers.Set("Content-Type", ContentType)
+	}
+
+	p.Body = Body
+	p.ETag = probeETag(Body)
+	p.Fetched = time.Now()
+
+	return nil
+}
+
+// refresh
+// fetches the page at the Url of the probe again once it expired. the
+// probes keep getting the cached page meanwhile.
+func (p *probeCache) refresh() {
+	var CacheTime = time.Duration(p.Probe.CacheTime) * time.Second
+
+	if len(p.Probe.Url) == 0 {
+		return
+	}
+
+	if CacheTime <= 0 {
+		CacheTime = PROBE_CACHE_TIME * time.Second
+	}
+
+	p.mutex.Lock()
+	if p.refreshing || time.Since(p.Fetched) < CacheTime {
+		p.mutex.Unlock()
+		return
+	}
+	p.refreshing = true
+	p.mutex.Unlock()
+
+	go func() {
+		if err := p.fetch(); err != nil {
+			logger.Debug("Failed to refresh the probe page " + p.Probe.Url + ": " + err.Error())
+		}
+
+		p.mutex.Lock()
+		p.refreshing = false
+		/* don't retry on every probe if the page is gone */
+		if p.Fetched.IsZero() || time.Since(p.Fetched) >= CacheTime {
+			p.Fetched = time.Now()
+		}
+		p.mutex.Unlock()
+	}()
+}
+
+// match
+// tells if the request is a health probe.
+func (p *probeCache) match(Request *http.Request) bool {
+	var Found bool
+
+	if Request.Method != http.MethodGet && Request.Method != http.MethodHead {
+		return false
+	}
+
+	for _, Uri := range p.Probe.Uris {
+		if Request.URL.Path == Uri {
+			Found = true
+			break
+		}
+	}
+
+	if !Found {
+		return false
+	}
+
+	if len(p.Probe.UserAgents) > 0 {
+		Found = false
+		for _, UserAgent := range p.Probe.UserAgents {
+			if strings.Contains(Request.UserAgent(), UserAgent) {
+				Found = true
+				break
+			}
+		}
+
+		if !Found {
+			return false
+		}
+	}
+
+	if len(p.Sources) > 0 {
+		/* the load balancer itself connects to us, so forwarded headers don't matter */
+		Host, _, err := net.SplitHostPort(Request.RemoteAddr)
+		if err != nil {
+			return false
+		}
+
+		var Address = net.ParseIP(Host)
+		if Address == nil {
+			return false
+		}
+
+		for _, Source := range p.Sources {
+			if Source.Contains(Address) {
+				return true
+			}
+		}
+
+		return false
+	}
+
+	return true
+}
+
+// healthProbe
+// answers the health probes of load balancers and uptime monitors with
+// the cached benign response. they never reach the agent handling and
+// aren't logged.
+func (h *HTTP) healthProbe(ctx *gin.Context) {
+	if h.probe == nil || !h.probe.match(ctx.Request) {
+		ctx.Next()
+		return
+	}
+
+	h.probe.refresh()
+
+	h.probe.mutex.RLock()
+	var (
+		Status  = h.probe.Status
+		Headers = h.probe.Headers
+		Body    = h.probe.Body
+		ETag    = h.probe.ETag
+	)
+	h.probe.mutex.RUnlock()
+
+	for Name, Values := range Headers {
+		for _, Value := range Values {
+			ctx.Writer.Header().Add(Name, Value)
+		}
+	}
+
+	ctx.Writer.Header().Set("ETag", ETag)
+
+	if Status == http.StatusOK && ctx.Request.Header.Get("If-None-Match") == ETag {
+		ctx.AbortWithStatus(http.StatusNotModified)
+		return
+	}
+
+	ctx.Status(Status)
+
+	if ctx.Request.Method != http.MethodHead {
+		ctx.Writer.Write(Body)
+	}
+
+	ctx.Abort()
+}
@@ -0,0 +1,188 @@
+package handlers
+
+import (
+	"bytes"
+	"encoding/binary"
+	"encoding/json"
+	"io"
+	"net/http"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sync"
+	"time"
+
+	"Havoc/pkg/agent"
+	"Havoc/pkg/logger"
+	"Havoc/pkg/logr"
+
+	"github.com/gin-gonic/gin"
+)
+
+// file in the folder of the listener the transactions are recorded in
+const RECORD_FILE = "transactions.jsonl"
+
+// headers whose values are dropped from the recording even if the config
+// doesn't list them. they carry credentials or the address of the agent
+var recordRedact = []string{"Authorization", "Proxy-Authorization", "Cookie", "Set-Cookie", "X-Forwarded-For", "X-Real-Ip", "Forwarded"}
+
+// Transaction
+// an anonymized request of an agent and the answer of the listener. It
+// keeps the shape of the request (what the profile of the agent decides)
+// and the command of the demon but neither the agent id nor the payload.
+type Transaction struct {
+	// milliseconds since the first recorded transaction
+	Offset int64
+	// agents are numbered in the order the recording saw them first
+	Agent int
+
+	Method  string
+	Uri     string
+	Host    string
+	Headers http.Header
+
+	Command uint32
+	Size    int
+
+	Status       int
+	ResponseSize int
+}
+
+// recorder
+// records the transactions of the agents talking to a listener.
+type recorder struct {
+	mutex  sync.Mutex
+	Path   string
+	File   *os.File
+	Start  time.Time
+	Agents map[uint32]int
+	Redact map[string]bool
+}
+
+// newRecorder
+// opens the recording of the listener Name.
+func newRecorder(Name string, Config *HTTPRecord) (*recorder, error) {
+	var (
+		reg      = regexp.MustCompile("[^a-zA-Z0-9]+")
+		Path     = filepath.Join(logr.LogrInstance.ListenerPath, reg.ReplaceAllString(Name, ""), "record")
+		Recorder = &recorder{
+			Agents: make(map[uint32]int),
+			Redact: make(map[string]bool),
+		}
+		err error
+	)
+
+	for _, Header := range append(recordRedact, Config.Redact...) {
+		Recorder.Redact[http.CanonicalHeaderKey(Header)] = true
+	}
+
+	if err = os.MkdirAll(Path, 0700); err != nil {
+		return nil, err
+	}
+
+	Recorder.Path = filepath.Join(Path, RECORD_FILE)
+
+	if Recorder.File, err = os.OpenFile(Recorder.Path, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0600); err != nil {
+		return nil, err
+	}
+
+	return Recorder, nil
+}
+
+// record
+// appends the transaction if the request is one of a demon.
+func (r *recorder) record(Request *http.Request, Body []byte, Status, ResponseSize int) {
+	var Transaction = Transaction{
+		Method:       Request.Method,
+		Uri:          Request.RequestURI,
+		Host:         Request.Host,
+		Headers:      make(http.Header),
+		Size:         len(Body),
+		Status:       Status,
+		ResponseSize: max(ResponseSize, 0),
+	}
+
+	/* header of the demon: size, magic value, agent id, command and request id */
+	if len(Body) < 20 || binary.BigEndian.Uint32(Body[4:]) != agent.DEMON_MAGIC_VALUE {
+		return
+	}
+
+	Transaction.Command = binary.BigEndian.Uint32(Body[12:])
+
+	for Name, Values := range Request.Header {
+		/* the replay sets its own */
+		if http.CanonicalHeaderKey(Name) == "Content-Length" {
+			continue
+		}
+
+		if r.Redact[http.CanonicalHeaderKey(Name)] {
+			Values = []string{"[redacted]"}
+		}
+
+		Transaction.Headers[Name] = Values
+	}
+
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	if r.File == nil {
+		return
+	}
+
+	if r.Start.IsZero() {
+		r.Start = time.Now()
+	}
+
+	var AgentID = binary.BigEndian.Uint32(Body[8:])
+
+	if _, ok := r.Agents[AgentID]; !ok {
+		r.Agents[AgentID] = len(r.Agents) + 1
+	}
+
+	Transaction.Agent = r.Agents[AgentID]
+	Transaction.Offset = time.Since(r.Start).Milliseconds()
+
+	Line, err := json.Marshal(Transaction)
+	if err != nil {
+		return
+	}
+
+	if _, err = r.File.Write(append(Line, '\n')); err != nil {
+		logger.Debug("Failed to write recording " + r.Path + ": " + err.Error())
+	}
+}
+
+func (r *recorder) close() {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	if r.File != nil {
+		r.File.Close()
+		r.File = nil
+	}
+}
+
+// recording
+// records the transactions of the agents when the recording of the
+// listener is enabled.
+func (h *HTTP) recording(ctx *gin.Context) {
+	var (
+		Body []byte
+		err  error
+	)
+
+	if h.recorder == nil {
+		ctx.Next()
+		return
+	}
+
+	if Body, err = io.ReadAll(ctx.Request.Body); err != nil {
+		logger.Debug("Error while reading request: " + err.Error())
+	}
+
+	ctx.Request.Body = io.NopCloser(bytes.NewReader(Body))
+
+	ctx.Next()
+
+	h.recorder.record(ctx.Request, Body, ctx.Writer.Status(), ctx.Writer.Size())
+}
@@ -0,0 +1,304 @@
+package handlers
+
+import (
+	"bytes"
+	"crypto/tls"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"strings"
+	"sync"
+	"time"
+
+	"Havoc/pkg/logger"
+)
+
+const (
+	// server name of the listener getting the connections no other one claims
+	SNI_DEFAULT = "*"
+	// time a client gets to send its hello
+	SNI_HELLO_TIMEOUT = 10 * time.Second
+)
+
+// errPeeked aborts the handshake once the hello got read
+var errPeeked = errors.New("client hello peeked")
+
+// sniPorts
+// the ports https listeners share, by address.
+var sniPorts = struct {
+	sync.Mutex
+	Ports map[string]*sniPort
+}{Ports: make(map[string]*sniPort)}
+
+// sniPort
+// a port shared by https listeners. The connections get routed to the
+// listener whose ServerNames match the server name of the client hello,
+// every listener terminates tls with its own certificate.
+type sniPort struct {
+	Address  string
+	listener net.Listener
+
+	mutex     sync.RWMutex
+	listeners []*sniListener
+}
+
+// sniListener
+// the connections of the shared port routed to a listener.
+type sniListener struct {
+	port  *sniPort
+	Name  string
+	Names []string
+
+	conns chan net.Conn
+	done  chan struct{}
+	once  sync.Once
+}
+
+// SharesPort
+// tells if the listeners can serve on the same port: both are https and
+// route by server name.
+func SharesPort(First, Second HTTPConfig) bool {
+	return First.Secure && Second.Secure && len(First.ServerNames) > 0 && len(Second.ServerNames) > 0
+}
+
+// sniListen
+// routes the connections of the server names of the listener to it,
+// binding the port if it is the first listener on it.
+func sniListen(Address string, Config HTTPConfig) (*sniListener, error) {
+	var Listener = &sniListener{
+		Name:  Config.Name,
+		conns: make(chan net.Conn),
+		done:  make(chan struct{}),
+	}
+
+	for _, Name := range Config.ServerNames {
+		if Name = strings.ToLower(strings.TrimSuffix(strings.TrimSpace(Name), ".")); len(Name) > 0 {
+			Listener.Names = append(Listener.Names, Name)
+		}
+	}
+
+	sniPorts.Lock()
+	defer sniPorts.Unlock()
+
+	var Port, ok = sniPorts.Ports[Address]
+
+	if ok {
+		Port.mutex.Lock()
+		defer Port.mutex.Unlock()
+
+		for _, Other := range Port.listeners {
+			for _, Name := range Listener.Names {
+				for _, Taken := range Other.Names {
+					if Name == Taken {
+						return nil, fmt.Errorf("server name %v of port %v is routed to listener %v", Name, Address, Other.Name)
+					}
+				}
+			}
+		}
+
+		Listener.port = Port
+		Port.listeners = append(Port.listeners, Listener)
+
+		return Listener, nil
+	}
+
+	Bound, err := net.Listen("tcp", Address)
+	if err != nil {
+		return nil, err
+	}
+
+	Port = &sniPort{Address: Address, listener: Bound}
+	Listener.port = Port
+	Port.listeners = []*sniListener{Listener}
+	sniPorts.Ports[Address] = Port
+
+	go Port.accept()
+
+	return Listener, nil
+}
+
+// accept
+// routes the connections of the port till the last listener closed it.
+func (p *sniPort) accept() {
+	for {
+		Conn, err := p.listener.Accept()
+		if err != nil {
+			if !errors.Is(err, net.ErrClosed) {
+				logger.Error(fmt.Sprintf("Failed to accept a connection of the shared port %v: %v", p.Address, err))
+			}
+			return
+		}
+
+		go p.route(Conn)
+	}
+}
+
+// route
+// hands the connection to the listener of the server name it asks for.
+func (p *sniPort) route(Conn net.Conn) {
+	defer func() {
+		if Panic := recover(); Panic != nil {
+			logger.Error(fmt.Sprintf("Routing a connection of the shared port %v panicked: %v", p.Address, Panic))
+			Conn.Close()
+		}
+	}()
+
+	Conn.SetReadDeadline(time.Now().Add(SNI_HELLO_TIMEOUT))
+
+	Name, Peeked, err := sniPeek(Conn)
+	if err != nil {
+		Conn.Close()
+		return
+	}
+
+	Conn.SetReadDeadline(time.Time{})
+
+	var Listener = p.match(Name)
+	if Listener == nil {
+		logger.Debug(fmt.Sprintf("No listener of the shared port %v serves %v", p.Address, Name))
+		Conn.Close()
+		return
+	}
+
+	select {
+	case Listener.conns <- Peeked:
+	case <-Listener.done:
+		Conn.Close()
+	}
+}
+
+// match
+// returns the listener of the server name: the one naming it, the one with
+// a wildcard for it, the default one.
+func (p *sniPort) match(Name string) *sniListener {
+	var (
+		Wildcard *sniListener
+		Default  *sniListener
+	)
+
+	Name = strings.ToLower(Name)
+
+	p.mutex.RLock()
+	defer p.mutex.RUnlock()
+
+	for _, Listener := range p.listeners {
+		for _, Pattern := range Listener.Names {
+			switch {
+
+			case Pattern == Name:
+				return Listener
+
+			case Pattern == SNI_DEFAULT:
+				Default = Listener
+
+			case strings.HasPrefix(Pattern, "*.") && strings.Contains(Name, ".") && Name[strings.Index(Name, ".")+1:] == Pattern[2:]:
+				Wildcard = Listener
+
+			}
+		}
+	}
+
+	if Wildcard != nil {
+		return Wildcard
+	}
+
+	return Default
+}
+
+func (l *sniListener) Accept() (net.Conn, error) {
+	select {
+	case Conn := <-l.conns:
+		return Conn, nil
+
+	case <-l.done:
+		return nil, net.ErrClosed
+	}
+}
+
+// Close
+// stops routing to the listener, and closes the port once no listener is
+// left on it.
+func (l *sniListener) Close() error {
+	l.once.Do(func() {
+		close(l.done)
+
+		sniPorts.Lock()
+		defer sniPorts.Unlock()
+
+		l.port.mutex.Lock()
+		for i, Listener := range l.port.listeners {
+			if Listener == l {
+				l.port.listeners = append(l.port.listeners[:i], l.port.listeners[i+1:]...)
+				break
+			}
+		}
+		var Empty = len(l.port.listeners) == 0
+		l.port.mutex.Unlock()
+
+		if Empty {
+			delete(sniPorts.Ports, l.port.Address)
+			l.port.listener.Close()
+		}
+	})
+
+	return nil
+}
+
+func (l *sniListener) Addr() net.Addr {
+	return l.port.listener.Addr()
+}
+
+// sniPeek
+// reads the server name of the client hello. the returned connection
+// replays what got read.
+func sniPeek(Conn net.Conn) (string, net.Conn, error) {
+	var (
+		Hello  bytes.Buffer
+		Name   string
+		Peeked bool
+	)
+
+	var err = tls.Server(&helloConn{Conn: Conn, Reader: io.TeeReader(Conn, &Hello)}, &tls.Config{
+		GetConfigForClient: func(Info *tls.ClientHelloInfo) (*tls.Config, error) {
+			Name, Peeked = Info.ServerName, true
+			return nil, errPeeked
+		},
+	}).Handshake()
+
+	if !Peeked {
+		return "", nil, err
+	}
+
+	return Name, &peekedConn{Conn: Conn, Reader: io.MultiReader(&Hello, Conn)}, nil
+}
+
+// helloConn
+// reads the client hello without answering it.
+type helloConn struct {
+	net.Conn
+	Reader io.Reader
+}
+
+func (c *helloConn) Read(Buffer []byte) (int, error) {
+	return c.Reader.Read(Buffer)
+}
+
+func (c *helloConn) Write([]byte) (int, error) {
+	return 0, io.ErrClosedPipe
+}
+
+func (c *helloConn) Close() error {
+	return nil
+}
+
+// peekedConn
+// a connection whose first bytes got read already.
+type peekedConn struct {
+	net.Conn
+	Reader io.Reader
+}
+
+func (c *peekedConn) Read(Buffer []byte) (int, error) {
+	return c.Reader.Read(Buffer)
+}
@@ -0,0 +1,175 @@
+package handlers
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"sync"
+	"time"
+
+	"Havoc/pkg/common/certs"
+	"Havoc/pkg/logger"
+)
+
+const (
+	// the staple gets refreshed halfway through the validity of the ocsp
+	// response, at the latest every interval
+	STAPLE_REFRESH = 12 * time.Hour
+	// time till the next try after the ocsp server failed
+	STAPLE_RETRY = 10 * time.Minute
+)
+
+// stapler
+// the imported certificate of a https listener served with its complete
+// chain and the ocsp response of its issuer stapled.
+type stapler struct {
+	Listener string
+	Leaf     *x509.Certificate
+	Issuer   *x509.Certificate
+
+	mutex       sync.RWMutex
+	certificate *tls.Certificate
+	expires     time.Time
+
+	done chan struct{}
+	once sync.Once
+}
+
+// newStapler
+// loads the certificate (path or PEM) and completes its chain.
+func newStapler(Listener, Cert, Key string) (*stapler, error) {
+	KeyPair, err := certs.KeyPair(Cert, Key)
+	if err != nil {
+		return nil, err
+	}
+
+	var Chain = make([]*x509.Certificate, len(KeyPair.Certificate))
+
+	for i := range KeyPair.Certificate {
+		if Chain[i], err = x509.ParseCertificate(KeyPair.Certificate[i]); err != nil {
+			return nil, err
+		}
+	}
+
+	var Stapler = &stapler{
+		Listener: Listener,
+		Leaf:     Chain[0],
+		done:     make(chan struct{}),
+	}
+
+	/* an incomplete chain gets flagged by strict clients and inspecting proxies */
+	if Complete, err := certs.Complete(Chain); err != nil {
+		logger.Warn(fmt.Sprintf("Couldn't complete the certificate chain of listener %v: %v", Listener, err))
+	} else if len(Complete) > len(Chain) {
+		logger.Info(fmt.Sprintf("Completed the certificate chain of listener %v with %v intermediates", Listener, len(Complete)-len(Chain)))
+
+		for _, Intermediate := range Complete[len(Chain):] {
+			KeyPair.Certificate = append(KeyPair.Certificate, Intermediate.Raw)
+		}
+
+		Chain = Complete
+	}
+
+	KeyPair.Leaf = Stapler.Leaf
+
+	if len(Chain) > 1 && len(Stapler.Leaf.OCSPServer) > 0 {
+		Stapler.Issuer = Chain[1]
+	}
+
+	Stapler.certificate = &KeyPair
+
+	return Stapler, nil
+}
+
+// GetCertificate
+// the certificate with the current staple for the handshakes.
+func (s *stapler) GetCertificate(*tls.ClientHelloInfo) (*tls.Certificate, error) {
+	s.mutex.RLock()
+	defer s.mutex.RUnlock()
+
+	return s.certificate, nil
+}
+
+// run
+// keeps the staple fresh till the listener stops. Certificates without an
+// issuer in the chain or an ocsp server (eg: self signed) aren't stapled.
+func (s *stapler) run() {
+	if s.Issuer == nil {
+		return
+	}
+
+	for {
+		var Next = s.staple()
+
+		select {
+		case <-s.done:
+			return
+
+		case <-time.After(time.Until(Next)):
+		}
+	}
+}
+
+// staple
+// fetches a new ocsp response and returns when to refresh it.
+func (s *stapler) staple() time.Time {
+	var Now = time.Now()
+
+	Raw, Response, err := certs.Staple(s.Leaf, s.Issuer)
+	if err != nil {
+		logger.Warn(fmt.Sprintf("Couldn't staple the ocsp response for listener %v: %v", s.Listener, err))
+
+		/* never keep stapling a good response of a revoked certificate */
+		s.mutex.Lock()
+		if Response != nil || Now.After(s.expires) {
+			s.update(nil, time.Time{})
+		}
+		s.mutex.Unlock()
+
+		return Now.Add(STAPLE_RETRY)
+	}
+
+	var (
+		Next    = Now.Add(STAPLE_REFRESH)
+		Expires = Response.NextUpdate
+	)
+
+	if Expires.IsZero() {
+		Expires = Next
+	}
+
+	if !Response.NextUpdate.IsZero() {
+		if Half := Response.ThisUpdate.Add(Response.NextUpdate.Sub(Response.ThisUpdate) / 2); Half.Before(Next) {
+			Next = Half
+		}
+	}
+
+	if Next.Before(Now.Add(time.Minute)) {
+		Next = Now.Add(time.Minute)
+	}
+
+	s.mutex.Lock()
+	s.update(Raw, Expires)
+	s.mutex.Unlock()
+
+	logger.Debug(fmt.Sprintf("Stapled the ocsp response for listener %v till %v", s.Listener, Expires))
+
+	return Next
+}
+
+// update
+// swaps the certificate for one with the staple. the caller holds the lock.
+func (s *stapler) update(Staple []byte, Expires time.Time) {
+	var Certificate = *s.certificate
+
+	Certificate.OCSPStaple = Staple
+
+	s.certificate = &Certificate
+	s.expires = Expires
+}
+
+func (s *stapler) close() {
+	s.once.Do(func() {
+		close(s.done)
+	})
+}
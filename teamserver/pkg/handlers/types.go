@@ -4,6 +4,7 @@ import (
 	"net/http"
 
 	"Havoc/pkg/agent"
+	"Havoc/pkg/common/certs"
 
 	"github.com/gin-gonic/gin"
 )
@@ -24,30 +25,102 @@ type (
 		Headers      []string
 		Uris         []string
 		HostHeader   string
+		HostHeaders  []string
 		Secure       bool
+		Workspace    string
+
+		/* server names the listener gets the connections of when https listeners share the port (* for the rest) */
+		ServerNames []string
 
 		Cert struct {
 			Cert string
 			Key  string
 		}
 
+		/* subject used for generated certificates (imported from a bundle) */
+		CertTemplate *certs.Template
+
 		Proxy struct {
 			Enabled  bool
+			Mode     string
 			Type     string
 			Host     string
 			Port     string
 			Username string
 			Password string
+			Auth     string
+			Bypass   []string
 		}
 
 		Response struct {
 			Headers []string
 		}
+
+		/* benign response for the health probes of load balancers and uptime monitors */
+		Probe *HTTPProbe
+
+		/* raw capture of the requests and responses to debug profile mismatches */
+		Capture *HTTPCapture
+
+		/* anonymized transactions of the agents to replay against another profile or teamserver */
+		Record *HTTPRecord
+
+		/* failures injected into the transport to test the resilience of the agents (--chaos only) */
+		Chaos *HTTPChaos
+	}
+
+	HTTPProbe struct {
+		/* paths the probes request (GET or HEAD) */
+		Uris []string
+		/* only answer probes with one of these user agents (substring) or from these sources (ip or cidr) */
+		UserAgents []string
+		Sources    []string
+
+		Status  int
+		Headers []string
+		/* content of the response: Body, the content of File or the page at Url (cached for CacheTime seconds) */
+		Body      string
+		File      string
+		Url       string
+		CacheTime int
+	}
+
+	HTTPCapture struct {
+		/* "ring" (in memory, default) or "files" (rotated in the folder of the listener) */
+		Mode string
+		/* requests the ring keeps */
+		Entries int
+		/* size of a capture file in bytes and rotated files kept */
+		FileSize int
+		Files    int
+		/* bytes of each body captured */
+		MaxBody int
+		/* headers whose values are redacted and whether bodies are redacted */
+		Redact     []string
+		RedactBody bool
+	}
+
+	HTTPRecord struct {
+		/* headers whose values are dropped from the recording */
+		Redact []string
+	}
+
+	HTTPChaos struct {
+		/* percent of the requests dropped without an answer and of the responses cut short */
+		Loss     int
+		Truncate int
+		/* delay of each response plus a random part of up to Jitter */
+		Latency string
+		Jitter  string
+		/* the listener refuses connections every Flap for Down (default 30s) */
+		Flap string
+		Down string
 	}
 
 	ExternalConfig struct {
-		Name     string
-		Endpoint string
+		Name      string
+		Endpoint  string
+		Workspace string
 	}
 
 	SMBConfig struct {
@@ -55,6 +128,7 @@ type (
 		PipeName     string
 		KillDate     int64
 		WorkingHours string
+		Workspace    string
 	}
 )
 
@@ -76,6 +150,12 @@ type (
 		Teamserver agent.TeamServer
 
 		Active bool
+
+		probe    *probeCache
+		capture  *capture
+		recorder *recorder
+		chaos    *chaos
+		stapler  *stapler
 	}
 
 	SMB struct {
@@ -113,3 +193,13 @@ const (
 	AGENT_EXTERNAL  = "External"
 	AGENT_PIVOT_SMB = "Smb"
 )
+
+const (
+	PROXY_MODE_SYSTEM   = "System"
+	PROXY_MODE_EXPLICIT = "Explicit"
+	PROXY_MODE_DIRECT   = "Direct"
+
+	PROXY_AUTH_NONE  = "None"
+	PROXY_AUTH_BASIC = "Basic"
+	PROXY_AUTH_NTLM  = "NTLM"
+)
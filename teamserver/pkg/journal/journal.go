@@ -0,0 +1,318 @@
+package journal
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"encoding/gob"
+	"errors"
+	"fmt"
+	"hash/crc32"
+	"io"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+
+	"Havoc/pkg/seal"
+)
+
+/*
+ * layout of a journal:
+ *
+ *  [ Magic          ] 8 bytes
+ *  [ Records        ] ...
+ *
+ * record:
+ *  [ Length         ] 4 bytes
+ *  [ Checksum       ] 4 bytes (crc32 of flags and data)
+ *  [ Flags          ] 1 byte
+ *  [ Data           ] Length bytes (gob of the Record, sealed if FLAG_SEALED)
+ *
+ * every record gets synced to the disk before Append returns. a crash in
+ * the middle of a write leaves a torn record at the end, which Open cuts
+ * off: the change it described never happened.
+ */
+const (
+	MAGIC       = "HVJRNL01"
+	FLAG_SEALED = 0x1
+
+	// biggest record. bigger lengths are a corrupted journal
+	RECORD_MAX = 0x4000000
+)
+
+// Record
+// a state change of the teamserver. Data is what the owner of the
+// journal encoded for the type, Time when it got journaled in unix
+// nanoseconds.
+type Record struct {
+	Type    string
+	AgentID string
+	Time    int64
+	Data    []byte
+}
+
+// Journal
+// append only log of the changes the teamserver can't lose in a crash.
+type Journal struct {
+	mutex sync.Mutex
+	path  string
+	file  *os.File
+}
+
+// Open
+// opens the journal or creates it, and returns the records it has.
+// A torn record at the end gets cut off.
+func Open(Path string) (*Journal, []Record, error) {
+	var (
+		Journal = &Journal{path: Path}
+		Records []Record
+		Valid   int64
+		err     error
+	)
+
+	if Records, Valid, err = read(Path); err != nil {
+		return nil, nil, err
+	}
+
+	if Journal.file, err = os.OpenFile(Path, os.O_CREATE|os.O_RDWR, 0600); err != nil {
+		return nil, nil, err
+	}
+
+	/* new journal, or one cut off before its magic got written */
+	if Valid == 0 {
+		if err = Journal.file.Truncate(0); err == nil {
+			_, err = Journal.file.WriteAt([]byte(MAGIC), 0)
+		}
+
+		Valid = int64(len(MAGIC))
+	} else {
+		err = Journal.file.Truncate(Valid)
+	}
+
+	if err == nil {
+		err = Journal.file.Sync()
+	}
+
+	if err == nil {
+		_, err = Journal.file.Seek(Valid, io.SeekStart)
+	}
+
+	if err != nil {
+		Journal.file.Close()
+		return nil, nil, err
+	}
+
+	return Journal, Records, nil
+}
+
+// read
+// returns the records of the journal and the size of the part of the
+// file that holds them.
+func read(Path string) ([]Record, int64, error) {
+	var (
+		Records []Record
+		Magic   = make([]byte, len(MAGIC))
+		Offset  int64
+	)
+
+	File, err := os.Open(Path)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, 0, nil
+	} else if err != nil {
+		return nil, 0, err
+	}
+	defer File.Close()
+
+	var Reader = bufio.NewReader(File)
+
+	if _, err = io.ReadFull(Reader, Magic); err != nil {
+		return nil, 0, nil
+	}
+
+	if string(Magic) != MAGIC {
+		return nil, 0, errors.New(Path + " is not a journal")
+	}
+
+	Offset = int64(len(MAGIC))
+
+	for {
+		var (
+			Header = make([]byte, 9)
+			Length uint32
+			Data   []byte
+			Record Record
+		)
+
+		if _, err = io.ReadFull(Reader, Header); err != nil {
+			break
+		}
+
+		if Length = binary.LittleEndian.Uint32(Header[0:4]); Length > RECORD_MAX {
+			break
+		}
+
+		Data = make([]byte, Length)
+		if _, err = io.ReadFull(Reader, Data); err != nil {
+			break
+		}
+
+		if crc32.Update(crc32.ChecksumIEEE(Header[8:9]), crc32.IEEETable, Data) != binary.LittleEndian.Uint32(Header[4:8]) {
+			break
+		}
+
+		if Header[8]&FLAG_SEALED != 0 {
+			if Data, err = seal.OpenBytes(Data, []byte(MAGIC)); err != nil {
+				return nil, 0, fmt.Errorf("journal record at %v: %w", Offset, err)
+			}
+		}
+
+		if err = gob.NewDecoder(bytes.NewReader(Data)).Decode(&Record); err != nil {
+			return nil, 0, fmt.Errorf("journal record at %v: %w", Offset, err)
+		}
+
+		Records = append(Records, Record)
+		Offset += int64(len(Header)) + int64(Length)
+	}
+
+	return Records, Offset, nil
+}
+
+// frame
+// encodes the record the way it is stored in the journal.
+func frame(Record Record) ([]byte, error) {
+	var (
+		Data  bytes.Buffer
+		Flags byte
+		Frame []byte
+		err   error
+	)
+
+	if Record.Time == 0 {
+		Record.Time = time.Now().UnixNano()
+	}
+
+	if err = gob.NewEncoder(&Data).Encode(Record); err != nil {
+		return nil, err
+	}
+
+	var Body = Data.Bytes()
+
+	if seal.Enabled() {
+		if Body, err = seal.SealBytes(Body, []byte(MAGIC)); err != nil {
+			return nil, err
+		}
+
+		Flags |= FLAG_SEALED
+	}
+
+	if len(Body) > RECORD_MAX {
+		return nil, fmt.Errorf("journal record of %v bytes is too big", len(Body))
+	}
+
+	Frame = binary.LittleEndian.AppendUint32(make([]byte, 0, 9+len(Body)), uint32(len(Body)))
+	Frame = binary.LittleEndian.AppendUint32(Frame, crc32.Update(crc32.ChecksumIEEE([]byte{Flags}), crc32.IEEETable, Body))
+	Frame = append(Frame, Flags)
+
+	return append(Frame, Body...), nil
+}
+
+// Append
+// writes the record and syncs it to the disk.
+func (j *Journal) Append(Record Record) error {
+	Frame, err := frame(Record)
+	if err != nil {
+		return err
+	}
+
+	j.mutex.Lock()
+	defer j.mutex.Unlock()
+
+	if j.file == nil {
+		return os.ErrClosed
+	}
+
+	if _, err = j.file.Write(Frame); err != nil {
+		return err
+	}
+
+	return j.file.Sync()
+}
+
+// Rewrite
+// replaces the journal with the records. The records it had are either
+// all there or all replaced, whenever the teamserver crashes.
+func (j *Journal) Rewrite(Records []Record) error {
+	var (
+		Temp = j.path + ".tmp"
+		File *os.File
+		err  error
+	)
+
+	j.mutex.Lock()
+	defer j.mutex.Unlock()
+
+	if File, err = os.OpenFile(Temp, os.O_CREATE|os.O_TRUNC|os.O_WRONLY, 0600); err != nil {
+		return err
+	}
+
+	var Writer = bufio.NewWriter(File)
+
+	Writer.WriteString(MAGIC)
+
+	for _, Record := range Records {
+		Frame, err := frame(Record)
+		if err != nil {
+			File.Close()
+			os.Remove(Temp)
+			return err
+		}
+
+		Writer.Write(Frame)
+	}
+
+	if err = Writer.Flush(); err == nil {
+		err = File.Sync()
+	}
+
+	File.Close()
+
+	if err == nil {
+		err = os.Rename(Temp, j.path)
+	}
+
+	if err != nil {
+		os.Remove(Temp)
+		return err
+	}
+
+	/* the rename is only durable once the folder is synced */
+	if Dir, err := os.Open(filepath.Dir(j.path)); err == nil {
+		Dir.Sync()
+		Dir.Close()
+	}
+
+	if j.file != nil {
+		j.file.Close()
+	}
+
+	j.file, err = os.OpenFile(j.path, os.O_APPEND|os.O_WRONLY, 0600)
+
+	return err
+}
+
+// Close
+// closes the journal.
+func (j *Journal) Close() error {
+	j.mutex.Lock()
+	defer j.mutex.Unlock()
+
+	if j.file == nil {
+		return nil
+	}
+
+	var err = j.file.Close()
+	j.file = nil
+
+	return err
+}
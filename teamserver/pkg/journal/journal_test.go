@@ -0,0 +1,77 @@
+package journal
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestJournalTornRecord(t *testing.T) {
+	var Path = filepath.Join(t.TempDir(), "teamserver.journal")
+
+	Journal, Records, err := Open(Path)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(Records) != 0 {
+		t.Fatalf("new journal has %v records", len(Records))
+	}
+
+	for _, Type := range []string{"session.new", "task.queued", "task.delivered"} {
+		if err = Journal.Append(Record{Type: Type, AgentID: "1a2b3c4d", Data: []byte(Type)}); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	Journal.Close()
+
+	/* a crash in the middle of the next record */
+	File, err := os.OpenFile(Path, os.O_APPEND|os.O_WRONLY, 0600)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	File.Write([]byte{0x40, 0, 0, 0, 0xde, 0xad})
+	File.Close()
+
+	if Journal, Records, err = Open(Path); err != nil {
+		t.Fatal(err)
+	}
+
+	if len(Records) != 3 || Records[2].Type != "task.delivered" || string(Records[1].Data) != "task.queued" {
+		t.Fatalf("records after a torn write: %+v", Records)
+	}
+
+	if err = Journal.Append(Record{Type: "session.key"}); err != nil {
+		t.Fatal(err)
+	}
+
+	Journal.Close()
+
+	if Journal, Records, err = Open(Path); err != nil {
+		t.Fatal(err)
+	}
+
+	if len(Records) != 4 || Records[3].Type != "session.key" {
+		t.Fatalf("record appended after the torn one got lost: %+v", Records)
+	}
+
+	if err = Journal.Rewrite(Records[1:2]); err != nil {
+		t.Fatal(err)
+	}
+
+	if err = Journal.Append(Record{Type: "task.delivered"}); err != nil {
+		t.Fatal(err)
+	}
+
+	Journal.Close()
+
+	if _, Records, err = Open(Path); err != nil {
+		t.Fatal(err)
+	}
+
+	if len(Records) != 2 || Records[0].Type != "task.queued" || Records[1].Type != "task.delivered" {
+		t.Fatalf("records after the rewrite: %+v", Records)
+	}
+}
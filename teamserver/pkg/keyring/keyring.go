@@ -0,0 +1,223 @@
+package keyring
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"crypto/subtle"
+	"errors"
+	"sync"
+)
+
+// The session keys of the agents are kept wrapped (aes-256-gcm) with a
+// master key while they aren't used, so a dump of the teamserver memory
+// doesn't have them in the clear. The master key is random for every run
+// and lives in memory that is locked (not swapped out) and, on linux, left
+// out of core dumps. Callers wipe the keys they unwrapped once done.
+const (
+	MASTER_SIZE = 32
+	NONCE_SIZE  = 12
+)
+
+var (
+	// ErrUnlocked is returned by Setup if the memory of the master key couldn't be locked
+	ErrUnlocked = errors.New("memory of the master key couldn't be locked")
+
+	master   []byte
+	once     sync.Once
+	setupErr error
+)
+
+// Setup
+// creates the master key. The keys are wrapped even if it returns an
+// error, but the master key may end up in swap or a core dump.
+func Setup() error {
+	once.Do(setup)
+
+	return setupErr
+}
+
+func setup() {
+	var err error
+
+	if master, err = protect(MASTER_SIZE); err != nil {
+		master, setupErr = make([]byte, MASTER_SIZE), errors.Join(ErrUnlocked, err)
+	}
+
+	if _, err = rand.Read(master); err != nil {
+		panic("keyring: no randomness for the master key: " + err.Error())
+	}
+}
+
+func aead() cipher.AEAD {
+	once.Do(setup)
+
+	/* the key schedule is on the heap for as long as the call takes */
+	Block, err := aes.NewCipher(master)
+	if err != nil {
+		panic("keyring: " + err.Error())
+	}
+
+	AEAD, err := cipher.NewGCM(Block)
+	if err != nil {
+		panic("keyring: " + err.Error())
+	}
+
+	return AEAD
+}
+
+// Wipe
+// zeroes the buffers.
+func Wipe(Buffers ...[]byte) {
+	for _, Buffer := range Buffers {
+		for i := range Buffer {
+			Buffer[i] = 0
+		}
+	}
+}
+
+// Session
+// the aes key and iv of an agent session, wrapped with the master key.
+// The zero value has no key.
+type Session struct {
+	mutex   sync.Mutex
+	wrapped []byte
+
+	// expanded key and iv of the session, pooled once used (see Stream)
+	block cipher.Block
+	iv    []byte
+}
+
+// Set
+// wraps copies of the key and iv. The caller wipes its own copies.
+// An empty key and iv clear the session.
+func (s *Session) Set(Key, IV []byte) {
+	var (
+		Plain = make([]byte, 0, 1+len(Key)+len(IV))
+		Nonce = make([]byte, NONCE_SIZE)
+	)
+
+	if len(Key) == 0 && len(IV) == 0 {
+		s.Destroy()
+		return
+	}
+
+	if _, err := rand.Read(Nonce); err != nil {
+		panic("keyring: no randomness for the nonce: " + err.Error())
+	}
+
+	/* [key length][key][iv] */
+	Plain = append(append(append(Plain, byte(len(Key))), Key...), IV...)
+
+	var Wrapped = aead().Seal(Nonce, Nonce, Plain, nil)
+
+	Wipe(Plain)
+
+	s.mutex.Lock()
+	s.drop()
+	Wipe(s.wrapped)
+	s.wrapped = Wrapped
+	s.mutex.Unlock()
+}
+
+// Keys
+// returns unwrapped copies of the key and iv, nil if the session has
+// none. The caller wipes them once used.
+func (s *Session) Keys() ([]byte, []byte) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	return s.keys()
+}
+
+func (s *Session) keys() ([]byte, []byte) {
+	if len(s.wrapped) < NONCE_SIZE {
+		return nil, nil
+	}
+
+	Plain, err := aead().Open(nil, s.wrapped[:NONCE_SIZE], s.wrapped[NONCE_SIZE:], nil)
+	if err != nil || len(Plain) == 0 || int(Plain[0]) > len(Plain)-1 {
+		return nil, nil
+	}
+
+	var (
+		Length = int(Plain[0])
+		Key    = append([]byte(nil), Plain[1:1+Length]...)
+		IV     = append([]byte(nil), Plain[1+Length:]...)
+	)
+
+	Wipe(Plain)
+
+	return Key, IV
+}
+
+// Stream
+// returns a new aes-ctr stream of the session. The expanded key is pooled
+// with the session the first time, so busy agents don't get their key
+// unwrapped and expanded for every message. Set and Destroy drop it.
+func (s *Session) Stream() (cipher.Stream, error) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	if s.block == nil {
+		var Key, IV = s.keys()
+		if Key == nil {
+			return nil, errors.New("session has no key")
+		}
+
+		Block, err := aes.NewCipher(Key)
+		Wipe(Key)
+
+		if err != nil {
+			Wipe(IV)
+			return nil, err
+		}
+
+		/* NewCTR panics on an iv of the wrong size */
+		if len(IV) != Block.BlockSize() {
+			Wipe(IV)
+			return nil, errors.New("invalid iv size")
+		}
+
+		s.block, s.iv = Block, IV
+	}
+
+	return cipher.NewCTR(s.block, s.iv), nil
+}
+
+// drop
+// releases the pooled key. The key schedule of the aes block can't be
+// zeroed, nothing references it anymore and the garbage collector reuses it.
+func (s *Session) drop() {
+	Wipe(s.iv)
+	s.block, s.iv = nil, nil
+}
+
+// Equal
+// compares the key and iv of the session with the ones given in
+// constant time.
+func (s *Session) Equal(Key, IV []byte) bool {
+	var SessionKey, SessionIV = s.Keys()
+	defer Wipe(SessionKey, SessionIV)
+
+	return subtle.ConstantTimeCompare(SessionKey, Key) == 1 && subtle.ConstantTimeCompare(SessionIV, IV) == 1
+}
+
+// Empty
+// returns true if the session has no key.
+func (s *Session) Empty() bool {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	return len(s.wrapped) == 0
+}
+
+// Destroy
+// zeroes the wrapped key once the session is closed.
+func (s *Session) Destroy() {
+	s.mutex.Lock()
+	s.drop()
+	Wipe(s.wrapped)
+	s.wrapped = nil
+	s.mutex.Unlock()
+}
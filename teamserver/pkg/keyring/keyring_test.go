@@ -0,0 +1,119 @@
+package keyring
+
+import (
+	"bytes"
+	"crypto/aes"
+	"crypto/cipher"
+	"testing"
+)
+
+func TestSession(t *testing.T) {
+	var (
+		Session Session
+		Key     = bytes.Repeat([]byte{0x41}, 32)
+		IV      = bytes.Repeat([]byte{0x42}, 16)
+	)
+
+	if !Session.Empty() {
+		t.Fatal("zero session has a key")
+	}
+
+	Session.Set(Key, IV)
+
+	/* the key isn't kept in the clear */
+	if bytes.Contains(Session.wrapped, Key[:8]) || bytes.Contains(Session.wrapped, IV[:8]) {
+		t.Error("wrapped session contains the key")
+	}
+
+	SessionKey, SessionIV := Session.Keys()
+	if !bytes.Equal(SessionKey, Key) || !bytes.Equal(SessionIV, IV) {
+		t.Fatalf("unwrapped %x %x", SessionKey, SessionIV)
+	}
+
+	Wipe(SessionKey, SessionIV)
+
+	if !Session.Equal(Key, IV) || Session.Equal(Key, Key[:16]) {
+		t.Error("session compares wrong")
+	}
+
+	var Wrapped = Session.wrapped
+
+	Session.Destroy()
+
+	if !Session.Empty() || !bytes.Equal(Wrapped, make([]byte, len(Wrapped))) {
+		t.Error("destroyed session isn't wiped")
+	}
+
+	if SessionKey, SessionIV = Session.Keys(); SessionKey != nil || SessionIV != nil {
+		t.Error("destroyed session still has keys")
+	}
+}
+
+func TestSessionStream(t *testing.T) {
+	var (
+		Session Session
+		Key     = bytes.Repeat([]byte{0x41}, 32)
+		IV      = bytes.Repeat([]byte{0x42}, 16)
+		Plain   = []byte("checkin")
+	)
+
+	if _, err := Session.Stream(); err == nil {
+		t.Fatal("stream of a session without key")
+	}
+
+	Session.Set(Key, IV)
+
+	/* every stream starts at the iv */
+	for i := 0; i < 2; i++ {
+		Stream, err := Session.Stream()
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		var (
+			Block, _ = aes.NewCipher(Key)
+			Expected = make([]byte, len(Plain))
+			Cipher   = make([]byte, len(Plain))
+		)
+
+		cipher.NewCTR(Block, IV).XORKeyStream(Expected, Plain)
+		Stream.XORKeyStream(Cipher, Plain)
+
+		if !bytes.Equal(Cipher, Expected) {
+			t.Fatalf("stream %v encrypted to %x", i, Cipher)
+		}
+	}
+
+	/* a new key drops the pooled one */
+	Session.Set(bytes.Repeat([]byte{0x43}, 32), IV)
+
+	Stream, err := Session.Stream()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var (
+		Block, _ = aes.NewCipher(Key)
+		Previous = make([]byte, len(Plain))
+		Cipher   = make([]byte, len(Plain))
+	)
+
+	cipher.NewCTR(Block, IV).XORKeyStream(Previous, Plain)
+	Stream.XORKeyStream(Cipher, Plain)
+
+	if bytes.Equal(Cipher, Previous) {
+		t.Error("stream of the previous key after Set")
+	}
+
+	var Pooled = Session.iv
+
+	Session.Destroy()
+
+	if Session.block != nil || !bytes.Equal(Pooled, make([]byte, len(Pooled))) {
+		t.Error("destroyed session kept its pooled key")
+	}
+
+	if _, err := Session.Stream(); err == nil {
+		t.Error("stream of a destroyed session")
+	}
+}
@@ -0,0 +1,28 @@
+//go:build linux
+
+package keyring
+
+import "golang.org/x/sys/unix"
+
+// protect
+// maps memory of its own for the master key, locks it so it isn't
+// swapped out and leaves it out of core dumps.
+func protect(Size int) ([]byte, error) {
+	Memory, err := unix.Mmap(-1, 0, Size, unix.PROT_READ|unix.PROT_WRITE, unix.MAP_PRIVATE|unix.MAP_ANON)
+	if err != nil {
+		return nil, err
+	}
+
+	if err = unix.Mlock(Memory); err != nil {
+		unix.Munmap(Memory)
+		return nil, err
+	}
+
+	if err = unix.Madvise(Memory, unix.MADV_DONTDUMP); err != nil {
+		unix.Munlock(Memory)
+		unix.Munmap(Memory)
+		return nil, err
+	}
+
+	return Memory, nil
+}
@@ -0,0 +1,11 @@
+//go:build !linux
+
+package keyring
+
+import "errors"
+
+// protect
+// locked memory is only supported on linux.
+func protect(Size int) ([]byte, error) {
+	return nil, errors.New("locked memory isn't supported on this platform")
+}
@@ -0,0 +1,463 @@
+package keystore
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"strconv"
+	"strings"
+
+	"golang.org/x/crypto/chacha20poly1305"
+	"golang.org/x/crypto/curve25519"
+	"golang.org/x/crypto/hkdf"
+	"golang.org/x/crypto/scrypt"
+)
+
+// age (https://age-encryption.org/v1) files encrypted to X25519
+// identities or with a passphrase (scrypt). Armored files are supported.
+const (
+	AGE_INTRO        = "age-encryption.org/v1"
+	AGE_ARMOR_BEGIN  = "-----BEGIN AGE ENCRYPTED FILE-----"
+	AGE_ARMOR_END    = "-----END AGE ENCRYPTED FILE-----"
+	AGE_IDENTITY_HRP = "age-secret-key-"
+	AGE_CHUNK_SIZE   = 64 * 1024
+	AGE_COLUMNS      = 64
+
+	// upper limit of the scrypt work factor (log2) of passphrase files
+	AGE_SCRYPT_MAX = 22
+)
+
+type ageStanza struct {
+	Type string
+	Args []string
+	Body []byte
+}
+
+func (k *Keystore) ageDecrypt(Data []byte) ([]byte, error) {
+	var Identities [][]byte
+
+	for _, Identity := range k.options.Age.Identities {
+		Keys, err := ageIdentities(Identity)
+		if err != nil {
+			return nil, err
+		}
+
+		Identities = append(Identities, Keys...)
+	}
+
+	return AgeDecrypt(Data, Identities, k.options.Age.Passphrase)
+}
+
+// ageIdentities
+// parses an identity (AGE-SECRET-KEY-1...) or a file of identities
+// (as age-keygen writes them).
+func ageIdentities(Identity string) ([][]byte, error) {
+	var (
+		Lines      = []string{Identity}
+		Identities [][]byte
+	)
+
+	if !strings.HasPrefix(strings.ToLower(Identity), AGE_IDENTITY_HRP) {
+		Data, err := os.ReadFile(Identity)
+		if err != nil {
+			return nil, err
+		}
+
+		Lines = strings.Split(string(Data), "\n")
+	}
+
+	for _, Line := range Lines {
+		if Line = strings.TrimSpace(Line); len(Line) == 0 || strings.HasPrefix(Line, "#") {
+			continue
+		}
+
+		HRP, Key, err := bech32Decode(Line)
+		if err != nil || HRP != AGE_IDENTITY_HRP || len(Key) != curve25519.ScalarSize {
+			return nil, errors.New("invalid age identity")
+		}
+
+		Identities = append(Identities, Key)
+	}
+
+	if len(Identities) == 0 {
+		return nil, errors.New("no age identity found")
+	}
+
+	return Identities, nil
+}
+
+// AgeDecrypt
+// decrypts an age file with one of the X25519 identities or the passphrase.
+func AgeDecrypt(Data []byte, Identities [][]byte, Passphrase string) ([]byte, error) {
+	var err error
+
+	if bytes.HasPrefix(bytes.TrimSpace(Data), []byte(AGE_ARMOR_BEGIN)) {
+		if Data, err = ageDearmor(Data); err != nil {
+			return nil, err
+		}
+	}
+
+	Stanzas, Header, Mac, Payload, err := ageHeader(Data)
+	if err != nil {
+		return nil, err
+	}
+
+	FileKey, err := ageFileKey(Stanzas, Identities, Passphrase)
+	if err != nil {
+		return nil, err
+	}
+
+	/* the mac covers the header up to and including "---" */
+	if !hmac.Equal(ageHmac(ageKey(FileKey, nil, "header"), Header), Mac) {
+		return nil, errors.New("age header mac mismatch")
+	}
+
+	return agePayload(FileKey, Payload)
+}
+
+func ageDearmor(Data []byte) ([]byte, error) {
+	var (
+		Text   = strings.TrimSpace(strings.ReplaceAll(string(Data), "\r\n", "\n"))
+		Lines  = strings.Split(Text, "\n")
+		Base64 strings.Builder
+	)
+
+	if len(Lines) < 2 || Lines[0] != AGE_ARMOR_BEGIN || Lines[len(Lines)-1] != AGE_ARMOR_END {
+		return nil, errors.New("invalid age armor")
+	}
+
+	for _, Line := range Lines[1 : len(Lines)-1] {
+		Base64.WriteString(strings.TrimSpace(Line))
+	}
+
+	return base64.StdEncoding.DecodeString(Base64.String())
+}
+
+func ageHeader(Data []byte) (Stanzas []ageStanza, Header []byte, Mac []byte, Payload []byte, err error) {
+	var (
+		Reader = bufio.NewReader(bytes.NewReader(Data))
+		Read   = 0
+		Line   string
+	)
+
+	line := func() (string, error) {
+		Line, err := Reader.ReadString('\n')
+		if err != nil {
+			return "", errors.New("age header is truncated")
+		}
+
+		Read += len(Line)
+
+		return strings.TrimSuffix(Line, "\n"), nil
+	}
+
+	if Line, err = line(); err != nil {
+		return
+	}
+
+	if Line != AGE_INTRO {
+		err = errors.New("not an age file")
+		return
+	}
+
+	for {
+		var Start = Read
+
+		if Line, err = line(); err != nil {
+			return
+		}
+
+		if strings.HasPrefix(Line, "--- ") {
+			Header = Data[:Start+3]
+
+			if Mac, err = base64.RawStdEncoding.Strict().DecodeString(Line[4:]); err != nil {
+				err = errors.New("invalid age header mac")
+				return
+			}
+
+			Payload = Data[Read:]
+			return
+		}
+
+		if !strings.HasPrefix(Line, "-> ") {
+			err = errors.New("invalid age header line")
+			return
+		}
+
+		var (
+			Fields  = strings.Split(Line[3:], " ")
+			Stanza  = ageStanza{Type: Fields[0], Args: Fields[1:]}
+			Encoded strings.Builder
+		)
+
+		/* the body ends with a line shorter than 64 columns */
+		for {
+			if Line, err = line(); err != nil {
+				return
+			}
+
+			Encoded.WriteString(Line)
+
+			if len(Line) < AGE_COLUMNS {
+				break
+			}
+		}
+
+		if Stanza.Body, err = base64.RawStdEncoding.Strict().DecodeString(Encoded.String()); err != nil {
+			err = errors.New("invalid age stanza body")
+			return
+		}
+
+		Stanzas = append(Stanzas, Stanza)
+	}
+}
+
+func ageFileKey(Stanzas []ageStanza, Identities [][]byte, Passphrase string) ([]byte, error) {
+	for _, Stanza := range Stanzas {
+		switch Stanza.Type {
+
+		case "X25519":
+			if len(Stanza.Args) != 1 {
+				return nil, errors.New("invalid age X25519 stanza")
+			}
+
+			Share, err := base64.RawStdEncoding.Strict().DecodeString(Stanza.Args[0])
+			if err != nil || len(Share) != curve25519.PointSize {
+				return nil, errors.New("invalid age X25519 share")
+			}
+
+			for _, Identity := range Identities {
+				Recipient, err := curve25519.X25519(Identity, curve25519.Basepoint)
+				if err != nil {
+					continue
+				}
+
+				Shared, err := curve25519.X25519(Identity, Share)
+				if err != nil {
+					continue
+				}
+
+				if FileKey, err := ageUnwrap(ageKey(Shared, append(append([]byte{}, Share...), Recipient...), "age-encryption.org/v1/X25519"), Stanza.Body); err == nil {
+					return FileKey, nil
+				}
+			}
+
+		case "scrypt":
+			if len(Stanzas) != 1 {
+				return nil, errors.New("age scrypt stanza has to be the only one")
+			}
+
+			if len(Passphrase) == 0 || len(Stanza.Args) != 2 {
+				break
+			}
+
+			Salt, err := base64.RawStdEncoding.Strict().DecodeString(Stanza.Args[0])
+			if err != nil || len(Salt) != 16 {
+				return nil, errors.New("invalid age scrypt salt")
+			}
+
+			Work, err := strconv.Atoi(Stanza.Args[1])
+			if err != nil || Work <= 0 || Work > AGE_SCRYPT_MAX {
+				return nil, fmt.Errorf("invalid age scrypt work factor %v", Stanza.Args[1])
+			}
+
+			Key, err := scrypt.Key([]byte(Passphrase), append([]byte("age-encryption.org/v1/scrypt"), Salt...), 1<<Work, 8, 1, chacha20poly1305.KeySize)
+			if err != nil {
+				return nil, err
+			}
+
+			if FileKey, err := ageUnwrap(Key, Stanza.Body); err == nil {
+				return FileKey, nil
+			}
+
+			return nil, errors.New("wrong age passphrase")
+
+		}
+	}
+
+	return nil, errors.New("no age identity or passphrase matches the file")
+}
+
+func ageUnwrap(Key, Body []byte) ([]byte, error) {
+	AEAD, err := chacha20poly1305.New(Key)
+	if err != nil {
+		return nil, err
+	}
+
+	if len(Body) != 16+AEAD.Overhead() {
+		return nil, errors.New("invalid age file key size")
+	}
+
+	return AEAD.Open(nil, make([]byte, chacha20poly1305.NonceSize), Body, nil)
+}
+
+func agePayload(FileKey, Payload []byte) ([]byte, error) {
+	if len(Payload) < 16 {
+		return nil, errors.New("age payload is truncated")
+	}
+
+	AEAD, err := chacha20poly1305.New(ageKey(FileKey, Payload[:16], "payload"))
+	if err != nil {
+		return nil, err
+	}
+
+	var (
+		Plain   []byte
+		Nonce   = make([]byte, chacha20poly1305.NonceSize)
+		Chunks  = Payload[16:]
+		Sealed  = AGE_CHUNK_SIZE + AEAD.Overhead()
+		Counter uint64
+	)
+
+	for {
+		var (
+			Chunk = Chunks
+			Last  = len(Chunks) <= Sealed
+		)
+
+		if !Last {
+			Chunk = Chunks[:Sealed]
+		}
+
+		/* 11 bytes big endian counter followed by the last chunk flag */
+		for i := 0; i < 8; i++ {
+			Nonce[10-i] = byte(Counter >> (8 * i))
+		}
+
+		Nonce[11] = 0
+		if Last {
+			Nonce[11] = 1
+		}
+
+		Data, err := AEAD.Open(nil, Nonce, Chunk, nil)
+		if err != nil {
+			return nil, errors.New("age payload is corrupted or truncated")
+		}
+
+		if len(Data) == 0 && (Counter > 0 || !Last) {
+			return nil, errors.New("age payload has an empty chunk")
+		}
+
+		Plain = append(Plain, Data...)
+
+		if Last {
+			return Plain, nil
+		}
+
+		Chunks = Chunks[Sealed:]
+		Counter++
+	}
+}
+
+func ageKey(Secret, Salt []byte, Info string) []byte {
+	var Key = make([]byte, chacha20poly1305.KeySize)
+
+	io.ReadFull(hkdf.New(sha256.New, Secret, Salt, []byte(Info)), Key)
+
+	return Key
+}
+
+func ageHmac(Key, Data []byte) []byte {
+	var Mac = hmac.New(sha256.New, Key)
+
+	Mac.Write(Data)
+
+	return Mac.Sum(nil)
+}
+
+const bech32Charset = "qpzry9x8gf2tvdw0s3jn54khce6mua7l"
+
+// bech32Decode
+// decodes a bech32 string (age lifts the length limit of bip 173).
+func bech32Decode(Value string) (string, []byte, error) {
+	if strings.ToLower(Value) != Value && strings.ToUpper(Value) != Value {
+		return "", nil, errors.New("bech32: mixed case")
+	}
+
+	Value = strings.ToLower(Value)
+
+	var Separator = strings.LastIndex(Value, "1")
+	if Separator < 1 || Separator+7 > len(Value) {
+		return "", nil, errors.New("bech32: invalid separator")
+	}
+
+	var (
+		HRP    = Value[:Separator]
+		Values []byte
+	)
+
+	for _, Char := range Value[Separator+1:] {
+		var Index = strings.IndexRune(bech32Charset, Char)
+		if Index < 0 {
+			return "", nil, errors.New("bech32: invalid character")
+		}
+
+		Values = append(Values, byte(Index))
+	}
+
+	var Expanded []byte
+
+	for _, Char := range []byte(HRP) {
+		Expanded = append(Expanded, Char>>5)
+	}
+
+	Expanded = append(Expanded, 0)
+
+	for _, Char := range []byte(HRP) {
+		Expanded = append(Expanded, Char&31)
+	}
+
+	if bech32Polymod(append(Expanded, Values...)) != 1 {
+		return "", nil, errors.New("bech32: invalid checksum")
+	}
+
+	/* 5 bit groups to bytes */
+	var (
+		Data []byte
+		Acc  uint32
+		Bits uint
+	)
+
+	for _, Group := range Values[:len(Values)-6] {
+		Acc = Acc<<5 | uint32(Group)
+		Bits += 5
+
+		if Bits >= 8 {
+			Bits -= 8
+			Data = append(Data, byte(Acc>>Bits))
+		}
+	}
+
+	if Bits >= 5 || Acc&(1<<Bits-1) != 0 {
+		return "", nil, errors.New("bech32: invalid padding")
+	}
+
+	return HRP, Data, nil
+}
+
+func bech32Polymod(Values []byte) uint32 {
+	var (
+		Generator = [5]uint32{0x3b6a57b2, 0x26508e6d, 0x1ea119fa, 0x3d4233dd, 0x2a1462b3}
+		Checksum  = uint32(1)
+	)
+
+	for _, Value := range Values {
+		var Top = Checksum >> 25
+
+		Checksum = (Checksum&0x1ffffff)<<5 ^ uint32(Value)
+
+		for i := 0; i < 5; i++ {
+			if (Top>>i)&1 == 1 {
+				Checksum ^= Generator[i]
+			}
+		}
+	}
+
+	return Checksum
+}
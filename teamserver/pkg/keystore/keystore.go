@@ -0,0 +1,212 @@
+package keystore
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"reflect"
+	"strings"
+	"sync"
+)
+
+// prefixes of the references to secrets kept outside of the profile
+const (
+	// vault://<path>#<field>. kv version 1 or 2 secret of hashicorp vault
+	PREFIX_VAULT = "vault://"
+	// awskms://<base64 ciphertext blob> or awskms://<path to the blob>. decrypted by aws kms
+	PREFIX_KMS = "awskms://"
+	// age://<path>. file encrypted with age to an identity or passphrase
+	PREFIX_AGE = "age://"
+)
+
+type VaultOptions struct {
+	// address of the vault server. default is $VAULT_ADDR
+	Address string
+	// token. default is $VAULT_TOKEN or ~/.vault-token
+	Token string
+	// approle to log in with instead of a token
+	RoleID   string
+	SecretID string
+	// enterprise namespace. default is $VAULT_NAMESPACE
+	Namespace string
+	// ca certificate of the server. default is $VAULT_CACERT
+	CACert string
+}
+
+type KMSOptions struct {
+	// default is $AWS_REGION or $AWS_DEFAULT_REGION
+	Region string
+	// credentials. default is $AWS_ACCESS_KEY_ID, $AWS_SECRET_ACCESS_KEY and $AWS_SESSION_TOKEN
+	AccessKey    string
+	SecretKey    string
+	SessionToken string
+	// endpoint of the kms api. default is https://kms.<region>.amazonaws.com
+	Endpoint string
+}
+
+type AgeOptions struct {
+	// identities (AGE-SECRET-KEY-1...) the files are encrypted to
+	Identities []string
+	// passphrase of files encrypted with a passphrase
+	Passphrase string
+}
+
+type Options struct {
+	Vault VaultOptions
+	KMS   KMSOptions
+	Age   AgeOptions
+}
+
+// Keystore
+// resolves references to secrets in vault, aws kms or age encrypted
+// files. Every secret is fetched once.
+type Keystore struct {
+	options Options
+
+	mutex sync.Mutex
+	vault map[string]map[string]any
+	token string
+}
+
+func New(Options Options) *Keystore {
+	return &Keystore{
+		options: Options,
+		vault:   make(map[string]map[string]any),
+	}
+}
+
+// IsReference
+// returns true if the value refers to a secret of a keystore.
+func IsReference(Value string) bool {
+	return strings.HasPrefix(Value, PREFIX_VAULT) || strings.HasPrefix(Value, PREFIX_KMS) || strings.HasPrefix(Value, PREFIX_AGE)
+}
+
+// Resolve
+// fetches the secret the reference refers to.
+func (k *Keystore) Resolve(Reference string) (string, error) {
+	k.mutex.Lock()
+	defer k.mutex.Unlock()
+
+	switch {
+
+	case strings.HasPrefix(Reference, PREFIX_VAULT):
+		return k.vaultSecret(strings.TrimPrefix(Reference, PREFIX_VAULT))
+
+	case strings.HasPrefix(Reference, PREFIX_KMS):
+		return k.kmsDecrypt(strings.TrimPrefix(Reference, PREFIX_KMS))
+
+	case strings.HasPrefix(Reference, PREFIX_AGE):
+		Data, err := os.ReadFile(strings.TrimPrefix(Reference, PREFIX_AGE))
+		if err != nil {
+			return "", err
+		}
+
+		Plain, err := k.ageDecrypt(Data)
+		if err != nil {
+			return "", err
+		}
+
+		/* echo secret | age adds a new line */
+		return strings.TrimRight(string(Plain), "\r\n"), nil
+
+	}
+
+	return "", errors.New("not a keystore reference")
+}
+
+// ResolveAll
+// replaces every reference in the string fields of the struct (and the
+// structs, pointers, slices and maps it contains) by its secret.
+// Returns the count of resolved references.
+func (k *Keystore) ResolveAll(Value any) (int, error) {
+	return k.resolve(reflect.ValueOf(Value), "")
+}
+
+func (k *Keystore) resolve(Value reflect.Value, Path string) (int, error) {
+	var Count = 0
+
+	switch Value.Kind() {
+
+	case reflect.Pointer, reflect.Interface:
+		if Value.IsNil() {
+			return 0, nil
+		}
+
+		return k.resolve(Value.Elem(), Path)
+
+	case reflect.Struct:
+		for i := 0; i < Value.NumField(); i++ {
+			if !Value.Type().Field(i).IsExported() {
+				continue
+			}
+
+			n, err := k.resolve(Value.Field(i), strings.TrimPrefix(Path+"."+Value.Type().Field(i).Name, "."))
+			if err != nil {
+				return Count, err
+			}
+
+			Count += n
+		}
+
+	case reflect.Slice, reflect.Array:
+		for i := 0; i < Value.Len(); i++ {
+			n, err := k.resolve(Value.Index(i), fmt.Sprintf("%v[%v]", Path, i))
+			if err != nil {
+				return Count, err
+			}
+
+			Count += n
+		}
+
+	case reflect.Map:
+		if Value.Type().Elem().Kind() != reflect.String {
+			return 0, nil
+		}
+
+		for _, Key := range Value.MapKeys() {
+			var Entry = Value.MapIndex(Key).String()
+
+			if !IsReference(Entry) {
+				continue
+			}
+
+			Secret, err := k.Resolve(Entry)
+			if err != nil {
+				return Count, fmt.Errorf("%v[%v]: %v", Path, Key, err)
+			}
+
+			Value.SetMapIndex(Key, reflect.ValueOf(Secret).Convert(Value.Type().Elem()))
+			Count++
+		}
+
+	case reflect.String:
+		if !IsReference(Value.String()) || !Value.CanSet() {
+			return 0, nil
+		}
+
+		Secret, err := k.Resolve(Value.String())
+		if err != nil {
+			return 0, fmt.Errorf("%v: %v", Path, err)
+		}
+
+		Value.SetString(Secret)
+		Count++
+
+	}
+
+	return Count, nil
+}
+
+func env(Value string, Names ...string) string {
+	if len(Value) > 0 {
+		return Value
+	}
+
+	for _, Name := range Names {
+		if Value = os.Getenv(Name); len(Value) > 0 {
+			return Value
+		}
+	}
+
+	return ""
+}
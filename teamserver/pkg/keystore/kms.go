@@ -0,0 +1,172 @@
+package keystore
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+	"time"
+)
+
+// kmsDecrypt
+// decrypts the ciphertext blob (base64, as aws kms encrypt returns it)
+// with aws kms. The blob can also be read from a file.
+func (k *Keystore) kmsDecrypt(Blob string) (string, error) {
+	var Options = k.options.KMS
+
+	if strings.HasPrefix(Blob, "/") || strings.HasPrefix(Blob, "./") {
+		Data, err := os.ReadFile(Blob)
+		if err != nil {
+			return "", err
+		}
+
+		/* raw blob (fileb://) or base64 */
+		if Decoded, err := base64.StdEncoding.DecodeString(strings.TrimSpace(string(Data))); err == nil {
+			Data = Decoded
+		}
+
+		Blob = base64.StdEncoding.EncodeToString(Data)
+	}
+
+	var (
+		Region    = env(Options.Region, "AWS_REGION", "AWS_DEFAULT_REGION")
+		AccessKey = env(Options.AccessKey, "AWS_ACCESS_KEY_ID")
+		SecretKey = env(Options.SecretKey, "AWS_SECRET_ACCESS_KEY")
+		Session   = env(Options.SessionToken, "AWS_SESSION_TOKEN")
+		Endpoint  = Options.Endpoint
+	)
+
+	if len(Region) == 0 {
+		return "", errors.New("aws region not specified (KMS.Region or $AWS_REGION)")
+	}
+
+	if len(AccessKey) == 0 || len(SecretKey) == 0 {
+		return "", errors.New("aws credentials not specified (KMS.AccessKey/SecretKey or $AWS_ACCESS_KEY_ID/$AWS_SECRET_ACCESS_KEY)")
+	}
+
+	if len(Endpoint) == 0 {
+		Endpoint = "https://kms." + Region + ".amazonaws.com/"
+	}
+
+	Body, err := json.Marshal(map[string]string{"CiphertextBlob": Blob})
+	if err != nil {
+		return "", err
+	}
+
+	Request, err := http.NewRequest(http.MethodPost, Endpoint, bytes.NewReader(Body))
+	if err != nil {
+		return "", err
+	}
+
+	Request.Header.Set("Content-Type", "application/x-amz-json-1.1")
+	Request.Header.Set("X-Amz-Target", "TrentService.Decrypt")
+
+	if len(Session) > 0 {
+		Request.Header.Set("X-Amz-Security-Token", Session)
+	}
+
+	kmsSign(Request, Body, Region, AccessKey, SecretKey, time.Now().UTC())
+
+	Reply, err := (&http.Client{Timeout: 30 * time.Second}).Do(Request)
+	if err != nil {
+		return "", err
+	}
+	defer Reply.Body.Close()
+
+	Data, err := io.ReadAll(io.LimitReader(Reply.Body, 1<<20))
+	if err != nil {
+		return "", err
+	}
+
+	var Response struct {
+		Plaintext string `json:"Plaintext"`
+		Type      string `json:"__type"`
+		Message   string `json:"message"`
+	}
+
+	json.Unmarshal(Data, &Response)
+
+	if Reply.StatusCode != http.StatusOK {
+		return "", fmt.Errorf("aws kms decrypt: %v %v %v", Reply.Status, Response.Type, Response.Message)
+	}
+
+	Plain, err := base64.StdEncoding.DecodeString(Response.Plaintext)
+	if err != nil {
+		return "", errors.New("aws kms decrypt: invalid plaintext: " + err.Error())
+	}
+
+	return string(Plain), nil
+}
+
+// kmsSign
+// signs the request with aws signature version 4.
+func kmsSign(Request *http.Request, Body []byte, Region, AccessKey, SecretKey string, Now time.Time) {
+	var (
+		Date    = Now.Format("20060102")
+		Time    = Now.Format("20060102T150405Z")
+		Scope   = Date + "/" + Region + "/kms/aws4_request"
+		Hash    = sha256.Sum256(Body)
+		Headers = []string{"content-type", "host", "x-amz-date", "x-amz-target"}
+		Path    = Request.URL.EscapedPath()
+	)
+
+	Request.Header.Set("X-Amz-Date", Time)
+
+	if len(Request.Header.Get("X-Amz-Security-Token")) > 0 {
+		Headers = append(Headers, "x-amz-security-token")
+	}
+
+	if len(Path) == 0 {
+		Path = "/"
+	}
+
+	var Canonical strings.Builder
+
+	Canonical.WriteString(Request.Method + "\n" + Path + "\n" + kmsQuery(Request.URL.Query()) + "\n")
+
+	for _, Header := range Headers {
+		var Value = Request.Header.Get(Header)
+
+		if Header == "host" {
+			Value = Request.URL.Host
+		}
+
+		Canonical.WriteString(Header + ":" + strings.TrimSpace(Value) + "\n")
+	}
+
+	Canonical.WriteString("\n" + strings.Join(Headers, ";") + "\n" + hex.EncodeToString(Hash[:]))
+
+	var (
+		CanonicalHash = sha256.Sum256([]byte(Canonical.String()))
+		Sign          = "AWS4-HMAC-SHA256\n" + Time + "\n" + Scope + "\n" + hex.EncodeToString(CanonicalHash[:])
+		Key           = kmsHmac([]byte("AWS4"+SecretKey), Date)
+	)
+
+	Key = kmsHmac(Key, Region)
+	Key = kmsHmac(Key, "kms")
+	Key = kmsHmac(Key, "aws4_request")
+
+	Request.Header.Set("Authorization", fmt.Sprintf("AWS4-HMAC-SHA256 Credential=%v/%v, SignedHeaders=%v, Signature=%v", AccessKey, Scope, strings.Join(Headers, ";"), hex.EncodeToString(kmsHmac(Key, Sign))))
+}
+
+func kmsHmac(Key []byte, Data string) []byte {
+	var Mac = hmac.New(sha256.New, Key)
+
+	Mac.Write([]byte(Data))
+
+	return Mac.Sum(nil)
+}
+
+func kmsQuery(Query url.Values) string {
+	/* Encode sorts by key. aws wants spaces as %20 */
+	return strings.ReplaceAll(Query.Encode(), "+", "%20")
+}
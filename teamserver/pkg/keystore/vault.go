@@ -0,0 +1,206 @@
+package keystore
+
+import (
+	"bytes"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// vaultSecret
+// returns the field of a kv secret: <path>#<field>. The field can be
+// left out for secrets with a single field.
+func (k *Keystore) vaultSecret(Reference string) (string, error) {
+	var (
+		Path, Field, _ = strings.Cut(Reference, "#")
+		Data, ok       = k.vault[Path]
+		err            error
+	)
+
+	if !ok {
+		if Data, err = k.vaultRead(Path); err != nil {
+			return "", err
+		}
+
+		k.vault[Path] = Data
+	}
+
+	if len(Field) == 0 {
+		if len(Data) != 1 {
+			return "", fmt.Errorf("vault secret %v has %v fields. specify one (%v#<field>)", Path, len(Data), Path)
+		}
+
+		for Field = range Data {
+		}
+	}
+
+	Value, ok := Data[Field]
+	if !ok {
+		return "", fmt.Errorf("vault secret %v has no field %v", Path, Field)
+	}
+
+	if Value, ok := Value.(string); ok {
+		return Value, nil
+	}
+
+	Encoded, err := json.Marshal(Value)
+
+	return string(Encoded), err
+}
+
+func (k *Keystore) vaultRead(Path string) (map[string]any, error) {
+	var Response struct {
+		Data   map[string]any `json:"data"`
+		Errors []string       `json:"errors"`
+	}
+
+	if err := k.vaultRequest(http.MethodGet, strings.TrimPrefix(Path, "/"), nil, &Response); err != nil {
+		return nil, err
+	}
+
+	/* kv version 2 nests the secret in data.data */
+	if Data, ok := Response.Data["data"].(map[string]any); ok {
+		if _, ok = Response.Data["metadata"]; ok {
+			return Data, nil
+		}
+	}
+
+	return Response.Data, nil
+}
+
+func (k *Keystore) vaultRequest(Method, Path string, Body any, Response any) error {
+	var (
+		Options = k.options.Vault
+		Address = strings.TrimSuffix(env(Options.Address, "VAULT_ADDR"), "/")
+		Payload io.Reader
+	)
+
+	if len(Address) == 0 {
+		return errors.New("vault address not specified (Vault.Address or $VAULT_ADDR)")
+	}
+
+	if Body != nil {
+		Encoded, err := json.Marshal(Body)
+		if err != nil {
+			return err
+		}
+
+		Payload = bytes.NewReader(Encoded)
+	}
+
+	Request, err := http.NewRequest(Method, Address+"/v1/"+Path, Payload)
+	if err != nil {
+		return err
+	}
+
+	if Namespace := env(Options.Namespace, "VAULT_NAMESPACE"); len(Namespace) > 0 {
+		Request.Header.Set("X-Vault-Namespace", Namespace)
+	}
+
+	/* the login itself goes without a token */
+	if !strings.HasPrefix(Path, "auth/approle/login") {
+		Token, err := k.vaultToken()
+		if err != nil {
+			return err
+		}
+
+		Request.Header.Set("X-Vault-Token", Token)
+	}
+
+	Client, err := k.vaultClient()
+	if err != nil {
+		return err
+	}
+
+	Reply, err := Client.Do(Request)
+	if err != nil {
+		return err
+	}
+	defer Reply.Body.Close()
+
+	Data, err := io.ReadAll(io.LimitReader(Reply.Body, 1<<20))
+	if err != nil {
+		return err
+	}
+
+	if Reply.StatusCode != http.StatusOK {
+		var Error struct {
+			Errors []string `json:"errors"`
+		}
+
+		json.Unmarshal(Data, &Error)
+
+		return fmt.Errorf("vault %v %v: %v %v", Method, Path, Reply.Status, strings.Join(Error.Errors, ", "))
+	}
+
+	return json.Unmarshal(Data, Response)
+}
+
+func (k *Keystore) vaultToken() (string, error) {
+	var Options = k.options.Vault
+
+	if len(k.token) > 0 {
+		return k.token, nil
+	}
+
+	if len(Options.RoleID) > 0 {
+		var Login struct {
+			Auth struct {
+				ClientToken string `json:"client_token"`
+			} `json:"auth"`
+		}
+
+		if err := k.vaultRequest(http.MethodPost, "auth/approle/login", map[string]string{"role_id": Options.RoleID, "secret_id": Options.SecretID}, &Login); err != nil {
+			return "", err
+		}
+
+		k.token = Login.Auth.ClientToken
+	} else if k.token = env(Options.Token, "VAULT_TOKEN"); len(k.token) == 0 {
+		if Home, err := os.UserHomeDir(); err == nil {
+			if Token, err := os.ReadFile(filepath.Join(Home, ".vault-token")); err == nil {
+				k.token = strings.TrimSpace(string(Token))
+			}
+		}
+	}
+
+	if len(k.token) == 0 {
+		return "", errors.New("no vault token (Vault.Token, Vault.RoleID, $VAULT_TOKEN or ~/.vault-token)")
+	}
+
+	return k.token, nil
+}
+
+func (k *Keystore) vaultClient() (*http.Client, error) {
+	var (
+		Client = &http.Client{Timeout: 30 * time.Second}
+		CACert = env(k.options.Vault.CACert, "VAULT_CACERT")
+	)
+
+	if len(CACert) == 0 {
+		return Client, nil
+	}
+
+	PEM, err := os.ReadFile(CACert)
+	if err != nil {
+		return nil, err
+	}
+
+	var Pool = x509.NewCertPool()
+	if !Pool.AppendCertsFromPEM(PEM) {
+		return nil, errors.New("no certificate found in " + CACert)
+	}
+
+	Client.Transport = &http.Transport{
+		TLSClientConfig: &tls.Config{RootCAs: Pool, MinVersion: tls.VersionTLS12},
+	}
+
+	return Client, nil
+}
@@ -91,6 +91,7 @@ func (logger *Logger) Warn(args ...interface{}) {
         logger.log.SetPrefix("[" + colors.Yellow("WARN") + "] ")
     }
     logger.log.Println(args...)
+    remember("WARN", args...)
 }
 
 func (logger *Logger) Error(args ...interface{}) {
@@ -100,6 +101,7 @@ func (logger *Logger) Error(args ...interface{}) {
         logger.log.SetPrefix("[" + colors.Red("ERRO") + "] ")
     }
     logger.log.Println(args...)
+    remember("ERRO", args...)
 }
 
 func (logger *Logger) Fatal(args ...interface{}) {
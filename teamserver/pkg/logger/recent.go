@@ -0,0 +1,52 @@
+package logger
+
+import (
+    "fmt"
+    "strings"
+    "sync"
+    "time"
+)
+
+// warnings and errors kept for the admin panel
+const RECENT_MAX = 50
+
+type Entry struct {
+    Time    time.Time
+    Level   string
+    Message string
+}
+
+var recent struct {
+    sync.Mutex
+    Entries []Entry
+}
+
+// remember
+// keeps the message in the ring of the recent warnings and errors.
+func remember(Level string, args ...interface{}) {
+    var Message = strings.TrimSuffix(fmt.Sprintln(args...), "\n")
+
+    recent.Lock()
+    defer recent.Unlock()
+
+    if len(recent.Entries) == RECENT_MAX {
+        recent.Entries = recent.Entries[1:]
+    }
+
+    recent.Entries = append(recent.Entries, Entry{Time: time.Now(), Level: Level, Message: Message})
+}
+
+// Recent
+// returns the recent warnings and errors, newest first.
+func Recent() []Entry {
+    recent.Lock()
+    defer recent.Unlock()
+
+    var Entries = make([]Entry, len(recent.Entries))
+
+    for i := range recent.Entries {
+        Entries[len(Entries)-1-i] = recent.Entries[i]
+    }
+
+    return Entries
+}
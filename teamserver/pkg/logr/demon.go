@@ -3,13 +3,13 @@ package logr
 import (
 	"errors"
 	"fmt"
-	"log"
 	"os"
 	"path/filepath"
 	"strings"
 
 	"Havoc/pkg/common"
 	"Havoc/pkg/logger"
+	"Havoc/pkg/seal"
 )
 
 func (l Logr) AddAgentInput(AgentType, AgentID, User, TaskID, Input string, time string) {
@@ -33,9 +33,10 @@ func (l Logr) AddAgentInput(AgentType, AgentID, User, TaskID, Input string, time
 		}
 	}
 
-	f, err := os.OpenFile(DemonLogFile, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0644)
+	f, err := seal.Append(DemonLogFile)
 	if err != nil {
-		log.Fatal(err)
+		logger.Error("Failed to open File [" + DemonLogFile + "]: " + err.Error())
+		return
 	}
 	defer f.Close()
 
@@ -68,9 +69,10 @@ func (l Logr) AddAgentRaw(AgentID, Raw string) {
 		}
 	}
 
-	f, err := os.OpenFile(DemonLogFile, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0644)
+	f, err := seal.Append(DemonLogFile)
 	if err != nil {
-		log.Fatal(err)
+		logger.Error("Failed to open File [" + DemonLogFile + "]: " + err.Error())
+		return
 	}
 	defer f.Close()
 
@@ -101,9 +103,10 @@ func (l Logr) DemonAddOutput(DemonID string, Output map[string]string, time stri
 		}
 	}
 
-	f, err := os.OpenFile(DemonLogFile, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0644)
+	f, err := seal.Append(DemonLogFile)
 	if err != nil {
-		log.Fatal(err)
+		logger.Error("Failed to open File [" + DemonLogFile + "]: " + err.Error())
+		return
 	}
 	defer f.Close()
 
@@ -162,7 +165,7 @@ func (l Logr) DemonAddDownloadedFile(DemonID, FileName string, FileBytes []byte)
 		}
 	}
 
-	f, err := os.Create(DemonDownload)
+	f, err := seal.Create(DemonDownload)
 	if err != nil {
 		logger.Error("Failed to create file: " + err.Error())
 		return
@@ -205,7 +208,7 @@ func (l Logr) DemonSaveScreenshot(DemonID, Name string, BmpBytes []byte) error {
 		}
 	}
 
-	f, err := os.Create(DemonScreenshot)
+	f, err := seal.Create(DemonScreenshot)
 	if err != nil {
 		logger.Error("Failed to create file: " + err.Error())
 		return errors.New("Failed to create file: " + err.Error())
@@ -221,3 +224,84 @@ func (l Logr) DemonSaveScreenshot(DemonID, Name string, BmpBytes []byte) error {
 
 	return nil
 }
+
+func (l Logr) DemonSaveOutput(DemonID, Name string, Output []byte) error {
+	var (
+		DemonPath      = l.AgentPath + "/" + DemonID
+		DemonOutputDir = DemonPath + "/Output"
+		DemonOutput    = DemonOutputDir + "/" + Name
+	)
+
+	// check if we don't have a path traversal
+	path := filepath.Clean(DemonOutput)
+	if !strings.HasPrefix(path, DemonOutputDir) {
+		logger.Error("File didn't started with agent output path. abort")
+		return errors.New("file didn't started with agent output path. abort")
+	}
+
+	if err := os.MkdirAll(DemonOutputDir, os.ModePerm); err != nil {
+		logger.Error("Failed to create Logr demon " + DemonID + " output folder: " + err.Error())
+		return errors.New("Failed to create Logr demon " + DemonID + " output folder: " + err.Error())
+	}
+
+	if err := seal.WriteFile(DemonOutput, Output); err != nil {
+		logger.Error("Failed to write output file: " + err.Error())
+		return errors.New("Failed to write output file: " + err.Error())
+	}
+
+	return nil
+}
+
+// DemonRecording
+// creates a recording in the loot folder of the agent. the frames
+// get appended to it while the recording runs.
+func (l Logr) DemonRecording(DemonID, Name string) (*seal.Writer, error) {
+	var (
+		DemonPath         = l.AgentPath + "/" + DemonID
+		DemonRecordingDir = DemonPath + "/Recordings"
+		DemonRecording    = DemonRecordingDir + "/" + Name
+	)
+
+	// check if we don't have a path traversal
+	path := filepath.Clean(DemonRecording)
+	if !strings.HasPrefix(path, DemonRecordingDir) {
+		logger.Error("File didn't started with agent recording path. abort")
+		return nil, errors.New("file didn't started with agent recording path. abort")
+	}
+
+	if err := os.MkdirAll(DemonRecordingDir, os.ModePerm); err != nil {
+		logger.Error("Failed to create Logr demon " + DemonID + " recording folder: " + err.Error())
+		return nil, errors.New("Failed to create Logr demon " + DemonID + " recording folder: " + err.Error())
+	}
+
+	return seal.Create(DemonRecording)
+}
+
+// DemonLoot
+// reads a file from the loot folder (Download, Screenshots, Output, Recordings) of the agent.
+func (l Logr) DemonLoot(DemonID, Folder, Name string) ([]byte, error) {
+	path, err := l.DemonLootPath(DemonID, Folder, Name)
+	if err != nil {
+		return nil, err
+	}
+
+	return seal.ReadFile(path)
+}
+
+// DemonLootPath
+// returns the path of a file from the loot folder of the agent.
+func (l Logr) DemonLootPath(DemonID, Folder, Name string) (string, error) {
+	var (
+		DemonPath = l.AgentPath + "/" + DemonID
+		LootDir   = DemonPath + "/" + Folder
+		LootFile  = LootDir + "/" + Name
+	)
+
+	// check if we don't have a path traversal
+	path := filepath.Clean(LootFile)
+	if !strings.HasPrefix(path, filepath.Clean(l.AgentPath)+"/") || filepath.Dir(path) != filepath.Clean(LootDir) {
+		return "", errors.New("file didn't started with agent loot path. abort")
+	}
+
+	return path, nil
+}
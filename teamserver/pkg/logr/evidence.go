@@ -0,0 +1,37 @@
+package logr
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"Havoc/pkg/logger"
+	"Havoc/pkg/seal"
+)
+
+// SaveEvidence
+// saves a file an operator attached as evidence in the evidence folder
+// and returns its path.
+func (l Logr) SaveEvidence(Name string, Data []byte) (string, error) {
+	var Evidence = l.EvidencePath + "/" + Name
+
+	// check if we don't have a path traversal
+	path := filepath.Clean(Evidence)
+	if !strings.HasPrefix(path, filepath.Clean(l.EvidencePath)+string(filepath.Separator)) {
+		logger.Error("File didn't started with evidence path. abort")
+		return "", errors.New("file didn't started with evidence path. abort")
+	}
+
+	if err := os.MkdirAll(l.EvidencePath, os.ModePerm); err != nil {
+		logger.Error("Failed to create Logr evidence folder: " + err.Error())
+		return "", errors.New("Failed to create Logr evidence folder: " + err.Error())
+	}
+
+	if err := seal.WriteFile(path, Data); err != nil {
+		logger.Error("Failed to write evidence file: " + err.Error())
+		return "", errors.New("Failed to write evidence file: " + err.Error())
+	}
+
+	return path, nil
+}
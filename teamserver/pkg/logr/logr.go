@@ -1,7 +1,10 @@
 package logr
 
 import (
+	"net/url"
 	"os"
+	"path/filepath"
+	"strings"
 
 	"Havoc/pkg/logger"
 )
@@ -12,6 +15,10 @@ type Logr struct {
 	ListenerPath string
 	AgentPath    string
 	ServerPath   string
+	// files reassembled from segmented downloads
+	DownloadPath string
+	// files the operators attached to tasks and timeline entries
+	EvidencePath string
 
 	LogrSendText func(text string)
 }
@@ -28,6 +35,8 @@ func NewLogr(Server, Path string) *Logr {
 	logr.Path = Server + "/" + Path
 	logr.ListenerPath = Path + "/listener"
 	logr.AgentPath = Path + "/agents"
+	logr.DownloadPath = Path + "/downloads"
+	logr.EvidencePath = Path + "/evidence"
 
 	if _, err = os.Stat(Path); os.IsNotExist(err) {
 		if err = os.MkdirAll(Path, os.ModePerm); err != nil {
@@ -60,5 +69,38 @@ func NewLogr(Server, Path string) *Logr {
 		}
 	}
 
+	if _, err = os.Stat(logr.DownloadPath); os.IsNotExist(err) {
+		if err = os.MkdirAll(logr.DownloadPath, os.ModePerm); err != nil {
+			logger.Error("Failed to create Logr download folder: " + err.Error())
+			return nil
+		}
+	}
+
+	if _, err = os.Stat(logr.EvidencePath); os.IsNotExist(err) {
+		if err = os.MkdirAll(logr.EvidencePath, os.ModePerm); err != nil {
+			logger.Error("Failed to create Logr evidence folder: " + err.Error())
+			return nil
+		}
+	}
+
 	return logr
 }
+
+// TransferPath
+// returns the path of the file relative to the logr folder, the way the
+// transfer endpoint of the teamserver serves it (agents/..., downloads/...).
+// The segments are escaped so names with spaces or non-ascii characters
+// keep working as url.
+func (l Logr) TransferPath(File string) string {
+	Path, err := filepath.Rel(filepath.Dir(l.AgentPath), File)
+	if err != nil {
+		return ""
+	}
+
+	var Segments = strings.Split(filepath.ToSlash(Path), "/")
+	for i := range Segments {
+		Segments[i] = url.PathEscape(Segments[i])
+	}
+
+	return strings.Join(Segments, "/")
+}
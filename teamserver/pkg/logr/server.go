@@ -2,13 +2,27 @@ package logr
 
 import (
 	"bufio"
+	"io"
 	"log"
 	"os"
 	"regexp"
+	"sync"
 
 	"Havoc/pkg/logger"
+	"Havoc/pkg/seal"
 )
 
+// file the teamserver output gets written to. swapped once the storage gets sealed
+var serverLog struct {
+	sync.Mutex
+	io.WriteCloser
+}
+
+type discard struct{}
+
+func (discard) Write(Data []byte) (int, error) { return len(Data), nil }
+func (discard) Close() error                   { return nil }
+
 func strip(str []byte) []byte {
 	var (
 		ansi = "[\u001B\u009B][[\\]()#;?]*(?:(?:(?:[a-zA-Z\\d]*(?:;[a-zA-Z\\d]*)*)?\u0007)|(?:(?:\\d{1,4}(?:;\\d{0,4})*)?[\\dA-PRZcf-ntqry=><~]))"
@@ -31,6 +45,8 @@ func (l Logr) ServerStdOutInit() {
 		log.Fatal(err)
 	}
 
+	serverLog.WriteCloser = File
+
 	os.Stdout = StdWrite
 
 	logger.LoggerInstance = logger.NewLogger(StdWrite)
@@ -49,7 +65,9 @@ func (l Logr) ServerStdOutInit() {
 					l.LogrSendText(string(strip(rawLine)))
 				}
 
-				_, err := File.Write(strip(line))
+				serverLog.Lock()
+				_, err := serverLog.Write(strip(line))
+				serverLog.Unlock()
 				if err != nil {
 					return
 				}
@@ -62,3 +80,27 @@ func (l Logr) ServerStdOutInit() {
 		}
 	}()
 }
+
+// ServerStdOutSeal
+// seals what the teamserver logged so far and everything it logs from now on.
+func (l Logr) ServerStdOutSeal() error {
+	serverLog.Lock()
+	defer serverLog.Unlock()
+
+	if serverLog.WriteCloser == nil {
+		return nil
+	}
+
+	serverLog.Close()
+
+	File, err := seal.Append(l.Path + "/teamserver.log")
+	if err != nil {
+		/* rather lose the log than write it in plain text */
+		serverLog.WriteCloser = discard{}
+		return err
+	}
+
+	serverLog.WriteCloser = File
+
+	return nil
+}
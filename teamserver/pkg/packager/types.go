@@ -12,6 +12,9 @@ type (
 		User    string `json:"User"`
 		Time    string `json:"Time"`
 		OneTime string `json:"OneTime"`
+
+		// workspace the event belongs to. empty for global events
+		Workspace string `json:"Workspace,omitempty"`
 	}
 
 	Body struct {
@@ -45,6 +48,12 @@ type (
 			Edit   int
 			Mark   int
 			Error  int
+
+			TemplateSave   int
+			TemplateRemove int
+			TemplateList   int
+			Clone          int
+			Egress         int
 		}
 
 		Chat struct {
@@ -59,9 +68,13 @@ type (
 		Credentials struct {
 			Type int
 
-			Add    int
-			Edit   int
-			Remove int
+			Add     int
+			Edit    int
+			Remove  int
+			List    int
+			Cookies int
+			Export  int
+			Import  int
 		}
 
 		HostFile struct {
@@ -114,6 +127,271 @@ type (
 			Type    int
 			Log     int
 			Profile int
+			Crash   int
+		}
+
+		Infra struct {
+			Type int
+
+			Burn    int
+			Restore int
+			List    int
+		}
+
+		Bundle struct {
+			Type int
+
+			Export int
+			Import int
+			Key    int
+		}
+
+		Export struct {
+			Type int
+
+			Stix     int
+			Timeline int
+		}
+
+		Snapshot struct {
+			Type int
+
+			List int
+			Diff int
+		}
+
+		Loot struct {
+			Type int
+
+			Fetch int
+		}
+
+		Download struct {
+			Type int
+
+			Segmented int
+			Status    int
+			Finished  int
+		}
+
+		Archive struct {
+			Type int
+
+			List    int
+			Add     int
+			Restore int
+		}
+
+		Search struct {
+			Type int
+
+			Query int
+		}
+
+		Preset struct {
+			Type int
+
+			List   int
+			Add    int
+			Remove int
+		}
+
+		Script struct {
+			Type int
+
+			List   int
+			Add    int
+			Remove int
+		}
+
+		Lateral struct {
+			Type int
+
+			Move    int
+			List    int
+			Methods int
+		}
+
+		SSH struct {
+			Type int
+
+			Connect    int
+			Disconnect int
+			List       int
+		}
+
+		Directory struct {
+			Type int
+
+			List int
+		}
+
+		Blocklist struct {
+			Type int
+
+			List   int
+			Add    int
+			Remove int
+		}
+
+		Approval struct {
+			Type int
+
+			List    int
+			Approve int
+			Deny    int
+		}
+
+		Template struct {
+			Type int
+
+			List    int
+			Add     int
+			Remove  int
+			Execute int
+		}
+
+		Batch struct {
+			Type int
+
+			Task   int
+			List   int
+			Result int
+			Tag    int
+			Tags   int
+		}
+
+		Schedule struct {
+			Type int
+
+			Add    int
+			List   int
+			Cancel int
+		}
+
+		Clipboard struct {
+			Type int
+
+			History int
+		}
+
+		Registry struct {
+			Type int
+
+			Records int
+			Changes int
+		}
+
+		Services struct {
+			Type int
+
+			List int
+		}
+
+		Desktop struct {
+			Type int
+
+			Frame   int
+			Watch   int
+			Leave   int
+			List    int
+			Stopped int
+		}
+
+		Uploads struct {
+			Type int
+
+			Rules  int
+			Add    int
+			Remove int
+			Audit  int
+		}
+
+		Relay struct {
+			Type int
+
+			Connect    int
+			Message    int
+			Disconnect int
+		}
+
+		Notification struct {
+			Type int
+
+			Alert       int
+			Digest      int
+			Preferences int
+			Set         int
+		}
+
+		Group struct {
+			Type int
+
+			Save    int
+			Remove  int
+			List    int
+			Members int
+			Tag     int
+		}
+
+		Spray struct {
+			Type int
+
+			Start     int
+			List      int
+			Attempts  int
+			Pause     int
+			Resume    int
+			Cancel    int
+			Protocols int
+		}
+
+		Pivot struct {
+			Type int
+
+			List    int
+			Streams int
+		}
+
+		Route struct {
+			Type int
+
+			Add    int
+			Remove int
+			List   int
+			Listen int
+			Close  int
+		}
+
+		Files struct {
+			Type int
+
+			Records int
+		}
+
+		Timeline struct {
+			Type int
+
+			Add    int
+			Remove int
+			List   int
+		}
+
+		Evidence struct {
+			Type int
+
+			Add    int
+			Remove int
+			List   int
+			Fetch  int
+		}
+
+		Detection struct {
+			Type int
+
+			Annotate int
+			List     int
+			Coverage int
 		}
 	}
 )
@@ -144,6 +422,12 @@ var Type = Types{
 		Edit   int
 		Mark   int
 		Error  int
+
+		TemplateSave   int
+		TemplateRemove int
+		TemplateList   int
+		Clone          int
+		Egress         int
 	}{
 		Type: 0x2,
 
@@ -152,6 +436,12 @@ var Type = Types{
 		Remove: 0x3,
 		Mark:   0x4,
 		Error:  0x5,
+
+		TemplateSave:   0x6,
+		TemplateRemove: 0x7,
+		TemplateList:   0x8,
+		Clone:          0x9,
+		Egress:         0xA,
 	},
 
 	Chat: struct {
@@ -171,15 +461,23 @@ var Type = Types{
 	},
 
 	Credentials: struct {
-		Type   int
-		Add    int
-		Edit   int
-		Remove int
+		Type    int
+		Add     int
+		Edit    int
+		Remove  int
+		List    int
+		Cookies int
+		Export  int
+		Import  int
 	}{
-		Type:   0x3,
-		Add:    0x1,
-		Edit:   0x2,
-		Remove: 0x3,
+		Type:    0x3,
+		Add:     0x1,
+		Edit:    0x2,
+		Remove:  0x3,
+		List:    0x4,
+		Cookies: 0x5,
+		Export:  0x6,
+		Import:  0x7,
 	},
 
 	HostFile: struct {
@@ -254,5 +552,402 @@ var Type = Types{
 		Type    int
 		Log     int
 		Profile int
-	}{Type: 0x10, Log: 0x1, Profile: 0x2},
+		Crash   int
+	}{Type: 0x10, Log: 0x1, Profile: 0x2, Crash: 0x3},
+
+	Infra: struct {
+		Type    int
+		Burn    int
+		Restore int
+		List    int
+	}{
+		Type:    0x11,
+		Burn:    0x1,
+		Restore: 0x2,
+		List:    0x3,
+	},
+
+	Bundle: struct {
+		Type   int
+		Export int
+		Import int
+		Key    int
+	}{
+		Type:   0x12,
+		Export: 0x1,
+		Import: 0x2,
+		Key:    0x3,
+	},
+
+	Export: struct {
+		Type     int
+		Stix     int
+		Timeline int
+	}{
+		Type:     0x13,
+		Stix:     0x1,
+		Timeline: 0x2,
+	},
+
+	Snapshot: struct {
+		Type int
+		List int
+		Diff int
+	}{
+		Type: 0x14,
+		List: 0x1,
+		Diff: 0x2,
+	},
+
+	Loot: struct {
+		Type  int
+		Fetch int
+	}{
+		Type:  0x15,
+		Fetch: 0x1,
+	},
+
+	Download: struct {
+		Type      int
+		Segmented int
+		Status    int
+		Finished  int
+	}{
+		Type:      0x16,
+		Segmented: 0x1,
+		Status:    0x2,
+		Finished:  0x3,
+	},
+
+	Archive: struct {
+		Type    int
+		List    int
+		Add     int
+		Restore int
+	}{
+		Type:    0x17,
+		List:    0x1,
+		Add:     0x2,
+		Restore: 0x3,
+	},
+
+	Search: struct {
+		Type  int
+		Query int
+	}{
+		Type:  0x18,
+		Query: 0x1,
+	},
+
+	Preset: struct {
+		Type   int
+		List   int
+		Add    int
+		Remove int
+	}{
+		Type:   0x19,
+		List:   0x1,
+		Add:    0x2,
+		Remove: 0x3,
+	},
+
+	Script: struct {
+		Type   int
+		List   int
+		Add    int
+		Remove int
+	}{
+		Type:   0x1A,
+		List:   0x1,
+		Add:    0x2,
+		Remove: 0x3,
+	},
+
+	Lateral: struct {
+		Type    int
+		Move    int
+		List    int
+		Methods int
+	}{
+		Type:    0x1B,
+		Move:    0x1,
+		List:    0x2,
+		Methods: 0x3,
+	},
+
+	SSH: struct {
+		Type       int
+		Connect    int
+		Disconnect int
+		List       int
+	}{
+		Type:       0x1C,
+		Connect:    0x1,
+		Disconnect: 0x2,
+		List:       0x3,
+	},
+
+	Directory: struct {
+		Type int
+		List int
+	}{
+		Type: 0x1D,
+		List: 0x1,
+	},
+
+	Blocklist: struct {
+		Type   int
+		List   int
+		Add    int
+		Remove int
+	}{
+		Type:   0x1E,
+		List:   0x1,
+		Add:    0x2,
+		Remove: 0x3,
+	},
+
+	Approval: struct {
+		Type    int
+		List    int
+		Approve int
+		Deny    int
+	}{
+		Type:    0x1F,
+		List:    0x1,
+		Approve: 0x2,
+		Deny:    0x3,
+	},
+
+	Template: struct {
+		Type    int
+		List    int
+		Add     int
+		Remove  int
+		Execute int
+	}{
+		Type:    0x20,
+		List:    0x1,
+		Add:     0x2,
+		Remove:  0x3,
+		Execute: 0x4,
+	},
+
+	Batch: struct {
+		Type   int
+		Task   int
+		List   int
+		Result int
+		Tag    int
+		Tags   int
+	}{
+		Type:   0x21,
+		Task:   0x1,
+		List:   0x2,
+		Result: 0x3,
+		Tag:    0x4,
+		Tags:   0x5,
+	},
+
+	Schedule: struct {
+		Type   int
+		Add    int
+		List   int
+		Cancel int
+	}{
+		Type:   0x22,
+		Add:    0x1,
+		List:   0x2,
+		Cancel: 0x3,
+	},
+
+	Clipboard: struct {
+		Type    int
+		History int
+	}{
+		Type:    0x23,
+		History: 0x1,
+	},
+
+	Registry: struct {
+		Type    int
+		Records int
+		Changes int
+	}{
+		Type:    0x24,
+		Records: 0x1,
+		Changes: 0x2,
+	},
+
+	Services: struct {
+		Type int
+		List int
+	}{
+		Type: 0x25,
+		List: 0x1,
+	},
+
+	Desktop: struct {
+		Type    int
+		Frame   int
+		Watch   int
+		Leave   int
+		List    int
+		Stopped int
+	}{
+		Type:    0x26,
+		Frame:   0x1,
+		Watch:   0x2,
+		Leave:   0x3,
+		List:    0x4,
+		Stopped: 0x5,
+	},
+
+	Uploads: struct {
+		Type   int
+		Rules  int
+		Add    int
+		Remove int
+		Audit  int
+	}{
+		Type:   0x27,
+		Rules:  0x1,
+		Add:    0x2,
+		Remove: 0x3,
+		Audit:  0x4,
+	},
+
+	Relay: struct {
+		Type       int
+		Connect    int
+		Message    int
+		Disconnect int
+	}{
+		Type:       0x28,
+		Connect:    0x1,
+		Message:    0x2,
+		Disconnect: 0x3,
+	},
+
+	Notification: struct {
+		Type        int
+		Alert       int
+		Digest      int
+		Preferences int
+		Set         int
+	}{
+		Type:        0x29,
+		Alert:       0x1,
+		Digest:      0x2,
+		Preferences: 0x3,
+		Set:         0x4,
+	},
+
+	Group: struct {
+		Type    int
+		Save    int
+		Remove  int
+		List    int
+		Members int
+		Tag     int
+	}{
+		Type:    0x2A,
+		Save:    0x1,
+		Remove:  0x2,
+		List:    0x3,
+		Members: 0x4,
+		Tag:     0x5,
+	},
+
+	Spray: struct {
+		Type      int
+		Start     int
+		List      int
+		Attempts  int
+		Pause     int
+		Resume    int
+		Cancel    int
+		Protocols int
+	}{
+		Type:      0x2B,
+		Start:     0x1,
+		List:      0x2,
+		Attempts:  0x3,
+		Pause:     0x4,
+		Resume:    0x5,
+		Cancel:    0x6,
+		Protocols: 0x7,
+	},
+
+	Pivot: struct {
+		Type    int
+		List    int
+		Streams int
+	}{
+		Type:    0x2C,
+		List:    0x1,
+		Streams: 0x2,
+	},
+
+	Route: struct {
+		Type   int
+		Add    int
+		Remove int
+		List   int
+		Listen int
+		Close  int
+	}{
+		Type:   0x2D,
+		Add:    0x1,
+		Remove: 0x2,
+		List:   0x3,
+		Listen: 0x4,
+		Close:  0x5,
+	},
+
+	Files: struct {
+		Type    int
+		Records int
+	}{
+		Type:    0x2E,
+		Records: 0x1,
+	},
+
+	Timeline: struct {
+		Type   int
+		Add    int
+		Remove int
+		List   int
+	}{
+		Type:   0x2F,
+		Add:    0x1,
+		Remove: 0x2,
+		List:   0x3,
+	},
+
+	Evidence: struct {
+		Type   int
+		Add    int
+		Remove int
+		List   int
+		Fetch  int
+	}{
+		Type:   0x30,
+		Add:    0x1,
+		Remove: 0x2,
+		List:   0x3,
+		Fetch:  0x4,
+	},
+
+	Detection: struct {
+		Type     int
+		Annotate int
+		List     int
+		Coverage int
+	}{
+		Type:     0x31,
+		Annotate: 0x1,
+		List:     0x2,
+		Coverage: 0x3,
+	},
 }
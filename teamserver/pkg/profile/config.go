@@ -1,12 +1,16 @@
 package profile
 
 type HavocConfig struct {
+	// version of the profile format. 1 if left out
+	Version int `yaotl:"Version,optional"`
+
 	Server    *ServerProfile  `yaotl:"Teamserver,block"`
 	Operators *OperatorsBlock `yaotl:"Operators,block"`
 	Listener  *Listeners      `yaotl:"Listeners,block"`
 	Demon     *Demon          `yaotl:"Demon,block"`
 	Service   *ServiceConfig  `yaotl:"Service,block"`
 	WebHook   *WebHookConfig  `yaotl:"WebHook,block"`
+	Keystore  *KeystoreConfig `yaotl:"Keystore,block"`
 }
 
 type WebHookDiscordConfig struct {
@@ -15,8 +19,42 @@ type WebHookDiscordConfig struct {
 	UserName  string `yaotl:"User,optional"`
 }
 
+type WebHookSmtpConfig struct {
+	// mail server and its port. default is 587
+	Host string `yaotl:"Host"`
+	Port int    `yaotl:"Port,optional"`
+	// starttls, tls (implicit, usually port 465) or none. default is starttls
+	TLS string `yaotl:"TLS,optional"`
+	// skip the verification of the certificate of the server
+	Insecure bool   `yaotl:"Insecure,optional"`
+	Username string `yaotl:"Username,optional"`
+	Password string `yaotl:"Password,optional"`
+	From     string `yaotl:"From"`
+	// recipients of the events without a route of their own
+	To []string `yaotl:"To,optional"`
+	// text/template of the mails. they get the event (.Type, .Time,
+	// .Workspace, .Summary and .Data)
+	Subject string `yaotl:"Subject,optional"`
+	Body    string `yaotl:"Body,optional"`
+	// default is network.new, teamserver.error and killdate.imminent
+	Events []string           `yaotl:"Events,optional"`
+	Routes []WebHookSmtpRoute `yaotl:"Route,block"`
+}
+
+// WebHookSmtpRoute
+// recipients and templates of an event type, instead of the ones of the
+// smtp block.
+type WebHookSmtpRoute struct {
+	Event   string   `yaotl:"Event,label"`
+	To      []string `yaotl:"To"`
+	Subject string   `yaotl:"Subject,optional"`
+	Body    string   `yaotl:"Body,optional"`
+}
+
 type WebHookConfig struct {
 	Discord *WebHookDiscordConfig `yaotl:"Discord,block"`
+	// mails the critical events to the team
+	Smtp *WebHookSmtpConfig `yaotl:"Smtp,block"`
 }
 
 type BuildConfig struct {
@@ -30,22 +68,368 @@ type ServiceConfig struct {
 	Password string `yaotl:"Password"`
 }
 
+type ReplayConfig struct {
+	// how far back the history gets replayed to new operators (eg: "30m", "24h"). default is 24h
+	Window string `yaotl:"Window,optional"`
+}
+
+type KeepaliveConfig struct {
+	// how often the operator clients get pinged (eg: "30s"). default is 30s
+	Interval string `yaotl:"Interval,optional"`
+	// a client that doesn't answer for this long gets dropped. default is 90s
+	Timeout string `yaotl:"Timeout,optional"`
+	// how long a dropped client can resume its session with its reconnect token. default is 5m
+	Reconnect string `yaotl:"Reconnect,optional"`
+}
+
+type ProxyConfig struct {
+	// path the operator api gets served under (eg: "/a8f3c1"). the clients connect to <host>/<prefix>
+	PathPrefix string `yaotl:"PathPrefix,optional"`
+	// addresses or cidrs of the proxies whose forwarded headers are trusted (eg: "127.0.0.1", "173.245.48.0/20")
+	Trusted []string `yaotl:"Trusted,optional"`
+	// headers holding the address of the operator. default is X-Forwarded-For and X-Real-IP
+	Headers []string `yaotl:"Headers,optional"`
+	// serve plain http/ws. the proxy terminates tls
+	PlainHTTP bool `yaotl:"PlainHTTP,optional"`
+	// idle timeout of websockets of the proxy (eg: "100s" on cloudflare). operator clients get pinged more often
+	IdleTimeout string `yaotl:"IdleTimeout,optional"`
+}
+
+type BundlesConfig struct {
+	// base64 ed25519 public keys of teamservers whose bundles can be imported
+	Trusted []string `yaotl:"Trusted,optional"`
+}
+
+type OutputConfig struct {
+	// max bytes of a command output that get sent to the operators. default is 1 MiB
+	Limit int `yaotl:"Limit,optional"`
+}
+
+type BlocklistConfig struct {
+	Rules []BlockRuleConfig `yaotl:"Rule,block"`
+}
+
+type BlockRuleConfig struct {
+	Name string `yaotl:"Name,label"`
+	// comma separated commands the rule applies to (eg: "shell,proc"). empty applies to every command
+	Command string `yaotl:"Command,optional"`
+	// case insensitive regex matched against the command line (eg: "procdump.*lsass")
+	Pattern string `yaotl:"Pattern,optional"`
+	Reason  string `yaotl:"Reason,optional"`
+}
+
+type UploadsConfig struct {
+	Rules []UploadRuleConfig `yaotl:"Rule,block"`
+}
+
+type UploadRuleConfig struct {
+	Name string `yaotl:"Name,label"`
+	// "block" (default) or "approval"
+	Action string `yaotl:"Action,optional"`
+	// tool category the rule covers (eg: "ransomware simulator")
+	Category string `yaotl:"Category,optional"`
+	// md5, sha1 or sha256 hex digests of the files
+	Hashes []string `yaotl:"Hashes,optional"`
+	// case insensitive regex matched against the file name and the command line
+	Pattern string `yaotl:"Pattern,optional"`
+	// regex matched against the content of the file (eg: "(?i)your files have been encrypted")
+	Content string `yaotl:"Content,optional"`
+	Reason  string `yaotl:"Reason,optional"`
+}
+
+type SecretScanConfig struct {
+	// don't scan downloaded files and command output for secrets
+	Disabled bool `yaotl:"Disabled,optional"`
+	// bytes of a downloaded file that get scanned. default is 16 MiB
+	MaxSize int `yaotl:"MaxSize,optional"`
+	// only scan with the rules of the profile, not the built-in ones
+	NoDefaults bool               `yaotl:"NoDefaults,optional"`
+	Rules      []SecretRuleConfig `yaotl:"Rule,block"`
+}
+
+type TransparencyConfig struct {
+	// warn the operators about the hostnames publicly logged certificates of listeners disclose
+	Warn bool `yaotl:"Warn,optional"`
+	// domains whose newly logged certificates get reported
+	Domains []string `yaotl:"Domains,optional"`
+	// search of the logs returning json like crt.sh, {domain} is the domain. default is crt.sh
+	Monitor string `yaotl:"Monitor,optional"`
+	// polling interval of the monitor (eg: "30m"). default is 1h
+	Interval string `yaotl:"Interval,optional"`
+}
+
+type PrivilegesConfig struct {
+	// user the teamserver runs as once its listeners are bound
+	User string `yaotl:"User"`
+	// group to run as. default is the primary group of the user
+	Group string `yaotl:"Group,optional"`
+	// confine the teamserver to its working directory
+	Chroot bool `yaotl:"Chroot,optional"`
+}
+
+type SecretRuleConfig struct {
+	Name string `yaotl:"Name,label"`
+	// regex. the first group is the secret if it has groups
+	Pattern string `yaotl:"Pattern"`
+	// minimum shannon entropy (bits per character) of the secret
+	Entropy float64 `yaotl:"Entropy,optional"`
+}
+
+type ApprovalConfig struct {
+	// how long a task waits for its approval (eg: "30m", "2h"). default is 1h
+	Timeout string `yaotl:"Timeout,optional"`
+	// only admins approve tasks. by default every other operator can
+	AdminOnly bool                 `yaotl:"AdminOnly,optional"`
+	Rules     []ApprovalRuleConfig `yaotl:"Rule,block"`
+}
+
+type ApprovalRuleConfig struct {
+	Name string `yaotl:"Name,label"`
+	// comma separated commands the rule applies to (eg: "shell,exit")
+	Command string `yaotl:"Command,optional"`
+	// case insensitive regex matched against the command line
+	Pattern string `yaotl:"Pattern,optional"`
+	// case insensitive regex matched against the hostname of the agent (eg: "^dc[0-9]+")
+	Host   string `yaotl:"Host,optional"`
+	Reason string `yaotl:"Reason,optional"`
+}
+
+type BudgetConfig struct {
+	// listeners, pivots or transfers
+	Subsystem string `yaotl:"Subsystem,label"`
+	// hard caps of the subsystem. 0 means unlimited
+	Goroutines int `yaotl:"Goroutines,optional"`
+	Sockets    int `yaotl:"Sockets,optional"`
+	// bytes
+	Memory int `yaotl:"Memory,optional"`
+}
+
+type StorageConfig struct {
+	// secret the key sealing loot, credentials and transcripts at rest is derived from
+	Secret string `yaotl:"Secret,optional"`
+	// file holding the secret. keeps it out of the profile
+	SecretFile string `yaotl:"SecretFile,optional"`
+}
+
+type SyslogConfig struct {
+	// udp://host:514 or tcp://host:514. default is the syslog of the host
+	Address string `yaotl:"Address,optional"`
+	// default is havoc
+	Tag string `yaotl:"Tag,optional"`
+	// session.new, task.complete, loot.added and listener.down. default is every event
+	Events []string `yaotl:"Events,optional"`
+}
+
+type NatsConfig struct {
+	// nats://host:4222 or tls://host:4222. the next one is used when a server goes down
+	Servers []string `yaotl:"Servers"`
+	// events are published to <Subject>.<type> (eg: havoc.session.new). default is havoc
+	Subject  string `yaotl:"Subject,optional"`
+	User     string `yaotl:"User,optional"`
+	Password string `yaotl:"Password,optional"`
+	Token    string `yaotl:"Token,optional"`
+	TLS      bool   `yaotl:"TLS,optional"`
+	// pem file of the certificate authority of the servers
+	CACert string `yaotl:"CACert,optional"`
+	// default is every event
+	Events []string `yaotl:"Events,optional"`
+}
+
+type KafkaConfig struct {
+	// host:9092 of the brokers the metadata of the topic is looked up from
+	Brokers []string `yaotl:"Brokers"`
+	// default is havoc
+	Topic string `yaotl:"Topic,optional"`
+	// sasl plain
+	Username string `yaotl:"Username,optional"`
+	Password string `yaotl:"Password,optional"`
+	TLS      bool   `yaotl:"TLS,optional"`
+	// pem file of the certificate authority of the brokers
+	CACert string `yaotl:"CACert,optional"`
+	// default is every event
+	Events []string `yaotl:"Events,optional"`
+}
+
+type ServerCertConfig struct {
+	// path or pem content (eg: a keystore reference) of the certificate and its key
+	Cert string `yaotl:"Cert"`
+	Key  string `yaotl:"Key"`
+}
+
+type ManagementConfig struct {
+	// dedicated address of the operator api (eg: 127.0.0.1 or the ip of a vpn interface)
+	Host string `yaotl:"Host,optional"`
+	Port int    `yaotl:"Port,optional"`
+	// unix socket serving the operator api, guarded by its permissions (0660)
+	Socket string `yaotl:"Socket,optional"`
+	// certificate of the management address. default is the one of the teamserver
+	Cert *ServerCertConfig `yaotl:"Cert,block"`
+	// path or pem of the authorities the client certificates of the operators chain up to (mtls)
+	ClientCA string `yaotl:"ClientCA,optional"`
+}
+
+type VaultConfig struct {
+	// default is $VAULT_ADDR
+	Address string `yaotl:"Address,optional"`
+	// default is $VAULT_TOKEN or ~/.vault-token
+	Token string `yaotl:"Token,optional"`
+	// approle to log in with instead of a token
+	RoleID   string `yaotl:"RoleID,optional"`
+	SecretID string `yaotl:"SecretID,optional"`
+	// default is $VAULT_NAMESPACE
+	Namespace string `yaotl:"Namespace,optional"`
+	// default is $VAULT_CACERT
+	CACert string `yaotl:"CACert,optional"`
+}
+
+type KMSConfig struct {
+	// default is $AWS_REGION
+	Region string `yaotl:"Region,optional"`
+	// default is $AWS_ACCESS_KEY_ID, $AWS_SECRET_ACCESS_KEY and $AWS_SESSION_TOKEN
+	AccessKey    string `yaotl:"AccessKey,optional"`
+	SecretKey    string `yaotl:"SecretKey,optional"`
+	SessionToken string `yaotl:"SessionToken,optional"`
+	// default is https://kms.<region>.amazonaws.com
+	Endpoint string `yaotl:"Endpoint,optional"`
+}
+
+type AgeConfig struct {
+	// identities (AGE-SECRET-KEY-1...) or identity files the secrets are encrypted to
+	Identity []string `yaotl:"Identity,optional"`
+	// passphrase of secrets encrypted with age -p
+	Passphrase string `yaotl:"Passphrase,optional"`
+}
+
+// KeystoreConfig
+// where the references (vault://, awskms://, age://) in the profile
+// get resolved from at startup.
+type KeystoreConfig struct {
+	Vault *VaultConfig `yaotl:"Vault,block"`
+	KMS   *KMSConfig   `yaotl:"KMS,block"`
+	Age   *AgeConfig   `yaotl:"Age,block"`
+}
+
 type ServerProfile struct {
-	Host  string       `yaotl:"Host"`
-	Port  int          `yaotl:"Port"`
-	Build *BuildConfig `yaotl:"Build,block"`
+	Host      string           `yaotl:"Host"`
+	Port      int              `yaotl:"Port"`
+	Build     *BuildConfig     `yaotl:"Build,block"`
+	Replay    *ReplayConfig    `yaotl:"Replay,block"`
+	Keepalive *KeepaliveConfig `yaotl:"Keepalive,block"`
+	Proxy     *ProxyConfig     `yaotl:"Proxy,block"`
+	Bundles   *BundlesConfig   `yaotl:"Bundles,block"`
+	Output    *OutputConfig    `yaotl:"Output,block"`
+	Blocklist *BlocklistConfig `yaotl:"Blocklist,block"`
+	Uploads   *UploadsConfig   `yaotl:"Uploads,block"`
+	Approval  *ApprovalConfig  `yaotl:"Approval,block"`
+	Storage   *StorageConfig   `yaotl:"Storage,block"`
+	// certificate of the teamserver. randomly generated by default
+	Cert *ServerCertConfig `yaotl:"Cert,block"`
+	// operator api apart from the agent facing Host and Port
+	Management *ManagementConfig `yaotl:"Management,block"`
+	// query endpoint for engagement data (/havoc/graphql)
+	GraphQL bool `yaotl:"GraphQL,optional"`
+	// pprof and execution trace endpoints for admins (/havoc/debug/pprof/)
+	Pprof bool `yaotl:"Pprof,optional"`
+	// resource usage of the subsystems for admins (/havoc/metrics)
+	Metrics bool `yaotl:"Metrics,optional"`
+	// health of the teamserver in the browser for admins (/havoc/panel/)
+	Panel bool `yaotl:"Panel,optional"`
+	// request captures of the listeners for admins (/havoc/capture/<listener>)
+	Capture bool `yaotl:"Capture,optional"`
+	// snippets of the socks pivots for proxychains, ncat and ssh (/havoc/pivots/<format>)
+	Pivots bool `yaotl:"Pivots,optional"`
+	// local api the relay tools on the teamserver host push captured
+	// hashes and relayed sessions to (/havoc/ingest/)
+	Ingest  bool           `yaotl:"Ingest,optional"`
+	Budgets []BudgetConfig `yaotl:"Budget,block"`
+	// forwards the events of the teamserver to syslog
+	Syslog *SyslogConfig `yaotl:"Syslog,block"`
+	Nats   *NatsConfig   `yaotl:"Nats,block"`
+	Kafka  *KafkaConfig  `yaotl:"Kafka,block"`
+	// content scanning of loot and output for secrets
+	Secrets *SecretScanConfig `yaotl:"Secrets,block"`
+	// certificate transparency: what the certificates of the listeners
+	// disclose and a monitor of the logs for the engagement domains
+	Transparency *TransparencyConfig `yaotl:"Transparency,block"`
+	// drop root once the listeners are bound
+	Privileges *PrivilegesConfig `yaotl:"Privileges,block"`
 	// TODO: add WebSocket server config
 	// Path for Havoc connection
 	// TLS or not
 }
 
 type OperatorsBlock struct {
-	Users []UsersBlock `yaotl:"user,block"`
+	Users  []UsersBlock          `yaotl:"user,block"`
+	Policy *PasswordPolicyConfig `yaotl:"Policy,block"`
+	// operators of a directory (ldap, active directory) besides the users above
+	Ldap *LdapConfig `yaotl:"Ldap,block"`
+	// operators of an openid connect provider, logging in with its id tokens
+	Oidc *OidcConfig `yaotl:"Oidc,block"`
+}
+
+type LdapConfig struct {
+	// ldaps://dc01.corp.local or ldap://dc01.corp.local
+	Url string `yaotl:"Url"`
+	// upgrade ldap:// to tls
+	StartTLS bool `yaotl:"StartTLS,optional"`
+	// path of the certificate authority of the directory. default is the system pool
+	CACert   string `yaotl:"CACert,optional"`
+	Insecure bool   `yaotl:"Insecure,optional"`
+	// account searching the operators. anonymous if empty
+	BindDN       string `yaotl:"BindDN,optional"`
+	BindPassword string `yaotl:"BindPassword,optional"`
+	BaseDN       string `yaotl:"BaseDN"`
+	// attribute of the login name. default is sAMAccountName
+	UserAttribute string `yaotl:"UserAttribute,optional"`
+	// filter the operators additionally match (eg: "(objectClass=person)")
+	UserFilter string `yaotl:"UserFilter,optional"`
+	// search of the groups of an operator, {dn} is its dn. memberOf by default
+	GroupFilter string `yaotl:"GroupFilter,optional"`
+	// eg: "10s"
+	Timeout string            `yaotl:"Timeout,optional"`
+	Groups  []AuthGroupConfig `yaotl:"Group,block"`
+}
+
+type OidcConfig struct {
+	// issuer url as in the tokens (eg: https://login.corp.local/realms/red)
+	Issuer string `yaotl:"Issuer"`
+	// client id of the teamserver at the provider
+	ClientID string `yaotl:"ClientID"`
+	// claims with the name and the groups of the operator
+	UserClaim   string `yaotl:"UserClaim,optional"`
+	GroupsClaim string `yaotl:"GroupsClaim,optional"`
+	// path of the certificate authority of the provider. default is the system pool
+	CACert string            `yaotl:"CACert,optional"`
+	Groups []AuthGroupConfig `yaotl:"Group,block"`
+}
+
+// AuthGroupConfig
+// role and workspace of the operators of a group of the directory or the
+// provider. The first group of the profile an operator is in decides.
+type AuthGroupConfig struct {
+	Name      string `yaotl:"Name,label"`
+	Role      string `yaotl:"Role,optional"`
+	Workspace string `yaotl:"Workspace,optional"`
+}
+
+type PasswordPolicyConfig struct {
+	// minimum length of the passwords. default is 12
+	MinLength int `yaotl:"MinLength,optional"`
+	// character classes every password needs
+	Upper  bool `yaotl:"Upper,optional"`
+	Lower  bool `yaotl:"Lower,optional"`
+	Digit  bool `yaotl:"Digit,optional"`
+	Symbol bool `yaotl:"Symbol,optional"`
+	// refuse to start with plaintext passwords in the profile
+	RequireHash bool `yaotl:"RequireHash,optional"`
 }
 
 type UsersBlock struct {
-	Name     string `yaotl:"Name,label"`
-	Password string `yaotl:"Password"`
+	Name string `yaotl:"Name,label"`
+	// plaintext or argon2id hash ($argon2id$...) as --hash-passwords writes it
+	Password  string `yaotl:"Password"`
+	Role      string `yaotl:"Role,optional"`
+	Workspace string `yaotl:"Workspace,optional"`
 }
 
 type Listeners struct {
@@ -55,7 +439,8 @@ type Listeners struct {
 }
 
 type ListenerHTTP struct {
-	Name string `yaotl:"Name"`
+	Name      string `yaotl:"Name"`
+	Workspace string `yaotl:"Workspace,optional"`
 
 	// 2006-01-02 15:04:05
 	KillDate string `yaotl:"KillDate,optional"`
@@ -78,16 +463,27 @@ type ListenerHTTP struct {
 	Uris      []string `yaotl:"Uris,optional"`
 	Secure    bool     `yaotl:"Secure,optional"`
     HostHeader string  `yaotl:"HostHeader,optional"`
+	/* one Host header for each entry in Hosts (empty entries use HostHeader) */
+	HostHeaders []string `yaotl:"HostHeaders,optional"`
+	/* https listeners with server names share their port, they get the
+	   connections asking for one of their names (* for the ones no other
+	   listener claims) */
+	ServerNames []string `yaotl:"ServerNames,optional"`
 
 	/* optional sub blocks */
 	Cert     *ListenerHttpCerts    `yaotl:"Cert,block"`
 	Response *ListenerHttpResponse `yaotl:"Response,block"`
 	Proxy    *ListenerHttpProxy    `yaotl:"Proxy,block"`
+	Probe    *ListenerHttpProbe    `yaotl:"Probe,block"`
+	Capture  *ListenerHttpCapture  `yaotl:"Capture,block"`
+	Record   *ListenerHttpRecord   `yaotl:"Record,block"`
+	Chaos    *ListenerHttpChaos    `yaotl:"Chaos,block"`
 }
 
 type ListenerSMB struct {
-	Name     string `yaotl:"Name"`
-	PipeName string `yaotl:"PipeName"`
+	Name      string `yaotl:"Name"`
+	PipeName  string `yaotl:"PipeName"`
+	Workspace string `yaotl:"Workspace,optional"`
 
 	// 2006-01-02 15:04:05
 	KillDate string `yaotl:"KillDate,optional"`
@@ -96,19 +492,73 @@ type ListenerSMB struct {
 }
 
 type ListenerExternal struct {
-	Name     string `yaotl:"Name"`
-	Endpoint string `yaotl:"Endpoint"`
+	Name      string `yaotl:"Name"`
+	Endpoint  string `yaotl:"Endpoint"`
+	Workspace string `yaotl:"Workspace,optional"`
 }
 
 type ListenerHttpResponse struct {
 	Headers []string `yaotl:"Headers,optional"`
 }
 
+type ListenerHttpProbe struct {
+	// paths the health probes of the load balancer/uptime monitor request
+	Uris []string `yaotl:"Uris"`
+	// only answer probes with these user agents (substring) or from these ips/cidrs
+	UserAgents []string `yaotl:"UserAgents,optional"`
+	Sources    []string `yaotl:"Sources,optional"`
+
+	// 200 (default) or the status of the page at Url
+	Status  int      `yaotl:"Status,optional"`
+	Headers []string `yaotl:"Headers,optional"`
+	// content of the response. Url is fetched again every CacheTime seconds (default 300)
+	Body      string `yaotl:"Body,optional"`
+	File      string `yaotl:"File,optional"`
+	Url       string `yaotl:"Url,optional"`
+	CacheTime int    `yaotl:"CacheTime,optional"`
+}
+
+type ListenerHttpCapture struct {
+	// "ring" (default, in memory) or "files" (rotated in the folder of the listener)
+	Mode     string `yaotl:"Mode,optional"`
+	Entries  int    `yaotl:"Entries,optional"`
+	FileSize int    `yaotl:"FileSize,optional"`
+	Files    int    `yaotl:"Files,optional"`
+	MaxBody  int    `yaotl:"MaxBody,optional"`
+	// Authorization, Proxy-Authorization, Cookie and Set-Cookie are always redacted
+	Redact     []string `yaotl:"Redact,optional"`
+	RedactBody bool     `yaotl:"RedactBody,optional"`
+}
+
+type ListenerHttpRecord struct {
+	// Authorization, Cookie and the forwarded addresses are always dropped
+	Redact []string `yaotl:"Redact,optional"`
+}
+
+// only applied when the teamserver runs with --chaos
+type ListenerHttpChaos struct {
+	// percent of the requests dropped and of the responses cut short
+	Loss     int `yaotl:"Loss,optional"`
+	Truncate int `yaotl:"Truncate,optional"`
+	// delay of the responses plus up to Jitter ("500ms", "2s")
+	Latency string `yaotl:"Latency,optional"`
+	Jitter  string `yaotl:"Jitter,optional"`
+	// the listener goes down every Flap for Down ("10m", "30s")
+	Flap string `yaotl:"Flap,optional"`
+	Down string `yaotl:"Down,optional"`
+}
+
 type ListenerHttpProxy struct {
-	Host string `yaotl:"Host"`
-	Port int    `yaotl:"Port"`
-	User string `yaotl:"Username,optional"`
-	Pass string `yaotl:"Password,optional"`
+	// System (default if Host is empty), Explicit or Direct
+	Mode   string   `yaotl:"Mode,optional"`
+	Type   string   `yaotl:"Type,optional"`
+	Host   string   `yaotl:"Host,optional"`
+	Port   int      `yaotl:"Port,optional"`
+	User   string   `yaotl:"Username,optional"`
+	Pass   string   `yaotl:"Password,optional"`
+	// Basic or NTLM
+	Auth   string   `yaotl:"Auth,optional"`
+	Bypass []string `yaotl:"Bypass,optional"`
 }
 
 type ListenerHttpCerts struct {
@@ -152,4 +602,42 @@ type Demon struct {
 	Binary             *Binary                `yaotl:"Binary,block"`
 
 	TrustXForwardedFor bool                   `yaotl:"TrustXForwardedFor,optional"`
+
+	// max response size the demons get built with. for transports or proxies that can't take DEMON_MAX_RESPONSE_LENGTH
+	MaxResponse        int                    `yaotl:"MaxResponse,optional"`
+
+	Exfil              *ExfilConfig           `yaotl:"Exfil,block"`
+	Socks              *SocksConfig           `yaotl:"Socks,block"`
+	Inbound            *InboundConfig         `yaotl:"Inbound,block"`
+}
+
+type InboundConfig struct {
+	// bytes per second an agent is allowed to send on average. 0 is unlimited
+	Rate int `yaotl:"Rate,optional"`
+	// bytes an agent is allowed to send at once. default is 10 times the rate
+	Burst int `yaotl:"Burst,optional"`
+	// bytes an agent may exceed its burst by before its requests get dropped. default is the burst
+	Drop int `yaotl:"Drop,optional"`
+	// requests of an agent processed at the same time. more get refused. default is 2
+	Concurrent int `yaotl:"Concurrent,optional"`
+	// bytes per minute an agent has to send to alert the operators. 0 disables the alert
+	Alert int `yaotl:"Alert,optional"`
+}
+
+type SocksConfig struct {
+	// max bytes read from a socks client per socket write task. default is 64k
+	FrameSize int `yaotl:"FrameSize,optional"`
+	// max bytes per socks client waiting to be written by the agent. 0 is unlimited
+	Window int `yaotl:"Window,optional"`
+	// compress the frames (lznt1) for agents that support it
+	Compress bool `yaotl:"Compress,optional"`
+}
+
+type ExfilConfig struct {
+	// max bytes an agent is allowed to download per hour. 0 is unlimited
+	MaxPerHour int `yaotl:"MaxPerHour,optional"`
+	// time of the day (teamserver time) downloads are allowed (eg: "8:00-17:00")
+	Hours string `yaotl:"Hours,optional"`
+	// percent the agent randomly reduces the download chunk size by (0-90)
+	ChunkJitter int `yaotl:"ChunkJitter,optional"`
 }
@@ -0,0 +1,105 @@
+package profile
+
+import (
+	"reflect"
+	"strings"
+)
+
+// Effective
+// returns the config the teamserver runs with: the settings of the
+// profile (variables interpolated, keystore references resolved) merged
+// with the defaults of the settings it leaves out. In the json syntax of
+// the profile. Sensitive settings are redacted.
+func (p *Profile) Effective() map[string]any {
+	return effectiveObject(reflect.ValueOf(p.Config), "")
+}
+
+func effectiveObject(Value reflect.Value, Path string) map[string]any {
+	var Object = map[string]any{}
+
+	for _, Field := range schemaFields(Value.Type()) {
+		var (
+			FieldValue = Value.Field(Field.Index)
+			FieldPath  = strings.TrimPrefix(Path+"."+Field.Name, ".")
+			Rule       = schemaRules[FieldPath]
+		)
+
+		switch Field.Kind {
+
+		case "attr":
+			switch {
+			case !FieldValue.IsZero():
+				if Rule.Sensitive {
+					Object[Field.Name] = SCHEMA_REDACTED
+				} else {
+					Object[Field.Name] = FieldValue.Interface()
+				}
+
+			case Rule.Default != nil:
+				Object[Field.Name] = Rule.Default
+
+			case !Field.Optional:
+				Object[Field.Name] = FieldValue.Interface()
+			}
+
+		case "block":
+			var Block, Label = schemaBlock(FieldValue.Type())
+
+			switch FieldValue.Kind() {
+
+			case reflect.Pointer:
+				if !FieldValue.IsNil() {
+					Object[Field.Name] = effectiveObject(FieldValue.Elem(), FieldPath)
+				} else if Rule.Default != nil {
+					/* the subsystem runs with its defaults without the block */
+					Object[Field.Name] = effectiveObject(reflect.New(Block).Elem(), FieldPath)
+				}
+
+			case reflect.Slice:
+				if FieldValue.Len() == 0 {
+					continue
+				}
+
+				var (
+					Blocks   []any
+					Labelled = map[string]any{}
+				)
+
+				for i := 0; i < FieldValue.Len(); i++ {
+					var Item = FieldValue.Index(i)
+
+					if Item.Kind() == reflect.Pointer {
+						Item = Item.Elem()
+					}
+
+					if Label == nil {
+						Blocks = append(Blocks, effectiveObject(Item, FieldPath))
+						continue
+					}
+
+					/* blocks sharing a label turn into an array */
+					var Name = Item.Field(Label.Index).String()
+
+					switch Existing := Labelled[Name].(type) {
+					case nil:
+						Labelled[Name] = effectiveObject(Item, FieldPath)
+					case []any:
+						Labelled[Name] = append(Existing, effectiveObject(Item, FieldPath))
+					default:
+						Labelled[Name] = []any{Existing, effectiveObject(Item, FieldPath)}
+					}
+				}
+
+				if Label != nil {
+					Object[Field.Name] = Labelled
+				} else {
+					Object[Field.Name] = Blocks
+				}
+
+			}
+
+		}
+	}
+
+	return Object
+}
@@ -0,0 +1,362 @@
+package profile
+
+import (
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+
+	"Havoc/pkg/keystore"
+	"Havoc/pkg/logger"
+	"Havoc/pkg/profile/yaotl"
+	"Havoc/pkg/profile/yaotl/gohcl"
+	yaotl "Havoc/pkg/profile/yaotl/hclsimple"
+	"Havoc/pkg/profile/yaotl/hclsyntax"
+
+	"github.com/kylelemons/godebug/diff"
+	"github.com/zclconf/go-cty/cty"
+)
+
+// HashPasswords
+// replaces the plaintext operator passwords of the profile by their
+// argon2id hash, leaving the rest of the file (comments, layout) as is.
+// Passwords that interpolate variables or refer to a keystore are left
+// alone; store their hash at the source instead. Returns the count of
+// hashed passwords.
+func HashPasswords(Path, Secrets string) (int, error) {
+	var Config HavocConfig
+
+	Variables, err := variables(Secrets)
+	if err != nil {
+		return 0, err
+	}
+
+	/* policy of the passwords */
+	if err = yaotl.DecodeFile(Path, Variables, &Config); err != nil {
+		return 0, err
+	}
+
+	Source, err := os.ReadFile(Path)
+	if err != nil {
+		return 0, err
+	}
+
+	File, diags := hclsyntax.ParseConfig(Source, Path, hcl.Pos{Line: 1, Column: 1})
+	if diags.HasErrors() {
+		return 0, diags
+	}
+
+	var (
+		Count    = 0
+		Policy   *PasswordPolicyConfig
+		Replaced []hcl.Range
+		Hashes   []string
+	)
+
+	if Config.Operators != nil {
+		Policy = Config.Operators.Policy
+	}
+
+	for _, Operators := range File.Body.(*hclsyntax.Body).Blocks {
+		if Operators.Type != "Operators" {
+			continue
+		}
+
+		for _, User := range Operators.Body.Blocks {
+			var Attribute, ok = User.Body.Attributes["Password"]
+
+			if User.Type != "user" || !ok || len(User.Labels) == 0 {
+				continue
+			}
+
+			var Name = User.Labels[0]
+
+			if len(Attribute.Expr.Variables()) > 0 {
+				logger.Warn(fmt.Sprintf("Password of operator %v isn't a literal. Skipped", Name))
+				continue
+			}
+
+			Value, diags := Attribute.Expr.Value(nil)
+			if diags.HasErrors() || Value.Type() != cty.String || Value.IsNull() {
+				continue
+			}
+
+			var Password = Value.AsString()
+
+			if IsPasswordHash(Password) {
+				continue
+			}
+
+			if keystore.IsReference(Password) {
+				logger.Warn(fmt.Sprintf("Password of operator %v refers to a keystore. Skipped", Name))
+				continue
+			}
+
+			if err = CheckPassword(Policy, Password); err != nil {
+				return 0, fmt.Errorf("password of operator %v doesn't comply with the password policy: %v", Name, err)
+			}
+
+			Hash, err := HashPassword(Password)
+			if err != nil {
+				return 0, err
+			}
+
+			Replaced = append(Replaced, Attribute.Expr.Range())
+			Hashes = append(Hashes, Hash)
+			Count++
+		}
+	}
+
+	/* replace the literals only. the hash needs no escaping */
+	for i := len(Replaced) - 1; i >= 0; i-- {
+		Source = append(Source[:Replaced[i].Start.Byte], append([]byte(`"`+Hashes[i]+`"`), Source[Replaced[i].End.Byte:]...)...)
+	}
+
+	if Count == 0 {
+		return 0, nil
+	}
+
+	Info, err := os.Stat(Path)
+	if err != nil {
+		return 0, err
+	}
+
+	/* never leave a half written profile behind */
+	if err = os.WriteFile(Path+".tmp", Source, Info.Mode().Perm()); err != nil {
+		return 0, err
+	}
+
+	if err = os.Rename(Path+".tmp", Path); err != nil {
+		os.Remove(Path + ".tmp")
+		return 0, err
+	}
+
+	return Count, nil
+}
+
+// version of the profile format this teamserver reads. profiles
+// without a Version are the format of 0.7 (version 1)
+const PROFILE_VERSION = 2
+
+// Migration
+// change of the profile format between teamserver versions. Gets the
+// source of the profile and returns the migrated one, leaving the rest
+// of the file (comments, layout) as is.
+type Migration struct {
+	Version     int
+	Description string
+
+	migrate func(Source []byte, Body *hclsyntax.Body) ([]byte, error)
+}
+
+// add new changes of the format as a new migration at the end and bump
+// PROFILE_VERSION. never change a migration that has been released.
+var migrations = []Migration{
+	{
+		Version:     2,
+		Description: "record the version of the profile format",
+		migrate: func(Source []byte, Body *hclsyntax.Body) ([]byte, error) {
+			return Source, nil
+		},
+	},
+}
+
+// MigrationPlan
+// migrations of a profile and the changes they make to the file.
+type MigrationPlan struct {
+	From       int
+	To         int
+	Migrations []Migration
+	Diff       string
+}
+
+// Version
+// returns the version of the profile format of the file.
+func Version(Body *hclsyntax.Body) (int, error) {
+	var Attribute, ok = Body.Attributes["Version"]
+	if !ok {
+		return 1, nil
+	}
+
+	Value, diags := Attribute.Expr.Value(nil)
+	if diags.HasErrors() {
+		return 0, diags
+	}
+
+	if Value.Type() != cty.Number || Value.IsNull() {
+		return 0, fmt.Errorf("%v: Version of the profile isn't a number", Attribute.SrcRange)
+	}
+
+	Version, _ := Value.AsBigFloat().Int64()
+
+	return int(Version), nil
+}
+
+// Migrate
+// brings the profile up to the format of this teamserver. The migrated
+// profile has to load before it replaces the file, the old one is kept
+// as <profile>.v<version>.bak. With DryRun the file is left alone and
+// the plan shows what would change.
+func Migrate(Path, Secrets string, DryRun bool) (*MigrationPlan, error) {
+	var Plan = new(MigrationPlan)
+
+	/* written by hand. the structure is the same for every version */
+	if strings.HasSuffix(strings.ToLower(Path), ".json") {
+		return Plan, nil
+	}
+
+	Source, err := os.ReadFile(Path)
+	if err != nil {
+		return nil, err
+	}
+
+	File, diags := hclsyntax.ParseConfig(Source, Path, hcl.Pos{Line: 1, Column: 1})
+	if diags.HasErrors() {
+		return nil, diagnostics(diags)
+	}
+
+	if Plan.From, err = Version(File.Body.(*hclsyntax.Body)); err != nil {
+		return nil, err
+	}
+
+	Plan.To = Plan.From
+
+	if Plan.From > PROFILE_VERSION {
+		return nil, fmt.Errorf("the profile has format version %v, this teamserver only knows up to %v. upgrade the teamserver", Plan.From, PROFILE_VERSION)
+	}
+
+	var Migrated = Source
+
+	for _, Migration := range migrations {
+		if Migration.Version <= Plan.From {
+			continue
+		}
+
+		if Migrated, err = Migration.migrate(Migrated, File.Body.(*hclsyntax.Body)); err != nil {
+			return nil, fmt.Errorf("migration %v (%v) failed: %w", Migration.Version, Migration.Description, err)
+		}
+
+		if Migrated, err = setVersion(Migrated, Path, Migration.Version); err != nil {
+			return nil, err
+		}
+
+		/* the next migration works on the migrated file */
+		if File, diags = hclsyntax.ParseConfig(Migrated, Path, hcl.Pos{Line: 1, Column: 1}); diags.HasErrors() {
+			return nil, fmt.Errorf("migration %v (%v) broke the profile: %w", Migration.Version, Migration.Description, diagnostics(diags))
+		}
+
+		Plan.Migrations = append(Plan.Migrations, Migration)
+		Plan.To = Migration.Version
+	}
+
+	if len(Plan.Migrations) == 0 {
+		return Plan, nil
+	}
+
+	Plan.Diff = changes(diff.Diff(string(Source), string(Migrated)), 3)
+
+	/* rolled back if the migrated profile doesn't load */
+	if err = check(Migrated, Path, Secrets); err != nil {
+		return nil, fmt.Errorf("migrated profile doesn't load: %w", err)
+	}
+
+	if DryRun {
+		return Plan, nil
+	}
+
+	Info, err := os.Stat(Path)
+	if err != nil {
+		return nil, err
+	}
+
+	if err = os.WriteFile(fmt.Sprintf("%v.v%v.bak", Path, Plan.From), Source, Info.Mode().Perm()); err != nil {
+		return nil, fmt.Errorf("failed to back up the profile: %w", err)
+	}
+
+	/* never leave a half written profile behind */
+	if err = os.WriteFile(Path+".tmp", Migrated, Info.Mode().Perm()); err != nil {
+		return nil, err
+	}
+
+	if err = os.Rename(Path+".tmp", Path); err != nil {
+		os.Remove(Path + ".tmp")
+		return nil, err
+	}
+
+	return Plan, nil
+}
+
+// setVersion
+// sets the Version of the profile. Added on top of the file if it has none.
+func setVersion(Source []byte, Path string, Version int) ([]byte, error) {
+	File, diags := hclsyntax.ParseConfig(Source, Path, hcl.Pos{Line: 1, Column: 1})
+	if diags.HasErrors() {
+		return nil, diagnostics(diags)
+	}
+
+	var Value = []byte(strconv.Itoa(Version))
+
+	if Attribute, ok := File.Body.(*hclsyntax.Body).Attributes["Version"]; ok {
+		var Range = Attribute.Expr.Range()
+
+		return append(Source[:Range.Start.Byte:Range.Start.Byte], append(Value, Source[Range.End.Byte:]...)...), nil
+	}
+
+	return append([]byte("# version of the profile format\nVersion = "+string(Value)+"\n\n"), Source...), nil
+}
+
+// check
+// loads the source of a profile the way the teamserver does.
+func check(Source []byte, Path, Secrets string) error {
+	var Config HavocConfig
+
+	Variables, err := variables(Secrets)
+	if err != nil {
+		return err
+	}
+
+	File, diags := hclsyntax.ParseConfig(Source, Path, hcl.Pos{Line: 1, Column: 1})
+	if diags.HasErrors() {
+		return diagnostics(diags)
+	}
+
+	if diags = gohcl.DecodeBody(File.Body, Variables, &Config); diags.HasErrors() {
+		return diagnostics(diags)
+	}
+
+	if diags = validate(File.Body, Variables); diags.HasErrors() {
+		return diagnostics(diags)
+	}
+
+	return nil
+}
+
+// changes
+// returns the changed lines of the diff with the lines around them.
+func changes(Diff string, Context int) string {
+	var (
+		Lines  = strings.Split(Diff, "\n")
+		Keep   = make([]bool, len(Lines))
+		Output []string
+	)
+
+	for i, Line := range Lines {
+		if !strings.HasPrefix(Line, "+") && !strings.HasPrefix(Line, "-") {
+			continue
+		}
+
+		for j := max(0, i-Context); j <= min(len(Lines)-1, i+Context); j++ {
+			Keep[j] = true
+		}
+	}
+
+	for i, Line := range Lines {
+		if Keep[i] {
+			Output = append(Output, Line)
+		} else if i > 0 && Keep[i-1] {
+			Output = append(Output, "...")
+		}
+	}
+
+	return strings.Join(Output, "\n")
+}
@@ -0,0 +1,92 @@
+package profile
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+const testProfileV1 = `Teamserver {
+    Host = "0.0.0.0"
+    Port = 40056
+}
+
+Operators {
+    user "neo" {
+        Password = "correct horse battery"
+    }
+}
+`
+
+func TestMigrate(t *testing.T) {
+	var Path = filepath.Join(t.TempDir(), "havoc.yaotl")
+
+	if err := os.WriteFile(Path, []byte(testProfileV1), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	Plan, err := Migrate(Path, "", true)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if Plan.From != 1 || Plan.To != PROFILE_VERSION || !strings.Contains(Plan.Diff, "+Version = ") {
+		t.Fatalf("unexpected plan: %+v", Plan)
+	}
+
+	if Source, _ := os.ReadFile(Path); string(Source) != testProfileV1 {
+		t.Fatal("dry run changed the profile")
+	}
+
+	if _, err = Migrate(Path, "", false); err != nil {
+		t.Fatal(err)
+	}
+
+	if Backup, _ := os.ReadFile(Path + ".v1.bak"); string(Backup) != testProfileV1 {
+		t.Fatal("old profile isn't backed up")
+	}
+
+	if Plan, err = Migrate(Path, "", false); err != nil || len(Plan.Migrations) != 0 || Plan.From != PROFILE_VERSION {
+		t.Fatalf("migrated profile migrated again: %+v %v", Plan, err)
+	}
+
+	if err = NewProfile().SetProfile(Path, false); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestMigrateRollback(t *testing.T) {
+	var (
+		Path   = filepath.Join(t.TempDir(), "havoc.yaotl")
+		Broken = strings.Replace(testProfileV1, "40056", "70000", 1)
+	)
+
+	if err := os.WriteFile(Path, []byte(Broken), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := Migrate(Path, "", false); err == nil {
+		t.Fatal("profile that doesn't load got migrated")
+	}
+
+	if Source, _ := os.ReadFile(Path); string(Source) != Broken {
+		t.Fatal("failed migration changed the profile")
+	}
+
+	if _, err := os.Stat(Path + ".v1.bak"); !os.IsNotExist(err) {
+		t.Fatal("failed migration left a backup behind")
+	}
+}
+
+func TestMigrateNewer(t *testing.T) {
+	var Path = filepath.Join(t.TempDir(), "havoc.yaotl")
+
+	if err := os.WriteFile(Path, []byte("Version = 99\n\n"+testProfileV1), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := Migrate(Path, "", false); err == nil {
+		t.Fatal("profile of a newer teamserver got migrated")
+	}
+}
@@ -0,0 +1,250 @@
+package profile
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"strings"
+	"sync"
+	"unicode"
+
+	"golang.org/x/crypto/argon2"
+	"golang.org/x/crypto/sha3"
+)
+
+// argon2id parameters of new password hashes
+const (
+	PASSWORD_HASH_PREFIX = "$argon2id$"
+
+	PASSWORD_TIME    = 3
+	PASSWORD_MEMORY  = 64 * 1024
+	PASSWORD_THREADS = 4
+	PASSWORD_SALT    = 16
+	PASSWORD_KEY     = 32
+
+	// default minimum length of a password
+	PASSWORD_MIN_LENGTH = 12
+)
+
+// digests of passwords that have been verified against their argon2id
+// hash. basic auth endpoints verify every request.
+var verified sync.Map
+
+// PasswordDigest
+// returns the sha3-256 hex digest of the password. clients send the digest
+// instead of the password, so it is what the argon2id hash is taken from.
+func PasswordDigest(Password string) string {
+	var Hash = sha3.Sum256([]byte(Password))
+
+	return hex.EncodeToString(Hash[:])
+}
+
+// IsPasswordHash
+// returns true if the password of the profile is an argon2id hash.
+func IsPasswordHash(Password string) bool {
+	return strings.HasPrefix(Password, PASSWORD_HASH_PREFIX)
+}
+
+// HashPassword
+// returns the argon2id hash of the password in the PHC string format
+// ($argon2id$v=19$m=65536,t=3,p=4$<salt>$<hash>).
+func HashPassword(Password string) (string, error) {
+	var Salt = make([]byte, PASSWORD_SALT)
+
+	if _, err := rand.Read(Salt); err != nil {
+		return "", err
+	}
+
+	var Key = argon2.IDKey([]byte(PasswordDigest(Password)), Salt, PASSWORD_TIME, PASSWORD_MEMORY, PASSWORD_THREADS, PASSWORD_KEY)
+
+	return fmt.Sprintf("%vv=%v$m=%v,t=%v,p=%v$%v$%v",
+		PASSWORD_HASH_PREFIX, argon2.Version, PASSWORD_MEMORY, PASSWORD_TIME, PASSWORD_THREADS,
+		base64.RawStdEncoding.EncodeToString(Salt), base64.RawStdEncoding.EncodeToString(Key),
+	), nil
+}
+
+type passwordHash struct {
+	Memory  uint32
+	Time    uint32
+	Threads uint8
+	Salt    []byte
+	Key     []byte
+}
+
+func parsePasswordHash(Hash string) (*passwordHash, error) {
+	var (
+		Parts   = strings.Split(Hash, "$")
+		Version int
+		Parsed  = new(passwordHash)
+		err     error
+	)
+
+	/* "", "argon2id", "v=19", "m=..,t=..,p=..", salt, key */
+	if len(Parts) != 6 || Parts[1] != "argon2id" {
+		return nil, errors.New("not an argon2id hash")
+	}
+
+	if _, err = fmt.Sscanf(Parts[2], "v=%d", &Version); err != nil || Version != argon2.Version {
+		return nil, errors.New("unsupported argon2id version")
+	}
+
+	if _, err = fmt.Sscanf(Parts[3], "m=%d,t=%d,p=%d", &Parsed.Memory, &Parsed.Time, &Parsed.Threads); err != nil {
+		return nil, errors.New("invalid argon2id parameters")
+	}
+
+	if Parsed.Memory == 0 || Parsed.Time == 0 || Parsed.Threads == 0 || Parsed.Memory > 4*1024*1024 {
+		return nil, errors.New("invalid argon2id parameters")
+	}
+
+	if Parsed.Salt, err = base64.RawStdEncoding.Strict().DecodeString(Parts[4]); err != nil || len(Parsed.Salt) < 8 {
+		return nil, errors.New("invalid argon2id salt")
+	}
+
+	if Parsed.Key, err = base64.RawStdEncoding.Strict().DecodeString(Parts[5]); err != nil || len(Parsed.Key) < 16 {
+		return nil, errors.New("invalid argon2id hash")
+	}
+
+	return Parsed, nil
+}
+
+// verifyPassword
+// checks the digest (see PasswordDigest) against the password of the
+// profile, which is either plaintext or an argon2id hash.
+func verifyPassword(Password, Digest string) bool {
+	if !IsPasswordHash(Password) {
+		return subtle.ConstantTimeCompare([]byte(PasswordDigest(Password)), []byte(Digest)) == 1
+	}
+
+	var Verified = sha256.Sum256([]byte(Password + "\x00" + Digest))
+
+	if _, ok := verified.Load(Verified); ok {
+		return true
+	}
+
+	Hash, err := parsePasswordHash(Password)
+	if err != nil {
+		return false
+	}
+
+	var Key = argon2.IDKey([]byte(Digest), Hash.Salt, Hash.Time, Hash.Memory, Hash.Threads, uint32(len(Hash.Key)))
+
+	if subtle.ConstantTimeCompare(Key, Hash.Key) != 1 {
+		return false
+	}
+
+	verified.Store(Verified, true)
+
+	return true
+}
+
+// CheckPassword
+// returns an error if the password doesn't comply with the policy.
+func CheckPassword(Policy *PasswordPolicyConfig, Password string) error {
+	var (
+		MinLength = PASSWORD_MIN_LENGTH
+		Missing   []string
+
+		Upper, Lower, Digit, Symbol bool
+	)
+
+	if Policy != nil && Policy.MinLength > 0 {
+		MinLength = Policy.MinLength
+	}
+
+	if len([]rune(Password)) < MinLength {
+		return fmt.Errorf("shorter than %v characters", MinLength)
+	}
+
+	if Policy == nil {
+		return nil
+	}
+
+	for _, Char := range Password {
+		switch {
+		case unicode.IsUpper(Char):
+			Upper = true
+		case unicode.IsLower(Char):
+			Lower = true
+		case unicode.IsDigit(Char):
+			Digit = true
+		default:
+			Symbol = true
+		}
+	}
+
+	if Policy.Upper && !Upper {
+		Missing = append(Missing, "an upper case letter")
+	}
+
+	if Policy.Lower && !Lower {
+		Missing = append(Missing, "a lower case letter")
+	}
+
+	if Policy.Digit && !Digit {
+		Missing = append(Missing, "a digit")
+	}
+
+	if Policy.Symbol && !Symbol {
+		Missing = append(Missing, "a symbol")
+	}
+
+	if len(Missing) > 0 {
+		return errors.New("missing " + strings.Join(Missing, ", "))
+	}
+
+	return nil
+}
+
+// Authenticate
+// checks the password digest the operator sent (see PasswordDigest).
+func (p *Profile) Authenticate(Name, Digest string) bool {
+	if p.Config.Operators == nil {
+		return false
+	}
+
+	for _, user := range p.Config.Operators.Users {
+		if user.Name == Name {
+			return verifyPassword(user.Password, Digest)
+		}
+	}
+
+	return false
+}
+
+// checkPasswords
+// checks the operator passwords of the profile against the policy.
+// Passwords that are already hashed can't be checked anymore.
+func (p *Profile) checkPasswords() ([]string, error) {
+	var Plaintext []string
+
+	if p.Config.Operators == nil {
+		return nil, nil
+	}
+
+	var Policy = p.Config.Operators.Policy
+
+	for _, user := range p.Config.Operators.Users {
+		if IsPasswordHash(user.Password) {
+			if _, err := parsePasswordHash(user.Password); err != nil {
+				return nil, fmt.Errorf("password of operator %v: %v", user.Name, err)
+			}
+			continue
+		}
+
+		if err := CheckPassword(Policy, user.Password); err != nil {
+			return nil, fmt.Errorf("password of operator %v doesn't comply with the password policy: %v", user.Name, err)
+		}
+
+		Plaintext = append(Plaintext, user.Name)
+	}
+
+	if len(Plaintext) > 0 && Policy != nil && Policy.RequireHash {
+		return nil, fmt.Errorf("plaintext passwords of operators %v. hash them with --hash-passwords", strings.Join(Plaintext, ", "))
+	}
+
+	return Plaintext, nil
+}
@@ -1,13 +1,56 @@
 package profile
 
 import (
+	"errors"
+	"fmt"
+	"strings"
+	"sync"
+
 	"Havoc/pkg/colors"
+	"Havoc/pkg/keystore"
 	"Havoc/pkg/logger"
-	yaotl "Havoc/pkg/profile/yaotl/hclsimple"
+	"Havoc/pkg/profile/yaotl/gohcl"
+)
+
+const (
+	ROLE_OPERATOR = "Operator"
+
+	// ROLE_OBSERVER receives every event (sessions, output, chat)
+	// but isn't allowed to task agents or modify the teamserver.
+	ROLE_OBSERVER = "Observer"
+
+	// ROLE_ADMIN is an operator that also manages the rules of
+	// engagement of the teamserver (eg: the command blocklist).
+	ROLE_ADMIN = "Admin"
+
+	// ROLE_RELAY is the account a relay keeps its link to the teamserver
+	// with. The operators behind the relay authenticate on their own.
+	ROLE_RELAY = "Relay"
+)
+
+const (
+	// operators, listeners and agents without a workspace end up in here
+	WORKSPACE_DEFAULT = "default"
+
+	// operators in this workspace see and manage every workspace
+	WORKSPACE_ALL = "*"
 )
 
 type Profile struct {
 	Config HavocConfig
+
+	// file of the sensitive values the profile interpolates (${NAME}).
+	// keeps them out of profiles committed to version control
+	Secrets string
+
+	// role and workspace of the operators a directory or identity
+	// provider authenticated, they have no user block
+	identities sync.Map
+}
+
+type identity struct {
+	Role      string
+	Workspace string
 }
 
 func NewProfile() *Profile {
@@ -15,11 +58,42 @@ func NewProfile() *Profile {
 }
 
 func (p *Profile) SetProfile(path string, def bool) error {
-	err := yaotl.DecodeFile(path, nil, &p.Config)
+	Variables, err := variables(p.Secrets)
 	if err != nil {
 		return err
 	}
 
+	File, diags := parse(path)
+	if diags.HasErrors() {
+		return diagnostics(diags)
+	}
+
+	if diags = gohcl.DecodeBody(File.Body, Variables, &p.Config); diags.HasErrors() {
+		return diagnostics(diags)
+	}
+
+	/* constraints of the schema (ports, durations, roles, ...) */
+	if diags = validate(File.Body, Variables); diags.HasErrors() {
+		return diagnostics(diags)
+	}
+
+	for _, Warning := range diags {
+		logger.Warn(Warning.Error())
+	}
+
+	if err = p.resolveSecrets(); err != nil {
+		return err
+	}
+
+	Plaintext, err := p.checkPasswords()
+	if err != nil {
+		return err
+	}
+
+	if len(Plaintext) > 0 {
+		logger.Warn(fmt.Sprintf("Operators %v have plaintext passwords. Hash them with --hash-passwords", strings.Join(Plaintext, ", ")))
+	}
+
 	if def {
 		logger.Info("Use default profile")
 	} else {
@@ -29,6 +103,61 @@ func (p *Profile) SetProfile(path string, def bool) error {
 	return nil
 }
 
+// resolveSecrets
+// replaces the references to secrets in vault, aws kms or age encrypted
+// files (eg: Password = "vault://secret/havoc#neo") with the secrets.
+func (p *Profile) resolveSecrets() error {
+	var (
+		Config  = p.Config.Keystore
+		Options keystore.Options
+	)
+
+	if Config != nil {
+		if Config.Vault != nil {
+			Options.Vault = keystore.VaultOptions{
+				Address:   Config.Vault.Address,
+				Token:     Config.Vault.Token,
+				RoleID:    Config.Vault.RoleID,
+				SecretID:  Config.Vault.SecretID,
+				Namespace: Config.Vault.Namespace,
+				CACert:    Config.Vault.CACert,
+			}
+		}
+
+		if Config.KMS != nil {
+			Options.KMS = keystore.KMSOptions{
+				Region:       Config.KMS.Region,
+				AccessKey:    Config.KMS.AccessKey,
+				SecretKey:    Config.KMS.SecretKey,
+				SessionToken: Config.KMS.SessionToken,
+				Endpoint:     Config.KMS.Endpoint,
+			}
+		}
+
+		if Config.Age != nil {
+			Options.Age = keystore.AgeOptions{
+				Identities: Config.Age.Identity,
+				Passphrase: Config.Age.Passphrase,
+			}
+		}
+	}
+
+	/* the keystore block configures the keystores, it isn't resolved */
+	p.Config.Keystore = nil
+	defer func() { p.Config.Keystore = Config }()
+
+	Count, err := keystore.New(Options).ResolveAll(&p.Config)
+	if err != nil {
+		return errors.New("failed to resolve profile secret " + err.Error())
+	}
+
+	if Count > 0 {
+		logger.Info(fmt.Sprintf("Resolved %v profile secrets from the keystores", Count))
+	}
+
+	return nil
+}
+
 func (p *Profile) ServerHost() string {
 	if p.Config.Server != nil {
 		return p.Config.Server.Host
@@ -43,6 +172,72 @@ func (p *Profile) ServerPort() int {
 	return 0
 }
 
+// UserRole
+// returns the role of the operator. Defaults to ROLE_OPERATOR.
+func (p *Profile) UserRole(Name string) string {
+	if p.Config.Operators == nil {
+		return ROLE_OPERATOR
+	}
+
+	for _, user := range p.Config.Operators.Users {
+		if user.Name == Name {
+			return role(user.Role)
+		}
+	}
+
+	if Identity, ok := p.identities.Load(Name); ok {
+		return Identity.(identity).Role
+	}
+
+	return ROLE_OPERATOR
+}
+
+// UserWorkspace
+// returns the workspace of the operator. Defaults to WORKSPACE_DEFAULT.
+func (p *Profile) UserWorkspace(Name string) string {
+	if p.Config.Operators == nil {
+		return WORKSPACE_DEFAULT
+	}
+
+	for _, user := range p.Config.Operators.Users {
+		if user.Name == Name {
+			if len(user.Workspace) > 0 {
+				return user.Workspace
+			}
+			return WORKSPACE_DEFAULT
+		}
+	}
+
+	if Identity, ok := p.identities.Load(Name); ok {
+		return Identity.(identity).Workspace
+	}
+
+	return WORKSPACE_DEFAULT
+}
+
+// IdentitySet
+// sets the role and workspace of an operator that isn't a user of the
+// profile (authenticated by a directory or an identity provider).
+func (p *Profile) IdentitySet(Name, Role, Workspace string) {
+	if len(Workspace) == 0 {
+		Workspace = WORKSPACE_DEFAULT
+	}
+
+	p.identities.Store(Name, identity{Role: role(Role), Workspace: Workspace})
+}
+
+// role
+// the role of the profile by its name in any case. Defaults to ROLE_OPERATOR.
+func role(Name string) string {
+	for _, Role := range []string{ROLE_OBSERVER, ROLE_ADMIN, ROLE_RELAY} {
+		if strings.EqualFold(Name, Role) {
+			return Role
+		}
+	}
+
+	return ROLE_OPERATOR
+}
+
 func (p *Profile) ListOfUsernames() []string {
 	var Usernames []string
 
@@ -0,0 +1,384 @@
+package profile
+
+import (
+	"reflect"
+	"strings"
+)
+
+// draft of the published schema (profiles/havoc.schema.json)
+const SCHEMA_DRAFT = "https://json-schema.org/draft/2020-12/schema"
+
+// value of sensitive settings in the effective config
+const SCHEMA_REDACTED = "<redacted>"
+
+const (
+	schemaDuration = `^([0-9]+(\.[0-9]+)?(ns|us|µs|ms|s|m|h))+$`
+	schemaHours    = `^[0-9]{1,2}:[0-9]{2}-[0-9]{1,2}:[0-9]{2}$`
+	schemaDate     = `^[0-9]{4}-[0-9]{2}-[0-9]{2} [0-9]{2}:[0-9]{2}:[0-9]{2}$`
+)
+
+// schemaRule
+// constraints and default of a setting the structure of the profile
+// doesn't tell. Settings are addressed by the names of their blocks
+// without labels (eg: Listeners.Http.PortBind). A block with a default
+// is used by the teamserver even if the profile leaves it out.
+type schemaRule struct {
+	Description string
+
+	Enum    []string
+	Pattern string
+	Minimum *float64
+	Maximum *float64
+
+	Default any
+
+	// the teamserver falls back to a default instead of refusing the profile
+	Warn bool
+
+	// the teamserver matches the enum case insensitively
+	Fold bool
+
+	// redacted from the effective config
+	Sensitive bool
+}
+
+func limit(Value float64) *float64 {
+	return &Value
+}
+
+// the defaults mirror the ones of the subsystems using the settings
+var schemaRules = map[string]schemaRule{
+	"Version": {Description: "version of the profile format", Minimum: limit(1), Maximum: limit(PROFILE_VERSION)},
+
+	"Teamserver.Port": {Minimum: limit(1), Maximum: limit(65535)},
+
+	"Teamserver.Replay.Window": {Description: "how far back the history gets replayed to new operators", Pattern: schemaDuration, Default: "24h"},
+
+	"Teamserver.Keepalive":           {Default: struct{}{}},
+	"Teamserver.Keepalive.Interval":  {Description: "how often the operator clients get pinged", Pattern: schemaDuration, Default: "30s"},
+	"Teamserver.Keepalive.Timeout":   {Description: "a client that doesn't answer for this long gets dropped", Pattern: schemaDuration, Default: "90s"},
+	"Teamserver.Keepalive.Reconnect": {Description: "how long a dropped client can resume its session", Pattern: schemaDuration, Default: "5m"},
+
+	"Teamserver.Proxy.PathPrefix":  {Description: "path the operator api gets served under", Pattern: `^/?[A-Za-z0-9._~-]+(/[A-Za-z0-9._~-]+)*/?$`},
+	"Teamserver.Proxy.IdleTimeout": {Description: "idle timeout of websockets of the proxy", Pattern: schemaDuration, Default: "100s"},
+
+	"Teamserver.Output":       {Default: struct{}{}},
+	"Teamserver.Output.Limit": {Description: "max bytes of a command output that get sent to the operators", Minimum: limit(0), Default: 1024 * 1024},
+
+	"Teamserver.Uploads.Rule.Action": {Enum: []string{"block", "approval"}, Fold: true, Default: "block"},
+
+	"Teamserver.Approval.Timeout": {Description: "how long a task waits for its approval", Pattern: schemaDuration, Default: "1h"},
+
+	"Teamserver.Budget.Subsystem":  {Enum: []string{"listeners", "pivots", "transfers"}},
+	"Teamserver.Budget.Goroutines": {Minimum: limit(0)},
+	"Teamserver.Budget.Sockets":    {Minimum: limit(0)},
+	"Teamserver.Budget.Memory":     {Minimum: limit(0)},
+
+	"Teamserver.Storage.Secret": {Sensitive: true},
+
+	"Teamserver.Syslog.Tag":    {Default: "havoc"},
+	"Teamserver.Syslog.Events": {Enum: []string{"session.new", "task.complete", "loot.added", "credential.found", "listener.down", "listener.expired", "certificate.logged", "killdate.imminent", "network.new", "teamserver.error"}},
+
+	"Teamserver.Nats.Subject":  {Default: "havoc"},
+	"Teamserver.Nats.Password": {Sensitive: true},
+	"Teamserver.Nats.Token":    {Sensitive: true},
+	"Teamserver.Nats.Events":   {Enum: []string{"session.new", "task.complete", "loot.added", "credential.found", "listener.down", "listener.expired", "certificate.logged", "killdate.imminent", "network.new", "teamserver.error"}},
+
+	"Teamserver.Kafka.Topic":    {Default: "havoc"},
+	"Teamserver.Kafka.Password": {Sensitive: true},
+	"Teamserver.Kafka.Events":   {Enum: []string{"session.new", "task.complete", "loot.added", "credential.found", "listener.down", "listener.expired", "certificate.logged", "killdate.imminent", "network.new", "teamserver.error"}},
+
+	"Teamserver.Cert.Key": {Sensitive: true},
+
+	"Teamserver.Management.Port":     {Minimum: limit(1), Maximum: limit(65535)},
+	"Teamserver.Management.Cert.Key": {Sensitive: true},
+
+	"Teamserver.Transparency.Interval": {Pattern: schemaDuration, Default: "1h"},
+
+	"Teamserver.Secrets":              {Default: struct{}{}},
+	"Teamserver.Secrets.MaxSize":      {Description: "bytes of a downloaded file that get scanned", Minimum: limit(0), Default: 16 * 1024 * 1024},
+	"Teamserver.Secrets.Rule.Entropy": {Minimum: limit(0), Maximum: limit(8)},
+
+	"Operators.user.Password":    {Sensitive: true},
+	"Operators.user.Role":        {Enum: []string{ROLE_OPERATOR, ROLE_OBSERVER, ROLE_ADMIN, ROLE_RELAY}, Fold: true, Default: ROLE_OPERATOR},
+	"Operators.user.Workspace":   {Default: WORKSPACE_DEFAULT},
+	"Operators.Policy":           {Default: struct{}{}},
+	"Operators.Policy.MinLength": {Description: "minimum length of the passwords", Minimum: limit(0), Default: PASSWORD_MIN_LENGTH},
+
+	"Operators.Ldap.Url":             {Pattern: `^ldaps?://`},
+	"Operators.Ldap.BindPassword":    {Sensitive: true},
+	"Operators.Ldap.UserAttribute":   {Default: "sAMAccountName"},
+	"Operators.Ldap.Timeout":         {Pattern: schemaDuration, Default: "10s"},
+	"Operators.Ldap.Group.Role":      {Enum: []string{ROLE_OPERATOR, ROLE_OBSERVER, ROLE_ADMIN, ROLE_RELAY}, Fold: true, Default: ROLE_OPERATOR},
+	"Operators.Ldap.Group.Workspace": {Default: WORKSPACE_DEFAULT},
+	"Operators.Oidc.Issuer":          {Pattern: `^https://`},
+	"Operators.Oidc.UserClaim":       {Default: "preferred_username"},
+	"Operators.Oidc.GroupsClaim":     {Default: "groups"},
+	"Operators.Oidc.Group.Role":      {Enum: []string{ROLE_OPERATOR, ROLE_OBSERVER, ROLE_ADMIN, ROLE_RELAY}, Fold: true, Default: ROLE_OPERATOR},
+	"Operators.Oidc.Group.Workspace": {Default: WORKSPACE_DEFAULT},
+
+	"Listeners.Http.KillDate":        {Pattern: schemaDate},
+	"Listeners.Http.WorkingHours":    {Pattern: schemaHours},
+	"Listeners.Http.HostRotation":    {Enum: []string{"round-robin", "random", "failover"}, Warn: true},
+	"Listeners.Http.PortBind":        {Minimum: limit(1), Maximum: limit(65535)},
+	"Listeners.Http.PortConn":        {Minimum: limit(0), Maximum: limit(65535)},
+	"Listeners.Http.Workspace":       {Default: WORKSPACE_DEFAULT},
+	"Listeners.Http.Cert.Key":        {Sensitive: true},
+	"Listeners.Http.Probe.Status":    {Minimum: limit(100), Maximum: limit(599), Default: 200},
+	"Listeners.Http.Probe.CacheTime": {Minimum: limit(0), Default: 300},
+	"Listeners.Http.Capture.Mode":    {Enum: []string{"ring", "files"}, Fold: true, Default: "ring"},
+	"Listeners.Http.Chaos.Loss":      {Description: "percent of the requests dropped", Minimum: limit(0), Maximum: limit(100)},
+	"Listeners.Http.Chaos.Truncate":  {Description: "percent of the responses cut short", Minimum: limit(0), Maximum: limit(100)},
+	"Listeners.Http.Chaos.Latency":   {Pattern: schemaDuration},
+	"Listeners.Http.Chaos.Jitter":    {Pattern: schemaDuration},
+	"Listeners.Http.Chaos.Flap":      {Description: "how often the listener goes down", Pattern: schemaDuration},
+	"Listeners.Http.Chaos.Down":      {Description: "how long the listener stays down", Pattern: schemaDuration, Default: "30s"},
+	"Listeners.Http.Proxy.Mode":      {Enum: []string{"System", "Explicit", "Direct"}, Fold: true},
+	"Listeners.Http.Proxy.Port":      {Minimum: limit(0), Maximum: limit(65535)},
+	"Listeners.Http.Proxy.Password":  {Sensitive: true},
+	"Listeners.Http.Proxy.Auth":      {Enum: []string{"None", "Basic", "NTLM"}, Fold: true},
+
+	"Listeners.Smb.KillDate":     {Pattern: schemaDate},
+	"Listeners.Smb.WorkingHours": {Pattern: schemaHours},
+	"Listeners.Smb.Workspace":    {Default: WORKSPACE_DEFAULT},
+
+	"Listeners.External.Workspace": {Default: WORKSPACE_DEFAULT},
+
+	"Demon.Sleep":              {Minimum: limit(0)},
+	"Demon.Jitter":             {Minimum: limit(0), Maximum: limit(100)},
+	"Demon.MaxResponse":        {Minimum: limit(0)},
+	"Demon.Exfil.MaxPerHour":   {Minimum: limit(0)},
+	"Demon.Exfil.Hours":        {Pattern: schemaHours},
+	"Demon.Exfil.ChunkJitter":  {Minimum: limit(0), Maximum: limit(90)},
+	"Demon.Socks.FrameSize":    {Minimum: limit(0), Default: 64 * 1024},
+	"Demon.Socks.Window":       {Minimum: limit(0)},
+	"Demon.Inbound.Rate":       {Minimum: limit(0)},
+	"Demon.Inbound.Burst":      {Minimum: limit(0)},
+	"Demon.Inbound.Drop":       {Minimum: limit(0)},
+	"Demon.Inbound.Concurrent": {Minimum: limit(0), Default: 2},
+	"Demon.Inbound.Alert":      {Minimum: limit(0)},
+
+	"Service.Password": {Sensitive: true},
+
+	"WebHook.Discord.Url":      {Sensitive: true},
+	"WebHook.Smtp.Port":        {Minimum: limit(1), Maximum: limit(65535), Default: 587},
+	"WebHook.Smtp.TLS":         {Enum: []string{"starttls", "tls", "none"}, Fold: true, Default: "starttls"},
+	"WebHook.Smtp.Password":    {Sensitive: true},
+	"WebHook.Smtp.Events":      {Enum: []string{"session.new", "task.complete", "loot.added", "credential.found", "listener.down", "listener.expired", "certificate.logged", "killdate.imminent", "network.new", "teamserver.error"}},
+	"WebHook.Smtp.Route.Event": {Enum: []string{"session.new", "task.complete", "loot.added", "credential.found", "listener.down", "listener.expired", "certificate.logged", "killdate.imminent", "network.new", "teamserver.error"}},
+
+	"Keystore.Vault.Token":      {Sensitive: true},
+	"Keystore.Vault.SecretID":   {Sensitive: true},
+	"Keystore.KMS.SecretKey":    {Sensitive: true},
+	"Keystore.KMS.SessionToken": {Sensitive: true},
+	"Keystore.Age.Identity":     {Sensitive: true},
+	"Keystore.Age.Passphrase":   {Sensitive: true},
+}
+
+// schemaField
+// attribute, block or label of a struct of the profile.
+type schemaField struct {
+	Name     string
+	Kind     string
+	Optional bool
+	Index    int
+}
+
+// schemaFields
+// returns the fields of the struct by their yaotl tags.
+func schemaFields(Type reflect.Type) []schemaField {
+	var Fields []schemaField
+
+	for i := 0; i < Type.NumField(); i++ {
+		var Tag = Type.Field(i).Tag.Get("yaotl")
+
+		if len(Tag) == 0 {
+			continue
+		}
+
+		Name, Kind, _ := strings.Cut(Tag, ",")
+
+		switch Kind {
+		case "", "attr":
+			Fields = append(Fields, schemaField{Name: Name, Kind: "attr", Index: i})
+		case "optional":
+			Fields = append(Fields, schemaField{Name: Name, Kind: "attr", Optional: true, Index: i})
+		case "block", "label":
+			Fields = append(Fields, schemaField{Name: Name, Kind: Kind, Index: i})
+		}
+	}
+
+	return Fields
+}
+
+// schemaBlock
+// returns the struct type of a block field and its label (if it has one).
+func schemaBlock(Type reflect.Type) (reflect.Type, *schemaField) {
+	for Type.Kind() == reflect.Pointer || Type.Kind() == reflect.Slice {
+		Type = Type.Elem()
+	}
+
+	for _, Field := range schemaFields(Type) {
+		if Field.Kind == "label" {
+			return Type, &Field
+		}
+	}
+
+	return Type, nil
+}
+
+// Schema
+// returns the JSON Schema of the profile. Describes the json syntax of
+// the profile (*.json), the native syntax has the same structure.
+func Schema() map[string]any {
+	var Root = schemaObject(reflect.TypeOf(HavocConfig{}), "")
+
+	Root["$schema"] = SCHEMA_DRAFT
+	Root["title"] = "Havoc profile"
+	Root["description"] = "Profile of the Havoc teamserver. Repeated blocks are arrays, labeled blocks are objects keyed by their label."
+
+	return Root
+}
+
+func schemaObject(Type reflect.Type, Path string) map[string]any {
+	var (
+		Properties = map[string]any{}
+		Required   []string
+	)
+
+	for _, Field := range schemaFields(Type) {
+		var (
+			FieldType = Type.Field(Field.Index).Type
+			FieldPath = strings.TrimPrefix(Path+"."+Field.Name, ".")
+			Property  map[string]any
+		)
+
+		switch Field.Kind {
+
+		case "attr":
+			Property = schemaValue(FieldType)
+			schemaRules[FieldPath].annotate(Property)
+
+			if !Field.Optional {
+				Required = append(Required, Field.Name)
+			}
+
+		case "block":
+			var (
+				Block, Label = schemaBlock(FieldType)
+				Object       = schemaObject(Block, FieldPath)
+			)
+
+			if Description := schemaRules[FieldPath].Description; len(Description) > 0 {
+				Object["description"] = Description
+			}
+
+			switch {
+			case Label != nil:
+				var Names = map[string]any{"type": "string"}
+
+				schemaRules[FieldPath+"."+Label.Name].annotate(Names)
+				delete(Names, "default")
+
+				Property = map[string]any{
+					"type":                 "object",
+					"propertyNames":        Names,
+					"additionalProperties": schemaMany(Object),
+				}
+
+			case FieldType.Kind() == reflect.Slice:
+				Property = schemaMany(Object)
+
+			default:
+				Property = Object
+			}
+
+		default:
+			continue
+
+		}
+
+		Properties[Field.Name] = Property
+	}
+
+	var Object = map[string]any{
+		"type":                 "object",
+		"properties":           Properties,
+		"additionalProperties": false,
+	}
+
+	if len(Required) > 0 {
+		Object["required"] = Required
+	}
+
+	return Object
+}
+
+// schemaMany
+// a block that can be repeated is either a single object or an array of them.
+func schemaMany(Object map[string]any) map[string]any {
+	return map[string]any{
+		"anyOf": []any{
+			Object,
+			map[string]any{"type": "array", "items": Object},
+		},
+	}
+}
+
+func schemaValue(Type reflect.Type) map[string]any {
+	switch Type.Kind() {
+	case reflect.String:
+		return map[string]any{"type": "string"}
+	case reflect.Bool:
+		return map[string]any{"type": "boolean"}
+	case reflect.Int, reflect.Int32, reflect.Int64:
+		return map[string]any{"type": "integer"}
+	case reflect.Float32, reflect.Float64:
+		return map[string]any{"type": "number"}
+	case reflect.Slice:
+		return map[string]any{"type": "array", "items": schemaValue(Type.Elem())}
+	case reflect.Map:
+		return map[string]any{"type": "object", "additionalProperties": schemaValue(Type.Elem())}
+	}
+
+	return map[string]any{}
+}
+
+// annotate
+// adds the constraints of the rule to the schema of a value. The ones
+// of a list apply to its items.
+func (r schemaRule) annotate(Schema map[string]any) {
+	var Target = Schema
+
+	if Items, ok := Schema["items"].(map[string]any); ok {
+		Target = Items
+	}
+
+	if len(r.Description) > 0 {
+		Schema["description"] = r.Description
+	}
+
+	if len(r.Enum) > 0 {
+		Target["enum"] = r.Enum
+	}
+
+	if len(r.Pattern) > 0 {
+		Target["pattern"] = r.Pattern
+	}
+
+	if r.Minimum != nil {
+		Target["minimum"] = *r.Minimum
+	}
+
+	if r.Maximum != nil {
+		Target["maximum"] = *r.Maximum
+	}
+
+	if r.Default != nil {
+		Schema["default"] = r.Default
+	}
+
+	if r.Sensitive {
+		Schema["writeOnly"] = true
+	}
+}
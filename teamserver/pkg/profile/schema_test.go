@@ -0,0 +1,107 @@
+package profile
+
+import (
+	"bytes"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// regenerate with: havoc server --print-schema > profiles/havoc.schema.json
+func TestSchemaPublished(t *testing.T) {
+	Published, err := os.ReadFile("../../../profiles/havoc.schema.json")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var Buffer bytes.Buffer
+
+	Encoder := json.NewEncoder(&Buffer)
+	Encoder.SetEscapeHTML(false)
+	Encoder.SetIndent("", "  ")
+
+	if err = Encoder.Encode(Schema()); err != nil {
+		t.Fatal(err)
+	}
+
+	if !bytes.Equal(Published, Buffer.Bytes()) {
+		t.Fatal("profiles/havoc.schema.json is out of date")
+	}
+}
+
+func testProfile(t *testing.T, Name, Content string) (*Profile, error) {
+	var (
+		Path    = filepath.Join(t.TempDir(), Name)
+		Profile = NewProfile()
+	)
+
+	if err := os.WriteFile(Path, []byte(Content), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	return Profile, Profile.SetProfile(Path, false)
+}
+
+func TestValidatePositions(t *testing.T) {
+	_, err := testProfile(t, "bad.yaotl", `Teamserver {
+    Host = "0.0.0.0"
+    Port = 70000
+
+    Keepalive {
+        Interval = "30 seconds"
+    }
+}
+
+Operators {
+    user "neo" {
+        Password = "correct horse battery"
+        Role     = "Root"
+    }
+}
+`)
+	if err == nil {
+		t.Fatal("invalid profile got loaded")
+	}
+
+	for _, Expected := range []string{
+		"bad.yaotl:3,12-17: Invalid value of Teamserver.Port",
+		"bad.yaotl:6,20-32: Invalid value of Teamserver.Keepalive.Interval",
+		"bad.yaotl:13,20-26: Invalid value of Operators.user.Role",
+	} {
+		if !strings.Contains(err.Error(), Expected) {
+			t.Errorf("missing %q in:\n%v", Expected, err)
+		}
+	}
+}
+
+func TestEffective(t *testing.T) {
+	Profile, err := testProfile(t, "havoc.json", `{
+  "Teamserver": {"Host": "0.0.0.0", "Port": 40056, "Keepalive": {"Interval": "20s"}},
+  "Operators": {"user": {"neo": {"Password": "correct horse battery", "Role": "admin"}}}
+}`)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var Effective = Profile.Effective()
+
+	Keepalive := Effective["Teamserver"].(map[string]any)["Keepalive"].(map[string]any)
+	if Keepalive["Interval"] != "20s" || Keepalive["Timeout"] != "90s" {
+		t.Errorf("keepalive isn't merged with its defaults: %v", Keepalive)
+	}
+
+	if _, ok := Effective["Teamserver"].(map[string]any)["Output"]; !ok {
+		t.Error("output block used by default is missing")
+	}
+
+	User := Effective["Operators"].(map[string]any)["user"].(map[string]any)["neo"].(map[string]any)
+	if User["Password"] != SCHEMA_REDACTED {
+		t.Errorf("password isn't redacted: %v", User["Password"])
+	}
+
+	if User["Workspace"] != WORKSPACE_DEFAULT {
+		t.Errorf("workspace default is missing: %v", User["Workspace"])
+	}
+}
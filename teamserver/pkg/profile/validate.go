@@ -0,0 +1,190 @@
+package profile
+
+import (
+	"errors"
+	"fmt"
+	"math/big"
+	"reflect"
+	"regexp"
+	"strings"
+
+	"Havoc/pkg/profile/yaotl"
+	"Havoc/pkg/profile/yaotl/gohcl"
+	"Havoc/pkg/profile/yaotl/hclparse"
+
+	"github.com/zclconf/go-cty/cty"
+)
+
+// parse
+// parses the profile in the native (*.yaotl) or json (*.json) syntax.
+func parse(Path string) (*hcl.File, hcl.Diagnostics) {
+	var Parser = hclparse.NewParser()
+
+	if strings.HasSuffix(strings.ToLower(Path), ".json") {
+		return Parser.ParseJSONFile(Path)
+	}
+
+	return Parser.ParseHCLFile(Path)
+}
+
+// diagnostics
+// returns every error of the profile with its position, one per line.
+func diagnostics(Diags hcl.Diagnostics) error {
+	var Errors []error
+
+	for _, Diag := range Diags {
+		if Diag.Severity == hcl.DiagError {
+			Errors = append(Errors, Diag)
+		}
+	}
+
+	return errors.Join(Errors...)
+}
+
+// validate
+// checks the settings of the profile against the constraints of the
+// schema. The structure (unknown settings, types) is already checked
+// by decoding it. Settings the teamserver falls back to a default for
+// are reported as warnings.
+func validate(Body hcl.Body, Variables *hcl.EvalContext) hcl.Diagnostics {
+	return validateBody(Body, reflect.TypeOf(HavocConfig{}), "", Variables)
+}
+
+func validateBody(Body hcl.Body, Type reflect.Type, Path string, Variables *hcl.EvalContext) hcl.Diagnostics {
+	var Diags hcl.Diagnostics
+
+	BodySchema, _ := gohcl.ImpliedBodySchema(reflect.New(Type).Interface())
+
+	/* errors of the structure got reported by the decoder */
+	Content, _, _ := Body.PartialContent(BodySchema)
+
+	for _, Field := range schemaFields(Type) {
+		var FieldPath = strings.TrimPrefix(Path+"."+Field.Name, ".")
+
+		switch Field.Kind {
+
+		case "attr":
+			var Attribute, ok = Content.Attributes[Field.Name]
+			if !ok {
+				continue
+			}
+
+			Rule, ok := schemaRules[FieldPath]
+			if !ok {
+				continue
+			}
+
+			Value, diags := Attribute.Expr.Value(Variables)
+			if diags.HasErrors() {
+				continue
+			}
+
+			Diags = append(Diags, Rule.check(FieldPath, Value, Attribute.Expr.Range())...)
+
+		case "block":
+			var Block, Label = schemaBlock(Type.Field(Field.Index).Type)
+
+			for _, Nested := range Content.Blocks.OfType(Field.Name) {
+				if Label != nil && len(Nested.Labels) > 0 {
+					if Rule, ok := schemaRules[FieldPath+"."+Label.Name]; ok {
+						Diags = append(Diags, Rule.check(FieldPath+"."+Label.Name, cty.StringVal(Nested.Labels[0]), Nested.LabelRanges[0])...)
+					}
+				}
+
+				Diags = append(Diags, validateBody(Nested.Body, Block, FieldPath, Variables)...)
+			}
+
+		}
+	}
+
+	return Diags
+}
+
+// check
+// returns the constraints of the rule the value (or the items of a
+// list) violates.
+func (r schemaRule) check(Path string, Value cty.Value, Range hcl.Range) hcl.Diagnostics {
+	var (
+		Diags    hcl.Diagnostics
+		Severity = hcl.DiagError
+	)
+
+	if r.Warn {
+		Severity = hcl.DiagWarning
+	}
+
+	if Value.IsNull() || !Value.IsKnown() {
+		return nil
+	}
+
+	if Value.Type().IsListType() || Value.Type().IsTupleType() || Value.Type().IsSetType() {
+		for it := Value.ElementIterator(); it.Next(); {
+			_, Item := it.Element()
+			Diags = append(Diags, r.check(Path, Item, Range)...)
+		}
+
+		return Diags
+	}
+
+	var violated = func(Detail string) {
+		Diags = append(Diags, &hcl.Diagnostic{
+			Severity: Severity,
+			Summary:  "Invalid value of " + Path,
+			Detail:   Detail,
+			Subject:  Range.Ptr(),
+		})
+	}
+
+	switch Value.Type() {
+
+	case cty.String:
+		var Text = Value.AsString()
+
+		/* empty is the same as leaving it out */
+		if len(Text) == 0 {
+			return nil
+		}
+
+		if len(r.Enum) > 0 {
+			var Found bool
+
+			for _, Allowed := range r.Enum {
+				if Allowed == Text || (r.Fold && strings.EqualFold(Allowed, Text)) {
+					Found = true
+					break
+				}
+			}
+
+			if !Found {
+				violated(fmt.Sprintf("%q isn't one of %v.", Text, strings.Join(r.Enum, ", ")))
+			}
+		}
+
+		if len(r.Pattern) > 0 && !regexp.MustCompile(r.Pattern).MatchString(Text) {
+			switch r.Pattern {
+			case schemaDuration:
+				violated(fmt.Sprintf("%q isn't a duration (eg: \"90s\", \"5m\", \"1h30m\").", Text))
+			case schemaHours:
+				violated(fmt.Sprintf("%q isn't a time range (eg: \"8:00-17:00\").", Text))
+			case schemaDate:
+				violated(fmt.Sprintf("%q isn't a date (eg: \"2006-01-02 15:04:05\").", Text))
+			default:
+				violated(fmt.Sprintf("%q doesn't match %v.", Text, r.Pattern))
+			}
+		}
+
+	case cty.Number:
+		var Number = Value.AsBigFloat()
+
+		if r.Minimum != nil && Number.Cmp(big.NewFloat(*r.Minimum)) < 0 {
+			violated(fmt.Sprintf("%v is less than %v.", Number.String(), *r.Minimum))
+		}
+
+		if r.Maximum != nil && Number.Cmp(big.NewFloat(*r.Maximum)) > 0 {
+			violated(fmt.Sprintf("%v is more than %v.", Number.String(), *r.Maximum))
+		}
+
+	}
+
+	return Diags
+}
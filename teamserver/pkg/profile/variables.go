@@ -0,0 +1,98 @@
+package profile
+
+import (
+	"fmt"
+	"os"
+	"strings"
+
+	"Havoc/pkg/logger"
+	"Havoc/pkg/profile/yaotl"
+	"Havoc/pkg/profile/yaotl/hclsyntax"
+
+	"github.com/zclconf/go-cty/cty"
+	"github.com/zclconf/go-cty/cty/convert"
+)
+
+// variables
+// returns the variables the profile interpolates (eg: Password = "${NEO_PASSWORD}").
+// The values of the secrets file take precedence over the environment.
+func variables(Secrets string) (*hcl.EvalContext, error) {
+	var Context = &hcl.EvalContext{
+		Variables: make(map[string]cty.Value),
+	}
+
+	for _, Variable := range os.Environ() {
+		Name, Value, _ := strings.Cut(Variable, "=")
+
+		/* names like ProgramFiles(x86) can't be referenced */
+		if hclsyntax.ValidIdentifier(Name) {
+			Context.Variables[Name] = cty.StringVal(Value)
+		}
+	}
+
+	if len(Secrets) == 0 {
+		return Context, nil
+	}
+
+	Values, err := secrets(Secrets, Context)
+	if err != nil {
+		return nil, err
+	}
+
+	for Name, Value := range Values {
+		Context.Variables[Name] = Value
+	}
+
+	logger.Info(fmt.Sprintf("Loaded %v profile secrets from %v", len(Values), Secrets))
+
+	return Context, nil
+}
+
+// secrets
+// parses the secrets file. It holds string attributes only, which can
+// themselves interpolate environment variables:
+//
+//	NEO_PASSWORD = "password1234"
+//	SERVER_KEY   = "vault://secret/data/havoc#server_key"
+func secrets(Path string, Context *hcl.EvalContext) (map[string]cty.Value, error) {
+	Info, err := os.Stat(Path)
+	if err != nil {
+		return nil, err
+	}
+
+	if Info.Mode().Perm()&0077 != 0 {
+		logger.Warn(fmt.Sprintf("Profile secrets file %v is accessible by other users (%v)", Path, Info.Mode().Perm()))
+	}
+
+	Source, err := os.ReadFile(Path)
+	if err != nil {
+		return nil, err
+	}
+
+	File, diags := hclsyntax.ParseConfig(Source, Path, hcl.Pos{Line: 1, Column: 1})
+	if diags.HasErrors() {
+		return nil, diags
+	}
+
+	Attributes, diags := File.Body.JustAttributes()
+	if diags.HasErrors() {
+		return nil, diags
+	}
+
+	var Values = make(map[string]cty.Value, len(Attributes))
+
+	for Name, Attribute := range Attributes {
+		Value, diags := Attribute.Expr.Value(Context)
+		if diags.HasErrors() {
+			return nil, diags
+		}
+
+		if Value, err = convert.Convert(Value, cty.String); err != nil || Value.IsNull() {
+			return nil, fmt.Errorf("%v: secret %v has to be a string", Attribute.NameRange, Name)
+		}
+
+		Values[Name] = Value
+	}
+
+	return Values, nil
+}
@@ -0,0 +1,424 @@
+package relay
+
+import (
+	"crypto/rand"
+	"crypto/tls"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"net/http/httputil"
+	"net/url"
+	"sync"
+	"time"
+
+	"Havoc/pkg/agent"
+	"Havoc/pkg/common/certs"
+	"Havoc/pkg/logger"
+	"Havoc/pkg/packager"
+	"Havoc/pkg/profile"
+
+	"github.com/gorilla/websocket"
+)
+
+const (
+	// how long the relay waits before it connects to the teamserver again
+	RELAY_RETRY_MIN = time.Second
+	RELAY_RETRY_MAX = time.Minute
+
+	// how often the clients get pinged
+	RELAY_PING = 30 * time.Second
+
+	// the link gets dropped if the teamserver neither pings nor sends anything for this long
+	RELAY_LINK_TIMEOUT = 3 * time.Minute
+)
+
+// Config
+// where the relay listens for operator clients and the teamserver it
+// keeps its link to.
+type Config struct {
+	// address the operator clients connect to (eg: 0.0.0.0:40056)
+	Listen string
+
+	// teamserver (host:port) and the account with the Relay role the link authenticates with
+	Teamserver string
+	User       string
+	Password   string
+
+	// path prefix of the operator api of the teamserver behind a cdn or reverse proxy (eg: /a8f3c1). served under the same prefix
+	Prefix string
+
+	// sha256 fingerprint (hex) of the certificate of the teamserver. not verified if empty
+	Fingerprint string
+
+	// certificate the relay serves (path or pem). randomly generated by default
+	Cert string
+	Key  string
+}
+
+// Relay
+// keeps a single authenticated link to the teamserver and multiplexes
+// the operator clients connected to it over the link. The operators
+// still authenticate with their own credentials, the relay only passes
+// their packages on.
+type Relay struct {
+	Config Config
+
+	link    *websocket.Conn
+	linkMtx sync.Mutex
+
+	clients sync.Map // map[string]*client
+}
+
+// client
+// operator client connected to the relay.
+type client struct {
+	Connection *websocket.Conn
+	Mutex      sync.Mutex
+}
+
+func NewRelay(Config Config) *Relay {
+	return &Relay{Config: Config}
+}
+
+// Run
+// serves the operator clients and keeps the link to the teamserver up.
+// Only returns if the relay failed to listen.
+func (r *Relay) Run() error {
+	var (
+		Certificate tls.Certificate
+		Proxy       *httputil.ReverseProxy
+		Router      = http.NewServeMux()
+		Listener    net.Listener
+		err         error
+	)
+
+	if len(r.Config.Cert) > 0 {
+		if Certificate, err = certs.KeyPair(r.Config.Cert, r.Config.Key); err != nil {
+			return fmt.Errorf("failed to load the certificate: %w", err)
+		}
+	} else {
+		Host, _, _ := net.SplitHostPort(r.Config.Listen)
+
+		Cert, Key, err := certs.HTTPSGenerateRSACertificate(Host)
+		if err != nil {
+			return fmt.Errorf("failed to generate a certificate: %w", err)
+		}
+
+		if Certificate, err = tls.X509KeyPair(Cert, Key); err != nil {
+			return err
+		}
+	}
+
+	/* files too big for the websocket get fetched over http. passed on as is, the operator authenticates on its own */
+	Proxy = httputil.NewSingleHostReverseProxy(&url.URL{Scheme: "https", Host: r.Config.Teamserver})
+	Proxy.Transport = &http.Transport{TLSClientConfig: certs.Pinned(r.Config.Fingerprint)}
+
+	Router.Handle(r.Config.Prefix+agent.TRANSFER_ENDPOINT, Proxy)
+	Router.HandleFunc(r.Config.Prefix+"/havoc/", r.handleClient)
+
+	if Listener, err = tls.Listen("tcp", r.Config.Listen, &tls.Config{Certificates: []tls.Certificate{Certificate}}); err != nil {
+		return err
+	}
+
+	go r.keepLink()
+
+	logger.Info("Relay listening on " + r.Config.Listen + " for " + r.Config.Teamserver)
+
+	return http.Serve(Listener, Router)
+}
+
+// keepLink
+// connects to the teamserver and reconnects with a growing delay every
+// time the link drops.
+func (r *Relay) keepLink() {
+	var Retry = RELAY_RETRY_MIN
+
+	for {
+		var Started = time.Now()
+
+		if err := r.connect(); err != nil {
+			logger.Error("Relay link to " + r.Config.Teamserver + " failed: " + err.Error())
+		} else {
+			logger.Info("Relay link to " + r.Config.Teamserver + " established")
+			r.forward()
+		}
+
+		/* a link that held for a while starts over with the shortest delay */
+		if time.Since(Started) > RELAY_RETRY_MAX {
+			Retry = RELAY_RETRY_MIN
+		}
+
+		logger.Info(fmt.Sprintf("Connecting to the teamserver again in %v", Retry))
+		time.Sleep(Retry)
+
+		if Retry *= 2; Retry > RELAY_RETRY_MAX {
+			Retry = RELAY_RETRY_MAX
+		}
+	}
+}
+
+// connect
+// dials the teamserver and authenticates the link.
+func (r *Relay) connect() error {
+	var (
+		Dialer = websocket.Dialer{
+			HandshakeTimeout: 30 * time.Second,
+			TLSClientConfig:  certs.Pinned(r.Config.Fingerprint),
+		}
+		Authenticated packager.Package
+	)
+
+	Link, _, err := Dialer.Dial("wss://"+r.Config.Teamserver+r.Config.Prefix+"/havoc/", nil)
+	if err != nil {
+		return err
+	}
+
+	err = writeJSON(Link, packager.Package{
+		Head: packager.Head{
+			Event: packager.Type.InitConnection.Type,
+			User:  r.Config.User,
+			Time:  time.Now().Format("02/01/2006 15:04:05"),
+		},
+		Body: packager.Body{
+			SubEvent: packager.Type.InitConnection.OAuthRequest,
+			Info: map[string]any{
+				"User":     r.Config.User,
+				"Password": profile.PasswordDigest(r.Config.Password),
+			},
+		},
+	})
+	if err != nil {
+		Link.Close()
+		return err
+	}
+
+	Link.SetReadDeadline(time.Now().Add(30 * time.Second))
+
+	if err = Link.ReadJSON(&Authenticated); err != nil {
+		Link.Close()
+		return err
+	}
+
+	if Authenticated.Head.Event != packager.Type.InitConnection.Type || Authenticated.Body.SubEvent != packager.Type.InitConnection.Success {
+		Link.Close()
+		return fmt.Errorf("teamserver refused the relay %v: %v", r.Config.User, Authenticated.Body.Info["Message"])
+	}
+
+	if Role, _ := Authenticated.Body.Info["Role"].(string); Role != profile.ROLE_RELAY {
+		Link.Close()
+		return fmt.Errorf("account %v doesn't have the %v role", r.Config.User, profile.ROLE_RELAY)
+	}
+
+	r.linkMtx.Lock()
+	r.link = Link
+	r.linkMtx.Unlock()
+
+	return nil
+}
+
+// forward
+// passes the packages of the teamserver on to the clients till the
+// link drops. Drops every client once it did.
+func (r *Relay) forward() {
+	var (
+		Link = r.link
+		Done = make(chan struct{})
+	)
+
+	defer func() {
+		close(Done)
+
+		r.linkMtx.Lock()
+		r.link = nil
+		r.linkMtx.Unlock()
+
+		Link.Close()
+
+		r.clients.Range(func(key, value any) bool {
+			value.(*client).Connection.Close()
+			r.clients.Delete(key)
+			return true
+		})
+	}()
+
+	/* the teamserver pings the link. a link it stopped pinging is half-open */
+	Link.SetReadDeadline(time.Now().Add(RELAY_LINK_TIMEOUT))
+	Link.SetPingHandler(func(Data string) error {
+		Link.SetReadDeadline(time.Now().Add(RELAY_LINK_TIMEOUT))
+
+		err := Link.WriteControl(websocket.PongMessage, []byte(Data), time.Now().Add(RELAY_PING))
+		if errors.Is(err, websocket.ErrCloseSent) {
+			return nil
+		}
+
+		return err
+	})
+
+	go r.ping(Done)
+
+	for {
+		var Package packager.Package
+
+		if err := Link.ReadJSON(&Package); err != nil {
+			logger.Warn("Relay link dropped: " + err.Error())
+			return
+		}
+
+		Link.SetReadDeadline(time.Now().Add(RELAY_LINK_TIMEOUT))
+
+		if Package.Head.Event != packager.Type.Relay.Type {
+			continue
+		}
+
+		var (
+			ClientID, _ = Package.Body.Info["ClientID"].(string)
+			Data, _     = Package.Body.Info["Package"].(string)
+		)
+
+		value, ok := r.clients.Load(ClientID)
+		if !ok {
+			continue
+		}
+
+		var Client = value.(*client)
+
+		switch Package.Body.SubEvent {
+
+		case packager.Type.Relay.Message:
+			Client.Mutex.Lock()
+			Client.Connection.SetWriteDeadline(time.Now().Add(RELAY_PING))
+			err := Client.Connection.WriteMessage(websocket.BinaryMessage, []byte(Data))
+			Client.Mutex.Unlock()
+
+			if err != nil {
+				logger.Debug("Failed to write to client " + ClientID + ": " + err.Error())
+				Client.Connection.Close()
+			}
+
+		case packager.Type.Relay.Disconnect:
+			r.clients.Delete(ClientID)
+			Client.Connection.Close()
+
+		}
+	}
+}
+
+// ping
+// pings the clients of the relay till the link drops. Clients that
+// stopped answering get dropped by their read deadline.
+func (r *Relay) ping(Done chan struct{}) {
+	var Ticker = time.NewTicker(RELAY_PING)
+	defer Ticker.Stop()
+
+	for {
+		select {
+		case <-Done:
+			return
+
+		case <-Ticker.C:
+			r.clients.Range(func(key, value any) bool {
+				go value.(*client).Connection.WriteControl(websocket.PingMessage, nil, time.Now().Add(RELAY_PING))
+				return true
+			})
+		}
+	}
+}
+
+// send
+// sends a package of the client over the link.
+func (r *Relay) send(SubEvent int, ClientID string, Data []byte) error {
+	r.linkMtx.Lock()
+	defer r.linkMtx.Unlock()
+
+	if r.link == nil {
+		return errors.New("no link to the teamserver")
+	}
+
+	r.link.SetWriteDeadline(time.Now().Add(RELAY_PING))
+
+	return writeJSON(r.link, packager.Package{
+		Head: packager.Head{
+			Event: packager.Type.Relay.Type,
+			User:  r.Config.User,
+			Time:  time.Now().Format("02/01/2006 15:04:05"),
+		},
+		Body: packager.Body{
+			SubEvent: SubEvent,
+			Info: map[string]any{
+				"ClientID": ClientID,
+				"Package":  string(Data),
+			},
+		},
+	})
+}
+
+// handleClient
+// accepts an operator client and passes its packages on to the
+// teamserver. The first package is the login of the operator.
+func (r *Relay) handleClient(w http.ResponseWriter, req *http.Request) {
+	var (
+		upgrade  websocket.Upgrader
+		ClientID = randomID()
+		Client   = &client{}
+		err      error
+	)
+
+	if Client.Connection, err = upgrade.Upgrade(w, req, nil); err != nil {
+		logger.Error("Failed upgrading request: " + err.Error())
+		return
+	}
+
+	defer Client.Connection.Close()
+
+	Client.Connection.SetReadDeadline(time.Now().Add(3 * RELAY_PING))
+	Client.Connection.SetPongHandler(func(string) error {
+		return Client.Connection.SetReadDeadline(time.Now().Add(3 * RELAY_PING))
+	})
+
+	r.clients.Store(ClientID, Client)
+
+	logger.Info("Client " + ClientID + " connected from " + req.RemoteAddr)
+
+	for SubEvent := packager.Type.Relay.Connect; ; SubEvent = packager.Type.Relay.Message {
+		_, Data, err := Client.Connection.ReadMessage()
+		if err != nil {
+			break
+		}
+
+		Client.Connection.SetReadDeadline(time.Now().Add(3 * RELAY_PING))
+
+		if err = r.send(SubEvent, ClientID, Data); err != nil {
+			logger.Warn("Failed to relay the package of client " + ClientID + ": " + err.Error())
+			break
+		}
+	}
+
+	/* still known if the teamserver didn't drop it */
+	if _, ok := r.clients.LoadAndDelete(ClientID); ok {
+		r.send(packager.Type.Relay.Disconnect, ClientID, nil)
+	}
+
+	logger.Info("Client " + ClientID + " disconnected")
+}
+
+func writeJSON(Connection *websocket.Conn, Package packager.Package) error {
+	Data, err := json.Marshal(Package)
+	if err != nil {
+		return err
+	}
+
+	return Connection.WriteMessage(websocket.BinaryMessage, Data)
+}
+
+// randomID
+// returns a random id for a client of the relay.
+func randomID() string {
+	var Random = make([]byte, 8)
+
+	_, _ = rand.Read(Random)
+
+	return hex.EncodeToString(Random)
+}
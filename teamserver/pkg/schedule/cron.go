@@ -0,0 +1,216 @@
+package schedule
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// shortest interval of an @every schedule
+const MIN_INTERVAL = time.Minute
+
+// Schedule
+// decides when a recurring job runs next.
+type Schedule interface {
+	// Next returns the first time the job runs after the given time
+	Next(After time.Time) time.Time
+}
+
+// Every
+// runs at a fixed interval (@every 30m).
+type Every time.Duration
+
+func (e Every) Next(After time.Time) time.Time {
+	return After.Add(time.Duration(e))
+}
+
+// Cron
+// runs at the minutes the fields of a cron expression match.
+type Cron struct {
+	Minute  uint64
+	Hour    uint64
+	Day     uint64
+	Month   uint64
+	Weekday uint64
+
+	// the day or the weekday is restricted. runs if either of them matches then
+	anyDay     bool
+	anyWeekday bool
+}
+
+// bounds of the fields of a cron expression
+var fields = []struct {
+	Name     string
+	Min, Max int
+}{
+	{"minute", 0, 59},
+	{"hour", 0, 23},
+	{"day of month", 1, 31},
+	{"month", 1, 12},
+	{"day of week", 0, 7},
+}
+
+var shortcuts = map[string]string{
+	"@hourly":  "0 * * * *",
+	"@daily":   "0 0 * * *",
+	"@weekly":  "0 0 * * 0",
+	"@monthly": "0 0 1 * *",
+}
+
+// Parse
+// parses a cron expression (minute hour day month weekday, eg:
+// "*/30 8-17 * * 1-5"), a shortcut (@hourly, @daily, @weekly,
+// @monthly) or an interval (@every 10m).
+func Parse(Spec string) (Schedule, error) {
+	var Cron = new(Cron)
+
+	Spec = strings.TrimSpace(Spec)
+
+	if Interval, ok := strings.CutPrefix(Spec, "@every "); ok {
+		Duration, err := time.ParseDuration(strings.TrimSpace(Interval))
+		if err != nil {
+			return nil, errors.New("invalid interval: " + Interval)
+		}
+
+		if Duration < MIN_INTERVAL {
+			return nil, fmt.Errorf("interval has to be at least %v", MIN_INTERVAL)
+		}
+
+		return Every(Duration), nil
+	}
+
+	if Expression, ok := shortcuts[Spec]; ok {
+		Spec = Expression
+	}
+
+	var Fields = strings.Fields(Spec)
+
+	if len(Fields) != len(fields) {
+		return nil, errors.New("cron expression needs 5 fields: minute hour day month weekday")
+	}
+
+	var Bits = []*uint64{&Cron.Minute, &Cron.Hour, &Cron.Day, &Cron.Month, &Cron.Weekday}
+
+	for i, Field := range Fields {
+		var err error
+
+		if *Bits[i], err = parseField(Field, fields[i].Min, fields[i].Max); err != nil {
+			return nil, fmt.Errorf("invalid %v %q: %v", fields[i].Name, Field, err)
+		}
+	}
+
+	/* 7 is sunday too */
+	if Cron.Weekday&(1<<7) != 0 {
+		Cron.Weekday |= 1
+	}
+
+	Cron.anyDay = Fields[2] == "*"
+	Cron.anyWeekday = Fields[4] == "*"
+
+	return Cron, nil
+}
+
+// parseField
+// parses a list of values, ranges (a-b), steps (*/n, a-b/n) or *.
+func parseField(Field string, Min, Max int) (uint64, error) {
+	var Bits uint64
+
+	for _, Part := range strings.Split(Field, ",") {
+		var (
+			Range, Step, Stepped = strings.Cut(Part, "/")
+			Start, End           = Min, Max
+			Increment            = 1
+			err                  error
+		)
+
+		if Stepped {
+			if Increment, err = strconv.Atoi(Step); err != nil || Increment <= 0 {
+				return 0, errors.New("invalid step " + Step)
+			}
+		}
+
+		if Range != "*" {
+			First, Last, IsRange := strings.Cut(Range, "-")
+
+			if Start, err = strconv.Atoi(First); err != nil {
+				return 0, errors.New("invalid value " + First)
+			}
+
+			End = Start
+
+			if IsRange {
+				if End, err = strconv.Atoi(Last); err != nil {
+					return 0, errors.New("invalid value " + Last)
+				}
+			} else if Stepped {
+				/* a/n runs from a to the end */
+				End = Max
+			}
+		}
+
+		if Start < Min || End > Max || Start > End {
+			return 0, fmt.Errorf("out of range %v-%v", Min, Max)
+		}
+
+		for Value := Start; Value <= End; Value += Increment {
+			Bits |= 1 << uint(Value)
+		}
+	}
+
+	return Bits, nil
+}
+
+func (c *Cron) day(Time time.Time) bool {
+	var (
+		Day     = c.Day&(1<<uint(Time.Day())) != 0
+		Weekday = c.Weekday&(1<<uint(Time.Weekday())) != 0
+	)
+
+	switch {
+	case c.anyDay && c.anyWeekday:
+		return true
+	case c.anyDay:
+		return Weekday
+	case c.anyWeekday:
+		return Day
+	}
+
+	return Day || Weekday
+}
+
+func (c *Cron) Next(After time.Time) time.Time {
+	var (
+		Time  = After.Truncate(time.Minute).Add(time.Minute)
+		Limit = Time.AddDate(5, 0, 0)
+	)
+
+	/* skip whole months, days and hours that don't match */
+	for Time.Before(Limit) {
+		if c.Month&(1<<uint(Time.Month())) == 0 {
+			Time = time.Date(Time.Year(), Time.Month()+1, 1, 0, 0, 0, 0, Time.Location())
+			continue
+		}
+
+		if !c.day(Time) {
+			Time = time.Date(Time.Year(), Time.Month(), Time.Day()+1, 0, 0, 0, 0, Time.Location())
+			continue
+		}
+
+		if c.Hour&(1<<uint(Time.Hour())) == 0 {
+			Time = time.Date(Time.Year(), Time.Month(), Time.Day(), Time.Hour()+1, 0, 0, 0, Time.Location())
+			continue
+		}
+
+		if c.Minute&(1<<uint(Time.Minute())) == 0 {
+			Time = Time.Add(time.Minute)
+			continue
+		}
+
+		return Time
+	}
+
+	/* never matches (eg: 30th of february) */
+	return time.Time{}
+}
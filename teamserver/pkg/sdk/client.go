@@ -0,0 +1,338 @@
+// Package sdk
+// talks to the teamserver the way the operator client does, so bots and
+// custom tooling don't have to reimplement the packet format.
+//
+//	Client := sdk.New(sdk.Config{
+//		Address:  "127.0.0.1:40056",
+//		User:     "bot",
+//		Password: "password1234",
+//	})
+//
+//	Client.OnAgent(func(Agent sdk.Agent) {
+//		go func() {
+//			TaskID, _ := Client.Shell(Agent.ID, "whoami")
+//			Output, _ := Client.Await(context.Background(), TaskID)
+//			fmt.Println(Output.Output)
+//		}()
+//	})
+//
+//	if err := Client.Connect(); err != nil {
+//		return err
+//	}
+//	defer Client.Close()
+//
+//	return Client.Wait()
+//
+// The teamserver replays its state (agents, listeners, history) after
+// the login, so handlers subscribed before Connect get called for what
+// happened before too. Handlers get called one after the other from the
+// connection, block them and no other package gets read.
+package sdk
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+
+	"Havoc/pkg/common/certs"
+	"Havoc/pkg/packager"
+	"Havoc/pkg/profile"
+
+	"github.com/gorilla/websocket"
+)
+
+// how long the login to the teamserver may take by default
+const LOGIN_TIMEOUT = 30 * time.Second
+
+// outputs of a task Await keeps till it gets called
+const TASK_OUTPUTS = 16
+
+// Config
+// the teamserver the client connects to and the account it logs in with.
+type Config struct {
+	// host:port of the teamserver or of a relay
+	Address string
+
+	User     string
+	Password string
+
+	// id token of the identity provider of the teamserver, for operators of the provider
+	Token string
+
+	// the account is one of the directory of the teamserver, which needs the
+	// password in the clear. Only use it with the fingerprint
+	Directory bool
+
+	// path prefix of the operator api behind a cdn or reverse proxy (eg: /a8f3c1)
+	Prefix string
+
+	// sha256 fingerprint (hex) of the certificate of the teamserver. not verified if empty
+	Fingerprint string
+
+	// how long the login may take (default LOGIN_TIMEOUT)
+	Timeout time.Duration
+}
+
+// Handler
+// gets called with every package of the subscribed event.
+type Handler func(Package packager.Package)
+
+type subscription struct {
+	ID      int
+	Event   int
+	Handler Handler
+}
+
+// Client
+// an authenticated session on the teamserver.
+type Client struct {
+	Config Config
+
+	// role and workspace the teamserver gave the account
+	Role      string
+	Workspace string
+
+	connection *websocket.Conn
+	writeMtx   sync.Mutex
+
+	mutex         sync.Mutex
+	subscriptions []subscription
+	nextID        int
+	agents        map[string]*Agent
+	tasks         map[string]chan Output
+
+	done chan struct{}
+	err  error
+}
+
+// New
+// returns a client of the teamserver. Subscribe to the packages of
+// interest before connecting it.
+func New(Config Config) *Client {
+	if Config.Timeout <= 0 {
+		Config.Timeout = LOGIN_TIMEOUT
+	}
+
+	return &Client{
+		Config: Config,
+		agents: make(map[string]*Agent),
+		tasks:  make(map[string]chan Output),
+		done:   make(chan struct{}),
+	}
+}
+
+// Connect
+// dials the teamserver and logs in. Packages are dispatched to the
+// handlers from then on till the connection drops.
+func (c *Client) Connect() error {
+	if err := c.login(); err != nil {
+		return err
+	}
+
+	go c.read()
+
+	return nil
+}
+
+// login
+// dials the teamserver and authenticates with the digest of the password,
+// the password itself for the directory or the token of the identity provider.
+func (c *Client) login() error {
+	var (
+		Dialer = websocket.Dialer{
+			HandshakeTimeout: c.Config.Timeout,
+			TLSClientConfig:  certs.Pinned(c.Config.Fingerprint),
+		}
+		Authenticated packager.Package
+		Info          = map[string]any{
+			"User":     c.Config.User,
+			"Password": profile.PasswordDigest(c.Config.Password),
+		}
+	)
+
+	if c.Config.Directory {
+		Info["Secret"] = c.Config.Password
+	}
+
+	if len(c.Config.Token) > 0 {
+		Info["Token"] = c.Config.Token
+	}
+
+	Connection, _, err := Dialer.Dial("wss://"+c.Config.Address+c.Config.Prefix+"/havoc/", nil)
+	if err != nil {
+		return err
+	}
+
+	c.connection = Connection
+
+	err = c.Send(packager.Type.InitConnection.Type, packager.Type.InitConnection.OAuthRequest, Info)
+	if err != nil {
+		Connection.Close()
+		return err
+	}
+
+	Connection.SetReadDeadline(time.Now().Add(c.Config.Timeout))
+
+	if err = Connection.ReadJSON(&Authenticated); err != nil {
+		Connection.Close()
+		return err
+	}
+
+	Connection.SetReadDeadline(time.Time{})
+
+	if Authenticated.Head.Event != packager.Type.InitConnection.Type || Authenticated.Body.SubEvent != packager.Type.InitConnection.Success {
+		Connection.Close()
+		return fmt.Errorf("teamserver refused %v: %v", c.Config.User, Authenticated.Body.Info["Message"])
+	}
+
+	c.Role, _ = Authenticated.Body.Info["Role"].(string)
+	c.Workspace, _ = Authenticated.Body.Info["Workspace"].(string)
+
+	/* operators of the identity provider are named by their token */
+	if User, ok := Authenticated.Body.Info["User"].(string); ok && len(User) > 0 {
+		c.Config.User = User
+	}
+
+	return nil
+}
+
+// Send
+// sends a package to the teamserver. The teamserver sets the user and
+// the workspace of the package itself.
+func (c *Client) Send(Event, SubEvent int, Info map[string]any) error {
+	Data, err := json.Marshal(packager.Package{
+		Head: packager.Head{
+			Event: Event,
+			User:  c.Config.User,
+			Time:  time.Now().Format("02/01/2006 15:04:05"),
+		},
+		Body: packager.Body{
+			SubEvent: SubEvent,
+			Info:     Info,
+		},
+	})
+	if err != nil {
+		return err
+	}
+
+	if c.connection == nil {
+		return errNotConnected
+	}
+
+	c.writeMtx.Lock()
+	defer c.writeMtx.Unlock()
+
+	return c.connection.WriteMessage(websocket.BinaryMessage, Data)
+}
+
+// Subscribe
+// calls the handler with every package of the event (packager.Type.*.Type)
+// the teamserver sends. An Event of 0 subscribes to every package.
+// Returns the function that cancels the subscription.
+func (c *Client) Subscribe(Event int, Handler Handler) func() {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	var ID = c.nextID
+	c.nextID++
+
+	c.subscriptions = append(c.subscriptions, subscription{ID: ID, Event: Event, Handler: Handler})
+
+	return func() {
+		c.mutex.Lock()
+		defer c.mutex.Unlock()
+
+		for i := range c.subscriptions {
+			if c.subscriptions[i].ID == ID {
+				c.subscriptions = append(c.subscriptions[:i], c.subscriptions[i+1:]...)
+				break
+			}
+		}
+	}
+}
+
+// read
+// reads the packages of the teamserver till the connection drops and
+// hands them to the handlers subscribed to them.
+func (c *Client) read() {
+	defer close(c.done)
+
+	for {
+		var Package packager.Package
+
+		if err := c.connection.ReadJSON(&Package); err != nil {
+			c.mutex.Lock()
+			if c.err == nil {
+				c.err = err
+			}
+			c.mutex.Unlock()
+
+			return
+		}
+
+		if Package.Head.Event == packager.Type.Session.Type {
+			c.session(Package)
+		}
+
+		c.mutex.Lock()
+		var Subscriptions = append([]subscription(nil), c.subscriptions...)
+		c.mutex.Unlock()
+
+		for _, Subscription := range Subscriptions {
+			if Subscription.Event == 0 || Subscription.Event == Package.Head.Event {
+				Subscription.Handler(Package)
+			}
+		}
+	}
+}
+
+// Wait
+// blocks till the connection to the teamserver drops or the client
+// gets closed. Returns nil if it got closed.
+func (c *Client) Wait() error {
+	<-c.done
+
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	if errors.Is(c.err, errClosed) {
+		return nil
+	}
+
+	return c.err
+}
+
+// Done
+// closed once the connection to the teamserver dropped.
+func (c *Client) Done() <-chan struct{} {
+	return c.done
+}
+
+// Close
+// logs out of the teamserver.
+func (c *Client) Close() error {
+	if c.connection == nil {
+		return errNotConnected
+	}
+
+	c.mutex.Lock()
+	if c.err == nil {
+		c.err = errClosed
+	}
+	c.mutex.Unlock()
+
+	c.writeMtx.Lock()
+	c.connection.WriteControl(websocket.CloseMessage, websocket.FormatCloseMessage(websocket.CloseNormalClosure, ""), time.Now().Add(time.Second))
+	c.writeMtx.Unlock()
+
+	return c.connection.Close()
+}
+
+var (
+	// returned by Wait after the client got closed
+	errClosed = errors.New("client closed")
+
+	errNotConnected = errors.New("not connected to the teamserver")
+)
@@ -0,0 +1,173 @@
+package sdk
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"strings"
+
+	"Havoc/pkg/packager"
+)
+
+// Alert
+// an event of the teamserver the operator gets notified of (eg: a new
+// agent, a listener down or an agent reaching its kill date).
+type Alert struct {
+	Type      string
+	Time      string
+	Workspace string
+	// critical alerts are never muted or held back
+	Critical bool
+	Summary  string
+	Data     map[string]any
+}
+
+// NotifyPreferences
+// what the operator wants to be notified of and when, stored on the
+// teamserver. Alerts that aren't critical are held back while Digest is
+// set (eg: 1h) or during the QuietHours (eg: 22:00-07:00 in TimeZone)
+// and delivered together as a digest. With Groups the operator only gets
+// notified of the agents of these agent groups.
+type NotifyPreferences struct {
+	Muted      []string
+	Digest     string
+	QuietHours string
+	TimeZone   string
+	Groups     []string
+}
+
+// OnAlert
+// calls the handler with every alert the teamserver notifies the
+// operator of right away.
+func (c *Client) OnAlert(Handler func(Alert Alert)) func() {
+	return c.Subscribe(packager.Type.Notification.Type, func(Package packager.Package) {
+		if Package.Body.SubEvent != packager.Type.Notification.Alert {
+			return
+		}
+
+		var Alert Alert
+
+		if decode(Package.Body.Info["Alert"], &Alert) == nil {
+			Handler(Alert)
+		}
+	})
+}
+
+// OnDigest
+// calls the handler with the alerts held back for the operator by its
+// digest or its quiet hours. Dropped is the number of alerts that didn't
+// fit into the digest.
+func (c *Client) OnDigest(Handler func(Alerts []Alert, Dropped int)) func() {
+	return c.Subscribe(packager.Type.Notification.Type, func(Package packager.Package) {
+		if Package.Body.SubEvent != packager.Type.Notification.Digest {
+			return
+		}
+
+		var (
+			Alerts  []Alert
+			Dropped int
+		)
+
+		if decode(Package.Body.Info["Alerts"], &Alerts) != nil {
+			return
+		}
+
+		decode(Package.Body.Info["Dropped"], &Dropped)
+
+		Handler(Alerts, Dropped)
+	})
+}
+
+// NotifyPreferences
+// returns the notification preferences of the operator.
+func (c *Client) NotifyPreferences(ctx context.Context) (NotifyPreferences, error) {
+	return c.notifyPreferences(ctx, packager.Type.Notification.Preferences, nil)
+}
+
+// SetNotifyPreferences
+// replaces the notification preferences of the operator. Returns them as
+// the teamserver stored them.
+func (c *Client) SetNotifyPreferences(ctx context.Context, Preferences NotifyPreferences) (NotifyPreferences, error) {
+	if Preferences.Muted == nil {
+		Preferences.Muted = []string{}
+	}
+
+	if Preferences.Groups == nil {
+		Preferences.Groups = []string{}
+	}
+
+	return c.notifyPreferences(ctx, packager.Type.Notification.Set, map[string]any{
+		"Muted":      Preferences.Muted,
+		"Digest":     Preferences.Digest,
+		"QuietHours": Preferences.QuietHours,
+		"TimeZone":   Preferences.TimeZone,
+		"Groups":     Preferences.Groups,
+	})
+}
+
+// notifyPreferences
+// sends the request and waits for the preferences the teamserver
+// answers with, or for the error it logs.
+func (c *Client) notifyPreferences(ctx context.Context, SubEvent int, Info map[string]any) (NotifyPreferences, error) {
+	var (
+		Preferences = make(chan NotifyPreferences, 1)
+		Failed      = make(chan error, 1)
+
+		Answer = c.Subscribe(packager.Type.Notification.Type, func(Package packager.Package) {
+			var Answer NotifyPreferences
+
+			if Package.Body.SubEvent == packager.Type.Notification.Preferences && decode(Package.Body.Info["Preferences"], &Answer) == nil {
+				select {
+				case Preferences <- Answer:
+				default:
+				}
+			}
+		})
+		Logged = c.Subscribe(packager.Type.Teamserver.Type, func(Package packager.Package) {
+			var Text, _ = Package.Body.Info["Text"].(string)
+
+			if Package.Body.SubEvent == packager.Type.Teamserver.Log && strings.HasPrefix(Text, "Failed to set notification preferences") {
+				select {
+				case Failed <- errors.New(Text):
+				default:
+				}
+			}
+		})
+	)
+
+	defer Answer()
+	defer Logged()
+
+	if Info == nil {
+		Info = map[string]any{}
+	}
+
+	if err := c.Send(packager.Type.Notification.Type, SubEvent, Info); err != nil {
+		return NotifyPreferences{}, err
+	}
+
+	select {
+	case Answer := <-Preferences:
+		return Answer, nil
+
+	case err := <-Failed:
+		return NotifyPreferences{}, err
+
+	case <-ctx.Done():
+		return NotifyPreferences{}, ctx.Err()
+
+	case <-c.done:
+		return NotifyPreferences{}, errors.New("connection to the teamserver dropped")
+	}
+}
+
+// decode
+// converts a decoded json value of a package into the type.
+func decode(Value any, Target any) error {
+	Data, err := json.Marshal(Value)
+	if err != nil {
+		return err
+	}
+
+	return json.Unmarshal(Data, Target)
+}
@@ -0,0 +1,109 @@
+package sdk
+
+import (
+	"bytes"
+	"fmt"
+	"reflect"
+	"sort"
+	"strings"
+	"unicode"
+
+	"Havoc/pkg/agent"
+	"Havoc/pkg/packager"
+)
+
+// Python
+// generates the protocol module of the python bindings
+// (tools/python/havoc/protocol.py) from the packet definitions of the
+// teamserver, so the bindings can't drift from them.
+func Python() []byte {
+	var (
+		Buffer   bytes.Buffer
+		Types    = reflect.ValueOf(packager.Type)
+		Commands = make([]string, 0, len(agent.CommandNames))
+		IDs      = make(map[string]uint32)
+	)
+
+	Buffer.WriteString("# generated from the packet definitions of the teamserver with:\n")
+	Buffer.WriteString("#   havoc sdk python > tools/python/havoc/protocol.py\n")
+	Buffer.WriteString("# don't edit.\n\n")
+
+	Buffer.WriteString("# events (Head.Event) and their sub events (Body.SubEvent)\n")
+
+	for i := 0; i < Types.NumField(); i++ {
+		var Event = Types.Field(i)
+
+		fmt.Fprintf(&Buffer, "\n\nclass %v:\n", Types.Type().Field(i).Name)
+
+		for j := 0; j < Event.NumField(); j++ {
+			fmt.Fprintf(&Buffer, "    %v = 0x%x\n", pythonConstant(Event.Type().Field(j).Name), Event.Field(j).Int())
+		}
+	}
+
+	Buffer.WriteString("\n\n# ids of the commands of the demon (CommandID of a task)\n")
+	Buffer.WriteString("COMMANDS = {\n")
+
+	for ID, Name := range agent.CommandNames {
+		Commands = append(Commands, Name)
+		IDs[Name] = ID
+	}
+
+	sort.Strings(Commands)
+
+	for _, Name := range Commands {
+		fmt.Fprintf(&Buffer, "    %q: 0x%x,\n", Name, IDs[Name])
+	}
+
+	Buffer.WriteString("}\n\n")
+
+	for _, Constant := range []struct {
+		Name  string
+		Value any
+	}{
+		{"COMMAND_NOJOB", agent.COMMAND_NOJOB},
+		{"COMMAND_CHECKIN", agent.COMMAND_CHECKIN},
+		{"COMMAND_SLEEP", agent.COMMAND_SLEEP},
+		{"COMMAND_EXIT", agent.COMMAND_EXIT},
+		{"COMMAND_PROC", agent.COMMAND_PROC},
+		{"COMMAND_FS", agent.COMMAND_FS},
+		{"DEMON_COMMAND_PROC_CREATE", agent.DEMON_COMMAND_PROC_CREATE},
+		{"DOWNLOAD_INLINE_MAX", agent.DOWNLOAD_INLINE_MAX},
+		{"TRANSFER_ENDPOINT", agent.TRANSFER_ENDPOINT},
+	} {
+		switch Value := Constant.Value.(type) {
+		case string:
+			fmt.Fprintf(&Buffer, "%v = %q\n", Constant.Name, Value)
+		default:
+			fmt.Fprintf(&Buffer, "%v = 0x%x\n", Constant.Name, Value)
+		}
+	}
+
+	Buffer.WriteString("\n# kinds of task failures (ErrorCode of an output of Type Error)\n")
+
+	for _, Code := range agent.ErrorCodes {
+		fmt.Fprintf(&Buffer, "ERROR_CODE_%v = %q\n", strings.ToUpper(Code), Code)
+	}
+
+	return Buffer.Bytes()
+}
+
+// pythonConstant
+// turns the name of a field into the name of a python constant
+// (OAuthRequest becomes OAUTH_REQUEST).
+func pythonConstant(Name string) string {
+	var (
+		Runes    = []rune(Name)
+		Constant strings.Builder
+	)
+
+	for i, Rune := range Runes {
+		/* a word starts at an upper case letter after a lower case one or at the last upper case letter of an acronym (MSOffice) */
+		if i > 0 && unicode.IsUpper(Rune) && (unicode.IsLower(Runes[i-1]) || (i > 1 && i+1 < len(Runes) && unicode.IsLower(Runes[i+1]) && unicode.IsUpper(Runes[i-1]) && unicode.IsUpper(Runes[i-2]))) {
+			Constant.WriteRune('_')
+		}
+
+		Constant.WriteRune(unicode.ToUpper(Rune))
+	}
+
+	return Constant.String()
+}
@@ -0,0 +1,33 @@
+package sdk
+
+import (
+	"bytes"
+	"os"
+	"testing"
+)
+
+// regenerate with: havoc sdk python > tools/python/havoc/protocol.py
+func TestPythonPublished(t *testing.T) {
+	Published, err := os.ReadFile("../../../tools/python/havoc/protocol.py")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if !bytes.Equal(Published, Python()) {
+		t.Fatal("tools/python/havoc/protocol.py is out of date")
+	}
+}
+
+func TestPythonConstant(t *testing.T) {
+	for Name, Constant := range map[string]string{
+		"Type":         "TYPE",
+		"OAuthRequest": "OAUTH_REQUEST",
+		"MarkAsDead":   "MARK_AS_DEAD",
+		"MSOffice":     "MS_OFFICE",
+		"SSH":          "SSH",
+	} {
+		if Got := pythonConstant(Name); Got != Constant {
+			t.Errorf("pythonConstant(%v) = %v, want %v", Name, Got, Constant)
+		}
+	}
+}
@@ -0,0 +1,170 @@
+package sdk
+
+import (
+	"context"
+	"encoding/base64"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"Havoc/pkg/agent"
+	"Havoc/pkg/common/certs"
+	"Havoc/pkg/packager"
+)
+
+// File
+// a file downloaded from an agent. Data holds its content if the
+// teamserver sent it inline. Files too big for that stay on the
+// teamserver and have to be fetched from Transfer with Fetch.
+type File struct {
+	AgentID string
+	TaskID  string
+
+	Name string
+	Size int64
+
+	Data     []byte
+	Transfer string
+}
+
+// File
+// returns the file the output carries, if it's the end of a download.
+func (o Output) File() (File, bool) {
+	var File = File{
+		AgentID:  o.AgentID,
+		TaskID:   o.TaskID,
+		Transfer: o.Fields["Transfer"],
+	}
+
+	switch {
+
+	case o.Fields["MiscType"] == "downloadComplete":
+		var (
+			Data, err     = base64.StdEncoding.DecodeString(o.Fields["MiscData"])
+			Name, Size, _ = strings.Cut(o.Fields["MiscData2"], ";")
+		)
+
+		if err != nil {
+			return File, false
+		}
+
+		if Decoded, err := base64.StdEncoding.DecodeString(Name); err == nil {
+			File.Name = string(Decoded)
+		}
+
+		File.Data = Data
+		File.Size, _ = strconv.ParseInt(Size, 10, 64)
+
+	case len(File.Transfer) > 0:
+		File.Name = File.Transfer[strings.LastIndex(File.Transfer, "/")+1:]
+
+	default:
+		return File, false
+	}
+
+	return File, true
+}
+
+// OnFile
+// calls the handler with every file downloaded from the agents,
+// including the ones downloaded in segments.
+func (c *Client) OnFile(Handler func(File File)) func() {
+	var (
+		Outputs = c.OnOutput(func(Output Output) {
+			if File, ok := Output.File(); ok {
+				Handler(File)
+			}
+		})
+		Segmented = c.Subscribe(packager.Type.Download.Type, func(Package packager.Package) {
+			if Package.Body.SubEvent != packager.Type.Download.Finished {
+				return
+			}
+
+			var File File
+
+			File.Name, _ = Package.Body.Info["Name"].(string)
+			File.Transfer, _ = Package.Body.Info["Transfer"].(string)
+
+			if Encoded, ok := Package.Body.Info["Data"].(string); ok {
+				File.Data, _ = base64.StdEncoding.DecodeString(Encoded)
+				File.Size = int64(len(File.Data))
+			}
+
+			/* too big to be sent inline */
+			if len(File.Data) == 0 {
+				File.Data = nil
+			}
+
+			Handler(File)
+		})
+	)
+
+	return func() {
+		Outputs()
+		Segmented()
+	}
+}
+
+// Download
+// tasks the agent to download the file. The file arrives at the
+// handlers of OnFile (or as the output Await returns).
+func (c *Client) Download(AgentID, Path string) (string, error) {
+	return c.Task(AgentID, agent.COMMAND_FS, "download "+Path, map[string]any{
+		"SubCommand": "download",
+		"Arguments":  base64.StdEncoding.EncodeToString([]byte(Path)),
+	})
+}
+
+// Upload
+// tasks the agent to write the content to the path.
+func (c *Client) Upload(AgentID, Path string, Content []byte) (string, error) {
+	return c.Task(AgentID, agent.COMMAND_FS, "upload "+Path, map[string]any{
+		"SubCommand": "upload",
+		"Arguments":  base64.StdEncoding.EncodeToString([]byte(Path)) + ";" + base64.StdEncoding.EncodeToString(Content),
+	})
+}
+
+// Fetch
+// streams a file the teamserver keeps (the Transfer of a File) to the
+// writer. Offset resumes an interrupted fetch.
+func (c *Client) Fetch(ctx context.Context, Transfer string, Offset int64, Writer io.Writer) error {
+	var Client = &http.Client{
+		Transport: &http.Transport{TLSClientConfig: certs.Pinned(c.Config.Fingerprint)},
+	}
+
+	Request, err := http.NewRequestWithContext(ctx, http.MethodGet, "https://"+c.Config.Address+Transfer, nil)
+	if err != nil {
+		return err
+	}
+
+	/* operators of the identity provider authenticate with their token */
+	if len(c.Config.Token) > 0 {
+		Request.SetBasicAuth(c.Config.User, c.Config.Token)
+	} else {
+		Request.SetBasicAuth(c.Config.User, c.Config.Password)
+	}
+
+	if Offset > 0 {
+		Request.Header.Set("Range", fmt.Sprintf("bytes=%v-", Offset))
+	}
+
+	Response, err := Client.Do(Request)
+	if err != nil {
+		return err
+	}
+	defer Response.Body.Close()
+
+	if Response.StatusCode != http.StatusOK && Response.StatusCode != http.StatusPartialContent {
+		return fmt.Errorf("teamserver answered the fetch of %v with %v", Transfer, Response.Status)
+	}
+
+	if Offset > 0 && Response.StatusCode != http.StatusPartialContent {
+		return fmt.Errorf("teamserver can't resume the fetch of %v", Transfer)
+	}
+
+	_, err = io.Copy(Writer, Response.Body)
+
+	return err
+}
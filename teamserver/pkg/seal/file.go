@@ -0,0 +1,513 @@
+package seal
+
+import (
+	"bytes"
+	"crypto/rand"
+	"encoding/binary"
+	"errors"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sort"
+	"sync"
+
+	"Havoc/pkg/common"
+)
+
+/*
+ * layout of a sealed file:
+ *
+ *  [ Magic          ] 8 bytes
+ *  [ File ID        ] 16 bytes
+ *  [ Records        ] ...
+ *
+ * record:
+ *  [ Length         ] 4 bytes (plain text)
+ *  [ Nonce          ] 12 bytes
+ *  [ Cipher text    ] Length bytes
+ *  [ Tag            ] 16 bytes
+ *
+ * every write is sealed as its own records so files can be appended to
+ * (console logs) and written while they are being downloaded. the file
+ * id and offset of a record are authenticated so records can't be moved
+ * around or between files.
+ */
+const (
+	FILE_MAGIC      = "HVSEAL01"
+	FILE_ID_SIZE    = 16
+	HEADER_SIZE     = len(FILE_MAGIC) + FILE_ID_SIZE
+	RECORD_SIZE     = 0x10000
+	RECORD_OVERHEAD = 4 + 12 + 16
+)
+
+// appends of different writers (console logs) to the same file
+var appendLock sync.Mutex
+
+// Writer
+// writes a sealed file. Writes pass through if no storage key is set up.
+type Writer struct {
+	file   *os.File
+	id     []byte
+	offset int64
+	size   int64
+	append bool
+	sealed bool
+}
+
+// Create
+// creates or truncates the file. It gets sealed if a storage key is set up.
+func Create(Path string) (*Writer, error) {
+	File, err := os.Create(Path)
+	if err != nil {
+		return nil, err
+	}
+
+	var Writer = &Writer{file: File}
+
+	if !Enabled() {
+		return Writer, nil
+	}
+
+	if err = Writer.header(); err != nil {
+		File.Close()
+		return nil, err
+	}
+
+	return Writer, nil
+}
+
+// Append
+// opens the file for appending or creates it. Plain text files get
+// sealed first if a storage key is set up.
+func Append(Path string) (*Writer, error) {
+	Sealed, err := IsSealedFile(Path)
+	if err != nil && !errors.Is(err, fs.ErrNotExist) {
+		return nil, err
+	}
+
+	if Sealed && !Enabled() {
+		return nil, ErrLocked
+	}
+
+	if !Sealed && Enabled() && err == nil {
+		if err = SealFile(Path); err != nil {
+			return nil, err
+		}
+
+		Sealed = true
+	}
+
+	if !Enabled() {
+		File, err := os.OpenFile(Path, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0644)
+		if err != nil {
+			return nil, err
+		}
+
+		return &Writer{file: File, append: true}, nil
+	}
+
+	File, err := os.OpenFile(Path, os.O_CREATE|os.O_RDWR, 0644)
+	if err != nil {
+		return nil, err
+	}
+
+	var Writer = &Writer{file: File, append: true, sealed: true}
+
+	if !Sealed {
+		err = Writer.header()
+	} else {
+		Writer.id = make([]byte, FILE_ID_SIZE)
+		_, err = File.ReadAt(Writer.id, int64(len(FILE_MAGIC)))
+	}
+
+	if err != nil {
+		File.Close()
+		return nil, err
+	}
+
+	return Writer, nil
+}
+
+func (w *Writer) header() error {
+	w.id = make([]byte, FILE_ID_SIZE)
+	if _, err := rand.Read(w.id); err != nil {
+		return err
+	}
+
+	if _, err := w.file.Write(append([]byte(FILE_MAGIC), w.id...)); err != nil {
+		return err
+	}
+
+	w.offset = int64(HEADER_SIZE)
+	w.sealed = true
+
+	return nil
+}
+
+// Write
+// seals the data as records of at most RECORD_SIZE bytes.
+func (w *Writer) Write(Data []byte) (int, error) {
+	if !w.sealed {
+		n, err := w.file.Write(Data)
+		w.size += int64(n)
+		return n, err
+	}
+
+	if w.append {
+		appendLock.Lock()
+		defer appendLock.Unlock()
+
+		Offset, err := w.file.Seek(0, io.SeekEnd)
+		if err != nil {
+			return 0, err
+		}
+
+		w.offset = Offset
+	}
+
+	var Written = 0
+
+	for len(Data) > 0 {
+		var Length = min(len(Data), RECORD_SIZE)
+
+		Sealed, err := SealBytes(Data[:Length], recordData(w.id, w.offset))
+		if err != nil {
+			return Written, err
+		}
+
+		var Record = binary.LittleEndian.AppendUint32(make([]byte, 0, 4+len(Sealed)), uint32(Length))
+
+		if _, err = w.file.WriteAt(append(Record, Sealed...), w.offset); err != nil {
+			return Written, err
+		}
+
+		w.offset += int64(len(Record) + len(Sealed))
+		w.size += int64(Length)
+		Written += Length
+		Data = Data[Length:]
+	}
+
+	return Written, nil
+}
+
+// Size
+// returns the plain text bytes written by this writer.
+func (w *Writer) Size() int64 {
+	return w.size
+}
+
+func (w *Writer) Close() error {
+	return w.file.Close()
+}
+
+func recordData(ID []byte, Offset int64) []byte {
+	return binary.BigEndian.AppendUint64(append([]byte{}, ID...), uint64(Offset))
+}
+
+type record struct {
+	plain  int64
+	offset int64
+	length int
+}
+
+// Reader
+// reads a sealed or plain text file. Not safe for concurrent use.
+type Reader struct {
+	file    *os.File
+	id      []byte
+	sealed  bool
+	records []record
+	size    int64
+	pos     int64
+
+	// last decrypted record
+	cached int
+	buffer []byte
+}
+
+// Open
+// opens a sealed or plain text file for reading.
+func Open(Path string) (*Reader, error) {
+	File, err := os.Open(Path)
+	if err != nil {
+		return nil, err
+	}
+
+	Stat, err := File.Stat()
+	if err != nil {
+		File.Close()
+		return nil, err
+	}
+
+	var (
+		Reader = &Reader{file: File, size: Stat.Size(), cached: -1}
+		Header = make([]byte, HEADER_SIZE)
+	)
+
+	if n, _ := File.ReadAt(Header, 0); n < HEADER_SIZE || !bytes.Equal(Header[:len(FILE_MAGIC)], []byte(FILE_MAGIC)) {
+		return Reader, nil
+	}
+
+	if !Enabled() {
+		File.Close()
+		return nil, ErrLocked
+	}
+
+	Reader.sealed = true
+	Reader.id = Header[len(FILE_MAGIC):]
+	Reader.size = 0
+
+	/* index the records. a record cut off by a crash ends the file */
+	var (
+		Offset = int64(HEADER_SIZE)
+		Length = make([]byte, 4)
+	)
+
+	for {
+		if _, err = File.ReadAt(Length, Offset); err != nil {
+			break
+		}
+
+		var Size = int(binary.LittleEndian.Uint32(Length))
+		if Size > RECORD_SIZE || Offset+int64(Size+RECORD_OVERHEAD) > Stat.Size() {
+			break
+		}
+
+		Reader.records = append(Reader.records, record{plain: Reader.size, offset: Offset, length: Size})
+		Reader.size += int64(Size)
+		Offset += int64(Size + RECORD_OVERHEAD)
+	}
+
+	return Reader, nil
+}
+
+// Size
+// returns the plain text size of the file.
+func (r *Reader) Size() int64 {
+	return r.size
+}
+
+func (r *Reader) ReadAt(Data []byte, Offset int64) (int, error) {
+	if !r.sealed {
+		return r.file.ReadAt(Data, Offset)
+	}
+
+	var Read = 0
+
+	for Read < len(Data) {
+		if Offset >= r.size {
+			return Read, io.EOF
+		}
+
+		var i = sort.Search(len(r.records), func(i int) bool {
+			return r.records[i].plain+int64(r.records[i].length) > Offset
+		})
+
+		if err := r.decrypt(i); err != nil {
+			return Read, err
+		}
+
+		var n = copy(Data[Read:], r.buffer[Offset-r.records[i].plain:])
+
+		Read += n
+		Offset += int64(n)
+	}
+
+	return Read, nil
+}
+
+func (r *Reader) decrypt(i int) error {
+	if r.cached == i {
+		return nil
+	}
+
+	var (
+		Record = r.records[i]
+		Sealed = make([]byte, Record.length+RECORD_OVERHEAD-4)
+	)
+
+	if _, err := r.file.ReadAt(Sealed, Record.offset+4); err != nil {
+		return err
+	}
+
+	Plain, err := OpenBytes(Sealed, recordData(r.id, Record.offset))
+	if err != nil {
+		return err
+	}
+
+	r.cached = i
+	r.buffer = Plain
+
+	return nil
+}
+
+func (r *Reader) Read(Data []byte) (int, error) {
+	if r.pos >= r.size {
+		return 0, io.EOF
+	}
+
+	n, err := r.ReadAt(Data, r.pos)
+	r.pos += int64(n)
+
+	if n > 0 && err == io.EOF {
+		err = nil
+	}
+
+	return n, err
+}
+
+func (r *Reader) Seek(Offset int64, Whence int) (int64, error) {
+	switch Whence {
+
+	case io.SeekStart:
+
+	case io.SeekCurrent:
+		Offset += r.pos
+
+	case io.SeekEnd:
+		Offset += r.size
+
+	default:
+		return 0, errors.New("seek: invalid whence")
+
+	}
+
+	if Offset < 0 {
+		return 0, errors.New("seek: negative position")
+	}
+
+	r.pos = Offset
+
+	return Offset, nil
+}
+
+func (r *Reader) Close() error {
+	return r.file.Close()
+}
+
+// IsSealedFile
+// returns true if the file has been sealed.
+func IsSealedFile(Path string) (bool, error) {
+	File, err := os.Open(Path)
+	if err != nil {
+		return false, err
+	}
+	defer File.Close()
+
+	var Magic = make([]byte, len(FILE_MAGIC))
+
+	if _, err = io.ReadFull(File, Magic); err != nil {
+		return false, nil
+	}
+
+	return bytes.Equal(Magic, []byte(FILE_MAGIC)), nil
+}
+
+// ReadFile
+// reads the whole sealed or plain text file.
+func ReadFile(Path string) ([]byte, error) {
+	Reader, err := Open(Path)
+	if err != nil {
+		return nil, err
+	}
+	defer Reader.Close()
+
+	var Data = make([]byte, Reader.Size())
+
+	if _, err = io.ReadFull(Reader, Data); err != nil {
+		return nil, err
+	}
+
+	return Data, nil
+}
+
+// WriteFile
+// writes the data to the file. It gets sealed if a storage key is set up.
+func WriteFile(Path string, Data []byte) error {
+	Writer, err := Create(Path)
+	if err != nil {
+		return err
+	}
+
+	if _, err = Writer.Write(Data); err != nil {
+		Writer.Close()
+		return err
+	}
+
+	return Writer.Close()
+}
+
+// Size
+// returns the plain text size of the sealed or plain text file.
+func Size(Path string) (int64, error) {
+	Reader, err := Open(Path)
+	if err != nil {
+		return 0, err
+	}
+	defer Reader.Close()
+
+	return Reader.Size(), nil
+}
+
+// SealFile
+// seals a plain text file in place.
+func SealFile(Path string) error {
+	if Sealed, err := IsSealedFile(Path); err != nil || Sealed {
+		return err
+	}
+
+	In, err := os.Open(Path)
+	if err != nil {
+		return err
+	}
+	defer In.Close()
+
+	Out, err := Create(Path + ".sealing")
+	if err != nil {
+		return err
+	}
+
+	if _, err = common.StreamCopy(Out, In); err != nil {
+		Out.Close()
+		os.Remove(Path + ".sealing")
+		return err
+	}
+
+	if err = Out.Close(); err != nil {
+		return err
+	}
+
+	return os.Rename(Path+".sealing", Path)
+}
+
+// SealTree
+// seals every plain text file in the folder and its sub folders.
+// Returns the count of files that got sealed.
+func SealTree(Dir string) (int, error) {
+	var Count = 0
+
+	err := filepath.WalkDir(Dir, func(Path string, Entry fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+
+		if !Entry.Type().IsRegular() {
+			return nil
+		}
+
+		if Sealed, err := IsSealedFile(Path); err != nil || Sealed {
+			return err
+		}
+
+		if err = SealFile(Path); err != nil {
+			return err
+		}
+
+		Count++
+
+		return nil
+	})
+
+	return Count, err
+}
@@ -0,0 +1,168 @@
+package seal
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"encoding/base64"
+	"errors"
+	"strings"
+	"sync/atomic"
+
+	"golang.org/x/crypto/argon2"
+)
+
+// argon2id parameters the storage key gets derived from the server secret with
+const (
+	KDF_TIME    = 3
+	KDF_MEMORY  = 64 * 1024
+	KDF_THREADS = 4
+	KEY_SIZE    = 32
+	SALT_SIZE   = 16
+)
+
+// prefix of sealed strings (database columns)
+const STRING_PREFIX = "sealed:v1:"
+
+var (
+	// ErrLocked is returned for sealed data while no key has been set up
+	ErrLocked = errors.New("data is sealed and no storage secret is configured")
+	// ErrCorrupt is returned for sealed data that doesn't decrypt with the key
+	ErrCorrupt = errors.New("sealed data is corrupted or sealed with another secret")
+
+	storage atomic.Pointer[cipher.AEAD]
+)
+
+// Salt
+// returns a new random salt for Setup.
+func Salt() ([]byte, error) {
+	var Salt = make([]byte, SALT_SIZE)
+
+	if _, err := rand.Read(Salt); err != nil {
+		return nil, err
+	}
+
+	return Salt, nil
+}
+
+// Setup
+// derives the storage key from the server secret. Everything written
+// afterwards through this package gets sealed with it.
+func Setup(Secret string, Salt []byte) error {
+	if len(Secret) == 0 {
+		return errors.New("storage secret is empty")
+	}
+
+	if len(Salt) < SALT_SIZE {
+		return errors.New("storage salt is too short")
+	}
+
+	Block, err := aes.NewCipher(argon2.IDKey([]byte(Secret), Salt, KDF_TIME, KDF_MEMORY, KDF_THREADS, KEY_SIZE))
+	if err != nil {
+		return err
+	}
+
+	AEAD, err := cipher.NewGCM(Block)
+	if err != nil {
+		return err
+	}
+
+	storage.Store(&AEAD)
+
+	return nil
+}
+
+// Enabled
+// returns true if a storage key has been set up.
+func Enabled() bool {
+	return storage.Load() != nil
+}
+
+func key() cipher.AEAD {
+	if AEAD := storage.Load(); AEAD != nil {
+		return *AEAD
+	}
+
+	return nil
+}
+
+// SealBytes
+// encrypts the data: nonce || ciphertext || tag.
+func SealBytes(Plain, Data []byte) ([]byte, error) {
+	var AEAD = key()
+
+	if AEAD == nil {
+		return nil, ErrLocked
+	}
+
+	var Sealed = make([]byte, AEAD.NonceSize(), AEAD.NonceSize()+len(Plain)+AEAD.Overhead())
+	if _, err := rand.Read(Sealed); err != nil {
+		return nil, err
+	}
+
+	return AEAD.Seal(Sealed, Sealed, Plain, Data), nil
+}
+
+// OpenBytes
+// decrypts data sealed by SealBytes with the same additional data.
+func OpenBytes(Sealed, Data []byte) ([]byte, error) {
+	var AEAD = key()
+
+	if AEAD == nil {
+		return nil, ErrLocked
+	}
+
+	if len(Sealed) < AEAD.NonceSize()+AEAD.Overhead() {
+		return nil, ErrCorrupt
+	}
+
+	Plain, err := AEAD.Open(nil, Sealed[:AEAD.NonceSize()], Sealed[AEAD.NonceSize():], Data)
+	if err != nil {
+		return nil, ErrCorrupt
+	}
+
+	return Plain, nil
+}
+
+// IsSealed
+// returns true if the string has been sealed by SealString.
+func IsSealed(Value string) bool {
+	return strings.HasPrefix(Value, STRING_PREFIX)
+}
+
+// SealString
+// seals the string if a storage key has been set up. Returns it as is
+// otherwise. Empty strings stay empty.
+func SealString(Value string) string {
+	if !Enabled() || len(Value) == 0 || IsSealed(Value) {
+		return Value
+	}
+
+	Sealed, err := SealBytes([]byte(Value), nil)
+	if err != nil {
+		return Value
+	}
+
+	return STRING_PREFIX + base64.StdEncoding.EncodeToString(Sealed)
+}
+
+// OpenString
+// opens a string sealed by SealString. Strings that haven't been
+// sealed (written before the storage got sealed) are returned as is.
+func OpenString(Value string) (string, error) {
+	if !IsSealed(Value) {
+		return Value, nil
+	}
+
+	Sealed, err := base64.StdEncoding.DecodeString(strings.TrimPrefix(Value, STRING_PREFIX))
+	if err != nil {
+		return "", ErrCorrupt
+	}
+
+	Plain, err := OpenBytes(Sealed, nil)
+	if err != nil {
+		return "", err
+	}
+
+	return string(Plain), nil
+}
@@ -0,0 +1,89 @@
+package secrets
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+)
+
+// CookiesJSON
+// exports the cookies in the format of the Cookie-Editor and
+// EditThisCookie browser extensions.
+func CookiesJSON(Cookies []Secret) ([]byte, error) {
+	var Export = make([]map[string]any, 0, len(Cookies))
+
+	for _, Cookie := range Cookies {
+		var Entry = map[string]any{
+			"domain":   Cookie.Host,
+			"hostOnly": !strings.HasPrefix(Cookie.Host, "."),
+			"httpOnly": Cookie.HttpOnly,
+			"name":     Cookie.Name,
+			"path":     cookiePath(Cookie),
+			"secure":   Cookie.Secure,
+			"session":  Cookie.Expires == 0,
+			"storeId":  nil,
+			"value":    Cookie.Value,
+		}
+
+		if Cookie.Expires > 0 {
+			Entry["expirationDate"] = Cookie.Expires
+		}
+
+		switch strings.ToLower(Cookie.SameSite) {
+
+		case "lax", "strict":
+			Entry["sameSite"] = strings.ToLower(Cookie.SameSite)
+
+		case "none", "no_restriction":
+			Entry["sameSite"] = "no_restriction"
+
+		default:
+			Entry["sameSite"] = "unspecified"
+
+		}
+
+		Export = append(Export, Entry)
+	}
+
+	return json.MarshalIndent(Export, "", "  ")
+}
+
+// CookiesNetscape
+// exports the cookies as netscape cookies.txt (curl, wget, browser importers).
+func CookiesNetscape(Cookies []Secret) []byte {
+	var Export strings.Builder
+
+	Export.WriteString("# Netscape HTTP Cookie File\n")
+
+	for _, Cookie := range Cookies {
+		var (
+			Domain    = Cookie.Host
+			Subdomain = "FALSE"
+			Secure    = "FALSE"
+		)
+
+		if strings.HasPrefix(Domain, ".") {
+			Subdomain = "TRUE"
+		}
+
+		if Cookie.Secure {
+			Secure = "TRUE"
+		}
+
+		if Cookie.HttpOnly {
+			Domain = "#HttpOnly_" + Domain
+		}
+
+		Export.WriteString(fmt.Sprintf("%v\t%v\t%v\t%v\t%d\t%v\t%v\n", Domain, Subdomain, cookiePath(Cookie), Secure, int64(Cookie.Expires), Cookie.Name, Cookie.Value))
+	}
+
+	return []byte(Export.String())
+}
+
+func cookiePath(Cookie Secret) string {
+	if len(Cookie.Path) == 0 {
+		return "/"
+	}
+
+	return Cookie.Path
+}
@@ -0,0 +1,188 @@
+package secrets
+
+import (
+	"encoding/hex"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// types of hashes the credential store can export for cracking
+const (
+	HASH_NTLM       = "ntlm"
+	HASH_NETNTLMV1  = "netntlmv1"
+	HASH_NETNTLMV2  = "netntlmv2"
+	HASH_KRB5TGS    = "krb5tgs"
+	HASH_KRB5TGS17  = "krb5tgs-aes128"
+	HASH_KRB5TGS18  = "krb5tgs-aes256"
+	HASH_KRB5ASREP  = "krb5asrep"
+	HASH_MSCASH2    = "mscash2"
+	FORMAT_HASHCAT  = "hashcat"
+	FORMAT_JOHN     = "john"
+	HEX_PLAIN_START = "$HEX["
+)
+
+// HashType
+// mode of hashcat and format of john the hash gets cracked with.
+
+type HashType struct {
+	Name    string
+	Hashcat int
+	John    string
+}
+
+var (
+	hashTypes = map[string]HashType{
+		HASH_NTLM:      {Name: HASH_NTLM, Hashcat: 1000, John: "nt"},
+		HASH_NETNTLMV1: {Name: HASH_NETNTLMV1, Hashcat: 5500, John: "netntlm"},
+		HASH_NETNTLMV2: {Name: HASH_NETNTLMV2, Hashcat: 5600, John: "netntlmv2"},
+		HASH_KRB5TGS:   {Name: HASH_KRB5TGS, Hashcat: 13100, John: "krb5tgs"},
+		HASH_KRB5TGS17: {Name: HASH_KRB5TGS17, Hashcat: 19600, John: "krb5tgs-aes128"},
+		HASH_KRB5TGS18: {Name: HASH_KRB5TGS18, Hashcat: 19700, John: "krb5tgs-aes256"},
+		HASH_KRB5ASREP: {Name: HASH_KRB5ASREP, Hashcat: 18200, John: "krb5asrep"},
+		HASH_MSCASH2:   {Name: HASH_MSCASH2, Hashcat: 2100, John: "mscash2"},
+	}
+
+	hashNTLM      = regexp.MustCompile(`^(?i:[0-9a-f]{32}:)?([0-9a-fA-F]{32})$`)
+	hashNetNTLMv1 = regexp.MustCompile(`^[^:]+::[^:]*:(?i:[0-9a-f]{48}:[0-9a-f]{48}:[0-9a-f]{16})$`)
+	hashNetNTLMv2 = regexp.MustCompile(`^[^:]+::[^:]*:(?i:[0-9a-f]{16}:[0-9a-f]{32}:[0-9a-f]+)$`)
+)
+
+// Hash
+// hash of the credential store in the formats of the cracking tools.
+type Hash struct {
+	Type     HashType
+	Hash     string
+	Username string
+}
+
+// HashParse
+// detects the type of the hash and normalizes it. returns false if the
+// type isn't known.
+func HashParse(Username, Value string) (Hash, bool) {
+	var Hash = Hash{Username: Username, Hash: strings.Join(strings.Fields(Value), "")}
+
+	switch {
+
+	case hashNTLM.MatchString(Hash.Hash):
+		/* lm:nt pairs of secretsdump */
+		Hash.Hash = strings.ToLower(hashNTLM.FindStringSubmatch(Hash.Hash)[1])
+		Hash.Type = hashTypes[HASH_NTLM]
+
+	case hashNetNTLMv1.MatchString(Hash.Hash):
+		Hash.Type = hashTypes[HASH_NETNTLMV1]
+
+	case hashNetNTLMv2.MatchString(Hash.Hash):
+		Hash.Type = hashTypes[HASH_NETNTLMV2]
+
+	case strings.HasPrefix(Hash.Hash, "$krb5tgs$23$"):
+		Hash.Type = hashTypes[HASH_KRB5TGS]
+
+	case strings.HasPrefix(Hash.Hash, "$krb5tgs$17$"):
+		Hash.Type = hashTypes[HASH_KRB5TGS17]
+
+	case strings.HasPrefix(Hash.Hash, "$krb5tgs$18$"):
+		Hash.Type = hashTypes[HASH_KRB5TGS18]
+
+	case strings.HasPrefix(Hash.Hash, "$krb5asrep$23$"):
+		Hash.Type = hashTypes[HASH_KRB5ASREP]
+
+	case strings.HasPrefix(strings.ToUpper(Hash.Hash), "$DCC2$"):
+		Hash.Type = hashTypes[HASH_MSCASH2]
+
+	default:
+		return Hash, false
+
+	}
+
+	return Hash, true
+}
+
+// HashTypes
+// returns the names of the hash types that can be exported.
+func HashTypes() []string {
+	var Names []string
+
+	for Name := range hashTypes {
+		Names = append(Names, Name)
+	}
+
+	sort.Strings(Names)
+
+	return Names
+}
+
+// HashLine
+// returns the line of the hash in the job file of the cracking tool.
+func HashLine(Hash Hash, Format string) string {
+	if Format != FORMAT_JOHN {
+		return Hash.Hash
+	}
+
+	switch Hash.Type.Name {
+
+	case HASH_NTLM:
+		return johnUsername(Hash.Username) + ":$NT$" + Hash.Hash
+
+	case HASH_MSCASH2:
+		return johnUsername(Hash.Username) + ":" + Hash.Hash
+
+	}
+
+	/* the other formats contain the username already */
+	return Hash.Hash
+}
+
+// HashFile
+// returns the name of the job file of the hash type and tells how to crack it.
+func HashFile(Type HashType, Format string) (string, string) {
+	if Format == FORMAT_JOHN {
+		return Type.Name + ".john", "john --format=" + Type.John + " " + Type.Name + ".john"
+	}
+
+	return Type.Name + ".hashcat", "hashcat -m " + strconv.Itoa(Type.Hashcat) + " " + Type.Name + ".hashcat"
+}
+
+// PotParse
+// splits a line of a hashcat or john potfile into the hash and the
+// plaintext. Known returns true if the candidate hash belongs to the
+// hashes that have been exported.
+func PotParse(Line string, Known func(Hash string) bool) (string, string, bool) {
+	Line = strings.TrimRight(Line, "\r\n")
+
+	/* john prefixes the nt hashes */
+	Line = strings.TrimPrefix(Line, "$NT$")
+
+	for i := 0; i < len(Line); i++ {
+		if Line[i] != ':' {
+			continue
+		}
+
+		if Candidate := Line[:i]; Known(Candidate) {
+			return Candidate, potPlain(Line[i+1:]), true
+		}
+	}
+
+	return "", "", false
+}
+
+// potPlain
+// decodes the plaintexts hashcat encodes as $HEX[...]
+func potPlain(Plain string) string {
+	if strings.HasPrefix(Plain, HEX_PLAIN_START) && strings.HasSuffix(Plain, "]") {
+		if Decoded, err := hex.DecodeString(Plain[len(HEX_PLAIN_START) : len(Plain)-1]); err == nil {
+			return string(Decoded)
+		}
+	}
+
+	return Plain
+}
+
+func johnUsername(Username string) string {
+	if len(Username) == 0 {
+		return "user"
+	}
+
+	return strings.ReplaceAll(Username, ":", "_")
+}
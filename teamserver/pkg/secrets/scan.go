@@ -0,0 +1,205 @@
+package secrets
+
+import (
+	"bytes"
+	"errors"
+	"math"
+	"regexp"
+	"strings"
+	"unicode/utf16"
+	"unicode/utf8"
+)
+
+// matches a single scan reports at most
+const SCAN_MAX_MATCHES = 100
+
+// Rule
+// a pattern the content scanning looks for in loot and output.
+type Rule struct {
+	Name    string
+	Pattern *regexp.Regexp
+	// minimum shannon entropy (bits per character) of the secret.
+	// filters placeholders (********, <password>) and examples
+	Entropy float64
+}
+
+// Match
+// a secret a rule found. Value is the secret itself (the first group
+// of the pattern if it has one), Line the line it starts at.
+type Match struct {
+	Rule    string `json:"rule"`
+	Value   string `json:"value"`
+	Line    int    `json:"line"`
+	Context string `json:"context,omitempty"`
+}
+
+// built-in rules of the content scanning
+var defaultRules = []struct {
+	Name    string
+	Pattern string
+	Entropy float64
+}{
+	{"private key", `-----BEGIN (?:RSA |EC |DSA |OPENSSH |ENCRYPTED |PGP )?PRIVATE KEY(?: BLOCK)?-----[\s\S]{16,}?-----END (?:RSA |EC |DSA |OPENSSH |ENCRYPTED |PGP )?PRIVATE KEY(?: BLOCK)?-----`, 0},
+	{"aws access key", `\b((?:AKIA|ASIA|AGPA|AIDA|AROA|ANPA|ANVA|AIPA)[A-Z0-9]{16})\b`, 0},
+	{"aws secret key", `(?i)aws_?secret_?(?:access_?)?key["']?\s*[:=]\s*["']?([A-Za-z0-9/+=]{40})\b`, 3.5},
+	{"azure storage key", `(?i)AccountKey=([A-Za-z0-9+/]{86}==)`, 0},
+	{"github token", `\b(gh[pousr]_[A-Za-z0-9]{36,255})\b`, 0},
+	{"slack token", `\b(xox[abposr]-[A-Za-z0-9-]{10,})\b`, 0},
+	{"connection string", `(?i)((?:server|data source|host|address)\s*=[^;"'\r\n]+;[^"'\r\n]*?(?:password|pwd)\s*=[^;"'\r\n]+)`, 0},
+	{"credential url", `\b((?:mysql|postgres(?:ql)?|mongodb(?:\+srv)?|redis|amqp|mssql|sqlserver|ldaps?|ftp|smb|https?)://[^\s:/@"']+:[^\s:/@"']+@[^\s/"']+)`, 0},
+	{"password", `(?i)\b(?:password|passwd|pwd|pass)["']?\s*[:=]\s*["']?([^\s"';,<>]{4,128})`, 2.5},
+	{"generic secret", `(?i)\b(?:api_?key|apikey|secret(?:_?key)?|client_?secret|access_?token|auth_?token)["']?\s*[:=]\s*["']?([A-Za-z0-9_\-+/=.]{20,256})`, 3.5},
+}
+
+// DefaultRules
+// returns the built-in rules of the content scanning.
+func DefaultRules() []Rule {
+	var Rules []Rule
+
+	for _, Default := range defaultRules {
+		Rule, _ := RuleCompile(Default.Name, Default.Pattern, Default.Entropy)
+
+		Rules = append(Rules, Rule)
+	}
+
+	return Rules
+}
+
+// RuleCompile
+// compiles a rule of the content scanning.
+func RuleCompile(Name, Pattern string, Entropy float64) (Rule, error) {
+	if len(Name) == 0 || len(Pattern) == 0 {
+		return Rule{}, errors.New("secret rule requires a name and a pattern")
+	}
+
+	Compiled, err := regexp.Compile(Pattern)
+	if err != nil {
+		return Rule{}, errors.New("invalid pattern of secret rule " + Name + ": " + err.Error())
+	}
+
+	return Rule{Name: Name, Pattern: Compiled, Entropy: Entropy}, nil
+}
+
+// Scan
+// looks for the secrets the rules match in the text. the same secret
+// is reported once.
+func Scan(Text string, Rules []Rule) []Match {
+	var (
+		Matches []Match
+		Seen    = make(map[string]bool)
+	)
+
+	for _, Rule := range Rules {
+		for _, Index := range Rule.Pattern.FindAllStringSubmatchIndex(Text, SCAN_MAX_MATCHES) {
+			var Start, End = Index[0], Index[1]
+
+			/* the first group that took part in the match is the secret */
+			for Group := 2; Group+1 < len(Index); Group += 2 {
+				if Index[Group] >= 0 {
+					Start, End = Index[Group], Index[Group+1]
+					break
+				}
+			}
+
+			var Value = strings.TrimSpace(Text[Start:End])
+
+			if len(Value) == 0 || Entropy(Value) < Rule.Entropy || Seen[Rule.Name+"\x00"+Value] {
+				continue
+			}
+
+			Seen[Rule.Name+"\x00"+Value] = true
+
+			Matches = append(Matches, Match{
+				Rule:    Rule.Name,
+				Value:   Value,
+				Line:    strings.Count(Text[:Start], "\n") + 1,
+				Context: scanContext(Text, Index[0]),
+			})
+
+			if len(Matches) == SCAN_MAX_MATCHES {
+				return Matches
+			}
+		}
+	}
+
+	return Matches
+}
+
+// scanContext
+// returns the (shortened) line the match starts at.
+func scanContext(Text string, Offset int) string {
+	var (
+		Start = strings.LastIndexByte(Text[:Offset], '\n') + 1
+		End   = strings.IndexByte(Text[Offset:], '\n')
+	)
+
+	if End < 0 {
+		End = len(Text)
+	} else {
+		End += Offset
+	}
+
+	var Line = strings.TrimSpace(Text[Start:End])
+
+	if len(Line) > 160 {
+		Line = Line[:160]
+
+		/* don't cut a character in half */
+		for len(Line) > 0 && !utf8.ValidString(Line) {
+			Line = Line[:len(Line)-1]
+		}
+
+		Line += "..."
+	}
+
+	return Line
+}
+
+// Entropy
+// returns the shannon entropy of the value in bits per character.
+func Entropy(Value string) float64 {
+	var (
+		Counts  = make(map[rune]int)
+		Total   = 0
+		Entropy = 0.0
+	)
+
+	for _, Char := range Value {
+		Counts[Char]++
+		Total++
+	}
+
+	for _, Count := range Counts {
+		var Probability = float64(Count) / float64(Total)
+
+		Entropy -= Probability * math.Log2(Probability)
+	}
+
+	return Entropy
+}
+
+// ScanText
+// returns the text of a file for the content scanning. UTF-16 files
+// (with a byte order mark) get decoded, other binary files are skipped.
+func ScanText(Data []byte) (string, bool) {
+	if len(Data) >= 2 && Data[0] == 0xff && Data[1] == 0xfe {
+		var Units = make([]uint16, (len(Data)-2)/2)
+
+		for i := range Units {
+			Units[i] = uint16(Data[2+i*2]) | uint16(Data[3+i*2])<<8
+		}
+
+		return string(utf16.Decode(Units)), true
+	}
+
+	var Head = Data
+	if len(Head) > 8192 {
+		Head = Head[:8192]
+	}
+
+	if bytes.IndexByte(Head, 0) >= 0 {
+		return "", false
+	}
+
+	return string(Data), true
+}
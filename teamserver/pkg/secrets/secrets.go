@@ -0,0 +1,391 @@
+package secrets
+
+import (
+	"bufio"
+	"encoding/csv"
+	"encoding/json"
+	"regexp"
+	"strings"
+)
+
+// kinds of secrets the parsers collect
+const (
+	KIND_LOGIN      = "login"
+	KIND_COOKIE     = "cookie"
+	KIND_MASTERKEY  = "masterkey"
+	KIND_CREDENTIAL = "credential"
+)
+
+type Secret struct {
+	Kind     string `json:"kind"`
+	URL      string `json:"url,omitempty"`
+	Host     string `json:"host,omitempty"`
+	Username string `json:"username,omitempty"`
+	Password string `json:"password,omitempty"`
+
+	// cookie fields
+	Name     string  `json:"name,omitempty"`
+	Value    string  `json:"value,omitempty"`
+	Path     string  `json:"path,omitempty"`
+	Expires  float64 `json:"expires,omitempty"`
+	Secure   bool    `json:"secure,omitempty"`
+	HttpOnly bool    `json:"httpOnly,omitempty"`
+	SameSite string  `json:"sameSite,omitempty"`
+
+	// masterkey fields
+	GUID string `json:"guid,omitempty"`
+	Key  string `json:"key,omitempty"`
+
+	// file the tool read the secret from
+	File string `json:"file,omitempty"`
+}
+
+var (
+	/* SharpDPAPI, SharpChrome: {guid}:sha1 */
+	masterkeyLine = regexp.MustCompile(`(?i)\{([0-9a-f]{8}-[0-9a-f]{4}-[0-9a-f]{4}-[0-9a-f]{4}-[0-9a-f]{12})\}:([0-9a-f]{40}|[0-9a-f]{128})\b`)
+
+	/* "Name : Value" lines of mimikatz and the GhostPack tools */
+	fieldLine = regexp.MustCompile(`^\s*([A-Za-z][A-Za-z0-9 _()]{0,31}?)\s*:\s(.*)$`)
+	guidValue = regexp.MustCompile(`(?i)^\{?([0-9a-f]{8}-[0-9a-f]{4}-[0-9a-f]{4}-[0-9a-f]{4}-[0-9a-f]{12})\}?$`)
+	hexValue  = regexp.MustCompile(`(?i)^[0-9a-f]{40,128}$`)
+)
+
+// fields of the blocks the names of the tools map to
+var fieldNames = map[string]string{
+	"url":            "url",
+	"origin_url":     "url",
+	"origin url":     "url",
+	"action_url":     "url",
+	"signon_realm":   "url",
+	"targetname":     "url",
+	"target":         "url",
+	"username":       "username",
+	"user name":      "username",
+	"login":          "username",
+	"password":       "password",
+	"credential":     "password",
+	"credentialblob": "password",
+	"guid":           "guid",
+	"masterkey":      "key",
+	"sha1(key)":      "sha1",
+	"sha1":           "sha1",
+	"file_path":      "file",
+	"file":           "file",
+	"path":           "file",
+}
+
+// Parse
+// collects the secrets of the output of DPAPI and browser credential
+// tools (SharpDPAPI, SharpChrome, mimikatz dpapi, cookie json exports).
+func Parse(Output string) []Secret {
+	var (
+		Secrets []Secret
+		Seen    = make(map[string]bool)
+	)
+
+	if !Interesting(Output) {
+		return nil
+	}
+
+	for _, Secret := range append(append(append(parseJSON(Output), parseCSV(Output)...), parseBlocks(Output)...), parseMasterkeys(Output)...) {
+		var Key = Secret.Kind + "\x00" + Secret.URL + "\x00" + Secret.Host + "\x00" + Secret.Username + "\x00" + Secret.Password + "\x00" + Secret.Name + "\x00" + Secret.GUID
+
+		if Seen[Key] {
+			continue
+		}
+
+		Seen[Key] = true
+		Secrets = append(Secrets, Secret)
+	}
+
+	return Secrets
+}
+
+// Interesting
+// cheap check if the output might contain secrets before parsing it.
+func Interesting(Output string) bool {
+	var Lower = strings.ToLower(Output)
+
+	for _, Word := range []string{"password", "masterkey", "}:", "\"cookie", "\"name\"", "expirationdate", "credential"} {
+		if strings.Contains(Lower, Word) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// parseJSON
+// parses cookie exports (SharpChrome /format:json, Cookie-Editor).
+func parseJSON(Output string) []Secret {
+	var Secrets []Secret
+
+	for _, Start := range jsonArrays(Output) {
+		var (
+			Cookies []map[string]any
+			Decoder = json.NewDecoder(strings.NewReader(Output[Start:]))
+		)
+
+		if err := Decoder.Decode(&Cookies); err != nil {
+			continue
+		}
+
+		for _, Cookie := range Cookies {
+			var Secret = Secret{Kind: KIND_COOKIE}
+
+			Secret.Name, _ = Cookie["name"].(string)
+			Secret.Value, _ = Cookie["value"].(string)
+			Secret.Host, _ = Cookie["domain"].(string)
+			Secret.Path, _ = Cookie["path"].(string)
+			Secret.Expires, _ = Cookie["expirationDate"].(float64)
+			Secret.Secure, _ = Cookie["secure"].(bool)
+			Secret.HttpOnly, _ = Cookie["httpOnly"].(bool)
+			Secret.SameSite, _ = Cookie["sameSite"].(string)
+
+			if len(Secret.Name) == 0 || len(Secret.Host) == 0 {
+				continue
+			}
+
+			Secrets = append(Secrets, Secret)
+		}
+	}
+
+	return Secrets
+}
+
+// jsonArrays
+// returns the offsets of lines starting a json array of objects.
+func jsonArrays(Output string) []int {
+	var (
+		Offsets []int
+		Offset  = 0
+	)
+
+	for _, Line := range strings.SplitAfter(Output, "\n") {
+		if Trimmed := strings.TrimSpace(Line); strings.HasPrefix(Trimmed, "[") && (len(Trimmed) == 1 || strings.HasPrefix(strings.TrimSpace(Trimmed[1:]), "{")) {
+			Offsets = append(Offsets, Offset+strings.Index(Line, "["))
+		}
+
+		Offset += len(Line)
+	}
+
+	return Offsets
+}
+
+// parseCSV
+// parses the csv format of SharpChrome logins and cookies.
+func parseCSV(Output string) []Secret {
+	var (
+		Secrets []Secret
+		Header  map[string]int
+		Scanner = bufio.NewScanner(strings.NewReader(Output))
+	)
+
+	Scanner.Buffer(make([]byte, 0x10000), 0x1000000)
+
+	for Scanner.Scan() {
+		var Line = strings.TrimSpace(Scanner.Text())
+
+		if !strings.Contains(Line, ",") {
+			Header = nil
+			continue
+		}
+
+		Record, err := csv.NewReader(strings.NewReader(Line)).Read()
+		if err != nil {
+			continue
+		}
+
+		if Columns := csvHeader(Record); Columns != nil {
+			Header = Columns
+			continue
+		}
+
+		if Header == nil {
+			continue
+		}
+
+		var Field = func(Name string) string {
+			if Index, ok := Header[Name]; ok && Index < len(Record) {
+				return Record[Index]
+			}
+
+			return ""
+		}
+
+		if _, ok := Header["password"]; ok {
+			var Secret = Secret{
+				Kind:     KIND_LOGIN,
+				URL:      Field("origin_url"),
+				Username: Field("username"),
+				Password: Field("password"),
+				File:     Field("file_path"),
+			}
+
+			if len(Secret.URL) == 0 {
+				Secret.URL = Field("signon_realm")
+			}
+
+			if len(Secret.Password) > 0 {
+				Secrets = append(Secrets, Secret)
+			}
+		} else {
+			var Secret = Secret{
+				Kind:  KIND_COOKIE,
+				Host:  Field("host"),
+				Path:  Field("path"),
+				Name:  Field("name"),
+				Value: Field("value"),
+				File:  Field("file_path"),
+			}
+
+			Secret.Secure = strings.EqualFold(Field("is_secure"), "true") || Field("is_secure") == "1"
+			Secret.HttpOnly = strings.EqualFold(Field("is_httponly"), "true") || Field("is_httponly") == "1"
+
+			if len(Secret.Name) > 0 && len(Secret.Host) > 0 {
+				Secrets = append(Secrets, Secret)
+			}
+		}
+	}
+
+	return Secrets
+}
+
+// csvHeader
+// returns the columns of a header of logins or cookies.
+func csvHeader(Record []string) map[string]int {
+	var Columns = make(map[string]int)
+
+	for i, Column := range Record {
+		Columns[strings.ToLower(strings.TrimSpace(Column))] = i
+	}
+
+	if _, ok := Columns["username"]; ok {
+		if _, ok = Columns["password"]; ok {
+			return Columns
+		}
+	}
+
+	if _, ok := Columns["host"]; ok {
+		if _, ok = Columns["name"]; ok {
+			if _, ok = Columns["value"]; ok {
+				return Columns
+			}
+		}
+	}
+
+	return nil
+}
+
+// parseBlocks
+// parses blocks of "Name : Value" lines. blocks end at an empty line.
+func parseBlocks(Output string) []Secret {
+	var (
+		Secrets []Secret
+		Block   = make(map[string]string)
+	)
+
+	var Flush = func() {
+		defer func() { Block = make(map[string]string) }()
+
+		switch {
+
+		case len(Block["password"]) > 0 && (len(Block["username"]) > 0 || len(Block["url"]) > 0):
+			var Secret = Secret{
+				Kind:     KIND_LOGIN,
+				URL:      Block["url"],
+				Username: Block["username"],
+				Password: Block["password"],
+				File:     Block["file"],
+			}
+
+			/* windows credentials (Domain:target=host) aren't browser logins */
+			if !strings.Contains(Secret.URL, "://") {
+				Secret.Kind = KIND_CREDENTIAL
+				Secret.Host = credentialTarget(Secret.URL)
+				Secret.URL = ""
+			}
+
+			Secrets = append(Secrets, Secret)
+
+		case len(Block["guid"]) > 0 && (len(Block["key"]) > 0 || len(Block["sha1"]) > 0):
+			var Match = guidValue.FindStringSubmatch(Block["guid"])
+
+			if Match == nil {
+				return
+			}
+
+			var Secret = Secret{
+				Kind: KIND_MASTERKEY,
+				GUID: strings.ToLower(Match[1]),
+				Key:  strings.ToUpper(Block["sha1"]),
+				File: Block["file"],
+			}
+
+			if Key := Block["key"]; hexValue.MatchString(Key) {
+				Secret.Key = strings.ToUpper(Key)
+			}
+
+			if len(Secret.Key) > 0 {
+				Secrets = append(Secrets, Secret)
+			}
+
+		}
+	}
+
+	for _, Line := range strings.Split(strings.ReplaceAll(Output, "\r", ""), "\n") {
+		var Match = fieldLine.FindStringSubmatch(Line)
+
+		if Match == nil {
+			if len(strings.TrimSpace(Line)) == 0 || strings.HasPrefix(strings.TrimSpace(Line), "---") {
+				Flush()
+			}
+
+			continue
+		}
+
+		var (
+			Name  = strings.ToLower(strings.TrimSpace(Match[1]))
+			Value = strings.TrimSpace(Match[2])
+		)
+
+		if Field, ok := fieldNames[Name]; ok && len(Value) > 0 && !strings.EqualFold(Value, "(null)") {
+			/* a new secret starts with a field the current one already has */
+			if _, exists := Block[Field]; exists {
+				Flush()
+			}
+
+			Block[Field] = Value
+		}
+	}
+
+	Flush()
+
+	return Secrets
+}
+
+// credentialTarget
+// returns the host of the target of a windows credential.
+func credentialTarget(Target string) string {
+	if Index := strings.Index(Target, "target="); Index >= 0 {
+		return Target[Index+len("target="):]
+	}
+
+	return Target
+}
+
+// parseMasterkeys
+// parses the {guid}:sha1 lines of the GhostPack tools.
+func parseMasterkeys(Output string) []Secret {
+	var Secrets []Secret
+
+	for _, Match := range masterkeyLine.FindAllStringSubmatch(Output, -1) {
+		Secrets = append(Secrets, Secret{
+			Kind: KIND_MASTERKEY,
+			GUID: strings.ToLower(Match[1]),
+			Key:  strings.ToUpper(Match[2]),
+		})
+	}
+
+	return Secrets
+}
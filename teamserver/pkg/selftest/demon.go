@@ -0,0 +1,323 @@
+package selftest
+
+import (
+	"crypto/rand"
+	"encoding/binary"
+	"errors"
+	"fmt"
+
+	"Havoc/pkg/agent"
+	"Havoc/pkg/common"
+	"Havoc/pkg/common/crypt"
+	"Havoc/pkg/common/parser"
+)
+
+// commands the simulated demon answers
+var capabilities = []uint32{
+	agent.COMMAND_CHECKIN,
+	agent.COMMAND_FS,
+	agent.COMMAND_PIVOT,
+	agent.COMMAND_EXIT,
+}
+
+// Job
+// a task the teamserver sent to the demon.
+type Job struct {
+	Command   uint32
+	RequestID uint32
+	Data      *parser.Parser
+}
+
+// Demon
+// a simulated demon. It speaks the protocol of the demon (register,
+// key exchange, tasking, downloads and smb pivots) without doing
+// anything on the host it runs on.
+type Demon struct {
+	AgentID uint32
+	AESKey  []byte
+	AESIv   []byte
+
+	Hostname string
+	Username string
+	Domain   string
+	Process  string
+
+	// content of the files the teamserver downloads from the demon
+	Files map[string][]byte
+
+	// pivots connected over a (simulated) named pipe and the request
+	// id of the task that connected them. the teamserver expects the
+	// output of the pivots under it.
+	Pivots  map[uint32]*Demon
+	Connect map[uint32]uint32
+
+	Exited bool
+}
+
+// packet
+// builds the big endian packets of the demon.
+type packet []byte
+
+func (p packet) Int32(Value uint32) packet {
+	return binary.BigEndian.AppendUint32(p, Value)
+}
+
+func (p packet) Int64(Value uint64) packet {
+	return binary.BigEndian.AppendUint64(p, Value)
+}
+
+func (p packet) Bytes(Value []byte) packet {
+	return append(p.Int32(uint32(len(Value))), Value...)
+}
+
+func random(Size int) []byte {
+	var Buffer = make([]byte, Size)
+
+	if _, err := rand.Read(Buffer); err != nil {
+		panic(err)
+	}
+
+	return Buffer
+}
+
+// NewDemon
+// creates a simulated demon with a random agent id and session key.
+func NewDemon(Process string) *Demon {
+	return &Demon{
+		AgentID:  binary.BigEndian.Uint32(random(4)) &^ 0x80000000,
+		AESKey:   random(32),
+		AESIv:    random(16),
+		Hostname: "HAVOC-SELFTEST",
+		Username: "selftest",
+		Domain:   "SELFTEST",
+		Process:  Process,
+		Files:    make(map[string][]byte),
+		Pivots:   make(map[uint32]*Demon),
+		Connect:  make(map[uint32]uint32),
+	}
+}
+
+// NameID
+// returns the id of the demon as the teamserver names its session.
+func (d *Demon) NameID() string {
+	return fmt.Sprintf("%08x", d.AgentID)
+}
+
+// metadata
+// the metadata of a register request and a checkin (protocol v4).
+func (d *Demon) metadata() packet {
+	var Packet = packet{}
+
+	Packet = Packet.Int32(d.AgentID).Int32(agent.DEMON_PROTOCOL_FLAG | agent.DEMON_PROTOCOL_V4)
+	Packet = Packet.Bytes([]byte(d.Hostname)).Bytes([]byte(d.Username)).Bytes([]byte(d.Domain)).Bytes([]byte("127.0.0.1"))
+	Packet = Packet.Bytes(common.EncodeUTF16(`C:\Windows\System32\` + d.Process))
+	Packet = Packet.Int32(1337).Int32(1338).Int32(4).Int32(agent.PROCESS_ARCH_X64).Int32(0).Int64(0x7ff600000000)
+
+	/* windows 10 22h2, x64. no sleep */
+	Packet = Packet.Int32(10).Int32(0).Int32(1).Int32(0).Int32(19045).Int32(9)
+	Packet = Packet.Int32(0).Int32(0).Int64(0).Int32(0)
+
+	Packet = Packet.Int32(agent.PROXY_MODE_NONE).Bytes(nil).Int32(uint32(len(capabilities)))
+	for _, Command := range capabilities {
+		Packet = Packet.Int32(Command)
+	}
+
+	/* no max response size, utc host */
+	return Packet.Int32(0).Int64(0).Bytes(common.EncodeUTF16("UTC"))
+}
+
+// header
+// prefixes the packages of the demon with the header of its requests.
+func (d *Demon) header(Packages []byte) []byte {
+	var Packet = packet{}
+
+	Packet = Packet.Int32(uint32(len(Packages) + 8)).Int32(agent.DEMON_MAGIC_VALUE).Int32(d.AgentID)
+
+	return append(Packet, Packages...)
+}
+
+// Register
+// returns the register request of the demon. The session key travels
+// in front of the metadata it encrypts.
+func (d *Demon) Register() []byte {
+	var Packet = packet{}
+
+	Packet = Packet.Int32(agent.DEMON_INIT).Int32(0)
+	Packet = append(Packet, d.AESKey...)
+	Packet = append(Packet, d.AESIv...)
+	Packet = append(Packet, crypt.XCryptBytesAES256(d.metadata(), d.AESKey, d.AESIv)...)
+
+	return d.header(Packet)
+}
+
+// Registered
+// checks the answer of the teamserver to the register request.
+func (d *Demon) Registered(Response []byte) error {
+	var Decrypted = crypt.XCryptBytesAES256(Response, d.AESKey, d.AESIv)
+
+	if len(Decrypted) < 4 {
+		return errors.New("empty answer to the register request")
+	}
+
+	if AgentID := binary.LittleEndian.Uint32(Decrypted); AgentID != d.AgentID {
+		return fmt.Errorf("answer to the register request is for agent %08x (key exchange failed)", AgentID)
+	}
+
+	return nil
+}
+
+// Request
+// returns the request of the demon asking for jobs or sending the
+// result of one.
+func (d *Demon) Request(Command, RequestID uint32, Result []byte) []byte {
+	var Packet = packet{}.Int32(Command).Int32(RequestID)
+
+	if Result != nil {
+		Packet = append(Packet, crypt.XCryptBytesAES256(packet{}.Bytes(Result), d.AESKey, d.AESIv)...)
+	}
+
+	return d.header(Packet)
+}
+
+// Jobs
+// parses the jobs of the answer of the teamserver.
+func (d *Demon) Jobs(Response []byte) ([]Job, error) {
+	var (
+		Jobs   []Job
+		Parser = parser.NewParser(Response)
+	)
+
+	Parser.SetBigEndian(false)
+
+	for Parser.Length() > 0 {
+		if !Parser.CanIRead([]parser.ReadType{parser.ReadInt32, parser.ReadInt32, parser.ReadBytes}) {
+			return nil, errors.New("truncated job")
+		}
+
+		var (
+			Command   = uint32(Parser.ParseInt32())
+			RequestID = uint32(Parser.ParseInt32())
+			Data      = parser.NewParser(crypt.XCryptBytesAES256(Parser.ParseBytes(), d.AESKey, d.AESIv))
+		)
+
+		Data.SetBigEndian(false)
+
+		Jobs = append(Jobs, Job{Command: Command, RequestID: RequestID, Data: Data})
+	}
+
+	return Jobs, nil
+}
+
+// Execute
+// runs the job and returns the requests carrying its results.
+func (d *Demon) Execute(Job Job) ([][]byte, error) {
+	switch Job.Command {
+
+	case agent.COMMAND_NOJOB:
+		return nil, nil
+
+	case agent.COMMAND_CHECKIN:
+		var Result = append(append(append(packet{}, d.AESKey...), d.AESIv...), d.metadata()...)
+
+		return [][]byte{d.Request(agent.COMMAND_CHECKIN, Job.RequestID, Result)}, nil
+
+	case agent.COMMAND_FS:
+		if SubCommand := Job.Data.ParseInt32(); SubCommand != agent.DEMON_COMMAND_FS_DOWNLOAD {
+			return nil, fmt.Errorf("unsupported fs command %v", SubCommand)
+		}
+
+		return d.download(Job.RequestID, common.StripNull(common.DecodeUTF16(Job.Data.ParseBytes())))
+
+	case agent.COMMAND_PIVOT:
+		return d.pivot(Job)
+
+	case agent.COMMAND_EXIT:
+		var Method = Job.Data.ParseInt32()
+
+		d.Exited = true
+
+		return [][]byte{d.Request(agent.COMMAND_EXIT, Job.RequestID, packet{}.Int32(uint32(Method)))}, nil
+
+	}
+
+	return nil, fmt.Errorf("unsupported command %v", Job.Command)
+}
+
+// download
+// sends a file the way the demon does: open, write and close.
+func (d *Demon) download(RequestID uint32, Path string) ([][]byte, error) {
+	var (
+		Content, ok = d.Files[Path]
+		FileID      = binary.BigEndian.Uint32(random(4))
+		Requests    [][]byte
+	)
+
+	if !ok {
+		return nil, errors.New("unknown file " + Path)
+	}
+
+	Requests = append(Requests,
+		d.Request(agent.COMMAND_FS, RequestID, packet{}.Int32(agent.DEMON_COMMAND_FS_DOWNLOAD).Int32(0).Int32(FileID).Int64(uint64(len(Content))).Bytes(common.EncodeUTF16(Path))),
+		d.Request(agent.COMMAND_FS, RequestID, packet{}.Int32(agent.DEMON_COMMAND_FS_DOWNLOAD).Int32(1).Int32(FileID).Bytes(Content)),
+		d.Request(agent.COMMAND_FS, RequestID, packet{}.Int32(agent.DEMON_COMMAND_FS_DOWNLOAD).Int32(2).Int32(FileID).Int32(0)),
+	)
+
+	return Requests, nil
+}
+
+// pivot
+// connects a simulated pivot or passes the jobs of the teamserver on to
+// one and its results back.
+func (d *Demon) pivot(Job Job) ([][]byte, error) {
+	switch Command := Job.Data.ParseInt32(); Command {
+
+	case agent.DEMON_PIVOT_SMB_CONNECT:
+		var Pivot = NewDemon(d.Process)
+
+		/* nothing listens on the named pipe. the pivot answers right away */
+		Job.Data.ParseBytes()
+
+		Pivot.Files = d.Files
+		d.Pivots[Pivot.AgentID] = Pivot
+		d.Connect[Pivot.AgentID] = Job.RequestID
+
+		return [][]byte{d.Request(agent.COMMAND_PIVOT, Job.RequestID, packet{}.Int32(agent.DEMON_PIVOT_SMB_CONNECT).Int32(1).Bytes(Pivot.Register()))}, nil
+
+	case agent.DEMON_PIVOT_SMB_COMMAND:
+		var (
+			AgentID = uint32(Job.Data.ParseInt32())
+			Buffer  = parser.NewParser(Job.Data.ParseBytes())
+			Pivot   = d.Pivots[AgentID]
+			Results [][]byte
+		)
+
+		if Pivot == nil {
+			return nil, fmt.Errorf("unknown pivot %08x", AgentID)
+		}
+
+		/* agent id of the pivot and its jobs */
+		Buffer.SetBigEndian(false)
+		Buffer.ParseInt32()
+
+		Jobs, err := Pivot.Jobs(Buffer.ParseBytes())
+		if err != nil {
+			return nil, err
+		}
+
+		for _, Job := range Jobs {
+			Requests, err := Pivot.Execute(Job)
+			if err != nil {
+				return nil, err
+			}
+
+			for _, Request := range Requests {
+				Results = append(Results, d.Request(agent.COMMAND_PIVOT, d.Connect[AgentID], packet{}.Int32(agent.DEMON_PIVOT_SMB_COMMAND).Bytes(Request)))
+			}
+		}
+
+		return Results, nil
+
+	default:
+		return nil, fmt.Errorf("unsupported pivot command %v", Command)
+	}
+}
@@ -0,0 +1,109 @@
+package selftest
+
+import (
+	"errors"
+	"sync"
+	"time"
+
+	"Havoc/pkg/packager"
+	"Havoc/pkg/sdk"
+)
+
+// operator
+// connects to the teamserver like the client does to task the simulated
+// demons and watches what the teamserver makes of their results.
+type operator struct {
+	*sdk.Client
+
+	Events chan packager.Package
+
+	// agents whose events are of interest. the teamserver replays the
+	// history of the engagement to every operator connecting
+	Watched sync.Map
+}
+
+func newOperator(Teamserver, User, Password string, Timeout time.Duration) (*operator, error) {
+	var Operator = &operator{
+		Client: sdk.New(sdk.Config{
+			Address:  Teamserver,
+			User:     User,
+			Password: Password,
+			Timeout:  Timeout,
+		}),
+		Events: make(chan packager.Package, 1024),
+	}
+
+	Operator.Subscribe(packager.Type.Session.Type, func(Package packager.Package) {
+		if Operator.watched(Package) {
+			Operator.Events <- Package
+		}
+	})
+
+	if err := Operator.Connect(); err != nil {
+		return nil, err
+	}
+
+	return Operator, nil
+}
+
+// Watch
+// passes the events of the agent on to Wait.
+func (o *operator) Watch(AgentID string) {
+	o.Watched.Store(AgentID, true)
+}
+
+func (o *operator) watched(Package packager.Package) bool {
+	for _, Key := range []string{"NameID", "DemonID"} {
+		if AgentID, ok := Package.Body.Info[Key].(string); ok {
+			if _, ok = o.Watched.Load(AgentID); ok {
+				return true
+			}
+		}
+	}
+
+	return false
+}
+
+// Wait
+// waits for the event Match accepts.
+func (o *operator) Wait(Timeout time.Duration, Match func(Package packager.Package) bool) error {
+	var Timer = time.NewTimer(Timeout)
+	defer Timer.Stop()
+
+	for {
+		select {
+		case Package := <-o.Events:
+			if Match(Package) {
+				return nil
+			}
+
+		case <-o.Done():
+			return errors.New("teamserver closed the connection")
+
+		case <-Timer.C:
+			return errors.New("timed out")
+		}
+	}
+}
+
+// Session
+// matches the new session of the agent.
+func Session(AgentID string) func(Package packager.Package) bool {
+	return func(Package packager.Package) bool {
+		return Package.Head.Event == packager.Type.Session.Type &&
+			Package.Body.SubEvent == packager.Type.Session.NewSession &&
+			Package.Body.Info["NameID"] == AgentID
+	}
+}
+
+// Console
+// matches console output of the agent Match accepts.
+func Console(AgentID string, Match func(Output sdk.Output) bool) func(Package packager.Package) bool {
+	return func(Package packager.Package) bool {
+		if Output, ok := sdk.ParseOutput(Package); ok && Output.AgentID == AgentID {
+			return Match(Output)
+		}
+
+		return false
+	}
+}
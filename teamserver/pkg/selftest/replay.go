@@ -0,0 +1,175 @@
+package selftest
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"os"
+	"time"
+
+	"Havoc/pkg/agent"
+	"Havoc/pkg/handlers"
+	"Havoc/pkg/logger"
+)
+
+// ReplayConfig
+// what a recording gets replayed against.
+type ReplayConfig struct {
+	// recording of a listener (transactions.jsonl)
+	File string
+	// base urls of the listener the recording is replayed against
+	Urls []string
+
+	// keep the time between the recorded transactions
+	Pace    bool
+	Timeout time.Duration
+}
+
+// replayed
+// a recorded agent, simulated by a demon.
+type replayed struct {
+	Demon      *Demon
+	Registered bool
+}
+
+// Transactions
+// reads the transactions of a recording.
+func Transactions(Path string) ([]handlers.Transaction, error) {
+	var Transactions []handlers.Transaction
+
+	File, err := os.Open(Path)
+	if err != nil {
+		return nil, err
+	}
+	defer File.Close()
+
+	var Scanner = bufio.NewScanner(File)
+
+	Scanner.Buffer(make([]byte, 64*1024), 1024*1024)
+
+	for Line := 1; Scanner.Scan(); Line++ {
+		var Transaction handlers.Transaction
+
+		if len(Scanner.Bytes()) == 0 {
+			continue
+		}
+
+		if err = json.Unmarshal(Scanner.Bytes(), &Transaction); err != nil {
+			return nil, fmt.Errorf("line %v: %v", Line, err)
+		}
+
+		Transactions = append(Transactions, Transaction)
+	}
+
+	return Transactions, Scanner.Err()
+}
+
+// Replay
+// replays a recording against a listener: every recorded agent is
+// simulated by a demon talking to the listener the way the recorded agent
+// did (method, uri, host and headers) and the answers of the listener
+// are compared with the recorded ones. The payloads aren't part of the
+// recording, so results of tasks are replayed as requests for jobs (the
+// teamserver drops results of tasks it didn't send). Agents whose
+// registration isn't part of the recording get registered first.
+func Replay(Config ReplayConfig) error {
+	var (
+		Transport  = newTransport(Listener{Urls: Config.Urls}, Config.Timeout)
+		Agents     = make(map[int]*replayed)
+		Mismatches int
+		Start      = time.Now()
+	)
+
+	if len(Config.Urls) == 0 {
+		return fmt.Errorf("no url to reach the listener")
+	}
+
+	Transactions, err := Transactions(Config.File)
+	if err != nil {
+		return err
+	}
+
+	logger.Info(fmt.Sprintf("Replaying %v transactions of %v", len(Transactions), Config.File))
+
+	for i, Transaction := range Transactions {
+		var Agent = Agents[Transaction.Agent]
+
+		if Agent == nil {
+			Agent = &replayed{Demon: NewDemon("replay.exe")}
+			Agents[Transaction.Agent] = Agent
+		}
+
+		if Config.Pace {
+			if Wait := time.Duration(Transaction.Offset)*time.Millisecond - time.Since(Start); Wait > 0 {
+				time.Sleep(Wait)
+			}
+		}
+
+		if !Agent.Registered && Transaction.Command != agent.DEMON_INIT {
+			/* registers the agent the way it sends the transaction */
+			var Register = Transaction
+
+			Register.Command = agent.DEMON_INIT
+
+			if err = replay(Transport, Agent, Register, http.StatusOK); err != nil {
+				logger.Error(fmt.Sprintf("#%v agent %v: registration failed: %v", i+1, Transaction.Agent, err))
+				Mismatches++
+				continue
+			}
+		}
+
+		if err = replay(Transport, Agent, Transaction, Transaction.Status); err != nil {
+			logger.Error(fmt.Sprintf("#%v agent %v %v %v: %v", i+1, Transaction.Agent, Transaction.Method, Transaction.Uri, err))
+			Mismatches++
+		}
+	}
+
+	if Mismatches > 0 {
+		return fmt.Errorf("%v of %v transactions didn't replay like they were recorded", Mismatches, len(Transactions))
+	}
+
+	logger.Good(fmt.Sprintf("Replayed %v transactions of %v agents", len(Transactions), len(Agents)))
+
+	return nil
+}
+
+// replay
+// sends the transaction and checks the listener answers with the status
+// and, if it accepted it, with what the demon expects.
+func replay(Transport *transport, Agent *replayed, Transaction handlers.Transaction, Status int) error {
+	var Body []byte
+
+	if Transaction.Command == agent.DEMON_INIT {
+		Body = Agent.Demon.Register()
+	} else {
+		Body = Agent.Demon.Request(agent.COMMAND_GET_JOB, 0, nil)
+	}
+
+	Answered, Response, err := Transport.Replay(Transaction, Body)
+	if err != nil {
+		return err
+	}
+
+	if Answered != Status {
+		return fmt.Errorf("recorded %v %v, got %v %v", Status, http.StatusText(Status), Answered, http.StatusText(Answered))
+	}
+
+	if Answered != http.StatusOK {
+		return nil
+	}
+
+	if Transaction.Command == agent.DEMON_INIT {
+		if err = Agent.Demon.Registered(Response); err != nil {
+			return err
+		}
+
+		Agent.Registered = true
+
+		return nil
+	}
+
+	_, err = Agent.Demon.Jobs(Response)
+
+	return err
+}
@@ -0,0 +1,295 @@
+package selftest
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"Havoc/pkg/agent"
+	"Havoc/pkg/logger"
+	"Havoc/pkg/sdk"
+)
+
+// file the teamserver downloads from the simulated demon
+const SELFTEST_FILE = `C:\Windows\Temp\havoc-selftest.bin`
+
+// Config
+// what the self test runs against.
+type Config struct {
+	Listener Listener
+
+	// teamserver (host:port) and the operator tasking the simulated demons
+	Teamserver string
+	User       string
+	Password   string
+
+	// process the simulated demons claim to run in
+	Process string
+	// pipe the simulated pivot listens on
+	Pipe string
+
+	// how often the simulated demon asks for jobs and how long a step may take
+	Poll    time.Duration
+	Timeout time.Duration
+}
+
+// selftest
+// state of a self test run.
+type selftest struct {
+	Config    Config
+	Transport *transport
+	Operator  *operator
+	Demon     *Demon
+}
+
+// Run
+// runs the self test: registers a simulated demon over the listener,
+// tasks it, downloads a file from it and connects a pivot to it before
+// tasking both of them to exit. Returns the first step that failed.
+func Run(Config Config) error {
+	var (
+		Test = &selftest{
+			Config:    Config,
+			Transport: newTransport(Config.Listener, Config.Timeout),
+			Demon:     NewDemon(Config.Process),
+		}
+		Content = random(4096)
+		err     error
+	)
+
+	if len(Config.Listener.Urls) == 0 {
+		return errors.New("no url to reach the listener")
+	}
+
+	Test.Demon.Files[SELFTEST_FILE] = Content
+
+	logger.Info("Connecting to the teamserver " + Config.Teamserver + " as " + Config.User)
+	if Test.Operator, err = newOperator(Config.Teamserver, Config.User, Config.Password, Config.Timeout); err != nil {
+		return fmt.Errorf("operator: %v", err)
+	}
+	defer Test.Operator.Close()
+
+	Test.Operator.Watch(Test.Demon.NameID())
+
+	return Test.steps(
+		step{"register and key exchange over " + strings.Join(Config.Listener.Urls, ", "), Test.register},
+		step{"tasking round-trip (checkin)", func() error { return Test.checkin(Test.Demon, Test.Demon) }},
+		step{"file transfer (download of 4 KB)", func() error { return Test.download(Content) }},
+		step{"pivot over (simulated) smb pipe " + Config.Pipe, Test.pivot},
+		step{"exit", Test.exit},
+	)
+}
+
+type step struct {
+	Name string
+	Run  func() error
+}
+
+func (s *selftest) steps(Steps ...step) error {
+	for _, Step := range Steps {
+		var Start = time.Now()
+
+		if err := Step.Run(); err != nil {
+			logger.Error(fmt.Sprintf("[FAIL] %v: %v", Step.Name, err))
+			return fmt.Errorf("%v: %v", Step.Name, err)
+		}
+
+		logger.Good(fmt.Sprintf("[ OK ] %v (%v)", Step.Name, time.Since(Start).Round(time.Millisecond)))
+	}
+
+	return nil
+}
+
+func (s *selftest) register() error {
+	Response, err := s.Transport.Send(s.Demon.Register())
+	if err != nil {
+		return err
+	}
+
+	if err = s.Demon.Registered(Response); err != nil {
+		return err
+	}
+
+	if err = s.Operator.Wait(s.Config.Timeout, Session(s.Demon.NameID())); err != nil {
+		return errors.New("teamserver didn't announce the session: " + err.Error())
+	}
+
+	return nil
+}
+
+// poll
+// asks for jobs till the teamserver sends one of the command or the
+// step times out, then sends the results of the jobs.
+func (s *selftest) poll(Command uint32) error {
+	var Deadline = time.Now().Add(s.Config.Timeout)
+
+	for time.Now().Before(Deadline) {
+		Response, err := s.Transport.Send(s.Demon.Request(agent.COMMAND_GET_JOB, 0, nil))
+		if err != nil {
+			return err
+		}
+
+		Jobs, err := s.Demon.Jobs(Response)
+		if err != nil {
+			return err
+		}
+
+		var Found = false
+
+		for _, Job := range Jobs {
+			Requests, err := s.Demon.Execute(Job)
+			if err != nil {
+				return err
+			}
+
+			for _, Request := range Requests {
+				if _, err = s.Transport.Send(Request); err != nil {
+					return err
+				}
+			}
+
+			Found = Found || Job.Command == Command
+		}
+
+		if Found {
+			return nil
+		}
+
+		time.Sleep(s.Config.Poll)
+	}
+
+	return fmt.Errorf("teamserver didn't send the %v job", agent.CommandNames[Command])
+}
+
+// checkin
+// tasks the demon (directly or over its parent) with a checkin.
+func (s *selftest) checkin(Parent, Demon *Demon) error {
+	var Command uint32 = agent.COMMAND_CHECKIN
+
+	if _, err := s.Operator.Task(Demon.NameID(), agent.COMMAND_CHECKIN, "checkin", nil); err != nil {
+		return err
+	}
+
+	if Parent != Demon {
+		Command = agent.COMMAND_PIVOT
+	}
+
+	if err := s.poll(Command); err != nil {
+		return err
+	}
+
+	return s.Operator.Wait(s.Config.Timeout, Console(Demon.NameID(), func(Output sdk.Output) bool {
+		return strings.Contains(Output.Message, "checkin")
+	}))
+}
+
+func (s *selftest) download(Content []byte) error {
+	var (
+		Digest = sha256.Sum256(Content)
+		Failed error
+	)
+
+	_, err := s.Operator.Download(s.Demon.NameID(), SELFTEST_FILE)
+	if err != nil {
+		return err
+	}
+
+	if err = s.poll(agent.COMMAND_FS); err != nil {
+		return err
+	}
+
+	err = s.Operator.Wait(s.Config.Timeout, Console(s.Demon.NameID(), func(Output sdk.Output) bool {
+		if Output.Type == "Error" {
+			Failed = errors.New(Output.Message)
+			return true
+		}
+
+		File, ok := Output.File()
+		if !ok || File.Data == nil {
+			/* too big to send inline. the teamserver stored it */
+			return strings.HasPrefix(Output.Message, "Finished download")
+		}
+
+		if Received := sha256.Sum256(File.Data); !bytes.Equal(Received[:], Digest[:]) {
+			Failed = errors.New("downloaded file got corrupted")
+		}
+
+		return true
+	}))
+	if err != nil {
+		return err
+	}
+
+	return Failed
+}
+
+func (s *selftest) pivot() error {
+	var Pipe = `\\.\pipe\` + s.Config.Pipe
+
+	_, err := s.Operator.Task(s.Demon.NameID(), agent.COMMAND_PIVOT, "pivot connect "+Pipe, map[string]any{
+		"Command": fmt.Sprint(agent.DEMON_PIVOT_SMB_CONNECT),
+		"Param":   Pipe,
+	})
+	if err != nil {
+		return err
+	}
+
+	if err = s.poll(agent.COMMAND_PIVOT); err != nil {
+		return err
+	}
+
+	var Pivot *Demon
+
+	for _, Pivot = range s.Demon.Pivots {
+		s.Operator.Watch(Pivot.NameID())
+	}
+
+	if Pivot == nil {
+		return errors.New("pivot didn't connect")
+	}
+
+	err = s.Operator.Wait(s.Config.Timeout, Console(s.Demon.NameID(), func(Output sdk.Output) bool {
+		return strings.Contains(Output.Message, "[SMB]")
+	}))
+	if err != nil {
+		return err
+	}
+
+	/* jobs of the pivot go over its parent */
+	return s.checkin(s.Demon, Pivot)
+}
+
+func (s *selftest) exit() error {
+	var Demons []*Demon
+
+	for _, Pivot := range s.Demon.Pivots {
+		Demons = append(Demons, Pivot)
+	}
+
+	Demons = append(Demons, s.Demon)
+
+	for _, Demon := range Demons {
+		var Command uint32 = agent.COMMAND_EXIT
+
+		if _, err := s.Operator.Task(Demon.NameID(), agent.COMMAND_EXIT, "exit thread", map[string]any{"ExitMethod": "thread"}); err != nil {
+			return err
+		}
+
+		if Demon != s.Demon {
+			Command = agent.COMMAND_PIVOT
+		}
+
+		if err := s.poll(Command); err != nil {
+			return err
+		}
+
+		if !Demon.Exited {
+			return fmt.Errorf("agent %v didn't get the exit job", Demon.NameID())
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,128 @@
+package selftest
+
+import (
+	"bytes"
+	"crypto/tls"
+	"fmt"
+	"io"
+	"math/rand"
+	"net/http"
+	"strings"
+	"time"
+
+	"Havoc/pkg/handlers"
+)
+
+// Listener
+// how the simulated demon reaches the listener. the same settings the
+// payload of the listener gets.
+type Listener struct {
+	// base urls the demon connects to (eg: https://cdn.example.com:443)
+	Urls       []string
+	Uris       []string
+	UserAgent  string
+	Headers    []string
+	HostHeader string
+}
+
+// transport
+// sends the requests of the demon to the listener over http(s).
+type transport struct {
+	Listener Listener
+	Client   *http.Client
+}
+
+func newTransport(Listener Listener, Timeout time.Duration) *transport {
+	return &transport{
+		Listener: Listener,
+		Client: &http.Client{
+			Timeout: Timeout,
+			Transport: &http.Transport{
+				Proxy: http.ProxyFromEnvironment,
+				/* the demon doesn't verify the certificate of the listener either */
+				TLSClientConfig: &tls.Config{InsecureSkipVerify: true},
+			},
+		},
+	}
+}
+
+// Send
+// posts the request to a random uri of the listener.
+func (t *transport) Send(Body []byte) ([]byte, error) {
+	var (
+		Url = t.Listener.Urls[rand.Intn(len(t.Listener.Urls))]
+		Uri = "/"
+	)
+
+	if len(t.Listener.Uris) > 0 {
+		Uri = t.Listener.Uris[rand.Intn(len(t.Listener.Uris))]
+	}
+
+	Request, err := http.NewRequest(http.MethodPost, strings.TrimSuffix(Url, "/")+Uri, bytes.NewReader(Body))
+	if err != nil {
+		return nil, err
+	}
+
+	Request.Header.Set("User-Agent", t.Listener.UserAgent)
+
+	for _, Header := range t.Listener.Headers {
+		if Name, Value, ok := strings.Cut(Header, ":"); ok {
+			Request.Header.Set(strings.TrimSpace(Name), strings.TrimSpace(Value))
+		}
+	}
+
+	if len(t.Listener.HostHeader) > 0 {
+		Request.Host = t.Listener.HostHeader
+	}
+
+	Status, Data, err := t.do(Request)
+	if err != nil {
+		return nil, err
+	}
+
+	if Status != http.StatusOK {
+		return nil, fmt.Errorf("%v answered %v. the request doesn't match the profile of the listener or got refused on the way", Request.URL, Status)
+	}
+
+	return Data, nil
+}
+
+// Replay
+// sends the request the way the recorded transaction did and returns
+// the status the listener answered with.
+func (t *transport) Replay(Transaction handlers.Transaction, Body []byte) (int, []byte, error) {
+	var Url = t.Listener.Urls[rand.Intn(len(t.Listener.Urls))]
+
+	Request, err := http.NewRequest(Transaction.Method, strings.TrimSuffix(Url, "/")+Transaction.Uri, bytes.NewReader(Body))
+	if err != nil {
+		return 0, nil, err
+	}
+
+	for Name, Values := range Transaction.Headers {
+		/* redacted by the recording */
+		if len(Values) == 1 && Values[0] == "[redacted]" {
+			continue
+		}
+
+		Request.Header[Name] = Values
+	}
+
+	Request.Host = Transaction.Host
+
+	return t.do(Request)
+}
+
+func (t *transport) do(Request *http.Request) (int, []byte, error) {
+	Response, err := t.Client.Do(Request)
+	if err != nil {
+		return 0, nil, err
+	}
+	defer Response.Body.Close()
+
+	Data, err := io.ReadAll(Response.Body)
+	if err != nil {
+		return 0, nil, err
+	}
+
+	return Response.StatusCode, Data, nil
+}
@@ -0,0 +1,34 @@
+package service
+
+import (
+	"Havoc/pkg/eventbus"
+	"Havoc/pkg/logger"
+)
+
+const HeadEvent = "Event"
+
+// Consume
+// forwards the typed events of the teamserver to every service client so
+// scripts can react to new sessions, finished tasks, loot and failed
+// listeners.
+func (s *Service) Consume(Event eventbus.Event) error {
+	var Message = map[string]map[string]any{
+		"Head": {
+			"Type": HeadEvent,
+			"Time": Event.Time.Format("02/01/2006 15:04:05"),
+		},
+		"Body": {
+			"Type":      Event.Type,
+			"Workspace": Event.Workspace,
+			"Data":      Event.Data,
+		},
+	}
+
+	for _, client := range append([]*ClientService(nil), s.clients...) {
+		if err := client.WriteJson(Message); err != nil {
+			logger.DebugError("Failed to send event to service client: " + err.Error())
+		}
+	}
+
+	return nil
+}
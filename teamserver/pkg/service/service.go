@@ -65,8 +65,10 @@ func (s *Service) handleConnection(socket *websocket.Conn) {
 	// now add the new connected client
 	s.clients = append(s.clients, client)
 
-	// dispatch incoming events
-	s.routine(client)
+	// dispatch incoming events. a panic only restarts the routine of the client
+	s.Teamserver.Supervise("service client "+client.Conn.RemoteAddr().String(), func() {
+		s.routine(client)
+	})
 
 	// close connection and remove from service client list
 	s.ClientClose(client)
@@ -228,55 +230,50 @@ func (s *Service) dispatch(response map[string]map[string]any, client *ClientSer
 
 			if Task == "Add" {
 
-				for index := range s.Data.ServerAgents.Agents {
-
-					if Agent["NameID"] == s.Data.ServerAgents.Agents[index].NameID {
-
-						var Command, err = base64.StdEncoding.DecodeString(response["Body"]["Command"].(string))
-						if err != nil {
-							logger.Error("Failed to decode command response: " + err.Error())
-						}
+				var NameID, _ = Agent["NameID"].(string)
 
-						var TaskJob = agent.Job{
-							Payload: Command,
-						}
+				if ServerAgent := s.Data.ServerAgents.Get(NameID); ServerAgent != nil {
 
-						s.Data.ServerAgents.Agents[index].AddJobToQueue(TaskJob)
+					var Command, err = base64.StdEncoding.DecodeString(response["Body"]["Command"].(string))
+					if err != nil {
+						logger.Error("Failed to decode command response: " + err.Error())
+					}
 
+					var TaskJob = agent.Job{
+						Payload: Command,
 					}
 
+					ServerAgent.AddJobToQueue(TaskJob)
+
 				}
 
 			} else if Task == "Get" {
 
 				if _, ok := response["Body"]["TasksQueue"]; !ok {
 
-					for index := range s.Data.ServerAgents.Agents {
-
-						if Agent["NameID"] == s.Data.ServerAgents.Agents[index].NameID {
-							logger.Debug("Found agent")
-							var (
-								TasksQueue    = s.Data.ServerAgents.Agents[index].GetQueuedJobs()
-								PayloadBuffer []byte
-							)
+					var NameID, _ = Agent["NameID"].(string)
 
-							for _, task := range TasksQueue {
-								PayloadBuffer = append(PayloadBuffer, task.Payload...)
-							}
+					if ServerAgent := s.Data.ServerAgents.Get(NameID); ServerAgent != nil {
+						logger.Debug("Found agent")
+						var (
+							TasksQueue    = ServerAgent.GetQueuedJobs()
+							PayloadBuffer []byte
+						)
 
-							response["Body"]["TasksQueue"] = base64.StdEncoding.EncodeToString(PayloadBuffer)
+						for _, task := range TasksQueue {
+							PayloadBuffer = append(PayloadBuffer, task.Payload...)
+						}
 
-							if err := client.WriteJson(response); err != nil {
-								logger.Debug("Failed to write json to service client: " + err.Error())
-								return
-							}
+						response["Body"]["TasksQueue"] = base64.StdEncoding.EncodeToString(PayloadBuffer)
 
-							s.Data.ServerAgents.Agents[index].Info.LastCallIn = time.Now().Format("02-01-2006 15:04:05")
+						if err := client.WriteJson(response); err != nil {
+							logger.Debug("Failed to write json to service client: " + err.Error())
+							return
+						}
 
-							logger.Debug("Wrote to the client")
+						ServerAgent.Info.LastCallIn = time.Now().Format("02-01-2006 15:04:05")
 
-							break
-						}
+						logger.Debug("Wrote to the client")
 					}
 				}
 				return
@@ -25,6 +25,8 @@ type Teamserver interface {
 	EventAppend(pk packager.Package) []packager.Package
 	EventBroadcast(FromUser string, pk packager.Package)
 	SendEvent(id string, pk packager.Package) error
+
+	Supervise(Source string, Routine func())
 }
 
 type ConfigService struct {
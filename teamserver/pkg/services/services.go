@@ -0,0 +1,408 @@
+package services
+
+import (
+	"bufio"
+	"regexp"
+	"strings"
+)
+
+// kinds of the entries the parsers collect
+const (
+	KIND_SERVICE = "service"
+	KIND_TASK    = "task"
+)
+
+// flags of the entries that make them privilege escalation candidates
+const (
+	FLAG_UNQUOTED = "unquoted path"
+	FLAG_WRITABLE = "writable path"
+	FLAG_USERPATH = "outside protected folders"
+)
+
+// Entry
+// a service or scheduled task of the host.
+type Entry struct {
+	Kind      string
+	Name      string
+	Display   string
+	Path      string
+	RunAs     string
+	StartType string
+	State     string
+}
+
+// Access
+// an ACE of a path that lets unprivileged users modify it.
+type Access struct {
+	Path      string
+	Principal string
+	Rights    string
+}
+
+var (
+	/* "Name : Value" (sc qc, schtasks /v /fo list, Format-List) and "Name=Value" (wmic /format:list) lines */
+	fieldLine = regexp.MustCompile(`^\s*([A-Za-z][A-Za-z0-9 _]{0,39}?)\s*[:=]\s?(.*)$`)
+
+	/* icacls: "path principal:(rights)" followed by indented "principal:(rights)" lines */
+	principal = `(?:NT AUTHORITY|NT SERVICE|BUILTIN|APPLICATION PACKAGE AUTHORITY)\\[^:\\]+|[^\s\\:]+\\Domain Users|CREATOR OWNER|CREATOR GROUP|[^\s\\:]+\\[^\s\\:]+|[^\s\\:]+`
+	aclPath   = regexp.MustCompile(`^([A-Za-z]:\\.*?|\\\\.*?)\s(` + principal + `):((?:\([A-Z,]+\))+)\s*$`)
+	aclEntry  = regexp.MustCompile(`^\s+(` + principal + `):((?:\([A-Z,]+\))+)\s*$`)
+)
+
+// fields of the blocks the names of the tools map to
+var fieldNames = map[string]string{
+	"service_name":         "name",
+	"name":                 "name",
+	"taskname":             "name",
+	"display_name":         "display",
+	"displayname":          "display",
+	"binary_path_name":     "path",
+	"pathname":             "path",
+	"task to run":          "command",
+	"service_start_name":   "runas",
+	"startname":            "runas",
+	"run as user":          "runas",
+	"start_type":           "start",
+	"startmode":            "start",
+	"starttype":            "start",
+	"schedule type":        "start",
+	"state":                "state",
+	"status":               "status",
+	"scheduled task state": "enabled",
+}
+
+// principals unprivileged users are part of
+var unprivileged = []string{
+	"everyone",
+	"builtin\\users",
+	"users",
+	"nt authority\\authenticated users",
+	"authenticated users",
+	"nt authority\\interactive",
+	"interactive",
+}
+
+// rights of an ACE that allow replacing the file or adding files to the folder
+var writeRights = map[string]bool{
+	"F": true, "M": true, "W": true, "WD": true, "AD": true, "GA": true, "GW": true, "WDAC": true, "WO": true,
+}
+
+// folders only administrators can write to by default
+var protectedFolders = []string{
+	"c:\\windows\\",
+	"c:\\program files\\",
+	"c:\\program files (x86)\\",
+}
+
+// Parse
+// collects the services and scheduled tasks of the output of service
+// and task enumeration (sc qc, wmic service get /format:list, Get-CimInstance
+// Win32_Service | fl, schtasks /query /fo list /v) and the ACEs of
+// icacls output that grant unprivileged users write access.
+func Parse(Output string) ([]Entry, []Access) {
+	if !Interesting(Output) {
+		return nil, nil
+	}
+
+	return parseBlocks(Output), parseAcls(Output)
+}
+
+// Interesting
+// cheap check if the output might contain services, tasks or ACLs
+// before parsing it.
+func Interesting(Output string) bool {
+	var Lower = strings.ToLower(Output)
+
+	for _, Word := range []string{"service_name", "pathname", "task to run", "successfully processed"} {
+		if strings.Contains(Lower, Word) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// parseBlocks
+// parses the blocks of field lines. a blank line or a field repeating
+// in the block starts the next one.
+func parseBlocks(Output string) []Entry {
+	var (
+		Entries []Entry
+		Scanner = bufio.NewScanner(strings.NewReader(Output))
+		Block   = make(map[string]string)
+	)
+
+	Scanner.Buffer(make([]byte, 0, 64*1024), len(Output)+1)
+
+	var flush = func() {
+		if Entry, ok := blockEntry(Block); ok {
+			Entries = append(Entries, Entry)
+		}
+
+		Block = make(map[string]string)
+	}
+
+	for Scanner.Scan() {
+		var Line = strings.TrimRight(Scanner.Text(), "\r")
+
+		if len(strings.TrimSpace(Line)) == 0 {
+			flush()
+			continue
+		}
+
+		Match := fieldLine.FindStringSubmatch(Line)
+		if Match == nil {
+			continue
+		}
+
+		Field, ok := fieldNames[strings.ToLower(strings.TrimSpace(Match[1]))]
+		if !ok {
+			continue
+		}
+
+		if _, ok = Block[Field]; ok {
+			flush()
+		}
+
+		Block[Field] = strings.TrimSpace(Match[2])
+	}
+
+	flush()
+
+	return Entries
+}
+
+// blockEntry
+// returns the service or task of the fields of a block.
+func blockEntry(Block map[string]string) (Entry, bool) {
+	var Entry = Entry{
+		Name:    Block["name"],
+		Display: Block["display"],
+		RunAs:   Block["runas"],
+		State:   Block["state"],
+	}
+
+	/* schtasks: "Status: Ready" */
+	if len(Entry.State) == 0 {
+		Entry.State = Block["status"]
+	}
+
+	if len(Entry.Name) == 0 {
+		return Entry, false
+	}
+
+	if Command, ok := Block["command"]; ok {
+		Entry.Kind = KIND_TASK
+		Entry.Path = Command
+		Entry.StartType = Block["start"]
+
+		if strings.EqualFold(Block["enabled"], "disabled") {
+			Entry.State = "Disabled"
+		}
+	} else if Path, ok := Block["path"]; ok {
+		Entry.Kind = KIND_SERVICE
+		Entry.Path = Path
+
+		/* sc qc: "2   AUTO_START" */
+		if Fields := strings.Fields(Block["start"]); len(Fields) > 0 {
+			Entry.StartType = Fields[len(Fields)-1]
+		}
+	} else {
+		return Entry, false
+	}
+
+	/* com handlers and tasks without an action */
+	if len(Entry.Path) == 0 || strings.EqualFold(Entry.Path, "N/A") || strings.EqualFold(Entry.Path, "COM handler") {
+		return Entry, false
+	}
+
+	return Entry, true
+}
+
+// parseAcls
+// parses the ACEs of icacls output that grant unprivileged users write
+// access to the path.
+func parseAcls(Output string) []Access {
+	var (
+		Acls    []Access
+		Path    string
+		Scanner = bufio.NewScanner(strings.NewReader(Output))
+	)
+
+	Scanner.Buffer(make([]byte, 0, 64*1024), len(Output)+1)
+
+	for Scanner.Scan() {
+		var (
+			Line           = strings.TrimRight(Scanner.Text(), "\r")
+			Principal, Ace string
+		)
+
+		if Match := aclPath.FindStringSubmatch(Line); Match != nil {
+			Path, Principal, Ace = Match[1], Match[2], Match[3]
+		} else if Match = aclEntry.FindStringSubmatch(Line); Match != nil && len(Path) > 0 {
+			Principal, Ace = Match[1], Match[2]
+		} else {
+			Path = ""
+			continue
+		}
+
+		if Writable(Principal, Ace) {
+			Acls = append(Acls, Access{Path: strings.TrimRight(Path, "\\"), Principal: Principal, Rights: Ace})
+		}
+	}
+
+	return Acls
+}
+
+// Writable
+// checks if the ACE (eg: "BUILTIN\Users", "(I)(OI)(CI)(M)") lets
+// unprivileged users modify the object it applies to.
+func Writable(Principal, Rights string) bool {
+	var Unprivileged = false
+
+	for _, Name := range unprivileged {
+		if strings.EqualFold(Principal, Name) || strings.HasSuffix(strings.ToLower(Principal), "\\domain users") {
+			Unprivileged = true
+			break
+		}
+	}
+
+	if !Unprivileged {
+		return false
+	}
+
+	for _, Group := range strings.Split(strings.Trim(Rights, "()"), ")(") {
+		/* inherit only ACEs don't apply to the object itself */
+		if Group == "IO" || Group == "DENY" {
+			return false
+		}
+	}
+
+	for _, Group := range strings.Split(strings.Trim(Rights, "()"), ")(") {
+		for _, Right := range strings.Split(Group, ",") {
+			if writeRights[Right] {
+				return true
+			}
+		}
+	}
+
+	return false
+}
+
+// Executable
+// returns the path of the executable of the command line. unquoted
+// command lines end the path at the first ".exe" like CreateProcess
+// ends up doing and at the first space if there is none.
+func Executable(Command string) string {
+	Command = strings.TrimSpace(Command)
+
+	if strings.HasPrefix(Command, "\"") {
+		if End := strings.Index(Command[1:], "\""); End >= 0 {
+			return Command[1 : End+1]
+		}
+
+		return Command[1:]
+	}
+
+	if Index := strings.Index(strings.ToLower(Command), ".exe"); Index >= 0 {
+		if End := Index + 4; End == len(Command) || Command[End] == ' ' {
+			return Command[:End]
+		}
+	}
+
+	if Index := strings.IndexByte(Command, ' '); Index >= 0 {
+		return Command[:Index]
+	}
+
+	return Command
+}
+
+// Unquoted
+// checks if the command line runs an executable of which the path
+// contains spaces without quoting it. Windows tries every prefix of
+// it ending at a space as executable first.
+func Unquoted(Command string) bool {
+	Command = strings.TrimSpace(Command)
+
+	if strings.HasPrefix(Command, "\"") {
+		return false
+	}
+
+	return strings.Contains(Executable(Command), " ")
+}
+
+// Hijackable
+// returns the paths writing to lets an unprivileged user run code in
+// place of the command line: the executable, its folder and, for
+// unquoted paths, the folders of the prefixes Windows tries first.
+func Hijackable(Command string) []string {
+	var (
+		Path    = expand(Executable(Command))
+		Folder  = Path
+		Folders []string
+	)
+
+	if Index := strings.LastIndexByte(Path, '\\'); Index > 0 {
+		Folder = Path[:Index]
+	}
+
+	Folders = append(Folders, Path, Folder)
+
+	if Unquoted(Command) {
+		for i := range Path {
+			if Path[i] != ' ' {
+				continue
+			}
+
+			if Index := strings.LastIndexByte(Path[:i], '\\'); Index > 0 {
+				Folders = append(Folders, Path[:Index])
+			}
+		}
+	}
+
+	return Folders
+}
+
+// Protected
+// checks if the executable of the command line is in a folder only
+// administrators can write to by default.
+func Protected(Command string) bool {
+	var Path = strings.ToLower(expand(Executable(Command)))
+
+	/* paths of drivers and services without a drive (system32\drivers\x.sys) */
+	if !strings.Contains(Path, ":\\") {
+		return !strings.HasPrefix(Path, "\\\\")
+	}
+
+	for _, Folder := range protectedFolders {
+		if strings.HasPrefix(Path, Folder) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// expand
+// replaces the environment variables commonly used in service and
+// task command lines by their default value.
+func expand(Path string) string {
+	var Lower = strings.ToLower(Path)
+
+	for Variable, Value := range map[string]string{
+		"%systemroot%":         "C:\\Windows",
+		"%windir%":             "C:\\Windows",
+		"%programfiles%":       "C:\\Program Files",
+		"%programfiles(x86)%":  "C:\\Program Files (x86)",
+		"%systemdrive%":        "C:",
+		"\\systemroot\\":       "C:\\Windows\\",
+		"\\??\\":               "",
+		"%commonprogramfiles%": "C:\\Program Files\\Common Files",
+	} {
+		if strings.HasPrefix(Lower, Variable) {
+			return Value + Path[len(Variable):]
+		}
+	}
+
+	return Path
+}
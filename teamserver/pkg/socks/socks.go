@@ -4,6 +4,8 @@ import (
 	"errors"
 	"net"
 	"strings"
+
+	"Havoc/pkg/budget"
 )
 
 type Socks struct {
@@ -12,6 +14,8 @@ type Socks struct {
 	handler  func(s *Socks, conn net.Conn)
 	Failed   bool
 	Clients  []int32
+	// accounts the sockets of the proxy clients
+	Budget *budget.Budget
 }
 
 func NewSocks(addr string) *Socks {
@@ -47,6 +51,11 @@ func (s *Socks) Start() error {
 		return err
 	}
 
+	/* lets the accept loop get restarted after a crash */
+	defer s.listener.Close()
+
+	s.listener = s.Budget.Listener(s.listener)
+
 	for {
 
 		/* accepts any new connections */
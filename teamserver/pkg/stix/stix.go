@@ -0,0 +1,229 @@
+package stix
+
+import (
+	"crypto/rand"
+	"crypto/sha1"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"strings"
+	"time"
+)
+
+const (
+	SPEC_VERSION = "2.1"
+
+	// namespace for deterministic identifiers of cyber observables (STIX 2.1 section 2.9)
+	observableNamespace = "00abedb4-aa42-466c-9c01-fed23315a9b7"
+)
+
+type (
+	// Object is a STIX domain, relationship or cyber observable object.
+	Object map[string]any
+
+	Bundle struct {
+		Type    string   `json:"type"`
+		ID      string   `json:"id"`
+		Objects []Object `json:"objects"`
+
+		// identity every domain object is created by
+		identity string
+		index    map[string]bool
+	}
+)
+
+// NewBundle
+// creates a new bundle with an identity object of the producer.
+func NewBundle(Producer string) *Bundle {
+	var Bundle = &Bundle{
+		Type:  "bundle",
+		ID:    NewID("bundle"),
+		index: make(map[string]bool),
+	}
+
+	Bundle.identity = Bundle.Add(Object{
+		"type":           "identity",
+		"spec_version":   SPEC_VERSION,
+		"id":             NewID("identity"),
+		"created":        Timestamp(time.Now()),
+		"modified":       Timestamp(time.Now()),
+		"name":           Producer,
+		"identity_class": "system",
+	})
+
+	return Bundle
+}
+
+// Timestamp
+// formats the time as STIX timestamp (UTC, millisecond precision).
+func Timestamp(Time time.Time) string {
+	return Time.UTC().Format("2006-01-02T15:04:05.000Z")
+}
+
+// NewID
+// returns a random (uuid v4) identifier of the object type.
+func NewID(Type string) string {
+	var uuid = make([]byte, 16)
+
+	rand.Read(uuid)
+
+	uuid[6] = (uuid[6] & 0x0f) | 0x40
+	uuid[8] = (uuid[8] & 0x3f) | 0x80
+
+	return Type + "--" + formatUUID(uuid)
+}
+
+// ObservableID
+// returns the deterministic (uuid v5) identifier of a cyber observable
+// based on its id contributing properties.
+func ObservableID(Type string, Properties map[string]any) string {
+	var (
+		Namespace, _ = hex.DecodeString(strings.ReplaceAll(observableNamespace, "-", ""))
+		Hash         = sha1.New()
+	)
+
+	/* encoding/json sorts map keys which gives us a canonical representation */
+	Data, _ := json.Marshal(Properties)
+
+	Hash.Write(Namespace)
+	Hash.Write(Data)
+
+	uuid := Hash.Sum(nil)[:16]
+	uuid[6] = (uuid[6] & 0x0f) | 0x50
+	uuid[8] = (uuid[8] & 0x3f) | 0x80
+
+	return Type + "--" + formatUUID(uuid)
+}
+
+func formatUUID(uuid []byte) string {
+	return fmt.Sprintf("%x-%x-%x-%x-%x", uuid[0:4], uuid[4:6], uuid[6:8], uuid[8:10], uuid[10:16])
+}
+
+// Escape
+// escapes a string so it can be used inside of a pattern.
+func Escape(Value string) string {
+	return strings.ReplaceAll(strings.ReplaceAll(Value, `\`, `\\`), `'`, `\'`)
+}
+
+// Add
+// adds the object to the bundle if it doesn't exist yet and returns its id.
+func (b *Bundle) Add(Obj Object) string {
+	var ID = Obj["id"].(string)
+
+	if !b.index[ID] {
+		b.index[ID] = true
+		b.Objects = append(b.Objects, Obj)
+	}
+
+	return ID
+}
+
+// domain
+// creates a domain object of the type created by the bundle identity.
+func (b *Bundle) domain(Type string, Created time.Time, Properties Object) string {
+	var Obj = Object{
+		"type":           Type,
+		"spec_version":   SPEC_VERSION,
+		"id":             NewID(Type),
+		"created":        Timestamp(Created),
+		"modified":       Timestamp(Created),
+		"created_by_ref": b.identity,
+	}
+
+	for Key, Value := range Properties {
+		Obj[Key] = Value
+	}
+
+	return b.Add(Obj)
+}
+
+// Observable
+// adds a cyber observable. Identifying are the properties that contribute to the id.
+func (b *Bundle) Observable(Type string, Identifying map[string]any, Properties Object) string {
+	var Obj = Object{
+		"type":         Type,
+		"spec_version": SPEC_VERSION,
+		"id":           ObservableID(Type, Identifying),
+	}
+
+	for Key, Value := range Identifying {
+		Obj[Key] = Value
+	}
+
+	for Key, Value := range Properties {
+		Obj[Key] = Value
+	}
+
+	return b.Add(Obj)
+}
+
+// Indicator
+// adds an indicator with a STIX pattern.
+func (b *Bundle) Indicator(Name, Description, Pattern string, Created time.Time, Types ...string) string {
+	return b.domain("indicator", Created, Object{
+		"name":            Name,
+		"description":     Description,
+		"indicator_types": Types,
+		"pattern":         Pattern,
+		"pattern_type":    "stix",
+		"valid_from":      Timestamp(Created),
+	})
+}
+
+// Tool
+// adds a tool (eg. the agent).
+func (b *Bundle) Tool(Name, Description string, Types ...string) string {
+	return b.domain("tool", time.Now(), Object{
+		"name":        Name,
+		"description": Description,
+		"tool_types":  Types,
+	})
+}
+
+// Infrastructure
+// adds an infrastructure object (eg. a listener).
+func (b *Bundle) Infrastructure(Name, Description string, Created time.Time, Types ...string) string {
+	return b.domain("infrastructure", Created, Object{
+		"name":                 Name,
+		"description":          Description,
+		"infrastructure_types": Types,
+	})
+}
+
+// ObservedData
+// adds observed data referencing the cyber observables.
+func (b *Bundle) ObservedData(First, Last time.Time, Count int, References []string, Properties Object) string {
+	var Obj = Object{
+		"first_observed":  Timestamp(First),
+		"last_observed":   Timestamp(Last),
+		"number_observed": Count,
+		"object_refs":     References,
+	}
+
+	for Key, Value := range Properties {
+		Obj[Key] = Value
+	}
+
+	return b.domain("observed-data", First, Obj)
+}
+
+// Note
+// adds a note about the referenced objects.
+func (b *Bundle) Note(Abstract, Content, Author string, Created time.Time, References []string) string {
+	return b.domain("note", Created, Object{
+		"abstract":    Abstract,
+		"content":     Content,
+		"authors":     []string{Author},
+		"object_refs": References,
+	})
+}
+
+// Relationship
+// adds a relationship between two objects.
+func (b *Bundle) Relationship(Source, Type, Target string) string {
+	return b.domain("relationship", time.Now(), Object{
+		"relationship_type": Type,
+		"source_ref":        Source,
+		"target_ref":        Target,
+	})
+}
@@ -0,0 +1,252 @@
+package systemd
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"os/user"
+	"path/filepath"
+	"strings"
+	"text/template"
+)
+
+// folder of the unit files of the services installed by the admin
+const UNIT_PATH = "/etc/systemd/system"
+
+// Unit
+// teamserver service and the account it runs as.
+type Unit struct {
+	// name of the service (<Name>.service)
+	Name string
+
+	// account the teamserver runs as. created if it doesn't exist
+	User string
+
+	// working directory of the teamserver (data/, bin/static, ...)
+	Directory string
+
+	// havoc binary and the arguments of the teamserver
+	Binary    string
+	Arguments []string
+
+	// optional file of environment variables the profile interpolates (${NAME})
+	EnvironmentFile string
+
+	// folders the teamserver writes to besides its data folder
+	Writable []string
+
+	// files the teamserver reads outside of its working directory (profile, secrets, ...)
+	Readable []string
+}
+
+var unitTemplate = template.Must(template.New("unit").Funcs(template.FuncMap{"quote": quote}).Parse(`# written by havoc service install. reinstall instead of editing it
+[Unit]
+Description=Havoc teamserver ({{ .Name }})
+After=network-online.target
+Wants=network-online.target
+StartLimitIntervalSec=300
+StartLimitBurst=5
+
+[Service]
+Type=simple
+User={{ .User }}
+Group={{ .User }}
+WorkingDirectory={{ quote .Directory }}
+ExecStart={{ quote .Binary }}{{ range .Arguments }} {{ quote . }}{{ end }}
+{{- if .EnvironmentFile }}
+EnvironmentFile=-{{ quote .EnvironmentFile }}
+{{- end }}
+Restart=on-failure
+RestartSec=5s
+TimeoutStopSec=30s
+LimitNOFILE=65536
+UMask=0077
+
+# listeners on privileged ports without running as root
+AmbientCapabilities=CAP_NET_BIND_SERVICE
+CapabilityBoundingSet=CAP_NET_BIND_SERVICE
+NoNewPrivileges=yes
+
+# sandboxing. the teamserver only writes below its working directory
+ProtectSystem=strict
+ReadWritePaths={{ quote .Directory }}{{ range .Writable }} {{ quote . }}{{ end }}
+ProtectHome={{ .ProtectHome }}
+PrivateTmp=yes
+PrivateDevices=yes
+ProtectKernelTunables=yes
+ProtectKernelModules=yes
+ProtectKernelLogs=yes
+ProtectControlGroups=yes
+ProtectClock=yes
+ProtectHostname=yes
+RestrictSUIDSGID=yes
+RestrictRealtime=yes
+RestrictNamespaces=yes
+RestrictAddressFamilies=AF_INET AF_INET6 AF_UNIX AF_NETLINK
+LockPersonality=yes
+SystemCallArchitectures=native
+
+[Install]
+WantedBy=multi-user.target
+`))
+
+// quote
+// quotes a value of the unit if it has to be.
+func quote(Value string) string {
+	if !strings.ContainsAny(Value, " \t\"'\\$%") {
+		return Value
+	}
+
+	var Replacer = strings.NewReplacer(`\`, `\\`, `"`, `\"`, `$`, `$$`, `%`, `%%`)
+
+	return `"` + Replacer.Replace(Value) + `"`
+}
+
+// ProtectHome
+// home folders are hidden from the service unless it reads from one.
+func (u *Unit) ProtectHome() string {
+	for _, Path := range append([]string{u.Directory}, append(u.Readable, u.Writable...)...) {
+		for _, Home := range []string{"/home/", "/root/", "/run/user/"} {
+			if strings.HasPrefix(Path+"/", Home) {
+				return "read-only"
+			}
+		}
+	}
+
+	return "yes"
+}
+
+// Path
+// returns the path of the unit file.
+func (u *Unit) Path() string {
+	return filepath.Join(UNIT_PATH, u.Name+".service")
+}
+
+// Render
+// returns the content of the unit file.
+func (u *Unit) Render() ([]byte, error) {
+	var Buffer bytes.Buffer
+
+	if err := unitTemplate.Execute(&Buffer, u); err != nil {
+		return nil, err
+	}
+
+	return Buffer.Bytes(), nil
+}
+
+// Install
+// creates the account of the service, hands it the data folder, writes
+// the unit file and enables the service.
+func (u *Unit) Install() error {
+	Content, err := u.Render()
+	if err != nil {
+		return err
+	}
+
+	if os.Geteuid() != 0 {
+		return errors.New("installing a service requires root")
+	}
+
+	Account, err := u.account()
+	if err != nil {
+		return err
+	}
+
+	/* the teamserver keeps its db, certificates and loot in there */
+	for _, Path := range append([]string{filepath.Join(u.Directory, "data")}, u.Writable...) {
+		if err = os.MkdirAll(Path, 0700); err != nil {
+			return err
+		}
+
+		if err = chown(Path, Account); err != nil {
+			return fmt.Errorf("failed to hand %v to %v: %w", Path, u.User, err)
+		}
+	}
+
+	if err = os.WriteFile(u.Path(), Content, 0644); err != nil {
+		return err
+	}
+
+	if err = Systemctl("daemon-reload"); err != nil {
+		return err
+	}
+
+	return Systemctl("enable", u.Name)
+}
+
+// Uninstall
+// stops and disables the service and removes its unit file. The
+// account and the data of the teamserver are kept.
+func Uninstall(Name string) error {
+	var Path = filepath.Join(UNIT_PATH, Name+".service")
+
+	if _, err := os.Stat(Path); err != nil {
+		return fmt.Errorf("service %v isn't installed: %w", Name, err)
+	}
+
+	if err := Systemctl("disable", "--now", Name); err != nil {
+		return err
+	}
+
+	if err := os.Remove(Path); err != nil {
+		return err
+	}
+
+	return Systemctl("daemon-reload")
+}
+
+// Systemctl
+// runs systemctl with the arguments, passing its output through.
+func Systemctl(Arguments ...string) error {
+	var Command = exec.Command("systemctl", Arguments...)
+
+	Command.Stdout = os.Stdout
+	Command.Stderr = os.Stderr
+
+	if err := Command.Run(); err != nil {
+		return fmt.Errorf("systemctl %v: %w", strings.Join(Arguments, " "), err)
+	}
+
+	return nil
+}
+
+// account
+// returns the account of the service. Creates a system account without
+// a login shell if it doesn't exist.
+func (u *Unit) account() (*user.User, error) {
+	if Account, err := user.Lookup(u.User); err == nil {
+		return Account, nil
+	}
+
+	var Command = exec.Command("useradd", "--system", "--user-group", "--no-create-home", "--home-dir", u.Directory, "--shell", "/usr/sbin/nologin", u.User)
+
+	if Output, err := Command.CombinedOutput(); err != nil {
+		return nil, fmt.Errorf("failed to create the account %v: %v: %s", u.User, err, bytes.TrimSpace(Output))
+	}
+
+	return user.Lookup(u.User)
+}
+
+// chown
+// hands the folder and everything in it to the account.
+func chown(Path string, Account *user.User) error {
+	var Uid, Gid int
+
+	if _, err := fmt.Sscan(Account.Uid, &Uid); err != nil {
+		return err
+	}
+
+	if _, err := fmt.Sscan(Account.Gid, &Gid); err != nil {
+		return err
+	}
+
+	return filepath.Walk(Path, func(Path string, Info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+
+		return os.Lchown(Path, Uid, Gid)
+	})
+}
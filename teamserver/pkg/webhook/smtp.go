@@ -0,0 +1,293 @@
+package webhook
+
+import (
+	"bytes"
+	"crypto/tls"
+	"errors"
+	"fmt"
+	"mime"
+	"net"
+	"net/smtp"
+	"strconv"
+	"strings"
+	"text/template"
+	"time"
+
+	"Havoc/pkg/eventbus"
+)
+
+// tls modes of the connection to the mail server
+const (
+	SMTP_STARTTLS = "starttls"
+	SMTP_TLS      = "tls"
+	SMTP_NONE     = "none"
+)
+
+const (
+	SMTP_PORT    = 587
+	SMTP_TIMEOUT = 30 * time.Second
+
+	SMTP_SUBJECT = "[havoc] {{.Summary}}"
+	SMTP_BODY    = "{{.Summary}}\n\nEvent:     {{.Type}}\nTime:      {{.Time}}\nWorkspace: {{.Workspace}}\n{{range $Key, $Value := .Data}}\n{{$Key}}: {{$Value}}{{end}}\n"
+)
+
+// events mailed if the profile doesn't pick any
+var SmtpEvents = []string{eventbus.NETWORK_NEW, eventbus.TEAMSERVER_ERROR, eventbus.KILLDATE_IMMINENT}
+
+// SmtpOptions
+// mail server, sender and recipients of the alerts.
+type SmtpOptions struct {
+	Host     string
+	Port     int
+	TLS      string
+	Insecure bool
+	Username string
+	Password string
+	From     string
+	To       []string
+	Subject  string
+	Body     string
+	Routes   []SmtpRoute
+}
+
+// SmtpRoute
+// recipients and templates of an event type. empty templates are the
+// ones of the options.
+type SmtpRoute struct {
+	Event   string
+	To      []string
+	Subject string
+	Body    string
+}
+
+// SmtpMail
+// what the templates of a mail get.
+type SmtpMail struct {
+	Type      string
+	Time      string
+	Workspace string
+	Summary   string
+	Data      map[string]any
+}
+
+type smtpRoute struct {
+	To      []string
+	Subject *template.Template
+	Body    *template.Template
+}
+
+// Smtp
+// mails the events to the team.
+type Smtp struct {
+	Options SmtpOptions
+	// describes the event in a line (.Summary). the type of the event if nil
+	Summary func(Event eventbus.Event) string
+
+	routes   map[string]*smtpRoute
+	fallback *smtpRoute
+}
+
+// NewSmtp
+// parses the templates of the options. Events without a route go to To.
+func NewSmtp(Options SmtpOptions) (*Smtp, error) {
+	var (
+		Smtp = &Smtp{Options: Options, routes: make(map[string]*smtpRoute)}
+		err  error
+	)
+
+	if len(Options.Host) == 0 || len(Options.From) == 0 {
+		return nil, errors.New("smtp needs a host and a sender")
+	}
+
+	if Smtp.Options.Port == 0 {
+		Smtp.Options.Port = SMTP_PORT
+	}
+
+	if Smtp.Options.TLS = strings.ToLower(Options.TLS); len(Smtp.Options.TLS) == 0 {
+		Smtp.Options.TLS = SMTP_STARTTLS
+	}
+
+	switch Smtp.Options.TLS {
+	case SMTP_STARTTLS, SMTP_TLS, SMTP_NONE:
+	default:
+		return nil, errors.New("smtp tls has to be starttls, tls or none")
+	}
+
+	if len(Smtp.Options.Subject) == 0 {
+		Smtp.Options.Subject = SMTP_SUBJECT
+	}
+
+	if len(Smtp.Options.Body) == 0 {
+		Smtp.Options.Body = SMTP_BODY
+	}
+
+	if Smtp.fallback, err = smtpRouteParse("smtp", Options.To, Smtp.Options.Subject, Smtp.Options.Body); err != nil {
+		return nil, err
+	}
+
+	for _, Route := range Options.Routes {
+		var (
+			Subject = Route.Subject
+			Body    = Route.Body
+		)
+
+		if len(Route.To) == 0 {
+			return nil, errors.New("smtp route " + Route.Event + " has no recipients")
+		}
+
+		if len(Subject) == 0 {
+			Subject = Smtp.Options.Subject
+		}
+
+		if len(Body) == 0 {
+			Body = Smtp.Options.Body
+		}
+
+		if Smtp.routes[Route.Event], err = smtpRouteParse("smtp route "+Route.Event, Route.To, Subject, Body); err != nil {
+			return nil, err
+		}
+	}
+
+	return Smtp, nil
+}
+
+func smtpRouteParse(Name string, To []string, Subject, Body string) (*smtpRoute, error) {
+	var (
+		Route = &smtpRoute{To: To}
+		err   error
+	)
+
+	if Route.Subject, err = template.New("subject").Option("missingkey=zero").Parse(Subject); err != nil {
+		return nil, fmt.Errorf("%v subject: %v", Name, err)
+	}
+
+	if Route.Body, err = template.New("body").Option("missingkey=zero").Parse(Body); err != nil {
+		return nil, fmt.Errorf("%v body: %v", Name, err)
+	}
+
+	return Route, nil
+}
+
+// Consume
+// mails the event to the recipients of its route.
+func (s *Smtp) Consume(Event eventbus.Event) error {
+	var (
+		Route = s.fallback
+		Mail  = SmtpMail{
+			Type:      Event.Type,
+			Time:      Event.Time.UTC().Format("2006-01-02 15:04:05 UTC"),
+			Workspace: Event.Workspace,
+			Summary:   Event.Type,
+			Data:      Event.Data,
+		}
+		Subject bytes.Buffer
+		Body    bytes.Buffer
+	)
+
+	if Routed, ok := s.routes[Event.Type]; ok {
+		Route = Routed
+	}
+
+	if len(Route.To) == 0 {
+		return nil
+	}
+
+	if s.Summary != nil {
+		Mail.Summary = s.Summary(Event)
+	}
+
+	if err := Route.Subject.Execute(&Subject, Mail); err != nil {
+		return err
+	}
+
+	if err := Route.Body.Execute(&Body, Mail); err != nil {
+		return err
+	}
+
+	return s.Send(Route.To, strings.TrimSpace(Subject.String()), Body.String())
+}
+
+// Send
+// mails the text to the recipients.
+func (s *Smtp) Send(To []string, Subject, Body string) error {
+	var (
+		Address = net.JoinHostPort(s.Options.Host, strconv.Itoa(s.Options.Port))
+		Config  = &tls.Config{ServerName: s.Options.Host, InsecureSkipVerify: s.Options.Insecure}
+		Message bytes.Buffer
+		Conn    net.Conn
+		Client  *smtp.Client
+		err     error
+	)
+
+	/* header injection through the templates or the recipients */
+	if strings.ContainsAny(Subject+s.Options.From+strings.Join(To, ""), "\r\n") {
+		return errors.New("smtp header contains a line break")
+	}
+
+	if s.Options.TLS == SMTP_TLS {
+		Conn, err = tls.DialWithDialer(&net.Dialer{Timeout: SMTP_TIMEOUT}, "tcp", Address, Config)
+	} else {
+		Conn, err = net.DialTimeout("tcp", Address, SMTP_TIMEOUT)
+	}
+	if err != nil {
+		return err
+	}
+
+	Conn.SetDeadline(time.Now().Add(SMTP_TIMEOUT))
+
+	if Client, err = smtp.NewClient(Conn, s.Options.Host); err != nil {
+		Conn.Close()
+		return err
+	}
+	defer Client.Close()
+
+	if s.Options.TLS == SMTP_STARTTLS {
+		if ok, _ := Client.Extension("STARTTLS"); !ok {
+			return errors.New("smtp server " + Address + " doesn't support starttls")
+		}
+
+		if err = Client.StartTLS(Config); err != nil {
+			return err
+		}
+	}
+
+	/* plain auth refuses to send the password unencrypted, except to localhost */
+	if len(s.Options.Username) > 0 {
+		if err = Client.Auth(smtp.PlainAuth("", s.Options.Username, s.Options.Password, s.Options.Host)); err != nil {
+			return err
+		}
+	}
+
+	if err = Client.Mail(s.Options.From); err != nil {
+		return err
+	}
+
+	for _, Recipient := range To {
+		if err = Client.Rcpt(Recipient); err != nil {
+			return err
+		}
+	}
+
+	fmt.Fprintf(&Message, "From: %v\r\n", s.Options.From)
+	fmt.Fprintf(&Message, "To: %v\r\n", strings.Join(To, ", "))
+	fmt.Fprintf(&Message, "Subject: %v\r\n", mime.QEncoding.Encode("utf-8", Subject))
+	fmt.Fprintf(&Message, "Date: %v\r\n", time.Now().Format(time.RFC1123Z))
+	Message.WriteString("MIME-Version: 1.0\r\nContent-Type: text/plain; charset=utf-8\r\n\r\n")
+	Message.WriteString(strings.ReplaceAll(strings.ReplaceAll(Body, "\r\n", "\n"), "\n", "\r\n"))
+
+	Writer, err := Client.Data()
+	if err != nil {
+		return err
+	}
+
+	if _, err = Writer.Write(Message.Bytes()); err != nil {
+		Writer.Close()
+		return err
+	}
+
+	if err = Writer.Close(); err != nil {
+		return err
+	}
+
+	return Client.Quit()
+}
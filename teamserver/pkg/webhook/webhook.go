@@ -7,6 +7,8 @@ import (
 	"io"
 	"net/http"
 	"strconv"
+
+	"Havoc/pkg/eventbus"
 )
 
 type WebHook struct {
@@ -131,6 +133,19 @@ func (w *WebHook) NewAgent(agent map[string]any) error {
 	return nil
 }
 
+// Consume
+// posts the events of the event bus the webhooks handle.
+func (w *WebHook) Consume(Event eventbus.Event) error {
+	switch Event.Type {
+
+	case eventbus.SESSION_NEW:
+		return w.NewAgent(Event.Data)
+
+	}
+
+	return nil
+}
+
 func (w *WebHook) SetDiscord(AvatarUrl, User, Url string) {
 	w.Discord.Avatar = AvatarUrl
 	w.Discord.User = User
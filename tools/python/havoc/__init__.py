@@ -0,0 +1,17 @@
+"""Python bindings of the Havoc teamserver.
+
+    from havoc import Client
+
+    with Client("127.0.0.1:40056", "bot", "password1234") as client:
+        for agent in client.agents():
+            task = client.shell(agent.id, "whoami")
+            print(client.await_task(task, timeout=60).output)
+
+protocol is generated from the packet definitions of the teamserver
+(havoc sdk python), the client mirrors the Go sdk (teamserver/pkg/sdk).
+"""
+
+from . import protocol
+from .client import Agent, Client, File, HavocError, Output, parse_output
+
+__all__ = ["Agent", "Client", "File", "HavocError", "Output", "parse_output", "protocol"]
@@ -0,0 +1,202 @@
+"""Minimal websocket client (RFC 6455) on top of the standard library.
+
+Only what the operator api of the teamserver needs: tls, binary and text
+messages, fragmentation, ping/pong and close.
+"""
+
+import base64
+import hashlib
+import os
+import socket
+import struct
+import threading
+
+OPCODE_CONTINUATION = 0x0
+OPCODE_TEXT = 0x1
+OPCODE_BINARY = 0x2
+OPCODE_CLOSE = 0x8
+OPCODE_PING = 0x9
+OPCODE_PONG = 0xA
+
+_GUID = b"258EAFA5-E914-47DA-95CA-C5AB0DC85B11"
+
+
+class WebSocketError(Exception):
+    pass
+
+
+class WebSocketClosed(WebSocketError):
+    pass
+
+
+class WebSocket:
+    def __init__(self, sock):
+        self._sock = sock
+        self._buffer = b""
+        self._write_lock = threading.Lock()
+        self.closed = False
+
+    @classmethod
+    def connect(cls, host, port, path, context, timeout=None):
+        """Dials host:port over tls and upgrades the connection."""
+        raw = socket.create_connection((host, port), timeout=timeout)
+
+        try:
+            sock = context.wrap_socket(raw, server_hostname=host)
+        except Exception:
+            raw.close()
+            raise
+
+        key = base64.b64encode(os.urandom(16))
+        request = (
+            "GET %s HTTP/1.1\r\n"
+            "Host: %s:%d\r\n"
+            "Upgrade: websocket\r\n"
+            "Connection: Upgrade\r\n"
+            "Sec-WebSocket-Key: %s\r\n"
+            "Sec-WebSocket-Version: 13\r\n"
+            "\r\n" % (path, host, port, key.decode())
+        )
+
+        ws = cls(sock)
+
+        try:
+            sock.sendall(request.encode())
+
+            head = ws._read_until(b"\r\n\r\n").decode("latin-1")
+            status, _, fields = head.partition("\r\n")
+
+            if " 101 " not in status + " ":
+                raise WebSocketError("teamserver refused the websocket: " + status)
+
+            headers = {}
+            for line in fields.split("\r\n"):
+                name, _, value = line.partition(":")
+                headers[name.strip().lower()] = value.strip()
+
+            accept = base64.b64encode(hashlib.sha1(key + _GUID).digest()).decode()
+            if headers.get("sec-websocket-accept") != accept:
+                raise WebSocketError("invalid Sec-WebSocket-Accept of the teamserver")
+        except Exception:
+            sock.close()
+            raise
+
+        return ws
+
+    def settimeout(self, timeout):
+        self._sock.settimeout(timeout)
+
+    def peer_certificate(self):
+        """The certificate of the teamserver (DER)."""
+        return self._sock.getpeercert(binary_form=True)
+
+    def _read(self, size):
+        while len(self._buffer) < size:
+            data = self._sock.recv(max(size - len(self._buffer), 4096))
+            if not data:
+                raise WebSocketClosed("connection closed")
+            self._buffer += data
+
+        data, self._buffer = self._buffer[:size], self._buffer[size:]
+        return data
+
+    def _read_until(self, delimiter):
+        while delimiter not in self._buffer:
+            data = self._sock.recv(4096)
+            if not data:
+                raise WebSocketClosed("connection closed")
+            self._buffer += data
+
+        data, _, self._buffer = self._buffer.partition(delimiter)
+        return data
+
+    def _frame(self):
+        first, second = struct.unpack("!BB", self._read(2))
+        length = second & 0x7F
+
+        if length == 126:
+            length = struct.unpack("!H", self._read(2))[0]
+        elif length == 127:
+            length = struct.unpack("!Q", self._read(8))[0]
+
+        mask = self._read(4) if second & 0x80 else None
+        payload = self._read(length)
+
+        if mask:
+            payload = _mask(mask, payload)
+
+        return bool(first & 0x80), first & 0x0F, payload
+
+    def send(self, payload, opcode=OPCODE_BINARY):
+        if isinstance(payload, str):
+            payload = payload.encode()
+
+        header = bytes([0x80 | opcode])
+        length = len(payload)
+
+        # frames of clients are always masked
+        if length < 126:
+            header += bytes([0x80 | length])
+        elif length < 1 << 16:
+            header += bytes([0x80 | 126]) + struct.pack("!H", length)
+        else:
+            header += bytes([0x80 | 127]) + struct.pack("!Q", length)
+
+        mask = os.urandom(4)
+
+        with self._write_lock:
+            if self.closed:
+                raise WebSocketClosed("connection closed")
+            self._sock.sendall(header + mask + _mask(mask, payload))
+
+    def recv(self):
+        """Returns the next message. Answers pings on its way."""
+        message, opcode = b"", None
+
+        while True:
+            fin, frame_opcode, payload = self._frame()
+
+            if frame_opcode == OPCODE_PING:
+                self.send(payload, OPCODE_PONG)
+                continue
+
+            if frame_opcode == OPCODE_PONG:
+                continue
+
+            if frame_opcode == OPCODE_CLOSE:
+                code = struct.unpack("!H", payload[:2])[0] if len(payload) >= 2 else 1005
+                try:
+                    self.send(payload[:2], OPCODE_CLOSE)
+                except (OSError, WebSocketError):
+                    pass
+                self.closed = True
+                raise WebSocketClosed("teamserver closed the connection (%d)" % code)
+
+            if frame_opcode != OPCODE_CONTINUATION:
+                opcode = frame_opcode
+
+            message += payload
+
+            if fin:
+                return message if opcode == OPCODE_BINARY else message.decode()
+
+    def close(self):
+        try:
+            self.send(struct.pack("!H", 1000), OPCODE_CLOSE)
+        except (OSError, WebSocketError):
+            pass
+
+        self.closed = True
+
+        try:
+            self._sock.shutdown(socket.SHUT_RDWR)
+        except OSError:
+            pass
+
+        self._sock.close()
+
+
+def _mask(mask, payload):
+    # xor with the mask repeated over the payload, as one big integer
+    repeated = (mask * (len(payload) // 4 + 1))[: len(payload)]
+    return (int.from_bytes(payload, "big") ^ int.from_bytes(repeated, "big")).to_bytes(len(payload), "big")
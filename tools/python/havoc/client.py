@@ -0,0 +1,777 @@
+"""Client of the operator api of the teamserver.
+
+Port of the Go sdk (teamserver/pkg/sdk): it speaks the packet format of
+the operator client over the websocket of the teamserver and queries the
+loot over its GraphQL endpoint.
+"""
+
+import base64
+import hashlib
+import http.client
+import json
+import queue
+import ssl
+import threading
+import time
+import uuid
+from dataclasses import dataclass, field
+from typing import Callable, Dict, List, Optional
+
+from . import protocol
+from ._websocket import WebSocket, WebSocketClosed, WebSocketError
+
+# how long the login to the teamserver may take by default (seconds)
+LOGIN_TIMEOUT = 30
+
+# outputs of a task await_task keeps till it gets called
+TASK_OUTPUTS = 16
+
+
+class HavocError(Exception):
+    pass
+
+
+@dataclass
+class Agent:
+    """A session as the teamserver announces it."""
+
+    id: str
+    hostname: str = ""
+    username: str = ""
+    domain_name: str = ""
+    internal_ip: str = ""
+    external_ip: str = ""
+    process_name: str = ""
+    process_pid: str = ""
+    process_arch: str = ""
+    os_version: str = ""
+    elevated: str = ""
+    workspace: str = ""
+    first_call_in: str = ""
+    last_call_in: str = ""
+    sleep_delay: int = 0
+    sleep_jitter: int = 0
+    magic_value: str = ""
+    active: bool = True
+
+
+# fields of the session packages and the attributes of Agent they fill
+_AGENT_FIELDS = {
+    "NameID": "id",
+    "Hostname": "hostname",
+    "Username": "username",
+    "DomainName": "domain_name",
+    "InternalIP": "internal_ip",
+    "ExternalIP": "external_ip",
+    "ProcessName": "process_name",
+    "ProcessPID": "process_pid",
+    "ProcessArch": "process_arch",
+    "OSVersion": "os_version",
+    "Elevated": "elevated",
+    "Workspace": "workspace",
+    "FirstCallIn": "first_call_in",
+    "LastCallIn": "last_call_in",
+    "SleepDelay": "sleep_delay",
+    "SleepJitter": "sleep_jitter",
+    "MagicValue": "magic_value",
+}
+
+
+@dataclass
+class Output:
+    """What an agent printed. task_id is set if the output answers a task."""
+
+    agent_id: str
+    task_id: str
+    command_id: int
+
+    # Good, Info, Error or Warning
+    type: str
+    message: str
+    output: str
+
+    # the raw fields of the output (eg: MiscType and MiscData of files)
+    fields: Dict[str, str] = field(default_factory=dict)
+
+    # kind of the failure of an Error (protocol.ERROR_CODE_*), the win32 error
+    # or ntstatus the agent reported is in the ErrorStatus and ErrorName fields
+    error_code: str = ""
+
+    # chunk of the output of a task that is still running. sequence orders
+    # the chunks of the task, final marks the last one
+    partial: bool = False
+    sequence: int = 0
+    final: bool = False
+
+    def file(self) -> Optional["File"]:
+        """The file the output carries, if it's the end of a download."""
+        transfer = self.fields.get("Transfer", "")
+
+        if self.fields.get("MiscType") == "downloadComplete":
+            name, _, size = self.fields.get("MiscData2", "").partition(";")
+
+            try:
+                data = base64.b64decode(self.fields.get("MiscData", ""))
+                name = base64.b64decode(name).decode(errors="replace")
+            except ValueError:
+                return None
+
+            return File(self.agent_id, self.task_id, name, int(size or 0), data, transfer)
+
+        if transfer:
+            return File(self.agent_id, self.task_id, transfer.rsplit("/", 1)[-1], 0, None, transfer)
+
+        return None
+
+
+@dataclass
+class File:
+    """A file downloaded from an agent. data holds its content if the
+    teamserver sent it inline. Files too big for that stay on the
+    teamserver and have to be fetched from transfer with Client.fetch."""
+
+    agent_id: str
+    task_id: str
+    name: str
+    size: int
+    data: Optional[bytes]
+    transfer: str
+
+
+def parse_output(package) -> Optional[Output]:
+    """Decodes the output of an agent from its session package."""
+    head, body = package.get("Head", {}), package.get("Body", {})
+
+    if head.get("Event") != protocol.Session.TYPE or body.get("SubEvent") != protocol.Session.OUTPUT:
+        return None
+
+    info = body.get("Info") or {}
+
+    try:
+        fields = json.loads(base64.b64decode(info.get("Output", "")))
+        command_id = int(info.get("CommandID", 0))
+    except ValueError:
+        return None
+
+    if not isinstance(fields, dict):
+        return None
+
+    return Output(
+        agent_id=info.get("DemonID", ""),
+        task_id=fields.get("TaskID", ""),
+        command_id=command_id,
+        type=fields.get("Type", ""),
+        message=fields.get("Message", ""),
+        output=fields.get("Output", ""),
+        fields=fields,
+        error_code=fields.get("ErrorCode", ""),
+        partial=fields.get("Partial", "") == "true",
+        sequence=int(fields.get("Sequence", "") or 0),
+        final=fields.get("Final", "") == "true",
+    )
+
+
+def _event(event) -> int:
+    # protocol.Session as well as protocol.Session.TYPE
+    return getattr(event, "TYPE", event)
+
+
+class Client:
+    """An authenticated session on the teamserver.
+
+    Subscribe to the packages of interest before connecting: the
+    teamserver replays its state (agents, listeners, history) after the
+    login, so handlers subscribed before connect get called for what
+    happened before too. Handlers get called one after the other from the
+    thread reading the connection, block them and no other package gets
+    read.
+    """
+
+    def __init__(self, address, user, password, prefix="", fingerprint="", timeout=LOGIN_TIMEOUT, token="", directory=False):
+        # host:port of the teamserver or of a relay
+        self.address = address
+        self.user = user
+        self.password = password
+
+        # id token of the identity provider of the teamserver, for operators of the provider
+        self.token = token
+
+        # the account is one of the directory of the teamserver, which needs the
+        # password in the clear. only use it with the fingerprint
+        self.directory = directory
+
+        # path prefix of the operator api behind a cdn or reverse proxy (eg: /a8f3c1)
+        self.prefix = prefix
+
+        # sha256 fingerprint (hex) of the certificate of the teamserver. not verified if empty
+        self.fingerprint = fingerprint.replace(":", "").lower()
+
+        self.timeout = timeout
+
+        # role and workspace the teamserver gave the account
+        self.role = ""
+        self.workspace = ""
+
+        self._connection = None
+        self._lock = threading.Lock()
+        self._subscriptions = []
+        self._agents = {}
+        self._tasks = {}
+        self._reader = None
+        self._done = threading.Event()
+        self._error = None
+        self._closed = False
+
+    def __enter__(self):
+        self.connect()
+        return self
+
+    def __exit__(self, *_):
+        self.close()
+
+    @property
+    def host(self):
+        host, _, port = self.address.rpartition(":")
+        return host.strip("[]"), int(port)
+
+    def _context(self):
+        # the teamserver generates a self signed certificate by default, so
+        # only the fingerprint (if specified) gets checked.
+        context = ssl.create_default_context()
+        context.check_hostname = False
+        context.verify_mode = ssl.CERT_NONE
+        return context
+
+    def _verify(self, certificate):
+        if not self.fingerprint:
+            return
+
+        if certificate is None:
+            raise HavocError("teamserver sent no certificate")
+
+        if hashlib.sha256(certificate).hexdigest() != self.fingerprint:
+            raise HavocError("certificate of the teamserver doesn't match the fingerprint")
+
+    def connect(self):
+        """Dials the teamserver and logs in. Packages are dispatched to the
+        handlers from then on till the connection drops."""
+        host, port = self.host
+
+        self._connection = WebSocket.connect(host, port, self.prefix + "/havoc/", self._context(), self.timeout)
+
+        try:
+            self._verify(self._connection.peer_certificate())
+
+            info = {
+                "User": self.user,
+                "Password": hashlib.sha3_256(self.password.encode()).hexdigest(),
+            }
+
+            if self.directory:
+                info["Secret"] = self.password
+
+            if self.token:
+                info["Token"] = self.token
+
+            self.send(protocol.InitConnection.TYPE, protocol.InitConnection.OAUTH_REQUEST, info)
+
+            authenticated = json.loads(self._connection.recv())
+            head, body = authenticated.get("Head", {}), authenticated.get("Body", {})
+
+            if head.get("Event") != protocol.InitConnection.TYPE or body.get("SubEvent") != protocol.InitConnection.SUCCESS:
+                raise HavocError("teamserver refused %s: %s" % (self.user, (body.get("Info") or {}).get("Message")))
+        except Exception:
+            self._connection.close()
+            raise
+
+        self.role = body["Info"].get("Role", "")
+        self.workspace = body["Info"].get("Workspace", "")
+
+        # operators of the identity provider are named by their token
+        self.user = body["Info"].get("User") or self.user
+
+        self._connection.settimeout(None)
+
+        self._reader = threading.Thread(target=self._read, name="havoc-client", daemon=True)
+        self._reader.start()
+
+    def send(self, event, sub_event, info):
+        """Sends a package to the teamserver. The teamserver sets the user
+        and the workspace of the package itself."""
+        if self._connection is None:
+            raise HavocError("not connected to the teamserver")
+
+        self._connection.send(json.dumps({
+            "Head": {
+                "Event": _event(event),
+                "User": self.user,
+                "Time": time.strftime("%d/%m/%Y %H:%M:%S"),
+            },
+            "Body": {
+                "SubEvent": sub_event,
+                "Info": info,
+            },
+        }))
+
+    def subscribe(self, event, handler: Callable[[dict], None]) -> Callable[[], None]:
+        """Calls the handler with every package of the event (eg:
+        protocol.Session) the teamserver sends. An event of 0 subscribes to
+        every package. Returns the function that cancels the subscription."""
+        subscription = (_event(event), handler)
+
+        with self._lock:
+            self._subscriptions.append(subscription)
+
+        def unsubscribe():
+            with self._lock:
+                if subscription in self._subscriptions:
+                    self._subscriptions.remove(subscription)
+
+        return unsubscribe
+
+    def _read(self):
+        try:
+            while True:
+                package = json.loads(self._connection.recv())
+
+                if package.get("Head", {}).get("Event") == protocol.Session.TYPE:
+                    self._session(package)
+
+                with self._lock:
+                    subscriptions = list(self._subscriptions)
+
+                for event, handler in subscriptions:
+                    if event == 0 or event == package.get("Head", {}).get("Event"):
+                        handler(package)
+        except (OSError, ValueError, WebSocketError) as error:
+            with self._lock:
+                if not self._closed:
+                    self._error = error
+        finally:
+            self._done.set()
+
+    def _session(self, package):
+        body = package.get("Body", {})
+        info = body.get("Info") or {}
+        sub_event = body.get("SubEvent")
+
+        if sub_event == protocol.Session.NEW_SESSION:
+            if not info.get("NameID"):
+                return
+
+            agent = Agent(id=info["NameID"])
+
+            for name, attribute in _AGENT_FIELDS.items():
+                if name in info:
+                    value = info[name]
+                    setattr(agent, attribute, int(value or 0) if attribute.startswith("sleep_") else str(value))
+
+            agent.active = str(info.get("Active")) != "false"
+
+            with self._lock:
+                self._agents[agent.id] = agent
+
+        elif sub_event == protocol.Session.MARK_AS_DEAD:
+            with self._lock:
+                agent = self._agents.get(info.get("AgentID"))
+                if agent:
+                    agent.active = info.get("Marked") != "Dead"
+
+        elif sub_event == protocol.Session.REMOVE:
+            with self._lock:
+                self._agents.pop(info.get("AgentID"), None)
+
+        elif sub_event == protocol.Session.OUTPUT:
+            output = parse_output(package)
+
+            if output is None:
+                return
+
+            if output.command_id != protocol.COMMAND_NOJOB:
+                with self._lock:
+                    outputs = self._tasks.get(output.task_id)
+
+                if outputs is not None:
+                    try:
+                        outputs.put_nowait(output)
+                    except queue.Full:
+                        pass
+                return
+
+            # the check-ins of the agents
+            with self._lock:
+                agent = self._agents.get(output.agent_id)
+                if agent:
+                    agent.last_call_in = output.fields.get("Last", agent.last_call_in)
+                    agent.sleep_delay = int(output.fields.get("Sleep") or 0)
+                    agent.sleep_jitter = int(output.fields.get("Jitter") or 0)
+
+    def wait(self, timeout=None):
+        """Blocks till the connection to the teamserver drops or the client
+        gets closed. Raises the error the connection dropped with."""
+        if not self._done.wait(timeout):
+            return False
+
+        with self._lock:
+            if self._error is not None:
+                raise HavocError("connection to the teamserver dropped: %s" % self._error)
+
+        return True
+
+    @property
+    def done(self):
+        return self._done.is_set()
+
+    def close(self):
+        """Logs out of the teamserver."""
+        if self._connection is None:
+            return
+
+        with self._lock:
+            self._closed = True
+
+        self._connection.close()
+
+        if self._reader is not None:
+            self._reader.join(self.timeout)
+
+    # agents and tasks
+
+    def agents(self) -> List[Agent]:
+        """The agents the teamserver announced so far."""
+        with self._lock:
+            return [Agent(**vars(agent)) for agent in self._agents.values()]
+
+    def agent(self, agent_id) -> Optional[Agent]:
+        with self._lock:
+            agent = self._agents.get(agent_id)
+            return Agent(**vars(agent)) if agent else None
+
+    def on_agent(self, handler: Callable[[Agent], None]):
+        """Calls the handler with every agent the teamserver announces."""
+
+        def new_session(package):
+            body = package.get("Body", {})
+
+            if body.get("SubEvent") == protocol.Session.NEW_SESSION:
+                agent = self.agent((body.get("Info") or {}).get("NameID"))
+                if agent:
+                    handler(agent)
+
+        return self.subscribe(protocol.Session, new_session)
+
+    def on_output(self, handler: Callable[[Output], None]):
+        """Calls the handler with everything the agents print. Check-ins of
+        the agents aren't passed on."""
+
+        def output(package):
+            parsed = parse_output(package)
+            if parsed is not None and parsed.command_id != protocol.COMMAND_NOJOB:
+                handler(parsed)
+
+        return self.subscribe(protocol.Session, output)
+
+    def await_task(self, task_id, timeout=None) -> Output:
+        """Waits for the next output that answers the task. Outputs arriving
+        before await_task got called aren't lost. Use on_output to follow
+        tasks that print more than TASK_OUTPUTS outputs."""
+        with self._lock:
+            outputs = self._tasks.get(task_id)
+
+        if outputs is None:
+            raise HavocError("task %s wasn't created by this client" % task_id)
+
+        deadline = None if timeout is None else time.monotonic() + timeout
+
+        while True:
+            try:
+                return outputs.get(timeout=0.5)
+            except queue.Empty:
+                pass
+
+            if self._done.is_set():
+                raise HavocError("connection to the teamserver dropped")
+
+            if deadline is not None and time.monotonic() > deadline:
+                raise TimeoutError("no output of task %s" % task_id)
+
+    def forget(self, task_id):
+        """Stops keeping the outputs of the task for await_task."""
+        with self._lock:
+            self._tasks.pop(task_id, None)
+
+    def task(self, agent_id, command, command_line, arguments=None) -> str:
+        """Tasks the agent with the command (protocol.COMMANDS or its id).
+        arguments are the fields the command expects, the same the
+        operator client sends. Returns the id of the task its output gets
+        tagged with."""
+        if isinstance(command, str):
+            command = protocol.COMMANDS[command]
+
+        task_id = uuid.uuid4().hex[:8].upper()
+        info = {
+            "DemonID": agent_id,
+            "TaskID": task_id,
+            "CommandID": str(command),
+            "CommandLine": command_line,
+        }
+
+        if self.agent(agent_id) is None:
+            raise HavocError("agent %s not found" % agent_id)
+
+        info.update(arguments or {})
+
+        with self._lock:
+            self._tasks[task_id] = queue.Queue(TASK_OUTPUTS)
+
+        try:
+            self.send(protocol.Session, protocol.Session.INPUT, info)
+        except Exception:
+            self.forget(task_id)
+            raise
+
+        return task_id
+
+    def shell(self, agent_id, command) -> str:
+        """Runs the command with cmd.exe on the agent."""
+        arguments = base64.b64encode(("/c " + command).encode()).decode()
+
+        return self.task(agent_id, protocol.COMMAND_PROC, "shell " + command, {
+            "ProcCommand": str(protocol.DEMON_COMMAND_PROC_CREATE),
+            "Args": "0;FALSE;TRUE;c:\\windows\\system32\\cmd.exe;" + arguments,
+        })
+
+    def sleep(self, agent_id, delay, jitter=0) -> str:
+        """Changes the sleep (seconds) and jitter (percent) of the agent."""
+        return self.task(agent_id, protocol.COMMAND_SLEEP, "sleep %d %d" % (delay, jitter), {
+            "Arguments": "%d;%d" % (delay, jitter),
+        })
+
+    def checkin(self, agent_id) -> str:
+        """Asks the agent for its metadata again."""
+        return self.task(agent_id, protocol.COMMAND_CHECKIN, "checkin")
+
+    def exit(self, agent_id, process=False) -> str:
+        """Tells the agent to exit its thread or its process."""
+        method = "process" if process else "thread"
+
+        return self.task(agent_id, protocol.COMMAND_EXIT, "exit " + method, {
+            "ExitMethod": method,
+        })
+
+    # files and loot
+
+    def on_file(self, handler: Callable[[File], None]):
+        """Calls the handler with every file downloaded from the agents,
+        including the ones downloaded in segments."""
+
+        def output(parsed):
+            downloaded = parsed.file()
+            if downloaded is not None:
+                handler(downloaded)
+
+        def segmented(package):
+            body = package.get("Body", {})
+            info = body.get("Info") or {}
+
+            if body.get("SubEvent") != protocol.Download.FINISHED:
+                return
+
+            # too big to be sent inline if there's no data
+            data = base64.b64decode(info["Data"]) if info.get("Data") else None
+
+            handler(File("", "", info.get("Name", ""), len(data or b""), data, info.get("Transfer", "")))
+
+        unsubscribe = [self.on_output(output), self.subscribe(protocol.Download, segmented)]
+
+        return lambda: [cancel() for cancel in unsubscribe]
+
+    def download(self, agent_id, path) -> str:
+        """Tasks the agent to download the file. The file arrives at the
+        handlers of on_file (or as the output await_task returns)."""
+        return self.task(agent_id, protocol.COMMAND_FS, "download " + path, {
+            "SubCommand": "download",
+            "Arguments": base64.b64encode(path.encode()).decode(),
+        })
+
+    def upload(self, agent_id, path, content: bytes) -> str:
+        """Tasks the agent to write the content to the path."""
+        return self.task(agent_id, protocol.COMMAND_FS, "upload " + path, {
+            "SubCommand": "upload",
+            "Arguments": base64.b64encode(path.encode()).decode() + ";" + base64.b64encode(content).decode(),
+        })
+
+    def _request(self, method, path, body=None, headers=None):
+        host, port = self.host
+        connection = http.client.HTTPSConnection(host, port, timeout=self.timeout, context=self._context())
+        connection.connect()
+
+        try:
+            self._verify(connection.sock.getpeercert(binary_form=True))
+        except Exception:
+            connection.close()
+            raise
+
+        # operators of the identity provider authenticate with their token
+        credentials = base64.b64encode(("%s:%s" % (self.user, self.token or self.password)).encode()).decode()
+        headers = dict(headers or {}, Authorization="Basic " + credentials)
+
+        connection.request(method, path, body=body, headers=headers)
+
+        return connection, connection.getresponse()
+
+    def fetch(self, transfer, writer, offset=0):
+        """Streams a file the teamserver keeps (the transfer of a File) to
+        the writer. offset resumes an interrupted fetch."""
+        connection, response = self._request("GET", transfer, headers={"Range": "bytes=%d-" % offset} if offset > 0 else None)
+
+        try:
+            if response.status not in (200, 206):
+                raise HavocError("teamserver answered the fetch of %s with %d %s" % (transfer, response.status, response.reason))
+
+            if offset > 0 and response.status != 206:
+                raise HavocError("teamserver can't resume the fetch of %s" % transfer)
+
+            while True:
+                chunk = response.read(1 << 16)
+                if not chunk:
+                    break
+                writer.write(chunk)
+        finally:
+            connection.close()
+
+    def query(self, query, variables=None):
+        """Runs a GraphQL query against the teamserver (Server GraphQL has
+        to be enabled in its profile) and returns its data."""
+        connection, response = self._request(
+            "POST", self.prefix + "/havoc/graphql",
+            body=json.dumps({"query": query, "variables": variables or {}}),
+            headers={"Content-Type": "application/json"},
+        )
+
+        try:
+            if response.status != 200:
+                raise HavocError("teamserver answered the query with %d %s" % (response.status, response.reason))
+
+            result = json.loads(response.read())
+        finally:
+            connection.close()
+
+        if result.get("errors"):
+            raise HavocError("; ".join(error.get("message", "") for error in result["errors"]))
+
+        return result.get("data") or {}
+
+    def loot(self, agent_id=None) -> List[dict]:
+        """The loot (downloads, screenshots, outputs and recordings) of the
+        agents, or of one agent."""
+        data = self.query(
+            "query ($agentId: String) { loot(agentId: $agentId) { agentId type name path size time } }",
+            {"agentId": agent_id} if agent_id else {},
+        )
+
+        return data.get("loot") or []
+
+    def fetch_loot(self, agent_id, type, name, timeout=LOGIN_TIMEOUT) -> bytes:
+        """Returns the content of a loot. Loot too big to be sent over the
+        websocket has to be fetched with fetch."""
+        answer = queue.Queue()
+
+        def loot(package):
+            info = package.get("Body", {}).get("Info") or {}
+            if (info.get("DemonID"), info.get("Type"), info.get("Name")) == (agent_id, type, name):
+                answer.put(base64.b64decode(info.get("Data", "")))
+
+        def log(package):
+            text = (package.get("Body", {}).get("Info") or {}).get("Text", "")
+            if text.startswith("Failed to fetch loot") or text.startswith("Loot %s is too big" % name):
+                answer.put(HavocError(text))
+
+        unsubscribe = [self.subscribe(protocol.Loot, loot), self.subscribe(protocol.Teamserver, log)]
+
+        try:
+            self.send(protocol.Loot, protocol.Loot.FETCH, {"DemonID": agent_id, "Type": type, "Name": name})
+
+            try:
+                result = answer.get(timeout=timeout)
+            except queue.Empty:
+                raise TimeoutError("teamserver didn't answer the fetch of %s" % name) from None
+        finally:
+            for cancel in unsubscribe:
+                cancel()
+
+        if isinstance(result, Exception):
+            raise result
+
+        return result
+
+    def on_alert(self, handler: Callable[[dict], None]):
+        """Calls the handler with every alert the teamserver notifies the
+        operator of right away (Type, Time, Workspace, Critical, Summary and
+        Data)."""
+
+        def alert(package):
+            body = package.get("Body", {})
+            if body.get("SubEvent") == protocol.Notification.ALERT:
+                handler((body.get("Info") or {}).get("Alert") or {})
+
+        return self.subscribe(protocol.Notification, alert)
+
+    def on_digest(self, handler: Callable[[List[dict], int], None]):
+        """Calls the handler with the alerts held back by the digest or the
+        quiet hours of the operator, and the number of the ones dropped."""
+
+        def digest(package):
+            body = package.get("Body", {})
+            if body.get("SubEvent") == protocol.Notification.DIGEST:
+                info = body.get("Info") or {}
+                handler(info.get("Alerts") or [], int(info.get("Dropped") or 0))
+
+        return self.subscribe(protocol.Notification, digest)
+
+    def notify_preferences(self, timeout=LOGIN_TIMEOUT) -> dict:
+        """What the operator gets notified of and when (Muted, Digest,
+        QuietHours, TimeZone and Groups)."""
+        return self._notify(protocol.Notification.PREFERENCES, {}, timeout)
+
+    def set_notify_preferences(self, muted=(), digest="", quiet_hours="", time_zone="", groups=(), timeout=LOGIN_TIMEOUT) -> dict:
+        """Replaces the notification preferences of the operator, eg: a digest
+        of "1h" or quiet hours of "22:00-07:00". With groups the operator is
+        only notified of the agents of these agent groups. Listener down and
+        kill date alerts are critical and can't be muted or held back."""
+        return self._notify(
+            protocol.Notification.SET,
+            {"Muted": list(muted), "Digest": digest, "QuietHours": quiet_hours, "TimeZone": time_zone, "Groups": list(groups)},
+            timeout,
+        )
+
+    def _notify(self, sub_event, info, timeout) -> dict:
+        answer = queue.Queue()
+
+        def preferences(package):
+            body = package.get("Body", {})
+            if body.get("SubEvent") == protocol.Notification.PREFERENCES:
+                answer.put((body.get("Info") or {}).get("Preferences") or {})
+
+        def log(package):
+            text = (package.get("Body", {}).get("Info") or {}).get("Text", "")
+            if text.startswith("Failed to set notification preferences"):
+                answer.put(HavocError(text))
+
+        unsubscribe = [self.subscribe(protocol.Notification, preferences), self.subscribe(protocol.Teamserver, log)]
+
+        try:
+            self.send(protocol.Notification, sub_event, info)
+
+            try:
+                result = answer.get(timeout=timeout)
+            except queue.Empty:
+                raise TimeoutError("teamserver didn't answer with the notification preferences") from None
+        finally:
+            for cancel in unsubscribe:
+                cancel()
+
+        if isinstance(result, Exception):
+            raise result
+
+        return result
@@ -0,0 +1,386 @@
+# generated from the packet definitions of the teamserver with:
+#   havoc sdk python > tools/python/havoc/protocol.py
+# don't edit.
+
+# events (Head.Event) and their sub events (Body.SubEvent)
+
+
+class InitConnection:
+    TYPE = 0x1
+    OAUTH_REQUEST = 0x3
+    SUCCESS = 0x1
+    ERROR = 0x2
+    INIT_INFO = 0x4
+    PROFILE = 0x5
+
+
+class Listener:
+    TYPE = 0x2
+    ADD = 0x1
+    REMOVE = 0x3
+    EDIT = 0x2
+    MARK = 0x4
+    ERROR = 0x5
+    TEMPLATE_SAVE = 0x6
+    TEMPLATE_REMOVE = 0x7
+    TEMPLATE_LIST = 0x8
+    CLONE = 0x9
+    EGRESS = 0xa
+
+
+class Chat:
+    TYPE = 0x4
+    NEW_MESSAGE = 0x1
+    NEW_LISTENER = 0x2
+    NEW_SESSION = 0x3
+    NEW_USER = 0x4
+    USER_DISCONNECTED = 0x5
+
+
+class Credentials:
+    TYPE = 0x3
+    ADD = 0x1
+    EDIT = 0x2
+    REMOVE = 0x3
+    LIST = 0x4
+    COOKIES = 0x5
+    EXPORT = 0x6
+    IMPORT = 0x7
+
+
+class HostFile:
+    TYPE = 0x6
+    ADD = 0x1
+    REMOVE = 0x2
+
+
+class Session:
+    TYPE = 0x7
+    NEW_SESSION = 0x1
+    INPUT = 0x3
+    OUTPUT = 0x4
+    REMOVE = 0x2
+    MARK_AS_DEAD = 0x5
+
+
+class Gate:
+    TYPE = 0x5
+    STAGED = 0x1
+    STAGELESS = 0x2
+    MS_OFFICE = 0x3
+
+
+class Module:
+    TYPE = 0x6
+    REGISTER = 0x1
+    UNLOAD = 0x2
+    CALL = 0x3
+
+
+class Service:
+    TYPE = 0x9
+    REGISTER_AGENT = 0x1
+    REGISTER_LISTENER = 0x2
+
+
+class Misc:
+    TYPE = 0x7
+    MESSAGE_BOX = 0x1
+
+
+class Teamserver:
+    TYPE = 0x10
+    LOG = 0x1
+    PROFILE = 0x2
+    CRASH = 0x3
+
+
+class Infra:
+    TYPE = 0x11
+    BURN = 0x1
+    RESTORE = 0x2
+    LIST = 0x3
+
+
+class Bundle:
+    TYPE = 0x12
+    EXPORT = 0x1
+    IMPORT = 0x2
+    KEY = 0x3
+
+
+class Export:
+    TYPE = 0x13
+    STIX = 0x1
+    TIMELINE = 0x2
+
+
+class Snapshot:
+    TYPE = 0x14
+    LIST = 0x1
+    DIFF = 0x2
+
+
+class Loot:
+    TYPE = 0x15
+    FETCH = 0x1
+
+
+class Download:
+    TYPE = 0x16
+    SEGMENTED = 0x1
+    STATUS = 0x2
+    FINISHED = 0x3
+
+
+class Archive:
+    TYPE = 0x17
+    LIST = 0x1
+    ADD = 0x2
+    RESTORE = 0x3
+
+
+class Search:
+    TYPE = 0x18
+    QUERY = 0x1
+
+
+class Preset:
+    TYPE = 0x19
+    LIST = 0x1
+    ADD = 0x2
+    REMOVE = 0x3
+
+
+class Script:
+    TYPE = 0x1a
+    LIST = 0x1
+    ADD = 0x2
+    REMOVE = 0x3
+
+
+class Lateral:
+    TYPE = 0x1b
+    MOVE = 0x1
+    LIST = 0x2
+    METHODS = 0x3
+
+
+class SSH:
+    TYPE = 0x1c
+    CONNECT = 0x1
+    DISCONNECT = 0x2
+    LIST = 0x3
+
+
+class Directory:
+    TYPE = 0x1d
+    LIST = 0x1
+
+
+class Blocklist:
+    TYPE = 0x1e
+    LIST = 0x1
+    ADD = 0x2
+    REMOVE = 0x3
+
+
+class Approval:
+    TYPE = 0x1f
+    LIST = 0x1
+    APPROVE = 0x2
+    DENY = 0x3
+
+
+class Template:
+    TYPE = 0x20
+    LIST = 0x1
+    ADD = 0x2
+    REMOVE = 0x3
+    EXECUTE = 0x4
+
+
+class Batch:
+    TYPE = 0x21
+    TASK = 0x1
+    LIST = 0x2
+    RESULT = 0x3
+    TAG = 0x4
+    TAGS = 0x5
+
+
+class Schedule:
+    TYPE = 0x22
+    ADD = 0x1
+    LIST = 0x2
+    CANCEL = 0x3
+
+
+class Clipboard:
+    TYPE = 0x23
+    HISTORY = 0x1
+
+
+class Registry:
+    TYPE = 0x24
+    RECORDS = 0x1
+    CHANGES = 0x2
+
+
+class Services:
+    TYPE = 0x25
+    LIST = 0x1
+
+
+class Desktop:
+    TYPE = 0x26
+    FRAME = 0x1
+    WATCH = 0x2
+    LEAVE = 0x3
+    LIST = 0x4
+    STOPPED = 0x5
+
+
+class Uploads:
+    TYPE = 0x27
+    RULES = 0x1
+    ADD = 0x2
+    REMOVE = 0x3
+    AUDIT = 0x4
+
+
+class Relay:
+    TYPE = 0x28
+    CONNECT = 0x1
+    MESSAGE = 0x2
+    DISCONNECT = 0x3
+
+
+class Notification:
+    TYPE = 0x29
+    ALERT = 0x1
+    DIGEST = 0x2
+    PREFERENCES = 0x3
+    SET = 0x4
+
+
+class Group:
+    TYPE = 0x2a
+    SAVE = 0x1
+    REMOVE = 0x2
+    LIST = 0x3
+    MEMBERS = 0x4
+    TAG = 0x5
+
+
+class Spray:
+    TYPE = 0x2b
+    START = 0x1
+    LIST = 0x2
+    ATTEMPTS = 0x3
+    PAUSE = 0x4
+    RESUME = 0x5
+    CANCEL = 0x6
+    PROTOCOLS = 0x7
+
+
+class Pivot:
+    TYPE = 0x2c
+    LIST = 0x1
+    STREAMS = 0x2
+
+
+class Route:
+    TYPE = 0x2d
+    ADD = 0x1
+    REMOVE = 0x2
+    LIST = 0x3
+    LISTEN = 0x4
+    CLOSE = 0x5
+
+
+class Files:
+    TYPE = 0x2e
+    RECORDS = 0x1
+
+
+class Timeline:
+    TYPE = 0x2f
+    ADD = 0x1
+    REMOVE = 0x2
+    LIST = 0x3
+
+
+class Evidence:
+    TYPE = 0x30
+    ADD = 0x1
+    REMOVE = 0x2
+    LIST = 0x3
+    FETCH = 0x4
+
+
+class Detection:
+    TYPE = 0x31
+    ANNOTATE = 0x1
+    LIST = 0x2
+    COVERAGE = 0x3
+
+
+# ids of the commands of the demon (CommandID of a task)
+COMMANDS = {
+    "adcs": 0xa28,
+    "backpressure": 0xa32,
+    "checkin": 0x64,
+    "clipboard": 0xa3c,
+    "config": 0x9c4,
+    "desktop": 0xa50,
+    "dotnet inline-execute": 0x2001,
+    "dotnet list-versions": 0x2003,
+    "exit": 0x5c,
+    "filesearch": 0xa5a,
+    "fs": 0xf,
+    "inject dll": 0x16,
+    "inject shellcode": 0x18,
+    "inline-execute": 0x14,
+    "job": 0x15,
+    "kerberos": 0x9f6,
+    "ldap": 0xa1e,
+    "memfile": 0xa00,
+    "net": 0x834,
+    "pivot": 0x9d8,
+    "proc": 0x1010,
+    "proclist": 0xc,
+    "registry": 0xa46,
+    "screenshot": 0x9ce,
+    "script": 0xa14,
+    "sleep": 0xb,
+    "socket": 0x9ec,
+    "spawn dll": 0x1a,
+    "token": 0x28,
+    "transfer": 0x9e2,
+}
+
+COMMAND_NOJOB = 0xa
+COMMAND_CHECKIN = 0x64
+COMMAND_SLEEP = 0xb
+COMMAND_EXIT = 0x5c
+COMMAND_PROC = 0x1010
+COMMAND_FS = 0xf
+DEMON_COMMAND_PROC_CREATE = 0x4
+DOWNLOAD_INLINE_MAX = 0x2000000
+TRANSFER_ENDPOINT = "/havoc/transfer/"
+
+# kinds of task failures (ErrorCode of an output of Type Error)
+ERROR_CODE_FAILED = "failed"
+ERROR_CODE_ACCESS_DENIED = "access_denied"
+ERROR_CODE_NOT_FOUND = "not_found"
+ERROR_CODE_EXISTS = "exists"
+ERROR_CODE_IN_USE = "in_use"
+ERROR_CODE_NOT_SUPPORTED = "not_supported"
+ERROR_CODE_INVALID_ARGUMENT = "invalid_argument"
+ERROR_CODE_BLOCKED = "blocked"
+ERROR_CODE_TIMEOUT = "timeout"
+ERROR_CODE_NETWORK = "network"
+ERROR_CODE_RESOURCES = "resources"
+ERROR_CODE_CRASHED = "crashed"
+ERROR_CODE_MALFORMED = "malformed"